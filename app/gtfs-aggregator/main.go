@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"expvar"
 	"fmt"
-	"github.com/OpenTransitTools/transitcast/app/gtfs-aggregator/aggregator"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/systemevent"
 	"github.com/OpenTransitTools/transitcast/foundation/database"
+	"github.com/OpenTransitTools/transitcast/foundation/health"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
+	"github.com/OpenTransitTools/transitcast/foundation/profiling"
+	"github.com/OpenTransitTools/transitcast/pkg/predictor"
 	"github.com/ardanlabs/conf"
-	"github.com/nats-io/nats.go"
 	logger "log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 var build = "develop"
@@ -27,27 +36,118 @@ func run(log *logger.Logger) error {
 		conf.Version
 		Args conf.Args
 		DB   struct {
-			User       string `conf:"default:postgres"`
-			Password   string `conf:"default:postgres,noprint"`
-			Host       string `conf:"default:0.0.0.0"`
-			Name       string `conf:"default:postgres"`
-			DisableTLS bool   `conf:"default:true"`
+			User         string `conf:"default:postgres"`
+			Password     string `conf:"default:postgres,noprint"`
+			Host         string `conf:"default:0.0.0.0"`
+			Name         string `conf:"default:postgres"`
+			DisableTLS   bool   `conf:"default:true"`
+			SSLMode      string `conf:"help:Overrides the sslmode chosen by DisableTLS, for example verify-full"`
+			RootCertFile string `conf:"help:PEM file of certificate authorities used to verify the database server"`
+			CertFile     string `conf:"help:PEM client certificate used to authenticate with the database server"`
+			KeyFile      string `conf:"help:PEM key of the client certificate"`
+			Schema       string `conf:"help:Postgres schema holding the agency's tables when several agencies share the database"`
+			//QueryTimeoutSeconds limits how long any database query may run
+			QueryTimeoutSeconds int `conf:"default:30"`
 		}
 		NATS struct {
-			URL string `conf:"default:localhost"`
+			URL                       string `conf:"default:localhost"`
+			MaxReconnects             int    `conf:"default:-1,help:Reconnect attempts before giving up on a lost connection, negative values never give up"`
+			ReconnectWaitMilliseconds int    `conf:"default:500"`
+			MaxReconnectWaitSeconds   int    `conf:"default:30"`
+			ReconnectBufferBytes      int    `conf:"default:8388608"`
+			CredentialsFile           string `conf:"help:NATS user credentials file holding a user JWT and NKey seed"`
+			NKeySeedFile              string `conf:"help:File holding an NKey seed to authenticate with instead of a credentials file"`
+			RootCAFile                string `conf:"help:PEM file of certificate authorities used to verify the NATS server"`
+			CertFile                  string `conf:"help:PEM client certificate presented to the NATS server"`
+			KeyFile                   string `conf:"help:PEM key of the client certificate"`
+			Tenant                    string `conf:"help:Agency whose subjects are prefixed with <tenant>. when several agencies share NATS servers"`
+			Compression               string `conf:"default:none,help:Compression of published TripUpdate payloads which is one of none gzip or snappy"`
+			Encoding                  string `conf:"default:json,help:Encoding of published TripUpdate and inference request payloads, json or protobuf"`
+		}
+		Web struct {
+			DebugHost string `conf:"default:0.0.0.0:4001"`
+			Profiling bool   `conf:"default:false,help:Serve net/http/pprof profiles and execution traces under /debug/pprof/"`
+		}
+		Health struct {
+			CheckTimeoutSeconds int `conf:"default:5"`
+		}
+		Inference struct {
+			Transport              string   `conf:"default:nats,help:nats to request inference over NATS, sidecar to call the gRPC inference service at SidecarAddress or in-process to run ONNX models from OnnxModelDirectory"`
+			SidecarAddress         string   `conf:"default:localhost:50051,help:host:port of the sidecar serving the transitcast.Inference gRPC service"`
+			OnnxModelDirectory     string   `conf:"help:Directory of models exported as <model_name>_<version>.onnx run inside the aggregator"`
+			InProcessModelNames    []string `conf:"help:List model names separated by semicolons run from OnnxModelDirectory while other models use Transport."`
+			WarmUpMinutes          int      `conf:"default:60,help:Load the in process models used by trips scheduled this many minutes after startup before predicting, 0 loads models when first requested"`
+			MemoryBudgetMB         int      `conf:"default:0,help:Estimated megabytes of in process models kept loaded, least recently used models are removed beyond it, 0 is unlimited"`
+			TimeoutMilliseconds    int      `conf:"default:500"`
+			Retries                int      `conf:"default:2"`
+			RetryDelayMilliseconds int      `conf:"default:50"`
+			MaxConnections         int      `conf:"default:2,help:Number of gRPC connections to the sidecar that requests are spread across and sent concurrently on"`
+		}
+		Weather struct {
+			URL                 string   `conf:"help:Weather API returning current conditions as json. When set, the values at FeaturePaths are added to inference requests."`
+			FeaturePaths        []string `conf:"help:List dot separated paths to numeric values in the weather json separated by semicolons, for example current.precipitation;current.temperature_2m"`
+			CacheSeconds        int      `conf:"default:300"`
+			TimeoutMilliseconds int      `conf:"default:5000"`
 		}
 		ExpirePredictionSeconds               int      `conf:"default:8"`
 		MaximumObservedTransitionAgeInSeconds int      `conf:"default:3600"`
 		MinimumRMSEModelImprovement           float64  `conf:"default:0.0"`
 		MinimumObservedStopCount              int      `conf:"default:100"`
 		PredictionSubject                     string   `conf:"default:trip-update-prediction"`
+		PredictionSubjectRules                []string `conf:"help:List rules separated by semicolons publishing TripUpdates on another subject, as route_id:<route_id>=<subject> or route_type:<route_type>=<subject>."`
 		ExpirePredictorSeconds                int      `conf:"default:3600"`
+		RouteExpirePredictorSeconds           []string `conf:"help:List route_id:seconds separated by semicolons overriding ExpirePredictorSeconds for the route."`
+		RouteTypeExpirePredictorSeconds       []string `conf:"default:0:1800;1:1800,help:List route_type:seconds separated by semicolons overriding ExpirePredictorSeconds for trips with the route_type."`
 		LimitEarlyDepartureSeconds            int      `conf:"default:60"`
+		RouteTypeLimitEarlyDepartureSeconds   []string `conf:"default:0:0;1:0;2:0,help:List route_type:seconds separated by semicolons overriding LimitEarlyDepartureSeconds for trips with the route_type."`
+		RouteLimitEarlyDepartureSeconds       []string `conf:"help:List route_id:seconds separated by semicolons overriding LimitEarlyDepartureSeconds for the route, taking precedence over RouteTypeLimitEarlyDepartureSeconds."`
+		NonTimepointEarlyDeparture            string   `conf:"default:allow,help:Early departures from stops that aren't timepoints: allow, schedule to predict no earlier than scheduled or limit to predict no earlier than NonTimepointEarlyDepartureSeconds"`
+		NonTimepointEarlyDepartureSeconds     int      `conf:"default:0"`
+		RouteNonTimepointEarlyDeparture       []string `conf:"help:List route_id:policy separated by semicolons overriding NonTimepointEarlyDeparture for the route."`
+		PredictDwell                          bool     `conf:"default:false,help:Predict departures from stops with an average dwell computed by model-mgr tuneDwell"`
+		MinimumDwellSeconds                   int      `conf:"default:15,help:Least average dwell a stop needs for its departures to be predicted"`
+		PublishChangeThresholdSeconds         int      `conf:"default:0,help:Only publish TripUpdates changing a stop's prediction by more than this many seconds, or after PublishHeartbeatSeconds. 0 publishes every TripUpdate."`
+		PublishHeartbeatSeconds               int      `conf:"default:60"`
+		DelaySmoothingFactor                  float64  `conf:"default:1,help:Weight of a trip's newest delay when smoothing it with the delay last published for the trip. 1 disables smoothing."`
+		DelayHysteresisSeconds                int      `conf:"default:0,help:Ignore changes to a trip's delay of no more than this many seconds."`
+		RouteDelaySmoothing                   []string `conf:"help:List route_id:factor:seconds separated by semicolons overriding DelaySmoothingFactor and DelayHysteresisSeconds for the route."`
 		InferenceBuckets                      int      `conf:"default:8"`
 		MaximumPredictionMinutes              int      `conf:"default:60"`
 		IncludedRouteIds                      []string `conf:"help:List route_ids seperated by of semicolons. If included only trips for these route_ids will be predicted."`
 		MakePredictions                       bool     `conf:"default:true"`
 		UseStatistics                         bool     `conf:"default:true"`
+		TimepointOnlyRouteIds                 []string `conf:"help:List route_ids separated by semicolons. Trips on these route_ids are only predicted at timepoints, stops between timepoints are interpolated from the schedule."`
+		RecentObservationCount                int      `conf:"default:5"`
+		MinimumObservationConfidence          float64  `conf:"default:0,help:Ignore observed stop times scored by gtfs-monitor below this confidence, from 0.0 to 1.0, in features and recent travel times. 0 uses every observation."`
+		PredictionSourceStatsSubject          string   `conf:"default:prediction-source-stats"`
+		PredictionSourceStatsSeconds          int      `conf:"default:60"`
+		BackfillMinutes                       int      `conf:"default:60"`
+		RouteSilenceMinutes                   int      `conf:"default:15"`
+		RouteSilenceSubject                   string   `conf:"default:route-silence-alerts"`
+		ConsumerLagAlertSeconds               int      `conf:"default:30,help:Publish an alert when vehicle-monitor-results are processed more than this many seconds after the vehicle's position was recorded, or are dropped. 0 disables the alerts."`
+		ConsumerLagSubject                    string   `conf:"default:consumer-lag-alerts"`
+		DeviationHistoryMinutes               int      `conf:"default:30"`
+		ShedVehicleResults                    bool     `conf:"default:true,help:While a vehicle's results are being processed keep only the newest results received for it."`
+		TripOverrideSubject                   string   `conf:"default:trip-overrides,help:NATS subject dispatchers publish trip cancellations and holds on. Empty disables trip overrides."`
+		TripOverrideExpirationMinutes         int      `conf:"default:1440"`
+		ConnectionLookaheadMinutes            int      `conf:"default:0,help:Check connections at transfer points from trips predicted to arrive within this many minutes. 0 disables connection protection."`
+		ConnectionMaximumWaitMinutes          int      `conf:"default:15"`
+		ConnectionMinimumTransferSeconds      int      `conf:"default:60"`
+		ConnectionMarginSeconds               int      `conf:"default:60"`
+		ConnectionSameStopTransfers           bool     `conf:"default:true,help:Treat departures of other routes from the stop a trip arrives at as connections, in addition to transfers.txt."`
+		ConnectionSubject                     string   `conf:"default:connection-at-risk-alerts"`
+		MinimumLayoverSeconds                 int      `conf:"default:0"`
+		RouteMinimumLayoverSeconds            []string `conf:"help:List route_id:seconds separated by semicolons overriding MinimumLayoverSeconds for the route."`
+		ServiceExceptionFeatures              bool     `conf:"default:false,help:Include service added and service reduced flags from calendar_dates after the holiday feature in inference requests. Only enable when all models were trained with these features."`
+		TimeBucketFeature                     bool     `conf:"default:false,help:Include the time bucket recorded by model-mgr discover containing each request's time after the service exception features in inference requests. Only enable when all models were trained with this feature."`
+		PatternModels                         bool     `conf:"default:false,help:Predict with the model of each trip's stop pattern in the time bucket of each segment recorded by model-mgr discover when it has been trained and fall back to the models of its stops otherwise."`
+		ShadowEvaluation                      bool     `conf:"default:false,help:Send inference requests to shadow models alongside current models and record the differences to ml_model_shadow_comparison. Only current model predictions are published."`
+		CoalesceInferenceRequests             bool     `conf:"default:true,help:While a trip's prediction awaits inference hold newer predictions for the trip, sending only the newest once it completes or expires."`
+		InferenceTimeoutFallback              bool     `conf:"default:true,help:Publish predictions whose inference responses have not arrived after ExpirePredictionSeconds using the schedule for the stops without responses."`
+		InferenceGuardrailFactor              float64  `conf:"default:4,help:Reject inference responses more than this many times longer or shorter than the schedule in favor of the schedule. 0 disables the guardrail."`
+		ModelHealthWindow                     int      `conf:"default:200,help:Most recent predictions of each model compared with observed travel times to track its error. 0 disables model health tracking."`
+		ModelHealthMinimumSamples             int      `conf:"default:50,help:Compared predictions a model needs before it can be disabled"`
+		ModelHealthErrorRatio                 float64  `conf:"default:1.5,help:Disable a model and predict with the schedule when its mean error exceeds the schedule's by this factor"`
 	}
 	cfg.Version.SVN = build
 	cfg.Version.Desc = "Listens to vehicle data generated by gtfs-monitor, collects statistics, requests " +
@@ -77,6 +177,7 @@ func run(log *logger.Logger) error {
 	// App Starting
 
 	// Print the build version for our logs. Also expose it under /debug/vars.
+	expvar.NewString("build").Set(build)
 	log.Printf("main : Started : Application initializing : version %s", build)
 	defer log.Println("main: Completed")
 
@@ -86,17 +187,43 @@ func run(log *logger.Logger) error {
 	}
 	log.Printf("main: Config :\n%v\n", out)
 
+	// =========================================================================
+	// Start Debug Service
+	//
+	// /debug/vars - Exported metrics, including counts of stop updates by prediction source
+	// /healthz - Succeeds while the aggregator is running
+	// /readyz - Fails when the database, NATS or a schedule data set is unavailable
+	// /debug/pprof/ - CPU profiles and execution traces of the prediction pipeline, when enabled by Profiling
+
+	if cfg.Web.Profiling {
+		profiling.Register(http.DefaultServeMux)
+	}
+	checks := health.New(time.Duration(cfg.Health.CheckTimeoutSeconds) * time.Second)
+	checks.Register(http.DefaultServeMux)
+
+	log.Printf("main: Debug Listening %s", cfg.Web.DebugHost)
+	go func() {
+		if err := http.ListenAndServe(cfg.Web.DebugHost, http.DefaultServeMux); err != nil {
+			log.Printf("main: Debug Listener closed : %v", err)
+		}
+	}()
+
 	// =========================================================================
 	// Start Database
 
 	log.Println("main: Initializing database support")
 
 	db, err := database.Open(database.Config{
-		User:       cfg.DB.User,
-		Password:   cfg.DB.Password,
-		Host:       cfg.DB.Host,
-		Name:       cfg.DB.Name,
-		DisableTLS: cfg.DB.DisableTLS,
+		User:         cfg.DB.User,
+		Password:     cfg.DB.Password,
+		Host:         cfg.DB.Host,
+		Name:         cfg.DB.Name,
+		DisableTLS:   cfg.DB.DisableTLS,
+		SSLMode:      cfg.DB.SSLMode,
+		RootCertFile: cfg.DB.RootCertFile,
+		CertFile:     cfg.DB.CertFile,
+		KeyFile:      cfg.DB.KeyFile,
+		Schema:       cfg.DB.Schema,
 	})
 	if err != nil {
 		return fmt.Errorf("connecting to db: %w", err)
@@ -109,11 +236,77 @@ func run(log *logger.Logger) error {
 		}
 	}()
 
+	checks.AddReadiness("database", health.DatabaseCheck(db))
+	checks.AddReadiness("data_set", func(ctx context.Context) error {
+		_, err := gtfs.GetDataSetAt(ctx, db, time.Now())
+		return err
+	})
+
+	if cfg.Args.Num(0) == "simulate" {
+		cmd, err := parseSimulateCmd(cfg.Args)
+		if err != nil {
+			return err
+		}
+		tripUpdate, err := predictor.SimulatePrediction(context.Background(), log, db, predictor.SimulationConf{
+			TripId:                              cmd.tripId,
+			At:                                  cmd.at,
+			DelaySeconds:                        cmd.delaySeconds,
+			StubModelFactor:                     cmd.stubModelFactor,
+			MaximumPredictionMinutes:            cfg.MaximumPredictionMinutes,
+			LimitEarlyDepartureSeconds:          cfg.LimitEarlyDepartureSeconds,
+			RouteTypeLimitEarlyDepartureSeconds: cfg.RouteTypeLimitEarlyDepartureSeconds,
+			RouteLimitEarlyDepartureSeconds:     cfg.RouteLimitEarlyDepartureSeconds,
+			NonTimepointEarlyDeparture:          cfg.NonTimepointEarlyDeparture,
+			NonTimepointEarlyDepartureSeconds:   cfg.NonTimepointEarlyDepartureSeconds,
+			RouteNonTimepointEarlyDeparture:     cfg.RouteNonTimepointEarlyDeparture,
+			TimepointOnlyRouteIds:               cfg.TimepointOnlyRouteIds,
+		})
+		if err != nil {
+			return err
+		}
+		output, err := json.MarshalIndent(tripUpdate, "", " ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(output))
+		return nil
+	}
+
+	// =========================================================================
+	// Record start and stop in the system_event audit trail
+
+	queryTimeout := time.Duration(cfg.DB.QueryTimeoutSeconds) * time.Second
+	startCtx, cancelStart := context.WithTimeout(context.Background(), queryTimeout)
+	err = systemevent.RecordAppStart(startCtx, db, "gtfs-aggregator", build, out, time.Now())
+	cancelStart()
+	if err != nil {
+		log.Printf("main: unable to record start in system_event: %v", err)
+	}
+	defer func() {
+		stopCtx, cancelStop := context.WithTimeout(context.Background(), queryTimeout)
+		defer cancelStop()
+		if err := systemevent.RecordAppStop(stopCtx, db, "gtfs-aggregator", build, time.Now()); err != nil {
+			log.Printf("main: unable to record stop in system_event: %v", err)
+		}
+	}()
+
 	// =========================================================================
 	// Start nats
 
 	log.Printf("main: Connecting to NATS\n")
-	natsConnection, err := nats.Connect(cfg.NATS.URL)
+	natsConnection, err := natsclient.Connect(log, natsclient.Config{
+		URL:                  cfg.NATS.URL,
+		Name:                 "gtfs-aggregator",
+		MaxReconnects:        cfg.NATS.MaxReconnects,
+		ReconnectWait:        time.Duration(cfg.NATS.ReconnectWaitMilliseconds) * time.Millisecond,
+		MaxReconnectWait:     time.Duration(cfg.NATS.MaxReconnectWaitSeconds) * time.Second,
+		ReconnectBufferBytes: cfg.NATS.ReconnectBufferBytes,
+		CredentialsFile:      cfg.NATS.CredentialsFile,
+		NKeySeedFile:         cfg.NATS.NKeySeedFile,
+		RootCAFile:           cfg.NATS.RootCAFile,
+		CertFile:             cfg.NATS.CertFile,
+		KeyFile:              cfg.NATS.KeyFile,
+	})
 	if err != nil {
 		return fmt.Errorf("unable to establish connection to nats server: %w", err)
 	}
@@ -121,6 +314,7 @@ func run(log *logger.Logger) error {
 		log.Printf("main: closing connection to NATS")
 		natsConnection.Close()
 	}()
+	checks.AddReadiness("nats", health.NatsCheck(natsConnection))
 
 	// Make a channel to listen for an interrupt or terminate signal from the OS.
 	// Use a buffered channel because the signal package requires it.
@@ -128,24 +322,104 @@ func run(log *logger.Logger) error {
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
 	log.Printf("starting aggregator\n")
-	return aggregator.StartPredictionAggregator(log, db, shutdown, natsConnection,
-		aggregator.Conf{
+	return predictor.StartPredictionAggregator(log, db, shutdown, natsConnection,
+		predictor.Conf{
 			ExpirePredictionSeconds:               cfg.ExpirePredictionSeconds,
 			MaximumObservedTransitionAgeInSeconds: cfg.MaximumObservedTransitionAgeInSeconds,
 			MinimumRMSEModelImprovement:           cfg.MinimumRMSEModelImprovement,
 			MinimumObservedStopCount:              cfg.MinimumObservedStopCount,
 			PredictionSubject:                     cfg.PredictionSubject,
+			PredictionSubjectRules:                cfg.PredictionSubjectRules,
 			ExpirePredictorSeconds:                cfg.ExpirePredictorSeconds,
+			RouteExpirePredictorSeconds:           cfg.RouteExpirePredictorSeconds,
+			RouteTypeExpirePredictorSeconds:       cfg.RouteTypeExpirePredictorSeconds,
 			LimitEarlyDepartureSeconds:            cfg.LimitEarlyDepartureSeconds,
+			RouteTypeLimitEarlyDepartureSeconds:   cfg.RouteTypeLimitEarlyDepartureSeconds,
+			RouteLimitEarlyDepartureSeconds:       cfg.RouteLimitEarlyDepartureSeconds,
+			NonTimepointEarlyDeparture:            cfg.NonTimepointEarlyDeparture,
+			NonTimepointEarlyDepartureSeconds:     cfg.NonTimepointEarlyDepartureSeconds,
+			RouteNonTimepointEarlyDeparture:       cfg.RouteNonTimepointEarlyDeparture,
+			PredictDwell:                          cfg.PredictDwell,
+			MinimumDwellSeconds:                   cfg.MinimumDwellSeconds,
+			PublishChangeThresholdSeconds:         cfg.PublishChangeThresholdSeconds,
+			PublishHeartbeatSeconds:               cfg.PublishHeartbeatSeconds,
+			DelaySmoothingFactor:                  cfg.DelaySmoothingFactor,
+			DelayHysteresisSeconds:                cfg.DelayHysteresisSeconds,
+			RouteDelaySmoothing:                   cfg.RouteDelaySmoothing,
+			NATSCompression:                       cfg.NATS.Compression,
+			NATSEncoding:                          cfg.NATS.Encoding,
+			NATSTenant:                            cfg.NATS.Tenant,
 			InferenceBuckets:                      cfg.InferenceBuckets,
 			IncludedRouteIds:                      cfg.IncludedRouteIds,
 			MaximumPredictionMinutes:              cfg.MaximumPredictionMinutes,
 			MakePredictions:                       cfg.MakePredictions,
 			UseStatistics:                         cfg.UseStatistics,
+			TimepointOnlyRouteIds:                 cfg.TimepointOnlyRouteIds,
+			QueryTimeoutSeconds:                   cfg.DB.QueryTimeoutSeconds,
+			ShadowEvaluation:                      cfg.ShadowEvaluation,
+			CoalesceInferenceRequests:             cfg.CoalesceInferenceRequests,
+			InferenceTimeoutFallback:              cfg.InferenceTimeoutFallback,
+			InferenceGuardrailFactor:              cfg.InferenceGuardrailFactor,
+			ModelHealthWindow:                     cfg.ModelHealthWindow,
+			ModelHealthMinimumSamples:             cfg.ModelHealthMinimumSamples,
+			ModelHealthErrorRatio:                 cfg.ModelHealthErrorRatio,
+			App:                                   "gtfs-aggregator",
+			Version:                               build,
+			ServiceExceptionFeatures:              cfg.ServiceExceptionFeatures,
+			TimeBucketFeature:                     cfg.TimeBucketFeature,
+			PatternModels:                         cfg.PatternModels,
+			RecentObservationCount:                cfg.RecentObservationCount,
+			MinimumObservationConfidence:          cfg.MinimumObservationConfidence,
+			PredictionSourceStatsSubject:          cfg.PredictionSourceStatsSubject,
+			PredictionSourceStatsSeconds:          cfg.PredictionSourceStatsSeconds,
+			BackfillMinutes:                       cfg.BackfillMinutes,
+			RouteSilenceMinutes:                   cfg.RouteSilenceMinutes,
+			RouteSilenceSubject:                   cfg.RouteSilenceSubject,
+			ConsumerLagAlertSeconds:               cfg.ConsumerLagAlertSeconds,
+			ConsumerLagSubject:                    cfg.ConsumerLagSubject,
+			ShedVehicleResults:                    cfg.ShedVehicleResults,
+			DeviationHistoryMinutes:               cfg.DeviationHistoryMinutes,
+			TripOverrideSubject:                   cfg.TripOverrideSubject,
+			TripOverrideExpirationMinutes:         cfg.TripOverrideExpirationMinutes,
+			ConnectionLookaheadMinutes:            cfg.ConnectionLookaheadMinutes,
+			ConnectionMaximumWaitMinutes:          cfg.ConnectionMaximumWaitMinutes,
+			ConnectionMinimumTransferSeconds:      cfg.ConnectionMinimumTransferSeconds,
+			ConnectionMarginSeconds:               cfg.ConnectionMarginSeconds,
+			ConnectionSameStopTransfers:           cfg.ConnectionSameStopTransfers,
+			ConnectionSubject:                     cfg.ConnectionSubject,
+			MinimumLayoverSeconds:                 cfg.MinimumLayoverSeconds,
+			RouteMinimumLayoverSeconds:            cfg.RouteMinimumLayoverSeconds,
+			InferenceTransport:                    cfg.Inference.Transport,
+			DebugMux:                              http.DefaultServeMux,
+			SidecarInference: predictor.SidecarInferenceConf{
+				Address:                cfg.Inference.SidecarAddress,
+				TimeoutMilliseconds:    cfg.Inference.TimeoutMilliseconds,
+				Retries:                cfg.Inference.Retries,
+				RetryDelayMilliseconds: cfg.Inference.RetryDelayMilliseconds,
+				MaxConnections:         cfg.Inference.MaxConnections,
+			},
+			InProcessInference: predictor.InProcessInferenceConf{
+				ModelDirectory: cfg.Inference.OnnxModelDirectory,
+				ModelNames:     cfg.Inference.InProcessModelNames,
+				WarmUpMinutes:  cfg.Inference.WarmUpMinutes,
+				MemoryBudgetMB: cfg.Inference.MemoryBudgetMB,
+			},
+			WeatherEnrichment: predictor.WeatherEnrichmentConf{
+				URL:                 cfg.Weather.URL,
+				FeaturePaths:        cfg.Weather.FeaturePaths,
+				CacheSeconds:        cfg.Weather.CacheSeconds,
+				TimeoutMilliseconds: cfg.Weather.TimeoutMilliseconds,
+			},
 		})
 
 }
 
 func printUsage(confUsage string) {
 	fmt.Println(confUsage)
+	fmt.Println("commands:")
+	fmt.Println("(none): listen for trip deviations and publish predicted TripUpdates")
+	fmt.Println("simulate <tripID> <timestamp in yyyy-MM-ddTHH:mm:ssZ> <delay seconds> [stub model factor]: predict " +
+		"the trip for a vehicle running delay seconds behind schedule at timestamp and print the TripUpdate, " +
+		"using the schedule or a stub model answering inference with scheduled seconds times the factor")
+	fmt.Println("Note: in date formats Z is local time minus UTC, example -0700 for 7 hours")
 }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ardanlabs/conf"
+	"strconv"
+	"time"
+)
+
+// simulateCmd contains required arguments for simulate command execution
+type simulateCmd struct {
+	tripId          string
+	at              time.Time
+	delaySeconds    int
+	stubModelFactor float64
+}
+
+// parseSimulateCmd using conf.Args attempts to load simulateCmd, returns error if any arguments are not present or
+// malformed. The stub model factor is optional
+func parseSimulateCmd(args conf.Args) (*simulateCmd, error) {
+	tripId := args.Num(1)
+	if len(tripId) < 1 {
+		return nil, fmt.Errorf("expected tripId in position 1 with command simulate")
+	}
+	at, err := time.Parse("2006-01-02T15:04:05-0700", args.Num(2))
+	if err != nil {
+		return nil, fmt.Errorf("expected timestamp in yyyy-MM-ddTHH:mm:ss-0000 format in position 2 with command "+
+			"simulate, unable to parse %s", args.Num(2))
+	}
+	delaySeconds, err := strconv.Atoi(args.Num(3))
+	if err != nil {
+		return nil, fmt.Errorf("expected delay seconds in position 3 with command simulate, unable to parse %s",
+			args.Num(3))
+	}
+	cmd := simulateCmd{
+		tripId:       tripId,
+		at:           at,
+		delaySeconds: delaySeconds,
+	}
+	if factor := args.Num(4); len(factor) > 0 {
+		cmd.stubModelFactor, err = strconv.ParseFloat(factor, 64)
+		if err != nil || cmd.stubModelFactor <= 0 {
+			return nil, fmt.Errorf("expected stub model factor above zero in position 4 with command simulate, "+
+				"unable to parse %s", factor)
+		}
+	}
+	return &cmd, nil
+}
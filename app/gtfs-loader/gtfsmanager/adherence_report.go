@@ -0,0 +1,190 @@
+package gtfsmanager
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/jmoiron/sqlx"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// AdherenceConf sets how early or late a departure from a timepoint may be and still count as on time
+type AdherenceConf struct {
+	EarlySeconds int
+	LateSeconds  int
+}
+
+// adherenceCSVHeader is the header row of files written by WriteAdherenceReport
+var adherenceCSVHeader = []string{
+	"route_id",
+	"service_date",
+	"early",
+	"on_time",
+	"late",
+	"observed",
+	"on_time_percent",
+}
+
+// routeDayAdherence counts timepoint departures on a route on one service date by schedule adherence
+type routeDayAdherence struct {
+	routeId     string
+	serviceDate time.Time
+	early       int
+	onTime      int
+	late        int
+}
+
+type routeDayKey struct {
+	routeId     string
+	serviceDate string
+}
+
+// adherenceTally collects routeDayAdherence from observations
+type adherenceTally struct {
+	conf     AdherenceConf
+	location *time.Location
+	days     map[routeDayKey]*routeDayAdherence
+}
+
+func makeAdherenceTally(conf AdherenceConf, location *time.Location) *adherenceTally {
+	return &adherenceTally{
+		conf:     conf,
+		location: location,
+		days:     make(map[routeDayKey]*routeDayAdherence),
+	}
+}
+
+// add counts observation if it departed a timepoint on its scheduled trip
+func (a *adherenceTally) add(observation *gtfs.ScheduledObservedStopTime) {
+	if observation.Timepoint == nil || *observation.Timepoint != 1 || observation.ScheduledDepartureTime == nil {
+		return
+	}
+	departedAt := observation.ObservedTime.Add(time.Duration(-observation.TravelSeconds) * time.Second).In(a.location)
+	serviceDate, deviation := scheduleDeviation(departedAt, *observation.ScheduledDepartureTime)
+	key := routeDayKey{routeId: observation.RouteId, serviceDate: serviceDate.Format("2006-01-02")}
+	day, present := a.days[key]
+	if !present {
+		day = &routeDayAdherence{routeId: observation.RouteId, serviceDate: serviceDate}
+		a.days[key] = day
+	}
+	if deviation < -a.conf.EarlySeconds {
+		day.early++
+	} else if deviation > a.conf.LateSeconds {
+		day.late++
+	} else {
+		day.onTime++
+	}
+}
+
+// results returns routeDayAdherence ordered by route and service date
+func (a *adherenceTally) results() []*routeDayAdherence {
+	results := make([]*routeDayAdherence, 0, len(a.days))
+	for _, day := range a.days {
+		results = append(results, day)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].routeId != results[j].routeId {
+			return results[i].routeId < results[j].routeId
+		}
+		return results[i].serviceDate.Before(results[j].serviceDate)
+	})
+	return results
+}
+
+// scheduleDeviation finds the service date that places scheduleSeconds closest to departedAt, either the day
+// departedAt occurred or the day before for schedules past midnight. Returns the service date and seconds departedAt
+// was after the scheduled time, negative when early
+func scheduleDeviation(departedAt time.Time, scheduleSeconds int) (time.Time, int) {
+	serviceDate := gtfs.Get12AmTime(departedAt)
+	deviation := int(departedAt.Sub(gtfs.MakeScheduleTime(serviceDate, scheduleSeconds)).Seconds())
+	previousDate := serviceDate.AddDate(0, 0, -1)
+	previousDeviation := int(departedAt.Sub(gtfs.MakeScheduleTime(previousDate, scheduleSeconds)).Seconds())
+	if absInt(previousDeviation) < absInt(deviation) {
+		return previousDate, previousDeviation
+	}
+	return serviceDate, deviation
+}
+
+func absInt(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+// adherenceCSVRecord formats day in the column order of adherenceCSVHeader
+func adherenceCSVRecord(day *routeDayAdherence) []string {
+	observed := day.early + day.onTime + day.late
+	onTimePercent := 0.0
+	if observed > 0 {
+		onTimePercent = float64(day.onTime) * 100 / float64(observed)
+	}
+	return []string{
+		day.routeId,
+		day.serviceDate.Format("2006-01-02"),
+		strconv.Itoa(day.early),
+		strconv.Itoa(day.onTime),
+		strconv.Itoa(day.late),
+		strconv.Itoa(observed),
+		strconv.FormatFloat(onTimePercent, 'f', 1, 64),
+	}
+}
+
+// WriteAdherenceReport counts departures from timepoints observed from start up to end as early, on time or late
+// according to conf for each route and service date, and writes the counts to destinationFile in csv format.
+// Service dates are in the time zone of the DataSet active at start.
+// When routeIds is not empty only those routes are included
+func WriteAdherenceReport(ctx context.Context,
+	log *log.Logger,
+	db *sqlx.DB,
+	start time.Time,
+	end time.Time,
+	routeIds []string,
+	conf AdherenceConf,
+	destinationFile string) error {
+	dataSet, err := gtfs.GetDataSetAt(ctx, db, start)
+	if err != nil {
+		return err
+	}
+	tally := makeAdherenceTally(conf, dataSet.Location())
+	err = gtfs.ForEachScheduledObservedStopTime(ctx, db, start, end, routeIds,
+		func(observation *gtfs.ScheduledObservedStopTime) error {
+			tally.add(observation)
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(destinationFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	writer := csv.NewWriter(file)
+	err = writer.Write(adherenceCSVHeader)
+	if err != nil {
+		return err
+	}
+	days := tally.results()
+	for _, day := range days {
+		err = writer.Write(adherenceCSVRecord(day))
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	err = writer.Error()
+	if err != nil {
+		return fmt.Errorf("unable to write adherence report to %s: %w", destinationFile, err)
+	}
+	log.Printf("wrote schedule adherence for %d route service days to %s", len(days), destinationFile)
+	return file.Close()
+}
@@ -0,0 +1,99 @@
+package gtfsmanager
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_scheduleDeviation(t *testing.T) {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatalf("Unable to get testing time zone location")
+	}
+	tests := []struct {
+		name            string
+		departedAt      time.Time
+		scheduleSeconds int
+		wantServiceDate time.Time
+		wantDeviation   int
+	}{
+		{
+			name:            "late departure",
+			departedAt:      time.Date(2022, 5, 22, 12, 2, 0, 0, location),
+			scheduleSeconds: 12 * 3600,
+			wantServiceDate: time.Date(2022, 5, 22, 0, 0, 0, 0, location),
+			wantDeviation:   120,
+		},
+		{
+			name:            "early departure",
+			departedAt:      time.Date(2022, 5, 22, 11, 59, 0, 0, location),
+			scheduleSeconds: 12 * 3600,
+			wantServiceDate: time.Date(2022, 5, 22, 0, 0, 0, 0, location),
+			wantDeviation:   -60,
+		},
+		{
+			name:            "after midnight on previous service date",
+			departedAt:      time.Date(2022, 5, 23, 0, 31, 0, 0, location),
+			scheduleSeconds: 24*3600 + 30*60,
+			wantServiceDate: time.Date(2022, 5, 22, 0, 0, 0, 0, location),
+			wantDeviation:   60,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotServiceDate, gotDeviation := scheduleDeviation(tt.departedAt, tt.scheduleSeconds)
+			if !gotServiceDate.Equal(tt.wantServiceDate) {
+				t.Errorf("scheduleDeviation() serviceDate = %v, want %v", gotServiceDate, tt.wantServiceDate)
+			}
+			if gotDeviation != tt.wantDeviation {
+				t.Errorf("scheduleDeviation() deviation = %v, want %v", gotDeviation, tt.wantDeviation)
+			}
+		})
+	}
+}
+
+func Test_adherenceTally(t *testing.T) {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatalf("Unable to get testing time zone location")
+	}
+	timepoint := 1
+	notTimepoint := 0
+	scheduledDeparture := 12 * 3600
+	observation := func(routeId string, departedAt time.Time, timepoint *int) *gtfs.ScheduledObservedStopTime {
+		return &gtfs.ScheduledObservedStopTime{
+			ObservedStopTime: gtfs.ObservedStopTime{
+				ObservedTime:  departedAt.Add(30 * time.Second),
+				RouteId:       routeId,
+				TravelSeconds: 30,
+			},
+			Timepoint:              timepoint,
+			ScheduledDepartureTime: &scheduledDeparture,
+		}
+	}
+	noon := time.Date(2022, 5, 22, 12, 0, 0, 0, location)
+	tally := makeAdherenceTally(AdherenceConf{EarlySeconds: 60, LateSeconds: 300}, location)
+	tally.add(observation("100", noon.Add(-61*time.Second), &timepoint))
+	tally.add(observation("100", noon.Add(-60*time.Second), &timepoint))
+	tally.add(observation("100", noon.Add(300*time.Second), &timepoint))
+	tally.add(observation("100", noon.Add(301*time.Second), &timepoint))
+	tally.add(observation("100", noon.Add(time.Hour), &notTimepoint))
+	tally.add(observation("100", noon.Add(time.Hour), nil))
+	tally.add(observation("90", noon.AddDate(0, 0, 1), &timepoint))
+	tally.add(observation("100", noon.AddDate(0, 0, -1), &timepoint))
+
+	var got [][]string
+	for _, day := range tally.results() {
+		got = append(got, adherenceCSVRecord(day))
+	}
+	want := [][]string{
+		{"100", "2022-05-21", "0", "1", "0", "1", "100.0"},
+		{"100", "2022-05-22", "1", "2", "1", "4", "50.0"},
+		{"90", "2022-05-23", "0", "1", "0", "1", "100.0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("adherence results = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,32 @@
+package gtfsmanager
+
+import (
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"time"
+)
+
+// agencyTimezoneRowReader implements gtfsRowReader interface, collecting the agency_timezone shared by all agencies in
+// agency.txt. agencies are not recorded, their time zone is saved on the gtfs.DataSet
+type agencyTimezoneRowReader struct {
+	timezone string
+}
+
+func (a *agencyTimezoneRowReader) addRow(parser *gtfsFileParser, _ *gtfs.DataSetTransaction) error {
+	timezone := parser.getString("agency_timezone", false)
+	if err := parser.getError(); err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("unknown agency_timezone %q: %w", timezone, err)
+	}
+	if a.timezone != "" && a.timezone != timezone {
+		return fmt.Errorf("all agencies must have the same agency_timezone, found %s and %s", a.timezone, timezone)
+	}
+	a.timezone = timezone
+	return nil
+}
+
+func (a *agencyTimezoneRowReader) flush(_ *gtfs.DataSetTransaction) error {
+	return nil
+}
@@ -0,0 +1,58 @@
+package gtfsmanager
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func Test_agencyTimezoneRowReader(t *testing.T) {
+	agencyRR := &agencyTimezoneRowReader{}
+	addTestRows(t, "agency_id,agency_name,agency_url,agency_timezone\n"+
+		"TRIMET,TriMet,https://trimet.org,America/Los_Angeles\n"+
+		"PSC,Portland Streetcar,https://portlandstreetcar.org,America/Los_Angeles\n", agencyRR)
+	if agencyRR.timezone != "America/Los_Angeles" {
+		t.Errorf("timezone = %q, want America/Los_Angeles", agencyRR.timezone)
+	}
+}
+
+func Test_agencyTimezoneRowReader_invalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		csvContent string
+	}{
+		{
+			name: "agencies in different time zones",
+			csvContent: "agency_id,agency_name,agency_url,agency_timezone\n" +
+				"TRIMET,TriMet,https://trimet.org,America/Los_Angeles\n" +
+				"BVG,BVG,https://bvg.de,Europe/Berlin\n",
+		},
+		{
+			name: "unknown time zone",
+			csvContent: "agency_id,agency_name,agency_url,agency_timezone\n" +
+				"TRIMET,TriMet,https://trimet.org,America/Portland\n",
+		},
+		{
+			name: "missing time zone",
+			csvContent: "agency_id,agency_name,agency_url,agency_timezone\n" +
+				"TRIMET,TriMet,https://trimet.org,\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := makeGTFSFileParser(strings.NewReader(tt.csvContent), "agency.txt")
+			if err != nil {
+				t.Fatalf("Unable to make gtfsFileParser %s", err)
+			}
+			agencyRR := &agencyTimezoneRowReader{}
+			for err == nil {
+				if err = parser.nextLine(); err == nil {
+					err = agencyRR.addRow(parser, nil)
+				}
+			}
+			if err == io.EOF {
+				t.Errorf("addRow() expected error")
+			}
+		})
+	}
+}
@@ -4,18 +4,24 @@ import (
 	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
 )
 
-// calendarRowReader implements gtfsRowReader interface for gtfs.CalendarDate
-type calendarDateRowReader struct{}
+// calendarDateRowReader implements gtfsRowReader interface for gtfs.CalendarDate
+// the service_id of each calendar date adding service is added to serviceIds
+type calendarDateRowReader struct {
+	serviceIds map[string]bool
+}
 
-func (c calendarDateRowReader) addRow(parser *gtfsFileParser, dsTx *gtfs.DataSetTransaction) error {
+func (c *calendarDateRowReader) addRow(parser *gtfsFileParser, dsTx *gtfs.DataSetTransaction) error {
 	calendarDate, err := buildCalendarDate(parser)
 	if err != nil {
 		return err
 	}
+	if calendarDate.ExceptionType == 1 {
+		c.serviceIds[calendarDate.ServiceId] = true
+	}
 	return gtfs.RecordCalendarDate(calendarDate, dsTx)
 }
 
-func (c calendarDateRowReader) flush(_ *gtfs.DataSetTransaction) error {
+func (c *calendarDateRowReader) flush(_ *gtfs.DataSetTransaction) error {
 	return nil
 }
 
@@ -2,10 +2,13 @@ package gtfsmanager
 
 import (
 	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"sort"
 )
 
 // calendarRowReader implements gtfsRowReader interface for gtfs.Calendar
+// the service_id of each calendar is added to serviceIds
 type calendarRowReader struct {
+	serviceIds map[string]bool
 }
 
 func (r *calendarRowReader) addRow(parser *gtfsFileParser, dsTx *gtfs.DataSetTransaction) error {
@@ -13,6 +16,7 @@ func (r *calendarRowReader) addRow(parser *gtfsFileParser, dsTx *gtfs.DataSetTra
 	if err != nil {
 		return err
 	}
+	r.serviceIds[calendar.ServiceId] = true
 	return gtfs.RecordCalendar(calendar, dsTx)
 }
 
@@ -36,3 +40,16 @@ func buildCalendar(parser *gtfsFileParser) (*gtfs.Calendar, error) {
 
 	return &calendar, parser.getError()
 }
+
+// undefinedServiceIds returns the sorted serviceIds in tripServiceIds missing from definedServiceIds, the service_ids
+// in calendar.txt and calendar_dates.txt. Trips with these service_ids are never scheduled
+func undefinedServiceIds(tripServiceIds map[string]bool, definedServiceIds map[string]bool) []string {
+	results := make([]string, 0)
+	for serviceId := range tripServiceIds {
+		if !definedServiceIds[serviceId] {
+			results = append(results, serviceId)
+		}
+	}
+	sort.Strings(results)
+	return results
+}
@@ -73,3 +73,30 @@ func Test_buildCalendar(t *testing.T) {
 		})
 	}
 }
+
+func Test_undefinedServiceIds(t *testing.T) {
+	tripServiceIds := map[string]bool{"W": true, "S": true, "20220522": true, "X": true}
+	tests := []struct {
+		name              string
+		definedServiceIds map[string]bool
+		want              []string
+	}{
+		{
+			name:              "calendar only feed",
+			definedServiceIds: map[string]bool{"W": true, "S": true},
+			want:              []string{"20220522", "X"},
+		},
+		{
+			name:              "calendar_dates only feed",
+			definedServiceIds: map[string]bool{"20220522": true, "W": true, "S": true, "X": true},
+			want:              []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := undefinedServiceIds(tripServiceIds, tt.definedServiceIds); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("undefinedServiceIds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
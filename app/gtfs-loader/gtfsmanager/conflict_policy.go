@@ -0,0 +1,164 @@
+package gtfsmanager
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ConflictPolicy decides what is loaded when rows in a gtfs file share the key of another row, such as two rows in
+// trips.txt with the same trip_id
+type ConflictPolicy string
+
+const (
+	// ConflictFail stops the load at the first duplicate row
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictKeepFirst loads the first row with each key and skips the rest
+	ConflictKeepFirst ConflictPolicy = "keep-first"
+	// ConflictKeepLast loads the last row with each key and skips the rest. Files are read an extra time to find the
+	// last row of each key before they are loaded
+	ConflictKeepLast ConflictPolicy = "keep-last"
+)
+
+// ParseConflictPolicy returns the ConflictPolicy named by policy
+func ParseConflictPolicy(policy string) (ConflictPolicy, error) {
+	switch ConflictPolicy(policy) {
+	case ConflictFail, ConflictKeepFirst, ConflictKeepLast:
+		return ConflictPolicy(policy), nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q, expected %s, %s or %s", policy, ConflictFail,
+		ConflictKeepFirst, ConflictKeepLast)
+}
+
+// rowKeyColumns are the columns identifying a row in each gtfs file recorded to a table with a primary key
+var rowKeyColumns = map[string][]string{
+	"calendar.txt":       {"service_id"},
+	"calendar_dates.txt": {"service_id", "date"},
+	"trips.txt":          {"trip_id"},
+	"stop_times.txt":     {"trip_id", "stop_sequence"},
+	"shapes.txt":         {"shape_id", "shape_pt_sequence"},
+	"pathways.txt":       {"pathway_id"},
+}
+
+// duplicateRows applies a ConflictPolicy to the rows of gtfs files as they are loaded, counting the duplicate rows
+// skipped in each file
+type duplicateRows struct {
+	policy ConflictPolicy
+	// keys holds the number of rows read with each key in the current file, or with ConflictKeepLast the number of
+	// rows with each key still to be read
+	keys map[string]int
+	// skipped is the number of duplicate rows skipped in each file
+	skipped map[string]int
+}
+
+// makeDuplicateRows builds duplicateRows applying policy
+func makeDuplicateRows(policy ConflictPolicy) *duplicateRows {
+	return &duplicateRows{
+		policy:  policy,
+		skipped: make(map[string]int),
+	}
+}
+
+// rowKey returns the key of the current row of parser and true, or false if rows of the file are not checked
+func rowKey(parser *gtfsFileParser) (string, bool) {
+	columns, present := rowKeyColumns[parser.Filename]
+	if !present {
+		return "", false
+	}
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		value, _ := findValue(column, parser.currentRecords, parser.headers, true)
+		if value != nil {
+			values[i] = strings.TrimSpace(*value)
+		}
+	}
+	return strings.Join(values, "\x00"), true
+}
+
+// begin prepares to check the rows of f. With ConflictKeepLast f is read to count the rows with each key.
+// nil duplicateRows check no rows
+func (d *duplicateRows) begin(f *zip.File) error {
+	if d == nil {
+		return nil
+	}
+	d.keys = make(map[string]int)
+	if d.policy != ConflictKeepLast {
+		return nil
+	}
+	if _, present := rowKeyColumns[f.Name]; !present {
+		return nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	parser, err := makeGTFSFileParser(rc, f.Name)
+	if err != nil {
+		return err
+	}
+	for {
+		err = parser.nextLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		key, _ := rowKey(parser)
+		d.keys[key]++
+	}
+}
+
+// include returns true if the current row of parser should be loaded according to the ConflictPolicy.
+// returns an error on a duplicate row with ConflictFail. nil duplicateRows include every row
+func (d *duplicateRows) include(parser *gtfsFileParser) (bool, error) {
+	if d == nil {
+		return true, nil
+	}
+	key, checked := rowKey(parser)
+	if !checked {
+		return true, nil
+	}
+	if d.policy == ConflictKeepLast {
+		d.keys[key]--
+		if d.keys[key] > 0 {
+			d.skipped[parser.Filename]++
+			return false, nil
+		}
+		return true, nil
+	}
+	d.keys[key]++
+	if d.keys[key] == 1 {
+		return true, nil
+	}
+	if d.policy == ConflictFail {
+		return false, fmt.Errorf("duplicate row with %s %s, use a keep-first or keep-last conflict policy to "+
+			"load the file", strings.Join(rowKeyColumns[parser.Filename], ","),
+			strings.ReplaceAll(key, "\x00", ","))
+	}
+	d.skipped[parser.Filename]++
+	return false, nil
+}
+
+// summary describes the duplicate rows skipped in each file
+func (d *duplicateRows) summary() string {
+	if len(d.skipped) == 0 {
+		return "no duplicate rows found"
+	}
+	files := make([]string, 0, len(d.skipped))
+	for file := range d.skipped {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	counts := make([]string, len(files))
+	for i, file := range files {
+		counts[i] = fmt.Sprintf("%s:%d", file, d.skipped[file])
+	}
+	return fmt.Sprintf("skipped duplicate rows keeping the %s row with each key in %s",
+		strings.TrimPrefix(string(d.policy), "keep-"), strings.Join(counts, ", "))
+}
@@ -0,0 +1,114 @@
+package gtfsmanager
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"reflect"
+	"testing"
+)
+
+// tripHeadsignRowReader collects the trip_id and trip_headsign of each row read
+type tripHeadsignRowReader struct {
+	rows []string
+}
+
+func (r *tripHeadsignRowReader) addRow(parser *gtfsFileParser, _ *gtfs.DataSetTransaction) error {
+	r.rows = append(r.rows, parser.getString("trip_id", false)+":"+parser.getString("trip_headsign", false))
+	return parser.getError()
+}
+
+func (r *tripHeadsignRowReader) flush(_ *gtfs.DataSetTransaction) error {
+	return nil
+}
+
+// makeTestZipFile builds a zip file containing fileName with contents
+func makeTestZipFile(t *testing.T, fileName string, contents string) *zip.File {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	fileWriter, err := writer.Create(fileName)
+	if err == nil {
+		_, err = fileWriter.Write([]byte(contents))
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		t.Fatalf("unable to write zip file: %v", err)
+	}
+	zipReader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatalf("unable to read zip file: %v", err)
+	}
+	return zipReader.File[0]
+}
+
+func Test_duplicateRows(t *testing.T) {
+	trips := "trip_id,trip_headsign\n" +
+		"1,first\n" +
+		"2,only\n" +
+		"1,second\n" +
+		"1,third\n"
+	tests := []struct {
+		policy      ConflictPolicy
+		wantErr     bool
+		wantRows    []string
+		wantSummary string
+	}{
+		{
+			policy:  ConflictFail,
+			wantErr: true,
+		},
+		{
+			policy:      ConflictKeepFirst,
+			wantRows:    []string{"1:first", "2:only"},
+			wantSummary: "skipped duplicate rows keeping the first row with each key in trips.txt:2",
+		},
+		{
+			policy:      ConflictKeepLast,
+			wantRows:    []string{"2:only", "1:third"},
+			wantSummary: "skipped duplicate rows keeping the last row with each key in trips.txt:2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			duplicates := makeDuplicateRows(tt.policy)
+			rowReader := &tripHeadsignRowReader{}
+			err := loadGtfsFile(nil, rowReader, makeTestZipFile(t, "trips.txt", trips), duplicates)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadGtfsFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(rowReader.rows, tt.wantRows) {
+				t.Errorf("loaded rows = %v, want %v", rowReader.rows, tt.wantRows)
+			}
+			if got := duplicates.summary(); got != tt.wantSummary {
+				t.Errorf("summary() = %q, want %q", got, tt.wantSummary)
+			}
+		})
+	}
+}
+
+func Test_duplicateRows_uncheckedFile(t *testing.T) {
+	duplicates := makeDuplicateRows(ConflictFail)
+	rowReader := &tripHeadsignRowReader{}
+	err := loadGtfsFile(nil, rowReader, makeTestZipFile(t, "routes.txt",
+		"trip_id,trip_headsign\n1,first\n1,second\n"), duplicates)
+	if err != nil {
+		t.Fatalf("loadGtfsFile() error = %v", err)
+	}
+	if len(rowReader.rows) != 2 || duplicates.summary() != "no duplicate rows found" {
+		t.Errorf("rows in files without a key were checked for duplicates: %v", rowReader.rows)
+	}
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	if got, err := ParseConflictPolicy("keep-last"); err != nil || got != ConflictKeepLast {
+		t.Errorf("ParseConflictPolicy(keep-last) = %v, %v", got, err)
+	}
+	if _, err := ParseConflictPolicy("keep-all"); err == nil {
+		t.Errorf("ParseConflictPolicy(keep-all) expected error")
+	}
+}
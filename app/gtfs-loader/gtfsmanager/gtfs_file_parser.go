@@ -333,9 +333,12 @@ func timeFromYYYYMMDD(dateString string) (time.Time, error) {
 	return result, err
 }
 
-// loadGTFSRows iterates over all rows in gtfsFileParser and feeds them into rowReader.
-// reading halts if an error occurs and the error is returned
-func loadGTFSRows(dsTx *gtfs.DataSetTransaction, parser *gtfsFileParser, rowReader gtfsRowReader) error {
+// loadGTFSRows iterates over all rows in gtfsFileParser and feeds them into rowReader, skipping rows duplicates
+// excludes. reading halts if an error occurs and the error is returned
+func loadGTFSRows(dsTx *gtfs.DataSetTransaction,
+	parser *gtfsFileParser,
+	rowReader gtfsRowReader,
+	duplicates *duplicateRows) error {
 
 	for {
 		err := parser.nextLine()
@@ -347,7 +350,10 @@ func loadGTFSRows(dsTx *gtfs.DataSetTransaction, parser *gtfsFileParser, rowRead
 			return err
 		}
 
-		err = rowReader.addRow(parser, dsTx)
+		include, err := duplicates.include(parser)
+		if err == nil && include {
+			err = rowReader.addRow(parser, dsTx)
+		}
 
 		if err != nil {
 			parser.addParseError(err)
@@ -359,10 +365,17 @@ func loadGTFSRows(dsTx *gtfs.DataSetTransaction, parser *gtfsFileParser, rowRead
 }
 
 // loadGtfsZipFile reads local zip file at localGTFSFilePath, uncompresses the files inside, if a gtfsRowReader
-// is available for the file its used to read and record the file.
+// is available for the file its used to read and record the file through load.
 // reading halts if an error occurs and the error is returned.
+// stop times are sent to copier when it's present, rows with duplicate keys are resolved with conflictPolicy,
+// and only routeIds are loaded when any are present
 // returns list of files that have been read.
-func loadGtfsZipFile(log *log.Logger, gtfsDataSetTx *gtfs.DataSetTransaction, localGTFSFilePath string) error {
+func loadGtfsZipFile(log *log.Logger,
+	load *stagedLoad,
+	localGTFSFilePath string,
+	copier *stopTimeCopier,
+	conflictPolicy ConflictPolicy,
+	routeIds []string) error {
 
 	r, err := zip.OpenReader(localGTFSFilePath)
 	if err != nil {
@@ -376,27 +389,47 @@ func loadGtfsZipFile(log *log.Logger, gtfsDataSetTx *gtfs.DataSetTransaction, lo
 		}
 	}()
 
-	files, err := newGTFSFiles(log, r)
+	return loadGtfsZip(log, load, &r.Reader, copier, conflictPolicy, routeIds)
+}
+
+// loadGtfsZip reads each file in zipReader that has a gtfsRowReader available as it's uncompressed, without
+// extracting the file first.
+// stop times are sent to copier when it's present, rows with duplicate keys are resolved with conflictPolicy,
+// and only routeIds are loaded when any are present
+// reading halts if an error occurs and the error is returned.
+func loadGtfsZip(log *log.Logger,
+	load *stagedLoad,
+	zipReader *zip.Reader,
+	copier *stopTimeCopier,
+	conflictPolicy ConflictPolicy,
+	routeIds []string) error {
+
+	files, err := newGTFSFiles(log, zipReader)
 
 	if err != nil {
 		return err
 	}
 
-	return loadGtfsFiles(files, gtfsDataSetTx)
+	return loadGtfsFiles(log, files, load, copier, conflictPolicy, routeIds)
 }
 
 // gtfsFiles holds all gtfs files that we know how to load
 type gtfsFiles struct {
+	agencyFile       *zip.File
 	calendarFile     *zip.File
 	calendarDateFile *zip.File
 	tripFile         *zip.File
+	routeFile        *zip.File
 	stopTimeFile     *zip.File
 	shapeFile        *zip.File
+	stopFile         *zip.File
+	transferFile     *zip.File
+	pathwayFile      *zip.File
 }
 
 // newGTFSFiles creates new set of gtfsRowReaders for gtfs file in zipReader
 // returns error if any files are missing
-func newGTFSFiles(log *log.Logger, zipReader *zip.ReadCloser) (*gtfsFiles, error) {
+func newGTFSFiles(log *log.Logger, zipReader *zip.Reader) (*gtfsFiles, error) {
 	readers := gtfsFiles{}
 	//iterate over each file
 	for _, f := range zipReader.File {
@@ -405,16 +438,26 @@ func newGTFSFiles(log *log.Logger, zipReader *zip.ReadCloser) (*gtfsFiles, error
 			continue
 		}
 		switch f.Name {
+		case "agency.txt":
+			readers.agencyFile = f
 		case "calendar.txt":
 			readers.calendarFile = f
 		case "calendar_dates.txt":
 			readers.calendarDateFile = f
 		case "trips.txt":
 			readers.tripFile = f
+		case "routes.txt":
+			readers.routeFile = f
 		case "stop_times.txt":
 			readers.stopTimeFile = f
 		case "shapes.txt":
 			readers.shapeFile = f
+		case "stops.txt":
+			readers.stopFile = f
+		case "transfers.txt":
+			readers.transferFile = f
+		case "pathways.txt":
+			readers.pathwayFile = f
 		}
 	}
 	missingFiles := getMissingFiles(&readers)
@@ -450,45 +493,193 @@ func getMissingFiles(readers *gtfsFiles) []string {
 }
 
 func printWarningOnOptionalMissingFiles(log *log.Logger, readers *gtfsFiles) {
+	if readers.agencyFile == nil {
+		log.Printf("Warning: without agency.txt file schedule times will be in the local time zone")
+	}
 	if readers.calendarFile == nil {
-		log.Printf("Warning: without calendar.txt file future trips may not be loaded resulting " +
-			"in missing trip deviation records for training")
+		log.Printf("No calendar.txt file, service is scheduled only on the dates in calendar_dates.txt")
+	}
+	if readers.routeFile == nil {
+		log.Printf("Warning: without routes.txt file trips will be loaded without route_type")
+	}
+}
+
+//loadGtfsFiles loads gtfsFiles in order required by gtfsRowReaders.
+//the agency_timezone from agency.txt is set as the gtfs.DataSet Timezone. Service may be defined by calendar.txt,
+//calendar_dates.txt or both, trips with a service_id in neither are loaded but logged as never being scheduled.
+//when stop_times.txt is missing shape_dist_traveled the distances are calculated from the location of each stop in
+//stops.txt along its trip's shape after the trips are read. Each trip is saved with its route's route_type from routes.txt
+//when routeIds are present trips.txt is read first to find the trips and shapes on those routes, and only they are loaded
+//rows sharing the key of another row in their file are resolved with conflictPolicy, and the duplicates skipped logged
+//once loading completes
+//each file is recorded in its own transaction through load, files recorded by an earlier attempt are skipped and the
+//details later files need from them retrieved from the database instead
+func loadGtfsFiles(log *log.Logger,
+	files *gtfsFiles,
+	load *stagedLoad,
+	copier *stopTimeCopier,
+	conflictPolicy ConflictPolicy,
+	routeIds []string) error {
+	duplicates := makeDuplicateRows(conflictPolicy)
+	routes, err := loadRouteFilter(files, routeIds)
+	if err != nil {
+		return err
 	}
-}
-
-//loadGtfsFiles loads gtfsFiles in order required by gtfsRowReaders
-func loadGtfsFiles(files *gtfsFiles, gtfsDataSetTx *gtfs.DataSetTransaction) error {
+	if routes != nil {
+		log.Printf("Loading %d trips on routes %s\n", len(routes.tripIds), strings.Join(routeIds, ","))
+	}
+	if files.agencyFile != nil {
+		agencyRR := &agencyTimezoneRowReader{}
+		err = loadGtfsFile(nil, agencyRR, files.agencyFile, duplicates)
+		if err != nil {
+			return err
+		}
+		load.ds.Timezone = agencyRR.timezone
+	}
+	definedServiceIds := make(map[string]bool)
 	if files.calendarFile != nil {
-		err := loadGtfsFile(gtfsDataSetTx, &calendarRowReader{}, files.calendarFile)
+		err := load.file(files.calendarFile, &calendarRowReader{serviceIds: definedServiceIds}, duplicates)
 		if err != nil {
 			return err
 		}
 	}
 	if files.calendarDateFile != nil {
-		err := loadGtfsFile(gtfsDataSetTx, &calendarDateRowReader{}, files.calendarDateFile)
+		err := load.file(files.calendarDateFile, &calendarDateRowReader{serviceIds: definedServiceIds}, duplicates)
+		if err != nil {
+			return err
+		}
+	}
+	if load.isLoaded("calendar.txt") || load.isLoaded("calendar_dates.txt") {
+		definedServiceIds, err = load.serviceIds()
 		if err != nil {
 			return err
 		}
 	}
 
-	stopRR := newStopTimeRowReader()
-	err := loadGtfsFile(gtfsDataSetTx, stopRR, files.stopTimeFile)
+	stopRR := newStopTimeRowReader(copier, routes)
+	if load.isLoaded(files.stopTimeFile.Name) {
+		log.Printf("Skipping %s, loaded by an earlier attempt\n", files.stopTimeFile.Name)
+		stopRR.tripStartEndMap, err = load.tripStopTimeRanges()
+	} else {
+		err = load.transact(files.stopTimeFile.Name, func(dsTx *gtfs.DataSetTransaction) error {
+			err := loadGtfsFile(dsTx, stopRR, files.stopTimeFile, duplicates)
+			if copier != nil {
+				copied, copyErr := copier.finish()
+				if err == nil && copyErr != nil {
+					err = copyErr
+				}
+				log.Printf("Copied %d stop times\n", copied)
+			}
+			if err != nil || len(stopRR.missingDistances) > 0 {
+				// stop times missing distances are recorded with the trips
+				return err
+			}
+			return load.markLoaded(dsTx, files.stopTimeFile.Name)
+		})
+	}
 	if err != nil {
 		return err
 	}
-	shapeRR := newShapeRowReader()
-	err = loadGtfsFile(gtfsDataSetTx, shapeRR, files.shapeFile)
+	missingStopDistances := len(stopRR.missingDistances) > 0
+	shapeRR := newShapeRowReader(missingStopDistances, routes)
+	if load.isLoaded(files.shapeFile.Name) && !missingStopDistances {
+		log.Printf("Skipping %s, loaded by an earlier attempt\n", files.shapeFile.Name)
+		shapeRR.shapeMaxDistMap, err = load.shapeDistances()
+	} else {
+		err = load.transact(files.shapeFile.Name, func(dsTx *gtfs.DataSetTransaction) error {
+			err := loadGtfsFile(dsTx, shapeRR, files.shapeFile, duplicates)
+			if err != nil || missingStopDistances {
+				return err
+			}
+			return load.markLoaded(dsTx, files.shapeFile.Name)
+		})
+	}
 	if err != nil {
 		return err
 	}
-	tripRR := newTripRowReader(stopRR, shapeRR)
-	err = loadGtfsFile(gtfsDataSetTx, tripRR, files.tripFile)
-	return err
+	routeTypeRR := newRouteTypeRowReader()
+	if files.routeFile != nil {
+		err = loadGtfsFile(nil, routeTypeRR, files.routeFile, duplicates)
+		if err != nil {
+			return err
+		}
+	}
+	tripRR := newTripRowReader(stopRR, shapeRR, routes, routeTypeRR.routeTypes)
+	if load.isLoaded(files.tripFile.Name) {
+		log.Printf("Skipping %s, loaded by an earlier attempt\n", files.tripFile.Name)
+	} else {
+		err = load.transact(files.tripFile.Name, func(dsTx *gtfs.DataSetTransaction) error {
+			err := loadGtfsFile(dsTx, tripRR, files.tripFile, duplicates)
+			if err != nil {
+				return err
+			}
+			loaded := []string{files.tripFile.Name}
+			if missingStopDistances {
+				err = loadMissingStopDistances(log, files, dsTx, stopRR, shapeRR, tripRR)
+				if err != nil {
+					return err
+				}
+				loaded = append(loaded, files.stopTimeFile.Name, files.shapeFile.Name)
+			}
+			return load.markLoaded(dsTx, loaded...)
+		})
+		if err != nil {
+			return err
+		}
+		if undefined := undefinedServiceIds(tripRR.serviceIds, definedServiceIds); len(undefined) > 0 {
+			log.Printf("Warning: trips with service_id %s are never scheduled, the service_ids are not in "+
+				"calendar.txt or calendar_dates.txt\n", strings.Join(undefined, ","))
+		}
+	}
+	if files.transferFile != nil {
+		err = load.file(files.transferFile, transferRowReader{}, duplicates)
+		if err != nil {
+			return err
+		}
+	}
+	if files.pathwayFile != nil {
+		err = load.file(files.pathwayFile, pathwayRowReader{}, duplicates)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Load report: %s\n", duplicates.summary())
+	return nil
+}
+
+// loadMissingStopDistances reads stop locations from stops.txt and records the stop times held by stopRR with their
+// distances along their trip's shape
+func loadMissingStopDistances(log *log.Logger,
+	files *gtfsFiles,
+	gtfsDataSetTx *gtfs.DataSetTransaction,
+	stopRR *stopTimeRowReader,
+	shapeRR *shapeRowReader,
+	tripRR *tripRowReader) error {
+	if files.stopFile == nil {
+		return fmt.Errorf("stops.txt is required to find shape_dist_traveled missing from %d trips in "+
+			"stop_times.txt", len(stopRR.missingDistances))
+	}
+	stopLocationRR := newStopLocationRowReader()
+	err := loadGtfsFile(gtfsDataSetTx, stopLocationRR, files.stopFile, nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("Calculating shape_dist_traveled of stop times on %d trips\n", len(stopRR.missingDistances))
+	return stopRR.recordMissingDistances(gtfsDataSetTx, tripRR.shapeIds, shapeRR.shapePoints,
+		stopLocationRR.locations)
 }
 
-// loadGtfsFile loads gtfs zipped file and reads with gtfsRowReader
-func loadGtfsFile(gtfsDataSetTx *gtfs.DataSetTransaction, rowReader gtfsRowReader, f *zip.File) error {
+// loadGtfsFile loads gtfs zipped file and reads with gtfsRowReader, resolving rows with duplicate keys with
+// duplicates. When duplicates is nil every row is read
+func loadGtfsFile(gtfsDataSetTx *gtfs.DataSetTransaction,
+	rowReader gtfsRowReader,
+	f *zip.File,
+	duplicates *duplicateRows) error {
 	start := time.Now()
+	err := duplicates.begin(f)
+	if err != nil {
+		return err
+	}
 	rc, err := f.Open()
 	if err != nil {
 		return err
@@ -498,7 +689,7 @@ func loadGtfsFile(gtfsDataSetTx *gtfs.DataSetTransaction, rowReader gtfsRowReade
 		return err
 	}
 	log.Printf("Loading %s\n", parser.Filename)
-	err = loadGTFSRows(gtfsDataSetTx, parser, rowReader)
+	err = loadGTFSRows(gtfsDataSetTx, parser, rowReader, duplicates)
 	if err != nil {
 		return err
 	}
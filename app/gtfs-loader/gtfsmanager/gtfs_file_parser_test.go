@@ -1,6 +1,9 @@
 package gtfsmanager
 
 import (
+	"archive/zip"
+	"bytes"
+	"log"
 	"os"
 	"reflect"
 	"strings"
@@ -601,3 +604,71 @@ func Test_load_csv_with_bom(t *testing.T) {
 		})
 	}
 }
+
+// makeTestZipReader builds a zip.Reader containing an empty file for each of fileNames
+func makeTestZipReader(t *testing.T, fileNames []string) *zip.Reader {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for _, fileName := range fileNames {
+		if _, err := writer.Create(fileName); err != nil {
+			t.Fatalf("unable to add %s to zip file: %v", fileName, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("unable to write zip file: %v", err)
+	}
+	zipReader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatalf("unable to read zip file: %v", err)
+	}
+	return zipReader
+}
+
+func Test_newGTFSFiles_calendars(t *testing.T) {
+	requiredFiles := []string{"agency.txt", "trips.txt", "stop_times.txt", "shapes.txt"}
+	tests := []struct {
+		name             string
+		calendarFiles    []string
+		wantErr          bool
+		wantCalendar     bool
+		wantCalendarDate bool
+	}{
+		{
+			name:             "calendar and calendar_dates",
+			calendarFiles:    []string{"calendar.txt", "calendar_dates.txt"},
+			wantCalendar:     true,
+			wantCalendarDate: true,
+		},
+		{
+			name:          "calendar only",
+			calendarFiles: []string{"calendar.txt"},
+			wantCalendar:  true,
+		},
+		{
+			name:             "calendar_dates only",
+			calendarFiles:    []string{"calendar_dates.txt"},
+			wantCalendarDate: true,
+		},
+		{
+			name:    "neither",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zipReader := makeTestZipReader(t, append(tt.calendarFiles, requiredFiles...))
+			files, err := newGTFSFiles(log.New(os.Stdout, "test", 0), zipReader)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newGTFSFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if (files.calendarFile != nil) != tt.wantCalendar ||
+				(files.calendarDateFile != nil) != tt.wantCalendarDate {
+				t.Errorf("newGTFSFiles() calendarFile = %v, calendarDateFile = %v", files.calendarFile,
+					files.calendarDateFile)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@
 package gtfsmanager
 
 import (
+	"archive/zip"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -15,19 +17,24 @@ import (
 	"time"
 )
 
-// DeleteGTFSSchedule deletes all gtfs records associated with gtfs.DataSet with dataSetId
-func DeleteGTFSSchedule(log *log.Logger,
+// streamBlockSize is the number of bytes requested at a time when reading a gtfs file without downloading it
+const streamBlockSize = 1 << 20
+
+// DeleteGTFSSchedule deletes all gtfs records associated with gtfs.DataSet with dataSetId, returning the DataSet
+// deleted
+func DeleteGTFSSchedule(ctx context.Context,
+	log *log.Logger,
 	db *sqlx.DB,
-	dataSetId int64) error {
+	dataSetId int64) (*gtfs.DataSet, error) {
 
-	dataSet, err := gtfs.GetDataSet(db, dataSetId)
+	dataSet, err := gtfs.GetDataSet(ctx, db, dataSetId)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return fmt.Errorf("no DataSet found with id %d", dataSetId)
+			return nil, fmt.Errorf("no DataSet found with id %d", dataSetId)
 		}
-		return err
+		return nil, err
 	}
-	err = transact(log, db, func(tx *sqlx.Tx) error {
+	err = transact(ctx, log, db, func(tx *sqlx.Tx) error {
 		log.Printf("Removing dataSet %v", dataSet)
 		deleteStatements := []struct {
 			query string
@@ -53,17 +60,29 @@ func DeleteGTFSSchedule(log *log.Logger,
 				name:  "calendar_date",
 				query: "delete from calendar_date where data_set_id = ?",
 			},
+			{
+				name:  "transfer",
+				query: "delete from transfer where data_set_id = ?",
+			},
+			{
+				name:  "pathway",
+				query: "delete from pathway where data_set_id = ?",
+			},
+			{
+				name:  "data_set_file",
+				query: "delete from data_set_file where data_set_id = ?",
+			},
 			{
 				name:  "data_set",
 				query: "delete from data_set where id = ?",
 			},
 		}
 		for _, deleteStatement := range deleteStatements {
-			stmt, innerErr := tx.Prepare(tx.Rebind(deleteStatement.query))
+			stmt, innerErr := tx.PrepareContext(ctx, tx.Rebind(deleteStatement.query))
 			if innerErr != nil {
 				return fmt.Errorf("error running '%s' error:%w", deleteStatement.query, innerErr)
 			}
-			result, innerErr := stmt.Exec(dataSet.Id)
+			result, innerErr := stmt.ExecContext(ctx, dataSet.Id)
 			if innerErr != nil {
 				return fmt.Errorf("error running '%s' error:%w", deleteStatement.query, innerErr)
 			}
@@ -76,29 +95,94 @@ func DeleteGTFSSchedule(log *log.Logger,
 		return nil
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	log.Printf("Deleted DataSet %v", dataSet)
-	return nil
+	return dataSet, nil
 }
 
 // UpdateGTFSSchedule checks for updated gtfs schedule on remote server
 // if new version is detected attempts to load gtfs file in zip format to localDownloadDirectory from url to database
 // forceDownload flag will bypass remote check
-func UpdateGTFSSchedule(log *log.Logger,
+// stream flag reads the gtfs file with byte range requests instead of downloading it when the server supports them
+// conflictPolicy decides which row is loaded when rows in a file share a key, such as duplicate trip_ids
+// when routeIds are present only trips on those routes, and their stop times and shapes, are loaded
+// returns the DataSet activated, or nil when the loaded DataSet is current
+func UpdateGTFSSchedule(ctx context.Context,
+	log *log.Logger,
 	db *sqlx.DB,
 	localDownloadDirectory string,
 	url string,
-	forceDownload bool) error {
+	forceDownload bool,
+	stream bool,
+	stopTimeLoadConf StopTimeLoadConf,
+	conflictPolicy ConflictPolicy,
+	routeIds []string) (*gtfs.DataSet, error) {
 	if forceDownload {
 		log.Printf("Not checking remote gtfs file for new information, forcing load of gtfs file")
-	} else if !shouldUpdateGTFSSchedule(log, db, url) {
-		return nil
+	} else if !shouldUpdateGTFSSchedule(ctx, log, db, url) {
+		return nil, nil
+	}
+
+	return fetchGTFSSchedule(ctx, log, db, localDownloadDirectory, url, stream, stopTimeLoadConf, conflictPolicy,
+		routeIds, nil)
+}
+
+// ResumeGTFSSchedule continues loading the most recently staged gtfs.DataSet left by a load that did not complete,
+// skipping the files it recorded. The gtfs file is read again from the DataSet's url, and must not have changed since
+// it was staged. stream, stopTimeLoadConf, conflictPolicy and routeIds are applied as in UpdateGTFSSchedule, and
+// should match the interrupted load. Returns the DataSet activated
+func ResumeGTFSSchedule(ctx context.Context,
+	log *log.Logger,
+	db *sqlx.DB,
+	localDownloadDirectory string,
+	stream bool,
+	stopTimeLoadConf StopTimeLoadConf,
+	conflictPolicy ConflictPolicy,
+	routeIds []string) (*gtfs.DataSet, error) {
+	staged, err := gtfs.GetStagedDataSets(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if len(staged) == 0 {
+		return nil, fmt.Errorf("no staged DataSet to resume")
+	}
+	ds := staged[0]
+	log.Printf("Resuming load of DataSet %v", &ds)
+	return fetchGTFSSchedule(ctx, log, db, localDownloadDirectory, ds.URL, stream, stopTimeLoadConf, conflictPolicy,
+		routeIds, &ds)
+}
+
+// fetchGTFSSchedule reads the gtfs file at url, streaming it when stream is true and the server supports it or
+// downloading it to localDownloadDirectory otherwise, and loads it into a new DataSet, or into staged when resuming
+// an earlier load. Returns the DataSet activated
+func fetchGTFSSchedule(ctx context.Context,
+	log *log.Logger,
+	db *sqlx.DB,
+	localDownloadDirectory string,
+	url string,
+	stream bool,
+	stopTimeLoadConf StopTimeLoadConf,
+	conflictPolicy ConflictPolicy,
+	routeIds []string,
+	staged *gtfs.DataSet) (*gtfs.DataSet, error) {
+	if stream {
+		remoteFile, err := httpclient.OpenRemoteFile(url, streamBlockSize)
+		if err == nil {
+			log.Printf("Reading %d byte gtfs file from %s without downloading\n", remoteFile.Size, url)
+			ds, err := streamGTFSScheduleFromRemoteFile(ctx, log, db, remoteFile, stopTimeLoadConf, conflictPolicy,
+				routeIds, staged)
+			if err != nil {
+				return nil, err
+			}
+			return ds, nil
+		}
+		log.Printf("Unable to read gtfs file from %s without downloading, downloading instead: %v", url, err)
 	}
 
 	err := makeDirectoryIfNotPresent(localDownloadDirectory)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	start := time.Now()
 	localGtfsZipFile := filepath.Join(localDownloadDirectory, "gtfs.zip")
@@ -115,15 +199,18 @@ func UpdateGTFSSchedule(log *log.Logger,
 		}
 	}()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	log.Printf("Downloaded %v bytes in %v seconds\n",
 		downloadedFile.Size, downloadedFile.DownloadedAt.Unix()-start.Unix())
 
-	_, err = loadGTFSScheduleFromFile(log, db, *downloadedFile)
-
-	return err
+	ds, err := loadGTFSScheduleFromFile(ctx, log, db, *downloadedFile, stopTimeLoadConf, conflictPolicy, routeIds,
+		staged)
+	if err != nil {
+		return nil, err
+	}
+	return ds, nil
 
 }
 
@@ -131,14 +218,14 @@ func UpdateGTFSSchedule(log *log.Logger,
 // server. If it see's a differance returns true.
 // On error logs and returns false.
 // if the gtfs.DataSet.ETag or gtfs.DataSet.LastModifiedTimestamp match the remote file information returns false.
-func shouldUpdateGTFSSchedule(log *log.Logger, db *sqlx.DB, url string) bool {
+func shouldUpdateGTFSSchedule(ctx context.Context, log *log.Logger, db *sqlx.DB, url string) bool {
 	remoteFileInfo, err := httpclient.GetRemoteFileInfo(url)
 	if err != nil {
 		log.Printf("Unable to retrieve remote file information from '%s' error: %v", url, err)
 		return false
 	}
 
-	existingDataSet, err := gtfs.GetLatestDataSet(db)
+	existingDataSet, err := gtfs.GetLatestDataSet(ctx, db)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			log.Printf("No DataSet loaded, should perform initial load")
@@ -171,23 +258,32 @@ func shouldUpdateGTFSSchedule(log *log.Logger, db *sqlx.DB, url string) bool {
 }
 
 // ListGTFSSchedules displays a list of all DataSets to logger
-func ListGTFSSchedules(db *sqlx.DB) error {
+func ListGTFSSchedules(ctx context.Context, db *sqlx.DB) error {
 	fmt.Println("Loaded DataSets:")
-	dataSets, err := gtfs.GetAllDataSets(db)
+	dataSets, err := gtfs.GetAllDataSets(ctx, db)
 	if err != nil {
 		return err
 	}
 	for _, ds := range dataSets {
+		if ds.IsStaged() {
+			fmt.Printf("%v (staged, not yet active)\n", &ds)
+			continue
+		}
 		fmt.Println(&ds)
 	}
 	return nil
 }
 
-// loadGTFSScheduleFromFile loads gtfs file described in httpclient.DownloadedFile and saves it to new DataSet
-// wrapped inside single transaction
-func loadGTFSScheduleFromFile(log *log.Logger,
+// loadGTFSScheduleFromFile loads gtfs file described in httpclient.DownloadedFile and saves it to new DataSet, or
+// continues loading it into staged when present
+func loadGTFSScheduleFromFile(ctx context.Context,
+	log *log.Logger,
 	db *sqlx.DB,
-	downloadedFile httpclient.DownloadedFile) (*gtfs.DataSet, error) {
+	downloadedFile httpclient.DownloadedFile,
+	stopTimeLoadConf StopTimeLoadConf,
+	conflictPolicy ConflictPolicy,
+	routeIds []string,
+	staged *gtfs.DataSet) (*gtfs.DataSet, error) {
 	// Create and data set to save other data under
 	ds := gtfs.DataSet{
 		URL:                   downloadedFile.RemoteFileInfo.Path,
@@ -195,35 +291,91 @@ func loadGTFSScheduleFromFile(log *log.Logger,
 		LastModifiedTimestamp: downloadedFile.RemoteFileInfo.LastModifiedTimestamp,
 		DownloadedAt:          downloadedFile.DownloadedAt,
 	}
-	err := transact(log, db, func(tx *sqlx.Tx) error {
-		err := gtfs.SaveDataSet(tx, &ds)
+	if staged != nil {
+		err := checkResumable(log, *staged, downloadedFile.RemoteFileInfo)
 		if err != nil {
-			return err
-		}
-
-		// create DataSetTransaction for recording gtfs records
-		dsTx := gtfs.DataSetTransaction{
-			DS: ds,
-			Tx: tx,
+			return nil, err
 		}
+		ds = *staged
+	}
+	return loadGTFSSchedule(ctx, log, db, ds, stopTimeLoadConf,
+		func(load *stagedLoad, copier *stopTimeCopier) error {
+			return loadGtfsZipFile(log, load, downloadedFile.LocalFilePath, copier, conflictPolicy, routeIds)
+		})
+}
 
-		err = loadGtfsZipFile(log, &dsTx, downloadedFile.LocalFilePath)
-		if err != nil {
-			return err
-		}
-		now := time.Now()
-		err = gtfs.SaveAndTerminateReplacedDataSet(tx, &ds, now)
+// streamGTFSScheduleFromRemoteFile loads gtfs file read with byte range requests through httpclient.RemoteFile and
+// saves it to new DataSet, or continues loading it into staged when present
+func streamGTFSScheduleFromRemoteFile(ctx context.Context,
+	log *log.Logger,
+	db *sqlx.DB,
+	remoteFile *httpclient.RemoteFile,
+	stopTimeLoadConf StopTimeLoadConf,
+	conflictPolicy ConflictPolicy,
+	routeIds []string,
+	staged *gtfs.DataSet) (*gtfs.DataSet, error) {
+	ds := gtfs.DataSet{
+		URL:                   remoteFile.RemoteFileInfo.Path,
+		ETag:                  remoteFile.RemoteFileInfo.ETag,
+		LastModifiedTimestamp: remoteFile.RemoteFileInfo.LastModifiedTimestamp,
+		DownloadedAt:          remoteFile.OpenedAt,
+	}
+	if staged != nil {
+		err := checkResumable(log, *staged, remoteFile.RemoteFileInfo)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		return nil
-	})
+		ds = *staged
+	}
+	return loadGTFSSchedule(ctx, log, db, ds, stopTimeLoadConf,
+		func(load *stagedLoad, copier *stopTimeCopier) error {
+			zipReader, err := zip.NewReader(remoteFile, remoteFile.Size)
+			if err != nil {
+				return fmt.Errorf("unable to read zip file from %s: %w", remoteFile.RemoteFileInfo.Path, err)
+			}
+			return loadGtfsZip(log, load, zipReader, copier, conflictPolicy, routeIds)
+		})
+}
 
-	return &ds, err
+// loadGTFSSchedule stages ds, records the gtfs files read by loadFiles each in their own transaction, and then
+// activates ds in a single transaction replacing the active DataSet. If loading fails ds is left staged with the files
+// already recorded, so the load can be resumed or the DataSet deleted. When ds has already been staged the files it
+// recorded are skipped.
+// When stopTimeLoadConf.Workers is above zero stop times are copied in parallel outside the transaction
+func loadGTFSSchedule(ctx context.Context,
+	log *log.Logger,
+	db *sqlx.DB,
+	ds gtfs.DataSet,
+	stopTimeLoadConf StopTimeLoadConf,
+	loadFiles func(load *stagedLoad, copier *stopTimeCopier) error) (*gtfs.DataSet, error) {
+	load, err := stageDataSet(ctx, log, db, &ds)
+	if err != nil {
+		return nil, err
+	}
+	var copier *stopTimeCopier
+	if stopTimeLoadConf.Workers > 0 {
+		copier = makeStopTimeCopier(log, ds.Id, stopTimeLoadConf, func() (stopTimeCopyConn, error) {
+			return connectPgxStopTimeCopyConn(db)
+		})
+		// stops the workers if loading ends before stop times are read
+		defer copier.finish()
+	}
+	err = loadFiles(load, copier)
+	if err == nil {
+		err = load.activate()
+	}
+	if err != nil {
+		log.Printf("DataSet %d remains staged after failed load, run \"resume\" to continue loading it or "+
+			"\"delete %d\" to remove it", ds.Id, ds.Id)
+		return &ds, err
+	}
+	log.Printf("Activated DataSet %v", &ds)
+	return &ds, nil
 }
 
 // ExportTripToJson attempts to load tripId effective "at" a point in time and writes to destinationFile in Json format
-func ExportTripToJson(log *log.Logger,
+func ExportTripToJson(ctx context.Context,
+	log *log.Logger,
 	db *sqlx.DB,
 	at time.Time,
 	tripId string,
@@ -233,7 +385,7 @@ func ExportTripToJson(log *log.Logger,
 	start := at.Add(time.Duration(-tripSearchRangeSeconds) * time.Second)
 	end := at.Add(time.Duration(tripSearchRangeSeconds) * time.Second)
 
-	results, err := gtfs.GetTripInstances(db, at, start, end, []string{tripId})
+	results, err := gtfs.GetTripInstancesBetween(ctx, db, at, start, end, []string{tripId}, nil)
 	if err != nil {
 		var missingTripInstancesError *gtfs.MissingTripInstances
 		if errors.As(err, &missingTripInstancesError) {
@@ -265,10 +417,10 @@ func makeDirectoryIfNotPresent(directory string) error {
 
 /*
 transact starts a Transaction on sqlx.DB, calls txFunc and commits or rolls back the transaction depending on the
-return code of the txFunc result
+return code of the txFunc result. The transaction is rolled back if ctx is done before it is committed
 */
-func transact(log *log.Logger, db *sqlx.DB, txFunc func(*sqlx.Tx) error) (err error) {
-	tx, err := db.Beginx()
+func transact(ctx context.Context, log *log.Logger, db *sqlx.DB, txFunc func(*sqlx.Tx) error) (err error) {
+	tx, err := db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -288,31 +440,22 @@ func transact(log *log.Logger, db *sqlx.DB, txFunc func(*sqlx.Tx) error) (err er
 
 // ExportAggregatorDataToJson attempts to load data needed for aggregator tests and writes
 // to destinationFile in Json format
-func ExportAggregatorDataToJson(log *log.Logger,
+func ExportAggregatorDataToJson(ctx context.Context,
+	log *log.Logger,
 	db *sqlx.DB,
 	start time.Time,
 	end time.Time,
 	vehicleId string,
 	destinationFile string) error {
 
-	tripDeviations, err := gtfs.GetTripDeviations(db, start, end, vehicleId)
+	tripDeviations, err := gtfs.GetTripDeviations(ctx, db, start, end, vehicleId)
 	if err != nil {
 		return err
 	}
 
-	tripIdMap := make(map[string]bool, 0)
-
-	trips := make([]*gtfs.TripInstance, 0)
-	for _, tripDeviation := range tripDeviations {
-		if _, present := tripIdMap[tripDeviation.TripId]; !present {
-			tripIdMap[tripDeviation.TripId] = true
-			trip, err := gtfs.GetTripInstance(db, tripDeviation.DataSetId, tripDeviation.TripId,
-				tripDeviation.CreatedAt, 60*60*2)
-			if err != nil {
-				return err
-			}
-			trips = append(trips, trip)
-		}
+	trips, err := getDeviationTripInstances(ctx, db, tripDeviations)
+	if err != nil {
+		return err
 	}
 
 	jsonMap := map[string]interface{}{
@@ -0,0 +1,49 @@
+package gtfsmanager
+
+import (
+	"context"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/systemevent"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ListSystemEvents displays the systemevent.SystemEvents recorded from start up to end, limited to eventTypes when
+// present
+func ListSystemEvents(ctx context.Context, db *sqlx.DB, start time.Time, end time.Time, eventTypes []string) error {
+	events, err := systemevent.GetSystemEvents(ctx, db, start, end)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("System events from %s to %s:\n", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	return writeSystemEvents(os.Stdout, events, eventTypes)
+}
+
+// writeSystemEvents writes a line for each of events with a type in eventTypes, or all events when eventTypes is
+// empty. The configuration lines changed by systemevent.ConfigChanged events are written indented beneath them
+func writeSystemEvents(w io.Writer, events []systemevent.SystemEvent, eventTypes []string) error {
+	included := make(map[string]bool)
+	for _, eventType := range eventTypes {
+		included[eventType] = true
+	}
+	for _, event := range events {
+		if len(included) > 0 && !included[event.EventType] {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, event); err != nil {
+			return err
+		}
+		if event.EventType != systemevent.ConfigChanged || len(event.Details) == 0 {
+			continue
+		}
+		for _, line := range strings.Split(event.Details, "\n") {
+			if _, err := fmt.Fprintf(w, "    %s\n", line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
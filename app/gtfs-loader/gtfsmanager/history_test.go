@@ -0,0 +1,50 @@
+package gtfsmanager
+
+import (
+	"bytes"
+	"github.com/OpenTransitTools/transitcast/business/data/systemevent"
+	"testing"
+	"time"
+)
+
+func Test_writeSystemEvents(t *testing.T) {
+	at := time.Date(2022, 6, 1, 8, 30, 0, 0, time.Local)
+	events := []systemevent.SystemEvent{
+		{CreatedAt: at, App: "gtfs-loader", Version: "1.2", EventType: systemevent.DataSetLoaded,
+			Description: "activated data set 12"},
+		{CreatedAt: at.Add(time.Minute), App: "gtfs-monitor", Version: "1.3", EventType: systemevent.ConfigChanged,
+			Description: "configuration changed", Details: "+ --loop-every-seconds=5\n- --loop-every-seconds=3"},
+		{CreatedAt: at.Add(time.Minute), App: "gtfs-monitor", Version: "1.3", EventType: systemevent.AppStarted,
+			Description: "started version 1.3", Details: "--loop-every-seconds=5"},
+	}
+	tests := []struct {
+		name       string
+		eventTypes []string
+		want       string
+	}{
+		{
+			name: "all events",
+			want: events[0].String() + "\n" +
+				events[1].String() + "\n" +
+				"    + --loop-every-seconds=5\n" +
+				"    - --loop-every-seconds=3\n" +
+				events[2].String() + "\n",
+		},
+		{
+			name:       "limited to event types",
+			eventTypes: []string{systemevent.DataSetLoaded, systemevent.AppStarted},
+			want:       events[0].String() + "\n" + events[2].String() + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeSystemEvents(&buf, events, tt.eventTypes); err != nil {
+				t.Fatalf("writeSystemEvents() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("writeSystemEvents() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package gtfsmanager
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/jmoiron/sqlx"
+	"github.com/xitongsys/parquet-go/writer"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// observationParquetRowGroupSize is the size in bytes of the row groups held in memory while writing parquet files
+const observationParquetRowGroupSize = 32 * 1024 * 1024
+
+// observationCSVHeader is the header row of csv files written by ExportObservations
+var observationCSVHeader = []string{
+	"observed_time",
+	"stop_id",
+	"next_stop_id",
+	"vehicle_id",
+	"route_id",
+	"observed_at_stop",
+	"observed_at_next_stop",
+	"stop_distance",
+	"next_stop_distance",
+	"travel_seconds",
+	"scheduled_seconds",
+	"scheduled_time",
+	"data_set_id",
+	"trip_id",
+	"service_id",
+	"block_id",
+	"shape_id",
+	"trip_headsign",
+	"trip_start_time",
+	"stop_sequence",
+	"timepoint",
+	"scheduled_departure_time",
+	"confidence",
+}
+
+// Formats observations are exported in by ExportObservations
+const (
+	ObservationFormatCSV     = "csv"
+	ObservationFormatParquet = "parquet"
+)
+
+// ExportObservations writes ObservedStopTimes observed from start up to end, with the schedule they were
+// observed on, to destinationFile in format, either ObservationFormatCSV or ObservationFormatParquet. When format is
+// empty it follows destinationFile's extension, .csv or .parquet.
+// When routeIds is not empty only those routes are exported
+func ExportObservations(ctx context.Context,
+	log *log.Logger,
+	db *sqlx.DB,
+	start time.Time,
+	end time.Time,
+	routeIds []string,
+	format string,
+	destinationFile string) error {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(destinationFile)), ".")
+	}
+	if format != ObservationFormatCSV && format != ObservationFormatParquet {
+		return fmt.Errorf("unable to export observations to %s in format %q, only csv and parquet are supported",
+			destinationFile, format)
+	}
+	file, err := os.Create(destinationFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	observationWriter, err := makeObservationWriter(format, file)
+	if err != nil {
+		return err
+	}
+	exported := 0
+	err = gtfs.ForEachScheduledObservedStopTime(ctx, db, start, end, routeIds,
+		func(observation *gtfs.ScheduledObservedStopTime) error {
+			exported++
+			return observationWriter.write(observation)
+		})
+	if err != nil {
+		return err
+	}
+	err = observationWriter.flush()
+	if err != nil {
+		return err
+	}
+	log.Printf("exported %d observations to %s", exported, destinationFile)
+	return file.Close()
+}
+
+// observationWriter writes ScheduledObservedStopTimes to an export file
+type observationWriter interface {
+	write(observation *gtfs.ScheduledObservedStopTime) error
+	//flush completes the file once every observation has been written
+	flush() error
+}
+
+// makeObservationWriter builds the observationWriter writing to w in format, ObservationFormatCSV or
+// ObservationFormatParquet
+func makeObservationWriter(format string, w io.Writer) (observationWriter, error) {
+	if format == ObservationFormatParquet {
+		parquetWriter, err := writer.NewParquetWriterFromWriter(w, new(observationParquetRow), 4)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create parquet writer: %w", err)
+		}
+		parquetWriter.RowGroupSize = observationParquetRowGroupSize
+		return &parquetObservationWriter{writer: parquetWriter}, nil
+	}
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(observationCSVHeader); err != nil {
+		return nil, err
+	}
+	return &csvObservationWriter{writer: csvWriter}, nil
+}
+
+// csvObservationWriter writes observations as rows of a csv file, in the column order of observationCSVHeader
+type csvObservationWriter struct {
+	writer *csv.Writer
+}
+
+func (c *csvObservationWriter) write(observation *gtfs.ScheduledObservedStopTime) error {
+	return c.writer.Write(observationCSVRecord(observation))
+}
+
+func (c *csvObservationWriter) flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// parquetObservationWriter writes observations as observationParquetRows of a parquet file
+type parquetObservationWriter struct {
+	writer *writer.ParquetWriter
+}
+
+func (p *parquetObservationWriter) write(observation *gtfs.ScheduledObservedStopTime) error {
+	return p.writer.Write(makeObservationParquetRow(observation))
+}
+
+func (p *parquetObservationWriter) flush() error {
+	return p.writer.WriteStop()
+}
+
+// observationCSVRecord formats observation in the column order of observationCSVHeader
+// missing values are empty
+func observationCSVRecord(observation *gtfs.ScheduledObservedStopTime) []string {
+	return []string{
+		observation.ObservedTime.Format(time.RFC3339),
+		observation.StopId,
+		observation.NextStopId,
+		observation.VehicleId,
+		observation.RouteId,
+		strconv.FormatBool(observation.ObservedAtStop),
+		strconv.FormatBool(observation.ObservedAtNextStop),
+		strconv.FormatFloat(observation.StopDistance, 'f', -1, 64),
+		strconv.FormatFloat(observation.NextStopDistance, 'f', -1, 64),
+		strconv.Itoa(observation.TravelSeconds),
+		formatOptionalInt(observation.ScheduledSeconds),
+		formatOptionalInt(observation.ScheduledTime),
+		strconv.FormatInt(observation.DataSetId, 10),
+		observation.TripId,
+		formatOptionalString(observation.ServiceId),
+		formatOptionalString(observation.BlockId),
+		formatOptionalString(observation.ShapeId),
+		formatOptionalString(observation.TripHeadsign),
+		formatOptionalInt(observation.TripStartTime),
+		formatOptionalInt(observation.StopSequence),
+		formatOptionalInt(observation.Timepoint),
+		formatOptionalInt(observation.ScheduledDepartureTime),
+		formatConfidence(observation.Confidence),
+	}
+}
+
+// observationParquetRow holds the columns of parquet files written by ExportObservations, named as the columns of
+// observationCSVHeader. Missing values are null
+type observationParquetRow struct {
+	ObservedTime           int64    `parquet:"name=observed_time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	StopId                 string   `parquet:"name=stop_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	NextStopId             string   `parquet:"name=next_stop_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	VehicleId              string   `parquet:"name=vehicle_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	RouteId                string   `parquet:"name=route_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ObservedAtStop         bool     `parquet:"name=observed_at_stop, type=BOOLEAN"`
+	ObservedAtNextStop     bool     `parquet:"name=observed_at_next_stop, type=BOOLEAN"`
+	StopDistance           float64  `parquet:"name=stop_distance, type=DOUBLE"`
+	NextStopDistance       float64  `parquet:"name=next_stop_distance, type=DOUBLE"`
+	TravelSeconds          int32    `parquet:"name=travel_seconds, type=INT32"`
+	ScheduledSeconds       *int32   `parquet:"name=scheduled_seconds, type=INT32, repetitiontype=OPTIONAL"`
+	ScheduledTime          *int32   `parquet:"name=scheduled_time, type=INT32, repetitiontype=OPTIONAL"`
+	DataSetId              int64    `parquet:"name=data_set_id, type=INT64"`
+	TripId                 string   `parquet:"name=trip_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ServiceId              *string  `parquet:"name=service_id, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	BlockId                *string  `parquet:"name=block_id, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	ShapeId                *string  `parquet:"name=shape_id, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	TripHeadsign           *string  `parquet:"name=trip_headsign, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	TripStartTime          *int32   `parquet:"name=trip_start_time, type=INT32, repetitiontype=OPTIONAL"`
+	StopSequence           *int32   `parquet:"name=stop_sequence, type=INT32, repetitiontype=OPTIONAL"`
+	Timepoint              *int32   `parquet:"name=timepoint, type=INT32, repetitiontype=OPTIONAL"`
+	ScheduledDepartureTime *int32   `parquet:"name=scheduled_departure_time, type=INT32, repetitiontype=OPTIONAL"`
+	Confidence             *float64 `parquet:"name=confidence, type=DOUBLE, repetitiontype=OPTIONAL"`
+}
+
+// makeObservationParquetRow builds the observationParquetRow of observation
+func makeObservationParquetRow(observation *gtfs.ScheduledObservedStopTime) *observationParquetRow {
+	row := &observationParquetRow{
+		ObservedTime:           observation.ObservedTime.UnixNano() / int64(time.Millisecond),
+		StopId:                 observation.StopId,
+		NextStopId:             observation.NextStopId,
+		VehicleId:              observation.VehicleId,
+		RouteId:                observation.RouteId,
+		ObservedAtStop:         observation.ObservedAtStop,
+		ObservedAtNextStop:     observation.ObservedAtNextStop,
+		StopDistance:           observation.StopDistance,
+		NextStopDistance:       observation.NextStopDistance,
+		TravelSeconds:          int32(observation.TravelSeconds),
+		ScheduledSeconds:       optionalInt32(observation.ScheduledSeconds),
+		ScheduledTime:          optionalInt32(observation.ScheduledTime),
+		DataSetId:              observation.DataSetId,
+		TripId:                 observation.TripId,
+		ServiceId:              observation.ServiceId,
+		BlockId:                observation.BlockId,
+		ShapeId:                observation.ShapeId,
+		TripHeadsign:           observation.TripHeadsign,
+		TripStartTime:          optionalInt32(observation.TripStartTime),
+		StopSequence:           optionalInt32(observation.StopSequence),
+		Timepoint:              optionalInt32(observation.Timepoint),
+		ScheduledDepartureTime: optionalInt32(observation.ScheduledDepartureTime),
+	}
+	if observation.Confidence > 0 {
+		confidence := observation.Confidence
+		row.Confidence = &confidence
+	}
+	return row
+}
+
+func optionalInt32(value *int) *int32 {
+	if value == nil {
+		return nil
+	}
+	result := int32(*value)
+	return &result
+}
+
+// formatConfidence formats confidence, empty for observations that were not scored
+func formatConfidence(confidence float64) string {
+	if confidence <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(confidence, 'f', -1, 64)
+}
+
+func formatOptionalInt(value *int) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.Itoa(*value)
+}
+
+func formatOptionalString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
@@ -0,0 +1,157 @@
+package gtfsmanager
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_observationCSVRecord(t *testing.T) {
+	observedTime := time.Date(2022, 5, 22, 12, 30, 0, 0, time.UTC)
+	blockId := "9001"
+	tests := []struct {
+		name        string
+		observation *gtfs.ScheduledObservedStopTime
+		want        []string
+	}{
+		{
+			name: "observation with schedule",
+			observation: &gtfs.ScheduledObservedStopTime{
+				ObservedStopTime: gtfs.ObservedStopTime{
+					ObservedTime:     observedTime,
+					StopId:           "A",
+					NextStopId:       "B",
+					VehicleId:        "3501",
+					RouteId:          "100",
+					ObservedAtStop:   true,
+					StopDistance:     100.5,
+					NextStopDistance: 400,
+					TravelSeconds:    45,
+					ScheduledSeconds: testIntPointer(60),
+					ScheduledTime:    testIntPointer(45000),
+					DataSetId:        3,
+					TripId:           "10292960",
+					Confidence:       0.8,
+				},
+				BlockId:                &blockId,
+				StopSequence:           testIntPointer(6),
+				Timepoint:              testIntPointer(1),
+				ScheduledDepartureTime: testIntPointer(45010),
+			},
+			want: []string{"2022-05-22T12:30:00Z", "A", "B", "3501", "100", "true", "false", "100.5", "400", "45",
+				"60", "45000", "3", "10292960", "", "9001", "", "", "", "6", "1", "45010", "0.8"},
+		},
+		{
+			name: "observation without schedule",
+			observation: &gtfs.ScheduledObservedStopTime{
+				ObservedStopTime: gtfs.ObservedStopTime{
+					ObservedTime:  observedTime,
+					StopId:        "A",
+					NextStopId:    "B",
+					TravelSeconds: 45,
+					TripId:        "missing",
+				},
+			},
+			want: []string{"2022-05-22T12:30:00Z", "A", "B", "", "", "false", "false", "0", "0", "45",
+				"", "", "0", "missing", "", "", "", "", "", "", "", "", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := observationCSVRecord(tt.observation)
+			if len(got) != len(observationCSVHeader) {
+				t.Errorf("observationCSVRecord() has %d columns, header has %d", len(got), len(observationCSVHeader))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("observationCSVRecord() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parquetObservationWriter(t *testing.T) {
+	observedTime := time.Date(2022, 5, 22, 12, 30, 0, 0, time.UTC)
+	blockId := "9001"
+	observations := []*gtfs.ScheduledObservedStopTime{
+		{
+			ObservedStopTime: gtfs.ObservedStopTime{
+				ObservedTime:     observedTime,
+				StopId:           "A",
+				NextStopId:       "B",
+				VehicleId:        "3501",
+				RouteId:          "100",
+				ObservedAtStop:   true,
+				StopDistance:     100.5,
+				NextStopDistance: 400,
+				TravelSeconds:    45,
+				ScheduledSeconds: testIntPointer(60),
+				DataSetId:        3,
+				TripId:           "10292960",
+				Confidence:       0.8,
+			},
+			BlockId:      &blockId,
+			StopSequence: testIntPointer(6),
+		},
+		{
+			ObservedStopTime: gtfs.ObservedStopTime{
+				ObservedTime:  observedTime.Add(time.Minute),
+				StopId:        "B",
+				NextStopId:    "C",
+				TravelSeconds: 30,
+				TripId:        "missing",
+			},
+		},
+	}
+	destinationFile := filepath.Join(t.TempDir(), "observations.parquet")
+	file, err := os.Create(destinationFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	observationWriter, err := makeObservationWriter(ObservationFormatParquet, file)
+	if err != nil {
+		t.Fatalf("makeObservationWriter() error = %v", err)
+	}
+	for _, observation := range observations {
+		if err = observationWriter.write(observation); err != nil {
+			t.Fatalf("write() error = %v", err)
+		}
+	}
+	if err = observationWriter.flush(); err != nil {
+		t.Fatalf("flush() error = %v", err)
+	}
+	_ = file.Close()
+
+	parquetFile, err := local.NewLocalFileReader(destinationFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = parquetFile.Close()
+	}()
+	parquetReader, err := reader.NewParquetReader(parquetFile, new(observationParquetRow), 1)
+	if err != nil {
+		t.Fatalf("unable to read parquet file: %v", err)
+	}
+	defer parquetReader.ReadStop()
+	got := make([]observationParquetRow, parquetReader.GetNumRows())
+	if err = parquetReader.Read(&got); err != nil {
+		t.Fatalf("unable to read parquet rows: %v", err)
+	}
+	if len(got) != len(observations) {
+		t.Fatalf("read %d rows, want %d", len(got), len(observations))
+	}
+	for i, observation := range observations {
+		if want := makeObservationParquetRow(observation); !reflect.DeepEqual(got[i], *want) {
+			t.Errorf("row %d = %+v, want %+v", i, got[i], *want)
+		}
+	}
+	if got[0].ObservedTime != observedTime.UnixNano()/int64(time.Millisecond) || *got[0].Confidence != 0.8 ||
+		*got[0].BlockId != blockId || got[1].Confidence != nil || got[1].ScheduledSeconds != nil {
+		t.Errorf("rows = %+v, want observed_time in milliseconds and missing values null", got)
+	}
+}
@@ -0,0 +1,87 @@
+package gtfsmanager
+
+import (
+	"context"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/jmoiron/sqlx"
+	"log"
+	"time"
+)
+
+// CreatePartitions creates partitionCount partitions of partitionInterval size for each of the partitioned tables,
+// starting with the partition containing "at". Partitions overlapping with already present partitions are skipped
+func CreatePartitions(ctx context.Context,
+	log *log.Logger,
+	db *sqlx.DB,
+	at time.Time,
+	interval gtfs.PartitionInterval,
+	partitionCount int) error {
+	for _, tableName := range gtfs.PartitionedTables {
+		existing, err := gtfs.GetTablePartitions(ctx, db, tableName)
+		if err != nil {
+			return err
+		}
+		wanted := gtfs.MakeTablePartitions(tableName, interval, at, partitionCount)
+		missing := gtfs.RemoveOverlappingPartitions(wanted, existing)
+		for _, partition := range missing {
+			err = gtfs.CreateTablePartition(ctx, db, partition)
+			if err != nil {
+				return err
+			}
+			log.Printf("Created partition %v", partition)
+		}
+		log.Printf("Created %d %s partitions on %s, %d already present", len(missing), interval,
+			tableName, len(wanted)-len(missing))
+	}
+	return nil
+}
+
+// DropExpiredPartitions removes partitions from each of the partitioned tables where all the rows in the partition
+// are older than retentionDays from "at"
+func DropExpiredPartitions(ctx context.Context,
+	log *log.Logger,
+	db *sqlx.DB,
+	at time.Time,
+	retentionDays int) error {
+	if retentionDays < 1 {
+		return fmt.Errorf("retention days must be at least 1, received %d", retentionDays)
+	}
+	cutoff := at.AddDate(0, 0, -retentionDays)
+	log.Printf("Removing partitions with rows before %s", cutoff.Format(time.RFC3339))
+	for _, tableName := range gtfs.PartitionedTables {
+		partitions, err := gtfs.GetTablePartitions(ctx, db, tableName)
+		if err != nil {
+			return err
+		}
+		dropped := 0
+		for _, partition := range partitions {
+			if partition.To.After(cutoff) {
+				continue
+			}
+			err = gtfs.DropTablePartition(ctx, db, partition)
+			if err != nil {
+				return err
+			}
+			dropped++
+			log.Printf("Dropped partition %v", partition)
+		}
+		log.Printf("Dropped %d partitions from %s", dropped, tableName)
+	}
+	return nil
+}
+
+// ListPartitions displays the partitions present on each of the partitioned tables
+func ListPartitions(ctx context.Context, db *sqlx.DB) error {
+	for _, tableName := range gtfs.PartitionedTables {
+		partitions, err := gtfs.GetTablePartitions(ctx, db, tableName)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Partitions of %s:\n", tableName)
+		for _, partition := range partitions {
+			fmt.Println(partition)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package gtfsmanager
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+)
+
+// pathwayRowReader implements gtfsRowReader interface for gtfs.Pathway
+type pathwayRowReader struct{}
+
+func (p pathwayRowReader) addRow(parser *gtfsFileParser, dsTx *gtfs.DataSetTransaction) error {
+	pathway, err := buildPathway(parser)
+	if err != nil {
+		return err
+	}
+	return gtfs.RecordPathway(pathway, dsTx)
+}
+
+func (p pathwayRowReader) flush(_ *gtfs.DataSetTransaction) error {
+	return nil
+}
+
+func buildPathway(parser *gtfsFileParser) (*gtfs.Pathway, error) {
+	pathway := gtfs.Pathway{
+		PathwayId:            parser.getString("pathway_id", false),
+		FromStopId:           parser.getString("from_stop_id", false),
+		ToStopId:             parser.getString("to_stop_id", false),
+		PathwayMode:          parser.getInt("pathway_mode", false),
+		IsBidirectional:      parser.getInt("is_bidirectional", false),
+		Length:               parser.getFloat64Pointer("length", true),
+		TraversalTime:        parser.getIntPointer("traversal_time", true),
+		StairCount:           parser.getIntPointer("stair_count", true),
+		MaxSlope:             parser.getFloat64Pointer("max_slope", true),
+		MinWidth:             parser.getFloat64Pointer("min_width", true),
+		SignpostedAs:         parser.getString("signposted_as", true),
+		ReversedSignpostedAs: parser.getString("reversed_signposted_as", true),
+	}
+
+	return &pathway, parser.getError()
+}
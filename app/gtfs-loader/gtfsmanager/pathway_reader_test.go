@@ -0,0 +1,79 @@
+package gtfsmanager
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_buildPathway(t *testing.T) {
+	tests := []struct {
+		name       string
+		csvContent string
+		wantErr    bool
+		want       *gtfs.Pathway
+	}{
+		{
+			name: "pathways.txt stairs",
+			csvContent: "pathway_id,from_stop_id,to_stop_id,pathway_mode,is_bidirectional,length,traversal_time," +
+				"stair_count,max_slope,min_width,signposted_as,reversed_signposted_as\n" +
+				"P1,E1,PL1,2,1,12.5,30,20,,1.8,To Platform,To Street",
+			want: &gtfs.Pathway{
+				PathwayId:            "P1",
+				FromStopId:           "E1",
+				ToStopId:             "PL1",
+				PathwayMode:          2,
+				IsBidirectional:      1,
+				Length:               testFloat64Pointer(12.5),
+				TraversalTime:        testIntPointer(30),
+				StairCount:           testIntPointer(20),
+				MinWidth:             testFloat64Pointer(1.8),
+				SignpostedAs:         "To Platform",
+				ReversedSignpostedAs: "To Street",
+			},
+		},
+		{
+			name: "pathways.txt only required columns",
+			csvContent: "pathway_id,from_stop_id,to_stop_id,pathway_mode,is_bidirectional\n" +
+				"P2,PL1,PL2,1,0",
+			want: &gtfs.Pathway{
+				PathwayId:   "P2",
+				FromStopId:  "PL1",
+				ToStopId:    "PL2",
+				PathwayMode: 1,
+			},
+		},
+		{
+			name: "pathways.txt error, missing is_bidirectional",
+			csvContent: "pathway_id,from_stop_id,to_stop_id,pathway_mode\n" +
+				"P2,PL1,PL2,1",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := makeGTFSFileParser(strings.NewReader(tt.csvContent), "test.txt")
+			if err != nil {
+				t.Errorf("Unable to make gtfsFileParser %s", err)
+			}
+			err = parser.nextLine()
+			if err != nil {
+				t.Errorf("Unable to move gtfsFileParser to first line %s", err)
+			}
+			got, err := buildPathway(parser)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: buildPathway() produced no error, but we want one", tt.name)
+				}
+				return
+			} else if err != nil {
+				t.Errorf("%v: buildPathway() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildPathway() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
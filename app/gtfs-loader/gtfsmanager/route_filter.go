@@ -0,0 +1,82 @@
+package gtfsmanager
+
+import (
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"strings"
+)
+
+// routeFilter limits the trips, stop times and shapes loaded to those on a set of routes.
+// implements gtfsRowReader interface, collecting the trip_id and shape_id of each trip on the routes from trips.txt.
+// a nil routeFilter includes every route
+type routeFilter struct {
+	routeIds map[string]bool
+	tripIds  map[string]bool
+	shapeIds map[string]bool
+}
+
+// makeRouteFilter builds routeFilter for routeIds, returns nil when routeIds is empty
+func makeRouteFilter(routeIds []string) *routeFilter {
+	if len(routeIds) == 0 {
+		return nil
+	}
+	filter := routeFilter{
+		routeIds: make(map[string]bool),
+		tripIds:  make(map[string]bool),
+		shapeIds: make(map[string]bool),
+	}
+	for _, routeId := range routeIds {
+		filter.routeIds[routeId] = true
+	}
+	return &filter
+}
+
+func (f *routeFilter) addRow(parser *gtfsFileParser, _ *gtfs.DataSetTransaction) error {
+	routeId := parser.getString("route_id", false)
+	tripId := parser.getString("trip_id", false)
+	shapeId := parser.getString("shape_id", false)
+	if err := parser.getError(); err != nil {
+		return err
+	}
+	if f.routeIds[routeId] {
+		f.tripIds[tripId] = true
+		f.shapeIds[shapeId] = true
+	}
+	return nil
+}
+
+func (f *routeFilter) flush(_ *gtfs.DataSetTransaction) error {
+	return nil
+}
+
+// includesRoute returns true if trips on routeId should be loaded
+func (f *routeFilter) includesRoute(routeId string) bool {
+	return f == nil || f.routeIds[routeId]
+}
+
+// includesTrip returns true if stop times on tripId should be loaded
+func (f *routeFilter) includesTrip(tripId string) bool {
+	return f == nil || f.tripIds[tripId]
+}
+
+// includesShape returns true if points on shapeId should be loaded
+func (f *routeFilter) includesShape(shapeId string) bool {
+	return f == nil || f.shapeIds[shapeId]
+}
+
+// loadRouteFilter reads trips.txt from files to find the trips and shapes on routeIds.
+// returns nil when routeIds is empty, and an error if no trips are on any of the routes
+func loadRouteFilter(files *gtfsFiles, routeIds []string) (*routeFilter, error) {
+	filter := makeRouteFilter(routeIds)
+	if filter == nil {
+		return nil, nil
+	}
+	err := loadGtfsFile(nil, filter, files.tripFile, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(filter.tripIds) == 0 {
+		return nil, fmt.Errorf("found no trips on routes %s", strings.Join(routeIds, ","))
+	}
+	return filter, nil
+}
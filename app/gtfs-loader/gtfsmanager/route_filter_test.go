@@ -0,0 +1,78 @@
+package gtfsmanager
+
+import (
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// addTestRows reads each row of csvContent into rowReader without flushing it to the database
+func addTestRows(t *testing.T, csvContent string, rowReader gtfsRowReader) {
+	parser, err := makeGTFSFileParser(strings.NewReader(csvContent), "test.txt")
+	if err != nil {
+		t.Fatalf("Unable to make gtfsFileParser %s", err)
+	}
+	for {
+		err = parser.nextLine()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatalf("Unable to move gtfsFileParser to next line %s", err)
+		}
+		if err = rowReader.addRow(parser, nil); err != nil {
+			t.Fatalf("addRow() error = %v", err)
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func Test_routeFilter(t *testing.T) {
+	if makeRouteFilter(nil) != nil {
+		t.Errorf("makeRouteFilter() with no routes should include everything")
+	}
+	var all *routeFilter
+	if !all.includesRoute("1") || !all.includesTrip("1") || !all.includesShape("1") {
+		t.Errorf("nil routeFilter should include everything")
+	}
+
+	routes := makeRouteFilter([]string{"20", "57"})
+	addTestRows(t, "route_id,service_id,trip_id,block_id,shape_id\n"+
+		"20,W.1,t1,b1,s1\n"+
+		"20,W.1,t2,b1,s1\n"+
+		"57,W.1,t3,b2,s2\n"+
+		"75,W.1,t4,b3,s3\n", routes)
+	if got, want := sortedKeys(routes.tripIds), []string{"t1", "t2", "t3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("routeFilter trips = %v, want %v", got, want)
+	}
+	if got, want := sortedKeys(routes.shapeIds), []string{"s1", "s2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("routeFilter shapes = %v, want %v", got, want)
+	}
+
+	stopRR := newStopTimeRowReader(nil, routes)
+	addTestRows(t, "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n"+
+		"t1,08:00:00,08:00:00,A,1\n"+
+		"t3,08:00:00,08:00:00,A,1\n"+
+		"t4,08:00:00,08:00:00,A,1\n", stopRR)
+	if got, want := sortedKeys(stopRR.tripStartEndMap), []string{"t1", "t3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("stop times read on trips %v, want %v", got, want)
+	}
+
+	shapeRR := newShapeRowReader(true, routes)
+	addTestRows(t, "shape_id,shape_pt_lat,shape_pt_lon,shape_pt_sequence\n"+
+		"s1,45.5,-122.68,1\n"+
+		"s3,45.5,-122.68,1\n", shapeRR)
+	if got, want := sortedKeys(shapeRR.shapePoints), []string{"s1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("shapes read %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,31 @@
+package gtfsmanager
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+)
+
+// routeTypeRowReader implements gtfsRowReader interface, collecting the route_type of each route in routes.txt.
+// routes are not recorded, their route_type is saved on each of their trips
+type routeTypeRowReader struct {
+	routeTypes map[string]int
+}
+
+func newRouteTypeRowReader() *routeTypeRowReader {
+	return &routeTypeRowReader{
+		routeTypes: make(map[string]int),
+	}
+}
+
+func (r *routeTypeRowReader) addRow(parser *gtfsFileParser, _ *gtfs.DataSetTransaction) error {
+	routeId := parser.getString("route_id", false)
+	routeType := parser.getInt("route_type", false)
+	if err := parser.getError(); err != nil {
+		return err
+	}
+	r.routeTypes[routeId] = routeType
+	return nil
+}
+
+func (r *routeTypeRowReader) flush(_ *gtfs.DataSetTransaction) error {
+	return nil
+}
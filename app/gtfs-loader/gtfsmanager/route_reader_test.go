@@ -0,0 +1,37 @@
+package gtfsmanager
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_routeTypeRowReader(t *testing.T) {
+	routeTypeRR := newRouteTypeRowReader()
+	addTestRows(t, "route_id,agency_id,route_short_name,route_long_name,route_type\n"+
+		"20,TRIMET,20,Burnside/Stark,3\n"+
+		"90,TRIMET,,MAX Red Line,0\n"+
+		"193,PSC,NS,Portland Streetcar,0\n", routeTypeRR)
+	want := map[string]int{"20": 3, "90": 0, "193": 0}
+	if !reflect.DeepEqual(routeTypeRR.routeTypes, want) {
+		t.Errorf("routeTypes = %v, want %v", routeTypeRR.routeTypes, want)
+	}
+
+	stopRR := newStopTimeRowReader(nil, nil)
+	stopRR.tripStartEndMap["1"] = &tripStartEnds{startTime: 100, endTime: 200, tripDistance: 1000}
+	stopRR.tripStartEndMap["2"] = &tripStartEnds{startTime: 100, endTime: 200, tripDistance: 1000}
+	shapeRR := newShapeRowReader(false, nil)
+	shapeRR.shapeMaxDistMap["A"] = 1000
+	tripRR := newTripRowReader(stopRR, shapeRR, nil, routeTypeRR.routeTypes)
+	addTestRows(t, "route_id,service_id,trip_id,block_id,shape_id\n"+
+		"90,W,1,9001,A\n"+
+		"unknown,W,2,9002,A\n", tripRR)
+	if len(tripRR.batchedTrips) != 2 {
+		t.Fatalf("expected 2 trips, got %d", len(tripRR.batchedTrips))
+	}
+	if routeType := tripRR.batchedTrips[0].RouteType; routeType == nil || *routeType != 0 {
+		t.Errorf("trip on route 90 RouteType = %v, want 0", routeType)
+	}
+	if routeType := tripRR.batchedTrips[1].RouteType; routeType != nil {
+		t.Errorf("trip on route missing from routes.txt RouteType = %v, want nil", *routeType)
+	}
+}
@@ -0,0 +1,502 @@
+package gtfsmanager
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// sampleGTFSFileName and samplePositionsFileName are the files written by GenerateSample
+const (
+	sampleGTFSFileName      = "sample_gtfs.zip"
+	samplePositionsFileName = "sample_vehicle_positions.json"
+)
+
+// samplePositionIntervalSeconds is the time between synthetic vehicle positions reported by each vehicle
+const samplePositionIntervalSeconds = 30
+
+// sampleMaximumDelaySeconds is the longest a synthetic vehicle runs behind schedule on a trip
+const sampleMaximumDelaySeconds = 180
+
+// samplePosition is a synthetic vehicle position, in the json format of the vehicle position fixtures used by
+// gtfs-monitor's tests
+type samplePosition struct {
+	Id                string
+	Label             string
+	Timestamp         int64
+	TripId            string
+	RouteId           string
+	Latitude          float32
+	Longitude         float32
+	VehicleStopStatus int
+	StopSequence      uint32
+	StopId            string
+}
+
+// vehicle stop statuses of samplePosition, matching gtfs-rt VehicleStopStatus
+const (
+	sampleStoppedAt   = 1
+	sampleInTransitTo = 2
+)
+
+// sampleIds replaces the identifiers of one kind of gtfs record with prefix followed by a number, in the order they
+// are first seen
+type sampleIds struct {
+	prefix string
+	ids    map[string]string
+}
+
+func makeSampleIds(prefix string) *sampleIds {
+	return &sampleIds{
+		prefix: prefix,
+		ids:    make(map[string]string),
+	}
+}
+
+// get returns the anonymous identifier for id
+func (s *sampleIds) get(id string) string {
+	sampleId, present := s.ids[id]
+	if !present {
+		sampleId = s.prefix + strconv.Itoa(len(s.ids)+1)
+		s.ids[id] = sampleId
+	}
+	return sampleId
+}
+
+// sampleDataSet is an anonymized copy of the trips on a service date, with the stops and shapes they use
+type sampleDataSet struct {
+	serviceDate time.Time
+	serviceId   string
+	routeIds    []string
+	trips       []*gtfs.Trip
+	stopTimes   map[string][]*gtfs.StopTime
+	shapes      map[string][]*gtfs.Shape
+	stopIds     []string
+	stops       map[string]stopLocation
+}
+
+// GenerateSample writes an anonymized gtfs zip file with the trips on routeIds from dataSetId scheduled on
+// serviceDate to destinationDirectory, along with synthetic vehicle positions of a vehicle serving each block
+func GenerateSample(ctx context.Context,
+	log *log.Logger,
+	db *sqlx.DB,
+	dataSetId int64,
+	serviceDate time.Time,
+	routeIds []string,
+	destinationDirectory string) error {
+	dataSet, err := gtfs.GetDataSet(ctx, db, dataSetId)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve data set %d: %w", dataSetId, err)
+	}
+	serviceDate = dataSet.ServiceDate(serviceDate.Date())
+	trips, err := getSampleTrips(ctx, db, dataSet, serviceDate, routeIds)
+	if err != nil {
+		return err
+	}
+	if len(trips) == 0 {
+		return fmt.Errorf("found no trips on routes %v in data set %d on %s", routeIds, dataSetId,
+			serviceDate.Format("2006-01-02"))
+	}
+	sample := buildSampleDataSet(trips, serviceDate)
+
+	err = makeDirectoryIfNotPresent(destinationDirectory)
+	if err != nil {
+		return err
+	}
+	gtfsFile := filepath.Join(destinationDirectory, sampleGTFSFileName)
+	err = writeSampleFile(gtfsFile, sample.writeGTFSZip)
+	if err != nil {
+		return err
+	}
+	positions := sample.vehiclePositions(rand.New(rand.NewSource(dataSetId)))
+	positionsFile := filepath.Join(destinationDirectory, samplePositionsFileName)
+	err = writeSampleFile(positionsFile, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(positions)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Wrote %d trips on %d routes to %s and %d vehicle positions to %s\n", len(sample.trips),
+		len(sample.routeIds), gtfsFile, len(positions), positionsFile)
+	return nil
+}
+
+// getSampleTrips retrieves the trips on routeIds from dataSet scheduled on serviceDate with their shapes
+func getSampleTrips(ctx context.Context,
+	db *sqlx.DB,
+	dataSet *gtfs.DataSet,
+	serviceDate time.Time,
+	routeIds []string) ([]*gtfs.TripInstance, error) {
+	scheduled, err := gtfs.GetScheduledTripsByServiceDate(ctx, db, dataSet, serviceDate,
+		serviceDate.Add(24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	var tripIds []string
+	for _, scheduledTrips := range scheduled {
+		if scheduledTrips.ServiceDate.Equal(serviceDate) {
+			tripIds = append(tripIds, scheduledTrips.TripIds...)
+		}
+	}
+	tripInstances, err := gtfs.GetTripInstances(ctx, db, dataSet.Id, tripIds, serviceDate, nil)
+	if err != nil {
+		return nil, err
+	}
+	includedRoutes := makeRouteFilter(routeIds)
+	for tripId, tripInstance := range tripInstances {
+		if !includedRoutes.includesRoute(tripInstance.RouteId) {
+			delete(tripInstances, tripId)
+		}
+	}
+	missingShapeIds, err := gtfs.LoadTripInstanceShapes(ctx, db, dataSet.Id, tripInstances, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(missingShapeIds) > 0 {
+		return nil, fmt.Errorf("unable to find shapes %v in data set %d", missingShapeIds, dataSet.Id)
+	}
+	trips := make([]*gtfs.TripInstance, 0, len(tripInstances))
+	for _, tripInstance := range tripInstances {
+		trips = append(trips, tripInstance)
+	}
+	return trips, nil
+}
+
+// buildSampleDataSet makes an anonymized copy of trips scheduled on serviceDate. Every identifier is replaced, trip
+// headsigns and short names are removed and the trips are moved east or west to center on the prime meridian.
+// Stops are located on their trip's shape at their shape_dist_traveled
+func buildSampleDataSet(trips []*gtfs.TripInstance, serviceDate time.Time) *sampleDataSet {
+	sort.SliceStable(trips, func(i, j int) bool {
+		if trips[i].BlockId != trips[j].BlockId {
+			return trips[i].BlockId < trips[j].BlockId
+		}
+		return trips[i].StartTime < trips[j].StartTime
+	})
+	longitudeOffset := -centerLongitude(trips)
+	routeIds := makeSampleIds("route-")
+	tripIds := makeSampleIds("trip-")
+	blockIds := makeSampleIds("block-")
+	shapeIds := makeSampleIds("shape-")
+	stopIds := makeSampleIds("stop-")
+	sample := sampleDataSet{
+		serviceDate: serviceDate,
+		serviceId:   "service-1",
+		stopTimes:   make(map[string][]*gtfs.StopTime),
+		shapes:      make(map[string][]*gtfs.Shape),
+		stops:       make(map[string]stopLocation),
+	}
+	for _, tripInstance := range trips {
+		trip := tripInstance.Trip
+		trip.TripId = tripIds.get(trip.TripId)
+		trip.RouteId = routeIds.get(trip.RouteId)
+		trip.ServiceId = sample.serviceId
+		trip.BlockId = blockIds.get(trip.BlockId)
+		trip.ShapeId = shapeIds.get(trip.ShapeId)
+		trip.TripHeadsign = nil
+		trip.TripShortName = nil
+		sample.trips = append(sample.trips, &trip)
+
+		shapes, present := sample.shapes[trip.ShapeId]
+		if !present {
+			shapes = translateShape(tripInstance.Shapes, trip.ShapeId, longitudeOffset)
+			sample.shapes[trip.ShapeId] = shapes
+		}
+		for _, stopTimeInstance := range tripInstance.StopTimeInstances {
+			stopTime := stopTimeInstance.StopTime
+			stopTime.TripId = trip.TripId
+			stopTime.StopId = stopIds.get(stopTime.StopId)
+			sample.stopTimes[trip.TripId] = append(sample.stopTimes[trip.TripId], &stopTime)
+			if _, present := sample.stops[stopTime.StopId]; !present {
+				sample.stops[stopTime.StopId] = locationAlongShape(shapes, stopTime.ShapeDistTraveled)
+				sample.stopIds = append(sample.stopIds, stopTime.StopId)
+			}
+		}
+	}
+	for _, routeId := range routeIds.ids {
+		sample.routeIds = append(sample.routeIds, routeId)
+	}
+	sort.Strings(sample.routeIds)
+	return &sample
+}
+
+// centerLongitude returns the longitude half way between the east and west edges of the shapes of trips
+func centerLongitude(trips []*gtfs.TripInstance) float64 {
+	west := math.Inf(1)
+	east := math.Inf(-1)
+	for _, trip := range trips {
+		for _, shape := range trip.Shapes {
+			west = math.Min(west, shape.ShapePtLng)
+			east = math.Max(east, shape.ShapePtLng)
+		}
+	}
+	if math.IsInf(west, 0) {
+		return 0
+	}
+	return (west + east) / 2
+}
+
+// translateShape copies the points of a single shape, renamed to shapeId and moved by longitudeOffset degrees.
+// Moving east or west keeps the length of the shape, so shape_dist_traveled is unchanged
+func translateShape(shapes []*gtfs.Shape, shapeId string, longitudeOffset float64) []*gtfs.Shape {
+	translated := make([]*gtfs.Shape, 0, len(shapes))
+	missingDistances := false
+	for _, shape := range shapes {
+		point := *shape
+		point.ShapeId = shapeId
+		point.ShapePtLng += longitudeOffset
+		missingDistances = missingDistances || point.ShapeDistTraveled == nil
+		translated = append(translated, &point)
+	}
+	if missingDistances {
+		calculateShapeDistances(translated)
+	}
+	return translated
+}
+
+// locationAlongShape returns the location distance feet along shapes, which must have ShapeDistTraveled
+func locationAlongShape(shapes []*gtfs.Shape, distance float64) stopLocation {
+	if len(shapes) == 0 {
+		return stopLocation{}
+	}
+	for i := 1; i < len(shapes); i++ {
+		start := shapes[i-1]
+		end := shapes[i]
+		if *end.ShapeDistTraveled < distance {
+			continue
+		}
+		portion := 0.0
+		if length := *end.ShapeDistTraveled - *start.ShapeDistTraveled; length > 0 {
+			portion = math.Max(0, (distance-*start.ShapeDistTraveled)/length)
+		}
+		return stopLocation{
+			lat: start.ShapePtLat + (end.ShapePtLat-start.ShapePtLat)*portion,
+			lon: start.ShapePtLng + (end.ShapePtLng-start.ShapePtLng)*portion,
+		}
+	}
+	last := shapes[len(shapes)-1]
+	return stopLocation{lat: last.ShapePtLat, lon: last.ShapePtLng}
+}
+
+// vehiclePositions reports the location of a vehicle serving each block every samplePositionIntervalSeconds from the
+// first departure to the last arrival of each trip. Vehicles follow the schedule, running behind it on each trip by
+// a delay chosen by random
+func (s *sampleDataSet) vehiclePositions(random *rand.Rand) []samplePosition {
+	vehicleIds := makeSampleIds("vehicle-")
+	positions := make([]samplePosition, 0)
+	for _, trip := range s.trips {
+		stopTimes := s.stopTimes[trip.TripId]
+		if len(stopTimes) < 2 {
+			continue
+		}
+		vehicleId := vehicleIds.get(trip.BlockId)
+		delay := int64(random.Intn(sampleMaximumDelaySeconds + 1))
+		first := stopTimes[0].DepartureTime
+		last := stopTimes[len(stopTimes)-1].ArrivalTime
+		for scheduleSeconds := first; ; scheduleSeconds += samplePositionIntervalSeconds {
+			if scheduleSeconds > last {
+				scheduleSeconds = last
+			}
+			position := s.positionAt(trip, stopTimes, scheduleSeconds)
+			position.Id = vehicleId
+			position.Timestamp = gtfs.MakeScheduleTime(s.serviceDate, scheduleSeconds).Unix() + delay
+			positions = append(positions, position)
+			if scheduleSeconds == last {
+				break
+			}
+		}
+	}
+	sort.SliceStable(positions, func(i, j int) bool {
+		return positions[i].Timestamp < positions[j].Timestamp
+	})
+	return positions
+}
+
+// positionAt finds where a vehicle on trip following its schedule is scheduleSeconds after midnight
+func (s *sampleDataSet) positionAt(trip *gtfs.Trip, stopTimes []*gtfs.StopTime, scheduleSeconds int) samplePosition {
+	position := samplePosition{
+		Label:   trip.RouteId,
+		TripId:  trip.TripId,
+		RouteId: trip.RouteId,
+	}
+	next := 0
+	for next < len(stopTimes)-1 && stopTimes[next].DepartureTime < scheduleSeconds {
+		next++
+	}
+	stopTime := stopTimes[next]
+	position.StopSequence = stopTime.StopSequence
+	position.StopId = stopTime.StopId
+	distance := stopTime.ShapeDistTraveled
+	if scheduleSeconds >= stopTime.ArrivalTime || next == 0 {
+		position.VehicleStopStatus = sampleStoppedAt
+	} else {
+		position.VehicleStopStatus = sampleInTransitTo
+		previous := stopTimes[next-1]
+		if travelSeconds := stopTime.ArrivalTime - previous.DepartureTime; travelSeconds > 0 {
+			portion := float64(scheduleSeconds-previous.DepartureTime) / float64(travelSeconds)
+			distance = previous.ShapeDistTraveled + (stopTime.ShapeDistTraveled-previous.ShapeDistTraveled)*portion
+		}
+	}
+	location := locationAlongShape(s.shapes[trip.ShapeId], distance)
+	position.Latitude = float32(location.lat)
+	position.Longitude = float32(location.lon)
+	return position
+}
+
+// writeGTFSZip writes the sample as a gtfs zip file to w
+func (s *sampleDataSet) writeGTFSZip(w io.Writer) error {
+	zipWriter := zip.NewWriter(w)
+	files := []struct {
+		name string
+		rows [][]string
+	}{
+		{name: "agency.txt", rows: s.agencyRows()},
+		{name: "calendar_dates.txt", rows: s.calendarDateRows()},
+		{name: "routes.txt", rows: s.routeRows()},
+		{name: "stops.txt", rows: s.stopRows()},
+		{name: "trips.txt", rows: s.tripRows()},
+		{name: "stop_times.txt", rows: s.stopTimeRows()},
+		{name: "shapes.txt", rows: s.shapeRows()},
+	}
+	for _, file := range files {
+		fileWriter, err := zipWriter.Create(file.name)
+		if err != nil {
+			return err
+		}
+		csvWriter := csv.NewWriter(fileWriter)
+		err = csvWriter.WriteAll(file.rows)
+		if err != nil {
+			return fmt.Errorf("unable to write %s: %w", file.name, err)
+		}
+	}
+	return zipWriter.Close()
+}
+
+func (s *sampleDataSet) agencyRows() [][]string {
+	return [][]string{
+		{"agency_id", "agency_name", "agency_url", "agency_timezone"},
+		{"agency-1", "Sample Transit", "https://example.com", s.timezone()},
+	}
+}
+
+// timezone names the time zone of the service date, which the schedule's times are in
+func (s *sampleDataSet) timezone() string {
+	name := s.serviceDate.Location().String()
+	if name != "Local" {
+		return name
+	}
+	if tz := os.Getenv("TZ"); len(tz) > 0 {
+		return tz
+	}
+	return "UTC"
+}
+
+func (s *sampleDataSet) calendarDateRows() [][]string {
+	return [][]string{
+		{"service_id", "date", "exception_type"},
+		{s.serviceId, s.serviceDate.Format("20060102"), "1"},
+	}
+}
+
+func (s *sampleDataSet) routeRows() [][]string {
+	rows := [][]string{{"route_id", "agency_id", "route_short_name", "route_type"}}
+	for _, routeId := range s.routeIds {
+		rows = append(rows, []string{routeId, "agency-1", routeId, "3"})
+	}
+	return rows
+}
+
+func (s *sampleDataSet) stopRows() [][]string {
+	rows := [][]string{{"stop_id", "stop_name", "stop_lat", "stop_lon"}}
+	for _, stopId := range s.stopIds {
+		stop := s.stops[stopId]
+		rows = append(rows, []string{stopId, stopId, formatCoordinate(stop.lat), formatCoordinate(stop.lon)})
+	}
+	return rows
+}
+
+func (s *sampleDataSet) tripRows() [][]string {
+	rows := [][]string{{"route_id", "service_id", "trip_id", "block_id", "shape_id"}}
+	for _, trip := range s.trips {
+		rows = append(rows, []string{trip.RouteId, trip.ServiceId, trip.TripId, trip.BlockId, trip.ShapeId})
+	}
+	return rows
+}
+
+func (s *sampleDataSet) stopTimeRows() [][]string {
+	rows := [][]string{{"trip_id", "arrival_time", "departure_time", "stop_id", "stop_sequence",
+		"shape_dist_traveled", "timepoint"}}
+	for _, trip := range s.trips {
+		for _, stopTime := range s.stopTimes[trip.TripId] {
+			rows = append(rows, []string{
+				stopTime.TripId,
+				formatGTFSTime(stopTime.ArrivalTime),
+				formatGTFSTime(stopTime.DepartureTime),
+				stopTime.StopId,
+				strconv.FormatUint(uint64(stopTime.StopSequence), 10),
+				strconv.FormatFloat(stopTime.ShapeDistTraveled, 'f', 1, 64),
+				strconv.Itoa(stopTime.Timepoint),
+			})
+		}
+	}
+	return rows
+}
+
+func (s *sampleDataSet) shapeRows() [][]string {
+	rows := [][]string{{"shape_id", "shape_pt_lat", "shape_pt_lon", "shape_pt_sequence", "shape_dist_traveled"}}
+	shapeIds := make([]string, 0, len(s.shapes))
+	for shapeId := range s.shapes {
+		shapeIds = append(shapeIds, shapeId)
+	}
+	sort.Strings(shapeIds)
+	for _, shapeId := range shapeIds {
+		for _, shape := range s.shapes[shapeId] {
+			rows = append(rows, []string{
+				shapeId,
+				formatCoordinate(shape.ShapePtLat),
+				formatCoordinate(shape.ShapePtLng),
+				strconv.Itoa(shape.ShapePtSequence),
+				strconv.FormatFloat(*shape.ShapeDistTraveled, 'f', 1, 64),
+			})
+		}
+	}
+	return rows
+}
+
+// formatCoordinate formats a latitude or longitude to about a tenth of a meter
+func formatCoordinate(degrees float64) string {
+	return strconv.FormatFloat(degrees, 'f', 6, 64)
+}
+
+// formatGTFSTime formats seconds after midnight as HH:MM:SS, with hours past 24 for times after midnight
+func formatGTFSTime(seconds int) string {
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// writeSampleFile creates fileName and writes its contents with write
+func writeSampleFile(fileName string, write func(w io.Writer) error) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	err = write(file)
+	closeErr := file.Close()
+	if err != nil {
+		return fmt.Errorf("unable to write %s: %w", fileName, err)
+	}
+	return closeErr
+}
@@ -0,0 +1,140 @@
+package gtfsmanager
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// makeSampleTestTrip builds a trip on route 20 starting at startTime with three stops two minutes apart along a shape
+// running east on latitude 45.5
+func makeSampleTestTrip(tripId string, startTime int) *gtfs.TripInstance {
+	shapes := makeTestShape(-122.68, -122.67, -122.66)
+	calculateShapeDistances(shapes)
+	for _, shape := range shapes {
+		shape.ShapeId = "secret-shape"
+	}
+	headsign := "Downtown"
+	trip := &gtfs.TripInstance{
+		Trip: gtfs.Trip{
+			TripId:       tripId,
+			RouteId:      "20",
+			ServiceId:    "W.581",
+			TripHeadsign: &headsign,
+			BlockId:      "2001",
+			ShapeId:      "secret-shape",
+			StartTime:    startTime,
+		},
+		Shapes: shapes,
+	}
+	for i, stopId := range []string{"9848", "9846", "9845"} {
+		trip.StopTimeInstances = append(trip.StopTimeInstances, &gtfs.StopTimeInstance{
+			StopTime: gtfs.StopTime{
+				TripId:            tripId,
+				StopId:            stopId,
+				StopSequence:      uint32(i + 1),
+				ArrivalTime:       startTime + i*120,
+				DepartureTime:     startTime + i*120,
+				ShapeDistTraveled: *shapes[i].ShapeDistTraveled,
+			},
+		})
+	}
+	return trip
+}
+
+func Test_buildSampleDataSet(t *testing.T) {
+	serviceDate := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	trips := []*gtfs.TripInstance{makeSampleTestTrip("secret-trip-b", 8*3600+600),
+		makeSampleTestTrip("secret-trip-a", 8*3600)}
+	sample := buildSampleDataSet(trips, serviceDate)
+
+	if len(sample.trips) != 2 || sample.trips[0].TripId != "trip-1" || sample.trips[0].StartTime != 8*3600 {
+		t.Errorf("buildSampleDataSet() trips not in block order: %+v", sample.trips)
+	}
+	for _, trip := range sample.trips {
+		if trip.RouteId != "route-1" || trip.BlockId != "block-1" || trip.ShapeId != "shape-1" ||
+			trip.TripHeadsign != nil {
+			t.Errorf("buildSampleDataSet() trip not anonymized: %+v", trip)
+		}
+	}
+	// the shape is centered on the prime meridian, with stops on the shape at their distances
+	if stop := sample.stops["stop-2"]; math.Abs(stop.lat-45.5) > 0.000001 || math.Abs(stop.lon) > 0.000001 {
+		t.Errorf("buildSampleDataSet() stop-2 at %+v, want 45.5, 0", stop)
+	}
+
+	var zipFile bytes.Buffer
+	err := sample.writeGTFSZip(&zipFile)
+	if err != nil {
+		t.Fatalf("writeGTFSZip() error = %v", err)
+	}
+	zipReader, err := zip.NewReader(bytes.NewReader(zipFile.Bytes()), int64(zipFile.Len()))
+	if err != nil {
+		t.Fatalf("unable to read zip file: %v", err)
+	}
+	files, err := newGTFSFiles(log.New(os.Stdout, "test", 0), zipReader)
+	if err != nil {
+		t.Fatalf("newGTFSFiles() error = %v", err)
+	}
+	for _, file := range zipReader.File {
+		reader, _ := file.Open()
+		contents, _ := io.ReadAll(reader)
+		if strings.Contains(string(contents), "secret") || strings.Contains(string(contents), "9848") {
+			t.Errorf("%s contains identifiers from the original data set:\n%s", file.Name, contents)
+		}
+	}
+	reader, _ := files.stopTimeFile.Open()
+	contents, _ := io.ReadAll(reader)
+	stopRR := newStopTimeRowReader(nil, nil)
+	addTestRows(t, string(contents), stopRR)
+	if len(stopRR.missingDistances) > 0 || len(stopRR.tripStartEndMap) != 2 {
+		t.Errorf("stop_times.txt not loaded with shape_dist_traveled for both trips:\n%s", contents)
+	}
+}
+
+func Test_sampleDataSet_vehiclePositions(t *testing.T) {
+	serviceDate := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	sample := buildSampleDataSet([]*gtfs.TripInstance{makeSampleTestTrip("1", 8*3600)}, serviceDate)
+	positions := sample.vehiclePositions(rand.New(rand.NewSource(1)))
+	// every 30 seconds over the four minute trip
+	if len(positions) != 9 {
+		t.Fatalf("vehiclePositions() returned %d positions, want 9", len(positions))
+	}
+	delay := positions[0].Timestamp - serviceDate.Add(8*time.Hour).Unix()
+	if delay < 0 || delay > sampleMaximumDelaySeconds {
+		t.Errorf("vehiclePositions() delay %d seconds out of range", delay)
+	}
+	want := []struct {
+		status       int
+		stopSequence uint32
+	}{
+		{sampleStoppedAt, 1},
+		{sampleInTransitTo, 2},
+		{sampleInTransitTo, 2},
+		{sampleInTransitTo, 2},
+		{sampleStoppedAt, 2},
+		{sampleInTransitTo, 3},
+		{sampleInTransitTo, 3},
+		{sampleInTransitTo, 3},
+		{sampleStoppedAt, 3},
+	}
+	for i, position := range positions {
+		if position.Id != "vehicle-1" || position.TripId != "trip-1" {
+			t.Errorf("position %d on vehicle %s trip %s", i, position.Id, position.TripId)
+		}
+		if position.VehicleStopStatus != want[i].status || position.StopSequence != want[i].stopSequence {
+			t.Errorf("position %d status %d stop_sequence %d, want %d %d", i, position.VehicleStopStatus,
+				position.StopSequence, want[i].status, want[i].stopSequence)
+		}
+		if i > 0 && position.Longitude <= positions[i-1].Longitude && position.VehicleStopStatus == sampleInTransitTo {
+			t.Errorf("position %d did not move east along the shape", i)
+		}
+	}
+}
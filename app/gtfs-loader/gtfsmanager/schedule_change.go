@@ -0,0 +1,314 @@
+package gtfsmanager
+
+import (
+	"context"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ScheduleChangeConf controls which changes between data sets mark models for retraining
+type ScheduleChangeConf struct {
+	//MinimumTravelChangeSeconds is how much the scheduled travel time between a pair of stops on a trip must change
+	//before the models including the pair are affected
+	MinimumTravelChangeSeconds int
+	//FlagModels sets train_flag on the trained models affected, so they are revalidated against the new schedule
+	FlagModels bool
+}
+
+// TimepointMove lists the stops that became or stopped being timepoints on a stop pattern present in both data sets
+type TimepointMove struct {
+	Pattern string   `json:"pattern"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// ScheduleChangeReport describes how the trips in a data set changed from those of a previous data set
+type ScheduleChangeReport struct {
+	PreviousDataSetId int64    `json:"previous_data_set_id"`
+	DataSetId         int64    `json:"data_set_id"`
+	NewTrips          []string `json:"new_trips"`
+	RemovedTrips      []string `json:"removed_trips"`
+	//ChangedTrips are the trips in both data sets whose stops, scheduled times or timepoints changed
+	ChangedTrips []string `json:"changed_trips"`
+	//NewPatterns and RemovedPatterns are stop patterns, a route_id and the stop_ids it serves in order
+	NewPatterns     []string        `json:"new_patterns"`
+	RemovedPatterns []string        `json:"removed_patterns"`
+	TimepointMoves  []TimepointMove `json:"timepoint_moves"`
+	//ChangedStopPairs are consecutive stops, named like models, whose scheduled travel time changed by at least
+	//ScheduleChangeConf.MinimumTravelChangeSeconds on a trip in both data sets
+	ChangedStopPairs []string `json:"changed_stop_pairs"`
+	//AffectedModels are the trained models including a pair in ChangedStopPairs
+	AffectedModels []string `json:"affected_models"`
+	//ModelsFlagged is true when AffectedModels were flagged for retraining
+	ModelsFlagged bool `json:"models_flagged"`
+}
+
+// String summarizes the counts of changes in ScheduleChangeReport
+func (r *ScheduleChangeReport) String() string {
+	summary := fmt.Sprintf("data set %d compared to %d: %d new, %d removed and %d changed trips, "+
+		"%d new and %d removed stop patterns, %d timepoint moves, %d changed stop pairs affecting %d models",
+		r.DataSetId, r.PreviousDataSetId, len(r.NewTrips), len(r.RemovedTrips), len(r.ChangedTrips),
+		len(r.NewPatterns), len(r.RemovedPatterns), len(r.TimepointMoves), len(r.ChangedStopPairs),
+		len(r.AffectedModels))
+	if r.ModelsFlagged {
+		summary += " flagged for retraining"
+	}
+	return summary
+}
+
+// ReportReplacedScheduleChanges compares dataSet with the data set it replaced, writing the changes to w and flagging
+// the models affected when conf.FlagModels is set. Returns nil without a report when dataSet replaced no data set
+func ReportReplacedScheduleChanges(ctx context.Context,
+	log *log.Logger,
+	db *sqlx.DB,
+	dataSet *gtfs.DataSet,
+	conf ScheduleChangeConf,
+	w io.Writer) (*ScheduleChangeReport, error) {
+	if dataSet.SavedAt == nil {
+		return nil, fmt.Errorf("data set %d has not been saved", dataSet.Id)
+	}
+	previous, err := gtfs.GetDataSetAt(ctx, db, dataSet.SavedAt.Add(-time.Microsecond))
+	if err != nil {
+		log.Printf("No data set replaced by data set %d to compare with: %v\n", dataSet.Id, err)
+		return nil, nil
+	}
+	return ReportScheduleChanges(ctx, log, db, previous.Id, dataSet.Id, conf, w)
+}
+
+// ReportScheduleChanges compares the trips of the data set with dataSetId to those in previousDataSetId, writing the
+// changes to w and flagging the models affected when conf.FlagModels is set
+func ReportScheduleChanges(ctx context.Context,
+	log *log.Logger,
+	db *sqlx.DB,
+	previousDataSetId int64,
+	dataSetId int64,
+	conf ScheduleChangeConf,
+	w io.Writer) (*ScheduleChangeReport, error) {
+	log.Printf("Comparing stop patterns of data set %d to data set %d\n", dataSetId, previousDataSetId)
+	previous, err := gtfs.GetTripStopPatterns(ctx, db, previousDataSetId)
+	if err != nil {
+		return nil, err
+	}
+	current, err := gtfs.GetTripStopPatterns(ctx, db, dataSetId)
+	if err != nil {
+		return nil, err
+	}
+	report := compareTripStopPatterns(previous, current, conf)
+	report.PreviousDataSetId = previousDataSetId
+	report.DataSetId = dataSetId
+
+	models, err := mlmodels.GetAllCurrentMLModelsByName(db, false)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load current models: %w", err)
+	}
+	affected := findAffectedModels(models, report.ChangedStopPairs)
+	for _, model := range affected {
+		report.AffectedModels = append(report.AffectedModels, model.ModelName)
+	}
+	if conf.FlagModels && len(affected) > 0 {
+		ids := make([]int64, 0, len(affected))
+		for _, model := range affected {
+			ids = append(ids, model.MLModelId)
+		}
+		err = transact(ctx, log, db, func(tx *sqlx.Tx) error {
+			return mlmodels.FlagMLModelsForTraining(ctx, tx, ids)
+		})
+		if err != nil {
+			return nil, err
+		}
+		report.ModelsFlagged = true
+	}
+	return report, writeScheduleChangeReport(w, report)
+}
+
+// makePatternName names the stop pattern of trip
+func makePatternName(trip *gtfs.TripStopPattern) string {
+	return trip.RouteId + ":" + strings.Join(trip.StopIds, "_")
+}
+
+// timepointStops returns the stop ids of trip's timepoints
+func timepointStops(trip *gtfs.TripStopPattern) []string {
+	var stops []string
+	for i, timepoint := range trip.Timepoints {
+		if timepoint {
+			stops = append(stops, trip.StopIds[i])
+		}
+	}
+	return stops
+}
+
+// compareTripStopPatterns builds ScheduleChangeReport of the changes from previous to current, without data set ids
+// or models. Lists in the report are sorted
+func compareTripStopPatterns(previous []*gtfs.TripStopPattern,
+	current []*gtfs.TripStopPattern,
+	conf ScheduleChangeConf) *ScheduleChangeReport {
+	report := &ScheduleChangeReport{}
+	previousTrips := make(map[string]*gtfs.TripStopPattern, len(previous))
+	previousPatterns := make(map[string][]string)
+	for _, trip := range previous {
+		previousTrips[trip.TripId] = trip
+		name := makePatternName(trip)
+		if _, present := previousPatterns[name]; !present {
+			previousPatterns[name] = timepointStops(trip)
+		}
+	}
+	currentPatterns := make(map[string][]string)
+	changedPairs := make(map[string]bool)
+	for _, trip := range current {
+		name := makePatternName(trip)
+		if _, present := currentPatterns[name]; !present {
+			currentPatterns[name] = timepointStops(trip)
+		}
+		previousTrip, present := previousTrips[trip.TripId]
+		if !present {
+			report.NewTrips = append(report.NewTrips, trip.TripId)
+			continue
+		}
+		delete(previousTrips, trip.TripId)
+		if compareTrip(previousTrip, trip, conf.MinimumTravelChangeSeconds, changedPairs) {
+			report.ChangedTrips = append(report.ChangedTrips, trip.TripId)
+		}
+	}
+	for tripId := range previousTrips {
+		report.RemovedTrips = append(report.RemovedTrips, tripId)
+	}
+
+	for name, timepoints := range currentPatterns {
+		previousTimepoints, present := previousPatterns[name]
+		if !present {
+			report.NewPatterns = append(report.NewPatterns, name)
+			continue
+		}
+		added, removed := difference(timepoints, previousTimepoints), difference(previousTimepoints, timepoints)
+		if len(added) > 0 || len(removed) > 0 {
+			report.TimepointMoves = append(report.TimepointMoves, TimepointMove{
+				Pattern: name,
+				Added:   added,
+				Removed: removed,
+			})
+		}
+	}
+	for name := range previousPatterns {
+		if _, present := currentPatterns[name]; !present {
+			report.RemovedPatterns = append(report.RemovedPatterns, name)
+		}
+	}
+	for pair := range changedPairs {
+		report.ChangedStopPairs = append(report.ChangedStopPairs, pair)
+	}
+
+	sort.Strings(report.NewTrips)
+	sort.Strings(report.RemovedTrips)
+	sort.Strings(report.ChangedTrips)
+	sort.Strings(report.NewPatterns)
+	sort.Strings(report.RemovedPatterns)
+	sort.Strings(report.ChangedStopPairs)
+	sort.Slice(report.TimepointMoves, func(i, j int) bool {
+		return report.TimepointMoves[i].Pattern < report.TimepointMoves[j].Pattern
+	})
+	return report
+}
+
+// compareTrip returns true when current's stops, scheduled times or timepoints differ from previous. When both
+// serve the same stops, the pairs of stops whose scheduled travel time changed by at least minimumTravelChange
+// seconds are added to changedPairs
+func compareTrip(previous *gtfs.TripStopPattern,
+	current *gtfs.TripStopPattern,
+	minimumTravelChange int,
+	changedPairs map[string]bool) bool {
+	if len(previous.StopIds) != len(current.StopIds) {
+		return true
+	}
+	changed := false
+	for i := range current.StopIds {
+		if current.StopIds[i] != previous.StopIds[i] {
+			return true
+		}
+		if current.ArrivalTimes[i] != previous.ArrivalTimes[i] || current.Timepoints[i] != previous.Timepoints[i] {
+			changed = true
+		}
+	}
+	for i := 1; i < len(current.StopIds); i++ {
+		currentTravel := current.ArrivalTimes[i] - current.ArrivalTimes[i-1]
+		previousTravel := previous.ArrivalTimes[i] - previous.ArrivalTimes[i-1]
+		travelChange := currentTravel - previousTravel
+		if travelChange < 0 {
+			travelChange = -travelChange
+		}
+		if travelChange > 0 && travelChange >= minimumTravelChange {
+			changedPairs[current.StopIds[i-1]+"_"+current.StopIds[i]] = true
+		}
+	}
+	return changed
+}
+
+// difference returns the values in a that are not in b
+func difference(a []string, b []string) []string {
+	inB := make(map[string]bool, len(b))
+	for _, value := range b {
+		inB[value] = true
+	}
+	var result []string
+	for _, value := range a {
+		if !inB[value] {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// findAffectedModels returns the trained models in models including any of changedStopPairs, in model name order
+func findAffectedModels(models map[string]*mlmodels.MLModel, changedStopPairs []string) []*mlmodels.MLModel {
+	changed := make(map[string]bool, len(changedStopPairs))
+	for _, pair := range changedStopPairs {
+		changed[pair] = true
+	}
+	var affected []*mlmodels.MLModel
+	for _, model := range models {
+		if model.TrainedTimestamp == nil || model.TrainFlag {
+			continue
+		}
+		for _, stop := range model.ModelStops {
+			if changed[stop.StopId+"_"+stop.NextStopId] {
+				affected = append(affected, model)
+				break
+			}
+		}
+	}
+	sort.Slice(affected, func(i, j int) bool {
+		return affected[i].ModelName < affected[j].ModelName
+	})
+	return affected
+}
+
+// writeScheduleChangeReport writes the summary of report to w followed by its stop patterns, timepoint moves and
+// affected models
+func writeScheduleChangeReport(w io.Writer, report *ScheduleChangeReport) error {
+	lines := []string{report.String()}
+	for _, pattern := range report.NewPatterns {
+		lines = append(lines, "new stop pattern "+pattern)
+	}
+	for _, pattern := range report.RemovedPatterns {
+		lines = append(lines, "removed stop pattern "+pattern)
+	}
+	for _, move := range report.TimepointMoves {
+		lines = append(lines, fmt.Sprintf("timepoints moved on %s added:%s removed:%s", move.Pattern,
+			strings.Join(move.Added, ","), strings.Join(move.Removed, ",")))
+	}
+	for _, model := range report.AffectedModels {
+		lines = append(lines, "affected model "+model)
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
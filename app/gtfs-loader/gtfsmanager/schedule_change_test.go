@@ -0,0 +1,173 @@
+package gtfsmanager
+
+import (
+	"bytes"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// makeTestTripStopPattern builds TripStopPattern for tripId on route 10 serving stopIds at arrivalTimes, with
+// timepoints at the stops in timepoints
+func makeTestTripStopPattern(tripId string,
+	stopIds []string,
+	arrivalTimes []int,
+	timepoints ...string) *gtfs.TripStopPattern {
+	trip := &gtfs.TripStopPattern{TripId: tripId, RouteId: "10", StopIds: stopIds, ArrivalTimes: arrivalTimes}
+	for _, stopId := range stopIds {
+		timepoint := false
+		for _, timepointStopId := range timepoints {
+			timepoint = timepoint || stopId == timepointStopId
+		}
+		trip.Timepoints = append(trip.Timepoints, timepoint)
+	}
+	return trip
+}
+
+func Test_compareTripStopPatterns(t *testing.T) {
+	stops := []string{"A", "B", "C"}
+	tests := []struct {
+		name     string
+		previous []*gtfs.TripStopPattern
+		current  []*gtfs.TripStopPattern
+		want     *ScheduleChangeReport
+	}{
+		{
+			name: "Unchanged trips",
+			previous: []*gtfs.TripStopPattern{
+				makeTestTripStopPattern("1", stops, []int{100, 200, 300}, "A", "C"),
+			},
+			current: []*gtfs.TripStopPattern{
+				makeTestTripStopPattern("1", stops, []int{100, 200, 300}, "A", "C"),
+			},
+			want: &ScheduleChangeReport{},
+		},
+		{
+			name: "New and removed trips and patterns",
+			previous: []*gtfs.TripStopPattern{
+				makeTestTripStopPattern("1", stops, []int{100, 200, 300}, "A", "C"),
+				makeTestTripStopPattern("2", []string{"A", "B"}, []int{100, 200}, "A", "B"),
+			},
+			current: []*gtfs.TripStopPattern{
+				makeTestTripStopPattern("1", stops, []int{100, 200, 300}, "A", "C"),
+				makeTestTripStopPattern("3", []string{"A", "D"}, []int{100, 200}, "A", "D"),
+			},
+			want: &ScheduleChangeReport{
+				NewTrips:        []string{"3"},
+				RemovedTrips:    []string{"2"},
+				NewPatterns:     []string{"10:A_D"},
+				RemovedPatterns: []string{"10:A_B"},
+			},
+		},
+		{
+			name: "Travel changes at or above the minimum change stop pairs",
+			previous: []*gtfs.TripStopPattern{
+				makeTestTripStopPattern("1", stops, []int{100, 200, 300}, "A", "C"),
+				makeTestTripStopPattern("2", stops, []int{1000, 1100, 1200}, "A", "C"),
+			},
+			current: []*gtfs.TripStopPattern{
+				makeTestTripStopPattern("1", stops, []int{100, 260, 360}, "A", "C"),
+				makeTestTripStopPattern("2", stops, []int{1000, 1100, 1230}, "A", "C"),
+			},
+			want: &ScheduleChangeReport{
+				ChangedTrips:     []string{"1", "2"},
+				ChangedStopPairs: []string{"A_B"},
+			},
+		},
+		{
+			name: "Trips shifted in time change no stop pairs",
+			previous: []*gtfs.TripStopPattern{
+				makeTestTripStopPattern("1", stops, []int{100, 200, 300}, "A", "C"),
+			},
+			current: []*gtfs.TripStopPattern{
+				makeTestTripStopPattern("1", stops, []int{400, 500, 600}, "A", "C"),
+			},
+			want: &ScheduleChangeReport{
+				ChangedTrips: []string{"1"},
+			},
+		},
+		{
+			name: "Timepoint moved",
+			previous: []*gtfs.TripStopPattern{
+				makeTestTripStopPattern("1", stops, []int{100, 200, 300}, "A", "C"),
+			},
+			current: []*gtfs.TripStopPattern{
+				makeTestTripStopPattern("1", stops, []int{100, 200, 300}, "A", "B"),
+			},
+			want: &ScheduleChangeReport{
+				ChangedTrips: []string{"1"},
+				TimepointMoves: []TimepointMove{
+					{Pattern: "10:A_B_C", Added: []string{"B"}, Removed: []string{"C"}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := compareTripStopPatterns(tt.previous, tt.current, ScheduleChangeConf{MinimumTravelChangeSeconds: 60})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compareTripStopPatterns() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_findAffectedModels(t *testing.T) {
+	trainedAt := time.Date(2022, 5, 22, 3, 0, 0, 0, time.Local)
+	makeTestModel := func(name string, trained bool, stopIds ...string) *mlmodels.MLModel {
+		model := &mlmodels.MLModel{ModelName: name, TrainFlag: !trained}
+		if trained {
+			model.TrainedTimestamp = &trainedAt
+		}
+		for i := 1; i < len(stopIds); i++ {
+			model.ModelStops = append(model.ModelStops, mlmodels.MakeMLModelStop(i, stopIds[i-1], stopIds[i]))
+		}
+		return model
+	}
+	models := map[string]*mlmodels.MLModel{
+		"A_B":   makeTestModel("A_B", true, "A", "B"),
+		"B_C":   makeTestModel("B_C", true, "B", "C"),
+		"A_B_C": makeTestModel("A_B_C", true, "A", "B", "C"),
+		"C_B":   makeTestModel("C_B", true, "C", "B"),
+		"X_B_C": makeTestModel("X_B_C", false, "X", "B", "C"),
+	}
+	got := findAffectedModels(models, []string{"B_C"})
+	var gotNames []string
+	for _, model := range got {
+		gotNames = append(gotNames, model.ModelName)
+	}
+	want := []string{"A_B_C", "B_C"}
+	if !reflect.DeepEqual(gotNames, want) {
+		t.Errorf("findAffectedModels() = %v, want %v", gotNames, want)
+	}
+}
+
+func Test_writeScheduleChangeReport(t *testing.T) {
+	report := &ScheduleChangeReport{
+		PreviousDataSetId: 1,
+		DataSetId:         2,
+		ChangedTrips:      []string{"1"},
+		NewPatterns:       []string{"10:A_D"},
+		TimepointMoves: []TimepointMove{
+			{Pattern: "10:A_B_C", Added: []string{"B"}, Removed: []string{"C"}},
+		},
+		ChangedStopPairs: []string{"A_B"},
+		AffectedModels:   []string{"A_B"},
+		ModelsFlagged:    true,
+	}
+	want := "data set 2 compared to 1: 0 new, 0 removed and 1 changed trips, 1 new and 0 removed stop patterns, " +
+		"1 timepoint moves, 1 changed stop pairs affecting 1 models flagged for retraining\n" +
+		"new stop pattern 10:A_D\n" +
+		"timepoints moved on 10:A_B_C added:B removed:C\n" +
+		"affected model A_B\n"
+	w := &bytes.Buffer{}
+	if err := writeScheduleChangeReport(w, report); err != nil {
+		t.Errorf("writeScheduleChangeReport() error = %v", err)
+		return
+	}
+	if got := w.String(); got != want {
+		t.Errorf("writeScheduleChangeReport() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,130 @@
+package gtfsmanager
+
+import (
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"math"
+	"sort"
+)
+
+// feetPerMeter converts the distances calculated here to feet, the unit assumed for all gtfs distances
+const feetPerMeter = 3.281
+
+// maximumStopToShapeMeters is the furthest a stop can be from its trip's shape and still be placed on it
+const maximumStopToShapeMeters = 200.0
+
+// stopMatchToleranceMeters lets a stop be placed on an earlier part of the shape than the nearest part when it is
+// nearly as close, so stops on streets a loop trip travels twice are placed on the first pass
+const stopMatchToleranceMeters = 20.0
+
+// stopLocation is the coordinates of a stop from stops.txt
+type stopLocation struct {
+	lat float64
+	lon float64
+}
+
+// calculateShapeDistances sorts the points of a single shape by ShapePtSequence and sets each point's
+// ShapeDistTraveled to the distance in feet traveled along the shape from the first point
+func calculateShapeDistances(shapes []*gtfs.Shape) {
+	sortShapePoints(shapes)
+	distance := 0.0
+	for i, shape := range shapes {
+		if i > 0 {
+			previous := shapes[i-1]
+			distance += latLngDistance(previous.ShapePtLat, previous.ShapePtLng, shape.ShapePtLat, shape.ShapePtLng) *
+				feetPerMeter
+		}
+		pointDistance := distance
+		shape.ShapeDistTraveled = &pointDistance
+	}
+}
+
+// sortShapePoints sorts the points of a single shape by ShapePtSequence
+func sortShapePoints(shapes []*gtfs.Shape) {
+	sort.SliceStable(shapes, func(i, j int) bool {
+		return shapes[i].ShapePtSequence < shapes[j].ShapePtSequence
+	})
+}
+
+// projectStopTimesOntoShape sets ShapeDistTraveled on each of a trip's stopTimes to the distance along shapes of the
+// nearest point on the shape to the stop's location. Stops are placed in stop_sequence order, each no earlier on the
+// shape than the stop before it and on the earliest part of the shape within stopMatchToleranceMeters of the nearest,
+// so stops visited more than once on loop trips are placed on the right part of the shape
+func projectStopTimesOntoShape(stopTimes []*gtfs.StopTime, shapes []*gtfs.Shape, stops map[string]stopLocation) error {
+	if len(shapes) < 2 {
+		return fmt.Errorf("shape has %d points, at least two are required", len(shapes))
+	}
+	sortShapePoints(shapes)
+	for _, shape := range shapes {
+		if shape.ShapeDistTraveled == nil {
+			return fmt.Errorf("shape %s point %d has no shape_dist_traveled", shape.ShapeId, shape.ShapePtSequence)
+		}
+	}
+	sort.SliceStable(stopTimes, func(i, j int) bool {
+		return stopTimes[i].StopSequence < stopTimes[j].StopSequence
+	})
+
+	segment := 1
+	minimumDistance := 0.0
+	for _, stopTime := range stopTimes {
+		stop, present := stops[stopTime.StopId]
+		if !present {
+			return fmt.Errorf("stop_id %s has no location in stops.txt", stopTime.StopId)
+		}
+		meters := make([]float64, len(shapes))
+		distances := make([]float64, len(shapes))
+		nearestMeters := maximumStopToShapeMeters
+		for i := segment; i < len(shapes); i++ {
+			meters[i], distances[i] = projectOntoSegment(shapes[i-1], shapes[i], stop)
+			// the segment the previous stop was placed on can only be used again if this stop is further along it
+			if distances[i] < minimumDistance-stopMatchToleranceMeters*feetPerMeter {
+				meters[i] = math.Inf(1)
+			}
+			nearestMeters = math.Min(nearestMeters, meters[i])
+		}
+		if nearestMeters >= maximumStopToShapeMeters {
+			return fmt.Errorf("stop_id %s at stop_sequence %d is more than %.0f meters from the remaining shape",
+				stopTime.StopId, stopTime.StopSequence, maximumStopToShapeMeters)
+		}
+		for i := segment; i < len(shapes); i++ {
+			if meters[i] <= nearestMeters+stopMatchToleranceMeters {
+				segment = i
+				break
+			}
+		}
+		minimumDistance = math.Max(distances[segment], minimumDistance)
+		stopTime.ShapeDistTraveled = minimumDistance
+	}
+	return nil
+}
+
+// projectOntoSegment finds the nearest point to stop on the segment of the shape from start to end, returning the
+// distance in meters from stop to that point and the distance in feet along the shape of that point
+func projectOntoSegment(start *gtfs.Shape, end *gtfs.Shape, stop stopLocation) (float64, float64) {
+	snappedLat, snappedLon := nearestPointOnSegment(start.ShapePtLat, start.ShapePtLng, end.ShapePtLat, end.ShapePtLng,
+		stop.lat, stop.lon)
+	distance := *start.ShapeDistTraveled +
+		latLngDistance(start.ShapePtLat, start.ShapePtLng, snappedLat, snappedLon)*feetPerMeter
+	return latLngDistance(snappedLat, snappedLon, stop.lat, stop.lon), distance
+}
+
+// latLngDistance returns the approximate distance in meters between two nearby coordinates
+func latLngDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	averageLat := (lat1 + lat2) / 2 * math.Pi / 180
+	diffLat := 111300 * (lat1 - lat2)
+	diffLon := 111300 * math.Cos(averageLat) * (lon1 - lon2)
+	return math.Sqrt(diffLon*diffLon + diffLat*diffLat)
+}
+
+// nearestPointOnSegment returns the coordinates of the point on the segment from start to end nearest to point
+func nearestPointOnSegment(startLat, startLon, endLat, endLon, pointLat, pointLon float64) (float64, float64) {
+	segmentLon := endLon - startLon
+	segmentLat := endLat - startLat
+	lengthSquared := segmentLon*segmentLon + segmentLat*segmentLat
+	t := 0.0
+	if lengthSquared > 0 {
+		t = ((pointLon-startLon)*segmentLon + (pointLat-startLat)*segmentLat) / lengthSquared
+		t = math.Min(1, math.Max(0, t))
+	}
+	return startLat + segmentLat*t, startLon + segmentLon*t
+}
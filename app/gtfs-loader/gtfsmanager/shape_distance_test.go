@@ -0,0 +1,105 @@
+package gtfsmanager
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"math"
+	"testing"
+)
+
+// makeTestShape builds shape points at each longitude along latitude 45.5 without shape_dist_traveled
+func makeTestShape(longitudes ...float64) []*gtfs.Shape {
+	shapes := make([]*gtfs.Shape, 0, len(longitudes))
+	for i, lon := range longitudes {
+		shapes = append(shapes, &gtfs.Shape{ShapeId: "1", ShapePtLat: 45.5, ShapePtLng: lon, ShapePtSequence: i + 1})
+	}
+	return shapes
+}
+
+func Test_calculateShapeDistances(t *testing.T) {
+	shapes := makeTestShape(-122.68, -122.67, -122.66)
+	// points out of sequence order are sorted first
+	shapes[0], shapes[2] = shapes[2], shapes[0]
+	calculateShapeDistances(shapes)
+	// one hundredth of a degree of longitude at 45.5 degrees latitude is about 780 meters
+	segmentFeet := latLngDistance(45.5, -122.68, 45.5, -122.67) * feetPerMeter
+	want := []float64{0, segmentFeet, segmentFeet * 2}
+	for i, shape := range shapes {
+		if shape.ShapePtSequence != i+1 {
+			t.Errorf("point %d has sequence %d", i, shape.ShapePtSequence)
+		}
+		if shape.ShapeDistTraveled == nil || math.Abs(*shape.ShapeDistTraveled-want[i]) > 0.01 {
+			t.Errorf("point %d shape_dist_traveled = %v, want %v", i, shape.ShapeDistTraveled, want[i])
+		}
+	}
+	if math.Abs(segmentFeet-2560) > 20 {
+		t.Errorf("segment length %v feet, want about 2560", segmentFeet)
+	}
+}
+
+func Test_projectStopTimesOntoShape(t *testing.T) {
+	stops := map[string]stopLocation{
+		"west":   {lat: 45.5001, lon: -122.68},
+		"middle": {lat: 45.5001, lon: -122.67},
+		"east":   {lat: 45.5001, lon: -122.66},
+		"far":    {lat: 45.6, lon: -122.67},
+	}
+	makeStopTimes := func(stopIds ...string) []*gtfs.StopTime {
+		stopTimes := make([]*gtfs.StopTime, 0, len(stopIds))
+		for i, stopId := range stopIds {
+			stopTimes = append(stopTimes, &gtfs.StopTime{StopId: stopId, StopSequence: uint32(i + 1)})
+		}
+		return stopTimes
+	}
+	segmentFeet := latLngDistance(45.5, -122.68, 45.5, -122.67) * feetPerMeter
+	tests := []struct {
+		name      string
+		shape     []*gtfs.Shape
+		stopTimes []*gtfs.StopTime
+		want      []float64
+		wantErr   bool
+	}{
+		{
+			name:      "stops along shape",
+			shape:     makeTestShape(-122.68, -122.675, -122.67, -122.665, -122.66),
+			stopTimes: makeStopTimes("west", "middle", "east"),
+			want:      []float64{0, segmentFeet, segmentFeet * 2},
+		},
+		{
+			name:      "out and back trip visits stops twice",
+			shape:     makeTestShape(-122.68, -122.67, -122.66, -122.67, -122.68),
+			stopTimes: makeStopTimes("west", "middle", "east", "middle", "west"),
+			want:      []float64{0, segmentFeet, segmentFeet * 2, segmentFeet * 3, segmentFeet * 4},
+		},
+		{
+			name:      "stop too far from shape",
+			shape:     makeTestShape(-122.68, -122.67, -122.66),
+			stopTimes: makeStopTimes("west", "far"),
+			wantErr:   true,
+		},
+		{
+			name:      "stop without location",
+			shape:     makeTestShape(-122.68, -122.67, -122.66),
+			stopTimes: makeStopTimes("west", "unknown"),
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calculateShapeDistances(tt.shape)
+			err := projectStopTimesOntoShape(tt.stopTimes, tt.shape, stops)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("projectStopTimesOntoShape() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for i, stopTime := range tt.stopTimes {
+				// stops are 11 meters north of the shape, so they land almost exactly on a shape point
+				if math.Abs(stopTime.ShapeDistTraveled-tt.want[i]) > 1 {
+					t.Errorf("stop_sequence %d shape_dist_traveled = %v, want %v", stopTime.StopSequence,
+						stopTime.ShapeDistTraveled, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -5,15 +5,25 @@ import "github.com/OpenTransitTools/transitcast/business/data/gtfs"
 const batchedShapeCount = 250
 
 // shapeRowReader implements gtfsRowReader interface for gtfs.Shape
-// batches inserts
+// batches inserts. Shapes without shape_dist_traveled are held in missingDistances until the whole file is read,
+// then their distances are calculated from their points. When keepPoints is set every shape point is kept in
+// shapePoints for finding the distances of stop times. Only shapes used by trips included by routes are read
 type shapeRowReader struct {
 	batchedShapeRows []*gtfs.Shape
 	shapeMaxDistMap  map[string]float64
+	missingDistances map[string][]*gtfs.Shape
+	keepPoints       bool
+	shapePoints      map[string][]*gtfs.Shape
+	routes           *routeFilter
 }
 
-func newShapeRowReader() *shapeRowReader {
+func newShapeRowReader(keepPoints bool, routes *routeFilter) *shapeRowReader {
 	return &shapeRowReader{
-		shapeMaxDistMap: make(map[string]float64),
+		shapeMaxDistMap:  make(map[string]float64),
+		missingDistances: make(map[string][]*gtfs.Shape),
+		keepPoints:       keepPoints,
+		shapePoints:      make(map[string][]*gtfs.Shape),
+		routes:           routes,
 	}
 }
 
@@ -22,12 +32,27 @@ func (s *shapeRowReader) addRow(parser *gtfsFileParser, dsTx *gtfs.DataSetTransa
 	if err != nil {
 		return err
 	}
+	if !s.routes.includesShape(shape.ShapeId) {
+		return nil
+	}
+	if s.keepPoints {
+		s.shapePoints[shape.ShapeId] = append(s.shapePoints[shape.ShapeId], shape)
+	}
+	if shape.ShapeDistTraveled == nil {
+		s.missingDistances[shape.ShapeId] = append(s.missingDistances[shape.ShapeId], shape)
+		return nil
+	}
+	return s.addToBatch(shape, dsTx)
+}
+
+// addToBatch adds shape to the batch, saving the batch when it's full
+func (s *shapeRowReader) addToBatch(shape *gtfs.Shape, dsTx *gtfs.DataSetTransaction) error {
 	s.batchedShapeRows = append(s.batchedShapeRows, shape)
 	s.addMaxShapeDistance(shape)
 
 	//check if its time to save the batch
 	if len(s.batchedShapeRows) == batchedShapeCount {
-		return s.flush(dsTx)
+		return s.saveBatch(dsTx)
 	}
 	return nil
 }
@@ -43,7 +68,26 @@ func (s *shapeRowReader) addMaxShapeDistance(shape *gtfs.Shape) {
 	}
 }
 
+// flush calculates distances for shapes in missingDistances and saves all remaining shapes.
+// Distances are only calculated for shapes with no shape_dist_traveled on any point, points missing
+// shape_dist_traveled on other shapes are saved without it
 func (s *shapeRowReader) flush(dsTx *gtfs.DataSetTransaction) error {
+	for shapeId, shapes := range s.missingDistances {
+		if _, present := s.shapeMaxDistMap[shapeId]; !present {
+			calculateShapeDistances(shapes)
+		}
+		for _, shape := range shapes {
+			err := s.addToBatch(shape, dsTx)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	s.missingDistances = make(map[string][]*gtfs.Shape)
+	return s.saveBatch(dsTx)
+}
+
+func (s *shapeRowReader) saveBatch(dsTx *gtfs.DataSetTransaction) error {
 	//check if there's something to do
 	if len(s.batchedShapeRows) == 0 {
 
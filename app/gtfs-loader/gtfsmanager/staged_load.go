@@ -0,0 +1,232 @@
+package gtfsmanager
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/foundation/httpclient"
+	"github.com/jmoiron/sqlx"
+	"log"
+	"time"
+)
+
+// stagedFileTables are the tables holding the rows of each gtfs file recorded in its own transaction while a
+// gtfs.DataSet is staged
+var stagedFileTables = map[string]string{
+	"calendar.txt":       "calendar",
+	"calendar_dates.txt": "calendar_date",
+	"stop_times.txt":     "stop_time",
+	"shapes.txt":         "shape",
+	"trips.txt":          "trip",
+	"transfers.txt":      "transfer",
+	"pathways.txt":       "pathway",
+}
+
+// stagedLoad records the files of a staged gtfs.DataSet, each in its own transaction, skipping the files recorded by
+// an earlier attempt to load the same DataSet
+type stagedLoad struct {
+	ctx context.Context
+	log *log.Logger
+	db  *sqlx.DB
+	ds  *gtfs.DataSet
+	// loaded holds the files recorded by an earlier attempt
+	loaded map[string]bool
+	// resumed is true when continuing an earlier attempt, whose rows from files that were not recorded are removed
+	// before the file is loaded again
+	resumed bool
+}
+
+// stageDataSet saves ds without activating it. When ds has already been staged the files recorded by earlier attempts
+// are retrieved so loading resumes after them, otherwise any other staged DataSets are removed first
+func stageDataSet(ctx context.Context, log *log.Logger, db *sqlx.DB, ds *gtfs.DataSet) (*stagedLoad, error) {
+	load := stagedLoad{
+		ctx:    ctx,
+		log:    log,
+		db:     db,
+		ds:     ds,
+		loaded: make(map[string]bool),
+	}
+	if ds.Id != 0 {
+		files, err := gtfs.GetDataSetFiles(ctx, db, ds.Id)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			load.loaded[file] = true
+		}
+		load.resumed = true
+		log.Printf("Resuming load of DataSet %d with %d files already loaded\n", ds.Id, len(files))
+		return &load, nil
+	}
+	staged, err := gtfs.GetStagedDataSets(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	for _, previous := range staged {
+		log.Printf("Removing DataSet %d left staged by an earlier load\n", previous.Id)
+		_, err = DeleteGTFSSchedule(ctx, log, db, previous.Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = transact(ctx, log, db, func(tx *sqlx.Tx) error {
+		return gtfs.SaveDataSet(ctx, tx, ds)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Staged DataSet %d\n", ds.Id)
+	return &load, nil
+}
+
+// isLoaded returns true if fileName was recorded by an earlier attempt
+func (s *stagedLoad) isLoaded(fileName string) bool {
+	return s.loaded[fileName]
+}
+
+// file loads f with rowReader in its own transaction and records it as loaded, unless it was loaded by an earlier
+// attempt
+func (s *stagedLoad) file(f *zip.File, rowReader gtfsRowReader, duplicates *duplicateRows) error {
+	if s.isLoaded(f.Name) {
+		s.log.Printf("Skipping %s, loaded by an earlier attempt\n", f.Name)
+		return nil
+	}
+	return s.transact(f.Name, func(dsTx *gtfs.DataSetTransaction) error {
+		err := loadGtfsFile(dsTx, rowReader, f, duplicates)
+		if err != nil {
+			return err
+		}
+		return s.markLoaded(dsTx, f.Name)
+	})
+}
+
+// transact calls txFunc with a gtfs.DataSetTransaction, committing it if no error is returned. When resuming an
+// earlier attempt the rows it left from fileName are removed first
+func (s *stagedLoad) transact(fileName string, txFunc func(dsTx *gtfs.DataSetTransaction) error) error {
+	if s.resumed {
+		err := s.clear(fileName)
+		if err != nil {
+			return err
+		}
+	}
+	return transact(s.ctx, s.log, s.db, func(tx *sqlx.Tx) error {
+		return txFunc(&gtfs.DataSetTransaction{
+			DS: *s.ds,
+			Tx: tx,
+		})
+	})
+}
+
+// markLoaded records fileNames as loaded inside dsTx, so they are skipped if the load is resumed
+func (s *stagedLoad) markLoaded(dsTx *gtfs.DataSetTransaction, fileNames ...string) error {
+	now := time.Now()
+	for _, fileName := range fileNames {
+		err := gtfs.RecordDataSetFile(s.ctx, dsTx.Tx, s.ds.Id, fileName, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clear removes the rows of fileName and its record in data_set_file. Rows are removed in their own transaction so
+// stop times copied on other connections are not blocked by them
+func (s *stagedLoad) clear(fileName string) error {
+	table, present := stagedFileTables[fileName]
+	if !present {
+		return nil
+	}
+	return transact(s.ctx, s.log, s.db, func(tx *sqlx.Tx) error {
+		query := fmt.Sprintf("delete from %s where data_set_id = $1", table)
+		result, err := tx.ExecContext(s.ctx, query, s.ds.Id)
+		if err != nil {
+			return fmt.Errorf("unable to remove rows of %s left by an earlier attempt: %w", fileName, err)
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows > 0 {
+			s.log.Printf("Removed %d rows from %s left by an earlier attempt\n", rows, table)
+		}
+		_, err = tx.ExecContext(s.ctx, "delete from data_set_file where data_set_id = $1 and file_name = $2",
+			s.ds.Id, fileName)
+		return err
+	})
+}
+
+// serviceIds retrieves the service_ids defined by calendar.txt and calendar_dates.txt in an earlier attempt
+func (s *stagedLoad) serviceIds() (map[string]bool, error) {
+	serviceIds, err := gtfs.GetDefinedServiceIds(s.ctx, s.db, s.ds.Id)
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[string]bool, len(serviceIds))
+	for _, serviceId := range serviceIds {
+		results[serviceId] = true
+	}
+	return results, nil
+}
+
+// tripStopTimeRanges retrieves the first and last times and furthest distance of each trip's stop times recorded in
+// an earlier attempt
+func (s *stagedLoad) tripStopTimeRanges() (map[string]*tripStartEnds, error) {
+	ranges, err := gtfs.GetTripStopTimeRanges(s.ctx, s.db, s.ds.Id)
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[string]*tripStartEnds, len(ranges))
+	for _, tripRange := range ranges {
+		results[tripRange.TripId] = &tripStartEnds{
+			startTime:    tripRange.StartTime,
+			endTime:      tripRange.EndTime,
+			tripDistance: tripRange.ShapeDistTraveled,
+		}
+	}
+	return results, nil
+}
+
+// shapeDistances retrieves the furthest distance of each shape recorded in an earlier attempt
+func (s *stagedLoad) shapeDistances() (map[string]float64, error) {
+	return gtfs.GetShapeDistances(s.ctx, s.db, s.ds.Id)
+}
+
+// activate assigns stop patterns to the trips of the staged gtfs.DataSet, replaces the active gtfs.DataSet with it and
+// removes the record of its loaded files
+func (s *stagedLoad) activate() error {
+	return transact(s.ctx, s.log, s.db, func(tx *sqlx.Tx) error {
+		patterns, err := gtfs.AssignTripPatterns(s.ctx, tx, s.ds.Id)
+		if err != nil {
+			return err
+		}
+		s.log.Printf("Assigned %d stop patterns to trips\n", patterns)
+		err = gtfs.DeleteDataSetFiles(s.ctx, tx, s.ds.Id)
+		if err != nil {
+			return err
+		}
+		return gtfs.SaveAndTerminateReplacedDataSet(s.ctx, tx, s.ds, time.Now())
+	})
+}
+
+// checkResumable returns an error if remoteFileInfo shows the gtfs file has changed since staged was downloaded,
+// comparing ETags when both are present and last modified timestamps otherwise. When neither can be compared the
+// file is assumed to be unchanged
+func checkResumable(log *log.Logger, staged gtfs.DataSet, remoteFileInfo httpclient.RemoteFileInfo) error {
+	if len(staged.ETag) > 0 && len(remoteFileInfo.ETag) > 0 {
+		if staged.ETag != remoteFileInfo.ETag {
+			return fmt.Errorf("gtfs file ETag %s differs from %s when DataSet %d was staged, delete the DataSet "+
+				"and load again", remoteFileInfo.ETag, staged.ETag, staged.Id)
+		}
+		return nil
+	}
+	if staged.LastModifiedTimestamp != 0 && remoteFileInfo.LastModifiedTimestamp != 0 {
+		if staged.LastModifiedTimestamp != remoteFileInfo.LastModifiedTimestamp {
+			return fmt.Errorf("gtfs file was modified since DataSet %d was staged, delete the DataSet and load "+
+				"again", staged.Id)
+		}
+		return nil
+	}
+	log.Printf("Warning: unable to confirm the gtfs file is unchanged since DataSet %d was staged", staged.Id)
+	return nil
+}
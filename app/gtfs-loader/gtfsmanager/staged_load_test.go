@@ -0,0 +1,54 @@
+package gtfsmanager
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/foundation/httpclient"
+	"io"
+	"log"
+	"testing"
+)
+
+func Test_checkResumable(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	tests := []struct {
+		name    string
+		staged  gtfs.DataSet
+		remote  httpclient.RemoteFileInfo
+		wantErr bool
+	}{
+		{
+			name:   "same ETag",
+			staged: gtfs.DataSet{ETag: "a", LastModifiedTimestamp: 1},
+			remote: httpclient.RemoteFileInfo{ETag: "a", LastModifiedTimestamp: 2},
+		},
+		{
+			name:    "changed ETag",
+			staged:  gtfs.DataSet{ETag: "a", LastModifiedTimestamp: 1},
+			remote:  httpclient.RemoteFileInfo{ETag: "b", LastModifiedTimestamp: 1},
+			wantErr: true,
+		},
+		{
+			name:   "same last modified without ETag",
+			staged: gtfs.DataSet{LastModifiedTimestamp: 1},
+			remote: httpclient.RemoteFileInfo{ETag: "b", LastModifiedTimestamp: 1},
+		},
+		{
+			name:    "changed last modified",
+			staged:  gtfs.DataSet{LastModifiedTimestamp: 1},
+			remote:  httpclient.RemoteFileInfo{LastModifiedTimestamp: 2},
+			wantErr: true,
+		},
+		{
+			name:   "nothing to compare",
+			staged: gtfs.DataSet{},
+			remote: httpclient.RemoteFileInfo{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkResumable(logger, tt.staged, tt.remote); (err != nil) != tt.wantErr {
+				t.Errorf("checkResumable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
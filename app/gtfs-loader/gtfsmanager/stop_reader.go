@@ -0,0 +1,35 @@
+package gtfsmanager
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+)
+
+// stopLocationRowReader implements gtfsRowReader interface, collecting the location of each stop in stops.txt.
+// stops are not recorded, their locations are only used to find the distances of stop times along their trip's shape
+type stopLocationRowReader struct {
+	locations map[string]stopLocation
+}
+
+func newStopLocationRowReader() *stopLocationRowReader {
+	return &stopLocationRowReader{
+		locations: make(map[string]stopLocation),
+	}
+}
+
+func (s *stopLocationRowReader) addRow(parser *gtfsFileParser, _ *gtfs.DataSetTransaction) error {
+	stopId := parser.getString("stop_id", false)
+	lat := parser.getFloat64Pointer("stop_lat", true)
+	lon := parser.getFloat64Pointer("stop_lon", true)
+	if err := parser.getError(); err != nil {
+		return err
+	}
+	// generic nodes and boarding areas may not have a location
+	if lat != nil && lon != nil {
+		s.locations[stopId] = stopLocation{lat: *lat, lon: *lon}
+	}
+	return nil
+}
+
+func (s *stopLocationRowReader) flush(_ *gtfs.DataSetTransaction) error {
+	return nil
+}
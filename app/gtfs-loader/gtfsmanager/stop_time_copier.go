@@ -0,0 +1,145 @@
+package gtfsmanager
+
+import (
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/stdlib"
+	"github.com/jmoiron/sqlx"
+	"log"
+	"sync"
+)
+
+// StopTimeLoadConf configures how stop_times.txt is written to the database
+type StopTimeLoadConf struct {
+	// Workers is the number of connections copying stop times in parallel.
+	// When zero stop times are inserted inside the load transaction
+	Workers int
+	// BatchSize is the number of stop times sent in each COPY
+	BatchSize int
+}
+
+// stopTimeCopyConn writes batches of gtfs.StopTime over a single database connection
+type stopTimeCopyConn interface {
+	copyStopTimes(dataSetId int64, stopTimes []*gtfs.StopTime) (int, error)
+	release() error
+}
+
+// pgxStopTimeCopyConn copies stop times using a pgx connection acquired from a sqlx.DB pool
+type pgxStopTimeCopyConn struct {
+	db   *sqlx.DB
+	conn *pgx.Conn
+}
+
+func (p *pgxStopTimeCopyConn) copyStopTimes(dataSetId int64, stopTimes []*gtfs.StopTime) (int, error) {
+	return gtfs.CopyStopTimes(p.conn, dataSetId, stopTimes)
+}
+
+func (p *pgxStopTimeCopyConn) release() error {
+	return stdlib.ReleaseConn(p.db.DB, p.conn)
+}
+
+// connectPgxStopTimeCopyConn acquires a pgx connection from db
+func connectPgxStopTimeCopyConn(db *sqlx.DB) (stopTimeCopyConn, error) {
+	conn, err := stdlib.AcquireConn(db.DB)
+	if err != nil {
+		return nil, fmt.Errorf("unable to acquire connection to copy stop times: %w", err)
+	}
+	return &pgxStopTimeCopyConn{db: db, conn: conn}, nil
+}
+
+// stopTimeCopier writes batches of gtfs.StopTime with a pool of workers, each copying over its own connection.
+// Stop times are committed as they are copied, outside the load transaction, so they must be removed if the load fails
+type stopTimeCopier struct {
+	log       *log.Logger
+	dataSetId int64
+	batchSize int
+	batches   chan []*gtfs.StopTime
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	mu        sync.Mutex
+	err       error
+	copied    int
+}
+
+// makeStopTimeCopier starts conf.Workers workers copying stop times for dataSetId over connections from connect
+func makeStopTimeCopier(log *log.Logger,
+	dataSetId int64,
+	conf StopTimeLoadConf,
+	connect func() (stopTimeCopyConn, error)) *stopTimeCopier {
+	copier := &stopTimeCopier{
+		log:       log,
+		dataSetId: dataSetId,
+		batchSize: conf.BatchSize,
+		batches:   make(chan []*gtfs.StopTime, conf.Workers),
+	}
+	for i := 0; i < conf.Workers; i++ {
+		copier.wg.Add(1)
+		go copier.runWorker(connect)
+	}
+	return copier
+}
+
+// runWorker copies each batch received until the batches channel is closed.
+// after any worker fails remaining batches are discarded
+func (s *stopTimeCopier) runWorker(connect func() (stopTimeCopyConn, error)) {
+	defer s.wg.Done()
+	conn, err := connect()
+	if err != nil {
+		s.setError(err)
+	} else {
+		defer func() {
+			if releaseErr := conn.release(); releaseErr != nil {
+				s.log.Printf("unable to release stop time copy connection: %v", releaseErr)
+			}
+		}()
+	}
+	for batch := range s.batches {
+		if conn == nil || s.error() != nil {
+			continue
+		}
+		copied, err := conn.copyStopTimes(s.dataSetId, batch)
+		if err != nil {
+			s.setError(fmt.Errorf("unable to copy stop times: %w", err))
+			continue
+		}
+		s.mu.Lock()
+		s.copied += copied
+		s.mu.Unlock()
+	}
+}
+
+// send queues stopTimes to be copied, returns the first error encountered by any worker
+func (s *stopTimeCopier) send(stopTimes []*gtfs.StopTime) error {
+	if err := s.error(); err != nil {
+		return err
+	}
+	s.batches <- stopTimes
+	return nil
+}
+
+// finish waits for all queued stop times to be copied
+// returns the number of stop times copied and the first error encountered by any worker
+func (s *stopTimeCopier) finish() (int, error) {
+	s.closeOnce.Do(func() {
+		close(s.batches)
+	})
+	s.wg.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.copied, s.err
+}
+
+func (s *stopTimeCopier) setError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *stopTimeCopier) error() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
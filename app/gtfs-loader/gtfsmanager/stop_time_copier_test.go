@@ -0,0 +1,126 @@
+package gtfsmanager
+
+import (
+	"errors"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type testStopTimeCopyConn struct {
+	mu       *sync.Mutex
+	copied   map[string]int64
+	failTrip string
+	released *int
+}
+
+func (t *testStopTimeCopyConn) copyStopTimes(dataSetId int64, stopTimes []*gtfs.StopTime) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, stopTime := range stopTimes {
+		if stopTime.TripId == t.failTrip {
+			return 0, errors.New("copy failed")
+		}
+		t.copied[fmt.Sprintf("%s_%d", stopTime.TripId, stopTime.StopSequence)] = dataSetId
+	}
+	return len(stopTimes), nil
+}
+
+func (t *testStopTimeCopyConn) release() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*t.released++
+	return nil
+}
+
+func Test_stopTimeCopier(t *testing.T) {
+	csvContent := "trip_id,arrival_time,departure_time,stop_id,stop_sequence,shape_dist_traveled,timepoint\n" +
+		"1,06:00:00,06:00:00,A,1,0,1\n" +
+		"1,06:05:00,06:05:00,B,2,100,0\n" +
+		"1,06:10:00,06:10:00,C,3,200,1\n" +
+		"2,07:00:00,07:00:00,A,1,0,1\n" +
+		"2,07:05:00,07:05:00,B,2,100,0\n"
+
+	tests := []struct {
+		name        string
+		workers     int
+		batchSize   int
+		failTrip    string
+		wantCopied  int
+		wantErr     bool
+		wantTripEnd int
+	}{
+		{
+			name:        "copies all stop times across workers",
+			workers:     3,
+			batchSize:   2,
+			wantCopied:  5,
+			wantTripEnd: 6*60*60 + 10*60,
+		},
+		{
+			name:        "single worker with batch larger than file",
+			workers:     1,
+			batchSize:   100,
+			wantCopied:  5,
+			wantTripEnd: 6*60*60 + 10*60,
+		},
+		{
+			name:      "copy failure is returned",
+			workers:   2,
+			batchSize: 1,
+			failTrip:  "2",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &testStopTimeCopyConn{
+				mu:       &sync.Mutex{},
+				copied:   make(map[string]int64),
+				failTrip: tt.failTrip,
+				released: new(int),
+			}
+			copier := makeStopTimeCopier(log.New(os.Stdout, "test", 0), 7,
+				StopTimeLoadConf{Workers: tt.workers, BatchSize: tt.batchSize},
+				func() (stopTimeCopyConn, error) {
+					return conn, nil
+				})
+			reader := newStopTimeRowReader(copier, nil)
+			parser, err := makeGTFSFileParser(strings.NewReader(csvContent), "stop_times.txt")
+			if err != nil {
+				t.Errorf("Unable to make gtfsFileParser %s", err)
+				return
+			}
+			loadErr := loadGTFSRows(nil, parser, reader, nil)
+			copied, err := copier.finish()
+			if loadErr != nil {
+				err = loadErr
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("stopTimeCopier error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if *conn.released != tt.workers {
+				t.Errorf("released %d connections, want %d", *conn.released, tt.workers)
+			}
+			if tt.wantErr {
+				return
+			}
+			if copied != tt.wantCopied || len(conn.copied) != tt.wantCopied {
+				t.Errorf("copied %d stop times, %d unique, want %d", copied, len(conn.copied), tt.wantCopied)
+			}
+			for key, dataSetId := range conn.copied {
+				if dataSetId != 7 {
+					t.Errorf("stop time %s copied with data set id %d", key, dataSetId)
+				}
+			}
+			if reader.tripStartEndMap["1"].endTime != tt.wantTripEnd {
+				t.Errorf("trip end time = %d, want %d", reader.tripStartEndMap["1"].endTime, tt.wantTripEnd)
+			}
+		})
+	}
+}
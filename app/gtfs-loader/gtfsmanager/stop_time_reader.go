@@ -1,12 +1,13 @@
 package gtfsmanager
 
 import (
+	"fmt"
 	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
 )
 
 const batchedStopTimeCount = 250
 
-//tripStartEnds stores start times, end times and maximum distances for a trip for later use while loading trips
+// tripStartEnds stores start times, end times and maximum distances for a trip for later use while loading trips
 type tripStartEnds struct {
 	startTime    int
 	endTime      int
@@ -14,28 +15,49 @@ type tripStartEnds struct {
 }
 
 // stopTimeRowReader implements gtfsRowReader interface for gtfs.StopTime
-// batches inserts
+// batches inserts, or sends batches to stopTimeCopier when present.
+// stop times without shape_dist_traveled are held in missingDistances until their distances can be found from the
+// trip's shape. Only stop times on trips included by routes are read
 type stopTimeRowReader struct {
 	batchedStopTimes []*gtfs.StopTime
 	tripStartEndMap  map[string]*tripStartEnds
+	copier           *stopTimeCopier
+	batchSize        int
+	missingDistances map[string][]*gtfs.StopTime
+	routes           *routeFilter
 }
 
-func newStopTimeRowReader() *stopTimeRowReader {
+func newStopTimeRowReader(copier *stopTimeCopier, routes *routeFilter) *stopTimeRowReader {
+	batchSize := batchedStopTimeCount
+	if copier != nil && copier.batchSize > 0 {
+		batchSize = copier.batchSize
+	}
 	return &stopTimeRowReader{
-		tripStartEndMap: make(map[string]*tripStartEnds),
+		tripStartEndMap:  make(map[string]*tripStartEnds),
+		copier:           copier,
+		batchSize:        batchSize,
+		missingDistances: make(map[string][]*gtfs.StopTime),
+		routes:           routes,
 	}
 }
 
 func (s *stopTimeRowReader) addRow(parser *gtfsFileParser, dsTx *gtfs.DataSetTransaction) error {
-	stopTime, err := buildStopTime(parser)
+	stopTime, hasShapeDistance, err := buildStopTime(parser)
 	if err != nil {
 		return err
 	}
-	s.batchedStopTimes = append(s.batchedStopTimes, stopTime)
+	if !s.routes.includesTrip(stopTime.TripId) {
+		return nil
+	}
 	s.addEndStartTime(stopTime)
+	if !hasShapeDistance {
+		s.missingDistances[stopTime.TripId] = append(s.missingDistances[stopTime.TripId], stopTime)
+		return nil
+	}
+	s.batchedStopTimes = append(s.batchedStopTimes, stopTime)
 
 	//check if it's time to save the batch
-	if len(s.batchedStopTimes) == batchedStopTimeCount {
+	if len(s.batchedStopTimes) == s.batchSize {
 		return s.flush(dsTx)
 	}
 	return nil
@@ -72,7 +94,12 @@ func (s *stopTimeRowReader) flush(dsTx *gtfs.DataSetTransaction) error {
 		return nil
 	}
 
-	err := gtfs.RecordStopTimes(s.batchedStopTimes, dsTx)
+	var err error
+	if s.copier != nil {
+		err = s.copier.send(s.batchedStopTimes)
+	} else {
+		err = gtfs.RecordStopTimes(s.batchedStopTimes, dsTx)
+	}
 	if err != nil {
 		return err
 	}
@@ -82,14 +109,53 @@ func (s *stopTimeRowReader) flush(dsTx *gtfs.DataSetTransaction) error {
 	return nil
 }
 
-func buildStopTime(parser *gtfsFileParser) (*gtfs.StopTime, error) {
+// buildStopTime reads gtfs.StopTime from parser, also returning false if shape_dist_traveled was missing
+func buildStopTime(parser *gtfsFileParser) (*gtfs.StopTime, bool, error) {
 	stopTime := gtfs.StopTime{}
 	stopTime.TripId = parser.getString("trip_id", false)
 	stopTime.StopId = parser.getString("stop_id", false)
 	stopTime.StopSequence = uint32(parser.getInt("stop_sequence", false))
 	stopTime.ArrivalTime = parser.getGTFSTime("arrival_time", false)
 	stopTime.DepartureTime = parser.getGTFSTime("departure_time", false)
-	stopTime.ShapeDistTraveled = parser.getFloat64("shape_dist_traveled", false)
+	shapeDistTraveled := parser.getFloat64Pointer("shape_dist_traveled", true)
+	if shapeDistTraveled != nil {
+		stopTime.ShapeDistTraveled = *shapeDistTraveled
+	}
 	stopTime.Timepoint = parser.getInt("timepoint", true)
-	return &stopTime, parser.getError()
+	return &stopTime, shapeDistTraveled != nil, parser.getError()
+}
+
+// recordMissingDistances finds the distance along the trip's shape of each stop time held in missingDistances,
+// using shapeIds of each trip, points of each shape and the location of each stop, and records them
+func (s *stopTimeRowReader) recordMissingDistances(dsTx *gtfs.DataSetTransaction,
+	shapeIds map[string]string,
+	shapePoints map[string][]*gtfs.Shape,
+	stops map[string]stopLocation) error {
+	for tripId, stopTimes := range s.missingDistances {
+		shapeId, present := shapeIds[tripId]
+		if !present {
+			return fmt.Errorf("found no trip for stop times on tripId:%s", tripId)
+		}
+		err := projectStopTimesOntoShape(stopTimes, shapePoints[shapeId], stops)
+		if err != nil {
+			return fmt.Errorf("unable to find shape_dist_traveled for tripId:%s: %w", tripId, err)
+		}
+		for _, stopTime := range stopTimes {
+			s.batchedStopTimes = append(s.batchedStopTimes, stopTime)
+			if len(s.batchedStopTimes) == batchedStopTimeCount {
+				if err = gtfs.RecordStopTimes(s.batchedStopTimes, dsTx); err != nil {
+					return err
+				}
+				s.batchedStopTimes = make([]*gtfs.StopTime, 0)
+			}
+		}
+	}
+	if len(s.batchedStopTimes) > 0 {
+		err := gtfs.RecordStopTimes(s.batchedStopTimes, dsTx)
+		if err != nil {
+			return err
+		}
+		s.batchedStopTimes = make([]*gtfs.StopTime, 0)
+	}
+	return nil
 }
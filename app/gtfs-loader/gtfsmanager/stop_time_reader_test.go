@@ -14,10 +14,11 @@ func testFloat64Pointer(f float64) *float64 {
 func Test_buildStopTime(t *testing.T) {
 
 	tests := []struct {
-		name       string
-		csvContent string
-		want       *gtfs.StopTime
-		wantErr    bool
+		name                  string
+		csvContent            string
+		want                  *gtfs.StopTime
+		wantShapeDistTraveled bool
+		wantErr               bool
 	}{
 		{
 			name: "stop_time parsed",
@@ -32,7 +33,23 @@ func Test_buildStopTime(t *testing.T) {
 				ShapeDistTraveled: 5543.4,
 				Timepoint:         1,
 			},
-			wantErr: false,
+			wantShapeDistTraveled: true,
+			wantErr:               false,
+		},
+		{
+			name: "stop_time parsed, optional shape_dist_traveled missing",
+			csvContent: "trip_id,arrival_time,departure_time,stop_id,stop_sequence,timepoint" +
+				"\n10292960,06:53:02,06:53:02,10491,6,1",
+			want: &gtfs.StopTime{
+				TripId:        "10292960",
+				StopSequence:  6,
+				StopId:        "10491",
+				ArrivalTime:   (6 * 60 * 60) + (53 * 60) + 2,
+				DepartureTime: (6 * 60 * 60) + (53 * 60) + 2,
+				Timepoint:     1,
+			},
+			wantShapeDistTraveled: false,
+			wantErr:               false,
 		},
 		{
 			name: "error on missing required field (stop_sequence)",
@@ -51,7 +68,7 @@ func Test_buildStopTime(t *testing.T) {
 			if err != nil {
 				t.Errorf("Unable to move gtfsFileParser to first line %s", err)
 			}
-			got, err := buildStopTime(parser)
+			got, gotShapeDistTraveled, err := buildStopTime(parser)
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("%v: buildStopTime() produced no error, but we want one", tt.name)
@@ -65,6 +82,10 @@ func Test_buildStopTime(t *testing.T) {
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("buildStopTime() got = %+v, want %+v", got, tt.want)
 			}
+			if gotShapeDistTraveled != tt.wantShapeDistTraveled {
+				t.Errorf("buildStopTime() shape_dist_traveled present = %v, want %v", gotShapeDistTraveled,
+					tt.wantShapeDistTraveled)
+			}
 		})
 	}
 }
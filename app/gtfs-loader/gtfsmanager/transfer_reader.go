@@ -0,0 +1,42 @@
+package gtfsmanager
+
+import (
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+)
+
+// transferRowReader implements gtfsRowReader interface for gtfs.Transfer
+type transferRowReader struct{}
+
+func (t transferRowReader) addRow(parser *gtfsFileParser, dsTx *gtfs.DataSetTransaction) error {
+	transfer, err := buildTransfer(parser)
+	if err != nil {
+		return err
+	}
+	return gtfs.RecordTransfer(transfer, dsTx)
+}
+
+func (t transferRowReader) flush(_ *gtfs.DataSetTransaction) error {
+	return nil
+}
+
+func buildTransfer(parser *gtfsFileParser) (*gtfs.Transfer, error) {
+	transfer := gtfs.Transfer{
+		FromStopId:      parser.getString("from_stop_id", true),
+		ToStopId:        parser.getString("to_stop_id", true),
+		FromRouteId:     parser.getString("from_route_id", true),
+		ToRouteId:       parser.getString("to_route_id", true),
+		FromTripId:      parser.getString("from_trip_id", true),
+		ToTripId:        parser.getString("to_trip_id", true),
+		TransferType:    parser.getInt("transfer_type", true),
+		MinTransferTime: parser.getIntPointer("min_transfer_time", true),
+	}
+	// stops are only optional for in-seat transfers between trips
+	if transfer.TransferType >= 1 && transfer.TransferType <= 3 &&
+		(len(transfer.FromStopId) == 0 || len(transfer.ToStopId) == 0) {
+		parser.addParseError(fmt.Errorf("from_stop_id and to_stop_id are required for transfer_type %d",
+			transfer.TransferType))
+	}
+
+	return &transfer, parser.getError()
+}
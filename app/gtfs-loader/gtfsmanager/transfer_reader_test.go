@@ -0,0 +1,91 @@
+package gtfsmanager
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testIntPointer(i int) *int {
+	return &i
+}
+
+func Test_buildTransfer(t *testing.T) {
+	tests := []struct {
+		name       string
+		csvContent string
+		wantErr    bool
+		want       *gtfs.Transfer
+	}{
+		{
+			name: "transfers.txt timed transfer",
+			csvContent: "from_stop_id,to_stop_id,from_route_id,to_route_id,transfer_type,min_transfer_time\n" +
+				"8370,8370,100,90,1,120",
+			want: &gtfs.Transfer{
+				FromStopId:      "8370",
+				ToStopId:        "8370",
+				FromRouteId:     "100",
+				ToRouteId:       "90",
+				TransferType:    1,
+				MinTransferTime: testIntPointer(120),
+			},
+		},
+		{
+			name: "transfers.txt empty transfer_type is recommended transfer",
+			csvContent: "from_stop_id,to_stop_id,transfer_type,min_transfer_time\n" +
+				"8370,7601,,",
+			want: &gtfs.Transfer{
+				FromStopId: "8370",
+				ToStopId:   "7601",
+			},
+		},
+		{
+			name: "transfers.txt in-seat transfer between trips without stops",
+			csvContent: "from_trip_id,to_trip_id,transfer_type\n" +
+				"10292960,10292961,4",
+			want: &gtfs.Transfer{
+				FromTripId:   "10292960",
+				ToTripId:     "10292961",
+				TransferType: 4,
+			},
+		},
+		{
+			name: "transfers.txt error, timed transfer missing to_stop_id",
+			csvContent: "from_stop_id,to_stop_id,transfer_type\n" +
+				"8370,,1",
+			wantErr: true,
+		},
+		{
+			name: "transfers.txt error, invalid min_transfer_time",
+			csvContent: "from_stop_id,to_stop_id,transfer_type,min_transfer_time\n" +
+				"8370,8370,2,two minutes",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := makeGTFSFileParser(strings.NewReader(tt.csvContent), "test.txt")
+			if err != nil {
+				t.Errorf("Unable to make gtfsFileParser %s", err)
+			}
+			err = parser.nextLine()
+			if err != nil {
+				t.Errorf("Unable to move gtfsFileParser to first line %s", err)
+			}
+			got, err := buildTransfer(parser)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: buildTransfer() produced no error, but we want one", tt.name)
+				}
+				return
+			} else if err != nil {
+				t.Errorf("%v: buildTransfer() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildTransfer() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
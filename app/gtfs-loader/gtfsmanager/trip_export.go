@@ -0,0 +1,166 @@
+package gtfsmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/jmoiron/sqlx"
+	"log"
+	"os"
+	"time"
+)
+
+// ExportBlockToJson writes the trips on blockId scheduled on serviceDate, in order of their start time, to
+// destinationFile as a json list of trip instances
+func ExportBlockToJson(ctx context.Context,
+	log *log.Logger,
+	db *sqlx.DB,
+	serviceDate time.Time,
+	blockId string,
+	destinationFile string) error {
+	trips, err := getServiceDateTrips(ctx, log, db, serviceDate, "", blockId)
+	if err != nil {
+		return err
+	}
+	if len(trips) == 0 {
+		return fmt.Errorf("no trips on block %s scheduled on %s", blockId, serviceDate.Format("2006-01-02"))
+	}
+	log.Printf("saving %d trips on block %s to %s", len(trips), blockId, destinationFile)
+	return writeJsonFile(destinationFile, trips)
+}
+
+// ExportRouteToJson writes the trips on routeId scheduled on serviceDate, in order of their start time, to
+// destinationFile as a json list of trip instances
+func ExportRouteToJson(ctx context.Context,
+	log *log.Logger,
+	db *sqlx.DB,
+	serviceDate time.Time,
+	routeId string,
+	destinationFile string) error {
+	trips, err := getServiceDateTrips(ctx, log, db, serviceDate, routeId, "")
+	if err != nil {
+		return err
+	}
+	if len(trips) == 0 {
+		return fmt.Errorf("no trips on route %s scheduled on %s", routeId, serviceDate.Format("2006-01-02"))
+	}
+	log.Printf("saving %d trips on route %s to %s", len(trips), routeId, destinationFile)
+	return writeJsonFile(destinationFile, trips)
+}
+
+// ExportVehicleHistoryToJson writes the trip deviations and observed stop times recorded for vehicleId on the
+// calendar day of serviceDate, along with the trips they were recorded on, to destinationFile in json format
+func ExportVehicleHistoryToJson(ctx context.Context,
+	log *log.Logger,
+	db *sqlx.DB,
+	serviceDate time.Time,
+	vehicleId string,
+	destinationFile string) error {
+	dataSet, err := getServiceDateDataSet(ctx, db, serviceDate)
+	if err != nil {
+		return err
+	}
+	start := dataSet.ServiceDate(serviceDate.Date())
+	end := start.AddDate(0, 0, 1).Add(-time.Microsecond)
+
+	tripDeviations, err := gtfs.GetTripDeviations(ctx, db, start, end, vehicleId)
+	if err != nil {
+		return err
+	}
+	observedStopTimes, err := gtfs.GetVehicleObservedStopTimes(ctx, db, start, end, vehicleId)
+	if err != nil {
+		return err
+	}
+	if len(tripDeviations) == 0 && len(observedStopTimes) == 0 {
+		return fmt.Errorf("no history recorded for vehicle %s on %s", vehicleId, start.Format("2006-01-02"))
+	}
+	trips, err := getDeviationTripInstances(ctx, db, tripDeviations)
+	if err != nil {
+		return err
+	}
+	log.Printf("saving %d trip deviations and %d observed stop times of vehicle %s on %d trips to %s",
+		len(tripDeviations), len(observedStopTimes), vehicleId, len(trips), destinationFile)
+	return writeJsonFile(destinationFile, map[string]interface{}{
+		"trip_deviations":     tripDeviations,
+		"observed_stop_times": observedStopTimes,
+		"trip_instances":      trips,
+	})
+}
+
+// getServiceDateDataSet retrieves the DataSet active on the calendar day of serviceDate
+func getServiceDateDataSet(ctx context.Context, db *sqlx.DB, serviceDate time.Time) (*gtfs.DataSet, error) {
+	year, month, day := serviceDate.Date()
+	// noon UTC falls on the same calendar day in nearly every time zone
+	return gtfs.GetDataSetAt(ctx, db, time.Date(year, month, day, 12, 0, 0, 0, time.UTC))
+}
+
+// getServiceDateTrips retrieves the trips scheduled on serviceDate, limited to routeId and blockId when they are not
+// empty, in order of their start time
+func getServiceDateTrips(ctx context.Context,
+	log *log.Logger,
+	db *sqlx.DB,
+	serviceDate time.Time,
+	routeId string,
+	blockId string) ([]*gtfs.TripInstance, error) {
+	dataSet, err := getServiceDateDataSet(ctx, db, serviceDate)
+	if err != nil {
+		return nil, err
+	}
+	serviceDate = dataSet.ServiceDate(serviceDate.Date())
+	tripIds, err := gtfs.GetServiceDateTripIds(ctx, db, dataSet, serviceDate, routeId, blockId)
+	if err != nil {
+		return nil, err
+	}
+	tripInstances, err := gtfs.GetTripInstances(ctx, db, dataSet.Id, tripIds, serviceDate, nil)
+	if err != nil {
+		var missingTripInstancesError *gtfs.MissingTripInstances
+		if !errors.As(err, &missingTripInstancesError) {
+			return nil, err
+		}
+		log.Printf("%s\n", err)
+	}
+	return orderTripInstances(tripIds, tripInstances), nil
+}
+
+// orderTripInstances returns the TripInstances in tripInstances in the order of tripIds, skipping trips not present
+func orderTripInstances(tripIds []string, tripInstances map[string]*gtfs.TripInstance) []*gtfs.TripInstance {
+	results := make([]*gtfs.TripInstance, 0, len(tripInstances))
+	for _, tripId := range tripIds {
+		if tripInstance, present := tripInstances[tripId]; present {
+			results = append(results, tripInstance)
+		}
+	}
+	return results
+}
+
+// getDeviationTripInstances retrieves the TripInstance each of tripDeviations was recorded on, once for each trip
+func getDeviationTripInstances(ctx context.Context,
+	db *sqlx.DB,
+	tripDeviations []*gtfs.TripDeviation) ([]*gtfs.TripInstance, error) {
+	tripIdMap := make(map[string]bool, 0)
+
+	trips := make([]*gtfs.TripInstance, 0)
+	for _, tripDeviation := range tripDeviations {
+		if _, present := tripIdMap[tripDeviation.TripId]; !present {
+			tripIdMap[tripDeviation.TripId] = true
+			trip, err := gtfs.GetTripInstance(ctx, db, tripDeviation.DataSetId, tripDeviation.TripId,
+				tripDeviation.CreatedAt, 60*60*2, nil)
+			if err != nil {
+				return nil, err
+			}
+			trips = append(trips, trip)
+		}
+	}
+	return trips, nil
+}
+
+// writeJsonFile writes value to destinationFile in indented json format
+func writeJsonFile(destinationFile string, value interface{}) error {
+	file, err := json.MarshalIndent(value, "", " ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(destinationFile, file, 0644)
+}
@@ -0,0 +1,24 @@
+package gtfsmanager
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"testing"
+)
+
+func Test_orderTripInstances(t *testing.T) {
+	tripInstances := map[string]*gtfs.TripInstance{
+		"b": {Trip: gtfs.Trip{TripId: "b"}},
+		"a": {Trip: gtfs.Trip{TripId: "a"}},
+		"c": {Trip: gtfs.Trip{TripId: "c"}},
+	}
+	got := orderTripInstances([]string{"c", "missing", "a", "b"}, tripInstances)
+	want := []string{"c", "a", "b"}
+	if len(got) != len(want) {
+		t.Fatalf("orderTripInstances() returned %d trips, want %d", len(got), len(want))
+	}
+	for i, tripInstance := range got {
+		if tripInstance.TripId != want[i] {
+			t.Errorf("orderTripInstances()[%d] = %s, want %s", i, tripInstance.TripId, want[i])
+		}
+	}
+}
@@ -8,17 +8,30 @@ import (
 const batchedTripCount = 250
 
 // tripRowReader implements gtfsRowReader interface for gtfs.Trip
-// batches inserts
+// batches inserts. shapeIds holds the shape_id of trips with stop times missing shape_dist_traveled.
+// Only trips on routes included by routes are read. Trips are given the route_type of their route in routeTypes.
+// serviceIds holds the service_id of each trip read
 type tripRowReader struct {
 	batchedTrips []*gtfs.Trip
 	stopRR       *stopTimeRowReader
 	shapeRR      *shapeRowReader
+	shapeIds     map[string]string
+	routes       *routeFilter
+	routeTypes   map[string]int
+	serviceIds   map[string]bool
 }
 
-func newTripRowReader(stopRR *stopTimeRowReader, shapeRR *shapeRowReader) *tripRowReader {
+func newTripRowReader(stopRR *stopTimeRowReader,
+	shapeRR *shapeRowReader,
+	routes *routeFilter,
+	routeTypes map[string]int) *tripRowReader {
 	return &tripRowReader{
-		stopRR:  stopRR,
-		shapeRR: shapeRR,
+		stopRR:     stopRR,
+		shapeRR:    shapeRR,
+		shapeIds:   make(map[string]string),
+		routes:     routes,
+		routeTypes: routeTypes,
+		serviceIds: make(map[string]bool),
 	}
 }
 
@@ -27,11 +40,21 @@ func (r *tripRowReader) addRow(parser *gtfsFileParser, dsTx *gtfs.DataSetTransac
 	if err != nil {
 		return err
 	}
+	if !r.routes.includesRoute(trip.RouteId) {
+		return nil
+	}
 	err = r.populateColumnsFromChildren(trip)
 	if err != nil {
 		return err
 	}
+	r.serviceIds[trip.ServiceId] = true
+	if routeType, present := r.routeTypes[trip.RouteId]; present {
+		trip.RouteType = &routeType
+	}
 
+	if _, present := r.stopRR.missingDistances[trip.TripId]; present {
+		r.shapeIds[trip.TripId] = trip.ShapeId
+	}
 	r.batchedTrips = append(r.batchedTrips, trip)
 
 	//check if it's time to save the batch
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/systemevent"
 	"github.com/OpenTransitTools/transitcast/foundation/database"
+	"github.com/jmoiron/sqlx"
 	logger "log"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/OpenTransitTools/transitcast/app/gtfs-loader/gtfsmanager"
 	"github.com/ardanlabs/conf"
@@ -26,16 +34,40 @@ func run(log *logger.Logger) error {
 		conf.Version
 		Args conf.Args
 		DB   struct {
-			User       string `conf:"default:postgres"`
-			Password   string `conf:"default:postgres,noprint"`
-			Host       string `conf:"default:0.0.0.0"`
-			Name       string `conf:"default:postgres"`
-			DisableTLS bool   `conf:"default:true"`
+			User         string `conf:"default:postgres"`
+			Password     string `conf:"default:postgres,noprint"`
+			Host         string `conf:"default:0.0.0.0"`
+			Name         string `conf:"default:postgres"`
+			DisableTLS   bool   `conf:"default:true"`
+			SSLMode      string `conf:"help:Overrides the sslmode chosen by DisableTLS, for example verify-full"`
+			RootCertFile string `conf:"help:PEM file of certificate authorities used to verify the database server"`
+			CertFile     string `conf:"help:PEM client certificate used to authenticate with the database server"`
+			KeyFile      string `conf:"help:PEM key of the client certificate"`
+			Schema       string `conf:"help:Postgres schema holding the agency's tables when several agencies share the database"`
 		}
 		GTFS struct {
-			Url           string `conf:"default:https://developer.trimet.org/schedule/gtfs.zip"`
-			TempDir       string `conf:"default:gtfs_tmp"`
-			ForceDownload bool   `conf:"default:false"`
+			Url            string `conf:"default:https://developer.trimet.org/schedule/gtfs.zip"`
+			TempDir        string `conf:"default:gtfs_tmp"`
+			ForceDownload  bool   `conf:"default:false"`
+			Stream         bool   `conf:"default:true,help:Read the gtfs file with byte range requests instead of downloading it to TempDir when the server supports them"`
+			ConflictPolicy string `conf:"default:fail,help:How rows sharing a key with another row in their file are loaded: fail, keep-first or keep-last"`
+			StopTimes      struct {
+				Workers   int `conf:"default:4,help:Connections copying stop_times.txt in parallel, 0 inserts stop times inside the load transaction"`
+				BatchSize int `conf:"default:10000,help:Number of stop times sent in each copy"`
+			}
+		}
+		Partition struct {
+			Interval      string `conf:"default:monthly"`
+			Count         int    `conf:"default:2"`
+			RetentionDays int    `conf:"default:90"`
+		}
+		ScheduleChange struct {
+			MinimumTravelChangeSeconds int  `conf:"default:60,help:Change in scheduled travel between stops on a trip that affects the models including them"`
+			FlagModels                 bool `conf:"default:true,help:Flag the trained models affected by a newly loaded data set for retraining"`
+		}
+		Adherence struct {
+			EarlySeconds int `conf:"default:60,help:Seconds before schedule a timepoint departure is counted as early"`
+			LateSeconds  int `conf:"default:300,help:Seconds after schedule a timepoint departure is counted as late"`
 		}
 	}
 	cfg.Version.SVN = build
@@ -83,11 +115,16 @@ func run(log *logger.Logger) error {
 	log.Println("main: Initializing database support")
 
 	db, err := database.Open(database.Config{
-		User:       cfg.DB.User,
-		Password:   cfg.DB.Password,
-		Host:       cfg.DB.Host,
-		Name:       cfg.DB.Name,
-		DisableTLS: cfg.DB.DisableTLS,
+		User:         cfg.DB.User,
+		Password:     cfg.DB.Password,
+		Host:         cfg.DB.Host,
+		Name:         cfg.DB.Name,
+		DisableTLS:   cfg.DB.DisableTLS,
+		SSLMode:      cfg.DB.SSLMode,
+		RootCertFile: cfg.DB.RootCertFile,
+		CertFile:     cfg.DB.CertFile,
+		KeyFile:      cfg.DB.KeyFile,
+		Schema:       cfg.DB.Schema,
 	})
 	if err != nil {
 		return fmt.Errorf("connecting to db: %w", err)
@@ -100,13 +137,76 @@ func run(log *logger.Logger) error {
 		}
 	}()
 
+	// cancel any database work in progress on an interrupt or terminate signal from the OS
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	scheduleChangeConf := gtfsmanager.ScheduleChangeConf{
+		MinimumTravelChangeSeconds: cfg.ScheduleChange.MinimumTravelChangeSeconds,
+		FlagModels:                 cfg.ScheduleChange.FlagModels,
+	}
+
 	switch cfg.Args.Num(0) {
 	case "load":
-		err = gtfsmanager.UpdateGTFSSchedule(log, db, cfg.GTFS.TempDir, cfg.GTFS.Url, cfg.GTFS.ForceDownload)
+		loadCmd, err := parseLoadCmd(cfg.Args)
+		if err != nil {
+			log.Printf("error parsing load command: %v", err)
+			printUsage(usage)
+			return err
+		}
+		conflictPolicy, err := gtfsmanager.ParseConflictPolicy(cfg.GTFS.ConflictPolicy)
+		if err != nil {
+			return err
+		}
+		dataSet, err := gtfsmanager.UpdateGTFSSchedule(ctx, log, db, cfg.GTFS.TempDir, cfg.GTFS.Url,
+			cfg.GTFS.ForceDownload, cfg.GTFS.Stream, gtfsmanager.StopTimeLoadConf{
+				Workers:   cfg.GTFS.StopTimes.Workers,
+				BatchSize: cfg.GTFS.StopTimes.BatchSize,
+			}, conflictPolicy, loadCmd.routeIds)
+		if err != nil {
+			return err
+		}
+		if dataSet != nil {
+			recordDataSetEvent(ctx, log, db, systemevent.DataSetLoaded, "loaded", dataSet)
+			reportScheduleChanges(ctx, log, db, dataSet, scheduleChangeConf)
+		}
+		return gtfsmanager.ListGTFSSchedules(ctx, db)
+	case "resume":
+		loadCmd, err := parseLoadCmd(cfg.Args)
+		if err != nil {
+			log.Printf("error parsing resume command: %v", err)
+			printUsage(usage)
+			return err
+		}
+		conflictPolicy, err := gtfsmanager.ParseConflictPolicy(cfg.GTFS.ConflictPolicy)
+		if err != nil {
+			return err
+		}
+		dataSet, err := gtfsmanager.ResumeGTFSSchedule(ctx, log, db, cfg.GTFS.TempDir, cfg.GTFS.Stream,
+			gtfsmanager.StopTimeLoadConf{
+				Workers:   cfg.GTFS.StopTimes.Workers,
+				BatchSize: cfg.GTFS.StopTimes.BatchSize,
+			}, conflictPolicy, loadCmd.routeIds)
 		if err != nil {
 			return err
 		}
-		return gtfsmanager.ListGTFSSchedules(db)
+		recordDataSetEvent(ctx, log, db, systemevent.DataSetLoaded, "loaded", dataSet)
+		reportScheduleChanges(ctx, log, db, dataSet, scheduleChangeConf)
+		return gtfsmanager.ListGTFSSchedules(ctx, db)
+	case "scheduleChanges":
+		previousDataSetId, err := strconv.ParseInt(cfg.Args.Num(1), 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected previous data set id with command scheduleChanges, found %q", cfg.Args.Num(1))
+		}
+		dataSetId, err := strconv.ParseInt(cfg.Args.Num(2), 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected data set id with command scheduleChanges, found %q", cfg.Args.Num(2))
+		}
+		_, err = gtfsmanager.ReportScheduleChanges(ctx, log, db, previousDataSetId, dataSetId,
+			gtfsmanager.ScheduleChangeConf{
+				MinimumTravelChangeSeconds: cfg.ScheduleChange.MinimumTravelChangeSeconds,
+			}, os.Stdout)
+		return err
 	case "delete":
 		dataSetIdString := cfg.Args.Num(1)
 		if len(dataSetIdString) < 1 {
@@ -116,10 +216,15 @@ func run(log *logger.Logger) error {
 		if err != nil {
 			return fmt.Errorf("unable to parse data set id %s, error: %w", dataSetIdString, err)
 		}
-		return gtfsmanager.DeleteGTFSSchedule(log, db, dataSetId)
+		dataSet, err := gtfsmanager.DeleteGTFSSchedule(ctx, log, db, dataSetId)
+		if err != nil {
+			return err
+		}
+		recordDataSetEvent(ctx, log, db, systemevent.DataSetDeleted, "deleted", dataSet)
+		return nil
 
 	case "list":
-		return gtfsmanager.ListGTFSSchedules(db)
+		return gtfsmanager.ListGTFSSchedules(ctx, db)
 	case "exportTrip":
 		exportCmd, err := parseTripExportCmd(cfg.Args)
 		if err != nil {
@@ -127,7 +232,34 @@ func run(log *logger.Logger) error {
 			printUsage(usage)
 			return err
 		}
-		return gtfsmanager.ExportTripToJson(log, db, exportCmd.date, exportCmd.tripId, exportCmd.destinationFile)
+		return gtfsmanager.ExportTripToJson(ctx, log, db, exportCmd.date, exportCmd.tripId, exportCmd.destinationFile)
+	case "exportBlock":
+		exportCmd, err := parseServiceDateExportCmd(cfg.Args, "blockId")
+		if err != nil {
+			log.Printf("error parsing exportBlock command: %v", err)
+			printUsage(usage)
+			return err
+		}
+		return gtfsmanager.ExportBlockToJson(ctx, log, db, exportCmd.serviceDate, exportCmd.id,
+			exportCmd.destinationFile)
+	case "exportRoute":
+		exportCmd, err := parseServiceDateExportCmd(cfg.Args, "routeId")
+		if err != nil {
+			log.Printf("error parsing exportRoute command: %v", err)
+			printUsage(usage)
+			return err
+		}
+		return gtfsmanager.ExportRouteToJson(ctx, log, db, exportCmd.serviceDate, exportCmd.id,
+			exportCmd.destinationFile)
+	case "exportVehicleHistory":
+		exportCmd, err := parseServiceDateExportCmd(cfg.Args, "vehicleId")
+		if err != nil {
+			log.Printf("error parsing exportVehicleHistory command: %v", err)
+			printUsage(usage)
+			return err
+		}
+		return gtfsmanager.ExportVehicleHistoryToJson(ctx, log, db, exportCmd.serviceDate, exportCmd.id,
+			exportCmd.destinationFile)
 	case "exportAggregator":
 		exportCmd, err := parseAggregatorExportCmd(cfg.Args)
 		if err != nil {
@@ -135,8 +267,56 @@ func run(log *logger.Logger) error {
 			printUsage(usage)
 			return err
 		}
-		return gtfsmanager.ExportAggregatorDataToJson(log, db, exportCmd.start, exportCmd.end,
+		return gtfsmanager.ExportAggregatorDataToJson(ctx, log, db, exportCmd.start, exportCmd.end,
 			exportCmd.vehicleId, exportCmd.destinationFile)
+	case "exportObservations":
+		exportCmd, err := parseObservationExportCmd(cfg.Args)
+		if err != nil {
+			log.Printf("error parsing exportObservations command: %v", err)
+			printUsage(usage)
+			return err
+		}
+		return gtfsmanager.ExportObservations(ctx, log, db, exportCmd.start, exportCmd.end, exportCmd.routeIds,
+			exportCmd.format, exportCmd.destinationFile)
+	case "adherenceReport":
+		reportCmd, err := parseAdherenceReportCmd(cfg.Args)
+		if err != nil {
+			log.Printf("error parsing adherenceReport command: %v", err)
+			printUsage(usage)
+			return err
+		}
+		return gtfsmanager.WriteAdherenceReport(ctx, log, db, reportCmd.start, reportCmd.end, reportCmd.routeIds,
+			gtfsmanager.AdherenceConf{
+				EarlySeconds: cfg.Adherence.EarlySeconds,
+				LateSeconds:  cfg.Adherence.LateSeconds,
+			}, reportCmd.destinationFile)
+	case "generateSample":
+		sampleCmd, err := parseSampleCmd(cfg.Args)
+		if err != nil {
+			log.Printf("error parsing generateSample command: %v", err)
+			printUsage(usage)
+			return err
+		}
+		return gtfsmanager.GenerateSample(ctx, log, db, sampleCmd.dataSetId, sampleCmd.serviceDate,
+			sampleCmd.routeIds, sampleCmd.destinationDirectory)
+	case "createPartitions":
+		interval, err := gtfs.ParsePartitionInterval(cfg.Partition.Interval)
+		if err != nil {
+			return err
+		}
+		return gtfsmanager.CreatePartitions(ctx, log, db, time.Now(), interval, cfg.Partition.Count)
+	case "dropPartitions":
+		return gtfsmanager.DropExpiredPartitions(ctx, log, db, time.Now(), cfg.Partition.RetentionDays)
+	case "listPartitions":
+		return gtfsmanager.ListPartitions(ctx, db)
+	case "history":
+		historyCmd, err := parseHistoryCmd(cfg.Args)
+		if err != nil {
+			log.Printf("error parsing history command: %v", err)
+			printUsage(usage)
+			return err
+		}
+		return gtfsmanager.ListSystemEvents(ctx, db, historyCmd.start, historyCmd.end, historyCmd.eventTypes)
 
 	default:
 		printUsage(usage)
@@ -144,15 +324,99 @@ func run(log *logger.Logger) error {
 	}
 }
 
+// recordDataSetEvent records a systemevent.SystemEvent of eventType describing dataSet as action, logging rather than
+// returning failures as the change to dataSet has already been made
+func recordDataSetEvent(ctx context.Context,
+	log *logger.Logger,
+	db *sqlx.DB,
+	eventType string,
+	action string,
+	dataSet *gtfs.DataSet) {
+	err := systemevent.Record(ctx, db, &systemevent.SystemEvent{
+		CreatedAt:   time.Now(),
+		App:         "gtfs-loader",
+		Version:     build,
+		EventType:   eventType,
+		Description: fmt.Sprintf("%s data set %d from %s", action, dataSet.Id, dataSet.URL),
+		Details:     dataSet.String(),
+	})
+	if err != nil {
+		log.Printf("main: unable to record %s in system_event: %v", eventType, err)
+	}
+}
+
+// reportScheduleChanges reports the changes from the data set replaced by dataSet, flagging the models affected when
+// conf.FlagModels is set, and records them as a systemevent.ScheduleChanged event. Failures are logged rather than
+// returned as dataSet has already been loaded
+func reportScheduleChanges(ctx context.Context,
+	log *logger.Logger,
+	db *sqlx.DB,
+	dataSet *gtfs.DataSet,
+	conf gtfsmanager.ScheduleChangeConf) {
+	report, err := gtfsmanager.ReportReplacedScheduleChanges(ctx, log, db, dataSet, conf, os.Stdout)
+	if err != nil {
+		log.Printf("main: unable to report schedule changes: %v", err)
+		return
+	}
+	if report == nil {
+		return
+	}
+	details, err := json.Marshal(report)
+	if err != nil {
+		log.Printf("main: unable to encode schedule changes: %v", err)
+		return
+	}
+	err = systemevent.Record(ctx, db, &systemevent.SystemEvent{
+		CreatedAt:   time.Now(),
+		App:         "gtfs-loader",
+		Version:     build,
+		EventType:   systemevent.ScheduleChanged,
+		Description: report.String(),
+		Details:     string(details),
+	})
+	if err != nil {
+		log.Printf("main: unable to record %s in system_event: %v", systemevent.ScheduleChanged, err)
+	}
+}
+
 func printUsage(confUsage string) {
 	fmt.Println(confUsage)
 	fmt.Println("commands:")
-	fmt.Println("load: download and update (if needed) latest gtfs data set")
+	fmt.Println("load [--routes=<routeIds separated by commas>]: download and update (if needed) latest gtfs data " +
+		"set, only loading trips on the routes when present")
+	fmt.Println("resume [--routes=<routeIds separated by commas>]: continue loading the gtfs data set left staged by " +
+		"a load that did not complete, skipping the files it already loaded")
+	fmt.Println("scheduleChanges <previousDataSetID> <dataSetID>: list the trips, stop patterns and timepoints " +
+		"changed between two data sets and the trained models affected")
 	fmt.Println("delete <dataSetID>: remove a gtfs data set from the database with <dataSetID>")
 	fmt.Println("list: list all gtfs data sets in the database")
 	fmt.Println("exportTrip <tripID> <date in yyyy-MM-ddTHH:mm:ssZ> " +
 		"<destination>: export trip instance in json format to destination file")
+	fmt.Println("exportBlock <blockID> <service date in yyyy-MM-dd> <destination>: export the trip instances on a " +
+		"block in json format to destination file")
+	fmt.Println("exportRoute <routeID> <service date in yyyy-MM-dd> <destination>: export the trip instances on a " +
+		"route in json format to destination file")
+	fmt.Println("exportVehicleHistory <vehicleID> <service date in yyyy-MM-dd> <destination>: export the trip " +
+		"deviations and observed stop times of a vehicle with their trip instances in json format to destination file")
 	fmt.Println("exportAggregator <start in yyyy-MM-ddTHH:mm:ssZ> <end in yyyy-MM-ddTHH:mm:ssZ> <vehicleId> <destination>" +
 		": export trip instance in json format to destination file")
+	fmt.Println("exportObservations --from=<start in yyyy-MM-ddTHH:mm:ssZ> --to=<end in yyyy-MM-ddTHH:mm:ssZ> " +
+		"--out=<destination> [--route=<routeIds separated by commas>] [--format=<csv or parquet>]: export observed " +
+		"stop times with their scheduled trip details in csv or parquet format to destination file, the format " +
+		"following the destination's extension when not given")
+	fmt.Println("adherenceReport <start in yyyy-MM-ddTHH:mm:ssZ> <end in yyyy-MM-ddTHH:mm:ssZ> <destination.csv> " +
+		"[routeIds separated by semicolons]: write counts of early, on time and late timepoint departures for " +
+		"each route and service date in csv format to destination file")
+	fmt.Println("generateSample <dataSetID> <service date in yyyy-MM-dd> <destination directory> " +
+		"<routeIds separated by semicolons>: write an anonymized gtfs zip file of the routes on the service date and " +
+		"synthetic vehicle positions following its blocks to destination directory")
+	fmt.Println("createPartitions: create partitions of observed_stop_time and trip_deviation tables, " +
+		"starting with the current partition")
+	fmt.Println("dropPartitions: remove partitions of observed_stop_time and trip_deviation tables " +
+		"older than the retention days")
+	fmt.Println("listPartitions: list partitions of observed_stop_time and trip_deviation tables")
+	fmt.Println("history <start in yyyy-MM-ddTHH:mm:ssZ> <end in yyyy-MM-ddTHH:mm:ssZ> " +
+		"[event types separated by semicolons]: list data set loads, deletions and schedule changes, model " +
+		"discoveries, configuration changes and app starts and stops recorded between start and end")
 	fmt.Println("Note: in date formats Z is local time minus UTC, example -0700 for 7 hours")
 }
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"github.com/ardanlabs/conf"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -95,3 +97,229 @@ func parseTimeArg(argPosition int, name string, args conf.Args) (*time.Time, err
 	}
 	return &date, nil
 }
+
+// observationExportCmd contains required arguments for exportObservations command execution
+type observationExportCmd struct {
+	start           time.Time
+	end             time.Time
+	destinationFile string
+	format          string
+	routeIds        []string
+}
+
+// parseObservationExportCmd using conf.Args attempts to load observationExportCmd from --from=, --to= and --out=,
+// returns error if any are not present or malformed. --route=<routeIds separated by commas> and --format=<csv or
+// parquet> are optional, the format follows the extension of --out when not given
+func parseObservationExportCmd(args conf.Args) (*observationExportCmd, error) {
+	cmd := observationExportCmd{}
+	var from, to string
+	for i := 1; i < len(args); i++ {
+		arg := args.Num(i)
+		switch {
+		case strings.HasPrefix(arg, "--from="):
+			from = strings.TrimPrefix(arg, "--from=")
+		case strings.HasPrefix(arg, "--to="):
+			to = strings.TrimPrefix(arg, "--to=")
+		case strings.HasPrefix(arg, "--out="):
+			cmd.destinationFile = strings.TrimPrefix(arg, "--out=")
+		case strings.HasPrefix(arg, "--format="):
+			cmd.format = strings.ToLower(strings.TrimPrefix(arg, "--format="))
+		case strings.HasPrefix(arg, "--route="):
+			for _, routeId := range strings.Split(strings.TrimPrefix(arg, "--route="), ",") {
+				if routeId = strings.TrimSpace(routeId); len(routeId) > 0 {
+					cmd.routeIds = append(cmd.routeIds, routeId)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unexpected argument %s with command %s", arg, args.Num(0))
+		}
+	}
+
+	start, err := parseTimeFlag("from", from)
+	if err != nil {
+		return nil, err
+	}
+	cmd.start = *start
+	end, err := parseTimeFlag("to", to)
+	if err != nil {
+		return nil, err
+	}
+	cmd.end = *end
+	if len(cmd.destinationFile) < 1 {
+		return nil, fmt.Errorf("expected destination file with --out= for command exportObservations")
+	}
+	return &cmd, nil
+}
+
+// parseTimeFlag parses the value of the flag --name=
+// returns result or error with description of expected flag
+func parseTimeFlag(name string, value string) (*time.Time, error) {
+	if len(value) < 1 {
+		return nil, fmt.Errorf("expected --%s= in yyyy-MM-ddTHH:mm:ss-0000 format", name)
+	}
+	date, err := time.Parse("2006-01-02T15:04:05-0700", value)
+	if err != nil {
+		return nil, fmt.Errorf("expected --%s= in yyyy-MM-ddTHH:mm:ss-0000 format, unable to parse %s", name, value)
+	}
+	return &date, nil
+}
+
+// adherenceReportCmd contains required arguments for adherenceReport command execution
+type adherenceReportCmd struct {
+	start           time.Time
+	end             time.Time
+	destinationFile string
+	routeIds        []string
+}
+
+// parseAdherenceReportCmd using conf.Args attempts to load adherenceReportCmd, returns error if any arguments are
+// not present or malformed. routeIds are optional and separated by semicolons
+func parseAdherenceReportCmd(args conf.Args) (*adherenceReportCmd, error) {
+	startDate, err := parseTimeArg(1, "start", args)
+	if err != nil {
+		return nil, err
+	}
+
+	endDate, err := parseTimeArg(2, "end", args)
+	if err != nil {
+		return nil, err
+	}
+
+	destinationFile := args.Num(3)
+	if len(destinationFile) < 1 {
+		return nil, fmt.Errorf("expected destination command adherenceReport in position 3")
+	}
+
+	var routeIds []string
+	if routes := args.Num(4); len(routes) > 0 {
+		routeIds = strings.Split(routes, ";")
+	}
+	return &adherenceReportCmd{
+		start:           *startDate,
+		end:             *endDate,
+		destinationFile: destinationFile,
+		routeIds:        routeIds,
+	}, nil
+}
+
+// loadCmd contains optional arguments for load command execution
+type loadCmd struct {
+	routeIds []string
+}
+
+// parseLoadCmd using conf.Args attempts to load loadCmd, returns error if any arguments are malformed.
+// routes to load are optional, given as --routes=<routeIds separated by commas>
+func parseLoadCmd(args conf.Args) (*loadCmd, error) {
+	cmd := loadCmd{}
+	for i := 1; i < len(args); i++ {
+		arg := args.Num(i)
+		if !strings.HasPrefix(arg, "--routes=") {
+			return nil, fmt.Errorf("unexpected argument %s with command %s", arg, args.Num(0))
+		}
+		for _, routeId := range strings.Split(strings.TrimPrefix(arg, "--routes="), ",") {
+			if routeId = strings.TrimSpace(routeId); len(routeId) > 0 {
+				cmd.routeIds = append(cmd.routeIds, routeId)
+			}
+		}
+	}
+	return &cmd, nil
+}
+
+// sampleCmd contains required arguments for generateSample command execution
+type sampleCmd struct {
+	dataSetId            int64
+	serviceDate          time.Time
+	destinationDirectory string
+	routeIds             []string
+}
+
+// parseSampleCmd using conf.Args attempts to load sampleCmd, returns error if any arguments are not present or
+// malformed. routeIds are separated by semicolons
+func parseSampleCmd(args conf.Args) (*sampleCmd, error) {
+	dataSetId, err := strconv.ParseInt(args.Num(1), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("expected data set id in position 1 with command generateSample, error: %w", err)
+	}
+	serviceDate, err := time.ParseInLocation("2006-01-02", args.Num(2), time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("expected service date in yyyy-MM-dd format in position 2 with command "+
+			"generateSample, error: %w", err)
+	}
+	destinationDirectory := args.Num(3)
+	if len(destinationDirectory) < 1 {
+		return nil, fmt.Errorf("expected destination directory in position 3 with command generateSample")
+	}
+	routes := args.Num(4)
+	if len(routes) < 1 {
+		return nil, fmt.Errorf("expected routeIds separated by semicolons in position 4 with command generateSample")
+	}
+	return &sampleCmd{
+		dataSetId:            dataSetId,
+		serviceDate:          serviceDate,
+		destinationDirectory: destinationDirectory,
+		routeIds:             strings.Split(routes, ";"),
+	}, nil
+}
+
+// serviceDateExportCmd contains required arguments for commands exporting the trips or history of an id on a
+// service date: exportBlock, exportRoute and exportVehicleHistory
+type serviceDateExportCmd struct {
+	id              string
+	serviceDate     time.Time
+	destinationFile string
+}
+
+// parseServiceDateExportCmd using conf.Args attempts to load serviceDateExportCmd, returns error if any arguments are
+// not present or malformed. idName describes the id expected in position 1
+func parseServiceDateExportCmd(args conf.Args, idName string) (*serviceDateExportCmd, error) {
+	command := args.Num(0)
+	id := args.Num(1)
+	if len(id) < 1 {
+		return nil, fmt.Errorf("expected %s in position 1 with command %s", idName, command)
+	}
+	serviceDate, err := time.ParseInLocation("2006-01-02", args.Num(2), time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("expected service date in yyyy-MM-dd format in position 2 with command %s, "+
+			"error: %w", command, err)
+	}
+	destinationFile := args.Num(3)
+	if len(destinationFile) < 1 {
+		return nil, fmt.Errorf("expected destination file in position 3 with command %s", command)
+	}
+	return &serviceDateExportCmd{
+		id:              id,
+		serviceDate:     serviceDate,
+		destinationFile: destinationFile,
+	}, nil
+}
+
+// historyCmd contains required arguments for history command execution
+type historyCmd struct {
+	start      time.Time
+	end        time.Time
+	eventTypes []string
+}
+
+// parseHistoryCmd using conf.Args attempts to load historyCmd, returns error if any arguments are not present or
+// malformed. eventTypes are optional and separated by semicolons
+func parseHistoryCmd(args conf.Args) (*historyCmd, error) {
+	startDate, err := parseTimeArg(1, "start", args)
+	if err != nil {
+		return nil, err
+	}
+
+	endDate, err := parseTimeArg(2, "end", args)
+	if err != nil {
+		return nil, err
+	}
+
+	var eventTypes []string
+	if types := args.Num(3); len(types) > 0 {
+		eventTypes = strings.Split(types, ";")
+	}
+	return &historyCmd{
+		start:      *startDate,
+		end:        *endDate,
+		eventTypes: eventTypes,
+	}, nil
+}
@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
+	"expvar"
 	"fmt"
 	"github.com/OpenTransitTools/transitcast/app/gtfs-monitor/monitor"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/systemevent"
+	"github.com/OpenTransitTools/transitcast/foundation/clock"
 	"github.com/OpenTransitTools/transitcast/foundation/database"
+	"github.com/OpenTransitTools/transitcast/foundation/health"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
 	"github.com/ardanlabs/conf"
-	"github.com/nats-io/nats.go"
+	"github.com/jmoiron/sqlx"
 	logger "log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 var build = "develop"
@@ -27,20 +36,85 @@ func run(log *logger.Logger) error {
 		conf.Version
 		Args conf.Args
 		DB   struct {
-			User       string `conf:"default:postgres"`
-			Password   string `conf:"default:postgres,noprint"`
-			Host       string `conf:"default:0.0.0.0"`
-			Name       string `conf:"default:postgres"`
-			DisableTLS bool   `conf:"default:true"`
+			User         string `conf:"default:postgres"`
+			Password     string `conf:"default:postgres,noprint"`
+			Host         string `conf:"default:0.0.0.0"`
+			Name         string `conf:"default:postgres"`
+			DisableTLS   bool   `conf:"default:true"`
+			SSLMode      string `conf:"help:Overrides the sslmode chosen by DisableTLS, for example verify-full"`
+			RootCertFile string `conf:"help:PEM file of certificate authorities used to verify the database server"`
+			CertFile     string `conf:"help:PEM client certificate used to authenticate with the database server"`
+			KeyFile      string `conf:"help:PEM key of the client certificate"`
+			Schema       string `conf:"help:Postgres schema holding the agency's tables when several agencies share the database"`
+			//QueryTimeoutSeconds limits how long any database query may run
+			QueryTimeoutSeconds int `conf:"default:30"`
 		}
 		NATS struct {
-			URL string `conf:"default:localhost"`
+			URL                       string `conf:"default:localhost"`
+			MaxReconnects             int    `conf:"default:-1,help:Reconnect attempts before giving up on a lost connection, negative values never give up"`
+			ReconnectWaitMilliseconds int    `conf:"default:500"`
+			MaxReconnectWaitSeconds   int    `conf:"default:30"`
+			ReconnectBufferBytes      int    `conf:"default:8388608"`
+			CredentialsFile           string `conf:"help:NATS user credentials file holding a user JWT and NKey seed"`
+			NKeySeedFile              string `conf:"help:File holding an NKey seed to authenticate with instead of a credentials file"`
+			RootCAFile                string `conf:"help:PEM file of certificate authorities used to verify the NATS server"`
+			CertFile                  string `conf:"help:PEM client certificate presented to the NATS server"`
+			KeyFile                   string `conf:"help:PEM key of the client certificate"`
+			Tenant                    string `conf:"help:Agency whose subjects are prefixed with <tenant>. when several agencies share NATS servers"`
+			Compression               string `conf:"default:none,help:Compression of published message payloads which is one of none gzip or snappy"`
+			Encoding                  string `conf:"default:json,help:Encoding of published message payloads, json or protobuf"`
 		}
 		GTFS struct {
-			VehiclePositionsUrl   string  `conf:"default:https://developer.trimet.org/ws/V1/VehiclePositions"`
-			LoadEverySeconds      int     `conf:"default:3"`
-			EarlyTolerance        float64 `conf:"default:0.1"`
-			ExpirePositionSeconds int     `conf:"default:900"`
+			PositionSource                 string   `conf:"default:http,help:Where vehicle positions are received from, http polls VehiclePositionsUrl and mqtt subscribes to MQTT_TOPICS"`
+			VehiclePositionsUrl            string   `conf:"default:https://developer.trimet.org/ws/V1/VehiclePositions"`
+			LoadEverySeconds               int      `conf:"default:3"`
+			MaxFetchBackoffSeconds         int      `conf:"default:60,help:Longest delay between attempts to retrieve vehicle positions after failures"`
+			MaxFeedStaleSeconds            int      `conf:"default:90,help:Seconds the feed header timestamp may stop advancing before snapshots are ignored, 0 disables"`
+			EarlyTolerance                 float64  `conf:"default:0.1"`
+			RouteTypeEarlyTolerance        []string `conf:"default:0:0.2;1:0.2;2:0.2,help:List route_type:tolerance separated by semicolons overriding EarlyTolerance for trips with the route_type."`
+			ExpirePositionSeconds          int      `conf:"default:900"`
+			RouteTypeExpirePositionSeconds []string `conf:"help:List route_type:seconds separated by semicolons overriding ExpirePositionSeconds for trips with the route_type."`
+			MinimumMovementMeters          float64  `conf:"default:5"`
+			DistanceMedianWindow           int      `conf:"default:3"`
+			Interpolation                  string   `conf:"default:schedule,help:How travel between positions is split between the stops passed, schedule by scheduled time or distance by shape distance and scheduled speed"`
+			TripCacheSize                  int      `conf:"default:10000"`
+			PositionWorkers                int      `conf:"default:4,help:Number of goroutines processing vehicle positions concurrently"`
+			ReorderDelaySeconds            int      `conf:"default:0,help:Seconds positions are held so those received out of order can be processed in timestamp order, 0 disables"`
+			StaleToleranceSeconds          int      `conf:"default:0,help:Seconds a position may be older than the vehicle's last position and still be used, older positions are dropped"`
+		}
+		MQTT struct {
+			BrokerURL             string   `conf:"help:MQTT broker vehicle positions are published on, for example tcp://broker:1883 or ssl://broker:8883"`
+			Topics                []string `conf:"help:List topic filters separated by semicolons, each message is a GTFS-RT FeedMessage"`
+			QoS                   int      `conf:"default:1,help:MQTT quality of service subscribed with, 0, 1 or 2"`
+			ClientId              string   `conf:"default:gtfs-monitor,help:Client id identifying the session on the broker, must be unique on the broker"`
+			Username              string
+			Password              string `conf:"noprint"`
+			CleanSession          bool   `conf:"default:false,help:Discard the session when disconnected, otherwise QoS 1 and 2 messages published while disconnected are delivered on reconnect"`
+			ConnectTimeoutSeconds int    `conf:"default:30"`
+			MaxPendingMessages    int    `conf:"default:100000,help:Messages held between runs of the monitor loop before the oldest are dropped, 0 is unlimited"`
+		}
+		Filter struct {
+			IncludedRouteIds          []string `conf:"help:List route_ids separated by semicolons. If included only vehicles on these route_ids will be monitored."`
+			ExcludedRouteIds          []string `conf:"help:List route_ids separated by semicolons. Vehicles on these route_ids will not be monitored."`
+			IncludedVehicleIdPatterns []string `conf:"help:List regular expressions separated by semicolons. If included only vehicles with matching ids will be monitored."`
+			ExcludedVehicleIdPatterns []string `conf:"help:List regular expressions separated by semicolons. Vehicles with matching ids will not be monitored."`
+		}
+		Assignments struct {
+			Publish        bool `conf:"default:false,help:Publish the trip and block each vehicle is on to the vehicle-assignments subject"`
+			RefreshSeconds int  `conf:"default:60,help:Seconds between publishing a vehicle's assignment again while it stays on the same trip"`
+		}
+		Outliers struct {
+			ZScore     float64 `conf:"default:0,help:Standard deviations from the mean travel time between stops beyond which observations are quarantined, 0 disables"`
+			MinSamples int     `conf:"default:30"`
+			Window     int     `conf:"default:200"`
+		}
+		Web struct {
+			DebugHost      string `conf:"default:0.0.0.0:4000"`
+			DebugPositions bool   `conf:"default:false,help:Serve the last vehicle position snapshot and what became of each position on /debug/positions"`
+		}
+		Health struct {
+			CheckTimeoutSeconds   int `conf:"default:5"`
+			MaxPositionAgeSeconds int `conf:"default:120,help:/healthz fails when vehicle positions have not been retrieved within this many seconds"`
 		}
 		RecordToDatabase bool `conf:"default:true"`
 		PublishOverNats  bool `conf:"default:true"`
@@ -72,6 +146,7 @@ func run(log *logger.Logger) error {
 	// App Starting
 
 	// Print the build version for our logs. Also expose it under /debug/vars.
+	expvar.NewString("build").Set(build)
 	log.Printf("main : Started : Application initializing : version %s", build)
 	defer log.Println("main: Completed")
 
@@ -81,17 +156,48 @@ func run(log *logger.Logger) error {
 	}
 	log.Printf("main: Config :\n%v\n", out)
 
+	// =========================================================================
+	// Start Debug Service
+	//
+	// /debug/vars - Exported metrics, including counts of filtered vehicle positions
+	// /healthz - Fails when vehicle positions haven't been retrieved recently
+	// /readyz - Also fails when the database, NATS or a schedule data set is unavailable
+	// /debug/positions - The last vehicle position snapshot, when enabled by DebugPositions
+
+	var positionDebugger *monitor.PositionDebugger
+	if cfg.Web.DebugPositions {
+		positionDebugger = monitor.NewPositionDebugger()
+		http.Handle("/debug/positions", positionDebugger)
+	}
+	checks := health.New(time.Duration(cfg.Health.CheckTimeoutSeconds) * time.Second)
+	checks.Register(http.DefaultServeMux)
+	positionPolls := health.NewHeartbeat(time.Now())
+	checks.AddLiveness("vehicle_positions",
+		positionPolls.Check(time.Duration(cfg.Health.MaxPositionAgeSeconds)*time.Second))
+
+	log.Printf("main: Debug Listening %s", cfg.Web.DebugHost)
+	go func() {
+		if err := http.ListenAndServe(cfg.Web.DebugHost, http.DefaultServeMux); err != nil {
+			log.Printf("main: Debug Listener closed : %v", err)
+		}
+	}()
+
 	// =========================================================================
 	// Start Database
 
 	log.Println("main: Initializing database support")
 
 	db, err := database.Open(database.Config{
-		User:       cfg.DB.User,
-		Password:   cfg.DB.Password,
-		Host:       cfg.DB.Host,
-		Name:       cfg.DB.Name,
-		DisableTLS: cfg.DB.DisableTLS,
+		User:         cfg.DB.User,
+		Password:     cfg.DB.Password,
+		Host:         cfg.DB.Host,
+		Name:         cfg.DB.Name,
+		DisableTLS:   cfg.DB.DisableTLS,
+		SSLMode:      cfg.DB.SSLMode,
+		RootCertFile: cfg.DB.RootCertFile,
+		CertFile:     cfg.DB.CertFile,
+		KeyFile:      cfg.DB.KeyFile,
+		Schema:       cfg.DB.Schema,
 	})
 	if err != nil {
 		return fmt.Errorf("connecting to db: %w", err)
@@ -104,11 +210,74 @@ func run(log *logger.Logger) error {
 		}
 	}()
 
+	if cfg.Args.Num(0) == "backfill" {
+		return backfill(log, db, cfg.Args.Num(1), monitor.BackfillConf{
+			EarlyTolerance:                 cfg.GTFS.EarlyTolerance,
+			RouteTypeEarlyTolerance:        cfg.GTFS.RouteTypeEarlyTolerance,
+			ExpirePositionSeconds:          cfg.GTFS.ExpirePositionSeconds,
+			RouteTypeExpirePositionSeconds: cfg.GTFS.RouteTypeExpirePositionSeconds,
+			MinimumMovementMeters:          cfg.GTFS.MinimumMovementMeters,
+			DistanceMedianWindow:           cfg.GTFS.DistanceMedianWindow,
+			Interpolation:                  cfg.GTFS.Interpolation,
+			StaleToleranceSeconds:          cfg.GTFS.StaleToleranceSeconds,
+			TripCacheSize:                  cfg.GTFS.TripCacheSize,
+			QueryTimeoutSeconds:            cfg.DB.QueryTimeoutSeconds,
+			PositionWorkers:                cfg.GTFS.PositionWorkers,
+			VehicleFilter: monitor.VehicleFilterConf{
+				IncludedRouteIds:          cfg.Filter.IncludedRouteIds,
+				ExcludedRouteIds:          cfg.Filter.ExcludedRouteIds,
+				IncludedVehicleIdPatterns: cfg.Filter.IncludedVehicleIdPatterns,
+				ExcludedVehicleIdPatterns: cfg.Filter.ExcludedVehicleIdPatterns,
+			},
+			Outliers: monitor.OutlierConf{
+				ZScore:     cfg.Outliers.ZScore,
+				MinSamples: cfg.Outliers.MinSamples,
+				Window:     cfg.Outliers.Window,
+			},
+		})
+	}
+
+	checks.AddReadiness("database", health.DatabaseCheck(db))
+	checks.AddReadiness("data_set", func(ctx context.Context) error {
+		_, err := gtfs.GetDataSetAt(ctx, db, time.Now())
+		return err
+	})
+
+	// =========================================================================
+	// Record start and stop in the system_event audit trail
+
+	queryTimeout := time.Duration(cfg.DB.QueryTimeoutSeconds) * time.Second
+	startCtx, cancelStart := context.WithTimeout(context.Background(), queryTimeout)
+	err = systemevent.RecordAppStart(startCtx, db, "gtfs-monitor", build, out, time.Now())
+	cancelStart()
+	if err != nil {
+		log.Printf("main: unable to record start in system_event: %v", err)
+	}
+	defer func() {
+		stopCtx, cancelStop := context.WithTimeout(context.Background(), queryTimeout)
+		defer cancelStop()
+		if err := systemevent.RecordAppStop(stopCtx, db, "gtfs-monitor", build, time.Now()); err != nil {
+			log.Printf("main: unable to record stop in system_event: %v", err)
+		}
+	}()
+
 	// =========================================================================
 	// Start nats
 
 	log.Printf("main: Connecting to NATS\n")
-	natsConnection, err := nats.Connect(cfg.NATS.URL)
+	natsConnection, err := natsclient.Connect(log, natsclient.Config{
+		URL:                  cfg.NATS.URL,
+		Name:                 "gtfs-monitor",
+		MaxReconnects:        cfg.NATS.MaxReconnects,
+		ReconnectWait:        time.Duration(cfg.NATS.ReconnectWaitMilliseconds) * time.Millisecond,
+		MaxReconnectWait:     time.Duration(cfg.NATS.MaxReconnectWaitSeconds) * time.Second,
+		ReconnectBufferBytes: cfg.NATS.ReconnectBufferBytes,
+		CredentialsFile:      cfg.NATS.CredentialsFile,
+		NKeySeedFile:         cfg.NATS.NKeySeedFile,
+		RootCAFile:           cfg.NATS.RootCAFile,
+		CertFile:             cfg.NATS.CertFile,
+		KeyFile:              cfg.NATS.KeyFile,
+	})
 	if err != nil {
 		return fmt.Errorf("unable to establish connection to nats server: %w", err)
 	}
@@ -116,21 +285,103 @@ func run(log *logger.Logger) error {
 		log.Printf("main: closing connection to NATS")
 		natsConnection.Close()
 	}()
+	checks.AddReadiness("nats", health.NatsCheck(natsConnection))
 
 	// Make a channel to listen for an interrupt or terminate signal from the OS.
 	// Use a buffered channel because the signal package requires it.
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
-	return monitor.RunVehicleMonitorLoop(log, db, natsConnection,
-		cfg.GTFS.VehiclePositionsUrl, cfg.GTFS.LoadEverySeconds,
-		cfg.GTFS.EarlyTolerance, cfg.GTFS.ExpirePositionSeconds,
-		cfg.RecordToDatabase,
-		cfg.PublishOverNats,
-		shutdown)
+	natsCodec, err := natsclient.NewCodec(cfg.NATS.Compression, cfg.NATS.Encoding)
+	if err != nil {
+		return err
+	}
+	natsSubjects, err := natsclient.NewSubjects(cfg.NATS.Tenant)
+	if err != nil {
+		return err
+	}
+
+	return monitor.RunVehicleMonitorLoop(log, db, natsConnection, monitor.Conf{
+		NatsCodec:    natsCodec,
+		NatsSubjects: natsSubjects,
+		PositionSource: monitor.PositionSourceConf{
+			Type: cfg.GTFS.PositionSource,
+			URL:  cfg.GTFS.VehiclePositionsUrl,
+			MQTT: monitor.MQTTConf{
+				BrokerURL:             cfg.MQTT.BrokerURL,
+				Topics:                cfg.MQTT.Topics,
+				QoS:                   cfg.MQTT.QoS,
+				ClientId:              cfg.MQTT.ClientId,
+				Username:              cfg.MQTT.Username,
+				Password:              cfg.MQTT.Password,
+				CleanSession:          cfg.MQTT.CleanSession,
+				ConnectTimeoutSeconds: cfg.MQTT.ConnectTimeoutSeconds,
+				MaxPendingMessages:    cfg.MQTT.MaxPendingMessages,
+			},
+		},
+		LoopEverySeconds:               cfg.GTFS.LoadEverySeconds,
+		MaxFetchBackoffSeconds:         cfg.GTFS.MaxFetchBackoffSeconds,
+		MaxFeedStaleSeconds:            cfg.GTFS.MaxFeedStaleSeconds,
+		EarlyTolerance:                 cfg.GTFS.EarlyTolerance,
+		RouteTypeEarlyTolerance:        cfg.GTFS.RouteTypeEarlyTolerance,
+		ExpirePositionSeconds:          cfg.GTFS.ExpirePositionSeconds,
+		RouteTypeExpirePositionSeconds: cfg.GTFS.RouteTypeExpirePositionSeconds,
+		MinimumMovementMeters:          cfg.GTFS.MinimumMovementMeters,
+		DistanceMedianWindow:           cfg.GTFS.DistanceMedianWindow,
+		Interpolation:                  cfg.GTFS.Interpolation,
+		RecordToDatabase:               cfg.RecordToDatabase,
+		PublishOverNats:                cfg.PublishOverNats,
+		TripCacheSize:                  cfg.GTFS.TripCacheSize,
+		QueryTimeoutSeconds:            cfg.DB.QueryTimeoutSeconds,
+		VehicleFilter: monitor.VehicleFilterConf{
+			IncludedRouteIds:          cfg.Filter.IncludedRouteIds,
+			ExcludedRouteIds:          cfg.Filter.ExcludedRouteIds,
+			IncludedVehicleIdPatterns: cfg.Filter.IncludedVehicleIdPatterns,
+			ExcludedVehicleIdPatterns: cfg.Filter.ExcludedVehicleIdPatterns,
+		},
+		Outliers: monitor.OutlierConf{
+			ZScore:     cfg.Outliers.ZScore,
+			MinSamples: cfg.Outliers.MinSamples,
+			Window:     cfg.Outliers.Window,
+		},
+		Ordering: monitor.PositionOrderingConf{
+			ReorderDelaySeconds:   cfg.GTFS.ReorderDelaySeconds,
+			StaleToleranceSeconds: cfg.GTFS.StaleToleranceSeconds,
+		},
+		Assignment: monitor.AssignmentConf{
+			Publish:        cfg.Assignments.Publish,
+			RefreshSeconds: cfg.Assignments.RefreshSeconds,
+		},
+		PositionWorkers:  cfg.GTFS.PositionWorkers,
+		PositionPolls:    positionPolls,
+		PositionDebugger: positionDebugger,
+		Clock:            clock.System{},
+	}, shutdown)
 
 }
 
+// backfill replays the GTFS-RT vehicle positions archived in directory to record ObservedStopTimes, stopping on an
+// interrupt or terminate signal
+func backfill(log *logger.Logger, db *sqlx.DB, directory string, backfillConf monitor.BackfillConf) error {
+	if len(directory) < 1 {
+		return fmt.Errorf("expected archive directory with command backfill")
+	}
+	backfillConf.Archive = directory
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+	results, err := monitor.Backfill(log, db, backfillConf, shutdown)
+	if err != nil {
+		return err
+	}
+	log.Printf("main: backfill replayed %d snapshots with %d vehicle positions from %d files, skipped %d files",
+		results.Snapshots, results.Positions, results.Files, results.Skipped)
+	return nil
+}
+
 func printUsage(confUsage string) {
 	fmt.Println(confUsage)
+	fmt.Println("commands:")
+	fmt.Println("(none): monitor the vehicle positions feed")
+	fmt.Println("backfill <directory>: replay archived GTFS-RT vehicle positions in <directory> against the data " +
+		"sets active at the time, recording observed stop times")
 }
@@ -0,0 +1,220 @@
+package monitor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	gtfsrtproto2 "github.com/OpenTransitTools/transitcast/business/data/gtfsrtproto"
+	"github.com/OpenTransitTools/transitcast/foundation/clock"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
+	"github.com/jmoiron/sqlx"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BackfillConf configures Backfill, the vehicle monitor settings match those of Conf
+type BackfillConf struct {
+	//Archive is a directory of GTFS-RT vehicle positions FeedMessages, one per file and optionally gzipped with a .gz
+	//extension, replayed in path order
+	Archive                        string
+	EarlyTolerance                 float64
+	RouteTypeEarlyTolerance        []string
+	ExpirePositionSeconds          int
+	RouteTypeExpirePositionSeconds []string
+	MinimumMovementMeters          float64
+	DistanceMedianWindow           int
+	Interpolation                  string
+	StaleToleranceSeconds          int
+	TripCacheSize                  int
+	QueryTimeoutSeconds            int
+	PositionWorkers                int
+	VehicleFilter                  VehicleFilterConf
+	Outliers                       OutlierConf
+}
+
+// BackfillResults counts the archive snapshots replayed by Backfill
+type BackfillResults struct {
+	Files     int
+	Snapshots int
+	Positions int
+	//Skipped are the files that could not be read, were not newer than the previous snapshot, or were taken when no
+	//data set was active
+	Skipped int
+}
+
+// archiveSnapshot holds the vehicle positions read from an archived FeedMessage, taken at "at"
+type archiveSnapshot struct {
+	at        time.Time
+	positions []vehiclemonitor.Position
+}
+
+// Backfill replays the vehicle positions archived in conf.Archive against the data sets active when each snapshot was
+// taken, recording the ObservedStopTimes made to the database. Trip deviations, assignment changes and anomalies are
+// not recorded. Partitions of observed_stop_time covering the archive must exist before it is replayed.
+// Stops early, returning the snapshots replayed so far, when shutdownSignal is received
+func Backfill(log *log.Logger, db *sqlx.DB, conf BackfillConf, shutdownSignal chan os.Signal) (*BackfillResults, error) {
+	filter, err := makeVehicleFilter(conf.VehicleFilter)
+	if err != nil {
+		return nil, err
+	}
+	bounds := vehiclemonitor.NewTravelBounds(nil)
+	monitorCollection, err := vehiclemonitor.NewCollection(vehiclemonitor.Options{
+		EarlyTolerance:                 conf.EarlyTolerance,
+		RouteTypeEarlyTolerances:       conf.RouteTypeEarlyTolerance,
+		ExpirePositionSeconds:          conf.ExpirePositionSeconds,
+		RouteTypeExpirePositionSeconds: conf.RouteTypeExpirePositionSeconds,
+		Smoothing: vehiclemonitor.Smoothing{
+			MinimumMovementMeters: conf.MinimumMovementMeters,
+			DistanceMedianWindow:  conf.DistanceMedianWindow,
+		},
+		StaleToleranceSeconds: conf.StaleToleranceSeconds,
+		TravelBounds:          bounds,
+		Interpolation:         conf.Interpolation,
+	})
+	if err != nil {
+		return nil, err
+	}
+	files, err := listArchiveFiles(conf.Archive)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Backfilling from %d files in %s\n", len(files), conf.Archive)
+
+	queryTimeout := time.Duration(conf.QueryTimeoutSeconds) * time.Second
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err = loadTravelBounds(ctx, log, db, bounds, queryTimeout); err != nil {
+		log.Printf("error loading stop pair travel bounds, using early tolerance alone. error:%v\n", err)
+	}
+	relevantTripCache := makeTripCache(conf.TripCacheSize, queryTimeout)
+	resultPublisher := makeVehicleMonitorResultsPublisher(log, db, nil, natsclient.Codec{}, natsclient.Subjects{},
+		true, false, queryTimeout, makeOutlierFilter(conf.Outliers), clock.System{})
+	resultPublisher.observationsOnly = true
+
+	results := &BackfillResults{Files: len(files)}
+	var discards *discardCounter
+	var last time.Time
+	var nextPreload time.Time
+	for _, path := range files {
+		select {
+		case <-shutdownSignal:
+			log.Printf("Stopping backfill on shutdown signal after %s\n", path)
+			return results, nil
+		default:
+		}
+		snapshot, err := readArchiveSnapshot(log, path)
+		if err != nil {
+			log.Printf("skipping %s. error:%v\n", path, err)
+			results.Skipped++
+			continue
+		}
+		if !snapshot.at.After(last) {
+			results.Skipped++
+			continue
+		}
+		if discards == nil {
+			discards = makeDiscardCounter(snapshot.at)
+		}
+		if !last.IsZero() && last.Format("2006-01-02") != snapshot.at.Format("2006-01-02") {
+			log.Printf("Backfilled through %s, %d snapshots with %d positions replayed, %d files skipped\n",
+				last.Format("2006-01-02"), results.Snapshots, results.Positions, results.Skipped)
+		}
+		last = snapshot.at
+
+		// the preloader is run in step with the archive, finding the trips scheduled around each snapshot
+		if !snapshot.at.Before(nextPreload) {
+			err = relevantTripCache.preloadScheduledTrips(ctx, log, db, snapshot.at)
+			if err != nil {
+				log.Printf("unable to load trips scheduled at %s, skipping %s. error:%v\n",
+					snapshot.at.Format(time.RFC3339), path, err)
+				results.Skipped++
+				continue
+			}
+			nextPreload = snapshot.at.Add(relevantTripCache.loadTripsEveryDuration)
+		}
+
+		vehiclePositions, filteredCounts := filter.filter(snapshot.positions)
+		recordFilterMetrics(len(vehiclePositions), filteredCounts)
+		loadedTrips, err := relevantTripCache.loadRelevantTrips(ctx, log, db, snapshot.at, vehiclePositions)
+		if err != nil {
+			log.Printf("error attempting to get required trip for vehicle positions. error:%v\n", err)
+			discards.add(outcomeTripsUnavailable, len(vehiclePositions), snapshot.at)
+			results.Skipped++
+			continue
+		}
+		updateVehiclePositions(ctx, log, resultPublisher, vehiclePositions, loadedTrips, monitorCollection,
+			conf.PositionWorkers, discards, nil)
+		discards.flush(ctx, log, db, queryTimeout, true, snapshot.at, false)
+		results.Snapshots++
+		results.Positions += len(vehiclePositions)
+	}
+	if discards != nil {
+		discards.flush(ctx, log, db, queryTimeout, true, last, true)
+	}
+	return results, nil
+}
+
+// listArchiveFiles returns the paths of the regular files beneath directory in lexical order, which archivers naming
+// files by the time they were retrieved keep in time order
+func listArchiveFiles(directory string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list archive %s: %w", directory, err)
+	}
+	return files, nil
+}
+
+// readArchiveSnapshot reads the FeedMessage in the file at path, decompressing files ending in .gz. The snapshot is
+// taken at the FeedHeader timestamp, or at the latest vehicle timestamp when the header has none, and positions
+// without a timestamp are given that time
+func readArchiveSnapshot(log *log.Logger, path string) (*archiveSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(path, ".gz") {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		data, err = io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+	}
+	feedMessage := gtfsrtproto2.FeedMessage{}
+	if err = proto.Unmarshal(data, &feedMessage); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal FeedMessage: %w", err)
+	}
+	timestamp := feedHeaderTimestamp(&feedMessage)
+	if timestamp == 0 {
+		for _, entity := range feedMessage.Entity {
+			if entity.Vehicle != nil && entity.Vehicle.Timestamp != nil &&
+				int64(*entity.Vehicle.Timestamp) > timestamp {
+				timestamp = int64(*entity.Vehicle.Timestamp)
+			}
+		}
+	}
+	if timestamp == 0 {
+		return nil, fmt.Errorf("FeedMessage has no timestamp")
+	}
+	at := time.Unix(timestamp, 0)
+	return &archiveSnapshot{at: at, positions: feedVehiclePositions(log, &feedMessage, at)}, nil
+}
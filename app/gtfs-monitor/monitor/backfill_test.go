@@ -0,0 +1,130 @@
+package monitor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfsrtproto"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_readArchive(t *testing.T) {
+	testLog := log.New(io.Discard, "", 0)
+	directory := t.TempDir()
+	writeFile := func(name string, data []byte) {
+		path := filepath.Join(directory, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("unable to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("unable to write %s: %v", name, err)
+		}
+	}
+	gzipped := &bytes.Buffer{}
+	writer := gzip.NewWriter(gzipped)
+	_, _ = writer.Write(makeTestFeedMessage(t, 2000, "3"))
+	_ = writer.Close()
+	withoutHeaderTimestamp, err := proto.Marshal(&gtfsrtproto.FeedMessage{
+		Header: &gtfsrtproto.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfsrtproto.FeedEntity{
+			{
+				Id: proto.String("4"),
+				Vehicle: &gtfsrtproto.VehiclePosition{
+					Vehicle:   &gtfsrtproto.VehicleDescriptor{Id: proto.String("4")},
+					Timestamp: proto.Uint64(3000),
+				},
+			},
+			{
+				Id:      proto.String("5"),
+				Vehicle: &gtfsrtproto.VehiclePosition{Vehicle: &gtfsrtproto.VehicleDescriptor{Id: proto.String("5")}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to marshal FeedMessage: %v", err)
+	}
+	writeFile("2022-05-22/vehicle_positions_1000.pb", makeTestFeedMessage(t, 1000, "1", "2"))
+	writeFile("2022-05-22/vehicle_positions_2000.pb.gz", gzipped.Bytes())
+	writeFile("2022-05-23/vehicle_positions_3000.pb", withoutHeaderTimestamp)
+	writeFile("2022-05-23/vehicle_positions_4000.pb", []byte("not a feed"))
+
+	files, err := listArchiveFiles(directory)
+	if err != nil {
+		t.Fatalf("listArchiveFiles() error = %v", err)
+	}
+	wantFiles := []string{
+		filepath.Join(directory, "2022-05-22/vehicle_positions_1000.pb"),
+		filepath.Join(directory, "2022-05-22/vehicle_positions_2000.pb.gz"),
+		filepath.Join(directory, "2022-05-23/vehicle_positions_3000.pb"),
+		filepath.Join(directory, "2022-05-23/vehicle_positions_4000.pb"),
+	}
+	if !reflect.DeepEqual(files, wantFiles) {
+		t.Fatalf("listArchiveFiles() = %v, want %v", files, wantFiles)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		wantAt         time.Time
+		wantIds        []string
+		wantTimestamps []int64
+		wantErr        bool
+	}{
+		{
+			name:           "FeedHeader timestamp",
+			path:           files[0],
+			wantAt:         time.Unix(1000, 0),
+			wantIds:        []string{"1", "2"},
+			wantTimestamps: []int64{1000, 1000},
+		},
+		{
+			name:           "gzipped",
+			path:           files[1],
+			wantAt:         time.Unix(2000, 0),
+			wantIds:        []string{"3"},
+			wantTimestamps: []int64{2000},
+		},
+		{
+			name:           "latest vehicle timestamp without FeedHeader timestamp",
+			path:           files[2],
+			wantAt:         time.Unix(3000, 0),
+			wantIds:        []string{"4", "5"},
+			wantTimestamps: []int64{3000, 3000},
+		},
+		{
+			name:    "not a FeedMessage",
+			path:    files[3],
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readArchiveSnapshot(testLog, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readArchiveSnapshot() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !got.at.Equal(tt.wantAt) {
+				t.Errorf("readArchiveSnapshot() at = %v, want %v", got.at, tt.wantAt)
+			}
+			var ids []string
+			var timestamps []int64
+			for _, position := range got.positions {
+				ids = append(ids, position.Id)
+				timestamps = append(timestamps, position.Timestamp)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIds) || !reflect.DeepEqual(timestamps, tt.wantTimestamps) {
+				t.Errorf("readArchiveSnapshot() positions %v at %v, want %v at %v", ids, timestamps, tt.wantIds,
+					tt.wantTimestamps)
+			}
+		})
+	}
+}
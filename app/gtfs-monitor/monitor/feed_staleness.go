@@ -0,0 +1,67 @@
+package monitor
+
+import (
+	"expvar"
+	"log"
+	"time"
+)
+
+// feedStaleness exports whether the vehicle position feed is stale and the number of snapshots ignored while it was
+var feedStaleness = expvar.NewMap("vehicle_position_feed_staleness")
+
+// feedStalenessDetector watches the FeedHeader timestamp of each vehicle position snapshot. When the timestamp stops
+// advancing for longer than maxStale the feed is considered stale, usually because the upstream AVL system has stopped
+// updating, and snapshots are ignored until it advances again
+type feedStalenessDetector struct {
+	maxStale       time.Duration
+	lastTimestamp  int64
+	lastAdvancedAt time.Time
+	stale          bool
+}
+
+// makeFeedStalenessDetector builds feedStalenessDetector, staleness detection is disabled when maxStaleSeconds is not
+// positive
+func makeFeedStalenessDetector(maxStaleSeconds int) *feedStalenessDetector {
+	feedStaleness.Set("stale", expvar.Func(func() interface{} { return false }))
+	return &feedStalenessDetector{
+		maxStale: time.Duration(maxStaleSeconds) * time.Second,
+	}
+}
+
+// accept records feedTimestamp, the FeedHeader timestamp of a snapshot received at now, and returns false when the
+// snapshot is stale and should not be processed. Feeds without a header timestamp are always accepted
+func (f *feedStalenessDetector) accept(log *log.Logger, feedTimestamp int64, now time.Time) bool {
+	if f.maxStale <= 0 || feedTimestamp == 0 {
+		return true
+	}
+	if feedTimestamp > f.lastTimestamp {
+		if f.stale {
+			log.Printf("Vehicle position feed recovered, header timestamp advanced to %s after %s without change\n",
+				time.Unix(feedTimestamp, 0).Format(time.RFC3339), now.Sub(f.lastAdvancedAt).Round(time.Second))
+			f.setStale(false)
+		}
+		f.lastTimestamp = feedTimestamp
+		f.lastAdvancedAt = now
+		return true
+	}
+	if now.Sub(f.lastAdvancedAt) <= f.maxStale {
+		return true
+	}
+	if !f.stale {
+		log.Printf("ALERT: vehicle position feed is stale, header timestamp %s has not advanced in %s. "+
+			"Stop time observations are suspended until it does\n",
+			time.Unix(f.lastTimestamp, 0).Format(time.RFC3339), now.Sub(f.lastAdvancedAt).Round(time.Second))
+		f.setStale(true)
+	}
+	feedStaleness.Add("ignored_snapshots", 1)
+	return false
+}
+
+// setStale records stale in the detector and feedStaleness
+func (f *feedStalenessDetector) setStale(stale bool) {
+	f.stale = stale
+	feedStaleness.Set("stale", expvar.Func(func() interface{} { return stale }))
+	if stale {
+		feedStaleness.Add("stale_periods", 1)
+	}
+}
@@ -0,0 +1,91 @@
+package monitor
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+func Test_feedStalenessDetector_accept(t *testing.T) {
+	start := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	type snapshot struct {
+		feedTimestamp  int64
+		receivedAfter  time.Duration
+		want           bool
+		wantStaleAfter bool
+	}
+	tests := []struct {
+		name            string
+		maxStaleSeconds int
+		snapshots       []snapshot
+	}{
+		{
+			name:            "advancing feed accepted",
+			maxStaleSeconds: 60,
+			snapshots: []snapshot{
+				{feedTimestamp: 1000, receivedAfter: 0, want: true},
+				{feedTimestamp: 1003, receivedAfter: 3 * time.Second, want: true},
+				{feedTimestamp: 1006, receivedAfter: 6 * time.Second, want: true},
+			},
+		},
+		{
+			name:            "repeated timestamp accepted within max stale",
+			maxStaleSeconds: 60,
+			snapshots: []snapshot{
+				{feedTimestamp: 1000, receivedAfter: 0, want: true},
+				{feedTimestamp: 1000, receivedAfter: 30 * time.Second, want: true},
+				{feedTimestamp: 1000, receivedAfter: 60 * time.Second, want: true},
+			},
+		},
+		{
+			name:            "stale feed ignored until it advances",
+			maxStaleSeconds: 60,
+			snapshots: []snapshot{
+				{feedTimestamp: 1000, receivedAfter: 0, want: true},
+				{feedTimestamp: 1000, receivedAfter: 61 * time.Second, want: false, wantStaleAfter: true},
+				{feedTimestamp: 1000, receivedAfter: 120 * time.Second, want: false, wantStaleAfter: true},
+				{feedTimestamp: 1123, receivedAfter: 123 * time.Second, want: true},
+				{feedTimestamp: 1123, receivedAfter: 126 * time.Second, want: true},
+			},
+		},
+		{
+			name:            "timestamp moving backwards is not an advance",
+			maxStaleSeconds: 60,
+			snapshots: []snapshot{
+				{feedTimestamp: 1000, receivedAfter: 0, want: true},
+				{feedTimestamp: 990, receivedAfter: 90 * time.Second, want: false, wantStaleAfter: true},
+			},
+		},
+		{
+			name:            "missing header timestamp always accepted",
+			maxStaleSeconds: 60,
+			snapshots: []snapshot{
+				{feedTimestamp: 0, receivedAfter: 0, want: true},
+				{feedTimestamp: 0, receivedAfter: 300 * time.Second, want: true},
+			},
+		},
+		{
+			name:            "disabled",
+			maxStaleSeconds: 0,
+			snapshots: []snapshot{
+				{feedTimestamp: 1000, receivedAfter: 0, want: true},
+				{feedTimestamp: 1000, receivedAfter: 300 * time.Second, want: true},
+			},
+		},
+	}
+	testLog := log.New(io.Discard, "", 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := makeFeedStalenessDetector(tt.maxStaleSeconds)
+			for i, s := range tt.snapshots {
+				if got := f.accept(testLog, s.feedTimestamp, start.Add(s.receivedAfter)); got != s.want {
+					t.Errorf("accept() snapshot %d = %v, want %v", i, got, s.want)
+				}
+				if f.stale != s.wantStaleAfter {
+					t.Errorf("after snapshot %d stale = %v, want %v", i, f.stale, s.wantStaleAfter)
+				}
+			}
+		})
+	}
+}
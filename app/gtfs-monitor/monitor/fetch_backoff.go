@@ -0,0 +1,111 @@
+package monitor
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// positionFetchErrors counts failed vehicle position retrievals, keyed by the response status or failure type
+var positionFetchErrors = expvar.NewMap("vehicle_position_fetch_errors")
+
+// fetchStatusError is returned when the vehicle position feed responds with a status other than 200 OK
+type fetchStatusError struct {
+	StatusCode int
+	//RetryAfter is the delay requested by the feed's Retry-After header, zero when absent
+	RetryAfter time.Duration
+}
+
+func (f *fetchStatusError) Error() string {
+	if f.RetryAfter > 0 {
+		return fmt.Sprintf("vehicle position feed returned status %d, retry after %s", f.StatusCode, f.RetryAfter)
+	}
+	return fmt.Sprintf("vehicle position feed returned status %d", f.StatusCode)
+}
+
+// makeFetchStatusError builds fetchStatusError from resp received at now
+func makeFetchStatusError(resp *http.Response, now time.Time) *fetchStatusError {
+	return &fetchStatusError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), now),
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given either as seconds or an http date, returning zero when the
+// header is missing or can't be read
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// fetchBackoff delays retrieval of vehicle positions after failures, doubling the delay with each consecutive failure
+// up to maxDelay and never retrying sooner than the feed requests with Retry-After
+type fetchBackoff struct {
+	interval time.Duration
+	maxDelay time.Duration
+	failures int
+}
+
+// makeFetchBackoff builds fetchBackoff for a feed polled every interval
+func makeFetchBackoff(interval time.Duration, maxDelay time.Duration) *fetchBackoff {
+	return &fetchBackoff{
+		interval: interval,
+		maxDelay: maxDelay,
+	}
+}
+
+// succeeded resets the backoff after vehicle positions are retrieved
+func (f *fetchBackoff) succeeded() {
+	f.failures = 0
+}
+
+// failed records err and returns the delay before vehicle positions should be retrieved again
+func (f *fetchBackoff) failed(err error) time.Duration {
+	f.failures++
+	recordFetchError(err)
+	delay := f.delay()
+	// jitter avoids every monitor retrying a recovering feed at the same moment
+	delay += time.Duration(rand.Int63n(int64(delay)/10 + 1))
+	var statusError *fetchStatusError
+	if errors.As(err, &statusError) && statusError.RetryAfter > delay {
+		return statusError.RetryAfter
+	}
+	return delay
+}
+
+// delay returns interval doubled for each consecutive failure, limited to maxDelay
+func (f *fetchBackoff) delay() time.Duration {
+	delay := f.interval
+	for i := 1; i < f.failures && delay < f.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > f.maxDelay {
+		return f.maxDelay
+	}
+	return delay
+}
+
+// recordFetchError counts err in positionFetchErrors
+func recordFetchError(err error) {
+	var statusError *fetchStatusError
+	if errors.As(err, &statusError) {
+		positionFetchErrors.Add(strconv.Itoa(statusError.StatusCode), 1)
+		return
+	}
+	positionFetchErrors.Add("request", 1)
+}
@@ -0,0 +1,83 @@
+package monitor
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{name: "missing", header: "", want: 0},
+		{name: "seconds", header: "120", want: 2 * time.Minute},
+		{name: "http date", header: "Sun, 22 May 2022 12:00:30 GMT", want: 30 * time.Second},
+		{name: "http date in the past", header: "Sun, 22 May 2022 11:59:00 GMT", want: 0},
+		{name: "unreadable", header: "soon", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.header, now); got != tt.want {
+				t.Errorf("parseRetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_fetchBackoff_failed(t *testing.T) {
+	interval := 3 * time.Second
+	maxDelay := 20 * time.Second
+	tests := []struct {
+		name         string
+		errs         []error
+		wantAtLeast  time.Duration
+		wantLessThan time.Duration
+	}{
+		{
+			name:         "first failure waits the polling interval",
+			errs:         []error{errors.New("connection refused")},
+			wantAtLeast:  3 * time.Second,
+			wantLessThan: 3300 * time.Millisecond,
+		},
+		{
+			name: "doubles with consecutive failures",
+			errs: []error{&fetchStatusError{StatusCode: 503}, &fetchStatusError{StatusCode: 503},
+				&fetchStatusError{StatusCode: 503}},
+			wantAtLeast:  12 * time.Second,
+			wantLessThan: 13200 * time.Millisecond,
+		},
+		{
+			name: "limited to max delay",
+			errs: []error{&fetchStatusError{StatusCode: 500}, &fetchStatusError{StatusCode: 500},
+				&fetchStatusError{StatusCode: 500}, &fetchStatusError{StatusCode: 500}, &fetchStatusError{StatusCode: 500}},
+			wantAtLeast:  20 * time.Second,
+			wantLessThan: 22 * time.Second,
+		},
+		{
+			name:         "respects retry after",
+			errs:         []error{&fetchStatusError{StatusCode: 429, RetryAfter: time.Minute}},
+			wantAtLeast:  time.Minute,
+			wantLessThan: time.Minute + time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backoff := makeFetchBackoff(interval, maxDelay)
+			var got time.Duration
+			for _, err := range tt.errs {
+				got = backoff.failed(err)
+			}
+			if got < tt.wantAtLeast || got >= tt.wantLessThan {
+				t.Errorf("failed() = %v, want between %v and %v", got, tt.wantAtLeast, tt.wantLessThan)
+			}
+			backoff.succeeded()
+			if got = backoff.failed(errors.New("timeout")); got >= interval+interval/10+time.Nanosecond {
+				t.Errorf("failed() after succeeded() = %v, want reset to interval", got)
+			}
+		})
+	}
+}
@@ -2,36 +2,142 @@
 package monitor
 
 import (
+	"context"
 	"fmt"
 	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/foundation/clock"
+	"github.com/OpenTransitTools/transitcast/foundation/health"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
 	"github.com/jmoiron/sqlx"
 	"github.com/nats-io/nats.go"
+	"hash/fnv"
 	"log"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-//RunVehicleMonitorLoop starts loop that monitors gtfs-rt feed and records results for use in ML processing.
+// Conf configures RunVehicleMonitorLoop
+type Conf struct {
+	//NatsCodec encodes the messages published over NATS
+	NatsCodec natsclient.Codec
+	//NatsSubjects are the tenant's subjects messages are published on
+	NatsSubjects natsclient.Subjects
+	//PositionSource selects where vehicle positions are polled from, or pushed by
+	PositionSource PositionSourceConf
+	//LoopEverySeconds is how often vehicle positions are retrieved and processed
+	LoopEverySeconds int
+	//MaxFetchBackoffSeconds is the longest wait before retrying after failing to retrieve vehicle positions
+	MaxFetchBackoffSeconds int
+	//MaxFeedStaleSeconds is how long the feed's header timestamp can go without advancing before its snapshots are
+	//ignored, zero accepts every snapshot
+	MaxFeedStaleSeconds int
+	//EarlyTolerance is the least portion of its scheduled time a vehicle can be observed to take travelling between
+	//stops before the movement is discarded as unlikely
+	EarlyTolerance float64
+	//RouteTypeEarlyTolerance overrides EarlyTolerance for trips by route_type, as route_type:tolerance
+	RouteTypeEarlyTolerance []string
+	//ExpirePositionSeconds is how old a vehicle's previous position can be and still be used with a new position
+	ExpirePositionSeconds int
+	//RouteTypeExpirePositionSeconds overrides ExpirePositionSeconds by route_type, as route_type:seconds
+	RouteTypeExpirePositionSeconds []string
+	//MinimumMovementMeters is how far a vehicle must move from its last position before a new position on the same
+	//trip and stop is used, zero disables the check
+	MinimumMovementMeters float64
+	//DistanceMedianWindow is the number of recent distances along the trip a vehicle's distance is the median of, one
+	//or less disables the median filter
+	DistanceMedianWindow int
+	//Interpolation is how travel between positions is split over the stop pairs passed, "schedule" or "distance"
+	Interpolation string
+	//RecordToDatabase records results, and the discarded position counts every minute, to the database
+	RecordToDatabase bool
+	//PublishOverNats publishes results over NATS
+	PublishOverNats bool
+	//TripCacheSize is the number of trips held in memory, and of shapes shared between them
+	TripCacheSize int
+	//QueryTimeoutSeconds is the deadline for each database query
+	QueryTimeoutSeconds int
+	//VehicleFilter selects the vehicle positions processed
+	VehicleFilter VehicleFilterConf
+	//Outliers configures the quarantining of ObservedStopTimes with unusual travel times
+	Outliers OutlierConf
+	//Ordering buffers positions received out of timestamp order and drops those that are stale
+	Ordering PositionOrderingConf
+	//Assignment configures the vehicle assignments published on the vehicle-assignments subject
+	Assignment AssignmentConf
+	//PositionWorkers is the number of goroutines processing vehicle positions
+	PositionWorkers int
+	//PositionPolls is beat after each successful retrieval of vehicle positions
+	PositionPolls *health.Heartbeat
+	//PositionDebugger when not nil is given each snapshot and what became of its positions
+	PositionDebugger *PositionDebugger
+	//Clock gives the time positions are processed at, and the time of positions without a timestamp
+	Clock clock.Clock
+}
+
+//RunVehicleMonitorLoop starts loop that monitors gtfs-rt feed and records results for use in ML processing,
+//as configured by conf, until shutdownSignal is received. Results are published over natsConnection
 func RunVehicleMonitorLoop(log *log.Logger,
 	db *sqlx.DB,
 	natsConnection *nats.Conn,
-	url string,
-	loopEverySeconds int,
-	earlyTolerance float64,
-	expirePositionSeconds int,
-	recordToDatabase bool,
-	publishOverNats bool,
+	conf Conf,
 	shutdownSignal chan os.Signal) error {
 
-	loopDuration := time.Duration(loopEverySeconds) * time.Second
+	filter, err := makeVehicleFilter(conf.VehicleFilter)
+	if err != nil {
+		return err
+	}
+	bounds := vehiclemonitor.NewTravelBounds(nil)
+	monitorCollection, err := vehiclemonitor.NewCollection(vehiclemonitor.Options{
+		EarlyTolerance:                 conf.EarlyTolerance,
+		RouteTypeEarlyTolerances:       conf.RouteTypeEarlyTolerance,
+		ExpirePositionSeconds:          conf.ExpirePositionSeconds,
+		RouteTypeExpirePositionSeconds: conf.RouteTypeExpirePositionSeconds,
+		Smoothing: vehiclemonitor.Smoothing{
+			MinimumMovementMeters: conf.MinimumMovementMeters,
+			DistanceMedianWindow:  conf.DistanceMedianWindow,
+		},
+		StaleToleranceSeconds: conf.Ordering.StaleToleranceSeconds,
+		TravelBounds:          bounds,
+		Interpolation:         conf.Interpolation,
+	})
+	if err != nil {
+		return err
+	}
+	source, err := makePositionSource(log, conf.PositionSource)
+	if err != nil {
+		return err
+	}
+	defer source.close()
+
+	clk := conf.Clock
+	loopDuration := time.Duration(conf.LoopEverySeconds) * time.Second
+	queryTimeout := time.Duration(conf.QueryTimeoutSeconds) * time.Second
+	backoff := makeFetchBackoff(loopDuration, time.Duration(conf.MaxFetchBackoffSeconds)*time.Second)
+	staleness := makeFeedStalenessDetector(conf.MaxFeedStaleSeconds)
+
+	// ctx is cancelled on shutdown to abandon any database queries in progress
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	sleepChan := make(chan bool)
 	sleep := time.Duration(0) //sleep for zero seconds the first time
 
-	relevantTripCache := makeTripCache(time.Now())
-	monitorCollection := newVehicleMonitorCollection(earlyTolerance, expirePositionSeconds)
+	relevantTripCache := makeTripCache(conf.TripCacheSize, queryTimeout)
+
+	wg := sync.WaitGroup{}
+	preloaderShutdown := make(chan bool, 1)
+	go runTripPreloader(ctx, log, &wg, db, relevantTripCache, clk, preloaderShutdown)
+	travelBoundsShutdown := make(chan bool, 1)
+	go runTravelBoundsLoader(ctx, log, &wg, db, bounds, queryTimeout, travelBoundsShutdown)
+	reorderBuffer := makePositionReorderBuffer(conf.Ordering.ReorderDelaySeconds)
 
-	resultPublisher := makeVehicleMonitorResultsPublisher(log, db, natsConnection, recordToDatabase, publishOverNats)
+	resultPublisher := makeVehicleMonitorResultsPublisher(log, db, natsConnection, conf.NatsCodec, conf.NatsSubjects,
+		conf.RecordToDatabase, conf.PublishOverNats, queryTimeout, makeOutlierFilter(conf.Outliers), clk)
+	resultPublisher.assignments = makeAssignmentTracker(conf.Assignment, conf.ExpirePositionSeconds)
+	discards := makeDiscardCounter(clk.Now())
 
 	for {
 
@@ -43,6 +149,11 @@ func RunVehicleMonitorLoop(log *log.Logger,
 		select {
 		case <-shutdownSignal:
 			log.Printf("Exiting on shutdown signal")
+			discards.flush(ctx, log, db, queryTimeout, conf.RecordToDatabase, clk.Now(), true)
+			cancel()
+			preloaderShutdown <- true
+			travelBoundsShutdown <- true
+			wg.Wait()
 			return nil
 		case <-sleepChan:
 			break
@@ -51,28 +162,54 @@ func RunVehicleMonitorLoop(log *log.Logger,
 		//set default sleep for next loop in the event of an error after continue statements
 		sleep = loopDuration
 
-		// mark the time we start working
+		// mark the time we start working, now is the time positions are processed at and may be controlled by clk
 		start := time.Now()
+		now := clk.Now()
 
-		vehiclePositions, err := getVehiclePositions(log, url)
+		vehiclePositions, feedTimestamp, err := source.positions(log, now)
 
 		if err != nil {
-			log.Printf("error retrieving vehicle positions. error:%v\n", err)
+			sleep = backoff.failed(err)
+			log.Printf("error retrieving vehicle positions, retrying in %s. error:%v\n",
+				sleep.Round(time.Millisecond), err)
+			continue
+		}
+		backoff.succeeded()
+		conf.PositionPolls.Beat(time.Now())
+		snapshot := conf.PositionDebugger.begin(now, source.lastReceived(), feedTimestamp, vehiclePositions)
+
+		if !staleness.accept(log, feedTimestamp, now) {
+			discards.add(outcomeFeedStale, len(vehiclePositions), now)
+			snapshot.ignore(outcomeFeedStale, "feed is stale")
 			continue
 		}
 
-		log.Printf("loaded %d vehicle positions\n", len(vehiclePositions))
+		loadedCount := len(vehiclePositions)
+		vehiclePositions, filteredCounts := filter.filter(vehiclePositions)
+		recordFilterMetrics(len(vehiclePositions), filteredCounts)
+		snapshot.filtered(filter)
+
+		log.Printf("loaded %d vehicle positions, %d filtered out\n", loadedCount,
+			loadedCount-len(vehiclePositions))
+
+		vehiclePositions = reorderBuffer.release(vehiclePositions, now)
+		snapshot.released(vehiclePositions)
 
 		//load required trips
-		loadedTrips, err := relevantTripCache.loadRelevantTrips(log, db, start, vehiclePositions)
+		loadedTrips, err := relevantTripCache.loadRelevantTrips(ctx, log, db, now, vehiclePositions)
 
 		if err != nil {
 			log.Printf("error attempting to get required trip for vehicle positions. error:%v\n", err)
+			discards.add(outcomeTripsUnavailable, len(vehiclePositions), now)
+			snapshot.ignore(outcomeTripsUnavailable, fmt.Sprintf("unable to load trips: %v", err))
 			continue
 		}
 
 		//update vehicle positions and retrieve new positions for recording to TripDeviations
-		updateVehiclePositions(log, resultPublisher, vehiclePositions, loadedTrips, &monitorCollection)
+		updateVehiclePositions(ctx, log, resultPublisher, vehiclePositions, loadedTrips, monitorCollection,
+			conf.PositionWorkers, discards, snapshot)
+		resultPublisher.assignments.expire(now)
+		discards.flush(ctx, log, db, queryTimeout, conf.RecordToDatabase, now, false)
 
 		// attempt to run the loop every loopEverySeconds by subtracting the time it took to perform the work
 		workTook := time.Now().Sub(start)
@@ -89,49 +226,128 @@ func RunVehicleMonitorLoop(log *log.Logger,
 	}
 }
 
-//updateVehiclePositions runs vehiclePositions through vehicleMonitors and saves results to database
-//returns map of new tripStopPositions by blockId
-func updateVehiclePositions(log *log.Logger,
+//updateVehiclePositions runs positions through their vehiclemonitor.Monitor and saves results to database.
+//positions are divided between workers by vehicle id, so each vehicle's positions are always processed in order
+//by the same worker. Discarded positions are counted in discards, and the outcome of each position is recorded in
+//snapshot
+func updateVehiclePositions(ctx context.Context,
+	log *log.Logger,
 	resultPublisher *vehicleMonitorResultsPublisher,
-	positions []vehiclePosition,
+	positions []vehiclemonitor.Position,
 	tripCache map[string]*gtfs.TripInstance,
-	monitorCollection *vehicleMonitorCollection) {
-
-	countNewTripStopPositions := 0
-	countNewObservations := 0
-
-	for _, position := range positions {
-		vm := monitorCollection.getOrMakeVehicle(position.Id)
-		var trip *gtfs.TripInstance
-		if position.TripId != nil {
-			trip = tripCache[*position.TripId]
+	monitorCollection *vehiclemonitor.Collection,
+	workers int,
+	discards *discardCounter,
+	snapshot *positionSnapshot) {
+
+	// vehicleMonitors are retrieved before the workers start as vehiclemonitor.Collection is not safe for concurrent use
+	partitions := partitionPositions(positions, workers)
+	vehicleMonitors := make([][]*vehiclemonitor.Monitor, len(partitions))
+	for i, partition := range partitions {
+		for _, position := range partition {
+			vehicleMonitors[i] = append(vehicleMonitors[i], monitorCollection.Vehicle(position.Id))
 		}
+	}
 
-		newPosition, osts := vm.newPosition(log, position, trip)
-
-		if newPosition != nil {
-			countNewTripStopPositions++
-		}
-		countNewObservations += len(osts)
-
-		publishNewPosition(resultPublisher, position.Id, tripCache, newPosition, osts)
-
+	var countNewTripStopPositions int64
+	var countNewObservations int64
+	wg := sync.WaitGroup{}
+	for i := range partitions {
+		wg.Add(1)
+		go func(partition []vehiclemonitor.Position, monitors []*vehiclemonitor.Monitor) {
+			defer wg.Done()
+			for j, position := range partition {
+				result := updateVehiclePosition(ctx, log, resultPublisher, position, tripCache, monitors[j])
+				outcome := positionOutcome(result.Outcome)
+				if outcome.discarded() {
+					discards.add(outcome, 1, time.Unix(position.Timestamp, 0))
+				}
+				snapshot.processed(position, outcome, len(result.ObservedStopTimes))
+				if result.TripStopPosition != nil {
+					atomic.AddInt64(&countNewTripStopPositions, 1)
+				}
+				atomic.AddInt64(&countNewObservations, int64(len(result.ObservedStopTimes)))
+			}
+		}(partitions[i], vehicleMonitors[i])
 	}
+	wg.Wait()
 
 	if countNewObservations > 0 {
 		log.Printf("Made %d new stop time observations", countNewObservations)
 	}
 
 	if countNewTripStopPositions > 0 {
-		log.Printf("Made %d new trip stop positions", countNewObservations)
+		log.Printf("Made %d new trip stop positions", countNewTripStopPositions)
 	}
 
 }
 
-func publishNewPosition(resultPublisher *vehicleMonitorResultsPublisher,
+//updateVehiclePosition runs position through vm and publishes the results, logging the reason position was discarded.
+//returns what vm made of position
+func updateVehiclePosition(ctx context.Context,
+	log *log.Logger,
+	resultPublisher *vehicleMonitorResultsPublisher,
+	position vehiclemonitor.Position,
+	tripCache map[string]*gtfs.TripInstance,
+	vm *vehiclemonitor.Monitor) vehiclemonitor.Result {
+	var trip *gtfs.TripInstance
+	if position.TripId != nil {
+		trip = tripCache[*position.TripId]
+	}
+
+	result := vm.NewPosition(position, trip)
+	if result.AssignmentChange != nil {
+		resultPublisher.publishAssignmentChange(ctx, result.AssignmentChange)
+	}
+	if result.Outcome == vehiclemonitor.OutcomeStale {
+		positionOrdering.Add(string(droppedStale), 1)
+	} else if result.ClampedToLast {
+		positionOrdering.Add(string(clampedToLast), 1)
+	}
+	if outcome := positionOutcome(result.Outcome); outcome.logged() {
+		logDiscard(log, &position, outcome, result.OutcomeDetail)
+	}
+	if result.Anomaly != nil {
+		resultPublisher.publishAssignmentAnomaly(ctx, result.Anomaly)
+	}
+	if result.Deadhead != nil {
+		resultPublisher.publishDeadhead(ctx, result.Deadhead)
+	}
+	if result.TripStopPosition != nil {
+		resultPublisher.publishAssignment(position, trip)
+	}
+
+	publishNewPosition(ctx, resultPublisher, position.Id, tripCache, result.TripStopPosition, result.ObservedStopTimes)
+	return result
+}
+
+//partitionPositions divides positions into at most workers slices by a hash of the vehicle id, keeping the
+//order of positions within each slice
+func partitionPositions(positions []vehiclemonitor.Position, workers int) [][]vehiclemonitor.Position {
+	if workers < 1 {
+		workers = 1
+	}
+	partitions := make([][]vehiclemonitor.Position, workers)
+	for _, position := range positions {
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(position.Id))
+		index := hash.Sum32() % uint32(workers)
+		partitions[index] = append(partitions[index], position)
+	}
+	results := make([][]vehiclemonitor.Position, 0, workers)
+	for _, partition := range partitions {
+		if len(partition) > 0 {
+			results = append(results, partition)
+		}
+	}
+	return results
+}
+
+func publishNewPosition(ctx context.Context,
+	resultPublisher *vehicleMonitorResultsPublisher,
 	vehicleId string,
 	tripCache map[string]*gtfs.TripInstance,
-	tsp *tripStopPosition,
+	tsp *vehiclemonitor.TripStopPosition,
 	osts []*gtfs.ObservedStopTime) {
 	if tsp == nil && len(osts) == 0 {
 		return
@@ -139,9 +355,9 @@ func publishNewPosition(resultPublisher *vehicleMonitorResultsPublisher,
 	vehicleMonitorResults := gtfs.VehicleMonitorResults{
 		VehicleId:         vehicleId,
 		ObservedStopTimes: osts,
-		TripDeviations:    collectBlockDeviations(tripCache, tsp),
+		TripDeviations:    vehiclemonitor.BlockDeviations(tripCache, tsp),
 	}
-	resultPublisher.publish(&vehicleMonitorResults)
+	resultPublisher.publish(ctx, &vehicleMonitorResults)
 }
 
 //fmtDuration returns a string presentation of time.Duration for logging
@@ -0,0 +1,73 @@
+package monitor
+
+import (
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
+	"testing"
+)
+
+func Test_partitionPositions(t *testing.T) {
+	var positions []vehiclemonitor.Position
+	for timestamp := int64(0); timestamp < 3; timestamp++ {
+		for vehicle := 0; vehicle < 20; vehicle++ {
+			positions = append(positions, vehiclemonitor.Position{Id: fmt.Sprintf("%d", 100+vehicle), Timestamp: timestamp})
+		}
+	}
+	tests := []struct {
+		name              string
+		workers           int
+		wantMaxPartitions int
+	}{
+		{
+			name:              "single worker",
+			workers:           1,
+			wantMaxPartitions: 1,
+		},
+		{
+			name:              "invalid worker count treated as one",
+			workers:           0,
+			wantMaxPartitions: 1,
+		},
+		{
+			name:              "several workers",
+			workers:           4,
+			wantMaxPartitions: 4,
+		},
+		{
+			name:              "more workers than vehicles leaves no empty partitions",
+			workers:           100,
+			wantMaxPartitions: 20,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			partitions := partitionPositions(positions, tt.workers)
+			if len(partitions) > tt.wantMaxPartitions {
+				t.Errorf("partitionPositions() returned %d partitions, want at most %d", len(partitions),
+					tt.wantMaxPartitions)
+			}
+			partitionByVehicle := make(map[string]int)
+			lastTimestamp := make(map[string]int64)
+			count := 0
+			for i, partition := range partitions {
+				if len(partition) == 0 {
+					t.Errorf("partitionPositions() returned empty partition %d", i)
+				}
+				for _, position := range partition {
+					count++
+					if previous, present := partitionByVehicle[position.Id]; present && previous != i {
+						t.Errorf("vehicle %s positions in partitions %d and %d", position.Id, previous, i)
+					}
+					partitionByVehicle[position.Id] = i
+					if last, present := lastTimestamp[position.Id]; present && last >= position.Timestamp {
+						t.Errorf("vehicle %s position %d after %d", position.Id, position.Timestamp, last)
+					}
+					lastTimestamp[position.Id] = position.Timestamp
+				}
+			}
+			if count != len(positions) {
+				t.Errorf("partitionPositions() returned %d positions, want %d", count, len(positions))
+			}
+		})
+	}
+}
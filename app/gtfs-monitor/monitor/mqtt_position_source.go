@@ -0,0 +1,166 @@
+package monitor
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"log"
+	"sync"
+	"time"
+)
+
+// mqttMessages counts the MQTT messages received, dropped because too many were waiting to be processed, and those
+// that could not be read as a GTFS-RT FeedMessage
+var mqttMessages = expvar.NewMap("mqtt_vehicle_position_messages")
+
+// MQTTConf configures the MQTT broker subscription used when vehicle positions are pushed by an AVL vendor
+type MQTTConf struct {
+	//BrokerURL is the broker to connect to, for example tcp://broker:1883 or ssl://broker:8883
+	BrokerURL string
+	//Topics are the topic filters subscribed to, each message's payload is a GTFS-RT FeedMessage holding one or
+	//more vehicle positions
+	Topics   []string
+	QoS      int
+	ClientId string
+	Username string
+	Password string
+	//CleanSession discards the subscription when disconnected. When false the broker keeps QoS 1 and 2 messages
+	//published while gtfs-monitor is disconnected and delivers them on reconnect, which requires a ClientId
+	CleanSession          bool
+	ConnectTimeoutSeconds int
+	//MaxPendingMessages limits the messages held between runs of the monitor loop, the oldest are dropped beyond it
+	MaxPendingMessages int
+}
+
+// mqttPositionSource collects the vehicle positions published on an MQTT broker between calls to positions
+type mqttPositionSource struct {
+	client             mqtt.Client
+	mu                 sync.Mutex
+	pending            [][]byte
+	last               [][]byte
+	maxPending         int
+	lastFeedTimestamp  int64
+	disconnectedReason error
+}
+
+// makeMQTTPositionSource connects to the broker in conf, subscribing to its topics each time a connection is made.
+// Connection is retried in the background if the broker can't be reached at start
+func makeMQTTPositionSource(log *log.Logger, conf MQTTConf) (*mqttPositionSource, error) {
+	if conf.BrokerURL == "" {
+		return nil, errors.New("an MQTT broker url is required for mqtt vehicle position source")
+	}
+	if len(conf.Topics) == 0 {
+		return nil, errors.New("at least one MQTT topic is required for mqtt vehicle position source")
+	}
+	if conf.QoS < 0 || conf.QoS > 2 {
+		return nil, fmt.Errorf("MQTT QoS must be 0, 1 or 2, not %d", conf.QoS)
+	}
+	if !conf.CleanSession && conf.ClientId == "" {
+		return nil, errors.New("an MQTT client id is required when the session is not clean")
+	}
+	source := &mqttPositionSource{
+		maxPending:         conf.MaxPendingMessages,
+		disconnectedReason: errors.New("not yet connected to MQTT broker"),
+	}
+	filters := make(map[string]byte, len(conf.Topics))
+	for _, topic := range conf.Topics {
+		filters[topic] = byte(conf.QoS)
+	}
+	connectTimeout := time.Duration(conf.ConnectTimeoutSeconds) * time.Second
+
+	options := mqtt.NewClientOptions().
+		AddBroker(conf.BrokerURL).
+		SetClientID(conf.ClientId).
+		SetUsername(conf.Username).
+		SetPassword(conf.Password).
+		SetCleanSession(conf.CleanSession).
+		SetConnectTimeout(connectTimeout).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(func(client mqtt.Client) {
+			log.Printf("Connected to MQTT broker %s, subscribing to %v with QoS %d\n", conf.BrokerURL,
+				conf.Topics, conf.QoS)
+			token := client.SubscribeMultiple(filters, func(_ mqtt.Client, msg mqtt.Message) {
+				source.receive(msg.Payload())
+			})
+			if !token.WaitTimeout(connectTimeout) {
+				source.setDisconnected(log, fmt.Errorf("timed out subscribing to MQTT topics %v", conf.Topics))
+				return
+			}
+			if token.Error() != nil {
+				source.setDisconnected(log, fmt.Errorf("unable to subscribe to MQTT topics %v: %w", conf.Topics,
+					token.Error()))
+				return
+			}
+			source.setDisconnected(log, nil)
+		}).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			source.setDisconnected(log, fmt.Errorf("lost connection to MQTT broker: %w", err))
+		})
+	source.client = mqtt.NewClient(options)
+	// with connect retry the token only completes once connected, so there is nothing to wait on here
+	source.client.Connect()
+	return source, nil
+}
+
+// receive holds payload until the next call to positions
+func (m *mqttPositionSource) receive(payload []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mqttMessages.Add("received", 1)
+	m.pending = append(m.pending, payload)
+	if m.maxPending > 0 && len(m.pending) > m.maxPending {
+		dropped := len(m.pending) - m.maxPending
+		m.pending = m.pending[dropped:]
+		mqttMessages.Add("dropped", int64(dropped))
+	}
+}
+
+// setDisconnected records why the subscription isn't active, nil once it is
+func (m *mqttPositionSource) setDisconnected(log *log.Logger, reason error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if reason != nil {
+		log.Printf("MQTT vehicle position source unavailable: %v\n", reason)
+	}
+	m.disconnectedReason = reason
+}
+
+// positions returns the vehicle positions in messages received since the last call, in the order received.
+// Returns an error when no messages were received while the subscription is not active
+func (m *mqttPositionSource) positions(log *log.Logger, now time.Time) ([]vehiclemonitor.Position, int64, error) {
+	m.mu.Lock()
+	payloads := m.pending
+	m.pending = nil
+	disconnectedReason := m.disconnectedReason
+	m.mu.Unlock()
+
+	if len(payloads) == 0 && disconnectedReason != nil {
+		return nil, 0, disconnectedReason
+	}
+	m.last = payloads
+	var results []vehiclemonitor.Position
+	for _, payload := range payloads {
+		positions, feedTimestamp, err := parseVehiclePositions(log, payload, now)
+		if err != nil {
+			mqttMessages.Add("invalid", 1)
+			continue
+		}
+		if feedTimestamp > m.lastFeedTimestamp {
+			m.lastFeedTimestamp = feedTimestamp
+		}
+		results = append(results, positions...)
+	}
+	return results, m.lastFeedTimestamp, nil
+}
+
+func (m *mqttPositionSource) lastReceived() [][]byte {
+	return m.last
+}
+
+// close disconnects from the broker, allowing a moment for messages being processed to be acknowledged
+func (m *mqttPositionSource) close() {
+	m.client.Disconnect(250)
+}
@@ -0,0 +1,185 @@
+package monitor
+
+import (
+	"errors"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfsrtproto"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+// makeTestFeedMessage returns a marshaled FeedMessage with feedTimestamp holding positions for vehicleIds
+func makeTestFeedMessage(t *testing.T, feedTimestamp uint64, vehicleIds ...string) []byte {
+	feed := gtfsrtproto.FeedMessage{
+		Header: &gtfsrtproto.FeedHeader{
+			GtfsRealtimeVersion: proto.String("2.0"),
+			Timestamp:           proto.Uint64(feedTimestamp),
+		},
+	}
+	for _, vehicleId := range vehicleIds {
+		feed.Entity = append(feed.Entity, &gtfsrtproto.FeedEntity{
+			Id: proto.String(vehicleId),
+			Vehicle: &gtfsrtproto.VehiclePosition{
+				Vehicle: &gtfsrtproto.VehicleDescriptor{
+					Id: proto.String(vehicleId),
+				},
+				Timestamp: proto.Uint64(feedTimestamp),
+			},
+		})
+	}
+	data, err := proto.Marshal(&feed)
+	if err != nil {
+		t.Fatalf("unable to marshal FeedMessage: %v", err)
+	}
+	return data
+}
+
+func Test_mqttPositionSource_positions(t *testing.T) {
+	now := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	testLog := log.New(io.Discard, "", 0)
+	notConnected := errors.New("not connected")
+	tests := []struct {
+		name               string
+		maxPending         int
+		disconnectedReason error
+		payloads           [][]byte
+		wantIds            []string
+		wantFeedTimestamp  int64
+		wantErr            bool
+	}{
+		{
+			name: "positions from all messages in order received",
+			payloads: [][]byte{
+				makeTestFeedMessage(t, 1000, "1", "2"),
+				makeTestFeedMessage(t, 1003, "3"),
+			},
+			wantIds:           []string{"1", "2", "3"},
+			wantFeedTimestamp: 1003,
+		},
+		{
+			name: "unreadable messages skipped",
+			payloads: [][]byte{
+				makeTestFeedMessage(t, 1000, "1"),
+				[]byte("not a feed message"),
+			},
+			wantIds:           []string{"1"},
+			wantFeedTimestamp: 1000,
+		},
+		{
+			name:       "oldest messages dropped beyond max pending",
+			maxPending: 2,
+			payloads: [][]byte{
+				makeTestFeedMessage(t, 1000, "1"),
+				makeTestFeedMessage(t, 1001, "2"),
+				makeTestFeedMessage(t, 1002, "3"),
+			},
+			wantIds:           []string{"2", "3"},
+			wantFeedTimestamp: 1002,
+		},
+		{
+			name:               "messages received before disconnection returned",
+			disconnectedReason: notConnected,
+			payloads: [][]byte{
+				makeTestFeedMessage(t, 1000, "1"),
+			},
+			wantIds:           []string{"1"},
+			wantFeedTimestamp: 1000,
+		},
+		{
+			name:               "error while disconnected without messages",
+			disconnectedReason: notConnected,
+			wantErr:            true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &mqttPositionSource{
+				maxPending:         tt.maxPending,
+				disconnectedReason: tt.disconnectedReason,
+			}
+			for _, payload := range tt.payloads {
+				source.receive(payload)
+			}
+			positions, feedTimestamp, err := source.positions(testLog, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("positions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if feedTimestamp != tt.wantFeedTimestamp {
+				t.Errorf("positions() feedTimestamp = %d, want %d", feedTimestamp, tt.wantFeedTimestamp)
+			}
+			var gotIds []string
+			for _, position := range positions {
+				gotIds = append(gotIds, position.Id)
+			}
+			if len(gotIds) != len(tt.wantIds) {
+				t.Fatalf("positions() ids = %v, want %v", gotIds, tt.wantIds)
+			}
+			for i := range gotIds {
+				if gotIds[i] != tt.wantIds[i] {
+					t.Errorf("positions() ids = %v, want %v", gotIds, tt.wantIds)
+					break
+				}
+			}
+			// messages are only returned once, the last feed timestamp is kept for staleness detection
+			positions, feedTimestamp, err = source.positions(testLog, now)
+			if err == nil && (len(positions) != 0 || feedTimestamp != tt.wantFeedTimestamp) {
+				t.Errorf("second positions() = %d positions, feedTimestamp %d, want none and %d", len(positions),
+					feedTimestamp, tt.wantFeedTimestamp)
+			}
+		})
+	}
+}
+
+func Test_makePositionSource(t *testing.T) {
+	testLog := log.New(io.Discard, "", 0)
+	tests := []struct {
+		name    string
+		conf    PositionSourceConf
+		wantErr bool
+	}{
+		{
+			name: "http",
+			conf: PositionSourceConf{Type: "http", URL: "http://localhost/vehicles"},
+		},
+		{
+			name:    "unknown type",
+			conf:    PositionSourceConf{Type: "kafka"},
+			wantErr: true,
+		},
+		{
+			name:    "mqtt without broker",
+			conf:    PositionSourceConf{Type: "mqtt", MQTT: MQTTConf{Topics: []string{"vehicles/#"}}},
+			wantErr: true,
+		},
+		{
+			name:    "mqtt without topics",
+			conf:    PositionSourceConf{Type: "mqtt", MQTT: MQTTConf{BrokerURL: "tcp://localhost:1883"}},
+			wantErr: true,
+		},
+		{
+			name: "mqtt invalid qos",
+			conf: PositionSourceConf{Type: "mqtt", MQTT: MQTTConf{BrokerURL: "tcp://localhost:1883",
+				Topics: []string{"vehicles/#"}, QoS: 3, CleanSession: true}},
+			wantErr: true,
+		},
+		{
+			name: "mqtt persistent session without client id",
+			conf: PositionSourceConf{Type: "mqtt", MQTT: MQTTConf{BrokerURL: "tcp://localhost:1883",
+				Topics: []string{"vehicles/#"}, QoS: 1}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := makePositionSource(testLog, tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("makePositionSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if source != nil {
+				source.close()
+			}
+		})
+	}
+}
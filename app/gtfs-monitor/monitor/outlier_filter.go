@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"expvar"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"math"
+	"sync"
+)
+
+// quarantinedStopTimes counts ObservedStopTimes rejected as outliers
+var quarantinedStopTimes = expvar.NewInt("quarantined_stop_time_observations")
+
+// minimumTravelStdDevSeconds keeps stop pairs with very consistent travel times from rejecting observations that are
+// only a few seconds from the mean
+const minimumTravelStdDevSeconds = 5.0
+
+// OutlierConf contains parameters for rejecting ObservedStopTimes with unusual travel times
+type OutlierConf struct {
+	//ZScore is the number of standard deviations from the mean travel time between a pair of stops beyond which an
+	//observation is quarantined, outlier rejection is disabled when not positive
+	ZScore float64
+	//MinSamples is the number of observations between a pair of stops required before any are rejected
+	MinSamples int
+	//Window is the approximate number of recent observations between a pair of stops the mean and variance follow
+	Window int
+}
+
+// travelTimeStats is an exponentially weighted mean and variance of travel seconds between a pair of stops,
+// weighting all observations equally until window observations have been seen
+type travelTimeStats struct {
+	count    int
+	mean     float64
+	variance float64
+}
+
+// add includes travelSeconds in the statistics
+func (s *travelTimeStats) add(travelSeconds float64, window int) {
+	s.count++
+	weight := 1.0 / float64(s.count)
+	if s.count > window {
+		weight = 1.0 / float64(window)
+	}
+	delta := travelSeconds - s.mean
+	s.mean += weight * delta
+	s.variance = (1 - weight) * (s.variance + weight*delta*delta)
+}
+
+// stdDev returns the standard deviation, no less than minimumTravelStdDevSeconds
+func (s *travelTimeStats) stdDev() float64 {
+	return math.Max(math.Sqrt(s.variance), minimumTravelStdDevSeconds)
+}
+
+// stopPair identifies the stops an ObservedStopTime moved between
+type stopPair struct {
+	stopId     string
+	nextStopId string
+}
+
+// outlierFilter maintains travelTimeStats for each pair of stops and separates ObservedStopTimes whose travel time
+// is more than conf.ZScore standard deviations from the mean. Safe for concurrent use
+type outlierFilter struct {
+	mu    sync.Mutex
+	conf  OutlierConf
+	stats map[stopPair]*travelTimeStats
+}
+
+// makeOutlierFilter builds outlierFilter following conf
+func makeOutlierFilter(conf OutlierConf) *outlierFilter {
+	if conf.Window < 1 {
+		conf.Window = 1
+	}
+	return &outlierFilter{
+		mu:    sync.Mutex{},
+		conf:  conf,
+		stats: make(map[stopPair]*travelTimeStats),
+	}
+}
+
+// filter returns the observations that are not outliers and the outliers as QuarantinedObservedStopTimes
+func (o *outlierFilter) filter(observations []*gtfs.ObservedStopTime) ([]*gtfs.ObservedStopTime,
+	[]*gtfs.QuarantinedObservedStopTime) {
+	if o.conf.ZScore <= 0 || len(observations) == 0 {
+		return observations, nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	accepted := make([]*gtfs.ObservedStopTime, 0, len(observations))
+	var quarantined []*gtfs.QuarantinedObservedStopTime
+	for _, observation := range observations {
+		outlier := o.check(observation)
+		if outlier == nil {
+			accepted = append(accepted, observation)
+		} else {
+			quarantined = append(quarantined, outlier)
+		}
+	}
+	quarantinedStopTimes.Add(int64(len(quarantined)))
+	return accepted, quarantined
+}
+
+// check updates the statistics for observation's stops and returns observation as a QuarantinedObservedStopTime if
+// it's an outlier, otherwise nil
+func (o *outlierFilter) check(observation *gtfs.ObservedStopTime) *gtfs.QuarantinedObservedStopTime {
+	key := stopPair{stopId: observation.StopId, nextStopId: observation.NextStopId}
+	stats, present := o.stats[key]
+	if !present {
+		stats = &travelTimeStats{}
+		o.stats[key] = stats
+	}
+	travelSeconds := float64(observation.TravelSeconds)
+	if stats.count < o.conf.MinSamples {
+		stats.add(travelSeconds, o.conf.Window)
+		return nil
+	}
+	mean := stats.mean
+	stdDev := stats.stdDev()
+	zScore := (travelSeconds - mean) / stdDev
+	if math.Abs(zScore) <= o.conf.ZScore {
+		stats.add(travelSeconds, o.conf.Window)
+		return nil
+	}
+	// outliers are limited to the rejection threshold before being added so the statistics can still follow a
+	// lasting change in travel times, such as a detour, without a single bad observation distorting them
+	stats.add(mean+math.Copysign(o.conf.ZScore*stdDev, zScore), o.conf.Window)
+	return &gtfs.QuarantinedObservedStopTime{
+		ObservedStopTime:    *observation,
+		ZScore:              zScore,
+		MeanTravelSeconds:   mean,
+		StdDevTravelSeconds: stdDev,
+	}
+}
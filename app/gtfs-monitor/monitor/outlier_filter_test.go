@@ -0,0 +1,100 @@
+package monitor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"math"
+	"testing"
+)
+
+func Test_travelTimeStats_add(t *testing.T) {
+	stats := travelTimeStats{}
+	for _, travelSeconds := range []float64{50, 60, 70} {
+		stats.add(travelSeconds, 100)
+	}
+	if stats.mean != 60 {
+		t.Errorf("mean = %v, want 60", stats.mean)
+	}
+	wantVariance := 200.0 / 3
+	if math.Abs(stats.variance-wantVariance) > 0.0001 {
+		t.Errorf("variance = %v, want %v", stats.variance, wantVariance)
+	}
+}
+
+func Test_outlierFilter_filter(t *testing.T) {
+	observation := func(stopId string, travelSeconds int) *gtfs.ObservedStopTime {
+		return &gtfs.ObservedStopTime{StopId: stopId, NextStopId: stopId + "-next", TravelSeconds: travelSeconds}
+	}
+	history := func(stopId string) []*gtfs.ObservedStopTime {
+		var observations []*gtfs.ObservedStopTime
+		for i := 0; i < 20; i++ {
+			observations = append(observations, observation(stopId, 80+(i%5)*10))
+		}
+		return observations
+	}
+	tests := []struct {
+		name            string
+		conf            OutlierConf
+		history         []*gtfs.ObservedStopTime
+		observations    []*gtfs.ObservedStopTime
+		wantAccepted    []int
+		wantQuarantined []int
+	}{
+		{
+			name:            "outliers quarantined in both directions",
+			conf:            OutlierConf{ZScore: 3, MinSamples: 10, Window: 100},
+			history:         history("A"),
+			observations:    []*gtfs.ObservedStopTime{observation("A", 95), observation("A", 400), observation("A", 1)},
+			wantAccepted:    []int{95},
+			wantQuarantined: []int{400, 1},
+		},
+		{
+			name:         "other stop pairs have their own statistics",
+			conf:         OutlierConf{ZScore: 3, MinSamples: 10, Window: 100},
+			history:      history("A"),
+			observations: []*gtfs.ObservedStopTime{observation("B", 400)},
+			wantAccepted: []int{400},
+		},
+		{
+			name:         "nothing rejected before min samples",
+			conf:         OutlierConf{ZScore: 3, MinSamples: 30, Window: 100},
+			history:      history("A"),
+			observations: []*gtfs.ObservedStopTime{observation("A", 400)},
+			wantAccepted: []int{400},
+		},
+		{
+			name:         "disabled",
+			conf:         OutlierConf{ZScore: 0, MinSamples: 10, Window: 100},
+			history:      history("A"),
+			observations: []*gtfs.ObservedStopTime{observation("A", 400)},
+			wantAccepted: []int{400},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := makeOutlierFilter(tt.conf)
+			o.filter(tt.history)
+			accepted, quarantined := o.filter(tt.observations)
+			if len(accepted) != len(tt.wantAccepted) {
+				t.Fatalf("filter() accepted %d observations, want %d", len(accepted), len(tt.wantAccepted))
+			}
+			for i, observation := range accepted {
+				if observation.TravelSeconds != tt.wantAccepted[i] {
+					t.Errorf("accepted[%d] travel seconds = %d, want %d", i, observation.TravelSeconds,
+						tt.wantAccepted[i])
+				}
+			}
+			if len(quarantined) != len(tt.wantQuarantined) {
+				t.Fatalf("filter() quarantined %d observations, want %d", len(quarantined), len(tt.wantQuarantined))
+			}
+			for i, outlier := range quarantined {
+				if outlier.TravelSeconds != tt.wantQuarantined[i] {
+					t.Errorf("quarantined[%d] travel seconds = %d, want %d", i, outlier.TravelSeconds,
+						tt.wantQuarantined[i])
+				}
+				if math.Abs(outlier.ZScore) <= tt.conf.ZScore {
+					t.Errorf("quarantined[%d] z score %v within limit %v", i, outlier.ZScore, tt.conf.ZScore)
+				}
+			}
+		})
+	}
+}
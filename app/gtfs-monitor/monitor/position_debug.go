@@ -0,0 +1,254 @@
+package monitor
+
+import (
+	"encoding/json"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfsrtproto"
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// positionOutcome describes what became of a vehiclemonitor.Position in the most recent snapshot. Positions
+// processed by a vehiclemonitor.Monitor have its vehiclemonitor.Outcome, those removed by vehicleFilter have their
+// filterReason as their outcome
+type positionOutcome string
+
+const (
+	// outcomeNotProcessed positions have not yet been given to a vehiclemonitor.Monitor
+	outcomeNotProcessed positionOutcome = "not_processed"
+	// outcomeFeedStale positions were in a snapshot ignored because the feed's header timestamp stopped advancing
+	outcomeFeedStale positionOutcome = "feed_stale"
+	// outcomeTripsUnavailable positions were in a snapshot ignored because their trips couldn't be loaded
+	outcomeTripsUnavailable positionOutcome = "trips_unavailable"
+	// outcomeHeld positions are held by positionReorderBuffer and will be processed with a later snapshot
+	outcomeHeld positionOutcome = "held_for_reordering"
+	// outcomeUnchanged and the outcomes following are made by vehiclemonitor.Monitor
+	outcomeUnchanged             = positionOutcome(vehiclemonitor.OutcomeUnchanged)
+	outcomeStale                 = positionOutcome(vehiclemonitor.OutcomeStale)
+	outcomeNotOnTrip             = positionOutcome(vehiclemonitor.OutcomeNotOnTrip)
+	outcomeTripNotFound          = positionOutcome(vehiclemonitor.OutcomeTripNotFound)
+	outcomeStopNotFound          = positionOutcome(vehiclemonitor.OutcomeStopNotFound)
+	outcomeDeadhead              = positionOutcome(vehiclemonitor.OutcomeDeadhead)
+	outcomeWrongDirection        = positionOutcome(vehiclemonitor.OutcomeWrongDirection)
+	outcomeNoStopPassed          = positionOutcome(vehiclemonitor.OutcomeNoStopPassed)
+	outcomeMovementNotBelievable = positionOutcome(vehiclemonitor.OutcomeMovementNotBelievable)
+	outcomeObserved              = positionOutcome(vehiclemonitor.OutcomeObserved)
+)
+
+// positionKey identifies a vehiclemonitor.Position within a snapshot
+type positionKey struct {
+	vehicleId string
+	timestamp int64
+}
+
+// positionSnapshotEntry is a vehiclemonitor.Position from a snapshot and what became of it
+type positionSnapshotEntry struct {
+	Position          vehiclemonitor.Position `json:"position"`
+	Outcome           positionOutcome         `json:"outcome"`
+	ObservedStopTimes int                     `json:"observed_stop_times,omitempty"`
+}
+
+// positionSnapshot records what became of each vehiclemonitor.Position retrieved on one run of
+// RunVehicleMonitorLoop. All methods may be called on a nil positionSnapshot, doing nothing, so the loop need not
+// check whether debugging is enabled
+type positionSnapshot struct {
+	mu            sync.Mutex
+	receivedAt    time.Time
+	feedTimestamp int64
+	feeds         [][]byte
+	ignored       string
+	entries       []*positionSnapshotEntry
+	index         map[positionKey]*positionSnapshotEntry
+}
+
+// ignore records reason the whole snapshot was not processed, giving outcome to its positions not yet processed
+func (s *positionSnapshot) ignore(outcome positionOutcome, reason string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ignored = reason
+	for _, entry := range s.entries {
+		if entry.Outcome == outcomeNotProcessed {
+			entry.Outcome = outcome
+		}
+	}
+}
+
+// filtered records the reason each position removed by filter was removed
+func (s *positionSnapshot) filtered(filter *vehicleFilter) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.entries {
+		if reason := filter.reasonFiltered(&entry.Position); reason != notFiltered {
+			entry.Outcome = positionOutcome(reason)
+		}
+	}
+}
+
+// released records the positions released by positionReorderBuffer. The snapshot's positions that were not released
+// are held, positions released from earlier snapshots are added
+func (s *positionSnapshot) released(positions []vehiclemonitor.Position) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	releasedKeys := make(map[positionKey]bool, len(positions))
+	for _, position := range positions {
+		key := positionKey{vehicleId: position.Id, timestamp: position.Timestamp}
+		releasedKeys[key] = true
+		if _, present := s.index[key]; !present {
+			s.add(position)
+		}
+	}
+	for key, entry := range s.index {
+		if entry.Outcome == outcomeNotProcessed && !releasedKeys[key] {
+			entry.Outcome = outcomeHeld
+		}
+	}
+}
+
+// processed records the outcome of giving position to its vehicleMonitor and the number of stop time observations made
+func (s *positionSnapshot) processed(position vehiclemonitor.Position, outcome positionOutcome, observedStopTimes int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, present := s.index[positionKey{vehicleId: position.Id, timestamp: position.Timestamp}]
+	if !present {
+		entry = s.add(position)
+	}
+	entry.Outcome = outcome
+	entry.ObservedStopTimes = observedStopTimes
+}
+
+// add appends position to the snapshot as not processed, callers hold mu
+func (s *positionSnapshot) add(position vehiclemonitor.Position) *positionSnapshotEntry {
+	entry := &positionSnapshotEntry{Position: position, Outcome: outcomeNotProcessed}
+	s.entries = append(s.entries, entry)
+	s.index[positionKey{vehicleId: position.Id, timestamp: position.Timestamp}] = entry
+	return entry
+}
+
+// PositionDebugger keeps the most recent vehicle position snapshot, serving it as json with the raw GTFS-RT feed it
+// was read from and what became of each position
+type PositionDebugger struct {
+	mu   sync.Mutex
+	last *positionSnapshot
+}
+
+// NewPositionDebugger builds PositionDebugger, to be given to RunVehicleMonitorLoop and served by an http.ServeMux
+func NewPositionDebugger() *PositionDebugger {
+	return &PositionDebugger{}
+}
+
+// begin starts recording the snapshot of positions read from feeds at receivedAt, returns nil when d is nil
+func (d *PositionDebugger) begin(receivedAt time.Time,
+	feeds [][]byte,
+	feedTimestamp int64,
+	positions []vehiclemonitor.Position) *positionSnapshot {
+	if d == nil {
+		return nil
+	}
+	snapshot := &positionSnapshot{
+		receivedAt:    receivedAt,
+		feedTimestamp: feedTimestamp,
+		feeds:         feeds,
+		index:         make(map[positionKey]*positionSnapshotEntry, len(positions)),
+	}
+	for _, position := range positions {
+		snapshot.add(position)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.last = snapshot
+	return snapshot
+}
+
+// positionSnapshotResponse is the json served by PositionDebugger
+type positionSnapshotResponse struct {
+	ReceivedAt    time.Time `json:"received_at"`
+	FeedTimestamp int64     `json:"feed_timestamp"`
+	//Ignored is the reason the snapshot was not processed, empty when it was
+	Ignored string `json:"ignored,omitempty"`
+	//Counts is the number of positions by outcome
+	Counts    map[positionOutcome]int `json:"counts"`
+	Positions []positionSnapshotEntry `json:"positions"`
+	Feeds     []json.RawMessage       `json:"feeds"`
+}
+
+// ServeHTTP implements PositionDebugger's http.Handler interface. Positions can be limited to a vehicle with the
+// "vehicle" query parameter, and the raw feeds left out with "feeds=false"
+func (d *PositionDebugger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	snapshot := d.last
+	d.mu.Unlock()
+	if snapshot == nil {
+		http.Error(w, "no vehicle positions retrieved yet", http.StatusNotFound)
+		return
+	}
+	includeFeeds := true
+	if feeds := r.URL.Query().Get("feeds"); feeds != "" {
+		includeFeeds, _ = strconv.ParseBool(feeds)
+	}
+	response := snapshot.response(r.URL.Query().Get("vehicle"), includeFeeds)
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(jsonData)
+}
+
+// response builds positionSnapshotResponse with positions for vehicleId, or all positions when empty. Feeds are
+// rendered as json when includeFeeds is true
+func (s *positionSnapshot) response(vehicleId string, includeFeeds bool) *positionSnapshotResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	response := &positionSnapshotResponse{
+		ReceivedAt:    s.receivedAt,
+		FeedTimestamp: s.feedTimestamp,
+		Ignored:       s.ignored,
+		Counts:        make(map[positionOutcome]int),
+		Positions:     make([]positionSnapshotEntry, 0, len(s.entries)),
+		Feeds:         make([]json.RawMessage, 0),
+	}
+	for _, entry := range s.entries {
+		response.Counts[entry.Outcome]++
+		if vehicleId == "" || entry.Position.Id == vehicleId {
+			response.Positions = append(response.Positions, *entry)
+		}
+	}
+	if includeFeeds {
+		for _, feed := range s.feeds {
+			response.Feeds = append(response.Feeds, feedJSON(feed))
+		}
+	}
+	return response
+}
+
+// feedJSON renders feed, a marshaled GTFS-RT FeedMessage, as json. Feeds that can't be read are rendered as the reason
+func feedJSON(feed []byte) json.RawMessage {
+	feedMessage := gtfsrtproto.FeedMessage{}
+	err := proto.Unmarshal(feed, &feedMessage)
+	if err == nil {
+		var jsonData []byte
+		jsonData, err = protojson.Marshal(&feedMessage)
+		if err == nil {
+			return jsonData
+		}
+	}
+	jsonData, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return jsonData
+}
@@ -0,0 +1,110 @@
+package monitor
+
+import (
+	"encoding/json"
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_positionSnapshot_outcomes(t *testing.T) {
+	now := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	filter, err := makeVehicleFilter(VehicleFilterConf{ExcludedRouteIds: []string{"90"}})
+	if err != nil {
+		t.Fatalf("makeVehicleFilter() error = %v", err)
+	}
+	positions := []vehiclemonitor.Position{
+		{Id: "101", RouteId: strPtr("90"), Timestamp: 1000},
+		{Id: "102", RouteId: strPtr("100"), Timestamp: 1000},
+		{Id: "103", RouteId: strPtr("100"), Timestamp: 1000},
+		{Id: "104", RouteId: strPtr("100"), Timestamp: 1000},
+	}
+	earlierPosition := vehiclemonitor.Position{Id: "105", RouteId: strPtr("100"), Timestamp: 990}
+
+	debugger := NewPositionDebugger()
+	snapshot := debugger.begin(now, [][]byte{makeTestFeedMessage(t, 1000, "101")}, 1000, positions)
+	snapshot.filtered(filter)
+	// 104 is held for reordering, 105 was received in an earlier snapshot
+	snapshot.released([]vehiclemonitor.Position{positions[1], positions[2], earlierPosition})
+	snapshot.processed(positions[1], outcomeObserved, 2)
+	snapshot.processed(positions[2], outcomeTripNotFound, 0)
+	snapshot.processed(earlierPosition, outcomeNoStopPassed, 0)
+
+	response := snapshot.response("", true)
+	gotOutcomes := make(map[string]positionOutcome)
+	for _, entry := range response.Positions {
+		gotOutcomes[entry.Position.Id] = entry.Outcome
+	}
+	wantOutcomes := map[string]positionOutcome{
+		"101": positionOutcome(routeExcluded),
+		"102": outcomeObserved,
+		"103": outcomeTripNotFound,
+		"104": outcomeHeld,
+		"105": outcomeNoStopPassed,
+	}
+	if !reflect.DeepEqual(gotOutcomes, wantOutcomes) {
+		t.Errorf("outcomes = %v, want %v", gotOutcomes, wantOutcomes)
+	}
+	if response.Positions[1].ObservedStopTimes != 2 {
+		t.Errorf("observed stop times = %d, want 2", response.Positions[1].ObservedStopTimes)
+	}
+	if len(response.Counts) != 5 || response.Counts[outcomeObserved] != 1 {
+		t.Errorf("counts = %v, want one of each outcome", response.Counts)
+	}
+	if len(response.Feeds) != 1 {
+		t.Fatalf("feeds = %d, want 1", len(response.Feeds))
+	}
+	var feed map[string]interface{}
+	if err = json.Unmarshal(response.Feeds[0], &feed); err != nil || feed["entity"] == nil {
+		t.Errorf("feed = %s, want FeedMessage json with entity", response.Feeds[0])
+	}
+
+	vehicleResponse := snapshot.response("103", false)
+	if len(vehicleResponse.Positions) != 1 || vehicleResponse.Positions[0].Position.Id != "103" {
+		t.Errorf("response for vehicle 103 = %v, want only vehicle 103", vehicleResponse.Positions)
+	}
+	if len(vehicleResponse.Feeds) != 0 {
+		t.Errorf("response without feeds has %d feeds", len(vehicleResponse.Feeds))
+	}
+}
+
+func Test_positionSnapshot_nilIgnored(t *testing.T) {
+	var debugger *PositionDebugger
+	snapshot := debugger.begin(time.Now(), nil, 0, []vehiclemonitor.Position{{Id: "101"}})
+	if snapshot != nil {
+		t.Fatalf("begin() on nil PositionDebugger = %v, want nil", snapshot)
+	}
+	snapshot.ignore(outcomeFeedStale, "feed is stale")
+	snapshot.filtered(&vehicleFilter{})
+	snapshot.released(nil)
+	snapshot.processed(vehiclemonitor.Position{Id: "101"}, outcomeObserved, 1)
+}
+
+func TestPositionDebugger_ServeHTTP(t *testing.T) {
+	debugger := NewPositionDebugger()
+
+	recorder := httptest.NewRecorder()
+	debugger.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/positions", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("status before any snapshot = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+
+	snapshot := debugger.begin(time.Now(), nil, 1000, []vehiclemonitor.Position{{Id: "101", Timestamp: 1000}})
+	snapshot.ignore(outcomeFeedStale, "feed is stale")
+	recorder = httptest.NewRecorder()
+	debugger.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/positions?feeds=false", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	var response positionSnapshotResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("unable to read response %s: %v", recorder.Body.String(), err)
+	}
+	if response.Ignored != "feed is stale" || len(response.Positions) != 1 ||
+		response.Positions[0].Outcome != outcomeFeedStale {
+		t.Errorf("response = %+v, want ignored snapshot with stale feed position", response)
+	}
+}
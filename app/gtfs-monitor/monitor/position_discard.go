@@ -0,0 +1,155 @@
+package monitor
+
+import (
+	"context"
+	"expvar"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
+	"github.com/jmoiron/sqlx"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// discardedPositions counts vehicle positions discarded by gtfs-monitor, keyed by positionOutcome
+var discardedPositions = expvar.NewMap("discarded_vehicle_positions")
+
+// discardFlushInterval is how often discard counts are added to the position_discard_count table
+const discardFlushInterval = time.Minute
+
+// discarded returns true when o is a reason a position was dropped without being used to place its vehicle on a trip.
+// Positions removed by vehicleFilter are not discards, they are counted in filteredVehiclePositions
+func (o positionOutcome) discarded() bool {
+	switch o {
+	case outcomeUnchanged, outcomeStale, outcomeNotOnTrip, outcomeTripNotFound, outcomeStopNotFound,
+		outcomeMovementNotBelievable, outcomeFeedStale, outcomeTripsUnavailable, outcomeWrongDirection,
+		outcomeDeadhead:
+		return true
+	}
+	return false
+}
+
+// logged returns true when each position discarded for o is logged. Repeated positions and vehicles not on a trip
+// are common in normal operation so are only counted, and whole snapshots are logged once when they are ignored
+func (o positionOutcome) logged() bool {
+	switch o {
+	case outcomeStale, outcomeTripNotFound, outcomeStopNotFound, outcomeMovementNotBelievable:
+		return true
+	}
+	return false
+}
+
+// logDiscard logs position being discarded for outcome as key=value pairs, with detail when present
+func logDiscard(log *log.Logger, position *vehiclemonitor.Position, outcome positionOutcome, detail string) {
+	tripId := "unknown"
+	if position.TripId != nil {
+		tripId = *position.TripId
+	}
+	stopSequence := "unknown"
+	if position.StopSequence != nil {
+		stopSequence = strconv.FormatUint(uint64(*position.StopSequence), 10)
+	}
+	if detail == "" {
+		log.Printf("discarded vehicle position reason=%s vehicle=%s trip=%s stop_sequence=%s timestamp=%d\n",
+			outcome, position.Id, tripId, stopSequence, position.Timestamp)
+		return
+	}
+	log.Printf("discarded vehicle position reason=%s vehicle=%s trip=%s stop_sequence=%s timestamp=%d detail=%q\n",
+		outcome, position.Id, tripId, stopSequence, position.Timestamp, detail)
+}
+
+// discardKey is a UTC date and reason positions were discarded for
+type discardKey struct {
+	date   time.Time
+	reason positionOutcome
+}
+
+// discardCounter counts discarded positions by UTC date and reason until they are saved to the database
+type discardCounter struct {
+	mu        sync.Mutex
+	counts    map[discardKey]int64
+	lastFlush time.Time
+}
+
+// makeDiscardCounter builds discardCounter, counts are first saved discardFlushInterval after "now"
+func makeDiscardCounter(now time.Time) *discardCounter {
+	return &discardCounter{
+		counts:    make(map[discardKey]int64),
+		lastFlush: now,
+	}
+}
+
+// add counts count positions discarded for reason at "at", also adding them to discardedPositions
+func (d *discardCounter) add(reason positionOutcome, count int, at time.Time) {
+	if count <= 0 {
+		return
+	}
+	discardedPositions.Add(string(reason), int64(count))
+	at = at.UTC()
+	key := discardKey{date: time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC), reason: reason}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.counts[key] += int64(count)
+}
+
+// take removes and returns the counts made since the last call, ordered by date and reason
+func (d *discardCounter) take() []gtfs.PositionDiscardCount {
+	d.mu.Lock()
+	counts := d.counts
+	d.counts = make(map[discardKey]int64)
+	d.mu.Unlock()
+	results := make([]gtfs.PositionDiscardCount, 0, len(counts))
+	for key, count := range counts {
+		results = append(results, gtfs.PositionDiscardCount{
+			DiscardDate: key.date,
+			Reason:      string(key.reason),
+			Count:       count,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if !results[i].DiscardDate.Equal(results[j].DiscardDate) {
+			return results[i].DiscardDate.Before(results[j].DiscardDate)
+		}
+		return results[i].Reason < results[j].Reason
+	})
+	return results
+}
+
+// restore adds counts that could not be saved back to those waiting to be saved
+func (d *discardCounter) restore(counts []gtfs.PositionDiscardCount) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, count := range counts {
+		d.counts[discardKey{date: count.DiscardDate, reason: positionOutcome(count.Reason)}] += count.Count
+	}
+}
+
+// flush saves the counts to db when discardFlushInterval has passed since the last flush at "now", or always when
+// force is true. Counts are kept to be saved with the next flush if they can't be saved, and dropped without saving
+// when recordToDatabase is false
+func (d *discardCounter) flush(ctx context.Context,
+	log *log.Logger,
+	db *sqlx.DB,
+	queryTimeout time.Duration,
+	recordToDatabase bool,
+	now time.Time,
+	force bool) {
+	if !force && now.Sub(d.lastFlush) < discardFlushInterval {
+		return
+	}
+	d.lastFlush = now
+	counts := d.take()
+	if !recordToDatabase || len(counts) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	err := gtfs.RecordPositionDiscardCounts(ctx, db, counts)
+	if err != nil {
+		log.Printf("failed to record %d position discard counts, retrying with next flush. error:%v\n",
+			len(counts), err)
+		d.restore(counts)
+	}
+}
@@ -0,0 +1,101 @@
+package monitor
+
+import (
+	"context"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_discardCounter_take(t *testing.T) {
+	day1 := time.Date(2022, 5, 22, 23, 59, 0, 0, time.UTC)
+	day2 := time.Date(2022, 5, 23, 0, 1, 0, 0, time.UTC)
+	counter := makeDiscardCounter(day1)
+	counter.add(outcomeTripNotFound, 1, day1)
+	counter.add(outcomeTripNotFound, 2, day1.Add(-time.Hour))
+	counter.add(outcomeFeedStale, 10, day1)
+	counter.add(outcomeTripNotFound, 1, day2)
+	counter.add(outcomeMovementNotBelievable, 0, day2)
+
+	got := counter.take()
+	want := []gtfs.PositionDiscardCount{
+		{DiscardDate: time.Date(2022, 5, 22, 0, 0, 0, 0, time.UTC), Reason: "feed_stale", Count: 10},
+		{DiscardDate: time.Date(2022, 5, 22, 0, 0, 0, 0, time.UTC), Reason: "trip_not_in_schedule", Count: 3},
+		{DiscardDate: time.Date(2022, 5, 23, 0, 0, 0, 0, time.UTC), Reason: "trip_not_in_schedule", Count: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("take() = %v, want %v", got, want)
+	}
+	if remaining := counter.take(); len(remaining) != 0 {
+		t.Errorf("take() after take() = %v, want none", remaining)
+	}
+
+	counter.restore(want[1:2])
+	counter.add(outcomeTripNotFound, 1, day1)
+	got = counter.take()
+	if len(got) != 1 || got[0].Count != 4 {
+		t.Errorf("take() after restore() = %v, want restored count added to new count", got)
+	}
+}
+
+func Test_discardCounter_flush(t *testing.T) {
+	start := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	testLog := makeTestLogWriter()
+	counter := makeDiscardCounter(start)
+	counter.add(outcomeTripNotFound, 1, start)
+
+	counter.flush(ctx, testLog.log, nil, time.Second, false, start.Add(discardFlushInterval/2), false)
+	if len(counter.counts) != 1 {
+		t.Errorf("counts taken before flush interval, counts = %v", counter.counts)
+	}
+	counter.flush(ctx, testLog.log, nil, time.Second, false, start.Add(discardFlushInterval), false)
+	if len(counter.counts) != 0 {
+		t.Errorf("counts not taken after flush interval, counts = %v", counter.counts)
+	}
+	counter.add(outcomeTripNotFound, 1, start)
+	counter.flush(ctx, testLog.log, nil, time.Second, false, start.Add(discardFlushInterval), true)
+	if len(counter.counts) != 0 {
+		t.Errorf("counts not taken on forced flush, counts = %v", counter.counts)
+	}
+}
+
+func Test_positionOutcome_discarded(t *testing.T) {
+	for _, outcome := range []positionOutcome{outcomeUnchanged, outcomeStale, outcomeNotOnTrip,
+		outcomeTripNotFound, outcomeStopNotFound, outcomeMovementNotBelievable, outcomeFeedStale,
+		outcomeTripsUnavailable} {
+		if !outcome.discarded() {
+			t.Errorf("%s.discarded() = false, want true", outcome)
+		}
+	}
+	for _, outcome := range []positionOutcome{outcomeObserved, outcomeNoStopPassed, outcomeHeld,
+		positionOutcome(routeExcluded)} {
+		if outcome.discarded() {
+			t.Errorf("%s.discarded() = true, want false", outcome)
+		}
+	}
+}
+
+func Test_logDiscard(t *testing.T) {
+	testLog := makeTestLogWriter()
+	logDiscard(testLog.log, &vehiclemonitor.Position{Id: "101", TripId: strPtr("9000"), StopSequence: uint32Ptr(3),
+		Timestamp: 1000}, outcomeStopNotFound, "missing stop")
+	logDiscard(testLog.log, &vehiclemonitor.Position{Id: "102", Timestamp: 1001}, outcomeTripNotFound, "")
+	want := []string{
+		`discarded vehicle position reason=stop_not_found vehicle=101 trip=9000 stop_sequence=3 timestamp=1000 ` +
+			`detail="missing stop"`,
+		`discarded vehicle position reason=trip_not_in_schedule vehicle=102 trip=unknown stop_sequence=unknown ` +
+			`timestamp=1001`,
+	}
+	if len(testLog.logLines) != len(want) {
+		t.Fatalf("logged %d lines, want %d", len(testLog.logLines), len(want))
+	}
+	for i, line := range testLog.logLines {
+		if !strings.HasSuffix(strings.TrimSpace(line), want[i]) {
+			t.Errorf("logged %q, want line ending %q", line, want[i])
+		}
+	}
+}
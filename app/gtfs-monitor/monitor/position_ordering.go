@@ -0,0 +1,99 @@
+package monitor
+
+import (
+	"expvar"
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
+	"sort"
+	"time"
+)
+
+// positionOrdering counts vehicle positions received out of timestamp order, keyed by orderingOutcome
+var positionOrdering = expvar.NewMap("vehicle_position_ordering")
+
+// orderingOutcome describes what happened to a vehiclemonitor.Position received out of timestamp order
+type orderingOutcome string
+
+const (
+	// droppedStale positions were older than the vehicle's last position by more than the stale tolerance
+	droppedStale orderingOutcome = "dropped_stale"
+	// clampedToLast positions were older than the vehicle's last position within the stale tolerance, and processed
+	// at the last position's timestamp
+	clampedToLast orderingOutcome = "clamped_to_last"
+	// reordered positions were released from positionReorderBuffer ahead of a position received before them
+	reordered orderingOutcome = "reordered"
+)
+
+// PositionOrderingConf controls how vehicle positions arriving out of timestamp order are handled. Some feeds
+// interleave GPS and AVL clock corrections, making legitimate positions appear older than ones already received
+type PositionOrderingConf struct {
+	//ReorderDelaySeconds holds each position this long before processing, releasing the positions held for each
+	//vehicle in timestamp order. Zero processes positions as soon as they are received
+	ReorderDelaySeconds int
+	//StaleToleranceSeconds is how much older than a vehicle's last position a position can be and still be
+	//processed, at the last position's timestamp. Older positions are dropped
+	StaleToleranceSeconds int
+}
+
+// bufferedPosition is a vehiclemonitor.Position held by positionReorderBuffer since receivedAt
+type bufferedPosition struct {
+	position   vehiclemonitor.Position
+	receivedAt time.Time
+}
+
+// positionReorderBuffer holds vehicle positions for a delay so positions received out of order over successive feed
+// snapshots can be processed in timestamp order
+type positionReorderBuffer struct {
+	delay   time.Duration
+	pending map[string][]bufferedPosition
+}
+
+// makePositionReorderBuffer builds positionReorderBuffer holding positions for delaySeconds
+func makePositionReorderBuffer(delaySeconds int) *positionReorderBuffer {
+	return &positionReorderBuffer{
+		delay:   time.Duration(delaySeconds) * time.Second,
+		pending: make(map[string][]bufferedPosition),
+	}
+}
+
+// release adds positions received at "now" to the buffer and returns the positions ready to be processed, in
+// timestamp order for each vehicle. A vehicle's positions are released oldest timestamp first until reaching one
+// that has not been held for the delay. With no delay positions are returned as received
+func (b *positionReorderBuffer) release(positions []vehiclemonitor.Position, now time.Time) []vehiclemonitor.Position {
+	if b.delay <= 0 {
+		return positions
+	}
+	for _, position := range positions {
+		b.pending[position.Id] = append(b.pending[position.Id], bufferedPosition{
+			position:   position,
+			receivedAt: now,
+		})
+	}
+	var results []vehiclemonitor.Position
+	for vehicleId, held := range b.pending {
+		sort.SliceStable(held, func(i, j int) bool {
+			return held[i].position.Timestamp < held[j].position.Timestamp
+		})
+		// earliestAfter[i] is the earliest time a position with a later timestamp than held[i] was received
+		earliestAfter := make([]time.Time, len(held))
+		for i := len(held) - 2; i >= 0; i-- {
+			earliestAfter[i] = held[i+1].receivedAt
+			if !earliestAfter[i+1].IsZero() && earliestAfter[i+1].Before(earliestAfter[i]) {
+				earliestAfter[i] = earliestAfter[i+1]
+			}
+		}
+		released := 0
+		for released < len(held) && now.Sub(held[released].receivedAt) >= b.delay {
+			if held[released].receivedAt.After(earliestAfter[released]) && !earliestAfter[released].IsZero() {
+				positionOrdering.Add(string(reordered), 1)
+			}
+			results = append(results, held[released].position)
+			released++
+		}
+		if released == len(held) {
+			delete(b.pending, vehicleId)
+		} else {
+			b.pending[vehicleId] = held[released:]
+		}
+	}
+	return results
+}
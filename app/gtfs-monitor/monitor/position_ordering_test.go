@@ -0,0 +1,55 @@
+package monitor
+
+import (
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// positionTimestamps returns the vehicle id and timestamp of each position
+func positionTimestamps(positions []vehiclemonitor.Position) []string {
+	results := make([]string, 0)
+	for _, position := range positions {
+		results = append(results, position.Id+":"+time.Unix(position.Timestamp, 0).UTC().Format("15:04:05"))
+	}
+	return results
+}
+
+func Test_positionReorderBuffer_release(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	buffer := makePositionReorderBuffer(6)
+
+	got := buffer.release([]vehiclemonitor.Position{{Id: "1", Timestamp: at.Unix()}}, at)
+	if len(got) != 0 {
+		t.Errorf("release() = %v, expected position to be held", positionTimestamps(got))
+	}
+	// a position corrected to before the one already held arrives on the next snapshot
+	got = buffer.release([]vehiclemonitor.Position{{Id: "1", Timestamp: at.Add(-5 * time.Second).Unix()}},
+		at.Add(3*time.Second))
+	if len(got) != 0 {
+		t.Errorf("release() = %v, expected positions to be held", positionTimestamps(got))
+	}
+	got = buffer.release(nil, at.Add(6*time.Second))
+	if len(got) != 0 {
+		t.Errorf("release() = %v, expected older timestamp to hold back the newer one", positionTimestamps(got))
+	}
+	got = buffer.release(nil, at.Add(9*time.Second))
+	want := []string{"1:11:59:55", "1:12:00:00"}
+	if !reflect.DeepEqual(positionTimestamps(got), want) {
+		t.Errorf("release() = %v, want %v", positionTimestamps(got), want)
+	}
+	if len(buffer.pending) != 0 {
+		t.Errorf("release() left %d vehicles pending", len(buffer.pending))
+	}
+}
+
+func Test_positionReorderBuffer_release_disabled(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	positions := []vehiclemonitor.Position{{Id: "1", Timestamp: at.Unix()},
+		{Id: "1", Timestamp: at.Add(-time.Minute).Unix()}}
+	got := makePositionReorderBuffer(0).release(positions, at)
+	if !reflect.DeepEqual(got, positions) {
+		t.Errorf("release() = %v, want positions as received", positionTimestamps(got))
+	}
+}
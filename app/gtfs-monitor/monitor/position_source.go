@@ -0,0 +1,67 @@
+package monitor
+
+import (
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
+	"log"
+	"time"
+)
+
+// PositionSourceConf selects where RunVehicleMonitorLoop receives vehicle positions from
+type PositionSourceConf struct {
+	//Type is "http" to poll URL for a GTFS-RT vehicle positions feed, or "mqtt" to subscribe to MQTT.Topics
+	Type string
+	URL  string
+	MQTT MQTTConf
+}
+
+// positionSource supplies vehicle positions each time RunVehicleMonitorLoop runs, either pulled from a feed or
+// collected from positions pushed to gtfs-monitor since the last call
+type positionSource interface {
+	//positions returns the vehicle positions available at "now" along with the most recent FeedHeader timestamp
+	//received, zero when unknown
+	positions(log *log.Logger, now time.Time) ([]vehiclemonitor.Position, int64, error)
+	//lastReceived returns the GTFS-RT FeedMessages read by the last call to positions
+	lastReceived() [][]byte
+	//close releases any connection held by the source
+	close()
+}
+
+// makePositionSource builds the positionSource configured in conf
+func makePositionSource(log *log.Logger, conf PositionSourceConf) (positionSource, error) {
+	switch conf.Type {
+	case "", "http":
+		return &httpPositionSource{url: conf.URL}, nil
+	case "mqtt":
+		source, err := makeMQTTPositionSource(log, conf.MQTT)
+		if err != nil {
+			return nil, err
+		}
+		return source, nil
+	}
+	return nil, fmt.Errorf("unknown vehicle position source type \"%s\", expected http or mqtt", conf.Type)
+}
+
+// httpPositionSource polls a GTFS-RT vehicle positions feed at url
+type httpPositionSource struct {
+	url  string
+	last []byte
+}
+
+func (h *httpPositionSource) positions(log *log.Logger, now time.Time) ([]vehiclemonitor.Position, int64, error) {
+	gtfsResponseBytes, err := retrieveBytes(log, h.url)
+	if err != nil {
+		return nil, 0, err
+	}
+	h.last = gtfsResponseBytes
+	return parseVehiclePositions(log, gtfsResponseBytes, now)
+}
+
+func (h *httpPositionSource) lastReceived() [][]byte {
+	if h.last == nil {
+		return nil
+	}
+	return [][]byte{h.last}
+}
+
+func (h *httpPositionSource) close() {}
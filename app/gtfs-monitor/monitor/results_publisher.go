@@ -1,8 +1,11 @@
 package monitor
 
 import (
-	"encoding/json"
+	"context"
 	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/foundation/clock"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
 	"github.com/jmoiron/sqlx"
 	"github.com/nats-io/nats.go"
 	"log"
@@ -10,78 +13,238 @@ import (
 )
 
 //vehicleMonitorResultsPublisher takes observations made by vehicle monitor and sends them to their
-// destinations (such as database and nats )
+// destinations (such as database and nats ). Observations are timestamped with clock, and encoded for nats by codec
+// on the tenant's subjects
 type vehicleMonitorResultsPublisher struct {
 	log              *log.Logger
 	db               *sqlx.DB
 	natsConnection   *nats.Conn
+	codec            natsclient.Codec
+	subjects         natsclient.Subjects
 	recordToDatabase bool
 	publishOverNats  bool
+	queryTimeout     time.Duration
+	outliers         *outlierFilter
+	clock            clock.Clock
+	//observationsOnly drops everything but ObservedStopTimes, as when backfilling observations from an archive
+	observationsOnly bool
+	//assignments decides when vehicle assignments are published, nil publishes none
+	assignments *assignmentTracker
 }
 
 //makeVehicleMonitorResultsPublisher creates vehicleMonitorResultsPublisher
 func makeVehicleMonitorResultsPublisher(log *log.Logger,
 	db *sqlx.DB,
 	natsConnection *nats.Conn,
+	codec natsclient.Codec,
+	subjects natsclient.Subjects,
 	recordToDatabase bool,
-	publishOverNats bool) *vehicleMonitorResultsPublisher {
+	publishOverNats bool,
+	queryTimeout time.Duration,
+	outliers *outlierFilter,
+	clk clock.Clock) *vehicleMonitorResultsPublisher {
 	return &vehicleMonitorResultsPublisher{
 		log:              log,
 		db:               db,
 		natsConnection:   natsConnection,
+		codec:            codec,
+		subjects:         subjects,
 		recordToDatabase: recordToDatabase,
 		publishOverNats:  publishOverNats,
+		queryTimeout:     queryTimeout,
+		outliers:         outliers,
+		clock:            clk,
 	}
 }
 
 //publish sends gtfs.VehicleMonitorResults over NATS and records them to the database according to
-//publishOverNats and recordToDatabase
-func (v *vehicleMonitorResultsPublisher) publish(results *gtfs.VehicleMonitorResults) {
-	now := time.Now()
-	//set created at on all observations and log
+//publishOverNats and recordToDatabase. ObservedStopTimes rejected as outliers are removed from results and only
+//recorded to the quarantine table
+func (v *vehicleMonitorResultsPublisher) publish(ctx context.Context, results *gtfs.VehicleMonitorResults) {
+	now := v.clock.Now()
 	for _, observation := range results.ObservedStopTimes {
 		observation.CreatedAt = now
+		observation.SchemaVersion = gtfs.MessageSchemaVersion
+	}
+	var quarantined []*gtfs.QuarantinedObservedStopTime
+	results.ObservedStopTimes, quarantined = v.outliers.filter(results.ObservedStopTimes)
+	for _, outlier := range quarantined {
+		v.log.Printf("Quarantined vehicle %s on route %s moving from %s to %s in %d, %.1f standard deviations "+
+			"from mean %.0f\n", outlier.VehicleId, outlier.RouteId, outlier.StopId, outlier.NextStopId,
+			outlier.TravelSeconds, outlier.ZScore, outlier.MeanTravelSeconds)
+	}
+	//log remaining observations
+	for _, observation := range results.ObservedStopTimes {
 		v.log.Printf("Vehicle %s on route %s moved from %s to %s in %d\n", observation.VehicleId,
 			observation.RouteId, observation.StopId, observation.NextStopId, observation.TravelSeconds)
 	}
+	if v.observationsOnly {
+		results.TripDeviations = nil
+	}
 	//set created at on all tripDeviations
 	for _, tripDeviation := range results.TripDeviations {
 		tripDeviation.CreatedAt = now
+		tripDeviation.SchemaVersion = gtfs.MessageSchemaVersion
 	}
 	if v.publishOverNats {
 		v.sendOverNats(results)
 	}
 	if v.recordToDatabase {
-		v.record(results)
+		v.record(ctx, results)
+		v.recordQuarantined(ctx, quarantined)
 	}
 
 }
 
 func (v *vehicleMonitorResultsPublisher) sendOverNats(results *gtfs.VehicleMonitorResults) {
-	jsonData, err := json.Marshal(results)
+	jsonData, err := v.codec.Marshal(results)
 	if err != nil {
 		v.log.Printf("failed to marshal VehicleMonitorResults to in "+
 			"vehicleMonitorResultsPublisher.sendOverNats, error:%v", err)
 		return
 	}
-	err = v.natsConnection.Publish("vehicle-monitor-results", jsonData)
+	err = v.natsConnection.Publish(v.subjects.Subject("vehicle-monitor-results"), jsonData)
 	if err != nil {
 		v.log.Printf("failed to send VehicleMonitorResults in "+
 			"vehicleMonitorResultsPublisher.sendOverNats, error:%v", err)
 	}
 }
 
-func (v *vehicleMonitorResultsPublisher) record(results *gtfs.VehicleMonitorResults) {
+//record saves results to the database, giving up after queryTimeout or when ctx is cancelled
+func (v *vehicleMonitorResultsPublisher) record(ctx context.Context, results *gtfs.VehicleMonitorResults) {
+	ctx, cancel := context.WithTimeout(ctx, v.queryTimeout)
+	defer cancel()
 	for _, observation := range results.ObservedStopTimes {
-		err := gtfs.RecordObservedStopTime(observation, v.db)
+		err := gtfs.RecordObservedStopTime(ctx, observation, v.db)
 		if err != nil {
 			v.log.Printf("Error saving stop time observation %+v. error: %v", observation, err)
 		}
 	}
-	err := gtfs.RecordTripDeviation(results.TripDeviations, v.db)
+	err := gtfs.RecordTripDeviation(ctx, results.TripDeviations, v.db)
 	if err != nil {
 		v.log.Printf("failed to record %d trip deviations, error:%v", len(results.TripDeviations), err)
 		return
 	}
 
 }
+
+//recordQuarantined saves observations rejected as outliers to the database, giving up after queryTimeout or when
+//ctx is cancelled
+func (v *vehicleMonitorResultsPublisher) recordQuarantined(ctx context.Context,
+	quarantined []*gtfs.QuarantinedObservedStopTime) {
+	if len(quarantined) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, v.queryTimeout)
+	defer cancel()
+	for _, observation := range quarantined {
+		err := gtfs.RecordQuarantinedObservedStopTime(ctx, observation, v.db)
+		if err != nil {
+			v.log.Printf("Error saving quarantined stop time observation %+v. error: %v", observation, err)
+		}
+	}
+}
+
+//publishAssignmentChange logs change and sends it over NATS and records it to the database according to
+//publishOverNats and recordToDatabase
+func (v *vehicleMonitorResultsPublisher) publishAssignmentChange(ctx context.Context,
+	change *gtfs.VehicleAssignmentChange) {
+	if v.observationsOnly {
+		return
+	}
+	change.CreatedAt = v.clock.Now()
+	v.log.Printf("Vehicle %s reassigned from trip %s block %s at stop sequence %d to trip %s block %s\n",
+		change.VehicleId, change.PreviousTripId, change.PreviousBlockId, change.PreviousStopSequence, change.TripId,
+		change.BlockId)
+	if v.publishOverNats {
+		jsonData, err := v.codec.Marshal(change)
+		if err != nil {
+			v.log.Printf("failed to marshal VehicleAssignmentChange, error:%v", err)
+		} else if err = v.natsConnection.Publish(v.subjects.Subject("vehicle-assignment-changes"),
+			jsonData); err != nil {
+			v.log.Printf("failed to send VehicleAssignmentChange, error:%v", err)
+		}
+	}
+	if v.recordToDatabase {
+		ctx, cancel := context.WithTimeout(ctx, v.queryTimeout)
+		defer cancel()
+		err := gtfs.RecordVehicleAssignmentChange(ctx, change, v.db)
+		if err != nil {
+			v.log.Printf("failed to record VehicleAssignmentChange %+v, error:%v", change, err)
+		}
+	}
+}
+
+//publishAssignmentAnomaly logs anomaly and sends it over NATS and records it to the database according to
+//publishOverNats and recordToDatabase
+func (v *vehicleMonitorResultsPublisher) publishAssignmentAnomaly(ctx context.Context,
+	anomaly *gtfs.VehicleAssignmentAnomaly) {
+	if v.observationsOnly {
+		return
+	}
+	anomaly.CreatedAt = v.clock.Now()
+	v.log.Printf("Vehicle %s assignment anomaly %s on trip %s block %s at stop sequence %d: %s\n",
+		anomaly.VehicleId, anomaly.Anomaly, anomaly.TripId, anomaly.BlockId, anomaly.StopSequence, anomaly.Detail)
+	if v.publishOverNats {
+		jsonData, err := v.codec.Marshal(anomaly)
+		if err != nil {
+			v.log.Printf("failed to marshal VehicleAssignmentAnomaly, error:%v", err)
+		} else if err = v.natsConnection.Publish(v.subjects.Subject("vehicle-assignment-anomalies"),
+			jsonData); err != nil {
+			v.log.Printf("failed to send VehicleAssignmentAnomaly, error:%v", err)
+		}
+	}
+	if v.recordToDatabase {
+		ctx, cancel := context.WithTimeout(ctx, v.queryTimeout)
+		defer cancel()
+		err := gtfs.RecordVehicleAssignmentAnomaly(ctx, anomaly, v.db)
+		if err != nil {
+			v.log.Printf("failed to record VehicleAssignmentAnomaly %+v, error:%v", anomaly, err)
+		}
+	}
+}
+
+//publishAssignment sends the vehicle's assignment to trip over NATS when position places it on a new trip or its
+//assignment is due to be refreshed. Assignments are not recorded to the database
+func (v *vehicleMonitorResultsPublisher) publishAssignment(position vehiclemonitor.Position, trip *gtfs.TripInstance) {
+	if v.observationsOnly || !v.publishOverNats {
+		return
+	}
+	assignment := v.assignments.update(position, trip)
+	if assignment == nil {
+		return
+	}
+	jsonData, err := v.codec.Marshal(assignment)
+	if err != nil {
+		v.log.Printf("failed to marshal VehicleAssignment, error:%v", err)
+	} else if err = v.natsConnection.Publish(v.subjects.Subject("vehicle-assignments"), jsonData); err != nil {
+		v.log.Printf("failed to send VehicleAssignment, error:%v", err)
+	}
+}
+
+//publishDeadhead logs deadhead and sends it over NATS and records it to the database according to publishOverNats and
+//recordToDatabase
+func (v *vehicleMonitorResultsPublisher) publishDeadhead(ctx context.Context, deadhead *gtfs.VehicleDeadhead) {
+	if v.observationsOnly {
+		return
+	}
+	deadhead.CreatedAt = v.clock.Now()
+	v.log.Printf("Vehicle %s %s deadhead from %s to %s, %.0f meters\n", deadhead.VehicleId, deadhead.Kind,
+		deadhead.StartedAt.Format(time.RFC3339), deadhead.EndedAt.Format(time.RFC3339), deadhead.DistanceMeters)
+	if v.publishOverNats {
+		jsonData, err := v.codec.Marshal(deadhead)
+		if err != nil {
+			v.log.Printf("failed to marshal VehicleDeadhead, error:%v", err)
+		} else if err = v.natsConnection.Publish(v.subjects.Subject("vehicle-deadheads"), jsonData); err != nil {
+			v.log.Printf("failed to send VehicleDeadhead, error:%v", err)
+		}
+	}
+	if v.recordToDatabase {
+		ctx, cancel := context.WithTimeout(ctx, v.queryTimeout)
+		defer cancel()
+		err := gtfs.RecordVehicleDeadhead(ctx, deadhead, v.db)
+		if err != nil {
+			v.log.Printf("failed to record VehicleDeadhead %+v, error:%v", deadhead, err)
+		}
+	}
+}
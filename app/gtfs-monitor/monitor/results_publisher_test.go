@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"context"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/foundation/clock"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_vehicleMonitorResultsPublisher_publish_timestampsWithClock(t *testing.T) {
+	now := time.Date(2022, 6, 1, 8, 30, 0, 0, time.Local)
+	manual := clock.NewManual(now)
+	publisher := makeVehicleMonitorResultsPublisher(log.New(os.Stdout, "test", 0), nil, nil, natsclient.Codec{},
+		natsclient.Subjects{}, false, false, time.Second, makeOutlierFilter(OutlierConf{}), manual)
+
+	results := &gtfs.VehicleMonitorResults{
+		VehicleId:         "101",
+		ObservedStopTimes: []*gtfs.ObservedStopTime{{StopId: "A", NextStopId: "B"}},
+		TripDeviations:    []*gtfs.TripDeviation{{TripId: "1"}},
+	}
+	publisher.publish(context.Background(), results)
+	if got := results.ObservedStopTimes[0].CreatedAt; !got.Equal(now) {
+		t.Errorf("ObservedStopTime.CreatedAt = %v, want %v", got, now)
+	}
+	if got := results.TripDeviations[0].CreatedAt; !got.Equal(now) {
+		t.Errorf("TripDeviation.CreatedAt = %v, want %v", got, now)
+	}
+
+	manual.Advance(time.Minute)
+	change := &gtfs.VehicleAssignmentChange{VehicleId: "101"}
+	publisher.publishAssignmentChange(context.Background(), change)
+	if want := now.Add(time.Minute); !change.CreatedAt.Equal(want) {
+		t.Errorf("VehicleAssignmentChange.CreatedAt = %v, want %v", change.CreatedAt, want)
+	}
+
+	manual.Advance(time.Minute)
+	anomaly := &gtfs.VehicleAssignmentAnomaly{VehicleId: "101", Anomaly: gtfs.WrongDirectionAnomaly}
+	publisher.publishAssignmentAnomaly(context.Background(), anomaly)
+	if want := now.Add(2 * time.Minute); !anomaly.CreatedAt.Equal(want) {
+		t.Errorf("VehicleAssignmentAnomaly.CreatedAt = %v, want %v", anomaly.CreatedAt, want)
+	}
+}
+
+func Test_vehicleMonitorResultsPublisher_publish_observationsOnly(t *testing.T) {
+	now := time.Date(2022, 6, 1, 8, 30, 0, 0, time.Local)
+	publisher := makeVehicleMonitorResultsPublisher(log.New(io.Discard, "", 0), nil, nil, natsclient.Codec{},
+		natsclient.Subjects{}, false, false, time.Second, makeOutlierFilter(OutlierConf{}), clock.NewManual(now))
+	publisher.observationsOnly = true
+
+	results := &gtfs.VehicleMonitorResults{
+		VehicleId:         "101",
+		ObservedStopTimes: []*gtfs.ObservedStopTime{{StopId: "A", NextStopId: "B"}},
+		TripDeviations:    []*gtfs.TripDeviation{{TripId: "1"}},
+	}
+	publisher.publish(context.Background(), results)
+	if len(results.ObservedStopTimes) != 1 || len(results.TripDeviations) != 0 {
+		t.Errorf("publish() kept %d ObservedStopTimes and %d TripDeviations, want 1 and 0",
+			len(results.ObservedStopTimes), len(results.TripDeviations))
+	}
+	change := &gtfs.VehicleAssignmentChange{VehicleId: "101"}
+	publisher.publishAssignmentChange(context.Background(), change)
+	if !change.CreatedAt.IsZero() {
+		t.Errorf("publishAssignmentChange() published VehicleAssignmentChange at %v", change.CreatedAt)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
 	"log"
 	"os"
-	"path/filepath"
 	"testing"
 	"time"
 )
@@ -29,32 +28,12 @@ func (t *testLogWriter) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
-func intPtr(i int) *int {
-	return &i
-}
-
 func strPtr(s string) *string {
 	return &s
 }
-func float32Ptr(f float32) *float32 {
-	return &f
-}
 
-func float64Ptr(f float64) *float64 {
-	return &f
-}
-
-func getTestTrip(trips []*gtfs.TripInstance, tripId *string, t *testing.T) *gtfs.TripInstance {
-	if tripId == nil {
-		return nil
-	}
-	for _, trip := range trips {
-		if trip.TripId == *tripId {
-			return trip
-		}
-	}
-	t.Errorf("unable to find test tripId %s", *tripId)
-	return nil
+func uint32Ptr(u uint32) *uint32 {
+	return &u
 }
 
 func getTestTrips(serviceDate time.Time, t *testing.T) []*gtfs.TripInstance {
@@ -75,30 +54,3 @@ func getTestTrips(serviceDate time.Time, t *testing.T) []*gtfs.TripInstance {
 	}
 	return result
 }
-
-func getTestTripsFromJson(fileName string, t *testing.T) []*gtfs.TripInstance {
-	var result []*gtfs.TripInstance
-	file, err := os.ReadFile(filepath.Join("testdata", fileName))
-	if err != nil {
-		t.Errorf("unable to read test trips file: %v", err)
-	}
-	err = json.Unmarshal(file, &result)
-	if err != nil {
-		t.Errorf("unable to read test trips file: %v", err)
-	}
-	return result
-}
-
-func getFirstTestTripFromJson(fileName string, t *testing.T) *gtfs.TripInstance {
-	trips := getTestTripsFromJson(fileName, t)
-	if len(trips) < 1 {
-		t.Errorf("failed to load test trip from file %s", fileName)
-		return nil
-	}
-	return trips[0]
-}
-
-func testDate(dateString string) time.Time {
-	t, _ := time.Parse("2006-01-02T15:04:05-07:00", dateString)
-	return t
-}
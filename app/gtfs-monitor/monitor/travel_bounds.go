@@ -0,0 +1,68 @@
+package monitor
+
+import (
+	"context"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
+	"github.com/jmoiron/sqlx"
+	"log"
+	"sync"
+	"time"
+)
+
+// travelBoundsLoadEvery is how often travel bounds are reloaded, picking up bounds computed by model-mgr tuneTolerance
+const travelBoundsLoadEvery = time.Hour
+
+// loadTravelBounds replaces bounds with those in the stop_pair_travel_bound table
+func loadTravelBounds(ctx context.Context,
+	log *log.Logger,
+	db *sqlx.DB,
+	bounds *vehiclemonitor.TravelBounds,
+	queryTimeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	loaded, err := gtfs.GetStopPairTravelBounds(ctx, db)
+	if err != nil {
+		return err
+	}
+	bounds.Replace(loaded)
+	log.Printf("loaded minimum travel times for %d stop pairs\n", len(loaded))
+	return nil
+}
+
+// runTravelBoundsLoader loads bounds every travelBoundsLoadEvery until shutdownSignal is received.
+// Movement is checked against earlyTolerance alone until bounds are loaded
+func runTravelBoundsLoader(ctx context.Context,
+	log *log.Logger,
+	wg *sync.WaitGroup,
+	db *sqlx.DB,
+	bounds *vehiclemonitor.TravelBounds,
+	queryTimeout time.Duration,
+	shutdownSignal chan bool) {
+	wg.Add(1)
+	defer wg.Done()
+
+	sleepChan := make(chan bool)
+	sleep := time.Duration(0) //sleep for zero seconds the first time
+
+	for {
+
+		go func() {
+			time.Sleep(sleep)
+			sleepChan <- true
+		}()
+
+		select {
+		case <-shutdownSignal:
+			log.Printf("Exiting travel bounds loader on shutdown signal")
+			return
+		case <-sleepChan:
+		}
+
+		sleep = travelBoundsLoadEvery
+		err := loadTravelBounds(ctx, log, db, bounds, queryTimeout)
+		if err != nil {
+			log.Printf("error loading stop pair travel bounds, keeping current bounds. error:%v\n", err)
+		}
+	}
+}
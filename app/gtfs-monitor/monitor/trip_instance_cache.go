@@ -0,0 +1,169 @@
+package monitor
+
+import (
+	"container/list"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"math"
+	"sync"
+	"time"
+)
+
+// tripInstanceKey identifies a trip instance by the DataSet it was loaded from, its tripId and the service date it
+// is scheduled on
+type tripInstanceKey struct {
+	dataSetId   int64
+	tripId      string
+	serviceDate string
+}
+
+// makeTripInstanceKey builds the tripInstanceKey for trip
+func makeTripInstanceKey(trip *gtfs.TripInstance) tripInstanceKey {
+	return tripInstanceKey{
+		dataSetId:   trip.DataSetId,
+		tripId:      trip.TripId,
+		serviceDate: trip.ServiceDate().Format("2006-01-02"),
+	}
+}
+
+// tripInstanceLRU holds up to capacity trip instances, removing the least recently used trips when full.
+// Safe for use by multiple go routines
+type tripInstanceLRU struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[tripInstanceKey]*list.Element
+	// keysByTripId holds the keys of every trip instance present for each tripId
+	keysByTripId map[string]map[tripInstanceKey]bool
+	hits         int
+	misses       int
+	evictions    int
+}
+
+// makeTripInstanceLRU creates tripInstanceLRU that holds up to capacity trip instances
+func makeTripInstanceLRU(capacity int) *tripInstanceLRU {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &tripInstanceLRU{
+		capacity:     capacity,
+		order:        list.New(),
+		entries:      make(map[tripInstanceKey]*list.Element),
+		keysByTripId: make(map[string]map[tripInstanceKey]bool),
+	}
+}
+
+// add places trip in the cache as the most recently used, replacing any trip instance with the same key
+func (c *tripInstanceLRU) add(trip *gtfs.TripInstance) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := makeTripInstanceKey(trip)
+	if element, present := c.entries[key]; present {
+		element.Value = trip
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(trip)
+	keys, present := c.keysByTripId[key.tripId]
+	if !present {
+		keys = make(map[tripInstanceKey]bool)
+		c.keysByTripId[key.tripId] = keys
+	}
+	keys[key] = true
+
+	for c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+		c.evictions++
+	}
+}
+
+// removeElement removes element from the cache, caller must hold lock
+func (c *tripInstanceLRU) removeElement(element *list.Element) {
+	trip := c.order.Remove(element).(*gtfs.TripInstance)
+	key := makeTripInstanceKey(trip)
+	delete(c.entries, key)
+	if keys, present := c.keysByTripId[key.tripId]; present {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(c.keysByTripId, key.tripId)
+		}
+	}
+}
+
+// contains returns true if a trip instance with key is present, does not change how recently the trip was used
+func (c *tripInstanceLRU) contains(key tripInstanceKey) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, present := c.entries[key]
+	return present
+}
+
+// get retrieves the trip instance for tripId in dataSetId that is scheduled nearest to "at", only trips scheduled
+// within maximumDistance of "at" are returned. The trip returned is marked as the most recently used
+func (c *tripInstanceLRU) get(dataSetId int64,
+	tripId string,
+	at time.Time,
+	maximumDistance time.Duration) (*gtfs.TripInstance, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var bestElement *list.Element
+	bestDistance := maximumDistance
+	for key := range c.keysByTripId[tripId] {
+		if key.dataSetId != dataSetId {
+			continue
+		}
+		element := c.entries[key]
+		distance := distanceFromTripSchedule(element.Value.(*gtfs.TripInstance), at)
+		if distance <= bestDistance {
+			bestElement = element
+			bestDistance = distance
+		}
+	}
+	if bestElement == nil {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(bestElement)
+	return bestElement.Value.(*gtfs.TripInstance), true
+}
+
+// tripInstanceLRUStats contains counts describing tripInstanceLRU usage
+type tripInstanceLRUStats struct {
+	size      int
+	hits      int
+	misses    int
+	evictions int
+}
+
+// stats returns current size of the cache and counts of hits, misses and evictions since the last call to stats
+func (c *tripInstanceLRU) stats() tripInstanceLRUStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := tripInstanceLRUStats{
+		size:      c.order.Len(),
+		hits:      c.hits,
+		misses:    c.misses,
+		evictions: c.evictions,
+	}
+	c.hits = 0
+	c.misses = 0
+	c.evictions = 0
+	return result
+}
+
+// distanceFromTripSchedule returns how far "at" is from the scheduled start and end of trip,
+// zero if "at" is during the trip
+func distanceFromTripSchedule(trip *gtfs.TripInstance, at time.Time) time.Duration {
+	first := trip.FirstStopTimeInstance()
+	last := trip.LastStopTimeInstance()
+	if first == nil || last == nil {
+		return time.Duration(math.MaxInt64)
+	}
+	if at.Before(first.ArrivalDateTime) {
+		return first.ArrivalDateTime.Sub(at)
+	}
+	if at.After(last.DepartureDateTime) {
+		return at.Sub(last.DepartureDateTime)
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+package monitor
+
+import (
+	"context"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+func Test_tripInstanceLRU(t *testing.T) {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Errorf("Unable to get testing time zone location")
+		return
+	}
+	dayOne := time.Date(2021, 7, 13, 0, 0, 0, 0, location)
+	dayTwo := dayOne.AddDate(0, 0, 1)
+	dayOneTrips := getTestTrips(dayOne, t)
+	dayTwoTrips := getTestTrips(dayTwo, t)
+
+	lru := makeTripInstanceLRU(3)
+	lru.add(dayOneTrips[0])
+	lru.add(dayTwoTrips[0])
+	lru.add(dayOneTrips[1])
+
+	maximumDistance := 8 * time.Hour
+
+	// 9am on day two should find the day two instance of the first trip
+	got, present := lru.get(1, "9529801", dayTwo.Add(9*time.Hour), maximumDistance)
+	if !present || got != dayTwoTrips[0] {
+		t.Errorf("expected day two instance of trip 9529801, got %v", got)
+	}
+
+	// the first trip is not scheduled within range in a day later
+	_, present = lru.get(1, "9529801", dayTwo.AddDate(0, 0, 1).Add(20*time.Hour), maximumDistance)
+	if present {
+		t.Errorf("expected no trip 9529801 out of range")
+	}
+
+	// trips from other data sets are not returned
+	_, present = lru.get(2, "9529801", dayTwo.Add(9*time.Hour), maximumDistance)
+	if present {
+		t.Errorf("expected no trip 9529801 from data set 2")
+	}
+
+	// day one instance of the first trip is now least recently used and is evicted
+	lru.add(dayTwoTrips[1])
+	_, present = lru.get(1, "9529801", dayOne.Add(9*time.Hour), time.Duration(0))
+	if present {
+		t.Errorf("expected day one instance of trip 9529801 to be evicted")
+	}
+	got, present = lru.get(1, "9530573", dayOne.Add(12*time.Hour), maximumDistance)
+	if !present || got != dayOneTrips[1] {
+		t.Errorf("expected day one instance of trip 9530573, got %v", got)
+	}
+
+	stats := lru.stats()
+	want := tripInstanceLRUStats{size: 3, hits: 2, misses: 3, evictions: 1}
+	if stats != want {
+		t.Errorf("stats() = %+v, want %+v", stats, want)
+	}
+}
+
+func Test_tripCache_useNewerDataSet(t *testing.T) {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Errorf("Unable to get testing time zone location")
+		return
+	}
+	serviceDate := time.Date(2021, 7, 13, 0, 0, 0, 0, location)
+	trips := getTestTrips(serviceDate, t)
+	for _, trip := range trips {
+		trip.DataSetId = 2
+	}
+	cache := makeTripCache(10, time.Second)
+	cache.dataSetId = 1
+	cache.instances.add(trips[0])
+
+	// trips loaded from a data set activated since the last preload replace the cache's data set
+	cache.useNewerDataSet(map[string]*gtfs.TripInstance{trips[0].TripId: trips[0]})
+	if cache.dataSetId != 2 {
+		t.Fatalf("dataSetId = %d, want 2", cache.dataSetId)
+	}
+	got, err := collectRequiredTrips(context.Background(), log.New(io.Discard, "", 0), nil, cache.dataSetId,
+		map[string]bool{trips[0].TripId: true}, serviceDate.Add(9*time.Hour), cache.instances, cache.compactor)
+	if err != nil || got[trips[0].TripId] != trips[0] {
+		t.Errorf("collectRequiredTrips() = %v, %v, want trip %s from the cache", got, err, trips[0].TripId)
+	}
+
+	// trips from an older data set don't move the cache back
+	trips[1].DataSetId = 1
+	cache.useNewerDataSet(map[string]*gtfs.TripInstance{trips[1].TripId: trips[1]})
+	if cache.dataSetId != 2 {
+		t.Errorf("dataSetId = %d, want 2", cache.dataSetId)
+	}
+}
@@ -1,66 +1,222 @@
 package monitor
 
 import (
+	"context"
 	"errors"
 	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/foundation/clock"
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
 	"github.com/jmoiron/sqlx"
 	"log"
+	"sync"
 	"time"
 )
 
+// tripSearchRangeSeconds is the range of time around the present searched for a trip's scheduled service date
+const tripSearchRangeSeconds = 60 * 60 * 8
+
 // tripCache keeping trips that are currently in service or near to service loaded
 type tripCache struct {
-	lastLoadedTrips        time.Time
+	mu                     sync.Mutex
 	loadTripsEveryDuration time.Duration
 	relevantTripDuration   time.Duration
+	//queryTimeout is the longest any single database query loading trips may take
+	queryTimeout time.Duration
 	//keys are tripIds, holds true values for every trip that is relevant
 	requiredTripMap map[string]bool
-	loadedTrips     map[string]*gtfs.TripInstance
+	//dataSetId of the gtfs.DataSet active when the scheduled trips were last loaded, zero if not yet loaded
+	dataSetId int64
+	instances *tripInstanceLRU
+	//compactor shares shapes and ids between the cached trips, all loaded from one database
+	compactor *gtfs.TripCompactor
 }
 
-// makeTripCache generates new tripCache
-func makeTripCache(now time.Time) *tripCache {
+// makeTripCache generates new tripCache holding up to tripCacheSize trip instances, sharing up to tripCacheSize shapes
+// between them
+func makeTripCache(tripCacheSize int, queryTimeout time.Duration) *tripCache {
 	return &tripCache{
-		lastLoadedTrips:        now.Add(-1 * time.Hour),
 		loadTripsEveryDuration: 5 * time.Minute,
 		relevantTripDuration:   time.Hour,
+		queryTimeout:           queryTimeout,
 		requiredTripMap:        make(map[string]bool),
-		loadedTrips:            make(map[string]*gtfs.TripInstance),
+		instances:              makeTripInstanceLRU(tripCacheSize),
+		compactor:              gtfs.NewTripCompactor(tripCacheSize),
+	}
+}
+
+// runTripPreloader loads trips scheduled in the near future into tripCache every loadTripsEveryDuration so
+// they are available before vehicles begin serving them, finding trips scheduled after clk.Now()
+func runTripPreloader(ctx context.Context,
+	log *log.Logger,
+	wg *sync.WaitGroup,
+	db *sqlx.DB,
+	cache *tripCache,
+	clk clock.Clock,
+	shutdownSignal chan bool) {
+	wg.Add(1)
+	defer wg.Done()
+
+	sleepChan := make(chan bool)
+	sleep := time.Duration(0) //sleep for zero seconds the first time
+
+	for {
+
+		go func() {
+			time.Sleep(sleep)
+			sleepChan <- true
+		}()
+
+		select {
+		case <-shutdownSignal:
+			log.Printf("Exiting trip preloader on shutdown signal")
+			return
+		case <-sleepChan:
+		}
+
+		sleep = cache.loadTripsEveryDuration
+		err := cache.preloadScheduledTrips(ctx, log, db, clk.Now())
+		if err != nil {
+			log.Printf("error preloading scheduled trips. error:%v\n", err)
+		}
+	}
+}
+
+// preloadScheduledTrips finds all trips scheduled from now until relevantTripDuration plus loadTripsEveryDuration
+// and loads any not already present into the cache
+func (r *tripCache) preloadScheduledTrips(ctx context.Context, log *log.Logger, db *sqlx.DB, now time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	dataSet, err := gtfs.GetDataSetAt(ctx, db, now)
+	if err != nil {
+		return err
+	}
+	// load an hours worth plus how long we wait to reload
+	loadTripsUntil := r.loadTripsEveryDuration + r.relevantTripDuration
+	scheduledTrips, err := gtfs.GetScheduledTripsByServiceDate(ctx, db, dataSet, now, now.Add(loadTripsUntil))
+	if err != nil {
+		log.Printf("error retrieving scheduled trip_ids. error:%s\n", err)
+		return err
+	}
+
+	requiredTripMap := make(map[string]bool)
+	for _, scheduled := range scheduledTrips {
+		for _, tripId := range scheduled.TripIds {
+			requiredTripMap[tripId] = true
+		}
+		err = preloadTripsOnServiceDate(ctx, log, db, dataSet.Id, scheduled, r.instances, r.compactor)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	r.requiredTripMap = requiredTripMap
+	r.dataSetId = dataSet.Id
+	r.mu.Unlock()
+
+	stats := r.instances.stats()
+	log.Printf("trip cache holds %d trips, hits:%d misses:%d evictions:%d since last preload\n",
+		stats.size, stats.hits, stats.misses, stats.evictions)
+	return nil
+}
+
+// preloadTripsOnServiceDate loads all trips in scheduled not already present in tripInstanceLRU with their shapes
+func preloadTripsOnServiceDate(ctx context.Context,
+	log *log.Logger,
+	db *sqlx.DB,
+	dataSetId int64,
+	scheduled gtfs.ScheduledTrips,
+	instances *tripInstanceLRU,
+	compactor *gtfs.TripCompactor) error {
+	serviceDate := scheduled.ServiceDate.Format("2006-01-02")
+	tripIdsNeeded := make([]string, 0)
+	for _, tripId := range scheduled.TripIds {
+		key := tripInstanceKey{dataSetId: dataSetId, tripId: tripId, serviceDate: serviceDate}
+		if !instances.contains(key) {
+			tripIdsNeeded = append(tripIdsNeeded, tripId)
+		}
+	}
+	if len(tripIdsNeeded) == 0 {
+		return nil
+	}
+
+	tripInstancesByTripId, err := gtfs.GetTripInstances(ctx, db, dataSetId, tripIdsNeeded,
+		scheduled.ServiceDate, compactor)
+	if err != nil {
+		var missingTripInstances *gtfs.MissingTripInstances
+		if !errors.As(err, &missingTripInstances) {
+			return err
+		}
+		log.Printf("%s\n", err)
+	}
+	for _, err = range gtfs.RemoveInvalidTripTopologies(tripInstancesByTripId) {
+		log.Printf("%s, trip will not be monitored\n", err)
+	}
+	missingShapeIds, err := gtfs.LoadTripInstanceShapes(ctx, db, dataSetId, tripInstancesByTripId, compactor)
+	if err != nil {
+		return err
+	}
+	if len(missingShapeIds) > 0 {
+		log.Printf("unable to find shapes %v for trips on %s\n", missingShapeIds, serviceDate)
 	}
+
+	for _, trip := range tripInstancesByTripId {
+		instances.add(trip)
+	}
+	log.Printf("preloaded %d of %d trips scheduled on %s\n", len(tripInstancesByTripId), len(tripIdsNeeded),
+		serviceDate)
+	return nil
 }
 
 // loadRelevantTrips finds all trips that are scheduled in the near future or are currently present in
 // vehiclePositions slice
-func (r *tripCache) loadRelevantTrips(
+func (r *tripCache) loadRelevantTrips(ctx context.Context,
 	log *log.Logger,
 	db *sqlx.DB,
 	now time.Time,
-	vehiclePositions []vehiclePosition) (map[string]*gtfs.TripInstance, error) {
-	//Only load scheduled trips every so often
-	if now.After(r.lastLoadedTrips.Add(r.loadTripsEveryDuration)) {
-		// load an hours worth plus how long we wait to reload
-		loadTripsUntil := r.loadTripsEveryDuration + r.relevantTripDuration
-		requiredTripMap, err := gtfs.GetScheduledTripIds(db, now, now, now.Add(loadTripsUntil))
+	vehiclePositions []vehiclemonitor.Position) (map[string]*gtfs.TripInstance, error) {
+	r.mu.Lock()
+	dataSetId := r.dataSetId
+	scheduledTripMap := r.requiredTripMap
+	r.mu.Unlock()
+
+	//scheduled trips haven't been loaded by the preloader yet, load them now
+	if dataSetId == 0 {
+		err := r.preloadScheduledTrips(ctx, log, db, now)
 		if err != nil {
-			log.Printf("error retrieving scheduled trip_ids. error:%s\n", err)
 			return nil, err
 		}
-		r.requiredTripMap = requiredTripMap
-		r.lastLoadedTrips = now
+		r.mu.Lock()
+		dataSetId = r.dataSetId
+		scheduledTripMap = r.requiredTripMap
+		r.mu.Unlock()
 	}
 
-	requiredTripMap := addVehiclePositionTripIds(r.requiredTripMap, vehiclePositions)
+	requiredTripMap := addVehiclePositionTripIds(scheduledTripMap, vehiclePositions)
 
-	loadedTrips, err := collectRequiredTrips(log, db, requiredTripMap, time.Now(), r.loadedTrips)
-	if err != nil {
-		return nil, err
+	ctx, cancel := context.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	requiredTrips, err := collectRequiredTrips(ctx, log, db, dataSetId, requiredTripMap, now, r.instances,
+		r.compactor)
+	r.useNewerDataSet(requiredTrips)
+	return requiredTrips, err
+}
+
+// useNewerDataSet replaces dataSetId with the data set of trips when it's newer. Trips missing from the cache are
+// loaded from the data set active now, so once a new data set is activated its trips are found in the cache
+// without waiting for the next preload
+func (r *tripCache) useNewerDataSet(trips map[string]*gtfs.TripInstance) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, trip := range trips {
+		if trip.DataSetId > r.dataSetId {
+			r.dataSetId = trip.DataSetId
+		}
 	}
-	r.loadedTrips = loadedTrips
-	return r.loadedTrips, nil
 }
 
 // addVehiclePositionTripIds combine trips from tripIdMap and vehiclePositions into new map
-func addVehiclePositionTripIds(tripIdMap map[string]bool, vehiclePositions []vehiclePosition) map[string]bool {
+func addVehiclePositionTripIds(tripIdMap map[string]bool, vehiclePositions []vehiclemonitor.Position) map[string]bool {
 	result := make(map[string]bool)
 	for k, v := range tripIdMap {
 		result[k] = v
@@ -74,30 +230,25 @@ func addVehiclePositionTripIds(tripIdMap map[string]bool, vehiclePositions []veh
 }
 
 //collectRequiredTrips loads all trips that are required for processing list of vehiclePositions and returns as a map by tripId
-//only trips not present in loadedTripInstances are retrieved
-//any trips in loadedTripInstances that are no longer needed will not be included in the return map.
-func collectRequiredTrips(log *log.Logger,
+//only trips not present in the tripInstanceLRU for dataSetId are retrieved, compacted by compactor and added to it
+func collectRequiredTrips(ctx context.Context,
+	log *log.Logger,
 	db *sqlx.DB,
+	dataSetId int64,
 	currentTripIdMap map[string]bool,
 	now time.Time,
-	loadedTripInstancesByTripId map[string]*gtfs.TripInstance) (map[string]*gtfs.TripInstance, error) {
+	instances *tripInstanceLRU,
+	compactor *gtfs.TripCompactor) (map[string]*gtfs.TripInstance, error) {
 
 	requiredTrips := make(map[string]*gtfs.TripInstance)
 	tripIdsNeeded := make([]string, 0)
-	uniqTripIdsNeeded := make(map[string]bool)
 
 	for tripId := range currentTripIdMap {
-
-		if trip, present := loadedTripInstancesByTripId[tripId]; present {
+		if trip, present := instances.get(dataSetId, tripId, now, tripSearchRangeSeconds*time.Second); present {
 			requiredTrips[tripId] = trip
 		} else {
-			//only add to list if not already present
-			if _, present = uniqTripIdsNeeded[tripId]; !present {
-				uniqTripIdsNeeded[tripId] = true
-				tripIdsNeeded = append(tripIdsNeeded, tripId)
-			}
+			tripIdsNeeded = append(tripIdsNeeded, tripId)
 		}
-
 	}
 
 	log.Printf("%d trips loaded, need %d new trips\n", len(requiredTrips), len(tripIdsNeeded))
@@ -105,19 +256,27 @@ func collectRequiredTrips(log *log.Logger,
 		return requiredTrips, nil
 	}
 
-	startTime, endTime := gtfs.GetStartEndTimeToSearchSchedule(now, 60*60*8)
-	tripInstancesByTripId, err := gtfs.GetTripInstances(db, now, startTime, endTime, tripIdsNeeded)
+	startTime, endTime := gtfs.GetStartEndTimeToSearchSchedule(now, tripSearchRangeSeconds)
+	tripInstancesByTripId, err := gtfs.GetTripInstancesBetween(ctx, db, now, startTime, endTime, tripIdsNeeded,
+		compactor)
 	if err != nil {
-		if errors.Is(err, &gtfs.MissingTripInstances{}) {
-			log.Printf("%s\n", err)
+		// trips that could not be found are logged, the remaining trips can still be used
+		var missingTripInstances *gtfs.MissingTripInstances
+		if !errors.As(err, &missingTripInstances) {
+			return requiredTrips, err
 		}
-		return requiredTrips, err
+		log.Printf("%s\n", err)
+	}
+	// trips whose stops can't be followed by stop_sequence are left out, like missing trips
+	for _, err = range gtfs.RemoveInvalidTripTopologies(tripInstancesByTripId) {
+		log.Printf("%s, trip will not be monitored\n", err)
 	}
 	log.Printf("loaded of %d of %d new trips\n", len(tripInstancesByTripId), len(tripIdsNeeded))
 
-	// add all the trips loaded into the requiredTrips result
+	// add all the trips loaded into the requiredTrips result and the cache
 	for _, trip := range tripInstancesByTripId {
 		requiredTrips[trip.TripId] = trip
+		instances.add(trip)
 	}
 
 	return requiredTrips, nil
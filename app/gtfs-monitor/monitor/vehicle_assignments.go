@@ -0,0 +1,96 @@
+package monitor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
+	"sync"
+	"time"
+)
+
+// AssignmentConf controls the stream of gtfs.VehicleAssignments published on the vehicle-assignments subject
+type AssignmentConf struct {
+	//Publish turns on the stream
+	Publish bool
+	//RefreshSeconds is how often a vehicle's assignment is published again, with its latest LastSeen, while it stays
+	//on the same trip
+	RefreshSeconds int
+}
+
+// trackedAssignment is a vehicle's current gtfs.VehicleAssignment and when it was last published
+type trackedAssignment struct {
+	assignment  gtfs.VehicleAssignment
+	publishedAt time.Time
+}
+
+// assignmentTracker follows the trip each vehicle is on, deciding when its gtfs.VehicleAssignment is published: when
+// the vehicle is first placed on a trip and every refresh while it stays on it. A nil assignmentTracker publishes
+// nothing. Safe for concurrent use by the position workers
+type assignmentTracker struct {
+	mu          sync.Mutex
+	refresh     time.Duration
+	expireAfter time.Duration
+	assignments map[string]*trackedAssignment
+}
+
+// makeAssignmentTracker returns an assignmentTracker for conf forgetting vehicles not seen for expirePositionSeconds,
+// or nil when conf doesn't publish assignments
+func makeAssignmentTracker(conf AssignmentConf, expirePositionSeconds int) *assignmentTracker {
+	if !conf.Publish {
+		return nil
+	}
+	return &assignmentTracker{
+		refresh:     time.Duration(conf.RefreshSeconds) * time.Second,
+		expireAfter: time.Duration(expirePositionSeconds) * time.Second,
+		assignments: make(map[string]*trackedAssignment),
+	}
+}
+
+// update records position placing its vehicle on trip, returning the vehicle's gtfs.VehicleAssignment when it's due to
+// be published, otherwise nil
+func (a *assignmentTracker) update(position vehiclemonitor.Position, trip *gtfs.TripInstance) *gtfs.VehicleAssignment {
+	if a == nil || trip == nil {
+		return nil
+	}
+	seen := time.Unix(position.Timestamp, 0)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	tracked, present := a.assignments[position.Id]
+	if !present || tracked.assignment.TripId != trip.TripId || tracked.assignment.DataSetId != trip.DataSetId {
+		tracked = &trackedAssignment{assignment: gtfs.VehicleAssignment{
+			VehicleId:  position.Id,
+			DataSetId:  trip.DataSetId,
+			TripId:     trip.TripId,
+			RouteId:    trip.RouteId,
+			BlockId:    trip.BlockId,
+			AssignedAt: seen,
+		}}
+		if len(trip.StopTimeInstances) > 0 {
+			tracked.assignment.TripStartTime = trip.StopTimeInstances[0].DepartureDateTime
+		}
+		a.assignments[position.Id] = tracked
+	} else if !seen.After(tracked.assignment.LastSeen) {
+		return nil
+	}
+	tracked.assignment.LastSeen = seen
+	if !tracked.publishedAt.IsZero() && seen.Sub(tracked.publishedAt) < a.refresh {
+		return nil
+	}
+	tracked.publishedAt = seen
+	assignment := tracked.assignment
+	return &assignment
+}
+
+// expire forgets vehicles last seen more than expireAfter before now, so they are published again as newly assigned
+// when they return
+func (a *assignmentTracker) expire(now time.Time) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for vehicleId, tracked := range a.assignments {
+		if now.Sub(tracked.assignment.LastSeen) > a.expireAfter {
+			delete(a.assignments, vehicleId)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package monitor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_assignmentTracker_update(t *testing.T) {
+	// positions are read in local time
+	at := time.Unix(time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC).Unix(), 0)
+	start := at.Add(-10 * time.Minute)
+	firstTrip := &gtfs.TripInstance{
+		Trip: gtfs.Trip{DataSetId: 1, TripId: "t1", RouteId: "100", BlockId: "b1"},
+		StopTimeInstances: []*gtfs.StopTimeInstance{
+			{DepartureDateTime: start},
+		},
+	}
+	secondTrip := &gtfs.TripInstance{Trip: gtfs.Trip{DataSetId: 1, TripId: "t2", RouteId: "100", BlockId: "b1"}}
+	tracker := makeAssignmentTracker(AssignmentConf{Publish: true, RefreshSeconds: 60}, 900)
+
+	positionAt := func(seconds int) vehiclemonitor.Position {
+		return vehiclemonitor.Position{Id: "v1", Timestamp: at.Add(time.Duration(seconds) * time.Second).Unix()}
+	}
+	steps := []struct {
+		name     string
+		position vehiclemonitor.Position
+		trip     *gtfs.TripInstance
+		want     *gtfs.VehicleAssignment
+	}{
+		{
+			name:     "first position on trip published",
+			position: positionAt(0),
+			trip:     firstTrip,
+			want: &gtfs.VehicleAssignment{VehicleId: "v1", DataSetId: 1, TripId: "t1", RouteId: "100", BlockId: "b1",
+				TripStartTime: start, AssignedAt: at, LastSeen: at},
+		},
+		{
+			name:     "same trip before refresh not published",
+			position: positionAt(30),
+			trip:     firstTrip,
+		},
+		{
+			name:     "position without trip not published",
+			position: positionAt(45),
+		},
+		{
+			name:     "same trip after refresh published with last seen",
+			position: positionAt(60),
+			trip:     firstTrip,
+			want: &gtfs.VehicleAssignment{VehicleId: "v1", DataSetId: 1, TripId: "t1", RouteId: "100", BlockId: "b1",
+				TripStartTime: start, AssignedAt: at, LastSeen: at.Add(time.Minute)},
+		},
+		{
+			name:     "older position not published",
+			position: positionAt(50),
+			trip:     firstTrip,
+		},
+		{
+			name:     "new trip published immediately",
+			position: positionAt(70),
+			trip:     secondTrip,
+			want: &gtfs.VehicleAssignment{VehicleId: "v1", DataSetId: 1, TripId: "t2", RouteId: "100", BlockId: "b1",
+				AssignedAt: at.Add(70 * time.Second), LastSeen: at.Add(70 * time.Second)},
+		},
+	}
+	for _, step := range steps {
+		got := tracker.update(step.position, step.trip)
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: update() = %+v, want %+v", step.name, got, step.want)
+		}
+	}
+
+	tracker.expire(at.Add(70*time.Second + 901*time.Second))
+	if len(tracker.assignments) != 0 {
+		t.Errorf("expire() left %d vehicles", len(tracker.assignments))
+	}
+}
+
+func Test_assignmentTracker_disabled(t *testing.T) {
+	tracker := makeAssignmentTracker(AssignmentConf{RefreshSeconds: 60}, 900)
+	trip := &gtfs.TripInstance{Trip: gtfs.Trip{TripId: "t1"}}
+	if got := tracker.update(vehiclemonitor.Position{Id: "v1", Timestamp: 1}, trip); got != nil {
+		t.Errorf("update() = %+v, want nil when assignments aren't published", got)
+	}
+	tracker.expire(time.Now())
+}
@@ -0,0 +1,141 @@
+package monitor
+
+import (
+	"expvar"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
+	"regexp"
+)
+
+// filteredVehiclePositions counts vehicle positions removed by vehicleFilter, keyed by filterReason
+var filteredVehiclePositions = expvar.NewMap("filtered_vehicle_positions")
+
+// trackedVehiclePositions counts vehicle positions passed by vehicleFilter
+var trackedVehiclePositions = expvar.NewInt("tracked_vehicle_positions")
+
+// VehicleFilterConf lists route ids and vehicle id patterns used to select the vehicles that are monitored.
+// Empty lists have no effect
+type VehicleFilterConf struct {
+	//IncludedRouteIds when present only vehicles on these route_ids are monitored
+	IncludedRouteIds []string
+	//ExcludedRouteIds vehicles on these route_ids are never monitored
+	ExcludedRouteIds []string
+	//IncludedVehicleIdPatterns when present only vehicles with an id matching one of these regular expressions
+	//are monitored
+	IncludedVehicleIdPatterns []string
+	//ExcludedVehicleIdPatterns vehicles with an id matching any of these regular expressions are never monitored
+	ExcludedVehicleIdPatterns []string
+}
+
+// filterReason describes why a vehiclemonitor.Position was removed by vehicleFilter
+type filterReason string
+
+const (
+	routeNotIncluded   filterReason = "route_not_included"
+	routeExcluded      filterReason = "route_excluded"
+	vehicleNotIncluded filterReason = "vehicle_not_included"
+	vehicleExcluded    filterReason = "vehicle_excluded"
+	notFiltered        filterReason = ""
+)
+
+// filteredMetricsTotal is the key in filteredVehiclePositions counting all filtered positions
+const filteredMetricsTotal = "total"
+
+// vehicleFilter selects vehiclePositions to be monitored according to VehicleFilterConf
+type vehicleFilter struct {
+	includedRouteIds          map[string]bool
+	excludedRouteIds          map[string]bool
+	includedVehicleIdPatterns []*regexp.Regexp
+	excludedVehicleIdPatterns []*regexp.Regexp
+}
+
+// makeVehicleFilter builds vehicleFilter from conf, returns error if any of the vehicle id patterns are not valid
+// regular expressions
+func makeVehicleFilter(conf VehicleFilterConf) (*vehicleFilter, error) {
+	includedPatterns, err := compileVehicleIdPatterns(conf.IncludedVehicleIdPatterns)
+	if err != nil {
+		return nil, err
+	}
+	excludedPatterns, err := compileVehicleIdPatterns(conf.ExcludedVehicleIdPatterns)
+	if err != nil {
+		return nil, err
+	}
+	return &vehicleFilter{
+		includedRouteIds:          makeRouteIdSet(conf.IncludedRouteIds),
+		excludedRouteIds:          makeRouteIdSet(conf.ExcludedRouteIds),
+		includedVehicleIdPatterns: includedPatterns,
+		excludedVehicleIdPatterns: excludedPatterns,
+	}, nil
+}
+
+func makeRouteIdSet(routeIds []string) map[string]bool {
+	result := make(map[string]bool)
+	for _, routeId := range routeIds {
+		result[routeId] = true
+	}
+	return result
+}
+
+func compileVehicleIdPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	result := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vehicle id pattern %q: %w", pattern, err)
+		}
+		result = append(result, compiled)
+	}
+	return result, nil
+}
+
+// reasonFiltered returns the reason position should not be monitored, or notFiltered if it should be.
+// when route ids are included positions without a route_id are removed, since they can't be shown to be on one of
+// the included routes
+func (f *vehicleFilter) reasonFiltered(position *vehiclemonitor.Position) filterReason {
+	if len(f.includedRouteIds) > 0 && (position.RouteId == nil || !f.includedRouteIds[*position.RouteId]) {
+		return routeNotIncluded
+	}
+	if position.RouteId != nil && f.excludedRouteIds[*position.RouteId] {
+		return routeExcluded
+	}
+	if len(f.includedVehicleIdPatterns) > 0 && !anyPatternMatches(f.includedVehicleIdPatterns, position.Id) {
+		return vehicleNotIncluded
+	}
+	if anyPatternMatches(f.excludedVehicleIdPatterns, position.Id) {
+		return vehicleExcluded
+	}
+	return notFiltered
+}
+
+func anyPatternMatches(patterns []*regexp.Regexp, vehicleId string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(vehicleId) {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the positions that should be monitored and counts of the positions removed by filterReason
+func (f *vehicleFilter) filter(positions []vehiclemonitor.Position) ([]vehiclemonitor.Position, map[filterReason]int) {
+	result := make([]vehiclemonitor.Position, 0, len(positions))
+	filteredCounts := make(map[filterReason]int)
+	for _, position := range positions {
+		reason := f.reasonFiltered(&position)
+		if reason == notFiltered {
+			result = append(result, position)
+		} else {
+			filteredCounts[reason]++
+		}
+	}
+	return result, filteredCounts
+}
+
+// recordFilterMetrics adds the results of a call to vehicleFilter.filter to the exported metrics
+func recordFilterMetrics(tracked int, filteredCounts map[filterReason]int) {
+	trackedVehiclePositions.Add(int64(tracked))
+	for reason, count := range filteredCounts {
+		filteredVehiclePositions.Add(string(reason), int64(count))
+		filteredVehiclePositions.Add(filteredMetricsTotal, int64(count))
+	}
+}
@@ -0,0 +1,85 @@
+package monitor
+
+import (
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
+	"reflect"
+	"testing"
+)
+
+func Test_vehicleFilter_filter(t *testing.T) {
+	positions := []vehiclemonitor.Position{
+		{Id: "101", RouteId: strPtr("90")},
+		{Id: "102", RouteId: strPtr("100")},
+		{Id: "3501", RouteId: strPtr("100")},
+		{Id: "3502"},
+	}
+	tests := []struct {
+		name           string
+		conf           VehicleFilterConf
+		wantIds        []string
+		wantFiltered   map[filterReason]int
+		wantMakeErrors bool
+	}{
+		{
+			name:         "no filters",
+			conf:         VehicleFilterConf{},
+			wantIds:      []string{"101", "102", "3501", "3502"},
+			wantFiltered: map[filterReason]int{},
+		},
+		{
+			name:         "included routes removes vehicles without route",
+			conf:         VehicleFilterConf{IncludedRouteIds: []string{"100"}},
+			wantIds:      []string{"102", "3501"},
+			wantFiltered: map[filterReason]int{routeNotIncluded: 2},
+		},
+		{
+			name:         "excluded routes",
+			conf:         VehicleFilterConf{ExcludedRouteIds: []string{"100"}},
+			wantIds:      []string{"101", "3502"},
+			wantFiltered: map[filterReason]int{routeExcluded: 2},
+		},
+		{
+			name: "vehicle id patterns",
+			conf: VehicleFilterConf{
+				IncludedVehicleIdPatterns: []string{"^35"},
+				ExcludedVehicleIdPatterns: []string{"2$"},
+			},
+			wantIds:      []string{"3501"},
+			wantFiltered: map[filterReason]int{vehicleNotIncluded: 2, vehicleExcluded: 1},
+		},
+		{
+			name:         "routes filtered before vehicle ids",
+			conf:         VehicleFilterConf{ExcludedRouteIds: []string{"90"}, ExcludedVehicleIdPatterns: []string{"^1"}},
+			wantIds:      []string{"3501", "3502"},
+			wantFiltered: map[filterReason]int{routeExcluded: 1, vehicleExcluded: 1},
+		},
+		{
+			name:           "invalid pattern",
+			conf:           VehicleFilterConf{IncludedVehicleIdPatterns: []string{"("}},
+			wantMakeErrors: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := makeVehicleFilter(tt.conf)
+			if (err != nil) != tt.wantMakeErrors {
+				t.Errorf("makeVehicleFilter() error = %v, wantMakeErrors %v", err, tt.wantMakeErrors)
+				return
+			}
+			if err != nil {
+				return
+			}
+			got, gotFiltered := filter.filter(positions)
+			gotIds := make([]string, 0)
+			for _, position := range got {
+				gotIds = append(gotIds, position.Id)
+			}
+			if !reflect.DeepEqual(gotIds, tt.wantIds) {
+				t.Errorf("filter() got ids = %v, want %v", gotIds, tt.wantIds)
+			}
+			if !reflect.DeepEqual(gotFiltered, tt.wantFiltered) {
+				t.Errorf("filter() got filtered = %v, want %v", gotFiltered, tt.wantFiltered)
+			}
+		})
+	}
+}
@@ -3,121 +3,15 @@ package monitor
 import (
 	"bytes"
 	gtfsrtproto2 "github.com/OpenTransitTools/transitcast/business/data/gtfsrtproto"
+	"github.com/OpenTransitTools/transitcast/pkg/vehiclemonitor"
 	"google.golang.org/protobuf/proto"
 	"log"
 	"net/http"
-	"strconv"
 	"time"
 )
 
-//vehiclePosition contains fields read from a GTFS-RT vehicle activity feed.
-//fields that are optional are pointers and will be nil if they were not present in the feed
-type vehiclePosition struct {
-	Id                string
-	Label             string
-	Timestamp         int64
-	TripId            *string
-	RouteId           *string
-	Latitude          *float32
-	Longitude         *float32
-	Bearing           *float32
-	VehicleStopStatus VehicleStopStatus
-	StopSequence      *uint32
-	StopId            *string
-}
-
-//positionIsSame returns true unless any position related differences are seen in other vehiclePosition
-//secondsTolerance allows for some skew in the vehiclePosition.Timestamp, due to slight variations
-//typically a few seconds, between service calls to VehiclePosition service being handled by different servers
-//which may have received the position a few seconds apart
-func (v *vehiclePosition) positionIsSame(v2 *vehiclePosition, secondsTolerance int64) bool {
-	if v == nil {
-		return v2 == nil
-	} else if v2 == nil {
-		return false
-	}
-	if v.Id != v2.Id || v.VehicleStopStatus != v2.VehicleStopStatus {
-		return false
-	}
-	if v.Timestamp-v2.Timestamp > secondsTolerance {
-		return false
-	}
-	if v.StopSequence != nil && v2.StopSequence != nil && *v.StopSequence != *v2.StopSequence {
-		return false
-	}
-	if v.Latitude != nil && v2.Latitude != nil && *v.Latitude != *v2.Latitude {
-		return false
-	}
-	if v.Longitude != nil && v2.Longitude != nil && *v.Longitude != *v2.Longitude {
-		return false
-	}
-
-	return true
-}
-
-//String implements Stringer interface for vehiclePosition
-func (v *vehiclePosition) String() string {
-	var buffer bytes.Buffer
-	buffer.WriteString("vehiclePosition{ id:")
-	buffer.WriteString(v.Id)
-	buffer.WriteString(", Label:\"")
-	buffer.WriteString(v.Label)
-	buffer.WriteString("\", TripId:")
-	if v.TripId == nil {
-		buffer.WriteString("unknown")
-	} else {
-		buffer.WriteString(*v.TripId)
-	}
-	buffer.WriteString(", previousStopSequence:")
-	if v.StopSequence == nil {
-		buffer.WriteString("unknown")
-	} else {
-		buffer.WriteString(strconv.FormatInt(int64(*v.StopSequence), 10))
-	}
-	buffer.WriteString(", StopPosition:")
-	buffer.WriteString(v.VehicleStopStatus.String())
-	buffer.WriteString(", Timestamp: ")
-	buffer.WriteString(strconv.FormatInt(v.Timestamp, 10))
-	buffer.WriteString(" }")
-	return buffer.String()
-}
-
-// VehicleStopStatus defines the possible relationship a vehicle has to a stop in GTFS
-type VehicleStopStatus int
-
-const (
-	Unknown VehicleStopStatus = -1
-	// IncomingAt indicates vehicle is just about to arrive at the stop (on a stop
-	// display, the vehicle symbol typically flashes).
-	IncomingAt VehicleStopStatus = 0
-	// StoppedAt indicates vehicle is at the stop.
-	StoppedAt VehicleStopStatus = 1
-	// InTransitTo indicates vehicle has departed a previous stop and is in transit to the next stop.
-	InTransitTo VehicleStopStatus = 2
-)
-
-// String - Stringer interface for VehicleStopStatus
-func (s *VehicleStopStatus) String() string {
-	if s == nil {
-		return "unknown"
-	}
-	switch *s {
-	case IncomingAt:
-		return "INCOMING_AT"
-	case StoppedAt:
-		return "STOPPED_AT"
-	case InTransitTo:
-		return "IN_TRANSIT_TO"
-	}
-	return "Unknown"
-}
-
-// IsUnknown convenience method to test for unknown VehicleStopStatus
-func (s *VehicleStopStatus) IsUnknown() bool {
-	return *s == Unknown
-}
-
 // retrieveBytes pulls bytes from url using simple GET request
+// responses with a status other than 200 OK are returned as fetchStatusError
 func retrieveBytes(log *log.Logger, url string) ([]byte, error) {
 
 	resp, err := http.Get(url)
@@ -130,6 +24,9 @@ func retrieveBytes(log *log.Logger, url string) ([]byte, error) {
 			log.Printf("error closing http response body. error: %v\n", innerErr)
 		}
 	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, makeFetchStatusError(resp, time.Now())
+	}
 
 	buf := new(bytes.Buffer)
 	_, err = buf.ReadFrom(resp.Body)
@@ -142,22 +39,35 @@ func retrieveBytes(log *log.Logger, url string) ([]byte, error) {
 }
 
 /*
-getVehiclePositions Retrieves gtfs-realtime vehicle positions and loads them into a non-protocol buffer object.
+parseVehiclePositions loads vehicle positions from a gtfs-realtime FeedMessage into a non-protocol buffer object.
 Any changes to the GTFS-realtime protocol or generated code can be handled here and not elsewhere in the program.
+Also returns the FeedHeader timestamp, or zero when the feed doesn't include one.
 */
-func getVehiclePositions(log *log.Logger, url string) ([]vehiclePosition, error) {
-	gtfsResponseBytes, err := retrieveBytes(log, url)
-	if err != nil {
-		return nil, err
-	}
+func parseVehiclePositions(log *log.Logger, feedBytes []byte, now time.Time) ([]vehiclemonitor.Position, int64, error) {
 	feedMessage := gtfsrtproto2.FeedMessage{}
-	err = proto.Unmarshal(gtfsResponseBytes, &feedMessage)
+	err := proto.Unmarshal(feedBytes, &feedMessage)
 	if err != nil {
 		log.Printf("Unable to unmarshal FeedMessage: %v\n", err)
-		return nil, err
+		return nil, 0, err
+	}
+	positions := feedVehiclePositions(log, &feedMessage, now)
+	return positions, feedHeaderTimestamp(&feedMessage), nil
+}
+
+// feedHeaderTimestamp returns the FeedHeader timestamp of feedMessage, or zero when it doesn't include one
+func feedHeaderTimestamp(feedMessage *gtfsrtproto2.FeedMessage) int64 {
+	if feedMessage.Header != nil && feedMessage.Header.Timestamp != nil {
+		return int64(*feedMessage.Header.Timestamp)
 	}
-	var vehiclePositions []vehiclePosition
-	now := time.Now().Unix()
+	return 0
+}
+
+// feedVehiclePositions converts the vehicle entities in feedMessage into vehiclemonitor.Position, positions without
+// a timestamp are given "now"
+func feedVehiclePositions(log *log.Logger,
+	feedMessage *gtfsrtproto2.FeedMessage,
+	now time.Time) []vehiclemonitor.Position {
+	var vehiclePositions []vehiclemonitor.Position
 	for _, entity := range feedMessage.Entity {
 		if entity.Vehicle == nil {
 			continue
@@ -168,7 +78,7 @@ func getVehiclePositions(log *log.Logger, url string) ([]vehiclePosition, error)
 			log.Printf("Vehicle entity missing vehicle identifier, %v\n", entity.Id)
 			continue
 		}
-		position := vehiclePosition{
+		position := vehiclemonitor.Position{
 			Id:                *vehicleDescriptor.Id,
 			StopSequence:      vehicle.CurrentStopSequence,
 			VehicleStopStatus: getVehicleStopStatus(vehicle.CurrentStatus),
@@ -192,7 +102,7 @@ func getVehiclePositions(log *log.Logger, url string) ([]vehiclePosition, error)
 		if vehicle.Timestamp != nil {
 			position.Timestamp = int64(*vehicle.Timestamp)
 		} else {
-			position.Timestamp = now
+			position.Timestamp = now.Unix()
 		}
 		if vehicle.StopId != nil {
 			position.StopId = vehicle.StopId
@@ -200,22 +110,22 @@ func getVehiclePositions(log *log.Logger, url string) ([]vehiclePosition, error)
 
 		vehiclePositions = append(vehiclePositions, position)
 	}
-	return vehiclePositions, nil
+	return vehiclePositions
 }
 
 // getVehicleStopStatus converts gtfs status to VehicleStopStatus
-func getVehicleStopStatus(status *gtfsrtproto2.VehiclePosition_VehicleStopStatus) VehicleStopStatus {
+func getVehicleStopStatus(status *gtfsrtproto2.VehiclePosition_VehicleStopStatus) vehiclemonitor.VehicleStopStatus {
 	if status == nil {
-		return Unknown
+		return vehiclemonitor.Unknown
 	}
 	switch *status {
 	case gtfsrtproto2.VehiclePosition_INCOMING_AT:
-		return IncomingAt
+		return vehiclemonitor.IncomingAt
 	case gtfsrtproto2.VehiclePosition_STOPPED_AT:
-		return StoppedAt
+		return vehiclemonitor.StoppedAt
 	case gtfsrtproto2.VehiclePosition_IN_TRANSIT_TO:
-		return InTransitTo
+		return vehiclemonitor.InTransitTo
 	default:
-		return Unknown
+		return vehiclemonitor.Unknown
 	}
 }
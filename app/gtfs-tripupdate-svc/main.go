@@ -3,12 +3,15 @@ package main
 import (
 	"fmt"
 	"github.com/OpenTransitTools/transitcast/app/gtfs-tripupdate-svc/tripupdate"
+	"github.com/OpenTransitTools/transitcast/foundation/database"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
 	"github.com/ardanlabs/conf"
-	"github.com/nats-io/nats.go"
+	"github.com/jmoiron/sqlx"
 	logger "log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 var build = "develop"
@@ -26,7 +29,45 @@ func run(log *logger.Logger) error {
 		conf.Version
 		Args conf.Args
 		NATS struct {
-			URL string `conf:"default:localhost"`
+			URL                       string `conf:"default:localhost"`
+			MaxReconnects             int    `conf:"default:-1,help:Reconnect attempts before giving up on a lost connection, negative values never give up"`
+			ReconnectWaitMilliseconds int    `conf:"default:500"`
+			MaxReconnectWaitSeconds   int    `conf:"default:30"`
+			ReconnectBufferBytes      int    `conf:"default:8388608"`
+			CredentialsFile           string `conf:"help:NATS user credentials file holding a user JWT and NKey seed"`
+			NKeySeedFile              string `conf:"help:File holding an NKey seed to authenticate with instead of a credentials file"`
+			RootCAFile                string `conf:"help:PEM file of certificate authorities used to verify the NATS server"`
+			CertFile                  string `conf:"help:PEM client certificate presented to the NATS server"`
+			KeyFile                   string `conf:"help:PEM key of the client certificate"`
+			Tenant                    string `conf:"help:Agency whose subjects are prefixed with <tenant>. when several agencies share NATS servers"`
+		}
+		DB struct {
+			User         string `conf:"default:postgres"`
+			Password     string `conf:"default:postgres,noprint"`
+			Host         string `conf:"default:0.0.0.0"`
+			Name         string `conf:"default:postgres"`
+			DisableTLS   bool   `conf:"default:true"`
+			SSLMode      string `conf:"help:Overrides the sslmode chosen by DisableTLS, for example verify-full"`
+			RootCertFile string `conf:"help:PEM file of certificate authorities used to verify the database server"`
+			CertFile     string `conf:"help:PEM client certificate used to authenticate with the database server"`
+			KeyFile      string `conf:"help:PEM key of the client certificate"`
+			Schema       string `conf:"help:Postgres schema holding the agency's tables when several agencies share the database"`
+			//QueryTimeoutSeconds limits how long any database query may run
+			QueryTimeoutSeconds int `conf:"default:30"`
+		}
+		Arrivals struct {
+			PerRoute        int  `conf:"default:3,help:Arrivals returned for each route at a stop when a request doesn't set limit"`
+			IncludeSchedule bool `conf:"default:false,help:Include scheduled arrivals of trips without predictions, read from the database"`
+			ScheduleMinutes int  `conf:"default:60"`
+		}
+		Feed struct {
+			Mode   string `conf:"default:delay,help:StopTimeEvents in the gtfs-rt feed carry the predicted delay or with time the predicted time and delay"`
+			NoData string `conf:"default:each,help:Stops without predictions are each NO_DATA or with first only the first of them or with omit left out"`
+		}
+		Validate struct {
+			MaxFeedAgeSeconds int `conf:"default:120,help:Age of a feed retrieved over http beyond which it is reported stale"`
+			MaxDelaySeconds   int `conf:"default:3600,help:Delay beyond which a stop time event is reported"`
+			TimeoutSeconds    int `conf:"default:30"`
 		}
 		ExpireTripUpdateSeconds int    `conf:"default:120"`
 		HttpPort                int    `conf:"default:8080"`
@@ -68,11 +109,31 @@ func run(log *logger.Logger) error {
 	}
 	log.Printf("main: Config :\n%v\n", out)
 
+	if cfg.Args.Num(0) == "validate" {
+		return validate(cfg.Args.Num(1), tripupdate.ValidateConf{
+			MaxFeedAgeSeconds: cfg.Validate.MaxFeedAgeSeconds,
+			MaxDelaySeconds:   cfg.Validate.MaxDelaySeconds,
+			TimeoutSeconds:    cfg.Validate.TimeoutSeconds,
+		})
+	}
+
 	// =========================================================================
 	// Start NATS
 
 	log.Printf("main: Connecting to NATS\n")
-	natsConnection, err := nats.Connect(cfg.NATS.URL)
+	natsConnection, err := natsclient.Connect(log, natsclient.Config{
+		URL:                  cfg.NATS.URL,
+		Name:                 "gtfs-tripupdate-svc",
+		MaxReconnects:        cfg.NATS.MaxReconnects,
+		ReconnectWait:        time.Duration(cfg.NATS.ReconnectWaitMilliseconds) * time.Millisecond,
+		MaxReconnectWait:     time.Duration(cfg.NATS.MaxReconnectWaitSeconds) * time.Second,
+		ReconnectBufferBytes: cfg.NATS.ReconnectBufferBytes,
+		CredentialsFile:      cfg.NATS.CredentialsFile,
+		NKeySeedFile:         cfg.NATS.NKeySeedFile,
+		RootCAFile:           cfg.NATS.RootCAFile,
+		CertFile:             cfg.NATS.CertFile,
+		KeyFile:              cfg.NATS.KeyFile,
+	})
 	if err != nil {
 		return fmt.Errorf("unable to establish connection to nats server: %w", err)
 	}
@@ -81,18 +142,85 @@ func run(log *logger.Logger) error {
 		natsConnection.Close()
 	}()
 
+	// =========================================================================
+	// Start Database
+
+	var db *sqlx.DB
+	if cfg.Arrivals.IncludeSchedule {
+		log.Println("main: Initializing database support")
+		db, err = database.Open(database.Config{
+			User:         cfg.DB.User,
+			Password:     cfg.DB.Password,
+			Host:         cfg.DB.Host,
+			Name:         cfg.DB.Name,
+			DisableTLS:   cfg.DB.DisableTLS,
+			SSLMode:      cfg.DB.SSLMode,
+			RootCertFile: cfg.DB.RootCertFile,
+			CertFile:     cfg.DB.CertFile,
+			KeyFile:      cfg.DB.KeyFile,
+			Schema:       cfg.DB.Schema,
+		})
+		if err != nil {
+			return fmt.Errorf("connecting to db: %w", err)
+		}
+		defer func() {
+			log.Printf("main: Database Stopping : %s", cfg.DB.Host)
+			err = db.Close()
+			if err != nil {
+				log.Printf("main: error closing database: %v", err)
+			}
+		}()
+	}
+
 	// Make a channel to listen for an interrupt or terminate signal from the OS.
 	// Use a buffered channel because the signal package requires it.
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
+	natsSubjects, err := natsclient.NewSubjects(cfg.NATS.Tenant)
+	if err != nil {
+		return err
+	}
+	feedMode, err := tripupdate.ParseFeedMode(cfg.Feed.Mode)
+	if err != nil {
+		return err
+	}
+	noDataMode, err := tripupdate.ParseNoDataMode(cfg.Feed.NoData)
+	if err != nil {
+		return err
+	}
+
 	tripupdate.StartServices(log, cfg.ExpireTripUpdateSeconds, cfg.HttpPort, natsConnection,
-		cfg.PredictionSubject, shutdown)
+		natsSubjects.Subject(cfg.PredictionSubject), db, tripupdate.ArrivalsConf{
+			PerRoute:            cfg.Arrivals.PerRoute,
+			ScheduleMinutes:     cfg.Arrivals.ScheduleMinutes,
+			QueryTimeoutSeconds: cfg.DB.QueryTimeoutSeconds,
+		}, tripupdate.FeedConf{Mode: feedMode, NoData: noDataMode}, shutdown)
 
 	return nil
 
 }
 
+// validate checks the TripUpdates feed at source, returning an error when the feed breaks the GTFS-realtime
+// specification so CI jobs fail
+func validate(source string, validateConf tripupdate.ValidateConf) error {
+	if len(source) < 1 {
+		return fmt.Errorf("expected feed url or file with command validate")
+	}
+	errors, err := tripupdate.ValidateFeed(os.Stdout, source, validateConf)
+	if err != nil {
+		return err
+	}
+	if errors > 0 {
+		return fmt.Errorf("%s has %d validation errors", source, errors)
+	}
+	return nil
+}
+
 func printUsage(confUsage string) {
 	fmt.Println(confUsage)
+	fmt.Println("commands:")
+	fmt.Println("(none): serve predicted trip updates")
+	fmt.Println("validate <url|file>: check the TripUpdates feed at <url|file> against GTFS-realtime best practices, " +
+		"exiting with an error when it breaks the specification")
 }
@@ -0,0 +1,245 @@
+package tripupdate
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	logger "log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// scheduledArrivalsRefresh is how long the scheduled arrivals retrieved for a stop are reused
+const scheduledArrivalsRefresh = time.Minute
+
+// ArrivalsConf configures the arrivals returned for a stop
+type ArrivalsConf struct {
+	//PerRoute is the number of arrivals returned for each route when a request doesn't set limit
+	PerRoute int
+	//ScheduleMinutes is how far ahead scheduled arrivals are included for trips without predictions
+	ScheduleMinutes int
+	//QueryTimeoutSeconds limits how long schedule queries may run
+	QueryTimeoutSeconds int
+}
+
+// StopArrival is a trip's predicted, or for trips without predictions scheduled, arrival at a stop
+type StopArrival struct {
+	RouteId              string    `json:"route_id"`
+	TripId               string    `json:"trip_id"`
+	VehicleId            string    `json:"vehicle_id,omitempty"`
+	StopSequence         uint32    `json:"stop_sequence"`
+	ScheduledArrivalTime time.Time `json:"scheduled_arrival_time"`
+	ArrivalTime          time.Time `json:"arrival_time"`
+	ArrivalDelay         int       `json:"arrival_delay"`
+	Predicted            bool      `json:"predicted"`
+}
+
+// JsonStopArrivalsResponse is the response to a request for the arrivals at a stop
+type JsonStopArrivalsResponse struct {
+	Timestamp uint64         `json:"timestamp"`
+	StopId    string         `json:"stop_id"`
+	Arrivals  []*StopArrival `json:"arrivals"`
+}
+
+// stopScheduleProvider provides the scheduled arrivals at a stop, or implementation for testing
+type stopScheduleProvider interface {
+	GetScheduledArrivals(ctx context.Context, stopId string, start time.Time, end time.Time) ([]*StopArrival, error)
+}
+
+// dbStopScheduleProvider uses a database connection to retrieve scheduled arrivals from the data set active at the
+// start of the period requested, each query is abandoned after queryTimeout
+type dbStopScheduleProvider struct {
+	db           *sqlx.DB
+	queryTimeout time.Duration
+}
+
+func (d *dbStopScheduleProvider) GetScheduledArrivals(ctx context.Context,
+	stopId string,
+	start time.Time,
+	end time.Time) ([]*StopArrival, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.queryTimeout)
+	defer cancel()
+	repository := gtfs.MakeDBScheduleRepository(d.db, 0)
+	dataSet, err := repository.GetActiveDataSet(ctx, start)
+	if err != nil {
+		return nil, err
+	}
+	stopTimes, err := repository.StopTimesForStop(ctx, dataSet.Id, stopId, start, end)
+	if err != nil {
+		return nil, err
+	}
+	tripIds := make([]string, 0, len(stopTimes))
+	for _, stopTime := range stopTimes {
+		tripIds = append(tripIds, stopTime.TripId)
+	}
+	routeIds, err := gtfs.GetTripRouteIds(ctx, d.db, dataSet.Id, tripIds)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*StopArrival, 0, len(stopTimes))
+	for _, stopTime := range stopTimes {
+		results = append(results, &StopArrival{
+			RouteId:              routeIds[stopTime.TripId],
+			TripId:               stopTime.TripId,
+			StopSequence:         stopTime.StopSequence,
+			ScheduledArrivalTime: stopTime.ArrivalDateTime,
+			ArrivalTime:          stopTime.ArrivalDateTime,
+		})
+	}
+	return results, nil
+}
+
+// cachedScheduledArrivals are the scheduled arrivals retrieved for a stop
+type cachedScheduledArrivals struct {
+	retrievedAt time.Time
+	arrivals    []*StopArrival
+}
+
+// stopArrivalsHandler responds with the next arrivals of each route at a stop, merging the current TripUpdates with
+// the schedule of trips that have none. A nil schedule only returns predicted arrivals
+type stopArrivalsHandler struct {
+	log                     *logger.Logger
+	updateCollection        *updateCollection
+	expireTripUpdateSeconds uint64
+	schedule                stopScheduleProvider
+	conf                    ArrivalsConf
+	mu                      sync.Mutex
+	scheduleCache           map[string]*cachedScheduledArrivals
+}
+
+// makeStopArrivalsHandler builds stopArrivalsHandler
+func makeStopArrivalsHandler(log *logger.Logger,
+	updateCollection *updateCollection,
+	expireTripUpdateSeconds int,
+	schedule stopScheduleProvider,
+	conf ArrivalsConf) *stopArrivalsHandler {
+	return &stopArrivalsHandler{
+		log:                     log,
+		updateCollection:        updateCollection,
+		expireTripUpdateSeconds: uint64(expireTripUpdateSeconds),
+		schedule:                schedule,
+		conf:                    conf,
+		scheduleCache:           make(map[string]*cachedScheduledArrivals),
+	}
+}
+
+// ServeHTTP implements stopArrivalsHandler's http.Handler interface
+func (h *stopArrivalsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stopId := mux.Vars(r)["stop_id"]
+	perRoute := h.conf.PerRoute
+	if limit := r.FormValue("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		perRoute = parsed
+	}
+	now := time.Now()
+	scheduled, err := h.scheduledArrivals(r.Context(), stopId, now)
+	if err != nil {
+		h.log.Printf("Unable to retrieve scheduled arrivals for stop %s, returning predictions only: %v", stopId, err)
+	}
+	response := &JsonStopArrivalsResponse{
+		Timestamp: uint64(now.Unix()),
+		StopId:    stopId,
+		Arrivals: mergeStopArrivals(stopId,
+			h.updateCollection.currentUpdates(uint64(now.Unix()), h.expireTripUpdateSeconds), scheduled, now, perRoute),
+	}
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		h.log.Printf("Error marshaling stop arrivals to json: error:%v\n", err)
+		http.Error(w, "Error serving request", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(jsonData)
+	if err != nil {
+		h.log.Printf("Error writing json response: %s", err)
+	}
+}
+
+// scheduledArrivals returns the arrivals at stopId scheduled within ScheduleMinutes of "now", reusing those
+// retrieved within scheduledArrivalsRefresh
+func (h *stopArrivalsHandler) scheduledArrivals(ctx context.Context,
+	stopId string,
+	now time.Time) ([]*StopArrival, error) {
+	if h.schedule == nil {
+		return nil, nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if cached, present := h.scheduleCache[stopId]; present && now.Sub(cached.retrievedAt) < scheduledArrivalsRefresh {
+		return cached.arrivals, nil
+	}
+	for cachedStopId, cached := range h.scheduleCache {
+		if now.Sub(cached.retrievedAt) >= scheduledArrivalsRefresh {
+			delete(h.scheduleCache, cachedStopId)
+		}
+	}
+	arrivals, err := h.schedule.GetScheduledArrivals(ctx, stopId, now,
+		now.Add(time.Duration(h.conf.ScheduleMinutes)*time.Minute+scheduledArrivalsRefresh))
+	if err != nil {
+		return nil, err
+	}
+	h.scheduleCache[stopId] = &cachedScheduledArrivals{retrievedAt: now, arrivals: arrivals}
+	return arrivals, nil
+}
+
+// mergeStopArrivals returns the first perRoute arrivals of each route at stopId after "now" in order of arrival.
+// Arrivals are predicted from updates, trips without an update arrive as scheduled. Canceled trips are left out
+func mergeStopArrivals(stopId string,
+	updates []*updateWrapper,
+	scheduled []*StopArrival,
+	now time.Time,
+	perRoute int) []*StopArrival {
+	arrivals := make([]*StopArrival, 0)
+	monitoredTrips := make(map[string]bool)
+	for _, update := range updates {
+		tripUpdate := update.tripUpdate
+		monitoredTrips[tripUpdate.TripId] = true
+		if tripUpdate.ScheduleRelationship == "CANCELED" {
+			continue
+		}
+		for _, stopTimeUpdate := range tripUpdate.StopTimeUpdates {
+			if stopTimeUpdate.StopId != stopId || stopTimeUpdate.PredictionSource == gtfs.NoFurtherPredictions ||
+				stopTimeUpdate.PredictedArrivalTime.Before(now) {
+				continue
+			}
+			arrivals = append(arrivals, &StopArrival{
+				RouteId:              tripUpdate.RouteId,
+				TripId:               tripUpdate.TripId,
+				VehicleId:            tripUpdate.VehicleId,
+				StopSequence:         stopTimeUpdate.StopSequence,
+				ScheduledArrivalTime: stopTimeUpdate.ScheduledArrivalTime,
+				ArrivalTime:          stopTimeUpdate.PredictedArrivalTime,
+				ArrivalDelay:         stopTimeUpdate.ArrivalDelay,
+				Predicted:            true,
+			})
+		}
+	}
+	for _, arrival := range scheduled {
+		if monitoredTrips[arrival.TripId] || arrival.ArrivalTime.Before(now) {
+			continue
+		}
+		arrivals = append(arrivals, arrival)
+	}
+	sort.SliceStable(arrivals, func(i, j int) bool {
+		return arrivals[i].ArrivalTime.Before(arrivals[j].ArrivalTime)
+	})
+	routeCounts := make(map[string]int)
+	results := make([]*StopArrival, 0)
+	for _, arrival := range arrivals {
+		if routeCounts[arrival.RouteId] >= perRoute {
+			continue
+		}
+		routeCounts[arrival.RouteId]++
+		results = append(results, arrival)
+	}
+	return results
+}
@@ -0,0 +1,64 @@
+package tripupdate
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_mergeStopArrivals(t *testing.T) {
+	now := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	makeUpdate := func(tripId string, routeId string, relationship string, stopId string, delay int) *updateWrapper {
+		scheduled := now.Add(5 * time.Minute)
+		return &updateWrapper{tripUpdate: &gtfs.TripUpdate{
+			TripId:               tripId,
+			RouteId:              routeId,
+			VehicleId:            "v" + tripId,
+			ScheduleRelationship: relationship,
+			StopTimeUpdates: []gtfs.StopTimeUpdate{
+				{
+					StopSequence:         3,
+					StopId:               stopId,
+					ScheduledArrivalTime: scheduled,
+					ArrivalDelay:         delay,
+					PredictedArrivalTime: scheduled.Add(time.Duration(delay) * time.Second),
+				},
+			},
+		}}
+	}
+	updates := []*updateWrapper{
+		makeUpdate("1", "100", "SCHEDULED", "A", 120),
+		makeUpdate("2", "100", "SCHEDULED", "A", -60),
+		makeUpdate("3", "90", "CANCELED", "A", 0),
+		makeUpdate("4", "90", "SCHEDULED", "B", 0),
+		makeUpdate("5", "20", "SCHEDULED", "A", -600),
+	}
+	scheduled := []*StopArrival{
+		{RouteId: "90", TripId: "3", StopSequence: 3, ScheduledArrivalTime: now.Add(5 * time.Minute),
+			ArrivalTime: now.Add(5 * time.Minute)},
+		{RouteId: "90", TripId: "6", StopSequence: 3, ScheduledArrivalTime: now.Add(8 * time.Minute),
+			ArrivalTime: now.Add(8 * time.Minute)},
+		{RouteId: "100", TripId: "7", StopSequence: 3, ScheduledArrivalTime: now.Add(20 * time.Minute),
+			ArrivalTime: now.Add(20 * time.Minute)},
+		{RouteId: "20", TripId: "8", StopSequence: 3, ScheduledArrivalTime: now.Add(-time.Minute),
+			ArrivalTime: now.Add(-time.Minute)},
+	}
+
+	got := mergeStopArrivals("A", updates, scheduled, now, 2)
+	want := []*StopArrival{
+		{RouteId: "100", TripId: "2", VehicleId: "v2", StopSequence: 3, ScheduledArrivalTime: now.Add(5 * time.Minute),
+			ArrivalTime: now.Add(4 * time.Minute), ArrivalDelay: -60, Predicted: true},
+		{RouteId: "100", TripId: "1", VehicleId: "v1", StopSequence: 3, ScheduledArrivalTime: now.Add(5 * time.Minute),
+			ArrivalTime: now.Add(7 * time.Minute), ArrivalDelay: 120, Predicted: true},
+		scheduled[1],
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeStopArrivals() = %+v, want %+v", got, want)
+	}
+
+	got = mergeStopArrivals("A", updates, scheduled, now, 1)
+	if len(got) != 2 || got[0].TripId != "2" || got[1].TripId != "6" {
+		t.Errorf("mergeStopArrivals() = %+v, want first arrival of routes 100 and 90", got)
+	}
+}
@@ -1,24 +1,78 @@
 package tripupdate
 
 import (
+	"fmt"
 	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
 	"github.com/OpenTransitTools/transitcast/business/data/gtfsrtproto"
 	"sync"
 	"time"
 )
 
+// FeedMode chooses what the StopTimeEvents of the gtfs-rt TripUpdates feed carry
+type FeedMode string
+
+const (
+	// FeedModeDelay StopTimeEvents carry the predicted delay alone
+	FeedModeDelay FeedMode = "delay"
+	// FeedModeTime StopTimeEvents carry the predicted time along with the delay, as trip planners such as
+	// OpenTripPlanner prefer
+	FeedModeTime FeedMode = "time"
+)
+
+// ParseFeedMode returns the FeedMode named by mode
+func ParseFeedMode(mode string) (FeedMode, error) {
+	switch FeedMode(mode) {
+	case FeedModeDelay, FeedModeTime:
+		return FeedMode(mode), nil
+	}
+	return "", fmt.Errorf("unsupported feed mode %q, expected %s or %s", mode, FeedModeDelay, FeedModeTime)
+}
+
+// NoDataMode chooses how stops the aggregator has no further predictions for appear in the gtfs-rt TripUpdates feed
+type NoDataMode string
+
+const (
+	// NoDataEach stops without predictions each have a NO_DATA StopTimeUpdate
+	NoDataEach NoDataMode = "each"
+	// NoDataFirst the first of a run of stops without predictions has a NO_DATA StopTimeUpdate, which consumers apply
+	// to the stops after it that have no StopTimeUpdate
+	NoDataFirst NoDataMode = "first"
+	// NoDataOmit stops without predictions have no StopTimeUpdate, so consumers propagate the last predicted delay to
+	// them. A TripUpdate with no predicted stops keeps its first NO_DATA StopTimeUpdate
+	NoDataOmit NoDataMode = "omit"
+)
+
+// ParseNoDataMode returns the NoDataMode named by mode
+func ParseNoDataMode(mode string) (NoDataMode, error) {
+	switch NoDataMode(mode) {
+	case NoDataEach, NoDataFirst, NoDataOmit:
+		return NoDataMode(mode), nil
+	}
+	return "", fmt.Errorf("unsupported no data mode %q, expected %s, %s or %s", mode, NoDataEach, NoDataFirst,
+		NoDataOmit)
+}
+
+// FeedConf configures how TripUpdates are encoded in the gtfs-rt feed
+type FeedConf struct {
+	Mode   FeedMode
+	NoData NoDataMode
+}
+
 // updateWrapper holds gtfs.TripUpdate and gtfsrtproto.TripUpdate that was built from it
 type updateWrapper struct {
 	tripUpdate       *gtfs.TripUpdate
 	tripUpdateProtoc *gtfsrtproto.TripUpdate
 }
 
-// makeUpdateWrapper builds updateWrapper from gtfs.TripUpdate
-func makeUpdateWrapper(tripUpdate *gtfs.TripUpdate) *updateWrapper {
+// makeUpdateWrapper builds updateWrapper from gtfs.TripUpdate, with StopTimeUpdates encoded according to feed
+func makeUpdateWrapper(tripUpdate *gtfs.TripUpdate, feed FeedConf) *updateWrapper {
 	u := updateWrapper{
 		tripUpdate: tripUpdate,
 	}
 	tripScheduleRelationship := gtfsrtproto.TripDescriptor_SCHEDULED
+	if tripUpdate.ScheduleRelationship == "CANCELED" {
+		tripScheduleRelationship = gtfsrtproto.TripDescriptor_CANCELED
+	}
 	stopScheduleRelationship := gtfsrtproto.TripUpdate_StopTimeUpdate_SCHEDULED
 	stopNoDataRelationship := gtfsrtproto.TripUpdate_StopTimeUpdate_NO_DATA
 	tripUpdateProtoc := gtfsrtproto.TripUpdate{
@@ -34,6 +88,8 @@ func makeUpdateWrapper(tripUpdate *gtfs.TripUpdate) *updateWrapper {
 		Timestamp:      &tripUpdate.Timestamp,
 	}
 	var stopTimeUpdates []*gtfsrtproto.TripUpdate_StopTimeUpdate
+	var firstNoData *gtfsrtproto.TripUpdate_StopTimeUpdate
+	previousNoData := false
 	for _, stopTimeUpdate := range tripUpdate.StopTimeUpdates {
 		//make new variables so pointers in gtfsStopUpdate doesn't end up pointing to the stopTimeUpdate
 		//that's reused by range
@@ -46,22 +102,42 @@ func makeUpdateWrapper(tripUpdate *gtfs.TripUpdate) *updateWrapper {
 
 		if stopTimeUpdate.PredictionSource == gtfs.NoFurtherPredictions {
 			gtfsStopUpdate.ScheduleRelationship = &stopNoDataRelationship
+			if firstNoData == nil {
+				firstNoData = &gtfsStopUpdate
+			}
+			omit := feed.NoData == NoDataOmit || (feed.NoData == NoDataFirst && previousNoData)
+			previousNoData = true
+			if omit {
+				continue
+			}
 		} else {
+			previousNoData = false
 			arrivalDelay := int32(stopTimeUpdate.ArrivalDelay)
 			gtfsStopUpdate.ScheduleRelationship = &stopScheduleRelationship
 			gtfsStopUpdate.Arrival = &gtfsrtproto.TripUpdate_StopTimeEvent{
 				Delay: &arrivalDelay,
 			}
+			if feed.Mode == FeedModeTime {
+				arrivalTime := stopTimeUpdate.PredictedArrivalTime.Unix()
+				gtfsStopUpdate.Arrival.Time = &arrivalTime
+			}
 			if stopTimeUpdate.DepartureDelay != nil {
-				departureDelay := int32(stopTimeUpdate.ArrivalDelay)
+				departureDelay := int32(*stopTimeUpdate.DepartureDelay)
 				gtfsStopUpdate.Departure = &gtfsrtproto.TripUpdate_StopTimeEvent{
 					Delay: &departureDelay,
 				}
+				if feed.Mode == FeedModeTime && stopTimeUpdate.PredictedDepartureTime != nil {
+					departureTime := stopTimeUpdate.PredictedDepartureTime.Unix()
+					gtfsStopUpdate.Departure.Time = &departureTime
+				}
 			}
 		}
 
 		stopTimeUpdates = append(stopTimeUpdates, &gtfsStopUpdate)
 	}
+	if len(stopTimeUpdates) == 0 && firstNoData != nil {
+		stopTimeUpdates = append(stopTimeUpdates, firstNoData)
+	}
 	tripUpdateProtoc.StopTimeUpdate = stopTimeUpdates
 	u.tripUpdateProtoc = &tripUpdateProtoc
 	return &u
@@ -109,6 +185,17 @@ func (c *updateCollection) updateList() []*updateWrapper {
 	return c.tripUpdates
 }
 
+// currentUpdates returns the updateWrappers that are no more than expireAfterSeconds old as of "now"
+func (c *updateCollection) currentUpdates(now uint64, expireAfterSeconds uint64) []*updateWrapper {
+	var results []*updateWrapper
+	for _, u := range c.updateList() {
+		if now-u.tripUpdate.Timestamp <= expireAfterSeconds {
+			results = append(results, u)
+		}
+	}
+	return results
+}
+
 // expireUpdates removes all updateWrappers that are older than "expireAfterSeconds".
 // returns the number of updateWrappers that have been removed and how many are currently stored.
 func (c *updateCollection) expireUpdates(at time.Time, expireAfterSeconds int) (removed int, currentSize int) {
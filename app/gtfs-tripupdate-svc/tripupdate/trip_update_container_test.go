@@ -0,0 +1,131 @@
+package tripupdate
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_makeUpdateWrapper_feedMode(t *testing.T) {
+	scheduled := time.Date(2022, 4, 15, 8, 0, 0, 0, time.UTC)
+	predictedArrival := scheduled.Add(time.Minute)
+	predictedDeparture := scheduled.Add(90 * time.Second)
+	departureDelay := 90
+	tripUpdate := &gtfs.TripUpdate{
+		TripId: "1",
+		StopTimeUpdates: []gtfs.StopTimeUpdate{
+			{
+				StopSequence:           3,
+				StopId:                 "A",
+				ArrivalDelay:           60,
+				ScheduledArrivalTime:   scheduled,
+				PredictedArrivalTime:   predictedArrival,
+				ScheduledDepartureTime: &scheduled,
+				PredictedDepartureTime: &predictedDeparture,
+				DepartureDelay:         &departureDelay,
+				PredictionSource:       gtfs.StopMLPrediction,
+			},
+		},
+	}
+	tests := []struct {
+		name          string
+		feedMode      FeedMode
+		wantArrival   int64
+		wantDeparture int64
+	}{
+		{
+			name:     "delay only",
+			feedMode: FeedModeDelay,
+		},
+		{
+			name:          "time and delay",
+			feedMode:      FeedModeTime,
+			wantArrival:   predictedArrival.Unix(),
+			wantDeparture: predictedDeparture.Unix(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapper := makeUpdateWrapper(tripUpdate, FeedConf{Mode: tt.feedMode, NoData: NoDataEach})
+			update := wrapper.tripUpdateProtoc.StopTimeUpdate[0]
+			if update.GetArrival().GetDelay() != 60 || update.GetDeparture().GetDelay() != 90 {
+				t.Errorf("makeUpdateWrapper() delays = %d, %d, want 60, 90", update.GetArrival().GetDelay(),
+					update.GetDeparture().GetDelay())
+			}
+			if update.GetArrival().GetTime() != tt.wantArrival || update.GetDeparture().GetTime() != tt.wantDeparture {
+				t.Errorf("makeUpdateWrapper() times = %d, %d, want %d, %d", update.GetArrival().GetTime(),
+					update.GetDeparture().GetTime(), tt.wantArrival, tt.wantDeparture)
+			}
+		})
+	}
+}
+
+func Test_makeUpdateWrapper_noData(t *testing.T) {
+	predicted := gtfs.StopTimeUpdate{StopSequence: 1, StopId: "A", PredictionSource: gtfs.StopMLPrediction}
+	noData := func(stopSequence uint32) gtfs.StopTimeUpdate {
+		return gtfs.StopTimeUpdate{StopSequence: stopSequence, PredictionSource: gtfs.NoFurtherPredictions}
+	}
+	tests := []struct {
+		name            string
+		stopTimeUpdates []gtfs.StopTimeUpdate
+		noData          NoDataMode
+		want            []uint32
+	}{
+		{
+			name:            "each",
+			stopTimeUpdates: []gtfs.StopTimeUpdate{predicted, noData(2), noData(3)},
+			noData:          NoDataEach,
+			want:            []uint32{1, 2, 3},
+		},
+		{
+			name:            "first",
+			stopTimeUpdates: []gtfs.StopTimeUpdate{predicted, noData(2), noData(3)},
+			noData:          NoDataFirst,
+			want:            []uint32{1, 2},
+		},
+		{
+			name:            "omit",
+			stopTimeUpdates: []gtfs.StopTimeUpdate{predicted, noData(2), noData(3)},
+			noData:          NoDataOmit,
+			want:            []uint32{1},
+		},
+		{
+			name:            "omit keeps first when nothing is predicted",
+			stopTimeUpdates: []gtfs.StopTimeUpdate{noData(2), noData(3)},
+			noData:          NoDataOmit,
+			want:            []uint32{2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tripUpdate := &gtfs.TripUpdate{TripId: "1", StopTimeUpdates: tt.stopTimeUpdates}
+			wrapper := makeUpdateWrapper(tripUpdate, FeedConf{Mode: FeedModeDelay, NoData: tt.noData})
+			var got []uint32
+			for _, update := range wrapper.tripUpdateProtoc.StopTimeUpdate {
+				got = append(got, update.GetStopSequence())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("makeUpdateWrapper() stop sequences = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFeedMode(t *testing.T) {
+	if got, err := ParseFeedMode("time"); err != nil || got != FeedModeTime {
+		t.Errorf("ParseFeedMode(time) = %v, %v, want %v", got, err, FeedModeTime)
+	}
+	if _, err := ParseFeedMode("times"); err == nil {
+		t.Errorf("ParseFeedMode(times) expected error")
+	}
+}
+
+func TestParseNoDataMode(t *testing.T) {
+	if got, err := ParseNoDataMode("first"); err != nil || got != NoDataFirst {
+		t.Errorf("ParseNoDataMode(first) = %v, %v, want %v", got, err, NoDataFirst)
+	}
+	if _, err := ParseNoDataMode("none"); err == nil {
+		t.Errorf("ParseNoDataMode(none) expected error")
+	}
+}
@@ -1,8 +1,8 @@
 package tripupdate
 
 import (
-	"encoding/json"
 	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
 	"github.com/nats-io/nats.go"
 	logger "log"
 	"os"
@@ -10,13 +10,15 @@ import (
 )
 
 //runTripUpdateListener starts NATS subscription on tripUpdatePredictionSubject for gtfs.TripUpdate messages.
-//Store results in updateCollection. Ends NATS subscription and returns on shutdownSignal
+//Store results in updateCollection and pass them to broadcaster. Ends NATS subscription and returns on shutdownSignal
 func runTripUpdateListener(
 	log *logger.Logger,
 	wg *sync.WaitGroup,
 	natsConn *nats.Conn,
 	updateCollection *updateCollection,
+	broadcaster *tripUpdateBroadcaster,
 	tripUpdatePredictionSubject string,
+	feed FeedConf,
 	shutdownSignal chan bool) {
 	wg.Add(1)
 	defer wg.Done()
@@ -33,7 +35,7 @@ func runTripUpdateListener(
 	for {
 		select {
 		case msg := <-ch:
-			processTripUpdateFromMsg(log, msg, updateCollection)
+			processTripUpdateFromMsg(log, msg, updateCollection, broadcaster, feed)
 			break
 		case <-shutdownSignal:
 			log.Printf("ending TripUpdate listener on shutdown signal\n")
@@ -47,16 +49,22 @@ func runTripUpdateListener(
 	}
 }
 
-//processTripUpdateFromMsg un-marshal gtfs.TripUpdate from nats.Msg, craete updateWrapper and store
-//result in updateCollection
-func processTripUpdateFromMsg(log *logger.Logger, msg *nats.Msg, updateCollection *updateCollection) {
+//processTripUpdateFromMsg un-marshal gtfs.TripUpdate from nats.Msg, craete updateWrapper encoded for feed and store
+//result in updateCollection. TripUpdates stored are passed to broadcaster
+func processTripUpdateFromMsg(log *logger.Logger,
+	msg *nats.Msg,
+	updateCollection *updateCollection,
+	broadcaster *tripUpdateBroadcaster,
+	feed FeedConf) {
 	var tripUpdate gtfs.TripUpdate
-	err := json.Unmarshal(msg.Data, &tripUpdate)
+	err := natsclient.Unmarshal(msg.Data, &tripUpdate)
 	if err != nil {
 		log.Printf("error parsing TripUpdate: %s, payload:%s", err, string(msg.Data))
 		return
 	}
-	newUpdate := makeUpdateWrapper(&tripUpdate)
-	updateCollection.addTripUpdate(newUpdate)
+	newUpdate := makeUpdateWrapper(&tripUpdate, feed)
+	if updateCollection.addTripUpdate(newUpdate) {
+		broadcaster.publish(&tripUpdate)
+	}
 
 }
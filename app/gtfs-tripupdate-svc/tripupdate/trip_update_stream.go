@@ -0,0 +1,210 @@
+package tripupdate
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	logger "log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// streamHeartbeatInterval is how often a comment is sent to streaming clients that have received no TripUpdates, so
+// proxies don't close idle connections
+const streamHeartbeatInterval = 15 * time.Second
+
+// streamSubscriberBuffer is the number of TripUpdates held for a streaming client that is slow to receive them,
+// TripUpdates are dropped for the client while its buffer is full
+const streamSubscriberBuffer = 64
+
+// tripUpdateFilter selects TripUpdates on any of routeIds or with a stop update at any of stopIds, an empty
+// tripUpdateFilter selects all TripUpdates
+type tripUpdateFilter struct {
+	routeIds map[string]bool
+	stopIds  map[string]bool
+}
+
+// makeTripUpdateFilter builds tripUpdateFilter from routeIds and stopIds
+func makeTripUpdateFilter(routeIds []string, stopIds []string) *tripUpdateFilter {
+	filter := &tripUpdateFilter{
+		routeIds: make(map[string]bool),
+		stopIds:  make(map[string]bool),
+	}
+	for _, routeId := range routeIds {
+		filter.routeIds[routeId] = true
+	}
+	for _, stopId := range stopIds {
+		filter.stopIds[stopId] = true
+	}
+	return filter
+}
+
+// matches returns true if tripUpdate is selected by the filter
+func (f *tripUpdateFilter) matches(tripUpdate *gtfs.TripUpdate) bool {
+	if len(f.routeIds) == 0 && len(f.stopIds) == 0 {
+		return true
+	}
+	if f.routeIds[tripUpdate.RouteId] {
+		return true
+	}
+	for _, stopTimeUpdate := range tripUpdate.StopTimeUpdates {
+		if f.stopIds[stopTimeUpdate.StopId] {
+			return true
+		}
+	}
+	return false
+}
+
+// streamSubscriber receives the TripUpdates selected by filter on updates
+type streamSubscriber struct {
+	filter  *tripUpdateFilter
+	updates chan *gtfs.TripUpdate
+	dropped int
+}
+
+// tripUpdateBroadcaster passes each TripUpdate stored to the streamSubscribers whose filter selects it
+type tripUpdateBroadcaster struct {
+	mu          sync.Mutex
+	subscribers map[*streamSubscriber]bool
+	closed      bool
+}
+
+// makeTripUpdateBroadcaster builds tripUpdateBroadcaster
+func makeTripUpdateBroadcaster() *tripUpdateBroadcaster {
+	return &tripUpdateBroadcaster{
+		subscribers: make(map[*streamSubscriber]bool),
+	}
+}
+
+// subscribe adds a streamSubscriber receiving TripUpdates selected by filter, returns nil after close
+func (b *tripUpdateBroadcaster) subscribe(filter *tripUpdateFilter) *streamSubscriber {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	subscriber := &streamSubscriber{
+		filter:  filter,
+		updates: make(chan *gtfs.TripUpdate, streamSubscriberBuffer),
+	}
+	b.subscribers[subscriber] = true
+	return subscriber
+}
+
+// unsubscribe removes subscriber, returning the number of TripUpdates dropped while its buffer was full
+func (b *tripUpdateBroadcaster) unsubscribe(subscriber *streamSubscriber) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[subscriber] {
+		delete(b.subscribers, subscriber)
+		close(subscriber.updates)
+	}
+	return subscriber.dropped
+}
+
+// publish passes tripUpdate to each subscriber whose filter selects it
+func (b *tripUpdateBroadcaster) publish(tripUpdate *gtfs.TripUpdate) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for subscriber := range b.subscribers {
+		if !subscriber.filter.matches(tripUpdate) {
+			continue
+		}
+		select {
+		case subscriber.updates <- tripUpdate:
+		default:
+			subscriber.dropped++
+		}
+	}
+}
+
+// close ends all subscriptions, so streaming responses end on shutdown
+func (b *tripUpdateBroadcaster) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for subscriber := range b.subscribers {
+		delete(b.subscribers, subscriber)
+		close(subscriber.updates)
+	}
+}
+
+// tripUpdateStreamHandler streams TripUpdates as Server-Sent Events, starting with the current TripUpdates
+type tripUpdateStreamHandler struct {
+	log                     *logger.Logger
+	updateCollection        *updateCollection
+	broadcaster             *tripUpdateBroadcaster
+	expireTripUpdateSeconds uint64
+}
+
+// ServeHTTP implements tripUpdateStreamHandler's http.Handler interface. TripUpdates are limited to the route_id and
+// stop_id query parameters, each may be repeated
+func (h *tripUpdateStreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid query", http.StatusBadRequest)
+		return
+	}
+	filter := makeTripUpdateFilter(r.Form["route_id"], r.Form["stop_id"])
+	subscriber := h.broadcaster.subscribe(filter)
+	if subscriber == nil {
+		http.Error(w, "Service is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer func() {
+		if dropped := h.broadcaster.unsubscribe(subscriber); dropped > 0 {
+			h.log.Printf("Dropped %d TripUpdates for slow streaming client %s", dropped, r.RemoteAddr)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for _, update := range h.updateCollection.currentUpdates(uint64(time.Now().Unix()), h.expireTripUpdateSeconds) {
+		if !filter.matches(update.tripUpdate) {
+			continue
+		}
+		if err := writeTripUpdateEvent(w, update.tripUpdate); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case tripUpdate, open := <-subscriber.updates:
+			if !open {
+				return
+			}
+			if err := writeTripUpdateEvent(w, tripUpdate); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeTripUpdateEvent writes tripUpdate as a trip_update event with json data
+func writeTripUpdateEvent(w http.ResponseWriter, tripUpdate *gtfs.TripUpdate) error {
+	jsonData, err := json.Marshal(tripUpdate)
+	if err != nil {
+		return fmt.Errorf("error marshaling tripUpdate to json: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "event: trip_update\ndata: %s\n\n", jsonData)
+	return err
+}
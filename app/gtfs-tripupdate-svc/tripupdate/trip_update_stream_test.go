@@ -0,0 +1,102 @@
+package tripupdate
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	logger "log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_tripUpdateFilter_matches(t *testing.T) {
+	tripUpdate := &gtfs.TripUpdate{
+		TripId:  "1",
+		RouteId: "100",
+		StopTimeUpdates: []gtfs.StopTimeUpdate{
+			{StopId: "A"},
+			{StopId: "B"},
+		},
+	}
+	tests := []struct {
+		name     string
+		routeIds []string
+		stopIds  []string
+		want     bool
+	}{
+		{
+			name: "empty filter selects all",
+			want: true,
+		},
+		{
+			name:     "matching route",
+			routeIds: []string{"90", "100"},
+			want:     true,
+		},
+		{
+			name:    "matching stop",
+			stopIds: []string{"B"},
+			want:    true,
+		},
+		{
+			name:     "other route and stop",
+			routeIds: []string{"90"},
+			stopIds:  []string{"C"},
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := makeTripUpdateFilter(tt.routeIds, tt.stopIds).matches(tripUpdate); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_tripUpdateStreamHandler_ServeHTTP(t *testing.T) {
+	now := uint64(time.Now().Unix())
+	collection := makeUpdateCollection()
+	collection.addTripUpdate(makeUpdateWrapper(&gtfs.TripUpdate{TripId: "current", RouteId: "100", Timestamp: now},
+		FeedConf{Mode: FeedModeDelay, NoData: NoDataEach}))
+	collection.addTripUpdate(makeUpdateWrapper(&gtfs.TripUpdate{TripId: "other", RouteId: "90", Timestamp: now},
+		FeedConf{Mode: FeedModeDelay, NoData: NoDataEach}))
+	broadcaster := makeTripUpdateBroadcaster()
+	handler := &tripUpdateStreamHandler{
+		log:                     logger.New(os.Stdout, "TEST : ", 0),
+		updateCollection:        collection,
+		broadcaster:             broadcaster,
+		expireTripUpdateSeconds: 120,
+	}
+
+	recorder := httptest.NewRecorder()
+	done := make(chan bool)
+	go func() {
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/stream/tripUpdates?route_id=100", nil))
+		done <- true
+	}()
+	for subscribed := false; !subscribed; {
+		broadcaster.mu.Lock()
+		subscribed = len(broadcaster.subscribers) == 1
+		broadcaster.mu.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+	broadcaster.publish(&gtfs.TripUpdate{TripId: "skipped", RouteId: "90", Timestamp: now})
+	broadcaster.publish(&gtfs.TripUpdate{TripId: "published", RouteId: "100", Timestamp: now})
+	broadcaster.close()
+	<-done
+
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Content-Type = %s, want text/event-stream", contentType)
+	}
+	body := recorder.Body.String()
+	if count := strings.Count(body, "event: trip_update\n"); count != 2 {
+		t.Errorf("body has %d trip_update events, want 2. body: %s", count, body)
+	}
+	current := strings.Index(body, `"trip_id":"current"`)
+	published := strings.Index(body, `"trip_id":"published"`)
+	if current < 0 || published < current {
+		t.Errorf("body should contain current TripUpdate followed by published TripUpdate. body: %s", body)
+	}
+}
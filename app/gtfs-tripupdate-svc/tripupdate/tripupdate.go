@@ -1,6 +1,7 @@
 package tripupdate
 
 import (
+	"github.com/jmoiron/sqlx"
 	"github.com/nats-io/nats.go"
 	logger "log"
 	"os"
@@ -8,18 +9,32 @@ import (
 	"time"
 )
 
-//StartServices brings up backgroundLoop, tripUpdateListener and webservice. Exits application on shutdown signal
+//StartServices brings up backgroundLoop, tripUpdateListener and webservice. Exits application on shutdown signal.
+//Arrivals at stops include scheduled arrivals from db for trips without predictions, a nil db only returns predictions.
+//TripUpdates are encoded in the gtfs-rt feed according to feed
 func StartServices(log *logger.Logger,
 	expireTripUpdateSeconds int,
 	httpPort int,
 	natsConn *nats.Conn,
 	tripUpdatePredictionSubject string,
+	db *sqlx.DB,
+	arrivals ArrivalsConf,
+	feed FeedConf,
 	shutdownSignal chan os.Signal) {
 
 	wg := sync.WaitGroup{}
 
+	var schedule stopScheduleProvider
+	if db != nil {
+		schedule = &dbStopScheduleProvider{
+			db:           db,
+			queryTimeout: time.Duration(arrivals.QueryTimeoutSeconds) * time.Second,
+		}
+	}
+
 	//create shared container
 	updateCollection := makeUpdateCollection()
+	broadcaster := makeTripUpdateBroadcaster()
 
 	//create shutdown channels
 	backgroundLoopShutdown := make(chan bool, 1)
@@ -28,9 +43,10 @@ func StartServices(log *logger.Logger,
 
 	//start all child services
 	go runBackgroundLoop(log, &wg, updateCollection, backgroundLoopShutdown, expireTripUpdateSeconds)
-	go runTripUpdateListener(log, &wg, natsConn, updateCollection, tripUpdatePredictionSubject,
-		tripUpdateListenerShutdown)
-	go runWebService(log, &wg, updateCollection, expireTripUpdateSeconds, httpPort, webServiceShutdown)
+	go runTripUpdateListener(log, &wg, natsConn, updateCollection, broadcaster, tripUpdatePredictionSubject,
+		feed, tripUpdateListenerShutdown)
+	go runWebService(log, &wg, updateCollection, broadcaster, expireTripUpdateSeconds, httpPort, schedule, arrivals,
+		webServiceShutdown)
 	select {
 	case <-shutdownSignal:
 		log.Printf("Exiting on shutdown signal, shutting down subroutines")
@@ -0,0 +1,90 @@
+package tripupdate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfsrtproto"
+	"github.com/OpenTransitTools/transitcast/pkg/tripupdatevalidator"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ValidateConf configures ValidateFeed
+type ValidateConf struct {
+	//MaxFeedAgeSeconds is how old a feed retrieved over http may be, saved feeds are not checked for age
+	MaxFeedAgeSeconds int
+	//MaxDelaySeconds is the largest delay expected before a warning is reported
+	MaxDelaySeconds int
+	//TimeoutSeconds limits how long retrieving a feed over http may take
+	TimeoutSeconds int
+}
+
+// ValidateFeed checks the TripUpdates feed at source, a http(s) url or a file optionally gzipped with a .gz extension,
+// against GTFS-realtime best practices, writing the issues found to w. Returns the number of issues that were errors
+func ValidateFeed(w io.Writer, source string, conf ValidateConf) (int, error) {
+	options := tripupdatevalidator.Options{MaxDelaySeconds: conf.MaxDelaySeconds}
+	var data []byte
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		options.Now = time.Now()
+		options.MaxFeedAgeSeconds = conf.MaxFeedAgeSeconds
+		data, err = fetchFeed(source, time.Duration(conf.TimeoutSeconds)*time.Second)
+	} else {
+		data, err = readFeedFile(source)
+	}
+	if err != nil {
+		return 0, err
+	}
+	feedMessage := gtfsrtproto.FeedMessage{}
+	if err = proto.Unmarshal(data, &feedMessage); err != nil {
+		return 0, fmt.Errorf("unable to unmarshal FeedMessage from %s: %w", source, err)
+	}
+	issues := tripupdatevalidator.Validate(&feedMessage, options)
+	if err = tripupdatevalidator.WriteIssues(w, issues); err != nil {
+		return 0, err
+	}
+	return tripupdatevalidator.CountErrors(issues), nil
+}
+
+// fetchFeed retrieves the body of url
+func fetchFeed(url string, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve %s: %w", url, err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to retrieve %s: status %s", url, response.Status)
+	}
+	return io.ReadAll(response.Body)
+}
+
+// readFeedFile reads the file at path, decompressing files ending in .gz
+func readFeedFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return data, nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,114 @@
+package tripupdate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"google.golang.org/protobuf/proto"
+	logger "log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// makeConformanceUpdates builds TripUpdates covering each kind of update the aggregator publishes
+func makeConformanceUpdates(now time.Time) []*gtfs.TripUpdate {
+	departureDelay := 45
+	scheduledA := now.Add(5 * time.Minute).Truncate(time.Second)
+	scheduledB := scheduledA.Add(2 * time.Minute)
+	predictedDepartureA := scheduledA.Add(45 * time.Second)
+	return []*gtfs.TripUpdate{
+		{
+			TripId:               "predicted",
+			RouteId:              "100",
+			ScheduleRelationship: "SCHEDULED",
+			Timestamp:            uint64(now.Unix()) - 5,
+			VehicleId:            "3001",
+			StopTimeUpdates: []gtfs.StopTimeUpdate{
+				{StopSequence: 4, StopId: "A", ArrivalDelay: 30, ScheduledArrivalTime: scheduledA,
+					PredictedArrivalTime: scheduledA.Add(30 * time.Second), ScheduledDepartureTime: &scheduledA,
+					PredictedDepartureTime: &predictedDepartureA, DepartureDelay: &departureDelay,
+					PredictionSource: gtfs.StopMLPrediction},
+				{StopSequence: 5, StopId: "B", ArrivalDelay: 60, ScheduledArrivalTime: scheduledB,
+					PredictedArrivalTime: scheduledB.Add(time.Minute), PredictionSource: gtfs.SchedulePrediction},
+				{StopSequence: 7, StopId: "C", PredictionSource: gtfs.NoFurtherPredictions},
+			},
+		},
+		{
+			TripId:               "canceled",
+			RouteId:              "90",
+			ScheduleRelationship: "CANCELED",
+			Timestamp:            uint64(now.Unix()),
+			VehicleId:            "3002",
+		},
+	}
+}
+
+// Test_gtfsTripUpdateHandler_conformance checks the TripUpdates feed served in each FeedMode has no validation errors
+// or warnings
+func Test_gtfsTripUpdateHandler_conformance(t *testing.T) {
+	for _, feedMode := range []FeedMode{FeedModeDelay, FeedModeTime} {
+		t.Run(string(feedMode), func(t *testing.T) {
+			collection := makeUpdateCollection()
+			for _, tripUpdate := range makeConformanceUpdates(time.Now()) {
+				collection.addTripUpdate(makeUpdateWrapper(tripUpdate, FeedConf{Mode: feedMode, NoData: NoDataEach}))
+			}
+			server := httptest.NewServer(makeGtfsTripUpdateHandler(logger.New(os.Stdout, "TEST : ", 0), collection,
+				120))
+			defer server.Close()
+
+			var output bytes.Buffer
+			errors, err := ValidateFeed(&output, server.URL, ValidateConf{
+				MaxFeedAgeSeconds: 60,
+				MaxDelaySeconds:   3600,
+				TimeoutSeconds:    5,
+			})
+			if err != nil {
+				t.Fatalf("ValidateFeed() error = %v", err)
+			}
+			if errors != 0 || output.String() != "0 errors, 0 warnings\n" {
+				t.Errorf("ValidateFeed() = %d errors, output:\n%s", errors, output.String())
+			}
+		})
+	}
+}
+
+func TestValidateFeed_file(t *testing.T) {
+	now := uint64(time.Now().Unix())
+	collection := makeUpdateCollection()
+	collection.addTripUpdate(makeUpdateWrapper(&gtfs.TripUpdate{
+		TripId:    "unordered",
+		Timestamp: now,
+		VehicleId: "3001",
+		StopTimeUpdates: []gtfs.StopTimeUpdate{
+			{StopSequence: 5, StopId: "B", PredictionSource: gtfs.StopMLPrediction},
+			{StopSequence: 4, StopId: "A", PredictionSource: gtfs.StopMLPrediction},
+		},
+	}, FeedConf{Mode: FeedModeDelay, NoData: NoDataEach}))
+	handler := makeGtfsTripUpdateHandler(logger.New(os.Stdout, "TEST : ", 0), collection, 120)
+	data, err := proto.Marshal(handler.buildFeedMessage(now))
+	if err != nil {
+		t.Fatalf("unable to marshal FeedMessage: %v", err)
+	}
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, _ = writer.Write(data)
+	_ = writer.Close()
+	path := filepath.Join(t.TempDir(), "tripupdates.pb.gz")
+	if err = os.WriteFile(path, compressed.Bytes(), 0600); err != nil {
+		t.Fatalf("unable to write feed: %v", err)
+	}
+
+	var output bytes.Buffer
+	errors, err := ValidateFeed(&output, path, ValidateConf{})
+	if err != nil {
+		t.Fatalf("ValidateFeed() error = %v", err)
+	}
+	if errors != 1 || !strings.Contains(output.String(), "stop_sequence_not_increasing") {
+		t.Errorf("ValidateFeed() = %d errors, want 1 stop_sequence_not_increasing. output:\n%s", errors,
+			output.String())
+	}
+}
@@ -16,6 +16,9 @@ import (
 	"time"
 )
 
+//responseTimeout limits how long responses other than streams may take
+const responseTimeout = 15 * time.Second
+
 //defaultHttpHandler simple default http handler for default route
 type defaultHttpHandler struct {
 }
@@ -118,15 +121,7 @@ func (t *gtfsTripUpdateHandler) serveJSON(w http.ResponseWriter) {
 
 //currentUpdates retrieves all updateWrappers that have not expired as of "now"
 func (t *gtfsTripUpdateHandler) currentUpdates(now uint64) []*updateWrapper {
-
-	allUpdates := t.updateCollection.updateList()
-	var results []*updateWrapper
-	for _, u := range allUpdates {
-		if now-u.tripUpdate.Timestamp <= t.expireTripUpdateSeconds {
-			results = append(results, u)
-		}
-	}
-	return results
+	return t.updateCollection.currentUpdates(now, t.expireTripUpdateSeconds)
 }
 
 //buildFeedMessage retrieve current tripUpdates as of "now" and build gtfsrtproto.FeedMessage from them
@@ -178,25 +173,39 @@ func makeJsonTripUpdateResponseWrapper(now uint64, updates []*updateWrapper) *Js
 	}
 }
 
-//createServer creates configured http.Server for responding to gtfs-rt tripUpdate requests
+//createServer creates configured http.Server for responding to gtfs-rt tripUpdate requests and arrivals at stops,
+//merging arrivals with schedule when it's not nil, and streaming TripUpdates passed to broadcaster
 func createServer(log *logger.Logger,
 	updateCollection *updateCollection,
+	broadcaster *tripUpdateBroadcaster,
 	expireTripUpdateSeconds int,
-	httpPort int) *http.Server {
+	httpPort int,
+	schedule stopScheduleProvider,
+	arrivals ArrivalsConf) *http.Server {
 
 	tripUpdateService := makeGtfsTripUpdateHandler(log, updateCollection, expireTripUpdateSeconds)
 
 	r := mux.NewRouter()
 	r.Handle("/", &defaultHttpHandler{})
-	r.Handle("/tripUpdate", tripUpdateService)
+	r.Handle("/tripUpdate", http.TimeoutHandler(tripUpdateService, responseTimeout, "Request timed out"))
+	r.Handle("/stops/{stop_id}/arrivals", http.TimeoutHandler(
+		makeStopArrivalsHandler(log, updateCollection, expireTripUpdateSeconds, schedule, arrivals),
+		responseTimeout, "Request timed out"))
+	r.Handle("/stream/tripUpdates", &tripUpdateStreamHandler{
+		log:                     log,
+		updateCollection:        updateCollection,
+		broadcaster:             broadcaster,
+		expireTripUpdateSeconds: uint64(expireTripUpdateSeconds),
+	})
 	srv := &http.Server{
 		Addr: strings.Join([]string{"0.0.0.0", strconv.Itoa(httpPort)}, ":"),
 		// Good practice to set timeouts to avoid Slowloris attacks.
-		WriteTimeout: time.Second * 15,
-		ReadTimeout:  time.Second * 15,
-		IdleTimeout:  time.Second * 60,
-		Handler:      r,
+		// Responses other than streams are limited by responseTimeout instead of WriteTimeout, so streams stay open
+		ReadTimeout: time.Second * 15,
+		IdleTimeout: time.Second * 60,
+		Handler:     r,
 	}
+	srv.RegisterOnShutdown(broadcaster.close)
 	return srv
 }
 
@@ -204,13 +213,16 @@ func createServer(log *logger.Logger,
 func runWebService(log *logger.Logger,
 	wg *sync.WaitGroup,
 	updateCollection *updateCollection,
+	broadcaster *tripUpdateBroadcaster,
 	expireTripUpdateSeconds int,
 	httpPort int,
+	schedule stopScheduleProvider,
+	arrivals ArrivalsConf,
 	shutdownSignal chan bool,
 ) {
 	wg.Add(1)
 	defer wg.Done()
-	srv := createServer(log, updateCollection, expireTripUpdateSeconds, httpPort)
+	srv := createServer(log, updateCollection, broadcaster, expireTripUpdateSeconds, httpPort, schedule, arrivals)
 	log.Printf("Starting server on port %d", httpPort)
 	go func() {
 		if err := srv.ListenAndServe(); err != nil {
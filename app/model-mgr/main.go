@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/OpenTransitTools/transitcast/app/model-mgr/modelmgr"
+	"github.com/OpenTransitTools/transitcast/business/data/systemevent"
 	"github.com/OpenTransitTools/transitcast/foundation/database"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
 	"github.com/ardanlabs/conf"
 	logger "log"
 	"os"
+	"strconv"
+	"time"
 )
 
 var build = "develop"
@@ -24,13 +29,52 @@ func run(log *logger.Logger) error {
 		conf.Version
 		Args conf.Args
 		DB   struct {
-			User       string `conf:"default:postgres"`
-			Password   string `conf:"default:postgres,noprint"`
-			Host       string `conf:"default:0.0.0.0"`
-			Name       string `conf:"default:postgres"`
-			DisableTLS bool   `conf:"default:true"`
+			User         string `conf:"default:postgres"`
+			Password     string `conf:"default:postgres,noprint"`
+			Host         string `conf:"default:0.0.0.0"`
+			Name         string `conf:"default:postgres"`
+			DisableTLS   bool   `conf:"default:true"`
+			SSLMode      string `conf:"help:Overrides the sslmode chosen by DisableTLS, for example verify-full"`
+			RootCertFile string `conf:"help:PEM file of certificate authorities used to verify the database server"`
+			CertFile     string `conf:"help:PEM client certificate used to authenticate with the database server"`
+			KeyFile      string `conf:"help:PEM key of the client certificate"`
+			Schema       string `conf:"help:Postgres schema holding the agency's tables when several agencies share the database"`
+		}
+		SearchScheduleDays int    `conf:"default:120"`
+		TimeBuckets        string `conf:"help:Time buckets recorded by discover for the time bucket inference feature written as name=days@HH:MM-HH:MM separated by semicolons"`
+		PatternModels      bool   `conf:"default:false,help:Discover and retrain a model of each stop pattern in each recorded time bucket alongside the stop models"`
+		TravelBound        struct {
+			HistoryDays         int     `conf:"default:28,help:Days of observations examined by tuneTolerance"`
+			Percentile          float64 `conf:"default:0.02,help:Percentile of a stop pair's travel times taken as its fastest typical travel"`
+			Margin              float64 `conf:"default:0.8,help:Multiplies the percentile travel time to give the minimum plausible travel time"`
+			MinSamples          int     `conf:"default:50,help:Observations a stop pair needs before it is given a minimum travel time"`
+			QueryTimeoutSeconds int     `conf:"default:600"`
+		}
+		StopDwell struct {
+			HistoryDays         int `conf:"default:28,help:Days of observations examined by tuneDwell"`
+			MaxDwellSeconds     int `conf:"default:300,help:Longest observed dwell included in a stop's average dwell"`
+			MinSamples          int `conf:"default:50,help:Observed dwells a stop needs before it is given an average dwell"`
+			QueryTimeoutSeconds int `conf:"default:600"`
+		}
+		Retrain struct {
+			NewObservations     int     `conf:"default:2000,help:Observations after a model's training window before retrain flags it or 0 to disable"`
+			SpacingTolerance    float64 `conf:"default:100,help:Change in shape_dist_traveled between a model's stops before retrain flags it or 0 to disable"`
+			Publish             bool    `conf:"default:false,help:Publish models flagged by retrain over NATS on model-retraining-needed"`
+			QueryTimeoutSeconds int     `conf:"default:600"`
+		}
+		NATS struct {
+			URL             string `conf:"default:localhost"`
+			CredentialsFile string `conf:"help:NATS user credentials file holding a user JWT and NKey seed"`
+			NKeySeedFile    string `conf:"help:File holding an NKey seed to authenticate with instead of a credentials file"`
+			RootCAFile      string `conf:"help:PEM file of certificate authorities used to verify the NATS server"`
+			CertFile        string `conf:"help:PEM client certificate presented to the NATS server"`
+			KeyFile         string `conf:"help:PEM key of the client certificate"`
+			Tenant          string `conf:"help:Agency whose subjects are prefixed with <tenant>. when several agencies share NATS servers"`
+		}
+		Aggregator struct {
+			MinimumObservedStopCount    int     `conf:"default:100,help:gtfs-aggregator's MinimumObservedStopCount used by status"`
+			MinimumRMSEModelImprovement float64 `conf:"default:0.0,help:gtfs-aggregator's MinimumRMSEModelImprovement used by status"`
 		}
-		SearchScheduleDays int `conf:"default:120"`
 	}
 	cfg.Version.SVN = build
 	cfg.Version.Desc = "Maintain models required by current schedule in database"
@@ -77,11 +121,16 @@ func run(log *logger.Logger) error {
 	log.Println("main: Initializing database support")
 
 	db, err := database.Open(database.Config{
-		User:       cfg.DB.User,
-		Password:   cfg.DB.Password,
-		Host:       cfg.DB.Host,
-		Name:       cfg.DB.Name,
-		DisableTLS: cfg.DB.DisableTLS,
+		User:         cfg.DB.User,
+		Password:     cfg.DB.Password,
+		Host:         cfg.DB.Host,
+		Name:         cfg.DB.Name,
+		DisableTLS:   cfg.DB.DisableTLS,
+		SSLMode:      cfg.DB.SSLMode,
+		RootCertFile: cfg.DB.RootCertFile,
+		CertFile:     cfg.DB.CertFile,
+		KeyFile:      cfg.DB.KeyFile,
+		Schema:       cfg.DB.Schema,
 	})
 	if err != nil {
 		return fmt.Errorf("connecting to db: %w", err)
@@ -96,9 +145,131 @@ func run(log *logger.Logger) error {
 
 	switch cfg.Args.Num(0) {
 	case "discover":
+		bucketsChanged, err := modelmgr.RecordTimeBuckets(log, db, cfg.TimeBuckets)
+		if err != nil {
+			return err
+		}
 		log.Printf("Discovering models")
-		err := modelmgr.DiscoverAndRecordRequiredModels(log, db, cfg.SearchScheduleDays)
-		return err
+		results, err := modelmgr.DiscoverAndRecordRequiredModels(log, db, cfg.SearchScheduleDays, cfg.PatternModels)
+		if err != nil {
+			return err
+		}
+		description := fmt.Sprintf("recorded %d new models, found %d existing models, marked %d models as not "+
+			"relevant", results.New, results.Existing, results.NotRelevant)
+		if bucketsChanged {
+			description += ", time buckets changed"
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		err = systemevent.Record(ctx, db, &systemevent.SystemEvent{
+			CreatedAt:   time.Now(),
+			App:         "model-mgr",
+			Version:     build,
+			EventType:   systemevent.ModelsDiscovered,
+			Description: description,
+		})
+		if err != nil {
+			log.Printf("main: unable to record %s in system_event: %v", systemevent.ModelsDiscovered, err)
+		}
+		return nil
+	case "tuneTolerance":
+		log.Printf("Tuning stop pair travel bounds")
+		count, err := modelmgr.TuneStopPairTravelBounds(log, db, modelmgr.TravelBoundConf{
+			HistoryDays: cfg.TravelBound.HistoryDays,
+			Percentile:  cfg.TravelBound.Percentile,
+			Margin:      cfg.TravelBound.Margin,
+			MinSamples:  cfg.TravelBound.MinSamples,
+		}, time.Duration(cfg.TravelBound.QueryTimeoutSeconds)*time.Second, time.Now())
+		if err != nil {
+			return err
+		}
+		log.Printf("Saved minimum travel times for %d stop pairs", count)
+		return nil
+	case "tuneDwell":
+		log.Printf("Tuning stop dwells")
+		count, err := modelmgr.TuneStopDwells(log, db, modelmgr.StopDwellConf{
+			HistoryDays:     cfg.StopDwell.HistoryDays,
+			MaxDwellSeconds: cfg.StopDwell.MaxDwellSeconds,
+			MinSamples:      cfg.StopDwell.MinSamples,
+		}, time.Duration(cfg.StopDwell.QueryTimeoutSeconds)*time.Second, time.Now())
+		if err != nil {
+			return err
+		}
+		log.Printf("Saved average dwells for %d stops", count)
+		return nil
+	case "health":
+		days := 7
+		if daysArg := cfg.Args.Num(1); len(daysArg) > 0 {
+			days, err = strconv.Atoi(daysArg)
+			if err != nil || days < 1 {
+				return fmt.Errorf("expected number of days with command health, found %q", daysArg)
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		now := time.Now()
+		return modelmgr.ListDisabledModels(ctx, db, now.AddDate(0, 0, -days), now)
+	case "retrain":
+		var publisher modelmgr.RetrainingPublisher
+		if cfg.Retrain.Publish {
+			natsConnection, err := natsclient.Connect(log, natsclient.Config{
+				URL:             cfg.NATS.URL,
+				Name:            "model-mgr",
+				CredentialsFile: cfg.NATS.CredentialsFile,
+				NKeySeedFile:    cfg.NATS.NKeySeedFile,
+				RootCAFile:      cfg.NATS.RootCAFile,
+				CertFile:        cfg.NATS.CertFile,
+				KeyFile:         cfg.NATS.KeyFile,
+			})
+			if err != nil {
+				return fmt.Errorf("unable to establish connection to nats server: %w", err)
+			}
+			defer func() {
+				if err := natsConnection.Drain(); err != nil {
+					log.Printf("main: error draining connection to NATS: %v", err)
+				}
+			}()
+			natsSubjects, err := natsclient.NewSubjects(cfg.NATS.Tenant)
+			if err != nil {
+				return err
+			}
+			publisher = modelmgr.MakeNatsRetrainingPublisher(natsConnection,
+				natsSubjects.Subject("model-retraining-needed"))
+		}
+		log.Printf("Flagging models for retraining")
+		results, err := modelmgr.FlagModelsForRetraining(log, db, modelmgr.RetrainConf{
+			SearchScheduleDays: cfg.SearchScheduleDays,
+			NewObservations:    cfg.Retrain.NewObservations,
+			SpacingTolerance:   cfg.Retrain.SpacingTolerance,
+			PatternModels:      cfg.PatternModels,
+		}, publisher, time.Duration(cfg.Retrain.QueryTimeoutSeconds)*time.Second, time.Now())
+		if err != nil {
+			return err
+		}
+		log.Printf("Flagged %d models with new observations and %d models with changed stop spacing for "+
+			"retraining, recorded %d stop distances", results.NewObservations, results.StopSpacingChanged,
+			results.DistancesRecorded)
+		return nil
+	case "status":
+		return modelmgr.ReportModelStatus(log, db, os.Stdout, modelmgr.StatusConf{
+			SearchScheduleDays:          cfg.SearchScheduleDays,
+			MinimumObservedStopCount:    cfg.Aggregator.MinimumObservedStopCount,
+			MinimumRMSEModelImprovement: cfg.Aggregator.MinimumRMSEModelImprovement,
+		})
+	case "export":
+		fileName := cfg.Args.Num(1)
+		if len(fileName) < 1 {
+			return fmt.Errorf("expected file name with command export")
+		}
+		log.Printf("Exporting models to %s", fileName)
+		return modelmgr.ExportModels(log, db, fileName)
+	case "import":
+		fileName := cfg.Args.Num(1)
+		if len(fileName) < 1 {
+			return fmt.Errorf("expected file name with command import")
+		}
+		log.Printf("Importing models from %s", fileName)
+		return modelmgr.ImportModels(log, db, fileName)
 	default:
 		printUsage(usage)
 		return nil
@@ -108,5 +279,18 @@ func run(log *logger.Logger) error {
 func printUsage(confUsage string) {
 	fmt.Println(confUsage)
 	fmt.Println("commands:")
-	fmt.Println("discover: examine current schedule and discover required models")
+	fmt.Println("discover: examine current schedule and discover required models, recording TimeBuckets for " +
+		"the time bucket inference feature")
+	fmt.Println("tuneTolerance: compute each stop pair's minimum plausible travel time from recent observations, " +
+		"used by gtfs-monitor in place of its early tolerance")
+	fmt.Println("tuneDwell: compute each stop's average dwell from recent observations, used by gtfs-aggregator " +
+		"to predict departures")
+	fmt.Println("health [days]: list the models gtfs-aggregator disabled in the last days (default 7) for " +
+		"predicting worse than the schedule")
+	fmt.Println("retrain: flag trained models for retraining once they receive enough new observations or the " +
+		"spacing of their stops changes")
+	fmt.Println("status: report for each route the models required, trained, observed and used by gtfs-aggregator")
+	fmt.Println("export <file>: write current trained models to a zip archive at <file>")
+	fmt.Println("import <file>: load models from a zip archive created by export, replacing current models " +
+		"with the same name")
 }
@@ -0,0 +1,265 @@
+package modelmgr
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// manifestFileName is the name of the file in a model archive describing the models it contains
+const manifestFileName = "manifest.json"
+
+// modelArchiveManifest describes the models contained in a model archive
+type modelArchiveManifest struct {
+	ExportedAt time.Time        `json:"exported_at"`
+	Models     []*archivedModel `json:"models"`
+}
+
+// archivedModel is a single mlmodels.MLModel in a model archive.
+// the model type is recorded by name since ml_model_type_id may differ between databases
+type archivedModel struct {
+	Model         *mlmodels.MLModel `json:"model"`
+	ModelTypeName string            `json:"model_type_name"`
+	//BlobFile is the name of the file in the archive containing the trained model, empty if the model has none
+	BlobFile string `json:"blob_file,omitempty"`
+	blob     []byte
+}
+
+// ExportModels writes all current trained models, with their stops and trained model blobs, to a zip archive at
+// fileName which can be loaded into another database with ImportModels
+func ExportModels(log *log.Logger, db *sqlx.DB, fileName string) error {
+	modelTypeNames, err := getModelTypeNamesById(db)
+	if err != nil {
+		return err
+	}
+	modelsByName, err := mlmodels.GetAllCurrentMLModelsByName(db, true)
+	if err != nil {
+		return fmt.Errorf("unable to load current models: %w", err)
+	}
+	manifest := modelArchiveManifest{
+		ExportedAt: time.Now(),
+		Models:     make([]*archivedModel, 0, len(modelsByName)),
+	}
+	for _, model := range modelsByName {
+		typeName, present := modelTypeNames[model.MLModelTypeId]
+		if !present {
+			return fmt.Errorf("model %s has unknown ml_model_type_id %d", model.ModelName, model.MLModelTypeId)
+		}
+		blob, err := mlmodels.GetMLModelBlob(db, model.MLModelId)
+		if err != nil {
+			return err
+		}
+		manifest.Models = append(manifest.Models, &archivedModel{
+			Model:         model,
+			ModelTypeName: typeName,
+			blob:          blob,
+		})
+	}
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("unable to create model archive %s: %w", fileName, err)
+	}
+	err = writeModelArchive(file, &manifest)
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return fmt.Errorf("unable to close model archive %s: %w", fileName, closeErr)
+	}
+	log.Printf("Exported %d models to %s\n", len(manifest.Models), fileName)
+	return nil
+}
+
+// ImportModels loads models from a zip archive created by ExportModels into db.
+// Current models with the same name have their training results and trained model replaced by the archived model,
+// models not already present are recorded as new models
+func ImportModels(log *log.Logger, db *sqlx.DB, fileName string) error {
+	manifest, err := readModelArchive(fileName)
+	if err != nil {
+		return err
+	}
+	modelTypeNames, err := getModelTypeNamesById(db)
+	if err != nil {
+		return err
+	}
+	modelTypeIds := make(map[string]int)
+	for id, name := range modelTypeNames {
+		modelTypeIds[name] = id
+	}
+	existingModelsByName, err := mlmodels.GetAllCurrentMLModelsByName(db, false)
+	if err != nil {
+		return fmt.Errorf("unable to load current models: %w", err)
+	}
+
+	updatedCount := 0
+	newCount := 0
+	for _, archived := range manifest.Models {
+		typeId, present := modelTypeIds[archived.ModelTypeName]
+		if !present {
+			return fmt.Errorf("model %s has model type %s which is not present in the database",
+				archived.Model.ModelName, archived.ModelTypeName)
+		}
+		var model *mlmodels.MLModel
+		if existing, present := existingModelsByName[archived.Model.ModelName]; present {
+			applyArchivedTraining(existing, archived.Model)
+			model, err = mlmodels.UpdateMLModel(db, existing)
+			updatedCount++
+		} else {
+			model, err = mlmodels.RecordNewMLModel(db, makeImportedModel(archived.Model, typeId))
+			newCount++
+		}
+		if err != nil {
+			return fmt.Errorf("failed to record imported model %s: %w", archived.Model.ModelName, err)
+		}
+		if archived.blob != nil {
+			err = mlmodels.UpdateMLModelBlob(db, model.MLModelId, archived.blob)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	log.Printf("Imported %d models from %s exported at %s, updated %d existing models and recorded %d new models\n",
+		len(manifest.Models), fileName, manifest.ExportedAt.Format(time.RFC3339), updatedCount, newCount)
+	return nil
+}
+
+// getModelTypeNamesById returns names of all mlmodels.MLModelType by ml_model_type_id
+func getModelTypeNamesById(db *sqlx.DB) (map[int]string, error) {
+	modelTypes, err := mlmodels.GetMLModelTypes(db)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int]string)
+	for _, modelType := range modelTypes {
+		result[modelType.MLModelTypeId] = modelType.Name
+	}
+	return result, nil
+}
+
+// applyArchivedTraining copies the results of training from archived onto existing
+func applyArchivedTraining(existing *mlmodels.MLModel, archived *mlmodels.MLModel) {
+	existing.Version = archived.Version
+	existing.TrainFlag = archived.TrainFlag
+	existing.TrainedTimestamp = archived.TrainedTimestamp
+	existing.AvgRMSE = archived.AvgRMSE
+	existing.MLRMSE = archived.MLRMSE
+	existing.FeatureTrainedStartTimestamp = archived.FeatureTrainedStartTimestamp
+	existing.FeatureTrainedEndTimestamp = archived.FeatureTrainedEndTimestamp
+	existing.LastTrainAttemptTimestamp = archived.LastTrainAttemptTimestamp
+	existing.ObservedStopCount = archived.ObservedStopCount
+	existing.Median = archived.Median
+	existing.Average = archived.Average
+}
+
+// makeImportedModel copies archived into a new mlmodels.MLModel with typeId, without database ids so it can be
+// recorded as a new model
+func makeImportedModel(archived *mlmodels.MLModel, typeId int) *mlmodels.MLModel {
+	model := *archived
+	model.MLModelId = 0
+	model.MLModelTypeId = typeId
+	model.ModelStops = make([]*mlmodels.MLModelStop, 0, len(archived.ModelStops))
+	for _, stop := range archived.ModelStops {
+		modelStop := mlmodels.MakeMLModelStop(stop.Sequence, stop.StopId, stop.NextStopId)
+		modelStop.Distance = stop.Distance
+		model.ModelStops = append(model.ModelStops, modelStop)
+	}
+	return &model
+}
+
+// writeModelArchive writes manifest and the trained model blobs of its models as a zip archive to w
+func writeModelArchive(w io.Writer, manifest *modelArchiveManifest) error {
+	archive := zip.NewWriter(w)
+	for i, model := range manifest.Models {
+		if model.blob == nil {
+			continue
+		}
+		model.BlobFile = fmt.Sprintf("blobs/%d.bin", i)
+		blobWriter, err := archive.Create(model.BlobFile)
+		if err != nil {
+			return fmt.Errorf("unable to add %s to model archive: %w", model.BlobFile, err)
+		}
+		_, err = blobWriter.Write(model.blob)
+		if err != nil {
+			return fmt.Errorf("unable to write %s to model archive: %w", model.BlobFile, err)
+		}
+	}
+	manifestWriter, err := archive.Create(manifestFileName)
+	if err != nil {
+		return fmt.Errorf("unable to add manifest to model archive: %w", err)
+	}
+	encoder := json.NewEncoder(manifestWriter)
+	encoder.SetIndent("", " ")
+	err = encoder.Encode(manifest)
+	if err != nil {
+		return fmt.Errorf("unable to write manifest to model archive: %w", err)
+	}
+	return archive.Close()
+}
+
+// readModelArchive reads the manifest and trained model blobs from a zip archive created by writeModelArchive
+func readModelArchive(fileName string) (*modelArchiveManifest, error) {
+	archive, err := zip.OpenReader(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open model archive %s: %w", fileName, err)
+	}
+	defer func() {
+		_ = archive.Close()
+	}()
+
+	files := make(map[string]*zip.File)
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+	manifestFile, present := files[manifestFileName]
+	if !present {
+		return nil, fmt.Errorf("model archive %s is missing %s", fileName, manifestFileName)
+	}
+	manifestBytes, err := readZipFile(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	var manifest modelArchiveManifest
+	err = json.Unmarshal(manifestBytes, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse manifest in model archive %s: %w", fileName, err)
+	}
+	for _, model := range manifest.Models {
+		if model.BlobFile == "" {
+			continue
+		}
+		blobFile, present := files[model.BlobFile]
+		if !present {
+			return nil, fmt.Errorf("model archive %s is missing %s for model %s", fileName, model.BlobFile,
+				model.Model.ModelName)
+		}
+		model.blob, err = readZipFile(blobFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &manifest, nil
+}
+
+// readZipFile returns the contents of file
+func readZipFile(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s in model archive: %w", file.Name, err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s in model archive: %w", file.Name, err)
+	}
+	return contents, nil
+}
@@ -0,0 +1,109 @@
+package modelmgr
+
+import (
+	"bytes"
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_modelArchiveRoundTrip(t *testing.T) {
+	trainedAt := time.Date(2022, 5, 22, 3, 0, 0, 0, time.UTC)
+	average := 95.5
+	trained := mlmodels.MLModel{
+		MLModelId:        12,
+		Version:          3,
+		StartTimestamp:   time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndTimestamp:     time.Date(3000, 12, 31, 23, 29, 59, 0, time.UTC),
+		MLModelTypeId:    1,
+		TrainedTimestamp: &trainedAt,
+		AvgRMSE:          20.1,
+		MLRMSE:           15.3,
+		ModelName:        "A_B_C",
+		Average:          &average,
+		ModelStops: []*mlmodels.MLModelStop{
+			{MLModelStopId: 7, MLModelId: 12, Sequence: 0, StopId: "A", NextStopId: "B"},
+			{MLModelStopId: 8, MLModelId: 12, Sequence: 1, StopId: "B", NextStopId: "C"},
+		},
+	}
+	untrained := mlmodels.MLModel{MLModelId: 13, MLModelTypeId: 2, ModelName: "C_D", TrainFlag: true}
+	manifest := modelArchiveManifest{
+		ExportedAt: time.Date(2022, 5, 23, 0, 0, 0, 0, time.UTC),
+		Models: []*archivedModel{
+			{Model: &trained, ModelTypeName: "Timepoints", blob: []byte{1, 2, 3}},
+			{Model: &untrained, ModelTypeName: "Stops"},
+		},
+	}
+
+	var buffer bytes.Buffer
+	err := writeModelArchive(&buffer, &manifest)
+	if err != nil {
+		t.Fatalf("writeModelArchive() error = %v", err)
+	}
+	fileName := filepath.Join(t.TempDir(), "models.zip")
+	err = os.WriteFile(fileName, buffer.Bytes(), 0644)
+	if err != nil {
+		t.Fatalf("unable to write archive: %v", err)
+	}
+
+	got, err := readModelArchive(fileName)
+	if err != nil {
+		t.Fatalf("readModelArchive() error = %v", err)
+	}
+	if !got.ExportedAt.Equal(manifest.ExportedAt) || len(got.Models) != 2 {
+		t.Fatalf("readModelArchive() = %+v, want %+v", got, manifest)
+	}
+	if !reflect.DeepEqual(got.Models[0].blob, []byte{1, 2, 3}) || got.Models[1].blob != nil {
+		t.Errorf("readModelArchive() blobs = %v, %v, want [1 2 3], nil", got.Models[0].blob, got.Models[1].blob)
+	}
+	if got.Models[0].ModelTypeName != "Timepoints" || got.Models[0].Model.ModelName != "A_B_C" ||
+		len(got.Models[0].Model.ModelStops) != 2 || *got.Models[0].Model.Average != average {
+		t.Errorf("readModelArchive() model = %+v, want %+v", got.Models[0].Model, trained)
+	}
+
+	imported := makeImportedModel(got.Models[0].Model, 5)
+	if imported.MLModelId != 0 || imported.MLModelTypeId != 5 {
+		t.Errorf("makeImportedModel() ids = %d, %d, want 0, 5", imported.MLModelId, imported.MLModelTypeId)
+	}
+	for i, stop := range imported.ModelStops {
+		want := mlmodels.MakeMLModelStop(i, trained.ModelStops[i].StopId, trained.ModelStops[i].NextStopId)
+		if !reflect.DeepEqual(stop, want) {
+			t.Errorf("makeImportedModel() stop %d = %+v, want %+v", i, stop, want)
+		}
+	}
+}
+
+func Test_applyArchivedTraining(t *testing.T) {
+	trainedAt := time.Date(2022, 5, 22, 3, 0, 0, 0, time.UTC)
+	existing := mlmodels.MLModel{
+		MLModelId:         40,
+		MLModelTypeId:     2,
+		ModelName:         "A_B_C",
+		TrainFlag:         true,
+		CurrentlyRelevant: true,
+	}
+	archived := mlmodels.MLModel{
+		MLModelId:        12,
+		MLModelTypeId:    1,
+		Version:          3,
+		ModelName:        "A_B_C",
+		TrainedTimestamp: &trainedAt,
+		MLRMSE:           15.3,
+	}
+	applyArchivedTraining(&existing, &archived)
+	want := mlmodels.MLModel{
+		MLModelId:         40,
+		MLModelTypeId:     2,
+		Version:           3,
+		ModelName:         "A_B_C",
+		TrainedTimestamp:  &trainedAt,
+		MLRMSE:            15.3,
+		CurrentlyRelevant: true,
+	}
+	if !reflect.DeepEqual(existing, want) {
+		t.Errorf("applyArchivedTraining() = %+v, want %+v", existing, want)
+	}
+}
@@ -1,6 +1,7 @@
 package modelmgr
 
 import (
+	"context"
 	"fmt"
 	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
 	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
@@ -29,13 +30,21 @@ func (dm *discoveredModels) containsModel(modelName string) bool {
 	return contains
 }
 
-// getUniqueTripIds retrieves all trip ids in dataset that are active during activeServiceIds
+// patternTrip is a trip_id and the trip's pattern_id, nil when the trip has none
+type patternTrip struct {
+	TripId    string  `db:"trip_id"`
+	PatternId *string `db:"pattern_id"`
+}
+
+// loadUniqueTripIds retrieves a trip for each stop pattern in dataset active during activeServiceIds. Trips sharing a
+// pattern require the same models, trips without a pattern are all retrieved
 func loadUniqueTripIds(db *sqlx.DB,
 	dataSet *gtfs.DataSet,
-	activeServiceIds []string) ([]string, error) {
+	activeServiceIds []string) ([]patternTrip, error) {
 
-	var tripIds []string
-	query := "select trip_id from trip where data_set_id = ? and service_id in (?)"
+	var tripIds []patternTrip
+	query := "select distinct on (coalesce(pattern_id, trip_id)) trip_id, pattern_id from trip " +
+		"where data_set_id = ? and service_id in (?) order by coalesce(pattern_id, trip_id), trip_id"
 	query, args, err := sqlx.In(query, dataSet.Id, activeServiceIds)
 	if err != nil {
 		return nil, fmt.Errorf("unable to convert query. query:%s error: %w", query, err)
@@ -105,10 +114,11 @@ func markModelsNotRelevant(db *sqlx.DB, models map[string]*mlmodels.MLModel) (in
 }
 
 // discoverCurrentModels looks through days of service for all trips in current dataset
-// and returns discoveredModels containing all models needed
-func discoverCurrentModels(db *sqlx.DB, days int) (*discoveredModels, error) {
+// and returns discoveredModels containing all models needed. When patternModels is set the models of each stop pattern
+// in each of the recorded time buckets its trips are scheduled in are included
+func discoverCurrentModels(db *sqlx.DB, days int, patternModels bool) (*discoveredModels, error) {
 	//get current dataset
-	dateSet, err := gtfs.GetLatestDataSet(db)
+	dateSet, err := gtfs.GetLatestDataSet(context.Background(), db)
 	if err != nil {
 		return nil, err
 	}
@@ -119,33 +129,105 @@ func discoverCurrentModels(db *sqlx.DB, days int) (*discoveredModels, error) {
 		return nil, err
 	}
 
-	//retrieve all active unique service ids from now to days ahead
+	//retrieve all active unique service ids from now to days ahead, with the weekdays they are active on
 	now := time.Now()
-	activeServiceIds, err := gtfs.GetActiveServiceIdsBetween(db, dateSet, now, now.AddDate(0, 0, days))
+	weekdaysByServiceId, err := gtfs.GetServiceWeekdaysBetween(context.Background(), db, dateSet, now,
+		now.AddDate(0, 0, days))
+	if err != nil {
+		return nil, err
+	}
+	activeServiceIds := make([]string, 0, len(weekdaysByServiceId))
+	for serviceId := range weekdaysByServiceId {
+		activeServiceIds = append(activeServiceIds, serviceId)
+	}
 
 	//retrieve all tripids active for those service ids
+	tripIds, err := loadUniqueTripIds(db, dateSet, activeServiceIds)
 	if err != nil {
 		return nil, err
 	}
-	tripIds, err := loadUniqueTripIds(db, dateSet, activeServiceIds)
+
+	var timeBucketsByPattern map[string][]map[int]bool
+	if patternModels {
+		timeBucketsByPattern, err = loadPatternTimeBuckets(db, dateSet, weekdaysByServiceId)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	//load all unique models for all stops on those trips
+	models, err := discoverModelsInTrips(db, dateSet, tripIds, timeBucketsByPattern, timePointModelType,
+		stopsModelTime)
 	if err != nil {
 		return nil, err
 	}
-	models, err := discoverModelsInTrips(db, dateSet, tripIds, timePointModelType, stopsModelTime)
+
+	return models, err
+}
+
+// loadPatternTimeBuckets retrieves the recorded time buckets and the schedule of each trip in dataSet, returning the
+// time buckets each stop of each stop pattern is scheduled in with patternTimeBuckets
+func loadPatternTimeBuckets(db *sqlx.DB,
+	dataSet *gtfs.DataSet,
+	weekdaysByServiceId map[string]map[time.Weekday]bool) (map[string][]map[int]bool, error) {
+	ctx := context.Background()
+	timeBuckets, err := mlmodels.GetTimeBuckets(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if len(timeBuckets) == 0 {
+		return nil, nil
+	}
+	tripPatterns, err := gtfs.GetTripStopPatterns(ctx, db, dataSet.Id)
 	if err != nil {
 		return nil, err
 	}
+	return patternTimeBuckets(tripPatterns, weekdaysByServiceId, timeBuckets), nil
+}
 
-	return models, err
+// patternTimeBuckets returns the sequences of the timeBuckets each stop of each stop pattern is scheduled to be
+// arrived at in, by the stop's index on the pattern, keyed by pattern_id. Only trips in tripPatterns running on the
+// weekdays in weekdaysByServiceId are included, and stops scheduled outside every time bucket have none
+func patternTimeBuckets(tripPatterns []*gtfs.TripStopPattern,
+	weekdaysByServiceId map[string]map[time.Weekday]bool,
+	timeBuckets []*mlmodels.TimeBucket) map[string][]map[int]bool {
+	results := make(map[string][]map[int]bool)
+	for _, trip := range tripPatterns {
+		weekdays := weekdaysByServiceId[trip.ServiceId]
+		if trip.PatternId == nil || len(weekdays) == 0 {
+			continue
+		}
+		stopTimeBuckets, present := results[*trip.PatternId]
+		if !present {
+			stopTimeBuckets = make([]map[int]bool, len(trip.ArrivalTimes))
+			for i := range stopTimeBuckets {
+				stopTimeBuckets[i] = make(map[int]bool)
+			}
+			results[*trip.PatternId] = stopTimeBuckets
+		}
+		//trips on a pattern serve the same stops, so only a mismatched schedule can differ in length
+		if len(stopTimeBuckets) != len(trip.ArrivalTimes) {
+			continue
+		}
+		for weekday := range weekdays {
+			for i, arrivalTime := range trip.ArrivalTimes {
+				timeBucket := mlmodels.ScheduleTimeBucketSequence(timeBuckets, int(weekday), arrivalTime)
+				if timeBucket > 0 {
+					stopTimeBuckets[i][timeBucket] = true
+				}
+			}
+		}
+	}
+	return results
 }
 
-// discoverModelsInTrips creates models for each tripId for dataSet
+// discoverModelsInTrips creates models for each trip in tripIds for dataSet, and the models of the trip's stop pattern
+// in each of the time buckets held for the pattern in timeBucketsByPattern
 func discoverModelsInTrips(
 	db *sqlx.DB,
 	dataSet *gtfs.DataSet,
-	tripIds []string,
+	tripIds []patternTrip,
+	timeBucketsByPattern map[string][]map[int]bool,
 	timePointModelType *mlmodels.MLModelType,
 	stopsModelTime *mlmodels.MLModelType) (*discoveredModels, error) {
 
@@ -153,15 +235,19 @@ func discoverModelsInTrips(
 
 	//limit := 5
 	//count := 0
-	for _, tripId := range tripIds {
+	for _, trip := range tripIds {
 		//if count > limit {
 		//	return models, nil
 		//}
-		stopTimes, err := loadStopTimesForTrip(db, dataSet, tripId)
+		stopTimes, err := loadStopTimesForTrip(db, dataSet, trip.TripId)
 		if err != nil {
 			return nil, fmt.Errorf("while discovering models error: %w", err)
 		}
 		discoverModelsOnTrip(models, stopTimes, timePointModelType, stopsModelTime)
+		if trip.PatternId != nil {
+			discoverPatternModelsOnTrip(models, stopTimes, *trip.PatternId, timeBucketsByPattern[*trip.PatternId],
+				timePointModelType, stopsModelTime)
+		}
 		//count++
 
 	}
@@ -173,22 +259,49 @@ func discoverModelsOnTrip(models *discoveredModels,
 	stopTimes []*gtfs.StopTime,
 	timePointModelType *mlmodels.MLModelType,
 	stopsModelTime *mlmodels.MLModelType) {
-	var previousStop *gtfs.StopTime
-	var currentStops []*gtfs.StopTime
-	for _, currentStopTime := range stopTimes {
-		currentStops = append(currentStops, currentStopTime)
-		if previousStop != nil {
-			addModel(models, []*gtfs.StopTime{previousStop, currentStopTime}, stopsModelTime)
-			//check if this is a timepoint
-			if currentStopTime.Timepoint == 1 {
-				//don't create model if two timepoints are adjacent
-				if len(currentStops) > 2 {
-					addModel(models, currentStops, timePointModelType)
-				}
-				currentStops = []*gtfs.StopTime{currentStopTime}
+	forEachTripSegment(stopTimes, timePointModelType, stopsModelTime,
+		func(_ int, segmentStops []*gtfs.StopTime, modelType *mlmodels.MLModelType) {
+			addModel(models, segmentStops, modelType)
+		})
+}
+
+// discoverPatternModelsOnTrip adds MLModels to discoveredModels for stopTimes on a trip on the stop pattern with
+// patternId, one for each time bucket in stopTimeBuckets the first stop of the model is scheduled in.
+// stopTimeBuckets holds the time bucket sequences of each stop by its index in stopTimes
+func discoverPatternModelsOnTrip(models *discoveredModels,
+	stopTimes []*gtfs.StopTime,
+	patternId string,
+	stopTimeBuckets []map[int]bool,
+	timePointModelType *mlmodels.MLModelType,
+	stopsModelTime *mlmodels.MLModelType) {
+	if len(stopTimeBuckets) != len(stopTimes) {
+		return
+	}
+	forEachTripSegment(stopTimes, timePointModelType, stopsModelTime,
+		func(firstStop int, segmentStops []*gtfs.StopTime, modelType *mlmodels.MLModelType) {
+			for timeBucket := range stopTimeBuckets[firstStop] {
+				addPatternModel(models, segmentStops, modelType, patternId, timeBucket)
 			}
+		})
+}
+
+// forEachTripSegment calls fn with each pair of stops in stopTimes and stopsModelTime, and with the stops between each
+// pair of timepoints that aren't adjacent and timePointModelType, along with the index of the segment's first stop
+func forEachTripSegment(stopTimes []*gtfs.StopTime,
+	timePointModelType *mlmodels.MLModelType,
+	stopsModelTime *mlmodels.MLModelType,
+	fn func(firstStop int, segmentStops []*gtfs.StopTime, modelType *mlmodels.MLModelType)) {
+	segmentStart := 0
+	for i := 1; i < len(stopTimes); i++ {
+		fn(i-1, stopTimes[i-1:i+1], stopsModelTime)
+		//check if this is a timepoint
+		if stopTimes[i].Timepoint == 1 {
+			//don't create model if two timepoints are adjacent
+			if i-segmentStart > 1 {
+				fn(segmentStart, stopTimes[segmentStart:i+1], timePointModelType)
+			}
+			segmentStart = i
 		}
-		previousStop = currentStopTime
 	}
 }
 
@@ -206,7 +319,26 @@ func addModel(models *discoveredModels, stopTimes []*gtfs.StopTime, modelType *m
 
 }
 
-// makeModel builds model with MLStopTimes for each gtfs.StopTime pair.
+// addPatternModel creates and adds the model of stopTimes on the stop pattern with patternId in timeBucket to
+// discoveredModels
+func addPatternModel(models *discoveredModels,
+	stopTimes []*gtfs.StopTime,
+	modelType *mlmodels.MLModelType,
+	patternId string,
+	timeBucket int) {
+	modelName := mlmodels.GetPatternModelName(mlmodels.GetModelNameForStops(stopTimes...), patternId, timeBucket)
+	if models.containsModel(modelName) {
+		return
+	}
+	model := makeModel(stopTimes, modelName, modelType)
+	if model != nil {
+		model.PatternId = &patternId
+		model.TimeBucket = &timeBucket
+		models.addModel(model)
+	}
+}
+
+// makeModel builds model with MLStopTimes for each gtfs.StopTime pair, with the distance between the stops.
 func makeModel(stopTimes []*gtfs.StopTime,
 	modelName string,
 	modelType *mlmodels.MLModelType) *mlmodels.MLModel {
@@ -219,8 +351,10 @@ func makeModel(stopTimes []*gtfs.StopTime,
 	var previousStopTime *gtfs.StopTime
 	for _, stopTime := range stopTimes {
 		if previousStopTime != nil {
-			model.ModelStops = append(model.ModelStops,
-				mlmodels.MakeMLModelStop(modelStopSequence, previousStopTime.StopId, stopTime.StopId))
+			modelStop := mlmodels.MakeMLModelStop(modelStopSequence, previousStopTime.StopId, stopTime.StopId)
+			distance := stopTime.ShapeDistTraveled - previousStopTime.ShapeDistTraveled
+			modelStop.Distance = &distance
+			model.ModelStops = append(model.ModelStops, modelStop)
 			modelStopSequence++
 		}
 		previousStopTime = stopTime
@@ -6,7 +6,9 @@ import (
 	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func Test_discoverModelsOnTrip(t *testing.T) {
@@ -227,6 +229,71 @@ func Test_discoverModelsOnTrip(t *testing.T) {
 	}
 }
 
+func Test_discoverPatternModelsOnTrip(t *testing.T) {
+	orangeLineTrip := getTestStopTimesFromJson("orangeLineTripSouthbound.json", t)
+	timePointModelType := &mlmodels.MLModelType{MLModelTypeId: 1, Name: "Timepoints"}
+	stopsModelType := &mlmodels.MLModelType{MLModelTypeId: 2, Name: "Stops"}
+
+	// the first stop is scheduled in time buckets 1 and 2, the rest only in 1
+	stopTimeBuckets := make([]map[int]bool, len(orangeLineTrip))
+	for i := range stopTimeBuckets {
+		stopTimeBuckets[i] = map[int]bool{1: true}
+	}
+	stopTimeBuckets[0][2] = true
+
+	models := makeDiscoveredModels()
+	discoverPatternModelsOnTrip(models, orangeLineTrip, "p1", stopTimeBuckets, timePointModelType, stopsModelType)
+	// 16 stop pairs and 4 timepoint spans in bucket 1, the two starting at the first stop also in bucket 2
+	if len(models.modelsByName) != 22 {
+		t.Errorf("expected 22 models, but instead have %d", len(models.modelsByName))
+	}
+	for _, name := range []string{"7601_9303@p1-2", "7601_9303_7627_7646@p1-2", "13715_13716_13717_13718@p1-1"} {
+		model, present := models.modelsByName[name]
+		if !present {
+			t.Errorf("didn't find model named %s", name)
+			continue
+		}
+		if model.PatternId == nil || *model.PatternId != "p1" || model.TimeBucket == nil {
+			t.Errorf("model '%s' not keyed by pattern p1", name)
+		}
+	}
+	if _, present := models.modelsByName["9303_7627@p1-2"]; present {
+		t.Errorf("found model 9303_7627@p1-2 for a stop not scheduled in time bucket 2")
+	}
+
+	mismatched := makeDiscoveredModels()
+	discoverPatternModelsOnTrip(mismatched, orangeLineTrip, "p1", stopTimeBuckets[1:], timePointModelType,
+		stopsModelType)
+	if len(mismatched.modelsByName) != 0 {
+		t.Errorf("expected no models for mismatched time buckets, but have %d", len(mismatched.modelsByName))
+	}
+}
+
+func Test_patternTimeBuckets(t *testing.T) {
+	timeBuckets, err := mlmodels.ParseTimeBuckets("am_peak=mon-fri@06:00-09:00;weekend=sat-sun")
+	if err != nil {
+		t.Fatalf("ParseTimeBuckets() error = %v", err)
+	}
+	patternId := "p1"
+	tripPatterns := []*gtfs.TripStopPattern{
+		{TripId: "weekday", ServiceId: "W", PatternId: &patternId, ArrivalTimes: []int{8 * 3600, 10 * 3600}},
+		{TripId: "weekend", ServiceId: "S", PatternId: &patternId, ArrivalTimes: []int{7 * 3600, 8 * 3600}},
+		{TripId: "inactive", ServiceId: "X", PatternId: &patternId, ArrivalTimes: []int{12 * 3600, 13 * 3600}},
+		{TripId: "no pattern", ServiceId: "W", ArrivalTimes: []int{8 * 3600, 9 * 3600}},
+	}
+	weekdaysByServiceId := map[string]map[time.Weekday]bool{
+		"W": {time.Monday: true},
+		"S": {time.Sunday: true},
+	}
+	got := patternTimeBuckets(tripPatterns, weekdaysByServiceId, timeBuckets)
+	want := map[string][]map[int]bool{
+		"p1": {{1: true, 2: true}, {2: true}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("patternTimeBuckets() = %v, want %v", got, want)
+	}
+}
+
 func getTestStopTimesFromJson(fileName string, t *testing.T) []*gtfs.StopTime {
 	var result []*gtfs.StopTime
 	file, err := os.ReadFile(filepath.Join("testdata", fileName))
@@ -0,0 +1,42 @@
+package modelmgr
+
+import (
+	"context"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/systemevent"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"os"
+	"time"
+)
+
+// ListDisabledModels displays the models gtfs-aggregator disabled from start up to end for predicting worse than the
+// schedule
+func ListDisabledModels(ctx context.Context, db *sqlx.DB, start time.Time, end time.Time) error {
+	events, err := systemevent.GetSystemEvents(ctx, db, start, end)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Models disabled from %s to %s:\n", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	return writeDisabledModels(os.Stdout, events)
+}
+
+// writeDisabledModels writes a line for each systemevent.ModelDisabled event in events, or a line saying there were
+// none
+func writeDisabledModels(w io.Writer, events []systemevent.SystemEvent) error {
+	written := 0
+	for _, event := range events {
+		if event.EventType != systemevent.ModelDisabled {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, event); err != nil {
+			return err
+		}
+		written++
+	}
+	if written == 0 {
+		_, err := fmt.Fprintln(w, "no models disabled")
+		return err
+	}
+	return nil
+}
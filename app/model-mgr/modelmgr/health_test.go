@@ -0,0 +1,54 @@
+package modelmgr
+
+import (
+	"bytes"
+	"github.com/OpenTransitTools/transitcast/business/data/systemevent"
+	"testing"
+	"time"
+)
+
+func Test_writeDisabledModels(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.Local)
+	disabled := systemevent.SystemEvent{
+		CreatedAt:   at,
+		App:         "gtfs-aggregator",
+		Version:     "1.0",
+		EventType:   systemevent.ModelDisabled,
+		Description: "disabled model 7 A_B",
+	}
+	started := systemevent.SystemEvent{
+		CreatedAt:   at,
+		App:         "gtfs-aggregator",
+		Version:     "1.0",
+		EventType:   systemevent.AppStarted,
+		Description: "started version 1.0",
+	}
+	tests := []struct {
+		name   string
+		events []systemevent.SystemEvent
+		want   string
+	}{
+		{
+			name:   "Only disabled models listed",
+			events: []systemevent.SystemEvent{started, disabled},
+			want:   disabled.String() + "\n",
+		},
+		{
+			name:   "No models disabled",
+			events: []systemevent.SystemEvent{started},
+			want:   "no models disabled\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			if err := writeDisabledModels(w, tt.events); err != nil {
+				t.Errorf("writeDisabledModels() error = %v", err)
+				return
+			}
+			if got := w.String(); got != tt.want {
+				t.Errorf("writeDisabledModels() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -7,21 +7,35 @@ import (
 	"log"
 )
 
+//DiscoveryResults counts the models recorded by DiscoverAndRecordRequiredModels
+type DiscoveryResults struct {
+	//New is the number of models recorded that were not present
+	New int
+	//Existing is the number of required models already present
+	Existing int
+	//NotRelevant is the number of models no longer required by the current dataset
+	NotRelevant int
+}
+
 //DiscoverAndRecordRequiredModels examines current dataset and discovers all models to cover service,
-//ensures there are mlmodels.MLModel rows present, and marks any existing rows as not relevant
-func DiscoverAndRecordRequiredModels(log *log.Logger, db *sqlx.DB, days int) error {
+//ensures there are mlmodels.MLModel rows present, and marks any existing rows as not relevant.
+//When patternModels is set a model is also required for each stop pattern in each time bucket its trips run in
+func DiscoverAndRecordRequiredModels(log *log.Logger,
+	db *sqlx.DB,
+	days int,
+	patternModels bool) (*DiscoveryResults, error) {
 	log.Printf("Loading all current models\n")
 	existingModelsByName, err := mlmodels.GetAllCurrentMLModelsByName(db, false)
 	if err != nil {
 		log.Printf("Unable to load existing models from database. error: %s", err)
-		return err
+		return nil, err
 	}
 	log.Printf("Found %d existing models \n", len(existingModelsByName))
 	//retrieve required models
 	log.Printf("Finding all required models for current dataset\n")
-	requiredModels, err := discoverCurrentModels(db, days)
+	requiredModels, err := discoverCurrentModels(db, days, patternModels)
 	if err != nil {
-		return fmt.Errorf("unable to discover models, error: %s", err)
+		return nil, fmt.Errorf("unable to discover models, error: %s", err)
 	}
 	log.Printf("Found %d models required by current dataset\n", len(requiredModels.modelsByName))
 
@@ -46,7 +60,7 @@ func DiscoverAndRecordRequiredModels(log *log.Logger, db *sqlx.DB, days int) err
 			if err != nil {
 				log.Printf("after recording %d models failed to record %+v. error: %s\n",
 					newModelCount, requiredModel, err)
-				return err
+				return nil, err
 			}
 			newModelCount++
 		}
@@ -58,11 +72,15 @@ func DiscoverAndRecordRequiredModels(log *log.Logger, db *sqlx.DB, days int) err
 		log.Printf("after recording %d models, updating %d old models as not relevant, "+
 			"failed to mark all irrelevant models as not relevant. error: %s\n",
 			newModelCount, markedNotRelevant, err)
-		return err
+		return nil, err
 	}
 
 	log.Printf("Recorded %d new models, found %d existing models, "+
 		"marked %d models as not relevant to current dataset\n", newModelCount, existingModelCount, markedNotRelevant)
 	log.Printf("Total models currently relevant: %d\n", newModelCount+existingModelCount)
-	return nil
+	return &DiscoveryResults{
+		New:         newModelCount,
+		Existing:    existingModelCount,
+		NotRelevant: markedNotRelevant,
+	}, nil
 }
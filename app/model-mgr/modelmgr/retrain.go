@@ -0,0 +1,238 @@
+package modelmgr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
+	"github.com/jmoiron/sqlx"
+	"github.com/nats-io/nats.go"
+	"log"
+	"math"
+	"sort"
+	"time"
+)
+
+// Reasons a model is flagged for retraining
+const (
+	RetrainNewObservations   = "new_observations"
+	RetrainStopSpacingChange = "stop_spacing_changed"
+)
+
+// RetrainConf controls when FlagModelsForRetraining flags trained models to be trained again
+type RetrainConf struct {
+	//SearchScheduleDays is the number of days of service examined for the current spacing of each model's stops
+	SearchScheduleDays int
+	//NewObservations is the number of observations a model needs after the end of its training window before it is
+	//retrained, 0 disables
+	NewObservations int
+	//SpacingTolerance is how far the schedule's distance between any of a model's stops, in shape_dist_traveled
+	//units, can change from the distance it was trained for before it is retrained, 0 disables
+	SpacingTolerance float64
+	//PatternModels includes the models of each stop pattern and time bucket discovered with discover's PatternModels
+	PatternModels bool
+}
+
+// validate returns an error describing the first value in conf that can't be used
+func (c RetrainConf) validate() error {
+	if c.NewObservations < 0 {
+		return fmt.Errorf("retrain new observations can't be negative, found %d", c.NewObservations)
+	}
+	if c.SpacingTolerance < 0 {
+		return fmt.Errorf("retrain spacing tolerance can't be negative, found %f", c.SpacingTolerance)
+	}
+	return nil
+}
+
+// RetrainingNeeded is published for each model flagged for retraining
+type RetrainingNeeded struct {
+	MLModelId int64     `json:"ml_model_id"`
+	ModelName string    `json:"model_name"`
+	Reason    string    `json:"reason"`
+	FlaggedAt time.Time `json:"flagged_at"`
+}
+
+// RetrainingPublisher publishes models flagged for retraining to the training service
+type RetrainingPublisher interface {
+	Publish(retraining RetrainingNeeded) error
+}
+
+// natsRetrainingPublisher publishes RetrainingNeeded messages as json on subject
+type natsRetrainingPublisher struct {
+	conn    *nats.Conn
+	subject string
+}
+
+// MakeNatsRetrainingPublisher builds RetrainingPublisher publishing on subject over conn
+func MakeNatsRetrainingPublisher(conn *nats.Conn, subject string) RetrainingPublisher {
+	return &natsRetrainingPublisher{conn: conn, subject: subject}
+}
+
+func (p *natsRetrainingPublisher) Publish(retraining RetrainingNeeded) error {
+	data, err := json.Marshal(retraining)
+	if err != nil {
+		return err
+	}
+	return p.conn.Publish(p.subject, data)
+}
+
+// RetrainResults counts the models flagged by FlagModelsForRetraining by reason
+type RetrainResults struct {
+	//NewObservations is the number of models flagged for receiving conf.NewObservations since they were trained
+	NewObservations int
+	//StopSpacingChanged is the number of models flagged for changes to the spacing of their stops
+	StopSpacingChanged int
+	//DistancesRecorded is the number of model stops given the schedule's distance between them
+	DistancesRecorded int
+}
+
+// FlagModelsForRetraining sets train_flag on current trained models that have received conf.NewObservations since
+// the end of the window they were trained on, or whose stops are spaced differently in the current schedule by more
+// than conf.SpacingTolerance. The spacing of models recorded before it was kept is recorded without flagging them.
+// Each model flagged is published to publisher when it isn't nil
+func FlagModelsForRetraining(log *log.Logger,
+	db *sqlx.DB,
+	conf RetrainConf,
+	publisher RetrainingPublisher,
+	queryTimeout time.Duration,
+	now time.Time) (*RetrainResults, error) {
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
+	log.Printf("Loading all current models\n")
+	models, err := mlmodels.GetAllCurrentMLModelsByName(db, false)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load current models: %w", err)
+	}
+	log.Printf("Finding the spacing of model stops in the current dataset\n")
+	required, err := discoverCurrentModels(db, conf.SearchScheduleDays, conf.PatternModels)
+	if err != nil {
+		return nil, fmt.Errorf("unable to discover models: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	newObservations := make(map[int64]int)
+	if conf.NewObservations > 0 {
+		log.Printf("Counting observations received since models were trained\n")
+		newObservations, err = mlmodels.GetNewObservationCounts(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	retraining, distanceUpdates := findModelsNeedingRetraining(models, required.modelsByName, newObservations,
+		conf, now)
+	results := &RetrainResults{DistancesRecorded: len(distanceUpdates)}
+	retrainIds := make([]int64, 0, len(retraining))
+	for _, r := range retraining {
+		retrainIds = append(retrainIds, r.MLModelId)
+		if r.Reason == RetrainNewObservations {
+			results.NewObservations++
+		} else {
+			results.StopSpacingChanged++
+		}
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = mlmodels.FlagMLModelsForTraining(ctx, tx, retrainIds)
+	for i := 0; err == nil && i < len(distanceUpdates); i++ {
+		err = mlmodels.UpdateMLModelStopDistance(ctx, tx, distanceUpdates[i])
+	}
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Printf("Received error while attempting to rollback transaction. error:%v", rollbackErr)
+		}
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if publisher != nil {
+		for _, r := range retraining {
+			if err = publisher.Publish(r); err != nil {
+				return results, fmt.Errorf("unable to publish retraining of model %d %s: %w", r.MLModelId,
+					r.ModelName, err)
+			}
+		}
+		log.Printf("Published %d models needing retraining\n", len(retraining))
+	}
+	return results, nil
+}
+
+// findModelsNeedingRetraining returns the trained models in models needing retraining, in ml_model_id order, either
+// for receiving conf.NewObservations as counted in newObservations or because their stops in required, the models
+// discovered in the current schedule, are spaced differently by more than conf.SpacingTolerance.
+// Also returns the model stops without a recorded distance, and all stops of models whose spacing changed, set to
+// their current distance
+func findModelsNeedingRetraining(models map[string]*mlmodels.MLModel,
+	required map[string]*mlmodels.MLModel,
+	newObservations map[int64]int,
+	conf RetrainConf,
+	now time.Time) ([]RetrainingNeeded, []*mlmodels.MLModelStop) {
+	var retraining []RetrainingNeeded
+	var distanceUpdates []*mlmodels.MLModelStop
+	for modelName, model := range models {
+		trained := model.TrainedTimestamp != nil && !model.TrainFlag
+		reason := ""
+		if trained && conf.NewObservations > 0 && newObservations[model.MLModelId] >= conf.NewObservations {
+			reason = RetrainNewObservations
+		}
+		requiredModel, present := required[modelName]
+		if present {
+			changed, updates := compareStopDistances(model.ModelStops, requiredModel.ModelStops,
+				conf.SpacingTolerance)
+			if changed && trained && reason == "" {
+				reason = RetrainStopSpacingChange
+			}
+			distanceUpdates = append(distanceUpdates, updates...)
+		}
+		if reason != "" {
+			retraining = append(retraining, RetrainingNeeded{
+				MLModelId: model.MLModelId,
+				ModelName: modelName,
+				Reason:    reason,
+				FlaggedAt: now,
+			})
+		}
+	}
+	sort.Slice(retraining, func(i, j int) bool {
+		return retraining[i].MLModelId < retraining[j].MLModelId
+	})
+	sort.Slice(distanceUpdates, func(i, j int) bool {
+		return distanceUpdates[i].MLModelStopId < distanceUpdates[j].MLModelStopId
+	})
+	return retraining, distanceUpdates
+}
+
+// compareStopDistances returns true when the distance between any pair of recorded stops differs from the same pair
+// in current by more than tolerance, with a tolerance of 0 never reporting a change. Recorded stops missing a
+// distance, or all recorded stops when a change is reported, are returned with their current distance
+func compareStopDistances(recorded []*mlmodels.MLModelStop,
+	current []*mlmodels.MLModelStop,
+	tolerance float64) (bool, []*mlmodels.MLModelStop) {
+	if len(recorded) != len(current) {
+		return false, nil
+	}
+	changed := false
+	for i, stop := range recorded {
+		if current[i].Distance == nil {
+			return false, nil
+		}
+		if stop.Distance != nil && tolerance > 0 && math.Abs(*stop.Distance-*current[i].Distance) > tolerance {
+			changed = true
+		}
+	}
+	var updates []*mlmodels.MLModelStop
+	for i, stop := range recorded {
+		if changed || stop.Distance == nil {
+			distance := *current[i].Distance
+			stop.Distance = &distance
+			updates = append(updates, stop)
+		}
+	}
+	return changed, updates
+}
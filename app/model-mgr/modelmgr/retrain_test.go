@@ -0,0 +1,126 @@
+package modelmgr
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_findModelsNeedingRetraining(t *testing.T) {
+	now := time.Date(2022, 5, 22, 3, 0, 0, 0, time.Local)
+	trainedAt := now.AddDate(0, 0, -30)
+	distance := func(value float64) *float64 {
+		return &value
+	}
+	// makeTestModel builds a model with id and stops A_B_C spaced by distances
+	makeTestModel := func(id int64, trained bool, distances ...*float64) *mlmodels.MLModel {
+		model := &mlmodels.MLModel{MLModelId: id, ModelName: "A_B_C", TrainFlag: !trained}
+		if trained {
+			model.TrainedTimestamp = &trainedAt
+		}
+		stops := []string{"A", "B", "C"}
+		for i, d := range distances {
+			model.ModelStops = append(model.ModelStops, &mlmodels.MLModelStop{
+				MLModelStopId: id*10 + int64(i),
+				MLModelId:     id,
+				Sequence:      i + 1,
+				StopId:        stops[i],
+				NextStopId:    stops[i+1],
+				Distance:      d,
+			})
+		}
+		return model
+	}
+	conf := RetrainConf{NewObservations: 1000, SpacingTolerance: 50}
+	tests := []struct {
+		name                string
+		model               *mlmodels.MLModel
+		required            *mlmodels.MLModel
+		newObservations     int
+		conf                RetrainConf
+		want                []RetrainingNeeded
+		wantDistanceUpdates []float64
+	}{
+		{
+			name:            "Unchanged model without enough new observations",
+			model:           makeTestModel(1, true, distance(500), distance(700)),
+			required:        makeTestModel(0, false, distance(500), distance(730)),
+			newObservations: 999,
+			conf:            conf,
+		},
+		{
+			name:            "Enough new observations",
+			model:           makeTestModel(1, true, distance(500), distance(700)),
+			required:        makeTestModel(0, false, distance(500), distance(700)),
+			newObservations: 1000,
+			conf:            conf,
+			want: []RetrainingNeeded{
+				{MLModelId: 1, ModelName: "A_B_C", Reason: RetrainNewObservations, FlaggedAt: now},
+			},
+		},
+		{
+			name:     "Stop spacing changed beyond tolerance",
+			model:    makeTestModel(1, true, distance(500), distance(700)),
+			required: makeTestModel(0, false, distance(500), distance(800)),
+			conf:     conf,
+			want: []RetrainingNeeded{
+				{MLModelId: 1, ModelName: "A_B_C", Reason: RetrainStopSpacingChange, FlaggedAt: now},
+			},
+			wantDistanceUpdates: []float64{500, 800},
+		},
+		{
+			name:                "Stop spacing changed on a model awaiting training updates distances",
+			model:               makeTestModel(1, false, distance(500), distance(700)),
+			required:            makeTestModel(0, false, distance(500), distance(800)),
+			newObservations:     5000,
+			conf:                conf,
+			wantDistanceUpdates: []float64{500, 800},
+		},
+		{
+			name:                "Missing distances recorded without retraining",
+			model:               makeTestModel(1, true, nil, distance(700)),
+			required:            makeTestModel(0, false, distance(450), distance(700)),
+			conf:                conf,
+			wantDistanceUpdates: []float64{450},
+		},
+		{
+			name:            "Disabled checks",
+			model:           makeTestModel(1, true, distance(500), distance(700)),
+			required:        makeTestModel(0, false, distance(500), distance(800)),
+			newObservations: 5000,
+			conf:            RetrainConf{},
+		},
+		{
+			name:            "Model no longer in the schedule",
+			model:           makeTestModel(1, true, distance(500), distance(700)),
+			newObservations: 1000,
+			conf:            conf,
+			want: []RetrainingNeeded{
+				{MLModelId: 1, ModelName: "A_B_C", Reason: RetrainNewObservations, FlaggedAt: now},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			models := map[string]*mlmodels.MLModel{tt.model.ModelName: tt.model}
+			required := make(map[string]*mlmodels.MLModel)
+			if tt.required != nil {
+				required[tt.required.ModelName] = tt.required
+			}
+			newObservations := map[int64]int{tt.model.MLModelId: tt.newObservations}
+			got, gotDistanceUpdates := findModelsNeedingRetraining(models, required, newObservations, tt.conf, now)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findModelsNeedingRetraining() got = %+v, want %+v", got, tt.want)
+			}
+			var gotDistances []float64
+			for _, update := range gotDistanceUpdates {
+				gotDistances = append(gotDistances, *update.Distance)
+			}
+			if !reflect.DeepEqual(gotDistances, tt.wantDistanceUpdates) {
+				t.Errorf("findModelsNeedingRetraining() gotDistanceUpdates = %v, want %v", gotDistances,
+					tt.wantDistanceUpdates)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package modelmgr
+
+import (
+	"context"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"log"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// StatusConf holds the gtfs-aggregator settings deciding which models it uses, so the status report matches them
+type StatusConf struct {
+	//SearchScheduleDays is the number of days of service examined for the models each route requires
+	SearchScheduleDays int
+	//MinimumObservedStopCount is the number of observations a model needs before gtfs-aggregator predicts with its
+	//travel time statistics
+	MinimumObservedStopCount int
+	//MinimumRMSEModelImprovement is how much lower than the schedule's a model's RMSE must be before
+	//gtfs-aggregator uses it for inference
+	MinimumRMSEModelImprovement float64
+}
+
+// RouteModelStatus counts the models required by the trips on a route by how far along they are to being used by
+// gtfs-aggregator
+type RouteModelStatus struct {
+	RouteId string
+	//Required is the number of models the route's trips need
+	Required int
+	//Recorded is the number of Required models recorded in ml_model, normally all of them after discover
+	Recorded int
+	//Trained is the number of Recorded models with training results that aren't flagged to be retrained
+	Trained int
+	//Observed is the number of Recorded models observed more than MinimumObservedStopCount times
+	Observed int
+	//Used is the number of Trained models improving on the schedule's RMSE by at least MinimumRMSEModelImprovement,
+	//which gtfs-aggregator uses for inference
+	Used int
+	//MLRMSE is the mean ml_rmse of the Trained models, nil when there are none
+	MLRMSE *float64
+	//ScheduleRMSE is the mean avg_rmse of the Trained models, the schedule's error baseline, nil when there are none
+	ScheduleRMSE *float64
+}
+
+// ReportModelStatus writes a line to w for each route with trips in the next conf.SearchScheduleDays of service,
+// counting the models the route requires, those trained and those gtfs-aggregator will use, followed by a line
+// totalling every route
+func ReportModelStatus(log *log.Logger, db *sqlx.DB, w io.Writer, conf StatusConf) error {
+	log.Printf("Loading all current models\n")
+	models, err := mlmodels.GetAllCurrentMLModelsByName(db, false)
+	if err != nil {
+		return fmt.Errorf("unable to load current models: %w", err)
+	}
+	log.Printf("Finding the models required by each route in the current dataset\n")
+	requiredByRoute, err := discoverRouteModels(db, conf.SearchScheduleDays)
+	if err != nil {
+		return fmt.Errorf("unable to discover models by route: %w", err)
+	}
+	statuses, total := buildRouteModelStatuses(requiredByRoute, models, conf)
+	return writeRouteModelStatuses(w, statuses, total)
+}
+
+// discoverRouteModels returns the names of the models required by the trips of each route in the next days of
+// service in the current dataset
+func discoverRouteModels(db *sqlx.DB, days int) (map[string]map[string]bool, error) {
+	dataSet, err := gtfs.GetLatestDataSet(context.Background(), db)
+	if err != nil {
+		return nil, err
+	}
+	timePointModelType, stopsModelType, err := getModelTypes(db)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	activeServiceIds, err := gtfs.GetActiveServiceIdsBetween(context.Background(), db, dataSet, now,
+		now.AddDate(0, 0, days))
+	if err != nil {
+		return nil, err
+	}
+	routeTrips, err := loadRouteTripIds(db, dataSet, activeServiceIds)
+	if err != nil {
+		return nil, err
+	}
+
+	requiredByRoute := make(map[string]map[string]bool)
+	for _, routeTrip := range routeTrips {
+		stopTimes, err := loadStopTimesForTrip(db, dataSet, routeTrip.TripId)
+		if err != nil {
+			return nil, fmt.Errorf("while discovering models error: %w", err)
+		}
+		tripModels := makeDiscoveredModels()
+		discoverModelsOnTrip(tripModels, stopTimes, timePointModelType, stopsModelType)
+		modelNames, present := requiredByRoute[routeTrip.RouteId]
+		if !present {
+			modelNames = make(map[string]bool)
+			requiredByRoute[routeTrip.RouteId] = modelNames
+		}
+		for modelName := range tripModels.modelsByName {
+			modelNames[modelName] = true
+		}
+	}
+	return requiredByRoute, nil
+}
+
+// routeTripId is a trip_id and the route_id of the trip
+type routeTripId struct {
+	RouteId string `db:"route_id"`
+	TripId  string `db:"trip_id"`
+}
+
+// loadRouteTripIds retrieves the trip and route ids of a trip for each stop pattern on each route in dataSet active
+// during activeServiceIds, and of all trips without a pattern
+func loadRouteTripIds(db *sqlx.DB, dataSet *gtfs.DataSet, activeServiceIds []string) ([]routeTripId, error) {
+	var routeTrips []routeTripId
+	query := "select distinct on (route_id, coalesce(pattern_id, trip_id)) route_id, trip_id from trip " +
+		"where data_set_id = ? and service_id in (?) order by route_id, coalesce(pattern_id, trip_id), trip_id"
+	query, args, err := sqlx.In(query, dataSet.Id, activeServiceIds)
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert query. query:%s error: %w", query, err)
+	}
+	err = db.Select(&routeTrips, db.Rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve trips. query:%s error: %w", query, err)
+	}
+	return routeTrips, nil
+}
+
+// modelStatusTally accumulates a RouteModelStatus and the RMSE of its trained models
+type modelStatusTally struct {
+	status            RouteModelStatus
+	mlRMSETotal       float64
+	scheduleRMSETotal float64
+}
+
+// add counts the model named modelName, found in models if it has been recorded
+func (t *modelStatusTally) add(modelName string, models map[string]*mlmodels.MLModel, conf StatusConf) {
+	t.status.Required++
+	model, present := models[modelName]
+	if !present {
+		return
+	}
+	t.status.Recorded++
+	if model.ObservedStopCount != nil && *model.ObservedStopCount > conf.MinimumObservedStopCount {
+		t.status.Observed++
+	}
+	if model.TrainedTimestamp == nil || model.TrainFlag {
+		return
+	}
+	t.status.Trained++
+	t.mlRMSETotal += model.MLRMSE
+	t.scheduleRMSETotal += model.AvgRMSE
+	if model.CurrentlyRelevant && model.AvgRMSE-model.MLRMSE >= conf.MinimumRMSEModelImprovement {
+		t.status.Used++
+	}
+}
+
+// result returns the RouteModelStatus tallied
+func (t *modelStatusTally) result() RouteModelStatus {
+	status := t.status
+	if status.Trained > 0 {
+		mlRMSE := t.mlRMSETotal / float64(status.Trained)
+		scheduleRMSE := t.scheduleRMSETotal / float64(status.Trained)
+		status.MLRMSE = &mlRMSE
+		status.ScheduleRMSE = &scheduleRMSE
+	}
+	return status
+}
+
+// buildRouteModelStatuses tallies the models in requiredByRoute against the models recorded, returning a
+// RouteModelStatus for each route in route_id order and one totalling the models required by any route, counting
+// models shared between routes once
+func buildRouteModelStatuses(requiredByRoute map[string]map[string]bool,
+	models map[string]*mlmodels.MLModel,
+	conf StatusConf) ([]RouteModelStatus, RouteModelStatus) {
+	routeIds := make([]string, 0, len(requiredByRoute))
+	for routeId := range requiredByRoute {
+		routeIds = append(routeIds, routeId)
+	}
+	sort.Strings(routeIds)
+
+	statuses := make([]RouteModelStatus, 0, len(routeIds))
+	allModelNames := make(map[string]bool)
+	for _, routeId := range routeIds {
+		tally := modelStatusTally{status: RouteModelStatus{RouteId: routeId}}
+		for modelName := range requiredByRoute[routeId] {
+			tally.add(modelName, models, conf)
+			allModelNames[modelName] = true
+		}
+		statuses = append(statuses, tally.result())
+	}
+	total := modelStatusTally{status: RouteModelStatus{RouteId: "all routes"}}
+	for modelName := range allModelNames {
+		total.add(modelName, models, conf)
+	}
+	return statuses, total.result()
+}
+
+// writeRouteModelStatuses writes statuses and total to w as aligned columns
+func writeRouteModelStatuses(w io.Writer, statuses []RouteModelStatus, total RouteModelStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, err := fmt.Fprintln(tw, "route\trequired\trecorded\ttrained\tobserved\tused\tml rmse\tschedule rmse")
+	if err != nil {
+		return err
+	}
+	for _, status := range append(statuses, total) {
+		_, err = fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%s\t%s\n", status.RouteId, status.Required,
+			status.Recorded, status.Trained, status.Observed, status.Used, formatRMSE(status.MLRMSE),
+			formatRMSE(status.ScheduleRMSE))
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+// formatRMSE formats rmse with one decimal place, or "-" when nil
+func formatRMSE(rmse *float64) string {
+	if rmse == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", *rmse)
+}
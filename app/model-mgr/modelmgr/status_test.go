@@ -0,0 +1,107 @@
+package modelmgr
+
+import (
+	"bytes"
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_buildRouteModelStatuses(t *testing.T) {
+	trainedAt := time.Date(2022, 5, 22, 12, 0, 0, 0, time.Local)
+	observed := 150
+	rarelyObserved := 20
+	models := map[string]*mlmodels.MLModel{
+		"improves": {ModelName: "improves", TrainedTimestamp: &trainedAt, CurrentlyRelevant: true, AvgRMSE: 30,
+			MLRMSE: 20, ObservedStopCount: &observed},
+		"no_better": {ModelName: "no_better", TrainedTimestamp: &trainedAt, CurrentlyRelevant: true, AvgRMSE: 30,
+			MLRMSE: 30, ObservedStopCount: &rarelyObserved},
+		"retraining": {ModelName: "retraining", TrainedTimestamp: &trainedAt, TrainFlag: true,
+			CurrentlyRelevant: true, AvgRMSE: 30, MLRMSE: 10, ObservedStopCount: &observed},
+		"untrained": {ModelName: "untrained", TrainFlag: true, CurrentlyRelevant: true},
+	}
+	rmse := func(value float64) *float64 {
+		return &value
+	}
+	tests := []struct {
+		name            string
+		requiredByRoute map[string]map[string]bool
+		conf            StatusConf
+		want            []RouteModelStatus
+		wantTotal       RouteModelStatus
+	}{
+		{
+			name: "Routes in order counting shared models once in total",
+			requiredByRoute: map[string]map[string]bool{
+				"20": {"improves": true, "untrained": true, "missing": true},
+				"10": {"improves": true, "no_better": true, "retraining": true},
+			},
+			conf: StatusConf{MinimumObservedStopCount: 100},
+			want: []RouteModelStatus{
+				{RouteId: "10", Required: 3, Recorded: 3, Trained: 2, Observed: 2, Used: 2, MLRMSE: rmse(25),
+					ScheduleRMSE: rmse(30)},
+				{RouteId: "20", Required: 3, Recorded: 2, Trained: 1, Observed: 1, Used: 1, MLRMSE: rmse(20),
+					ScheduleRMSE: rmse(30)},
+			},
+			wantTotal: RouteModelStatus{RouteId: "all routes", Required: 5, Recorded: 4, Trained: 2, Observed: 2,
+				Used: 2, MLRMSE: rmse(25), ScheduleRMSE: rmse(30)},
+		},
+		{
+			name: "Models not improving enough on the schedule aren't used",
+			requiredByRoute: map[string]map[string]bool{
+				"10": {"improves": true, "no_better": true},
+			},
+			conf: StatusConf{MinimumObservedStopCount: 100, MinimumRMSEModelImprovement: 5},
+			want: []RouteModelStatus{
+				{RouteId: "10", Required: 2, Recorded: 2, Trained: 2, Observed: 1, Used: 1, MLRMSE: rmse(25),
+					ScheduleRMSE: rmse(30)},
+			},
+			wantTotal: RouteModelStatus{RouteId: "all routes", Required: 2, Recorded: 2, Trained: 2, Observed: 1,
+				Used: 1, MLRMSE: rmse(25), ScheduleRMSE: rmse(30)},
+		},
+		{
+			name: "No RMSE without trained models",
+			requiredByRoute: map[string]map[string]bool{
+				"10": {"untrained": true},
+			},
+			conf: StatusConf{MinimumObservedStopCount: 100},
+			want: []RouteModelStatus{
+				{RouteId: "10", Required: 1, Recorded: 1},
+			},
+			wantTotal: RouteModelStatus{RouteId: "all routes", Required: 1, Recorded: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotTotal := buildRouteModelStatuses(tt.requiredByRoute, models, tt.conf)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildRouteModelStatuses() got = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(gotTotal, tt.wantTotal) {
+				t.Errorf("buildRouteModelStatuses() gotTotal = %+v, want %+v", gotTotal, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func Test_writeRouteModelStatuses(t *testing.T) {
+	mlRMSE := 20.0
+	scheduleRMSE := 30.0
+	statuses := []RouteModelStatus{
+		{RouteId: "10", Required: 3, Recorded: 3, Trained: 1, Observed: 2, Used: 1, MLRMSE: &mlRMSE,
+			ScheduleRMSE: &scheduleRMSE},
+	}
+	total := RouteModelStatus{RouteId: "all routes", Required: 3, Recorded: 3}
+	want := "route       required  recorded  trained  observed  used  ml rmse  schedule rmse\n" +
+		"10          3         3         1        2         1     20.0     30.0\n" +
+		"all routes  3         3         0        0         0     -        -\n"
+	w := &bytes.Buffer{}
+	if err := writeRouteModelStatuses(w, statuses, total); err != nil {
+		t.Errorf("writeRouteModelStatuses() error = %v", err)
+		return
+	}
+	if got := w.String(); got != want {
+		t.Errorf("writeRouteModelStatuses() = %q, want %q", got, want)
+	}
+}
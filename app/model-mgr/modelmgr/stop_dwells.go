@@ -0,0 +1,73 @@
+package modelmgr
+
+import (
+	"context"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/jmoiron/sqlx"
+	"log"
+	"time"
+)
+
+// StopDwellConf controls how TuneStopDwells computes the average dwell at each stop
+type StopDwellConf struct {
+	//HistoryDays is the number of days of observations examined, ending at the time dwells are computed
+	HistoryDays int
+	//MaxDwellSeconds is the longest dwell included, leaving out layovers and vehicles held out of service at a stop
+	MaxDwellSeconds int
+	//MinSamples is the number of observed dwells a stop needs before it is given an average dwell
+	MinSamples int
+}
+
+// validate returns an error describing the first value in conf that can't be used
+func (c StopDwellConf) validate() error {
+	if c.HistoryDays < 1 {
+		return fmt.Errorf("stop dwell history days must be at least 1, found %d", c.HistoryDays)
+	}
+	if c.MaxDwellSeconds < 1 {
+		return fmt.Errorf("stop dwell maximum seconds must be at least 1, found %d", c.MaxDwellSeconds)
+	}
+	if c.MinSamples < 1 {
+		return fmt.Errorf("stop dwell minimum samples must be at least 1, found %d", c.MinSamples)
+	}
+	return nil
+}
+
+// TuneStopDwells computes the average dwell at each stop from the last conf.HistoryDays of observed_stop_time and
+// replaces the dwells gtfs-aggregator predicts departures with. Returns the number of stops given dwells
+func TuneStopDwells(log *log.Logger,
+	db *sqlx.DB,
+	conf StopDwellConf,
+	queryTimeout time.Duration,
+	now time.Time) (int, error) {
+	if err := conf.validate(); err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	start := now.AddDate(0, 0, -conf.HistoryDays)
+	log.Printf("Computing stop dwells from observations between %s and %s\n",
+		start.Format(time.RFC3339), now.Format(time.RFC3339))
+	dwells, err := gtfs.ComputeStopDwells(ctx, db, start, now, conf.MaxDwellSeconds, conf.MinSamples, now)
+	if err != nil {
+		return 0, fmt.Errorf("unable to compute stop dwells: %w", err)
+	}
+	log.Printf("Replacing stop dwells with %d stops having at least %d observed dwells\n",
+		len(dwells), conf.MinSamples)
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	err = gtfs.DeleteStopDwells(ctx, tx)
+	if err == nil {
+		err = gtfs.RecordStopDwells(ctx, tx, dwells)
+	}
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Printf("Received error while attempting to rollback transaction. error:%v", rollbackErr)
+		}
+		return 0, fmt.Errorf("unable to save stop dwells: %w", err)
+	}
+	return len(dwells), tx.Commit()
+}
@@ -0,0 +1,40 @@
+package modelmgr
+
+import (
+	"context"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
+	"github.com/jmoiron/sqlx"
+	"log"
+	"time"
+)
+
+// RecordTimeBuckets replaces the time buckets models are trained and predicted with by those in definition, see
+// mlmodels.ParseTimeBuckets for its format. Returns true if the recorded time buckets changed, models trained with
+// the time bucket feature should then be retrained
+func RecordTimeBuckets(log *log.Logger, db *sqlx.DB, definition string) (bool, error) {
+	buckets, err := mlmodels.ParseTimeBuckets(definition)
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	changed, err := mlmodels.ReplaceTimeBuckets(ctx, tx, buckets)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Printf("Received error while attempting to rollback transaction. error:%v", rollbackErr)
+		}
+		return false, err
+	}
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("unable to commit time buckets: %w", err)
+	}
+	if changed {
+		log.Printf("Recorded %d time buckets", len(buckets))
+	}
+	return changed, nil
+}
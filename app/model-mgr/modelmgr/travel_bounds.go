@@ -0,0 +1,80 @@
+package modelmgr
+
+import (
+	"context"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/jmoiron/sqlx"
+	"log"
+	"time"
+)
+
+// TravelBoundConf controls how TuneStopPairTravelBounds computes each stop pair's minimum plausible travel time
+type TravelBoundConf struct {
+	//HistoryDays is the number of days of observations examined, ending at the time bounds are computed
+	HistoryDays int
+	//Percentile of a stop pair's travel times taken as the fastest typical travel, between 0.0 and 1.0
+	Percentile float64
+	//Margin multiplies the Percentile travel time so legitimate fast running beyond it is still accepted
+	Margin float64
+	//MinSamples is the number of observations a stop pair needs before it is given a bound
+	MinSamples int
+}
+
+// validate returns an error describing the first value in conf that can't be used
+func (c TravelBoundConf) validate() error {
+	if c.HistoryDays < 1 {
+		return fmt.Errorf("travel bound history days must be at least 1, found %d", c.HistoryDays)
+	}
+	if c.Percentile < 0 || c.Percentile > 1 {
+		return fmt.Errorf("travel bound percentile must be between 0.0 and 1.0, found %f", c.Percentile)
+	}
+	if c.Margin <= 0 || c.Margin > 1 {
+		return fmt.Errorf("travel bound margin must be greater than 0.0 and at most 1.0, found %f", c.Margin)
+	}
+	if c.MinSamples < 1 {
+		return fmt.Errorf("travel bound minimum samples must be at least 1, found %d", c.MinSamples)
+	}
+	return nil
+}
+
+// TuneStopPairTravelBounds computes the minimum plausible travel time between each pair of stops from the last
+// conf.HistoryDays of observed_stop_time and replaces the bounds gtfs-monitor uses in place of its earlyTolerance.
+// Returns the number of stop pairs given bounds
+func TuneStopPairTravelBounds(log *log.Logger,
+	db *sqlx.DB,
+	conf TravelBoundConf,
+	queryTimeout time.Duration,
+	now time.Time) (int, error) {
+	if err := conf.validate(); err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	start := now.AddDate(0, 0, -conf.HistoryDays)
+	log.Printf("Computing stop pair travel bounds from observations between %s and %s\n",
+		start.Format(time.RFC3339), now.Format(time.RFC3339))
+	bounds, err := gtfs.ComputeStopPairTravelBounds(ctx, db, start, now, conf.Percentile, conf.Margin,
+		conf.MinSamples, now)
+	if err != nil {
+		return 0, fmt.Errorf("unable to compute stop pair travel bounds: %w", err)
+	}
+	log.Printf("Replacing stop pair travel bounds with %d stop pairs having at least %d observations\n",
+		len(bounds), conf.MinSamples)
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	err = gtfs.DeleteStopPairTravelBounds(ctx, tx)
+	if err == nil {
+		err = gtfs.RecordStopPairTravelBounds(ctx, tx, bounds)
+	}
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Printf("Received error while attempting to rollback transaction. error:%v", rollbackErr)
+		}
+		return 0, fmt.Errorf("unable to save stop pair travel bounds: %w", err)
+	}
+	return len(bounds), tx.Commit()
+}
@@ -0,0 +1,276 @@
+package dashboard
+
+import (
+	"context"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
+	"github.com/jmoiron/sqlx"
+	"github.com/nats-io/nats.go"
+	logger "log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Conf contains all configurable parameters in dashboard
+type Conf struct {
+	HttpPort int
+	//PredictionSubject is the NATS subject gtfs-aggregator publishes TripUpdates on
+	PredictionSubject string
+	//NATSTenant prefixes the subjects subscribed to with "<tenant>.", empty leaves subjects unprefixed
+	NATSTenant string
+	//VehicleExpirationSeconds is how long a vehicle is shown after gtfs-monitor last reported it
+	VehicleExpirationSeconds int
+	//PredictionWindowSeconds is how recently a TripUpdate must have been received for its trip to be predicted
+	PredictionWindowSeconds int
+	//TransitionCount is the number of most recent stop transitions shown
+	TransitionCount int
+	//RefreshSeconds is how often data set and model status is read from the database
+	RefreshSeconds      int
+	QueryTimeoutSeconds int
+}
+
+// DataSetStatus describes a gtfs.DataSet loaded by gtfs-loader
+type DataSetStatus struct {
+	Id           int64      `json:"id"`
+	URL          string     `json:"url"`
+	Timezone     string     `json:"timezone"`
+	DownloadedAt time.Time  `json:"downloaded_at"`
+	SavedAt      *time.Time `json:"saved_at"`
+	ReplacedAt   *time.Time `json:"replaced_at"`
+}
+
+// makeDataSetStatus builds DataSetStatus from dataSet
+func makeDataSetStatus(dataSet *gtfs.DataSet) *DataSetStatus {
+	return &DataSetStatus{
+		Id:           dataSet.Id,
+		URL:          dataSet.URL,
+		Timezone:     dataSet.Timezone,
+		DownloadedAt: dataSet.DownloadedAt,
+		SavedAt:      dataSet.SavedAt,
+		ReplacedAt:   dataSet.ReplacedAt,
+	}
+}
+
+// DatabaseStatus is the schedule and model status read from the database
+type DatabaseStatus struct {
+	RetrievedAt time.Time `json:"retrieved_at"`
+	//ActiveDataSet is the data set in effect at RetrievedAt
+	ActiveDataSet *DataSetStatus `json:"active_data_set"`
+	//LatestDataSet is the last data set loaded, which may not be in effect yet
+	LatestDataSet *DataSetStatus          `json:"latest_data_set"`
+	Models        *mlmodels.MLModelStatus `json:"models"`
+	//Error is the reason the status could not be read, ActiveDataSet, LatestDataSet and Models are from the last
+	//successful read
+	Error string `json:"error,omitempty"`
+}
+
+// State is everything shown on the dashboard
+type State struct {
+	At          time.Time               `json:"at"`
+	Database    DatabaseStatus          `json:"database"`
+	Vehicles    []VehicleStatus         `json:"vehicles"`
+	Transitions []gtfs.ObservedStopTime `json:"transitions"`
+	Routes      []*RouteCoverage        `json:"routes"`
+}
+
+// databaseStatusProvider reads DatabaseStatus, or implementation for testing
+type databaseStatusProvider interface {
+	GetDatabaseStatus(ctx context.Context, at time.Time) (*DatabaseStatus, error)
+}
+
+// dbDatabaseStatusProvider uses a database connection to read DatabaseStatus, abandoning the queries after
+// queryTimeout
+type dbDatabaseStatusProvider struct {
+	db           *sqlx.DB
+	queryTimeout time.Duration
+}
+
+func (d *dbDatabaseStatusProvider) GetDatabaseStatus(ctx context.Context, at time.Time) (*DatabaseStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.queryTimeout)
+	defer cancel()
+	activeDataSet, err := gtfs.GetDataSetAt(ctx, d.db, at)
+	if err != nil {
+		return nil, err
+	}
+	latestDataSet, err := gtfs.GetLatestDataSet(ctx, d.db)
+	if err != nil {
+		return nil, err
+	}
+	models, err := mlmodels.GetMLModelStatus(ctx, d.db)
+	if err != nil {
+		return nil, err
+	}
+	return &DatabaseStatus{
+		RetrievedAt:   at,
+		ActiveDataSet: makeDataSetStatus(activeDataSet),
+		LatestDataSet: makeDataSetStatus(latestDataSet),
+		Models:        models,
+	}, nil
+}
+
+// pipelineState collects the dashboard State from NATS messages and the database
+type pipelineState struct {
+	mu                sync.Mutex
+	database          DatabaseStatus
+	vehicles          *vehicleActivity
+	predictions       *predictionCoverage
+	vehicleExpiration time.Duration
+	predictionWindow  time.Duration
+}
+
+// refreshDatabaseStatus reads DatabaseStatus from provider at "at", keeping the last status read along with the
+// error when it can't be read
+func (p *pipelineState) refreshDatabaseStatus(ctx context.Context, provider databaseStatusProvider, at time.Time) error {
+	status, err := provider.GetDatabaseStatus(ctx, at)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.database.Error = err.Error()
+		return err
+	}
+	p.database = *status
+	return nil
+}
+
+// state returns the dashboard State at "now"
+func (p *pipelineState) state(now time.Time) *State {
+	vehicles, transitions := p.vehicles.snapshot(now, p.vehicleExpiration)
+	p.mu.Lock()
+	database := p.database
+	p.mu.Unlock()
+	return &State{
+		At:          now,
+		Database:    database,
+		Vehicles:    vehicles,
+		Transitions: transitions,
+		Routes:      p.predictions.coverage(vehicles, now, p.predictionWindow),
+	}
+}
+
+// StartDashboard reads pipeline state from db and NATS and serves it until shutdownSignal
+func StartDashboard(log *logger.Logger,
+	db *sqlx.DB,
+	natsConn *nats.Conn,
+	conf Conf,
+	shutdownSignal chan os.Signal) error {
+	natsSubjects, err := natsclient.NewSubjects(conf.NATSTenant)
+	if err != nil {
+		return err
+	}
+	state := &pipelineState{
+		vehicles:          makeVehicleActivity(conf.TransitionCount),
+		predictions:       makePredictionCoverage(),
+		vehicleExpiration: time.Duration(conf.VehicleExpirationSeconds) * time.Second,
+		predictionWindow:  time.Duration(conf.PredictionWindowSeconds) * time.Second,
+	}
+	provider := &dbDatabaseStatusProvider{
+		db:           db,
+		queryTimeout: time.Duration(conf.QueryTimeoutSeconds) * time.Second,
+	}
+	err = state.refreshDatabaseStatus(context.Background(), provider, time.Now())
+	if err != nil {
+		log.Printf("Unable to read database status, continuing until next refresh: %v", err)
+	}
+
+	wg := sync.WaitGroup{}
+	listenerShutdown := make(chan bool, 1)
+	refreshShutdown := make(chan bool, 1)
+	webServiceShutdown := make(chan bool, 1)
+
+	listenerErrors := make(chan error, 1)
+	go runPipelineListener(log, &wg, natsConn, natsSubjects.Subject("vehicle-monitor-results"),
+		natsSubjects.Subject(conf.PredictionSubject), state, listenerErrors, listenerShutdown)
+	go runDatabaseStatusRefresh(log, &wg, provider, state, time.Duration(conf.RefreshSeconds)*time.Second,
+		refreshShutdown)
+	go runWebService(log, &wg, state, conf.HttpPort, webServiceShutdown)
+
+	select {
+	case err = <-listenerErrors:
+		log.Printf("Exiting on NATS subscription error, shutting down subroutines")
+	case <-shutdownSignal:
+		log.Printf("Exiting on shutdown signal, shutting down subroutines")
+	}
+	listenerShutdown <- true
+	refreshShutdown <- true
+	webServiceShutdown <- true
+	wg.Wait()
+	log.Printf("Subroutines shut down, exiting dashboard")
+	return err
+}
+
+// runPipelineListener subscribes to vehicleSubject and predictionSubject on NATS, recording the messages received in
+// state. Sends on errors if the subscriptions can't be made, ends the subscriptions on shutdownSignal
+func runPipelineListener(log *logger.Logger,
+	wg *sync.WaitGroup,
+	natsConn *nats.Conn,
+	vehicleSubject string,
+	predictionSubject string,
+	state *pipelineState,
+	errors chan error,
+	shutdownSignal chan bool) {
+	wg.Add(1)
+	defer wg.Done()
+
+	vehicleCh := make(chan *nats.Msg, 64)
+	predictionCh := make(chan *nats.Msg, 64)
+	log.Printf("Subscribing to %s and %s on nats: %v\n", vehicleSubject, predictionSubject, natsConn.Servers())
+	vehicleSub, err := natsConn.ChanSubscribe(vehicleSubject, vehicleCh)
+	if err != nil {
+		errors <- fmt.Errorf("unable to subscribe to %s: %w", vehicleSubject, err)
+		<-shutdownSignal
+		return
+	}
+	defer func() {
+		_ = vehicleSub.Unsubscribe()
+	}()
+	predictionSub, err := natsConn.ChanSubscribe(predictionSubject, predictionCh)
+	if err != nil {
+		errors <- fmt.Errorf("unable to subscribe to %s: %w", predictionSubject, err)
+		<-shutdownSignal
+		return
+	}
+	defer func() {
+		_ = predictionSub.Unsubscribe()
+	}()
+
+	for {
+		select {
+		case msg := <-vehicleCh:
+			recordVehicleMonitorResultsMsg(log, state.vehicles, msg)
+		case msg := <-predictionCh:
+			recordTripUpdateMsg(log, state.predictions, msg)
+		case <-shutdownSignal:
+			log.Printf("Exiting pipeline listener on shutdown signal")
+			return
+		}
+	}
+}
+
+// runDatabaseStatusRefresh reads DatabaseStatus into state every interval until shutdownSignal
+func runDatabaseStatusRefresh(log *logger.Logger,
+	wg *sync.WaitGroup,
+	provider databaseStatusProvider,
+	state *pipelineState,
+	interval time.Duration,
+	shutdownSignal chan bool) {
+	wg.Add(1)
+	defer wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-shutdownSignal:
+			log.Printf("Exiting database status refresh on shutdown signal")
+			return
+		case now := <-ticker.C:
+			err := state.refreshDatabaseStatus(context.Background(), provider, now)
+			if err != nil {
+				log.Printf("Unable to read database status: %v", err)
+			}
+		}
+	}
+}
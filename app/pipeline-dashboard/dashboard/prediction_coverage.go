@@ -0,0 +1,128 @@
+package dashboard
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
+	"github.com/nats-io/nats.go"
+	logger "log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RouteCoverage compares the trips vehicles are on with the trips predictions are published for on a route
+type RouteCoverage struct {
+	RouteId string `json:"route_id"`
+	//ActiveTrips is the number of trips vehicles are on
+	ActiveTrips int `json:"active_trips"`
+	//PredictedTrips is the number of ActiveTrips with a recent TripUpdate
+	PredictedTrips int `json:"predicted_trips"`
+	//Coverage is PredictedTrips divided by ActiveTrips, one when there are no ActiveTrips
+	Coverage float64 `json:"coverage"`
+	//TripUpdates is the number of trips with a recent TripUpdate, including later trips on vehicles' blocks
+	TripUpdates int `json:"trip_updates"`
+	//PredictionSources counts the stop updates in the recent TripUpdates by prediction source name
+	PredictionSources map[string]int `json:"prediction_sources"`
+	LastPublishedAt   *time.Time     `json:"last_published_at"`
+}
+
+// receivedTripUpdate is what predictionCoverage keeps from the last TripUpdate received for a trip
+type receivedTripUpdate struct {
+	routeId    string
+	receivedAt time.Time
+	sources    map[gtfs.PredictionSource]int
+}
+
+// predictionCoverage keeps the last TripUpdate received for each trip
+type predictionCoverage struct {
+	mu          sync.Mutex
+	tripUpdates map[string]*receivedTripUpdate
+}
+
+// makePredictionCoverage builds predictionCoverage
+func makePredictionCoverage() *predictionCoverage {
+	return &predictionCoverage{
+		tripUpdates: make(map[string]*receivedTripUpdate),
+	}
+}
+
+// record keeps tripUpdate as the last TripUpdate for its trip received at "now"
+func (p *predictionCoverage) record(tripUpdate *gtfs.TripUpdate, now time.Time) {
+	sources := make(map[gtfs.PredictionSource]int)
+	for _, stopTimeUpdate := range tripUpdate.StopTimeUpdates {
+		sources[stopTimeUpdate.PredictionSource]++
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tripUpdates[tripUpdate.TripId] = &receivedTripUpdate{
+		routeId:    tripUpdate.RouteId,
+		receivedAt: now,
+		sources:    sources,
+	}
+}
+
+// coverage returns the RouteCoverage of each route with vehicles on it or TripUpdates received within window of
+// "now", ordered by route id. TripUpdates older than window are forgotten
+func (p *predictionCoverage) coverage(vehicles []VehicleStatus, now time.Time, window time.Duration) []*RouteCoverage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	routes := make(map[string]*RouteCoverage)
+	routeCoverage := func(routeId string) *RouteCoverage {
+		route, present := routes[routeId]
+		if !present {
+			route = &RouteCoverage{RouteId: routeId, PredictionSources: make(map[string]int)}
+			routes[routeId] = route
+		}
+		return route
+	}
+	for tripId, tripUpdate := range p.tripUpdates {
+		if now.Sub(tripUpdate.receivedAt) > window {
+			delete(p.tripUpdates, tripId)
+			continue
+		}
+		route := routeCoverage(tripUpdate.routeId)
+		route.TripUpdates++
+		for source, count := range tripUpdate.sources {
+			route.PredictionSources[source.String()] += count
+		}
+		if route.LastPublishedAt == nil || tripUpdate.receivedAt.After(*route.LastPublishedAt) {
+			receivedAt := tripUpdate.receivedAt
+			route.LastPublishedAt = &receivedAt
+		}
+	}
+	activeTrips := make(map[string]bool)
+	for _, vehicle := range vehicles {
+		if vehicle.TripId == "" || activeTrips[vehicle.TripId] {
+			continue
+		}
+		activeTrips[vehicle.TripId] = true
+		route := routeCoverage(vehicle.RouteId)
+		route.ActiveTrips++
+		if _, present := p.tripUpdates[vehicle.TripId]; present {
+			route.PredictedTrips++
+		}
+	}
+	results := make([]*RouteCoverage, 0, len(routes))
+	for _, route := range routes {
+		route.Coverage = 1
+		if route.ActiveTrips > 0 {
+			route.Coverage = float64(route.PredictedTrips) / float64(route.ActiveTrips)
+		}
+		results = append(results, route)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].RouteId < results[j].RouteId
+	})
+	return results
+}
+
+// recordTripUpdateMsg un-marshal gtfs.TripUpdate from nats.Msg and record it in coverage
+func recordTripUpdateMsg(log *logger.Logger, coverage *predictionCoverage, msg *nats.Msg) {
+	var tripUpdate gtfs.TripUpdate
+	err := natsclient.Unmarshal(msg.Data, &tripUpdate)
+	if err != nil {
+		log.Printf("Error parsing TripUpdate: %v", err)
+		return
+	}
+	coverage.record(&tripUpdate, time.Now())
+}
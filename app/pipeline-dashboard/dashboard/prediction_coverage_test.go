@@ -0,0 +1,47 @@
+package dashboard
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_predictionCoverage_coverage(t *testing.T) {
+	now := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	makeTripUpdate := func(tripId string, routeId string, sources ...gtfs.PredictionSource) *gtfs.TripUpdate {
+		tripUpdate := &gtfs.TripUpdate{TripId: tripId, RouteId: routeId}
+		for _, source := range sources {
+			tripUpdate.StopTimeUpdates = append(tripUpdate.StopTimeUpdates, gtfs.StopTimeUpdate{PredictionSource: source})
+		}
+		return tripUpdate
+	}
+	coverage := makePredictionCoverage()
+	coverage.record(makeTripUpdate("1", "100", gtfs.StopMLPrediction, gtfs.StopMLPrediction), now.Add(-time.Minute))
+	coverage.record(makeTripUpdate("1-next", "100", gtfs.SchedulePrediction), now.Add(-30*time.Second))
+	coverage.record(makeTripUpdate("3", "20", gtfs.SchedulePrediction), now.Add(-5*time.Minute))
+	coverage.record(makeTripUpdate("4", "90", gtfs.TimepointMLPrediction), now)
+
+	vehicles := []VehicleStatus{
+		{VehicleId: "a", TripId: "1", RouteId: "100"},
+		{VehicleId: "b", TripId: "2", RouteId: "100"},
+		{VehicleId: "c", TripId: "3", RouteId: "20"},
+		{VehicleId: "d"},
+	}
+	published := now.Add(-30 * time.Second)
+	got := coverage.coverage(vehicles, now, 2*time.Minute)
+	want := []*RouteCoverage{
+		{RouteId: "100", ActiveTrips: 2, PredictedTrips: 1, Coverage: 0.5, TripUpdates: 2,
+			PredictionSources: map[string]int{"StopMLPrediction": 2, "SchedulePrediction": 1},
+			LastPublishedAt:   &published},
+		{RouteId: "20", ActiveTrips: 1, Coverage: 0, PredictionSources: map[string]int{}},
+		{RouteId: "90", TripUpdates: 1, Coverage: 1, PredictionSources: map[string]int{"TimepointMLPrediction": 1},
+			LastPublishedAt: &now},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("coverage() = %+v, want %+v", got, want)
+	}
+	if _, present := coverage.tripUpdates["3"]; present {
+		t.Errorf("coverage() kept TripUpdate older than window")
+	}
+}
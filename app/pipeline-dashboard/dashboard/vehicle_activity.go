@@ -0,0 +1,108 @@
+package dashboard
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
+	"github.com/nats-io/nats.go"
+	logger "log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// VehicleStatus is the trip a vehicle was last seen on by gtfs-monitor
+type VehicleStatus struct {
+	VehicleId string `json:"vehicle_id"`
+	//TripId is the trip the vehicle is on, empty when gtfs-monitor found no trip for it
+	TripId  string `json:"trip_id"`
+	RouteId string `json:"route_id"`
+	//Delay is the vehicle's delay in seconds on TripId
+	Delay    int       `json:"delay"`
+	AtStop   bool      `json:"at_stop"`
+	LastSeen time.Time `json:"last_seen"`
+	//LastTransition is the last movement between stops observed for the vehicle
+	LastTransition *gtfs.ObservedStopTime `json:"last_transition,omitempty"`
+}
+
+// vehicleActivity keeps the VehicleStatus of each vehicle and the most recent stop transitions observed, from the
+// gtfs.VehicleMonitorResults published by gtfs-monitor
+type vehicleActivity struct {
+	mu              sync.Mutex
+	vehicles        map[string]*VehicleStatus
+	transitions     []*gtfs.ObservedStopTime
+	transitionCount int
+}
+
+// makeVehicleActivity builds vehicleActivity keeping the last transitionCount stop transitions
+func makeVehicleActivity(transitionCount int) *vehicleActivity {
+	return &vehicleActivity{
+		vehicles:        make(map[string]*VehicleStatus),
+		transitions:     make([]*gtfs.ObservedStopTime, 0),
+		transitionCount: transitionCount,
+	}
+}
+
+// record updates the vehicle in results as seen at "now". The first TripDeviation in results is the trip the vehicle
+// is on, the rest are later trips on its block
+func (v *vehicleActivity) record(results *gtfs.VehicleMonitorResults, now time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	status, present := v.vehicles[results.VehicleId]
+	if !present {
+		status = &VehicleStatus{VehicleId: results.VehicleId}
+		v.vehicles[results.VehicleId] = status
+	}
+	status.LastSeen = now
+	status.TripId = ""
+	status.RouteId = ""
+	status.Delay = 0
+	status.AtStop = false
+	if len(results.TripDeviations) > 0 {
+		deviation := results.TripDeviations[0]
+		status.TripId = deviation.TripId
+		status.RouteId = deviation.RouteId
+		status.Delay = deviation.Delay
+		status.AtStop = deviation.AtStop
+	}
+	for _, ost := range results.ObservedStopTimes {
+		status.LastTransition = ost
+		v.transitions = append([]*gtfs.ObservedStopTime{ost}, v.transitions...)
+	}
+	if len(v.transitions) > v.transitionCount {
+		v.transitions = v.transitions[:v.transitionCount]
+	}
+}
+
+// snapshot returns the vehicles seen within expiration of "now" ordered by vehicle id, and the most recent stop
+// transitions, newest first. Vehicles not seen within expiration are forgotten
+func (v *vehicleActivity) snapshot(now time.Time, expiration time.Duration) ([]VehicleStatus, []gtfs.ObservedStopTime) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	vehicles := make([]VehicleStatus, 0, len(v.vehicles))
+	for vehicleId, status := range v.vehicles {
+		if now.Sub(status.LastSeen) > expiration {
+			delete(v.vehicles, vehicleId)
+			continue
+		}
+		vehicles = append(vehicles, *status)
+	}
+	sort.Slice(vehicles, func(i, j int) bool {
+		return vehicles[i].VehicleId < vehicles[j].VehicleId
+	})
+	transitions := make([]gtfs.ObservedStopTime, 0, len(v.transitions))
+	for _, ost := range v.transitions {
+		transitions = append(transitions, *ost)
+	}
+	return vehicles, transitions
+}
+
+// recordVehicleMonitorResultsMsg un-marshal gtfs.VehicleMonitorResults from nats.Msg and record them in activity
+func recordVehicleMonitorResultsMsg(log *logger.Logger, activity *vehicleActivity, msg *nats.Msg) {
+	var results gtfs.VehicleMonitorResults
+	err := natsclient.Unmarshal(msg.Data, &results)
+	if err != nil {
+		log.Printf("Error parsing VehicleMonitorResults: %v", err)
+		return
+	}
+	activity.record(&results, time.Now())
+}
@@ -0,0 +1,74 @@
+package dashboard
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_vehicleActivity(t *testing.T) {
+	now := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	transition := func(vehicleId string, stopId string, nextStopId string, at time.Time) *gtfs.ObservedStopTime {
+		return &gtfs.ObservedStopTime{
+			ObservedTime:  at,
+			StopId:        stopId,
+			NextStopId:    nextStopId,
+			VehicleId:     vehicleId,
+			RouteId:       "100",
+			TripId:        "trip" + vehicleId,
+			TravelSeconds: 60,
+		}
+	}
+	activity := makeVehicleActivity(3)
+	activity.record(&gtfs.VehicleMonitorResults{
+		VehicleId: "2",
+		ObservedStopTimes: []*gtfs.ObservedStopTime{
+			transition("2", "A", "B", now.Add(-2*time.Minute)),
+			transition("2", "B", "C", now.Add(-time.Minute)),
+		},
+		TripDeviations: []*gtfs.TripDeviation{
+			{TripId: "trip2", RouteId: "100", VehicleId: "2", Delay: 90, AtStop: true},
+			{TripId: "trip2-next", RouteId: "100", VehicleId: "2"},
+		},
+	}, now.Add(-time.Minute))
+	activity.record(&gtfs.VehicleMonitorResults{
+		VehicleId: "1",
+		ObservedStopTimes: []*gtfs.ObservedStopTime{
+			transition("1", "D", "E", now),
+			transition("1", "E", "F", now),
+		},
+		TripDeviations: []*gtfs.TripDeviation{
+			{TripId: "trip1", RouteId: "100", VehicleId: "1", Delay: -30},
+		},
+	}, now)
+	activity.record(&gtfs.VehicleMonitorResults{VehicleId: "3"}, now.Add(-10*time.Minute))
+
+	vehicles, transitions := activity.snapshot(now, 5*time.Minute)
+	wantVehicles := []VehicleStatus{
+		{VehicleId: "1", TripId: "trip1", RouteId: "100", Delay: -30, LastSeen: now,
+			LastTransition: transition("1", "E", "F", now)},
+		{VehicleId: "2", TripId: "trip2", RouteId: "100", Delay: 90, AtStop: true, LastSeen: now.Add(-time.Minute),
+			LastTransition: transition("2", "B", "C", now.Add(-time.Minute))},
+	}
+	if !reflect.DeepEqual(vehicles, wantVehicles) {
+		t.Errorf("snapshot() vehicles = %+v, want %+v", vehicles, wantVehicles)
+	}
+	wantTransitions := []gtfs.ObservedStopTime{
+		*transition("1", "E", "F", now),
+		*transition("1", "D", "E", now),
+		*transition("2", "B", "C", now.Add(-time.Minute)),
+	}
+	if !reflect.DeepEqual(transitions, wantTransitions) {
+		t.Errorf("snapshot() transitions = %+v, want %+v", transitions, wantTransitions)
+	}
+
+	activity.record(&gtfs.VehicleMonitorResults{VehicleId: "1"}, now.Add(time.Minute))
+	vehicles, _ = activity.snapshot(now.Add(5*time.Minute), 5*time.Minute)
+	wantVehicles = []VehicleStatus{
+		{VehicleId: "1", LastSeen: now.Add(time.Minute), LastTransition: transition("1", "E", "F", now)},
+	}
+	if !reflect.DeepEqual(vehicles, wantVehicles) {
+		t.Errorf("snapshot() after expiration vehicles = %+v, want %+v", vehicles, wantVehicles)
+	}
+}
@@ -0,0 +1,162 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"html/template"
+	logger "log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dashboardTemplate renders State as a page reloading itself every 15 seconds
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"clock": func(t time.Time) string {
+		return t.Local().Format("15:04:05")
+	},
+	"decimal": func(f float64) string {
+		return strconv.FormatFloat(f, 'f', 1, 64)
+	},
+	"percent": func(f float64) string {
+		return strconv.Itoa(int(f*100)) + "%"
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="15">
+<title>transitcast pipeline</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>transitcast pipeline at {{clock .At}}</h1>
+
+<h2>Data set</h2>
+{{with .Database.Error}}<p class="error">Unable to read database: {{.}}</p>{{end}}
+<table>
+<tr><th></th><th>Id</th><th>URL</th><th>Timezone</th><th>Downloaded</th><th>Saved</th></tr>
+{{with .Database.ActiveDataSet}}<tr><td>Active</td><td>{{.Id}}</td><td>{{.URL}}</td><td>{{.Timezone}}</td><td>{{.DownloadedAt}}</td><td>{{if .SavedAt}}{{.SavedAt}}{{end}}</td></tr>{{end}}
+{{with .Database.LatestDataSet}}<tr><td>Latest</td><td>{{.Id}}</td><td>{{.URL}}</td><td>{{.Timezone}}</td><td>{{.DownloadedAt}}</td><td>{{if .SavedAt}}{{.SavedAt}}{{end}}</td></tr>{{end}}
+</table>
+
+<h2>Models</h2>
+{{with .Database.Models}}
+<table>
+<tr><th>Current</th><th>Relevant</th><th>Trained</th><th>Awaiting training</th><th>Shadow</th><th>Last trained</th><th>Mean model RMSE</th><th>Mean schedule RMSE</th></tr>
+<tr><td>{{.Models}}</td><td>{{.Relevant}}</td><td>{{.Trained}}</td><td>{{.AwaitingTraining}}</td><td>{{.Shadow}}</td>
+<td>{{if .LastTrainedAt}}{{.LastTrainedAt}}{{end}}</td>
+<td>{{if .AverageMLRMSE}}{{decimal .AverageMLRMSE}}{{end}}</td>
+<td>{{if .AverageScheduleRMSE}}{{decimal .AverageScheduleRMSE}}{{end}}</td></tr>
+</table>
+{{end}}
+
+<h2>Prediction coverage</h2>
+<table>
+<tr><th>Route</th><th>Active trips</th><th>Predicted trips</th><th>Coverage</th><th>TripUpdates</th><th>Stop updates by source</th><th>Last published</th></tr>
+{{range .Routes}}<tr><td>{{.RouteId}}</td><td>{{.ActiveTrips}}</td><td>{{.PredictedTrips}}</td><td>{{percent .Coverage}}</td><td>{{.TripUpdates}}</td>
+<td>{{range $source, $count := .PredictionSources}}{{$source}}: {{$count}} {{end}}</td>
+<td>{{if .LastPublishedAt}}{{clock .LastPublishedAt}}{{end}}</td></tr>
+{{end}}
+</table>
+
+<h2>Active vehicles ({{len .Vehicles}})</h2>
+<table>
+<tr><th>Vehicle</th><th>Route</th><th>Trip</th><th>Delay</th><th>At stop</th><th>Last seen</th><th>Last transition</th></tr>
+{{range .Vehicles}}<tr><td>{{.VehicleId}}</td><td>{{.RouteId}}</td><td>{{.TripId}}</td><td>{{.Delay}}</td><td>{{.AtStop}}</td><td>{{clock .LastSeen}}</td>
+<td>{{with .LastTransition}}{{.StopId}} to {{.NextStopId}} at {{clock .ObservedTime}}{{end}}</td></tr>
+{{end}}
+</table>
+
+<h2>Last stop transitions</h2>
+<table>
+<tr><th>Observed</th><th>Vehicle</th><th>Route</th><th>Trip</th><th>From stop</th><th>To stop</th><th>Travel seconds</th><th>Scheduled seconds</th></tr>
+{{range .Transitions}}<tr><td>{{clock .ObservedTime}}</td><td>{{.VehicleId}}</td><td>{{.RouteId}}</td><td>{{.TripId}}</td><td>{{.StopId}}</td><td>{{.NextStopId}}</td>
+<td>{{.TravelSeconds}}</td><td>{{if .ScheduledSeconds}}{{.ScheduledSeconds}}{{end}}</td></tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
+
+// dashboardHandler serves the dashboard page
+type dashboardHandler struct {
+	log   *logger.Logger
+	state *pipelineState
+}
+
+// ServeHTTP implements dashboardHandler's http.Handler interface
+func (h *dashboardHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := dashboardTemplate.Execute(w, h.state.state(time.Now()))
+	if err != nil {
+		h.log.Printf("Error rendering dashboard: %v", err)
+	}
+}
+
+// stateHandler serves State as json
+type stateHandler struct {
+	log   *logger.Logger
+	state *pipelineState
+}
+
+// ServeHTTP implements stateHandler's http.Handler interface
+func (h *stateHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	jsonData, err := json.Marshal(h.state.state(time.Now()))
+	if err != nil {
+		h.log.Printf("Error marshaling dashboard state to json: %v", err)
+		http.Error(w, "Error serving request", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(jsonData)
+	if err != nil {
+		h.log.Printf("Error writing json response: %v", err)
+	}
+}
+
+// createServer creates http.Server serving the dashboard at / and its State as json at /api/state
+func createServer(log *logger.Logger, state *pipelineState, httpPort int) *http.Server {
+	r := mux.NewRouter()
+	r.Handle("/", &dashboardHandler{log: log, state: state})
+	r.Handle("/api/state", &stateHandler{log: log, state: state})
+	return &http.Server{
+		Addr:         strings.Join([]string{"0.0.0.0", strconv.Itoa(httpPort)}, ":"),
+		WriteTimeout: time.Second * 15,
+		ReadTimeout:  time.Second * 15,
+		IdleTimeout:  time.Second * 60,
+		Handler:      r,
+	}
+}
+
+// runWebService serves the dashboard until shutdownSignal
+func runWebService(log *logger.Logger,
+	wg *sync.WaitGroup,
+	state *pipelineState,
+	httpPort int,
+	shutdownSignal chan bool) {
+	wg.Add(1)
+	defer wg.Done()
+	srv := createServer(log, state, httpPort)
+	log.Printf("Starting dashboard on port %d", httpPort)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil {
+			log.Printf("server ListenAndServe ended. %s", err)
+		}
+	}()
+	<-shutdownSignal
+	log.Printf("ending webservice on shutdown signal")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("error shutting down webservice, error:%s", err)
+	}
+}
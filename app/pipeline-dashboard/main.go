@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/app/pipeline-dashboard/dashboard"
+	"github.com/OpenTransitTools/transitcast/foundation/database"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
+	"github.com/ardanlabs/conf"
+	logger "log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var build = "develop"
+
+func main() {
+	log := logger.New(os.Stdout, "PIPELINE_DASHBOARD : ", logger.LstdFlags|logger.Lmicroseconds|logger.Lshortfile)
+	if err := run(log); err != nil {
+		log.Printf("main: error: %v", err)
+		os.Exit(1)
+	}
+}
+
+func run(log *logger.Logger) error {
+	var cfg struct {
+		conf.Version
+		Args conf.Args
+		DB   struct {
+			User         string `conf:"default:postgres"`
+			Password     string `conf:"default:postgres,noprint"`
+			Host         string `conf:"default:0.0.0.0"`
+			Name         string `conf:"default:postgres"`
+			DisableTLS   bool   `conf:"default:true"`
+			SSLMode      string `conf:"help:Overrides the sslmode chosen by DisableTLS, for example verify-full"`
+			RootCertFile string `conf:"help:PEM file of certificate authorities used to verify the database server"`
+			CertFile     string `conf:"help:PEM client certificate used to authenticate with the database server"`
+			KeyFile      string `conf:"help:PEM key of the client certificate"`
+			Schema       string `conf:"help:Postgres schema holding the agency's tables when several agencies share the database"`
+			//QueryTimeoutSeconds limits how long any database query may run
+			QueryTimeoutSeconds int `conf:"default:30"`
+		}
+		NATS struct {
+			URL                       string `conf:"default:localhost"`
+			MaxReconnects             int    `conf:"default:-1,help:Reconnect attempts before giving up on a lost connection, negative values never give up"`
+			ReconnectWaitMilliseconds int    `conf:"default:500"`
+			MaxReconnectWaitSeconds   int    `conf:"default:30"`
+			ReconnectBufferBytes      int    `conf:"default:8388608"`
+			CredentialsFile           string `conf:"help:NATS user credentials file holding a user JWT and NKey seed"`
+			NKeySeedFile              string `conf:"help:File holding an NKey seed to authenticate with instead of a credentials file"`
+			RootCAFile                string `conf:"help:PEM file of certificate authorities used to verify the NATS server"`
+			CertFile                  string `conf:"help:PEM client certificate presented to the NATS server"`
+			KeyFile                   string `conf:"help:PEM key of the client certificate"`
+			Tenant                    string `conf:"help:Agency whose subjects are prefixed with <tenant>. when several agencies share NATS servers"`
+		}
+		HttpPort                 int    `conf:"default:8090"`
+		PredictionSubject        string `conf:"default:trip-update-prediction,help:NATS subject for trip-updates generated by aggregator"`
+		VehicleExpirationSeconds int    `conf:"default:300"`
+		PredictionWindowSeconds  int    `conf:"default:120,help:A trip is shown as predicted when a TripUpdate was received for it within this many seconds"`
+		TransitionCount          int    `conf:"default:50"`
+		RefreshSeconds           int    `conf:"default:60,help:How often data set and model status is read from the database"`
+	}
+	cfg.Version.SVN = build
+	cfg.Version.Desc = "Show the state of the prediction pipeline to operations staff"
+	const prefix = "PIPELINE_DASHBOARD"
+	if err := conf.Parse(os.Args[1:], prefix, &cfg); err != nil {
+		switch err {
+		case conf.ErrHelpWanted:
+			usage, err := conf.Usage(prefix, &cfg)
+			if err != nil {
+				return fmt.Errorf("generating config usage: %w", err)
+			}
+			printUsage(usage)
+			return nil
+		case conf.ErrVersionWanted:
+			version, err := conf.VersionString(prefix, &cfg)
+			if err != nil {
+				return fmt.Errorf("generating config version: %w", err)
+			}
+			fmt.Println(version)
+			return nil
+		}
+		return fmt.Errorf("parsing config: %w", err)
+	}
+
+	// =========================================================================
+	// App Starting
+
+	log.Printf("main : Started : Application initializing : version %s", build)
+	defer log.Println("main: Completed")
+
+	out, err := conf.String(&cfg)
+	if err != nil {
+		return fmt.Errorf("generating config for output: %w", err)
+	}
+	log.Printf("main: Config :\n%v\n", out)
+
+	// =========================================================================
+	// Start Database
+
+	log.Println("main: Initializing database support")
+
+	db, err := database.Open(database.Config{
+		User:         cfg.DB.User,
+		Password:     cfg.DB.Password,
+		Host:         cfg.DB.Host,
+		Name:         cfg.DB.Name,
+		DisableTLS:   cfg.DB.DisableTLS,
+		SSLMode:      cfg.DB.SSLMode,
+		RootCertFile: cfg.DB.RootCertFile,
+		CertFile:     cfg.DB.CertFile,
+		KeyFile:      cfg.DB.KeyFile,
+		Schema:       cfg.DB.Schema,
+	})
+	if err != nil {
+		return fmt.Errorf("connecting to db: %w", err)
+	}
+	defer func() {
+		log.Printf("main: Database Stopping : %s", cfg.DB.Host)
+		err = db.Close()
+		if err != nil {
+			log.Printf("main: error closing database: %v", err)
+		}
+	}()
+
+	// =========================================================================
+	// Start NATS
+
+	log.Printf("main: Connecting to NATS\n")
+	natsConnection, err := natsclient.Connect(log, natsclient.Config{
+		URL:                  cfg.NATS.URL,
+		Name:                 "pipeline-dashboard",
+		MaxReconnects:        cfg.NATS.MaxReconnects,
+		ReconnectWait:        time.Duration(cfg.NATS.ReconnectWaitMilliseconds) * time.Millisecond,
+		MaxReconnectWait:     time.Duration(cfg.NATS.MaxReconnectWaitSeconds) * time.Second,
+		ReconnectBufferBytes: cfg.NATS.ReconnectBufferBytes,
+		CredentialsFile:      cfg.NATS.CredentialsFile,
+		NKeySeedFile:         cfg.NATS.NKeySeedFile,
+		RootCAFile:           cfg.NATS.RootCAFile,
+		CertFile:             cfg.NATS.CertFile,
+		KeyFile:              cfg.NATS.KeyFile,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to establish connection to nats server: %w", err)
+	}
+	defer func() {
+		log.Printf("main: closing connection to NATS")
+		natsConnection.Close()
+	}()
+
+	// Make a channel to listen for an interrupt or terminate signal from the OS.
+	// Use a buffered channel because the signal package requires it.
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+
+	return dashboard.StartDashboard(log, db, natsConnection, dashboard.Conf{
+		HttpPort:                 cfg.HttpPort,
+		PredictionSubject:        cfg.PredictionSubject,
+		NATSTenant:               cfg.NATS.Tenant,
+		VehicleExpirationSeconds: cfg.VehicleExpirationSeconds,
+		PredictionWindowSeconds:  cfg.PredictionWindowSeconds,
+		TransitionCount:          cfg.TransitionCount,
+		RefreshSeconds:           cfg.RefreshSeconds,
+		QueryTimeoutSeconds:      cfg.DB.QueryTimeoutSeconds,
+	}, shutdown)
+}
+
+func printUsage(confUsage string) {
+	fmt.Println(confUsage)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/app/gtfs-loader/gtfsmanager"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/systemevent"
+	"github.com/jmoiron/sqlx"
+	logger "log"
+	"time"
+)
+
+// scheduledLoader does the work of the gtfs-loader commands normally run from cron: loading a new schedule when
+// url has changed, creating upcoming partitions and dropping partitions older than retentionDays
+type scheduledLoader struct {
+	log               *logger.Logger
+	db                *sqlx.DB
+	tempDir           string
+	url               string
+	stream            bool
+	conflictPolicy    gtfsmanager.ConflictPolicy
+	stopTimeLoadConf  gtfsmanager.StopTimeLoadConf
+	partitionInterval gtfs.PartitionInterval
+	partitionCount    int
+	retentionDays     int
+}
+
+// run calls runOnce every checkEvery until ctx is done
+func (s *scheduledLoader) run(ctx context.Context, checkEvery time.Duration) {
+	ticker := time.NewTicker(checkEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.log.Printf("Exiting scheduled loader on shutdown signal")
+			return
+		case <-ticker.C:
+		}
+		s.runOnce(ctx)
+	}
+}
+
+// runOnce maintains partitions and loads the schedule at url if it has changed, logging rather than returning
+// failures so the previously loaded schedule continues to be used until the next attempt
+func (s *scheduledLoader) runOnce(ctx context.Context) {
+	now := time.Now()
+	err := gtfsmanager.CreatePartitions(ctx, s.log, s.db, now, s.partitionInterval, s.partitionCount)
+	if err != nil {
+		s.log.Printf("Unable to create partitions: %v", err)
+	}
+	if s.retentionDays > 0 {
+		err = gtfsmanager.DropExpiredPartitions(ctx, s.log, s.db, now, s.retentionDays)
+		if err != nil {
+			s.log.Printf("Unable to drop expired partitions: %v", err)
+		}
+	}
+
+	dataSet, err := gtfsmanager.UpdateGTFSSchedule(ctx, s.log, s.db, s.tempDir, s.url, false, s.stream,
+		s.stopTimeLoadConf, s.conflictPolicy, nil)
+	if err != nil {
+		s.log.Printf("Unable to load gtfs schedule from %s: %v", s.url, err)
+		return
+	}
+	if dataSet == nil {
+		return
+	}
+	err = systemevent.Record(ctx, s.db, &systemevent.SystemEvent{
+		CreatedAt:   time.Now(),
+		App:         "transitcast",
+		Version:     build,
+		EventType:   systemevent.DataSetLoaded,
+		Description: fmt.Sprintf("loaded data set %d from %s", dataSet.Id, dataSet.URL),
+		Details:     dataSet.String(),
+	})
+	if err != nil {
+		s.log.Printf("Unable to record %s in system_event: %v", systemevent.DataSetLoaded, err)
+	}
+}
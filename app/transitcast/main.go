@@ -0,0 +1,510 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/app/gtfs-loader/gtfsmanager"
+	"github.com/OpenTransitTools/transitcast/app/gtfs-monitor/monitor"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/systemevent"
+	"github.com/OpenTransitTools/transitcast/foundation/clock"
+	"github.com/OpenTransitTools/transitcast/foundation/database"
+	"github.com/OpenTransitTools/transitcast/foundation/health"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
+	"github.com/OpenTransitTools/transitcast/foundation/profiling"
+	"github.com/OpenTransitTools/transitcast/pkg/predictor"
+	"github.com/ardanlabs/conf"
+	logger "log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var build = "develop"
+
+func main() {
+	log := logger.New(os.Stdout, "TRANSITCAST : ", logger.LstdFlags|logger.Lmicroseconds|logger.Lshortfile)
+	if err := run(log); err != nil {
+		log.Printf("main: error: %v", err)
+		os.Exit(1)
+	}
+}
+
+func run(log *logger.Logger) error {
+	var cfg struct {
+		conf.Version
+		DB struct {
+			User         string `conf:"default:postgres"`
+			Password     string `conf:"default:postgres,noprint"`
+			Host         string `conf:"default:0.0.0.0"`
+			Name         string `conf:"default:postgres"`
+			DisableTLS   bool   `conf:"default:true"`
+			SSLMode      string `conf:"help:Overrides the sslmode chosen by DisableTLS, for example verify-full"`
+			RootCertFile string `conf:"help:PEM file of certificate authorities used to verify the database server"`
+			CertFile     string `conf:"help:PEM client certificate used to authenticate with the database server"`
+			KeyFile      string `conf:"help:PEM key of the client certificate"`
+			Schema       string `conf:"help:Postgres schema holding the agency's tables when several agencies share the database"`
+			//QueryTimeoutSeconds limits how long any database query may run
+			QueryTimeoutSeconds int `conf:"default:30"`
+		}
+		NATS struct {
+			Embedded                  bool   `conf:"default:true,help:Run a NATS server inside the process on EmbeddedHost and EmbeddedPort instead of connecting to URL"`
+			EmbeddedHost              string `conf:"default:127.0.0.1"`
+			EmbeddedPort              int    `conf:"default:4222"`
+			URL                       string `conf:"default:localhost"`
+			MaxReconnects             int    `conf:"default:-1,help:Reconnect attempts before giving up on a lost connection, negative values never give up"`
+			ReconnectWaitMilliseconds int    `conf:"default:500"`
+			MaxReconnectWaitSeconds   int    `conf:"default:30"`
+			ReconnectBufferBytes      int    `conf:"default:8388608"`
+			CredentialsFile           string `conf:"help:NATS user credentials file holding a user JWT and NKey seed"`
+			NKeySeedFile              string `conf:"help:File holding an NKey seed to authenticate with instead of a credentials file"`
+			RootCAFile                string `conf:"help:PEM file of certificate authorities used to verify the NATS server"`
+			CertFile                  string `conf:"help:PEM client certificate presented to the NATS server"`
+			KeyFile                   string `conf:"help:PEM key of the client certificate"`
+			Tenant                    string `conf:"help:Agency whose subjects are prefixed with <tenant>. when several agencies share NATS servers"`
+			Compression               string `conf:"default:none,help:Compression of published message payloads which is one of none gzip or snappy"`
+			Encoding                  string `conf:"default:json,help:Encoding of published message payloads, json or protobuf"`
+		}
+		Web struct {
+			DebugHost      string `conf:"default:0.0.0.0:4000"`
+			DebugPositions bool   `conf:"default:false,help:Serve the last vehicle position snapshot and what became of each position on /debug/positions"`
+			Profiling      bool   `conf:"default:false,help:Serve net/http/pprof profiles and execution traces under /debug/pprof/"`
+		}
+		Health struct {
+			CheckTimeoutSeconds   int `conf:"default:5"`
+			MaxPositionAgeSeconds int `conf:"default:120,help:/healthz fails when vehicle positions have not been retrieved within this many seconds"`
+		}
+		Loader struct {
+			Url               string `conf:"default:https://developer.trimet.org/schedule/gtfs.zip"`
+			TempDir           string `conf:"default:gtfs_tmp"`
+			Stream            bool   `conf:"default:true,help:Read the gtfs file with byte range requests instead of downloading it to TempDir when the server supports them"`
+			ConflictPolicy    string `conf:"default:fail,help:How rows sharing a key with another row in their file are loaded: fail, keep-first or keep-last"`
+			StopTimeWorkers   int    `conf:"default:4,help:Connections copying stop_times.txt in parallel, 0 inserts stop times inside the load transaction"`
+			StopTimeBatchSize int    `conf:"default:10000"`
+			CheckEveryHours   int    `conf:"default:24,help:Hours between checks of Url for a new schedule and partition maintenance, 0 only checks on startup"`
+			PartitionInterval string `conf:"default:monthly"`
+			PartitionCount    int    `conf:"default:2"`
+			RetentionDays     int    `conf:"default:90,help:Days observed_stop_time and trip_deviation partitions are kept, 0 keeps them all"`
+		}
+		Monitor struct {
+			VehiclePositionsUrl            string   `conf:"default:https://developer.trimet.org/ws/V1/VehiclePositions"`
+			LoadEverySeconds               int      `conf:"default:3"`
+			MaxFetchBackoffSeconds         int      `conf:"default:60,help:Longest delay between attempts to retrieve vehicle positions after failures"`
+			MaxFeedStaleSeconds            int      `conf:"default:90,help:Seconds the feed header timestamp may stop advancing before snapshots are ignored, 0 disables"`
+			EarlyTolerance                 float64  `conf:"default:0.1"`
+			RouteTypeEarlyTolerance        []string `conf:"default:0:0.2;1:0.2;2:0.2,help:List route_type:tolerance separated by semicolons overriding EarlyTolerance for trips with the route_type."`
+			ExpirePositionSeconds          int      `conf:"default:900"`
+			RouteTypeExpirePositionSeconds []string `conf:"help:List route_type:seconds separated by semicolons overriding ExpirePositionSeconds for trips with the route_type."`
+			MinimumMovementMeters          float64  `conf:"default:5"`
+			DistanceMedianWindow           int      `conf:"default:3"`
+			Interpolation                  string   `conf:"default:schedule,help:How travel between positions is split between the stops passed, schedule by scheduled time or distance by shape distance and scheduled speed"`
+			TripCacheSize                  int      `conf:"default:10000"`
+			PositionWorkers                int      `conf:"default:4,help:Number of goroutines processing vehicle positions concurrently"`
+		}
+		Aggregator struct {
+			Inference struct {
+				Transport              string   `conf:"default:nats,help:nats to request inference over NATS, sidecar to call the gRPC inference service at SidecarAddress or in-process to run ONNX models from OnnxModelDirectory"`
+				SidecarAddress         string   `conf:"default:localhost:50051,help:host:port of the sidecar serving the transitcast.Inference gRPC service"`
+				OnnxModelDirectory     string   `conf:"help:Directory of models exported as <model_name>_<version>.onnx run inside the process"`
+				InProcessModelNames    []string `conf:"help:List model names separated by semicolons run from OnnxModelDirectory while other models use Transport."`
+				WarmUpMinutes          int      `conf:"default:60"`
+				MemoryBudgetMB         int      `conf:"default:0"`
+				TimeoutMilliseconds    int      `conf:"default:500"`
+				Retries                int      `conf:"default:2"`
+				RetryDelayMilliseconds int      `conf:"default:50"`
+				MaxConnections         int      `conf:"default:2,help:Number of gRPC connections to the sidecar that requests are spread across"`
+			}
+			ExpirePredictionSeconds               int      `conf:"default:8"`
+			MaximumObservedTransitionAgeInSeconds int      `conf:"default:3600"`
+			MinimumRMSEModelImprovement           float64  `conf:"default:0.0"`
+			MinimumObservedStopCount              int      `conf:"default:100"`
+			PredictionSubject                     string   `conf:"default:trip-update-prediction"`
+			ExpirePredictorSeconds                int      `conf:"default:3600"`
+			RouteTypeExpirePredictorSeconds       []string `conf:"default:0:1800;1:1800"`
+			LimitEarlyDepartureSeconds            int      `conf:"default:60"`
+			RouteTypeLimitEarlyDepartureSeconds   []string `conf:"default:0:0;1:0;2:0"`
+			RouteLimitEarlyDepartureSeconds       []string
+			NonTimepointEarlyDeparture            string   `conf:"default:allow,help:Early departures from stops that aren't timepoints: allow, schedule or limit to NonTimepointEarlyDepartureSeconds"`
+			NonTimepointEarlyDepartureSeconds     int      `conf:"default:0"`
+			RouteNonTimepointEarlyDeparture       []string `conf:"help:List route_id:policy separated by semicolons overriding NonTimepointEarlyDeparture for the route."`
+			PredictDwell                          bool     `conf:"default:false,help:Predict departures from stops with an average dwell computed by model-mgr tuneDwell"`
+			MinimumDwellSeconds                   int      `conf:"default:15,help:Least average dwell a stop needs for its departures to be predicted"`
+			PublishChangeThresholdSeconds         int      `conf:"default:0"`
+			PublishHeartbeatSeconds               int      `conf:"default:60"`
+			DelaySmoothingFactor                  float64  `conf:"default:1"`
+			DelayHysteresisSeconds                int      `conf:"default:0"`
+			InferenceBuckets                      int      `conf:"default:8"`
+			MaximumPredictionMinutes              int      `conf:"default:60"`
+			MakePredictions                       bool     `conf:"default:true"`
+			UseStatistics                         bool     `conf:"default:true"`
+			TimepointOnlyRouteIds                 []string `conf:"help:List route_ids separated by semicolons only predicted at timepoints."`
+			RecentObservationCount                int      `conf:"default:5"`
+			MinimumObservationConfidence          float64  `conf:"default:0"`
+			PredictionSourceStatsSubject          string   `conf:"default:prediction-source-stats"`
+			PredictionSourceStatsSeconds          int      `conf:"default:60"`
+			BackfillMinutes                       int      `conf:"default:60"`
+			RouteSilenceMinutes                   int      `conf:"default:15"`
+			RouteSilenceSubject                   string   `conf:"default:route-silence-alerts"`
+			ConsumerLagAlertSeconds               int      `conf:"default:30"`
+			ConsumerLagSubject                    string   `conf:"default:consumer-lag-alerts"`
+			DeviationHistoryMinutes               int      `conf:"default:30"`
+			ShedVehicleResults                    bool     `conf:"default:true"`
+			TripOverrideSubject                   string   `conf:"default:trip-overrides"`
+			TripOverrideExpirationMinutes         int      `conf:"default:1440"`
+			MinimumLayoverSeconds                 int      `conf:"default:0"`
+			CoalesceInferenceRequests             bool     `conf:"default:true"`
+			InferenceTimeoutFallback              bool     `conf:"default:true"`
+			InferenceGuardrailFactor              float64  `conf:"default:4"`
+			ModelHealthWindow                     int      `conf:"default:200"`
+			ModelHealthMinimumSamples             int      `conf:"default:50"`
+			ModelHealthErrorRatio                 float64  `conf:"default:1.5"`
+		}
+		IncludedRouteIds []string `conf:"help:List route_ids separated by semicolons. If included only vehicles and trips on these route_ids are monitored and predicted."`
+	}
+	cfg.Version.SVN = build
+	cfg.Version.Desc = "Loads gtfs schedules, monitors the gtfs-rt vehicle feed and publishes predicted trip updates " +
+		"in a single process"
+	const prefix = "TRANSITCAST"
+	if err := conf.Parse(os.Args[1:], prefix, &cfg); err != nil {
+		switch err {
+		case conf.ErrHelpWanted:
+			usage, err := conf.Usage(prefix, &cfg)
+			if err != nil {
+				return fmt.Errorf("generating config usage: %w", err)
+			}
+			fmt.Println(usage)
+			return nil
+		case conf.ErrVersionWanted:
+			version, err := conf.VersionString(prefix, &cfg)
+			if err != nil {
+				return fmt.Errorf("generating config version: %w", err)
+			}
+			fmt.Println(version)
+			return nil
+		}
+		return fmt.Errorf("parsing config: %w", err)
+	}
+
+	// =========================================================================
+	// App Starting
+
+	// Print the build version for our logs. Also expose it under /debug/vars.
+	expvar.NewString("build").Set(build)
+	log.Printf("main : Started : Application initializing : version %s", build)
+	defer log.Println("main: Completed")
+
+	out, err := conf.String(&cfg)
+	if err != nil {
+		return fmt.Errorf("generating config for output: %w", err)
+	}
+	log.Printf("main: Config :\n%v\n", out)
+
+	conflictPolicy, err := gtfsmanager.ParseConflictPolicy(cfg.Loader.ConflictPolicy)
+	if err != nil {
+		return err
+	}
+	partitionInterval, err := gtfs.ParsePartitionInterval(cfg.Loader.PartitionInterval)
+	if err != nil {
+		return err
+	}
+
+	// =========================================================================
+	// Start Debug Service
+	//
+	// /debug/vars - Exported metrics of the monitor and aggregator
+	// /debug/state - The aggregator's trip predictors, vehicle deviations and pending predictions
+	// /healthz - Fails when vehicle positions haven't been retrieved recently
+	// /readyz - Also fails when the database, NATS or a schedule data set is unavailable
+	// /debug/positions - The last vehicle position snapshot, when enabled by DebugPositions
+	// /debug/pprof/ - CPU profiles and execution traces, when enabled by Profiling
+
+	var positionDebugger *monitor.PositionDebugger
+	if cfg.Web.DebugPositions {
+		positionDebugger = monitor.NewPositionDebugger()
+		http.Handle("/debug/positions", positionDebugger)
+	}
+	if cfg.Web.Profiling {
+		profiling.Register(http.DefaultServeMux)
+	}
+	checks := health.New(time.Duration(cfg.Health.CheckTimeoutSeconds) * time.Second)
+	checks.Register(http.DefaultServeMux)
+	positionPolls := health.NewHeartbeat(time.Now())
+	checks.AddLiveness("vehicle_positions",
+		positionPolls.Check(time.Duration(cfg.Health.MaxPositionAgeSeconds)*time.Second))
+
+	log.Printf("main: Debug Listening %s", cfg.Web.DebugHost)
+	go func() {
+		if err := http.ListenAndServe(cfg.Web.DebugHost, http.DefaultServeMux); err != nil {
+			log.Printf("main: Debug Listener closed : %v", err)
+		}
+	}()
+
+	// =========================================================================
+	// Start Database, shared by the loader, monitor and aggregator
+
+	log.Println("main: Initializing database support")
+
+	db, err := database.Open(database.Config{
+		User:         cfg.DB.User,
+		Password:     cfg.DB.Password,
+		Host:         cfg.DB.Host,
+		Name:         cfg.DB.Name,
+		DisableTLS:   cfg.DB.DisableTLS,
+		SSLMode:      cfg.DB.SSLMode,
+		RootCertFile: cfg.DB.RootCertFile,
+		CertFile:     cfg.DB.CertFile,
+		KeyFile:      cfg.DB.KeyFile,
+		Schema:       cfg.DB.Schema,
+	})
+	if err != nil {
+		return fmt.Errorf("connecting to db: %w", err)
+	}
+	defer func() {
+		log.Printf("main: Database Stopping : %s", cfg.DB.Host)
+		err = db.Close()
+		if err != nil {
+			log.Printf("main: error closing database: %v", err)
+		}
+	}()
+
+	checks.AddReadiness("database", health.DatabaseCheck(db))
+	checks.AddReadiness("data_set", func(ctx context.Context) error {
+		_, err := gtfs.GetDataSetAt(ctx, db, time.Now())
+		return err
+	})
+
+	// =========================================================================
+	// Record start and stop in the system_event audit trail
+
+	queryTimeout := time.Duration(cfg.DB.QueryTimeoutSeconds) * time.Second
+	startCtx, cancelStart := context.WithTimeout(context.Background(), queryTimeout)
+	err = systemevent.RecordAppStart(startCtx, db, "transitcast", build, out, time.Now())
+	cancelStart()
+	if err != nil {
+		log.Printf("main: unable to record start in system_event: %v", err)
+	}
+	defer func() {
+		stopCtx, cancelStop := context.WithTimeout(context.Background(), queryTimeout)
+		defer cancelStop()
+		if err := systemevent.RecordAppStop(stopCtx, db, "transitcast", build, time.Now()); err != nil {
+			log.Printf("main: unable to record stop in system_event: %v", err)
+		}
+	}()
+
+	// =========================================================================
+	// Start nats, embedded in the process unless connecting to an existing server
+
+	natsURL := cfg.NATS.URL
+	if cfg.NATS.Embedded {
+		log.Printf("main: Starting embedded NATS server\n")
+		natsServer, err := natsclient.StartEmbeddedServer(log, natsclient.EmbeddedConfig{
+			Host:         cfg.NATS.EmbeddedHost,
+			Port:         cfg.NATS.EmbeddedPort,
+			ReadyTimeout: 10 * time.Second,
+		})
+		if err != nil {
+			return err
+		}
+		defer func() {
+			log.Printf("main: stopping embedded NATS server")
+			natsServer.Shutdown()
+		}()
+		natsURL = natsServer.ClientURL()
+	}
+
+	log.Printf("main: Connecting to NATS\n")
+	natsConnection, err := natsclient.Connect(log, natsclient.Config{
+		URL:                  natsURL,
+		Name:                 "transitcast",
+		MaxReconnects:        cfg.NATS.MaxReconnects,
+		ReconnectWait:        time.Duration(cfg.NATS.ReconnectWaitMilliseconds) * time.Millisecond,
+		MaxReconnectWait:     time.Duration(cfg.NATS.MaxReconnectWaitSeconds) * time.Second,
+		ReconnectBufferBytes: cfg.NATS.ReconnectBufferBytes,
+		CredentialsFile:      cfg.NATS.CredentialsFile,
+		NKeySeedFile:         cfg.NATS.NKeySeedFile,
+		RootCAFile:           cfg.NATS.RootCAFile,
+		CertFile:             cfg.NATS.CertFile,
+		KeyFile:              cfg.NATS.KeyFile,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to establish connection to nats server: %w", err)
+	}
+	defer func() {
+		log.Printf("main: closing connection to NATS")
+		natsConnection.Close()
+	}()
+	checks.AddReadiness("nats", health.NatsCheck(natsConnection))
+
+	natsCodec, err := natsclient.NewCodec(cfg.NATS.Compression, cfg.NATS.Encoding)
+	if err != nil {
+		return err
+	}
+	natsSubjects, err := natsclient.NewSubjects(cfg.NATS.Tenant)
+	if err != nil {
+		return err
+	}
+
+	// ctx is cancelled on an interrupt or terminate signal from the OS, or when any of the services stops
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// =========================================================================
+	// Load the schedule before monitoring vehicles so a new database has a data set to monitor against
+
+	loader := scheduledLoader{
+		log:            log,
+		db:             db,
+		tempDir:        cfg.Loader.TempDir,
+		url:            cfg.Loader.Url,
+		stream:         cfg.Loader.Stream,
+		conflictPolicy: conflictPolicy,
+		stopTimeLoadConf: gtfsmanager.StopTimeLoadConf{
+			Workers:   cfg.Loader.StopTimeWorkers,
+			BatchSize: cfg.Loader.StopTimeBatchSize,
+		},
+		partitionInterval: partitionInterval,
+		partitionCount:    cfg.Loader.PartitionCount,
+		retentionDays:     cfg.Loader.RetentionDays,
+	}
+	loader.runOnce(ctx)
+
+	// =========================================================================
+	// Start the loader, monitor and aggregator, stopping them all when any one returns
+
+	wg := sync.WaitGroup{}
+	serviceErrors := make(chan error, 3)
+	monitorShutdown := make(chan os.Signal, 1)
+
+	if cfg.Loader.CheckEveryHours > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			loader.run(ctx, time.Duration(cfg.Loader.CheckEveryHours)*time.Hour)
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		log.Printf("main: starting monitor\n")
+		serviceErrors <- monitor.RunVehicleMonitorLoop(log, db, natsConnection, monitor.Conf{
+			NatsCodec:    natsCodec,
+			NatsSubjects: natsSubjects,
+			PositionSource: monitor.PositionSourceConf{
+				Type: "http",
+				URL:  cfg.Monitor.VehiclePositionsUrl,
+			},
+			LoopEverySeconds:               cfg.Monitor.LoadEverySeconds,
+			MaxFetchBackoffSeconds:         cfg.Monitor.MaxFetchBackoffSeconds,
+			MaxFeedStaleSeconds:            cfg.Monitor.MaxFeedStaleSeconds,
+			EarlyTolerance:                 cfg.Monitor.EarlyTolerance,
+			RouteTypeEarlyTolerance:        cfg.Monitor.RouteTypeEarlyTolerance,
+			ExpirePositionSeconds:          cfg.Monitor.ExpirePositionSeconds,
+			RouteTypeExpirePositionSeconds: cfg.Monitor.RouteTypeExpirePositionSeconds,
+			MinimumMovementMeters:          cfg.Monitor.MinimumMovementMeters,
+			DistanceMedianWindow:           cfg.Monitor.DistanceMedianWindow,
+			Interpolation:                  cfg.Monitor.Interpolation,
+			RecordToDatabase:               true,
+			PublishOverNats:                true,
+			TripCacheSize:                  cfg.Monitor.TripCacheSize,
+			QueryTimeoutSeconds:            cfg.DB.QueryTimeoutSeconds,
+			VehicleFilter: monitor.VehicleFilterConf{
+				IncludedRouteIds: cfg.IncludedRouteIds,
+			},
+			PositionWorkers:  cfg.Monitor.PositionWorkers,
+			PositionPolls:    positionPolls,
+			PositionDebugger: positionDebugger,
+			Clock:            clock.System{},
+		}, monitorShutdown)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		log.Printf("main: starting aggregator\n")
+		serviceErrors <- predictor.Run(ctx, log, db, natsConnection, predictor.Conf{
+			ExpirePredictionSeconds:               cfg.Aggregator.ExpirePredictionSeconds,
+			MaximumObservedTransitionAgeInSeconds: cfg.Aggregator.MaximumObservedTransitionAgeInSeconds,
+			MinimumRMSEModelImprovement:           cfg.Aggregator.MinimumRMSEModelImprovement,
+			MinimumObservedStopCount:              cfg.Aggregator.MinimumObservedStopCount,
+			PredictionSubject:                     cfg.Aggregator.PredictionSubject,
+			ExpirePredictorSeconds:                cfg.Aggregator.ExpirePredictorSeconds,
+			RouteTypeExpirePredictorSeconds:       cfg.Aggregator.RouteTypeExpirePredictorSeconds,
+			LimitEarlyDepartureSeconds:            cfg.Aggregator.LimitEarlyDepartureSeconds,
+			RouteTypeLimitEarlyDepartureSeconds:   cfg.Aggregator.RouteTypeLimitEarlyDepartureSeconds,
+			RouteLimitEarlyDepartureSeconds:       cfg.Aggregator.RouteLimitEarlyDepartureSeconds,
+			NonTimepointEarlyDeparture:            cfg.Aggregator.NonTimepointEarlyDeparture,
+			NonTimepointEarlyDepartureSeconds:     cfg.Aggregator.NonTimepointEarlyDepartureSeconds,
+			RouteNonTimepointEarlyDeparture:       cfg.Aggregator.RouteNonTimepointEarlyDeparture,
+			PredictDwell:                          cfg.Aggregator.PredictDwell,
+			MinimumDwellSeconds:                   cfg.Aggregator.MinimumDwellSeconds,
+			PublishChangeThresholdSeconds:         cfg.Aggregator.PublishChangeThresholdSeconds,
+			PublishHeartbeatSeconds:               cfg.Aggregator.PublishHeartbeatSeconds,
+			DelaySmoothingFactor:                  cfg.Aggregator.DelaySmoothingFactor,
+			DelayHysteresisSeconds:                cfg.Aggregator.DelayHysteresisSeconds,
+			NATSCompression:                       cfg.NATS.Compression,
+			NATSEncoding:                          cfg.NATS.Encoding,
+			NATSTenant:                            cfg.NATS.Tenant,
+			InferenceBuckets:                      cfg.Aggregator.InferenceBuckets,
+			IncludedRouteIds:                      cfg.IncludedRouteIds,
+			MaximumPredictionMinutes:              cfg.Aggregator.MaximumPredictionMinutes,
+			MakePredictions:                       cfg.Aggregator.MakePredictions,
+			UseStatistics:                         cfg.Aggregator.UseStatistics,
+			TimepointOnlyRouteIds:                 cfg.Aggregator.TimepointOnlyRouteIds,
+			QueryTimeoutSeconds:                   cfg.DB.QueryTimeoutSeconds,
+			CoalesceInferenceRequests:             cfg.Aggregator.CoalesceInferenceRequests,
+			InferenceTimeoutFallback:              cfg.Aggregator.InferenceTimeoutFallback,
+			InferenceGuardrailFactor:              cfg.Aggregator.InferenceGuardrailFactor,
+			ModelHealthWindow:                     cfg.Aggregator.ModelHealthWindow,
+			ModelHealthMinimumSamples:             cfg.Aggregator.ModelHealthMinimumSamples,
+			ModelHealthErrorRatio:                 cfg.Aggregator.ModelHealthErrorRatio,
+			App:                                   "transitcast",
+			Version:                               build,
+			RecentObservationCount:                cfg.Aggregator.RecentObservationCount,
+			MinimumObservationConfidence:          cfg.Aggregator.MinimumObservationConfidence,
+			PredictionSourceStatsSubject:          cfg.Aggregator.PredictionSourceStatsSubject,
+			PredictionSourceStatsSeconds:          cfg.Aggregator.PredictionSourceStatsSeconds,
+			BackfillMinutes:                       cfg.Aggregator.BackfillMinutes,
+			RouteSilenceMinutes:                   cfg.Aggregator.RouteSilenceMinutes,
+			RouteSilenceSubject:                   cfg.Aggregator.RouteSilenceSubject,
+			ConsumerLagAlertSeconds:               cfg.Aggregator.ConsumerLagAlertSeconds,
+			ConsumerLagSubject:                    cfg.Aggregator.ConsumerLagSubject,
+			ShedVehicleResults:                    cfg.Aggregator.ShedVehicleResults,
+			DeviationHistoryMinutes:               cfg.Aggregator.DeviationHistoryMinutes,
+			TripOverrideSubject:                   cfg.Aggregator.TripOverrideSubject,
+			TripOverrideExpirationMinutes:         cfg.Aggregator.TripOverrideExpirationMinutes,
+			MinimumLayoverSeconds:                 cfg.Aggregator.MinimumLayoverSeconds,
+			InferenceTransport:                    cfg.Aggregator.Inference.Transport,
+			DebugMux:                              http.DefaultServeMux,
+			SidecarInference: predictor.SidecarInferenceConf{
+				Address:                cfg.Aggregator.Inference.SidecarAddress,
+				TimeoutMilliseconds:    cfg.Aggregator.Inference.TimeoutMilliseconds,
+				Retries:                cfg.Aggregator.Inference.Retries,
+				RetryDelayMilliseconds: cfg.Aggregator.Inference.RetryDelayMilliseconds,
+				MaxConnections:         cfg.Aggregator.Inference.MaxConnections,
+			},
+			InProcessInference: predictor.InProcessInferenceConf{
+				ModelDirectory: cfg.Aggregator.Inference.OnnxModelDirectory,
+				ModelNames:     cfg.Aggregator.Inference.InProcessModelNames,
+				WarmUpMinutes:  cfg.Aggregator.Inference.WarmUpMinutes,
+				MemoryBudgetMB: cfg.Aggregator.Inference.MemoryBudgetMB,
+			},
+		})
+	}()
+
+	// wait for a shutdown signal or the first service to stop, then stop the rest
+	select {
+	case <-ctx.Done():
+		log.Printf("main: shutting down on signal")
+	case err = <-serviceErrors:
+		log.Printf("main: shutting down after a service stopped: %v", err)
+	}
+	stop()
+	monitorShutdown <- syscall.SIGTERM
+	wg.Wait()
+	return err
+}
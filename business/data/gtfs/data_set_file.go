@@ -0,0 +1,109 @@
+package gtfs
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// A DataSet is staged while its gtfs files are loaded, with a nil DataSet.SavedAt so it is never active. Each file is
+// recorded in data_set_file once its rows are saved, so a load that is interrupted can be resumed from the files that
+// were not. SaveAndTerminateReplacedDataSet activates the DataSet once every file is loaded.
+
+// IsStaged returns true if the DataSet is still being loaded and has never been active
+func (d *DataSet) IsStaged() bool {
+	return d.SavedAt == nil
+}
+
+// RecordDataSetFile records that the rows of fileName have been saved in dataSetId
+func RecordDataSetFile(ctx context.Context, tx *sqlx.Tx, dataSetId int64, fileName string, loadedAt time.Time) error {
+	statementString := tx.Rebind("insert into data_set_file (data_set_id, file_name, loaded_at) values (?, ?, ?) " +
+		"on conflict (data_set_id, file_name) do update set loaded_at = excluded.loaded_at")
+	_, err := tx.ExecContext(ctx, statementString, dataSetId, fileName, loadedAt)
+	if err != nil {
+		return fmt.Errorf("unable to record %s loaded in data set %d: %w", fileName, dataSetId, err)
+	}
+	return nil
+}
+
+// GetDataSetFiles retrieves the names of the files recorded as loaded in dataSetId
+func GetDataSetFiles(ctx context.Context, db *sqlx.DB, dataSetId int64) ([]string, error) {
+	var results []string
+	err := db.SelectContext(ctx, &results, db.Rebind("select file_name from data_set_file where data_set_id = ?"),
+		dataSetId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve files loaded in data set %d: %w", dataSetId, err)
+	}
+	return results, nil
+}
+
+// DeleteDataSetFiles removes the record of files loaded in dataSetId
+func DeleteDataSetFiles(ctx context.Context, tx *sqlx.Tx, dataSetId int64) error {
+	_, err := tx.ExecContext(ctx, tx.Rebind("delete from data_set_file where data_set_id = ?"), dataSetId)
+	if err != nil {
+		return fmt.Errorf("unable to delete files loaded in data set %d: %w", dataSetId, err)
+	}
+	return nil
+}
+
+// GetStagedDataSets retrieves the DataSets being loaded, most recently downloaded first
+func GetStagedDataSets(ctx context.Context, db *sqlx.DB) ([]DataSet, error) {
+	var results []DataSet
+	err := db.SelectContext(ctx, &results, "select * from data_set where saved_at is null order by downloaded_at desc")
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve staged DataSets. error: %w", err)
+	}
+	return results, nil
+}
+
+// TripStopTimeRange is the first arrival, last departure and furthest distance of the stop times on a trip
+type TripStopTimeRange struct {
+	TripId            string  `db:"trip_id"`
+	StartTime         int     `db:"start_time"`
+	EndTime           int     `db:"end_time"`
+	ShapeDistTraveled float64 `db:"shape_dist_traveled"`
+}
+
+// GetTripStopTimeRanges retrieves the TripStopTimeRange of each trip with stop times in dataSetId
+func GetTripStopTimeRanges(ctx context.Context, db *sqlx.DB, dataSetId int64) ([]TripStopTimeRange, error) {
+	query := "select trip_id, min(arrival_time) as start_time, max(departure_time) as end_time, " +
+		"coalesce(max(shape_dist_traveled), 0) as shape_dist_traveled from stop_time where data_set_id = $1 group by trip_id"
+	var results []TripStopTimeRange
+	err := db.SelectContext(ctx, &results, query, dataSetId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve stop time ranges of trips in data set %d: %w", dataSetId, err)
+	}
+	return results, nil
+}
+
+// GetShapeDistances retrieves the furthest shape_dist_traveled of each shape in dataSetId, keyed by shape_id
+func GetShapeDistances(ctx context.Context, db *sqlx.DB, dataSetId int64) (map[string]float64, error) {
+	query := "select shape_id, coalesce(max(shape_dist_traveled), 0) as shape_dist_traveled from shape " +
+		"where data_set_id = $1 group by shape_id"
+	var rows []struct {
+		ShapeId           string  `db:"shape_id"`
+		ShapeDistTraveled float64 `db:"shape_dist_traveled"`
+	}
+	err := db.SelectContext(ctx, &rows, query, dataSetId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve shape distances in data set %d: %w", dataSetId, err)
+	}
+	results := make(map[string]float64, len(rows))
+	for _, row := range rows {
+		results[row.ShapeId] = row.ShapeDistTraveled
+	}
+	return results, nil
+}
+
+// GetDefinedServiceIds retrieves the service_ids in dataSetId scheduled by calendar or added by calendar_date
+func GetDefinedServiceIds(ctx context.Context, db *sqlx.DB, dataSetId int64) ([]string, error) {
+	query := "select service_id from calendar where data_set_id = $1 " +
+		"union select service_id from calendar_date where data_set_id = $1 and exception_type = 1"
+	var results []string
+	err := db.SelectContext(ctx, &results, query, dataSetId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve service_ids in data set %d: %w", dataSetId, err)
+	}
+	return results, nil
+}
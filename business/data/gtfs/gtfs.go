@@ -2,8 +2,10 @@
 package gtfs
 
 import (
+	"context"
 	"fmt"
 	"github.com/jmoiron/sqlx"
+	"sync"
 
 	"time"
 )
@@ -34,6 +36,50 @@ type DataSet struct {
 	DownloadedAt          time.Time  `db:"downloaded_at"`
 	SavedAt               *time.Time `db:"saved_at"`
 	ReplacedAt            *time.Time `db:"replaced_at"`
+	// Timezone is the agency_timezone from agency.txt that the schedule's times are in. Is empty if not available
+	Timezone string `db:"timezone"`
+}
+
+// locations caches the time.Location of each DataSet.Timezone
+var locations sync.Map
+
+// Location returns the time.Location of DataSet.Timezone, which service dates and schedule times in the DataSet are
+// in. Returns time.Local if the DataSet has no Timezone or it is not a known time zone
+func (d *DataSet) Location() *time.Location {
+	if d.Timezone == "" {
+		return time.Local
+	}
+	if location, present := locations.Load(d.Timezone); present {
+		return location.(*time.Location)
+	}
+	location, err := time.LoadLocation(d.Timezone)
+	if err != nil {
+		location = time.Local
+	}
+	locations.Store(d.Timezone, location)
+	return location
+}
+
+// ServiceDate returns 12am on the service date of year, month and day in the DataSet's Location
+func (d *DataSet) ServiceDate(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, d.Location())
+}
+
+// dataSetLocations caches the time.Location of each DataSet by DataSet.Id
+var dataSetLocations sync.Map
+
+// getDataSetLocation retrieves the time.Location of the DataSet with dataSetId
+func getDataSetLocation(ctx context.Context, db *sqlx.DB, dataSetId int64) (*time.Location, error) {
+	if location, present := dataSetLocations.Load(dataSetId); present {
+		return location.(*time.Location), nil
+	}
+	dataSet, err := GetDataSet(ctx, db, dataSetId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve DataSet %d, error: %w", dataSetId, err)
+	}
+	location := dataSet.Location()
+	dataSetLocations.Store(dataSetId, location)
+	return location, nil
 }
 
 func (d DataSet) String() string {
@@ -42,8 +88,8 @@ func (d DataSet) String() string {
 		lastModTime := time.Unix(d.LastModifiedTimestamp, 0)
 		lastModified = formatTime(&lastModTime)
 	}
-	return fmt.Sprintf("DataSet id:%d, url:%s, ETag:%s, lastModified:%s savedAt:%s replacedAt:%s",
-		d.Id, d.URL, d.ETag, lastModified, formatTime(d.SavedAt), formatTime(d.ReplacedAt))
+	return fmt.Sprintf("DataSet id:%d, url:%s, ETag:%s, lastModified:%s savedAt:%s replacedAt:%s timezone:%s",
+		d.Id, d.URL, d.ETag, lastModified, formatTime(d.SavedAt), formatTime(d.ReplacedAt), d.Timezone)
 }
 
 func formatTime(time *time.Time) string {
@@ -56,7 +102,7 @@ func formatTime(time *time.Time) string {
 // SaveAndTerminateReplacedDataSet updates all DataSet where now is between DataSet.SavedAt and DataSet.ReplacedAt and
 //sets DataSet.ReplacedAt to one microsecond before now.
 //ds is then saved with now as DataSet.SavedAt and the default DataSet.ReplacedAt date of 9999-12-31
-func SaveAndTerminateReplacedDataSet(tx *sqlx.Tx, ds *DataSet, now time.Time) error {
+func SaveAndTerminateReplacedDataSet(ctx context.Context, tx *sqlx.Tx, ds *DataSet, now time.Time) error {
 	endDate, err := time.Parse("2006-01-02", "9999-12-31")
 	if err != nil {
 		return err
@@ -65,33 +111,35 @@ func SaveAndTerminateReplacedDataSet(tx *sqlx.Tx, ds *DataSet, now time.Time) er
 	statementString := "update data_set set replaced_at = :millisecondAgo" +
 		" where :now between saved_at and replaced_at"
 	//statementString = tx.Rebind(statementString)
-	_, err = tx.NamedExec(statementString, map[string]interface{}{"now": now, "millisecondAgo": millisecondAgo})
+	_, err = tx.NamedExecContext(ctx, statementString, map[string]interface{}{"now": now, "millisecondAgo": millisecondAgo})
 	if err != nil {
 		return err
 	}
 	ds.SavedAt = &now
 	ds.ReplacedAt = &endDate
-	return SaveDataSet(tx, ds)
+	return SaveDataSet(ctx, tx, ds)
 }
 
 /*
 SaveDataSet saves new or updates existing DataSets.
 */
-func SaveDataSet(tx *sqlx.Tx, ds *DataSet) error {
+func SaveDataSet(ctx context.Context, tx *sqlx.Tx, ds *DataSet) error {
 	statementString := "insert into data_set ( " +
 		"url, " +
 		"e_tag, " +
 		"last_modified_timestamp, " +
 		"downloaded_at, " +
 		"saved_at, " +
-		"replaced_at) " +
+		"replaced_at, " +
+		"timezone) " +
 		"values (" +
 		":url, " +
 		":e_tag, " +
 		":last_modified_timestamp, " +
 		":downloaded_at, " +
 		":saved_at, " +
-		":replaced_at)"
+		":replaced_at, " +
+		":timezone)"
 	if ds.Id != 0 {
 		statementString = "update data_set set " +
 			"url = :url, " +
@@ -99,12 +147,13 @@ func SaveDataSet(tx *sqlx.Tx, ds *DataSet) error {
 			"last_modified_timestamp = :last_modified_timestamp, " +
 			"downloaded_at = :downloaded_at, " +
 			"saved_at = :saved_at, " +
-			"replaced_at = :replaced_at " +
+			"replaced_at = :replaced_at, " +
+			"timezone = :timezone " +
 			"where id = :id"
 	}
 
 	statementString = tx.Rebind(statementString)
-	_, err := tx.NamedExec(statementString, ds)
+	_, err := tx.NamedExecContext(ctx, statementString, ds)
 	if err != nil {
 		return err
 	}
@@ -114,7 +163,7 @@ func SaveDataSet(tx *sqlx.Tx, ds *DataSet) error {
 			"where e_tag = ? " +
 			"and last_modified_timestamp = ? " +
 			"and downloaded_at = ? limit 1")
-		err = tx.Get(&ds.Id, statementString, ds.ETag, ds.LastModifiedTimestamp, ds.DownloadedAt)
+		err = tx.GetContext(ctx, &ds.Id, statementString, ds.ETag, ds.LastModifiedTimestamp, ds.DownloadedAt)
 		if err != nil {
 			return err
 		}
@@ -124,24 +173,24 @@ func SaveDataSet(tx *sqlx.Tx, ds *DataSet) error {
 }
 
 // GetDataSet retrieves DataSet with dataSetId
-func GetDataSet(db *sqlx.DB, dataSetId int64) (*DataSet, error) {
+func GetDataSet(ctx context.Context, db *sqlx.DB, dataSetId int64) (*DataSet, error) {
 	query := "select * from data_set where id = $1"
 	ds := DataSet{}
-	err := db.Get(&ds, db.Rebind(query), dataSetId)
+	err := db.GetContext(ctx, &ds, db.Rebind(query), dataSetId)
 	return &ds, err
 }
 
 // GetLatestDataSet retrieves the latest DataSet that is active
-func GetLatestDataSet(db *sqlx.DB) (*DataSet, error) {
-	return GetDataSetAt(db, time.Now())
+func GetLatestDataSet(ctx context.Context, db *sqlx.DB) (*DataSet, error) {
+	return GetDataSetAt(ctx, db, time.Now())
 }
 
 // GetDataSetAt retrieves the DataSet that was active at a time
-func GetDataSetAt(db *sqlx.DB, at time.Time) (*DataSet, error) {
+func GetDataSetAt(ctx context.Context, db *sqlx.DB, at time.Time) (*DataSet, error) {
 	query := "select * from data_set " +
 		"where $1 between saved_at and replaced_at order by saved_at desc limit 1"
 	ds := DataSet{}
-	err := db.Get(&ds, db.Rebind(query), at)
+	err := db.GetContext(ctx, &ds, db.Rebind(query), at)
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve DataSet at %v, error: %w", at, err)
 	}
@@ -149,10 +198,10 @@ func GetDataSetAt(db *sqlx.DB, at time.Time) (*DataSet, error) {
 }
 
 // GetAllDataSets retrieves all DataSets currently loaded
-func GetAllDataSets(db *sqlx.DB) ([]DataSet, error) {
+func GetAllDataSets(ctx context.Context, db *sqlx.DB) ([]DataSet, error) {
 	query := "select * from data_set order by saved_at"
 	var results []DataSet
-	err := db.Select(&results, query)
+	err := db.SelectContext(ctx, &results, query)
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve all DataSets. error: %w", err)
 	}
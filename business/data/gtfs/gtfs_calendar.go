@@ -1,6 +1,7 @@
 package gtfs
 
 import (
+	"context"
 	"fmt"
 	"github.com/jmoiron/sqlx"
 	"strings"
@@ -81,36 +82,65 @@ func RecordCalendarDate(calendarDate *CalendarDate, dsTx *DataSetTransaction) er
 }
 
 // GetActiveServiceIdsBetween retrieves the active serviceIds active on startDate, on and up to endDate.
-// both calendar and calendar_date are used
-func GetActiveServiceIdsBetween(db *sqlx.DB,
+// both calendar and calendar_date are used. Dates are taken in the DataSet's Location
+func GetActiveServiceIdsBetween(ctx context.Context,
+	db *sqlx.DB,
 	dataSet *DataSet,
 	startDate time.Time,
 	endDate time.Time) ([]string, error) {
 
+	weekdaysByServiceId, err := GetServiceWeekdaysBetween(ctx, db, dataSet, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
 	serviceIdMap := make(map[string]bool)
-	currentDate := startDate
+	for serviceId := range weekdaysByServiceId {
+		serviceIdMap[serviceId] = true
+	}
+	return trueStringsFromMap(serviceIdMap), nil
+}
+
+// GetServiceWeekdaysBetween retrieves the weekdays, by time.Weekday, each serviceId is active on from startDate, on
+// and up to endDate, keyed by serviceId. Dates are taken in the DataSet's Location
+func GetServiceWeekdaysBetween(ctx context.Context,
+	db *sqlx.DB,
+	dataSet *DataSet,
+	startDate time.Time,
+	endDate time.Time) (map[string]map[time.Weekday]bool, error) {
+
+	weekdaysByServiceId := make(map[string]map[time.Weekday]bool)
+	currentDate := startDate.In(dataSet.Location())
 
 	for currentDate.Unix() <= endDate.Unix() {
-		serviceIds, err := GetActiveServiceIds(db, dataSet, currentDate)
+		serviceIds, err := GetActiveServiceIds(ctx, db, dataSet, currentDate)
 		if err != nil {
 			return nil, fmt.Errorf("unable to retrieve service ids between %s and %s error: %w",
 				startDate, endDate, err)
 		}
 		for _, serviceId := range serviceIds {
-			serviceIdMap[serviceId] = true
+			weekdays, present := weekdaysByServiceId[serviceId]
+			if !present {
+				weekdays = make(map[time.Weekday]bool)
+				weekdaysByServiceId[serviceId] = weekdays
+			}
+			weekdays[currentDate.Weekday()] = true
 		}
 		currentDate = currentDate.AddDate(0, 0, 1)
 
 	}
 
-	return trueStringsFromMap(serviceIdMap), nil
+	return weekdaysByServiceId, nil
 }
 
-// GetActiveServiceIds retrieves the active serviceIds on provided serviceDate.
-// both calendar and calendar_date are used
-func GetActiveServiceIds(db *sqlx.DB, dataSet *DataSet, serviceDate time.Time) ([]string, error) {
-	serviceIdMap := make(map[string]bool)
+// serviceDateParameter formats serviceDate as a date query parameter. Passing the time itself would have the database
+// convert it to its own time zone, which can fall on another date than the one in serviceDate's location
+func serviceDateParameter(serviceDate time.Time) string {
+	return serviceDate.Format("2006-01-02")
+}
 
+// GetActiveServiceIds retrieves the active serviceIds on provided serviceDate.
+// both calendar and calendar_date are used, either may be empty as feeds may define service with only one of them
+func GetActiveServiceIds(ctx context.Context, db *sqlx.DB, dataSet *DataSet, serviceDate time.Time) ([]string, error) {
 	// the calendar week days columns are named after the english weekdays
 	weekday := strings.ToLower(serviceDate.Weekday().String())
 
@@ -118,21 +148,29 @@ func GetActiveServiceIds(db *sqlx.DB, dataSet *DataSet, serviceDate time.Time) (
 		"and $2 between start_date and end_date "+
 		"and %s = 1", weekday)
 	var calendarServiceKeys []string
-	err := db.Select(&calendarServiceKeys, query, dataSet.Id, serviceDate)
+	err := db.SelectContext(ctx, &calendarServiceKeys, query, dataSet.Id, serviceDateParameter(serviceDate))
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve service_ids from calendar table. query:%s error: %w", query, err)
 	}
 
-	for _, serviceId := range calendarServiceKeys {
-		serviceIdMap[serviceId] = true
-	}
-
 	var calendarDates []CalendarDate
 	query = "select * from calendar_date where data_set_id = $1 and date = $2"
-	err = db.Select(&calendarDates, query, dataSet.Id, serviceDate)
+	err = db.SelectContext(ctx, &calendarDates, query, dataSet.Id, serviceDateParameter(serviceDate))
 	if err != nil {
 		return nil, fmt.Errorf("unable to query calendar_date table. query:%s error: %w", query, err)
 	}
+
+	return activeServiceIds(calendarServiceKeys, calendarDates), nil
+}
+
+// activeServiceIds returns the serviceIds active on a service date, starting with calendarServiceIds scheduled by
+// calendar on the date, adding and removing serviceIds according to the calendarDates on the date.
+// Removing a serviceId calendar does not schedule has no effect
+func activeServiceIds(calendarServiceIds []string, calendarDates []CalendarDate) []string {
+	serviceIdMap := make(map[string]bool)
+	for _, serviceId := range calendarServiceIds {
+		serviceIdMap[serviceId] = true
+	}
 	for _, calendarDate := range calendarDates {
 		if calendarDate.ExceptionType == 1 {
 			serviceIdMap[calendarDate.ServiceId] = true
@@ -140,6 +178,46 @@ func GetActiveServiceIds(db *sqlx.DB, dataSet *DataSet, serviceDate time.Time) (
 			delete(serviceIdMap, calendarDate.ServiceId)
 		}
 	}
+	return trueStringsFromMap(serviceIdMap)
+}
 
-	return trueStringsFromMap(serviceIdMap), nil
+// ServiceException flags departures from the regular weekly calendar on a service date, such as holidays and
+// reduced service days, as recorded in calendar_date
+type ServiceException struct {
+	//ServiceAdded is true when calendar_date adds service that calendar does not schedule on the date
+	ServiceAdded bool `json:"service_added"`
+	//ServiceReduced is true when calendar_date removes service that calendar schedules on the date
+	ServiceReduced bool `json:"service_reduced"`
+}
+
+// makeServiceException builds ServiceException from the calendar_date exception types on a service date
+func makeServiceException(exceptionTypes []int) ServiceException {
+	result := ServiceException{}
+	for _, exceptionType := range exceptionTypes {
+		if exceptionType == 1 {
+			result.ServiceAdded = true
+		} else if exceptionType == 2 {
+			result.ServiceReduced = true
+		}
+	}
+	return result
+}
+
+// GetServiceException retrieves the ServiceException for serviceDate in dataSetId.
+// only calendar_date records for service_ids that also appear in calendar are considered, so feeds that schedule
+// service entirely with calendar_date are not flagged on every day
+func GetServiceException(ctx context.Context,
+	db *sqlx.DB,
+	dataSetId int64,
+	serviceDate time.Time) (ServiceException, error) {
+	query := "select distinct cd.exception_type from calendar_date cd " +
+		"where cd.data_set_id = $1 and cd.date = $2 " +
+		"and exists (select 1 from calendar c where c.data_set_id = cd.data_set_id and c.service_id = cd.service_id)"
+	var exceptionTypes []int
+	err := db.SelectContext(ctx, &exceptionTypes, query, dataSetId, serviceDateParameter(serviceDate))
+	if err != nil {
+		return ServiceException{}, fmt.Errorf("unable to retrieve service exceptions on %s. query:%s error: %w",
+			serviceDate.Format("2006-01-02"), query, err)
+	}
+	return makeServiceException(exceptionTypes), nil
 }
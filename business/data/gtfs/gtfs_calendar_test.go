@@ -0,0 +1,90 @@
+package gtfs
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func Test_makeServiceException(t *testing.T) {
+	tests := []struct {
+		name           string
+		exceptionTypes []int
+		want           ServiceException
+	}{
+		{
+			name: "no exceptions",
+			want: ServiceException{},
+		},
+		{
+			name:           "service added",
+			exceptionTypes: []int{1},
+			want:           ServiceException{ServiceAdded: true},
+		},
+		{
+			name:           "service removed and replaced",
+			exceptionTypes: []int{2, 1},
+			want:           ServiceException{ServiceAdded: true, ServiceReduced: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := makeServiceException(tt.exceptionTypes); got != tt.want {
+				t.Errorf("makeServiceException() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_activeServiceIds(t *testing.T) {
+	tests := []struct {
+		name               string
+		calendarServiceIds []string
+		calendarDates      []CalendarDate
+		want               []string
+	}{
+		{
+			name:               "calendar only",
+			calendarServiceIds: []string{"W", "A"},
+			want:               []string{"A", "W"},
+		},
+		{
+			name: "calendar_dates only",
+			calendarDates: []CalendarDate{
+				{ServiceId: "20220522", ExceptionType: 1},
+				{ServiceId: "SUNDAY", ExceptionType: 1},
+			},
+			want: []string{"20220522", "SUNDAY"},
+		},
+		{
+			name: "calendar_dates only removing service never added",
+			calendarDates: []CalendarDate{
+				{ServiceId: "SUNDAY", ExceptionType: 1},
+				{ServiceId: "HOLIDAY", ExceptionType: 2},
+			},
+			want: []string{"SUNDAY"},
+		},
+		{
+			name:               "calendar with exceptions",
+			calendarServiceIds: []string{"W", "A"},
+			calendarDates: []CalendarDate{
+				{ServiceId: "W", ExceptionType: 2},
+				{ServiceId: "S", ExceptionType: 1},
+			},
+			want: []string{"A", "S"},
+		},
+		{
+			name: "no service",
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := activeServiceIds(tt.calendarServiceIds, tt.calendarDates)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("activeServiceIds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package gtfs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDataSet_Location(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		want     string
+	}{
+		{name: "agency timezone", timezone: "Europe/Berlin", want: "Europe/Berlin"},
+		{name: "no timezone", timezone: "", want: time.Local.String()},
+		{name: "unknown timezone", timezone: "America/Portland", want: time.Local.String()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &DataSet{Timezone: tt.timezone}
+			if got := d.Location().String(); got != tt.want {
+				t.Errorf("Location() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDataSet_ServiceDate(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("Unable to get testing time zone location")
+	}
+	d := &DataSet{Timezone: "Europe/Berlin"}
+	// 11pm on the 30th in Los Angeles is the 31st in Berlin, the calendar day given is used regardless
+	at := time.Date(2019, 3, 30, 23, 0, 0, 0, time.FixedZone("PDT", -7*60*60))
+	got := d.ServiceDate(at.Date())
+	want := time.Date(2019, 3, 30, 0, 0, 0, 0, berlin)
+	if !got.Equal(want) || got.Location().String() != berlin.String() {
+		t.Errorf("ServiceDate() = %v, want %v", got, want)
+	}
+	// the first trip of the day clocks move forward in Berlin is measured from 11pm the day before
+	serviceDate := d.ServiceDate(2019, time.March, 31)
+	if got := MakeScheduleTime(serviceDate, 5*60*60); !got.Equal(time.Date(2019, 3, 31, 5, 0, 0, 0, berlin)) {
+		t.Errorf("MakeScheduleTime() = %v, want 5am", got)
+	}
+}
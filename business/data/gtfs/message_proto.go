@@ -0,0 +1,255 @@
+package gtfs
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/transitcastproto"
+	"google.golang.org/protobuf/proto"
+	"time"
+)
+
+// MarshalProto encodes VehicleMonitorResults as a transitcastproto.VehicleMonitorResults protocol buffer
+func (v *VehicleMonitorResults) MarshalProto() ([]byte, error) {
+	message := &transitcastproto.VehicleMonitorResults{
+		VehicleId: v.VehicleId,
+	}
+	for _, observation := range v.ObservedStopTimes {
+		message.ObservedStopTimes = append(message.ObservedStopTimes, observedStopTimeToProto(observation))
+	}
+	for _, deviation := range v.TripDeviations {
+		message.TripDeviations = append(message.TripDeviations, tripDeviationToProto(deviation))
+	}
+	return proto.Marshal(message)
+}
+
+// UnmarshalProto decodes a transitcastproto.VehicleMonitorResults protocol buffer into VehicleMonitorResults
+func (v *VehicleMonitorResults) UnmarshalProto(data []byte) error {
+	var message transitcastproto.VehicleMonitorResults
+	if err := proto.Unmarshal(data, &message); err != nil {
+		return err
+	}
+	v.VehicleId = message.VehicleId
+	v.ObservedStopTimes = nil
+	for _, observation := range message.ObservedStopTimes {
+		v.ObservedStopTimes = append(v.ObservedStopTimes, observedStopTimeFromProto(observation))
+	}
+	v.TripDeviations = nil
+	for _, deviation := range message.TripDeviations {
+		v.TripDeviations = append(v.TripDeviations, tripDeviationFromProto(deviation))
+	}
+	return nil
+}
+
+// MarshalProto encodes TripUpdate as a transitcastproto.TripUpdate protocol buffer
+func (t *TripUpdate) MarshalProto() ([]byte, error) {
+	message := &transitcastproto.TripUpdate{
+		TripId:               t.TripId,
+		RouteId:              t.RouteId,
+		ScheduleRelationship: t.ScheduleRelationship,
+		Timestamp:            t.Timestamp,
+		VehicleId:            t.VehicleId,
+		SchemaVersion:        int32(t.SchemaVersion),
+	}
+	for _, update := range t.StopTimeUpdates {
+		message.StopTimeUpdate = append(message.StopTimeUpdate, &transitcastproto.StopTimeUpdate{
+			StopSequence:           update.StopSequence,
+			StopId:                 update.StopId,
+			ArrivalDelay:           int32(update.ArrivalDelay),
+			ScheduledArrivalTime:   unixNano(update.ScheduledArrivalTime),
+			PredictedArrivalTime:   unixNano(update.PredictedArrivalTime),
+			ScheduledDepartureTime: optionalUnixNano(update.ScheduledDepartureTime),
+			PredictedDepartureTime: optionalUnixNano(update.PredictedDepartureTime),
+			DepartureDelay:         optionalInt32(update.DepartureDelay),
+			PredictionSource:       int32(update.PredictionSource),
+		})
+	}
+	return proto.Marshal(message)
+}
+
+// UnmarshalProto decodes a transitcastproto.TripUpdate protocol buffer into TripUpdate
+func (t *TripUpdate) UnmarshalProto(data []byte) error {
+	var message transitcastproto.TripUpdate
+	if err := proto.Unmarshal(data, &message); err != nil {
+		return err
+	}
+	t.TripId = message.TripId
+	t.RouteId = message.RouteId
+	t.ScheduleRelationship = message.ScheduleRelationship
+	t.Timestamp = message.Timestamp
+	t.VehicleId = message.VehicleId
+	t.SchemaVersion = int(message.SchemaVersion)
+	t.StopTimeUpdates = nil
+	for _, update := range message.StopTimeUpdate {
+		t.StopTimeUpdates = append(t.StopTimeUpdates, StopTimeUpdate{
+			StopSequence:           update.StopSequence,
+			StopId:                 update.StopId,
+			ArrivalDelay:           int(update.ArrivalDelay),
+			ScheduledArrivalTime:   fromUnixNano(update.ScheduledArrivalTime),
+			PredictedArrivalTime:   fromUnixNano(update.PredictedArrivalTime),
+			ScheduledDepartureTime: optionalFromUnixNano(update.ScheduledDepartureTime),
+			PredictedDepartureTime: optionalFromUnixNano(update.PredictedDepartureTime),
+			DepartureDelay:         optionalInt(update.DepartureDelay),
+			PredictionSource:       PredictionSource(update.PredictionSource),
+		})
+	}
+	return nil
+}
+
+func observedStopTimeToProto(o *ObservedStopTime) *transitcastproto.ObservedStopTime {
+	return &transitcastproto.ObservedStopTime{
+		ObservedTime:       unixNano(o.ObservedTime),
+		StopId:             o.StopId,
+		NextStopId:         o.NextStopId,
+		VehicleId:          o.VehicleId,
+		RouteId:            o.RouteId,
+		ObservedAtStop:     o.ObservedAtStop,
+		ObservedAtNextStop: o.ObservedAtNextStop,
+		StopDistance:       o.StopDistance,
+		NextStopDistance:   o.NextStopDistance,
+		TravelSeconds:      int32(o.TravelSeconds),
+		ScheduledSeconds:   optionalInt32(o.ScheduledSeconds),
+		ScheduledTime:      optionalInt32(o.ScheduledTime),
+		DataSetId:          o.DataSetId,
+		TripId:             o.TripId,
+		CreatedAt:          unixNano(o.CreatedAt),
+		SchemaVersion:      int32(o.SchemaVersion),
+		Confidence:         o.Confidence,
+	}
+}
+
+func observedStopTimeFromProto(o *transitcastproto.ObservedStopTime) *ObservedStopTime {
+	return &ObservedStopTime{
+		ObservedTime:       fromUnixNano(o.ObservedTime),
+		StopId:             o.StopId,
+		NextStopId:         o.NextStopId,
+		VehicleId:          o.VehicleId,
+		RouteId:            o.RouteId,
+		ObservedAtStop:     o.ObservedAtStop,
+		ObservedAtNextStop: o.ObservedAtNextStop,
+		StopDistance:       o.StopDistance,
+		NextStopDistance:   o.NextStopDistance,
+		TravelSeconds:      int(o.TravelSeconds),
+		ScheduledSeconds:   optionalInt(o.ScheduledSeconds),
+		ScheduledTime:      optionalInt(o.ScheduledTime),
+		DataSetId:          o.DataSetId,
+		TripId:             o.TripId,
+		CreatedAt:          fromUnixNano(o.CreatedAt),
+		SchemaVersion:      int(o.SchemaVersion),
+		Confidence:         o.Confidence,
+	}
+}
+
+func tripDeviationToProto(t *TripDeviation) *transitcastproto.TripDeviation {
+	return &transitcastproto.TripDeviation{
+		CreatedAt:          unixNano(t.CreatedAt),
+		DeviationTimestamp: unixNano(t.DeviationTimestamp),
+		TripProgress:       t.TripProgress,
+		DataSetId:          t.DataSetId,
+		TripId:             t.TripId,
+		VehicleId:          t.VehicleId,
+		AtStop:             t.AtStop,
+		Delay:              int32(t.Delay),
+		RouteId:            t.RouteId,
+		ServiceDate:        unixNano(t.ServiceDate),
+		ServiceDay:         serviceDay(t.ServiceDate),
+		ServiceException: &transitcastproto.ServiceException{
+			ServiceAdded:   t.ServiceException.ServiceAdded,
+			ServiceReduced: t.ServiceException.ServiceReduced,
+		},
+		SchemaVersion: int32(t.SchemaVersion),
+	}
+}
+
+func tripDeviationFromProto(t *transitcastproto.TripDeviation) *TripDeviation {
+	return &TripDeviation{
+		CreatedAt:          fromUnixNano(t.CreatedAt),
+		DeviationTimestamp: fromUnixNano(t.DeviationTimestamp),
+		TripProgress:       t.TripProgress,
+		DataSetId:          t.DataSetId,
+		TripId:             t.TripId,
+		VehicleId:          t.VehicleId,
+		AtStop:             t.AtStop,
+		Delay:              int(t.Delay),
+		RouteId:            t.RouteId,
+		ServiceDate:        serviceDateFromProto(t.ServiceDate, t.ServiceDay),
+		ServiceException: ServiceException{
+			ServiceAdded:   t.ServiceException.GetServiceAdded(),
+			ServiceReduced: t.ServiceException.GetServiceReduced(),
+		},
+		SchemaVersion: int(t.SchemaVersion),
+	}
+}
+
+// unixNano returns t as unix nanoseconds, or zero when t is the zero time
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano returns the time of unix nanoseconds, or the zero time when nanoseconds is zero
+func fromUnixNano(nanoseconds int64) time.Time {
+	if nanoseconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanoseconds)
+}
+
+// serviceDay returns the calendar day of serviceDate in its own location as yyyy-mm-dd, or "" when it is the zero time
+func serviceDay(serviceDate time.Time) string {
+	if serviceDate.IsZero() {
+		return ""
+	}
+	return serviceDate.Format("2006-01-02")
+}
+
+// serviceDateFromProto returns the service date at unix nanoseconds in a fixed zone whose calendar day is day, keeping
+// the offset of the data set's location the service date was written in. Unix nanoseconds alone would place the
+// service date in the local time zone, moving it onto the previous day for agencies east of it. Messages written
+// without day use the local time zone
+func serviceDateFromProto(nanoseconds int64, day string) time.Time {
+	serviceDate := fromUnixNano(nanoseconds)
+	if serviceDate.IsZero() || day == "" {
+		return serviceDate
+	}
+	midnight, err := time.Parse("2006-01-02", day)
+	if err != nil {
+		return serviceDate
+	}
+	offset := midnight.Unix() - serviceDate.Unix()
+	if offset <= -24*60*60 || offset >= 24*60*60 {
+		return serviceDate
+	}
+	return serviceDate.In(time.FixedZone("", int(offset)))
+}
+
+func optionalUnixNano(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+	nanoseconds := unixNano(*t)
+	return &nanoseconds
+}
+
+func optionalFromUnixNano(nanoseconds *int64) *time.Time {
+	if nanoseconds == nil {
+		return nil
+	}
+	t := fromUnixNano(*nanoseconds)
+	return &t
+}
+
+func optionalInt32(value *int) *int32 {
+	if value == nil {
+		return nil
+	}
+	converted := int32(*value)
+	return &converted
+}
+
+func optionalInt(value *int32) *int {
+	if value == nil {
+		return nil
+	}
+	converted := int(*value)
+	return &converted
+}
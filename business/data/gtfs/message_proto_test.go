@@ -0,0 +1,138 @@
+package gtfs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVehicleMonitorResults_protoRoundTrip(t *testing.T) {
+	observedTime := time.Unix(1653238800, 0)
+	scheduledSeconds := 120
+	results := VehicleMonitorResults{
+		VehicleId: "200",
+		ObservedStopTimes: []*ObservedStopTime{
+			{
+				ObservedTime:     observedTime,
+				StopId:           "A",
+				NextStopId:       "B",
+				VehicleId:        "200",
+				RouteId:          "100",
+				ObservedAtStop:   true,
+				StopDistance:     10.5,
+				NextStopDistance: 420.25,
+				TravelSeconds:    95,
+				ScheduledSeconds: &scheduledSeconds,
+				DataSetId:        3,
+				TripId:           "9529801",
+				CreatedAt:        observedTime.Add(time.Second),
+				SchemaVersion:    MessageSchemaVersion,
+				Confidence:       0.72,
+			},
+		},
+		TripDeviations: []*TripDeviation{
+			{
+				DeviationTimestamp: observedTime,
+				TripProgress:       -120.5,
+				DataSetId:          3,
+				TripId:             "9529801",
+				VehicleId:          "200",
+				Delay:              -30,
+				RouteId:            "100",
+				ServiceException:   ServiceException{ServiceAdded: true},
+				SchemaVersion:      MessageSchemaVersion,
+			},
+		},
+	}
+	data, err := results.MarshalProto()
+	if err != nil {
+		t.Fatalf("MarshalProto() error = %v", err)
+	}
+	var got VehicleMonitorResults
+	if err = got.UnmarshalProto(data); err != nil {
+		t.Fatalf("UnmarshalProto() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, results) {
+		t.Errorf("UnmarshalProto() = %+v, want %+v", got, results)
+	}
+}
+
+func TestTripDeviation_protoServiceDate(t *testing.T) {
+	// decoding mustn't depend on the time zone of the process reading the message
+	local := time.Local
+	time.Local = time.UTC
+	defer func() {
+		time.Local = local
+	}()
+	for _, zone := range []string{"Europe/Berlin", "Asia/Tokyo", "America/Los_Angeles", "Pacific/Auckland"} {
+		location, err := time.LoadLocation(zone)
+		if err != nil {
+			t.Fatalf("unable to load location %s: %v", zone, err)
+		}
+		serviceDate := time.Date(2021, 10, 14, 0, 0, 0, 0, location)
+		got := tripDeviationFromProto(tripDeviationToProto(&TripDeviation{TripId: "9529801", ServiceDate: serviceDate}))
+		if !got.ServiceDate.Equal(serviceDate) {
+			t.Errorf("%s ServiceDate = %v, want %v", zone, got.ServiceDate, serviceDate)
+		}
+		if year, month, day := got.ServiceDate.Date(); year != 2021 || month != 10 || day != 14 {
+			t.Errorf("%s ServiceDate calendar day = %d-%d-%d, want 2021-10-14", zone, year, month, day)
+		}
+		_, gotOffset := got.ServiceDate.Zone()
+		if _, wantOffset := serviceDate.Zone(); gotOffset != wantOffset {
+			t.Errorf("%s ServiceDate offset = %d, want %d", zone, gotOffset, wantOffset)
+		}
+	}
+
+	// messages written before service_day was added fall back to the local time zone
+	legacy := tripDeviationToProto(&TripDeviation{ServiceDate: time.Date(2021, 10, 14, 0, 0, 0, 0, time.UTC)})
+	legacy.ServiceDay = ""
+	if got := tripDeviationFromProto(legacy).ServiceDate; got.Format("2006-01-02") != "2021-10-14" {
+		t.Errorf("legacy ServiceDate = %v, want 2021-10-14", got)
+	}
+}
+
+func TestTripUpdate_protoRoundTrip(t *testing.T) {
+	arrival := time.Unix(1653238800, 0)
+	departure := arrival.Add(30 * time.Second)
+	departureDelay := 45
+	tripUpdate := TripUpdate{
+		TripId:               "9529801",
+		RouteId:              "100",
+		ScheduleRelationship: "SCHEDULED",
+		Timestamp:            1653238700,
+		VehicleId:            "200",
+		StopTimeUpdates: []StopTimeUpdate{
+			{
+				StopSequence:         1,
+				StopId:               "A",
+				ArrivalDelay:         15,
+				ScheduledArrivalTime: arrival,
+				PredictedArrivalTime: arrival.Add(15 * time.Second),
+				PredictionSource:     StopMLPrediction,
+			},
+			{
+				StopSequence:           2,
+				StopId:                 "B",
+				ArrivalDelay:           45,
+				ScheduledArrivalTime:   arrival,
+				PredictedArrivalTime:   arrival.Add(45 * time.Second),
+				ScheduledDepartureTime: &departure,
+				PredictedDepartureTime: &departure,
+				DepartureDelay:         &departureDelay,
+				PredictionSource:       SchedulePrediction,
+			},
+		},
+		SchemaVersion: MessageSchemaVersion,
+	}
+	data, err := tripUpdate.MarshalProto()
+	if err != nil {
+		t.Fatalf("MarshalProto() error = %v", err)
+	}
+	var got TripUpdate
+	if err = got.UnmarshalProto(data); err != nil {
+		t.Fatalf("UnmarshalProto() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, tripUpdate) {
+		t.Errorf("UnmarshalProto() = %+v, want %+v", got, tripUpdate)
+	}
+}
@@ -1,6 +1,10 @@
 package gtfs
 
 import (
+	"context"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/foundation/database"
+	"github.com/jackc/pgx/pgtype"
 	"github.com/jmoiron/sqlx"
 	"time"
 )
@@ -39,6 +43,21 @@ type ObservedStopTime struct {
 	DataSetId int64     `db:"data_set_id" json:"data_set_id"`
 	TripId    string    `db:"trip_id" json:"trip_id"`
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	//Confidence from just above 0.0 to 1.0 of how closely TravelSeconds reflects the vehicle's actual travel, lowered
+	//when the vehicle wasn't seen at the stops, when travel was interpolated over several stops and when positions
+	//couldn't be placed on the trip's shape. Zero when not scored, as for observations made before scoring was added
+	Confidence float64 `db:"confidence" json:"confidence"`
+	//SchemaVersion is the MessageSchemaVersion of the app publishing the ObservedStopTime, not recorded to the database
+	SchemaVersion int `db:"-" json:"schema_version"`
+}
+
+// ConfidenceWeight returns Confidence for weighting the ObservedStopTime against others, or 1.0 when the
+// ObservedStopTime was not scored
+func (ost *ObservedStopTime) ConfidenceWeight() float64 {
+	if ost.Confidence <= 0 {
+		return 1
+	}
+	return ost.Confidence
 }
 
 // AssumedDepartTime returns the time the vehicle is assumed to have departed the from stopId, this is calculated
@@ -48,7 +67,7 @@ func (ost *ObservedStopTime) AssumedDepartTime() int {
 }
 
 // RecordObservedStopTime saves ObservedStopTime into database
-func RecordObservedStopTime(observation *ObservedStopTime, db *sqlx.DB) error {
+func RecordObservedStopTime(ctx context.Context, observation *ObservedStopTime, db *sqlx.DB) error {
 
 	statementString := "insert into observed_stop_time " +
 		"(observed_time, " +
@@ -65,7 +84,65 @@ func RecordObservedStopTime(observation *ObservedStopTime, db *sqlx.DB) error {
 		"scheduled_time, " +
 		"data_set_id, " +
 		"trip_id, " +
-		"created_at) " +
+		"created_at, " +
+		"confidence) " +
+		"values " +
+		"(:observed_time, " +
+		":stop_id, " +
+		":stop_distance, " +
+		":next_stop_id, " +
+		":next_stop_distance, " +
+		":vehicle_id, " +
+		":route_id, " +
+		":observed_at_stop, " +
+		":observed_at_next_stop, " +
+		":travel_seconds, " +
+		":scheduled_seconds, " +
+		":scheduled_time, " +
+		":data_set_id, " +
+		":trip_id, " +
+		":created_at, " +
+		":confidence)"
+	statementString = db.Rebind(statementString)
+	_, err := db.NamedExecContext(ctx, statementString, observation)
+	return err
+}
+
+// QuarantinedObservedStopTime is an ObservedStopTime whose travel time was an outlier compared to recent
+// observations between the same stops. It is kept for review rather than used as training data
+type QuarantinedObservedStopTime struct {
+	ObservedStopTime
+	//ZScore is the number of standard deviations TravelSeconds was from MeanTravelSeconds
+	ZScore              float64 `db:"z_score" json:"z_score"`
+	MeanTravelSeconds   float64 `db:"mean_travel_seconds" json:"mean_travel_seconds"`
+	StdDevTravelSeconds float64 `db:"std_dev_travel_seconds" json:"std_dev_travel_seconds"`
+}
+
+// RecordQuarantinedObservedStopTime saves QuarantinedObservedStopTime into database
+func RecordQuarantinedObservedStopTime(ctx context.Context,
+	observation *QuarantinedObservedStopTime,
+	db *sqlx.DB) error {
+
+	statementString := "insert into observed_stop_time_quarantine " +
+		"(observed_time, " +
+		"stop_id, " +
+		"stop_distance, " +
+		"next_stop_id, " +
+		"next_stop_distance, " +
+		"vehicle_id, " +
+		"route_id, " +
+		"observed_at_stop, " +
+		"observed_at_next_stop, " +
+		"travel_seconds, " +
+		"scheduled_seconds, " +
+		"scheduled_time, " +
+		"data_set_id, " +
+		"trip_id, " +
+		"created_at, " +
+		"confidence, " +
+		"z_score, " +
+		"mean_travel_seconds, " +
+		"std_dev_travel_seconds) " +
 		"values " +
 		"(:observed_time, " +
 		":stop_id, " +
@@ -81,8 +158,150 @@ func RecordObservedStopTime(observation *ObservedStopTime, db *sqlx.DB) error {
 		":scheduled_time, " +
 		":data_set_id, " +
 		":trip_id, " +
-		":created_at)"
+		":created_at, " +
+		":confidence, " +
+		":z_score, " +
+		":mean_travel_seconds, " +
+		":std_dev_travel_seconds)"
 	statementString = db.Rebind(statementString)
-	_, err := db.NamedExec(statementString, observation)
+	_, err := db.NamedExecContext(ctx, statementString, observation)
 	return err
 }
+
+// GetObservedStopTimes returns all ObservedStopTimes observed between start and end ordered by observed_time
+func GetObservedStopTimes(ctx context.Context, db *sqlx.DB, start time.Time, end time.Time) ([]*ObservedStopTime, error) {
+	statementString := "select * from observed_stop_time where observed_time between :start and :end " +
+		"order by observed_time"
+	rows, err := database.PrepareNamedQueryRowsFromMapContext(ctx, statementString, db, map[string]interface{}{
+		"start": start,
+		"end":   end,
+	})
+
+	defer func() {
+		if rows != nil {
+			_ = rows.Close()
+		}
+	}()
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve observed_stop_time rows, error: %w", err)
+	}
+
+	observations := make([]*ObservedStopTime, 0)
+	for rows.Next() {
+		observation := ObservedStopTime{}
+		err = rows.StructScan(&observation)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan observed_stop_time row, error: %w", err)
+		}
+		observations = append(observations, &observation)
+	}
+	return observations, rows.Err()
+}
+
+// GetVehicleObservedStopTimes returns the ObservedStopTimes of vehicleId observed between start and end ordered by
+// observed_time
+func GetVehicleObservedStopTimes(ctx context.Context,
+	db *sqlx.DB,
+	start time.Time,
+	end time.Time,
+	vehicleId string) ([]*ObservedStopTime, error) {
+	statementString := "select * from observed_stop_time where observed_time between :start and :end " +
+		"and vehicle_id = :vehicle_id order by observed_time"
+	rows, err := database.PrepareNamedQueryRowsFromMapContext(ctx, statementString, db, map[string]interface{}{
+		"start":      start,
+		"end":        end,
+		"vehicle_id": vehicleId,
+	})
+
+	defer func() {
+		if rows != nil {
+			_ = rows.Close()
+		}
+	}()
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve observed_stop_time rows, error: %w", err)
+	}
+
+	observations := make([]*ObservedStopTime, 0)
+	for rows.Next() {
+		observation := ObservedStopTime{}
+		err = rows.StructScan(&observation)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan observed_stop_time row, error: %w", err)
+		}
+		observations = append(observations, &observation)
+	}
+	return observations, rows.Err()
+}
+
+// ScheduledObservedStopTime is an ObservedStopTime with details of the trip and scheduled stop it was observed on
+type ScheduledObservedStopTime struct {
+	ObservedStopTime
+	ServiceId    *string `db:"service_id" json:"service_id"`
+	BlockId      *string `db:"block_id" json:"block_id"`
+	ShapeId      *string `db:"shape_id" json:"shape_id"`
+	TripHeadsign *string `db:"trip_headsign" json:"trip_headsign"`
+	//TripStartTime is the trip's first scheduled arrival in seconds since midnight of the service date
+	TripStartTime *int `db:"trip_start_time" json:"trip_start_time"`
+	//StopSequence is the stop_sequence of StopId on the trip
+	StopSequence *int `db:"stop_sequence" json:"stop_sequence"`
+	Timepoint    *int `db:"timepoint" json:"timepoint"`
+	//ScheduledDepartureTime is the scheduled departure from StopId in seconds since midnight of the service date
+	ScheduledDepartureTime *int `db:"scheduled_departure_time" json:"scheduled_departure_time"`
+}
+
+// ForEachScheduledObservedStopTime calls fn with each ObservedStopTime observed between start and end, joined
+// with its trip and scheduled stop, ordered by observed_time. The scheduled stop is matched by stop_id, arrival time and
+// distance along the shape so stops visited twice on loop trips are told apart. Rows are read as they are needed so any number of
+// observations can be processed. When routeIds is not empty only observations on those routes are included.
+// stops and returns the error if fn returns an error
+func ForEachScheduledObservedStopTime(ctx context.Context,
+	db *sqlx.DB,
+	start time.Time,
+	end time.Time,
+	routeIds []string,
+	fn func(observation *ScheduledObservedStopTime) error) error {
+	statementString := "select o.*, t.service_id, t.block_id, t.shape_id, t.trip_headsign, " +
+		"t.start_time as trip_start_time, st.stop_sequence, st.timepoint, " +
+		"st.departure_time as scheduled_departure_time " +
+		"from observed_stop_time o " +
+		"left join trip t on t.data_set_id = o.data_set_id and t.trip_id = o.trip_id " +
+		"left join stop_time st on st.data_set_id = o.data_set_id and st.trip_id = o.trip_id " +
+		"and st.stop_id = o.stop_id and st.arrival_time = o.scheduled_time " +
+		"and st.shape_dist_traveled = o.stop_distance " +
+		"where o.observed_time between $1 and $2 "
+	args := []interface{}{start, end}
+	if len(routeIds) > 0 {
+		routeIdArray := pgtype.TextArray{}
+		err := routeIdArray.Set(routeIds)
+		if err != nil {
+			return fmt.Errorf("unable to use routeIds as query parameter: %w", err)
+		}
+		statementString += "and o.route_id = any($3) "
+		args = append(args, &routeIdArray)
+	}
+	statementString += "order by o.observed_time"
+
+	rows, err := db.QueryxContext(ctx, statementString, args...)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve observed_stop_time rows, error: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		observation := ScheduledObservedStopTime{}
+		err = rows.StructScan(&observation)
+		if err != nil {
+			return fmt.Errorf("unable to scan observed_stop_time row, error: %w", err)
+		}
+		err = fn(&observation)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,242 @@
+package gtfs
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PartitionedTables are the tables in the schema that are partitioned by range on a timestamp column
+var PartitionedTables = []string{"observed_stop_time", "trip_deviation"}
+
+// PartitionInterval is the span of time covered by each partition of a partitioned table
+type PartitionInterval int
+
+const (
+	DailyPartition PartitionInterval = iota
+	WeeklyPartition
+	MonthlyPartition
+)
+
+// ParsePartitionInterval returns the PartitionInterval matching name ("daily", "weekly" or "monthly")
+func ParsePartitionInterval(name string) (PartitionInterval, error) {
+	switch strings.ToLower(name) {
+	case "daily":
+		return DailyPartition, nil
+	case "weekly":
+		return WeeklyPartition, nil
+	case "monthly":
+		return MonthlyPartition, nil
+	}
+	return DailyPartition, fmt.Errorf("unknown partition interval \"%s\", expected daily, weekly or monthly", name)
+}
+
+func (p PartitionInterval) String() string {
+	switch p {
+	case DailyPartition:
+		return "daily"
+	case WeeklyPartition:
+		return "weekly"
+	case MonthlyPartition:
+		return "monthly"
+	}
+	return "unknown"
+}
+
+// startOfPartition returns the beginning of the partition containing "at" in UTC
+func (p PartitionInterval) startOfPartition(at time.Time) time.Time {
+	at = at.UTC()
+	switch p {
+	case WeeklyPartition:
+		// weeks begin on monday
+		daysSinceMonday := (int(at.Weekday()) + 6) % 7
+		return time.Date(at.Year(), at.Month(), at.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+	case MonthlyPartition:
+		return time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// nextPartitionStart returns the start of the partition following the one starting at "start"
+func (p PartitionInterval) nextPartitionStart(start time.Time) time.Time {
+	switch p {
+	case WeeklyPartition:
+		return start.AddDate(0, 0, 7)
+	case MonthlyPartition:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// partitionSuffix names a partition starting at "start", monthly partitions are named by year and month only
+func (p PartitionInterval) partitionSuffix(start time.Time) string {
+	if p == MonthlyPartition {
+		return start.Format("2006_01")
+	}
+	return start.Format("2006_01_02")
+}
+
+// TablePartition is a single range partition of a partitioned table covering From (inclusive) to To (exclusive)
+type TablePartition struct {
+	TableName     string
+	PartitionName string
+	From          time.Time
+	To            time.Time
+}
+
+func (t TablePartition) String() string {
+	return fmt.Sprintf("%s from %s to %s", t.PartitionName,
+		t.From.Format(time.RFC3339), t.To.Format(time.RFC3339))
+}
+
+// overlaps returns true if the range of TablePartition o intersects with the range of t
+func (t TablePartition) overlaps(o TablePartition) bool {
+	return t.From.Before(o.To) && o.From.Before(t.To)
+}
+
+// MakeTablePartitions builds count consecutive TablePartitions for tableName of the interval size, the first
+// partition contains "from". Partition boundaries are in UTC
+func MakeTablePartitions(tableName string, interval PartitionInterval, from time.Time, count int) []TablePartition {
+	partitions := make([]TablePartition, 0, count)
+	start := interval.startOfPartition(from)
+	for i := 0; i < count; i++ {
+		end := interval.nextPartitionStart(start)
+		partitions = append(partitions, TablePartition{
+			TableName:     tableName,
+			PartitionName: fmt.Sprintf("%s_part_%s", tableName, interval.partitionSuffix(start)),
+			From:          start,
+			To:            end,
+		})
+		start = end
+	}
+	return partitions
+}
+
+// RemoveOverlappingPartitions returns the partitions that do not intersect with any of the existing partitions
+func RemoveOverlappingPartitions(partitions []TablePartition, existing []TablePartition) []TablePartition {
+	results := make([]TablePartition, 0, len(partitions))
+	for _, partition := range partitions {
+		overlapping := false
+		for _, e := range existing {
+			if partition.overlaps(e) {
+				overlapping = true
+				break
+			}
+		}
+		if !overlapping {
+			results = append(results, partition)
+		}
+	}
+	return results
+}
+
+// CreateTablePartition creates partition in the database if a table of the same name isn't already present
+func CreateTablePartition(ctx context.Context, db *sqlx.DB, partition TablePartition) error {
+	statement := fmt.Sprintf("create table if not exists %s partition of %s for values from ('%s') to ('%s')",
+		partition.PartitionName, partition.TableName,
+		partition.From.Format(time.RFC3339), partition.To.Format(time.RFC3339))
+	_, err := db.ExecContext(ctx, statement)
+	if err != nil {
+		return fmt.Errorf("unable to create partition %s, error: %w", partition.PartitionName, err)
+	}
+	return nil
+}
+
+// DropTablePartition removes partition and all of its rows from the database
+func DropTablePartition(ctx context.Context, db *sqlx.DB, partition TablePartition) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf("drop table if exists %s", partition.PartitionName))
+	if err != nil {
+		return fmt.Errorf("unable to drop partition %s, error: %w", partition.PartitionName, err)
+	}
+	return nil
+}
+
+// tablePartitionRow contains a partition's name and the text of its bound expression
+type tablePartitionRow struct {
+	PartitionName  string `db:"partition_name"`
+	PartitionBound string `db:"partition_bound"`
+}
+
+// GetTablePartitions returns all range partitions currently attached to tableName, ordered by their start.
+// Default partitions are not included. tableName is found on the connection's search_path, so only the partitions
+// in the agency's schema are returned when several agencies share the database
+func GetTablePartitions(ctx context.Context, db *sqlx.DB, tableName string) ([]TablePartition, error) {
+	statementString := "select c.relname as partition_name, " +
+		"pg_get_expr(c.relpartbound, c.oid) as partition_bound " +
+		"from pg_inherits i " +
+		"join pg_class c on c.oid = i.inhrelid " +
+		"where i.inhparent = to_regclass($1)"
+
+	var rows []tablePartitionRow
+	err := db.SelectContext(ctx, &rows, statementString, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve partitions of %s, error: %w", tableName, err)
+	}
+
+	partitions := make([]TablePartition, 0, len(rows))
+	for _, row := range rows {
+		from, to, ok, err := parsePartitionBound(row.PartitionBound)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read bounds of partition %s, error: %w", row.PartitionName, err)
+		}
+		if !ok {
+			continue
+		}
+		partitions = append(partitions, TablePartition{
+			TableName:     tableName,
+			PartitionName: row.PartitionName,
+			From:          from,
+			To:            to,
+		})
+	}
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].From.Before(partitions[j].From)
+	})
+	return partitions, nil
+}
+
+// partitionBoundRegex matches the range bound expression postgres reports for a timestamp partition
+var partitionBoundRegex = regexp.MustCompile(`FOR VALUES FROM \('([^']+)'\) TO \('([^']+)'\)`)
+
+// partitionBoundLayouts are the timestamp formats postgres may use when reporting partition bounds
+var partitionBoundLayouts = []string{
+	"2006-01-02 15:04:05.999999-07",
+	"2006-01-02 15:04:05.999999-07:00",
+	"2006-01-02 15:04:05.999999",
+	"2006-01-02",
+}
+
+// parsePartitionBound extracts the range of a partition from its bound expression.
+// returns false if the expression is not a range with fixed values (such as a default partition or MINVALUE bound)
+func parsePartitionBound(bound string) (time.Time, time.Time, bool, error) {
+	if bound == "DEFAULT" || strings.Contains(bound, "MINVALUE") || strings.Contains(bound, "MAXVALUE") {
+		return time.Time{}, time.Time{}, false, nil
+	}
+	matches := partitionBoundRegex.FindStringSubmatch(bound)
+	if matches == nil {
+		return time.Time{}, time.Time{}, false, fmt.Errorf("unexpected partition bound \"%s\"", bound)
+	}
+	from, err := parsePartitionBoundTime(matches[1])
+	if err != nil {
+		return time.Time{}, time.Time{}, false, err
+	}
+	to, err := parsePartitionBoundTime(matches[2])
+	if err != nil {
+		return time.Time{}, time.Time{}, false, err
+	}
+	return from, to, true, nil
+}
+
+func parsePartitionBoundTime(value string) (time.Time, error) {
+	for _, layout := range partitionBoundLayouts {
+		result, err := time.Parse(layout, value)
+		if err == nil {
+			return result.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unable to parse partition bound time \"%s\"", value)
+}
@@ -0,0 +1,157 @@
+package gtfs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMakeTablePartitions(t *testing.T) {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Errorf("Unable to get testing time zone location")
+		return
+	}
+	type args struct {
+		interval PartitionInterval
+		from     time.Time
+		count    int
+	}
+	tests := []struct {
+		name string
+		args args
+		want []TablePartition
+	}{
+		{
+			name: "daily partitions in utc",
+			args: args{
+				interval: DailyPartition,
+				from:     time.Date(2021, 8, 31, 20, 0, 0, 0, location),
+				count:    2,
+			},
+			want: []TablePartition{
+				{
+					TableName:     "observed_stop_time",
+					PartitionName: "observed_stop_time_part_2021_09_01",
+					From:          time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC),
+					To:            time.Date(2021, 9, 2, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					TableName:     "observed_stop_time",
+					PartitionName: "observed_stop_time_part_2021_09_02",
+					From:          time.Date(2021, 9, 2, 0, 0, 0, 0, time.UTC),
+					To:            time.Date(2021, 9, 3, 0, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			name: "weekly partitions start on monday",
+			args: args{
+				interval: WeeklyPartition,
+				from:     time.Date(2021, 8, 29, 12, 0, 0, 0, time.UTC),
+				count:    1,
+			},
+			want: []TablePartition{
+				{
+					TableName:     "observed_stop_time",
+					PartitionName: "observed_stop_time_part_2021_08_23",
+					From:          time.Date(2021, 8, 23, 0, 0, 0, 0, time.UTC),
+					To:            time.Date(2021, 8, 30, 0, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			name: "monthly partitions across year",
+			args: args{
+				interval: MonthlyPartition,
+				from:     time.Date(2021, 12, 15, 0, 0, 0, 0, time.UTC),
+				count:    2,
+			},
+			want: []TablePartition{
+				{
+					TableName:     "observed_stop_time",
+					PartitionName: "observed_stop_time_part_2021_12",
+					From:          time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC),
+					To:            time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					TableName:     "observed_stop_time",
+					PartitionName: "observed_stop_time_part_2022_01",
+					From:          time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+					To:            time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MakeTablePartitions("observed_stop_time", tt.args.interval, tt.args.from, tt.args.count)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MakeTablePartitions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveOverlappingPartitions(t *testing.T) {
+	existing := MakeTablePartitions("trip_deviation", MonthlyPartition,
+		time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC), 1)
+	wanted := MakeTablePartitions("trip_deviation", WeeklyPartition,
+		time.Date(2021, 8, 23, 0, 0, 0, 0, time.UTC), 3)
+
+	got := RemoveOverlappingPartitions(wanted, existing)
+	if !reflect.DeepEqual(got, wanted[2:]) {
+		t.Errorf("RemoveOverlappingPartitions() = %v, want %v", got, wanted[2:])
+	}
+}
+
+func Test_parsePartitionBound(t *testing.T) {
+	tests := []struct {
+		name     string
+		bound    string
+		wantFrom time.Time
+		wantTo   time.Time
+		wantOk   bool
+		wantErr  bool
+	}{
+		{
+			name:     "utc bound",
+			bound:    "FOR VALUES FROM ('2021-08-01 00:00:00+00') TO ('2021-09-01 00:00:00+00')",
+			wantFrom: time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC),
+			wantTo:   time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC),
+			wantOk:   true,
+		},
+		{
+			name:     "offset bound",
+			bound:    "FOR VALUES FROM ('2021-08-01 00:00:00-07') TO ('2021-08-02 00:00:00-07')",
+			wantFrom: time.Date(2021, 8, 1, 7, 0, 0, 0, time.UTC),
+			wantTo:   time.Date(2021, 8, 2, 7, 0, 0, 0, time.UTC),
+			wantOk:   true,
+		},
+		{
+			name:   "default partition",
+			bound:  "DEFAULT",
+			wantOk: false,
+		},
+		{
+			name:    "unexpected bound",
+			bound:   "FOR VALUES IN ('A')",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, ok, err := parsePartitionBound(tt.bound)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parsePartitionBound() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if ok != tt.wantOk {
+				t.Errorf("parsePartitionBound() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo) {
+				t.Errorf("parsePartitionBound() = %v, %v, want %v, %v", from, to, tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package gtfs
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// PositionDiscardCount is the number of vehicle positions gtfs-monitor discarded for Reason on the UTC date DiscardDate
+type PositionDiscardCount struct {
+	DiscardDate time.Time `db:"discard_date" json:"discard_date"`
+	Reason      string    `db:"reason" json:"reason"`
+	Count       int64     `db:"discard_count" json:"discard_count"`
+}
+
+// RecordPositionDiscardCounts adds counts to those already saved for their date and reason
+func RecordPositionDiscardCounts(ctx context.Context, db *sqlx.DB, counts []PositionDiscardCount) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	statementString := "insert into position_discard_count (discard_date, reason, discard_count) " +
+		"values (:discard_date, :reason, :discard_count) " +
+		"on conflict (discard_date, reason) " +
+		"do update set discard_count = position_discard_count.discard_count + excluded.discard_count"
+	statementString = db.Rebind(statementString)
+	_, err := db.NamedExecContext(ctx, statementString, counts)
+	return err
+}
+
@@ -0,0 +1,131 @@
+package gtfs
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/pgtype"
+	"github.com/jmoiron/sqlx"
+	"sort"
+	"time"
+)
+
+// ScheduleRepository provides read access to gtfs schedules loaded by gtfs-loader, so other Go services can use the
+// loaded schedule without parsing gtfs files themselves.
+//
+// Schedules are loaded as DataSets. GetActiveDataSet finds the DataSet in effect at a time, its Id is then used to
+// query the schedule it contains. Times returned in TripInstance and StopTimeInstance are in the DataSet's Location,
+// the agency's time zone from agency.txt.
+type ScheduleRepository interface {
+
+	// GetActiveDataSet returns the DataSet in effect at "at"
+	GetActiveDataSet(ctx context.Context, at time.Time) (*DataSet, error)
+
+	// GetTripInstance returns the TripInstance for tripId in dataSetId, scheduled on the service date closest to "at",
+	// including its StopTimeInstances
+	GetTripInstance(ctx context.Context, dataSetId int64, tripId string, at time.Time) (*TripInstance, error)
+
+	// StopTimesForStop returns the StopTimeInstances in dataSetId scheduled to depart stopId from start up to end,
+	// in order of departure
+	StopTimesForStop(ctx context.Context,
+		dataSetId int64,
+		stopId string,
+		start time.Time,
+		end time.Time) ([]*StopTimeInstance, error)
+}
+
+// DBScheduleRepository implements ScheduleRepository with a database connection
+type DBScheduleRepository struct {
+	db                     *sqlx.DB
+	tripSearchRangeSeconds int
+}
+
+var _ ScheduleRepository = (*DBScheduleRepository)(nil)
+
+// MakeDBScheduleRepository builds DBScheduleRepository
+// trips are searched for within tripSearchRangeSeconds of the time requested
+func MakeDBScheduleRepository(db *sqlx.DB, tripSearchRangeSeconds int) *DBScheduleRepository {
+	return &DBScheduleRepository{
+		db:                     db,
+		tripSearchRangeSeconds: tripSearchRangeSeconds,
+	}
+}
+
+func (r *DBScheduleRepository) GetActiveDataSet(ctx context.Context, at time.Time) (*DataSet, error) {
+	return GetDataSetAt(ctx, r.db, at)
+}
+
+func (r *DBScheduleRepository) GetTripInstance(ctx context.Context,
+	dataSetId int64,
+	tripId string,
+	at time.Time) (*TripInstance, error) {
+	return GetTripInstance(ctx, r.db, dataSetId, tripId, at, r.tripSearchRangeSeconds, nil)
+}
+
+func (r *DBScheduleRepository) StopTimesForStop(ctx context.Context,
+	dataSetId int64,
+	stopId string,
+	start time.Time,
+	end time.Time) ([]*StopTimeInstance, error) {
+	dataSet, err := GetDataSet(ctx, r.db, dataSetId)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*StopTimeInstance, 0)
+	for _, slice := range GetScheduleSlices(start.In(dataSet.Location()), end) {
+		serviceIds, err := GetActiveServiceIds(ctx, r.db, dataSet, slice.ServiceDate)
+		if err != nil {
+			return nil, err
+		}
+		if len(serviceIds) == 0 {
+			continue
+		}
+		stopTimes, err := getStopTimeInstancesAtStop(ctx, r.db, dataSetId, stopId, serviceIds, slice)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, stopTimes...)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].DepartureDateTime.Before(results[j].DepartureDateTime)
+	})
+	return results, nil
+}
+
+// getStopTimeInstancesAtStop retrieves StopTimeInstances departing stopId within ScheduleSlice on trips with serviceIds
+func getStopTimeInstancesAtStop(ctx context.Context,
+	db *sqlx.DB,
+	dataSetId int64,
+	stopId string,
+	serviceIds []string,
+	slice ScheduleSlice) ([]*StopTimeInstance, error) {
+	serviceIdArray := pgtype.TextArray{}
+	err := serviceIdArray.Set(serviceIds)
+	if err != nil {
+		return nil, fmt.Errorf("unable to use serviceIds as query parameter: %w", err)
+	}
+	query := "select stop_time.* from stop_time " +
+		"join trip on trip.data_set_id = stop_time.data_set_id and trip.trip_id = stop_time.trip_id " +
+		"where stop_time.data_set_id = $1 and stop_time.stop_id = $2 and trip.service_id = any($3) " +
+		"and stop_time.departure_time between $4 and $5 " +
+		"order by stop_time.departure_time"
+	rows, err := db.QueryxContext(ctx, query, dataSetId, stopId, &serviceIdArray, slice.StartSeconds,
+		slice.EndSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve stop_times for stop %s, error: %w", stopId, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	results := make([]*StopTimeInstance, 0)
+	for rows.Next() {
+		sti := StopTimeInstance{}
+		err = rows.StructScan(&sti)
+		if err != nil {
+			return nil, err
+		}
+		sti.ArrivalDateTime = MakeScheduleTime(slice.ServiceDate, sti.ArrivalTime)
+		sti.DepartureDateTime = MakeScheduleTime(slice.ServiceDate, sti.DepartureTime)
+		results = append(results, &sti)
+	}
+	return results, rows.Err()
+}
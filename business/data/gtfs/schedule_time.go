@@ -4,20 +4,19 @@ import (
 	"time"
 )
 
-// getDLSTransitionSeconds provides the number of seconds offset for a 12am date later in the day after day light saving time is done
-func getDLSTransitionSeconds(timeAt12 time.Time) int {
-	before := time.Date(timeAt12.Year(), timeAt12.Month(), timeAt12.Day(), 0, 0, 0, 0, timeAt12.Location())
-	after := time.Date(timeAt12.Year(), timeAt12.Month(), timeAt12.Day(), 5, 0, 0, 0, timeAt12.Location())
-	_, beforeOffset := before.Zone()
-	_, afterOffset := after.Zone()
-	return afterOffset - beforeOffset
+// ScheduleReferenceTime returns the time gtfs schedule seconds on the service day of serviceDate are measured from,
+// which the gtfs specification defines as "noon minus 12h" in serviceDate's location. This is 12am except on days
+// with a daylight saving time transition, when it is 11pm the day before (clocks moving forward) or 1am (clocks moving
+// back), so schedule times after the transition, including those past midnight, land on the intended wall clock time
+func ScheduleReferenceTime(serviceDate time.Time) time.Time {
+	noon := time.Date(serviceDate.Year(), serviceDate.Month(), serviceDate.Day(), 12, 0, 0, 0, serviceDate.Location())
+	return noon.Add(-12 * time.Hour)
 }
 
-// MakeScheduleTime produces a time from by adding seconds to a 12am date. Takes into account day light saving time
+// MakeScheduleTime produces a time by adding scheduleSeconds to the ScheduleReferenceTime of the service day of
+// timeAt12. Takes into account day light saving time
 func MakeScheduleTime(timeAt12 time.Time, scheduleSeconds int) time.Time {
-	offset := getDLSTransitionSeconds(timeAt12)
-	scheduleSeconds = scheduleSeconds + (0 - offset)
-	return timeAt12.Add(time.Duration(scheduleSeconds) * time.Second)
+	return ScheduleReferenceTime(timeAt12).Add(time.Duration(scheduleSeconds) * time.Second)
 }
 
 // ScheduleSlice contains a service date and a section of service time
@@ -31,21 +30,23 @@ const (
 	MaximumScheduleSeconds int = 60 * 60 * 30
 )
 
-// GetScheduleSlices produces array of schedule slices based on start and end times
+// GetScheduleSlices produces array of schedule slices based on start and end times, in the location of start.
+// StartSeconds and EndSeconds are schedule seconds measured from each service day's ScheduleReferenceTime
 func GetScheduleSlices(start time.Time, end time.Time) []ScheduleSlice {
 	var result []ScheduleSlice
 	//start a day behind to catch time past midnight but before MaximumScheduleSeconds
 	var serviceDate = Get12AmTime(start).AddDate(0, 0, -1)
-	endServiceDate := Get12AmTime(end).AddDate(0, 0, 1)
+	endServiceDate := Get12AmTime(end.In(start.Location())).AddDate(0, 0, 1)
 	for serviceDate.Unix() <= endServiceDate.Unix() {
 		slice := ScheduleSlice{
 			ServiceDate: serviceDate,
 		}
-		slice.StartSeconds = int(start.Unix() - serviceDate.Unix())
+		reference := ScheduleReferenceTime(serviceDate).Unix()
+		slice.StartSeconds = int(start.Unix() - reference)
 		if slice.StartSeconds < 0 {
 			slice.StartSeconds = 0
 		}
-		slice.EndSeconds = int(end.Unix() - serviceDate.Unix())
+		slice.EndSeconds = int(end.Unix() - reference)
 		if slice.EndSeconds > MaximumScheduleSeconds {
 			slice.EndSeconds = MaximumScheduleSeconds
 		}
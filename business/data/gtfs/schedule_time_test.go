@@ -15,6 +15,11 @@ func TestMakeScheduleTime(t *testing.T) {
 		t.Errorf("Unable to get testing time zone location")
 		return
 	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Errorf("Unable to get testing time zone location")
+		return
+	}
 	type args struct {
 		timeAt12        time.Time
 		scheduleSeconds int
@@ -56,10 +61,74 @@ func TestMakeScheduleTime(t *testing.T) {
 			},
 			want: time.Date(2019, 3, 10, 12, 30, 0, 0, location),
 		},
+		{
+			name: "1:30am, measured from 11pm the day before on forward day",
+			args: args{
+				timeAt12:        time.Date(2019, 3, 10, 0, 0, 0, 0, location),
+				scheduleSeconds: 5400,
+			},
+			want: time.Date(2019, 3, 10, 0, 30, 0, 0, location),
+		},
+		{
+			name: "3:30am, after forward transition",
+			args: args{
+				timeAt12:        time.Date(2019, 3, 10, 0, 0, 0, 0, location),
+				scheduleSeconds: 12600,
+			},
+			want: time.Date(2019, 3, 10, 3, 30, 0, 0, location),
+		},
+		{
+			name: "25:30, past midnight into forward day",
+			args: args{
+				timeAt12:        time.Date(2019, 3, 9, 0, 0, 0, 0, location),
+				scheduleSeconds: 91800,
+			},
+			want: time.Date(2019, 3, 10, 1, 30, 0, 0, location),
+		},
+		{
+			name: "26:30, past midnight through forward transition",
+			args: args{
+				timeAt12:        time.Date(2019, 3, 9, 0, 0, 0, 0, location),
+				scheduleSeconds: 95400,
+			},
+			want: time.Date(2019, 3, 10, 3, 30, 0, 0, location),
+		},
+		{
+			name: "25:30, past midnight into back day is before transition",
+			args: args{
+				timeAt12:        time.Date(2019, 11, 2, 0, 0, 0, 0, location),
+				scheduleSeconds: 91800,
+			},
+			want: time.Date(2019, 11, 3, 8, 30, 0, 0, time.UTC).In(location),
+		},
+		{
+			name: "26:30, past midnight through back transition",
+			args: args{
+				timeAt12:        time.Date(2019, 11, 2, 0, 0, 0, 0, location),
+				scheduleSeconds: 95400,
+			},
+			want: time.Date(2019, 11, 3, 9, 30, 0, 0, time.UTC).In(location),
+		},
+		{
+			name: "1:30am, measured from 1am on back day",
+			args: args{
+				timeAt12:        time.Date(2019, 11, 3, 0, 0, 0, 0, location),
+				scheduleSeconds: 5400,
+			},
+			want: time.Date(2019, 11, 3, 9, 30, 0, 0, time.UTC).In(location),
+		},
+		{
+			name: "forward day in another timezone",
+			args: args{
+				timeAt12:        time.Date(2019, 3, 31, 0, 0, 0, 0, berlin),
+				scheduleSeconds: 43200,
+			},
+			want: time.Date(2019, 3, 31, 12, 0, 0, 0, berlin),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := MakeScheduleTime(tt.args.timeAt12, tt.args.scheduleSeconds); !reflect.DeepEqual(got, tt.want) {
+			if got := MakeScheduleTime(tt.args.timeAt12, tt.args.scheduleSeconds); !got.Equal(tt.want) {
 				t.Errorf("MakeScheduleTime() = %v, want %v", got, tt.want)
 			}
 		})
@@ -135,6 +204,47 @@ func TestGetScheduleSlices(t *testing.T) {
 				},
 			},
 		},
+		{
+			// schedule seconds on the day clocks move back are measured from 1am
+			giveStart: time.Date(2019, 11, 3, 9, 0, 0, 0, location),
+			giveEnd:   time.Date(2019, 11, 3, 10, 0, 0, 0, location),
+			want: []ScheduleSlice{
+				{
+					ServiceDate:  time.Date(2019, 11, 3, 0, 0, 0, 0, location),
+					StartSeconds: 9 * 60 * 60,
+					EndSeconds:   10 * 60 * 60,
+				},
+			},
+		},
+		{
+			// schedule seconds on the day clocks move forward are measured from 11pm the day before
+			giveStart: time.Date(2019, 3, 10, 9, 0, 0, 0, location),
+			giveEnd:   time.Date(2019, 3, 10, 10, 0, 0, 0, location),
+			want: []ScheduleSlice{
+				{
+					ServiceDate:  time.Date(2019, 3, 10, 0, 0, 0, 0, location),
+					StartSeconds: 9 * 60 * 60,
+					EndSeconds:   10 * 60 * 60,
+				},
+			},
+		},
+		{
+			// trips from the day before run into the early hours of the day clocks move forward
+			giveStart: time.Date(2019, 3, 10, 3, 30, 0, 0, location),
+			giveEnd:   time.Date(2019, 3, 10, 4, 0, 0, 0, location),
+			want: []ScheduleSlice{
+				{
+					ServiceDate:  time.Date(2019, 3, 9, 0, 0, 0, 0, location),
+					StartSeconds: (26 * 60 * 60) + (30 * 60),
+					EndSeconds:   27 * 60 * 60,
+				},
+				{
+					ServiceDate:  time.Date(2019, 3, 10, 0, 0, 0, 0, location),
+					StartSeconds: (3 * 60 * 60) + (30 * 60),
+					EndSeconds:   4 * 60 * 60,
+				},
+			},
+		},
 	}
 	for row, tt := range tests {
 		t.Run("row: "+strconv.Itoa(row), func(t *testing.T) {
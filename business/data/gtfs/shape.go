@@ -1,6 +1,7 @@
 package gtfs
 
 import (
+	"context"
 	"fmt"
 	"github.com/OpenTransitTools/transitcast/foundation/database"
 	"github.com/jmoiron/sqlx"
@@ -47,7 +48,8 @@ func RecordShapes(shapes []*Shape, dsTx *DataSetTransaction) error {
 // returns:
 //		map with results keyed by shapeIds,
 //		slice of missing shapeIds (where no Shape records could be found)
-func GetShapes(db *sqlx.DB,
+func GetShapes(ctx context.Context,
+	db *sqlx.DB,
 	dataSetId int64,
 	shapeIds []string) (map[string][]*Shape, []string, error) {
 
@@ -61,7 +63,7 @@ func GetShapes(db *sqlx.DB,
 
 	statementString := "select * from shape where data_set_id = :data_set_id and shape_id in (:shape_ids)" +
 		"order by shape_id, shape_pt_sequence"
-	rows, err := database.PrepareNamedQueryRowsFromMap(statementString, db, map[string]interface{}{
+	rows, err := database.PrepareNamedQueryRowsFromMapContext(ctx, statementString, db, map[string]interface{}{
 		"data_set_id": dataSetId,
 		"shape_ids":   shapeIds,
 	})
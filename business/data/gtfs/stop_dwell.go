@@ -0,0 +1,100 @@
+package gtfs
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"math"
+	"time"
+)
+
+// stopDwellBatchSize is the number of StopDwell rows sent in each insert, keeping the statement within postgres'
+// limit on parameters
+const stopDwellBatchSize = 1000
+
+// StopDwell is the average time vehicles spend at StopId between arriving and departing, computed from consecutive
+// observed_stop_time records of the same vehicle and trip where the vehicle was seen at the stop
+type StopDwell struct {
+	StopId       string `db:"stop_id" json:"stop_id"`
+	DwellSeconds int    `db:"dwell_seconds" json:"dwell_seconds"`
+	//SampleCount is the number of observed dwells DwellSeconds was computed from
+	SampleCount int       `db:"sample_count" json:"sample_count"`
+	ComputedAt  time.Time `db:"computed_at" json:"computed_at"`
+}
+
+// ComputeStopDwells finds the mean dwell at each stop observed from start until end. A dwell is the time between a
+// vehicle's arrival at a stop, the observed_time of the observation ending at the stop, and its departure, the
+// observed_time less travel_seconds of the next observation on the trip. Only dwells where the vehicle was seen at the
+// stop, between zero and maxDwellSeconds, are used, and stops with fewer than minSamples dwells are left out
+func ComputeStopDwells(ctx context.Context,
+	db *sqlx.DB,
+	start time.Time,
+	end time.Time,
+	maxDwellSeconds int,
+	minSamples int,
+	now time.Time) ([]StopDwell, error) {
+	statementString := "select stop_id, avg(dwell_seconds) as mean_seconds, count(*) as sample_count " +
+		"from (select stop_id, observed_at_stop, " +
+		"lag(next_stop_id) over w as arrived_stop_id, " +
+		"lag(observed_at_next_stop) over w as observed_arriving, " +
+		"extract(epoch from observed_time - lag(observed_time) over w) - travel_seconds as dwell_seconds " +
+		"from observed_stop_time " +
+		"where observed_time >= $1 and observed_time < $2 " +
+		"window w as (partition by vehicle_id, trip_id, data_set_id order by observed_time)) dwell " +
+		"where observed_at_stop and observed_arriving and arrived_stop_id = stop_id " +
+		"and dwell_seconds >= 0 and dwell_seconds <= $3 " +
+		"group by stop_id " +
+		"having count(*) >= $4 " +
+		"order by stop_id"
+	statementString = db.Rebind(statementString)
+	var rows []struct {
+		StopId      string  `db:"stop_id"`
+		MeanSeconds float64 `db:"mean_seconds"`
+		SampleCount int     `db:"sample_count"`
+	}
+	err := db.SelectContext(ctx, &rows, statementString, start, end, maxDwellSeconds, minSamples)
+	if err != nil {
+		return nil, err
+	}
+	dwells := make([]StopDwell, 0, len(rows))
+	for _, row := range rows {
+		dwells = append(dwells, StopDwell{
+			StopId:       row.StopId,
+			DwellSeconds: int(math.Round(row.MeanSeconds)),
+			SampleCount:  row.SampleCount,
+			ComputedAt:   now,
+		})
+	}
+	return dwells, nil
+}
+
+// DeleteStopDwells removes all StopDwell records
+func DeleteStopDwells(ctx context.Context, tx *sqlx.Tx) error {
+	_, err := tx.ExecContext(ctx, "delete from stop_dwell")
+	return err
+}
+
+// RecordStopDwells saves dwells into database
+func RecordStopDwells(ctx context.Context, tx *sqlx.Tx, dwells []StopDwell) error {
+	statementString := "insert into stop_dwell (stop_id, dwell_seconds, sample_count, computed_at) " +
+		"values (:stop_id, :dwell_seconds, :sample_count, :computed_at)"
+	statementString = tx.Rebind(statementString)
+	for start := 0; start < len(dwells); start += stopDwellBatchSize {
+		end := start + stopDwellBatchSize
+		if end > len(dwells) {
+			end = len(dwells)
+		}
+		_, err := tx.NamedExecContext(ctx, statementString, dwells[start:end])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetStopDwells retrieves all StopDwell records
+func GetStopDwells(ctx context.Context, db *sqlx.DB) ([]StopDwell, error) {
+	statementString := "select stop_id, dwell_seconds, sample_count, computed_at from stop_dwell"
+	var dwells []StopDwell
+	err := db.SelectContext(ctx, &dwells, statementString)
+	return dwells, err
+}
@@ -0,0 +1,100 @@
+package gtfs
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"math"
+	"time"
+)
+
+// stopPairTravelBoundBatchSize is the number of StopPairTravelBound rows sent in each insert, keeping the statement
+// within postgres' limit on parameters
+const stopPairTravelBoundBatchSize = 1000
+
+// StopPairTravelBound is the least time a vehicle can plausibly take to travel from StopId to NextStopId, computed
+// from the travel times in observed_stop_time
+type StopPairTravelBound struct {
+	StopId           string `db:"stop_id" json:"stop_id"`
+	NextStopId       string `db:"next_stop_id" json:"next_stop_id"`
+	MinTravelSeconds int    `db:"min_travel_seconds" json:"min_travel_seconds"`
+	//SampleCount is the number of observations MinTravelSeconds was computed from
+	SampleCount int       `db:"sample_count" json:"sample_count"`
+	ComputedAt  time.Time `db:"computed_at" json:"computed_at"`
+}
+
+// ComputeStopPairTravelBounds finds the travel seconds at percentile of the observations of each stop pair observed
+// from start until end, and multiplies it by margin to give the pair's MinTravelSeconds. Pairs with fewer than
+// minSamples observations are left out
+func ComputeStopPairTravelBounds(ctx context.Context,
+	db *sqlx.DB,
+	start time.Time,
+	end time.Time,
+	percentile float64,
+	margin float64,
+	minSamples int,
+	now time.Time) ([]StopPairTravelBound, error) {
+	statementString := "select stop_id, next_stop_id, " +
+		"percentile_cont($3) within group (order by travel_seconds) as percentile_seconds, " +
+		"count(*) as sample_count " +
+		"from observed_stop_time " +
+		"where observed_time >= $1 and observed_time < $2 " +
+		"group by stop_id, next_stop_id " +
+		"having count(*) >= $4 " +
+		"order by stop_id, next_stop_id"
+	statementString = db.Rebind(statementString)
+	var rows []struct {
+		StopId            string  `db:"stop_id"`
+		NextStopId        string  `db:"next_stop_id"`
+		PercentileSeconds float64 `db:"percentile_seconds"`
+		SampleCount       int     `db:"sample_count"`
+	}
+	err := db.SelectContext(ctx, &rows, statementString, start, end, percentile, minSamples)
+	if err != nil {
+		return nil, err
+	}
+	bounds := make([]StopPairTravelBound, 0, len(rows))
+	for _, row := range rows {
+		bounds = append(bounds, StopPairTravelBound{
+			StopId:           row.StopId,
+			NextStopId:       row.NextStopId,
+			MinTravelSeconds: int(math.Floor(row.PercentileSeconds * margin)),
+			SampleCount:      row.SampleCount,
+			ComputedAt:       now,
+		})
+	}
+	return bounds, nil
+}
+
+// DeleteStopPairTravelBounds removes all StopPairTravelBound records
+func DeleteStopPairTravelBounds(ctx context.Context, tx *sqlx.Tx) error {
+	_, err := tx.ExecContext(ctx, "delete from stop_pair_travel_bound")
+	return err
+}
+
+// RecordStopPairTravelBounds saves bounds into database
+func RecordStopPairTravelBounds(ctx context.Context, tx *sqlx.Tx, bounds []StopPairTravelBound) error {
+	statementString := "insert into stop_pair_travel_bound " +
+		"(stop_id, next_stop_id, min_travel_seconds, sample_count, computed_at) " +
+		"values (:stop_id, :next_stop_id, :min_travel_seconds, :sample_count, :computed_at)"
+	statementString = tx.Rebind(statementString)
+	for start := 0; start < len(bounds); start += stopPairTravelBoundBatchSize {
+		end := start + stopPairTravelBoundBatchSize
+		if end > len(bounds) {
+			end = len(bounds)
+		}
+		_, err := tx.NamedExecContext(ctx, statementString, bounds[start:end])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetStopPairTravelBounds retrieves all StopPairTravelBound records
+func GetStopPairTravelBounds(ctx context.Context, db *sqlx.DB) ([]StopPairTravelBound, error) {
+	statementString := "select stop_id, next_stop_id, min_travel_seconds, sample_count, computed_at " +
+		"from stop_pair_travel_bound"
+	var bounds []StopPairTravelBound
+	err := db.SelectContext(ctx, &bounds, statementString)
+	return bounds, err
+}
@@ -1,7 +1,11 @@
 package gtfs
 
 import (
+	"context"
+	"fmt"
 	"github.com/OpenTransitTools/transitcast/foundation/database"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
 	"github.com/jmoiron/sqlx"
 	"time"
 )
@@ -59,6 +63,49 @@ func RecordStopTimes(stopTimes []*StopTime, dsTx *DataSetTransaction) error {
 	return err
 }
 
+// stopTimeCopyColumns are the stop_time columns written by CopyStopTimes, in the order values are provided
+var stopTimeCopyColumns = []string{
+	"data_set_id",
+	"trip_id",
+	"stop_sequence",
+	"stop_id",
+	"arrival_time",
+	"departure_time",
+	"shape_dist_traveled",
+	"timepoint",
+}
+
+// CopyStopTimes saves stopTimes under dataSetId with postgres COPY on conn, which is much faster than inserting
+// large numbers of rows
+// returns the number of rows copied
+func CopyStopTimes(conn *pgx.Conn, dataSetId int64, stopTimes []*StopTime) (int, error) {
+	rows := make([][]interface{}, len(stopTimes))
+	for i, stopTime := range stopTimes {
+		stopTime.DataSetId = dataSetId
+		rows[i] = []interface{}{
+			stopTime.DataSetId,
+			stopTime.TripId,
+			stopTime.StopSequence,
+			stopTime.StopId,
+			stopTime.ArrivalTime,
+			stopTime.DepartureTime,
+			stopTime.ShapeDistTraveled,
+			stopTime.Timepoint,
+		}
+	}
+	return conn.CopyFrom(pgx.Identifier{"stop_time"}, stopTimeCopyColumns, pgx.CopyFromRows(rows))
+}
+
+// DeleteStopTimes removes all stop_time records for dataSetId
+// returns the number of rows removed
+func DeleteStopTimes(ctx context.Context, db *sqlx.DB, dataSetId int64) (int64, error) {
+	result, err := db.ExecContext(ctx, db.Rebind("delete from stop_time where data_set_id = ?"), dataSetId)
+	if err != nil {
+		return 0, fmt.Errorf("unable to delete stop times for data set %d: %w", dataSetId, err)
+	}
+	return result.RowsAffected()
+}
+
 // getStopTimeInstances collects StopTimeInstances and returns in order by tripID inside a map
 // ArrivalDateTime and DepartureDateTime are populated from the best ScheduleSlice match from the trips first arrival time.
 //If a ScheduleSlice match can't be found the StopTimeInstances are not included in the map result
@@ -66,7 +113,8 @@ func RecordStopTimes(stopTimes []*StopTime, dsTx *DataSetTransaction) error {
 //		map with results keyed by tripId,
 //		slice of missing trip ids (where no StopTimeInstances could be found)
 //		slice of trip ids where no matching ScheduleSlice could be found for the trip
-func getStopTimeInstances(db *sqlx.DB,
+func getStopTimeInstances(ctx context.Context,
+	db *sqlx.DB,
 	scheduleSlices []ScheduleSlice,
 	dataSetId int64,
 	tripIds []string) (map[string][]*StopTimeInstance, []string, []string, error) {
@@ -78,7 +126,7 @@ func getStopTimeInstances(db *sqlx.DB,
 
 	statementString := "select * from stop_time where data_set_id = :data_set_id and trip_id in (:trip_ids) " +
 		"order by trip_id, stop_sequence"
-	rows, err := database.PrepareNamedQueryRowsFromMap(statementString, db, map[string]interface{}{
+	rows, err := database.PrepareNamedQueryRowsFromMapContext(ctx, statementString, db, map[string]interface{}{
 		"data_set_id": dataSetId,
 		"trip_ids":    tripIds,
 	})
@@ -154,3 +202,39 @@ func getStopTimeInstances(db *sqlx.DB,
 
 	return results, missingTripIds, invalidTimeSliceTripIds, err
 }
+
+// getStopTimeInstancesOnServiceDate collects StopTimeInstances for all trips in tripIds in a single query and returns
+// them in order by tripID inside a map. ArrivalDateTime and DepartureDateTime are calculated from serviceDate
+func getStopTimeInstancesOnServiceDate(ctx context.Context,
+	db *sqlx.DB,
+	dataSetId int64,
+	tripIds *pgtype.TextArray,
+	serviceDate time.Time) (map[string][]*StopTimeInstance, error) {
+
+	results := make(map[string][]*StopTimeInstance)
+
+	statementString := "select * from stop_time where data_set_id = $1 and trip_id = any($2) " +
+		"order by trip_id, stop_sequence"
+	rows, err := db.QueryxContext(ctx, statementString, dataSetId, tripIds)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve stop_times for dataSetId %d, error: %w", dataSetId, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		sti := StopTimeInstance{}
+		err = rows.StructScan(&sti)
+		if err != nil {
+			return nil, err
+		}
+		stopTimes := results[sti.TripId]
+		sti.FirstStop = len(stopTimes) == 0
+		sti.ArrivalDateTime = MakeScheduleTime(serviceDate, sti.ArrivalTime)
+		sti.DepartureDateTime = MakeScheduleTime(serviceDate, sti.DepartureTime)
+		results[sti.TripId] = append(stopTimes, &sti)
+	}
+
+	return results, rows.Err()
+}
@@ -0,0 +1,118 @@
+package gtfs
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+)
+
+// Transfer contains a record from a gtfs transfers.txt file
+// describes how a rider may connect between routes, trips or stops
+type Transfer struct {
+	DataSetId       int64  `db:"data_set_id" json:"data_set_id"`
+	FromStopId      string `db:"from_stop_id" json:"from_stop_id"`
+	ToStopId        string `db:"to_stop_id" json:"to_stop_id"`
+	FromRouteId     string `db:"from_route_id" json:"from_route_id"`
+	ToRouteId       string `db:"to_route_id" json:"to_route_id"`
+	FromTripId      string `db:"from_trip_id" json:"from_trip_id"`
+	ToTripId        string `db:"to_trip_id" json:"to_trip_id"`
+	TransferType    int    `db:"transfer_type" json:"transfer_type"`
+	MinTransferTime *int   `db:"min_transfer_time" json:"min_transfer_time"`
+}
+
+// TimedTransfer is the transfer_type of a Transfer where the departing vehicle is expected to wait for
+// the arriving one
+const TimedTransfer = 1
+
+// Pathway contains a record from a gtfs pathways.txt file
+// describes a path between two locations within a station
+type Pathway struct {
+	DataSetId            int64    `db:"data_set_id" json:"data_set_id"`
+	PathwayId            string   `db:"pathway_id" json:"pathway_id"`
+	FromStopId           string   `db:"from_stop_id" json:"from_stop_id"`
+	ToStopId             string   `db:"to_stop_id" json:"to_stop_id"`
+	PathwayMode          int      `db:"pathway_mode" json:"pathway_mode"`
+	IsBidirectional      int      `db:"is_bidirectional" json:"is_bidirectional"`
+	Length               *float64 `db:"length" json:"length"`
+	TraversalTime        *int     `db:"traversal_time" json:"traversal_time"`
+	StairCount           *int     `db:"stair_count" json:"stair_count"`
+	MaxSlope             *float64 `db:"max_slope" json:"max_slope"`
+	MinWidth             *float64 `db:"min_width" json:"min_width"`
+	SignpostedAs         string   `db:"signposted_as" json:"signposted_as"`
+	ReversedSignpostedAs string   `db:"reversed_signposted_as" json:"reversed_signposted_as"`
+}
+
+// RecordTransfer saves transfer to database
+func RecordTransfer(transfer *Transfer, dsTx *DataSetTransaction) error {
+	transfer.DataSetId = dsTx.DS.Id
+	statementString := "insert into transfer ( " +
+		"data_set_id, " +
+		"from_stop_id, " +
+		"to_stop_id, " +
+		"from_route_id, " +
+		"to_route_id, " +
+		"from_trip_id, " +
+		"to_trip_id, " +
+		"transfer_type, " +
+		"min_transfer_time) " +
+		"values (" +
+		":data_set_id, " +
+		":from_stop_id, " +
+		":to_stop_id, " +
+		":from_route_id, " +
+		":to_route_id, " +
+		":from_trip_id, " +
+		":to_trip_id, " +
+		":transfer_type, " +
+		":min_transfer_time)"
+	statementString = dsTx.Tx.Rebind(statementString)
+	_, err := dsTx.Tx.NamedExec(statementString, transfer)
+	return err
+}
+
+// RecordPathway saves pathway to database
+func RecordPathway(pathway *Pathway, dsTx *DataSetTransaction) error {
+	pathway.DataSetId = dsTx.DS.Id
+	statementString := "insert into pathway ( " +
+		"data_set_id, " +
+		"pathway_id, " +
+		"from_stop_id, " +
+		"to_stop_id, " +
+		"pathway_mode, " +
+		"is_bidirectional, " +
+		"length, " +
+		"traversal_time, " +
+		"stair_count, " +
+		"max_slope, " +
+		"min_width, " +
+		"signposted_as, " +
+		"reversed_signposted_as) " +
+		"values (" +
+		":data_set_id, " +
+		":pathway_id, " +
+		":from_stop_id, " +
+		":to_stop_id, " +
+		":pathway_mode, " +
+		":is_bidirectional, " +
+		":length, " +
+		":traversal_time, " +
+		":stair_count, " +
+		":max_slope, " +
+		":min_width, " +
+		":signposted_as, " +
+		":reversed_signposted_as)"
+	statementString = dsTx.Tx.Rebind(statementString)
+	_, err := dsTx.Tx.NamedExec(statementString, pathway)
+	return err
+}
+
+// GetTransfersFromStop retrieves all Transfers in dataSetId departing from stopId
+func GetTransfersFromStop(ctx context.Context, db *sqlx.DB, dataSetId int64, stopId string) ([]*Transfer, error) {
+	query := "select * from transfer where data_set_id = $1 and from_stop_id = $2"
+	results := make([]*Transfer, 0)
+	err := db.SelectContext(ctx, &results, query, dataSetId, stopId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve transfers from stop %s: %w", stopId, err)
+	}
+	return results, nil
+}
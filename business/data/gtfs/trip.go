@@ -1,8 +1,10 @@
 package gtfs
 
 import (
+	"context"
 	"fmt"
 	"github.com/OpenTransitTools/transitcast/foundation/database"
+	"github.com/jackc/pgx/pgtype"
 	"github.com/jmoiron/sqlx"
 	"strings"
 	"time"
@@ -21,6 +23,11 @@ type Trip struct {
 	StartTime     int     `db:"start_time" json:"start_time"`
 	EndTime       int     `db:"end_time" json:"end_time"`
 	TripDistance  float64 `db:"trip_distance" json:"trip_distance"`
+	// RouteType is the route_type of the trip's route in routes.txt, nil when routes.txt was not loaded
+	RouteType *int `db:"route_type" json:"route_type"`
+	// PatternId identifies the trip's stop pattern, shared by every trip in the data set serving the same stops with
+	// the same timepoints. nil until the data set is activated, and for data sets loaded before patterns were assigned
+	PatternId *string `db:"pattern_id" json:"pattern_id,omitempty"`
 }
 
 // RecordTrips saves trips to database in batch
@@ -39,7 +46,8 @@ func RecordTrips(trips []*Trip, dsTx *DataSetTransaction) error {
 		"shape_id," +
 		"start_time, " +
 		"end_time, " +
-		"trip_distance) " +
+		"trip_distance, " +
+		"route_type) " +
 		"values (" +
 		":data_set_id, " +
 		":trip_id, " +
@@ -51,7 +59,8 @@ func RecordTrips(trips []*Trip, dsTx *DataSetTransaction) error {
 		":shape_id," +
 		":start_time, " +
 		":end_time, " +
-		":trip_distance)"
+		":trip_distance, " +
+		":route_type)"
 	statementString = dsTx.Tx.Rebind(statementString)
 	_, err := dsTx.Tx.NamedExec(statementString, trips)
 	return err
@@ -62,6 +71,8 @@ type TripInstance struct {
 	Trip
 	StopTimeInstances []*StopTimeInstance `json:"stop_time_instances"`
 	Shapes            []*Shape            `json:"shapes"`
+	//ServiceException flags calendar exceptions on the service date the trip is scheduled on
+	ServiceException ServiceException `json:"service_exception"`
 }
 
 // ShapesBetweenDistances returns slice of Shapes where Shape.ShapeDistTraveled is between start and end
@@ -97,41 +108,82 @@ func (t *TripInstance) LastStopTimeInstance() *StopTimeInstance {
 	return t.StopTimeInstances[lastIndex]
 }
 
+// ServiceDate returns 12am on the service day the TripInstance is scheduled on, derived from its first
+// StopTimeInstance. Returns zero time if the trip has no StopTimeInstances
+func (t *TripInstance) ServiceDate() time.Time {
+	first := t.FirstStopTimeInstance()
+	if first == nil {
+		return time.Time{}
+	}
+	// noon on the service day is never moved onto another day by daylight saving time transitions
+	noon := first.ArrivalDateTime.Add(time.Duration(12*60*60-first.ArrivalTime) * time.Second)
+	return Get12AmTime(noon)
+}
+
 //GetScheduledTripIds returns all map of trip_ids that are scheduled between relevantFrom and relevantTo
 // at is used to retrieve the active dataSet
-func GetScheduledTripIds(db *sqlx.DB,
+func GetScheduledTripIds(ctx context.Context,
+	db *sqlx.DB,
 	at time.Time,
 	relevantFrom time.Time,
 	relevantTo time.Time) (map[string]bool, error) {
-	scheduleSlices := GetScheduleSlices(relevantFrom, relevantTo)
 
-	dataSet, err := GetDataSetAt(db, at)
+	dataSet, err := GetDataSetAt(ctx, db, at)
+	if err != nil {
+		return nil, err
+	}
+	scheduledTrips, err := GetScheduledTripsByServiceDate(ctx, db, dataSet, relevantFrom, relevantTo)
 	if err != nil {
 		return nil, err
 	}
 	tripIdMap := make(map[string]bool)
+	for _, scheduled := range scheduledTrips {
+		for _, tripId := range scheduled.TripIds {
+			tripIdMap[tripId] = true
+		}
+	}
+	return tripIdMap, nil
+}
+
+// ScheduledTrips contains the trip_ids scheduled on a service date
+type ScheduledTrips struct {
+	ServiceDate time.Time
+	TripIds     []string
+}
 
-	for _, slice := range scheduleSlices {
-		serviceIds, err := GetActiveServiceIds(db, dataSet, slice.ServiceDate)
+// GetScheduledTripsByServiceDate returns the trip_ids in dataSet scheduled between relevantFrom and relevantTo
+// grouped by the service date they are scheduled on. Service dates without any scheduled trips are not included.
+// Service dates are in the DataSet's Location
+func GetScheduledTripsByServiceDate(ctx context.Context,
+	db *sqlx.DB,
+	dataSet *DataSet,
+	relevantFrom time.Time,
+	relevantTo time.Time) ([]ScheduledTrips, error) {
+	results := make([]ScheduledTrips, 0)
+	for _, slice := range GetScheduleSlices(relevantFrom.In(dataSet.Location()), relevantTo) {
+		serviceIds, err := GetActiveServiceIds(ctx, db, dataSet, slice.ServiceDate)
 		if err != nil {
 			return nil, err
 		}
 		if len(serviceIds) > 0 {
-			tripIds, err := getScheduledTripIdsForSlice(db, dataSet, serviceIds, slice)
+			tripIds, err := getScheduledTripIdsForSlice(ctx, db, dataSet, serviceIds, slice)
 			if err != nil {
 				return nil, err
 			}
-			for _, tripId := range tripIds {
-				tripIdMap[tripId] = true
+			if len(tripIds) > 0 {
+				results = append(results, ScheduledTrips{
+					ServiceDate: slice.ServiceDate,
+					TripIds:     tripIds,
+				})
 			}
 		}
 	}
-	return tripIdMap, nil
+	return results, nil
 }
 
 //getScheduledTripIdsForSlice retrieves the tripIds for dataSet for serviceIds where trip start and trip end
 //fall within the range of ScheduleSlice.StartSeconds and ScheduleSlice.EndSeconds
-func getScheduledTripIdsForSlice(
+func getScheduledTripIdsForSlice(ctx context.Context,
 	db *sqlx.DB,
 	dataSet *DataSet,
 	serviceIds []string,
@@ -152,13 +204,112 @@ func getScheduledTripIdsForSlice(
 	})
 
 	var tripIds []string
-	err = db.Select(&tripIds, query, args...)
+	err = db.SelectContext(ctx, &tripIds, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve trip_ids from trip table. query:%s error: %w", query, err)
 	}
 	return tripIds, nil
 }
 
+// GetServiceDateTripIds returns the trip_ids in dataSet scheduled on serviceDate in order of their start time,
+// limited to routeId and blockId when they are not empty
+func GetServiceDateTripIds(ctx context.Context,
+	db *sqlx.DB,
+	dataSet *DataSet,
+	serviceDate time.Time,
+	routeId string,
+	blockId string) ([]string, error) {
+	serviceIds, err := GetActiveServiceIds(ctx, db, dataSet, serviceDate)
+	if err != nil {
+		return nil, err
+	}
+	if len(serviceIds) == 0 {
+		return nil, nil
+	}
+	serviceIdArray := pgtype.TextArray{}
+	err = serviceIdArray.Set(serviceIds)
+	if err != nil {
+		return nil, fmt.Errorf("unable to use serviceIds as query parameter: %w", err)
+	}
+	query := "select trip_id from trip where data_set_id = $1 and service_id = any($2) " +
+		"and ($3 = '' or route_id = $3) and ($4 = '' or block_id = $4) order by start_time, trip_id"
+	var tripIds []string
+	err = db.SelectContext(ctx, &tripIds, query, dataSet.Id, &serviceIdArray, routeId, blockId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve trip_ids from trip table. query:%s error: %w", query, err)
+	}
+	return tripIds, nil
+}
+
+// GetScheduledRouteIds returns the route_ids in dataSet with trips scheduled between relevantFrom and relevantTo
+func GetScheduledRouteIds(ctx context.Context,
+	db *sqlx.DB,
+	dataSet *DataSet,
+	relevantFrom time.Time,
+	relevantTo time.Time) ([]string, error) {
+	routeIdMap := make(map[string]bool)
+	for _, slice := range GetScheduleSlices(relevantFrom.In(dataSet.Location()), relevantTo) {
+		serviceIds, err := GetActiveServiceIds(ctx, db, dataSet, slice.ServiceDate)
+		if err != nil {
+			return nil, err
+		}
+		if len(serviceIds) == 0 {
+			continue
+		}
+		query := "select distinct route_id from trip where data_set_id = :data_set_id and route_id is not null " +
+			"and service_id in (:service_ids) " +
+			"and ((start_time between :start_seconds and :end_seconds " +
+			"or end_time between :start_seconds and :end_seconds) " +
+			"or (trip.start_time < :start_seconds and trip.end_time > :end_seconds))"
+		query, args, err := database.PrepareNamedQueryFromMap(query, db, map[string]interface{}{
+			"data_set_id":   dataSet.Id,
+			"service_ids":   serviceIds,
+			"start_seconds": slice.StartSeconds,
+			"end_seconds":   slice.EndSeconds,
+		})
+		if err != nil {
+			return nil, err
+		}
+		var routeIds []string
+		err = db.SelectContext(ctx, &routeIds, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve route_ids from trip table. query:%s error: %w", query, err)
+		}
+		for _, routeId := range routeIds {
+			routeIdMap[routeId] = true
+		}
+	}
+	return trueStringsFromMap(routeIdMap), nil
+}
+
+// GetTripRouteIds returns the route_id of each trip in tripIds found in dataSetId, keyed by trip_id
+func GetTripRouteIds(ctx context.Context,
+	db *sqlx.DB,
+	dataSetId int64,
+	tripIds []string) (map[string]string, error) {
+	results := make(map[string]string)
+	if len(tripIds) == 0 {
+		return results, nil
+	}
+	query := "select trip_id, route_id from trip where data_set_id = :data_set_id and trip_id in (:trip_ids)"
+	query, args, err := database.PrepareNamedQueryFromMap(query, db, map[string]interface{}{
+		"data_set_id": dataSetId,
+		"trip_ids":    tripIds,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []Trip
+	err = db.SelectContext(ctx, &rows, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve route_ids of trips from trip table. query:%s error: %w", query, err)
+	}
+	for _, row := range rows {
+		results[row.TripId] = row.RouteId
+	}
+	return results, nil
+}
+
 type MissingTripInstances struct {
 	DataSetId               int64
 	MissingTripIds          []string
@@ -177,28 +328,32 @@ func (m *MissingTripInstances) Error() string {
 
 }
 
-// GetTripInstances loads trip instances with tripIds.
+// GetTripInstancesBetween loads trip instances with tripIds.
 // Appropriate scheduleDates are selected where trip start and end times are within range of relevantFrom and relevantTo
+// times in the TripInstances are in the Location of the DataSet active "at"
 // if any tripIds could not be loaded error will be of MissingTripInstances, in which case its safe to continue if those
 // trips are not needed, but the error should be logged
-func GetTripInstances(db *sqlx.DB,
+// trips are compacted by compactor, which may be nil when they aren't kept
+func GetTripInstancesBetween(ctx context.Context,
+	db *sqlx.DB,
 	at time.Time,
 	relevantFrom time.Time,
 	relevantTo time.Time,
-	tripIds []string) (map[string]*TripInstance, error) {
+	tripIds []string,
+	compactor *TripCompactor) (map[string]*TripInstance, error) {
 
 	//find dataSet that's relevant
-	dataSet, err := GetDataSetAt(db, at)
+	dataSet, err := GetDataSetAt(ctx, db, at)
 	if err != nil {
 		return nil, err
 	}
 
 	//find relevant schedule slices
-	scheduleSlices := GetScheduleSlices(relevantFrom, relevantTo)
+	scheduleSlices := GetScheduleSlices(relevantFrom.In(dataSet.Location()), relevantTo)
 
 	//load all stopTimes for requested tripIds
 	stopTimeMap, missingTripIds, tripIdsScheduleSliceOutOfRange, err :=
-		getStopTimeInstances(db, scheduleSlices, dataSet.Id, tripIds)
+		getStopTimeInstances(ctx, db, scheduleSlices, dataSet.Id, tripIds)
 
 	if err != nil {
 		return nil, err
@@ -222,7 +377,7 @@ func GetTripInstances(db *sqlx.DB,
 
 	//load tripInstances with stopTimeMap
 	var tripInstanceByTripId map[string]*TripInstance
-	tripInstanceByTripId, err = getTripInstances(db, tripIds, dataSet, stopTimeMap)
+	tripInstanceByTripId, err = getTripInstances(ctx, db, tripIds, dataSet, stopTimeMap)
 
 	if err != nil {
 		return nil, err
@@ -230,12 +385,18 @@ func GetTripInstances(db *sqlx.DB,
 
 	//load any shape list available into trips
 	var missingShapeIds []string
-	missingShapeIds, err = loadShapesIntoTrips(tripInstanceByTripId, db, dataSet)
+	missingShapeIds, err = LoadTripInstanceShapes(ctx, db, dataSet.Id, tripInstanceByTripId, compactor)
 
 	if err != nil {
 		return nil, err
 	}
 
+	err = LoadTripInstanceServiceExceptions(ctx, db, dataSet.Id, tripInstanceByTripId)
+	if err != nil {
+		return nil, err
+	}
+	compactor.Compact(tripInstanceByTripId)
+
 	//only return missingTripInstancesError if its non-null
 	if len(missingTripIds) > 0 || len(tripIdsScheduleSliceOutOfRange) > 0 || len(missingShapeIds) > 0 {
 		return tripInstanceByTripId, &MissingTripInstances{
@@ -250,7 +411,8 @@ func GetTripInstances(db *sqlx.DB,
 
 }
 
-func getTripInstances(db *sqlx.DB,
+func getTripInstances(ctx context.Context,
+	db *sqlx.DB,
 	tripIds []string,
 	dataSet *DataSet,
 	stopTimeMap map[string][]*StopTimeInstance) (map[string]*TripInstance, error) {
@@ -258,7 +420,7 @@ func getTripInstances(db *sqlx.DB,
 	results := make(map[string]*TripInstance)
 
 	statementString := "select * from trip where data_set_id = :data_set_id and trip_id in (:trip_ids)"
-	rows, err := database.PrepareNamedQueryRowsFromMap(statementString, db, map[string]interface{}{
+	rows, err := database.PrepareNamedQueryRowsFromMapContext(ctx, statementString, db, map[string]interface{}{
 		"data_set_id": dataSet.Id,
 		"trip_ids":    tripIds,
 	})
@@ -287,9 +449,15 @@ func getTripInstances(db *sqlx.DB,
 	return results, nil
 }
 
-func loadShapesIntoTrips(tripsByTripId map[string]*TripInstance,
+// LoadTripInstanceShapes retrieves the Shapes for each TripInstance in tripsByTripId from dataSetId
+// returns slice of shapeIds that could not be found.
+// Trips on the same shape share its Shapes through compactor, which may be nil, and are only retrieved when not
+// already held for an earlier trip
+func LoadTripInstanceShapes(ctx context.Context,
 	db *sqlx.DB,
-	dataSet *DataSet) ([]string, error) {
+	dataSetId int64,
+	tripsByTripId map[string]*TripInstance,
+	compactor *TripCompactor) ([]string, error) {
 
 	//find shapeIds needed
 	shapeIdMap := make(map[string]bool)
@@ -301,10 +469,19 @@ func loadShapesIntoTrips(tripsByTripId map[string]*TripInstance,
 		}
 	}
 
-	//load shapes
-	mappedShapes, missingShapeIds, err := GetShapes(db, dataSet.Id, shapeIds)
-	if err != nil {
-		return missingShapeIds, err
+	//load shapes not already shared by earlier trips
+	mappedShapes, shapeIds := compactor.sharedShapes(dataSetId, shapeIds)
+	missingShapeIds := make([]string, 0)
+	if len(shapeIds) > 0 {
+		var loadedShapes map[string][]*Shape
+		var err error
+		loadedShapes, missingShapeIds, err = GetShapes(ctx, db, dataSetId, shapeIds)
+		if err != nil {
+			return missingShapeIds, err
+		}
+		for shapeId, shapes := range compactor.shareShapes(dataSetId, loadedShapes) {
+			mappedShapes[shapeId] = shapes
+		}
 	}
 
 	for _, tripInstance := range tripsByTripId {
@@ -316,6 +493,116 @@ func loadShapesIntoTrips(tripsByTripId map[string]*TripInstance,
 	return missingShapeIds, nil
 }
 
+// LoadTripInstanceServiceExceptions sets the ServiceException for each TripInstance in tripsByTripId from dataSetId,
+// retrieving the exceptions once for each service date the trips are scheduled on
+func LoadTripInstanceServiceExceptions(ctx context.Context,
+	db *sqlx.DB,
+	dataSetId int64,
+	tripsByTripId map[string]*TripInstance) error {
+	exceptionsByServiceDate := make(map[string]ServiceException)
+	for _, tripInstance := range tripsByTripId {
+		serviceDate := tripInstance.ServiceDate()
+		if serviceDate.IsZero() {
+			continue
+		}
+		key := serviceDate.Format("2006-01-02")
+		exception, present := exceptionsByServiceDate[key]
+		if !present {
+			var err error
+			exception, err = GetServiceException(ctx, db, dataSetId, serviceDate)
+			if err != nil {
+				return err
+			}
+			exceptionsByServiceDate[key] = exception
+		}
+		tripInstance.ServiceException = exception
+	}
+	return nil
+}
+
+// GetTripInstances loads trip instances with tripIds from dataSetId scheduled on serviceDate, including their
+// StopTimeInstances. Shapes are not loaded, use LoadTripInstanceShapes if they are required.
+// The calendar day of serviceDate is used, times in the TripInstances are in the Location of the DataSet.
+// Trips and stop times are each retrieved in a single query regardless of the number of tripIds.
+// if any tripIds could not be loaded error will be of MissingTripInstances along with the trips that were found
+// trips are compacted by compactor, which may be nil when they aren't kept
+func GetTripInstances(ctx context.Context,
+	db *sqlx.DB,
+	dataSetId int64,
+	tripIds []string,
+	serviceDate time.Time,
+	compactor *TripCompactor) (map[string]*TripInstance, error) {
+
+	results := make(map[string]*TripInstance)
+	if len(tripIds) == 0 {
+		return results, nil
+	}
+
+	location, err := getDataSetLocation(ctx, db, dataSetId)
+	if err != nil {
+		return nil, err
+	}
+	serviceDate = time.Date(serviceDate.Year(), serviceDate.Month(), serviceDate.Day(), 0, 0, 0, 0, location)
+
+	tripIdArray := pgtype.TextArray{}
+	err = tripIdArray.Set(tripIds)
+	if err != nil {
+		return nil, fmt.Errorf("unable to use tripIds as query parameter: %w", err)
+	}
+
+	stopTimeMap, err := getStopTimeInstancesOnServiceDate(ctx, db, dataSetId, &tripIdArray, serviceDate)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryxContext(ctx, "select * from trip where data_set_id = $1 and trip_id = any($2)",
+		dataSetId, &tripIdArray)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve trips for dataSetId %d, error: %w", dataSetId, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		tripInstance := TripInstance{}
+		err = rows.StructScan(&tripInstance)
+		if err != nil {
+			return nil, err
+		}
+		stopTimes, present := stopTimeMap[tripInstance.TripId]
+		if !present {
+			continue
+		}
+		tripInstance.StopTimeInstances = stopTimes
+		results[tripInstance.TripId] = &tripInstance
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	err = LoadTripInstanceServiceExceptions(ctx, db, dataSetId, results)
+	if err != nil {
+		return nil, err
+	}
+	compactor.Compact(results)
+
+	missingTripIds := make([]string, 0)
+	for _, tripId := range tripIds {
+		if _, present := results[tripId]; !present {
+			missingTripIds = append(missingTripIds, tripId)
+		}
+	}
+	if len(missingTripIds) > 0 {
+		return results, &MissingTripInstances{
+			DataSetId:      dataSetId,
+			MissingTripIds: missingTripIds,
+		}
+	}
+	return results, nil
+}
+
 func removeStringsFromSlice(target []string, toRemove []string) []string {
 	removeMap := make(map[string]bool)
 	for _, s := range toRemove {
@@ -330,21 +617,30 @@ func removeStringsFromSlice(target []string, toRemove []string) []string {
 	return newSlice
 }
 
-func GetTripInstance(db *sqlx.DB,
+// GetTripInstance loads the TripInstance for tripId in dataSetId scheduled within tripSearchRangeSeconds of "at".
+// times in the TripInstance are in the Location of the DataSet
+// the trip is compacted by compactor, which may be nil when it isn't kept
+func GetTripInstance(ctx context.Context,
+	db *sqlx.DB,
 	dataSetId int64,
 	tripId string,
 	at time.Time,
-	tripSearchRangeSeconds int) (*TripInstance, error) {
-	scheduleSlices := GetScheduleSlicesForSearchRange(at, tripSearchRangeSeconds)
+	tripSearchRangeSeconds int,
+	compactor *TripCompactor) (*TripInstance, error) {
+	location, err := getDataSetLocation(ctx, db, dataSetId)
+	if err != nil {
+		return nil, err
+	}
+	scheduleSlices := GetScheduleSlicesForSearchRange(at.In(location), tripSearchRangeSeconds)
 
-	stopTimeMap, _, _, err := getStopTimeInstances(db, scheduleSlices, dataSetId, []string{tripId})
+	stopTimeMap, _, _, err := getStopTimeInstances(ctx, db, scheduleSlices, dataSetId, []string{tripId})
 
 	if err != nil {
 		return nil, err
 	}
 
 	statementString := "select * from trip where data_set_id = :data_set_id and trip_id = :trip_id"
-	rows, err := database.PrepareNamedQueryRowsFromMap(statementString, db, map[string]interface{}{
+	rows, err := database.PrepareNamedQueryRowsFromMapContext(ctx, statementString, db, map[string]interface{}{
 		"data_set_id": dataSetId,
 		"trip_id":     tripId,
 	})
@@ -373,8 +669,16 @@ func GetTripInstance(db *sqlx.DB,
 	}
 	// check the error from rows
 	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
 
-	return tripInstance, err
+	tripInstance.ServiceException, err = GetServiceException(ctx, db, dataSetId, tripInstance.ServiceDate())
+	if err != nil {
+		return nil, err
+	}
+	compactor.Compact(map[string]*TripInstance{tripInstance.TripId: tripInstance})
+	return tripInstance, nil
 }
 
 func loadTripInstanceRows(rows *sqlx.Rows,
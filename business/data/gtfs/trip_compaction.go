@@ -0,0 +1,152 @@
+package gtfs
+
+import "sync"
+
+// TripCompactor reduces the memory held by TripInstances kept by long running caches, such as the monitor's trip
+// cache and the aggregator's trip predictors.
+// Each trip's StopTimeInstances are allocated in a single block, and trips on the same shape share a single copy of its
+// Shapes, stored with their distances in one column so a shape takes a few allocations regardless of its number of
+// points. Route, service, block, shape and stop ids repeated across trips share one copy of their text.
+// A TripCompactor is owned by the component loading trips from one database and schema, as data set and shape ids of
+// different agencies can collide. Only trips on the newest data set seen are shared, and at most size shapes and ids
+// are held, each released once a newer data set is seen or once size is reached.
+// A nil TripCompactor leaves trips as they are loaded. Safe for concurrent use
+type TripCompactor struct {
+	mu        sync.Mutex
+	size      int
+	dataSetId int64
+	ids       map[string]string
+	shapes    map[string][]*Shape
+}
+
+// NewTripCompactor builds TripCompactor holding at most size shapes and ids
+func NewTripCompactor(size int) *TripCompactor {
+	return &TripCompactor{
+		mu:     sync.Mutex{},
+		size:   size,
+		ids:    make(map[string]string),
+		shapes: make(map[string][]*Shape),
+	}
+}
+
+// useDataSet releases the shapes and ids held for older data sets when dataSetId is newer, and returns true if they
+// are shared for dataSetId. Trips still running on a replaced data set are rare and aren't shared
+func (c *TripCompactor) useDataSet(dataSetId int64) bool {
+	if dataSetId > c.dataSetId {
+		c.dataSetId = dataSetId
+		c.ids = make(map[string]string)
+		c.shapes = make(map[string][]*Shape)
+	}
+	return dataSetId == c.dataSetId
+}
+
+// intern returns the copy of id held, holding id if no copy is
+func (c *TripCompactor) intern(id string) string {
+	if interned, present := c.ids[id]; present {
+		return interned
+	}
+	if len(c.ids) >= c.size {
+		c.ids = make(map[string]string)
+	}
+	c.ids[id] = id
+	return id
+}
+
+// Compact replaces each trip in tripsByTripId's StopTimeInstances with a compact copy, and its ids with shared copies
+func (c *TripCompactor) Compact(tripsByTripId map[string]*TripInstance) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, trip := range tripsByTripId {
+		if !c.useDataSet(trip.DataSetId) {
+			trip.StopTimeInstances = compactStopTimeInstances(trip.TripId, trip.StopTimeInstances, nil)
+			continue
+		}
+		trip.RouteId = c.intern(trip.RouteId)
+		trip.ServiceId = c.intern(trip.ServiceId)
+		trip.BlockId = c.intern(trip.BlockId)
+		trip.ShapeId = c.intern(trip.ShapeId)
+		trip.StopTimeInstances = compactStopTimeInstances(trip.TripId, trip.StopTimeInstances, c.intern)
+	}
+}
+
+// sharedShapes returns the shared Shapes of dataSetId held for shapeIds, along with the shapeIds that aren't held
+func (c *TripCompactor) sharedShapes(dataSetId int64, shapeIds []string) (map[string][]*Shape, []string) {
+	results := make(map[string][]*Shape)
+	if c == nil {
+		return results, shapeIds
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.useDataSet(dataSetId) {
+		return results, shapeIds
+	}
+	notHeld := make([]string, 0)
+	for _, shapeId := range shapeIds {
+		if shapes, present := c.shapes[shapeId]; present {
+			results[shapeId] = shapes
+		} else {
+			notHeld = append(notHeld, shapeId)
+		}
+	}
+	return results, notHeld
+}
+
+// shareShapes returns compact copies of shapesByShapeId, which are held to be shared by later trips on dataSetId
+func (c *TripCompactor) shareShapes(dataSetId int64, shapesByShapeId map[string][]*Shape) map[string][]*Shape {
+	if c == nil {
+		return shapesByShapeId
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	shared := c.useDataSet(dataSetId)
+	results := make(map[string][]*Shape)
+	for shapeId, shapes := range shapesByShapeId {
+		compact := compactShapes(shapeId, shapes)
+		if shared {
+			if len(c.shapes) >= c.size {
+				c.shapes = make(map[string][]*Shape)
+			}
+			c.shapes[shapeId] = compact
+		}
+		results[shapeId] = compact
+	}
+	return results
+}
+
+// compactStopTimeInstances copies stopTimes into a single block with tripId. Stop ids are shared through intern when it
+// isn't nil
+func compactStopTimeInstances(tripId string,
+	stopTimes []*StopTimeInstance,
+	intern func(string) string) []*StopTimeInstance {
+	block := make([]StopTimeInstance, len(stopTimes))
+	results := make([]*StopTimeInstance, len(stopTimes))
+	for i, stopTime := range stopTimes {
+		block[i] = *stopTime
+		block[i].TripId = tripId
+		if intern != nil {
+			block[i].StopId = intern(stopTime.StopId)
+		}
+		results[i] = &block[i]
+	}
+	return results
+}
+
+// compactShapes copies shapes into a single block, with their ShapeDistTraveled in a single column
+func compactShapes(shapeId string, shapes []*Shape) []*Shape {
+	block := make([]Shape, len(shapes))
+	distances := make([]float64, len(shapes))
+	results := make([]*Shape, len(shapes))
+	for i, shape := range shapes {
+		block[i] = *shape
+		block[i].ShapeId = shapeId
+		if shape.ShapeDistTraveled != nil {
+			distances[i] = *shape.ShapeDistTraveled
+			block[i].ShapeDistTraveled = &distances[i]
+		}
+		results[i] = &block[i]
+	}
+	return results
+}
@@ -0,0 +1,94 @@
+package gtfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_TripCompactor_Compact(t *testing.T) {
+	compactor := NewTripCompactor(10)
+	trip := makeTopologyTestTrip("A", "B", "C")
+	trip.DataSetId = 2
+	want := make([]StopTimeInstance, 0)
+	for _, stopTime := range trip.StopTimeInstances {
+		want = append(want, *stopTime)
+	}
+
+	compactor.Compact(map[string]*TripInstance{trip.TripId: trip})
+	got := make([]StopTimeInstance, 0)
+	for _, stopTime := range trip.StopTimeInstances {
+		got = append(got, *stopTime)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Compact() StopTimeInstances = %+v, want %+v", got, want)
+	}
+	if _, present := compactor.ids["B"]; !present {
+		t.Errorf("Compact() didn't share stop id B")
+	}
+
+	// a nil TripCompactor leaves trips as they are
+	var none *TripCompactor
+	none.Compact(map[string]*TripInstance{trip.TripId: trip})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("nil Compact() changed StopTimeInstances")
+	}
+}
+
+func Test_TripCompactor_shapes(t *testing.T) {
+	distance := 10.0
+	loaded := map[string][]*Shape{
+		"s1": {
+			{DataSetId: 2, ShapeId: "s1", ShapePtLat: 45.5, ShapePtLng: -122.6, ShapePtSequence: 1},
+			{DataSetId: 2, ShapeId: "s1", ShapePtLat: 45.6, ShapePtLng: -122.7, ShapePtSequence: 2,
+				ShapeDistTraveled: &distance},
+		},
+	}
+	compactor := NewTripCompactor(10)
+
+	shared := compactor.shareShapes(2, loaded)
+	if !reflect.DeepEqual(shared, loaded) {
+		t.Errorf("shareShapes() = %+v, want %+v", shared, loaded)
+	}
+	held, notHeld := compactor.sharedShapes(2, []string{"s1", "s2"})
+	if len(held["s1"]) != 2 || held["s1"][0] != shared["s1"][0] {
+		t.Errorf("sharedShapes() didn't return the shapes shared for s1")
+	}
+	if !reflect.DeepEqual(notHeld, []string{"s2"}) {
+		t.Errorf("sharedShapes() not held = %v, want [s2]", notHeld)
+	}
+
+	// another database's compactor doesn't share the shapes, even with the same data set and shape ids
+	if held, notHeld = NewTripCompactor(10).sharedShapes(2, []string{"s1"}); len(held) != 0 || len(notHeld) != 1 {
+		t.Errorf("sharedShapes() of another compactor = %v, %v, want nothing held", held, notHeld)
+	}
+
+	// trips on older data sets aren't shared, newer data sets release the shapes held
+	if held, notHeld = compactor.sharedShapes(1, []string{"s1"}); len(held) != 0 || len(notHeld) != 1 {
+		t.Errorf("sharedShapes() on older data set = %v, %v, want nothing held", held, notHeld)
+	}
+	if held, notHeld = compactor.sharedShapes(3, []string{"s1"}); len(held) != 0 || len(notHeld) != 1 {
+		t.Errorf("sharedShapes() on newer data set = %v, %v, want nothing held", held, notHeld)
+	}
+
+	// a nil TripCompactor holds nothing
+	var none *TripCompactor
+	if held, notHeld = none.sharedShapes(2, []string{"s1"}); len(held) != 0 || len(notHeld) != 1 {
+		t.Errorf("nil sharedShapes() = %v, %v, want nothing held", held, notHeld)
+	}
+	if got := none.shareShapes(2, loaded); !reflect.DeepEqual(got, loaded) {
+		t.Errorf("nil shareShapes() = %+v, want %+v", got, loaded)
+	}
+}
+
+func Test_TripCompactor_bounded(t *testing.T) {
+	compactor := NewTripCompactor(2)
+	compactor.useDataSet(1)
+	for _, id := range []string{"A", "B", "C"} {
+		compactor.intern(id)
+		compactor.shareShapes(1, map[string][]*Shape{id: {{ShapeId: id}}})
+	}
+	if len(compactor.ids) > 2 || len(compactor.shapes) > 2 {
+		t.Errorf("compactor holds %d ids and %d shapes, want at most 2 of each",
+			len(compactor.ids), len(compactor.shapes))
+	}
+}
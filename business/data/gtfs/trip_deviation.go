@@ -1,6 +1,7 @@
 package gtfs
 
 import (
+	"context"
 	"fmt"
 	"github.com/OpenTransitTools/transitcast/foundation/database"
 	"github.com/jmoiron/sqlx"
@@ -21,6 +22,13 @@ type TripDeviation struct {
 	AtStop    bool   `db:"at_stop" json:"at_stop"`
 	Delay     int    `db:"delay"`
 	RouteId   string `db:"-" json:"route_id"`
+	//ServiceDate is 12am on the service day of the trip, not recorded to the database.
+	//zero if produced by a version of the monitor that did not include it
+	ServiceDate time.Time `db:"-" json:"service_date"`
+	//ServiceException flags calendar exceptions on ServiceDate, not recorded to the database
+	ServiceException ServiceException `db:"-" json:"service_exception"`
+	//SchemaVersion is the MessageSchemaVersion of the app publishing the TripDeviation, not recorded to the database
+	SchemaVersion int `db:"-" json:"schema_version"`
 }
 
 // SchedulePosition returns the schedule position (where the vehicle is according to its schedule) of the vehicle
@@ -30,7 +38,7 @@ func (t *TripDeviation) SchedulePosition() time.Time {
 }
 
 // RecordTripDeviation saves slice of TripDeviations into database in batch
-func RecordTripDeviation(tripDeviations []*TripDeviation, db *sqlx.DB) error {
+func RecordTripDeviation(ctx context.Context, tripDeviations []*TripDeviation, db *sqlx.DB) error {
 	if len(tripDeviations) == 0 {
 		return nil
 	}
@@ -50,19 +58,20 @@ func RecordTripDeviation(tripDeviations []*TripDeviation, db *sqlx.DB) error {
 		":at_stop, " +
 		":delay)"
 	statementString = db.Rebind(statementString)
-	_, err := db.NamedExec(statementString, tripDeviations)
+	_, err := db.NamedExecContext(ctx, statementString, tripDeviations)
 	return err
 }
 
 // GetTripDeviations returns list of TripDeviations between start and end for vehicleId
-func GetTripDeviations(db *sqlx.DB,
+func GetTripDeviations(ctx context.Context,
+	db *sqlx.DB,
 	start time.Time,
 	end time.Time,
 	vehicleId string) ([]*TripDeviation, error) {
 	statementString := "select * from trip_deviation where created_at between :start and :end " +
 		" and vehicle_id = :vehicle_id " +
 		"order by created_at"
-	rows, err := database.PrepareNamedQueryRowsFromMap(statementString, db, map[string]interface{}{
+	rows, err := database.PrepareNamedQueryRowsFromMapContext(ctx, statementString, db, map[string]interface{}{
 		"start":      start,
 		"end":        end,
 		"vehicle_id": vehicleId,
@@ -86,3 +95,76 @@ func GetTripDeviations(db *sqlx.DB,
 	}
 	return tripDeviations, err
 }
+
+// GetLatestTripDeviations returns the most recent TripDeviation for each vehicle with a TripDeviation created between
+// start and end
+func GetLatestTripDeviations(ctx context.Context,
+	db *sqlx.DB,
+	start time.Time,
+	end time.Time) ([]*TripDeviation, error) {
+	statementString := "select distinct on (vehicle_id) * from trip_deviation " +
+		"where created_at between :start and :end " +
+		"order by vehicle_id, created_at desc"
+	rows, err := database.PrepareNamedQueryRowsFromMapContext(ctx, statementString, db, map[string]interface{}{
+		"start": start,
+		"end":   end,
+	})
+
+	defer func() {
+		if rows != nil {
+			_ = rows.Close()
+		}
+	}()
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve latest trip_deviation rows, error: %w", err)
+	}
+
+	tripDeviations := make([]*TripDeviation, 0)
+	for rows.Next() {
+		tripDeviation := TripDeviation{}
+		err = rows.StructScan(&tripDeviation)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan trip_deviation row, error: %w", err)
+		}
+		tripDeviations = append(tripDeviations, &tripDeviation)
+	}
+	return tripDeviations, rows.Err()
+}
+
+// GetRecentDeviations returns the TripDeviations for vehicleId with a DeviationTimestamp at or after since, ordered by
+// DeviationTimestamp
+func GetRecentDeviations(ctx context.Context,
+	db *sqlx.DB,
+	vehicleId string,
+	since time.Time) ([]*TripDeviation, error) {
+	// deviations are created after their deviation_timestamp, limiting created_at restricts the partitions scanned
+	statementString := "select * from trip_deviation where vehicle_id = :vehicle_id " +
+		"and created_at >= :since and deviation_timestamp >= :since " +
+		"order by deviation_timestamp"
+	rows, err := database.PrepareNamedQueryRowsFromMapContext(ctx, statementString, db, map[string]interface{}{
+		"vehicle_id": vehicleId,
+		"since":      since,
+	})
+
+	defer func() {
+		if rows != nil {
+			_ = rows.Close()
+		}
+	}()
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve recent trip_deviation rows, error: %w", err)
+	}
+
+	tripDeviations := make([]*TripDeviation, 0)
+	for rows.Next() {
+		tripDeviation := TripDeviation{}
+		err = rows.StructScan(&tripDeviation)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan trip_deviation row, error: %w", err)
+		}
+		tripDeviations = append(tripDeviations, &tripDeviation)
+	}
+	return tripDeviations, rows.Err()
+}
@@ -0,0 +1,84 @@
+package gtfs
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+)
+
+// AssignTripPatterns sets trip.pattern_id on every trip in dataSetId to the md5 hash of its stop ids and timepoints in
+// stop_sequence order, so trips serving the same stops with the same timepoints share a pattern_id in any data set.
+// Returns the number of distinct patterns
+func AssignTripPatterns(ctx context.Context, tx *sqlx.Tx, dataSetId int64) (int, error) {
+	statementString := "update trip t set pattern_id = p.pattern_id " +
+		"from (select trip_id, " +
+		"md5(string_agg(stop_id || ':' || coalesce(timepoint, 0), '_' order by stop_sequence)) as pattern_id " +
+		"from stop_time where data_set_id = $1 group by trip_id) p " +
+		"where t.data_set_id = $1 and t.trip_id = p.trip_id"
+	_, err := tx.ExecContext(ctx, statementString, dataSetId)
+	if err != nil {
+		return 0, fmt.Errorf("unable to assign stop patterns to trips in data set %d: %w", dataSetId, err)
+	}
+	var patterns int
+	err = tx.GetContext(ctx, &patterns, "select count(distinct pattern_id) from trip where data_set_id = $1",
+		dataSetId)
+	if err != nil {
+		return 0, fmt.Errorf("unable to count stop patterns in data set %d: %w", dataSetId, err)
+	}
+	return patterns, nil
+}
+
+// TripStopPattern is the sequence of stops served by a trip, with the scheduled arrival at each and whether it is a
+// timepoint, in stop_sequence order. PatternId is the trip's pattern_id, nil when none is assigned
+type TripStopPattern struct {
+	TripId       string
+	RouteId      string
+	ServiceId    string
+	PatternId    *string
+	StopIds      []string
+	ArrivalTimes []int
+	Timepoints   []bool
+}
+
+// GetTripStopPatterns retrieves the TripStopPattern of every trip in dataSetId
+func GetTripStopPatterns(ctx context.Context, db *sqlx.DB, dataSetId int64) ([]*TripStopPattern, error) {
+	query := "select st.trip_id, t.route_id, t.service_id, t.pattern_id, st.stop_id, " +
+		"coalesce(st.arrival_time, 0) as arrival_time, " +
+		"coalesce(st.timepoint, 0) as timepoint " +
+		"from stop_time st " +
+		"join trip t on t.data_set_id = st.data_set_id and t.trip_id = st.trip_id " +
+		"where st.data_set_id = ? " +
+		"order by st.trip_id, st.stop_sequence"
+	rows, err := db.QueryxContext(ctx, db.Rebind(query), dataSetId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve stop patterns of data set %d: %w", dataSetId, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var patterns []*TripStopPattern
+	var current *TripStopPattern
+	for rows.Next() {
+		var row struct {
+			TripId      string  `db:"trip_id"`
+			RouteId     string  `db:"route_id"`
+			ServiceId   string  `db:"service_id"`
+			PatternId   *string `db:"pattern_id"`
+			StopId      string  `db:"stop_id"`
+			ArrivalTime int     `db:"arrival_time"`
+			Timepoint   int     `db:"timepoint"`
+		}
+		if err = rows.StructScan(&row); err != nil {
+			return nil, err
+		}
+		if current == nil || current.TripId != row.TripId {
+			current = &TripStopPattern{TripId: row.TripId, RouteId: row.RouteId, ServiceId: row.ServiceId,
+				PatternId: row.PatternId}
+			patterns = append(patterns, current)
+		}
+		current.StopIds = append(current.StopIds, row.StopId)
+		current.ArrivalTimes = append(current.ArrivalTimes, row.ArrivalTime)
+		current.Timepoints = append(current.Timepoints, row.Timepoint == 1)
+	}
+	return patterns, rows.Err()
+}
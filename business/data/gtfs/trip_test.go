@@ -0,0 +1,63 @@
+package gtfs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTripInstance_ServiceDate(t *testing.T) {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Errorf("Unable to get testing time zone location")
+		return
+	}
+	makeTrip := func(serviceDate time.Time, arrivalTime int) *TripInstance {
+		return &TripInstance{
+			StopTimeInstances: []*StopTimeInstance{
+				{
+					StopTime:        StopTime{ArrivalTime: arrivalTime},
+					ArrivalDateTime: MakeScheduleTime(serviceDate, arrivalTime),
+				},
+			},
+		}
+	}
+	tests := []struct {
+		name string
+		trip *TripInstance
+		want time.Time
+	}{
+		{
+			name: "morning trip",
+			trip: makeTrip(time.Date(2021, 7, 13, 0, 0, 0, 0, location), 8*60*60),
+			want: time.Date(2021, 7, 13, 0, 0, 0, 0, location),
+		},
+		{
+			name: "trip after midnight belongs to prior service day",
+			trip: makeTrip(time.Date(2021, 7, 13, 0, 0, 0, 0, location), 25*60*60),
+			want: time.Date(2021, 7, 13, 0, 0, 0, 0, location),
+		},
+		{
+			name: "trip on day daylight saving time begins",
+			trip: makeTrip(time.Date(2021, 3, 14, 0, 0, 0, 0, location), 60*60),
+			want: time.Date(2021, 3, 14, 0, 0, 0, 0, location),
+		},
+		{
+			name: "late trip on day daylight saving time ends",
+			trip: makeTrip(time.Date(2021, 11, 7, 0, 0, 0, 0, location), 24*60*60+30*60),
+			want: time.Date(2021, 11, 7, 0, 0, 0, 0, location),
+		},
+		{
+			name: "trip without stops",
+			trip: &TripInstance{},
+			want: time.Time{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.trip.ServiceDate(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ServiceDate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
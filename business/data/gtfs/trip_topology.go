@@ -0,0 +1,66 @@
+package gtfs
+
+import (
+	"fmt"
+)
+
+// TripTopologyError describes a TripInstance whose stops can't be followed in order
+type TripTopologyError struct {
+	TripId string
+	Reason string
+}
+
+func (t *TripTopologyError) Error() string {
+	return fmt.Sprintf("trip %s has invalid topology: %s", t.TripId, t.Reason)
+}
+
+// ValidateTripTopology checks trip's StopTimeInstances can be matched to vehicle positions by stop_sequence.
+// Stop sequences must strictly increase, and times and shape distances must never decrease. Stops are identified by
+// stop_sequence rather than stop_id throughout, so loop trips visiting the same stop_id more than once are valid.
+// Returns TripTopologyError describing the first problem found
+func ValidateTripTopology(trip *TripInstance) error {
+	if len(trip.StopTimeInstances) < 2 {
+		return &TripTopologyError{
+			TripId: trip.TripId,
+			Reason: fmt.Sprintf("%d stops, at least two are required", len(trip.StopTimeInstances)),
+		}
+	}
+	for i := 1; i < len(trip.StopTimeInstances); i++ {
+		previous := trip.StopTimeInstances[i-1]
+		current := trip.StopTimeInstances[i]
+		if current.StopSequence <= previous.StopSequence {
+			return &TripTopologyError{
+				TripId: trip.TripId,
+				Reason: fmt.Sprintf("stop_sequence %d follows %d", current.StopSequence, previous.StopSequence),
+			}
+		}
+		if current.ArrivalTime < previous.DepartureTime {
+			return &TripTopologyError{
+				TripId: trip.TripId,
+				Reason: fmt.Sprintf("arrival at stop_sequence %d is before departure from stop_sequence %d",
+					current.StopSequence, previous.StopSequence),
+			}
+		}
+		if current.ShapeDistTraveled < previous.ShapeDistTraveled {
+			return &TripTopologyError{
+				TripId: trip.TripId,
+				Reason: fmt.Sprintf("shape_dist_traveled at stop_sequence %d is less than at stop_sequence %d",
+					current.StopSequence, previous.StopSequence),
+			}
+		}
+	}
+	return nil
+}
+
+// RemoveInvalidTripTopologies removes trips failing ValidateTripTopology from tripsByTripId, returning the errors
+// describing each trip removed
+func RemoveInvalidTripTopologies(tripsByTripId map[string]*TripInstance) []error {
+	var errs []error
+	for tripId, trip := range tripsByTripId {
+		if err := ValidateTripTopology(trip); err != nil {
+			errs = append(errs, err)
+			delete(tripsByTripId, tripId)
+		}
+	}
+	return errs
+}
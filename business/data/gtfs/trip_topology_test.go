@@ -0,0 +1,115 @@
+package gtfs
+
+import (
+	"errors"
+	"testing"
+)
+
+// makeTopologyTestTrip builds a TripInstance visiting stopIds in order, one minute and 500 feet apart
+func makeTopologyTestTrip(stopIds ...string) *TripInstance {
+	trip := &TripInstance{Trip: Trip{TripId: "loop"}}
+	for i, stopId := range stopIds {
+		trip.StopTimeInstances = append(trip.StopTimeInstances, &StopTimeInstance{
+			StopTime: StopTime{
+				TripId:            "loop",
+				StopSequence:      uint32(i + 1),
+				StopId:            stopId,
+				ArrivalTime:       3600 + i*60,
+				DepartureTime:     3600 + i*60,
+				ShapeDistTraveled: float64(i * 500),
+			},
+		})
+	}
+	return trip
+}
+
+func TestValidateTripTopology(t *testing.T) {
+	tests := []struct {
+		name    string
+		trip    *TripInstance
+		modify  func(trip *TripInstance)
+		wantErr bool
+	}{
+		{
+			name: "simple trip",
+			trip: makeTopologyTestTrip("A", "B", "C"),
+		},
+		{
+			name: "loop returning to first stop",
+			trip: makeTopologyTestTrip("A", "B", "C", "D", "A"),
+		},
+		{
+			name: "lollipop visiting stops twice",
+			trip: makeTopologyTestTrip("A", "B", "C", "D", "E", "C", "B", "A"),
+		},
+		{
+			name: "gaps in stop sequence",
+			trip: makeTopologyTestTrip("A", "B", "C"),
+			modify: func(trip *TripInstance) {
+				trip.StopTimeInstances[1].StopSequence = 5
+				trip.StopTimeInstances[2].StopSequence = 10
+			},
+		},
+		{
+			name:    "single stop",
+			trip:    makeTopologyTestTrip("A"),
+			wantErr: true,
+		},
+		{
+			name: "repeated stop sequence",
+			trip: makeTopologyTestTrip("A", "B", "A"),
+			modify: func(trip *TripInstance) {
+				trip.StopTimeInstances[2].StopSequence = 2
+			},
+			wantErr: true,
+		},
+		{
+			name: "arrival before previous departure",
+			trip: makeTopologyTestTrip("A", "B", "C"),
+			modify: func(trip *TripInstance) {
+				trip.StopTimeInstances[1].DepartureTime = 4000
+			},
+			wantErr: true,
+		},
+		{
+			name: "shape distance decreasing",
+			trip: makeTopologyTestTrip("A", "B", "A"),
+			modify: func(trip *TripInstance) {
+				trip.StopTimeInstances[2].ShapeDistTraveled = 0
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.modify != nil {
+				tt.modify(tt.trip)
+			}
+			err := ValidateTripTopology(tt.trip)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTripTopology() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var topologyError *TripTopologyError
+			if err != nil && !errors.As(err, &topologyError) {
+				t.Errorf("ValidateTripTopology() error = %v, want TripTopologyError", err)
+			}
+		})
+	}
+}
+
+func TestRemoveInvalidTripTopologies(t *testing.T) {
+	valid := makeTopologyTestTrip("A", "B", "A")
+	invalid := makeTopologyTestTrip("A")
+	invalid.TripId = "invalid"
+	trips := map[string]*TripInstance{"loop": valid, "invalid": invalid}
+	errs := RemoveInvalidTripTopologies(trips)
+	if len(errs) != 1 {
+		t.Errorf("RemoveInvalidTripTopologies() returned %d errors, want 1", len(errs))
+	}
+	if _, present := trips["invalid"]; present {
+		t.Errorf("RemoveInvalidTripTopologies() left invalid trip")
+	}
+	if _, present := trips["loop"]; !present {
+		t.Errorf("RemoveInvalidTripTopologies() removed valid loop trip")
+	}
+}
@@ -13,8 +13,30 @@ const (
 	StopStatisticsPrediction
 	TimepointStatisticsPrediction
 	NoFurtherPredictions
+	RecentObservationsPrediction
 )
 
+// String returns the name of the PredictionSource
+func (p PredictionSource) String() string {
+	switch p {
+	case SchedulePrediction:
+		return "SchedulePrediction"
+	case StopMLPrediction:
+		return "StopMLPrediction"
+	case TimepointMLPrediction:
+		return "TimepointMLPrediction"
+	case StopStatisticsPrediction:
+		return "StopStatisticsPrediction"
+	case TimepointStatisticsPrediction:
+		return "TimepointStatisticsPrediction"
+	case NoFurtherPredictions:
+		return "NoFurtherPredictions"
+	case RecentObservationsPrediction:
+		return "RecentObservationsPrediction"
+	}
+	return "Undefined"
+}
+
 // TripUpdate holds a predicted Trip and its StopTimeUpdates
 type TripUpdate struct {
 	TripId               string           `json:"trip_id"`
@@ -23,6 +45,8 @@ type TripUpdate struct {
 	Timestamp            uint64           `json:"timestamp"`
 	VehicleId            string           `json:"vehicle_id"`
 	StopTimeUpdates      []StopTimeUpdate `json:"stop_time_update"`
+	//SchemaVersion is the MessageSchemaVersion of the app publishing the TripUpdate
+	SchemaVersion int `json:"schema_version"`
 }
 
 // LastSchedulePosition return the last schedule position for this TripUpdate, if StopTimeUpdates is not empty
@@ -0,0 +1,19 @@
+package gtfs
+
+import "time"
+
+// VehicleAssignment is the trip and block a vehicle is running, published by gtfs-monitor for systems reconciling
+// vehicle assignments, such as CAD/AVL, that don't need full TripUpdates
+type VehicleAssignment struct {
+	VehicleId string `json:"vehicle_id"`
+	DataSetId int64  `json:"data_set_id"`
+	TripId    string `json:"trip_id"`
+	RouteId   string `json:"route_id"`
+	BlockId   string `json:"block_id"`
+	//TripStartTime is when the trip is scheduled to depart its first stop
+	TripStartTime time.Time `json:"trip_start_time"`
+	//AssignedAt is the timestamp of the first vehicle position placing the vehicle on the trip
+	AssignedAt time.Time `json:"assigned_at"`
+	//LastSeen is the timestamp of the vehicle's latest position on the trip
+	LastSeen time.Time `json:"last_seen"`
+}
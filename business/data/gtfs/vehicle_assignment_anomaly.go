@@ -0,0 +1,57 @@
+package gtfs
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// WrongDirectionAnomaly is the Anomaly of a VehicleAssignmentAnomaly for a vehicle travelling its trip's shape in
+// reverse, as when a vehicle is signed on to the wrong trip for a training run or deadhead
+const WrongDirectionAnomaly = "wrong_direction"
+
+// VehicleAssignmentAnomaly records a vehicle whose movement doesn't match the trip it reports being on
+type VehicleAssignmentAnomaly struct {
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	//DetectedAt is the timestamp of the vehicle position the anomaly was detected with
+	DetectedAt   time.Time `db:"detected_at" json:"detected_at"`
+	VehicleId    string    `db:"vehicle_id" json:"vehicle_id"`
+	DataSetId    int64     `db:"data_set_id" json:"data_set_id"`
+	TripId       string    `db:"trip_id" json:"trip_id"`
+	RouteId      string    `db:"route_id" json:"route_id"`
+	BlockId      string    `db:"block_id" json:"block_id"`
+	StopSequence uint32    `db:"stop_sequence" json:"stop_sequence"`
+	//Anomaly is the kind of anomaly detected, such as WrongDirectionAnomaly
+	Anomaly string `db:"anomaly" json:"anomaly"`
+	//Detail describes the movement the anomaly was detected from
+	Detail string `db:"detail" json:"detail"`
+}
+
+// RecordVehicleAssignmentAnomaly saves anomaly to database
+func RecordVehicleAssignmentAnomaly(ctx context.Context, anomaly *VehicleAssignmentAnomaly, db *sqlx.DB) error {
+	statementString := "insert into vehicle_assignment_anomaly (" +
+		"created_at, " +
+		"detected_at, " +
+		"vehicle_id, " +
+		"data_set_id, " +
+		"trip_id, " +
+		"route_id, " +
+		"block_id, " +
+		"stop_sequence, " +
+		"anomaly, " +
+		"detail) " +
+		"values (" +
+		":created_at, " +
+		":detected_at, " +
+		":vehicle_id, " +
+		":data_set_id, " +
+		":trip_id, " +
+		":route_id, " +
+		":block_id, " +
+		":stop_sequence, " +
+		":anomaly, " +
+		":detail)"
+	statementString = db.Rebind(statementString)
+	_, err := db.NamedExecContext(ctx, statementString, anomaly)
+	return err
+}
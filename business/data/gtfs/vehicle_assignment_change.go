@@ -0,0 +1,62 @@
+package gtfs
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// VehicleAssignmentChange records a vehicle reporting a new trip before completing the trip it was on
+type VehicleAssignmentChange struct {
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	//ChangedAt is the timestamp of the vehicle position reporting the new trip
+	ChangedAt time.Time `db:"changed_at" json:"changed_at"`
+	VehicleId string    `db:"vehicle_id" json:"vehicle_id"`
+	DataSetId int64     `db:"data_set_id" json:"data_set_id"`
+	//PreviousTripId and the other Previous fields describe the vehicle's last known position on the trip it left
+	PreviousTripId       string  `db:"previous_trip_id" json:"previous_trip_id"`
+	PreviousRouteId      string  `db:"previous_route_id" json:"previous_route_id"`
+	PreviousBlockId      string  `db:"previous_block_id" json:"previous_block_id"`
+	PreviousStopSequence uint32  `db:"previous_stop_sequence" json:"previous_stop_sequence"`
+	TripId               string  `db:"trip_id" json:"trip_id"`
+	RouteId              string  `db:"route_id" json:"route_id"`
+	BlockId              string  `db:"block_id" json:"block_id"`
+	StopSequence         *uint32 `db:"stop_sequence" json:"stop_sequence"`
+	//BlockChanged is true when the vehicle moved to a trip on a different block
+	BlockChanged bool `db:"block_changed" json:"block_changed"`
+}
+
+// RecordVehicleAssignmentChange saves change to database
+func RecordVehicleAssignmentChange(ctx context.Context, change *VehicleAssignmentChange, db *sqlx.DB) error {
+	statementString := "insert into vehicle_assignment_change (" +
+		"created_at, " +
+		"changed_at, " +
+		"vehicle_id, " +
+		"data_set_id, " +
+		"previous_trip_id, " +
+		"previous_route_id, " +
+		"previous_block_id, " +
+		"previous_stop_sequence, " +
+		"trip_id, " +
+		"route_id, " +
+		"block_id, " +
+		"stop_sequence, " +
+		"block_changed) " +
+		"values (" +
+		":created_at, " +
+		":changed_at, " +
+		":vehicle_id, " +
+		":data_set_id, " +
+		":previous_trip_id, " +
+		":previous_route_id, " +
+		":previous_block_id, " +
+		":previous_stop_sequence, " +
+		":trip_id, " +
+		":route_id, " +
+		":block_id, " +
+		":stop_sequence, " +
+		":block_changed)"
+	statementString = db.Rebind(statementString)
+	_, err := db.NamedExecContext(ctx, statementString, change)
+	return err
+}
@@ -0,0 +1,101 @@
+package gtfs
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+const (
+	// PullOutDeadhead is the Kind of a VehicleDeadhead from where a vehicle was waiting without a trip to the start of
+	// its first trip
+	PullOutDeadhead = "pull_out"
+	// PullInDeadhead is the Kind of a VehicleDeadhead from the end of a vehicle's trip to where it stopped without
+	// another trip
+	PullInDeadhead = "pull_in"
+	// BetweenTripsDeadhead is the Kind of a VehicleDeadhead from one of a vehicle's trips to the start of another
+	BetweenTripsDeadhead = "between_trips"
+)
+
+const (
+	// NoTripDeadhead is the Reason of a VehicleDeadhead that began with the vehicle reporting no trip
+	NoTripDeadhead = "no_trip"
+	// OffShapeDeadhead is the Reason of a VehicleDeadhead that began with the vehicle leaving its trip's shape
+	OffShapeDeadhead = "off_shape"
+)
+
+// VehicleDeadhead records a vehicle moving out of service, between trips or to and from the garage
+type VehicleDeadhead struct {
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	VehicleId string    `db:"vehicle_id" json:"vehicle_id"`
+	DataSetId int64     `db:"data_set_id" json:"data_set_id"`
+	//Kind is PullOutDeadhead, PullInDeadhead or BetweenTripsDeadhead
+	Kind string `db:"kind" json:"kind"`
+	//Reason is how the deadhead began, NoTripDeadhead or OffShapeDeadhead
+	Reason string `db:"reason" json:"reason"`
+	//StartedAt is the timestamp of the vehicle position the vehicle started moving from
+	StartedAt      time.Time `db:"started_at" json:"started_at"`
+	StartLatitude  *float64  `db:"start_latitude" json:"start_latitude"`
+	StartLongitude *float64  `db:"start_longitude" json:"start_longitude"`
+	//EndedAt is the timestamp of the position the vehicle rejoined a trip at, or for PullInDeadhead where it stopped
+	EndedAt      time.Time `db:"ended_at" json:"ended_at"`
+	EndLatitude  *float64  `db:"end_latitude" json:"end_latitude"`
+	EndLongitude *float64  `db:"end_longitude" json:"end_longitude"`
+	//DistanceMeters is the distance between the vehicle's positions while deadheading
+	DistanceMeters float64 `db:"distance_meters" json:"distance_meters"`
+	//PreviousTripId and the other Previous fields describe the vehicle's last position on a trip before the deadhead,
+	//and are nil for PullOutDeadhead
+	PreviousTripId       *string `db:"previous_trip_id" json:"previous_trip_id"`
+	PreviousBlockId      *string `db:"previous_block_id" json:"previous_block_id"`
+	PreviousStopSequence *uint32 `db:"previous_stop_sequence" json:"previous_stop_sequence"`
+	//TripId and the other fields following describe the vehicle's first position on a trip after the deadhead, and
+	//are nil for PullInDeadhead
+	TripId       *string `db:"trip_id" json:"trip_id"`
+	BlockId      *string `db:"block_id" json:"block_id"`
+	StopSequence *uint32 `db:"stop_sequence" json:"stop_sequence"`
+}
+
+// RecordVehicleDeadhead saves deadhead to database
+func RecordVehicleDeadhead(ctx context.Context, deadhead *VehicleDeadhead, db *sqlx.DB) error {
+	statementString := "insert into vehicle_deadhead (" +
+		"created_at, " +
+		"vehicle_id, " +
+		"data_set_id, " +
+		"kind, " +
+		"reason, " +
+		"started_at, " +
+		"start_latitude, " +
+		"start_longitude, " +
+		"ended_at, " +
+		"end_latitude, " +
+		"end_longitude, " +
+		"distance_meters, " +
+		"previous_trip_id, " +
+		"previous_block_id, " +
+		"previous_stop_sequence, " +
+		"trip_id, " +
+		"block_id, " +
+		"stop_sequence) " +
+		"values (" +
+		":created_at, " +
+		":vehicle_id, " +
+		":data_set_id, " +
+		":kind, " +
+		":reason, " +
+		":started_at, " +
+		":start_latitude, " +
+		":start_longitude, " +
+		":ended_at, " +
+		":end_latitude, " +
+		":end_longitude, " +
+		":distance_meters, " +
+		":previous_trip_id, " +
+		":previous_block_id, " +
+		":previous_stop_sequence, " +
+		":trip_id, " +
+		":block_id, " +
+		":stop_sequence)"
+	statementString = db.Rebind(statementString)
+	_, err := db.NamedExecContext(ctx, statementString, deadhead)
+	return err
+}
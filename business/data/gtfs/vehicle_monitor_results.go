@@ -8,3 +8,9 @@ type VehicleMonitorResults struct {
 	ObservedStopTimes []*ObservedStopTime
 	TripDeviations    []*TripDeviation
 }
+
+//MessageSchemaVersion is set on ObservedStopTime, TripDeviation and TripUpdate messages published over NATS.
+//Messages published before versioning have a SchemaVersion of 0. Fields are only added between versions, so
+//subscribers decode messages from older and newer versions alike, ignoring fields they don't know, allowing apps to
+//be upgraded one at a time. Increment it whenever a field is added to one of these messages
+const MessageSchemaVersion = 2
@@ -14,7 +14,10 @@ type MLModelType struct {
 	Name          string
 }
 
-// MLModel stores definitions for each model trained or to be trained by the system
+// MLModel stores definitions for each model trained or to be trained by the system.
+// PatternId and TimeBucket are set on models trained only with the observations of trips on the stop pattern with
+// pattern_id made in the TimeBucket with that sequence, they are nil on models trained with every observation of
+// their stops
 type MLModel struct {
 	MLModelId                    int64          `db:"ml_model_id" json:"ml_model_id"`
 	Version                      int            `db:"version" json:"version"`
@@ -33,6 +36,9 @@ type MLModel struct {
 	ObservedStopCount            *int           `db:"observed_stop_count" json:"observed_stop_count"`
 	Median                       *float64       `db:"median" json:"median"`
 	Average                      *float64       `db:"average" json:"average"`
+	Shadow                       bool           `db:"shadow" json:"shadow"`
+	PatternId                    *string        `db:"pattern_id" json:"pattern_id,omitempty"`
+	TimeBucket                   *int           `db:"time_bucket" json:"time_bucket,omitempty"`
 	ModelStops                   []*MLModelStop `json:"model_stops"`
 }
 
@@ -43,6 +49,9 @@ type MLModelStop struct {
 	Sequence      int    `db:"sequence" json:"sequence"`
 	StopId        string `db:"stop_id" json:"stop_id"`
 	NextStopId    string `db:"next_stop_id" json:"next_stop_id"`
+	//Distance is the shape_dist_traveled between StopId and NextStopId in the schedule the model was last trained
+	//for, nil for models recorded before distances were kept
+	Distance *float64 `db:"distance" json:"distance,omitempty"`
 }
 
 // GetMLModelType loads MLModelType with ml_model_type of modelTypeName
@@ -56,6 +65,16 @@ func GetMLModelType(db *sqlx.DB, modelTypeName string) (*MLModelType, error) {
 	return &modelType, nil
 }
 
+// GetMLModelTypes loads all MLModelType records
+func GetMLModelTypes(db *sqlx.DB) ([]*MLModelType, error) {
+	modelTypes := make([]*MLModelType, 0)
+	err := db.Select(&modelTypes, "select * from ml_model_type order by ml_model_type_id")
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve ModelTypes. error: %w", err)
+	}
+	return modelTypes, nil
+}
+
 // MakeMLModel MLModelType factory
 func MakeMLModel(modelType *MLModelType,
 	version int,
@@ -92,6 +111,12 @@ func GetModelNameForStopTimeInstances(stopTimes []*gtfs.StopTimeInstance) string
 	return strings.Join(stopNames, "_")
 }
 
+// GetPatternModelName names the model of the stops in the model named modelName trained only with observations of
+// trips on the stop pattern with patternId in the time bucket with sequence timeBucket
+func GetPatternModelName(modelName string, patternId string, timeBucket int) string {
+	return fmt.Sprintf("%s@%s-%d", modelName, patternId, timeBucket)
+}
+
 // MakeMLModelStop MLModelStop factory
 func MakeMLModelStop(sequence int, stopId string, nextStopId string) *MLModelStop {
 	return &MLModelStop{
@@ -119,7 +144,10 @@ func RecordNewMLModel(db *sqlx.DB, model *MLModel) (*MLModel, error) {
 		"last_train_attempt_timestamp, " +
 		"observed_stop_count, " +
 		"median, " +
-		"average ) " +
+		"average, " +
+		"shadow, " +
+		"pattern_id, " +
+		"time_bucket ) " +
 		"values (:version, " +
 		":start_timestamp, " +
 		":end_timestamp, " +
@@ -135,7 +163,10 @@ func RecordNewMLModel(db *sqlx.DB, model *MLModel) (*MLModel, error) {
 		":last_train_attempt_timestamp, " +
 		":observed_stop_count, " +
 		":median, " +
-		":average )"
+		":average, " +
+		":shadow, " +
+		":pattern_id, " +
+		":time_bucket )"
 	if model.MLModelId != 0 {
 		statementString = "update ml_model set version = :version, " +
 			"start_timestamp = :start_timestamp, " +
@@ -152,7 +183,10 @@ func RecordNewMLModel(db *sqlx.DB, model *MLModel) (*MLModel, error) {
 			"last_train_attempt_timestamp = :last_train_attempt_timestamp, " +
 			"observed_stop_count = :observed_stop_count, " +
 			"median = :median, " +
-			"average = :average " +
+			"average = :average, " +
+			"shadow = :shadow, " +
+			"pattern_id = :pattern_id, " +
+			"time_bucket = :time_bucket " +
 			"where ml_model_id = :ml_model_id"
 	}
 	statementString = db.Rebind(statementString)
@@ -197,7 +231,10 @@ func UpdateMLModel(db *sqlx.DB, model *MLModel) (*MLModel, error) {
 		"last_train_attempt_timestamp = :last_train_attempt_timestamp, " +
 		"observed_stop_count = :observed_stop_count, " +
 		"median = :median, " +
-		"average = :average " +
+		"average = :average, " +
+		"shadow = :shadow, " +
+		"pattern_id = :pattern_id, " +
+		"time_bucket = :time_bucket " +
 		"where ml_model_id = :ml_model_id"
 	statementString = db.Rebind(statementString)
 	_, err := db.NamedExec(statementString, model)
@@ -210,8 +247,8 @@ func UpdateMLModel(db *sqlx.DB, model *MLModel) (*MLModel, error) {
 // RecordNewMLStopModel records new MLModelStop record.
 func RecordNewMLStopModel(db *sqlx.DB, modelStop *MLModelStop) (*MLModelStop, error) {
 
-	statementString := "insert into ml_model_stop (ml_model_id, sequence, stop_id, next_stop_id) " +
-		"values (:ml_model_id, :sequence, :stop_id, :next_stop_id)"
+	statementString := "insert into ml_model_stop (ml_model_id, sequence, stop_id, next_stop_id, distance) " +
+		"values (:ml_model_id, :sequence, :stop_id, :next_stop_id, :distance)"
 	statementString = db.Rebind(statementString)
 	_, err := db.NamedExec(statementString, modelStop)
 	if err != nil {
@@ -227,21 +264,32 @@ func RecordNewMLStopModel(db *sqlx.DB, modelStop *MLModelStop) (*MLModelStop, er
 }
 
 // GetAllCurrentMLModelsByName returns map of all current MLModel by ModelName, where current timestamp is between
-// ml_model.start_timestamp and ml_model.end_timestamp
+// ml_model.start_timestamp and ml_model.end_timestamp. Shadow models are not included
 func GetAllCurrentMLModelsByName(db *sqlx.DB, trainedOnly bool) (map[string]*MLModel, error) {
-	modelStopsWhereClause := ""
-	modelWhereClause := ""
+	return getCurrentMLModelsByName(db, trainedOnly, false)
+}
+
+// GetShadowMLModelsByName returns map of current trained shadow MLModel by ModelName. Shadow models are candidates
+// for replacing the current model of the same name and are only used to evaluate their predictions
+func GetShadowMLModelsByName(db *sqlx.DB) (map[string]*MLModel, error) {
+	return getCurrentMLModelsByName(db, true, true)
+}
+
+// getCurrentMLModelsByName returns map of current MLModel by ModelName with ml_model.shadow matching shadow
+func getCurrentMLModelsByName(db *sqlx.DB, trainedOnly bool, shadow bool) (map[string]*MLModel, error) {
+	modelStopsWhereClause := " and m.shadow = ? "
+	modelWhereClause := " and shadow = ? "
 	if trainedOnly {
-		modelStopsWhereClause = " and m.trained_timestamp is not null "
-		modelWhereClause = " and trained_timestamp is not null and train_flag = false " +
+		modelStopsWhereClause += " and m.trained_timestamp is not null "
+		modelWhereClause += " and trained_timestamp is not null and train_flag = false " +
 			"and currently_relevant = true "
 	}
 	modelStopMap, err := GetMLModelStopsByMLModelID(db,
-		"select s.ml_model_id, s.ml_model_stop_id, s.stop_id, s.next_stop_id, s.sequence "+
+		db.Rebind("select s.ml_model_id, s.ml_model_stop_id, s.stop_id, s.next_stop_id, s.sequence, s.distance "+
 			"from ml_model_stop s left join ml_model m on s.ml_model_id = m.ml_model_id "+
 			"where current_timestamp between m.start_timestamp and m.end_timestamp "+
 			modelStopsWhereClause+
-			"order by s.ml_model_id, s.sequence")
+			"order by s.ml_model_id, s.sequence"), shadow)
 	if err != nil {
 		return nil, err
 	}
@@ -262,13 +310,16 @@ func GetAllCurrentMLModelsByName(db *sqlx.DB, trainedOnly bool) (map[string]*MLM
 		"last_train_attempt_timestamp, " +
 		"observed_stop_count, " +
 		"median, " +
-		"average " +
+		"average, " +
+		"shadow, " +
+		"pattern_id, " +
+		"time_bucket " +
 		"from ml_model where current_timestamp between start_timestamp and end_timestamp" +
 		modelWhereClause
 	modelMap := make(map[string]*MLModel)
 	err = GetMLModels(db, func(model *MLModel) {
 		modelMap[model.ModelName] = model
-	}, modelStopMap, statementString)
+	}, modelStopMap, db.Rebind(statementString), shadow)
 	if err != nil {
 		return nil, err
 	}
@@ -320,12 +371,26 @@ func GetMLModelStopsByMLModelID(db *sqlx.DB, query string, args ...interface{})
 		if err != nil {
 			return nil, err
 		}
-		modelStops, present := stopMap[stop.MLModelId]
-		if !present {
-			modelStops = make([]*MLModelStop, 1)
-			stopMap[stop.MLModelId] = modelStops
-		}
-		modelStops = append(modelStops, &stop)
+		stopMap[stop.MLModelId] = append(stopMap[stop.MLModelId], &stop)
 	}
 	return stopMap, nil
 }
+
+// GetMLModelBlob returns the trained model stored for mlModelId, or nil if no trained model has been stored
+func GetMLModelBlob(db *sqlx.DB, mlModelId int64) ([]byte, error) {
+	var blob []byte
+	err := db.Get(&blob, db.Rebind("select model_blob from ml_model where ml_model_id = ?"), mlModelId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve model_blob for ml_model_id %d. error: %w", mlModelId, err)
+	}
+	return blob, nil
+}
+
+// UpdateMLModelBlob stores blob as the trained model for mlModelId
+func UpdateMLModelBlob(db *sqlx.DB, mlModelId int64, blob []byte) error {
+	_, err := db.Exec(db.Rebind("update ml_model set model_blob = ? where ml_model_id = ?"), blob, mlModelId)
+	if err != nil {
+		return fmt.Errorf("unable to update model_blob for ml_model_id %d. error: %w", mlModelId, err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package mlmodels
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// MLModelStatus counts the current MLModels, those where the current timestamp is between ml_model.start_timestamp
+// and ml_model.end_timestamp, by their training state
+type MLModelStatus struct {
+	//Models is the number of current models that are not shadow models
+	Models int `db:"models" json:"models"`
+	//Relevant is the number of Models required by the current schedule
+	Relevant int `db:"relevant" json:"relevant"`
+	//Trained is the number of relevant Models with training results in use
+	Trained int `db:"trained" json:"trained"`
+	//AwaitingTraining is the number of Models flagged to be trained
+	AwaitingTraining int `db:"awaiting_training" json:"awaiting_training"`
+	//Shadow is the number of current shadow models
+	Shadow int `db:"shadow" json:"shadow"`
+	//LastTrainedAt is when a current model was last trained, nil if none have been
+	LastTrainedAt *time.Time `db:"last_trained_at" json:"last_trained_at"`
+	//AverageMLRMSE is the mean ml_rmse of the Trained models
+	AverageMLRMSE *float64 `db:"average_ml_rmse" json:"average_ml_rmse"`
+	//AverageScheduleRMSE is the mean avg_rmse of the Trained models
+	AverageScheduleRMSE *float64 `db:"average_schedule_rmse" json:"average_schedule_rmse"`
+}
+
+// GetMLModelStatus returns MLModelStatus of the current MLModels
+func GetMLModelStatus(ctx context.Context, db *sqlx.DB) (*MLModelStatus, error) {
+	trained := "not shadow and currently_relevant and trained_timestamp is not null and not train_flag"
+	query := "select " +
+		"count(*) filter (where not shadow) as models, " +
+		"count(*) filter (where not shadow and currently_relevant) as relevant, " +
+		"count(*) filter (where " + trained + ") as trained, " +
+		"count(*) filter (where not shadow and train_flag) as awaiting_training, " +
+		"count(*) filter (where shadow) as shadow, " +
+		"max(trained_timestamp) as last_trained_at, " +
+		"avg(ml_rmse) filter (where " + trained + ") as average_ml_rmse, " +
+		"avg(avg_rmse) filter (where " + trained + ") as average_schedule_rmse " +
+		"from ml_model where current_timestamp between start_timestamp and end_timestamp"
+	status := MLModelStatus{}
+	err := db.GetContext(ctx, &status, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve ml model status: %w", err)
+	}
+	return &status, nil
+}
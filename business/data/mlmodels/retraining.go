@@ -0,0 +1,66 @@
+package mlmodels
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+)
+
+// GetNewObservationCounts returns, by ml_model_id, the number of observations each current trained model has received
+// since ml_model.feature_trained_end_timestamp, the end of the observations it was trained on. A model's count is the
+// fewest observed_stop_time records of any of its stop pairs, the number of complete traversals of its stops.
+// Models keyed by stop pattern only count observations of trips on their pattern, made in any time bucket
+func GetNewObservationCounts(ctx context.Context, db *sqlx.DB) (map[int64]int, error) {
+	query := "select ml_model_id, min(observations) as observations " +
+		"from (select m.ml_model_id, s.ml_model_stop_id, count(o.observed_time) as observations " +
+		"from ml_model m " +
+		"join ml_model_stop s on s.ml_model_id = m.ml_model_id " +
+		"left join observed_stop_time o on o.stop_id = s.stop_id and o.next_stop_id = s.next_stop_id " +
+		"and o.observed_time > m.feature_trained_end_timestamp " +
+		"and (m.pattern_id is null or exists (select 1 from trip t where t.data_set_id = o.data_set_id " +
+		"and t.trip_id = o.trip_id and t.pattern_id = m.pattern_id)) " +
+		"where current_timestamp between m.start_timestamp and m.end_timestamp " +
+		"and not m.shadow and m.currently_relevant and not m.train_flag " +
+		"and m.trained_timestamp is not null and m.feature_trained_end_timestamp is not null " +
+		"group by m.ml_model_id, s.ml_model_stop_id) pair " +
+		"group by ml_model_id"
+	var rows []struct {
+		MLModelId    int64 `db:"ml_model_id"`
+		Observations int   `db:"observations"`
+	}
+	err := db.SelectContext(ctx, &rows, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to count new observations of models: %w", err)
+	}
+	counts := make(map[int64]int, len(rows))
+	for _, row := range rows {
+		counts[row.MLModelId] = row.Observations
+	}
+	return counts, nil
+}
+
+// FlagMLModelsForTraining sets train_flag on the models with mlModelIds so they are trained again
+func FlagMLModelsForTraining(ctx context.Context, tx *sqlx.Tx, mlModelIds []int64) error {
+	if len(mlModelIds) == 0 {
+		return nil
+	}
+	query, args, err := sqlx.In("update ml_model set train_flag = true where ml_model_id in (?)", mlModelIds)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, tx.Rebind(query), args...)
+	if err != nil {
+		return fmt.Errorf("unable to flag models for training: %w", err)
+	}
+	return nil
+}
+
+// UpdateMLModelStopDistance records modelStop.Distance
+func UpdateMLModelStopDistance(ctx context.Context, tx *sqlx.Tx, modelStop *MLModelStop) error {
+	_, err := tx.ExecContext(ctx, tx.Rebind("update ml_model_stop set distance = ? where ml_model_stop_id = ?"),
+		modelStop.Distance, modelStop.MLModelStopId)
+	if err != nil {
+		return fmt.Errorf("unable to update distance of ml_model_stop_id %d: %w", modelStop.MLModelStopId, err)
+	}
+	return nil
+}
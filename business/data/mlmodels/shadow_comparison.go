@@ -0,0 +1,53 @@
+package mlmodels
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// ShadowComparison records the prediction of a shadow MLModel alongside the prediction of the current MLModel it may
+// replace, made with the same features
+type ShadowComparison struct {
+	ComparisonTimestamp time.Time `db:"comparison_timestamp" json:"comparison_timestamp"`
+	ModelName           string    `db:"model_name" json:"model_name"`
+	TripId              string    `db:"trip_id" json:"trip_id"`
+	MLModelId           int64     `db:"ml_model_id" json:"ml_model_id"`
+	Version             int       `db:"version" json:"version"`
+	ShadowMLModelId     int64     `db:"shadow_ml_model_id" json:"shadow_ml_model_id"`
+	ShadowVersion       int       `db:"shadow_version" json:"shadow_version"`
+	//Prediction is the number of seconds predicted by the current model
+	Prediction float64 `db:"prediction" json:"prediction"`
+	//ShadowPrediction is the number of seconds predicted by the shadow model
+	ShadowPrediction float64 `db:"shadow_prediction" json:"shadow_prediction"`
+}
+
+// RecordShadowComparisons saves comparisons into database
+func RecordShadowComparisons(ctx context.Context, db *sqlx.DB, comparisons []*ShadowComparison) error {
+	if len(comparisons) == 0 {
+		return nil
+	}
+	statementString := "insert into ml_model_shadow_comparison " +
+		"(comparison_timestamp, " +
+		"model_name, " +
+		"trip_id, " +
+		"ml_model_id, " +
+		"version, " +
+		"shadow_ml_model_id, " +
+		"shadow_version, " +
+		"prediction, " +
+		"shadow_prediction) " +
+		"values " +
+		"(:comparison_timestamp, " +
+		":model_name, " +
+		":trip_id, " +
+		":ml_model_id, " +
+		":version, " +
+		":shadow_ml_model_id, " +
+		":shadow_version, " +
+		":prediction, " +
+		":shadow_prediction)"
+	statementString = db.Rebind(statementString)
+	_, err := db.NamedExecContext(ctx, statementString, comparisons)
+	return err
+}
@@ -0,0 +1,177 @@
+package mlmodels
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"strings"
+	"time"
+)
+
+// TimeBucket is a named span of service, such as weekday peak or weekend, covering the days of the week from
+// FirstWeekday through LastWeekday between StartSeconds and EndSeconds past midnight. A span whose EndSeconds is not
+// after StartSeconds runs past midnight
+type TimeBucket struct {
+	//Sequence numbers each TimeBucket from 1 in the order defined, it is the value of the time bucket inference feature
+	Sequence     int    `db:"sequence" json:"sequence"`
+	Name         string `db:"name" json:"name"`
+	FirstWeekday int    `db:"first_weekday" json:"first_weekday"`
+	LastWeekday  int    `db:"last_weekday" json:"last_weekday"`
+	StartSeconds int    `db:"start_seconds" json:"start_seconds"`
+	EndSeconds   int    `db:"end_seconds" json:"end_seconds"`
+}
+
+// contains returns true if weekday and seconds past midnight fall in TimeBucket
+func (b *TimeBucket) contains(weekday int, seconds int) bool {
+	if b.FirstWeekday <= b.LastWeekday {
+		if weekday < b.FirstWeekday || weekday > b.LastWeekday {
+			return false
+		}
+	} else if weekday < b.FirstWeekday && weekday > b.LastWeekday {
+		return false
+	}
+	if b.StartSeconds < b.EndSeconds {
+		return seconds >= b.StartSeconds && seconds < b.EndSeconds
+	}
+	return seconds >= b.StartSeconds || seconds < b.EndSeconds
+}
+
+// TimeBucketSequence returns the Sequence of the first of buckets containing "at", or 0 when none do
+func TimeBucketSequence(buckets []*TimeBucket, at time.Time) int {
+	return ScheduleTimeBucketSequence(buckets, int(at.Weekday()), at.Hour()*3600+at.Minute()*60+at.Second())
+}
+
+// ScheduleTimeBucketSequence returns the Sequence of the first of buckets containing the schedule time scheduleSeconds
+// past midnight of a service date falling on weekday, or 0 when none do. Schedule times past 24:00:00 fall on the
+// following day
+func ScheduleTimeBucketSequence(buckets []*TimeBucket, weekday int, scheduleSeconds int) int {
+	weekday = (weekday + scheduleSeconds/(24*3600)) % 7
+	seconds := scheduleSeconds % (24 * 3600)
+	for _, bucket := range buckets {
+		if bucket.contains(weekday, seconds) {
+			return bucket.Sequence
+		}
+	}
+	return 0
+}
+
+var weekdayAbbreviations = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseTimeBuckets reads TimeBuckets from definition, a list of buckets separated by ';' each written as
+// name=days@HH:MM-HH:MM, where days is a day of the week or a range of them such as mon-fri. The time range may be
+// left out to cover the whole day, for example:
+// "am_peak=mon-fri@06:00-09:00;pm_peak=mon-fri@15:00-18:30;weekend=sat-sun"
+func ParseTimeBuckets(definition string) ([]*TimeBucket, error) {
+	var buckets []*TimeBucket
+	for _, entry := range strings.Split(definition, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, span, found := strings.Cut(entry, "=")
+		if !found || name == "" {
+			return nil, fmt.Errorf("time bucket %q is not written as name=days@HH:MM-HH:MM", entry)
+		}
+		days, hours, _ := strings.Cut(span, "@")
+		bucket := &TimeBucket{Sequence: len(buckets) + 1, Name: name}
+		firstDay, lastDay, isRange := strings.Cut(days, "-")
+		if !isRange {
+			lastDay = firstDay
+		}
+		var err error
+		if bucket.FirstWeekday, err = parseWeekday(firstDay); err != nil {
+			return nil, fmt.Errorf("time bucket %s: %w", name, err)
+		}
+		if bucket.LastWeekday, err = parseWeekday(lastDay); err != nil {
+			return nil, fmt.Errorf("time bucket %s: %w", name, err)
+		}
+		if hours != "" {
+			start, end, found := strings.Cut(hours, "-")
+			if !found {
+				return nil, fmt.Errorf("time bucket %s: expected HH:MM-HH:MM, got %q", name, hours)
+			}
+			if bucket.StartSeconds, err = parseTimeOfDay(start); err != nil {
+				return nil, fmt.Errorf("time bucket %s: %w", name, err)
+			}
+			if bucket.EndSeconds, err = parseTimeOfDay(end); err != nil {
+				return nil, fmt.Errorf("time bucket %s: %w", name, err)
+			}
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+// parseWeekday converts a three letter day abbreviation into its time.Weekday number
+func parseWeekday(day string) (int, error) {
+	day = strings.ToLower(strings.TrimSpace(day))
+	for i, abbreviation := range weekdayAbbreviations {
+		if day == abbreviation {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day of the week %q, expected one of %s", day,
+		strings.Join(weekdayAbbreviations, ","))
+}
+
+// parseTimeOfDay converts HH:MM into seconds past midnight, allowing 24:00 for the end of the day
+func parseTimeOfDay(value string) (int, error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		if strings.TrimSpace(value) == "24:00" {
+			return 24 * 3600, nil
+		}
+		return 0, fmt.Errorf("unable to parse time of day %q, expected HH:MM", value)
+	}
+	return parsed.Hour()*3600 + parsed.Minute()*60, nil
+}
+
+// GetTimeBuckets retrieves the TimeBuckets recorded by ReplaceTimeBuckets in Sequence order
+func GetTimeBuckets(ctx context.Context, db *sqlx.DB) ([]*TimeBucket, error) {
+	var buckets []*TimeBucket
+	err := db.SelectContext(ctx, &buckets, "select sequence, name, first_weekday, last_weekday, start_seconds, "+
+		"end_seconds from ml_time_bucket order by sequence")
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve time buckets: %w", err)
+	}
+	return buckets, nil
+}
+
+// ReplaceTimeBuckets replaces the recorded TimeBuckets with buckets, returning true if they differ from those
+// previously recorded
+func ReplaceTimeBuckets(ctx context.Context, tx *sqlx.Tx, buckets []*TimeBucket) (bool, error) {
+	var previous []*TimeBucket
+	err := tx.SelectContext(ctx, &previous, "select sequence, name, first_weekday, last_weekday, start_seconds, "+
+		"end_seconds from ml_time_bucket order by sequence")
+	if err != nil {
+		return false, fmt.Errorf("unable to retrieve time buckets: %w", err)
+	}
+	if sameTimeBuckets(previous, buckets) {
+		return false, nil
+	}
+	if _, err = tx.ExecContext(ctx, "delete from ml_time_bucket"); err != nil {
+		return false, fmt.Errorf("unable to remove time buckets: %w", err)
+	}
+	for _, bucket := range buckets {
+		_, err = tx.NamedExecContext(ctx, "insert into ml_time_bucket (sequence, name, first_weekday, "+
+			"last_weekday, start_seconds, end_seconds) values (:sequence, :name, :first_weekday, :last_weekday, "+
+			":start_seconds, :end_seconds)", bucket)
+		if err != nil {
+			return false, fmt.Errorf("unable to record time bucket %s: %w", bucket.Name, err)
+		}
+	}
+	return true, nil
+}
+
+// sameTimeBuckets returns true if a and b hold the same TimeBuckets in the same order
+func sameTimeBuckets(a []*TimeBucket, b []*TimeBucket) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if *a[i] != *b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package mlmodels
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTimeBuckets(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition string
+		want       []*TimeBucket
+		wantErr    bool
+	}{
+		{
+			name:       "No buckets",
+			definition: "",
+		},
+		{
+			name:       "Peaks and weekend",
+			definition: "am_peak=mon-fri@06:00-09:00; pm_peak=mon-fri@15:00-18:30;weekend=sat-sun",
+			want: []*TimeBucket{
+				{Sequence: 1, Name: "am_peak", FirstWeekday: 1, LastWeekday: 5, StartSeconds: 21600, EndSeconds: 32400},
+				{Sequence: 2, Name: "pm_peak", FirstWeekday: 1, LastWeekday: 5, StartSeconds: 54000, EndSeconds: 66600},
+				{Sequence: 3, Name: "weekend", FirstWeekday: 6, LastWeekday: 0},
+			},
+		},
+		{
+			name:       "Single day through end of day",
+			definition: "friday_night=fri@20:00-24:00",
+			want: []*TimeBucket{
+				{Sequence: 1, Name: "friday_night", FirstWeekday: 5, LastWeekday: 5, StartSeconds: 72000,
+					EndSeconds: 86400},
+			},
+		},
+		{
+			name:       "Missing name",
+			definition: "mon-fri@06:00-09:00",
+			wantErr:    true,
+		},
+		{
+			name:       "Unknown day",
+			definition: "peak=monday@06:00-09:00",
+			wantErr:    true,
+		},
+		{
+			name:       "Invalid time",
+			definition: "peak=mon@6am-9am",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTimeBuckets(tt.definition)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseTimeBuckets() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTimeBuckets() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeBucketSequence(t *testing.T) {
+	buckets, err := ParseTimeBuckets("am_peak=mon-fri@06:00-09:00;weekend=sat-sun;owl=fri-mon@23:00-04:00")
+	if err != nil {
+		t.Fatalf("ParseTimeBuckets() error = %v", err)
+	}
+	// 2022-05-23 is a Monday
+	monday := time.Date(2022, 5, 23, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		at   time.Time
+		want int
+	}{
+		{name: "Weekday peak start", at: monday.Add(6 * time.Hour), want: 1},
+		{name: "Weekday peak end is excluded", at: monday.Add(9 * time.Hour), want: 0},
+		{name: "Weekday midday", at: monday.Add(12 * time.Hour), want: 0},
+		{name: "First matching bucket", at: monday.AddDate(0, 0, -1).Add(23 * time.Hour), want: 2},
+		{name: "Past midnight", at: monday.Add(2 * time.Hour), want: 3},
+		{name: "Outside wrapped days", at: monday.AddDate(0, 0, 1).Add(2 * time.Hour), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TimeBucketSequence(buckets, tt.at); got != tt.want {
+				t.Errorf("TimeBucketSequence() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleTimeBucketSequence(t *testing.T) {
+	buckets, err := ParseTimeBuckets("am_peak=mon-fri@06:00-09:00;weekend=sat-sun")
+	if err != nil {
+		t.Fatalf("ParseTimeBuckets() error = %v", err)
+	}
+	tests := []struct {
+		name            string
+		weekday         int
+		scheduleSeconds int
+		want            int
+	}{
+		{name: "Weekday peak", weekday: 1, scheduleSeconds: 7 * 3600, want: 1},
+		{name: "Friday past midnight falls on saturday", weekday: 5, scheduleSeconds: 25 * 3600, want: 2},
+		{name: "Sunday past midnight falls on monday", weekday: 0, scheduleSeconds: 30 * 3600, want: 1},
+		{name: "Sunday late evening", weekday: 0, scheduleSeconds: 23 * 3600, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ScheduleTimeBucketSequence(buckets, tt.weekday, tt.scheduleSeconds); got != tt.want {
+				t.Errorf("ScheduleTimeBucketSequence() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
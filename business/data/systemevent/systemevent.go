@@ -0,0 +1,159 @@
+// Package systemevent records an audit trail of operational changes, such as schedule data set loads, model
+// discoveries, configuration changes and apps starting and stopping, so changes in prediction quality can be
+// correlated with them
+package systemevent
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"strings"
+	"time"
+)
+
+// Types of SystemEvent
+const (
+	AppStarted       = "app_started"
+	AppStopped       = "app_stopped"
+	ConfigChanged    = "config_changed"
+	DataSetLoaded    = "data_set_loaded"
+	DataSetDeleted   = "data_set_deleted"
+	ModelsDiscovered = "models_discovered"
+	ModelDisabled    = "model_disabled"
+	ScheduleChanged  = "schedule_changed"
+)
+
+// SystemEvent is an operational change made by an app
+type SystemEvent struct {
+	Id        int64     `db:"id" json:"id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	//App is the name of the app making the change, such as gtfs-loader
+	App string `db:"app" json:"app"`
+	//Version is the build version of App
+	Version   string `db:"version" json:"version"`
+	EventType string `db:"event_type" json:"event_type"`
+	//Description summarizes the change in a line
+	Description string `db:"description" json:"description"`
+	//Details holds anything more needed to understand the change, such as the configuration an app started with
+	Details string `db:"details" json:"details"`
+}
+
+// String returns a one line description of the SystemEvent
+func (e SystemEvent) String() string {
+	return fmt.Sprintf("%s %s %s (%s): %s", e.CreatedAt.Local().Format(time.RFC3339), e.EventType, e.App, e.Version,
+		e.Description)
+}
+
+// Record saves event to the database
+func Record(ctx context.Context, db *sqlx.DB, event *SystemEvent) error {
+	statementString := "insert into system_event (" +
+		"created_at, " +
+		"app, " +
+		"version, " +
+		"event_type, " +
+		"description, " +
+		"details) " +
+		"values (" +
+		":created_at, " +
+		":app, " +
+		":version, " +
+		":event_type, " +
+		":description, " +
+		":details)"
+	statementString = db.Rebind(statementString)
+	_, err := db.NamedExecContext(ctx, statementString, event)
+	if err != nil {
+		return fmt.Errorf("unable to record %s event of %s, error: %w", event.EventType, event.App, err)
+	}
+	return nil
+}
+
+// RecordAppStart records app starting at "at" with config, first recording a ConfigChanged event listing the lines of
+// config that differ from the configuration app last started with
+func RecordAppStart(ctx context.Context, db *sqlx.DB, app string, version string, config string, at time.Time) error {
+	lastStart, err := GetLastSystemEvent(ctx, db, app, AppStarted)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if lastStart != nil && lastStart.Details != config {
+		err = Record(ctx, db, &SystemEvent{
+			CreatedAt: at,
+			App:       app,
+			Version:   version,
+			EventType: ConfigChanged,
+			Description: fmt.Sprintf("configuration differs from the start at %s",
+				lastStart.CreatedAt.Local().Format(time.RFC3339)),
+			Details: configDifference(lastStart.Details, config),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return Record(ctx, db, &SystemEvent{
+		CreatedAt:   at,
+		App:         app,
+		Version:     version,
+		EventType:   AppStarted,
+		Description: fmt.Sprintf("started version %s", version),
+		Details:     config,
+	})
+}
+
+// configDifference lists the lines of config missing from previous prefixed with "+ ", followed by the lines of
+// previous missing from config prefixed with "- "
+func configDifference(previous string, config string) string {
+	previousLines := make(map[string]bool)
+	for _, line := range strings.Split(previous, "\n") {
+		previousLines[line] = true
+	}
+	configLines := make(map[string]bool)
+	var added, removed []string
+	for _, line := range strings.Split(config, "\n") {
+		configLines[line] = true
+		if !previousLines[line] {
+			added = append(added, "+ "+line)
+		}
+	}
+	for _, line := range strings.Split(previous, "\n") {
+		if !configLines[line] {
+			removed = append(removed, "- "+line)
+		}
+	}
+	return strings.Join(append(added, removed...), "\n")
+}
+
+// RecordAppStop records app stopping at "at"
+func RecordAppStop(ctx context.Context, db *sqlx.DB, app string, version string, at time.Time) error {
+	return Record(ctx, db, &SystemEvent{
+		CreatedAt:   at,
+		App:         app,
+		Version:     version,
+		EventType:   AppStopped,
+		Description: fmt.Sprintf("stopped version %s", version),
+	})
+}
+
+// GetLastSystemEvent retrieves the most recent SystemEvent of eventType recorded by app, returning an error wrapping
+// sql.ErrNoRows if there are none
+func GetLastSystemEvent(ctx context.Context, db *sqlx.DB, app string, eventType string) (*SystemEvent, error) {
+	query := "select * from system_event where app = $1 and event_type = $2 order by created_at desc limit 1"
+	event := SystemEvent{}
+	err := db.GetContext(ctx, &event, db.Rebind(query), app, eventType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve last %s event of %s, error: %w", eventType, app, err)
+	}
+	return &event, nil
+}
+
+// GetSystemEvents retrieves the SystemEvents recorded from start up to end, oldest first
+func GetSystemEvents(ctx context.Context, db *sqlx.DB, start time.Time, end time.Time) ([]SystemEvent, error) {
+	query := "select * from system_event where created_at >= $1 and created_at < $2 order by created_at, id"
+	var results []SystemEvent
+	err := db.SelectContext(ctx, &results, db.Rebind(query), start, end)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve SystemEvents from %v to %v, error: %w", start, end, err)
+	}
+	return results, nil
+}
@@ -0,0 +1,38 @@
+package systemevent
+
+import "testing"
+
+func Test_configDifference(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous string
+		config   string
+		want     string
+	}{
+		{
+			name:     "unchanged",
+			previous: "--db-host=db\n--loop-every-seconds=3",
+			config:   "--db-host=db\n--loop-every-seconds=3",
+			want:     "",
+		},
+		{
+			name:     "changed value",
+			previous: "--db-host=db\n--loop-every-seconds=3\n--nats-url=nats",
+			config:   "--db-host=db\n--loop-every-seconds=5\n--nats-url=nats",
+			want:     "+ --loop-every-seconds=5\n- --loop-every-seconds=3",
+		},
+		{
+			name:     "added and removed options",
+			previous: "--db-host=db\n--early-tolerance=0.1",
+			config:   "--db-host=db\n--position-workers=4\n--nats-tenant=trimet",
+			want:     "+ --position-workers=4\n+ --nats-tenant=trimet\n- --early-tolerance=0.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := configDifference(tt.previous, tt.config); got != tt.want {
+				t.Errorf("configDifference() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
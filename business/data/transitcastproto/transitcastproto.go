@@ -0,0 +1,1195 @@
+// Protocol definition of the messages exchanged over NATS between gtfs-monitor, gtfs-aggregator,
+// gtfs-tripupdate-svc and the inference model runner, and of the Inference service gtfs-aggregator calls over gRPC
+// when the model runner runs as a sidecar.
+//
+// Fields may only be added to these messages, never renumbered or removed, so apps built against different versions
+// of this file can exchange messages during rolling upgrades.
+// Times are unix nanoseconds, zero when the time is not set.
+//
+// Regenerate transitcastproto.go and transitcastproto_grpc.go after changing this file with "make proto"
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.0
+// 	protoc        v3.14.0
+// source: business/data/transitcastproto/transitcast.proto
+
+package transitcastproto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// ObservedStopTime is a vehicle's observed movement between two stops
+type ObservedStopTime struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ObservedTime       int64   `protobuf:"varint,1,opt,name=observed_time,json=observedTime,proto3" json:"observed_time,omitempty"`
+	StopId             string  `protobuf:"bytes,2,opt,name=stop_id,json=stopId,proto3" json:"stop_id,omitempty"`
+	NextStopId         string  `protobuf:"bytes,3,opt,name=next_stop_id,json=nextStopId,proto3" json:"next_stop_id,omitempty"`
+	VehicleId          string  `protobuf:"bytes,4,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	RouteId            string  `protobuf:"bytes,5,opt,name=route_id,json=routeId,proto3" json:"route_id,omitempty"`
+	ObservedAtStop     bool    `protobuf:"varint,6,opt,name=observed_at_stop,json=observedAtStop,proto3" json:"observed_at_stop,omitempty"`
+	ObservedAtNextStop bool    `protobuf:"varint,7,opt,name=observed_at_next_stop,json=observedAtNextStop,proto3" json:"observed_at_next_stop,omitempty"`
+	StopDistance       float64 `protobuf:"fixed64,8,opt,name=stop_distance,json=stopDistance,proto3" json:"stop_distance,omitempty"`
+	NextStopDistance   float64 `protobuf:"fixed64,9,opt,name=next_stop_distance,json=nextStopDistance,proto3" json:"next_stop_distance,omitempty"`
+	TravelSeconds      int32   `protobuf:"varint,10,opt,name=travel_seconds,json=travelSeconds,proto3" json:"travel_seconds,omitempty"`
+	ScheduledSeconds   *int32  `protobuf:"varint,11,opt,name=scheduled_seconds,json=scheduledSeconds,proto3,oneof" json:"scheduled_seconds,omitempty"`
+	ScheduledTime      *int32  `protobuf:"varint,12,opt,name=scheduled_time,json=scheduledTime,proto3,oneof" json:"scheduled_time,omitempty"`
+	DataSetId          int64   `protobuf:"varint,13,opt,name=data_set_id,json=dataSetId,proto3" json:"data_set_id,omitempty"`
+	TripId             string  `protobuf:"bytes,14,opt,name=trip_id,json=tripId,proto3" json:"trip_id,omitempty"`
+	CreatedAt          int64   `protobuf:"varint,15,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	SchemaVersion      int32   `protobuf:"varint,16,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"`
+	Confidence         float64 `protobuf:"fixed64,17,opt,name=confidence,proto3" json:"confidence,omitempty"`
+}
+
+func (x *ObservedStopTime) Reset() {
+	*x = ObservedStopTime{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_business_data_transitcastproto_transitcast_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ObservedStopTime) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ObservedStopTime) ProtoMessage() {}
+
+func (x *ObservedStopTime) ProtoReflect() protoreflect.Message {
+	mi := &file_business_data_transitcastproto_transitcast_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ObservedStopTime.ProtoReflect.Descriptor instead.
+func (*ObservedStopTime) Descriptor() ([]byte, []int) {
+	return file_business_data_transitcastproto_transitcast_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ObservedStopTime) GetObservedTime() int64 {
+	if x != nil {
+		return x.ObservedTime
+	}
+	return 0
+}
+
+func (x *ObservedStopTime) GetStopId() string {
+	if x != nil {
+		return x.StopId
+	}
+	return ""
+}
+
+func (x *ObservedStopTime) GetNextStopId() string {
+	if x != nil {
+		return x.NextStopId
+	}
+	return ""
+}
+
+func (x *ObservedStopTime) GetVehicleId() string {
+	if x != nil {
+		return x.VehicleId
+	}
+	return ""
+}
+
+func (x *ObservedStopTime) GetRouteId() string {
+	if x != nil {
+		return x.RouteId
+	}
+	return ""
+}
+
+func (x *ObservedStopTime) GetObservedAtStop() bool {
+	if x != nil {
+		return x.ObservedAtStop
+	}
+	return false
+}
+
+func (x *ObservedStopTime) GetObservedAtNextStop() bool {
+	if x != nil {
+		return x.ObservedAtNextStop
+	}
+	return false
+}
+
+func (x *ObservedStopTime) GetStopDistance() float64 {
+	if x != nil {
+		return x.StopDistance
+	}
+	return 0
+}
+
+func (x *ObservedStopTime) GetNextStopDistance() float64 {
+	if x != nil {
+		return x.NextStopDistance
+	}
+	return 0
+}
+
+func (x *ObservedStopTime) GetTravelSeconds() int32 {
+	if x != nil {
+		return x.TravelSeconds
+	}
+	return 0
+}
+
+func (x *ObservedStopTime) GetScheduledSeconds() int32 {
+	if x != nil && x.ScheduledSeconds != nil {
+		return *x.ScheduledSeconds
+	}
+	return 0
+}
+
+func (x *ObservedStopTime) GetScheduledTime() int32 {
+	if x != nil && x.ScheduledTime != nil {
+		return *x.ScheduledTime
+	}
+	return 0
+}
+
+func (x *ObservedStopTime) GetDataSetId() int64 {
+	if x != nil {
+		return x.DataSetId
+	}
+	return 0
+}
+
+func (x *ObservedStopTime) GetTripId() string {
+	if x != nil {
+		return x.TripId
+	}
+	return ""
+}
+
+func (x *ObservedStopTime) GetCreatedAt() int64 {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return 0
+}
+
+func (x *ObservedStopTime) GetSchemaVersion() int32 {
+	if x != nil {
+		return x.SchemaVersion
+	}
+	return 0
+}
+
+func (x *ObservedStopTime) GetConfidence() float64 {
+	if x != nil {
+		return x.Confidence
+	}
+	return 0
+}
+
+// ServiceException flags calendar exceptions on a trip's service date
+type ServiceException struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ServiceAdded   bool `protobuf:"varint,1,opt,name=service_added,json=serviceAdded,proto3" json:"service_added,omitempty"`
+	ServiceReduced bool `protobuf:"varint,2,opt,name=service_reduced,json=serviceReduced,proto3" json:"service_reduced,omitempty"`
+}
+
+func (x *ServiceException) Reset() {
+	*x = ServiceException{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_business_data_transitcastproto_transitcast_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ServiceException) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServiceException) ProtoMessage() {}
+
+func (x *ServiceException) ProtoReflect() protoreflect.Message {
+	mi := &file_business_data_transitcastproto_transitcast_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServiceException.ProtoReflect.Descriptor instead.
+func (*ServiceException) Descriptor() ([]byte, []int) {
+	return file_business_data_transitcastproto_transitcast_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ServiceException) GetServiceAdded() bool {
+	if x != nil {
+		return x.ServiceAdded
+	}
+	return false
+}
+
+func (x *ServiceException) GetServiceReduced() bool {
+	if x != nil {
+		return x.ServiceReduced
+	}
+	return false
+}
+
+// TripDeviation is a vehicle's position relative to a trip's schedule
+type TripDeviation struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	CreatedAt          int64             `protobuf:"varint,1,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	DeviationTimestamp int64             `protobuf:"varint,2,opt,name=deviation_timestamp,json=deviationTimestamp,proto3" json:"deviation_timestamp,omitempty"`
+	TripProgress       float64           `protobuf:"fixed64,3,opt,name=trip_progress,json=tripProgress,proto3" json:"trip_progress,omitempty"`
+	DataSetId          int64             `protobuf:"varint,4,opt,name=data_set_id,json=dataSetId,proto3" json:"data_set_id,omitempty"`
+	TripId             string            `protobuf:"bytes,5,opt,name=trip_id,json=tripId,proto3" json:"trip_id,omitempty"`
+	VehicleId          string            `protobuf:"bytes,6,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	AtStop             bool              `protobuf:"varint,7,opt,name=at_stop,json=atStop,proto3" json:"at_stop,omitempty"`
+	Delay              int32             `protobuf:"varint,8,opt,name=delay,proto3" json:"delay,omitempty"`
+	RouteId            string            `protobuf:"bytes,9,opt,name=route_id,json=routeId,proto3" json:"route_id,omitempty"`
+	ServiceDate        int64             `protobuf:"varint,10,opt,name=service_date,json=serviceDate,proto3" json:"service_date,omitempty"`
+	ServiceException   *ServiceException `protobuf:"bytes,11,opt,name=service_exception,json=serviceException,proto3" json:"service_exception,omitempty"`
+	SchemaVersion      int32             `protobuf:"varint,12,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"`
+	// service_day is the calendar day of service_date in the data set's time zone, written as yyyy-mm-dd
+	ServiceDay string `protobuf:"bytes,13,opt,name=service_day,json=serviceDay,proto3" json:"service_day,omitempty"`
+}
+
+func (x *TripDeviation) Reset() {
+	*x = TripDeviation{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_business_data_transitcastproto_transitcast_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TripDeviation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TripDeviation) ProtoMessage() {}
+
+func (x *TripDeviation) ProtoReflect() protoreflect.Message {
+	mi := &file_business_data_transitcastproto_transitcast_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TripDeviation.ProtoReflect.Descriptor instead.
+func (*TripDeviation) Descriptor() ([]byte, []int) {
+	return file_business_data_transitcastproto_transitcast_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *TripDeviation) GetCreatedAt() int64 {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return 0
+}
+
+func (x *TripDeviation) GetDeviationTimestamp() int64 {
+	if x != nil {
+		return x.DeviationTimestamp
+	}
+	return 0
+}
+
+func (x *TripDeviation) GetTripProgress() float64 {
+	if x != nil {
+		return x.TripProgress
+	}
+	return 0
+}
+
+func (x *TripDeviation) GetDataSetId() int64 {
+	if x != nil {
+		return x.DataSetId
+	}
+	return 0
+}
+
+func (x *TripDeviation) GetTripId() string {
+	if x != nil {
+		return x.TripId
+	}
+	return ""
+}
+
+func (x *TripDeviation) GetVehicleId() string {
+	if x != nil {
+		return x.VehicleId
+	}
+	return ""
+}
+
+func (x *TripDeviation) GetAtStop() bool {
+	if x != nil {
+		return x.AtStop
+	}
+	return false
+}
+
+func (x *TripDeviation) GetDelay() int32 {
+	if x != nil {
+		return x.Delay
+	}
+	return 0
+}
+
+func (x *TripDeviation) GetRouteId() string {
+	if x != nil {
+		return x.RouteId
+	}
+	return ""
+}
+
+func (x *TripDeviation) GetServiceDate() int64 {
+	if x != nil {
+		return x.ServiceDate
+	}
+	return 0
+}
+
+func (x *TripDeviation) GetServiceException() *ServiceException {
+	if x != nil {
+		return x.ServiceException
+	}
+	return nil
+}
+
+func (x *TripDeviation) GetSchemaVersion() int32 {
+	if x != nil {
+		return x.SchemaVersion
+	}
+	return 0
+}
+
+func (x *TripDeviation) GetServiceDay() string {
+	if x != nil {
+		return x.ServiceDay
+	}
+	return ""
+}
+
+// VehicleMonitorResults holds everything gtfs-monitor observed from a vehicle's movement
+type VehicleMonitorResults struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	VehicleId         string              `protobuf:"bytes,1,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	ObservedStopTimes []*ObservedStopTime `protobuf:"bytes,2,rep,name=observed_stop_times,json=observedStopTimes,proto3" json:"observed_stop_times,omitempty"`
+	TripDeviations    []*TripDeviation    `protobuf:"bytes,3,rep,name=trip_deviations,json=tripDeviations,proto3" json:"trip_deviations,omitempty"`
+}
+
+func (x *VehicleMonitorResults) Reset() {
+	*x = VehicleMonitorResults{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_business_data_transitcastproto_transitcast_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *VehicleMonitorResults) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VehicleMonitorResults) ProtoMessage() {}
+
+func (x *VehicleMonitorResults) ProtoReflect() protoreflect.Message {
+	mi := &file_business_data_transitcastproto_transitcast_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VehicleMonitorResults.ProtoReflect.Descriptor instead.
+func (*VehicleMonitorResults) Descriptor() ([]byte, []int) {
+	return file_business_data_transitcastproto_transitcast_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *VehicleMonitorResults) GetVehicleId() string {
+	if x != nil {
+		return x.VehicleId
+	}
+	return ""
+}
+
+func (x *VehicleMonitorResults) GetObservedStopTimes() []*ObservedStopTime {
+	if x != nil {
+		return x.ObservedStopTimes
+	}
+	return nil
+}
+
+func (x *VehicleMonitorResults) GetTripDeviations() []*TripDeviation {
+	if x != nil {
+		return x.TripDeviations
+	}
+	return nil
+}
+
+// StopTimeUpdate is the predicted time for a single stop on a trip
+type StopTimeUpdate struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	StopSequence           uint32 `protobuf:"varint,1,opt,name=stop_sequence,json=stopSequence,proto3" json:"stop_sequence,omitempty"`
+	StopId                 string `protobuf:"bytes,2,opt,name=stop_id,json=stopId,proto3" json:"stop_id,omitempty"`
+	ArrivalDelay           int32  `protobuf:"varint,3,opt,name=arrival_delay,json=arrivalDelay,proto3" json:"arrival_delay,omitempty"`
+	ScheduledArrivalTime   int64  `protobuf:"varint,4,opt,name=scheduled_arrival_time,json=scheduledArrivalTime,proto3" json:"scheduled_arrival_time,omitempty"`
+	PredictedArrivalTime   int64  `protobuf:"varint,5,opt,name=predicted_arrival_time,json=predictedArrivalTime,proto3" json:"predicted_arrival_time,omitempty"`
+	ScheduledDepartureTime *int64 `protobuf:"varint,6,opt,name=scheduled_departure_time,json=scheduledDepartureTime,proto3,oneof" json:"scheduled_departure_time,omitempty"`
+	PredictedDepartureTime *int64 `protobuf:"varint,7,opt,name=predicted_departure_time,json=predictedDepartureTime,proto3,oneof" json:"predicted_departure_time,omitempty"`
+	DepartureDelay         *int32 `protobuf:"varint,8,opt,name=departure_delay,json=departureDelay,proto3,oneof" json:"departure_delay,omitempty"`
+	PredictionSource       int32  `protobuf:"varint,9,opt,name=prediction_source,json=predictionSource,proto3" json:"prediction_source,omitempty"`
+}
+
+func (x *StopTimeUpdate) Reset() {
+	*x = StopTimeUpdate{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_business_data_transitcastproto_transitcast_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StopTimeUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StopTimeUpdate) ProtoMessage() {}
+
+func (x *StopTimeUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_business_data_transitcastproto_transitcast_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StopTimeUpdate.ProtoReflect.Descriptor instead.
+func (*StopTimeUpdate) Descriptor() ([]byte, []int) {
+	return file_business_data_transitcastproto_transitcast_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *StopTimeUpdate) GetStopSequence() uint32 {
+	if x != nil {
+		return x.StopSequence
+	}
+	return 0
+}
+
+func (x *StopTimeUpdate) GetStopId() string {
+	if x != nil {
+		return x.StopId
+	}
+	return ""
+}
+
+func (x *StopTimeUpdate) GetArrivalDelay() int32 {
+	if x != nil {
+		return x.ArrivalDelay
+	}
+	return 0
+}
+
+func (x *StopTimeUpdate) GetScheduledArrivalTime() int64 {
+	if x != nil {
+		return x.ScheduledArrivalTime
+	}
+	return 0
+}
+
+func (x *StopTimeUpdate) GetPredictedArrivalTime() int64 {
+	if x != nil {
+		return x.PredictedArrivalTime
+	}
+	return 0
+}
+
+func (x *StopTimeUpdate) GetScheduledDepartureTime() int64 {
+	if x != nil && x.ScheduledDepartureTime != nil {
+		return *x.ScheduledDepartureTime
+	}
+	return 0
+}
+
+func (x *StopTimeUpdate) GetPredictedDepartureTime() int64 {
+	if x != nil && x.PredictedDepartureTime != nil {
+		return *x.PredictedDepartureTime
+	}
+	return 0
+}
+
+func (x *StopTimeUpdate) GetDepartureDelay() int32 {
+	if x != nil && x.DepartureDelay != nil {
+		return *x.DepartureDelay
+	}
+	return 0
+}
+
+func (x *StopTimeUpdate) GetPredictionSource() int32 {
+	if x != nil {
+		return x.PredictionSource
+	}
+	return 0
+}
+
+// TripUpdate is a predicted trip published by gtfs-aggregator
+type TripUpdate struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	TripId               string            `protobuf:"bytes,1,opt,name=trip_id,json=tripId,proto3" json:"trip_id,omitempty"`
+	RouteId              string            `protobuf:"bytes,2,opt,name=route_id,json=routeId,proto3" json:"route_id,omitempty"`
+	ScheduleRelationship string            `protobuf:"bytes,3,opt,name=schedule_relationship,json=scheduleRelationship,proto3" json:"schedule_relationship,omitempty"`
+	Timestamp            uint64            `protobuf:"varint,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	VehicleId            string            `protobuf:"bytes,5,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	StopTimeUpdate       []*StopTimeUpdate `protobuf:"bytes,6,rep,name=stop_time_update,json=stopTimeUpdate,proto3" json:"stop_time_update,omitempty"`
+	SchemaVersion        int32             `protobuf:"varint,7,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"`
+}
+
+func (x *TripUpdate) Reset() {
+	*x = TripUpdate{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_business_data_transitcastproto_transitcast_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TripUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TripUpdate) ProtoMessage() {}
+
+func (x *TripUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_business_data_transitcastproto_transitcast_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TripUpdate.ProtoReflect.Descriptor instead.
+func (*TripUpdate) Descriptor() ([]byte, []int) {
+	return file_business_data_transitcastproto_transitcast_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *TripUpdate) GetTripId() string {
+	if x != nil {
+		return x.TripId
+	}
+	return ""
+}
+
+func (x *TripUpdate) GetRouteId() string {
+	if x != nil {
+		return x.RouteId
+	}
+	return ""
+}
+
+func (x *TripUpdate) GetScheduleRelationship() string {
+	if x != nil {
+		return x.ScheduleRelationship
+	}
+	return ""
+}
+
+func (x *TripUpdate) GetTimestamp() uint64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *TripUpdate) GetVehicleId() string {
+	if x != nil {
+		return x.VehicleId
+	}
+	return ""
+}
+
+func (x *TripUpdate) GetStopTimeUpdate() []*StopTimeUpdate {
+	if x != nil {
+		return x.StopTimeUpdate
+	}
+	return nil
+}
+
+func (x *TripUpdate) GetSchemaVersion() int32 {
+	if x != nil {
+		return x.SchemaVersion
+	}
+	return 0
+}
+
+// InferenceRequest asks the model runner for a prediction from a model given its features
+type InferenceRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	RequestId string    `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	MlModelId int64     `protobuf:"varint,2,opt,name=ml_model_id,json=mlModelId,proto3" json:"ml_model_id,omitempty"`
+	Version   int32     `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"`
+	Features  []float64 `protobuf:"fixed64,4,rep,packed,name=features,proto3" json:"features,omitempty"`
+	Timestamp int64     `protobuf:"varint,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+}
+
+func (x *InferenceRequest) Reset() {
+	*x = InferenceRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_business_data_transitcastproto_transitcast_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *InferenceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InferenceRequest) ProtoMessage() {}
+
+func (x *InferenceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_business_data_transitcastproto_transitcast_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InferenceRequest.ProtoReflect.Descriptor instead.
+func (*InferenceRequest) Descriptor() ([]byte, []int) {
+	return file_business_data_transitcastproto_transitcast_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *InferenceRequest) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *InferenceRequest) GetMlModelId() int64 {
+	if x != nil {
+		return x.MlModelId
+	}
+	return 0
+}
+
+func (x *InferenceRequest) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *InferenceRequest) GetFeatures() []float64 {
+	if x != nil {
+		return x.Features
+	}
+	return nil
+}
+
+func (x *InferenceRequest) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+// InferenceResponse is the model runner's result for an InferenceRequest
+type InferenceResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	RequestId  string  `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	MlModelId  int64   `protobuf:"varint,2,opt,name=ml_model_id,json=mlModelId,proto3" json:"ml_model_id,omitempty"`
+	Version    int32   `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"`
+	Prediction float64 `protobuf:"fixed64,4,opt,name=prediction,proto3" json:"prediction,omitempty"`
+	Error      string  `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	Timestamp  int64   `protobuf:"varint,6,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+}
+
+func (x *InferenceResponse) Reset() {
+	*x = InferenceResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_business_data_transitcastproto_transitcast_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *InferenceResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InferenceResponse) ProtoMessage() {}
+
+func (x *InferenceResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_business_data_transitcastproto_transitcast_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InferenceResponse.ProtoReflect.Descriptor instead.
+func (*InferenceResponse) Descriptor() ([]byte, []int) {
+	return file_business_data_transitcastproto_transitcast_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *InferenceResponse) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *InferenceResponse) GetMlModelId() int64 {
+	if x != nil {
+		return x.MlModelId
+	}
+	return 0
+}
+
+func (x *InferenceResponse) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *InferenceResponse) GetPrediction() float64 {
+	if x != nil {
+		return x.Prediction
+	}
+	return 0
+}
+
+func (x *InferenceResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *InferenceResponse) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+var File_business_data_transitcastproto_transitcast_proto protoreflect.FileDescriptor
+
+var file_business_data_transitcastproto_transitcast_proto_rawDesc = []byte{
+	0x0a, 0x30, 0x62, 0x75, 0x73, 0x69, 0x6e, 0x65, 0x73, 0x73, 0x2f, 0x64, 0x61, 0x74, 0x61, 0x2f,
+	0x74, 0x72, 0x61, 0x6e, 0x73, 0x69, 0x74, 0x63, 0x61, 0x73, 0x74, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x2f, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x69, 0x74, 0x63, 0x61, 0x73, 0x74, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x12, 0x0b, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x69, 0x74, 0x63, 0x61, 0x73, 0x74, 0x22,
+	0xa9, 0x05, 0x0a, 0x10, 0x4f, 0x62, 0x73, 0x65, 0x72, 0x76, 0x65, 0x64, 0x53, 0x74, 0x6f, 0x70,
+	0x54, 0x69, 0x6d, 0x65, 0x12, 0x23, 0x0a, 0x0d, 0x6f, 0x62, 0x73, 0x65, 0x72, 0x76, 0x65, 0x64,
+	0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0c, 0x6f, 0x62, 0x73,
+	0x65, 0x72, 0x76, 0x65, 0x64, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x17, 0x0a, 0x07, 0x73, 0x74, 0x6f,
+	0x70, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x74, 0x6f, 0x70,
+	0x49, 0x64, 0x12, 0x20, 0x0a, 0x0c, 0x6e, 0x65, 0x78, 0x74, 0x5f, 0x73, 0x74, 0x6f, 0x70, 0x5f,
+	0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x6e, 0x65, 0x78, 0x74, 0x53, 0x74,
+	0x6f, 0x70, 0x49, 0x64, 0x12, 0x1d, 0x0a, 0x0a, 0x76, 0x65, 0x68, 0x69, 0x63, 0x6c, 0x65, 0x5f,
+	0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x76, 0x65, 0x68, 0x69, 0x63, 0x6c,
+	0x65, 0x49, 0x64, 0x12, 0x19, 0x0a, 0x08, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x5f, 0x69, 0x64, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x49, 0x64, 0x12, 0x28,
+	0x0a, 0x10, 0x6f, 0x62, 0x73, 0x65, 0x72, 0x76, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x5f, 0x73, 0x74,
+	0x6f, 0x70, 0x18, 0x06, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0e, 0x6f, 0x62, 0x73, 0x65, 0x72, 0x76,
+	0x65, 0x64, 0x41, 0x74, 0x53, 0x74, 0x6f, 0x70, 0x12, 0x31, 0x0a, 0x15, 0x6f, 0x62, 0x73, 0x65,
+	0x72, 0x76, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x5f, 0x6e, 0x65, 0x78, 0x74, 0x5f, 0x73, 0x74, 0x6f,
+	0x70, 0x18, 0x07, 0x20, 0x01, 0x28, 0x08, 0x52, 0x12, 0x6f, 0x62, 0x73, 0x65, 0x72, 0x76, 0x65,
+	0x64, 0x41, 0x74, 0x4e, 0x65, 0x78, 0x74, 0x53, 0x74, 0x6f, 0x70, 0x12, 0x23, 0x0a, 0x0d, 0x73,
+	0x74, 0x6f, 0x70, 0x5f, 0x64, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x18, 0x08, 0x20, 0x01,
+	0x28, 0x01, 0x52, 0x0c, 0x73, 0x74, 0x6f, 0x70, 0x44, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65,
+	0x12, 0x2c, 0x0a, 0x12, 0x6e, 0x65, 0x78, 0x74, 0x5f, 0x73, 0x74, 0x6f, 0x70, 0x5f, 0x64, 0x69,
+	0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x18, 0x09, 0x20, 0x01, 0x28, 0x01, 0x52, 0x10, 0x6e, 0x65,
+	0x78, 0x74, 0x53, 0x74, 0x6f, 0x70, 0x44, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x12, 0x25,
+	0x0a, 0x0e, 0x74, 0x72, 0x61, 0x76, 0x65, 0x6c, 0x5f, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73,
+	0x18, 0x0a, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0d, 0x74, 0x72, 0x61, 0x76, 0x65, 0x6c, 0x53, 0x65,
+	0x63, 0x6f, 0x6e, 0x64, 0x73, 0x12, 0x30, 0x0a, 0x11, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c,
+	0x65, 0x64, 0x5f, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x05,
+	0x48, 0x00, 0x52, 0x10, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x64, 0x53, 0x65, 0x63,
+	0x6f, 0x6e, 0x64, 0x73, 0x88, 0x01, 0x01, 0x12, 0x2a, 0x0a, 0x0e, 0x73, 0x63, 0x68, 0x65, 0x64,
+	0x75, 0x6c, 0x65, 0x64, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x05, 0x48,
+	0x01, 0x52, 0x0d, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x64, 0x54, 0x69, 0x6d, 0x65,
+	0x88, 0x01, 0x01, 0x12, 0x1e, 0x0a, 0x0b, 0x64, 0x61, 0x74, 0x61, 0x5f, 0x73, 0x65, 0x74, 0x5f,
+	0x69, 0x64, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x64, 0x61, 0x74, 0x61, 0x53, 0x65,
+	0x74, 0x49, 0x64, 0x12, 0x17, 0x0a, 0x07, 0x74, 0x72, 0x69, 0x70, 0x5f, 0x69, 0x64, 0x18, 0x0e,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x72, 0x69, 0x70, 0x49, 0x64, 0x12, 0x1d, 0x0a, 0x0a,
+	0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x03,
+	0x52, 0x09, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x41, 0x74, 0x12, 0x25, 0x0a, 0x0e, 0x73,
+	0x63, 0x68, 0x65, 0x6d, 0x61, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x10, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x0d, 0x73, 0x63, 0x68, 0x65, 0x6d, 0x61, 0x56, 0x65, 0x72, 0x73, 0x69,
+	0x6f, 0x6e, 0x12, 0x1e, 0x0a, 0x0a, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x64, 0x65, 0x6e, 0x63, 0x65,
+	0x18, 0x11, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0a, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x64, 0x65, 0x6e,
+	0x63, 0x65, 0x42, 0x14, 0x0a, 0x12, 0x5f, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x64,
+	0x5f, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x42, 0x11, 0x0a, 0x0f, 0x5f, 0x73, 0x63, 0x68,
+	0x65, 0x64, 0x75, 0x6c, 0x65, 0x64, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x22, 0x60, 0x0a, 0x10, 0x53,
+	0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x12,
+	0x23, 0x0a, 0x0d, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x5f, 0x61, 0x64, 0x64, 0x65, 0x64,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0c, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x41,
+	0x64, 0x64, 0x65, 0x64, 0x12, 0x27, 0x0a, 0x0f, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x5f,
+	0x72, 0x65, 0x64, 0x75, 0x63, 0x65, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0e, 0x73,
+	0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x52, 0x65, 0x64, 0x75, 0x63, 0x65, 0x64, 0x22, 0xdd, 0x03,
+	0x0a, 0x0d, 0x54, 0x72, 0x69, 0x70, 0x44, 0x65, 0x76, 0x69, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12,
+	0x1d, 0x0a, 0x0a, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x09, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x41, 0x74, 0x12, 0x2f,
+	0x0a, 0x13, 0x64, 0x65, 0x76, 0x69, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x74, 0x69, 0x6d, 0x65,
+	0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x12, 0x64, 0x65, 0x76,
+	0x69, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12,
+	0x23, 0x0a, 0x0d, 0x74, 0x72, 0x69, 0x70, 0x5f, 0x70, 0x72, 0x6f, 0x67, 0x72, 0x65, 0x73, 0x73,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0c, 0x74, 0x72, 0x69, 0x70, 0x50, 0x72, 0x6f, 0x67,
+	0x72, 0x65, 0x73, 0x73, 0x12, 0x1e, 0x0a, 0x0b, 0x64, 0x61, 0x74, 0x61, 0x5f, 0x73, 0x65, 0x74,
+	0x5f, 0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x64, 0x61, 0x74, 0x61, 0x53,
+	0x65, 0x74, 0x49, 0x64, 0x12, 0x17, 0x0a, 0x07, 0x74, 0x72, 0x69, 0x70, 0x5f, 0x69, 0x64, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x72, 0x69, 0x70, 0x49, 0x64, 0x12, 0x1d, 0x0a,
+	0x0a, 0x76, 0x65, 0x68, 0x69, 0x63, 0x6c, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x09, 0x76, 0x65, 0x68, 0x69, 0x63, 0x6c, 0x65, 0x49, 0x64, 0x12, 0x17, 0x0a, 0x07,
+	0x61, 0x74, 0x5f, 0x73, 0x74, 0x6f, 0x70, 0x18, 0x07, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x61,
+	0x74, 0x53, 0x74, 0x6f, 0x70, 0x12, 0x14, 0x0a, 0x05, 0x64, 0x65, 0x6c, 0x61, 0x79, 0x18, 0x08,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x64, 0x65, 0x6c, 0x61, 0x79, 0x12, 0x19, 0x0a, 0x08, 0x72,
+	0x6f, 0x75, 0x74, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x72,
+	0x6f, 0x75, 0x74, 0x65, 0x49, 0x64, 0x12, 0x21, 0x0a, 0x0c, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63,
+	0x65, 0x5f, 0x64, 0x61, 0x74, 0x65, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0b, 0x73, 0x65,
+	0x72, 0x76, 0x69, 0x63, 0x65, 0x44, 0x61, 0x74, 0x65, 0x12, 0x4a, 0x0a, 0x11, 0x73, 0x65, 0x72,
+	0x76, 0x69, 0x63, 0x65, 0x5f, 0x65, 0x78, 0x63, 0x65, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x0b,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x1d, 0x2e, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x69, 0x74, 0x63, 0x61,
+	0x73, 0x74, 0x2e, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x45, 0x78, 0x63, 0x65, 0x70, 0x74,
+	0x69, 0x6f, 0x6e, 0x52, 0x10, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x45, 0x78, 0x63, 0x65,
+	0x70, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x25, 0x0a, 0x0e, 0x73, 0x63, 0x68, 0x65, 0x6d, 0x61, 0x5f,
+	0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0d, 0x73,
+	0x63, 0x68, 0x65, 0x6d, 0x61, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x1f, 0x0a, 0x0b,
+	0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x5f, 0x64, 0x61, 0x79, 0x18, 0x0d, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0a, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x44, 0x61, 0x79, 0x22, 0xca, 0x01,
+	0x0a, 0x15, 0x56, 0x65, 0x68, 0x69, 0x63, 0x6c, 0x65, 0x4d, 0x6f, 0x6e, 0x69, 0x74, 0x6f, 0x72,
+	0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x76, 0x65, 0x68, 0x69, 0x63,
+	0x6c, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x76, 0x65, 0x68,
+	0x69, 0x63, 0x6c, 0x65, 0x49, 0x64, 0x12, 0x4d, 0x0a, 0x13, 0x6f, 0x62, 0x73, 0x65, 0x72, 0x76,
+	0x65, 0x64, 0x5f, 0x73, 0x74, 0x6f, 0x70, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x18, 0x02, 0x20,
+	0x03, 0x28, 0x0b, 0x32, 0x1d, 0x2e, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x69, 0x74, 0x63, 0x61, 0x73,
+	0x74, 0x2e, 0x4f, 0x62, 0x73, 0x65, 0x72, 0x76, 0x65, 0x64, 0x53, 0x74, 0x6f, 0x70, 0x54, 0x69,
+	0x6d, 0x65, 0x52, 0x11, 0x6f, 0x62, 0x73, 0x65, 0x72, 0x76, 0x65, 0x64, 0x53, 0x74, 0x6f, 0x70,
+	0x54, 0x69, 0x6d, 0x65, 0x73, 0x12, 0x43, 0x0a, 0x0f, 0x74, 0x72, 0x69, 0x70, 0x5f, 0x64, 0x65,
+	0x76, 0x69, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1a,
+	0x2e, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x69, 0x74, 0x63, 0x61, 0x73, 0x74, 0x2e, 0x54, 0x72, 0x69,
+	0x70, 0x44, 0x65, 0x76, 0x69, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x0e, 0x74, 0x72, 0x69, 0x70,
+	0x44, 0x65, 0x76, 0x69, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x22, 0x86, 0x04, 0x0a, 0x0e, 0x53,
+	0x74, 0x6f, 0x70, 0x54, 0x69, 0x6d, 0x65, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x12, 0x23, 0x0a,
+	0x0d, 0x73, 0x74, 0x6f, 0x70, 0x5f, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x73, 0x74, 0x6f, 0x70, 0x53, 0x65, 0x71, 0x75, 0x65, 0x6e,
+	0x63, 0x65, 0x12, 0x17, 0x0a, 0x07, 0x73, 0x74, 0x6f, 0x70, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x74, 0x6f, 0x70, 0x49, 0x64, 0x12, 0x23, 0x0a, 0x0d, 0x61,
+	0x72, 0x72, 0x69, 0x76, 0x61, 0x6c, 0x5f, 0x64, 0x65, 0x6c, 0x61, 0x79, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x0c, 0x61, 0x72, 0x72, 0x69, 0x76, 0x61, 0x6c, 0x44, 0x65, 0x6c, 0x61, 0x79,
+	0x12, 0x34, 0x0a, 0x16, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x64, 0x5f, 0x61, 0x72,
+	0x72, 0x69, 0x76, 0x61, 0x6c, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03,
+	0x52, 0x14, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x64, 0x41, 0x72, 0x72, 0x69, 0x76,
+	0x61, 0x6c, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x34, 0x0a, 0x16, 0x70, 0x72, 0x65, 0x64, 0x69, 0x63,
+	0x74, 0x65, 0x64, 0x5f, 0x61, 0x72, 0x72, 0x69, 0x76, 0x61, 0x6c, 0x5f, 0x74, 0x69, 0x6d, 0x65,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x14, 0x70, 0x72, 0x65, 0x64, 0x69, 0x63, 0x74, 0x65,
+	0x64, 0x41, 0x72, 0x72, 0x69, 0x76, 0x61, 0x6c, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x3d, 0x0a, 0x18,
+	0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x64, 0x5f, 0x64, 0x65, 0x70, 0x61, 0x72, 0x74,
+	0x75, 0x72, 0x65, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x48, 0x00,
+	0x52, 0x16, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x64, 0x44, 0x65, 0x70, 0x61, 0x72,
+	0x74, 0x75, 0x72, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x88, 0x01, 0x01, 0x12, 0x3d, 0x0a, 0x18, 0x70,
+	0x72, 0x65, 0x64, 0x69, 0x63, 0x74, 0x65, 0x64, 0x5f, 0x64, 0x65, 0x70, 0x61, 0x72, 0x74, 0x75,
+	0x72, 0x65, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x03, 0x48, 0x01, 0x52,
+	0x16, 0x70, 0x72, 0x65, 0x64, 0x69, 0x63, 0x74, 0x65, 0x64, 0x44, 0x65, 0x70, 0x61, 0x72, 0x74,
+	0x75, 0x72, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x88, 0x01, 0x01, 0x12, 0x2c, 0x0a, 0x0f, 0x64, 0x65,
+	0x70, 0x61, 0x72, 0x74, 0x75, 0x72, 0x65, 0x5f, 0x64, 0x65, 0x6c, 0x61, 0x79, 0x18, 0x08, 0x20,
+	0x01, 0x28, 0x05, 0x48, 0x02, 0x52, 0x0e, 0x64, 0x65, 0x70, 0x61, 0x72, 0x74, 0x75, 0x72, 0x65,
+	0x44, 0x65, 0x6c, 0x61, 0x79, 0x88, 0x01, 0x01, 0x12, 0x2b, 0x0a, 0x11, 0x70, 0x72, 0x65, 0x64,
+	0x69, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x09, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x10, 0x70, 0x72, 0x65, 0x64, 0x69, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x53,
+	0x6f, 0x75, 0x72, 0x63, 0x65, 0x42, 0x1b, 0x0a, 0x19, 0x5f, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75,
+	0x6c, 0x65, 0x64, 0x5f, 0x64, 0x65, 0x70, 0x61, 0x72, 0x74, 0x75, 0x72, 0x65, 0x5f, 0x74, 0x69,
+	0x6d, 0x65, 0x42, 0x1b, 0x0a, 0x19, 0x5f, 0x70, 0x72, 0x65, 0x64, 0x69, 0x63, 0x74, 0x65, 0x64,
+	0x5f, 0x64, 0x65, 0x70, 0x61, 0x72, 0x74, 0x75, 0x72, 0x65, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x42,
+	0x12, 0x0a, 0x10, 0x5f, 0x64, 0x65, 0x70, 0x61, 0x72, 0x74, 0x75, 0x72, 0x65, 0x5f, 0x64, 0x65,
+	0x6c, 0x61, 0x79, 0x22, 0xa0, 0x02, 0x0a, 0x0a, 0x54, 0x72, 0x69, 0x70, 0x55, 0x70, 0x64, 0x61,
+	0x74, 0x65, 0x12, 0x17, 0x0a, 0x07, 0x74, 0x72, 0x69, 0x70, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x72, 0x69, 0x70, 0x49, 0x64, 0x12, 0x19, 0x0a, 0x08, 0x72,
+	0x6f, 0x75, 0x74, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x72,
+	0x6f, 0x75, 0x74, 0x65, 0x49, 0x64, 0x12, 0x33, 0x0a, 0x15, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75,
+	0x6c, 0x65, 0x5f, 0x72, 0x65, 0x6c, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x68, 0x69, 0x70, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x14, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x52,
+	0x65, 0x6c, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x68, 0x69, 0x70, 0x12, 0x1c, 0x0a, 0x09, 0x74,
+	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x04, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09,
+	0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x1d, 0x0a, 0x0a, 0x76, 0x65, 0x68,
+	0x69, 0x63, 0x6c, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x76,
+	0x65, 0x68, 0x69, 0x63, 0x6c, 0x65, 0x49, 0x64, 0x12, 0x45, 0x0a, 0x10, 0x73, 0x74, 0x6f, 0x70,
+	0x5f, 0x74, 0x69, 0x6d, 0x65, 0x5f, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x18, 0x06, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x69, 0x74, 0x63, 0x61, 0x73, 0x74,
+	0x2e, 0x53, 0x74, 0x6f, 0x70, 0x54, 0x69, 0x6d, 0x65, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x52,
+	0x0e, 0x73, 0x74, 0x6f, 0x70, 0x54, 0x69, 0x6d, 0x65, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x12,
+	0x25, 0x0a, 0x0e, 0x73, 0x63, 0x68, 0x65, 0x6d, 0x61, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f,
+	0x6e, 0x18, 0x07, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0d, 0x73, 0x63, 0x68, 0x65, 0x6d, 0x61, 0x56,
+	0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x22, 0xa5, 0x01, 0x0a, 0x10, 0x49, 0x6e, 0x66, 0x65, 0x72,
+	0x65, 0x6e, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x72,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x09, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x49, 0x64, 0x12, 0x1e, 0x0a, 0x0b, 0x6d, 0x6c,
+	0x5f, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x09, 0x6d, 0x6c, 0x4d, 0x6f, 0x64, 0x65, 0x6c, 0x49, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x76, 0x65,
+	0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x07, 0x76, 0x65, 0x72,
+	0x73, 0x69, 0x6f, 0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x66, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x73,
+	0x18, 0x04, 0x20, 0x03, 0x28, 0x01, 0x52, 0x08, 0x66, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x73,
+	0x12, 0x1c, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x05, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x22, 0xc0,
+	0x01, 0x0a, 0x11, 0x49, 0x6e, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f,
+	0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x49, 0x64, 0x12, 0x1e, 0x0a, 0x0b, 0x6d, 0x6c, 0x5f, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x5f,
+	0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x6d, 0x6c, 0x4d, 0x6f, 0x64, 0x65,
+	0x6c, 0x49, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x1e, 0x0a,
+	0x0a, 0x70, 0x72, 0x65, 0x64, 0x69, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x01, 0x52, 0x0a, 0x70, 0x72, 0x65, 0x64, 0x69, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x14, 0x0a,
+	0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x72,
+	0x72, 0x6f, 0x72, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70,
+	0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d,
+	0x70, 0x32, 0x53, 0x0a, 0x09, 0x49, 0x6e, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x12, 0x46,
+	0x0a, 0x05, 0x49, 0x6e, 0x66, 0x65, 0x72, 0x12, 0x1d, 0x2e, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x69,
+	0x74, 0x63, 0x61, 0x73, 0x74, 0x2e, 0x49, 0x6e, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1e, 0x2e, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x69, 0x74,
+	0x63, 0x61, 0x73, 0x74, 0x2e, 0x49, 0x6e, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x48, 0x5a, 0x46, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62,
+	0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x4f, 0x70, 0x65, 0x6e, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x69, 0x74,
+	0x54, 0x6f, 0x6f, 0x6c, 0x73, 0x2f, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x69, 0x74, 0x63, 0x61, 0x73,
+	0x74, 0x2f, 0x62, 0x75, 0x73, 0x69, 0x6e, 0x65, 0x73, 0x73, 0x2f, 0x64, 0x61, 0x74, 0x61, 0x2f,
+	0x74, 0x72, 0x61, 0x6e, 0x73, 0x69, 0x74, 0x63, 0x61, 0x73, 0x74, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_business_data_transitcastproto_transitcast_proto_rawDescOnce sync.Once
+	file_business_data_transitcastproto_transitcast_proto_rawDescData = file_business_data_transitcastproto_transitcast_proto_rawDesc
+)
+
+func file_business_data_transitcastproto_transitcast_proto_rawDescGZIP() []byte {
+	file_business_data_transitcastproto_transitcast_proto_rawDescOnce.Do(func() {
+		file_business_data_transitcastproto_transitcast_proto_rawDescData = protoimpl.X.CompressGZIP(file_business_data_transitcastproto_transitcast_proto_rawDescData)
+	})
+	return file_business_data_transitcastproto_transitcast_proto_rawDescData
+}
+
+var file_business_data_transitcastproto_transitcast_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_business_data_transitcastproto_transitcast_proto_goTypes = []interface{}{
+	(*ObservedStopTime)(nil),      // 0: transitcast.ObservedStopTime
+	(*ServiceException)(nil),      // 1: transitcast.ServiceException
+	(*TripDeviation)(nil),         // 2: transitcast.TripDeviation
+	(*VehicleMonitorResults)(nil), // 3: transitcast.VehicleMonitorResults
+	(*StopTimeUpdate)(nil),        // 4: transitcast.StopTimeUpdate
+	(*TripUpdate)(nil),            // 5: transitcast.TripUpdate
+	(*InferenceRequest)(nil),      // 6: transitcast.InferenceRequest
+	(*InferenceResponse)(nil),     // 7: transitcast.InferenceResponse
+}
+var file_business_data_transitcastproto_transitcast_proto_depIdxs = []int32{
+	1, // 0: transitcast.TripDeviation.service_exception:type_name -> transitcast.ServiceException
+	0, // 1: transitcast.VehicleMonitorResults.observed_stop_times:type_name -> transitcast.ObservedStopTime
+	2, // 2: transitcast.VehicleMonitorResults.trip_deviations:type_name -> transitcast.TripDeviation
+	4, // 3: transitcast.TripUpdate.stop_time_update:type_name -> transitcast.StopTimeUpdate
+	6, // 4: transitcast.Inference.Infer:input_type -> transitcast.InferenceRequest
+	7, // 5: transitcast.Inference.Infer:output_type -> transitcast.InferenceResponse
+	5, // [5:6] is the sub-list for method output_type
+	4, // [4:5] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_business_data_transitcastproto_transitcast_proto_init() }
+func file_business_data_transitcastproto_transitcast_proto_init() {
+	if File_business_data_transitcastproto_transitcast_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_business_data_transitcastproto_transitcast_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ObservedStopTime); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_business_data_transitcastproto_transitcast_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ServiceException); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_business_data_transitcastproto_transitcast_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TripDeviation); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_business_data_transitcastproto_transitcast_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*VehicleMonitorResults); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_business_data_transitcastproto_transitcast_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StopTimeUpdate); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_business_data_transitcastproto_transitcast_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TripUpdate); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_business_data_transitcastproto_transitcast_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*InferenceRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_business_data_transitcastproto_transitcast_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*InferenceResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_business_data_transitcastproto_transitcast_proto_msgTypes[0].OneofWrappers = []interface{}{}
+	file_business_data_transitcastproto_transitcast_proto_msgTypes[4].OneofWrappers = []interface{}{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_business_data_transitcastproto_transitcast_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_business_data_transitcastproto_transitcast_proto_goTypes,
+		DependencyIndexes: file_business_data_transitcastproto_transitcast_proto_depIdxs,
+		MessageInfos:      file_business_data_transitcastproto_transitcast_proto_msgTypes,
+	}.Build()
+	File_business_data_transitcastproto_transitcast_proto = out.File
+	file_business_data_transitcastproto_transitcast_proto_rawDesc = nil
+	file_business_data_transitcastproto_transitcast_proto_goTypes = nil
+	file_business_data_transitcastproto_transitcast_proto_depIdxs = nil
+}
@@ -28,10 +28,22 @@ create table if not exists ml_model
     observed_stop_count             int,
     median                          double precision,
     average                         double precision,
+    shadow                          bool not null default false,
+    pattern_id                      text,
+    time_bucket                     int,
     constraint ml_model_fk1
         foreign key (ml_model_type_id) references ml_model_type
 );
 
+-- models recorded before shadow models could be trained
+alter table ml_model
+    add column if not exists shadow bool not null default false;
+
+-- models recorded before models could be keyed by stop pattern and time bucket
+alter table ml_model
+    add column if not exists pattern_id text,
+    add column if not exists time_bucket int;
+
 create table if not exists ml_model_stop
 (
     ml_model_stop_id bigserial not null
@@ -41,10 +53,43 @@ create table if not exists ml_model_stop
     sequence          int       not null,
     stop_id           text      not null,
     next_stop_id      text      not null,
+    distance          double precision,
     constraint ml_model_stops_fk1
         foreign key (ml_model_id) references ml_model
 );
 
+-- models recorded before stop spacing was kept
+alter table ml_model_stop
+    add column if not exists distance double precision;
+
+create table if not exists ml_model_shadow_comparison
+(
+    comparison_timestamp timestamp with time zone not null,
+    model_name           text                     not null,
+    trip_id              text                     not null,
+    ml_model_id          bigint                   not null,
+    version              int                      not null,
+    shadow_ml_model_id   bigint                   not null,
+    shadow_version       int                      not null,
+    prediction           double precision         not null,
+    shadow_prediction    double precision         not null
+);
+
+create index if not exists ml_model_shadow_comparison_idx1
+    on ml_model_shadow_comparison (shadow_ml_model_id, comparison_timestamp);
+
+create table if not exists ml_time_bucket
+(
+    sequence      int  not null
+        constraint ml_time_bucket_pk
+            primary key,
+    name          text not null,
+    first_weekday int  not null,
+    last_weekday  int  not null,
+    start_seconds int  not null,
+    end_seconds   int  not null
+);
+
 insert into ml_model_type(name)
 values ('Timepoints');
 insert into ml_model_type(name)
@@ -8,13 +8,27 @@ create table if not exists data_set
     last_modified_timestamp bigint                   not null,
     downloaded_at           timestamp with time zone not null,
     saved_at                timestamp with time zone,
-    replaced_at             timestamp with time zone
+    replaced_at             timestamp with time zone,
+    timezone                text                     not null default ''
 );
 
+-- data sets loaded before agency_timezone was recorded
+alter table data_set
+    add column if not exists timezone text not null default '';
+
 create index data_set_idx1
     ON data_set
         (saved_at, replaced_at);
 
+create table if not exists data_set_file
+(
+    data_set_id bigint                   not null,
+    file_name   text                     not null,
+    loaded_at   timestamp with time zone not null,
+    constraint data_set_file_pkey
+        primary key (data_set_id, file_name)
+);
+
 create table if not exists shape
 (
     data_set_id         bigint           not null,
@@ -40,10 +54,20 @@ create table if not exists trip
     start_time      int,
     end_time        int,
     trip_distance   double precision,
+    route_type      int,
+    pattern_id      text,
     constraint trip_pkey
         primary key (data_set_id, trip_id)
 );
 
+-- data sets loaded before route_type was recorded
+alter table trip
+    add column if not exists route_type int;
+
+-- data sets loaded before stop patterns were assigned
+alter table trip
+    add column if not exists pattern_id text;
+
 create table if not exists stop_time
 (
     data_set_id         bigint not null,
@@ -89,6 +113,42 @@ create table calendar_date
         primary key (data_set_id, service_id, date)
 );
 
+create table if not exists transfer
+(
+    data_set_id       bigint not null,
+    from_stop_id      text,
+    to_stop_id        text,
+    from_route_id     text,
+    to_route_id       text,
+    from_trip_id      text,
+    to_trip_id        text,
+    transfer_type     int    not null,
+    min_transfer_time int
+);
+
+create index transfer_idx1
+    ON transfer
+        (data_set_id, from_stop_id);
+
+create table if not exists pathway
+(
+    data_set_id            bigint not null,
+    pathway_id             text   not null,
+    from_stop_id           text   not null,
+    to_stop_id             text   not null,
+    pathway_mode           int    not null,
+    is_bidirectional       int    not null,
+    length                 double precision,
+    traversal_time         int,
+    stair_count            int,
+    max_slope              double precision,
+    min_width              double precision,
+    signposted_as          text,
+    reversed_signposted_as text,
+    constraint pathway_pkey
+        primary key (data_set_id, pathway_id)
+);
+
 create table if not exists observed_stop_time
 (
     observed_time         timestamp with time zone not null,
@@ -106,11 +166,44 @@ create table if not exists observed_stop_time
     data_set_id           bigint                   not null,
     trip_id               text                     not null,
     created_at            timestamp with time zone,
+    confidence            double precision         not null default 0,
     constraint observed_stop_time_pkey
         primary key (observed_time, stop_id, next_stop_id, vehicle_id)
 
 ) partition by range (observed_time);
 
+-- observations recorded before confidence was scored
+alter table observed_stop_time
+    add column if not exists confidence double precision not null default 0;
+
+create table if not exists observed_stop_time_quarantine
+(
+    observed_time          timestamp with time zone not null,
+    stop_id                text                     not null,
+    next_stop_id           text                     not null,
+    vehicle_id             text                     not null,
+    route_id               text                     not null,
+    observed_at_stop       bool,
+    observed_at_next_stop  bool,
+    stop_distance          double precision         not null,
+    next_stop_distance     double precision         not null,
+    travel_seconds         int                      not null,
+    scheduled_seconds      int,
+    scheduled_time         int,
+    data_set_id            bigint                   not null,
+    trip_id                text                     not null,
+    created_at             timestamp with time zone,
+    confidence             double precision         not null default 0,
+    z_score                double precision         not null,
+    mean_travel_seconds    double precision         not null,
+    std_dev_travel_seconds double precision         not null,
+    constraint observed_stop_time_quarantine_pkey
+        primary key (observed_time, stop_id, next_stop_id, vehicle_id)
+);
+
+alter table observed_stop_time_quarantine
+    add column if not exists confidence double precision not null default 0;
+
 create table if not exists trip_deviation
 (
     id                  bigserial                not null,
@@ -124,4 +217,114 @@ create table if not exists trip_deviation
     deviation_timestamp timestamp with time zone not null,
     constraint trip_deviation_pkey
         primary key (created_at, trip_id, vehicle_id)
-) partition by range (created_at);
\ No newline at end of file
+) partition by range (created_at);
+
+create index if not exists trip_deviation_idx1
+    on trip_deviation
+        (vehicle_id, created_at);
+
+create table if not exists vehicle_assignment_change
+(
+    created_at             timestamp with time zone not null,
+    changed_at             timestamp with time zone not null,
+    vehicle_id             text                     not null,
+    data_set_id            bigint                   not null,
+    previous_trip_id       text                     not null,
+    previous_route_id      text                     not null,
+    previous_block_id      text                     not null,
+    previous_stop_sequence int                      not null,
+    trip_id                text                     not null,
+    route_id               text                     not null,
+    block_id               text                     not null,
+    stop_sequence          int,
+    block_changed          bool                     not null,
+    constraint vehicle_assignment_change_pkey
+        primary key (changed_at, vehicle_id)
+);
+
+create table if not exists vehicle_assignment_anomaly
+(
+    created_at    timestamp with time zone not null,
+    detected_at   timestamp with time zone not null,
+    vehicle_id    text                     not null,
+    data_set_id   bigint                   not null,
+    trip_id       text                     not null,
+    route_id      text                     not null,
+    block_id      text                     not null,
+    stop_sequence int                      not null,
+    anomaly       text                     not null,
+    detail        text                     not null,
+    constraint vehicle_assignment_anomaly_pkey
+        primary key (detected_at, vehicle_id, anomaly)
+);
+
+create table if not exists vehicle_deadhead
+(
+    created_at             timestamp with time zone not null,
+    vehicle_id             text                     not null,
+    data_set_id            bigint                   not null,
+    kind                   text                     not null,
+    reason                 text                     not null,
+    started_at             timestamp with time zone not null,
+    start_latitude         double precision,
+    start_longitude        double precision,
+    ended_at               timestamp with time zone not null,
+    end_latitude           double precision,
+    end_longitude          double precision,
+    distance_meters        double precision         not null,
+    previous_trip_id       text,
+    previous_block_id      text,
+    previous_stop_sequence int,
+    trip_id                text,
+    block_id               text,
+    stop_sequence          int,
+    constraint vehicle_deadhead_pkey
+        primary key (started_at, vehicle_id)
+);
+
+create table if not exists position_discard_count
+(
+    discard_date  date   not null,
+    reason        text   not null,
+    discard_count bigint not null,
+    constraint position_discard_count_pkey
+        primary key (discard_date, reason)
+);
+
+create table if not exists stop_pair_travel_bound
+(
+    stop_id            text                     not null,
+    next_stop_id       text                     not null,
+    min_travel_seconds int                      not null,
+    sample_count       int                      not null,
+    computed_at        timestamp with time zone not null,
+    constraint stop_pair_travel_bound_pkey
+        primary key (stop_id, next_stop_id)
+);
+
+create table if not exists stop_dwell
+(
+    stop_id       text                     not null,
+    dwell_seconds int                      not null,
+    sample_count  int                      not null,
+    computed_at   timestamp with time zone not null,
+    constraint stop_dwell_pkey
+        primary key (stop_id)
+);
+
+create table if not exists system_event
+(
+    id          bigserial                not null,
+    created_at  timestamp with time zone not null,
+    app         text                     not null,
+    version     text                     not null,
+    event_type  text                     not null,
+    description text                     not null,
+    details     text                     not null,
+    constraint system_event_pkey
+        primary key (id)
+);
+
+create index if not exists system_event_idx1
+    on system_event
+        (created_at);
@@ -0,0 +1,60 @@
+-- Optional alternative to the partitioned observed_stop_time and trip_deviation tables in
+-- schedule_and_monitor_ddl.sql for databases with the TimescaleDB extension available.
+-- Run this file in place of the observed_stop_time and trip_deviation definitions in schedule_and_monitor_ddl.sql.
+-- Chunks are created automatically and the retention policies remove chunks older than 90 days, the
+-- gtfs-loader partition commands are not needed when using these tables.
+
+create extension if not exists timescaledb;
+
+create table if not exists observed_stop_time
+(
+    observed_time         timestamp with time zone not null,
+    stop_id               text                     not null,
+    next_stop_id          text                     not null,
+    vehicle_id            text                     not null,
+    route_id              text                     not null,
+    observed_at_stop      bool,
+    observed_at_next_stop bool,
+    stop_distance         double precision         not null,
+    next_stop_distance    double precision         not null,
+    travel_seconds        int                      not null,
+    scheduled_seconds     int,
+    scheduled_time        int,
+    data_set_id           bigint                   not null,
+    trip_id               text                     not null,
+    created_at            timestamp with time zone,
+    confidence            double precision         not null default 0,
+    constraint observed_stop_time_pkey
+        primary key (observed_time, stop_id, next_stop_id, vehicle_id)
+);
+
+select create_hypertable('observed_stop_time', 'observed_time',
+                         chunk_time_interval => interval '1 day', if_not_exists => true);
+select add_retention_policy('observed_stop_time', interval '90 days', if_not_exists => true);
+
+-- observations recorded before confidence was scored
+alter table observed_stop_time
+    add column if not exists confidence double precision not null default 0;
+
+create table if not exists trip_deviation
+(
+    id                  bigserial                not null,
+    created_at          timestamp with time zone not null,
+    trip_progress       double precision,
+    data_set_id         bigint                   not null,
+    trip_id             text                     not null,
+    vehicle_id          text                     not null,
+    at_stop             bool                     not null,
+    delay               int                      not null,
+    deviation_timestamp timestamp with time zone not null,
+    constraint trip_deviation_pkey
+        primary key (created_at, trip_id, vehicle_id)
+);
+
+create index if not exists trip_deviation_idx1
+    on trip_deviation
+        (vehicle_id, created_at);
+
+select create_hypertable('trip_deviation', 'created_at',
+                         chunk_time_interval => interval '1 day', if_not_exists => true);
+select add_retention_policy('trip_deviation', interval '90 days', if_not_exists => true);
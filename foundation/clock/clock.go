@@ -0,0 +1,61 @@
+// Package clock provides the current time, so code that expires state or timestamps results can be run against a
+// controlled time in tests and when replaying recorded feeds
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock returns the current time
+type Clock interface {
+	Now() time.Time
+}
+
+// System is the Clock returning the system time
+type System struct{}
+
+// Now returns time.Now()
+func (System) Now() time.Time {
+	return time.Now()
+}
+
+// Manual is a Clock that only moves when it's set or advanced. Safe for concurrent use
+type Manual struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManual builds Manual starting at now
+func NewManual(now time.Time) *Manual {
+	return &Manual{now: now}
+}
+
+// Now returns the time Manual was last set to
+func (m *Manual) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+// Set moves Manual to now
+func (m *Manual) Set(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = now
+}
+
+// Advance moves Manual forward by d
+func (m *Manual) Advance(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = m.now.Add(d)
+}
+
+// OrSystem returns c, or System when c is nil
+func OrSystem(c Clock) Clock {
+	if c == nil {
+		return System{}
+	}
+	return c
+}
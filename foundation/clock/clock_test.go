@@ -0,0 +1,33 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManual(t *testing.T) {
+	start := time.Date(2022, 6, 1, 8, 0, 0, 0, time.UTC)
+	manual := NewManual(start)
+	if got := manual.Now(); !got.Equal(start) {
+		t.Errorf("Now() = %v, want %v", got, start)
+	}
+	manual.Advance(90 * time.Second)
+	if got, want := manual.Now(), start.Add(90*time.Second); !got.Equal(want) {
+		t.Errorf("Now() after Advance = %v, want %v", got, want)
+	}
+	later := start.Add(time.Hour)
+	manual.Set(later)
+	if got := manual.Now(); !got.Equal(later) {
+		t.Errorf("Now() after Set = %v, want %v", got, later)
+	}
+}
+
+func TestOrSystem(t *testing.T) {
+	if _, ok := OrSystem(nil).(System); !ok {
+		t.Errorf("OrSystem(nil) should return System")
+	}
+	manual := NewManual(time.Now())
+	if OrSystem(manual) != manual {
+		t.Errorf("OrSystem(manual) should return manual")
+	}
+}
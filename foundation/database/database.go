@@ -2,6 +2,8 @@
 package database
 
 import (
+	"context"
+	"fmt"
 	_ "github.com/jackc/pgx/stdlib"
 	"github.com/jmoiron/sqlx"
 	"net/url"
@@ -14,18 +16,56 @@ type Config struct {
 	Host       string
 	Name       string
 	DisableTLS bool
+	//SSLMode overrides the sslmode set by DisableTLS, for example verify-full to also verify the server certificate
+	SSLMode string
+	//RootCertFile is a pem file of certificate authorities used to verify the server certificate
+	RootCertFile string
+	//CertFile and KeyFile are a pem encoded client certificate and key used to authenticate with the server
+	CertFile string
+	KeyFile  string
+	//Schema is the postgres schema holding an agency's tables when several agencies share the database, empty uses
+	//the server's default search_path
+	Schema string
 }
 
 // Open knows how to open a database connection based on the configuration.
 func Open(cfg Config) (*sqlx.DB, error) {
+	u, err := connectionURL(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return sqlx.Connect("pgx", u.String())
+}
+
+// connectionURL builds the postgres url for cfg
+func connectionURL(cfg Config) (*url.URL, error) {
 	sslMode := "require"
 	if cfg.DisableTLS {
 		sslMode = "disable"
 	}
+	if cfg.SSLMode != "" {
+		sslMode = cfg.SSLMode
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, fmt.Errorf("a database client certificate requires both a certificate file and key file")
+	}
+	if sslMode == "disable" && (cfg.RootCertFile != "" || cfg.CertFile != "") {
+		return nil, fmt.Errorf("database certificates can't be used with TLS disabled")
+	}
 
 	q := make(url.Values)
 	q.Set("sslmode", sslMode)
 	q.Set("timezone", "utc")
+	if cfg.RootCertFile != "" {
+		q.Set("sslrootcert", cfg.RootCertFile)
+	}
+	if cfg.CertFile != "" {
+		q.Set("sslcert", cfg.CertFile)
+		q.Set("sslkey", cfg.KeyFile)
+	}
+	if cfg.Schema != "" {
+		q.Set("search_path", cfg.Schema)
+	}
 
 	u := url.URL{
 		Scheme:   "postgres",
@@ -34,7 +74,7 @@ func Open(cfg Config) (*sqlx.DB, error) {
 		Path:     cfg.Name,
 		RawQuery: q.Encode(),
 	}
-	return sqlx.Connect("pgx", u.String())
+	return &u, nil
 }
 
 // PrepareNamedQueryFromMap wraps boilerplate sqlx to prepare named query from map of ddl parameters
@@ -73,3 +113,21 @@ func PrepareNamedQueryRowsFromMap(
 	}
 	return rows, nil
 }
+
+// PrepareNamedQueryRowsFromMapContext wraps boilerplate sqlx to prepare named query from map of ddl parameters
+// returns sqlx.Rows after executing query with db.QueryxContext, the query is cancelled if ctx is done
+func PrepareNamedQueryRowsFromMapContext(ctx context.Context,
+	statementString string,
+	db *sqlx.DB,
+	sqlArgMap map[string]interface{}) (*sqlx.Rows, error) {
+
+	query, args, err := PrepareNamedQueryFromMap(statementString, db, sqlArgMap)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
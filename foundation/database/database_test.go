@@ -0,0 +1,54 @@
+package database
+
+import (
+	"testing"
+)
+
+func Test_connectionURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "tls disabled",
+			cfg:  Config{User: "u", Password: "p", Host: "db", Name: "transit", DisableTLS: true},
+			want: "postgres://u:p@db/transit?sslmode=disable&timezone=utc",
+		},
+		{
+			name: "client certificate",
+			cfg: Config{User: "u", Password: "p", Host: "db", Name: "transit", SSLMode: "verify-full",
+				RootCertFile: "/certs/ca.pem", CertFile: "/certs/client.pem", KeyFile: "/certs/client.key"},
+			want: "postgres://u:p@db/transit?sslcert=%2Fcerts%2Fclient.pem&sslkey=%2Fcerts%2Fclient.key" +
+				"&sslmode=verify-full&sslrootcert=%2Fcerts%2Fca.pem&timezone=utc",
+		},
+		{
+			name: "schema",
+			cfg:  Config{User: "u", Password: "p", Host: "db", Name: "transit", DisableTLS: true, Schema: "trimet"},
+			want: "postgres://u:p@db/transit?search_path=trimet&sslmode=disable&timezone=utc",
+		},
+		{
+			name:    "certificate without key",
+			cfg:     Config{User: "u", Password: "p", Host: "db", Name: "transit", CertFile: "/certs/client.pem"},
+			wantErr: true,
+		},
+		{
+			name: "certificate with tls disabled",
+			cfg: Config{User: "u", Password: "p", Host: "db", Name: "transit", DisableTLS: true,
+				CertFile: "/certs/client.pem", KeyFile: "/certs/client.key"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := connectionURL(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("connectionURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("connectionURL() = %v, want %v", got.String(), tt.want)
+			}
+		})
+	}
+}
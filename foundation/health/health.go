@@ -0,0 +1,162 @@
+// Package health provides /healthz and /readyz endpoints reporting on the dependencies of long-running apps
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/nats-io/nats.go"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Check returns an error describing why a dependency is unavailable, or nil when it is available
+type Check func(ctx context.Context) error
+
+// Checks holds the Checks reported by the /healthz and /readyz endpoints.
+// Liveness checks fail /healthz and /readyz, readiness checks only fail /readyz
+type Checks struct {
+	mu        sync.Mutex
+	timeout   time.Duration
+	liveness  map[string]Check
+	readiness map[string]Check
+}
+
+// Response is the json body returned by the /healthz and /readyz endpoints
+type Response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// New builds Checks, each Check is abandoned after timeout
+func New(timeout time.Duration) *Checks {
+	return &Checks{
+		mu:        sync.Mutex{},
+		timeout:   timeout,
+		liveness:  make(map[string]Check),
+		readiness: make(map[string]Check),
+	}
+}
+
+// AddLiveness adds a Check that should restart the app when it fails
+func (c *Checks) AddLiveness(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.liveness[name] = check
+}
+
+// AddReadiness adds a Check that should stop traffic to the app while it fails
+func (c *Checks) AddReadiness(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readiness[name] = check
+}
+
+// Register adds the /healthz and /readyz endpoints to mux
+func (c *Checks) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		c.respond(w, r, false)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		c.respond(w, r, true)
+	})
+}
+
+// respond runs the liveness checks, and the readiness checks when includeReadiness is set, and writes the Response.
+// the status code is 503 when any check fails
+func (c *Checks) respond(w http.ResponseWriter, r *http.Request, includeReadiness bool) {
+	response := c.run(r.Context(), includeReadiness)
+	w.Header().Set("Content-Type", "application/json")
+	if response.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// run executes the checks and collects their results into a Response
+func (c *Checks) run(ctx context.Context, includeReadiness bool) Response {
+	c.mu.Lock()
+	checks := make(map[string]Check)
+	for name, check := range c.liveness {
+		checks[name] = check
+	}
+	if includeReadiness {
+		for name, check := range c.readiness {
+			checks[name] = check
+		}
+	}
+	c.mu.Unlock()
+
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	response := Response{Status: "ok", Checks: make(map[string]string)}
+	for _, name := range names {
+		checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		err := checks[name](checkCtx)
+		cancel()
+		if err != nil {
+			response.Status = "unavailable"
+			response.Checks[name] = err.Error()
+		} else {
+			response.Checks[name] = "ok"
+		}
+	}
+	return response
+}
+
+// DatabaseCheck fails when db can't be reached
+func DatabaseCheck(db *sqlx.DB) Check {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// NatsCheck fails when natsConn is not connected to the NATS server
+func NatsCheck(natsConn *nats.Conn) Check {
+	return func(_ context.Context) error {
+		status := natsConn.Status()
+		if status != nats.CONNECTED {
+			return fmt.Errorf("nats connection is %s", status)
+		}
+		return nil
+	}
+}
+
+// Heartbeat records the last time a recurring task succeeded
+type Heartbeat struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// NewHeartbeat builds Heartbeat, treating startedAt as the last success so the task has time to run once
+func NewHeartbeat(startedAt time.Time) *Heartbeat {
+	return &Heartbeat{last: startedAt}
+}
+
+// Beat records the task succeeded at "at"
+func (h *Heartbeat) Beat(at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.last = at
+}
+
+// Check fails when the task hasn't succeeded within maxAge
+func (h *Heartbeat) Check(maxAge time.Duration) Check {
+	return func(_ context.Context) error {
+		h.mu.Lock()
+		last := h.last
+		h.mu.Unlock()
+		age := time.Since(last)
+		if age > maxAge {
+			return fmt.Errorf("last succeeded %d seconds ago at %s", int(age.Seconds()), last.Format(time.RFC3339))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,75 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChecks_Register(t *testing.T) {
+	checks := New(time.Second)
+	heartbeat := NewHeartbeat(time.Now())
+	checks.AddLiveness("polls", heartbeat.Check(time.Minute))
+	checks.AddReadiness("database", func(_ context.Context) error {
+		return errors.New("connection refused")
+	})
+	mux := http.NewServeMux()
+	checks.Register(mux)
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		want       Response
+	}{
+		{
+			name:       "healthz only runs liveness checks",
+			path:       "/healthz",
+			wantStatus: http.StatusOK,
+			want:       Response{Status: "ok", Checks: map[string]string{"polls": "ok"}},
+		},
+		{
+			name:       "readyz fails on readiness checks",
+			path:       "/readyz",
+			wantStatus: http.StatusServiceUnavailable,
+			want: Response{Status: "unavailable", Checks: map[string]string{
+				"polls":    "ok",
+				"database": "connection refused",
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			var got Response
+			err := json.Unmarshal(recorder.Body.Bytes(), &got)
+			if err != nil {
+				t.Fatalf("unable to parse response: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("response = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeartbeat_Check(t *testing.T) {
+	heartbeat := NewHeartbeat(time.Now().Add(-2 * time.Minute))
+	check := heartbeat.Check(time.Minute)
+	if err := check(context.Background()); err == nil {
+		t.Errorf("Check() expected error for heartbeat two minutes old")
+	}
+	heartbeat.Beat(time.Now())
+	if err := check(context.Background()); err != nil {
+		t.Errorf("Check() error = %v after Beat", err)
+	}
+}
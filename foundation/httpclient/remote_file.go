@@ -0,0 +1,115 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrRangesNotSupported is returned by OpenRemoteFile when the server does not accept byte range requests
+var ErrRangesNotSupported = errors.New("server does not support byte range requests")
+
+// RemoteFile reads a file from a url with byte range requests without downloading the whole file.
+// Implements io.ReaderAt, reads are made in blocks of blockSize and the most recent block is kept
+// so small sequential reads don't each result in a request
+type RemoteFile struct {
+	RemoteFileInfo RemoteFileInfo
+	Size           int64
+	OpenedAt       time.Time
+	client         *http.Client
+	blockSize      int64
+	mu             sync.Mutex
+	blockStart     int64
+	block          []byte
+}
+
+// OpenRemoteFile checks that url can be read with byte range requests using a HEAD request.
+// returns ErrRangesNotSupported if the server does not advertise byte range support or the file size
+func OpenRemoteFile(url string, blockSize int64) (*RemoteFile, error) {
+	client := &http.Client{}
+	resp, err := client.Head(url)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s checking %s", resp.Status, url)
+	}
+	if resp.Header.Get("Accept-Ranges") != "bytes" || resp.ContentLength <= 0 {
+		return nil, ErrRangesNotSupported
+	}
+	return &RemoteFile{
+		RemoteFileInfo: getRemoteFileInfo(url, resp),
+		Size:           resp.ContentLength,
+		OpenedAt:       time.Now(),
+		client:         client,
+		blockSize:      blockSize,
+	}, nil
+}
+
+// ReadAt reads len(p) bytes starting at offset off, implements io.ReaderAt
+func (r *RemoteFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if off >= r.Size {
+		return 0, io.EOF
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	read := 0
+	for read < len(p) && off < r.Size {
+		if off < r.blockStart || off >= r.blockStart+int64(len(r.block)) {
+			err := r.fetchBlock(off)
+			if err != nil {
+				return read, err
+			}
+		}
+		n := copy(p[read:], r.block[off-r.blockStart:])
+		read += n
+		off += int64(n)
+	}
+	if read < len(p) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+// fetchBlock retrieves the block starting at off.
+// if the file has changed since it was opened the server responds with the whole file and an error is returned
+func (r *RemoteFile) fetchBlock(off int64) error {
+	end := off + r.blockSize - 1
+	if end >= r.Size {
+		end = r.Size - 1
+	}
+	req, err := http.NewRequest(http.MethodGet, r.RemoteFileInfo.Path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, end))
+	if r.RemoteFileInfo.ETag != "" {
+		req.Header.Set("If-Range", r.RemoteFileInfo.ETag)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("unexpected status %s requesting bytes %d-%d of %s, the file may have changed",
+			resp.Status, off, end, r.RemoteFileInfo.Path)
+	}
+	block := make([]byte, end-off+1)
+	_, err = io.ReadFull(resp.Body, block)
+	if err != nil {
+		return fmt.Errorf("unable to read bytes %d-%d of %s: %w", off, end, r.RemoteFileInfo.Path, err)
+	}
+	r.blockStart = off
+	r.block = block
+	return nil
+}
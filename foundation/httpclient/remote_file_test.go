@@ -0,0 +1,111 @@
+package httpclient
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_RemoteFile(t *testing.T) {
+	var zipContent bytes.Buffer
+	zipWriter := zip.NewWriter(&zipContent)
+	stopTimes := "trip_id,arrival_time\n" + strings.Repeat("1,06:00:00\n", 5000)
+	for _, name := range []string{"trips.txt", "stop_times.txt"} {
+		// stored uncompressed so reading the entry takes many blocks
+		w, err := zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatalf("unable to create zip entry: %v", err)
+		}
+		_, _ = w.Write([]byte(stopTimes))
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatalf("unable to write zip: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		ranges      bool
+		etag        string
+		changedEtag string
+		wantOpenErr error
+		wantReadErr bool
+	}{
+		{
+			name:   "reads zip entries with range requests",
+			ranges: true,
+			etag:   `"v1"`,
+		},
+		{
+			name:        "server without range support",
+			wantOpenErr: ErrRangesNotSupported,
+		},
+		{
+			name:        "file changed while reading",
+			ranges:      true,
+			etag:        `"v1"`,
+			changedEtag: `"v2"`,
+			wantReadErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			etag := tt.etag
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					atomic.AddInt32(&requests, 1)
+				}
+				if !tt.ranges {
+					_, _ = w.Write(zipContent.Bytes())
+					return
+				}
+				w.Header().Set("ETag", etag)
+				http.ServeContent(w, r, "gtfs.zip", time.Time{}, bytes.NewReader(zipContent.Bytes()))
+			}))
+			defer server.Close()
+
+			remoteFile, err := OpenRemoteFile(server.URL, 1024)
+			if !errors.Is(err, tt.wantOpenErr) {
+				t.Errorf("OpenRemoteFile() error = %v, want %v", err, tt.wantOpenErr)
+				return
+			}
+			if tt.wantOpenErr != nil {
+				return
+			}
+			if remoteFile.Size != int64(zipContent.Len()) || remoteFile.RemoteFileInfo.ETag != tt.etag {
+				t.Errorf("OpenRemoteFile() = size %d, etag %s", remoteFile.Size, remoteFile.RemoteFileInfo.ETag)
+			}
+			if tt.changedEtag != "" {
+				etag = tt.changedEtag
+			}
+
+			zipReader, err := zip.NewReader(remoteFile, remoteFile.Size)
+			if err == nil {
+				var entry io.ReadCloser
+				entry, err = zipReader.File[1].Open()
+				if err == nil {
+					var content []byte
+					content, err = io.ReadAll(entry)
+					if err == nil && string(content) != stopTimes {
+						t.Errorf("read %d bytes of stop_times.txt that don't match", len(content))
+					}
+				}
+			}
+			if (err != nil) != tt.wantReadErr {
+				t.Errorf("reading zip error = %v, wantReadErr %v", err, tt.wantReadErr)
+			}
+			maximumRequests := int32(zipContent.Len()/1024 + 2)
+			if got := atomic.LoadInt32(&requests); got > maximumRequests {
+				t.Errorf("made %d requests reading %d bytes, expected at most %d", got, zipContent.Len(),
+					maximumRequests)
+			}
+		})
+	}
+}
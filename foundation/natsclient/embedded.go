@@ -0,0 +1,40 @@
+package natsclient
+
+import (
+	"fmt"
+	"github.com/nats-io/nats-server/v2/server"
+	"log"
+	"time"
+)
+
+// EmbeddedConfig contains the parameters for running a NATS server inside the process
+type EmbeddedConfig struct {
+	//Host and Port the server listens for client connections on, other services can connect to it there
+	Host string
+	Port int
+	//ReadyTimeout limits how long to wait for the server to accept connections
+	ReadyTimeout time.Duration
+}
+
+// StartEmbeddedServer starts a NATS server in the process following cfg and waits until it accepts client
+// connections. Connect to it with Connect using the server's ClientURL, and call Shutdown on the server once the
+// connections made to it are closed
+func StartEmbeddedServer(log *log.Logger, cfg EmbeddedConfig) (*server.Server, error) {
+	natsServer, err := server.NewServer(&server.Options{
+		ServerName: "transitcast",
+		Host:       cfg.Host,
+		Port:       cfg.Port,
+		NoSigs:     true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create embedded NATS server: %w", err)
+	}
+	go natsServer.Start()
+	if !natsServer.ReadyForConnections(cfg.ReadyTimeout) {
+		natsServer.Shutdown()
+		return nil, fmt.Errorf("embedded NATS server not accepting connections on %s:%d after %v", cfg.Host,
+			cfg.Port, cfg.ReadyTimeout)
+	}
+	log.Printf("Embedded NATS server accepting connections at %s\n", natsServer.ClientURL())
+	return natsServer, nil
+}
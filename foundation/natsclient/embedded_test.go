@@ -0,0 +1,41 @@
+package natsclient
+
+import (
+	"github.com/nats-io/nats.go"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestStartEmbeddedServer(t *testing.T) {
+	natsServer, err := StartEmbeddedServer(log.New(io.Discard, "", 0), EmbeddedConfig{
+		Host:         "127.0.0.1",
+		Port:         -1,
+		ReadyTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("StartEmbeddedServer() error = %v", err)
+	}
+	defer natsServer.Shutdown()
+
+	conn, err := nats.Connect(natsServer.ClientURL())
+	if err != nil {
+		t.Fatalf("unable to connect to embedded server: %v", err)
+	}
+	defer conn.Close()
+	sub, err := conn.SubscribeSync("vehicle-monitor-results")
+	if err != nil {
+		t.Fatalf("unable to subscribe: %v", err)
+	}
+	if err = conn.Publish("vehicle-monitor-results", []byte("result")); err != nil {
+		t.Fatalf("unable to publish: %v", err)
+	}
+	msg, err := sub.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatalf("no message received from embedded server: %v", err)
+	}
+	if string(msg.Data) != "result" {
+		t.Errorf("received %q, want %q", msg.Data, "result")
+	}
+}
@@ -0,0 +1,133 @@
+// Package natsclient connects to NATS with reconnect, backoff and connection state logging shared by all apps
+package natsclient
+
+import (
+	"expvar"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// connectionMetrics exports counts of NATS connection events under /debug/vars
+var connectionMetrics = expvar.NewMap("nats_connection")
+
+// Config contains the parameters for connecting to NATS
+type Config struct {
+	URL string
+	//Name identifies the connection in NATS server monitoring
+	Name string
+	//MaxReconnects is the number of attempts made to reconnect after the connection is lost before the connection is
+	//closed, negative values never stop attempting
+	MaxReconnects int
+	//ReconnectWait is the delay before the first reconnect attempt, doubling with each failed attempt
+	ReconnectWait time.Duration
+	//MaxReconnectWait limits the delay between reconnect attempts
+	MaxReconnectWait time.Duration
+	//ReconnectBufferBytes is the size of the buffer holding messages published while reconnecting
+	ReconnectBufferBytes int
+	//CredentialsFile is a NATS user credentials file holding a user JWT and NKey seed
+	CredentialsFile string
+	//NKeySeedFile is a file holding an NKey seed used to authenticate without a JWT
+	NKeySeedFile string
+	//RootCAFile is a pem file of certificate authorities used to verify the NATS server
+	RootCAFile string
+	//CertFile and KeyFile are a pem encoded client certificate and key presented to the NATS server
+	CertFile string
+	KeyFile  string
+}
+
+// securityOptions builds the nats.Options authenticating and encrypting the connection described by cfg
+func securityOptions(cfg Config) ([]nats.Option, error) {
+	var options []nats.Option
+	if cfg.CredentialsFile != "" && cfg.NKeySeedFile != "" {
+		return nil, fmt.Errorf("only one of a NATS credentials file or NKey seed file can be used")
+	}
+	if cfg.CredentialsFile != "" {
+		options = append(options, nats.UserCredentials(cfg.CredentialsFile))
+	}
+	if cfg.NKeySeedFile != "" {
+		option, err := nats.NkeyOptionFromSeed(cfg.NKeySeedFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to use NKey seed file %s: %w", cfg.NKeySeedFile, err)
+		}
+		options = append(options, option)
+	}
+	if cfg.RootCAFile != "" {
+		options = append(options, nats.RootCAs(cfg.RootCAFile))
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, fmt.Errorf("a NATS client certificate requires both a certificate file and key file")
+		}
+		options = append(options, nats.ClientCert(cfg.CertFile, cfg.KeyFile))
+	}
+	return options, nil
+}
+
+// Connect establishes a connection to the NATS server at cfg.URL. If the connection is lost it is re-established
+// with backoff following cfg, and subscriptions made on the connection are restored by the NATS client once
+// reconnected. Connection state changes are logged and counted in the nats_connection expvar.
+// The connection is authenticated with cfg.CredentialsFile or cfg.NKeySeedFile when set, and secured with TLS when
+// cfg.RootCAFile or a client certificate are set
+func Connect(log *log.Logger, cfg Config) (*nats.Conn, error) {
+	options, err := securityOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	connectionMetrics.Set("status", expvar.Func(func() interface{} { return "connecting" }))
+	options = append(options,
+		nats.Name(cfg.Name),
+		nats.MaxReconnects(cfg.MaxReconnects),
+		nats.ReconnectBufSize(cfg.ReconnectBufferBytes),
+		nats.CustomReconnectDelay(func(attempts int) time.Duration {
+			delay := reconnectDelay(attempts, cfg.ReconnectWait, cfg.MaxReconnectWait)
+			// jitter keeps all the apps from reconnecting to a restarted server at once
+			return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+		}),
+		nats.DisconnectErrHandler(func(conn *nats.Conn, err error) {
+			connectionMetrics.Add("disconnects", 1)
+			if err != nil {
+				log.Printf("Disconnected from NATS, attempting to reconnect: %v\n", err)
+			} else {
+				log.Printf("Disconnected from NATS\n")
+			}
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			connectionMetrics.Add("reconnects", 1)
+			log.Printf("Reconnected to NATS at %s, restored %d subscriptions\n", conn.ConnectedUrl(),
+				conn.NumSubscriptions())
+		}),
+		nats.ClosedHandler(func(conn *nats.Conn) {
+			log.Printf("NATS connection closed\n")
+		}),
+		nats.ErrorHandler(func(conn *nats.Conn, sub *nats.Subscription, err error) {
+			connectionMetrics.Add("errors", 1)
+			if sub != nil {
+				log.Printf("NATS error on subscription to %s: %v\n", sub.Subject, err)
+				return
+			}
+			log.Printf("NATS error: %v\n", err)
+		}),
+	)
+	conn, err := nats.Connect(cfg.URL, options...)
+	if err != nil {
+		return nil, err
+	}
+	connectionMetrics.Set("status", expvar.Func(func() interface{} { return conn.Status().String() }))
+	log.Printf("Connected to NATS at %s\n", conn.ConnectedUrl())
+	return conn, nil
+}
+
+// reconnectDelay doubles wait for each failed reconnect attempt up to maxWait
+func reconnectDelay(attempts int, wait time.Duration, maxWait time.Duration) time.Duration {
+	delay := wait
+	for i := 1; i < attempts && delay < maxWait; i++ {
+		delay *= 2
+	}
+	if delay > maxWait {
+		return maxWait
+	}
+	return delay
+}
@@ -0,0 +1,76 @@
+package natsclient
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_reconnectDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		want     time.Duration
+	}{
+		{
+			name:     "first attempt waits reconnect wait",
+			attempts: 1,
+			want:     500 * time.Millisecond,
+		},
+		{
+			name:     "doubles with each attempt",
+			attempts: 3,
+			want:     2 * time.Second,
+		},
+		{
+			name:     "limited to max wait",
+			attempts: 20,
+			want:     30 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reconnectDelay(tt.attempts, 500*time.Millisecond, 30*time.Second); got != tt.want {
+				t.Errorf("reconnectDelay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_securityOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         Config
+		wantOptions int
+		wantErr     bool
+	}{
+		{
+			name: "no security",
+		},
+		{
+			name:        "credentials with tls",
+			cfg:         Config{CredentialsFile: "user.creds", RootCAFile: "ca.pem", CertFile: "c.pem", KeyFile: "c.key"},
+			wantOptions: 3,
+		},
+		{
+			name:    "credentials and nkey",
+			cfg:     Config{CredentialsFile: "user.creds", NKeySeedFile: "user.nk"},
+			wantErr: true,
+		},
+		{
+			name:    "certificate without key",
+			cfg:     Config{CertFile: "c.pem"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := securityOptions(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("securityOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.wantOptions {
+				t.Errorf("securityOptions() returned %d options, want %d", len(got), tt.wantOptions)
+			}
+		})
+	}
+}
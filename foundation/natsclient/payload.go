@@ -0,0 +1,138 @@
+package natsclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/snappy"
+	"io"
+)
+
+// Compression applied to json payloads by Codec
+const (
+	CompressionNone   = "none"
+	CompressionGzip   = "gzip"
+	CompressionSnappy = "snappy"
+)
+
+// Encodings of payloads published by Codec
+const (
+	EncodingJSON     = "json"
+	EncodingProtobuf = "protobuf"
+)
+
+// gzipMagic starts every gzip stream and never starts a json document or protocol buffer
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// snappyMagic is the stream identifier chunk starting every snappy framed stream. Its first byte would be a tag with
+// the invalid wire type 7 in a protocol buffer
+var snappyMagic = []byte("\xff\x06\x00\x00sNaPpY")
+
+// ProtoMessage is implemented by messages with a protocol buffer contract, allowing them to be published as protobuf
+type ProtoMessage interface {
+	MarshalProto() ([]byte, error)
+	UnmarshalProto(data []byte) error
+}
+
+// Codec marshals messages published over NATS to json or protobuf, compressed with gzip or snappy when configured.
+// The zero value publishes uncompressed json
+type Codec struct {
+	compression string
+	encoding    string
+}
+
+// NewCodec returns a Codec applying compression, either CompressionNone, CompressionGzip, CompressionSnappy or empty
+// for none, to payloads encoded as encoding, either EncodingJSON, EncodingProtobuf or empty for json
+func NewCodec(compression string, encoding string) (Codec, error) {
+	var codec Codec
+	switch compression {
+	case "", CompressionNone:
+	case CompressionGzip, CompressionSnappy:
+		codec.compression = compression
+	default:
+		return Codec{}, fmt.Errorf("unsupported NATS payload compression %q, expected %s, %s or %s", compression,
+			CompressionNone, CompressionGzip, CompressionSnappy)
+	}
+	switch encoding {
+	case "", EncodingJSON:
+	case EncodingProtobuf:
+		codec.encoding = encoding
+	default:
+		return Codec{}, fmt.Errorf("unsupported NATS payload encoding %q, expected %s or %s", encoding,
+			EncodingJSON, EncodingProtobuf)
+	}
+	return codec, nil
+}
+
+// Marshal returns v encoded and compressed according to the Codec. When encoding as protobuf, messages that don't
+// implement ProtoMessage are encoded as json
+func (c Codec) Marshal(v interface{}) ([]byte, error) {
+	data, err := c.encode(v)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	var writer io.WriteCloser
+	switch c.compression {
+	case CompressionGzip:
+		writer = gzip.NewWriter(&buffer)
+	case CompressionSnappy:
+		writer = snappy.NewBufferedWriter(&buffer)
+	default:
+		return data, nil
+	}
+	if _, err = writer.Write(data); err != nil {
+		return nil, fmt.Errorf("unable to compress payload: %w", err)
+	}
+	if err = writer.Close(); err != nil {
+		return nil, fmt.Errorf("unable to compress payload: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// encode returns v as protobuf when the Codec encodes protobuf and v is a ProtoMessage, otherwise as json
+func (c Codec) encode(v interface{}) ([]byte, error) {
+	if message, ok := v.(ProtoMessage); ok && c.encoding == EncodingProtobuf {
+		return message.MarshalProto()
+	}
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes a json or protobuf payload into v whether or not it was compressed, so subscribers can read
+// messages from publishers using any Codec. Payloads starting with '{' are json, anything else is decoded as
+// protobuf, which requires v to be a ProtoMessage
+func Unmarshal(data []byte, v interface{}) error {
+	if bytes.HasPrefix(data, gzipMagic) {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("unable to decompress payload: %w", err)
+		}
+		defer reader.Close()
+		data, err = io.ReadAll(reader)
+		if err != nil {
+			return fmt.Errorf("unable to decompress payload: %w", err)
+		}
+	} else if bytes.HasPrefix(data, snappyMagic) {
+		var err error
+		data, err = io.ReadAll(snappy.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			return fmt.Errorf("unable to decompress payload: %w", err)
+		}
+	}
+	if isJSON(data) {
+		return json.Unmarshal(data, v)
+	}
+	message, ok := v.(ProtoMessage)
+	if !ok {
+		return fmt.Errorf("unable to decode protobuf payload into %T", v)
+	}
+	return message.UnmarshalProto(data)
+}
+
+// isJSON returns true if data starts a json object. A protocol buffer can't start with '{', which would be a tag for
+// field 15 with the deprecated start group wire type. Leading whitespace isn't skipped, as json.Marshal never writes
+// it and a protocol buffer can start with '\n', the tag of length delimited field 1
+func isJSON(data []byte) bool {
+	return len(data) > 0 && data[0] == '{'
+}
@@ -0,0 +1,134 @@
+package natsclient
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testMessage struct {
+	Version int      `json:"version"`
+	Stops   []string `json:"stops"`
+}
+
+// testProtoMessage stands in for a protocol buffer by encoding its stops separated by commas
+type testProtoMessage struct {
+	Stops []string `json:"stops"`
+}
+
+func (t *testProtoMessage) MarshalProto() ([]byte, error) {
+	return []byte(strings.Join(t.Stops, ",")), nil
+}
+
+func (t *testProtoMessage) UnmarshalProto(data []byte) error {
+	t.Stops = strings.Split(string(data), ",")
+	return nil
+}
+
+func TestCodec_roundTrip(t *testing.T) {
+	message := testMessage{Version: 1, Stops: []string{"A", "B", "C"}}
+	for _, compression := range []string{"", CompressionNone, CompressionGzip, CompressionSnappy} {
+		t.Run(compression, func(t *testing.T) {
+			codec, err := NewCodec(compression, "")
+			if err != nil {
+				t.Fatalf("NewCodec() error = %v", err)
+			}
+			data, err := codec.Marshal(message)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if compressed := bytes.HasPrefix(data, gzipMagic); compressed != (compression == CompressionGzip) {
+				t.Errorf("Marshal() gzip compressed = %v with compression %q", compressed, compression)
+			}
+			if compressed := bytes.HasPrefix(data, snappyMagic); compressed != (compression == CompressionSnappy) {
+				t.Errorf("Marshal() snappy compressed = %v with compression %q", compressed, compression)
+			}
+			var got testMessage
+			if err = Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, message) {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, message)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_unversionedJson(t *testing.T) {
+	var got testMessage
+	if err := Unmarshal([]byte(`{"stops":["A"],"added_later":true}`), &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if got.Version != 0 || len(got.Stops) != 1 {
+		t.Errorf("Unmarshal() = %+v", got)
+	}
+}
+
+func TestCodec_protobuf(t *testing.T) {
+	message := &testProtoMessage{Stops: []string{"A", "B"}}
+	for _, compression := range []string{CompressionNone, CompressionGzip, CompressionSnappy} {
+		t.Run(compression, func(t *testing.T) {
+			codec, err := NewCodec(compression, EncodingProtobuf)
+			if err != nil {
+				t.Fatalf("NewCodec() error = %v", err)
+			}
+			data, err := codec.Marshal(message)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			var got testProtoMessage
+			if err = Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Stops, message.Stops) {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, message)
+			}
+		})
+	}
+}
+
+func TestCodec_protobufFallsBackToJson(t *testing.T) {
+	codec, err := NewCodec(CompressionNone, EncodingProtobuf)
+	if err != nil {
+		t.Fatalf("NewCodec() error = %v", err)
+	}
+	data, err := codec.Marshal(testMessage{Version: 1})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if !isJSON(data) {
+		t.Errorf("Marshal() = %s, expected json for message without protocol buffer contract", data)
+	}
+}
+
+func TestUnmarshal_jsonIntoProtoMessage(t *testing.T) {
+	var got testProtoMessage
+	if err := Unmarshal([]byte(`{"stops":["A","B"]}`), &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(got.Stops, []string{"A", "B"}) {
+		t.Errorf("Unmarshal() = %+v", got)
+	}
+}
+
+func TestUnmarshal_protobufStartingWithNewline(t *testing.T) {
+	//length delimited field 1 holding 123 bytes is tagged '\n' followed by '{'
+	data := []byte("\n{A")
+	var got testProtoMessage
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(got.Stops, []string{"\n{A"}) {
+		t.Errorf("Unmarshal() = %+v, expected payload decoded as protocol buffer", got)
+	}
+}
+
+func TestNewCodec_unsupported(t *testing.T) {
+	if _, err := NewCodec("zstd", ""); err == nil {
+		t.Errorf("NewCodec(zstd) expected error")
+	}
+	if _, err := NewCodec("", "avro"); err == nil {
+		t.Errorf("NewCodec(avro) expected error")
+	}
+}
@@ -0,0 +1,31 @@
+package natsclient
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Subjects places the NATS subjects of one agency's pipeline under the agency's tenant prefix, so the pipelines of
+// several agencies share NATS servers without receiving each other's messages. The zero value leaves subjects
+// unchanged
+type Subjects struct {
+	tenant string
+}
+
+// NewSubjects returns Subjects prefixing each subject with tenant and the NATS token separator, an empty tenant
+// leaves subjects unchanged. tenant is a single subject token, it can't contain separators, wildcards or whitespace
+func NewSubjects(tenant string) (Subjects, error) {
+	if strings.ContainsAny(tenant, ".*> \t\r\n") {
+		return Subjects{}, fmt.Errorf("tenant %q must be a single NATS subject token without \".\", \"*\", "+
+			"\">\" or whitespace", tenant)
+	}
+	return Subjects{tenant: tenant}, nil
+}
+
+// Subject returns subject in the tenant's namespace, for example "trimet.trip-update-prediction"
+func (s Subjects) Subject(subject string) string {
+	if s.tenant == "" {
+		return subject
+	}
+	return s.tenant + "." + subject
+}
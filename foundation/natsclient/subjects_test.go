@@ -0,0 +1,49 @@
+package natsclient
+
+import "testing"
+
+func TestSubjects_Subject(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenant  string
+		subject string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "no tenant",
+			subject: "vehicle-monitor-results",
+			want:    "vehicle-monitor-results",
+		},
+		{
+			name:    "tenant",
+			tenant:  "trimet",
+			subject: "inference-request.3",
+			want:    "trimet.inference-request.3",
+		},
+		{
+			name:    "tenant with separator",
+			tenant:  "us.trimet",
+			wantErr: true,
+		},
+		{
+			name:    "tenant with wildcard",
+			tenant:  "*",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subjects, err := NewSubjects(tt.tenant)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSubjects() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := subjects.Subject(tt.subject); got != tt.want {
+				t.Errorf("Subject() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,415 @@
+// Package onnx loads ONNX models exported from training and evaluates them in process, so predictions can be made
+// without a round trip to a separate model runner. Only the operators used by the regression models transitcast
+// trains are supported: linear and tree ensemble regressors, scalers and small fully connected networks.
+// Values are computed as float64, results may differ from onnxruntime in the last digits of float32 precision
+package onnx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+	"os"
+)
+
+// onnx TensorProto data types that can be read
+const (
+	tensorFloat  = 1
+	tensorInt32  = 6
+	tensorInt64  = 7
+	tensorDouble = 11
+)
+
+// Model is a loaded ONNX graph that predicts a single value from a row of features
+type Model struct {
+	nodes        []*node
+	initializers map[string]*tensor
+	input        string
+	output       string
+}
+
+// node is an operator in the graph
+type node struct {
+	opType     string
+	name       string
+	inputs     []string
+	outputs    []string
+	attributes map[string]*attribute
+	// ensemble holds the trees of a TreeEnsembleRegressor
+	ensemble *treeEnsemble
+}
+
+// attribute is a named attribute of a node
+type attribute struct {
+	f       float64
+	i       int64
+	s       string
+	t       *tensor
+	floats  []float64
+	ints    []int64
+	strings []string
+}
+
+// tensor holds the values of a tensor in row major order
+type tensor struct {
+	shape []int
+	data  []float64
+}
+
+// Load reads and decodes the ONNX model at path
+func Load(path string) (*Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	model, err := Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load onnx model %s: %w", path, err)
+	}
+	return model, nil
+}
+
+// Decode decodes an ONNX ModelProto, returning an error if the graph uses an operator that is not supported
+func Decode(data []byte) (*Model, error) {
+	var graph []byte
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error {
+		if num == 7 && typ == protowire.BytesType {
+			graph = value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if graph == nil {
+		return nil, fmt.Errorf("model has no graph")
+	}
+	return decodeGraph(graph)
+}
+
+// decodeGraph decodes a GraphProto into a Model
+func decodeGraph(data []byte) (*Model, error) {
+	model := Model{initializers: make(map[string]*tensor)}
+	var inputs, outputs []string
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error {
+		switch num {
+		case 1:
+			n, err := decodeNode(value)
+			if err != nil {
+				return err
+			}
+			model.nodes = append(model.nodes, n)
+		case 5:
+			name, t, err := decodeTensor(value)
+			if err != nil {
+				return err
+			}
+			model.initializers[name] = t
+		case 11, 12:
+			name, err := decodeValueInfoName(value)
+			if err != nil {
+				return err
+			}
+			if num == 11 {
+				inputs = append(inputs, name)
+			} else {
+				outputs = append(outputs, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// older exporters list initializers as graph inputs
+	for _, input := range inputs {
+		if _, present := model.initializers[input]; !present {
+			model.input = input
+			break
+		}
+	}
+	if model.input == "" {
+		return nil, fmt.Errorf("graph has no input")
+	}
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("graph has no output")
+	}
+	model.output = outputs[0]
+	for _, n := range model.nodes {
+		if _, present := operators[n.opType]; !present {
+			return nil, fmt.Errorf("unsupported operator %s in node %s", n.opType, n.name)
+		}
+		if n.opType == "TreeEnsembleRegressor" {
+			n.ensemble, err = makeTreeEnsemble(n)
+			if err != nil {
+				return nil, fmt.Errorf("node %s: %w", n.name, err)
+			}
+		}
+	}
+	return &model, nil
+}
+
+// decodeNode decodes a NodeProto
+func decodeNode(data []byte) (*node, error) {
+	n := node{attributes: make(map[string]*attribute)}
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error {
+		switch num {
+		case 1:
+			n.inputs = append(n.inputs, string(value))
+		case 2:
+			n.outputs = append(n.outputs, string(value))
+		case 3:
+			n.name = string(value)
+		case 4:
+			n.opType = string(value)
+		case 5:
+			name, a, err := decodeAttribute(value)
+			if err != nil {
+				return err
+			}
+			n.attributes[name] = a
+		}
+		return nil
+	})
+	return &n, err
+}
+
+// decodeAttribute decodes an AttributeProto returning its name
+func decodeAttribute(data []byte) (string, *attribute, error) {
+	var name string
+	a := attribute{}
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error {
+		var err error
+		switch num {
+		case 1:
+			name = string(value)
+		case 2:
+			a.f = float64(math.Float32frombits(uint32(varint)))
+		case 3:
+			a.i = int64(varint)
+		case 4:
+			a.s = string(value)
+		case 5:
+			_, a.t, err = decodeTensor(value)
+		case 7:
+			a.floats, err = appendFloats(a.floats, typ, value, varint)
+		case 8:
+			a.ints, err = appendInts(a.ints, typ, value, varint)
+		case 9:
+			a.strings = append(a.strings, string(value))
+		}
+		return err
+	})
+	return name, &a, err
+}
+
+// decodeValueInfoName returns the name of a ValueInfoProto
+func decodeValueInfoName(data []byte) (string, error) {
+	var name string
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error {
+		if num == 1 {
+			name = string(value)
+		}
+		return nil
+	})
+	return name, err
+}
+
+// decodeTensor decodes a TensorProto returning its name
+func decodeTensor(data []byte) (string, *tensor, error) {
+	var name string
+	var dataType uint64
+	var dims []int64
+	var values []float64
+	var raw []byte
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error {
+		var err error
+		switch num {
+		case 1:
+			dims, err = appendInts(dims, typ, value, varint)
+		case 2:
+			dataType = varint
+		case 4:
+			values, err = appendFloats(values, typ, value, varint)
+		case 5, 7:
+			var ints []int64
+			ints, err = appendInts(nil, typ, value, varint)
+			for _, i := range ints {
+				values = append(values, float64(i))
+			}
+		case 8:
+			name = string(value)
+		case 9:
+			raw = value
+		case 10:
+			values, err = appendDoubles(values, typ, value, varint)
+		}
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if raw != nil {
+		values, err = decodeRawData(dataType, raw)
+		if err != nil {
+			return "", nil, fmt.Errorf("tensor %s: %w", name, err)
+		}
+	}
+	t := tensor{shape: make([]int, len(dims)), data: values}
+	size := 1
+	for i, dim := range dims {
+		t.shape[i] = int(dim)
+		size *= int(dim)
+	}
+	if size != len(values) {
+		return "", nil, fmt.Errorf("tensor %s has %d values for shape %v", name, len(values), t.shape)
+	}
+	return name, &t, nil
+}
+
+// decodeRawData reads little endian tensor values of dataType
+func decodeRawData(dataType uint64, raw []byte) ([]float64, error) {
+	var width int
+	switch dataType {
+	case tensorFloat, tensorInt32:
+		width = 4
+	case tensorInt64, tensorDouble:
+		width = 8
+	default:
+		return nil, fmt.Errorf("unsupported tensor data type %d", dataType)
+	}
+	if len(raw)%width != 0 {
+		return nil, fmt.Errorf("raw data length %d is not a multiple of %d", len(raw), width)
+	}
+	values := make([]float64, len(raw)/width)
+	for i := range values {
+		b := raw[i*width:]
+		switch dataType {
+		case tensorFloat:
+			values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		case tensorInt32:
+			values[i] = float64(int32(binary.LittleEndian.Uint32(b)))
+		case tensorInt64:
+			values[i] = float64(int64(binary.LittleEndian.Uint64(b)))
+		case tensorDouble:
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(b))
+		}
+	}
+	return values, nil
+}
+
+// consumeFields calls fieldFunc with each field of the protocol buffer message in data. Length delimited fields are
+// passed as value, varint and fixed width fields as varint
+func consumeFields(data []byte,
+	fieldFunc func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		var value []byte
+		var varint uint64
+		switch typ {
+		case protowire.VarintType:
+			varint, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(data)
+			varint = uint64(v)
+		case protowire.Fixed64Type:
+			varint, n = protowire.ConsumeFixed64(data)
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		err := fieldFunc(num, typ, value, varint)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendInts appends a repeated varint field, packed or not
+func appendInts(ints []int64, typ protowire.Type, value []byte, varint uint64) ([]int64, error) {
+	if typ != protowire.BytesType {
+		return append(ints, int64(varint)), nil
+	}
+	for len(value) > 0 {
+		v, n := protowire.ConsumeVarint(value)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		ints = append(ints, int64(v))
+		value = value[n:]
+	}
+	return ints, nil
+}
+
+// appendFloats appends a repeated float field, packed or not
+func appendFloats(floats []float64, typ protowire.Type, value []byte, varint uint64) ([]float64, error) {
+	if typ != protowire.BytesType {
+		return append(floats, float64(math.Float32frombits(uint32(varint)))), nil
+	}
+	for len(value) > 0 {
+		v, n := protowire.ConsumeFixed32(value)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		floats = append(floats, float64(math.Float32frombits(v)))
+		value = value[n:]
+	}
+	return floats, nil
+}
+
+// appendDoubles appends a repeated double field, packed or not
+func appendDoubles(doubles []float64, typ protowire.Type, value []byte, varint uint64) ([]float64, error) {
+	if typ != protowire.BytesType {
+		return append(doubles, math.Float64frombits(varint)), nil
+	}
+	for len(value) > 0 {
+		v, n := protowire.ConsumeFixed64(value)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		doubles = append(doubles, math.Float64frombits(v))
+		value = value[n:]
+	}
+	return doubles, nil
+}
+
+// MemorySize estimates the bytes held by the decoded model: its initializers, numeric and string attributes and the
+// index of any tree ensemble
+func (m *Model) MemorySize() int64 {
+	var size int64
+	for _, t := range m.initializers {
+		size += t.memorySize()
+	}
+	for _, n := range m.nodes {
+		for _, a := range n.attributes {
+			size += int64(8 * (len(a.floats) + len(a.ints)))
+			for _, s := range a.strings {
+				size += int64(16 + len(s))
+			}
+			if a.t != nil {
+				size += a.t.memorySize()
+			}
+		}
+		if n.ensemble != nil {
+			// each node is indexed by tree and node id, and has its own copy of the attributes
+			size += int64(len(n.ensemble.nodeIds) * (48 + 7*8))
+		}
+	}
+	return size
+}
+
+// memorySize estimates the bytes held by the values and shape of t
+func (t *tensor) memorySize() int64 {
+	return int64(8 * (len(t.data) + len(t.shape)))
+}
@@ -0,0 +1,356 @@
+package onnx
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testAttribute builds an AttributeProto, value is a float32, int, string, []float32, []int64 or []string
+func testAttribute(name string, value interface{}) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, name)
+	switch v := value.(type) {
+	case float32:
+		b = protowire.AppendTag(b, 2, protowire.Fixed32Type)
+		b = protowire.AppendFixed32(b, math.Float32bits(v))
+	case int:
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(v))
+	case string:
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendString(b, v)
+	case []float32:
+		var packed []byte
+		for _, f := range v {
+			packed = protowire.AppendFixed32(packed, math.Float32bits(f))
+		}
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendBytes(b, packed)
+	case []int64:
+		// repeated ints are written unpacked, as onnx's python helpers do
+		for _, i := range v {
+			b = protowire.AppendTag(b, 8, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(i))
+		}
+	case []string:
+		for _, s := range v {
+			b = protowire.AppendTag(b, 9, protowire.BytesType)
+			b = protowire.AppendString(b, s)
+		}
+	}
+	return b
+}
+
+// testNode builds a NodeProto
+func testNode(opType string, inputs []string, output string, attributes ...[]byte) []byte {
+	var b []byte
+	for _, input := range inputs {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, input)
+	}
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, output)
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendString(b, output+"_node")
+	b = protowire.AppendTag(b, 4, protowire.BytesType)
+	b = protowire.AppendString(b, opType)
+	for _, attribute := range attributes {
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendBytes(b, attribute)
+	}
+	return b
+}
+
+// testTensor builds a float TensorProto with values in raw_data
+func testTensor(name string, dims []int64, values []float32) []byte {
+	var b []byte
+	var packed []byte
+	for _, dim := range dims {
+		packed = protowire.AppendVarint(packed, uint64(dim))
+	}
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, packed)
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, tensorFloat)
+	b = protowire.AppendTag(b, 8, protowire.BytesType)
+	b = protowire.AppendString(b, name)
+	var raw []byte
+	for _, value := range values {
+		raw = protowire.AppendFixed32(raw, math.Float32bits(value))
+	}
+	// AppendFixed32 writes little endian, matching raw_data
+	b = protowire.AppendTag(b, 9, protowire.BytesType)
+	b = protowire.AppendBytes(b, raw)
+	return b
+}
+
+// testValueInfo builds a ValueInfoProto
+func testValueInfo(name string) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	return protowire.AppendString(b, name)
+}
+
+// testModel builds a ModelProto with a graph reading "features" and producing "prediction"
+func testModel(initializers [][]byte, nodes ...[]byte) []byte {
+	var graph []byte
+	for _, n := range nodes {
+		graph = protowire.AppendTag(graph, 1, protowire.BytesType)
+		graph = protowire.AppendBytes(graph, n)
+	}
+	for _, initializer := range initializers {
+		graph = protowire.AppendTag(graph, 5, protowire.BytesType)
+		graph = protowire.AppendBytes(graph, initializer)
+	}
+	graph = protowire.AppendTag(graph, 11, protowire.BytesType)
+	graph = protowire.AppendBytes(graph, testValueInfo("features"))
+	graph = protowire.AppendTag(graph, 12, protowire.BytesType)
+	graph = protowire.AppendBytes(graph, testValueInfo("prediction"))
+	var model []byte
+	model = protowire.AppendTag(model, 1, protowire.VarintType)
+	model = protowire.AppendVarint(model, 8)
+	model = protowire.AppendTag(model, 7, protowire.BytesType)
+	return protowire.AppendBytes(model, graph)
+}
+
+func TestModel_Run(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    []byte
+		features []float64
+		want     float64
+	}{
+		{
+			name: "fully connected network",
+			model: testModel([][]byte{
+				testTensor("w1", []int64{2, 2}, []float32{1, -1, 2, 1}),
+				testTensor("b1", []int64{2}, []float32{0, 1}),
+				testTensor("w2", []int64{1, 2}, []float32{3, 0.5}),
+				testTensor("b2", []int64{1}, []float32{10}),
+			},
+				testNode("Gemm", []string{"features", "w1", "b1"}, "hidden"),
+				testNode("Relu", []string{"hidden"}, "activated"),
+				testNode("Gemm", []string{"activated", "w2", "b2"}, "prediction", testAttribute("transB", 1))),
+			// hidden = [1+4, -1+2+1] = [5, 2], prediction = 3*5 + 0.5*2 + 10
+			features: []float64{1, 2},
+			want:     26,
+		},
+		{
+			name: "relu clips negative values",
+			model: testModel([][]byte{
+				testTensor("w", []int64{2, 1}, []float32{-1, -1}),
+				testTensor("b", []int64{1, 1}, []float32{4}),
+			},
+				testNode("MatMul", []string{"features", "w"}, "product"),
+				testNode("Add", []string{"product", "b"}, "sum"),
+				testNode("Relu", []string{"sum"}, "prediction")),
+			features: []float64{3, 2},
+			want:     0,
+		},
+		{
+			name: "scaled linear regressor",
+			model: testModel(nil,
+				testNode("Scaler", []string{"features"}, "scaled",
+					testAttribute("offset", []float32{10, 0}),
+					testAttribute("scale", []float32{0.5, 2})),
+				testNode("LinearRegressor", []string{"scaled"}, "prediction",
+					testAttribute("coefficients", []float32{4, 1}),
+					testAttribute("intercepts", []float32{100}))),
+			// scaled = [(14-10)*0.5, 3*2] = [2, 6], prediction = 4*2 + 6 + 100
+			features: []float64{14, 3},
+			want:     114,
+		},
+		{
+			name:     "tree ensemble first tree left, second tree right",
+			model:    testModel(nil, testTreeEnsemble("SUM")),
+			features: []float64{5, 20},
+			want:     100 + 30 + 7,
+		},
+		{
+			name:     "tree ensemble average",
+			model:    testModel(nil, testTreeEnsemble("AVERAGE")),
+			features: []float64{15, 5},
+			want:     100 + (60+3)/2.0,
+		},
+		{
+			name:     "tree ensemble missing value",
+			model:    testModel(nil, testTreeEnsemble("SUM")),
+			features: []float64{math.NaN(), 5},
+			want:     100 + 30 + 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := Decode(tt.model)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			got, err := model.Run(tt.features)
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("Run() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testTreeEnsemble builds a TreeEnsembleRegressor with two single split trees and a base value of 100.
+// Tree 0 splits feature 0 at 10, missing values going to its true branch, tree 1 splits feature 1 at 10
+func testTreeEnsemble(aggregate string) []byte {
+	return testNode("TreeEnsembleRegressor", []string{"features"}, "prediction",
+		testAttribute("aggregate_function", aggregate),
+		testAttribute("n_targets", 1),
+		testAttribute("base_values", []float32{100}),
+		testAttribute("nodes_treeids", []int64{0, 0, 0, 1, 1, 1}),
+		testAttribute("nodes_nodeids", []int64{0, 1, 2, 0, 1, 2}),
+		testAttribute("nodes_featureids", []int64{0, 0, 0, 1, 0, 0}),
+		testAttribute("nodes_values", []float32{10, 0, 0, 10, 0, 0}),
+		testAttribute("nodes_modes", []string{"BRANCH_LEQ", "LEAF", "LEAF", "BRANCH_LT", "LEAF", "LEAF"}),
+		testAttribute("nodes_truenodeids", []int64{1, 0, 0, 1, 0, 0}),
+		testAttribute("nodes_falsenodeids", []int64{2, 0, 0, 2, 0, 0}),
+		testAttribute("nodes_missing_value_tracks_true", []int64{1, 0, 0, 0, 0, 0}),
+		testAttribute("target_treeids", []int64{0, 0, 1, 1}),
+		testAttribute("target_nodeids", []int64{1, 2, 1, 2}),
+		testAttribute("target_ids", []int64{0, 0, 0, 0}),
+		testAttribute("target_weights", []float32{30, 60, 3, 7}))
+}
+
+// TestTreeEnsemble_skl2onnx checks the trees of testdata/sklearn_randomforest.onnx, a RandomForestClassifier trained
+// on the iris data set and exported by skl2onnx 1.17.0, against the results onnxruntime gives for it. The model and
+// its results come from the test data of github.com/yalue/onnxruntime_go (MIT license), where they were made by
+// generate_sklearn_network.py. The classifier's class_ attributes hold its leaf weights the same way a regressor's
+// target_ attributes do, so its class probabilities are the sums treeEnsembleRegressor computes with a target for
+// each class
+func TestTreeEnsemble_skl2onnx(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "sklearn_randomforest.onnx"))
+	if err != nil {
+		t.Fatalf("unable to read model: %v", err)
+	}
+	classifier := testFindNode(t, data, "TreeEnsembleClassifier")
+	for _, name := range []string{"treeids", "nodeids", "ids", "weights"} {
+		classifier.attributes["target_"+name] = classifier.attributes["class_"+name]
+	}
+	classLabels := classifier.attrInts("classlabels_int64s")
+	classifier.attributes["n_targets"] = &attribute{i: int64(len(classLabels))}
+	classifier.ensemble, err = makeTreeEnsemble(classifier)
+	if err != nil {
+		t.Fatalf("makeTreeEnsemble() error = %v", err)
+	}
+
+	features := &tensor{shape: []int{6, 4}, data: []float64{
+		5.9, 3.0, 5.1, 1.8,
+		6.8, 2.8, 4.8, 1.4,
+		6.3, 2.3, 4.4, 1.3,
+		6.5, 3.0, 5.5, 1.8,
+		7.7, 2.8, 6.7, 2.0,
+		5.5, 2.5, 4.0, 1.3,
+	}}
+	// output_label and output_probability from onnxruntime
+	wantLabels := []int64{2, 1, 1, 2, 2, 1}
+	wantProbabilities := [][]float64{
+		{0.0, 0.12999998033046722, 0.8699994683265686},
+		{0.0, 0.7699995636940002, 0.23000003397464752},
+		{0.0, 0.969999372959137, 0.029999999329447746},
+		{0.0, 0.0, 0.9999993443489075},
+		{0.0, 0.0, 0.9999993443489075},
+		{0.0, 0.9999993443489075, 0.0},
+	}
+
+	got, err := treeEnsembleRegressor(classifier, []*tensor{features})
+	if err != nil {
+		t.Fatalf("treeEnsembleRegressor() error = %v", err)
+	}
+	for r, want := range wantProbabilities {
+		probabilities := got.data[r*len(classLabels) : (r+1)*len(classLabels)]
+		best := 0
+		for c := range want {
+			if math.Abs(probabilities[c]-want[c]) > 1e-5 {
+				t.Errorf("row %d class %d probability = %v, want %v", r, classLabels[c], probabilities[c], want[c])
+			}
+			if probabilities[c] > probabilities[best] {
+				best = c
+			}
+		}
+		if classLabels[best] != wantLabels[r] {
+			t.Errorf("row %d label = %d, want %d", r, classLabels[best], wantLabels[r])
+		}
+	}
+}
+
+// testFindNode returns the first node with opType in the graph of the ONNX model data
+func testFindNode(t *testing.T, data []byte, opType string) *node {
+	var found *node
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error {
+		if num != 7 || typ != protowire.BytesType {
+			return nil
+		}
+		return consumeFields(value, func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error {
+			if num != 1 || found != nil {
+				return nil
+			}
+			n, err := decodeNode(value)
+			if err == nil && n.opType == opType {
+				found = n
+			}
+			return err
+		})
+	})
+	if err != nil || found == nil {
+		t.Fatalf("unable to find %s node: %v", opType, err)
+	}
+	return found
+}
+
+func TestDecode_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		model   []byte
+		wantErr string
+	}{
+		{
+			name:    "unsupported operator",
+			model:   testModel(nil, testNode("Softmax", []string{"features"}, "prediction")),
+			wantErr: "unsupported operator Softmax",
+		},
+		{
+			name: "mismatched tree attributes",
+			model: testModel(nil, testNode("TreeEnsembleRegressor", []string{"features"}, "prediction",
+				testAttribute("nodes_nodeids", []int64{0, 1}))),
+			wantErr: "tree node attributes have different lengths",
+		},
+		{
+			name:    "truncated",
+			model:   testModel(nil, testNode("Relu", []string{"features"}, "prediction"))[:10],
+			wantErr: "unexpected EOF",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(tt.model)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Decode() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestModel_MemorySize(t *testing.T) {
+	model, err := Decode(testModel([][]byte{testTensor("w", []int64{2, 3}, []float32{1, 2, 3, 4, 5, 6})},
+		testNode("MatMul", []string{"features", "w"}, "product"),
+		testNode("LinearRegressor", []string{"product"}, "prediction",
+			testAttribute("coefficients", []float32{1, 1, 1}))))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	// 6 values and 2 dimensions of w, then 3 coefficients
+	if got := model.MemorySize(); got != 8*(6+2)+8*3 {
+		t.Errorf("MemorySize() = %d, want %d", got, 8*(6+2)+8*3)
+	}
+}
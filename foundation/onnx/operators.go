@@ -0,0 +1,431 @@
+package onnx
+
+import (
+	"fmt"
+	"math"
+)
+
+// operator computes the single output of a node from its inputs, inputs named "" are optional inputs left out
+type operator func(n *node, inputs []*tensor) (*tensor, error)
+
+// operators are the supported operators by op_type
+var operators = map[string]operator{
+	"Identity":              identity,
+	"Cast":                  cast,
+	"Reshape":               reshape,
+	"Flatten":               flatten,
+	"Gemm":                  gemm,
+	"MatMul":                matMul,
+	"Add":                   elementwise(func(a, b float64) float64 { return a + b }),
+	"Sub":                   elementwise(func(a, b float64) float64 { return a - b }),
+	"Mul":                   elementwise(func(a, b float64) float64 { return a * b }),
+	"Div":                   elementwise(func(a, b float64) float64 { return a / b }),
+	"Relu":                  unary(func(x float64) float64 { return math.Max(x, 0) }),
+	"Sigmoid":               unary(func(x float64) float64 { return 1 / (1 + math.Exp(-x)) }),
+	"Tanh":                  unary(math.Tanh),
+	"Scaler":                scaler,
+	"LinearRegressor":       linearRegressor,
+	"TreeEnsembleRegressor": treeEnsembleRegressor,
+}
+
+// Run evaluates the model with features as a single row of its input and returns the first value of its output
+func (m *Model) Run(features []float64) (float64, error) {
+	values := make(map[string]*tensor, len(m.initializers)+len(m.nodes)+1)
+	for name, t := range m.initializers {
+		values[name] = t
+	}
+	values[m.input] = &tensor{shape: []int{1, len(features)}, data: features}
+	for _, n := range m.nodes {
+		inputs := make([]*tensor, len(n.inputs))
+		for i, name := range n.inputs {
+			if name == "" {
+				continue
+			}
+			t, present := values[name]
+			if !present {
+				return 0, fmt.Errorf("node %s input %s has not been computed", n.name, name)
+			}
+			inputs[i] = t
+		}
+		output, err := operators[n.opType](n, inputs)
+		if err != nil {
+			return 0, fmt.Errorf("%s node %s: %w", n.opType, n.name, err)
+		}
+		if len(n.outputs) > 0 {
+			values[n.outputs[0]] = output
+		}
+	}
+	result, present := values[m.output]
+	if !present || len(result.data) == 0 {
+		return 0, fmt.Errorf("model output %s was not computed", m.output)
+	}
+	return result.data[0], nil
+}
+
+// attrFloat returns the float attribute of n named name or defaultValue if not present
+func (n *node) attrFloat(name string, defaultValue float64) float64 {
+	if a, present := n.attributes[name]; present {
+		return a.f
+	}
+	return defaultValue
+}
+
+// attrInt returns the int attribute of n named name or defaultValue if not present
+func (n *node) attrInt(name string, defaultValue int64) int64 {
+	if a, present := n.attributes[name]; present {
+		return a.i
+	}
+	return defaultValue
+}
+
+// attrString returns the string attribute of n named name or defaultValue if not present
+func (n *node) attrString(name string, defaultValue string) string {
+	if a, present := n.attributes[name]; present {
+		return a.s
+	}
+	return defaultValue
+}
+
+// attrFloats returns the floats attribute of n named name
+func (n *node) attrFloats(name string) []float64 {
+	if a, present := n.attributes[name]; present {
+		return a.floats
+	}
+	return nil
+}
+
+// attrInts returns the ints attribute of n named name
+func (n *node) attrInts(name string) []int64 {
+	if a, present := n.attributes[name]; present {
+		return a.ints
+	}
+	return nil
+}
+
+// requireInputs returns an error if fewer than count inputs are present
+func requireInputs(inputs []*tensor, count int) error {
+	if len(inputs) < count {
+		return fmt.Errorf("expected %d inputs, found %d", count, len(inputs))
+	}
+	for i := 0; i < count; i++ {
+		if inputs[i] == nil {
+			return fmt.Errorf("missing input %d", i)
+		}
+	}
+	return nil
+}
+
+// checkPostTransform returns an error if n applies a post_transform other than NONE
+func checkPostTransform(n *node) error {
+	if transform := n.attrString("post_transform", "NONE"); transform != "NONE" {
+		return fmt.Errorf("unsupported post_transform %s", transform)
+	}
+	return nil
+}
+
+// size returns the number of values in a tensor of shape
+func size(shape []int) int {
+	result := 1
+	for _, dim := range shape {
+		result *= dim
+	}
+	return result
+}
+
+// rows returns the number of rows and columns of t treated as a matrix, a 1 dimensional tensor is a single row
+func rows(t *tensor) (int, int) {
+	if len(t.shape) == 0 {
+		return 1, 1
+	}
+	columns := t.shape[len(t.shape)-1]
+	if columns == 0 {
+		return 0, 0
+	}
+	return len(t.data) / columns, columns
+}
+
+func identity(_ *node, inputs []*tensor) (*tensor, error) {
+	if err := requireInputs(inputs, 1); err != nil {
+		return nil, err
+	}
+	return inputs[0], nil
+}
+
+// cast truncates values cast to integer types, values cast to floating point types are unchanged
+func cast(n *node, inputs []*tensor) (*tensor, error) {
+	if err := requireInputs(inputs, 1); err != nil {
+		return nil, err
+	}
+	switch n.attrInt("to", tensorFloat) {
+	case tensorInt32, tensorInt64:
+		return mapValues(inputs[0], math.Trunc), nil
+	}
+	return inputs[0], nil
+}
+
+func reshape(_ *node, inputs []*tensor) (*tensor, error) {
+	if err := requireInputs(inputs, 2); err != nil {
+		return nil, err
+	}
+	input := inputs[0]
+	shape := make([]int, len(inputs[1].data))
+	inferred := -1
+	known := 1
+	for i, value := range inputs[1].data {
+		dim := int(value)
+		switch {
+		case dim == 0 && i < len(input.shape):
+			dim = input.shape[i]
+		case dim == -1:
+			inferred = i
+			continue
+		}
+		shape[i] = dim
+		known *= dim
+	}
+	if inferred >= 0 {
+		if known == 0 || len(input.data)%known != 0 {
+			return nil, fmt.Errorf("cannot reshape %v to %v", input.shape, inputs[1].data)
+		}
+		shape[inferred] = len(input.data) / known
+	}
+	if size(shape) != len(input.data) {
+		return nil, fmt.Errorf("cannot reshape %v to %v", input.shape, shape)
+	}
+	return &tensor{shape: shape, data: input.data}, nil
+}
+
+func flatten(n *node, inputs []*tensor) (*tensor, error) {
+	if err := requireInputs(inputs, 1); err != nil {
+		return nil, err
+	}
+	input := inputs[0]
+	axis := int(n.attrInt("axis", 1))
+	if axis < 0 {
+		axis += len(input.shape)
+	}
+	if axis < 0 || axis > len(input.shape) {
+		return nil, fmt.Errorf("axis %d out of range for shape %v", axis, input.shape)
+	}
+	return &tensor{shape: []int{size(input.shape[:axis]), size(input.shape[axis:])}, data: input.data}, nil
+}
+
+// gemm computes alpha * A' * B' + beta * C where A' and B' are optionally transposed
+func gemm(n *node, inputs []*tensor) (*tensor, error) {
+	if err := requireInputs(inputs, 2); err != nil {
+		return nil, err
+	}
+	a, b := inputs[0], inputs[1]
+	if len(a.shape) != 2 || len(b.shape) != 2 {
+		return nil, fmt.Errorf("expected 2 dimensional inputs, found %v and %v", a.shape, b.shape)
+	}
+	transA, transB := n.attrInt("transA", 0) != 0, n.attrInt("transB", 0) != 0
+	alpha, beta := n.attrFloat("alpha", 1), n.attrFloat("beta", 1)
+	m, k := a.shape[0], a.shape[1]
+	if transA {
+		m, k = k, m
+	}
+	kb, columns := b.shape[0], b.shape[1]
+	if transB {
+		kb, columns = columns, kb
+	}
+	if k != kb {
+		return nil, fmt.Errorf("cannot multiply %v by %v", a.shape, b.shape)
+	}
+	result := &tensor{shape: []int{m, columns}, data: make([]float64, m*columns)}
+	for i := 0; i < m; i++ {
+		for j := 0; j < columns; j++ {
+			sum := 0.0
+			for x := 0; x < k; x++ {
+				aIndex, bIndex := i*a.shape[1]+x, x*b.shape[1]+j
+				if transA {
+					aIndex = x*a.shape[1] + i
+				}
+				if transB {
+					bIndex = j*b.shape[1] + x
+				}
+				sum += a.data[aIndex] * b.data[bIndex]
+			}
+			result.data[i*columns+j] = alpha * sum
+		}
+	}
+	if len(inputs) < 3 || inputs[2] == nil {
+		return result, nil
+	}
+	return broadcast(result, mapValues(inputs[2], func(c float64) float64 { return beta * c }),
+		func(a, b float64) float64 { return a + b })
+}
+
+// matMul multiplies 2 dimensional matrices, or a matrix by a vector
+func matMul(_ *node, inputs []*tensor) (*tensor, error) {
+	if err := requireInputs(inputs, 2); err != nil {
+		return nil, err
+	}
+	a, b := inputs[0], inputs[1]
+	m, k := rows(a)
+	kb, columns := 1, 1
+	switch len(b.shape) {
+	case 1:
+		kb = b.shape[0]
+	case 2:
+		kb, columns = b.shape[0], b.shape[1]
+	default:
+		return nil, fmt.Errorf("unsupported shape %v", b.shape)
+	}
+	if k != kb {
+		return nil, fmt.Errorf("cannot multiply %v by %v", a.shape, b.shape)
+	}
+	shape := append(append([]int{}, a.shape[:len(a.shape)-1]...), columns)
+	if len(b.shape) == 1 {
+		shape = shape[:len(shape)-1]
+	}
+	result := &tensor{shape: shape, data: make([]float64, m*columns)}
+	for i := 0; i < m; i++ {
+		for j := 0; j < columns; j++ {
+			sum := 0.0
+			for x := 0; x < k; x++ {
+				sum += a.data[i*k+x] * b.data[x*columns+j]
+			}
+			result.data[i*columns+j] = sum
+		}
+	}
+	return result, nil
+}
+
+// elementwise builds an operator applying f to its two inputs broadcast together
+func elementwise(f func(a, b float64) float64) operator {
+	return func(_ *node, inputs []*tensor) (*tensor, error) {
+		if err := requireInputs(inputs, 2); err != nil {
+			return nil, err
+		}
+		return broadcast(inputs[0], inputs[1], f)
+	}
+}
+
+// unary builds an operator applying f to each value of its input
+func unary(f func(x float64) float64) operator {
+	return func(_ *node, inputs []*tensor) (*tensor, error) {
+		if err := requireInputs(inputs, 1); err != nil {
+			return nil, err
+		}
+		return mapValues(inputs[0], f), nil
+	}
+}
+
+// mapValues returns a tensor with the shape of t and f applied to each of its values
+func mapValues(t *tensor, f func(x float64) float64) *tensor {
+	result := &tensor{shape: t.shape, data: make([]float64, len(t.data))}
+	for i, x := range t.data {
+		result.data[i] = f(x)
+	}
+	return result
+}
+
+// broadcast applies f to a and b with numpy style broadcasting
+func broadcast(a, b *tensor, f func(a, b float64) float64) (*tensor, error) {
+	rank := len(a.shape)
+	if len(b.shape) > rank {
+		rank = len(b.shape)
+	}
+	aShape, bShape := padShape(a.shape, rank), padShape(b.shape, rank)
+	shape := make([]int, rank)
+	for i := range shape {
+		switch {
+		case aShape[i] == bShape[i] || bShape[i] == 1:
+			shape[i] = aShape[i]
+		case aShape[i] == 1:
+			shape[i] = bShape[i]
+		default:
+			return nil, fmt.Errorf("cannot broadcast %v with %v", a.shape, b.shape)
+		}
+	}
+	result := &tensor{shape: shape, data: make([]float64, size(shape))}
+	index := make([]int, rank)
+	for i := range result.data {
+		result.data[i] = f(a.data[broadcastOffset(index, aShape)], b.data[broadcastOffset(index, bShape)])
+		for d := rank - 1; d >= 0; d-- {
+			index[d]++
+			if index[d] < shape[d] {
+				break
+			}
+			index[d] = 0
+		}
+	}
+	return result, nil
+}
+
+// padShape prepends dimensions of 1 to shape until it has rank dimensions
+func padShape(shape []int, rank int) []int {
+	padded := make([]int, rank-len(shape), rank)
+	for i := range padded {
+		padded[i] = 1
+	}
+	return append(padded, shape...)
+}
+
+// broadcastOffset returns the offset of index in a tensor of shape, dimensions of 1 are repeated
+func broadcastOffset(index []int, shape []int) int {
+	offset := 0
+	for d, dim := range shape {
+		offset *= dim
+		if dim > 1 {
+			offset += index[d]
+		}
+	}
+	return offset
+}
+
+// scaler computes (x - offset) * scale for each column of its input
+func scaler(n *node, inputs []*tensor) (*tensor, error) {
+	if err := requireInputs(inputs, 1); err != nil {
+		return nil, err
+	}
+	input := inputs[0]
+	_, columns := rows(input)
+	offset, scale := n.attrFloats("offset"), n.attrFloats("scale")
+	result := &tensor{shape: input.shape, data: make([]float64, len(input.data))}
+	for i, x := range input.data {
+		column := i % columns
+		if len(offset) > 0 {
+			x -= offset[column%len(offset)]
+		}
+		if len(scale) > 0 {
+			x *= scale[column%len(scale)]
+		}
+		result.data[i] = x
+	}
+	return result, nil
+}
+
+// linearRegressor computes the dot product of each row of its input with the coefficients of each target plus the
+// target's intercept
+func linearRegressor(n *node, inputs []*tensor) (*tensor, error) {
+	if err := requireInputs(inputs, 1); err != nil {
+		return nil, err
+	}
+	if err := checkPostTransform(n); err != nil {
+		return nil, err
+	}
+	input := inputs[0]
+	count, columns := rows(input)
+	targets := int(n.attrInt("targets", 1))
+	coefficients, intercepts := n.attrFloats("coefficients"), n.attrFloats("intercepts")
+	if len(coefficients) != targets*columns {
+		return nil, fmt.Errorf("%d coefficients for %d targets of %d features", len(coefficients), targets,
+			columns)
+	}
+	result := &tensor{shape: []int{count, targets}, data: make([]float64, count*targets)}
+	for r := 0; r < count; r++ {
+		for t := 0; t < targets; t++ {
+			sum := 0.0
+			if t < len(intercepts) {
+				sum = intercepts[t]
+			}
+			for c := 0; c < columns; c++ {
+				sum += input.data[r*columns+c] * coefficients[t*columns+c]
+			}
+			result.data[r*targets+t] = sum
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,201 @@
+package onnx
+
+import (
+	"fmt"
+	"math"
+)
+
+// treeNodeKey identifies a node in a tree ensemble
+type treeNodeKey struct {
+	tree int64
+	node int64
+}
+
+// treeWeight is a leaf's contribution to a target
+type treeWeight struct {
+	target int
+	weight float64
+}
+
+// treeEnsemble holds the nodes of a TreeEnsembleRegressor indexed by tree and node id
+type treeEnsemble struct {
+	roots      []int
+	index      map[treeNodeKey]int
+	nodeIds    []int64
+	features   []int64
+	values     []float64
+	modes      []string
+	trueNodes  []int64
+	falseNodes []int64
+	treeIds    []int64
+	missing    []int64
+	weights    map[treeNodeKey][]treeWeight
+}
+
+// makeTreeEnsemble reads the tree attributes of a TreeEnsembleRegressor node, the first node listed for each tree is
+// its root
+func makeTreeEnsemble(n *node) (*treeEnsemble, error) {
+	e := treeEnsemble{
+		index:      make(map[treeNodeKey]int),
+		features:   n.attrInts("nodes_featureids"),
+		values:     n.attrFloats("nodes_values"),
+		modes:      n.attributes["nodes_modes"].stringsOrNil(),
+		trueNodes:  n.attrInts("nodes_truenodeids"),
+		falseNodes: n.attrInts("nodes_falsenodeids"),
+		treeIds:    n.attrInts("nodes_treeids"),
+		missing:    n.attrInts("nodes_missing_value_tracks_true"),
+		weights:    make(map[treeNodeKey][]treeWeight),
+	}
+	e.nodeIds = n.attrInts("nodes_nodeids")
+	count := len(e.nodeIds)
+	if len(e.treeIds) != count || len(e.features) != count || len(e.values) != count || len(e.modes) != count ||
+		len(e.trueNodes) != count || len(e.falseNodes) != count {
+		return nil, fmt.Errorf("tree node attributes have different lengths")
+	}
+	for i, nodeId := range e.nodeIds {
+		key := treeNodeKey{tree: e.treeIds[i], node: nodeId}
+		if _, present := e.index[key]; present {
+			return nil, fmt.Errorf("duplicate node %d in tree %d", nodeId, e.treeIds[i])
+		}
+		if i == 0 || e.treeIds[i] != e.treeIds[e.roots[len(e.roots)-1]] {
+			e.roots = append(e.roots, i)
+		}
+		e.index[key] = i
+	}
+	targetTrees, targetNodes := n.attrInts("target_treeids"), n.attrInts("target_nodeids")
+	targetIds, targetWeights := n.attrInts("target_ids"), n.attrFloats("target_weights")
+	if len(targetNodes) != len(targetTrees) || len(targetIds) != len(targetTrees) ||
+		len(targetWeights) != len(targetTrees) {
+		return nil, fmt.Errorf("target attributes have different lengths")
+	}
+	for i := range targetTrees {
+		key := treeNodeKey{tree: targetTrees[i], node: targetNodes[i]}
+		e.weights[key] = append(e.weights[key], treeWeight{target: int(targetIds[i]), weight: targetWeights[i]})
+	}
+	return &e, nil
+}
+
+// stringsOrNil returns the strings of a, or nil if a is not present
+func (a *attribute) stringsOrNil() []string {
+	if a == nil {
+		return nil
+	}
+	return a.strings
+}
+
+// leaf follows the tree starting at root for row, returning the key of the leaf reached
+func (e *treeEnsemble) leaf(root int, row []float64) (treeNodeKey, error) {
+	i := root
+	for steps := 0; steps <= len(e.modes); steps++ {
+		if e.modes[i] == "LEAF" {
+			return treeNodeKey{tree: e.treeIds[i], node: e.nodeIds[i]}, nil
+		}
+		feature := int(e.features[i])
+		if feature < 0 || feature >= len(row) {
+			return treeNodeKey{}, fmt.Errorf("feature %d out of range of %d features", feature, len(row))
+		}
+		next := e.falseNodes[i]
+		if e.branch(i, row[feature]) {
+			next = e.trueNodes[i]
+		}
+		index, present := e.index[treeNodeKey{tree: e.treeIds[i], node: next}]
+		if !present {
+			return treeNodeKey{}, fmt.Errorf("node %d of tree %d not found", next, e.treeIds[i])
+		}
+		i = index
+	}
+	return treeNodeKey{}, fmt.Errorf("tree %d does not reach a leaf", e.treeIds[root])
+}
+
+// branch returns true if x takes the true branch of node i. Features are compared at the float32 precision of the
+// thresholds
+func (e *treeEnsemble) branch(i int, x float64) bool {
+	if math.IsNaN(x) {
+		return i < len(e.missing) && e.missing[i] != 0
+	}
+	value, threshold := float64(float32(x)), e.values[i]
+	switch e.modes[i] {
+	case "BRANCH_LEQ":
+		return value <= threshold
+	case "BRANCH_LT":
+		return value < threshold
+	case "BRANCH_GTE":
+		return value >= threshold
+	case "BRANCH_GT":
+		return value > threshold
+	case "BRANCH_EQ":
+		return value == threshold
+	case "BRANCH_NEQ":
+		return value != threshold
+	}
+	return false
+}
+
+// treeEnsembleRegressor sums, averages or takes the minimum or maximum of the leaf weights each row reaches in every
+// tree, added to base_values
+func treeEnsembleRegressor(n *node, inputs []*tensor) (*tensor, error) {
+	if err := requireInputs(inputs, 1); err != nil {
+		return nil, err
+	}
+	if err := checkPostTransform(n); err != nil {
+		return nil, err
+	}
+	e := n.ensemble
+	input := inputs[0]
+	count, columns := rows(input)
+	targets := int(n.attrInt("n_targets", 1))
+	aggregate := n.attrString("aggregate_function", "SUM")
+	baseValues := n.attrFloats("base_values")
+	result := &tensor{shape: []int{count, targets}, data: make([]float64, count*targets)}
+	for r := 0; r < count; r++ {
+		row := input.data[r*columns : (r+1)*columns]
+		scores := make([]float64, targets)
+		found := make([]bool, targets)
+		for _, root := range e.roots {
+			key, err := e.leaf(root, row)
+			if err != nil {
+				return nil, err
+			}
+			for _, w := range e.weights[key] {
+				if w.target < 0 || w.target >= targets {
+					return nil, fmt.Errorf("target %d out of range of %d targets", w.target, targets)
+				}
+				scores[w.target], err = aggregateScore(aggregate, scores[w.target], w.weight, found[w.target])
+				if err != nil {
+					return nil, err
+				}
+				found[w.target] = true
+			}
+		}
+		for t := 0; t < targets; t++ {
+			score := scores[t]
+			if aggregate == "AVERAGE" && len(e.roots) > 0 {
+				score /= float64(len(e.roots))
+			}
+			if t < len(baseValues) {
+				score += baseValues[t]
+			}
+			result.data[r*targets+t] = score
+		}
+	}
+	return result, nil
+}
+
+// aggregateScore combines weight with score according to aggregate, found is false for the first weight of a target
+func aggregateScore(aggregate string, score float64, weight float64, found bool) (float64, error) {
+	switch aggregate {
+	case "SUM", "AVERAGE":
+		return score + weight, nil
+	case "MIN":
+		if !found || weight < score {
+			return weight, nil
+		}
+		return score, nil
+	case "MAX":
+		if !found || weight > score {
+			return weight, nil
+		}
+		return score, nil
+	}
+	return 0, fmt.Errorf("unsupported aggregate_function %s", aggregate)
+}
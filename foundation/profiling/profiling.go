@@ -0,0 +1,18 @@
+// Package profiling provides the net/http/pprof endpoints for long-running apps that opt into profiling
+package profiling
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// Register adds the net/http/pprof endpoints under /debug/pprof/ to mux.
+// /debug/pprof/profile captures a CPU profile and /debug/pprof/trace an execution trace, which shows the runtime/trace
+// regions apps mark around the steps they want timed
+func Register(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
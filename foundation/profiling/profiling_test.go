@@ -0,0 +1,48 @@
+package profiling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	mux := http.NewServeMux()
+	Register(mux)
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{
+			name:       "index",
+			path:       "/debug/pprof/",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "named profile",
+			path:       "/debug/pprof/goroutine?debug=1",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "execution trace",
+			path:       "/debug/pprof/trace?seconds=0.01",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "unknown profile",
+			path:       "/debug/pprof/missing",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("GET %s status = %d, want %d", tt.path, recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,696 @@
+package predictor
+
+import (
+	"context"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
+	"github.com/OpenTransitTools/transitcast/foundation/clock"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
+	"github.com/jmoiron/sqlx"
+	"github.com/nats-io/nats.go"
+	logger "log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// tripCompactorSize bounds the shapes and ids shared between the trips the aggregator predicts
+const tripCompactorSize = 10000
+
+// Conf contains all configurable parameters in aggregator
+type Conf struct {
+	ExpirePredictionSeconds               int
+	MaximumObservedTransitionAgeInSeconds int
+	MinimumRMSEModelImprovement           float64
+	MinimumObservedStopCount              int
+	PredictionSubject                     string
+	ExpirePredictorSeconds                int
+	LimitEarlyDepartureSeconds            int
+	InferenceBuckets                      int
+	IncludedRouteIds                      []string
+	MaximumPredictionMinutes              int
+	MakePredictions                       bool
+	UseStatistics                         bool
+	TimepointOnlyRouteIds                 []string
+	QueryTimeoutSeconds                   int
+	ShadowEvaluation                      bool
+	//ServiceExceptionFeatures adds calendar service exception flags following the holiday inference feature,
+	//only enable with models trained with these features
+	ServiceExceptionFeatures bool
+	//TimeBucketFeature adds the sequence of the time bucket recorded by model-mgr discover containing each request's
+	//time following the service exception features, only enable with models trained with this feature
+	TimeBucketFeature bool
+	//PatternModels predicts with the models of each trip's stop pattern in the time bucket of each segment, recorded
+	//by model-mgr discover with PatternModels, when they are trained. Other segments use the models of their stops
+	PatternModels bool
+	//CoalesceInferenceRequests holds the predictions made for a trip while an earlier prediction for it awaits
+	//inference, sending only the newest once the earlier one completes or expires
+	CoalesceInferenceRequests bool
+	//InferenceTimeoutFallback publishes the predictions still awaiting inference responses after
+	//ExpirePredictionSeconds, completing the stops without responses with their scheduled travel times
+	InferenceTimeoutFallback bool
+	//InferenceGuardrailFactor rejects inference responses predicting a segment will take more than this many times, or
+	//less than one this many times, its scheduled travel time, using the schedule in their place. Zero accepts every
+	//response
+	InferenceGuardrailFactor float64
+	//ModelHealthWindow is the number of each model's most recent predictions compared with the travel times observed
+	//afterwards to track its rolling error, zero disables model health tracking
+	ModelHealthWindow int
+	//ModelHealthMinimumSamples is the number of compared predictions a model needs before it can be disabled
+	ModelHealthMinimumSamples int
+	//ModelHealthErrorRatio disables a model, predicting its segments with the schedule, when its rolling mean absolute
+	//error exceeds the schedule's by this factor
+	ModelHealthErrorRatio float64
+	//App and Version identify the app recording system events, such as the models disabled by model health tracking
+	App     string
+	Version string
+	//InferenceTransport is InferenceTransportNats, InferenceTransportSidecar or InferenceTransportInProcess
+	InferenceTransport string
+	SidecarInference   SidecarInferenceConf
+	//InProcessInference locates ONNX models run inside the aggregator and which models are run in process
+	InProcessInference InProcessInferenceConf
+	//WeatherEnrichment adds current weather conditions to inference requests when its URL is set
+	WeatherEnrichment WeatherEnrichmentConf
+	//RecentObservationCount is the number of recent ObservedStopTimes averaged for each pair of stops to predict
+	//segments without model statistics, zero falls back directly to the schedule
+	RecentObservationCount int
+	//MinimumObservationConfidence is the least confidence of ObservedStopTimes used in features and recent travel
+	//times, zero uses every ObservedStopTime
+	MinimumObservationConfidence float64
+	//PredictionSourceStatsSubject is the NATS subject PredictionSourceSummary is published on
+	PredictionSourceStatsSubject string
+	//PredictionSourceStatsSeconds is the period each PredictionSourceSummary covers
+	PredictionSourceStatsSeconds int
+	//BackfillMinutes is how far back ObservedStopTimes and vehicle trips are loaded on startup, zero disables backfill
+	BackfillMinutes int
+	//DebugMux when not nil has the /debug/state endpoint registered on it
+	DebugMux *http.ServeMux
+	//RouteSilenceMinutes is how long a route in scheduled service can go without a published TripUpdate before
+	//a RouteSilenceAlert is published, zero disables the route silence watchdog
+	RouteSilenceMinutes int
+	//RouteSilenceSubject is the NATS subject RouteSilenceAlerts are published on
+	RouteSilenceSubject string
+	//ConsumerLagAlertSeconds is how long after a vehicle's position was recorded its vehicle-monitor-results can be
+	//processed before a ConsumerLagAlert is published, zero disables the alerts
+	ConsumerLagAlertSeconds int
+	//ConsumerLagSubject is the NATS subject ConsumerLagAlerts are published on
+	ConsumerLagSubject string
+	//DeviationHistoryMinutes is how much of each vehicle's TripDeviation history is kept in memory
+	DeviationHistoryMinutes int
+	//ShedVehicleResults keeps only the newest vehicle-monitor-results received for a vehicle while its earlier results
+	//are being processed
+	ShedVehicleResults bool
+	//MinimumLayoverSeconds is the least time a vehicle is predicted to wait at the start of a trip after arriving
+	//from the previous trip on its block
+	MinimumLayoverSeconds int
+	//RouteMinimumLayoverSeconds overrides MinimumLayoverSeconds for routes, as route_id:seconds
+	RouteMinimumLayoverSeconds []string
+	//RouteExpirePredictorSeconds overrides ExpirePredictorSeconds, how long trip predictors are kept after the end of
+	//their trip, for routes as route_id:seconds
+	RouteExpirePredictorSeconds []string
+	//RouteTypeExpirePredictorSeconds overrides ExpirePredictorSeconds for trips by GTFS route_type, as
+	//route_type:seconds. RouteExpirePredictorSeconds takes precedence
+	RouteTypeExpirePredictorSeconds []string
+	//RouteTypeLimitEarlyDepartureSeconds overrides LimitEarlyDepartureSeconds for trips by GTFS route_type, as
+	//route_type:seconds
+	RouteTypeLimitEarlyDepartureSeconds []string
+	//RouteLimitEarlyDepartureSeconds overrides LimitEarlyDepartureSeconds for routes as route_id:seconds, taking
+	//precedence over RouteTypeLimitEarlyDepartureSeconds
+	RouteLimitEarlyDepartureSeconds []string
+	//NonTimepointEarlyDeparture is NonTimepointEarlyDepartureAllow, NonTimepointEarlyDepartureSchedule or
+	//NonTimepointEarlyDepartureLimit, how early vehicles are predicted to depart stops that aren't timepoints.
+	//Empty allows early departures
+	NonTimepointEarlyDeparture string
+	//NonTimepointEarlyDepartureSeconds is how early vehicles may depart stops that aren't timepoints under
+	//NonTimepointEarlyDepartureLimit
+	NonTimepointEarlyDepartureSeconds int
+	//RouteNonTimepointEarlyDeparture overrides NonTimepointEarlyDeparture for routes as route_id:policy
+	RouteNonTimepointEarlyDeparture []string
+	//PredictDwell predicts vehicles depart stops with an average dwell computed by model-mgr tuneDwell that long after
+	//their predicted arrival, rather than treating the dwell as part of the travel to the next stop
+	PredictDwell bool
+	//MinimumDwellSeconds is the least average dwell a stop needs for its departures to be predicted with PredictDwell
+	MinimumDwellSeconds int
+	//PublishChangeThresholdSeconds when above zero only publishes a TripUpdate when it changes a stop's prediction by
+	//more than this many seconds from the last TripUpdate published for the trip, or PublishHeartbeatSeconds after it
+	PublishChangeThresholdSeconds int
+	//PublishHeartbeatSeconds is the longest an unchanged trip goes without a TripUpdate published when
+	//PublishChangeThresholdSeconds is set
+	PublishHeartbeatSeconds int
+	//DelaySmoothingFactor is the weight given to a trip's newest delay when smoothing it with the delay last
+	//published for the trip, one publishes the newest delay unchanged
+	DelaySmoothingFactor float64
+	//DelayHysteresisSeconds ignores changes to a trip's delay of no more than this many seconds
+	DelayHysteresisSeconds int
+	//RouteDelaySmoothing overrides DelaySmoothingFactor and DelayHysteresisSeconds for routes, as
+	//route_id:factor:seconds
+	RouteDelaySmoothing []string
+	//NATSCompression compresses published TripUpdates, natsclient.CompressionNone, natsclient.CompressionGzip or
+	//natsclient.CompressionSnappy
+	NATSCompression string
+	//NATSEncoding encodes published TripUpdates and inference requests, natsclient.EncodingJSON or
+	//natsclient.EncodingProtobuf
+	NATSEncoding string
+	//NATSTenant prefixes every subject published and subscribed to with "<tenant>." so several agencies' pipelines
+	//share NATS servers, empty leaves subjects unprefixed
+	NATSTenant string
+	//PredictionSubjectRules publish TripUpdates on routes matching a rule on another subject than PredictionSubject, as
+	//route_id:<route_id>=<subject> or route_type:<route_type>=<subject>
+	PredictionSubjectRules []string
+	//TripOverrideSubject is the NATS subject dispatchers publish TripOverrides on, empty disables trip overrides
+	TripOverrideSubject string
+	//TripOverrideExpirationMinutes is how long a trip cancellation without an expiration is applied
+	TripOverrideExpirationMinutes int
+	//ConnectionLookaheadMinutes is how far ahead feeder trips' predicted arrivals are checked for connections at risk,
+	//zero disables connection protection
+	ConnectionLookaheadMinutes int
+	//ConnectionMaximumWaitMinutes is how long after a feeder trip's scheduled arrival a departure is a connection
+	ConnectionMaximumWaitMinutes int
+	//ConnectionMinimumTransferSeconds is the time needed to transfer when transfers.txt gives no min_transfer_time
+	ConnectionMinimumTransferSeconds int
+	//ConnectionMarginSeconds is the least slack a connection can have before a ConnectionAtRiskAlert is published
+	ConnectionMarginSeconds int
+	//ConnectionSameStopTransfers treats departures of other routes from the stop a feeder trip arrives at as
+	//connections in addition to those in transfers.txt
+	ConnectionSameStopTransfers bool
+	//ConnectionSubject is the NATS subject ConnectionAtRiskAlerts are published on
+	ConnectionSubject string
+	//Clock is the time predictions are made, expired and published at, nil uses the system time
+	Clock clock.Clock
+}
+
+// StartPredictionAggregator starts all routines for aggregation of predicted trips
+// shuts down all routines after receiving on shutdownSignal
+func StartPredictionAggregator(log *logger.Logger,
+	db *sqlx.DB,
+	shutdownSignal chan os.Signal,
+	natsConn *nats.Conn,
+	conf Conf) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-shutdownSignal:
+			log.Printf("Exiting on shutdown signal, shutting down subroutines")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return Run(ctx, log, db, natsConn, conf)
+}
+
+// Run starts all routines for aggregation of predicted trips, listening to the vehicle-monitor-results published on
+// natsConn and publishing predicted TripUpdates, and blocks until ctx is done, then shuts down all routines before
+// returning. Services embedding the predictor call Run in place of StartPredictionAggregator so the pipeline can be
+// stopped along with the rest of the process
+func Run(ctx context.Context,
+	log *logger.Logger,
+	db *sqlx.DB,
+	natsConn *nats.Conn,
+	conf Conf) error {
+
+	//create shared objects
+	clk := clock.OrSystem(conf.Clock)
+
+	log.Println("Creating shared aggregator structures")
+	log.Println("Creating pendingPredictionsCollection")
+	pendingPredictions := makePendingPredictionsCollection(conf.ExpirePredictionSeconds,
+		conf.CoalesceInferenceRequests)
+	log.Println("Creating ObservedStopTransitions")
+	osts := makeObservedStopTransitions(conf.MaximumObservedTransitionAgeInSeconds, conf.RecentObservationCount,
+		conf.MinimumObservationConfidence)
+	log.Println("Creating predictionPublisher")
+	natsCodec, err := natsclient.NewCodec(conf.NATSCompression, conf.NATSEncoding)
+	if err != nil {
+		return err
+	}
+	natsSubjects, err := natsclient.NewSubjects(conf.NATSTenant)
+	if err != nil {
+		return err
+	}
+	predictionDestination := natsPredictionPublicationDestination{
+		natsConn: natsConn,
+		codec:    natsCodec,
+		subjects: natsSubjects,
+	}
+	subjects, err := makePredictionSubjectRouter(conf.PredictionSubject, conf.PredictionSubjectRules)
+	if err != nil {
+		return err
+	}
+	sourceTally := makePredictionSourceTally(clk.Now())
+	var routeActivity *routeActivityTracker
+	if conf.RouteSilenceMinutes > 0 {
+		routeActivity = makeRouteActivityTracker(clk.Now())
+	}
+	layovers, err := makeLayoverPolicy(conf.MinimumLayoverSeconds, conf.RouteMinimumLayoverSeconds)
+	if err != nil {
+		return err
+	}
+	earlyDepartures, err := makeEarlyDepartureLimits(conf.LimitEarlyDepartureSeconds,
+		conf.RouteTypeLimitEarlyDepartureSeconds, conf.RouteLimitEarlyDepartureSeconds, conf.NonTimepointEarlyDeparture,
+		conf.NonTimepointEarlyDepartureSeconds, conf.RouteNonTimepointEarlyDeparture)
+	if err != nil {
+		return err
+	}
+	var dwells *stopDwells
+	if conf.PredictDwell {
+		dwells = makeStopDwells(conf.MinimumDwellSeconds)
+	}
+	deltas := makeTripUpdateDeltaFilter(conf.PublishChangeThresholdSeconds, conf.PublishHeartbeatSeconds)
+	smoother, err := makeDelaySmoother(log, conf.DelaySmoothingFactor, conf.DelayHysteresisSeconds,
+		conf.RouteDelaySmoothing)
+	if err != nil {
+		return err
+	}
+	var overrides *tripOverrides
+	if conf.TripOverrideSubject != "" {
+		overrides = makeTripOverrides(time.Duration(conf.TripOverrideExpirationMinutes) * time.Minute)
+	}
+	var connections *connectionTracker
+	if conf.ConnectionLookaheadMinutes > 0 {
+		connections = makeConnectionTracker(connectionPolicy{
+			lookahead:         time.Duration(conf.ConnectionLookaheadMinutes) * time.Minute,
+			maximumWait:       time.Duration(conf.ConnectionMaximumWaitMinutes) * time.Minute,
+			minimumTransfer:   time.Duration(conf.ConnectionMinimumTransferSeconds) * time.Second,
+			margin:            time.Duration(conf.ConnectionMarginSeconds) * time.Second,
+			sameStopTransfers: conf.ConnectionSameStopTransfers,
+		})
+	}
+	publisher := makePredictionPublisher(log, &predictionDestination, subjects, earlyDepartures, dwells, deltas,
+		smoother, sourceTally, routeActivity, layovers, overrides, connections, clk)
+	queryTimeout := time.Duration(conf.QueryTimeoutSeconds) * time.Second
+	var evaluator *shadowEvaluator
+	if conf.ShadowEvaluation {
+		log.Println("Creating shadowEvaluator")
+		evaluator = makeShadowEvaluator(&dbShadowComparisonDestination{db: db, queryTimeout: queryTimeout})
+	}
+	// ctx is cancelled on shutdown to abandon database queries made while preparing predictions
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var weatherEnricher *weatherFeatureEnricher
+	var enricher featureEnricher
+	if conf.WeatherEnrichment.URL != "" {
+		log.Println("Creating weatherFeatureEnricher")
+		weatherEnricher, err = makeWeatherFeatureEnricher(conf.WeatherEnrichment)
+		if err != nil {
+			return err
+		}
+		err = weatherEnricher.refresh(ctx)
+		if err != nil {
+			log.Printf("Unable to retrieve weather conditions, continuing until next refresh: %v", err)
+		}
+		enricher = weatherEnricher
+	}
+	eviction, err := makePredictorEvictionPolicy(conf.ExpirePredictorSeconds, conf.RouteExpirePredictorSeconds,
+		conf.RouteTypeExpirePredictorSeconds)
+	if err != nil {
+		return err
+	}
+	log.Println("Creating tripPredictorsCollection")
+	predictorsCollection, err := makeTripPredictorsCollection(&dbTripPredictorsDataProvider{
+		db:           db,
+		queryTimeout: queryTimeout,
+		compactor:    gtfs.NewTripCompactor(tripCompactorSize),
+	},
+		osts,
+		conf.MinimumRMSEModelImprovement,
+		conf.MinimumObservedStopCount,
+		eviction,
+		conf.MaximumPredictionMinutes,
+		conf.MakePredictions,
+		conf.UseStatistics,
+		conf.TimepointOnlyRouteIds,
+		conf.ShadowEvaluation,
+		conf.ServiceExceptionFeatures,
+		enricher)
+	log.Println("Done creating shared aggregator structures")
+
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Creating %s inferenceRequester", conf.InferenceTransport)
+	guardrail, err := makeInferenceGuardrail(conf.InferenceGuardrailFactor)
+	if err != nil {
+		return err
+	}
+	var health *modelHealthTracker
+	if conf.ModelHealthWindow > 0 {
+		log.Println("Creating modelHealthTracker")
+		health, err = makeModelHealthTracker(modelHealthPolicy{
+			window:         conf.ModelHealthWindow,
+			minimumSamples: conf.ModelHealthMinimumSamples,
+			errorRatio:     conf.ModelHealthErrorRatio,
+		})
+		if err != nil {
+			return err
+		}
+		predictorsCollection.predictorFactory.health = health
+	}
+	if conf.TimeBucketFeature || conf.PatternModels {
+		timeBuckets, err := loadTimeBuckets(ctx, db, queryTimeout)
+		if err != nil {
+			return err
+		}
+		if conf.TimeBucketFeature {
+			log.Printf("Including time bucket feature with %d time buckets", len(timeBuckets))
+		}
+		if conf.PatternModels {
+			log.Printf("Preferring stop pattern models in %d time buckets", len(timeBuckets))
+		}
+		predictorsCollection.predictorFactory.timeBucketFeature = conf.TimeBucketFeature
+		predictorsCollection.predictorFactory.patternModels = conf.PatternModels
+		predictorsCollection.predictorFactory.timeBuckets = timeBuckets
+	}
+	resultHandler := makeInferenceResultHandler(log, pendingPredictions, publisher, evaluator, guardrail, clk)
+	resultHandler.health = health
+	requester, err := makeInferenceRequester(log, natsConn, natsCodec, natsSubjects, conf, resultHandler)
+	if err != nil {
+		return err
+	}
+	resultHandler.requester = requester
+	defer closeInferenceRequester(requester)
+
+	if conf.BackfillMinutes > 0 {
+		log.Printf("Backfilling the last %d minutes of vehicle history", conf.BackfillMinutes)
+		err = backfillRecentHistory(ctx, log, &dbBackfillDataProvider{db: db, queryTimeout: queryTimeout}, osts,
+			predictorsCollection, clk.Now(), time.Duration(conf.BackfillMinutes)*time.Minute)
+		if err != nil {
+			log.Printf("Unable to backfill vehicle history, continuing without it: %v", err)
+		}
+	}
+
+	if inProcess, ok := requester.(*inProcessInferenceRequester); ok && conf.InProcessInference.WarmUpMinutes > 0 {
+		log.Printf("Warming up in process models for the next %d minutes", conf.InProcessInference.WarmUpMinutes)
+		err = warmUpInProcessModels(ctx, log, &dbScheduledTripsProvider{db: db, queryTimeout: queryTimeout},
+			predictorsCollection.predictorFactory, inProcess, clk.Now(),
+			time.Duration(conf.InProcessInference.WarmUpMinutes)*time.Minute)
+		if err != nil {
+			log.Printf("Unable to warm up in process models, loading them when first requested: %v", err)
+		}
+	}
+
+	vehicleDeviations := makeVehicleDeviationTracker(time.Duration(conf.DeviationHistoryMinutes) * time.Minute)
+	if conf.DebugMux != nil {
+		conf.DebugMux.Handle("/debug/state", &debugStateHandler{
+			log:                log,
+			predictors:         predictorsCollection,
+			pendingPredictions: pendingPredictions,
+			vehicleDeviations:  vehicleDeviations,
+			clock:              clk,
+		})
+	}
+
+	// start up background loop
+	wg := sync.WaitGroup{}
+	backgroundLoopShutdown := make(chan bool, 1)
+	ostSubscriptionShutdown := make(chan bool, 1)
+	tripUpdateSubscriberShutdown := make(chan bool, 1)
+	inferenceListenerShutdown := make(chan bool, 1)
+	sourceStatsShutdown := make(chan bool, 1)
+	routeSilenceShutdown := make(chan bool, 1)
+	weatherRefreshShutdown := make(chan bool, 1)
+	tripOverrideShutdown := make(chan bool, 1)
+	connectionMonitorShutdown := make(chan bool, 1)
+	stopDwellLoaderShutdown := make(chan bool, 1)
+	modelHealthShutdown := make(chan bool, 1)
+
+	var timeoutPublisher *predictionPublisher
+	if conf.InferenceTimeoutFallback {
+		timeoutPublisher = publisher
+	}
+	log.Println("Starting background loop")
+	go runBackgroundLoop(log, &wg, pendingPredictions, requester, timeoutPublisher, predictorsCollection,
+		vehicleDeviations,
+		time.Duration(conf.ExpirePredictorSeconds)*time.Second, evaluator, clk, backgroundLoopShutdown)
+	log.Println("Starting ObservedStopTransitionListener")
+	go startObservedStopTransitionListener(log, &wg, osts, health, natsConn,
+		natsSubjects.Subject("vehicle-monitor-results"), ostSubscriptionShutdown)
+	lagMonitor := &consumerLagMonitor{
+		tracker:   &consumerLagTracker{},
+		natsConn:  natsConn,
+		subject:   natsSubjects.Subject(conf.ConsumerLagSubject),
+		threshold: time.Duration(conf.ConsumerLagAlertSeconds) * time.Second,
+	}
+	log.Println("Starting TripUpdateListener")
+	go startTripUpdateListener(ctx, log, &wg, osts, natsConn, natsSubjects.Subject("vehicle-monitor-results"),
+		tripUpdateSubscriberShutdown, predictorsCollection, pendingPredictions, publisher, conf.IncludedRouteIds,
+		requester, conf.MaximumPredictionMinutes, vehicleDeviations, lagMonitor, conf.ShedVehicleResults, clk)
+	if conf.InferenceTransport == InferenceTransportNats {
+		log.Println("Starting InferenceListener")
+		go startInferenceResponseListener(log, &wg, natsConn, natsSubjects.Subject("inference-response"),
+			inferenceListenerShutdown, resultHandler)
+	}
+
+	log.Println("Starting PredictionSourceStatsPublisher")
+	go runPredictionSourceStatsPublisher(log, &wg, natsConn, natsSubjects.Subject(conf.PredictionSourceStatsSubject),
+		sourceTally, time.Duration(conf.PredictionSourceStatsSeconds)*time.Second, sourceStatsShutdown)
+
+	if routeActivity != nil {
+		log.Println("Starting RouteSilenceWatchdog")
+		go runRouteSilenceWatchdog(ctx, log, &wg, natsConn, natsSubjects.Subject(conf.RouteSilenceSubject),
+			&dbScheduledRoutesProvider{db: db, queryTimeout: queryTimeout}, routeActivity, conf.IncludedRouteIds,
+			time.Duration(conf.RouteSilenceMinutes)*time.Minute, routeSilenceCheckInterval, routeSilenceShutdown)
+	}
+
+	if overrides != nil {
+		log.Println("Starting TripOverrideListener")
+		go startTripOverrideListener(log, &wg, natsConn, natsSubjects.Subject(conf.TripOverrideSubject), overrides, clk,
+			tripOverrideShutdown)
+	}
+
+	if connections != nil {
+		log.Println("Starting ConnectionMonitor")
+		go runConnectionMonitor(ctx, log, &wg, natsConn, natsSubjects.Subject(conf.ConnectionSubject),
+			&dbConnectionDataProvider{db: db, queryTimeout: queryTimeout}, connections, connectionCheckInterval,
+			connectionMonitorShutdown)
+	}
+
+	if weatherEnricher != nil {
+		log.Println("Starting WeatherFeatureRefresh")
+		go runWeatherFeatureRefresh(ctx, log, &wg, weatherEnricher, weatherRefreshShutdown)
+	}
+
+	if health != nil {
+		log.Println("Starting ModelHealthMonitor")
+		go runModelHealthMonitor(log, &wg, health, &dbModelDisablementDestination{
+			db:           db,
+			app:          conf.App,
+			version:      conf.Version,
+			queryTimeout: queryTimeout,
+		}, clk.Now, modelHealthShutdown)
+	}
+
+	if dwells != nil {
+		log.Println("Starting StopDwellLoader")
+		go runStopDwellLoader(ctx, log, &wg, db, dwells, queryTimeout, stopDwellLoaderShutdown)
+	}
+
+	select {
+	case <-ctx.Done():
+		log.Printf("Shutting down aggregator subroutines")
+		backgroundLoopShutdown <- true
+		ostSubscriptionShutdown <- true
+		tripUpdateSubscriberShutdown <- true
+		inferenceListenerShutdown <- true
+		sourceStatsShutdown <- true
+		routeSilenceShutdown <- true
+		weatherRefreshShutdown <- true
+		tripOverrideShutdown <- true
+		connectionMonitorShutdown <- true
+		stopDwellLoaderShutdown <- true
+		modelHealthShutdown <- true
+		wg.Wait()
+		log.Printf("Subroutines shut down, exiting aggregator")
+
+	}
+	return nil
+}
+
+// makeInferenceRequester builds the inferenceRequester for conf.InferenceTransport, responses received by the sidecar
+// and in process transports are applied by handler. Requests sent over nats are encoded by natsCodec. When
+// conf.InProcessInference lists model names those models are run in process and the rest use conf.InferenceTransport
+func makeInferenceRequester(log *logger.Logger,
+	natsConn *nats.Conn,
+	natsCodec natsclient.Codec,
+	natsSubjects natsclient.Subjects,
+	conf Conf,
+	handler *inferenceResultHandler) (inferenceRequester, error) {
+	var requester inferenceRequester
+	switch conf.InferenceTransport {
+	case InferenceTransportNats:
+		requester = &natsInferenceRequester{
+			log:              log,
+			natsConn:         natsConn,
+			codec:            natsCodec,
+			subjects:         natsSubjects,
+			inferenceBuckets: conf.InferenceBuckets,
+			clock:            handler.clock,
+		}
+	case InferenceTransportSidecar:
+		if conf.SidecarInference.Address == "" {
+			return nil, fmt.Errorf("sidecar inference transport requires a sidecar inference address")
+		}
+		sidecar, err := makeSidecarInferenceRequester(log, conf.SidecarInference, handler)
+		if err != nil {
+			return nil, err
+		}
+		requester = sidecar
+	case InferenceTransportInProcess:
+	default:
+		return nil, fmt.Errorf("unknown inference transport %q", conf.InferenceTransport)
+	}
+	if requester != nil && len(conf.InProcessInference.ModelNames) == 0 {
+		return requester, nil
+	}
+	if conf.InProcessInference.ModelDirectory == "" {
+		return nil, fmt.Errorf("in process inference requires an onnx model directory")
+	}
+	return makeInProcessInferenceRequester(log, conf.InProcessInference, requester, handler), nil
+}
+
+// closeInferenceRequester closes the connections held by requester to a sidecar inference service
+func closeInferenceRequester(requester inferenceRequester) {
+	if inProcess, ok := requester.(*inProcessInferenceRequester); ok {
+		requester = inProcess.remote
+	}
+	if sidecar, ok := requester.(*sidecarInferenceRequester); ok {
+		sidecar.close()
+	}
+}
+
+// runBackgroundLoop frequently runs clean up on pendingPredictionsCollection, tripPredictorsCollection and
+// vehicleDeviationTracker, removing vehicles not heard from within vehicleExpiration, and records comparisons collected by shadowEvaluator.
+// Batches held behind expired batches are sent with requester. Expiry is measured at the time given by clk
+func runBackgroundLoop(log *logger.Logger,
+	wg *sync.WaitGroup,
+	pendingPredictions *pendingPredictionsCollection,
+	requester inferenceRequester,
+	timeoutPublisher *predictionPublisher,
+	tripPredictorsCollection *tripPredictorsCollection,
+	vehicleDeviations *vehicleDeviationTracker,
+	vehicleExpiration time.Duration,
+	shadowEvaluator *shadowEvaluator,
+	clk clock.Clock,
+	shutdownSignal chan bool) {
+	wg.Add(1)
+	defer wg.Done()
+
+	sleepChan := make(chan bool)
+
+	loopDuration := time.Duration(3) * time.Second
+	sleep := loopDuration
+
+	for {
+
+		go func() {
+			time.Sleep(sleep)
+			sleepChan <- true
+		}()
+
+		select {
+		case <-shutdownSignal:
+			log.Printf("Exiting background loop on shutdown signal")
+			recordShadowComparisons(log, shadowEvaluator)
+			return
+		case <-sleepChan:
+		}
+
+		// mark the time we start working
+		start := time.Now()
+		now := clk.Now()
+
+		expiredPredictions, releasedPredictions, pendingPredictionsAfterCleanup :=
+			pendingPredictions.removeExpiredPredictions(now)
+		for _, released := range releasedPredictions {
+			requester.sendInferenceRequests(released.allInferenceRequests())
+		}
+
+		completedPredictions, incompletePredictions := countExpiredPredictionCompletions(expiredPredictions)
+
+		timedOutBatches := 0
+		if timeoutPublisher != nil {
+			timedOutBatches = completeTimedOutPredictions(timeoutPublisher,
+				pendingPredictions.timedOutPredictionBatches(expiredPredictions))
+		}
+
+		log.Printf("PendingPredictions has %d. failed: %d, completed: %d, published on timeout: %d\n",
+			pendingPredictionsAfterCleanup, incompletePredictions, completedPredictions, timedOutBatches)
+
+		pendingAtStart, afterCleanup := tripPredictorsCollection.removeExpiredPredictors(now)
+
+		log.Printf("tripPredictorsCollection have %d removed %d\n", afterCleanup, pendingAtStart-afterCleanup)
+
+		vehicleDeviations.removeExpired(now, vehicleExpiration)
+
+		recordShadowComparisons(log, shadowEvaluator)
+
+		workTook := time.Now().Sub(start)
+
+		// if the work took longer than loopEverySeconds don't sleep at all on the next loop
+		if workTook >= loopDuration {
+			sleep = time.Duration(0)
+		} else {
+			sleep = loopDuration - workTook
+		}
+	}
+}
+
+// recordShadowComparisons flushes shadowEvaluator and logs the results
+func recordShadowComparisons(log *logger.Logger, shadowEvaluator *shadowEvaluator) {
+	recorded, meanDifference, err := shadowEvaluator.flush()
+	if err != nil {
+		log.Printf("error recording shadow model comparisons: %v\n", err)
+		return
+	}
+	if recorded > 0 {
+		log.Printf("Recorded %d shadow model comparisons, mean absolute difference %.1f seconds\n",
+			recorded, meanDifference)
+	}
+}
+
+// completeTimedOutPredictions completes the stopPredictions still awaiting inference responses in timedOutBatches with
+// their scheduled travel times and publishes the batches with publisher, returning the number of batches published
+func completeTimedOutPredictions(publisher *predictionPublisher, timedOutBatches []*predictionBatch) int {
+	for _, batch := range timedOutBatches {
+		completed := batch.completeWithScheduleFallback()
+		inferenceTimeoutMetrics.Add("batches", 1)
+		inferenceTimeoutMetrics.Add("stop_predictions", int64(completed))
+		publisher.publishPredictionBatch(batch)
+	}
+	return len(timedOutBatches)
+}
+
+// countExpiredPredictionCompletions count number of predictions completed and not completed in expiredBatches
+func countExpiredPredictionCompletions(expiredBatches []*predictionBatch) (completed int, notCompleted int) {
+
+	completed = 0
+	notCompleted = 0
+	for _, batch := range expiredBatches {
+		for _, pendingTrip := range batch.pendingTripPredictions {
+
+			for _, stop := range pendingTrip.tripPrediction.stopPredictions {
+				if stop.predictionComplete {
+					if stop.predictionSource == gtfs.StopMLPrediction ||
+						stop.predictionSource == gtfs.TimepointMLPrediction {
+						completed++
+					}
+
+				} else {
+					notCompleted++
+				}
+			}
+		}
+	}
+	return completed, notCompleted
+}
+
+// loadTimeBuckets retrieves the mlmodels.TimeBucket definitions models were trained with
+func loadTimeBuckets(ctx context.Context, db *sqlx.DB, queryTimeout time.Duration) ([]*mlmodels.TimeBucket, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	return mlmodels.GetTimeBuckets(ctx, db)
+}
@@ -0,0 +1,73 @@
+package predictor
+
+import (
+	"context"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/jmoiron/sqlx"
+	logger "log"
+	"time"
+)
+
+// backfillDataProvider provides recent vehicle history recorded by gtfs-monitor, or implementation for testing
+type backfillDataProvider interface {
+	GetObservedStopTimes(ctx context.Context, start time.Time, end time.Time) ([]*gtfs.ObservedStopTime, error)
+	GetLatestTripDeviations(ctx context.Context, start time.Time, end time.Time) ([]*gtfs.TripDeviation, error)
+}
+
+// dbBackfillDataProvider uses a database connection to retrieve recent vehicle history
+// each query is abandoned after queryTimeout
+type dbBackfillDataProvider struct {
+	db           *sqlx.DB
+	queryTimeout time.Duration
+}
+
+func (d *dbBackfillDataProvider) GetObservedStopTimes(ctx context.Context, start time.Time, end time.Time) ([]*gtfs.ObservedStopTime, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.queryTimeout)
+	defer cancel()
+	return gtfs.GetObservedStopTimes(ctx, d.db, start, end)
+}
+
+func (d *dbBackfillDataProvider) GetLatestTripDeviations(ctx context.Context, start time.Time, end time.Time) ([]*gtfs.TripDeviation, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.queryTimeout)
+	defer cancel()
+	return gtfs.GetLatestTripDeviations(ctx, d.db, start, end)
+}
+
+// backfillRecentHistory loads ObservedStopTimes recorded in the window before "at" into osts, and loads tripPredictors
+// for the trips vehicles were last seen on, so vehicles already in service when the aggregator starts are predicted
+// with their recent history instead of the schedule
+func backfillRecentHistory(ctx context.Context,
+	log *logger.Logger,
+	dataProvider backfillDataProvider,
+	osts *observedStopTransitions,
+	predictorsCollection *tripPredictorsCollection,
+	at time.Time,
+	window time.Duration) error {
+	start := at.Add(-window)
+
+	observations, err := dataProvider.GetObservedStopTimes(ctx, start, at)
+	if err != nil {
+		return err
+	}
+	for _, ost := range observations {
+		osts.newOST(ost)
+	}
+
+	deviations, err := dataProvider.GetLatestTripDeviations(ctx, start, at)
+	if err != nil {
+		return err
+	}
+	loadedPredictors := 0
+	for _, deviation := range deviations {
+		_, err = predictorsCollection.retrieveTripPredictor(ctx, deviation)
+		if err != nil {
+			log.Printf("Unable to load trip predictor for vehicle %s on trip %s during backfill: %v\n",
+				deviation.VehicleId, deviation.TripId, err)
+			continue
+		}
+		loadedPredictors++
+	}
+	log.Printf("Backfilled %d observed stop times and %d trip predictors for %d vehicles active since %s\n",
+		len(observations), loadedPredictors, len(deviations), start.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,75 @@
+package predictor
+
+import (
+	"context"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	logger "log"
+	"os"
+	"testing"
+	"time"
+)
+
+type testBackfillDataProvider struct {
+	observations []*gtfs.ObservedStopTime
+	deviations   []*gtfs.TripDeviation
+	start        time.Time
+}
+
+func (d *testBackfillDataProvider) GetObservedStopTimes(_ context.Context, start time.Time, _ time.Time) ([]*gtfs.ObservedStopTime, error) {
+	d.start = start
+	return d.observations, nil
+}
+
+func (d *testBackfillDataProvider) GetLatestTripDeviations(_ context.Context, _ time.Time, _ time.Time) ([]*gtfs.TripDeviation, error) {
+	return d.deviations, nil
+}
+
+func Test_backfillRecentHistory(t *testing.T) {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Errorf("Unable to get testing time zone location")
+		return
+	}
+	serviceDate := time.Date(2022, 5, 22, 0, 0, 0, 0, location)
+	at := time.Date(2022, 5, 22, 12, 30, 0, 0, location)
+	trip1 := getTestTrip(serviceDate, "trip_instance_1.json", t)
+
+	tripsProvider := &testTripPredictorsDataProvider{
+		tripInstances: map[string]*gtfs.TripInstance{trip1.TripId: trip1},
+	}
+	osts := makeObservedStopTransitions(3600, 5, 0)
+	collection, err := makeTripPredictorsCollection(tripsProvider, osts, 0.0, 1,
+		&predictorEvictionPolicy{defaultMargin: time.Hour}, 60, true, true, nil, false, false, nil)
+	if err != nil {
+		t.Errorf("unable to make tripPredictorsCollection: %v", err)
+		return
+	}
+	backfillProvider := &testBackfillDataProvider{
+		observations: []*gtfs.ObservedStopTime{
+			{ObservedTime: at.Add(-20 * time.Minute), StopId: "A", NextStopId: "B", TravelSeconds: 1000},
+			{ObservedTime: at.Add(-10 * time.Minute), StopId: "A", NextStopId: "B", TravelSeconds: 1200},
+		},
+		deviations: []*gtfs.TripDeviation{
+			{DataSetId: trip1.DataSetId, TripId: trip1.TripId, VehicleId: "1", DeviationTimestamp: at},
+			{DataSetId: trip1.DataSetId, TripId: "missing", VehicleId: "2", DeviationTimestamp: at},
+		},
+	}
+
+	err = backfillRecentHistory(context.Background(), logger.New(os.Stdout, "test", 0), backfillProvider, osts,
+		collection, at, time.Hour)
+	if err != nil {
+		t.Errorf("backfillRecentHistory() error = %v", err)
+	}
+	if !backfillProvider.start.Equal(at.Add(-time.Hour)) {
+		t.Errorf("backfillRecentHistory() loaded history from %v, want %v", backfillProvider.start, at.Add(-time.Hour))
+	}
+	if ost := osts.getOst("A", "B", at); ost == nil || ost.TravelSeconds != 1200 {
+		t.Errorf("getOst() = %+v, want most recent backfilled observation", ost)
+	}
+	if average, ok := osts.recentAverageTravelSeconds("A", "B", at); !ok || average != 1100 {
+		t.Errorf("recentAverageTravelSeconds() = %v, %v, want 1100, true", average, ok)
+	}
+	if collection.locker.retrieve(makePredictorMapId(trip1.DataSetId, trip1.TripId)) == nil {
+		t.Errorf("expected trip predictor for %s to be loaded", trip1.TripId)
+	}
+}
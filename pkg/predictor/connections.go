@@ -0,0 +1,404 @@
+package predictor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/jmoiron/sqlx"
+	"github.com/nats-io/nats.go"
+	logger "log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// connectionCheckInterval is how often published TripUpdates are checked for connections at risk
+const connectionCheckInterval = 30 * time.Second
+
+// connectionDeparturesRefresh is how long the departures retrieved for a stop are reused
+const connectionDeparturesRefresh = time.Minute
+
+// notPossibleTransfer is the transfer_type of a gtfs.Transfer where riders can not transfer between routes at the stops
+const notPossibleTransfer = 3
+
+// ConnectionAtRiskAlert is published when a feeder trip's predicted arrival leaves less than the connection margin to
+// transfer to a connecting trip scheduled to depart after it, so dispatch can decide whether to hold the connecting
+// trip. It is published again with AtRisk false if later predictions leave enough time to make the connection
+type ConnectionAtRiskAlert struct {
+	At            time.Time `json:"at"`
+	AtRisk        bool      `json:"at_risk"`
+	FromTripId    string    `json:"from_trip_id"`
+	FromRouteId   string    `json:"from_route_id"`
+	FromVehicleId string    `json:"from_vehicle_id"`
+	FromStopId    string    `json:"from_stop_id"`
+	ToTripId      string    `json:"to_trip_id"`
+	ToRouteId     string    `json:"to_route_id"`
+	ToStopId      string    `json:"to_stop_id"`
+	// PredictedArrival is when the feeder trip is predicted to arrive at FromStopId
+	PredictedArrival time.Time `json:"predicted_arrival"`
+	// ScheduledDeparture is when the connecting trip is scheduled to depart ToStopId
+	ScheduledDeparture     time.Time `json:"scheduled_departure"`
+	MinimumTransferSeconds int       `json:"minimum_transfer_seconds"`
+	// SlackSeconds is the time left between the transfer being made and the connecting trip departing, negative when
+	// the connection will be missed unless the connecting trip is held
+	SlackSeconds int `json:"slack_seconds"`
+}
+
+// connectingDeparture is a trip scheduled to depart a stop
+type connectingDeparture struct {
+	tripId    string
+	routeId   string
+	stopId    string
+	departure time.Time
+}
+
+// connectionDataProvider provides the schedule needed to find connections, or implementation for testing
+type connectionDataProvider interface {
+	GetActiveDataSetId(ctx context.Context, at time.Time) (int64, error)
+	GetTransfersFromStop(ctx context.Context, dataSetId int64, stopId string) ([]*gtfs.Transfer, error)
+	GetDepartures(ctx context.Context,
+		dataSetId int64,
+		stopId string,
+		start time.Time,
+		end time.Time) ([]*connectingDeparture, error)
+}
+
+// dbConnectionDataProvider uses a database connection to retrieve transfers and departures
+// each query is abandoned after queryTimeout
+type dbConnectionDataProvider struct {
+	db           *sqlx.DB
+	queryTimeout time.Duration
+}
+
+func (d *dbConnectionDataProvider) GetActiveDataSetId(ctx context.Context, at time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.queryTimeout)
+	defer cancel()
+	dataSet, err := gtfs.GetDataSetAt(ctx, d.db, at)
+	if err != nil {
+		return 0, err
+	}
+	return dataSet.Id, nil
+}
+
+func (d *dbConnectionDataProvider) GetTransfersFromStop(ctx context.Context,
+	dataSetId int64,
+	stopId string) ([]*gtfs.Transfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.queryTimeout)
+	defer cancel()
+	return gtfs.GetTransfersFromStop(ctx, d.db, dataSetId, stopId)
+}
+
+func (d *dbConnectionDataProvider) GetDepartures(ctx context.Context,
+	dataSetId int64,
+	stopId string,
+	start time.Time,
+	end time.Time) ([]*connectingDeparture, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.queryTimeout)
+	defer cancel()
+	stopTimes, err := gtfs.MakeDBScheduleRepository(d.db, 0).StopTimesForStop(ctx, dataSetId, stopId, start, end)
+	if err != nil {
+		return nil, err
+	}
+	tripIds := make([]string, 0, len(stopTimes))
+	for _, stopTime := range stopTimes {
+		tripIds = append(tripIds, stopTime.TripId)
+	}
+	routeIds, err := gtfs.GetTripRouteIds(ctx, d.db, dataSetId, tripIds)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*connectingDeparture, 0, len(stopTimes))
+	for _, stopTime := range stopTimes {
+		results = append(results, &connectingDeparture{
+			tripId:    stopTime.TripId,
+			routeId:   routeIds[stopTime.TripId],
+			stopId:    stopTime.StopId,
+			departure: stopTime.DepartureDateTime,
+		})
+	}
+	return results, nil
+}
+
+// connectionPolicy sets which connections are checked and when they are at risk
+type connectionPolicy struct {
+	// lookahead limits the feeder arrivals checked to those predicted within lookahead
+	lookahead time.Duration
+	// maximumWait is how long after the feeder's scheduled arrival a departure is still a connection
+	maximumWait time.Duration
+	// minimumTransfer is the time needed to transfer when a gtfs.Transfer has no min_transfer_time
+	minimumTransfer time.Duration
+	// margin is the least slack a connection can have without being at risk
+	margin time.Duration
+	// sameStopTransfers treats departures of other routes from the stop a feeder arrives at as connections
+	sameStopTransfers bool
+}
+
+// connectionKey identifies a connection from a feeder trip to a connecting trip
+type connectionKey struct {
+	fromTripId string
+	fromStopId string
+	toTripId   string
+}
+
+// cachedDepartures are the departures retrieved for a stop
+type cachedDepartures struct {
+	retrievedAt time.Time
+	departures  []*connectingDeparture
+}
+
+// connectionTracker keeps the last TripUpdate published for each trip, and the connections from them that are at risk
+type connectionTracker struct {
+	mu          sync.Mutex
+	policy      connectionPolicy
+	tripUpdates map[string]*gtfs.TripUpdate
+	atRisk      map[connectionKey]*ConnectionAtRiskAlert
+	dataSetId   int64
+	transfers   map[string][]*gtfs.Transfer
+	departures  map[string]*cachedDepartures
+}
+
+// makeConnectionTracker builds connectionTracker checking connections with policy
+func makeConnectionTracker(policy connectionPolicy) *connectionTracker {
+	return &connectionTracker{
+		mu:          sync.Mutex{},
+		policy:      policy,
+		tripUpdates: make(map[string]*gtfs.TripUpdate),
+		atRisk:      make(map[connectionKey]*ConnectionAtRiskAlert),
+		transfers:   make(map[string][]*gtfs.Transfer),
+		departures:  make(map[string]*cachedDepartures),
+	}
+}
+
+// record keeps tripUpdate as the last published for its trip, a nil connectionTracker ignores it
+func (c *connectionTracker) record(tripUpdate *gtfs.TripUpdate) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tripUpdates[tripUpdate.TripId] = tripUpdate
+}
+
+// check returns ConnectionAtRiskAlerts for connections from the recorded TripUpdates that have become at risk as of
+// "now", and for connections at risk that no longer are. Connections no longer checked because the feeder trip has
+// arrived or stopped being predicted are forgotten without an alert
+func (c *connectionTracker) check(ctx context.Context,
+	now time.Time,
+	provider connectionDataProvider) ([]*ConnectionAtRiskAlert, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dataSetId, err := provider.GetActiveDataSetId(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	if dataSetId != c.dataSetId {
+		c.dataSetId = dataSetId
+		c.transfers = make(map[string][]*gtfs.Transfer)
+		c.departures = make(map[string]*cachedDepartures)
+	}
+
+	checked := make(map[connectionKey]*ConnectionAtRiskAlert)
+	for tripId, tripUpdate := range c.tripUpdates {
+		if now.Sub(time.Unix(int64(tripUpdate.Timestamp), 0)) > publishedTripUpdateRetention {
+			delete(c.tripUpdates, tripId)
+			continue
+		}
+		for _, stopTimeUpdate := range tripUpdate.StopTimeUpdates {
+			if stopTimeUpdate.PredictedArrivalTime.Before(now) ||
+				stopTimeUpdate.PredictedArrivalTime.After(now.Add(c.policy.lookahead)) {
+				continue
+			}
+			connections, err := c.connectionsAt(ctx, now, provider, tripUpdate, stopTimeUpdate)
+			if err != nil {
+				return nil, err
+			}
+			for _, connection := range connections {
+				checked[connectionKey{
+					fromTripId: connection.FromTripId,
+					fromStopId: connection.FromStopId,
+					toTripId:   connection.ToTripId,
+				}] = connection
+			}
+		}
+	}
+
+	alerts := make([]*ConnectionAtRiskAlert, 0)
+	for key, connection := range checked {
+		_, wasAtRisk := c.atRisk[key]
+		if connection.AtRisk && !wasAtRisk {
+			c.atRisk[key] = connection
+			alerts = append(alerts, connection)
+		} else if !connection.AtRisk && wasAtRisk {
+			delete(c.atRisk, key)
+			alerts = append(alerts, connection)
+		}
+	}
+	for key := range c.atRisk {
+		if _, present := checked[key]; !present {
+			delete(c.atRisk, key)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].FromTripId != alerts[j].FromTripId {
+			return alerts[i].FromTripId < alerts[j].FromTripId
+		}
+		return alerts[i].ToTripId < alerts[j].ToTripId
+	})
+	return alerts, nil
+}
+
+// connectionsAt returns the connections a rider arriving at stopTimeUpdate's stop on tripUpdate is scheduled to make,
+// the first departure of each connecting route within maximumWait of the scheduled arrival, with the slack left by
+// the predicted arrival. c.mu must be held
+func (c *connectionTracker) connectionsAt(ctx context.Context,
+	now time.Time,
+	provider connectionDataProvider,
+	tripUpdate *gtfs.TripUpdate,
+	stopTimeUpdate gtfs.StopTimeUpdate) ([]*ConnectionAtRiskAlert, error) {
+	transfers, err := c.transfersFrom(ctx, provider, stopTimeUpdate.StopId)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*ConnectionAtRiskAlert, 0)
+	connectingRoutes := make(map[string]bool)
+	for _, transfer := range transfers {
+		if !transferApplies(transfer, tripUpdate) {
+			continue
+		}
+		minimumTransfer := c.policy.minimumTransfer
+		if transfer.MinTransferTime != nil {
+			minimumTransfer = time.Duration(*transfer.MinTransferTime) * time.Second
+		}
+		departures, err := c.departuresFrom(ctx, now, provider, transfer.ToStopId)
+		if err != nil {
+			return nil, err
+		}
+		earliest := stopTimeUpdate.ScheduledArrivalTime.Add(minimumTransfer)
+		latest := stopTimeUpdate.ScheduledArrivalTime.Add(c.policy.maximumWait)
+		for _, departure := range departures {
+			if departure.departure.Before(earliest) || departure.departure.After(latest) ||
+				departure.tripId == tripUpdate.TripId || departure.routeId == tripUpdate.RouteId ||
+				connectingRoutes[departure.routeId] ||
+				(transfer.ToRouteId != "" && transfer.ToRouteId != departure.routeId) ||
+				(transfer.ToTripId != "" && transfer.ToTripId != departure.tripId) {
+				continue
+			}
+			connectingRoutes[departure.routeId] = true
+			slack := departure.departure.Sub(stopTimeUpdate.PredictedArrivalTime.Add(minimumTransfer))
+			results = append(results, &ConnectionAtRiskAlert{
+				At:                     now,
+				AtRisk:                 slack < c.policy.margin,
+				FromTripId:             tripUpdate.TripId,
+				FromRouteId:            tripUpdate.RouteId,
+				FromVehicleId:          tripUpdate.VehicleId,
+				FromStopId:             stopTimeUpdate.StopId,
+				ToTripId:               departure.tripId,
+				ToRouteId:              departure.routeId,
+				ToStopId:               departure.stopId,
+				PredictedArrival:       stopTimeUpdate.PredictedArrivalTime,
+				ScheduledDeparture:     departure.departure,
+				MinimumTransferSeconds: int(minimumTransfer.Seconds()),
+				SlackSeconds:           int(slack.Seconds()),
+			})
+		}
+	}
+	return results, nil
+}
+
+// transferApplies returns true if transfer is possible from tripUpdate's trip
+func transferApplies(transfer *gtfs.Transfer, tripUpdate *gtfs.TripUpdate) bool {
+	return transfer.TransferType != notPossibleTransfer &&
+		(transfer.FromRouteId == "" || transfer.FromRouteId == tripUpdate.RouteId) &&
+		(transfer.FromTripId == "" || transfer.FromTripId == tripUpdate.TripId)
+}
+
+// transfersFrom returns the transfers possible from stopId, including a transfer to the same stop when
+// sameStopTransfers is set. c.mu must be held
+func (c *connectionTracker) transfersFrom(ctx context.Context,
+	provider connectionDataProvider,
+	stopId string) ([]*gtfs.Transfer, error) {
+	if transfers, present := c.transfers[stopId]; present {
+		return transfers, nil
+	}
+	transfers, err := provider.GetTransfersFromStop(ctx, c.dataSetId, stopId)
+	if err != nil {
+		return nil, err
+	}
+	if c.policy.sameStopTransfers {
+		transfers = append(transfers, &gtfs.Transfer{DataSetId: c.dataSetId, FromStopId: stopId, ToStopId: stopId})
+	}
+	c.transfers[stopId] = transfers
+	return transfers, nil
+}
+
+// departuresFrom returns the departures from stopId scheduled around "now" that can be connections for feeders
+// predicted within lookahead. c.mu must be held
+func (c *connectionTracker) departuresFrom(ctx context.Context,
+	now time.Time,
+	provider connectionDataProvider,
+	stopId string) ([]*connectingDeparture, error) {
+	if cached, present := c.departures[stopId]; present && now.Sub(cached.retrievedAt) < connectionDeparturesRefresh {
+		return cached.departures, nil
+	}
+	departures, err := provider.GetDepartures(ctx, c.dataSetId, stopId, now.Add(-c.policy.maximumWait),
+		now.Add(c.policy.lookahead+c.policy.maximumWait))
+	if err != nil {
+		return nil, err
+	}
+	c.departures[stopId] = &cachedDepartures{retrievedAt: now, departures: departures}
+	return departures, nil
+}
+
+// runConnectionMonitor checks every interval for connections at risk from the TripUpdates recorded in tracker and
+// publishes ConnectionAtRiskAlerts on NATS subject
+func runConnectionMonitor(ctx context.Context,
+	log *logger.Logger,
+	wg *sync.WaitGroup,
+	natsConn *nats.Conn,
+	subject string,
+	provider connectionDataProvider,
+	tracker *connectionTracker,
+	interval time.Duration,
+	shutdownSignal chan bool) {
+	wg.Add(1)
+	defer wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-shutdownSignal:
+			log.Printf("Exiting connection monitor on shutdown signal")
+			return
+		case now := <-ticker.C:
+			alerts, err := tracker.check(ctx, now, provider)
+			if err != nil {
+				log.Printf("Unable to check connections: %v\n", err)
+				continue
+			}
+			for _, alert := range alerts {
+				if alert.AtRisk {
+					log.Printf("Connection from trip %s to trip %s at stop %s is at risk with %d seconds slack\n",
+						alert.FromTripId, alert.ToTripId, alert.ToStopId, alert.SlackSeconds)
+				} else {
+					log.Printf("Connection from trip %s to trip %s at stop %s is no longer at risk\n",
+						alert.FromTripId, alert.ToTripId, alert.ToStopId)
+				}
+				err = publishConnectionAtRiskAlert(natsConn, subject, alert)
+				if err != nil {
+					log.Printf("Error publishing connection at risk alert: %v\n", err)
+				}
+			}
+		}
+	}
+}
+
+// publishConnectionAtRiskAlert sends alert as json on NATS subject
+func publishConnectionAtRiskAlert(natsConn *nats.Conn, subject string, alert *ConnectionAtRiskAlert) error {
+	jsonData, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("error marshaling connection at risk alert to json: %w", err)
+	}
+	return natsConn.Publish(subject, jsonData)
+}
@@ -0,0 +1,176 @@
+package predictor
+
+import (
+	"context"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"testing"
+	"time"
+)
+
+type testConnectionDataProvider struct {
+	dataSetId  int64
+	transfers  map[string][]*gtfs.Transfer
+	departures map[string][]*connectingDeparture
+}
+
+func (t *testConnectionDataProvider) GetActiveDataSetId(_ context.Context, _ time.Time) (int64, error) {
+	return t.dataSetId, nil
+}
+
+func (t *testConnectionDataProvider) GetTransfersFromStop(_ context.Context,
+	_ int64,
+	stopId string) ([]*gtfs.Transfer, error) {
+	return t.transfers[stopId], nil
+}
+
+func (t *testConnectionDataProvider) GetDepartures(_ context.Context,
+	_ int64,
+	stopId string,
+	_ time.Time,
+	_ time.Time) ([]*connectingDeparture, error) {
+	return t.departures[stopId], nil
+}
+
+// makeFeederTripUpdate builds a TripUpdate on route "100" arriving at stop "A" scheduled at scheduled and predicted
+// delaySeconds later
+func makeFeederTripUpdate(at time.Time, scheduled time.Time, delaySeconds int) *gtfs.TripUpdate {
+	return &gtfs.TripUpdate{
+		TripId:    "feeder",
+		RouteId:   "100",
+		VehicleId: "3501",
+		Timestamp: uint64(at.Unix()),
+		StopTimeUpdates: []gtfs.StopTimeUpdate{
+			{
+				StopSequence:         5,
+				StopId:               "A",
+				ScheduledArrivalTime: scheduled,
+				ArrivalDelay:         delaySeconds,
+				PredictedArrivalTime: scheduled.Add(time.Duration(delaySeconds) * time.Second),
+			},
+		},
+	}
+}
+
+func Test_connectionTracker_check(t *testing.T) {
+	now := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	scheduledArrival := now.Add(10 * time.Minute)
+	twoMinutes := 120
+	provider := &testConnectionDataProvider{
+		dataSetId: 1,
+		transfers: map[string][]*gtfs.Transfer{
+			"A": {{DataSetId: 1, FromStopId: "A", ToStopId: "B", MinTransferTime: &twoMinutes}},
+		},
+		departures: map[string][]*connectingDeparture{
+			"A": {
+				{tripId: "same-route", routeId: "100", stopId: "A", departure: scheduledArrival.Add(3 * time.Minute)},
+				{tripId: "90-first", routeId: "90", stopId: "A", departure: scheduledArrival.Add(3 * time.Minute)},
+				{tripId: "90-second", routeId: "90", stopId: "A", departure: scheduledArrival.Add(8 * time.Minute)},
+			},
+			"B": {
+				{tripId: "too-soon", routeId: "20", stopId: "B", departure: scheduledArrival.Add(time.Minute)},
+				{tripId: "20-first", routeId: "20", stopId: "B", departure: scheduledArrival.Add(5 * time.Minute)},
+				{tripId: "too-late", routeId: "8", stopId: "B", departure: scheduledArrival.Add(20 * time.Minute)},
+			},
+		},
+	}
+	tracker := makeConnectionTracker(connectionPolicy{
+		lookahead:         30 * time.Minute,
+		maximumWait:       15 * time.Minute,
+		minimumTransfer:   time.Minute,
+		margin:            time.Minute,
+		sameStopTransfers: true,
+	})
+
+	tracker.record(makeFeederTripUpdate(now, scheduledArrival, 30))
+	alerts, err := tracker.check(context.Background(), now, provider)
+	if err != nil {
+		t.Fatalf("check() error = %v", err)
+	}
+	if len(alerts) != 0 {
+		t.Errorf("check() = %+v, want no connections at risk", alerts)
+	}
+
+	tracker.record(makeFeederTripUpdate(now, scheduledArrival, 90))
+	alerts, err = tracker.check(context.Background(), now.Add(30*time.Second), provider)
+	if err != nil {
+		t.Fatalf("check() error = %v", err)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("check() = %+v, want one connection at risk", alerts)
+	}
+	got := alerts[0]
+	if !got.AtRisk || got.ToTripId != "90-first" || got.ToStopId != "A" || got.SlackSeconds != 30 ||
+		got.MinimumTransferSeconds != 60 || got.FromVehicleId != "3501" {
+		t.Errorf("check() = %+v, want connection to 90-first at risk with 30 seconds slack", got)
+	}
+
+	alerts, err = tracker.check(context.Background(), now.Add(time.Minute), provider)
+	if err != nil {
+		t.Fatalf("check() error = %v", err)
+	}
+	if len(alerts) != 0 {
+		t.Errorf("check() = %+v, want connection at risk reported only once", alerts)
+	}
+
+	tracker.record(makeFeederTripUpdate(now, scheduledArrival, 240))
+	alerts, err = tracker.check(context.Background(), now.Add(90*time.Second), provider)
+	if err != nil {
+		t.Fatalf("check() error = %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].ToTripId != "20-first" || alerts[0].SlackSeconds != -60 ||
+		alerts[0].MinimumTransferSeconds != 120 {
+		t.Errorf("check() = %+v, want transfer to 20-first at risk with -60 seconds slack", alerts)
+	}
+
+	tracker.record(makeFeederTripUpdate(now, scheduledArrival, 0))
+	alerts, err = tracker.check(context.Background(), now.Add(2*time.Minute), provider)
+	if err != nil {
+		t.Fatalf("check() error = %v", err)
+	}
+	if len(alerts) != 2 || alerts[0].AtRisk || alerts[1].AtRisk ||
+		alerts[0].ToTripId != "20-first" || alerts[1].ToTripId != "90-first" {
+		t.Errorf("check() = %+v, want both connections no longer at risk", alerts)
+	}
+}
+
+func Test_transferApplies(t *testing.T) {
+	tripUpdate := &gtfs.TripUpdate{TripId: "feeder", RouteId: "100"}
+	tests := []struct {
+		name     string
+		transfer *gtfs.Transfer
+		want     bool
+	}{
+		{
+			name:     "transfer from any route",
+			transfer: &gtfs.Transfer{FromStopId: "A", ToStopId: "B"},
+			want:     true,
+		},
+		{
+			name:     "transfer from trip's route",
+			transfer: &gtfs.Transfer{FromStopId: "A", ToStopId: "B", FromRouteId: "100"},
+			want:     true,
+		},
+		{
+			name:     "transfer from other route",
+			transfer: &gtfs.Transfer{FromStopId: "A", ToStopId: "B", FromRouteId: "90"},
+			want:     false,
+		},
+		{
+			name:     "transfer from other trip",
+			transfer: &gtfs.Transfer{FromStopId: "A", ToStopId: "B", FromTripId: "other"},
+			want:     false,
+		},
+		{
+			name:     "transfer not possible",
+			transfer: &gtfs.Transfer{FromStopId: "A", ToStopId: "B", TransferType: notPossibleTransfer},
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := transferApplies(tt.transfer, tripUpdate); got != tt.want {
+				t.Errorf("transferApplies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
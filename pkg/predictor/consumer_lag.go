@@ -0,0 +1,206 @@
+package predictor
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/nats-io/nats.go"
+	logger "log"
+	"sync"
+	"time"
+)
+
+// consumerLagCheckInterval is how often the vehicle-monitor-results subscription is checked for lag
+const consumerLagCheckInterval = 10 * time.Second
+
+// consumerLagMetrics exports how far behind the aggregator is in processing vehicle-monitor-results under
+// /debug/vars: the lag of the latest and the most lagged results processed since the last check, the messages waiting
+// in the subscription, the messages dropped by NATS and the results of each vehicle shed in favor of newer results
+var consumerLagMetrics = expvar.NewMap("consumer_lag")
+
+// ConsumerLagAlert is published when vehicle-monitor-results are processed more than the lag threshold after the
+// vehicle's position was recorded or NATS drops messages because the aggregator is too slow, and again with Lagging
+// false once the aggregator has caught up
+type ConsumerLagAlert struct {
+	At      time.Time `json:"at"`
+	Lagging bool      `json:"lagging"`
+	// LagSeconds is the longest any results processed since the last check waited after the vehicle's position was
+	// recorded
+	LagSeconds      int `json:"lag_seconds"`
+	PendingMessages int `json:"pending_messages"`
+	// DroppedMessages is the number of messages dropped by NATS since the last check
+	DroppedMessages int `json:"dropped_messages"`
+}
+
+// consumerLagTracker measures how long after a vehicle's position was recorded its vehicle-monitor-results are
+// processed, using the newest DeviationTimestamp in the results. The measurement includes any clock skew between the
+// monitor and the aggregator
+type consumerLagTracker struct {
+	mu sync.Mutex
+	// maxLag is the most lagged results recorded since the last check
+	maxLag  time.Duration
+	dropped int
+	lagging bool
+}
+
+// record measures the lag of results processed at "now", a nil consumerLagTracker ignores it
+func (c *consumerLagTracker) record(now time.Time, results *gtfs.VehicleMonitorResults) {
+	if c == nil {
+		return
+	}
+	timestamp := newestDeviationTimestamp(results)
+	if timestamp.IsZero() {
+		return
+	}
+	lag := now.Sub(timestamp)
+	setConsumerLagMetric("lag_milliseconds", lag.Milliseconds())
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if lag > c.maxLag {
+		c.maxLag = lag
+	}
+}
+
+// check returns a ConsumerLagAlert when the aggregator starts lagging or catches up as of "now", or nil if neither
+// happened. The aggregator is lagging when results recorded since the last check waited at least threshold or when
+// NATS dropped more messages than the dropped count at the last check
+func (c *consumerLagTracker) check(now time.Time,
+	threshold time.Duration,
+	pending int,
+	dropped int) *ConsumerLagAlert {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	maxLag := c.maxLag
+	newlyDropped := dropped - c.dropped
+	c.maxLag = 0
+	c.dropped = dropped
+	setConsumerLagMetric("max_lag_milliseconds", maxLag.Milliseconds())
+	setConsumerLagMetric("pending_messages", int64(pending))
+	setConsumerLagMetric("dropped_messages", int64(dropped))
+
+	lagging := maxLag >= threshold || newlyDropped > 0
+	if lagging == c.lagging {
+		return nil
+	}
+	c.lagging = lagging
+	return &ConsumerLagAlert{
+		At:              now,
+		Lagging:         lagging,
+		LagSeconds:      int(maxLag.Seconds()),
+		PendingMessages: pending,
+		DroppedMessages: newlyDropped,
+	}
+}
+
+// newestDeviationTimestamp returns the latest DeviationTimestamp in results, or zero time without TripDeviations
+func newestDeviationTimestamp(results *gtfs.VehicleMonitorResults) time.Time {
+	var newest time.Time
+	for _, deviation := range results.TripDeviations {
+		if deviation.DeviationTimestamp.After(newest) {
+			newest = deviation.DeviationTimestamp
+		}
+	}
+	return newest
+}
+
+// consumerLagMonitor checks the vehicle-monitor-results subscription for lag and publishes ConsumerLagAlerts on NATS
+// subject when the aggregator starts lagging more than threshold or catches up, a zero threshold disables alerts
+type consumerLagMonitor struct {
+	tracker   *consumerLagTracker
+	natsConn  *nats.Conn
+	subject   string
+	threshold time.Duration
+}
+
+// check checks for lag at "now" given the messages pending and dropped by sub, publishing a ConsumerLagAlert if the
+// aggregator started lagging or caught up
+func (m *consumerLagMonitor) check(log *logger.Logger, now time.Time, sub *nats.Subscription, pending int) {
+	dropped, err := sub.Dropped()
+	if err != nil {
+		log.Printf("Unable to retrieve dropped vehicle-monitor-results messages: %v\n", err)
+		return
+	}
+	alert := m.tracker.check(now, m.threshold, pending, dropped)
+	if alert == nil || m.threshold <= 0 {
+		return
+	}
+	if alert.Lagging {
+		log.Printf("Processing of vehicle-monitor-results is lagging by %d seconds with %d pending and %d dropped\n",
+			alert.LagSeconds, alert.PendingMessages, alert.DroppedMessages)
+	} else {
+		log.Printf("Processing of vehicle-monitor-results has caught up\n")
+	}
+	err = publishConsumerLagAlert(m.natsConn, m.subject, alert)
+	if err != nil {
+		log.Printf("Error publishing consumer lag alert: %v\n", err)
+	}
+}
+
+// publishConsumerLagAlert sends alert as json on NATS subject
+func publishConsumerLagAlert(natsConn *nats.Conn, subject string, alert *ConsumerLagAlert) error {
+	jsonData, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("error marshaling consumer lag alert to json: %w", err)
+	}
+	return natsConn.Publish(subject, jsonData)
+}
+
+// setConsumerLagMetric sets name in consumerLagMetrics to value
+func setConsumerLagMetric(name string, value int64) {
+	metric := new(expvar.Int)
+	metric.Set(value)
+	consumerLagMetrics.Set(name, metric)
+}
+
+// latestVehicleResults sheds load when vehicle-monitor-results for a vehicle arrive faster than they are processed.
+// While a vehicle's results are being processed only the newest results received for the vehicle are kept waiting,
+// the results they replace are never processed
+type latestVehicleResults struct {
+	mu         sync.Mutex
+	processing map[string]bool
+	waiting    map[string]*gtfs.VehicleMonitorResults
+}
+
+// makeLatestVehicleResults builds latestVehicleResults
+func makeLatestVehicleResults() *latestVehicleResults {
+	return &latestVehicleResults{
+		mu:         sync.Mutex{},
+		processing: make(map[string]bool),
+		waiting:    make(map[string]*gtfs.VehicleMonitorResults),
+	}
+}
+
+// begin returns true if results can be processed now, otherwise results wait for the results being processed for
+// the same vehicle to finish, replacing any older results waiting
+func (l *latestVehicleResults) begin(results *gtfs.VehicleMonitorResults) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.processing[results.VehicleId] {
+		l.processing[results.VehicleId] = true
+		return true
+	}
+	if waiting, present := l.waiting[results.VehicleId]; present {
+		consumerLagMetrics.Add("shed_results", 1)
+		// results delivered out of order don't replace newer results
+		if newestDeviationTimestamp(waiting).After(newestDeviationTimestamp(results)) {
+			return false
+		}
+	}
+	l.waiting[results.VehicleId] = results
+	return false
+}
+
+// finish ends the processing of vehicleId's results, returning the results waiting for vehicleId, which are now being
+// processed, or nil if none are waiting
+func (l *latestVehicleResults) finish(vehicleId string) *gtfs.VehicleMonitorResults {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	waiting, present := l.waiting[vehicleId]
+	if !present {
+		delete(l.processing, vehicleId)
+		return nil
+	}
+	delete(l.waiting, vehicleId)
+	return waiting
+}
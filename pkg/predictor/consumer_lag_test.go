@@ -0,0 +1,84 @@
+package predictor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"testing"
+	"time"
+)
+
+// testVehicleResults builds gtfs.VehicleMonitorResults for vehicleId with a TripDeviation recorded at deviationAt
+func testVehicleResults(vehicleId string, deviationAt time.Time) *gtfs.VehicleMonitorResults {
+	return &gtfs.VehicleMonitorResults{
+		VehicleId:      vehicleId,
+		TripDeviations: []*gtfs.TripDeviation{{VehicleId: vehicleId, DeviationTimestamp: deviationAt}},
+	}
+}
+
+func Test_consumerLagTracker_check(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	threshold := 30 * time.Second
+	tracker := &consumerLagTracker{}
+
+	tracker.record(at, testVehicleResults("1", at.Add(-5*time.Second)))
+	if alert := tracker.check(at, threshold, 0, 0); alert != nil {
+		t.Fatalf("check() = %+v, want no alert within threshold", alert)
+	}
+
+	tracker.record(at.Add(10*time.Second), testVehicleResults("1", at.Add(-35*time.Second)))
+	tracker.record(at.Add(10*time.Second), testVehicleResults("2", at.Add(5*time.Second)))
+	alert := tracker.check(at.Add(10*time.Second), threshold, 12, 0)
+	if alert == nil || !alert.Lagging || alert.LagSeconds != 45 || alert.PendingMessages != 12 {
+		t.Fatalf("check() = %+v, want lagging alert of 45 seconds with 12 pending", alert)
+	}
+	tracker.record(at.Add(20*time.Second), testVehicleResults("1", at.Add(-20*time.Second)))
+	if alert = tracker.check(at.Add(20*time.Second), threshold, 0, 0); alert != nil {
+		t.Fatalf("check() = %+v, want no alert while still lagging", alert)
+	}
+
+	tracker.record(at.Add(30*time.Second), testVehicleResults("1", at.Add(25*time.Second)))
+	alert = tracker.check(at.Add(30*time.Second), threshold, 0, 0)
+	if alert == nil || alert.Lagging {
+		t.Fatalf("check() = %+v, want caught up alert", alert)
+	}
+
+	// messages dropped by NATS since the last check are lagging regardless of the lag measured
+	alert = tracker.check(at.Add(40*time.Second), threshold, 64, 3)
+	if alert == nil || !alert.Lagging || alert.DroppedMessages != 3 {
+		t.Fatalf("check() = %+v, want lagging alert with 3 dropped", alert)
+	}
+	alert = tracker.check(at.Add(50*time.Second), threshold, 0, 3)
+	if alert == nil || alert.Lagging {
+		t.Errorf("check() = %+v, want caught up alert once no more messages are dropped", alert)
+	}
+}
+
+func Test_latestVehicleResults(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	latest := makeLatestVehicleResults()
+
+	first := testVehicleResults("1", at)
+	if !latest.begin(first) {
+		t.Fatalf("begin() = false for the first results of a vehicle")
+	}
+	if !latest.begin(testVehicleResults("2", at)) {
+		t.Errorf("begin() = false for results of another vehicle")
+	}
+	second := testVehicleResults("1", at.Add(5*time.Second))
+	third := testVehicleResults("1", at.Add(10*time.Second))
+	outOfOrder := testVehicleResults("1", at.Add(7*time.Second))
+	for _, results := range []*gtfs.VehicleMonitorResults{second, third, outOfOrder} {
+		if latest.begin(results) {
+			t.Fatalf("begin() = true while the vehicle's results are being processed")
+		}
+	}
+
+	if got := latest.finish("1"); got != third {
+		t.Fatalf("finish() = %v, want the newest results waiting", got)
+	}
+	if got := latest.finish("1"); got != nil {
+		t.Fatalf("finish() = %v, want nil with no results waiting", got)
+	}
+	if !latest.begin(testVehicleResults("1", at.Add(15*time.Second))) {
+		t.Errorf("begin() = false after the vehicle's results were finished")
+	}
+}
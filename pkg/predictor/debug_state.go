@@ -0,0 +1,278 @@
+package predictor
+
+import (
+	"encoding/json"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/foundation/clock"
+	logger "log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// vehicleDeviationTracker keeps the last gtfs.TripDeviation received for each vehicle, and the history of the vehicle's
+// deviations within historyDuration of its last deviation
+type vehicleDeviationTracker struct {
+	mu              sync.Mutex
+	vehicles        map[string]*vehicleDeviationState
+	history         map[string][]*gtfs.TripDeviation
+	historyDuration time.Duration
+}
+
+// vehicleDeviationState is the last gtfs.TripDeviation received for a vehicle and when it was received
+type vehicleDeviationState struct {
+	VehicleId  string              `json:"vehicle_id"`
+	ReceivedAt time.Time           `json:"received_at"`
+	Deviation  *gtfs.TripDeviation `json:"deviation"`
+}
+
+// makeVehicleDeviationTracker builds vehicleDeviationTracker keeping historyDuration of each vehicle's deviations,
+// zero keeps no history
+func makeVehicleDeviationTracker(historyDuration time.Duration) *vehicleDeviationTracker {
+	return &vehicleDeviationTracker{
+		mu:              sync.Mutex{},
+		vehicles:        make(map[string]*vehicleDeviationState),
+		history:         make(map[string][]*gtfs.TripDeviation),
+		historyDuration: historyDuration,
+	}
+}
+
+// record keeps the first of deviations, which is the trip the vehicle is currently on, as the vehicle's last deviation
+// and adds it to the vehicle's history, removing deviations older than historyDuration before it.
+// a nil vehicleDeviationTracker ignores deviations
+func (v *vehicleDeviationTracker) record(at time.Time, deviations []*gtfs.TripDeviation) {
+	if v == nil || len(deviations) == 0 {
+		return
+	}
+	deviation := deviations[0]
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.vehicles[deviation.VehicleId] = &vehicleDeviationState{
+		VehicleId:  deviation.VehicleId,
+		ReceivedAt: at,
+		Deviation:  deviation,
+	}
+	if v.historyDuration <= 0 {
+		return
+	}
+	history := v.history[deviation.VehicleId]
+	// deviations received out of order are kept ordered by DeviationTimestamp
+	i := sort.Search(len(history), func(i int) bool {
+		return history[i].DeviationTimestamp.After(deviation.DeviationTimestamp)
+	})
+	history = append(history, nil)
+	copy(history[i+1:], history[i:])
+	history[i] = deviation
+	oldest := history[len(history)-1].DeviationTimestamp.Add(-v.historyDuration)
+	expired := sort.Search(len(history), func(i int) bool {
+		return !history[i].DeviationTimestamp.Before(oldest)
+	})
+	v.history[deviation.VehicleId] = history[expired:]
+}
+
+// GetRecentDeviations returns vehicleId's deviations with a DeviationTimestamp at or after since, ordered by
+// DeviationTimestamp. Only deviations within historyDuration of the vehicle's last deviation are kept, older history
+// is available from gtfs.GetRecentDeviations
+func (v *vehicleDeviationTracker) GetRecentDeviations(vehicleId string, since time.Time) []*gtfs.TripDeviation {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	history := v.history[vehicleId]
+	first := sort.Search(len(history), func(i int) bool {
+		return !history[i].DeviationTimestamp.Before(since)
+	})
+	results := make([]*gtfs.TripDeviation, len(history)-first)
+	copy(results, history[first:])
+	return results
+}
+
+// removeExpired removes vehicles that have not had a deviation received within maximumAge of "now"
+func (v *vehicleDeviationTracker) removeExpired(now time.Time, maximumAge time.Duration) {
+	if v == nil {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for vehicleId, state := range v.vehicles {
+		if now.Sub(state.ReceivedAt) > maximumAge {
+			delete(v.vehicles, vehicleId)
+			delete(v.history, vehicleId)
+		}
+	}
+}
+
+// snapshot returns the last deviation of each vehicle ordered by vehicle id
+func (v *vehicleDeviationTracker) snapshot() []*vehicleDeviationState {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	results := make([]*vehicleDeviationState, 0, len(v.vehicles))
+	for _, state := range v.vehicles {
+		results = append(results, state)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].VehicleId < results[j].VehicleId
+	})
+	return results
+}
+
+// tripPredictorState describes a cached tripPredictor
+type tripPredictorState struct {
+	DataSetId int64     `json:"data_set_id"`
+	TripId    string    `json:"trip_id"`
+	RouteId   string    `json:"route_id"`
+	Segments  int       `json:"segments"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// pendingBatchState describes a predictionBatch awaiting inference responses
+type pendingBatchState struct {
+	BatchId              string                   `json:"batch_id"`
+	CreatedAt            time.Time                `json:"created_at"`
+	ExpiresAt            time.Time                `json:"expires_at"`
+	PredictionsRemaining int                      `json:"predictions_remaining"`
+	InferenceRequests    []*inferenceRequestState `json:"inference_requests"`
+}
+
+// inferenceRequestState describes an InferenceRequest sent for a pending predictionBatch
+type inferenceRequestState struct {
+	RequestId string `json:"request_id"`
+	MLModelId int64  `json:"ml_model_id"`
+	Version   int    `json:"version"`
+	Shadow    bool   `json:"shadow"`
+}
+
+// aggregatorState is the internal state of the aggregator returned by the /debug/state endpoint
+type aggregatorState struct {
+	GeneratedAt    time.Time                `json:"generated_at"`
+	TripPredictors []*tripPredictorState    `json:"trip_predictors"`
+	Vehicles       []*vehicleDeviationState `json:"vehicles"`
+	PendingBatches []*pendingBatchState     `json:"pending_batches"`
+	// DeviationHistory is the recent deviations of the vehicle when limited to a vehicle_id
+	DeviationHistory []*gtfs.TripDeviation `json:"deviation_history,omitempty"`
+}
+
+// debugStateHandler serves aggregatorState as json so the reason a trip has stale predictions can be inspected.
+// results can be limited with trip_id and vehicle_id query parameters, limiting to a vehicle_id includes the vehicle's
+// recent deviation history
+type debugStateHandler struct {
+	log                *logger.Logger
+	predictors         *tripPredictorsCollection
+	pendingPredictions *pendingPredictionsCollection
+	vehicleDeviations  *vehicleDeviationTracker
+	clock              clock.Clock
+}
+
+func (d *debugStateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	state := d.buildState(d.clock.Now(), r.URL.Query().Get("trip_id"), r.URL.Query().Get("vehicle_id"))
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(state)
+	if err != nil {
+		d.log.Printf("Error writing debug state: %v\n", err)
+	}
+}
+
+// buildState collects aggregatorState at "now", limited to tripId and vehicleId when they are not empty
+func (d *debugStateHandler) buildState(now time.Time, tripId string, vehicleId string) *aggregatorState {
+	state := aggregatorState{
+		GeneratedAt:    now,
+		TripPredictors: make([]*tripPredictorState, 0),
+		Vehicles:       make([]*vehicleDeviationState, 0),
+	}
+	vehicleTrips := make(map[string]bool)
+	for _, vehicle := range d.vehicleDeviations.snapshot() {
+		if vehicleId != "" && vehicle.VehicleId != vehicleId {
+			continue
+		}
+		if tripId != "" && vehicle.Deviation.TripId != tripId {
+			continue
+		}
+		vehicleTrips[vehicle.Deviation.TripId] = true
+		state.Vehicles = append(state.Vehicles, vehicle)
+	}
+	for _, predictor := range d.predictors.snapshot() {
+		if tripId != "" && predictor.TripId != tripId {
+			continue
+		}
+		if vehicleId != "" && !vehicleTrips[predictor.TripId] {
+			continue
+		}
+		state.TripPredictors = append(state.TripPredictors, predictor)
+	}
+	state.PendingBatches = d.pendingPredictions.snapshot(tripId, vehicleId)
+	if vehicleId != "" {
+		state.DeviationHistory = d.vehicleDeviations.GetRecentDeviations(vehicleId, time.Time{})
+	}
+	return &state
+}
+
+// snapshot returns tripPredictorState of each cached tripPredictor ordered by trip id
+func (t *tripPredictorsCollection) snapshot() []*tripPredictorState {
+	t.locker.mu.Lock()
+	defer t.locker.mu.Unlock()
+	results := make([]*tripPredictorState, 0, len(t.locker.tripPredictorMap))
+	for _, predictor := range t.locker.tripPredictorMap {
+		trip := predictor.tripInstance
+		predictorState := tripPredictorState{
+			DataSetId: trip.DataSetId,
+			TripId:    trip.TripId,
+			RouteId:   trip.RouteId,
+			Segments:  len(predictor.segmentPredictors),
+		}
+		if expiresAt, present := t.eviction.expiresAt(trip); present {
+			predictorState.ExpiresAt = expiresAt
+		}
+		results = append(results, &predictorState)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].TripId < results[j].TripId
+	})
+	return results
+}
+
+// snapshot returns pendingBatchState of each pending predictionBatch, limited to batches containing a prediction for
+// tripId and made for vehicleId when they are not empty
+func (p *pendingPredictionsCollection) snapshot(tripId string, vehicleId string) []*pendingBatchState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	results := make([]*pendingBatchState, 0)
+	for _, pending := range p.pendingList {
+		batch := pending.predictionBatch
+		if !batchMatches(batch, tripId, vehicleId) {
+			continue
+		}
+		batchState := pendingBatchState{
+			BatchId:              batch.id,
+			CreatedAt:            batch.createdAt,
+			ExpiresAt:            pending.expireTime,
+			PredictionsRemaining: batch.predictionsRemaining(),
+			InferenceRequests:    make([]*inferenceRequestState, 0),
+		}
+		for _, request := range batch.allInferenceRequests() {
+			batchState.InferenceRequests = append(batchState.InferenceRequests, &inferenceRequestState{
+				RequestId: request.RequestId,
+				MLModelId: request.MLModelId,
+				Version:   request.Version,
+				Shadow:    request.shadow,
+			})
+		}
+		results = append(results, &batchState)
+	}
+	return results
+}
+
+// batchMatches returns true if batch contains a prediction on tripId made for vehicleId, empty values match any
+func batchMatches(batch *predictionBatch, tripId string, vehicleId string) bool {
+	if tripId == "" && vehicleId == "" {
+		return true
+	}
+	for _, pendingTrip := range batch.pendingTripPredictions {
+		deviation := pendingTrip.tripPrediction.tripDeviation
+		if (tripId == "" || pendingTrip.tripPrediction.tripInstance.TripId == tripId) &&
+			(vehicleId == "" || deviation.VehicleId == vehicleId) {
+			return true
+		}
+	}
+	return false
+}
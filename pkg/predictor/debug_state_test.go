@@ -0,0 +1,159 @@
+package predictor
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/foundation/clock"
+	logger "log"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_debugStateHandler(t *testing.T) {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Errorf("Unable to get testing time zone location")
+		return
+	}
+	serviceDate := time.Date(2022, 5, 22, 0, 0, 0, 0, location)
+	at := time.Date(2022, 5, 22, 12, 30, 0, 0, location)
+	trip1 := getTestTrip(serviceDate, "trip_instance_1.json", t)
+
+	collection, err := makeTripPredictorsCollection(&testTripPredictorsDataProvider{
+		tripInstances: map[string]*gtfs.TripInstance{trip1.TripId: trip1},
+	}, makeObservedStopTransitions(3600, 0, 0), 0.0, 1, &predictorEvictionPolicy{defaultMargin: time.Hour}, 60, true,
+		true, nil, false, false, nil)
+	if err != nil {
+		t.Errorf("unable to make tripPredictorsCollection: %v", err)
+		return
+	}
+	deviation := &gtfs.TripDeviation{DataSetId: trip1.DataSetId, TripId: trip1.TripId, VehicleId: "1",
+		DeviationTimestamp: at}
+	_, err = collection.retrieveTripPredictor(context.Background(), deviation)
+	if err != nil {
+		t.Errorf("unable to load trip predictor: %v", err)
+		return
+	}
+
+	vehicleDeviations := makeVehicleDeviationTracker(time.Hour)
+	vehicleDeviations.record(at, []*gtfs.TripDeviation{deviation})
+	vehicleDeviations.record(at.Add(-time.Hour), []*gtfs.TripDeviation{{TripId: "other", VehicleId: "2"}})
+
+	pendingPredictions := makePendingPredictionsCollection(30, false)
+	batch := makePredictionBatch(at, "1")
+	batch.addPendingTripPrediction(makeTripPrediction(deviation, trip1, nil),
+		[]*InferenceRequest{{RequestId: "request", MLModelId: 5, Version: 2}})
+	pendingPredictions.addPendingPredictionBatch(at, batch)
+
+	handler := &debugStateHandler{
+		log:                logger.New(os.Stdout, "test", 0),
+		predictors:         collection,
+		pendingPredictions: pendingPredictions,
+		vehicleDeviations:  vehicleDeviations,
+		clock:              clock.NewManual(at),
+	}
+
+	tests := []struct {
+		name               string
+		query              string
+		wantVehicles       int
+		wantTripPredictors int
+		wantPendingBatches int
+		wantHistory        int
+	}{
+		{
+			name:               "all state",
+			wantVehicles:       2,
+			wantTripPredictors: 1,
+			wantPendingBatches: 1,
+		},
+		{
+			name:               "filtered by vehicle",
+			query:              "?vehicle_id=1",
+			wantVehicles:       1,
+			wantTripPredictors: 1,
+			wantPendingBatches: 1,
+			wantHistory:        1,
+		},
+		{
+			name:         "filtered by trip without predictor",
+			query:        "?trip_id=other",
+			wantVehicles: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/state"+tt.query, nil))
+			var got aggregatorState
+			err := json.NewDecoder(recorder.Body).Decode(&got)
+			if err != nil {
+				t.Errorf("unable to decode debug state: %v", err)
+				return
+			}
+			if len(got.Vehicles) != tt.wantVehicles {
+				t.Errorf("got %d vehicles, want %d", len(got.Vehicles), tt.wantVehicles)
+			}
+			if len(got.TripPredictors) != tt.wantTripPredictors {
+				t.Errorf("got %d trip predictors, want %d", len(got.TripPredictors), tt.wantTripPredictors)
+			}
+			if len(got.PendingBatches) != tt.wantPendingBatches {
+				t.Errorf("got %d pending batches, want %d", len(got.PendingBatches), tt.wantPendingBatches)
+			}
+			if len(got.DeviationHistory) != tt.wantHistory {
+				t.Errorf("got %d deviations in history, want %d", len(got.DeviationHistory), tt.wantHistory)
+			}
+			if tt.wantPendingBatches > 0 && got.PendingBatches[0].InferenceRequests[0].MLModelId != 5 {
+				t.Errorf("got pending inference requests %+v", got.PendingBatches[0].InferenceRequests)
+			}
+		})
+	}
+
+	vehicleDeviations.removeExpired(at, 30*time.Minute)
+	if remaining := len(vehicleDeviations.snapshot()); remaining != 1 {
+		t.Errorf("removeExpired() left %d vehicles, want 1", remaining)
+	}
+}
+
+func Test_vehicleDeviationTracker_GetRecentDeviations(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	tracker := makeVehicleDeviationTracker(10 * time.Minute)
+	record := func(vehicleId string, minutes int) *gtfs.TripDeviation {
+		deviation := &gtfs.TripDeviation{VehicleId: vehicleId,
+			DeviationTimestamp: at.Add(time.Duration(minutes) * time.Minute)}
+		tracker.record(deviation.DeviationTimestamp, []*gtfs.TripDeviation{deviation})
+		return deviation
+	}
+	expired := record("1", 0)
+	second := record("1", 4)
+	fourth := record("1", 8)
+	// received out of order
+	third := record("1", 6)
+	other := record("2", 6)
+	if got := tracker.GetRecentDeviations("1", at); !reflect.DeepEqual(got,
+		[]*gtfs.TripDeviation{expired, second, third, fourth}) {
+		t.Errorf("GetRecentDeviations() = %v, want all deviations in order", got)
+	}
+	if got := tracker.GetRecentDeviations("1", at.Add(5*time.Minute)); !reflect.DeepEqual(got,
+		[]*gtfs.TripDeviation{third, fourth}) {
+		t.Errorf("GetRecentDeviations() = %v, want deviations since 5 minutes", got)
+	}
+
+	last := record("1", 12)
+	if got := tracker.GetRecentDeviations("1", at); !reflect.DeepEqual(got,
+		[]*gtfs.TripDeviation{second, third, fourth, last}) {
+		t.Errorf("GetRecentDeviations() = %v, want deviations older than 10 minutes removed", got)
+	}
+	if got := tracker.GetRecentDeviations("2", at); !reflect.DeepEqual(got, []*gtfs.TripDeviation{other}) {
+		t.Errorf("GetRecentDeviations() = %v, want the other vehicle's deviation", got)
+	}
+
+	tracker.removeExpired(at.Add(20*time.Minute), 10*time.Minute)
+	if got := tracker.GetRecentDeviations("2", at); len(got) != 0 {
+		t.Errorf("GetRecentDeviations() = %v, want no history for an expired vehicle", got)
+	}
+}
@@ -0,0 +1,212 @@
+package predictor
+
+import (
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	logger "log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// delaySmoothing is how a trip's delay is smoothed between TripUpdates. factor is the weight given to the newest
+// delay, one uses it unchanged. Changes of no more than hysteresis from the last published delay are ignored
+type delaySmoothing struct {
+	factor     float64
+	hysteresis time.Duration
+}
+
+// enabled returns true if delaySmoothing changes any delay
+func (d delaySmoothing) enabled() bool {
+	return d.factor < 1 || d.hysteresis > 0
+}
+
+// smoothedTrip is the delay last published for a trip after smoothing
+type smoothedTrip struct {
+	at        time.Time
+	vehicleId string
+	delay     float64
+}
+
+// delaySmoother prevents predictions from oscillating between TripUpdates by smoothing the delay of each trip, the
+// delay at the next stop the vehicle arrives at, and shifting the trip's future stops by the change. A nil
+// delaySmoother leaves TripUpdates unchanged
+type delaySmoother struct {
+	log            *logger.Logger
+	mu             sync.Mutex
+	defaultSetting delaySmoothing
+	routeSettings  map[string]delaySmoothing
+	trips          map[string]*smoothedTrip
+	lastPruned     time.Time
+}
+
+// makeDelaySmoother builds delaySmoother from the default factor and hysteresisSeconds, and routeSettings, a list of
+// route_id, factor and hysteresis seconds separated by colons, for example "100:0.5:30", overriding the default for the
+// route. returns nil when no setting smooths delays
+func makeDelaySmoother(log *logger.Logger,
+	factor float64,
+	hysteresisSeconds int,
+	routeSettings []string) (*delaySmoother, error) {
+	defaultSetting, err := makeDelaySmoothing(factor, hysteresisSeconds)
+	if err != nil {
+		return nil, err
+	}
+	enabled := defaultSetting.enabled()
+	routes := make(map[string]delaySmoothing)
+	for _, value := range routeSettings {
+		parts := strings.Split(value, ":")
+		if len(parts) != 3 || len(parts[0]) == 0 {
+			return nil, fmt.Errorf("expected route delay smoothing as route_id:factor:seconds, found %q", value)
+		}
+		routeFactor, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid delay smoothing factor for route %s: %q", parts[0], parts[1])
+		}
+		routeHysteresis, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid delay hysteresis seconds for route %s: %q", parts[0], parts[2])
+		}
+		routes[parts[0]], err = makeDelaySmoothing(routeFactor, routeHysteresis)
+		if err != nil {
+			return nil, fmt.Errorf("invalid delay smoothing for route %s: %w", parts[0], err)
+		}
+		enabled = enabled || routes[parts[0]].enabled()
+	}
+	if !enabled {
+		return nil, nil
+	}
+	return &delaySmoother{
+		log:            log,
+		defaultSetting: defaultSetting,
+		routeSettings:  routes,
+		trips:          make(map[string]*smoothedTrip),
+	}, nil
+}
+
+// makeDelaySmoothing builds delaySmoothing, factor must be greater than zero and no more than one
+func makeDelaySmoothing(factor float64, hysteresisSeconds int) (delaySmoothing, error) {
+	if factor <= 0 || factor > 1 {
+		return delaySmoothing{}, fmt.Errorf("delay smoothing factor must be greater than 0 and at most 1, found %v",
+			factor)
+	}
+	if hysteresisSeconds < 0 {
+		return delaySmoothing{}, fmt.Errorf("delay hysteresis seconds can not be negative, found %d",
+			hysteresisSeconds)
+	}
+	return delaySmoothing{factor: factor, hysteresis: time.Duration(hysteresisSeconds) * time.Second}, nil
+}
+
+// setting returns the delaySmoothing used for routeId
+func (d *delaySmoother) setting(routeId string) delaySmoothing {
+	if setting, present := d.routeSettings[routeId]; present {
+		return setting
+	}
+	return d.defaultSetting
+}
+
+// smooth shifts the future stops of tripUpdate built at "now" by the difference between the trip's delay and its
+// smoothed delay, remembering the smoothed delay for the next TripUpdate of the trip. Stops are not shifted before the
+// vehicle's position timestamp, and are only predicted earlier than scheduled when they were before smoothing
+func (d *delaySmoother) smooth(tripUpdate *gtfs.TripUpdate, now time.Time) {
+	if d == nil {
+		return
+	}
+	setting := d.setting(tripUpdate.RouteId)
+	if !setting.enabled() {
+		return
+	}
+	timestamp := time.Unix(int64(tripUpdate.Timestamp), 0)
+	first := -1
+	for i, stopTimeUpdate := range tripUpdate.StopTimeUpdates {
+		if stopTimeUpdate.PredictedArrivalTime.After(timestamp) {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return
+	}
+	futureStops := tripUpdate.StopTimeUpdates[first:]
+	rawDelay := futureStops[0].ArrivalDelay
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.prune(now)
+	smoothed := float64(rawDelay)
+	last, present := d.trips[tripUpdate.TripId]
+	if present && last.vehicleId == tripUpdate.VehicleId {
+		change := float64(rawDelay) - last.delay
+		if math.Abs(change) <= setting.hysteresis.Seconds() {
+			smoothed = last.delay
+		} else {
+			smoothed = last.delay + setting.factor*change
+		}
+	}
+	shift := int(math.Round(smoothed)) - rawDelay
+	if shift < 0 {
+		shift = maxInt(shift, minimumDelayShift(futureStops, timestamp))
+	}
+	d.trips[tripUpdate.TripId] = &smoothedTrip{
+		at:        now,
+		vehicleId: tripUpdate.VehicleId,
+		delay:     float64(rawDelay + shift),
+	}
+	if shift == 0 {
+		return
+	}
+	d.log.Printf("Smoothed delay of trip %s on vehicle %s from %d to %d seconds\n", tripUpdate.TripId,
+		tripUpdate.VehicleId, rawDelay, rawDelay+shift)
+	for i := range futureStops {
+		shiftStopTimeUpdate(&futureStops[i], shift)
+	}
+}
+
+// minimumDelayShift returns the most futureStops can be shifted earlier without predicting the first before
+// timestamp or any stop earlier than scheduled that was not already
+func minimumDelayShift(futureStops []gtfs.StopTimeUpdate, timestamp time.Time) int {
+	minimum := -int(futureStops[0].PredictedArrivalTime.Sub(timestamp).Seconds())
+	for _, stopTimeUpdate := range futureStops {
+		minimum = maxInt(minimum, -maxInt(stopTimeUpdate.ArrivalDelay, 0))
+		if stopTimeUpdate.DepartureDelay != nil {
+			minimum = maxInt(minimum, -maxInt(*stopTimeUpdate.DepartureDelay, 0))
+		}
+	}
+	return minimum
+}
+
+// shiftStopTimeUpdate moves the predicted arrival and departure of stopTimeUpdate by seconds
+func shiftStopTimeUpdate(stopTimeUpdate *gtfs.StopTimeUpdate, seconds int) {
+	shift := time.Duration(seconds) * time.Second
+	stopTimeUpdate.PredictedArrivalTime = stopTimeUpdate.PredictedArrivalTime.Add(shift)
+	stopTimeUpdate.ArrivalDelay += seconds
+	if stopTimeUpdate.PredictedDepartureTime != nil {
+		departure := stopTimeUpdate.PredictedDepartureTime.Add(shift)
+		stopTimeUpdate.PredictedDepartureTime = &departure
+	}
+	if stopTimeUpdate.DepartureDelay != nil {
+		departureDelay := *stopTimeUpdate.DepartureDelay + seconds
+		stopTimeUpdate.DepartureDelay = &departureDelay
+	}
+}
+
+// prune forgets trips not smoothed within publishedTripUpdateRetention, checking at most once a minute
+func (d *delaySmoother) prune(now time.Time) {
+	if now.Sub(d.lastPruned) < time.Minute {
+		return
+	}
+	d.lastPruned = now
+	for tripId, trip := range d.trips {
+		if now.Sub(trip.at) > publishedTripUpdateRetention {
+			delete(d.trips, tripId)
+		}
+	}
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
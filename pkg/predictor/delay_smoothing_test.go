@@ -0,0 +1,120 @@
+package predictor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"io"
+	logger "log"
+	"testing"
+	"time"
+)
+
+// makeSmoothingTestTripUpdate builds a TripUpdate on route "100" at timestamp with a passed stop, and three future
+// stops scheduled two minutes apart predicted delaySeconds late
+func makeSmoothingTestTripUpdate(tripId string,
+	vehicleId string,
+	timestamp time.Time,
+	delaySeconds int) *gtfs.TripUpdate {
+	tripUpdate := &gtfs.TripUpdate{
+		TripId:    tripId,
+		RouteId:   "100",
+		VehicleId: vehicleId,
+		Timestamp: uint64(timestamp.Unix()),
+	}
+	for i := -1; i < 3; i++ {
+		scheduled := timestamp.Add(time.Duration(2*i+2) * time.Minute)
+		if i < 0 {
+			scheduled = timestamp.Add(-5 * time.Minute)
+		}
+		tripUpdate.StopTimeUpdates = append(tripUpdate.StopTimeUpdates, gtfs.StopTimeUpdate{
+			StopSequence:         uint32(i + 2),
+			ArrivalDelay:         delaySeconds,
+			ScheduledArrivalTime: scheduled,
+			PredictedArrivalTime: scheduled.Add(time.Duration(delaySeconds) * time.Second),
+		})
+	}
+	return tripUpdate
+}
+
+func Test_delaySmoother_smooth(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	smoother, err := makeDelaySmoother(logger.New(io.Discard, "test", 0), 0.5, 10, []string{"200:1:0"})
+	if err != nil {
+		t.Fatalf("makeDelaySmoother() error = %v", err)
+	}
+	tests := []struct {
+		name         string
+		tripId       string
+		vehicleId    string
+		routeId      string
+		delaySeconds int
+		wantDelay    int
+	}{
+		{name: "first update is unchanged", tripId: "1", vehicleId: "1", delaySeconds: 60, wantDelay: 60},
+		{name: "change within hysteresis", tripId: "1", vehicleId: "1", delaySeconds: 66, wantDelay: 60},
+		{name: "increase is smoothed", tripId: "1", vehicleId: "1", delaySeconds: 120, wantDelay: 90},
+		{name: "decrease is smoothed", tripId: "1", vehicleId: "1", delaySeconds: -20, wantDelay: 35},
+		{name: "new vehicle is unchanged", tripId: "1", vehicleId: "2", delaySeconds: -30, wantDelay: -30},
+		{name: "not shifted earlier than schedule", tripId: "1", vehicleId: "2", delaySeconds: 0, wantDelay: 0},
+		{name: "route without smoothing", tripId: "3", vehicleId: "3", routeId: "200", delaySeconds: 60,
+			wantDelay: 60},
+		{name: "route without smoothing changes", tripId: "3", vehicleId: "3", routeId: "200", delaySeconds: 120,
+			wantDelay: 120},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timestamp := at.Add(time.Duration(i) * 10 * time.Second)
+			tripUpdate := makeSmoothingTestTripUpdate(tt.tripId, tt.vehicleId, timestamp, tt.delaySeconds)
+			if tt.routeId != "" {
+				tripUpdate.RouteId = tt.routeId
+			}
+			smoother.smooth(tripUpdate, timestamp)
+			passed := tripUpdate.StopTimeUpdates[0]
+			if passed.ArrivalDelay != tt.delaySeconds {
+				t.Errorf("smooth() changed passed stop delay to %d, want %d", passed.ArrivalDelay, tt.delaySeconds)
+			}
+			for _, stopTimeUpdate := range tripUpdate.StopTimeUpdates[1:] {
+				wantArrival := stopTimeUpdate.ScheduledArrivalTime.Add(time.Duration(tt.wantDelay) * time.Second)
+				if stopTimeUpdate.ArrivalDelay != tt.wantDelay ||
+					!stopTimeUpdate.PredictedArrivalTime.Equal(wantArrival) {
+					t.Errorf("smooth() stop %d delay = %d arrival = %v, want %d arrival %v",
+						stopTimeUpdate.StopSequence, stopTimeUpdate.ArrivalDelay,
+						stopTimeUpdate.PredictedArrivalTime, tt.wantDelay, wantArrival)
+				}
+			}
+		})
+	}
+}
+
+func Test_makeDelaySmoother(t *testing.T) {
+	log := logger.New(io.Discard, "test", 0)
+	tests := []struct {
+		name          string
+		factor        float64
+		hysteresis    int
+		routeSettings []string
+		wantNil       bool
+		wantErr       bool
+	}{
+		{name: "disabled", factor: 1, wantNil: true},
+		{name: "default factor", factor: 0.5},
+		{name: "default hysteresis", factor: 1, hysteresis: 30},
+		{name: "route only", factor: 1, routeSettings: []string{"100:0.3:0"}},
+		{name: "route disabled", factor: 1, routeSettings: []string{"100:1:0"}, wantNil: true},
+		{name: "zero factor", factor: 0, wantErr: true},
+		{name: "negative hysteresis", factor: 1, hysteresis: -1, wantErr: true},
+		{name: "malformed route", factor: 1, routeSettings: []string{"100:0.5"}, wantErr: true},
+		{name: "invalid route factor", factor: 1, routeSettings: []string{"100:fast:0"}, wantErr: true},
+		{name: "route factor out of range", factor: 1, routeSettings: []string{"100:1.5:0"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := makeDelaySmoother(log, tt.factor, tt.hysteresis, tt.routeSettings)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("makeDelaySmoother() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (got == nil) != tt.wantNil {
+				t.Errorf("makeDelaySmoother() = %v, wantNil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+// Package predictor is the aggregation and prediction pipeline run by gtfs-aggregator. It listens to the
+// vehicle-monitor-results published by gtfs-monitor, requests model inference and publishes the predicted
+// gtfs.TripUpdate of each trip, so it can be embedded into a single binary alongside the other services.
+//
+// Run starts the pipeline with an open database and NATS connection and blocks until its context is done:
+//
+//	ctx, cancel := context.WithCancel(context.Background())
+//	defer cancel()
+//	err := predictor.Run(ctx, log, db, natsConn, predictor.Conf{
+//		ExpirePredictionSeconds:  8,
+//		ExpirePredictorSeconds:   3600,
+//		PredictionSubject:        "trip-update-prediction",
+//		InferenceTransport:       predictor.InferenceTransportInProcess,
+//		MaximumPredictionMinutes: 60,
+//		MakePredictions:          true,
+//		UseStatistics:            true,
+//		QueryTimeoutSeconds:      30,
+//		InProcessInference: predictor.InProcessInferenceConf{
+//			ModelDirectory: "/var/lib/transitcast/models",
+//		},
+//	})
+//
+// Conf has no defaults of its own, the defaults of gtfs-aggregator's configuration are a reasonable starting point.
+// Running inference in process removes the need for a separate inference service. SimulatePrediction predicts a
+// single trip without the pipeline.
+package predictor
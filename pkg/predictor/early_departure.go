@@ -0,0 +1,139 @@
+package predictor
+
+import (
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"strings"
+	"time"
+)
+
+// Policies for vehicles predicted to depart stops that aren't timepoints ahead of schedule
+const (
+	// NonTimepointEarlyDepartureAllow predicts vehicles depart stops between timepoints as early as they arrive
+	NonTimepointEarlyDepartureAllow = "allow"
+	// NonTimepointEarlyDepartureSchedule predicts vehicles depart stops between timepoints no earlier than scheduled
+	NonTimepointEarlyDepartureSchedule = "schedule"
+	// NonTimepointEarlyDepartureLimit predicts vehicles depart stops between timepoints no earlier than the
+	// non-timepoint limit
+	NonTimepointEarlyDepartureLimit = "limit"
+)
+
+// earlyDepartureLimits provides how far ahead of schedule a vehicle may be predicted to depart a timepoint.
+// Modes that hold at timepoints, such as rail, can be given a different limit by route_type, and routes by route_id.
+// Departures from other stops are allowed early unless the nonTimepointPolicy for the route is schedule or limit
+type earlyDepartureLimits struct {
+	defaultLimit              time.Duration
+	routeTypeLimits           map[int]time.Duration
+	routeLimits               map[string]time.Duration
+	nonTimepointPolicy        string
+	nonTimepointLimit         time.Duration
+	routeNonTimepointPolicies map[string]string
+}
+
+// earlyDepartureLimit is the number of seconds a trip may be predicted to depart its stops early
+type earlyDepartureLimit struct {
+	timepointSeconds int
+	//limitNonTimepoints applies nonTimepointSeconds to stops that aren't timepoints, otherwise they are not limited
+	limitNonTimepoints  bool
+	nonTimepointSeconds int
+}
+
+// makeEarlyDepartureLimits builds earlyDepartureLimits from defaultSeconds and routeTypeSeconds, a list of route_type
+// and seconds separated by a colon, for example "0:0", overriding the default for trips with the route_type.
+// routeSeconds lists route_id:seconds overriding both for the route.
+// nonTimepointPolicy is NonTimepointEarlyDepartureAllow, NonTimepointEarlyDepartureSchedule or
+// NonTimepointEarlyDepartureLimit, using nonTimepointSeconds, and is overridden for routes in routeNonTimepointPolicies
+// as route_id:policy
+func makeEarlyDepartureLimits(defaultSeconds int,
+	routeTypeSeconds []string,
+	routeSeconds []string,
+	nonTimepointPolicy string,
+	nonTimepointSeconds int,
+	routeNonTimepointPolicies []string) (*earlyDepartureLimits, error) {
+	routeTypeLimits, err := parseRouteTypeDurations("early departure limit", routeTypeSeconds)
+	if err != nil {
+		return nil, err
+	}
+	routeLimits, err := parseRouteDurations("early departure limit", routeSeconds)
+	if err != nil {
+		return nil, err
+	}
+	if nonTimepointPolicy == "" {
+		nonTimepointPolicy = NonTimepointEarlyDepartureAllow
+	}
+	if err = validateNonTimepointPolicy(nonTimepointPolicy); err != nil {
+		return nil, err
+	}
+	if nonTimepointSeconds < 0 {
+		return nil, fmt.Errorf("non-timepoint early departure limit must not be negative, received %d",
+			nonTimepointSeconds)
+	}
+	routePolicies := make(map[string]string)
+	for _, value := range routeNonTimepointPolicies {
+		routeId, policy, found := strings.Cut(value, ":")
+		if !found || len(routeId) == 0 {
+			return nil, fmt.Errorf("expected route non-timepoint early departure policy as route_id:policy, found %q",
+				value)
+		}
+		if err = validateNonTimepointPolicy(policy); err != nil {
+			return nil, fmt.Errorf("route %s: %w", routeId, err)
+		}
+		routePolicies[routeId] = policy
+	}
+	return &earlyDepartureLimits{
+		defaultLimit:              time.Duration(defaultSeconds) * time.Second,
+		routeTypeLimits:           routeTypeLimits,
+		routeLimits:               routeLimits,
+		nonTimepointPolicy:        nonTimepointPolicy,
+		nonTimepointLimit:         time.Duration(nonTimepointSeconds) * time.Second,
+		routeNonTimepointPolicies: routePolicies,
+	}, nil
+}
+
+// validateNonTimepointPolicy returns an error when policy isn't a known non-timepoint early departure policy
+func validateNonTimepointPolicy(policy string) error {
+	switch policy {
+	case NonTimepointEarlyDepartureAllow, NonTimepointEarlyDepartureSchedule, NonTimepointEarlyDepartureLimit:
+		return nil
+	}
+	return fmt.Errorf("unknown non-timepoint early departure policy %q, expected %s, %s or %s", policy,
+		NonTimepointEarlyDepartureAllow, NonTimepointEarlyDepartureSchedule, NonTimepointEarlyDepartureLimit)
+}
+
+// limitSeconds returns the seconds trip may be predicted to depart a timepoint early
+func (l *earlyDepartureLimits) limitSeconds(trip *gtfs.TripInstance) int {
+	if limit, present := l.routeLimits[trip.RouteId]; present {
+		return int(limit.Seconds())
+	}
+	if trip.RouteType != nil {
+		if limit, present := l.routeTypeLimits[*trip.RouteType]; present {
+			return int(limit.Seconds())
+		}
+	}
+	return int(l.defaultLimit.Seconds())
+}
+
+// limit returns how early trip may be predicted to depart its timepoints and other stops
+func (l *earlyDepartureLimits) limit(trip *gtfs.TripInstance) earlyDepartureLimit {
+	limit := earlyDepartureLimit{timepointSeconds: l.limitSeconds(trip)}
+	policy := l.nonTimepointPolicy
+	if routePolicy, present := l.routeNonTimepointPolicies[trip.RouteId]; present {
+		policy = routePolicy
+	}
+	switch policy {
+	case NonTimepointEarlyDepartureSchedule:
+		limit.limitNonTimepoints = true
+	case NonTimepointEarlyDepartureLimit:
+		limit.limitNonTimepoints = true
+		limit.nonTimepointSeconds = int(l.nonTimepointLimit.Seconds())
+	}
+	return limit
+}
+
+// seconds returns how many seconds early a vehicle may depart stopTime, and false when departures aren't limited
+func (l earlyDepartureLimit) seconds(stopTime *gtfs.StopTimeInstance) (int, bool) {
+	if stopTime.IsTimepoint() {
+		return l.timepointSeconds, true
+	}
+	return l.nonTimepointSeconds, l.limitNonTimepoints
+}
@@ -0,0 +1,111 @@
+package predictor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"testing"
+)
+
+func Test_earlyDepartureLimits_limitSeconds(t *testing.T) {
+	limits, err := makeEarlyDepartureLimits(60, []string{"0:0", "2:30"}, nil, "", 0, nil)
+	if err != nil {
+		t.Fatalf("makeEarlyDepartureLimits() error = %v", err)
+	}
+	tests := []struct {
+		name string
+		trip *gtfs.TripInstance
+		want int
+	}{
+		{
+			name: "light rail",
+			trip: withRouteType(&gtfs.TripInstance{}, 0),
+			want: 0,
+		},
+		{
+			name: "commuter rail",
+			trip: withRouteType(&gtfs.TripInstance{}, 2),
+			want: 30,
+		},
+		{
+			name: "bus uses default",
+			trip: withRouteType(&gtfs.TripInstance{}, 3),
+			want: 60,
+		},
+		{
+			name: "unknown route type uses default",
+			trip: &gtfs.TripInstance{},
+			want: 60,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limits.limitSeconds(tt.trip); got != tt.want {
+				t.Errorf("limitSeconds() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_makeEarlyDepartureLimits_invalid(t *testing.T) {
+	for _, routeTypeSeconds := range []string{"0", "rail:0", "0:early", "0:-60"} {
+		if _, err := makeEarlyDepartureLimits(60, []string{routeTypeSeconds}, nil, "", 0, nil); err == nil {
+			t.Errorf("makeEarlyDepartureLimits(%q) expected error", routeTypeSeconds)
+		}
+	}
+}
+
+func Test_earlyDepartureLimits_limit(t *testing.T) {
+	limits, err := makeEarlyDepartureLimits(60, []string{"0:0"}, []string{"100:0"}, NonTimepointEarlyDepartureLimit,
+		30, []string{"100:schedule", "90:allow"})
+	if err != nil {
+		t.Fatalf("makeEarlyDepartureLimits() error = %v", err)
+	}
+	tests := []struct {
+		name string
+		trip *gtfs.TripInstance
+		want earlyDepartureLimit
+	}{
+		{
+			name: "bus uses default limits",
+			trip: withRouteType(&gtfs.TripInstance{Trip: gtfs.Trip{RouteId: "20"}}, 3),
+			want: earlyDepartureLimit{timepointSeconds: 60, limitNonTimepoints: true, nonTimepointSeconds: 30},
+		},
+		{
+			name: "route forbidding early departures at all stops",
+			trip: withRouteType(&gtfs.TripInstance{Trip: gtfs.Trip{RouteId: "100"}}, 3),
+			want: earlyDepartureLimit{timepointSeconds: 0, limitNonTimepoints: true},
+		},
+		{
+			name: "route allowing early departures between timepoints",
+			trip: withRouteType(&gtfs.TripInstance{Trip: gtfs.Trip{RouteId: "90"}}, 0),
+			want: earlyDepartureLimit{timepointSeconds: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limits.limit(tt.trip); got != tt.want {
+				t.Errorf("limit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_makeEarlyDepartureLimits_invalidNonTimepointPolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        string
+		seconds       int
+		routePolicies []string
+	}{
+		{name: "unknown policy", policy: "clamp"},
+		{name: "negative limit", policy: NonTimepointEarlyDepartureLimit, seconds: -30},
+		{name: "route policy without route", routePolicies: []string{"schedule"}},
+		{name: "unknown route policy", routePolicies: []string{"100:never"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := makeEarlyDepartureLimits(60, nil, nil, tt.policy, tt.seconds, tt.routePolicies); err == nil {
+				t.Errorf("makeEarlyDepartureLimits() expected error")
+			}
+		})
+	}
+}
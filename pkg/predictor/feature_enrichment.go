@@ -0,0 +1,154 @@
+package predictor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	logger "log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// featureEnricher supplies external features added to every InferenceRequest, such as current weather conditions
+type featureEnricher interface {
+	// enrichmentFeatures returns the external features for the next InferenceRequest, always the same number of values
+	enrichmentFeatures() []float64
+}
+
+// WeatherEnrichmentConf contains parameters for adding current weather conditions to inference requests
+type WeatherEnrichmentConf struct {
+	//URL of a weather API returning current conditions as json, weather enrichment is disabled when empty
+	URL string
+	//FeaturePaths are the dot separated paths to each numeric value in the json response used as a feature,
+	//for example "current.precipitation"
+	FeaturePaths []string
+	//CacheSeconds is how long weather conditions are used before they are retrieved again
+	CacheSeconds int
+	//TimeoutMilliseconds is the deadline for each request to the weather API
+	TimeoutMilliseconds int
+}
+
+// weatherFeatureEnricher retrieves current weather conditions from a weather API and caches them as features
+type weatherFeatureEnricher struct {
+	mu            sync.Mutex
+	client        *http.Client
+	url           string
+	featurePaths  [][]string
+	cacheDuration time.Duration
+	values        []float64
+}
+
+// makeWeatherFeatureEnricher builds weatherFeatureEnricher, features are zero until conditions are first retrieved
+func makeWeatherFeatureEnricher(conf WeatherEnrichmentConf) (*weatherFeatureEnricher, error) {
+	if len(conf.FeaturePaths) == 0 {
+		return nil, fmt.Errorf("weather enrichment requires at least one feature path")
+	}
+	if conf.CacheSeconds <= 0 {
+		return nil, fmt.Errorf("weather enrichment cache seconds must be positive, was %d", conf.CacheSeconds)
+	}
+	featurePaths := make([][]string, 0, len(conf.FeaturePaths))
+	for _, path := range conf.FeaturePaths {
+		featurePaths = append(featurePaths, strings.Split(path, "."))
+	}
+	return &weatherFeatureEnricher{
+		mu:            sync.Mutex{},
+		client:        &http.Client{Timeout: time.Duration(conf.TimeoutMilliseconds) * time.Millisecond},
+		url:           conf.URL,
+		featurePaths:  featurePaths,
+		cacheDuration: time.Duration(conf.CacheSeconds) * time.Second,
+		values:        make([]float64, len(featurePaths)),
+	}, nil
+}
+
+// enrichmentFeatures returns the last weather conditions retrieved
+func (w *weatherFeatureEnricher) enrichmentFeatures() []float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	features := make([]float64, len(w.values))
+	copy(features, w.values)
+	return features
+}
+
+// refresh retrieves current weather conditions, the previous conditions are kept if they can't be retrieved
+func (w *weatherFeatureEnricher) refresh(ctx context.Context) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, w.url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := w.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve weather conditions: %w", err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("weather API returned status %d", response.StatusCode)
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read weather conditions: %w", err)
+	}
+	values, err := parseWeatherFeatures(body, w.featurePaths)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.values = values
+	return nil
+}
+
+// parseWeatherFeatures finds the numeric value at each of featurePaths in the json document body
+func parseWeatherFeatures(body []byte, featurePaths [][]string) ([]float64, error) {
+	var document interface{}
+	err := json.Unmarshal(body, &document)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse weather conditions: %w", err)
+	}
+	values := make([]float64, 0, len(featurePaths))
+	for _, path := range featurePaths {
+		element := document
+		for _, key := range path {
+			object, ok := element.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("weather conditions have no object at %s", strings.Join(path, "."))
+			}
+			element = object[key]
+		}
+		value, ok := element.(float64)
+		if !ok {
+			return nil, fmt.Errorf("weather conditions have no number at %s", strings.Join(path, "."))
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// runWeatherFeatureRefresh retrieves weather conditions for enricher each time its cache expires
+func runWeatherFeatureRefresh(ctx context.Context,
+	log *logger.Logger,
+	wg *sync.WaitGroup,
+	enricher *weatherFeatureEnricher,
+	shutdownSignal chan bool) {
+	wg.Add(1)
+	defer wg.Done()
+
+	ticker := time.NewTicker(enricher.cacheDuration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-shutdownSignal:
+			log.Printf("Exiting weather feature refresh on shutdown signal")
+			return
+		case <-ticker.C:
+			err := enricher.refresh(ctx)
+			if err != nil {
+				log.Printf("Unable to refresh weather features, continuing with previous conditions: %v\n", err)
+			}
+		}
+	}
+}
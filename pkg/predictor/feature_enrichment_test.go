@@ -0,0 +1,68 @@
+package predictor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func Test_weatherFeatureEnricher_refresh(t *testing.T) {
+	responses := []struct {
+		statusCode int
+		body       string
+	}{
+		{statusCode: http.StatusOK, body: `{"current":{"precipitation":2.5,"temperature_2m":11}}`},
+		{statusCode: http.StatusServiceUnavailable},
+		{statusCode: http.StatusOK, body: `{"current":{"temperature_2m":12}}`},
+		{statusCode: http.StatusOK, body: `{"current":{"precipitation":0,"temperature_2m":13.5}}`},
+	}
+	attempt := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := responses[attempt]
+		attempt++
+		w.WriteHeader(response.statusCode)
+		_, _ = w.Write([]byte(response.body))
+	}))
+	defer server.Close()
+
+	enricher, err := makeWeatherFeatureEnricher(WeatherEnrichmentConf{
+		URL:                 server.URL,
+		FeaturePaths:        []string{"current.precipitation", "current.temperature_2m"},
+		CacheSeconds:        300,
+		TimeoutMilliseconds: 1000,
+	})
+	if err != nil {
+		t.Fatalf("makeWeatherFeatureEnricher() error = %v", err)
+	}
+	if got := enricher.enrichmentFeatures(); !reflect.DeepEqual(got, []float64{0, 0}) {
+		t.Errorf("enrichmentFeatures() before refresh = %v, want zeros", got)
+	}
+
+	want := []struct {
+		wantErr  bool
+		features []float64
+	}{
+		{features: []float64{2.5, 11}},
+		{wantErr: true, features: []float64{2.5, 11}},
+		{wantErr: true, features: []float64{2.5, 11}},
+		{features: []float64{0, 13.5}},
+	}
+	for i, w := range want {
+		err = enricher.refresh(context.Background())
+		if (err != nil) != w.wantErr {
+			t.Errorf("refresh %d error = %v, wantErr %v", i, err, w.wantErr)
+		}
+		if got := enricher.enrichmentFeatures(); !reflect.DeepEqual(got, w.features) {
+			t.Errorf("refresh %d enrichmentFeatures() = %v, want %v", i, got, w.features)
+		}
+	}
+}
+
+func Test_makeWeatherFeatureEnricher_requiresFeaturePaths(t *testing.T) {
+	_, err := makeWeatherFeatureEnricher(WeatherEnrichmentConf{URL: "http://localhost", CacheSeconds: 300})
+	if err == nil {
+		t.Errorf("makeWeatherFeatureEnricher() without feature paths expected error")
+	}
+}
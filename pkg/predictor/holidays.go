@@ -1,4 +1,4 @@
-package aggregator
+package predictor
 
 import (
 	"github.com/rickar/cal/v2"
@@ -0,0 +1,45 @@
+package predictor
+
+import (
+	"expvar"
+	"fmt"
+	"math"
+)
+
+// inferenceGuardrailMetrics counts the inference responses under /debug/vars rejected for deviating too far from the
+// scheduled travel time of their segment
+var inferenceGuardrailMetrics = expvar.NewMap("inference_guardrail")
+
+// inferenceGuardrail rejects inference responses predicting a segment will take more than factor times, or less than
+// one factor of, its scheduled travel time, so an occasional pathological inference is replaced by the schedule
+type inferenceGuardrail struct {
+	factor float64
+}
+
+// makeInferenceGuardrail builds inferenceGuardrail rejecting predictions deviating from the schedule by more than
+// factor, or returns nil when factor is zero, disabling the guardrail
+func makeInferenceGuardrail(factor float64) (*inferenceGuardrail, error) {
+	if factor == 0 {
+		return nil, nil
+	}
+	if factor <= 1 {
+		return nil, fmt.Errorf("inference guardrail factor must be greater than 1, received %f", factor)
+	}
+	return &inferenceGuardrail{factor: factor}, nil
+}
+
+// rejects returns true when predictedSeconds can't be used in place of scheduledSeconds, being negative, not a number
+// or more than factor times longer or shorter than scheduledSeconds. Always false when g is nil
+func (g *inferenceGuardrail) rejects(scheduledSeconds int, predictedSeconds float64) bool {
+	if g == nil {
+		return false
+	}
+	if math.IsNaN(predictedSeconds) || math.IsInf(predictedSeconds, 0) || predictedSeconds < 0 {
+		return true
+	}
+	if scheduledSeconds <= 0 {
+		return false
+	}
+	scheduled := float64(scheduledSeconds)
+	return predictedSeconds > scheduled*g.factor || predictedSeconds < scheduled/g.factor
+}
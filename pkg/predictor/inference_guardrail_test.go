@@ -0,0 +1,123 @@
+package predictor
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_makeInferenceGuardrail(t *testing.T) {
+	tests := []struct {
+		name    string
+		factor  float64
+		wantNil bool
+		wantErr bool
+	}{
+		{
+			name:    "Zero disables the guardrail",
+			factor:  0,
+			wantNil: true,
+		},
+		{
+			name:   "Factor above one",
+			factor: 4,
+		},
+		{
+			name:    "Factor of one rejected",
+			factor:  1,
+			wantNil: true,
+			wantErr: true,
+		},
+		{
+			name:    "Negative factor rejected",
+			factor:  -2,
+			wantNil: true,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := makeInferenceGuardrail(tt.factor)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("makeInferenceGuardrail() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got == nil) != tt.wantNil {
+				t.Errorf("makeInferenceGuardrail() = %v, wantNil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func Test_inferenceGuardrail_rejects(t *testing.T) {
+	guardrail := &inferenceGuardrail{factor: 4}
+	tests := []struct {
+		name             string
+		guardrail        *inferenceGuardrail
+		scheduledSeconds int
+		predictedSeconds float64
+		want             bool
+	}{
+		{
+			name:             "Prediction close to schedule",
+			guardrail:        guardrail,
+			scheduledSeconds: 120,
+			predictedSeconds: 150,
+			want:             false,
+		},
+		{
+			name:             "Prediction at factor times schedule",
+			guardrail:        guardrail,
+			scheduledSeconds: 120,
+			predictedSeconds: 480,
+			want:             false,
+		},
+		{
+			name:             "Prediction longer than factor times schedule",
+			guardrail:        guardrail,
+			scheduledSeconds: 120,
+			predictedSeconds: 481,
+			want:             true,
+		},
+		{
+			name:             "Prediction shorter than schedule divided by factor",
+			guardrail:        guardrail,
+			scheduledSeconds: 120,
+			predictedSeconds: 29,
+			want:             true,
+		},
+		{
+			name:             "Negative prediction",
+			guardrail:        guardrail,
+			scheduledSeconds: 120,
+			predictedSeconds: -1,
+			want:             true,
+		},
+		{
+			name:             "Not a number",
+			guardrail:        guardrail,
+			scheduledSeconds: 120,
+			predictedSeconds: math.NaN(),
+			want:             true,
+		},
+		{
+			name:             "No scheduled time only rejects invalid predictions",
+			guardrail:        guardrail,
+			scheduledSeconds: 0,
+			predictedSeconds: 60,
+			want:             false,
+		},
+		{
+			name:             "Nil guardrail accepts everything",
+			guardrail:        nil,
+			scheduledSeconds: 120,
+			predictedSeconds: 10000,
+			want:             false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.guardrail.rejects(tt.scheduledSeconds, tt.predictedSeconds); got != tt.want {
+				t.Errorf("rejects() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
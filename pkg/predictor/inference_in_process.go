@@ -0,0 +1,218 @@
+package predictor
+
+import (
+	"container/list"
+	"errors"
+	"expvar"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/foundation/onnx"
+	logger "log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// InferenceTransportInProcess runs models exported from training as ONNX inside the aggregator
+const InferenceTransportInProcess = "in-process"
+
+// InProcessInferenceConf contains parameters for running ONNX models inside the aggregator
+type InProcessInferenceConf struct {
+	//ModelDirectory holds each model exported as <model_name>_<version>.onnx
+	ModelDirectory string
+	//ModelNames are the models run in process when InferenceTransport is nats or sidecar, requests for other models
+	//are sent with InferenceTransport. All models are run in process with InferenceTransportInProcess
+	ModelNames []string
+	//WarmUpMinutes loads the models used by trips scheduled within this many minutes of startup before predictions
+	//are made, other models are loaded when first requested. Zero loads every model when first requested
+	WarmUpMinutes int
+	//MemoryBudgetMB limits the estimated memory held by loaded models, the least recently requested models are
+	//removed to stay within it and loaded again when next requested. Zero keeps every model loaded
+	MemoryBudgetMB int
+}
+
+// inProcessModelMetrics exports the loading of in process models under /debug/vars: the number and estimated bytes
+// of models cached, cache hits, misses and evictions, loads and failed loads, the total and longest load times and
+// the duration of the warm-up at startup
+var inProcessModelMetrics = expvar.NewMap("in_process_models")
+
+// inProcessInferenceRequester runs InferenceRequests for ONNX models found in its model directory and applies the
+// responses with an inferenceResultHandler. Requests for models not run in process are sent with remote
+type inProcessInferenceRequester struct {
+	log       *logger.Logger
+	directory string
+	// modelNames are the models run in process, when nil all models are
+	modelNames map[string]bool
+	remote     inferenceRequester
+	handler    *inferenceResultHandler
+	// memoryBudget is the most bytes of models kept loaded, zero is unlimited
+	memoryBudget int64
+	mu           sync.Mutex
+	// models holds the list element of each loaded model, recently requested models are at the front of lru
+	models map[modelVersion]*list.Element
+	lru    *list.List
+	// failed holds the models that could not be loaded
+	failed      map[modelVersion]bool
+	cachedBytes int64
+	longestLoad time.Duration
+}
+
+// cachedModel is a loaded model version and its estimated memory size
+type cachedModel struct {
+	key   modelVersion
+	model *onnx.Model
+	size  int64
+}
+
+// makeInProcessInferenceRequester builds inProcessInferenceRequester. When remote is nil all models are run in
+// process, otherwise only conf.ModelNames are and requests for the rest are sent with remote
+func makeInProcessInferenceRequester(log *logger.Logger,
+	conf InProcessInferenceConf,
+	remote inferenceRequester,
+	handler *inferenceResultHandler) *inProcessInferenceRequester {
+	var modelNames map[string]bool
+	if remote != nil {
+		modelNames = make(map[string]bool, len(conf.ModelNames))
+		for _, name := range conf.ModelNames {
+			modelNames[name] = true
+		}
+	}
+	return &inProcessInferenceRequester{
+		log:          log,
+		directory:    conf.ModelDirectory,
+		modelNames:   modelNames,
+		remote:       remote,
+		handler:      handler,
+		memoryBudget: int64(conf.MemoryBudgetMB) * 1024 * 1024,
+		models:       make(map[modelVersion]*list.Element),
+		lru:          list.New(),
+		failed:       make(map[modelVersion]bool),
+	}
+}
+
+// sendInferenceRequests runs the requests for models run in process and applies their responses, then sends the
+// remaining requests with the remote inferenceRequester
+func (i *inProcessInferenceRequester) sendInferenceRequests(requests []*InferenceRequest) {
+	responses, remoteRequests := i.infer(requests, i.handler.clock.Now().Unix())
+	for _, response := range responses {
+		i.handler.applyInferenceResult(response)
+	}
+	if len(remoteRequests) > 0 {
+		i.remote.sendInferenceRequests(remoteRequests)
+	}
+}
+
+// infer runs the requests for models run in process, returning their responses and the requests to send with the
+// remote inferenceRequester
+func (i *inProcessInferenceRequester) infer(requests []*InferenceRequest,
+	timestamp int64) ([]InferenceResponse, []*InferenceRequest) {
+	var responses []InferenceResponse
+	var remoteRequests []*InferenceRequest
+	for _, request := range requests {
+		modelName := request.modelName()
+		if i.modelNames != nil && !i.modelNames[modelName] {
+			remoteRequests = append(remoteRequests, request)
+			continue
+		}
+		model := i.model(modelName, request.Version)
+		if model == nil {
+			if i.remote != nil {
+				remoteRequests = append(remoteRequests, request)
+			}
+			continue
+		}
+		prediction, err := model.Run(request.Features.featureArray())
+		if err != nil {
+			i.log.Printf("Error running in process inference for RequestId:%s error:%v", request.RequestId, err)
+			continue
+		}
+		responses = append(responses, InferenceResponse{
+			RequestId:  request.RequestId,
+			MLModelId:  request.MLModelId,
+			Version:    request.Version,
+			Prediction: prediction,
+			Timestamp:  timestamp,
+		})
+	}
+	return responses, remoteRequests
+}
+
+// preload loads models not yet requested that are run in process, returning the number of models available
+func (i *inProcessInferenceRequester) preload(models []modelVersion) int {
+	loaded := 0
+	for _, model := range models {
+		if i.modelNames != nil && !i.modelNames[model.name] {
+			continue
+		}
+		if i.model(model.name, model.version) != nil {
+			loaded++
+		}
+	}
+	return loaded
+}
+
+// model returns version of the model named modelName, loading it from the model directory when it is not cached.
+// Returns nil if the model could not be loaded, which is only attempted and logged once
+func (i *inProcessInferenceRequester) model(modelName string, version int) *onnx.Model {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	key := modelVersion{name: modelName, version: version}
+	if element, present := i.models[key]; present {
+		inProcessModelMetrics.Add("hits", 1)
+		i.lru.MoveToFront(element)
+		return element.Value.(*cachedModel).model
+	}
+	if i.failed[key] {
+		return nil
+	}
+	inProcessModelMetrics.Add("misses", 1)
+	path := filepath.Join(i.directory, fmt.Sprintf("%s_%d.onnx", modelName, version))
+	start := time.Now()
+	model, err := onnx.Load(path)
+	if err != nil {
+		i.failed[key] = true
+		inProcessModelMetrics.Add("load_failures", 1)
+		if errors.Is(err, os.ErrNotExist) && i.remote != nil {
+			i.log.Printf("No onnx model at %s, sending requests for model %s remotely", path, modelName)
+		} else {
+			i.log.Printf("Unable to run model %s version %d in process: %v", modelName, version, err)
+		}
+		return nil
+	}
+	i.recordLoad(time.Since(start))
+	cached := &cachedModel{key: key, model: model, size: model.MemorySize()}
+	i.models[key] = i.lru.PushFront(cached)
+	i.cachedBytes += cached.size
+	i.evict()
+	setInProcessModelMetric("cached", int64(i.lru.Len()))
+	setInProcessModelMetric("cached_bytes", i.cachedBytes)
+	return model
+}
+
+// evict removes the least recently requested models until the cached models fit in the memory budget, the most
+// recently requested model is always kept
+func (i *inProcessInferenceRequester) evict() {
+	for i.memoryBudget > 0 && i.cachedBytes > i.memoryBudget && i.lru.Len() > 1 {
+		cached := i.lru.Remove(i.lru.Back()).(*cachedModel)
+		delete(i.models, cached.key)
+		i.cachedBytes -= cached.size
+		inProcessModelMetrics.Add("evictions", 1)
+	}
+}
+
+// recordLoad adds a model loaded in elapsed time to inProcessModelMetrics
+func (i *inProcessInferenceRequester) recordLoad(elapsed time.Duration) {
+	if elapsed > i.longestLoad {
+		i.longestLoad = elapsed
+	}
+	inProcessModelMetrics.Add("loads", 1)
+	inProcessModelMetrics.Add("load_milliseconds_total", elapsed.Milliseconds())
+	setInProcessModelMetric("load_milliseconds_max", i.longestLoad.Milliseconds())
+}
+
+// setInProcessModelMetric sets name in inProcessModelMetrics to value
+func setInProcessModelMetric(name string, value int64) {
+	metric := new(expvar.Int)
+	metric.Set(value)
+	inProcessModelMetrics.Set(name, metric)
+}
@@ -0,0 +1,155 @@
+package predictor
+
+import (
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
+	"google.golang.org/protobuf/encoding/protowire"
+	logger "log"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTestOnnxModel writes an ONNX LinearRegressor predicting intercept for featureCount features to directory
+// as the exported model file for modelName and version
+func writeTestOnnxModel(t *testing.T, directory string, modelName string, version int, featureCount int,
+	intercept float32) {
+	var coefficients []byte
+	for i := 0; i < featureCount; i++ {
+		coefficients = protowire.AppendFixed32(coefficients, 0)
+	}
+	var node []byte
+	node = protowire.AppendTag(node, 1, protowire.BytesType)
+	node = protowire.AppendString(node, "features")
+	node = protowire.AppendTag(node, 2, protowire.BytesType)
+	node = protowire.AppendString(node, "prediction")
+	node = protowire.AppendTag(node, 4, protowire.BytesType)
+	node = protowire.AppendString(node, "LinearRegressor")
+	for name, values := range map[string][]byte{
+		"coefficients": coefficients,
+		"intercepts":   protowire.AppendFixed32(nil, math.Float32bits(intercept)),
+	} {
+		var attribute []byte
+		attribute = protowire.AppendTag(attribute, 1, protowire.BytesType)
+		attribute = protowire.AppendString(attribute, name)
+		attribute = protowire.AppendTag(attribute, 7, protowire.BytesType)
+		attribute = protowire.AppendBytes(attribute, values)
+		node = protowire.AppendTag(node, 5, protowire.BytesType)
+		node = protowire.AppendBytes(node, attribute)
+	}
+	var graph []byte
+	graph = protowire.AppendTag(graph, 1, protowire.BytesType)
+	graph = protowire.AppendBytes(graph, node)
+	for num, name := range map[protowire.Number]string{11: "features", 12: "prediction"} {
+		graph = protowire.AppendTag(graph, num, protowire.BytesType)
+		graph = protowire.AppendBytes(graph, protowire.AppendString(protowire.AppendTag(nil, 1,
+			protowire.BytesType), name))
+	}
+	model := protowire.AppendBytes(protowire.AppendTag(nil, 7, protowire.BytesType), graph)
+	path := filepath.Join(directory, fmt.Sprintf("%s_%d.onnx", modelName, version))
+	if err := os.WriteFile(path, model, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testInProcessRequest builds an InferenceRequest to modelName
+func testInProcessRequest(requestId string, modelName string, version int) *InferenceRequest {
+	return &InferenceRequest{
+		RequestId:        requestId,
+		MLModelId:        1,
+		Version:          version,
+		segmentPredictor: &segmentPredictor{model: &mlmodels.MLModel{ModelName: modelName, Version: version}},
+		Features:         inferenceFeatures{month: 5, weekDay: 2, hour: 8, scheduledSeconds: 120},
+	}
+}
+
+func Test_inProcessInferenceRequester_infer(t *testing.T) {
+	directory := t.TempDir()
+	featureCount := len(testInProcessRequest("", "", 0).Features.featureArray())
+	writeTestOnnxModel(t, directory, "A_B", 2, featureCount, 42)
+	writeTestOnnxModel(t, directory, "C_D", 1, featureCount, 7)
+	requests := []*InferenceRequest{
+		testInProcessRequest("in-process", "A_B", 2),
+		testInProcessRequest("not listed", "C_D", 1),
+		testInProcessRequest("missing version", "A_B", 3),
+		testInProcessRequest("missing model", "E_F", 1),
+	}
+	log := logger.New(os.Stdout, "test", 0)
+	tests := []struct {
+		name            string
+		remote          inferenceRequester
+		wantPredictions map[string]float64
+		wantRemote      []string
+	}{
+		{
+			name:            "listed models run in process",
+			remote:          &natsInferenceRequester{},
+			wantPredictions: map[string]float64{"in-process": 42},
+			wantRemote:      []string{"not listed", "missing version", "missing model"},
+		},
+		{
+			name:            "all models run in process",
+			wantPredictions: map[string]float64{"in-process": 42, "not listed": 7},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := InProcessInferenceConf{ModelDirectory: directory, ModelNames: []string{"A_B", "E_F"}}
+			requester := makeInProcessInferenceRequester(log, conf, tt.remote, nil)
+			responses, remoteRequests := requester.infer(requests, 100)
+			gotPredictions := make(map[string]float64)
+			for _, response := range responses {
+				gotPredictions[response.RequestId] = response.Prediction
+				if response.Timestamp != 100 {
+					t.Errorf("infer() response timestamp = %d, want 100", response.Timestamp)
+				}
+			}
+			if !reflect.DeepEqual(gotPredictions, tt.wantPredictions) {
+				t.Errorf("infer() predictions = %v, want %v", gotPredictions, tt.wantPredictions)
+			}
+			var gotRemote []string
+			for _, request := range remoteRequests {
+				gotRemote = append(gotRemote, request.RequestId)
+			}
+			if !reflect.DeepEqual(gotRemote, tt.wantRemote) {
+				t.Errorf("infer() remote requests = %v, want %v", gotRemote, tt.wantRemote)
+			}
+		})
+	}
+}
+
+func Test_inProcessInferenceRequester_model_eviction(t *testing.T) {
+	directory := t.TempDir()
+	featureCount := len(testInProcessRequest("", "", 0).Features.featureArray())
+	for _, name := range []string{"A_B", "C_D", "E_F"} {
+		writeTestOnnxModel(t, directory, name, 1, featureCount, 1)
+	}
+	requester := makeInProcessInferenceRequester(logger.New(os.Stdout, "test", 0),
+		InProcessInferenceConf{ModelDirectory: directory}, nil, nil)
+	modelSize := requester.model("A_B", 1).MemorySize()
+	requester.memoryBudget = 2 * modelSize
+
+	requester.model("C_D", 1)
+	// A_B becomes the most recently requested, leaving C_D to be evicted when E_F is loaded
+	requester.model("A_B", 1)
+	requester.model("E_F", 1)
+
+	var got []string
+	for element := requester.lru.Front(); element != nil; element = element.Next() {
+		got = append(got, element.Value.(*cachedModel).key.name)
+	}
+	if want := []string{"E_F", "A_B"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("model() cached %v, want %v", got, want)
+	}
+	if requester.cachedBytes != 2*modelSize {
+		t.Errorf("model() cachedBytes = %d, want %d", requester.cachedBytes, 2*modelSize)
+	}
+	if _, present := requester.models[modelVersion{name: "C_D", version: 1}]; present {
+		t.Errorf("model() kept evicted model C_D")
+	}
+	if requester.model("C_D", 1) == nil {
+		t.Errorf("model() did not load evicted model C_D again")
+	}
+}
@@ -0,0 +1,183 @@
+package predictor
+
+import (
+	"encoding/json"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/transitcastproto"
+	"google.golang.org/protobuf/proto"
+	"time"
+)
+
+//InferenceRequest holds the parameters and features for the model runner to service
+type InferenceRequest struct {
+	RequestId        string `json:"request_id"`
+	MLModelId        int64  `json:"ml_model_id"`
+	Version          int    `json:"version"`
+	segmentPredictor *segmentPredictor
+	Features         inferenceFeatures
+	//shadow is true when this request is made to a shadow model, its response is never published
+	shadow bool
+	//pairedRequest links a request to the current model with the shadow model request made with the same features
+	pairedRequest *InferenceRequest
+	//prediction is the response received for a request with a pairedRequest
+	prediction *float64
+}
+
+//jsonRequest marshals InferenceRequest into expected json bytes for sending to model runner
+func (i *InferenceRequest) jsonRequest(timestamp int64) ([]byte, error) {
+	return json.Marshal(i.message(timestamp))
+}
+
+//message builds the inferenceRequestMessage sent to the model runner for InferenceRequest
+func (i *InferenceRequest) message(timestamp int64) *inferenceRequestMessage {
+	return &inferenceRequestMessage{
+		RequestId: i.RequestId,
+		MLModelId: i.MLModelId,
+		Version:   i.Version,
+		Features:  i.Features.featureArray(),
+		Timestamp: timestamp,
+	}
+}
+
+//modelName returns the name of the model InferenceRequest is made to
+func (i *InferenceRequest) modelName() string {
+	if i.shadow {
+		return i.segmentPredictor.shadowModel.ModelName
+	}
+	return i.segmentPredictor.model.ModelName
+}
+
+//inferenceRequestMessage is the InferenceRequest as sent to the model runner, as json or protobuf
+type inferenceRequestMessage struct {
+	RequestId string    `json:"request_id"`
+	MLModelId int64     `json:"ml_model_id"`
+	Version   int       `json:"version"`
+	Features  []float64 `json:"features"`
+	Timestamp int64     `json:"timestamp"`
+}
+
+//MarshalProto encodes inferenceRequestMessage as a transitcastproto.InferenceRequest protocol buffer
+func (m *inferenceRequestMessage) MarshalProto() ([]byte, error) {
+	return proto.Marshal(m.protoRequest())
+}
+
+//protoRequest returns inferenceRequestMessage as a transitcastproto.InferenceRequest
+func (m *inferenceRequestMessage) protoRequest() *transitcastproto.InferenceRequest {
+	return &transitcastproto.InferenceRequest{
+		RequestId: m.RequestId,
+		MlModelId: m.MLModelId,
+		Version:   int32(m.Version),
+		Features:  m.Features,
+		Timestamp: m.Timestamp,
+	}
+}
+
+//UnmarshalProto decodes a transitcastproto.InferenceRequest protocol buffer into inferenceRequestMessage
+func (m *inferenceRequestMessage) UnmarshalProto(data []byte) error {
+	var message transitcastproto.InferenceRequest
+	if err := proto.Unmarshal(data, &message); err != nil {
+		return err
+	}
+	m.RequestId = message.RequestId
+	m.MLModelId = message.MlModelId
+	m.Version = int(message.Version)
+	m.Features = message.Features
+	m.Timestamp = message.Timestamp
+	return nil
+}
+
+//inferenceFeatures holds all elements used by the model to make an inference
+type inferenceFeatures struct {
+	month   int
+	weekDay int
+	hour    int
+	minute  int
+	second  int
+	holiday bool
+	//serviceExceptionFeatures includes serviceAdded and serviceReduced in featureArray, only models trained with
+	//them can be sent these features
+	serviceExceptionFeatures bool
+	serviceAdded             bool
+	serviceReduced           bool
+	//timeBucketFeature includes timeBucket in featureArray, only models trained with it can be sent this feature
+	timeBucketFeature bool
+	//timeBucket is the mlmodels.TimeBucket sequence the request is made in, 0 when outside every bucket
+	timeBucket       int
+	scheduledSeconds int
+	scheduledTime    int
+	delay            int
+	distanceToStop   float64
+	//enrichment holds external features supplied by a featureEnricher
+	enrichment         []float64
+	transitionFeatures []transitionFeature
+}
+
+//featureArray produces slice of floats for InferenceRequests
+//when serviceExceptionFeatures is set the service exception flags follow holiday, followed by timeBucket when
+//timeBucketFeature is set, and any enrichment features follow distanceToStop
+func (i *inferenceFeatures) featureArray() []float64 {
+	features := []float64{
+		float64(i.month),
+		float64(i.weekDay),
+		float64(i.hour),
+		float64(i.minute),
+		float64(i.second),
+		boolFeature(i.holiday),
+	}
+	if i.serviceExceptionFeatures {
+		features = append(features, boolFeature(i.serviceAdded), boolFeature(i.serviceReduced))
+	}
+	if i.timeBucketFeature {
+		features = append(features, float64(i.timeBucket))
+	}
+	features = append(features,
+		float64(i.scheduledSeconds),
+		float64(i.scheduledTime),
+		float64(i.delay),
+		i.distanceToStop,
+	)
+	features = append(features, i.enrichment...)
+
+	for _, transition := range i.transitionFeatures {
+		features = append(features, float64(transition.TransitionSeconds))
+		features = append(features, float64(transition.TransitionAge))
+	}
+	return features
+}
+
+//boolFeature converts value into 1.0 when true, otherwise 0.0
+func boolFeature(value bool) float64 {
+	if value {
+		return 1.0
+	}
+	return 0.0
+}
+
+//transitionFeature holds all features representing stop to stop transitions
+type transitionFeature struct {
+	Description       string
+	TransitionSeconds int
+	TransitionAge     int
+}
+
+//buildTransitionFeature factory for transitionFeature
+func buildTransitionFeature(stop1 *gtfs.StopTimeInstance,
+	stop2 *gtfs.StopTimeInstance,
+	osts *observedStopTransitions,
+	at time.Time) transitionFeature {
+	transitionName := stopTransitionName(stop1.StopId, stop2.StopId)
+	lastOst := osts.getOst(stop1.StopId, stop2.StopId, at)
+	if lastOst == nil {
+		return transitionFeature{
+			Description:       transitionName,
+			TransitionSeconds: stop2.ArrivalTime - stop1.ArrivalTime, //schedule seconds
+			TransitionAge:     7200,
+		}
+	}
+	diff := at.Sub(lastOst.ObservedTime)
+	return transitionFeature{
+		Description:       transitionName,
+		TransitionSeconds: lastOst.TravelSeconds,
+		TransitionAge:     int(diff.Seconds()),
+	}
+}
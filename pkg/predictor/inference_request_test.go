@@ -0,0 +1,70 @@
+package predictor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_inferenceFeatures_featureArray(t *testing.T) {
+	features := inferenceFeatures{
+		month:            5,
+		weekDay:          1,
+		hour:             12,
+		minute:           30,
+		second:           15,
+		holiday:          true,
+		serviceReduced:   true,
+		timeBucket:       3,
+		scheduledSeconds: 120,
+		scheduledTime:    45000,
+		delay:            60,
+		distanceToStop:   250.5,
+		transitionFeatures: []transitionFeature{
+			{TransitionSeconds: 70, TransitionAge: 300},
+		},
+	}
+	tests := []struct {
+		name                     string
+		serviceExceptionFeatures bool
+		timeBucketFeature        bool
+		enrichment               []float64
+		want                     []float64
+	}{
+		{
+			name: "service exceptions excluded",
+			want: []float64{5, 1, 12, 30, 15, 1, 120, 45000, 60, 250.5, 70, 300},
+		},
+		{
+			name:                     "service exceptions follow holiday",
+			serviceExceptionFeatures: true,
+			want:                     []float64{5, 1, 12, 30, 15, 1, 0, 1, 120, 45000, 60, 250.5, 70, 300},
+		},
+		{
+			name:              "time bucket follows holiday",
+			timeBucketFeature: true,
+			want:              []float64{5, 1, 12, 30, 15, 1, 3, 120, 45000, 60, 250.5, 70, 300},
+		},
+		{
+			name:                     "time bucket follows service exceptions",
+			serviceExceptionFeatures: true,
+			timeBucketFeature:        true,
+			want:                     []float64{5, 1, 12, 30, 15, 1, 0, 1, 3, 120, 45000, 60, 250.5, 70, 300},
+		},
+		{
+			name:       "enrichment precedes transitions",
+			enrichment: []float64{2.5, 11},
+			want:       []float64{5, 1, 12, 30, 15, 1, 120, 45000, 60, 250.5, 2.5, 11, 70, 300},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := features
+			i.serviceExceptionFeatures = tt.serviceExceptionFeatures
+			i.timeBucketFeature = tt.timeBucketFeature
+			i.enrichment = tt.enrichment
+			if got := i.featureArray(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("featureArray() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package predictor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/transitcastproto"
+	"github.com/OpenTransitTools/transitcast/foundation/clock"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
+	"github.com/nats-io/nats.go"
+	"google.golang.org/protobuf/proto"
+	logger "log"
+	"os"
+	"sync"
+)
+
+// InferenceResponse holds the results of an InferenceRequest sent back from the model runner
+type InferenceResponse struct {
+	RequestId  string  `json:"request_id"`
+	MLModelId  int64   `json:"ml_model_id"`
+	Version    int     `json:"version"`
+	Prediction float64 `json:"prediction"`
+	Error      string  `json:"error"`
+	Timestamp  int64   `json:"timestamp"`
+}
+
+// MarshalProto encodes InferenceResponse as a transitcastproto.InferenceResponse protocol buffer
+func (i *InferenceResponse) MarshalProto() ([]byte, error) {
+	return proto.Marshal(&transitcastproto.InferenceResponse{
+		RequestId:  i.RequestId,
+		MlModelId:  i.MLModelId,
+		Version:    int32(i.Version),
+		Prediction: i.Prediction,
+		Error:      i.Error,
+		Timestamp:  i.Timestamp,
+	})
+}
+
+// UnmarshalProto decodes a transitcastproto.InferenceResponse protocol buffer into InferenceResponse
+func (i *InferenceResponse) UnmarshalProto(data []byte) error {
+	var message transitcastproto.InferenceResponse
+	if err := proto.Unmarshal(data, &message); err != nil {
+		return err
+	}
+	*i = inferenceResponseFromProto(&message)
+	return nil
+}
+
+// inferenceResponseFromProto returns the InferenceResponse held in a transitcastproto.InferenceResponse
+func inferenceResponseFromProto(message *transitcastproto.InferenceResponse) InferenceResponse {
+	return InferenceResponse{
+		RequestId:  message.RequestId,
+		MLModelId:  message.MlModelId,
+		Version:    int(message.Version),
+		Prediction: message.Prediction,
+		Error:      message.Error,
+		Timestamp:  message.Timestamp,
+	}
+}
+
+// startInferenceResponseListener starts a listener on nats connection and applies these results to the predictions in
+// pendingPredictionsCollection. When an inference response completes a prediction the result is sent to
+// the predictionPublisher as a completed TripUpdate.
+func startInferenceResponseListener(
+	log *logger.Logger,
+	wg *sync.WaitGroup,
+	natsConn *nats.Conn,
+	subject string,
+	shutdownSignal chan bool,
+	handler *inferenceResultHandler) {
+	wg.Add(1)
+	defer wg.Done()
+
+	ch := make(chan *nats.Msg, 64)
+	log.Printf("Subscribing to %s on nats: %v\n", subject, natsConn.Servers())
+	sub, err := natsConn.ChanSubscribe(subject, ch)
+	if err != nil {
+		log.Printf("Unable to establish subscription to nats server: %v\n", err)
+		os.Exit(1)
+	}
+	//clean up nats
+	defer func() {
+		log.Printf("Unsubscribing to %s in InferenceResponseListener\n", subject)
+		err = sub.Unsubscribe()
+		if err != nil {
+			log.Printf("Error when attempting to unsubscribe: %v\n", err)
+		}
+	}()
+
+	for {
+		select {
+		case msg := <-ch:
+			handler.applyInferenceResultFromMsg(msg)
+			break
+		case <-shutdownSignal:
+			log.Printf("exiting inference response listener on shutdown signal\n")
+			return
+		}
+	}
+}
+
+// inferenceResultHandler applies inference results to predictions in pendingPredictionsCollection
+type inferenceResultHandler struct {
+	log                 *logger.Logger
+	pendingPredictions  *pendingPredictionsCollection
+	predictionPublisher *predictionPublisher
+	shadowEvaluator     *shadowEvaluator
+	// guardrail replaces inference responses deviating too far from the schedule with the schedule, when not nil
+	guardrail *inferenceGuardrail
+	// health compares the inference responses applied with the travel times later observed, when not nil
+	health *modelHealthTracker
+	clock  clock.Clock
+	// requester sends the batch held for a trip once the batch before it completes, when not nil
+	requester inferenceRequester
+}
+
+// makeInferenceResultHandler builds inferenceResultHandler, responses rejected by guardrail are replaced by the
+// schedule
+func makeInferenceResultHandler(log *logger.Logger,
+	pendingPredictions *pendingPredictionsCollection,
+	predictionPublisher *predictionPublisher,
+	shadowEvaluator *shadowEvaluator,
+	guardrail *inferenceGuardrail,
+	clk clock.Clock) *inferenceResultHandler {
+	return &inferenceResultHandler{
+		log:                 log,
+		pendingPredictions:  pendingPredictions,
+		predictionPublisher: predictionPublisher,
+		shadowEvaluator:     shadowEvaluator,
+		guardrail:           guardrail,
+		clock:               clk,
+	}
+}
+
+// applyInferenceResultFromMsg unmarshal nats message, as json or protobuf, and applies result to pending prediction
+func (i *inferenceResultHandler) applyInferenceResultFromMsg(msg *nats.Msg) {
+	inferenceResponse := InferenceResponse{}
+	err := natsclient.Unmarshal(msg.Data, &inferenceResponse)
+	if err != nil {
+		i.log.Printf("error parsing InferenceResponse: %v, payload:%s", err, string(msg.Data))
+		return
+	}
+	if len(inferenceResponse.Error) > 0 {
+		i.log.Printf("InferenceResponse RequestId:%s error:%s", inferenceResponse.RequestId,
+			inferenceResponse.Error)
+		return
+	}
+	i.applyInferenceResult(inferenceResponse)
+}
+
+// applyInferenceResult finds pending prediction, applies the InferenceResponse,
+// if this completes the prediction passes the prediction on to be published by predictionPublisher.
+// responses to shadow model requests are only passed to the shadowEvaluator. Responses rejected by the guardrail are
+// logged with their model and the schedule is used in their place
+func (i *inferenceResultHandler) applyInferenceResult(response InferenceResponse) {
+	now := i.clock.Now()
+	batch, prediction, inferenceRequest, err := i.pendingPredictions.getPendingPrediction(now, response)
+	if err != nil {
+		i.log.Printf("error applying inference response:%s, error:%v", response.RequestId, err)
+		return
+	}
+	i.shadowEvaluator.inferenceReceived(now, prediction.tripInstance.TripId, inferenceRequest, response.Prediction)
+	if inferenceRequest.shadow {
+		return
+	}
+	segmentPredictor := inferenceRequest.segmentPredictor
+	if i.guardrail.rejects(segmentPredictor.scheduledTime(), response.Prediction) {
+		inferenceGuardrailMetrics.Add("rejected", 1)
+		i.log.Printf("rejected inference response:%s from model %d %s predicting %f seconds, scheduled %d seconds, "+
+			"using schedule", response.RequestId, segmentPredictor.model.MLModelId, segmentPredictor.model.ModelName,
+			response.Prediction, segmentPredictor.scheduledTime())
+		err = prediction.applyScheduleFallback(segmentPredictor)
+	} else {
+		err = prediction.applyInferenceResponse(segmentPredictor, response.Prediction)
+		i.health.predictionReceived(now, prediction.tripInstance.TripId, segmentPredictor, response.Prediction)
+	}
+	if err != nil {
+		i.log.Printf("error applying inference response:%s, error:%v", response.RequestId, err)
+		return
+	}
+	remainingPredictions := batch.predictionsRemaining()
+
+	if remainingPredictions == 0 {
+		i.predictionPublisher.publishPredictionBatch(batch)
+		held := i.pendingPredictions.completePredictionBatch(now, batch)
+		if held != nil && i.requester != nil {
+			i.requester.sendInferenceRequests(held.allInferenceRequests())
+		}
+	}
+}
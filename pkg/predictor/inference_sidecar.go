@@ -0,0 +1,197 @@
+package predictor
+
+import (
+	"context"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/transitcastproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	logger "log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// InferenceTransportNats sends inference requests over NATS and receives responses with the inference response listener
+const InferenceTransportNats = "nats"
+
+// InferenceTransportSidecar sends inference requests over gRPC to an inference service running alongside the aggregator
+const InferenceTransportSidecar = "sidecar"
+
+// SidecarInferenceConf contains parameters for requesting inference from a sidecar inference service
+type SidecarInferenceConf struct {
+	//Address is the host:port the sidecar serves the transitcast.Inference gRPC service on
+	Address string
+	//TimeoutMilliseconds is the deadline for each attempt at an InferenceRequest
+	TimeoutMilliseconds int
+	//Retries is the number of times a failed InferenceRequest is attempted again
+	Retries int
+	//RetryDelayMilliseconds is multiplied by the attempt number to wait before retrying
+	RetryDelayMilliseconds int
+	//MaxConnections is the number of connections opened to the inference service, requests are spread across them
+	//and a batch of requests is sent with up to this many in flight at once
+	MaxConnections int
+}
+
+// sidecarInferenceRequester sends each InferenceRequest to an inference service over gRPC and applies the responses
+// with an inferenceResultHandler as they are received
+type sidecarInferenceRequester struct {
+	log         *logger.Logger
+	connections []*grpc.ClientConn
+	clients     []transitcastproto.InferenceClient
+	next        uint32
+	timeout     time.Duration
+	retries     int
+	retryDelay  time.Duration
+	handler     *inferenceResultHandler
+}
+
+// makeSidecarInferenceRequester builds sidecarInferenceRequester with conf.MaxConnections connections to the inference
+// service, which are kept open and reused between requests until close is called
+func makeSidecarInferenceRequester(log *logger.Logger,
+	conf SidecarInferenceConf,
+	handler *inferenceResultHandler) (*sidecarInferenceRequester, error) {
+	requester := &sidecarInferenceRequester{
+		log:        log,
+		timeout:    time.Duration(conf.TimeoutMilliseconds) * time.Millisecond,
+		retries:    conf.Retries,
+		retryDelay: time.Duration(conf.RetryDelayMilliseconds) * time.Millisecond,
+		handler:    handler,
+	}
+	connectionCount := conf.MaxConnections
+	if connectionCount < 1 {
+		connectionCount = 1
+	}
+	for i := 0; i < connectionCount; i++ {
+		connection, err := grpc.Dial(conf.Address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			requester.close()
+			return nil, fmt.Errorf("unable to connect to sidecar inference service at %s: %w", conf.Address, err)
+		}
+		requester.connections = append(requester.connections, connection)
+		requester.clients = append(requester.clients, transitcastproto.NewInferenceClient(connection))
+	}
+	return requester, nil
+}
+
+// close closes the connections to the inference service
+func (s *sidecarInferenceRequester) close() {
+	for _, connection := range s.connections {
+		if err := connection.Close(); err != nil {
+			s.log.Printf("Error closing connection to sidecar inference service: %v", err)
+		}
+	}
+}
+
+// sendInferenceRequests requests inference for the InferenceRequests concurrently and applies the responses.
+// Their batch is published by the inferenceResultHandler once the last response is applied
+func (s *sidecarInferenceRequester) sendInferenceRequests(requests []*InferenceRequest) {
+	s.requestInferenceBatch(requests, s.handler.clock.Now().Unix(), s.handler.applyInferenceResult)
+}
+
+// requestInferenceBatch sends the requests to the inference service with up to one in flight per connection, giving
+// the whole batch the time a single request may take with its retries. Successful responses are passed to apply on
+// the calling goroutine as they are received
+func (s *sidecarInferenceRequester) requestInferenceBatch(requests []*InferenceRequest,
+	timestamp int64,
+	apply func(response InferenceResponse)) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.batchTimeout())
+	defer cancel()
+
+	type result struct {
+		request  *InferenceRequest
+		response *InferenceResponse
+		err      error
+	}
+	results := make(chan result, len(requests))
+	inFlight := make(chan struct{}, len(s.clients))
+	var wg sync.WaitGroup
+	for _, request := range requests {
+		wg.Add(1)
+		go func(request *InferenceRequest) {
+			defer wg.Done()
+			select {
+			case inFlight <- struct{}{}:
+			case <-ctx.Done():
+				results <- result{request: request, err: ctx.Err()}
+				return
+			}
+			response, err := s.requestInference(ctx, request, timestamp)
+			<-inFlight
+			results <- result{request: request, response: response, err: err}
+		}(request)
+	}
+
+	for range requests {
+		r := <-results
+		if r.err != nil {
+			s.log.Printf("Error requesting inference for RequestId:%s error:%v", r.request.RequestId, r.err)
+			continue
+		}
+		if len(r.response.Error) > 0 {
+			s.log.Printf("InferenceResponse RequestId:%s error:%s", r.response.RequestId, r.response.Error)
+			continue
+		}
+		apply(*r.response)
+	}
+	wg.Wait()
+}
+
+// batchTimeout returns the longest a single request may take with all of its attempts and the delays between them
+func (s *sidecarInferenceRequester) batchTimeout() time.Duration {
+	retryDelays := time.Duration(s.retries*(s.retries+1)/2) * s.retryDelay
+	return time.Duration(s.retries+1)*s.timeout + retryDelays
+}
+
+// requestInference sends request to the inference service, retrying failed attempts that may succeed if repeated
+// until ctx is done
+func (s *sidecarInferenceRequester) requestInference(ctx context.Context,
+	request *InferenceRequest,
+	timestamp int64) (*InferenceResponse, error) {
+	message := request.message(timestamp).protoRequest()
+	client := s.clients[atomic.AddUint32(&s.next, 1)%uint32(len(s.clients))]
+	var lastErr error
+	for attempt := 0; attempt <= s.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(attempt) * s.retryDelay):
+			case <-ctx.Done():
+				return nil, lastErr
+			}
+		}
+		response, err := s.infer(ctx, client, message)
+		if err == nil {
+			return response, nil
+		}
+		lastErr = err
+		if !retryableInferenceError(err) {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// infer makes a single attempt at sending message to the inference service within the timeout
+func (s *sidecarInferenceRequester) infer(ctx context.Context,
+	client transitcastproto.InferenceClient,
+	message *transitcastproto.InferenceRequest) (*InferenceResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	response, err := client.Infer(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	result := inferenceResponseFromProto(response)
+	return &result, nil
+}
+
+// retryableInferenceError returns true if the gRPC error err is a failure that may succeed if attempted again
+func retryableInferenceError(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return false
+}
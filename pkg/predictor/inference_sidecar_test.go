@@ -0,0 +1,229 @@
+package predictor
+
+import (
+	"context"
+	"github.com/OpenTransitTools/transitcast/business/data/transitcastproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	logger "log"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testInferenceServer answers each Infer call with the next of its codes, codes.OK returns a prediction
+type testInferenceServer struct {
+	transitcastproto.UnimplementedInferenceServer
+	codes    []codes.Code
+	delay    time.Duration
+	attempts int32
+}
+
+func (s *testInferenceServer) Infer(_ context.Context,
+	request *transitcastproto.InferenceRequest) (*transitcastproto.InferenceResponse, error) {
+	code := s.codes[atomic.AddInt32(&s.attempts, 1)-1]
+	time.Sleep(s.delay)
+	if code != codes.OK {
+		return nil, status.Error(code, "test failure")
+	}
+	return &transitcastproto.InferenceResponse{
+		RequestId:  request.RequestId,
+		MlModelId:  request.MlModelId,
+		Prediction: 95.5,
+	}, nil
+}
+
+// startTestInferenceServer serves server on a local port, returning its address
+func startTestInferenceServer(server *testInferenceServer, t *testing.T) (string, *grpc.Server) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	transitcastproto.RegisterInferenceServer(grpcServer, server)
+	go func() {
+		_ = grpcServer.Serve(listener)
+	}()
+	return listener.Addr().String(), grpcServer
+}
+
+func Test_sidecarInferenceRequester_requestInference(t *testing.T) {
+	tests := []struct {
+		name         string
+		codes        []codes.Code
+		delay        time.Duration
+		retries      int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name:         "first attempt succeeds",
+			codes:        []codes.Code{codes.OK},
+			retries:      2,
+			wantAttempts: 1,
+		},
+		{
+			name:         "retries unavailable service",
+			codes:        []codes.Code{codes.Unavailable, codes.Unavailable, codes.OK},
+			retries:      2,
+			wantAttempts: 3,
+		},
+		{
+			name:         "gives up after retries",
+			codes:        []codes.Code{codes.ResourceExhausted, codes.ResourceExhausted},
+			retries:      1,
+			wantAttempts: 2,
+			wantErr:      true,
+		},
+		{
+			name:         "invalid argument is not retried",
+			codes:        []codes.Code{codes.InvalidArgument, codes.OK},
+			retries:      2,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "deadline exceeded is retried",
+			codes:        []codes.Code{codes.OK, codes.OK},
+			delay:        200 * time.Millisecond,
+			retries:      1,
+			wantAttempts: 2,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &testInferenceServer{codes: tt.codes, delay: tt.delay}
+			address, grpcServer := startTestInferenceServer(server, t)
+
+			requester, err := makeSidecarInferenceRequester(logger.New(os.Stdout, "test", 0), SidecarInferenceConf{
+				Address:                address,
+				TimeoutMilliseconds:    100,
+				Retries:                tt.retries,
+				RetryDelayMilliseconds: 1,
+				MaxConnections:         1,
+			}, nil)
+			if err != nil {
+				t.Fatalf("makeSidecarInferenceRequester() error = %v", err)
+			}
+			got, err := requester.requestInference(context.Background(), &InferenceRequest{RequestId: "A_1-1-5-1", MLModelId: 5}, 0)
+			requester.close()
+			grpcServer.Stop()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("requestInference() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if int(atomic.LoadInt32(&server.attempts)) != tt.wantAttempts {
+				t.Errorf("requestInference() made %d attempts, want %d", server.attempts, tt.wantAttempts)
+			}
+			if !tt.wantErr && (got.RequestId != "A_1-1-5-1" || got.MLModelId != 5 || got.Prediction != 95.5) {
+				t.Errorf("requestInference() = %+v", got)
+			}
+		})
+	}
+}
+
+func Test_sidecarInferenceRequester_reusesConnections(t *testing.T) {
+	codesReturned := make([]codes.Code, 6)
+	server := &testInferenceServer{codes: codesReturned}
+	address, grpcServer := startTestInferenceServer(server, t)
+	defer grpcServer.Stop()
+
+	requester, err := makeSidecarInferenceRequester(logger.New(os.Stdout, "test", 0), SidecarInferenceConf{
+		Address:             address,
+		TimeoutMilliseconds: 1000,
+		MaxConnections:      2,
+	}, nil)
+	if err != nil {
+		t.Fatalf("makeSidecarInferenceRequester() error = %v", err)
+	}
+	defer requester.close()
+	if len(requester.connections) != 2 {
+		t.Fatalf("makeSidecarInferenceRequester() opened %d connections, want 2", len(requester.connections))
+	}
+	for i := 0; i < len(codesReturned); i++ {
+		if _, err = requester.requestInference(context.Background(), &InferenceRequest{RequestId: "A_1-1-5-1", MLModelId: 5}, 0); err != nil {
+			t.Fatalf("requestInference() error = %v", err)
+		}
+	}
+	for _, connection := range requester.connections {
+		if state := connection.GetState().String(); state != "READY" {
+			t.Errorf("connection state = %s after requests, want READY", state)
+		}
+	}
+}
+
+func Test_sidecarInferenceRequester_requestInferenceBatch(t *testing.T) {
+	delay := 200 * time.Millisecond
+	server := &testInferenceServer{codes: make([]codes.Code, 4), delay: delay}
+	address, grpcServer := startTestInferenceServer(server, t)
+	defer grpcServer.Stop()
+
+	requester, err := makeSidecarInferenceRequester(logger.New(os.Stdout, "test", 0), SidecarInferenceConf{
+		Address:             address,
+		TimeoutMilliseconds: 1000,
+		MaxConnections:      4,
+	}, nil)
+	if err != nil {
+		t.Fatalf("makeSidecarInferenceRequester() error = %v", err)
+	}
+	defer requester.close()
+
+	requests := []*InferenceRequest{
+		{RequestId: "A_1-1-5-1", MLModelId: 5},
+		{RequestId: "A_1-2-5-1", MLModelId: 5},
+		{RequestId: "A_1-3-5-1", MLModelId: 5},
+		{RequestId: "A_1-4-5-1", MLModelId: 5},
+	}
+	received := make(map[string]bool)
+	start := time.Now()
+	requester.requestInferenceBatch(requests, 0, func(response InferenceResponse) {
+		received[response.RequestId] = true
+	})
+	elapsed := time.Since(start)
+
+	if len(received) != len(requests) {
+		t.Errorf("requestInferenceBatch() applied %d responses, want %d", len(received), len(requests))
+	}
+	if elapsed >= 2*delay {
+		t.Errorf("requestInferenceBatch() took %v with a sidecar taking %v per request, requests were not "+
+			"sent concurrently", elapsed, delay)
+	}
+}
+
+func Test_sidecarInferenceRequester_requestInferenceBatch_deadline(t *testing.T) {
+	server := &testInferenceServer{codes: make([]codes.Code, 3), delay: 300 * time.Millisecond}
+	address, grpcServer := startTestInferenceServer(server, t)
+	defer grpcServer.Stop()
+
+	requester, err := makeSidecarInferenceRequester(logger.New(os.Stdout, "test", 0), SidecarInferenceConf{
+		Address:             address,
+		TimeoutMilliseconds: 100,
+		MaxConnections:      1,
+	}, nil)
+	if err != nil {
+		t.Fatalf("makeSidecarInferenceRequester() error = %v", err)
+	}
+	defer requester.close()
+
+	requests := []*InferenceRequest{
+		{RequestId: "A_1-1-5-1", MLModelId: 5},
+		{RequestId: "A_1-2-5-1", MLModelId: 5},
+		{RequestId: "A_1-3-5-1", MLModelId: 5},
+	}
+	applied := 0
+	start := time.Now()
+	requester.requestInferenceBatch(requests, 0, func(response InferenceResponse) {
+		applied++
+	})
+	elapsed := time.Since(start)
+
+	if applied != 0 {
+		t.Errorf("requestInferenceBatch() applied %d responses past their deadline", applied)
+	}
+	if elapsed >= 250*time.Millisecond {
+		t.Errorf("requestInferenceBatch() took %v, want the batch to end at its 100ms deadline", elapsed)
+	}
+}
@@ -0,0 +1,34 @@
+package predictor
+
+import "time"
+
+// layoverPolicy provides the minimum layover a vehicle takes at the first stop of a trip after arriving from the
+// previous trip on its block. A vehicle arriving late recovers its delay up to the scheduled layover less the minimum
+type layoverPolicy struct {
+	defaultMinimumLayover time.Duration
+	routeMinimumLayovers  map[string]time.Duration
+}
+
+// makeLayoverPolicy builds layoverPolicy from defaultSeconds and routeSeconds, a list of route_id and seconds
+// separated by a colon, for example "100:300", overriding the default for the route
+func makeLayoverPolicy(defaultSeconds int, routeSeconds []string) (*layoverPolicy, error) {
+	routeMinimumLayovers, err := parseRouteDurations("minimum layover", routeSeconds)
+	if err != nil {
+		return nil, err
+	}
+	return &layoverPolicy{
+		defaultMinimumLayover: time.Duration(defaultSeconds) * time.Second,
+		routeMinimumLayovers:  routeMinimumLayovers,
+	}, nil
+}
+
+// minimumLayover returns the minimum layover before starting a trip on routeId, a nil layoverPolicy has none
+func (l *layoverPolicy) minimumLayover(routeId string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	if layover, present := l.routeMinimumLayovers[routeId]; present {
+		return layover
+	}
+	return l.defaultMinimumLayover
+}
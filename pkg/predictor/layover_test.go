@@ -0,0 +1,51 @@
+package predictor
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_makeLayoverPolicy(t *testing.T) {
+	tests := []struct {
+		name           string
+		defaultSeconds int
+		routeSeconds   []string
+		wantErr        bool
+		want           map[string]time.Duration
+	}{
+		{
+			name:           "default applies to all routes",
+			defaultSeconds: 120,
+			want:           map[string]time.Duration{"100": 2 * time.Minute, "90": 2 * time.Minute},
+		},
+		{
+			name:           "route overrides default",
+			defaultSeconds: 120,
+			routeSeconds:   []string{"100:300", "90:0"},
+			want:           map[string]time.Duration{"100": 5 * time.Minute, "90": 0, "20": 2 * time.Minute},
+		},
+		{
+			name:         "missing seconds",
+			routeSeconds: []string{"100"},
+			wantErr:      true,
+		},
+		{
+			name:         "negative seconds",
+			routeSeconds: []string{"100:-5"},
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := makeLayoverPolicy(tt.defaultSeconds, tt.routeSeconds)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("makeLayoverPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for routeId, want := range tt.want {
+				if layover := got.minimumLayover(routeId); layover != want {
+					t.Errorf("minimumLayover(%s) = %v, want %v", routeId, layover, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package predictor
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/systemevent"
+	"github.com/jmoiron/sqlx"
+	logger "log"
+	"math"
+	"sync"
+	"time"
+)
+
+// modelHealthPredictionAge is how long a model's prediction for a pair of stops awaits the ObservedStopTime it is
+// compared with before it is discarded
+const modelHealthPredictionAge = time.Hour
+
+// modelHealthCheckInterval is how often expired predictions are discarded and models disabled are recorded
+const modelHealthCheckInterval = time.Minute
+
+// modelHealthMetrics counts the predictions compared with observed travel times under /debug/vars and the models
+// disabled by modelHealthTracker
+var modelHealthMetrics = expvar.NewMap("model_health")
+
+// modelHealthPolicy controls when modelHealthTracker disables a model
+type modelHealthPolicy struct {
+	//window is the number of each model's most recent residuals its rolling error is taken over
+	window int
+	//minimumSamples is the number of residuals a model needs before it can be disabled
+	minimumSamples int
+	//errorRatio disables a model when its rolling mean absolute error exceeds the schedule's by this factor
+	errorRatio float64
+}
+
+// modelResidual is the absolute error of a model's prediction and of the schedule for the same travel between stops
+type modelResidual struct {
+	modelError    float64
+	scheduleError float64
+}
+
+// modelHealth holds the rolling residuals of a model
+type modelHealth struct {
+	modelId   int64
+	modelName string
+	residuals []modelResidual
+	//next is the index in residuals replaced by the next residual once window residuals are held
+	next       int
+	disabledAt *time.Time
+}
+
+// meanErrors returns the mean absolute error of the model and the schedule over the residuals held
+func (h *modelHealth) meanErrors() (float64, float64) {
+	modelError, scheduleError := 0.0, 0.0
+	for _, residual := range h.residuals {
+		modelError += residual.modelError
+		scheduleError += residual.scheduleError
+	}
+	count := float64(len(h.residuals))
+	return modelError / count, scheduleError / count
+}
+
+// modelPrediction is a model's prediction of the travel between a pair of stops on a trip awaiting its
+// ObservedStopTime
+type modelPrediction struct {
+	modelId          int64
+	modelName        string
+	predictedSeconds float64
+	scheduledSeconds int
+	madeAt           time.Time
+}
+
+// ModelDisablement describes a model disabled for predicting worse than the schedule
+type ModelDisablement struct {
+	MLModelId         int64     `json:"ml_model_id"`
+	ModelName         string    `json:"model_name"`
+	DisabledAt        time.Time `json:"disabled_at"`
+	Samples           int       `json:"samples"`
+	ModelMeanError    float64   `json:"model_mean_error"`
+	ScheduleMeanError float64   `json:"schedule_mean_error"`
+	ErrorRatio        float64   `json:"error_ratio"`
+}
+
+// modelHealthTracker compares the predictions of each model with the travel times later observed, and disables models
+// whose rolling error exceeds the schedule's by the policy's errorRatio. Segments predicted by a disabled model are
+// predicted with the schedule until the aggregator is restarted
+type modelHealthTracker struct {
+	mu          sync.RWMutex
+	policy      modelHealthPolicy
+	predictions map[string]*modelPrediction
+	models      map[int64]*modelHealth
+	//disablements holds the models disabled since they were last taken to be recorded
+	disablements []ModelDisablement
+}
+
+// makeModelHealthTracker builds modelHealthTracker with policy
+func makeModelHealthTracker(policy modelHealthPolicy) (*modelHealthTracker, error) {
+	if policy.window < 1 {
+		return nil, fmt.Errorf("model health window must be at least 1, received %d", policy.window)
+	}
+	if policy.minimumSamples < 1 || policy.minimumSamples > policy.window {
+		return nil, fmt.Errorf("model health minimum samples must be between 1 and the window of %d, received %d",
+			policy.window, policy.minimumSamples)
+	}
+	if policy.errorRatio <= 0 {
+		return nil, fmt.Errorf("model health error ratio must be greater than 0, received %f", policy.errorRatio)
+	}
+	return &modelHealthTracker{
+		policy:      policy,
+		predictions: make(map[string]*modelPrediction),
+		models:      make(map[int64]*modelHealth),
+	}, nil
+}
+
+// makeModelPredictionKey identifies the travel between stopId and nextStopId on tripId
+func makeModelPredictionKey(tripId string, stopId string, nextStopId string) string {
+	return tripId + "|" + stopId + "|" + nextStopId
+}
+
+// disabled returns true when the model with modelId has been disabled. Always false when t is nil
+func (t *modelHealthTracker) disabled(modelId int64) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	health, present := t.models[modelId]
+	return present && health.disabledAt != nil
+}
+
+// predictionReceived keeps the travel time between each pair of stops predicted by inferenceResponse from the model
+// of predictor, replacing earlier predictions for the same stops on tripId, until they are observed
+func (t *modelHealthTracker) predictionReceived(at time.Time,
+	tripId string,
+	predictor *segmentPredictor,
+	inferenceResponse float64) {
+	if t == nil || predictor.model == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	allStopsScheduledTime := predictor.scheduledTime()
+	var previousStop *gtfs.StopTimeInstance
+	for _, stop := range predictor.stopTimeInstances {
+		if previousStop != nil {
+			t.predictions[makeModelPredictionKey(tripId, previousStop.StopId, stop.StopId)] = &modelPrediction{
+				modelId:          predictor.model.MLModelId,
+				modelName:        predictor.model.ModelName,
+				predictedSeconds: calcStopSegmentTime(previousStop, stop, allStopsScheduledTime, inferenceResponse),
+				scheduledSeconds: stop.ArrivalTime - previousStop.ArrivalTime,
+				madeAt:           at,
+			}
+		}
+		previousStop = stop
+	}
+}
+
+// observed compares ost with the model prediction made for its stops, if any, and disables the model when its
+// rolling error exceeds the schedule's by the policy's errorRatio
+func (t *modelHealthTracker) observed(ost *gtfs.ObservedStopTime) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := makeModelPredictionKey(ost.TripId, ost.StopId, ost.NextStopId)
+	prediction, present := t.predictions[key]
+	if !present {
+		return
+	}
+	delete(t.predictions, key)
+	modelHealthMetrics.Add("compared", 1)
+
+	health, present := t.models[prediction.modelId]
+	if !present {
+		health = &modelHealth{modelId: prediction.modelId, modelName: prediction.modelName}
+		t.models[prediction.modelId] = health
+	}
+	residual := modelResidual{
+		modelError:    math.Abs(prediction.predictedSeconds - float64(ost.TravelSeconds)),
+		scheduleError: math.Abs(float64(prediction.scheduledSeconds - ost.TravelSeconds)),
+	}
+	if len(health.residuals) < t.policy.window {
+		health.residuals = append(health.residuals, residual)
+	} else {
+		health.residuals[health.next] = residual
+		health.next = (health.next + 1) % t.policy.window
+	}
+
+	if health.disabledAt != nil || len(health.residuals) < t.policy.minimumSamples {
+		return
+	}
+	modelError, scheduleError := health.meanErrors()
+	if modelError <= scheduleError*t.policy.errorRatio {
+		return
+	}
+	disabledAt := ost.ObservedTime
+	health.disabledAt = &disabledAt
+	modelHealthMetrics.Add("disabled", 1)
+	t.disablements = append(t.disablements, ModelDisablement{
+		MLModelId:         health.modelId,
+		ModelName:         health.modelName,
+		DisabledAt:        disabledAt,
+		Samples:           len(health.residuals),
+		ModelMeanError:    modelError,
+		ScheduleMeanError: scheduleError,
+		ErrorRatio:        t.policy.errorRatio,
+	})
+}
+
+// removeExpired discards predictions made before now less modelHealthPredictionAge, returning the number discarded
+func (t *modelHealthTracker) removeExpired(now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	expireBefore := now.Add(-modelHealthPredictionAge)
+	removed := 0
+	for key, prediction := range t.predictions {
+		if prediction.madeAt.Before(expireBefore) {
+			delete(t.predictions, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// takeDisablements returns the models disabled since takeDisablements was last called
+func (t *modelHealthTracker) takeDisablements() []ModelDisablement {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	disablements := t.disablements
+	t.disablements = nil
+	return disablements
+}
+
+// modelDisablementDestination records models disabled by modelHealthTracker, or implementation for testing
+type modelDisablementDestination interface {
+	recordModelDisablement(disablement ModelDisablement) error
+}
+
+// dbModelDisablementDestination records disabled models in system_event as systemevent.ModelDisabled events of app at
+// version
+type dbModelDisablementDestination struct {
+	db           *sqlx.DB
+	app          string
+	version      string
+	queryTimeout time.Duration
+}
+
+func (d *dbModelDisablementDestination) recordModelDisablement(disablement ModelDisablement) error {
+	details, err := json.Marshal(disablement)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.queryTimeout)
+	defer cancel()
+	return systemevent.Record(ctx, d.db, &systemevent.SystemEvent{
+		CreatedAt: disablement.DisabledAt,
+		App:       d.app,
+		Version:   d.version,
+		EventType: systemevent.ModelDisabled,
+		Description: fmt.Sprintf("disabled model %d %s, mean error %.1f seconds exceeded %.1f times the schedule's "+
+			"%.1f seconds over %d observations", disablement.MLModelId, disablement.ModelName,
+			disablement.ModelMeanError, disablement.ErrorRatio, disablement.ScheduleMeanError,
+			disablement.Samples),
+		Details: string(details),
+	})
+}
+
+// runModelHealthMonitor discards expired predictions from tracker and records the models it has disabled to
+// destination every modelHealthCheckInterval until shutdownSignal is received
+func runModelHealthMonitor(log *logger.Logger,
+	wg *sync.WaitGroup,
+	tracker *modelHealthTracker,
+	destination modelDisablementDestination,
+	now func() time.Time,
+	shutdownSignal chan bool) {
+	wg.Add(1)
+	defer wg.Done()
+
+	ticker := time.NewTicker(modelHealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-shutdownSignal:
+			log.Printf("Exiting model health monitor on shutdown signal")
+			return
+		case <-ticker.C:
+		}
+		tracker.removeExpired(now())
+		for _, disablement := range tracker.takeDisablements() {
+			log.Printf("Disabled model %d %s, predicting with the schedule. mean error:%.1f schedule mean error:%.1f",
+				disablement.MLModelId, disablement.ModelName, disablement.ModelMeanError,
+				disablement.ScheduleMeanError)
+			err := destination.recordModelDisablement(disablement)
+			if err != nil {
+				log.Printf("Unable to record %s in system_event: %v", systemevent.ModelDisabled, err)
+			}
+		}
+	}
+}
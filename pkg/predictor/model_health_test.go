@@ -0,0 +1,139 @@
+package predictor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
+	"testing"
+	"time"
+)
+
+// makeTestHealthSegmentPredictor builds a segmentPredictor for model over stops A, B and C scheduled 100 and 200
+// seconds apart
+func makeTestHealthSegmentPredictor(model *mlmodels.MLModel, health *modelHealthTracker) *segmentPredictor {
+	return &segmentPredictor{
+		model: model,
+		stopTimeInstances: []*gtfs.StopTimeInstance{
+			{StopTime: gtfs.StopTime{StopSequence: 1, StopId: "A", ArrivalTime: 1000, ShapeDistTraveled: 0}},
+			{StopTime: gtfs.StopTime{StopSequence: 2, StopId: "B", ArrivalTime: 1100, ShapeDistTraveled: 100}},
+			{StopTime: gtfs.StopTime{StopSequence: 3, StopId: "C", ArrivalTime: 1300, ShapeDistTraveled: 200}},
+		},
+		osts:            makeObservedStopTransitions(0, 0, 0),
+		holidayCalendar: makeTransitHolidayCalendar(),
+		useInference:    true,
+		health:          health,
+	}
+}
+
+func Test_modelHealthTracker_observed(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	model := &mlmodels.MLModel{MLModelId: 7, ModelName: "A_B_C"}
+	tests := []struct {
+		name string
+		//inferenceResponse is the model's prediction of the whole segment, split 1:2 between A-B and B-C
+		inferenceResponse float64
+		//travelSeconds is the observed travel time from A to B, scheduled at 100 seconds
+		travelSeconds    []int
+		wantDisabled     bool
+		wantDisablements int
+	}{
+		{
+			name:              "Model as accurate as schedule remains enabled",
+			inferenceResponse: 300,
+			travelSeconds:     []int{110, 90, 110, 90},
+			wantDisabled:      false,
+		},
+		{
+			name:              "Model worse than schedule disabled",
+			inferenceResponse: 600,
+			travelSeconds:     []int{110, 90, 110, 90},
+			wantDisabled:      true,
+			wantDisablements:  1,
+		},
+		{
+			name:              "Model worse than schedule not disabled before minimum samples",
+			inferenceResponse: 600,
+			travelSeconds:     []int{110, 90},
+			wantDisabled:      false,
+		},
+		{
+			name:              "Accurate predictions leaving the window no longer outweigh recent errors",
+			inferenceResponse: 600,
+			travelSeconds:     []int{200, 200, 200, 200, 200, 200, 200, 200, 100, 100, 100, 100, 100, 100},
+			wantDisabled:      true,
+			wantDisablements:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health, err := makeModelHealthTracker(modelHealthPolicy{window: 8, minimumSamples: 4, errorRatio: 1.5})
+			if err != nil {
+				t.Fatalf("makeModelHealthTracker() error = %v", err)
+			}
+			predictor := makeTestHealthSegmentPredictor(model, health)
+			for i, travelSeconds := range tt.travelSeconds {
+				tripId := string(rune('a' + i))
+				health.predictionReceived(at, tripId, predictor, tt.inferenceResponse)
+				health.observed(&gtfs.ObservedStopTime{
+					ObservedTime:  at,
+					StopId:        "A",
+					NextStopId:    "B",
+					TripId:        tripId,
+					TravelSeconds: travelSeconds,
+				})
+			}
+			if got := health.disabled(model.MLModelId); got != tt.wantDisabled {
+				t.Errorf("disabled() = %v, want %v", got, tt.wantDisabled)
+			}
+			if got := len(health.takeDisablements()); got != tt.wantDisablements {
+				t.Errorf("takeDisablements() returned %d disablements, want %d", got, tt.wantDisablements)
+			}
+		})
+	}
+}
+
+func Test_modelHealthTracker_removeExpired(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	health, err := makeModelHealthTracker(modelHealthPolicy{window: 8, minimumSamples: 1, errorRatio: 1.5})
+	if err != nil {
+		t.Fatalf("makeModelHealthTracker() error = %v", err)
+	}
+	predictor := makeTestHealthSegmentPredictor(&mlmodels.MLModel{MLModelId: 7}, health)
+	health.predictionReceived(at, "a", predictor, 300)
+	health.predictionReceived(at.Add(30*time.Minute), "b", predictor, 300)
+	if removed := health.removeExpired(at.Add(modelHealthPredictionAge + time.Minute)); removed != 2 {
+		t.Errorf("removeExpired() = %d, want the 2 predictions of trip a", removed)
+	}
+	if remaining := len(health.predictions); remaining != 2 {
+		t.Errorf("removeExpired() left %d predictions, want the 2 predictions of trip b", remaining)
+	}
+}
+
+func Test_segmentPredictor_predict_disabledModel(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	model := &mlmodels.MLModel{MLModelId: 7}
+	health, err := makeModelHealthTracker(modelHealthPolicy{window: 1, minimumSamples: 1, errorRatio: 1.5})
+	if err != nil {
+		t.Fatalf("makeModelHealthTracker() error = %v", err)
+	}
+	predictor := makeTestHealthSegmentPredictor(model, health)
+	deviation := &gtfs.TripDeviation{DeviationTimestamp: at, TripProgress: 0}
+
+	if result := predictor.predict(deviation); result.inferenceRequest == nil {
+		t.Fatalf("predict() made no inference request before the model was disabled")
+	}
+
+	health.predictionReceived(at, "a", predictor, 900)
+	health.observed(&gtfs.ObservedStopTime{ObservedTime: at, StopId: "A", NextStopId: "B", TripId: "a",
+		TravelSeconds: 100})
+
+	result := predictor.predict(deviation)
+	if result.inferenceRequest != nil {
+		t.Errorf("predict() made an inference request with a disabled model")
+	}
+	for _, sp := range result.stopPredictions {
+		scheduled := float64(sp.toStop.ArrivalTime - sp.fromStop.ArrivalTime)
+		if sp.predictionSource != gtfs.SchedulePrediction || sp.predictedTime != scheduled || !sp.predictionComplete {
+			t.Errorf("predict() with a disabled model = %+v, want complete schedule prediction of %f", sp, scheduled)
+		}
+	}
+}
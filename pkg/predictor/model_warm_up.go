@@ -0,0 +1,105 @@
+package predictor
+
+import (
+	"context"
+	"errors"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/jmoiron/sqlx"
+	logger "log"
+	"time"
+)
+
+// scheduledTripsProvider retrieves the trips scheduled in a window of time
+type scheduledTripsProvider interface {
+	GetScheduledTripInstances(ctx context.Context, start time.Time, end time.Time) (map[string]*gtfs.TripInstance, error)
+}
+
+// dbScheduledTripsProvider uses a database connection to retrieve scheduled trips
+// each query is abandoned after queryTimeout
+type dbScheduledTripsProvider struct {
+	db           *sqlx.DB
+	queryTimeout time.Duration
+}
+
+func (d *dbScheduledTripsProvider) GetScheduledTripInstances(ctx context.Context,
+	start time.Time,
+	end time.Time) (map[string]*gtfs.TripInstance, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.queryTimeout)
+	defer cancel()
+	tripIdMap, err := gtfs.GetScheduledTripIds(ctx, d.db, start, start, end)
+	if err != nil {
+		return nil, err
+	}
+	tripIds := make([]string, 0, len(tripIdMap))
+	for tripId := range tripIdMap {
+		tripIds = append(tripIds, tripId)
+	}
+	if len(tripIds) == 0 {
+		return map[string]*gtfs.TripInstance{}, nil
+	}
+	tripInstances, err := gtfs.GetTripInstancesBetween(ctx, d.db, start, start, end, tripIds, nil)
+	var missingTripInstances *gtfs.MissingTripInstances
+	if err != nil && !errors.As(err, &missingTripInstances) {
+		return nil, err
+	}
+	return tripInstances, nil
+}
+
+// modelVersion identifies a version of a model by name
+type modelVersion struct {
+	name    string
+	version int
+}
+
+// warmUpInProcessModels loads the in process models used to predict trips scheduled between "at" and "at" plus
+// window, so the first predictions made for them are not delayed by loading their models. Models for other trips are
+// loaded when they are first requested
+func warmUpInProcessModels(ctx context.Context,
+	log *logger.Logger,
+	dataProvider scheduledTripsProvider,
+	predictorFactory *segmentPredictorFactory,
+	requester *inProcessInferenceRequester,
+	at time.Time,
+	window time.Duration) error {
+	start := time.Now()
+	tripInstances, err := dataProvider.GetScheduledTripInstances(ctx, at, at.Add(window))
+	if err != nil {
+		return err
+	}
+	gtfs.RemoveInvalidTripTopologies(tripInstances)
+	models := scheduledTripModels(tripInstances, predictorFactory)
+	loaded := requester.preload(models)
+	elapsed := time.Since(start)
+	setInProcessModelMetric("warm_up_milliseconds", elapsed.Milliseconds())
+	log.Printf("Warmed up %d in process models of %d used by %d trips scheduled in the next %v in %v", loaded,
+		len(models), len(tripInstances), window, elapsed)
+	return nil
+}
+
+// scheduledTripModels returns the model versions, including shadow models, that predictorFactory would request
+// inference from to predict tripInstances
+func scheduledTripModels(tripInstances map[string]*gtfs.TripInstance,
+	predictorFactory *segmentPredictorFactory) []modelVersion {
+	var results []modelVersion
+	found := make(map[modelVersion]bool)
+	add := func(name string, version int) {
+		model := modelVersion{name: name, version: version}
+		if !found[model] {
+			found[model] = true
+			results = append(results, model)
+		}
+	}
+	for _, tripInstance := range tripInstances {
+		predictor := makeTripPredictor(tripInstance, predictorFactory, 0)
+		for _, segment := range predictor.segmentPredictors {
+			if !segment.useInference {
+				continue
+			}
+			add(segment.model.ModelName, segment.model.Version)
+			if segment.shadowModel != nil {
+				add(segment.shadowModel.ModelName, segment.shadowModel.Version)
+			}
+		}
+	}
+	return results
+}
@@ -0,0 +1,58 @@
+package predictor
+
+import (
+	"context"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
+	"io"
+	logger "log"
+	"testing"
+	"time"
+)
+
+// testScheduledTripsProvider returns its trips for any window
+type testScheduledTripsProvider struct {
+	trips map[string]*gtfs.TripInstance
+}
+
+func (p *testScheduledTripsProvider) GetScheduledTripInstances(_ context.Context,
+	_ time.Time,
+	_ time.Time) (map[string]*gtfs.TripInstance, error) {
+	return p.trips, nil
+}
+
+func Test_warmUpInProcessModels(t *testing.T) {
+	location, _ := time.LoadLocation("America/Los_Angeles")
+	at := time.Date(2022, 5, 22, 11, 30, 0, 0, location)
+	trip := getTestTrip(time.Date(2022, 5, 22, 0, 0, 0, 0, location), "trip_instance_1.json", t)
+	models := makeStubModels(trip, at)
+	factory := makeSegmentPredictionFactory(models, makeObservedStopTransitions(0, 0, 0), 0, 0, true, false, nil, nil,
+		false, nil)
+
+	directory := t.TempDir()
+	featureCount := len(testInProcessRequest("", "", 0).Features.featureArray())
+	firstModel := mlmodels.GetModelNameForStopTimeInstances(trip.StopTimeInstances[0:2])
+	lastModel := mlmodels.GetModelNameForStopTimeInstances(trip.StopTimeInstances[len(trip.StopTimeInstances)-2:])
+	writeTestOnnxModel(t, directory, firstModel, 0, featureCount, 1)
+	writeTestOnnxModel(t, directory, lastModel, 0, featureCount, 2)
+
+	log := logger.New(io.Discard, "test", 0)
+	requester := makeInProcessInferenceRequester(log, InProcessInferenceConf{ModelDirectory: directory}, nil, nil)
+	err := warmUpInProcessModels(context.Background(), log,
+		&testScheduledTripsProvider{trips: map[string]*gtfs.TripInstance{trip.TripId: trip}}, factory, requester, at,
+		time.Hour)
+	if err != nil {
+		t.Fatalf("warmUpInProcessModels() error = %v", err)
+	}
+	if len(requester.failed) != len(models)-2 {
+		t.Errorf("warmUpInProcessModels() failed to load %d models, want %d", len(requester.failed), len(models)-2)
+	}
+	if requester.lru.Len() != 2 {
+		t.Errorf("warmUpInProcessModels() cached %d models, want 2", requester.lru.Len())
+	}
+	for _, name := range []string{firstModel, lastModel} {
+		if requester.models[modelVersion{name: name}] == nil {
+			t.Errorf("warmUpInProcessModels() did not load model %s", name)
+		}
+	}
+}
@@ -1,9 +1,9 @@
-package aggregator
+package predictor
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
 	"github.com/nats-io/nats.go"
 	logger "log"
 	"os"
@@ -11,24 +11,26 @@ import (
 	"time"
 )
 
-//startObservedStopTransitionListener listens on NATS on 'vehicle-monitor-results' subject,
+//startObservedStopTransitionListener listens on NATS on the tenant's 'vehicle-monitor-results' subject,
 //expecting gtfs.VehicleMonitorResults. Adds all gtfs.VehicleMonitorResults.ObservedStopTimes to observedStopTransitions
-//collection
+//collection, and compares them with the model predictions kept by health
 //unlike the startTripUpdateListener, no queue is used so a gtfs-aggregator receives all ObservedStopTimes
 func startObservedStopTransitionListener(
 	log *logger.Logger,
 	wg *sync.WaitGroup,
 	osts *observedStopTransitions,
+	health *modelHealthTracker,
 	natsConn *nats.Conn,
+	subject string,
 	shutdownSignal chan bool) {
 
 	wg.Add(1)
 	defer wg.Done()
 
 	ch := make(chan *nats.Msg, 64)
-	log.Printf("Subscribing to vehicle-monitor-results in ObservedStopTransitionListener on nats server: %v\n",
+	log.Printf("Subscribing to %s in ObservedStopTransitionListener on nats server: %v\n", subject,
 		natsConn.Servers())
-	sub, err := natsConn.ChanSubscribe("vehicle-monitor-results", ch)
+	sub, err := natsConn.ChanSubscribe(subject, ch)
 	if err != nil {
 		log.Printf("Unable to establish subscription to nats server: %v\n", err)
 		os.Exit(1)
@@ -36,7 +38,7 @@ func startObservedStopTransitionListener(
 
 	//clean up nats
 	defer func() {
-		log.Printf("Unsubscribing to vehicle-monitor-results in ObservedStopTransitionListener\n")
+		log.Printf("Unsubscribing to %s in ObservedStopTransitionListener\n", subject)
 		err = sub.Unsubscribe()
 		if err != nil {
 			log.Printf("Error when attempting to unsubscribe: %v\n", err)
@@ -45,7 +47,7 @@ func startObservedStopTransitionListener(
 	for {
 		select {
 		case msg := <-ch:
-			fileOSTMessage(log, osts, msg)
+			fileOSTMessage(log, osts, health, msg)
 			break
 		case <-shutdownSignal:
 			log.Printf("exiting ObservedStopTransition listener on shutdown signal\n")
@@ -56,33 +58,47 @@ func startObservedStopTransitionListener(
 }
 
 //fileOSTMessage unmarshal gtfs.VehicleMonitorResults from NATS msg, and add gtfs.ObservedStopTime to
-//observedStopTransitions collection
+//observedStopTransitions collection and compare them with model predictions in health
 func fileOSTMessage(log *logger.Logger,
 	osts *observedStopTransitions,
+	health *modelHealthTracker,
 	msg *nats.Msg) {
 	var vehicleMonitorResults gtfs.VehicleMonitorResults
-	err := json.Unmarshal(msg.Data, &vehicleMonitorResults)
+	err := natsclient.Unmarshal(msg.Data, &vehicleMonitorResults)
 	if err != nil {
 		log.Printf("Error parsing VehicleMonitorResults: %v, payload:%s", err, string(msg.Data))
 		return
 	}
 	for _, ost := range vehicleMonitorResults.ObservedStopTimes {
 		osts.newOST(ost)
+		health.observed(ost)
 	}
 }
 
 //observedStopTransitions holds all ObservedStopTimes witnessed for use in stop passage features used in model inference
+//and keeps the most recent ObservedStopTimes between each pair of stops for predicting travel times without a model
 type observedStopTransitions struct {
 	stopToStopOSTMap     map[string]*gtfs.ObservedStopTime
+	recentOSTsMap        map[string][]*gtfs.ObservedStopTime
+	recentOSTCount       int
 	maximumTransitionAge time.Duration
-	mu                   sync.Mutex
+	//minimumConfidence is the least gtfs.ObservedStopTime.Confidence of ObservedStopTimes kept, those not scored
+	//are always kept
+	minimumConfidence float64
+	mu                sync.Mutex
 }
 
-//makeObservedStopTransitions builds observedStopTransitions
-func makeObservedStopTransitions(maximumTransitionSeconds int) *observedStopTransitions {
+//makeObservedStopTransitions builds observedStopTransitions, keeping up to recentOSTCount ObservedStopTimes between
+//each pair of stops for recentAverageTravelSeconds and ignoring ObservedStopTimes scored below minimumConfidence
+func makeObservedStopTransitions(maximumTransitionSeconds int,
+	recentOSTCount int,
+	minimumConfidence float64) *observedStopTransitions {
 	return &observedStopTransitions{
 		stopToStopOSTMap:     make(map[string]*gtfs.ObservedStopTime),
+		recentOSTsMap:        make(map[string][]*gtfs.ObservedStopTime),
+		recentOSTCount:       recentOSTCount,
 		maximumTransitionAge: time.Duration(maximumTransitionSeconds) * time.Second,
+		minimumConfidence:    minimumConfidence,
 		mu:                   sync.Mutex{},
 	}
 }
@@ -92,11 +108,42 @@ func stopTransitionName(from string, to string) string {
 	return fmt.Sprintf("%s_%s", from, to)
 }
 
-//newOST adds a gtfs.ObservedStopTime to the collection
+//newOST adds a gtfs.ObservedStopTime to the collection, unless it was scored below minimumConfidence
 func (t *observedStopTransitions) newOST(ost *gtfs.ObservedStopTime) {
+	if ost.Confidence > 0 && ost.Confidence < t.minimumConfidence {
+		return
+	}
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	t.stopToStopOSTMap[stopTransitionName(ost.StopId, ost.NextStopId)] = ost
+	key := stopTransitionName(ost.StopId, ost.NextStopId)
+	t.stopToStopOSTMap[key] = ost
+	if t.recentOSTCount > 0 {
+		recent := append(t.recentOSTsMap[key], ost)
+		if len(recent) > t.recentOSTCount {
+			recent = recent[len(recent)-t.recentOSTCount:]
+		}
+		t.recentOSTsMap[key] = recent
+	}
+}
+
+//recentAverageTravelSeconds returns the average travel seconds of the recent ObservedStopTimes between two stops
+//observed within maximumTransitionAge of "at", weighted by their confidence. returns false if there are none
+func (t *observedStopTransitions) recentAverageTravelSeconds(from string, to string, at time.Time) (float64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	total := 0.0
+	weight := 0.0
+	for _, ost := range t.recentOSTsMap[stopTransitionName(from, to)] {
+		if at.Sub(ost.ObservedTime) > t.maximumTransitionAge {
+			continue
+		}
+		total += float64(ost.TravelSeconds) * ost.ConfidenceWeight()
+		weight += ost.ConfidenceWeight()
+	}
+	if weight == 0 {
+		return 0, false
+	}
+	return total / weight, true
 }
 
 //getOst retrieves the last gtfs.ObservedStopTime between two stops.
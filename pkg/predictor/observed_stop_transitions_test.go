@@ -0,0 +1,86 @@
+package predictor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"testing"
+	"time"
+)
+
+func Test_observedStopTransitions_recentAverageTravelSeconds(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 30, 0, 0, time.UTC)
+	makeOST := func(minutesAgo int, travelSeconds int) *gtfs.ObservedStopTime {
+		return &gtfs.ObservedStopTime{
+			ObservedTime:  at.Add(time.Duration(-minutesAgo) * time.Minute),
+			StopId:        "A",
+			NextStopId:    "B",
+			TravelSeconds: travelSeconds,
+		}
+	}
+	makeScoredOST := func(minutesAgo int, travelSeconds int, confidence float64) *gtfs.ObservedStopTime {
+		ost := makeOST(minutesAgo, travelSeconds)
+		ost.Confidence = confidence
+		return ost
+	}
+	tests := []struct {
+		name              string
+		recentOSTCount    int
+		minimumConfidence float64
+		osts              []*gtfs.ObservedStopTime
+		want              float64
+		wantOk            bool
+	}{
+		{
+			name:           "no observations",
+			recentOSTCount: 3,
+			wantOk:         false,
+		},
+		{
+			name:           "disabled",
+			recentOSTCount: 0,
+			osts:           []*gtfs.ObservedStopTime{makeOST(5, 100)},
+			wantOk:         false,
+		},
+		{
+			name:           "averages last observations",
+			recentOSTCount: 3,
+			osts:           []*gtfs.ObservedStopTime{makeOST(20, 500), makeOST(15, 100), makeOST(10, 200), makeOST(5, 300)},
+			want:           200,
+			wantOk:         true,
+		},
+		{
+			name:           "ignores observations older than maximum age",
+			recentOSTCount: 3,
+			osts:           []*gtfs.ObservedStopTime{makeOST(90, 500), makeOST(10, 200), makeOST(5, 300)},
+			want:           250,
+			wantOk:         true,
+		},
+		{
+			name:           "weights observations by confidence",
+			recentOSTCount: 3,
+			osts:           []*gtfs.ObservedStopTime{makeScoredOST(10, 100, 0.25), makeOST(5, 200)},
+			want:           180,
+			wantOk:         true,
+		},
+		{
+			name:              "ignores observations below minimum confidence",
+			recentOSTCount:    3,
+			minimumConfidence: 0.5,
+			osts: []*gtfs.ObservedStopTime{makeScoredOST(15, 500, 0.4), makeScoredOST(10, 200, 0.5),
+				makeOST(5, 200)},
+			want:   200,
+			wantOk: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transitions := makeObservedStopTransitions(3600, tt.recentOSTCount, tt.minimumConfidence)
+			for _, ost := range tt.osts {
+				transitions.newOST(ost)
+			}
+			got, ok := transitions.recentAverageTravelSeconds("A", "B", at)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("recentAverageTravelSeconds() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
-package aggregator
+package predictor
 
 import (
+	"expvar"
 	"fmt"
 	"sort"
 	"strconv"
@@ -71,6 +72,14 @@ func (p *predictionBatch) orderedTripPredictions() []*tripPrediction {
 	return results
 }
 
+// coalesceKey identifies the batches whose inference requests are coalesced, by the trip the vehicle is on
+func (p *predictionBatch) coalesceKey() string {
+	if len(p.pendingTripPredictions) == 0 {
+		return ""
+	}
+	return p.pendingTripPredictions[0].tripPrediction.tripInstance.TripId
+}
+
 // allInferenceRequests returns slice of all InferenceRequests for this batch
 func (p *predictionBatch) allInferenceRequests() []*InferenceRequest {
 	var results []*InferenceRequest
@@ -80,6 +89,16 @@ func (p *predictionBatch) allInferenceRequests() []*InferenceRequest {
 	return results
 }
 
+// completeWithScheduleFallback completes the stopPredictions in this batch still awaiting inference responses with
+// their scheduled travel times, returning the number of stopPredictions completed
+func (p *predictionBatch) completeWithScheduleFallback() int {
+	completed := 0
+	for _, pending := range p.pendingTripPredictions {
+		completed += pending.tripPrediction.completeWithScheduleFallback()
+	}
+	return completed
+}
+
 // pendingTripPrediction contains tripPrediction and it's InferenceRequests
 type pendingTripPrediction struct {
 	tripPrediction    *tripPrediction
@@ -104,33 +123,107 @@ type pendingPredictionBatch struct {
 	predictionBatch *predictionBatch
 }
 
-// pendingPredictionsCollection contains and manages all predictionBatch structs, and allows for them to be expired
+// coalescedInferenceMetrics counts the batches held under /debug/vars while an earlier batch for the same trip was
+// awaiting inference, and those superseded by a newer batch before their requests were sent
+var coalescedInferenceMetrics = expvar.NewMap("coalesced_inference")
+
+// inferenceTimeoutMetrics counts the expired batches under /debug/vars that were still awaiting inference responses
+// and the stopPredictions in them completed with the schedule when they timed out
+var inferenceTimeoutMetrics = expvar.NewMap("inference_timeouts")
+
+// pendingPredictionsCollection contains and manages all predictionBatch structs, and allows for them to be expired.
+// When coalescing, only one batch for each trip awaits inference at a time. A batch made while another for its trip
+// is in flight is held, replacing any batch already held, until the batch in flight completes or expires
 type pendingPredictionsCollection struct {
 	mu                 sync.Mutex
 	pendingList        []*pendingPredictionBatch
 	expirationDuration time.Duration
+	coalesce           bool
+	// inflight holds the batch awaiting inference for each coalesceKey
+	inflight map[string]*pendingPredictionBatch
+	// held holds the newest batch for each coalesceKey made while another was in flight
+	held map[string]*predictionBatch
 }
 
-// makePendingPredictionsCollection builds pendingPredictionsCollection
-func makePendingPredictionsCollection(expireAfterSeconds int) *pendingPredictionsCollection {
+// makePendingPredictionsCollection builds pendingPredictionsCollection, coalescing inference requests for each trip
+// when coalesce is true
+func makePendingPredictionsCollection(expireAfterSeconds int, coalesce bool) *pendingPredictionsCollection {
 	return &pendingPredictionsCollection{
 		mu:                 sync.Mutex{},
 		pendingList:        make([]*pendingPredictionBatch, 0),
 		expirationDuration: time.Duration(expireAfterSeconds) * time.Second,
+		coalesce:           coalesce,
+		inflight:           make(map[string]*pendingPredictionBatch),
+		held:               make(map[string]*predictionBatch),
 	}
 }
 
-// addPendingPredictionBatch store a predictionBatch for later completion when InferenceResponses have been received
-func (p *pendingPredictionsCollection) addPendingPredictionBatch(at time.Time, batch *predictionBatch) {
+// addPendingPredictionBatch store a predictionBatch for later completion when InferenceResponses have been received.
+// returns false if the batch is held because another batch for the same trip is in flight, in which case its
+// InferenceRequests must not be sent yet
+func (p *pendingPredictionsCollection) addPendingPredictionBatch(at time.Time, batch *predictionBatch) bool {
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	if p.coalesce {
+		key := batch.coalesceKey()
+		if inflight, present := p.inflight[key]; present && inflight.expireTime.After(at) {
+			if _, held := p.held[key]; held {
+				coalescedInferenceMetrics.Add("superseded", 1)
+			}
+			coalescedInferenceMetrics.Add("held", 1)
+			p.held[key] = batch
+			return false
+		}
+		// a batch held behind an expired batch is older than this one
+		if _, held := p.held[key]; held {
+			coalescedInferenceMetrics.Add("superseded", 1)
+			delete(p.held, key)
+		}
+	}
+	p.addPending(at, batch)
+	return true
+}
+
+// addPending stores batch as pending, and in flight when coalescing. p.mu must be held
+func (p *pendingPredictionsCollection) addPending(at time.Time, batch *predictionBatch) {
 	newPrediction := pendingPredictionBatch{
 		expireTime:      at.Add(p.expirationDuration),
 		predictionBatch: batch,
 	}
 	p.pendingList = append(p.pendingList, &newPrediction)
+	if p.coalesce {
+		p.inflight[batch.coalesceKey()] = &newPrediction
+	}
+}
+
+// completePredictionBatch ends batch being in flight once all its InferenceResponses have been applied. returns the
+// batch held for the same trip, now stored as pending, whose InferenceRequests should be sent, or nil if none is held
+func (p *pendingPredictionsCollection) completePredictionBatch(at time.Time, batch *predictionBatch) *predictionBatch {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.releaseHeld(at, batch)
+}
+
+// releaseHeld ends batch being in flight, storing and returning the batch held for the same trip. p.mu must be held
+func (p *pendingPredictionsCollection) releaseHeld(at time.Time, batch *predictionBatch) *predictionBatch {
+	if !p.coalesce {
+		return nil
+	}
+	key := batch.coalesceKey()
+	inflight, present := p.inflight[key]
+	if !present || inflight.predictionBatch != batch {
+		return nil
+	}
+	delete(p.inflight, key)
+	held, present := p.held[key]
+	if !present {
+		return nil
+	}
+	delete(p.held, key)
+	p.addPending(at, held)
+	return held
 }
 
 // getPendingPrediction for an InferenceResponse, retrieve its non-expired predictionBatch, tripPrediction,
@@ -160,8 +253,10 @@ func (p *pendingPredictionsCollection) getPendingPrediction(at time.Time,
 }
 
 // removeExpiredPredictions remove all expired predictionBatch that have expired. Called by a background cleanup routine
-// returns slice of expired predictionBatch and size of current predictionBatch in collection
-func (p *pendingPredictionsCollection) removeExpiredPredictions(at time.Time) ([]*predictionBatch, int) {
+// returns slice of expired predictionBatch, batches held for the same trips as expired batches in flight that are now
+// pending and whose InferenceRequests should be sent, and size of current predictionBatch in collection
+func (p *pendingPredictionsCollection) removeExpiredPredictions(at time.Time) ([]*predictionBatch,
+	[]*predictionBatch, int) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -176,7 +271,43 @@ func (p *pendingPredictionsCollection) removeExpiredPredictions(at time.Time) ([
 	}
 	p.pendingList = newPendingList
 
-	return expiredList, len(p.pendingList)
+	var releasedList []*predictionBatch
+	for _, expired := range expiredList {
+		if released := p.releaseHeld(at, expired); released != nil {
+			releasedList = append(releasedList, released)
+		}
+	}
+
+	return expiredList, releasedList, len(p.pendingList)
+}
+
+// timedOutPredictionBatches returns the batches in expired still awaiting inference responses that are not replaced by
+// a newer batch for the same trip, either expired or still pending
+func (p *pendingPredictionsCollection) timedOutPredictionBatches(expired []*predictionBatch) []*predictionBatch {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	newest := make(map[string]time.Time)
+	recordNewest := func(batch *predictionBatch) {
+		key := batch.coalesceKey()
+		if batch.createdAt.After(newest[key]) {
+			newest[key] = batch.createdAt
+		}
+	}
+	for _, pending := range p.pendingList {
+		recordNewest(pending.predictionBatch)
+	}
+	for _, batch := range expired {
+		recordNewest(batch)
+	}
+
+	var results []*predictionBatch
+	for _, batch := range expired {
+		if batch.predictionsRemaining() > 0 && !newest[batch.coalesceKey()].After(batch.createdAt) {
+			results = append(results, batch)
+		}
+	}
+	return results
 }
 
 // makePredictionsBatchId builds an identifier for use in a predictionBatch
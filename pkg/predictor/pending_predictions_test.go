@@ -0,0 +1,264 @@
+package predictor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPendingPredictionsCollection_getPendingPrediction(t *testing.T) {
+
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Errorf("Unable to get testing time zone location")
+		return
+	}
+
+	twelve := time.Date(2022, 5, 22, 12, 00, 00, 0, location)
+
+	tripPredictionAtTwelve := &tripPrediction{
+		tripDeviation: &gtfs.TripDeviation{CreatedAt: twelve},
+		stopPredictions: []*stopPrediction{
+			{
+				fromStop: &gtfs.StopTimeInstance{
+					StopTime: gtfs.StopTime{
+						TripId:            "trip1",
+						StopSequence:      1,
+						StopId:            "A",
+						ArrivalTime:       1000,
+						DepartureTime:     1000,
+						ShapeDistTraveled: 0,
+					},
+					FirstStop: true,
+				},
+				toStop: &gtfs.StopTimeInstance{
+					StopTime: gtfs.StopTime{
+						TripId:            "trip1",
+						StopSequence:      2,
+						StopId:            "B",
+						ArrivalTime:       2000,
+						DepartureTime:     2000,
+						ShapeDistTraveled: 1000,
+					},
+					FirstStop: true,
+				},
+				predictedTime:      10,
+				predictionComplete: false,
+			},
+		},
+		tripInstance: &gtfs.TripInstance{
+			Trip: gtfs.Trip{TripId: "trip1"},
+		},
+		pendingPredictions: 1,
+	}
+
+	inferenceRequest1 := &InferenceRequest{
+		MLModelId: 1,
+		Version:   1,
+		Features:  inferenceFeatures{},
+	}
+
+	predictionBatch1 := makePredictionBatch(twelve, "101")
+
+	predictionBatch1.addPendingTripPrediction(tripPredictionAtTwelve, []*InferenceRequest{inferenceRequest1})
+
+	pendingPrediction1 := &pendingPredictionBatch{
+
+		expireTime:      twelve,
+		predictionBatch: predictionBatch1,
+	}
+
+	type fields struct {
+		pendingList        []*pendingPredictionBatch
+		expireAfterSeconds int
+	}
+	type args struct {
+		response InferenceResponse
+		at       time.Time
+	}
+	tests := []struct {
+		name                 string
+		fields               fields
+		args                 args
+		wantPredictionBatch  *predictionBatch
+		wantTripPrediction   *tripPrediction
+		wantInferenceRequest *InferenceRequest
+		wantErr              bool
+	}{
+		{
+			name: "basic retrieval",
+			fields: fields{
+				pendingList: []*pendingPredictionBatch{
+					pendingPrediction1,
+				},
+				expireAfterSeconds: 3,
+			},
+			args: args{
+				response: InferenceResponse{
+					RequestId:  inferenceRequest1.RequestId,
+					MLModelId:  1,
+					Version:    1,
+					Prediction: 1.0,
+					Error:      "",
+				},
+				at: twelve,
+			},
+			wantPredictionBatch:  predictionBatch1,
+			wantTripPrediction:   tripPredictionAtTwelve,
+			wantInferenceRequest: inferenceRequest1,
+			wantErr:              false,
+		},
+		{
+			name: "expired retrieval",
+			fields: fields{
+				pendingList: []*pendingPredictionBatch{
+					pendingPrediction1,
+				},
+				expireAfterSeconds: 3,
+			},
+			args: args{
+				response: InferenceResponse{
+					RequestId:  inferenceRequest1.RequestId,
+					MLModelId:  1,
+					Version:    1,
+					Prediction: 1.0,
+					Error:      "",
+				},
+				at: twelve.Add(time.Duration(4) * time.Second),
+			},
+			wantPredictionBatch:  nil,
+			wantTripPrediction:   nil,
+			wantInferenceRequest: nil,
+			wantErr:              true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &pendingPredictionsCollection{
+				pendingList:        tt.fields.pendingList,
+				expirationDuration: time.Duration(tt.fields.expireAfterSeconds) * time.Second,
+			}
+			gotPredictionBatch, gotTripPrediction, gotInferenceRequest, err := p.getPendingPrediction(tt.args.at, tt.args.response)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getPendingPrediction() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotPredictionBatch, tt.wantPredictionBatch) {
+				t.Errorf("getPendingPrediction() gotPredictionBatch = %v, wantPredictionBatch %v", gotPredictionBatch, tt.wantPredictionBatch)
+			}
+			if !reflect.DeepEqual(gotTripPrediction, tt.wantTripPrediction) {
+				t.Errorf("getPendingPrediction() gotPendingPrediction = %v, wantPendingPrediction %v", gotTripPrediction, tt.wantTripPrediction)
+			}
+			if !reflect.DeepEqual(gotInferenceRequest, tt.wantInferenceRequest) {
+				t.Errorf("getPendingPrediction() gotInferenceRequest = %v, wantPendingPrediction %v", gotInferenceRequest, tt.wantInferenceRequest)
+			}
+		})
+	}
+}
+
+// testTripBatch builds a predictionBatch for vehicleId on tripId created at "at"
+func testTripBatch(at time.Time, vehicleId string, tripId string) *predictionBatch {
+	batch := makePredictionBatch(at, vehicleId)
+	batch.addPendingTripPrediction(&tripPrediction{
+		tripInstance: &gtfs.TripInstance{Trip: gtfs.Trip{TripId: tripId}},
+	}, nil)
+	return batch
+}
+
+func TestPendingPredictionsCollection_coalescing(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	pending := makePendingPredictionsCollection(8, true)
+
+	first := testTripBatch(at, "1", "trip1")
+	if !pending.addPendingPredictionBatch(at, first) {
+		t.Fatalf("addPendingPredictionBatch() held the first batch for trip1")
+	}
+	otherTrip := testTripBatch(at, "2", "trip2")
+	if !pending.addPendingPredictionBatch(at, otherTrip) {
+		t.Errorf("addPendingPredictionBatch() held a batch for another trip")
+	}
+	second := testTripBatch(at.Add(time.Second), "1", "trip1")
+	third := testTripBatch(at.Add(2*time.Second), "1", "trip1")
+	if pending.addPendingPredictionBatch(at.Add(time.Second), second) ||
+		pending.addPendingPredictionBatch(at.Add(2*time.Second), third) {
+		t.Fatalf("addPendingPredictionBatch() sent a batch while trip1 was in flight")
+	}
+
+	// only the newest held batch is released when the first completes
+	if got := pending.completePredictionBatch(at.Add(3*time.Second), first); got != third {
+		t.Fatalf("completePredictionBatch() = %v, want the newest held batch", got)
+	}
+	if got := pending.completePredictionBatch(at.Add(3*time.Second), first); got != nil {
+		t.Errorf("completePredictionBatch() released %v on a batch no longer in flight", got)
+	}
+
+	// a batch held behind a batch that expires is released by removeExpiredPredictions
+	fourth := testTripBatch(at.Add(4*time.Second), "1", "trip1")
+	if pending.addPendingPredictionBatch(at.Add(4*time.Second), fourth) {
+		t.Fatalf("addPendingPredictionBatch() sent a batch while the released batch was in flight")
+	}
+	_, released, _ := pending.removeExpiredPredictions(at.Add(12 * time.Second))
+	if !reflect.DeepEqual(released, []*predictionBatch{fourth}) {
+		t.Errorf("removeExpiredPredictions() released %v, want the batch held behind the expired batch", released)
+	}
+}
+
+func TestPendingPredictionsCollection_coalescing_disabled(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	pending := makePendingPredictionsCollection(8, false)
+	first := testTripBatch(at, "1", "trip1")
+	pending.addPendingPredictionBatch(at, first)
+	if !pending.addPendingPredictionBatch(at, testTripBatch(at.Add(time.Second), "1", "trip1")) {
+		t.Errorf("addPendingPredictionBatch() held a batch with coalescing disabled")
+	}
+	if got := pending.completePredictionBatch(at, first); got != nil {
+		t.Errorf("completePredictionBatch() = %v, want nil", got)
+	}
+}
+
+// testAwaitingTripBatch builds a predictionBatch for vehicleId on tripId created at "at" with a stopPrediction awaiting
+// an inference response
+func testAwaitingTripBatch(at time.Time, vehicleId string, tripId string) *predictionBatch {
+	batch := makePredictionBatch(at, vehicleId)
+	batch.addPendingTripPrediction(makeTripPrediction(&gtfs.TripDeviation{},
+		&gtfs.TripInstance{Trip: gtfs.Trip{TripId: tripId}},
+		[]*stopPrediction{{
+			fromStop:              &gtfs.StopTimeInstance{StopTime: gtfs.StopTime{StopSequence: 1, ArrivalTime: 100}},
+			toStop:                &gtfs.StopTimeInstance{StopTime: gtfs.StopTime{StopSequence: 2, ArrivalTime: 160}},
+			predictedTime:         45,
+			predictionSource:      gtfs.StopStatisticsPrediction,
+			stopUpdateDisposition: FutureStop,
+		}}), nil)
+	return batch
+}
+
+func TestPendingPredictionsCollection_timedOutPredictionBatches(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	pending := makePendingPredictionsCollection(8, false)
+	replaced := testAwaitingTripBatch(at, "1", "trip1")
+	replacement := testAwaitingTripBatch(at.Add(5*time.Second), "1", "trip1")
+	timedOut := testAwaitingTripBatch(at, "2", "trip2")
+	completed := testTripBatch(at, "3", "trip3")
+	for _, batch := range []*predictionBatch{replaced, replacement, timedOut, completed} {
+		pending.addPendingPredictionBatch(batch.createdAt, batch)
+	}
+
+	expired, _, _ := pending.removeExpiredPredictions(at.Add(9 * time.Second))
+	got := pending.timedOutPredictionBatches(expired)
+	if !reflect.DeepEqual(got, []*predictionBatch{timedOut}) {
+		t.Fatalf("timedOutPredictionBatches() = %v, want only the batch awaiting inference and not replaced", got)
+	}
+
+	if completedStops := timedOut.completeWithScheduleFallback(); completedStops != 1 {
+		t.Errorf("completeWithScheduleFallback() = %d, want 1", completedStops)
+	}
+	if remaining := timedOut.predictionsRemaining(); remaining != 0 {
+		t.Errorf("completeWithScheduleFallback() left %d predictions remaining", remaining)
+	}
+	stop := timedOut.pendingTripPredictions[0].tripPrediction.stopPredictions[0]
+	if stop.predictedTime != 60 || stop.predictionSource != gtfs.SchedulePrediction || !stop.predictionComplete ||
+		stop.stopUpdateDisposition != FutureStop {
+		t.Errorf("completeWithScheduleFallback() stopPrediction = %+v, want 60 scheduled seconds", stop)
+	}
+}
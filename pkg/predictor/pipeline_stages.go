@@ -0,0 +1,72 @@
+package predictor
+
+import (
+	"context"
+	"expvar"
+	"runtime/trace"
+	"sync"
+	"time"
+)
+
+// steps of the prediction pipeline timed by startPipelineStage
+const (
+	//stageInferenceBatching builds a vehicle's predictionBatch and the InferenceRequests it needs
+	stageInferenceBatching = "inference_batching"
+	//stageInferenceRequests sends a predictionBatch's InferenceRequests with the inferenceRequester
+	stageInferenceRequests = "inference_requests"
+	//stageTripUpdateBuilding builds, smooths and filters the TripUpdates of a completed predictionBatch
+	stageTripUpdateBuilding = "trip_update_building"
+	//stageTripUpdatePublishing publishes a TripUpdate to its predictionPublicationDestination
+	stageTripUpdatePublishing = "trip_update_publishing"
+)
+
+// pipelineStageMetrics holds the count, total and maximum microseconds of each pipeline stage under /debug/vars
+var pipelineStageMetrics = expvar.NewMap("pipeline_stages")
+
+// pipelineStageMetricsMu serializes recordPipelineStage so each stage's metrics are created once and its maximum isn't
+// lowered by a concurrent update
+var pipelineStageMetricsMu sync.Mutex
+
+// pipelineStage is a running step of the prediction pipeline, marked as a runtime/trace region so it's visible in
+// execution traces captured from /debug/pprof/trace
+type pipelineStage struct {
+	name    string
+	region  *trace.Region
+	started time.Time
+}
+
+// startPipelineStage begins timing the stage named name within ctx, which must be ended with end.
+// Stages are timed with the wall clock rather than the aggregator's clock, which may be simulated
+func startPipelineStage(ctx context.Context, name string) *pipelineStage {
+	return &pipelineStage{
+		name:    name,
+		region:  trace.StartRegion(ctx, name),
+		started: time.Now(),
+	}
+}
+
+// end finishes the stage's trace region and records its duration in pipelineStageMetrics
+func (s *pipelineStage) end() {
+	s.region.End()
+	recordPipelineStage(s.name, time.Since(s.started))
+}
+
+// recordPipelineStage adds elapsed to the metrics of the stage named name
+func recordPipelineStage(name string, elapsed time.Duration) {
+	pipelineStageMetricsMu.Lock()
+	defer pipelineStageMetricsMu.Unlock()
+	metrics, ok := pipelineStageMetrics.Get(name).(*expvar.Map)
+	if !ok {
+		metrics = new(expvar.Map).Init()
+		metrics.Set("count", new(expvar.Int))
+		metrics.Set("total_microseconds", new(expvar.Int))
+		metrics.Set("max_microseconds", new(expvar.Int))
+		pipelineStageMetrics.Set(name, metrics)
+	}
+	microseconds := elapsed.Microseconds()
+	metrics.Add("count", 1)
+	metrics.Add("total_microseconds", microseconds)
+	if max := metrics.Get("max_microseconds").(*expvar.Int); microseconds > max.Value() {
+		max.Set(microseconds)
+	}
+}
@@ -0,0 +1,26 @@
+package predictor
+
+import (
+	"context"
+	"expvar"
+	"testing"
+	"time"
+)
+
+func Test_recordPipelineStage(t *testing.T) {
+	name := "test_stage"
+	recordPipelineStage(name, 3*time.Millisecond)
+	recordPipelineStage(name, time.Millisecond)
+	startPipelineStage(context.Background(), name).end()
+
+	metrics := pipelineStageMetrics.Get(name).(*expvar.Map)
+	if got := metrics.Get("count").(*expvar.Int).Value(); got != 3 {
+		t.Errorf("count = %d, want 3", got)
+	}
+	if got := metrics.Get("total_microseconds").(*expvar.Int).Value(); got < 4000 {
+		t.Errorf("total_microseconds = %d, want at least 4000", got)
+	}
+	if got := metrics.Get("max_microseconds").(*expvar.Int).Value(); got < 3000 {
+		t.Errorf("max_microseconds = %d, want at least 3000", got)
+	}
+}
@@ -0,0 +1,125 @@
+package predictor
+
+import (
+	"expvar"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"sync"
+	"time"
+)
+
+// publishedTripUpdateRetention is how long the last TripUpdate published for a trip is remembered, trips not
+// published for longer have usually ended
+const publishedTripUpdateRetention = time.Hour
+
+// suppressedTripUpdates counts TripUpdates not published by tripUpdateDeltaFilter, exported under /debug/vars
+var suppressedTripUpdates = expvar.NewInt("trip_updates_suppressed")
+
+// publishedStopTime is the predicted arrival and departure last published for a stop
+type publishedStopTime struct {
+	arrival   time.Time
+	departure time.Time
+}
+
+// publishedTripUpdate is what tripUpdateDeltaFilter remembers about the last TripUpdate published for a trip
+type publishedTripUpdate struct {
+	at        time.Time
+	vehicleId string
+	stopTimes map[uint32]publishedStopTime
+}
+
+// tripUpdateDeltaFilter reduces the TripUpdates published by only allowing a TripUpdate when it moves the
+// prediction at a stop by more than threshold from the last TripUpdate published for the trip, or once heartbeat has
+// passed since the last was published. A nil tripUpdateDeltaFilter allows every TripUpdate
+type tripUpdateDeltaFilter struct {
+	mu         sync.Mutex
+	threshold  time.Duration
+	heartbeat  time.Duration
+	published  map[string]*publishedTripUpdate
+	lastPruned time.Time
+}
+
+// makeTripUpdateDeltaFilter builds tripUpdateDeltaFilter, returning nil when thresholdSeconds is zero or less so every
+// TripUpdate is published. A heartbeatSeconds of zero or less only publishes TripUpdates that change
+func makeTripUpdateDeltaFilter(thresholdSeconds int, heartbeatSeconds int) *tripUpdateDeltaFilter {
+	if thresholdSeconds <= 0 {
+		return nil
+	}
+	return &tripUpdateDeltaFilter{
+		threshold: time.Duration(thresholdSeconds) * time.Second,
+		heartbeat: time.Duration(heartbeatSeconds) * time.Second,
+		published: make(map[string]*publishedTripUpdate),
+	}
+}
+
+// shouldPublish returns true if tripUpdate should be published at "now", remembering it as the last TripUpdate
+// published for its trip
+func (f *tripUpdateDeltaFilter) shouldPublish(tripUpdate *gtfs.TripUpdate, now time.Time) bool {
+	if f == nil {
+		return true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.prune(now)
+	last, present := f.published[tripUpdate.TripId]
+	if present && !f.changed(last, tripUpdate) && (f.heartbeat <= 0 || now.Sub(last.at) < f.heartbeat) {
+		suppressedTripUpdates.Add(1)
+		return false
+	}
+	f.published[tripUpdate.TripId] = makePublishedTripUpdate(tripUpdate, now)
+	return true
+}
+
+// changed returns true if tripUpdate is for another vehicle, predicts a stop not in last, or moves the prediction at
+// any stop by more than threshold. Stops in last missing from tripUpdate have been passed by the vehicle and are
+// not a change
+func (f *tripUpdateDeltaFilter) changed(last *publishedTripUpdate, tripUpdate *gtfs.TripUpdate) bool {
+	if last.vehicleId != tripUpdate.VehicleId {
+		return true
+	}
+	for _, stopTimeUpdate := range tripUpdate.StopTimeUpdates {
+		stopTime, present := last.stopTimes[stopTimeUpdate.StopSequence]
+		if !present {
+			return true
+		}
+		if absDuration(stopTime.arrival.Sub(stopTimeUpdate.PredictedArrivalTime)) > f.threshold ||
+			absDuration(stopTime.departure.Sub(stopTimeUpdate.LatestPredictedTime())) > f.threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// prune forgets trips not published within publishedTripUpdateRetention, checking at most once a minute
+func (f *tripUpdateDeltaFilter) prune(now time.Time) {
+	if now.Sub(f.lastPruned) < time.Minute {
+		return
+	}
+	f.lastPruned = now
+	for tripId, published := range f.published {
+		if now.Sub(published.at) > publishedTripUpdateRetention {
+			delete(f.published, tripId)
+		}
+	}
+}
+
+func makePublishedTripUpdate(tripUpdate *gtfs.TripUpdate, at time.Time) *publishedTripUpdate {
+	published := &publishedTripUpdate{
+		at:        at,
+		vehicleId: tripUpdate.VehicleId,
+		stopTimes: make(map[uint32]publishedStopTime, len(tripUpdate.StopTimeUpdates)),
+	}
+	for _, stopTimeUpdate := range tripUpdate.StopTimeUpdates {
+		published.stopTimes[stopTimeUpdate.StopSequence] = publishedStopTime{
+			arrival:   stopTimeUpdate.PredictedArrivalTime,
+			departure: stopTimeUpdate.LatestPredictedTime(),
+		}
+	}
+	return published
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
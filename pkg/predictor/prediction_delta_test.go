@@ -0,0 +1,107 @@
+package predictor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"testing"
+	"time"
+)
+
+// makeDeltaTestTripUpdate builds a TripUpdate for trip "1" predicting arrivals at each stop sequence after start
+func makeDeltaTestTripUpdate(vehicleId string, start time.Time, stopSequences ...uint32) *gtfs.TripUpdate {
+	tripUpdate := &gtfs.TripUpdate{TripId: "1", VehicleId: vehicleId}
+	for i, stopSequence := range stopSequences {
+		tripUpdate.StopTimeUpdates = append(tripUpdate.StopTimeUpdates, gtfs.StopTimeUpdate{
+			StopSequence:         stopSequence,
+			PredictedArrivalTime: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	return tripUpdate
+}
+
+func Test_tripUpdateDeltaFilter_shouldPublish(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		next        *gtfs.TripUpdate
+		nextAt      time.Time
+		wantPublish bool
+	}{
+		{
+			name:        "unchanged",
+			next:        makeDeltaTestTripUpdate("100", at, 1, 2, 3),
+			nextAt:      at.Add(5 * time.Second),
+			wantPublish: false,
+		},
+		{
+			name:        "change within threshold",
+			next:        makeDeltaTestTripUpdate("100", at.Add(15*time.Second), 1, 2, 3),
+			nextAt:      at.Add(5 * time.Second),
+			wantPublish: false,
+		},
+		{
+			name:        "change beyond threshold",
+			next:        makeDeltaTestTripUpdate("100", at.Add(16*time.Second), 1, 2, 3),
+			nextAt:      at.Add(5 * time.Second),
+			wantPublish: true,
+		},
+		{
+			name:        "passed stop is not a change",
+			next:        makeDeltaTestTripUpdate("100", at.Add(time.Minute), 2, 3),
+			nextAt:      at.Add(5 * time.Second),
+			wantPublish: false,
+		},
+		{
+			name:        "new stop",
+			next:        makeDeltaTestTripUpdate("100", at, 1, 2, 3, 4),
+			nextAt:      at.Add(5 * time.Second),
+			wantPublish: true,
+		},
+		{
+			name:        "new vehicle",
+			next:        makeDeltaTestTripUpdate("200", at, 1, 2, 3),
+			nextAt:      at.Add(5 * time.Second),
+			wantPublish: true,
+		},
+		{
+			name:        "heartbeat",
+			next:        makeDeltaTestTripUpdate("100", at, 1, 2, 3),
+			nextAt:      at.Add(time.Minute),
+			wantPublish: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := makeTripUpdateDeltaFilter(15, 60)
+			if !filter.shouldPublish(makeDeltaTestTripUpdate("100", at, 1, 2, 3), at) {
+				t.Fatalf("shouldPublish() first TripUpdate for trip was not published")
+			}
+			if got := filter.shouldPublish(tt.next, tt.nextAt); got != tt.wantPublish {
+				t.Errorf("shouldPublish() = %v, want %v", got, tt.wantPublish)
+			}
+		})
+	}
+}
+
+func Test_tripUpdateDeltaFilter_disabled(t *testing.T) {
+	filter := makeTripUpdateDeltaFilter(0, 60)
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if !filter.shouldPublish(makeDeltaTestTripUpdate("100", at, 1, 2, 3), at) {
+			t.Errorf("shouldPublish() with no threshold should publish every TripUpdate")
+		}
+	}
+}
+
+func Test_tripUpdateDeltaFilter_prune(t *testing.T) {
+	filter := makeTripUpdateDeltaFilter(15, 0)
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	filter.shouldPublish(makeDeltaTestTripUpdate("100", at, 1, 2, 3), at)
+	if filter.shouldPublish(makeDeltaTestTripUpdate("100", at, 1, 2, 3), at.Add(30*time.Minute)) {
+		t.Errorf("shouldPublish() without heartbeat published an unchanged TripUpdate")
+	}
+	later := at.Add(publishedTripUpdateRetention + time.Minute)
+	filter.shouldPublish(&gtfs.TripUpdate{TripId: "2"}, later)
+	if _, present := filter.published["1"]; present {
+		t.Errorf("prune() kept trip not published within publishedTripUpdateRetention")
+	}
+}
@@ -1,9 +1,11 @@
-package aggregator
+package predictor
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/foundation/clock"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
 	"github.com/nats-io/nats.go"
 	logger "log"
 	"math"
@@ -11,74 +13,148 @@ import (
 )
 
 // predictionPublicationDestination is where predictions should be sent after completion.
+// subject is chosen for the TripUpdate's route by predictionSubjectRouter
 type predictionPublicationDestination interface {
-	Publish(update *gtfs.TripUpdate) error
+	Publish(subject string, update *gtfs.TripUpdate) error
 }
 
-// natsPredictionPublicationDestination sends predictions over nats
+// natsPredictionPublicationDestination sends predictions over nats encoded by codec on the tenant's subjects
 type natsPredictionPublicationDestination struct {
-	natsConn          *nats.Conn
-	predictionSubject string
+	natsConn *nats.Conn
+	codec    natsclient.Codec
+	subjects natsclient.Subjects
 }
 
-func (n *natsPredictionPublicationDestination) Publish(tripUpdate *gtfs.TripUpdate) error {
-	jsonData, err := json.Marshal(tripUpdate)
+func (n *natsPredictionPublicationDestination) Publish(subject string, tripUpdate *gtfs.TripUpdate) error {
+	tripUpdate.SchemaVersion = gtfs.MessageSchemaVersion
+	jsonData, err := n.codec.Marshal(tripUpdate)
 	if err != nil {
 		return fmt.Errorf("error marshaling tripUpdate to json: error:%v\n", err)
 	}
-	return n.natsConn.Publish(n.predictionSubject, jsonData)
+	return n.natsConn.Publish(n.subjects.Subject(subject), jsonData)
 }
 
 // predictionPublisher takes completed predictions and publishes them on NATS connection as TripUpdates
 type predictionPublisher struct {
 	log                              *logger.Logger
 	predictionPublicationDestination predictionPublicationDestination
-	limitEarlyDepartureSeconds       int
+	subjects                         *predictionSubjectRouter
+	earlyDepartures                  *earlyDepartureLimits
+	dwells                           *stopDwells
+	deltas                           *tripUpdateDeltaFilter
+	smoother                         *delaySmoother
+	sourceTally                      *predictionSourceTally
+	routeActivity                    *routeActivityTracker
+	layovers                         *layoverPolicy
+	overrides                        *tripOverrides
+	connections                      *connectionTracker
+	clock                            clock.Clock
 }
 
-// makePredictionPublisher builds predictionPublisher
+// makePredictionPublisher builds predictionPublisher, published stop updates are counted in sourceTally
+// and the routes published are recorded in routeActivity at the time given by clk. layovers sets the layover taken
+// between trips on a block. TripUpdates are sent to predictionPublicationDestination on the subject chosen by subjects.
+// earlyDepartures limits how early each trip is predicted to depart its timepoints, departures from stops with an
+// average dwell in dwells are predicted when dwells is not nil, each trip's delay is smoothed by smoother, and TripUpdates that don't change enough to pass deltas are not published. Dispatcher overrides in overrides are applied to each TripUpdate
+// and TripUpdates published are recorded in connections to check for connections at risk
 func makePredictionPublisher(log *logger.Logger,
 	predictionPublicationDestination predictionPublicationDestination,
-	limitEarlyDepartureSeconds int) *predictionPublisher {
+	subjects *predictionSubjectRouter,
+	earlyDepartures *earlyDepartureLimits,
+	dwells *stopDwells,
+	deltas *tripUpdateDeltaFilter,
+	smoother *delaySmoother,
+	sourceTally *predictionSourceTally,
+	routeActivity *routeActivityTracker,
+	layovers *layoverPolicy,
+	overrides *tripOverrides,
+	connections *connectionTracker,
+	clk clock.Clock) *predictionPublisher {
 	return &predictionPublisher{
 		log:                              log,
 		predictionPublicationDestination: predictionPublicationDestination,
-		limitEarlyDepartureSeconds:       limitEarlyDepartureSeconds,
+		subjects:                         subjects,
+		earlyDepartures:                  earlyDepartures,
+		dwells:                           dwells,
+		deltas:                           deltas,
+		smoother:                         smoother,
+		sourceTally:                      sourceTally,
+		routeActivity:                    routeActivity,
+		layovers:                         layovers,
+		overrides:                        overrides,
+		connections:                      connections,
+		clock:                            clk,
 	}
 }
 
 // publishPredictionBatch for each trip predictions in predictionBatch, build gtfs.TripUpdate
 // and publish them over NATS
 func (p *predictionPublisher) publishPredictionBatch(batch *predictionBatch) {
+	building := startPipelineStage(context.Background(), stageTripUpdateBuilding)
 	orderedTripPredictions := batch.orderedTripPredictions()
-	tripUpdates := makeTripUpdates(p.log, orderedTripPredictions, p.limitEarlyDepartureSeconds)
+	tripUpdates := makeTripUpdates(p.log, orderedTripPredictions, p.earlyDepartures, p.dwells, p.layovers,
+		p.overrides, p.clock.Now())
+	routeTypes := make(map[string]*int)
+	for _, prediction := range orderedTripPredictions {
+		routeTypes[prediction.tripInstance.TripId] = prediction.tripInstance.RouteType
+	}
+	building.end()
 	for _, tripUpdate := range tripUpdates {
-		err := p.predictionPublicationDestination.Publish(tripUpdate)
+		p.smoother.smooth(tripUpdate, p.clock.Now())
+		if !p.deltas.shouldPublish(tripUpdate, p.clock.Now()) {
+			continue
+		}
+		subject := p.subjects.subject(tripUpdate.RouteId, routeTypes[tripUpdate.TripId])
+		publishing := startPipelineStage(context.Background(), stageTripUpdatePublishing)
+		err := p.predictionPublicationDestination.Publish(subject, tripUpdate)
+		publishing.end()
 		if err != nil {
 			p.log.Printf("Error publishing tripUpdate: error:%v\n", err)
 			return
 		}
+		p.sourceTally.record(tripUpdate)
+		p.routeActivity.record(tripUpdate, p.clock.Now())
+		p.connections.record(tripUpdate)
 	}
 }
 
 // makeTripUpdates builds series of gtfs.TripUpdates from tripPredictions
+// the predicted end of each trip is used as the start of the next trip on the block, tripPredictions marked
+// propagationOnly are built for this purpose but are not included in the results.
+// Trips after the first are not predicted to depart until the minimum layover in layovers has passed, and no trip is
+// predicted to depart a stop earlier than its limit in earlyDepartures. Departures are predicted after the average
+// dwell at stops in dwells.
+// overrides in effect at "now" are applied to each trip before its predicted end is carried to the next trip
 func makeTripUpdates(log *logger.Logger,
 	orderedPredictions []*tripPrediction,
-	limitEarlyDepartureSeconds int) []*gtfs.TripUpdate {
+	earlyDepartures *earlyDepartureLimits,
+	dwells *stopDwells,
+	layovers *layoverPolicy,
+	overrides *tripOverrides,
+	now time.Time) []*gtfs.TripUpdate {
 
 	tripUpdates := make([]*gtfs.TripUpdate, 0)
 	var predictedPositionInTime time.Time
+	builtTripUpdate := false
 	for _, prediction := range orderedPredictions {
-		if len(tripUpdates) == 0 {
+		minimumLayover := time.Duration(0)
+		if !builtTripUpdate {
 			predictedPositionInTime = prediction.tripDeviation.DeviationTimestamp
+		} else {
+			minimumLayover = layovers.minimumLayover(prediction.tripInstance.RouteId)
 		}
-		tripUpdate := buildTripUpdate(log, predictedPositionInTime, prediction, limitEarlyDepartureSeconds)
+		tripUpdate := buildTripUpdate(log, predictedPositionInTime, prediction,
+			earlyDepartures.limit(prediction.tripInstance), dwells, minimumLayover)
 		if tripUpdate != nil {
+			overrides.apply(tripUpdate, now)
+			builtTripUpdate = true
 			newSchedulePosition := tripUpdate.LastSchedulePosition()
 			if newSchedulePosition != nil {
 				predictedPositionInTime = *newSchedulePosition
 			}
-			tripUpdates = append(tripUpdates, tripUpdate)
+			if !prediction.propagationOnly {
+				tripUpdates = append(tripUpdates, tripUpdate)
+			}
 		}
 
 	}
@@ -88,11 +164,16 @@ func makeTripUpdates(log *logger.Logger,
 
 // buildTripUpdate builds a gtfs.TripUpdate a tripPrediction
 // previousSchedulePositionTime should be the last position the vehicle was reported as departing from
-// allowing this trip update to start late if the vehicle is running late after its previous trip
+// allowing this trip update to start late if the vehicle is running late after its previous trip.
+// minimumLayover is the least time the vehicle waits at the first stop after arriving from its previous trip,
+// and earlyDeparture limits how early the vehicle is predicted to depart each stop. The vehicle is predicted to depart
+// stops with an average dwell in dwells that long after arriving, and later stops are predicted from the departure
 func buildTripUpdate(log *logger.Logger,
 	predictedPositionInTime time.Time,
 	prediction *tripPrediction,
-	limitEarlyDepartureSeconds int) *gtfs.TripUpdate {
+	earlyDeparture earlyDepartureLimit,
+	dwells *stopDwells,
+	minimumLayover time.Duration) *gtfs.TripUpdate {
 	trip := prediction.tripInstance
 	if len(trip.StopTimeInstances) < 1 {
 		log.Printf("trip %s had no StopTimeInstances", trip.TripId)
@@ -124,25 +205,29 @@ func buildTripUpdate(log *logger.Logger,
 	delay := deviationTimestamp.Sub(tripDeviation.SchedulePosition())
 	firstStopTimeInstance := trip.StopTimeInstances[0]
 	stopUpdate := buildStopUpdateForFirstStop(predictedPositionInTime, tripDeviation.SchedulePosition(),
-		deviationTimestamp, delay, firstStopTimeInstance)
+		deviationTimestamp, delay, firstStopTimeInstance, minimumLayover)
 	tripUpdate.StopTimeUpdates = []gtfs.StopTimeUpdate{stopUpdate}
 	predictedPositionInTime = predictedPositionInTimeAfterFirstStop(predictedPositionInTime,
-		stopUpdate.PredictedArrivalTime, firstStopTimeInstance, tripDeviation.TripProgress)
+		stopUpdate.LatestPredictedTime(), firstStopTimeInstance, tripDeviation.TripProgress)
 
 	if lastPastStop != nil {
 		lastPastStopUpdate := buildStopUpdateForPassedStop(deviationTimestamp, lastPastStop, delay)
 		tripUpdate.StopTimeUpdates = append(tripUpdate.StopTimeUpdates, lastPastStopUpdate)
 	}
 
+	lastStopTimeInstance := trip.StopTimeInstances[len(trip.StopTimeInstances)-1]
 	var predictionRemainder = 0.0
 
 	for _, sp := range predictionsForStopUpdates {
 		var newStopUpdate gtfs.StopTimeUpdate
 		if sp.stopUpdateDisposition == AtStop {
-			newStopUpdate = buildStopUpdateForAtStop(deviationTimestamp, sp.toStop, limitEarlyDepartureSeconds)
+			newStopUpdate = buildStopUpdateForAtStop(deviationTimestamp, sp.toStop, earlyDeparture)
 		} else {
 			newStopUpdate, predictionRemainder = buildStopUpdate(log, predictedPositionInTime,
-				tripDeviation.TripProgress, predictionRemainder, sp, limitEarlyDepartureSeconds)
+				tripDeviation.TripProgress, predictionRemainder, sp, earlyDeparture)
+			if sp.toStop != lastStopTimeInstance {
+				dwells.predictDeparture(&newStopUpdate, sp.toStop, earlyDeparture)
+			}
 		}
 
 		predictedPositionInTime = newStopUpdate.LatestPredictedTime()
@@ -170,12 +255,13 @@ func predictedPositionInTimeAfterFirstStop(predictedPositionInTime time.Time,
 // located at, (a previous StopUpdate or the vehicle schedule position if its between the previous stop and this one)
 // tripDistanceTraveled is how far along the vehicle is on this trip, should not be further than stopPrediction.toStop
 // previousPredictionRemainder is the previous predictions remainder after rounding the predictions to seconds
+// earlyDeparture limits how early the vehicle is predicted to depart stopPrediction.fromStop
 func buildStopUpdate(log *logger.Logger,
 	predictedPositionInTime time.Time,
 	tripDistanceTraveled float64,
 	previousPredictionRemainder float64,
 	stopPrediction *stopPrediction,
-	limitEarlyDepartureSeconds int) (stopTimeUpdate gtfs.StopTimeUpdate, predictionRemainder float64) {
+	earlyDeparture earlyDepartureLimit) (stopTimeUpdate gtfs.StopTimeUpdate, predictionRemainder float64) {
 	toStop := stopPrediction.toStop
 	traversalSeconds := stopPrediction.predictedTime + previousPredictionRemainder
 	//if the vehicle is further than the previous stop it's between the last stop and this one
@@ -188,11 +274,12 @@ func buildStopUpdate(log *logger.Logger,
 	predictedArrivalTime := predictedPositionInTime.Add(time.Duration(traversalInt64) * time.Second)
 	arrivalDelay := int(predictedArrivalTime.Sub(toStop.ArrivalDateTime).Seconds())
 	//check for early departure from last stop
-	if stopPrediction.fromStop.IsTimepoint() &&
+	limitSeconds, limited := earlyDeparture.seconds(stopPrediction.fromStop)
+	if limited &&
 		tripDistanceTraveled <= stopPrediction.fromStop.ShapeDistTraveled &&
-		arrivalDelay < -limitEarlyDepartureSeconds {
-		arrivalDelay = -limitEarlyDepartureSeconds
-		predictedArrivalTime = toStop.ArrivalDateTime.Add(time.Duration(-limitEarlyDepartureSeconds) * time.Second)
+		arrivalDelay < -limitSeconds {
+		arrivalDelay = -limitSeconds
+		predictedArrivalTime = toStop.ArrivalDateTime.Add(time.Duration(-limitSeconds) * time.Second)
 	}
 
 	return gtfs.StopTimeUpdate{
@@ -230,12 +317,15 @@ func roundSecondsAndRemainder(traversalSeconds float64) (int64, float64) {
 }
 
 // buildStopUpdateForFirstStop creates gtfs.StopTimeUpdate for first stop of trip
+// a vehicle arriving at predictedPositionInTime departs no sooner than minimumLayover later, recovering any delay
+// up to the scheduled layover
 func buildStopUpdateForFirstStop(
 	predictedPositionInTime time.Time,
 	positionInSchedule time.Time,
 	positionTimestamp time.Time,
 	delay time.Duration,
-	stopTime *gtfs.StopTimeInstance) gtfs.StopTimeUpdate {
+	stopTime *gtfs.StopTimeInstance,
+	minimumLayover time.Duration) gtfs.StopTimeUpdate {
 
 	stopUpdate := gtfs.StopTimeUpdate{
 		StopSequence:         stopTime.StopSequence,
@@ -251,7 +341,7 @@ func buildStopUpdateForFirstStop(
 		stopUpdate.ArrivalDelay = int(stopUpdate.PredictedArrivalTime.Sub(stopUpdate.ScheduledArrivalTime).Seconds())
 		return stopUpdate
 	}
-	departTime := laterOfDates(positionTimestamp, predictedPositionInTime)
+	departTime := laterOfDates(positionTimestamp, predictedPositionInTime.Add(minimumLayover))
 
 	//position will be before depart time, assume on time departure
 	if departTime.Unix() <= stopTime.DepartureDateTime.Unix() {
@@ -268,7 +358,7 @@ func buildStopUpdateForFirstStop(
 
 	earliestPosition := earlierOfDates(positionTimestamp, predictedPositionInTime)
 
-	if earliestPosition.Unix() <= stopTime.DepartureDateTime.Unix() {
+	if earliestPosition.Unix() <= stopTime.DepartureDateTime.Unix() || minimumLayover > 0 {
 		stopUpdate.ScheduledDepartureTime = &stopTime.DepartureDateTime
 		stopUpdate.PredictedDepartureTime = &departTime
 		departureDelay := int(stopUpdate.PredictedDepartureTime.Sub(stopTime.DepartureDateTime).Seconds())
@@ -279,16 +369,17 @@ func buildStopUpdateForFirstStop(
 }
 
 // buildStopUpdateForAtStop creates gtfs.StopTimeUpdate when a vehicle is located at a stop.
+// The vehicle is predicted at the stop no earlier than earlyDeparture allows
 func buildStopUpdateForAtStop(at time.Time,
 	stopTime *gtfs.StopTimeInstance,
-	limitEarlyDepartureSeconds int) gtfs.StopTimeUpdate {
+	earlyDeparture earlyDepartureLimit) gtfs.StopTimeUpdate {
 
 	arrivalTime := at
 
 	delay := int(arrivalTime.Sub(stopTime.ArrivalDateTime).Seconds())
 
-	if stopTime.IsTimepoint() && delay < -limitEarlyDepartureSeconds {
-		delay = -limitEarlyDepartureSeconds
+	if limitSeconds, limited := earlyDeparture.seconds(stopTime); limited && delay < -limitSeconds {
+		delay = -limitSeconds
 		arrivalTime = stopTime.ArrivalDateTime.Add(time.Duration(delay) * time.Second)
 	}
 
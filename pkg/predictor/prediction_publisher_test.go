@@ -1,10 +1,11 @@
-package aggregator
+package predictor
 
 import (
 	"fmt"
 	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
 	logger "log"
 	"math"
+	"path/filepath"
 	"strings"
 	"sync"
 
@@ -31,7 +32,7 @@ func Test_buildStopUpdate(t *testing.T) {
 		tripDistanceTraveled        float64
 		previousPredictionRemainder float64
 		stopPrediction              *stopPrediction
-		limitEarlyDepartureSeconds  int
+		earlyDeparture              earlyDepartureLimit
 	}
 	tests := []struct {
 		name                    string
@@ -220,7 +221,7 @@ func Test_buildStopUpdate(t *testing.T) {
 					predictionSource:   gtfs.TimepointMLPrediction,
 					predictionComplete: true,
 				},
-				limitEarlyDepartureSeconds: 60,
+				earlyDeparture: earlyDepartureLimit{timepointSeconds: 60},
 			},
 			wantStopTimeUpdate: gtfs.StopTimeUpdate{
 				StopSequence:         4,
@@ -232,6 +233,63 @@ func Test_buildStopUpdate(t *testing.T) {
 			},
 			wantPredictionRemainder: 0,
 		},
+		{
+			name: "vehicle 5 minutes early at stop that isn't a timepoint, early departures allowed",
+			args: args{
+				predictedPositionInTime:     time.Date(2022, 5, 22, 12, 15, 0, 0, location),
+				tripDistanceTraveled:        1000,
+				previousPredictionRemainder: 0,
+				stopPrediction:              buildTestPrediction(secondStop, thirdStop, 0.0, gtfs.StopMLPrediction, FutureStop),
+				earlyDeparture:              earlyDepartureLimit{timepointSeconds: 60},
+			},
+			wantStopTimeUpdate: gtfs.StopTimeUpdate{
+				StopSequence:         3,
+				StopId:               "C",
+				ArrivalDelay:         -300,
+				ScheduledArrivalTime: thirdStop.ArrivalDateTime,
+				PredictedArrivalTime: time.Date(2022, 5, 22, 12, 35, 0, 0, location),
+				PredictionSource:     gtfs.StopMLPrediction,
+			},
+			wantPredictionRemainder: 0,
+		},
+		{
+			name: "vehicle 5 minutes early at stop that isn't a timepoint, clamped to schedule",
+			args: args{
+				predictedPositionInTime:     time.Date(2022, 5, 22, 12, 15, 0, 0, location),
+				tripDistanceTraveled:        1000,
+				previousPredictionRemainder: 0,
+				stopPrediction:              buildTestPrediction(secondStop, thirdStop, 0.0, gtfs.StopMLPrediction, FutureStop),
+				earlyDeparture:              earlyDepartureLimit{timepointSeconds: 60, limitNonTimepoints: true},
+			},
+			wantStopTimeUpdate: gtfs.StopTimeUpdate{
+				StopSequence:         3,
+				StopId:               "C",
+				ArrivalDelay:         0,
+				ScheduledArrivalTime: thirdStop.ArrivalDateTime,
+				PredictedArrivalTime: time.Date(2022, 5, 22, 12, 40, 0, 0, location),
+				PredictionSource:     gtfs.StopMLPrediction,
+			},
+			wantPredictionRemainder: 0,
+		},
+		{
+			name: "vehicle 5 minutes early at stop that isn't a timepoint, clamped to non-timepoint limit",
+			args: args{
+				predictedPositionInTime:     time.Date(2022, 5, 22, 12, 15, 0, 0, location),
+				tripDistanceTraveled:        1000,
+				previousPredictionRemainder: 0,
+				stopPrediction:              buildTestPrediction(secondStop, thirdStop, 0.0, gtfs.StopMLPrediction, FutureStop),
+				earlyDeparture:              earlyDepartureLimit{timepointSeconds: 60, limitNonTimepoints: true, nonTimepointSeconds: 120},
+			},
+			wantStopTimeUpdate: gtfs.StopTimeUpdate{
+				StopSequence:         3,
+				StopId:               "C",
+				ArrivalDelay:         -120,
+				ScheduledArrivalTime: thirdStop.ArrivalDateTime,
+				PredictedArrivalTime: time.Date(2022, 5, 22, 12, 38, 0, 0, location),
+				PredictionSource:     gtfs.StopMLPrediction,
+			},
+			wantPredictionRemainder: 0,
+		},
 		{
 			name: "vehicle very late, before stops",
 			args: args{
@@ -239,7 +297,7 @@ func Test_buildStopUpdate(t *testing.T) {
 				tripDistanceTraveled:        -2500,
 				previousPredictionRemainder: 0,
 				stopPrediction:              buildTestPrediction(thirdStop, fourthStop, 0.0, gtfs.TimepointMLPrediction, FutureStop),
-				limitEarlyDepartureSeconds:  60,
+				earlyDeparture:              earlyDepartureLimit{timepointSeconds: 60},
 			},
 			wantStopTimeUpdate: gtfs.StopTimeUpdate{
 				StopSequence:         4,
@@ -257,7 +315,7 @@ func Test_buildStopUpdate(t *testing.T) {
 			testLog := makeTestLogWriter()
 			gotStopTimeUpdate, gotPredictionRemainder := buildStopUpdate(testLog.log, tt.args.predictedPositionInTime,
 				tt.args.tripDistanceTraveled, tt.args.previousPredictionRemainder, tt.args.stopPrediction,
-				tt.args.limitEarlyDepartureSeconds)
+				tt.args.earlyDeparture)
 			if !reflect.DeepEqual(gotStopTimeUpdate, tt.wantStopTimeUpdate) {
 				t.Errorf("buildStopUpdate() produced unexpected StopTimeUpdate\ngot= %+v\nwant=%+v", gotStopTimeUpdate, tt.wantStopTimeUpdate)
 			}
@@ -368,12 +426,109 @@ func Test_buildTripUpdate(t *testing.T) {
 		previousSchedulePositionTime time.Time
 		prediction                   *tripPrediction
 		limitEarlyDepartureSeconds   int
+		dwells                       []gtfs.StopDwell
 	}
 	tests := []struct {
 		name string
 		args args
 		want *gtfs.TripUpdate
 	}{
+		{
+			name: "On time with dwells, departures follow dwells and later stops are predicted from departures",
+			args: args{
+				previousSchedulePositionTime: twelvePm,
+				limitEarlyDepartureSeconds:   60,
+				dwells: []gtfs.StopDwell{
+					{StopId: thirdStop.StopId, DwellSeconds: 60},
+					{StopId: sixthStop.StopId, DwellSeconds: 30},
+					{StopId: seventhStop.StopId, DwellSeconds: 120},
+				},
+				prediction: &tripPrediction{
+					tripDeviation: &gtfs.TripDeviation{
+						CreatedAt:          twelvePm,
+						DeviationTimestamp: twelvePm,
+						TripProgress:       0,
+						TripId:             trip1.TripId,
+						VehicleId:          "1",
+						Delay:              0,
+					},
+					mu: sync.Mutex{},
+					stopPredictions: []*stopPrediction{
+						buildTestPrediction(firstStop, secondStop, 0.0, gtfs.StopMLPrediction, FutureStop),
+						buildTestPrediction(secondStop, thirdStop, 0.0, gtfs.StopMLPrediction, FutureStop),
+						buildTestPrediction(thirdStop, fourthStop, 0.0, gtfs.StopMLPrediction, FutureStop),
+						buildTestPrediction(fourthStop, fifthStop, 0.0, gtfs.StopMLPrediction, FutureStop),
+						buildTestPrediction(fifthStop, sixthStop, 0.0, gtfs.StopMLPrediction, FutureStop),
+						buildTestPrediction(sixthStop, seventhStop, 0.0, gtfs.StopMLPrediction, FutureStop),
+					},
+					tripInstance: trip1,
+				},
+			},
+			want: &gtfs.TripUpdate{
+				TripId:               trip1.TripId,
+				RouteId:              trip1.RouteId,
+				ScheduleRelationship: "SCHEDULED",
+				Timestamp:            uint64(twelvePm.Unix()),
+				VehicleId:            "1",
+				StopTimeUpdates: []gtfs.StopTimeUpdate{
+					buildTestStopUpdate(firstStop, 0, gtfs.SchedulePrediction),
+					buildTestStopUpdate(secondStop, 0, gtfs.StopMLPrediction),
+					buildTestStopUpdateWithDeparture(thirdStop, 0, 60, gtfs.StopMLPrediction),
+					buildTestStopUpdate(fourthStop, 60, gtfs.StopMLPrediction),
+					buildTestStopUpdate(fifthStop, 60, gtfs.StopMLPrediction),
+					//arrives a minute late and departs 30 seconds later, 10 seconds ahead of its scheduled departure
+					buildTestStopUpdateWithDeparture(sixthStop, 60, -10, gtfs.StopMLPrediction),
+					//no departure predicted from the last stop
+					buildTestStopUpdate(seventhStop, 90, gtfs.StopMLPrediction),
+				},
+			},
+		},
+		{
+			name: "Dwell limited by early departure at timepoint",
+			args: args{
+				previousSchedulePositionTime: twelvePm,
+				limitEarlyDepartureSeconds:   0,
+				dwells: []gtfs.StopDwell{
+					{StopId: sixthStop.StopId, DwellSeconds: 30},
+				},
+				prediction: &tripPrediction{
+					tripDeviation: &gtfs.TripDeviation{
+						CreatedAt:          twelvePm,
+						DeviationTimestamp: twelvePm,
+						TripProgress:       0,
+						TripId:             trip1.TripId,
+						VehicleId:          "1",
+						Delay:              0,
+					},
+					mu: sync.Mutex{},
+					stopPredictions: []*stopPrediction{
+						buildTestPrediction(firstStop, secondStop, 0.0, gtfs.StopMLPrediction, FutureStop),
+						buildTestPrediction(secondStop, thirdStop, 0.0, gtfs.StopMLPrediction, FutureStop),
+						buildTestPrediction(thirdStop, fourthStop, 0.0, gtfs.StopMLPrediction, FutureStop),
+						buildTestPrediction(fourthStop, fifthStop, 0.0, gtfs.StopMLPrediction, FutureStop),
+						buildTestPrediction(fifthStop, sixthStop, 0.0, gtfs.StopMLPrediction, FutureStop),
+						buildTestPrediction(sixthStop, seventhStop, 0.0, gtfs.StopMLPrediction, FutureStop),
+					},
+					tripInstance: trip1,
+				},
+			},
+			want: &gtfs.TripUpdate{
+				TripId:               trip1.TripId,
+				RouteId:              trip1.RouteId,
+				ScheduleRelationship: "SCHEDULED",
+				Timestamp:            uint64(twelvePm.Unix()),
+				VehicleId:            "1",
+				StopTimeUpdates: []gtfs.StopTimeUpdate{
+					buildTestStopUpdate(firstStop, 0, gtfs.SchedulePrediction),
+					buildTestStopUpdate(secondStop, 0, gtfs.StopMLPrediction),
+					buildTestStopUpdate(thirdStop, 0, gtfs.StopMLPrediction),
+					buildTestStopUpdate(fourthStop, 0, gtfs.StopMLPrediction),
+					buildTestStopUpdate(fifthStop, 0, gtfs.StopMLPrediction),
+					buildTestStopUpdateWithDeparture(sixthStop, 0, 0, gtfs.StopMLPrediction),
+					buildTestStopUpdate(seventhStop, 100, gtfs.StopMLPrediction),
+				},
+			},
+		},
 		{
 			name: "Simple, on time, at start of trip",
 			args: args{
@@ -991,8 +1146,13 @@ func Test_buildTripUpdate(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			testLog := makeTestLogWriter()
+			var dwells *stopDwells
+			if tt.args.dwells != nil {
+				dwells = makeStopDwells(0)
+				dwells.replace(tt.args.dwells)
+			}
 			got := buildTripUpdate(testLog.log, tt.args.previousSchedulePositionTime, tt.args.prediction,
-				tt.args.limitEarlyDepartureSeconds)
+				earlyDepartureLimit{timepointSeconds: tt.args.limitEarlyDepartureSeconds}, dwells, 0)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("buildTripUpdate() produced unexpected StopTimeUpdate\ngot= %v\nwant=%v",
 					sprintTripUpdate(got), sprintTripUpdate(tt.want))
@@ -1035,6 +1195,7 @@ func Test_makeTripUpdates(t *testing.T) {
 		name                       string
 		orderedPredictions         []*tripPrediction
 		limitEarlyDepartureSeconds int
+		layovers                   *layoverPolicy
 		want                       []*gtfs.TripUpdate
 	}{
 		{
@@ -1294,6 +1455,58 @@ func Test_makeTripUpdates(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Propagation only trip is not published but delays the following trip",
+			orderedPredictions: []*tripPrediction{
+				{
+					tripDeviation: &gtfs.TripDeviation{
+						CreatedAt:          timeAt1353,
+						DeviationTimestamp: timeAt1353,
+						TripProgress:       1000.0,
+						TripId:             trip2.TripId,
+						VehicleId:          "1",
+						Delay:              420,
+					},
+					mu: sync.Mutex{},
+					stopPredictions: []*stopPrediction{
+						buildTestPrediction(stop1Trip2, stop2Trip2, 0, gtfs.StopMLPrediction, AtStop),
+						buildTestPrediction(stop2Trip2, stop3Trip2, -120, gtfs.StopMLPrediction, FutureStop),
+					},
+					tripInstance:    trip2,
+					propagationOnly: true,
+				},
+				{
+					tripDeviation: &gtfs.TripDeviation{
+						CreatedAt:          timeAt1353,
+						DeviationTimestamp: timeAt1353,
+						TripProgress:       -1000.0,
+						TripId:             trip4.TripId,
+						VehicleId:          "1",
+						Delay:              420,
+					},
+					mu: sync.Mutex{},
+					stopPredictions: []*stopPrediction{
+						buildTestPrediction(stop1Trip4, stop2Trip4, -120, gtfs.StopMLPrediction, FutureStop),
+						buildTestPrediction(stop2Trip4, stop3Trip4, 60, gtfs.StopMLPrediction, FutureStop),
+					},
+					tripInstance: trip4,
+				},
+			},
+			want: []*gtfs.TripUpdate{
+				{
+					TripId:               trip4.TripId,
+					RouteId:              trip4.RouteId,
+					ScheduleRelationship: "SCHEDULED",
+					Timestamp:            uint64(timeAt1353.Unix()),
+					VehicleId:            "1",
+					StopTimeUpdates: []gtfs.StopTimeUpdate{
+						buildTestStopUpdate(stop1Trip4, 300, gtfs.SchedulePrediction),
+						buildTestStopUpdate(stop2Trip4, 180, gtfs.StopMLPrediction),
+						buildTestStopUpdate(stop3Trip4, 240, gtfs.StopMLPrediction),
+					},
+				},
+			},
+		},
 		{
 			name: "Late prediction in middle of trip2",
 			orderedPredictions: []*tripPrediction{
@@ -1363,7 +1576,9 @@ func Test_makeTripUpdates(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			testLog := makeTestLogWriter()
-			got := makeTripUpdates(testLog.log, tt.orderedPredictions, tt.limitEarlyDepartureSeconds)
+			got := makeTripUpdates(testLog.log, tt.orderedPredictions,
+				&earlyDepartureLimits{defaultLimit: time.Duration(tt.limitEarlyDepartureSeconds) * time.Second}, nil,
+				tt.layovers, nil, time.Time{})
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("makeTripUpdates() \ngot =\n%v\nwant=\n%v", sprintTripUpdates(got), sprintTripUpdates(tt.want))
 			}
@@ -1371,6 +1586,54 @@ func Test_makeTripUpdates(t *testing.T) {
 	}
 }
 
+func Benchmark_makeTripUpdates(b *testing.B) {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		b.Fatalf("Unable to get testing time zone location")
+	}
+	// a vehicle running three minutes late ten stops into the first of two 47 stop trips on its block, shared with
+	// the vehiclemonitor package's tests
+	trips := getTestTrips(time.Date(2019, 12, 11, 0, 0, 0, 0, location),
+		filepath.Join("..", "vehiclemonitor", "testdata", "test_trips.json"), b)
+	firstTrip := trips[0]
+	firstTripLength := firstTrip.StopTimeInstances[len(firstTrip.StopTimeInstances)-1].ShapeDistTraveled
+	vehicleProgress := firstTrip.StopTimeInstances[9].ShapeDistTraveled + 100
+	at := firstTrip.StopTimeInstances[9].ArrivalDateTime.Add(3 * time.Minute)
+	var orderedPredictions []*tripPrediction
+	for i, trip := range trips {
+		tripProgress := vehicleProgress
+		if i > 0 {
+			tripProgress = vehicleProgress - firstTripLength
+		}
+		var stopPredictions []*stopPrediction
+		for j := 1; j < len(trip.StopTimeInstances); j++ {
+			from := trip.StopTimeInstances[j-1]
+			to := trip.StopTimeInstances[j]
+			stopPredictions = append(stopPredictions, buildTestPrediction(from, to, 5, gtfs.StopMLPrediction,
+				makeStopUpdateDisposition(tripProgress, to.ShapeDistTraveled)))
+		}
+		orderedPredictions = append(orderedPredictions, &tripPrediction{
+			tripInstance: trip,
+			tripDeviation: &gtfs.TripDeviation{
+				CreatedAt:          at,
+				DeviationTimestamp: at,
+				TripProgress:       tripProgress,
+				TripId:             trip.TripId,
+				VehicleId:          "102",
+				Delay:              180,
+			},
+			stopPredictions: stopPredictions,
+		})
+	}
+	testLog := makeTestLogWriter()
+	earlyDepartures := &earlyDepartureLimits{defaultLimit: 0}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		makeTripUpdates(testLog.log, orderedPredictions, earlyDepartures, nil, nil, nil, at)
+	}
+}
+
 func Test_buildStopUpdateForFirstStop(t *testing.T) {
 	location, err := time.LoadLocation("America/Los_Angeles")
 	if err != nil {
@@ -1406,6 +1669,7 @@ func Test_buildStopUpdateForFirstStop(t *testing.T) {
 		positionTimestamp       time.Time
 		stopTime                *gtfs.StopTimeInstance
 		delay                   int
+		minimumLayoverSeconds   int
 	}
 	tests := []struct {
 		name string
@@ -1533,12 +1797,49 @@ func Test_buildStopUpdateForFirstStop(t *testing.T) {
 			},
 			want: buildTestStopUpdate(firstStop, 420, gtfs.SchedulePrediction),
 		},
+		{
+			name: "Previous trip arrives early enough to take minimum layover",
+			args: args{
+				predictedPositionInTime: timeAt1346,
+				positionInSchedule:      timeAt1339,
+				positionTimestamp:       timeAt1344,
+				stopTime:                firstStop,
+				delay:                   0,
+				minimumLayoverSeconds:   300,
+			},
+			want: buildTestStopUpdate(firstStop, 0, gtfs.SchedulePrediction),
+		},
+		{
+			name: "Previous trip arrives two minutes late, minimum layover delays departure",
+			args: args{
+				predictedPositionInTime: time.Date(2022, 5, 22, 13, 51, 0, 0, location),
+				positionInSchedule:      timeAt1339,
+				positionTimestamp:       timeAt1344,
+				stopTime:                firstStop,
+				delay:                   120,
+				minimumLayoverSeconds:   300,
+			},
+			want: buildTestStopUpdateWithDeparture(firstStop, 120, 240, gtfs.SchedulePrediction),
+		},
+		{
+			name: "Previous trip arrives after departure time, departs after minimum layover",
+			args: args{
+				predictedPositionInTime: timeAt1356,
+				positionInSchedule:      timeAt1339,
+				positionTimestamp:       timeAt1353,
+				stopTime:                firstStop,
+				delay:                   420,
+				minimumLayoverSeconds:   120,
+			},
+			want: buildTestStopUpdateWithDeparture(firstStop, 420, 360, gtfs.SchedulePrediction),
+		},
 	}
 	for _, tt := range tests {
 
 		t.Run(tt.name, func(t *testing.T) {
 			got := buildStopUpdateForFirstStop(tt.args.predictedPositionInTime, tt.args.positionInSchedule,
-				tt.args.positionTimestamp, time.Duration(tt.args.delay)*time.Second, tt.args.stopTime)
+				tt.args.positionTimestamp, time.Duration(tt.args.delay)*time.Second, tt.args.stopTime,
+				time.Duration(tt.args.minimumLayoverSeconds)*time.Second)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("buildStopUpdateForFirstStop() = \n%s, \nwant=\n%s",
 					sprintStopUpdate(got), sprintStopUpdate(tt.want))
@@ -1576,9 +1877,9 @@ func Test_buildStopUpdateForAtStop(t *testing.T) {
 		DepartureDateTime: time.Date(2022, 5, 22, 10, 3, 0, 0, location),
 	}
 	type args struct {
-		at                         time.Time
-		stopTime                   *gtfs.StopTimeInstance
-		limitEarlyDepartureSeconds int
+		at             time.Time
+		stopTime       *gtfs.StopTimeInstance
+		earlyDeparture earlyDepartureLimit
 	}
 	tests := []struct {
 		name string
@@ -1588,9 +1889,9 @@ func Test_buildStopUpdateForAtStop(t *testing.T) {
 		{
 			name: "on schedule at stop",
 			args: args{
-				at:                         stop1.ArrivalDateTime,
-				stopTime:                   stop1,
-				limitEarlyDepartureSeconds: 60,
+				at:             stop1.ArrivalDateTime,
+				stopTime:       stop1,
+				earlyDeparture: earlyDepartureLimit{timepointSeconds: 60},
 			},
 			want: gtfs.StopTimeUpdate{
 				StopSequence:         stop1.StopSequence,
@@ -1604,9 +1905,9 @@ func Test_buildStopUpdateForAtStop(t *testing.T) {
 		{
 			name: "early at stop, not timepoint",
 			args: args{
-				at:                         stop1.ArrivalDateTime.Add(time.Duration(-30) * time.Second),
-				stopTime:                   stop1,
-				limitEarlyDepartureSeconds: 60,
+				at:             stop1.ArrivalDateTime.Add(time.Duration(-30) * time.Second),
+				stopTime:       stop1,
+				earlyDeparture: earlyDepartureLimit{timepointSeconds: 60},
 			},
 			want: gtfs.StopTimeUpdate{
 				StopSequence:         stop1.StopSequence,
@@ -1620,9 +1921,9 @@ func Test_buildStopUpdateForAtStop(t *testing.T) {
 		{
 			name: "early at timepoint, under limitEarlyDepartureSeconds",
 			args: args{
-				at:                         timepointStop1.ArrivalDateTime.Add(time.Duration(-30) * time.Second),
-				stopTime:                   stop1,
-				limitEarlyDepartureSeconds: 60,
+				at:             timepointStop1.ArrivalDateTime.Add(time.Duration(-30) * time.Second),
+				stopTime:       stop1,
+				earlyDeparture: earlyDepartureLimit{timepointSeconds: 60},
 			},
 			want: gtfs.StopTimeUpdate{
 				StopSequence:         timepointStop1.StopSequence,
@@ -1636,9 +1937,9 @@ func Test_buildStopUpdateForAtStop(t *testing.T) {
 		{
 			name: "early at timepoint, over limitEarlyDepartureSeconds",
 			args: args{
-				at:                         timepointStop1.ArrivalDateTime.Add(time.Duration(-90) * time.Second),
-				stopTime:                   timepointStop1,
-				limitEarlyDepartureSeconds: 60,
+				at:             timepointStop1.ArrivalDateTime.Add(time.Duration(-90) * time.Second),
+				stopTime:       timepointStop1,
+				earlyDeparture: earlyDepartureLimit{timepointSeconds: 60},
 			},
 			want: gtfs.StopTimeUpdate{
 				StopSequence:         timepointStop1.StopSequence,
@@ -1649,12 +1950,45 @@ func Test_buildStopUpdateForAtStop(t *testing.T) {
 				PredictionSource:     gtfs.SchedulePrediction,
 			},
 		},
+		{
+			name: "early at stop, not timepoint, clamped to schedule",
+			args: args{
+				at:             stop1.ArrivalDateTime.Add(time.Duration(-30) * time.Second),
+				stopTime:       stop1,
+				earlyDeparture: earlyDepartureLimit{timepointSeconds: 60, limitNonTimepoints: true},
+			},
+			want: gtfs.StopTimeUpdate{
+				StopSequence:         stop1.StopSequence,
+				StopId:               stop1.StopId,
+				ArrivalDelay:         0,
+				ScheduledArrivalTime: stop1.ArrivalDateTime,
+				PredictedArrivalTime: stop1.ArrivalDateTime,
+				PredictionSource:     gtfs.SchedulePrediction,
+			},
+		},
+		{
+			name: "early at stop, not timepoint, over non-timepoint limit",
+			args: args{
+				at:       stop1.ArrivalDateTime.Add(time.Duration(-90) * time.Second),
+				stopTime: stop1,
+				earlyDeparture: earlyDepartureLimit{timepointSeconds: 0, limitNonTimepoints: true,
+					nonTimepointSeconds: 45},
+			},
+			want: gtfs.StopTimeUpdate{
+				StopSequence:         stop1.StopSequence,
+				StopId:               stop1.StopId,
+				ArrivalDelay:         -45,
+				ScheduledArrivalTime: stop1.ArrivalDateTime,
+				PredictedArrivalTime: stop1.ArrivalDateTime.Add(time.Duration(-45) * time.Second),
+				PredictionSource:     gtfs.SchedulePrediction,
+			},
+		},
 		{
 			name: "late at stop",
 			args: args{
-				at:                         stop1.ArrivalDateTime.Add(time.Duration(90) * time.Second),
-				stopTime:                   stop1,
-				limitEarlyDepartureSeconds: 60,
+				at:             stop1.ArrivalDateTime.Add(time.Duration(90) * time.Second),
+				stopTime:       stop1,
+				earlyDeparture: earlyDepartureLimit{timepointSeconds: 60},
 			},
 			want: gtfs.StopTimeUpdate{
 				StopSequence:         stop1.StopSequence,
@@ -1668,9 +2002,9 @@ func Test_buildStopUpdateForAtStop(t *testing.T) {
 		{
 			name: "late at timepoint",
 			args: args{
-				at:                         timepointStop1.ArrivalDateTime.Add(time.Duration(90) * time.Second),
-				stopTime:                   timepointStop1,
-				limitEarlyDepartureSeconds: 60,
+				at:             timepointStop1.ArrivalDateTime.Add(time.Duration(90) * time.Second),
+				stopTime:       timepointStop1,
+				earlyDeparture: earlyDepartureLimit{timepointSeconds: 60},
 			},
 			want: gtfs.StopTimeUpdate{
 				StopSequence:           timepointStop1.StopSequence,
@@ -1685,7 +2019,7 @@ func Test_buildStopUpdateForAtStop(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := buildStopUpdateForAtStop(tt.args.at, tt.args.stopTime, tt.args.limitEarlyDepartureSeconds); !reflect.DeepEqual(got, tt.want) {
+			if got := buildStopUpdateForAtStop(tt.args.at, tt.args.stopTime, tt.args.earlyDeparture); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("buildStopUpdateForAtStop() got=\n%s,\nwant=\n%s", sprintStopUpdate(got), sprintStopUpdate(tt.want))
 			}
 		})
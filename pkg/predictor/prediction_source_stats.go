@@ -0,0 +1,130 @@
+package predictor
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/nats-io/nats.go"
+	logger "log"
+	"sync"
+	"time"
+)
+
+// predictionSourceMetrics exports the most recent PredictionSourceSummary under /debug/vars
+var predictionSourceMetrics = expvar.NewMap("prediction_sources")
+
+// PredictionSourceSummary counts the stop updates published for each route by gtfs.PredictionSource over a period
+type PredictionSourceSummary struct {
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	// Routes contains counts of stop updates by prediction source name for each route_id
+	Routes map[string]map[string]int `json:"routes"`
+}
+
+// predictionSourceTally counts the stop updates published by gtfs.PredictionSource for each route
+type predictionSourceTally struct {
+	mu          sync.Mutex
+	periodStart time.Time
+	routes      map[string]map[gtfs.PredictionSource]int
+}
+
+// makePredictionSourceTally builds predictionSourceTally starting its first period at "at"
+func makePredictionSourceTally(at time.Time) *predictionSourceTally {
+	return &predictionSourceTally{
+		mu:          sync.Mutex{},
+		periodStart: at,
+		routes:      make(map[string]map[gtfs.PredictionSource]int),
+	}
+}
+
+// record counts the stop updates in tripUpdate, a nil predictionSourceTally ignores them
+func (p *predictionSourceTally) record(tripUpdate *gtfs.TripUpdate) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sources, present := p.routes[tripUpdate.RouteId]
+	if !present {
+		sources = make(map[gtfs.PredictionSource]int)
+		p.routes[tripUpdate.RouteId] = sources
+	}
+	for _, stopTimeUpdate := range tripUpdate.StopTimeUpdates {
+		sources[stopTimeUpdate.PredictionSource]++
+	}
+}
+
+// summarize returns PredictionSourceSummary of the counts since the period began and starts a new period at "at"
+func (p *predictionSourceTally) summarize(at time.Time) *PredictionSourceSummary {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	summary := PredictionSourceSummary{
+		PeriodStart: p.periodStart,
+		PeriodEnd:   at,
+		Routes:      make(map[string]map[string]int),
+	}
+	for routeId, sources := range p.routes {
+		counts := make(map[string]int)
+		for source, count := range sources {
+			counts[source.String()] = count
+		}
+		summary.Routes[routeId] = counts
+	}
+	p.periodStart = at
+	p.routes = make(map[string]map[gtfs.PredictionSource]int)
+	return &summary
+}
+
+// runPredictionSourceStatsPublisher publishes a PredictionSourceSummary from tally on NATS subject every interval
+// and exports it under /debug/vars
+func runPredictionSourceStatsPublisher(log *logger.Logger,
+	wg *sync.WaitGroup,
+	natsConn *nats.Conn,
+	subject string,
+	tally *predictionSourceTally,
+	interval time.Duration,
+	shutdownSignal chan bool) {
+	wg.Add(1)
+	defer wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-shutdownSignal:
+			log.Printf("Exiting prediction source stats publisher on shutdown signal")
+			return
+		case at := <-ticker.C:
+			summary := tally.summarize(at)
+			exportPredictionSourceSummary(summary)
+			err := publishPredictionSourceSummary(natsConn, subject, summary)
+			if err != nil {
+				log.Printf("Error publishing prediction source summary: %v\n", err)
+			}
+		}
+	}
+}
+
+// publishPredictionSourceSummary sends summary as json on NATS subject
+func publishPredictionSourceSummary(natsConn *nats.Conn, subject string, summary *PredictionSourceSummary) error {
+	jsonData, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("error marshaling prediction source summary to json: %w", err)
+	}
+	return natsConn.Publish(subject, jsonData)
+}
+
+// exportPredictionSourceSummary replaces the counts in predictionSourceMetrics with summary
+func exportPredictionSourceSummary(summary *PredictionSourceSummary) {
+	predictionSourceMetrics.Init()
+	for routeId, counts := range summary.Routes {
+		routeMap := new(expvar.Map).Init()
+		for source, count := range counts {
+			value := new(expvar.Int)
+			value.Set(int64(count))
+			routeMap.Set(source, value)
+		}
+		predictionSourceMetrics.Set(routeId, routeMap)
+	}
+}
@@ -0,0 +1,58 @@
+package predictor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_predictionSourceTally_summarize(t *testing.T) {
+	start := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	end := start.Add(time.Minute)
+	makeTripUpdate := func(routeId string, sources ...gtfs.PredictionSource) *gtfs.TripUpdate {
+		tripUpdate := gtfs.TripUpdate{RouteId: routeId}
+		for _, source := range sources {
+			tripUpdate.StopTimeUpdates = append(tripUpdate.StopTimeUpdates, gtfs.StopTimeUpdate{PredictionSource: source})
+		}
+		return &tripUpdate
+	}
+	tests := []struct {
+		name        string
+		tripUpdates []*gtfs.TripUpdate
+		want        map[string]map[string]int
+	}{
+		{
+			name: "empty period",
+			want: map[string]map[string]int{},
+		},
+		{
+			name: "counts by route and source",
+			tripUpdates: []*gtfs.TripUpdate{
+				makeTripUpdate("10", gtfs.TimepointMLPrediction, gtfs.TimepointMLPrediction, gtfs.SchedulePrediction),
+				makeTripUpdate("10", gtfs.StopMLPrediction, gtfs.NoFurtherPredictions),
+				makeTripUpdate("20", gtfs.SchedulePrediction),
+			},
+			want: map[string]map[string]int{
+				"10": {"TimepointMLPrediction": 2, "SchedulePrediction": 1, "StopMLPrediction": 1, "NoFurtherPredictions": 1},
+				"20": {"SchedulePrediction": 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tally := makePredictionSourceTally(start)
+			for _, tripUpdate := range tt.tripUpdates {
+				tally.record(tripUpdate)
+			}
+			got := tally.summarize(end)
+			if !got.PeriodStart.Equal(start) || !got.PeriodEnd.Equal(end) || !reflect.DeepEqual(got.Routes, tt.want) {
+				t.Errorf("summarize() = %+v, want routes %+v", got, tt.want)
+			}
+			next := tally.summarize(end.Add(time.Minute))
+			if !next.PeriodStart.Equal(end) || len(next.Routes) != 0 {
+				t.Errorf("summarize() after reset = %+v, want empty period starting %v", next, end)
+			}
+		})
+	}
+}
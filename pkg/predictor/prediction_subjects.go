@@ -0,0 +1,60 @@
+package predictor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// predictionSubjectRouter chooses the NATS subject each gtfs.TripUpdate is published on from its route.
+// Rules for a route_id take precedence over rules for a route_type, TripUpdates matching no rule are published on
+// defaultSubject
+type predictionSubjectRouter struct {
+	defaultSubject    string
+	routeSubjects     map[string]string
+	routeTypeSubjects map[int]string
+}
+
+// makePredictionSubjectRouter builds predictionSubjectRouter from rules, each either route_id:<route_id>=<subject>
+// or route_type:<route_type>=<subject>, for example "route_type:0=trip-update-prediction-rail"
+func makePredictionSubjectRouter(defaultSubject string, rules []string) (*predictionSubjectRouter, error) {
+	router := &predictionSubjectRouter{
+		defaultSubject:    defaultSubject,
+		routeSubjects:     make(map[string]string),
+		routeTypeSubjects: make(map[int]string),
+	}
+	for _, rule := range rules {
+		match, subject, found := strings.Cut(rule, "=")
+		field, value, matchFound := strings.Cut(match, ":")
+		if !found || !matchFound || len(value) == 0 || len(subject) == 0 {
+			return nil, fmt.Errorf("expected prediction subject rule as route_id:<route_id>=<subject> or "+
+				"route_type:<route_type>=<subject>, found %q", rule)
+		}
+		switch field {
+		case "route_id":
+			router.routeSubjects[value] = subject
+		case "route_type":
+			routeType, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid route_type in prediction subject rule %q", rule)
+			}
+			router.routeTypeSubjects[routeType] = subject
+		default:
+			return nil, fmt.Errorf("prediction subject rule %q must match route_id or route_type", rule)
+		}
+	}
+	return router, nil
+}
+
+// subject returns the subject TripUpdates on routeId are published on, routeType is nil when it's unknown
+func (r *predictionSubjectRouter) subject(routeId string, routeType *int) string {
+	if subject, present := r.routeSubjects[routeId]; present {
+		return subject
+	}
+	if routeType != nil {
+		if subject, present := r.routeTypeSubjects[*routeType]; present {
+			return subject
+		}
+	}
+	return r.defaultSubject
+}
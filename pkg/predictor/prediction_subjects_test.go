@@ -0,0 +1,67 @@
+package predictor
+
+import "testing"
+
+func Test_predictionSubjectRouter_subject(t *testing.T) {
+	router, err := makePredictionSubjectRouter("trip-update-prediction", []string{
+		"route_type:0=trip-update-prediction-rail",
+		"route_type:2=trip-update-prediction-rail",
+		"route_id:193=trip-update-prediction-streetcar",
+	})
+	if err != nil {
+		t.Fatalf("makePredictionSubjectRouter() error = %v", err)
+	}
+	lightRail := 0
+	bus := 3
+	tests := []struct {
+		name      string
+		routeId   string
+		routeType *int
+		want      string
+	}{
+		{
+			name:      "route type rule",
+			routeId:   "90",
+			routeType: &lightRail,
+			want:      "trip-update-prediction-rail",
+		},
+		{
+			name:      "route id rule takes precedence over route type",
+			routeId:   "193",
+			routeType: &lightRail,
+			want:      "trip-update-prediction-streetcar",
+		},
+		{
+			name:      "no matching rule",
+			routeId:   "20",
+			routeType: &bus,
+			want:      "trip-update-prediction",
+		},
+		{
+			name:    "unknown route type",
+			routeId: "20",
+			want:    "trip-update-prediction",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := router.subject(tt.routeId, tt.routeType); got != tt.want {
+				t.Errorf("subject() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_makePredictionSubjectRouter_invalid(t *testing.T) {
+	for _, rule := range []string{
+		"route_type:0",
+		"route_type:rail=trip-update-prediction-rail",
+		"route_id:=trip-update-prediction-rail",
+		"route_id:90=",
+		"agency_id:TRIMET=trip-update-prediction-rail",
+	} {
+		if _, err := makePredictionSubjectRouter("trip-update-prediction", []string{rule}); err == nil {
+			t.Errorf("makePredictionSubjectRouter(%q) expected error", rule)
+		}
+	}
+}
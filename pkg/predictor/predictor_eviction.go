@@ -0,0 +1,90 @@
+package predictor
+
+import (
+	"expvar"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"time"
+)
+
+// tripPredictor eviction reasons counted in predictorEvictionMetrics
+const (
+	// evictedTripEnd is counted when the trip's scheduled end plus its route's margin has passed
+	evictedTripEnd = "trip_end"
+	// evictedNoStopTimes is counted when the trip has no stop times to find its end from
+	evictedNoStopTimes = "no_stop_times"
+)
+
+// predictorEvictionMetrics counts tripPredictors removed from tripPredictorsCollection by eviction reason
+var predictorEvictionMetrics = expvar.NewMap("predictor_evictions")
+
+// predictorEvictionPolicy decides when a cached tripPredictor is no longer needed. Predictors are kept until their
+// trip is scheduled to be complete plus a margin, allowing for vehicles running late, which can be set per route or
+// route_type. A margin for the trip's route_id takes precedence over one for its route_type
+type predictorEvictionPolicy struct {
+	defaultMargin    time.Duration
+	routeMargins     map[string]time.Duration
+	routeTypeMargins map[int]time.Duration
+}
+
+// makePredictorEvictionPolicy builds predictorEvictionPolicy with defaultSeconds margin after the end of each trip.
+// routeSeconds is a list of route_id and seconds separated by a colon, for example "100:7200", overriding the default
+// margin for the route. routeTypeSeconds is the same for route_types, for example "0:1800"
+func makePredictorEvictionPolicy(defaultSeconds int,
+	routeSeconds []string,
+	routeTypeSeconds []string) (*predictorEvictionPolicy, error) {
+	routeMargins, err := parseRouteDurations("predictor expiration", routeSeconds)
+	if err != nil {
+		return nil, err
+	}
+	routeTypeMargins, err := parseRouteTypeDurations("predictor expiration", routeTypeSeconds)
+	if err != nil {
+		return nil, err
+	}
+	return &predictorEvictionPolicy{
+		defaultMargin:    time.Duration(defaultSeconds) * time.Second,
+		routeMargins:     routeMargins,
+		routeTypeMargins: routeTypeMargins,
+	}, nil
+}
+
+// margin returns how long after the scheduled end of trip its tripPredictor is kept
+func (p *predictorEvictionPolicy) margin(trip *gtfs.TripInstance) time.Duration {
+	if margin, present := p.routeMargins[trip.RouteId]; present {
+		return margin
+	}
+	if trip.RouteType != nil {
+		if margin, present := p.routeTypeMargins[*trip.RouteType]; present {
+			return margin
+		}
+	}
+	return p.defaultMargin
+}
+
+// expiresAt returns when the tripPredictor for trip is evicted, false when trip has no stop times
+func (p *predictorEvictionPolicy) expiresAt(trip *gtfs.TripInstance) (time.Time, bool) {
+	lastStop := trip.LastStopTimeInstance()
+	if lastStop == nil {
+		return time.Time{}, false
+	}
+	return lastStop.ArrivalDateTime.Add(p.margin(trip)), true
+}
+
+// evictionReason returns the reason the tripPredictor for trip should be evicted as of "now", or an empty string when
+// it should be kept
+func (p *predictorEvictionPolicy) evictionReason(trip *gtfs.TripInstance, now time.Time) string {
+	expiresAt, present := p.expiresAt(trip)
+	if !present {
+		return evictedNoStopTimes
+	}
+	if !expiresAt.After(now) {
+		return evictedTripEnd
+	}
+	return ""
+}
+
+// recordPredictorEvictions adds evictions, counts by reason, to predictorEvictionMetrics
+func recordPredictorEvictions(evictions map[string]int) {
+	for reason, count := range evictions {
+		predictorEvictionMetrics.Add(reason, int64(count))
+	}
+}
@@ -0,0 +1,129 @@
+package predictor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// makeEvictionTestTrip builds a gtfs.TripInstance on routeId ending at end, or without stop times if end is zero
+func makeEvictionTestTrip(tripId string, routeId string, end time.Time) *gtfs.TripInstance {
+	trip := &gtfs.TripInstance{Trip: gtfs.Trip{TripId: tripId, RouteId: routeId}}
+	if !end.IsZero() {
+		trip.StopTimeInstances = []*gtfs.StopTimeInstance{
+			{ArrivalDateTime: end.Add(-30 * time.Minute)},
+			{ArrivalDateTime: end},
+		}
+	}
+	return trip
+}
+
+// withRouteType sets the route_type of trip
+func withRouteType(trip *gtfs.TripInstance, routeType int) *gtfs.TripInstance {
+	trip.RouteType = &routeType
+	return trip
+}
+
+func Test_predictorEvictionPolicy_evictionReason(t *testing.T) {
+	now := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	policy, err := makePredictorEvictionPolicy(3600, []string{"90:7200"}, []string{"0:1800", "3:7200"})
+	if err != nil {
+		t.Fatalf("makePredictorEvictionPolicy() error = %v", err)
+	}
+	tests := []struct {
+		name string
+		trip *gtfs.TripInstance
+		want string
+	}{
+		{
+			name: "trip still within default margin",
+			trip: makeEvictionTestTrip("1", "100", now.Add(-59*time.Minute)),
+			want: "",
+		},
+		{
+			name: "trip past default margin",
+			trip: makeEvictionTestTrip("2", "100", now.Add(-time.Hour)),
+			want: evictedTripEnd,
+		},
+		{
+			name: "route margin overrides default",
+			trip: makeEvictionTestTrip("3", "90", now.Add(-90*time.Minute)),
+			want: "",
+		},
+		{
+			name: "trip past route margin",
+			trip: makeEvictionTestTrip("4", "90", now.Add(-2*time.Hour)),
+			want: evictedTripEnd,
+		},
+		{
+			name: "route type margin overrides default",
+			trip: withRouteType(makeEvictionTestTrip("6", "200", now.Add(-45*time.Minute)), 0),
+			want: evictedTripEnd,
+		},
+		{
+			name: "route margin takes precedence over route type",
+			trip: withRouteType(makeEvictionTestTrip("7", "90", now.Add(-90*time.Minute)), 0),
+			want: "",
+		},
+		{
+			name: "route type without margin uses default",
+			trip: withRouteType(makeEvictionTestTrip("8", "300", now.Add(-59*time.Minute)), 2),
+			want: "",
+		},
+		{
+			name: "trip without stop times",
+			trip: makeEvictionTestTrip("5", "100", time.Time{}),
+			want: evictedNoStopTimes,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.evictionReason(tt.trip, now); got != tt.want {
+				t.Errorf("evictionReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_makePredictorEvictionPolicy_invalid(t *testing.T) {
+	for _, routeSeconds := range []string{"90", ":60", "90:soon", "90:-1"} {
+		if _, err := makePredictorEvictionPolicy(3600, []string{routeSeconds}, nil); err == nil {
+			t.Errorf("makePredictorEvictionPolicy(%q) expected error", routeSeconds)
+		}
+	}
+	for _, routeTypeSeconds := range []string{"0", "rail:60", "0:soon", "0:-1"} {
+		if _, err := makePredictorEvictionPolicy(3600, nil, []string{routeTypeSeconds}); err == nil {
+			t.Errorf("makePredictorEvictionPolicy(route type %q) expected error", routeTypeSeconds)
+		}
+	}
+}
+
+func Test_tripPredictorsLocker_removeExpiredPredictors(t *testing.T) {
+	now := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	policy, err := makePredictorEvictionPolicy(3600, nil, nil)
+	if err != nil {
+		t.Fatalf("makePredictorEvictionPolicy() error = %v", err)
+	}
+	locker := makeTripPredictorLocker()
+	for _, trip := range []*gtfs.TripInstance{
+		makeEvictionTestTrip("current", "100", now),
+		makeEvictionTestTrip("complete_1", "100", now.Add(-2*time.Hour)),
+		makeEvictionTestTrip("complete_2", "100", now.Add(-3*time.Hour)),
+		makeEvictionTestTrip("empty", "100", time.Time{}),
+	} {
+		locker.put(makePredictorMapId(1, trip.TripId), &tripPredictor{tripInstance: trip})
+	}
+
+	startSize, evictions := locker.removeExpiredPredictors(now, policy)
+	if startSize != 4 {
+		t.Errorf("removeExpiredPredictors() start size = %d, want 4", startSize)
+	}
+	wantEvictions := map[string]int{evictedTripEnd: 2, evictedNoStopTimes: 1}
+	if !reflect.DeepEqual(evictions, wantEvictions) {
+		t.Errorf("removeExpiredPredictors() evictions = %v, want %v", evictions, wantEvictions)
+	}
+	if locker.retrieve(makePredictorMapId(1, "current")) == nil || len(locker.tripPredictorMap) != 1 {
+		t.Errorf("removeExpiredPredictors() should only keep the current trip, kept %d", len(locker.tripPredictorMap))
+	}
+}
@@ -0,0 +1,48 @@
+package predictor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseRouteDurations parses values, a list of route_id and seconds separated by a colon, for example "100:300",
+// into durations by route_id. description names the setting in errors
+func parseRouteDurations(description string, values []string) (map[string]time.Duration, error) {
+	durations := make(map[string]time.Duration)
+	for _, value := range values {
+		parts := strings.Split(value, ":")
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return nil, fmt.Errorf("expected route %s as route_id:seconds, found %q", description, value)
+		}
+		seconds, err := strconv.Atoi(parts[1])
+		if err != nil || seconds < 0 {
+			return nil, fmt.Errorf("invalid %s seconds for route %s: %q", description, parts[0], parts[1])
+		}
+		durations[parts[0]] = time.Duration(seconds) * time.Second
+	}
+	return durations, nil
+}
+
+// parseRouteTypeDurations parses values, a list of route_type and seconds separated by a colon, for example "0:300",
+// into durations by GTFS route_type. description names the setting in errors
+func parseRouteTypeDurations(description string, values []string) (map[int]time.Duration, error) {
+	durations := make(map[int]time.Duration)
+	for _, value := range values {
+		routeTypeValue, secondsValue, found := strings.Cut(value, ":")
+		if !found {
+			return nil, fmt.Errorf("expected route_type %s as route_type:seconds, found %q", description, value)
+		}
+		routeType, err := strconv.Atoi(routeTypeValue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route_type for %s: %q", description, value)
+		}
+		seconds, err := strconv.Atoi(secondsValue)
+		if err != nil || seconds < 0 {
+			return nil, fmt.Errorf("invalid %s seconds for route_type %d: %q", description, routeType, secondsValue)
+		}
+		durations[routeType] = time.Duration(seconds) * time.Second
+	}
+	return durations, nil
+}
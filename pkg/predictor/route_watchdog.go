@@ -0,0 +1,257 @@
+package predictor
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/jmoiron/sqlx"
+	"github.com/nats-io/nats.go"
+	logger "log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// routeSilenceCheckInterval is how often the route silence watchdog checks for silent routes
+const routeSilenceCheckInterval = time.Minute
+
+// silentRouteMetrics exports the seconds each silent route has gone without a published TripUpdate under /debug/vars
+var silentRouteMetrics = expvar.NewMap("silent_routes")
+
+// RouteSilenceAlert is published when a route scheduled to be in service has had no TripUpdates published for the
+// silence period, and again with Silent false when TripUpdates resume or the route is no longer scheduled
+type RouteSilenceAlert struct {
+	RouteId string    `json:"route_id"`
+	At      time.Time `json:"at"`
+	Silent  bool      `json:"silent"`
+	// Scheduled is false when the alert is cleared because the route's scheduled service ended
+	Scheduled bool `json:"scheduled"`
+	// LastPublishedAt is the last time a TripUpdate was published for the route, or when the aggregator started
+	LastPublishedAt time.Time `json:"last_published_at"`
+	SilentSeconds   int       `json:"silent_seconds"`
+}
+
+// scheduledRoutesProvider provides the routes with trips scheduled, or implementation for testing
+type scheduledRoutesProvider interface {
+	GetScheduledRouteIds(ctx context.Context, at time.Time) ([]string, error)
+}
+
+// dbScheduledRoutesProvider uses a database connection to retrieve routes with trips scheduled
+// each query is abandoned after queryTimeout
+type dbScheduledRoutesProvider struct {
+	db           *sqlx.DB
+	queryTimeout time.Duration
+}
+
+func (d *dbScheduledRoutesProvider) GetScheduledRouteIds(ctx context.Context, at time.Time) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.queryTimeout)
+	defer cancel()
+	dataSet, err := gtfs.GetDataSetAt(ctx, d.db, at)
+	if err != nil {
+		return nil, err
+	}
+	return gtfs.GetScheduledRouteIds(ctx, d.db, dataSet, at, at)
+}
+
+// routeActivityTracker records when TripUpdates were last published for each route, and which routes are silent
+type routeActivityTracker struct {
+	mu            sync.Mutex
+	startedAt     time.Time
+	lastPublished map[string]time.Time
+	silentRoutes  map[string]bool
+}
+
+// makeRouteActivityTracker builds routeActivityTracker, routes are treated as last published at startedAt
+func makeRouteActivityTracker(startedAt time.Time) *routeActivityTracker {
+	return &routeActivityTracker{
+		mu:            sync.Mutex{},
+		startedAt:     startedAt,
+		lastPublished: make(map[string]time.Time),
+		silentRoutes:  make(map[string]bool),
+	}
+}
+
+// record marks tripUpdate's route as published at "at", a nil routeActivityTracker ignores it
+func (r *routeActivityTracker) record(tripUpdate *gtfs.TripUpdate, at time.Time) {
+	if r == nil {
+		return
+	}
+	r.recordAt(tripUpdate.RouteId, at)
+}
+
+func (r *routeActivityTracker) recordAt(routeId string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastPublished[routeId] = at
+}
+
+// checkSilence returns RouteSilenceAlerts for routes in scheduledRouteIds that have become silent as of "now",
+// and for silent routes that have resumed or are no longer scheduled
+func (r *routeActivityTracker) checkSilence(now time.Time,
+	scheduledRouteIds []string,
+	silence time.Duration) []*RouteSilenceAlert {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	alerts := make([]*RouteSilenceAlert, 0)
+	scheduled := make(map[string]bool)
+	for _, routeId := range scheduledRouteIds {
+		scheduled[routeId] = true
+		if r.silentRoutes[routeId] {
+			continue
+		}
+		lastPublished := r.lastPublishedAt(routeId)
+		if now.Sub(lastPublished) >= silence {
+			r.silentRoutes[routeId] = true
+			alerts = append(alerts, r.makeAlert(routeId, now, true, true))
+		}
+	}
+	for routeId := range r.silentRoutes {
+		if now.Sub(r.lastPublishedAt(routeId)) < silence || !scheduled[routeId] {
+			delete(r.silentRoutes, routeId)
+			alerts = append(alerts, r.makeAlert(routeId, now, false, scheduled[routeId]))
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].RouteId < alerts[j].RouteId
+	})
+	return alerts
+}
+
+// silentSeconds returns the seconds each silent route has gone without a published TripUpdate as of "now"
+func (r *routeActivityTracker) silentSeconds(now time.Time) map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	results := make(map[string]int)
+	for routeId := range r.silentRoutes {
+		results[routeId] = int(now.Sub(r.lastPublishedAt(routeId)).Seconds())
+	}
+	return results
+}
+
+func (r *routeActivityTracker) lastPublishedAt(routeId string) time.Time {
+	if lastPublished, present := r.lastPublished[routeId]; present {
+		return lastPublished
+	}
+	return r.startedAt
+}
+
+func (r *routeActivityTracker) makeAlert(routeId string, now time.Time, silent bool, scheduled bool) *RouteSilenceAlert {
+	lastPublished := r.lastPublishedAt(routeId)
+	return &RouteSilenceAlert{
+		RouteId:         routeId,
+		At:              now,
+		Silent:          silent,
+		Scheduled:       scheduled,
+		LastPublishedAt: lastPublished,
+		SilentSeconds:   int(now.Sub(lastPublished).Seconds()),
+	}
+}
+
+// routesScheduledThroughout returns the routes scheduled both at the start of the silence period and at "now",
+// limited to includedRoutes when it's not empty. Routes starting service within the period are left out so
+// they are not reported before they have had a chance to be predicted
+func routesScheduledThroughout(ctx context.Context,
+	provider scheduledRoutesProvider,
+	now time.Time,
+	silence time.Duration,
+	includedRoutes []string) ([]string, error) {
+	atStart, err := provider.GetScheduledRouteIds(ctx, now.Add(-silence))
+	if err != nil {
+		return nil, err
+	}
+	atEnd, err := provider.GetScheduledRouteIds(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	scheduledAtStart := make(map[string]bool)
+	for _, routeId := range atStart {
+		scheduledAtStart[routeId] = true
+	}
+	results := make([]string, 0)
+	for _, routeId := range atEnd {
+		if scheduledAtStart[routeId] && routeIncluded(routeId, includedRoutes) {
+			results = append(results, routeId)
+		}
+	}
+	return results, nil
+}
+
+// routeIncluded returns true if includedRoutes is empty or contains routeId
+func routeIncluded(routeId string, includedRoutes []string) bool {
+	if len(includedRoutes) == 0 {
+		return true
+	}
+	for _, value := range includedRoutes {
+		if value == routeId {
+			return true
+		}
+	}
+	return false
+}
+
+// runRouteSilenceWatchdog checks every interval for routes in scheduled service without TripUpdates published within
+// silence and publishes RouteSilenceAlerts on NATS subject
+func runRouteSilenceWatchdog(ctx context.Context,
+	log *logger.Logger,
+	wg *sync.WaitGroup,
+	natsConn *nats.Conn,
+	subject string,
+	provider scheduledRoutesProvider,
+	tracker *routeActivityTracker,
+	includedRoutes []string,
+	silence time.Duration,
+	interval time.Duration,
+	shutdownSignal chan bool) {
+	wg.Add(1)
+	defer wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-shutdownSignal:
+			log.Printf("Exiting route silence watchdog on shutdown signal")
+			return
+		case now := <-ticker.C:
+			scheduledRouteIds, err := routesScheduledThroughout(ctx, provider, now, silence, includedRoutes)
+			if err != nil {
+				log.Printf("Unable to retrieve scheduled routes for route silence watchdog: %v\n", err)
+				continue
+			}
+			for _, alert := range tracker.checkSilence(now, scheduledRouteIds, silence) {
+				if alert.Silent {
+					log.Printf("Route %s has had no predictions published for %d seconds\n",
+						alert.RouteId, alert.SilentSeconds)
+				} else {
+					log.Printf("Route %s is no longer silent\n", alert.RouteId)
+				}
+				err = publishRouteSilenceAlert(natsConn, subject, alert)
+				if err != nil {
+					log.Printf("Error publishing route silence alert: %v\n", err)
+				}
+			}
+			exportSilentRoutes(tracker.silentSeconds(now))
+		}
+	}
+}
+
+// publishRouteSilenceAlert sends alert as json on NATS subject
+func publishRouteSilenceAlert(natsConn *nats.Conn, subject string, alert *RouteSilenceAlert) error {
+	jsonData, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("error marshaling route silence alert to json: %w", err)
+	}
+	return natsConn.Publish(subject, jsonData)
+}
+
+// exportSilentRoutes replaces the routes in silentRouteMetrics with silentSeconds
+func exportSilentRoutes(silentSeconds map[string]int) {
+	silentRouteMetrics.Init()
+	for routeId, seconds := range silentSeconds {
+		value := new(expvar.Int)
+		value.Set(int64(seconds))
+		silentRouteMetrics.Set(routeId, value)
+	}
+}
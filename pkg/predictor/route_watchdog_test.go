@@ -0,0 +1,193 @@
+package predictor
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testScheduledRoutesProvider struct {
+	routesAt map[time.Time][]string
+}
+
+func (t *testScheduledRoutesProvider) GetScheduledRouteIds(_ context.Context, at time.Time) ([]string, error) {
+	return t.routesAt[at], nil
+}
+
+func Test_routeActivityTracker_checkSilence(t *testing.T) {
+	startedAt := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	silence := 10 * time.Minute
+	type check struct {
+		now       time.Time
+		scheduled []string
+		want      []*RouteSilenceAlert
+	}
+	tests := []struct {
+		name      string
+		published map[string]time.Time
+		checks    []check
+	}{
+		{
+			name: "routes are not reported before silence has passed since startup",
+			checks: []check{
+				{
+					now:       startedAt.Add(9 * time.Minute),
+					scheduled: []string{"100"},
+					want:      []*RouteSilenceAlert{},
+				},
+			},
+		},
+		{
+			name:      "scheduled route without publications is reported once",
+			published: map[string]time.Time{"100": startedAt.Add(5 * time.Minute)},
+			checks: []check{
+				{
+					now:       startedAt.Add(12 * time.Minute),
+					scheduled: []string{"100", "90"},
+					want: []*RouteSilenceAlert{
+						{
+							RouteId:         "90",
+							At:              startedAt.Add(12 * time.Minute),
+							Silent:          true,
+							Scheduled:       true,
+							LastPublishedAt: startedAt,
+							SilentSeconds:   720,
+						},
+					},
+				},
+				{
+					now:       startedAt.Add(13 * time.Minute),
+					scheduled: []string{"100", "90"},
+					want:      []*RouteSilenceAlert{},
+				},
+				{
+					now:       startedAt.Add(16 * time.Minute),
+					scheduled: []string{"100", "90"},
+					want: []*RouteSilenceAlert{
+						{
+							RouteId:         "100",
+							At:              startedAt.Add(16 * time.Minute),
+							Silent:          true,
+							Scheduled:       true,
+							LastPublishedAt: startedAt.Add(5 * time.Minute),
+							SilentSeconds:   660,
+						},
+					},
+				},
+			},
+		},
+		{
+			name:      "silent route is cleared when scheduled service ends",
+			published: map[string]time.Time{},
+			checks: []check{
+				{
+					now:       startedAt.Add(10 * time.Minute),
+					scheduled: []string{"100"},
+					want: []*RouteSilenceAlert{
+						{
+							RouteId:         "100",
+							At:              startedAt.Add(10 * time.Minute),
+							Silent:          true,
+							Scheduled:       true,
+							LastPublishedAt: startedAt,
+							SilentSeconds:   600,
+						},
+					},
+				},
+				{
+					now:       startedAt.Add(11 * time.Minute),
+					scheduled: []string{},
+					want: []*RouteSilenceAlert{
+						{
+							RouteId:         "100",
+							At:              startedAt.Add(11 * time.Minute),
+							Silent:          false,
+							Scheduled:       false,
+							LastPublishedAt: startedAt,
+							SilentSeconds:   660,
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := makeRouteActivityTracker(startedAt)
+			for routeId, at := range tt.published {
+				tracker.recordAt(routeId, at)
+			}
+			for i, c := range tt.checks {
+				got := tracker.checkSilence(c.now, c.scheduled, silence)
+				if !reflect.DeepEqual(got, c.want) {
+					t.Errorf("check %d checkSilence() = %+v, want %+v", i, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func Test_routeActivityTracker_checkSilence_resumed(t *testing.T) {
+	startedAt := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	silence := 10 * time.Minute
+	tracker := makeRouteActivityTracker(startedAt)
+	alerts := tracker.checkSilence(startedAt.Add(10*time.Minute), []string{"100"}, silence)
+	if len(alerts) != 1 || !alerts[0].Silent {
+		t.Fatalf("expected route to be reported silent, got %+v", alerts)
+	}
+	resumedAt := startedAt.Add(11 * time.Minute)
+	tracker.recordAt("100", resumedAt)
+	alerts = tracker.checkSilence(startedAt.Add(12*time.Minute), []string{"100"}, silence)
+	want := []*RouteSilenceAlert{
+		{
+			RouteId:         "100",
+			At:              startedAt.Add(12 * time.Minute),
+			Silent:          false,
+			Scheduled:       true,
+			LastPublishedAt: resumedAt,
+			SilentSeconds:   60,
+		},
+	}
+	if !reflect.DeepEqual(alerts, want) {
+		t.Errorf("checkSilence() = %+v, want %+v", alerts, want)
+	}
+	if seconds := tracker.silentSeconds(startedAt.Add(12 * time.Minute)); len(seconds) != 0 {
+		t.Errorf("silentSeconds() = %v, want no silent routes", seconds)
+	}
+}
+
+func Test_routesScheduledThroughout(t *testing.T) {
+	now := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	silence := 10 * time.Minute
+	provider := &testScheduledRoutesProvider{routesAt: map[time.Time][]string{
+		now.Add(-silence): {"100", "90", "20"},
+		now:               {"100", "90", "8"},
+	}}
+	tests := []struct {
+		name           string
+		includedRoutes []string
+		want           []string
+	}{
+		{
+			name: "routes scheduled at start and end of period",
+			want: []string{"100", "90"},
+		},
+		{
+			name:           "limited to included routes",
+			includedRoutes: []string{"90", "8"},
+			want:           []string{"90"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := routesScheduledThroughout(context.Background(), provider, now, silence, tt.includedRoutes)
+			if err != nil {
+				t.Fatalf("routesScheduledThroughout() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("routesScheduledThroughout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,408 @@
+package predictor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
+	"time"
+)
+
+// predictionResult holds the result of a segmentPredictor prediction
+type predictionResult struct {
+	inferenceRequest       *InferenceRequest
+	shadowInferenceRequest *InferenceRequest
+	stopPredictions        []*stopPrediction
+}
+
+// segmentPredictor responsible for generating predictions and InferenceRequests for segments of a trip
+// (one or more stops)
+type segmentPredictor struct {
+	model             *mlmodels.MLModel
+	osts              *observedStopTransitions
+	stopTimeInstances []*gtfs.StopTimeInstance
+	useInference      bool
+	useStatistics     bool
+	holidayCalendar   *transitHolidayCalendar
+	// shadowModel is a candidate replacement for model that receives the same inference requests for evaluation
+	shadowModel *mlmodels.MLModel
+	// serviceExceptionFeatures adds the trip's calendar service exceptions to inference features
+	serviceExceptionFeatures bool
+	// timeBucketFeature adds the sequence of the timeBuckets containing the request time to inference features
+	timeBucketFeature bool
+	timeBuckets       []*mlmodels.TimeBucket
+	// enricher supplies external inference features when not nil
+	enricher featureEnricher
+	// health disables inference with model when its predictions have been worse than the schedule, when not nil
+	health *modelHealthTracker
+}
+
+// scheduledTime returns the scheduled arrival time of the first stop in this segment in seconds since midnight
+func (s *segmentPredictor) scheduledTime() int {
+	return s.stopTimeInstances[len(s.stopTimeInstances)-1].ArrivalTime - s.stopTimeInstances[0].ArrivalTime
+}
+
+func (s *segmentPredictor) firstScheduledStopTimeInstances() (*gtfs.StopTimeInstance, *gtfs.StopTimeInstance) {
+	return s.stopTimeInstances[0], s.stopTimeInstances[1]
+}
+
+// relevantForDistance returns true if this segment is relevant for predictions after the distance on the trip
+func (s *segmentPredictor) relevantForDistance(distance float64) bool {
+	lastIndex := len(s.stopTimeInstances) - 1
+	if lastIndex <= 0 {
+		return false
+	}
+	return distance <= s.stopTimeInstances[lastIndex].ShapeDistTraveled
+}
+
+// predict produces predictionResult for this segment. If predictionResult.inferenceRequest is non-nil
+// then this segment needs am inference response before the prediction is complete.
+// Segments of models disabled by health are predicted with the schedule
+func (s *segmentPredictor) predict(tripDeviation *gtfs.TripDeviation) *predictionResult {
+	result := predictionResult{}
+	if s.useInference && s.health.disabled(s.model.MLModelId) {
+		result.stopPredictions = s.applySegmentTime(float64(s.scheduledTime()), gtfs.SchedulePrediction, true,
+			tripDeviation.TripProgress)
+		return &result
+	}
+	needsInference := s.useInference && s.relevantForDistance(tripDeviation.TripProgress)
+	segmentTime, source := s.statisticalSegmentTime(tripDeviation.DeviationTimestamp)
+	result.stopPredictions = s.applySegmentTime(segmentTime, source, !needsInference, tripDeviation.TripProgress)
+
+	if needsInference {
+		result.inferenceRequest = s.buildInferenceRequest(tripDeviation)
+		if s.shadowModel != nil {
+			result.shadowInferenceRequest = s.buildShadowInferenceRequest(result.inferenceRequest)
+		}
+	}
+	return &result
+}
+
+// buildShadowInferenceRequest creates an InferenceRequest for the shadowModel with the same features as request
+// and pairs the two requests so their responses can be compared
+func (s *segmentPredictor) buildShadowInferenceRequest(request *InferenceRequest) *InferenceRequest {
+	shadowRequest := &InferenceRequest{
+		MLModelId:        s.shadowModel.MLModelId,
+		Version:          s.shadowModel.Version,
+		segmentPredictor: s,
+		Features:         request.Features,
+		shadow:           true,
+		pairedRequest:    request,
+	}
+	request.pairedRequest = shadowRequest
+	return shadowRequest
+}
+
+// buildInferenceRequest creates an InferenceRequest for tripDeviation on its segment
+func (s *segmentPredictor) buildInferenceRequest(tripDeviation *gtfs.TripDeviation) *InferenceRequest {
+
+	at := tripDeviation.DeviationTimestamp
+
+	transitions := make([]transitionFeature, 0)
+	var previousStopTime *gtfs.StopTimeInstance
+	for _, stopTime := range s.stopTimeInstances {
+		if previousStopTime != nil {
+			transitions = append(transitions,
+				buildTransitionFeature(previousStopTime, stopTime, s.osts, at))
+		}
+		previousStopTime = stopTime
+	}
+
+	segmentScheduleSeconds := previousStopTime.ArrivalTime - s.stopTimeInstances[0].ArrivalTime
+
+	return &InferenceRequest{
+		MLModelId:        s.model.MLModelId,
+		Version:          s.model.Version,
+		segmentPredictor: s,
+		Features: inferenceFeatures{
+			month:                    int(at.Month()),
+			weekDay:                  int(at.Weekday()),
+			hour:                     at.Hour(),
+			minute:                   at.Minute(),
+			second:                   at.Second(),
+			holiday:                  s.isHoliday(at),
+			serviceExceptionFeatures: s.serviceExceptionFeatures,
+			serviceAdded:             tripDeviation.ServiceException.ServiceAdded,
+			serviceReduced:           tripDeviation.ServiceException.ServiceReduced,
+			timeBucketFeature:        s.timeBucketFeature,
+			timeBucket:               s.timeBucket(at),
+			scheduledSeconds:         segmentScheduleSeconds,
+			scheduledTime:            previousStopTime.ArrivalTime,
+			delay:                    tripDeviation.Delay,
+			distanceToStop:           previousStopTime.ShapeDistTraveled - tripDeviation.TripProgress,
+			enrichment:               s.enrichmentFeatures(),
+			transitionFeatures:       transitions,
+		},
+	}
+}
+
+// statisticalSegmentTime returns time to use for the segment prediction when inference is not used
+// and returns the gtfs.PredictionSource describing where this value derived from.
+// without model statistics the recent observed travel times are used before falling back to the schedule
+func (s *segmentPredictor) statisticalSegmentTime(at time.Time) (float64, gtfs.PredictionSource) {
+	if s.useStatistics && s.model != nil && s.model.Average != nil {
+		if len(s.stopTimeInstances) > 2 {
+			return *s.model.Average, gtfs.TimepointStatisticsPrediction
+		}
+		return *s.model.Average, gtfs.StopStatisticsPrediction
+	}
+	if segmentTime, ok := s.recentObservationsSegmentTime(at); ok {
+		return segmentTime, gtfs.RecentObservationsPrediction
+	}
+	return float64(s.scheduledTime()), gtfs.SchedulePrediction
+}
+
+// recentObservationsSegmentTime returns the sum of the recent average travel times between each pair of stops in
+// this segment. returns false unless every pair of stops has been observed recently
+func (s *segmentPredictor) recentObservationsSegmentTime(at time.Time) (float64, bool) {
+	segmentTime := 0.0
+	for i := 1; i < len(s.stopTimeInstances); i++ {
+		travelSeconds, ok := s.osts.recentAverageTravelSeconds(s.stopTimeInstances[i-1].StopId,
+			s.stopTimeInstances[i].StopId, at)
+		if !ok {
+			return 0, false
+		}
+		segmentTime += travelSeconds
+	}
+	return segmentTime, len(s.stopTimeInstances) > 1
+}
+
+// applyInferenceResponse uses inferenceResponse value among the segments stops and returns resulting
+// stopPrediction slice
+func (s *segmentPredictor) applyInferenceResponse(inferenceResponse float64,
+	tripProgress float64) []*stopPrediction {
+	src := gtfs.TimepointMLPrediction
+	if len(s.stopTimeInstances) <= 2 {
+		src = gtfs.StopMLPrediction
+	}
+	return s.applySegmentTime(inferenceResponse, src, true, tripProgress)
+}
+
+// applySegmentTime distributes seconds across stopTimeInstances and returns stopPrediction slice
+// with gtfs.PredictionSource
+// seconds is the number of seconds predicted to have been traveled for this segment, it may be derived from
+// any of the sources defined by the gtfs.PredictionSource
+// predictionComplete should be false when an inference request is required
+func (s *segmentPredictor) applySegmentTime(seconds float64,
+	src gtfs.PredictionSource,
+	predictionComplete bool,
+	tripProgress float64) []*stopPrediction {
+
+	results := make([]*stopPrediction, 0)
+
+	allStopsScheduledTime := s.scheduledTime()
+	var previousStop *gtfs.StopTimeInstance
+	for _, stop := range s.stopTimeInstances {
+		if previousStop != nil {
+			results = append(results, &stopPrediction{
+				fromStop:              previousStop,
+				toStop:                stop,
+				predictedTime:         calcStopSegmentTime(previousStop, stop, allStopsScheduledTime, seconds),
+				predictionSource:      src,
+				stopUpdateDisposition: makeStopUpdateDisposition(tripProgress, stop.ShapeDistTraveled),
+				predictionComplete:    predictionComplete,
+			})
+		}
+		previousStop = stop
+	}
+	return results
+}
+
+// enrichmentFeatures returns the external features from enricher, or nil without an enricher
+func (s *segmentPredictor) enrichmentFeatures() []float64 {
+	if s.enricher == nil {
+		return nil
+	}
+	return s.enricher.enrichmentFeatures()
+}
+
+// timeBucket returns the sequence of the time bucket containing "at" when timeBucketFeature is set, otherwise 0
+func (s *segmentPredictor) timeBucket(at time.Time) int {
+	if !s.timeBucketFeature {
+		return 0
+	}
+	return mlmodels.TimeBucketSequence(s.timeBuckets, at)
+}
+
+// isHoliday returns true if "at" is on an observed holiday
+func (s *segmentPredictor) isHoliday(at time.Time) bool {
+	return s.holidayCalendar.isHoliday(at)
+}
+
+// calcStopSegmentTime calculates the amount of time to be applied from "totalPredictedTime" for travel between
+// "stop1" and "stop2", where the "totalPredictedTime" is the prediction for a trip segment that's
+// scheduled for "allStopsScheduledTime" seconds, of which "stop1" and "stop2" are a part.
+func calcStopSegmentTime(stop1 *gtfs.StopTimeInstance,
+	stop2 *gtfs.StopTimeInstance,
+	allStopsScheduledTime int,
+	totalPredictedTime float64) float64 {
+	stopPairTime := stop2.ArrivalTime - stop1.ArrivalTime
+	stopPairRatio := float64(stopPairTime) / float64(allStopsScheduledTime)
+	ourSegmentTime := totalPredictedTime * stopPairRatio
+	return ourSegmentTime
+}
+
+// segmentPredictorFactory creates segmentPredictor from loaded mlmodels.MLModel
+type segmentPredictorFactory struct {
+	modelByName                 map[string]*mlmodels.MLModel
+	osts                        *observedStopTransitions
+	minimumRMSEModelImprovement float64
+	minimumObservedStopCount    int
+	holidayCalendar             *transitHolidayCalendar
+	makePredictions             bool
+	useStatistics               bool
+	// timepointOnlyRouteIds contains route_ids that are only predicted with timepoint models
+	timepointOnlyRouteIds map[string]bool
+	// shadowModelByName contains shadow models evaluated alongside the current model of the same name
+	shadowModelByName map[string]*mlmodels.MLModel
+	// serviceExceptionFeatures is passed on to each segmentPredictor
+	serviceExceptionFeatures bool
+	// timeBucketFeature and timeBuckets are passed on to each segmentPredictor, set after the factory is made when
+	// models were trained with the time bucket feature
+	timeBucketFeature bool
+	timeBuckets       []*mlmodels.TimeBucket
+	// patternModels prefers the models of a trip's stop pattern in the time bucket of each segment's first stop, set
+	// after the factory is made along with timeBuckets
+	patternModels bool
+	// enricher is passed on to each segmentPredictor
+	enricher featureEnricher
+	// health is passed on to each segmentPredictor, set after the factory is made when models are health tracked
+	health *modelHealthTracker
+}
+
+// makeSegmentPredictionFactory builds segmentPredictorFactory
+// serviceExceptionFeatures should only be set when the models were trained with service exception features,
+// likewise enricher should be nil unless the models were trained with its features
+func makeSegmentPredictionFactory(modelByName map[string]*mlmodels.MLModel,
+	osts *observedStopTransitions,
+	minimumRMSEModelImprovement float64,
+	minimumObservedStopCount int,
+	makePredictions bool,
+	useStatistics bool,
+	timepointOnlyRouteIds []string,
+	shadowModelByName map[string]*mlmodels.MLModel,
+	serviceExceptionFeatures bool,
+	enricher featureEnricher) *segmentPredictorFactory {
+
+	timepointOnlyRoutes := make(map[string]bool)
+	for _, routeId := range timepointOnlyRouteIds {
+		timepointOnlyRoutes[routeId] = true
+	}
+
+	factory := segmentPredictorFactory{
+		modelByName:                 modelByName,
+		osts:                        osts,
+		minimumRMSEModelImprovement: minimumRMSEModelImprovement,
+		minimumObservedStopCount:    minimumObservedStopCount,
+		holidayCalendar:             makeTransitHolidayCalendar(),
+		makePredictions:             makePredictions,
+		useStatistics:               useStatistics,
+		timepointOnlyRouteIds:       timepointOnlyRoutes,
+		shadowModelByName:           shadowModelByName,
+		serviceExceptionFeatures:    serviceExceptionFeatures,
+		enricher:                    enricher,
+	}
+
+	return &factory
+}
+
+// makeSegmentPredictors given a series of stopTimeInstances create segmentPredictor, preferring timepoint based
+// models over stop to stop based models.
+// when timepointOnly is true stop to stop models are never used, the timepoint segment is predicted as a whole and
+// intermediate stops are interpolated from their scheduled spacing.
+// patternId is the trip's stop pattern, nil when it has none
+func (f *segmentPredictorFactory) makeSegmentPredictors(
+	stopTimeInstances []*gtfs.StopTimeInstance,
+	patternId *string,
+	timepointOnly bool) []*segmentPredictor {
+
+	results := make([]*segmentPredictor, 0)
+
+	//check if entire segment can be done with the timepoint predictor
+	tpModel := f.findModel(stopTimeInstances, patternId)
+	if timepointOnly || f.shouldUseModelToPredict(tpModel) {
+		return append(results, f.makeSegmentPredictor(tpModel, stopTimeInstances))
+	}
+
+	return f.makeStopSegmentPredictors(stopTimeInstances, patternId)
+}
+
+// makeStopSegmentPredictors create slice of segmentPredictor with stop to stop based models for gtfs.StopTimeInstance
+func (f *segmentPredictorFactory) makeStopSegmentPredictors(stopTimeInstances []*gtfs.StopTimeInstance,
+	patternId *string) []*segmentPredictor {
+	results := make([]*segmentPredictor, 0)
+
+	var lastStop *gtfs.StopTimeInstance
+	for _, stop := range stopTimeInstances {
+		if lastStop != nil {
+			stopTimePair := []*gtfs.StopTimeInstance{lastStop, stop}
+			stopModel := f.findModel(stopTimePair, patternId)
+			results = append(results, f.makeSegmentPredictor(stopModel, stopTimePair))
+		}
+		lastStop = stop
+	}
+	return results
+}
+
+// findModel returns the model for stopTimeInstances. When patternModels is set the model of the stop pattern
+// patternId in the time bucket of the first stop's scheduled arrival is preferred, as long as it can be used to
+// predict. Otherwise the model named by the stops is returned, nil if there is none
+func (f *segmentPredictorFactory) findModel(stopTimeInstances []*gtfs.StopTimeInstance,
+	patternId *string) *mlmodels.MLModel {
+	modelName := mlmodels.GetModelNameForStopTimeInstances(stopTimeInstances)
+	if f.patternModels && patternId != nil {
+		timeBucket := mlmodels.TimeBucketSequence(f.timeBuckets, stopTimeInstances[0].ArrivalDateTime)
+		if timeBucket > 0 {
+			patternModel := f.modelByName[mlmodels.GetPatternModelName(modelName, *patternId, timeBucket)]
+			if f.shouldUseModelToPredict(patternModel) || f.shouldUseStatisticsToPredict(patternModel) {
+				return patternModel
+			}
+		}
+	}
+	return f.modelByName[modelName]
+}
+
+// makeSegmentPredictor makes a segmentPredictor with mlModel for slice of gtfs.StopTimeInstance
+// a shadow model is only assigned when mlModel is used for inference, so there is a prediction to compare it to
+func (f *segmentPredictorFactory) makeSegmentPredictor(mlModel *mlmodels.MLModel,
+	stopTimeInstances []*gtfs.StopTimeInstance,
+) *segmentPredictor {
+	useInference := f.shouldUseModelToPredict(mlModel)
+	var shadowModel *mlmodels.MLModel
+	if useInference {
+		shadowModel = f.shadowModelByName[mlModel.ModelName]
+	}
+	return &segmentPredictor{
+		model:                    mlModel,
+		osts:                     f.osts,
+		stopTimeInstances:        stopTimeInstances,
+		useInference:             useInference,
+		useStatistics:            f.shouldUseStatisticsToPredict(mlModel),
+		holidayCalendar:          f.holidayCalendar,
+		shadowModel:              shadowModel,
+		serviceExceptionFeatures: f.serviceExceptionFeatures,
+		timeBucketFeature:        f.timeBucketFeature,
+		timeBuckets:              f.timeBuckets,
+		enricher:                 f.enricher,
+		health:                   f.health,
+	}
+}
+
+// predictTimepointsOnly returns true if trips on routeId should only be predicted with timepoint models
+func (f *segmentPredictorFactory) predictTimepointsOnly(routeId string) bool {
+	return f.timepointOnlyRouteIds[routeId]
+}
+
+// shouldUseModelToPredict returns true if mlModel is suitable for inference
+func (f *segmentPredictorFactory) shouldUseModelToPredict(mlModel *mlmodels.MLModel) bool {
+	return f.makePredictions &&
+		mlModel != nil &&
+		mlModel.TrainedTimestamp != nil &&
+		mlModel.AvgRMSE-mlModel.MLRMSE >= f.minimumRMSEModelImprovement
+}
+
+// shouldUseStatisticsToPredict returns true if mlModel can be used for predictions based on average travel times
+func (f *segmentPredictorFactory) shouldUseStatisticsToPredict(mlModel *mlmodels.MLModel) bool {
+	return f.useStatistics &&
+		mlModel != nil &&
+		mlModel.ObservedStopCount != nil &&
+		*mlModel.ObservedStopCount > f.minimumObservedStopCount
+}
@@ -1,4 +1,4 @@
-package aggregator
+package predictor
 
 import (
 	"fmt"
@@ -14,7 +14,7 @@ func Test_segmentPredictorFactory(t *testing.T) {
 
 	modelMap := getTestModelMap(t, "trip_instance_1_stop_models.json", "trip_instance_1_tp_models.json")
 
-	osts := makeObservedStopTransitions(3600)
+	osts := makeObservedStopTransitions(3600, 0, 0)
 
 	location, err := time.LoadLocation("America/Los_Angeles")
 	if err != nil {
@@ -28,6 +28,7 @@ func Test_segmentPredictorFactory(t *testing.T) {
 		modelMap                    map[string]*mlmodels.MLModel
 		minimumRMSEModelImprovement float64
 		minimumObservedStopCount    int
+		timepointOnly               bool
 	}
 
 	tests := []struct {
@@ -88,6 +89,45 @@ func Test_segmentPredictorFactory(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "use tp model when timepoint model under performs on timepoint only route",
+			factoryArgs: factoryArgs{
+				modelMap:                    modelMap,
+				minimumRMSEModelImprovement: 0.0,
+				timepointOnly:               true,
+			},
+			stopTimeInstances: []*gtfs.StopTimeInstance{
+				trip.StopTimeInstances[0], trip.StopTimeInstances[1], trip.StopTimeInstances[2],
+			},
+			want: []*segmentPredictor{
+				{
+					model: modelMap["A_B_C"],
+					stopTimeInstances: []*gtfs.StopTimeInstance{
+						trip.StopTimeInstances[0], trip.StopTimeInstances[1], trip.StopTimeInstances[2],
+					},
+					useInference: false,
+				},
+			},
+		},
+		{
+			name: "schedule only on timepoint only route without models",
+			factoryArgs: factoryArgs{
+				modelMap:      nil,
+				timepointOnly: true,
+			},
+			stopTimeInstances: []*gtfs.StopTimeInstance{
+				trip.StopTimeInstances[0], trip.StopTimeInstances[1], trip.StopTimeInstances[2],
+			},
+			want: []*segmentPredictor{
+				{
+					model: nil,
+					stopTimeInstances: []*gtfs.StopTimeInstance{
+						trip.StopTimeInstances[0], trip.StopTimeInstances[1], trip.StopTimeInstances[2],
+					},
+					useInference: false,
+				},
+			},
+		},
 		{
 			name: "use tp models when timepoint model performs",
 			factoryArgs: factoryArgs{
@@ -112,8 +152,8 @@ func Test_segmentPredictorFactory(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			factory := makeSegmentPredictionFactory(tt.factoryArgs.modelMap, osts,
-				tt.factoryArgs.minimumRMSEModelImprovement, 1, true, true)
-			result := factory.makeSegmentPredictors(tt.stopTimeInstances)
+				tt.factoryArgs.minimumRMSEModelImprovement, 1, true, true, nil, nil, false, nil)
+			result := factory.makeSegmentPredictors(tt.stopTimeInstances, nil, tt.factoryArgs.timepointOnly)
 			same, discrepancyDescription := segmentPredictorsAreTheSame(result, tt.want)
 			if !same {
 				t.Errorf("Mismatch = %s\n", discrepancyDescription)
@@ -123,6 +163,105 @@ func Test_segmentPredictorFactory(t *testing.T) {
 
 }
 
+func Test_segmentPredictorFactory_patternModels(t *testing.T) {
+	modelMap := getTestModelMap(t, "trip_instance_1_stop_models.json", "trip_instance_1_tp_models.json")
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatalf("Unable to get testing time zone location")
+	}
+	trip := getTestTrip(time.Date(2022, 5, 22, 0, 0, 0, 0, location),
+		"trip_instance_1.json", t)
+	stopTimeInstances := []*gtfs.StopTimeInstance{
+		trip.StopTimeInstances[0], trip.StopTimeInstances[1], trip.StopTimeInstances[2],
+	}
+	timeBuckets, err := mlmodels.ParseTimeBuckets("weekday=mon-fri;weekend=sat-sun")
+	if err != nil {
+		t.Fatalf("ParseTimeBuckets() error = %v", err)
+	}
+	patternId := "p1"
+
+	// patternModel copies the model named modelName as the model of pattern p1 in the weekend time bucket
+	patternModel := func(modelName string, trained bool) *mlmodels.MLModel {
+		model := *modelMap[modelName]
+		model.ModelName = mlmodels.GetPatternModelName(modelName, patternId, 2)
+		model.ObservedStopCount = nil
+		model.TrainedTimestamp = nil
+		if trained {
+			trainedTimestamp := time.Now()
+			model.TrainedTimestamp = &trainedTimestamp
+			model.AvgRMSE = 20
+			model.MLRMSE = 10
+		}
+		return &model
+	}
+	withModels := func(patternModels ...*mlmodels.MLModel) map[string]*mlmodels.MLModel {
+		results := make(map[string]*mlmodels.MLModel)
+		for name, model := range modelMap {
+			results[name] = model
+		}
+		for _, model := range patternModels {
+			results[model.ModelName] = model
+		}
+		return results
+	}
+	timepointPatternModel := patternModel("A_B_C", true)
+	stopPatternModel := patternModel("A_B", true)
+	untrainedPatternModel := patternModel("B_C", false)
+
+	tests := []struct {
+		name          string
+		modelMap      map[string]*mlmodels.MLModel
+		patternModels bool
+		patternId     *string
+		want          []*mlmodels.MLModel
+	}{
+		{
+			name:          "trained timepoint pattern model preferred",
+			modelMap:      withModels(timepointPatternModel),
+			patternModels: true,
+			patternId:     &patternId,
+			want:          []*mlmodels.MLModel{timepointPatternModel},
+		},
+		{
+			name:          "stop models fall back when pattern model is untrained",
+			modelMap:      withModels(stopPatternModel, untrainedPatternModel),
+			patternModels: true,
+			patternId:     &patternId,
+			want:          []*mlmodels.MLModel{stopPatternModel, modelMap["B_C"]},
+		},
+		{
+			name:          "trip without a pattern uses stop models",
+			modelMap:      withModels(timepointPatternModel, stopPatternModel),
+			patternModels: true,
+			want:          []*mlmodels.MLModel{modelMap["A_B"], modelMap["B_C"]},
+		},
+		{
+			name:      "pattern models ignored unless enabled",
+			modelMap:  withModels(timepointPatternModel, stopPatternModel),
+			patternId: &patternId,
+			want:      []*mlmodels.MLModel{modelMap["A_B"], modelMap["B_C"]},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory := makeSegmentPredictionFactory(tt.modelMap, makeObservedStopTransitions(3600, 0, 0),
+				0, 1, true, true, nil, nil, false, nil)
+			factory.patternModels = tt.patternModels
+			factory.timeBuckets = timeBuckets
+			result := factory.makeSegmentPredictors(stopTimeInstances, tt.patternId, false)
+			if len(result) != len(tt.want) {
+				t.Fatalf("makeSegmentPredictors() returned %d predictors, want %d", len(result), len(tt.want))
+			}
+			for i, predictor := range result {
+				if predictor.model != tt.want[i] {
+					t.Errorf("row %d model = %s, want %s", i, describeModel(predictor.model),
+						describeModel(tt.want[i]))
+				}
+			}
+		})
+	}
+}
+
 func segmentPredictorsAreTheSame(got []*segmentPredictor, want []*segmentPredictor) (bool, string) {
 	if len(got) != len(want) {
 		return false, fmt.Sprintf("len(got) = %d != len(*wantPendingPrediction) %d", len(got), len(want))
@@ -150,7 +289,7 @@ func describeModel(model *mlmodels.MLModel) string {
 
 func Test_segmentPredictor_applySegmentTime(t *testing.T) {
 
-	osts := makeObservedStopTransitions(3600)
+	osts := makeObservedStopTransitions(3600, 0, 0)
 
 	location, err := time.LoadLocation("America/Los_Angeles")
 	if err != nil {
@@ -315,7 +454,7 @@ func Test_segmentPredictor_predict(t *testing.T) {
 		TravelSeconds: 1250,
 	}
 
-	osts := makeObservedStopTransitions(3600)
+	osts := makeObservedStopTransitions(3600, 0, 0)
 	osts.newOST(&stopBCOst)
 	osts.newOST(&stopEFOst)
 
@@ -827,3 +966,73 @@ func predictionResultMatches(got *predictionResult, want *predictionResult) (boo
 func stopPredictionMismatchDesc(row int, fieldName string, got *stopPrediction, want *stopPrediction) string {
 	return fmt.Sprintf("stopPrediction row %v mismatch on %v\n got:  %+v\n wantPendingPrediction: %+v", row, fieldName, got, want)
 }
+
+func Test_segmentPredictor_statisticalSegmentTime(t *testing.T) {
+	modelMap := getTestModelMap(t, "trip_instance_1_stop_models.json", "trip_instance_1_tp_models.json")
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Errorf("Unable to get testing time zone location")
+		return
+	}
+	trip1 := getTestTrip(time.Date(2022, 5, 22, 0, 0, 0, 0, location),
+		"trip_instance_1.json", t)
+	at := time.Date(2022, 5, 22, 12, 30, 10, 0, location)
+
+	osts := makeObservedStopTransitions(3600, 5, 0)
+	for _, travelSeconds := range []int{1000, 1100} {
+		osts.newOST(&gtfs.ObservedStopTime{ObservedTime: at, StopId: "A", NextStopId: "B", TravelSeconds: travelSeconds})
+	}
+	osts.newOST(&gtfs.ObservedStopTime{ObservedTime: at, StopId: "B", NextStopId: "C", TravelSeconds: 900})
+
+	tests := []struct {
+		name              string
+		model             *mlmodels.MLModel
+		useStatistics     bool
+		stopTimeInstances []*gtfs.StopTimeInstance
+		wantTime          float64
+		wantSource        gtfs.PredictionSource
+	}{
+		{
+			name:              "model statistics preferred",
+			model:             modelMap["A_B_C"],
+			useStatistics:     true,
+			stopTimeInstances: trip1.StopTimeInstances[0:3],
+			wantTime:          3600,
+			wantSource:        gtfs.TimepointStatisticsPrediction,
+		},
+		{
+			name:              "recent observations without model",
+			stopTimeInstances: trip1.StopTimeInstances[0:2],
+			wantTime:          1050,
+			wantSource:        gtfs.RecentObservationsPrediction,
+		},
+		{
+			name:              "recent observations summed across timepoint segment",
+			model:             modelMap["A_B_C"],
+			stopTimeInstances: trip1.StopTimeInstances[0:3],
+			wantTime:          1950,
+			wantSource:        gtfs.RecentObservationsPrediction,
+		},
+		{
+			name:              "schedule when a stop pair has no recent observations",
+			stopTimeInstances: trip1.StopTimeInstances[2:4],
+			wantTime:          float64(trip1.StopTimeInstances[3].ArrivalTime - trip1.StopTimeInstances[2].ArrivalTime),
+			wantSource:        gtfs.SchedulePrediction,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &segmentPredictor{
+				model:             tt.model,
+				osts:              osts,
+				stopTimeInstances: tt.stopTimeInstances,
+				useStatistics:     tt.useStatistics,
+			}
+			gotTime, gotSource := s.statisticalSegmentTime(at)
+			if gotTime != tt.wantTime || gotSource != tt.wantSource {
+				t.Errorf("statisticalSegmentTime() = %v, %v, want %v, %v", gotTime, gotSource, tt.wantTime,
+					tt.wantSource)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package predictor
+
+import (
+	"context"
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
+	"github.com/jmoiron/sqlx"
+	"math"
+	"sync"
+	"time"
+)
+
+// shadowComparisonDestination receives comparisons between shadow and current model predictions, or implementation
+// for testing
+type shadowComparisonDestination interface {
+	recordShadowComparisons(comparisons []*mlmodels.ShadowComparison) error
+}
+
+// dbShadowComparisonDestination records shadow comparisons to the ml_model_shadow_comparison table
+type dbShadowComparisonDestination struct {
+	db           *sqlx.DB
+	queryTimeout time.Duration
+}
+
+func (d *dbShadowComparisonDestination) recordShadowComparisons(comparisons []*mlmodels.ShadowComparison) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d.queryTimeout)
+	defer cancel()
+	return mlmodels.RecordShadowComparisons(ctx, d.db, comparisons)
+}
+
+// shadowEvaluator pairs inference responses from shadow models with the responses from the current model made with
+// the same features, and collects the comparisons until they are flushed to its shadowComparisonDestination
+type shadowEvaluator struct {
+	mu          sync.Mutex
+	destination shadowComparisonDestination
+	pending     []*mlmodels.ShadowComparison
+}
+
+// makeShadowEvaluator builds shadowEvaluator
+func makeShadowEvaluator(destination shadowComparisonDestination) *shadowEvaluator {
+	return &shadowEvaluator{
+		mu:          sync.Mutex{},
+		destination: destination,
+	}
+}
+
+// inferenceReceived stores prediction as the response to request. When both request and its paired request have
+// been answered a mlmodels.ShadowComparison is collected. Requests without a pair and a nil shadowEvaluator are ignored
+func (s *shadowEvaluator) inferenceReceived(at time.Time, tripId string, request *InferenceRequest, prediction float64) {
+	if s == nil || request.pairedRequest == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request.prediction = &prediction
+	paired := request.pairedRequest
+	if paired.prediction == nil {
+		return
+	}
+	current, shadow := request, paired
+	if request.shadow {
+		current, shadow = paired, request
+	}
+	s.pending = append(s.pending, &mlmodels.ShadowComparison{
+		ComparisonTimestamp: at,
+		ModelName:           current.segmentPredictor.model.ModelName,
+		TripId:              tripId,
+		MLModelId:           current.MLModelId,
+		Version:             current.Version,
+		ShadowMLModelId:     shadow.MLModelId,
+		ShadowVersion:       shadow.Version,
+		Prediction:          *current.prediction,
+		ShadowPrediction:    *shadow.prediction,
+	})
+}
+
+// flush sends all collected comparisons to the shadowComparisonDestination
+// returns the number of comparisons sent and the mean absolute difference in seconds between the predictions
+func (s *shadowEvaluator) flush() (int, float64, error) {
+	if s == nil {
+		return 0, 0, nil
+	}
+	s.mu.Lock()
+	comparisons := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	if len(comparisons) == 0 {
+		return 0, 0, nil
+	}
+	totalDifference := 0.0
+	for _, comparison := range comparisons {
+		totalDifference += math.Abs(comparison.ShadowPrediction - comparison.Prediction)
+	}
+	err := s.destination.recordShadowComparisons(comparisons)
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(comparisons), totalDifference / float64(len(comparisons)), nil
+}
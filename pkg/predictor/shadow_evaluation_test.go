@@ -0,0 +1,144 @@
+package predictor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testShadowComparisonDestination struct {
+	recorded []*mlmodels.ShadowComparison
+}
+
+func (d *testShadowComparisonDestination) recordShadowComparisons(comparisons []*mlmodels.ShadowComparison) error {
+	d.recorded = append(d.recorded, comparisons...)
+	return nil
+}
+
+func Test_segmentPredictorFactory_shadowModels(t *testing.T) {
+	modelMap := getTestModelMap(t, "trip_instance_1_stop_models.json", "trip_instance_1_tp_models.json")
+	shadowModelMap := map[string]*mlmodels.MLModel{
+		"A_B":   {MLModelId: 100, Version: 1, ModelName: "A_B", Shadow: true},
+		"B_C":   {MLModelId: 101, Version: 1, ModelName: "B_C", Shadow: true},
+		"C_D_E": {MLModelId: 102, Version: 1, ModelName: "C_D_E", Shadow: true},
+	}
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Errorf("Unable to get testing time zone location")
+		return
+	}
+	trip := getTestTrip(time.Date(2022, 5, 22, 0, 0, 0, 0, location), "trip_instance_1.json", t)
+	factory := makeSegmentPredictionFactory(modelMap, makeObservedStopTransitions(3600, 0, 0), 0.0, 1,
+		true, true, nil, shadowModelMap, false, nil)
+
+	tests := []struct {
+		name              string
+		stopTimeInstances []*gtfs.StopTimeInstance
+		wantShadowModels  []*mlmodels.MLModel
+	}{
+		{
+			name: "shadow model only used when current model is used for inference",
+			stopTimeInstances: []*gtfs.StopTimeInstance{
+				trip.StopTimeInstances[0], trip.StopTimeInstances[1], trip.StopTimeInstances[2],
+			},
+			wantShadowModels: []*mlmodels.MLModel{shadowModelMap["A_B"], nil},
+		},
+		{
+			name: "shadow timepoint model",
+			stopTimeInstances: []*gtfs.StopTimeInstance{
+				trip.StopTimeInstances[2], trip.StopTimeInstances[3], trip.StopTimeInstances[4],
+			},
+			wantShadowModels: []*mlmodels.MLModel{shadowModelMap["C_D_E"]},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			predictors := factory.makeSegmentPredictors(tt.stopTimeInstances, nil, false)
+			if len(predictors) != len(tt.wantShadowModels) {
+				t.Fatalf("makeSegmentPredictors() returned %d predictors, want %d", len(predictors),
+					len(tt.wantShadowModels))
+			}
+			for i, predictor := range predictors {
+				if predictor.shadowModel != tt.wantShadowModels[i] {
+					t.Errorf("row %d shadowModel = %s, want %s", i, describeModel(predictor.shadowModel),
+						describeModel(tt.wantShadowModels[i]))
+				}
+			}
+		})
+	}
+}
+
+func Test_shadowEvaluator(t *testing.T) {
+	modelMap := getTestModelMap(t, "trip_instance_1_stop_models.json", "trip_instance_1_tp_models.json")
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Errorf("Unable to get testing time zone location")
+		return
+	}
+	trip := getTestTrip(time.Date(2022, 5, 22, 0, 0, 0, 0, location), "trip_instance_1.json", t)
+	at := time.Date(2022, 5, 22, 12, 30, 10, 0, location)
+	predictor := &segmentPredictor{
+		model: modelMap["C_D_E"],
+		osts:  makeObservedStopTransitions(3600, 0, 0),
+		stopTimeInstances: []*gtfs.StopTimeInstance{
+			trip.StopTimeInstances[2], trip.StopTimeInstances[3], trip.StopTimeInstances[4],
+		},
+		useInference:    true,
+		holidayCalendar: makeTransitHolidayCalendar(),
+		shadowModel:     &mlmodels.MLModel{MLModelId: 102, Version: 3, ModelName: "C_D_E", Shadow: true},
+	}
+	deviation := &gtfs.TripDeviation{DeviationTimestamp: at, TripId: trip.TripId}
+
+	tests := []struct {
+		name        string
+		shadowFirst bool
+	}{
+		{name: "current model responds first"},
+		{name: "shadow model responds first", shadowFirst: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := predictor.predict(deviation)
+			current, shadow := result.inferenceRequest, result.shadowInferenceRequest
+			if current == nil || shadow == nil {
+				t.Fatalf("predict() inferenceRequest = %v, shadowInferenceRequest = %v, want both", current, shadow)
+			}
+			if !shadow.shadow || shadow.MLModelId != 102 || shadow.Version != 3 ||
+				!reflect.DeepEqual(shadow.Features, current.Features) {
+				t.Errorf("shadowInferenceRequest = %+v, want shadow request with features %+v", shadow, current.Features)
+			}
+
+			destination := &testShadowComparisonDestination{}
+			evaluator := makeShadowEvaluator(destination)
+			first, firstPrediction, second, secondPrediction := current, 1000.0, shadow, 1100.0
+			if tt.shadowFirst {
+				first, firstPrediction, second, secondPrediction = shadow, 1100.0, current, 1000.0
+			}
+			evaluator.inferenceReceived(at, trip.TripId, first, firstPrediction)
+			if recorded, _, _ := evaluator.flush(); recorded != 0 {
+				t.Errorf("flush() after first response recorded %d, want 0", recorded)
+			}
+			evaluator.inferenceReceived(at, trip.TripId, second, secondPrediction)
+			recorded, meanDifference, err := evaluator.flush()
+			if err != nil || recorded != 1 || meanDifference != 100 {
+				t.Errorf("flush() = %d, %v, %v, want 1, 100, nil", recorded, meanDifference, err)
+			}
+			want := []*mlmodels.ShadowComparison{{
+				ComparisonTimestamp: at,
+				ModelName:           "C_D_E",
+				TripId:              trip.TripId,
+				MLModelId:           modelMap["C_D_E"].MLModelId,
+				Version:             modelMap["C_D_E"].Version,
+				ShadowMLModelId:     102,
+				ShadowVersion:       3,
+				Prediction:          1000,
+				ShadowPrediction:    1100,
+			}}
+			if !reflect.DeepEqual(destination.recorded, want) {
+				t.Errorf("recorded = %+v, want %+v", destination.recorded[0], want[0])
+			}
+		})
+	}
+}
@@ -1,4 +1,4 @@
-package aggregator
+package predictor
 
 import (
 	"encoding/json"
@@ -28,6 +28,26 @@ func getTestTrip(serviceDate time.Time, fileName string, t *testing.T) *gtfs.Tri
 	return result
 }
 
+// getTestTrips loads trips on serviceDate from the json file at path, which may be another package's testdata
+func getTestTrips(serviceDate time.Time, path string, t testing.TB) []*gtfs.TripInstance {
+	var result []*gtfs.TripInstance
+	file, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("unable to read test trips file: %v", err)
+	}
+	err = json.Unmarshal(file, &result)
+	if err != nil {
+		t.Errorf("unable to read test trips file: %v", err)
+	}
+	for _, trip := range result {
+		for _, s := range trip.StopTimeInstances {
+			s.ArrivalDateTime = gtfs.MakeScheduleTime(serviceDate, s.ArrivalTime)
+			s.DepartureDateTime = gtfs.MakeScheduleTime(serviceDate, s.DepartureTime)
+		}
+	}
+	return result
+}
+
 func getTestModels(fileName string, t *testing.T) []*mlmodels.MLModel {
 	var result []*mlmodels.MLModel
 	file, err := os.ReadFile(fmt.Sprintf("testdata/%s", fileName))
@@ -0,0 +1,167 @@
+package predictor
+
+import (
+	"context"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
+	"github.com/jmoiron/sqlx"
+	logger "log"
+	"time"
+)
+
+// SimulationConf describes the mock TripDeviation a simulated prediction is made from and how its segments are
+// predicted
+type SimulationConf struct {
+	TripId string
+	//At is the time of the mock TripDeviation
+	At time.Time
+	//DelaySeconds is how far behind its schedule the vehicle is at At, negative when running early. The vehicle is
+	//placed along the trip where its schedule has it DelaySeconds before At
+	DelaySeconds int
+	//StubModelFactor when above zero predicts every pair of stops with a stub model answering each inference request
+	//with the segment's scheduled seconds multiplied by the factor. Otherwise segments are predicted from the schedule
+	StubModelFactor            float64
+	MaximumPredictionMinutes   int
+	LimitEarlyDepartureSeconds int
+	//RouteTypeLimitEarlyDepartureSeconds overrides LimitEarlyDepartureSeconds by GTFS route_type, as route_type:seconds
+	RouteTypeLimitEarlyDepartureSeconds []string
+	//RouteLimitEarlyDepartureSeconds overrides both limits above for routes, as route_id:seconds
+	RouteLimitEarlyDepartureSeconds []string
+	//NonTimepointEarlyDeparture, NonTimepointEarlyDepartureSeconds and RouteNonTimepointEarlyDeparture limit
+	//early departures from stops that aren't timepoints as in Conf
+	NonTimepointEarlyDeparture        string
+	NonTimepointEarlyDepartureSeconds int
+	RouteNonTimepointEarlyDeparture   []string
+	TimepointOnlyRouteIds             []string
+}
+
+// SimulatePrediction loads the trip in conf scheduled near conf.At from the DataSet active at that time and runs it
+// through the same prediction steps as a TripDeviation received from gtfs-monitor, returning the TripUpdate that
+// would be published. Nothing is published or recorded
+func SimulatePrediction(ctx context.Context,
+	log *logger.Logger,
+	db *sqlx.DB,
+	conf SimulationConf) (*gtfs.TripUpdate, error) {
+	dataSet, err := gtfs.GetDataSetAt(ctx, db, conf.At)
+	if err != nil {
+		return nil, err
+	}
+	tripInstance, err := gtfs.GetTripInstance(ctx, db, dataSet.Id, conf.TripId, conf.At, 60*60*8, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = gtfs.ValidateTripTopology(tripInstance)
+	if err != nil {
+		return nil, err
+	}
+	return simulateTripUpdate(log, tripInstance, conf)
+}
+
+// simulateTripUpdate predicts tripInstance from the mock TripDeviation described by conf and builds its TripUpdate
+func simulateTripUpdate(log *logger.Logger,
+	tripInstance *gtfs.TripInstance,
+	conf SimulationConf) (*gtfs.TripUpdate, error) {
+	earlyDepartures, err := makeEarlyDepartureLimits(conf.LimitEarlyDepartureSeconds,
+		conf.RouteTypeLimitEarlyDepartureSeconds, conf.RouteLimitEarlyDepartureSeconds, conf.NonTimepointEarlyDeparture,
+		conf.NonTimepointEarlyDepartureSeconds, conf.RouteNonTimepointEarlyDeparture)
+	if err != nil {
+		return nil, err
+	}
+	layovers, err := makeLayoverPolicy(0, nil)
+	if err != nil {
+		return nil, err
+	}
+	useStubModels := conf.StubModelFactor > 0
+	var modelsByName map[string]*mlmodels.MLModel
+	if useStubModels {
+		modelsByName = makeStubModels(tripInstance, conf.At)
+	}
+	factory := makeSegmentPredictionFactory(modelsByName,
+		makeObservedStopTransitions(0, 0, 0),
+		0,
+		0,
+		useStubModels,
+		false,
+		conf.TimepointOnlyRouteIds,
+		nil,
+		false,
+		nil)
+	predictor := makeTripPredictor(tripInstance, factory, conf.MaximumPredictionMinutes)
+
+	deviation := makeSimulatedTripDeviation(tripInstance, conf.At, conf.DelaySeconds)
+	prediction, inferenceRequests := predictor.predict(deviation)
+	for _, request := range inferenceRequests {
+		response := float64(request.Features.scheduledSeconds) * conf.StubModelFactor
+		err = prediction.applyInferenceResponse(request.segmentPredictor, response)
+		if err != nil {
+			return nil, err
+		}
+	}
+	tripUpdates := makeTripUpdates(log, []*tripPrediction{prediction}, earlyDepartures, nil, layovers, nil, conf.At)
+	if len(tripUpdates) == 0 {
+		return nil, fmt.Errorf("no TripUpdate built for trip %s", tripInstance.TripId)
+	}
+	return tripUpdates[0], nil
+}
+
+// makeStubModels builds a trained model for each pair of stops on tripInstance, so every segment is sent an
+// inference request
+func makeStubModels(tripInstance *gtfs.TripInstance, trainedAt time.Time) map[string]*mlmodels.MLModel {
+	results := make(map[string]*mlmodels.MLModel)
+	for i := 1; i < len(tripInstance.StopTimeInstances); i++ {
+		name := mlmodels.GetModelNameForStopTimeInstances(tripInstance.StopTimeInstances[i-1 : i+1])
+		results[name] = &mlmodels.MLModel{
+			MLModelId:        int64(i),
+			ModelName:        name,
+			TrainedTimestamp: &trainedAt,
+			AvgRMSE:          1,
+		}
+	}
+	return results
+}
+
+// makeSimulatedTripDeviation builds a TripDeviation for a vehicle on tripInstance at "at" running delaySeconds behind
+// schedule, positioned where the schedule has the vehicle delaySeconds before "at"
+func makeSimulatedTripDeviation(tripInstance *gtfs.TripInstance, at time.Time, delaySeconds int) *gtfs.TripDeviation {
+	schedulePosition := at.Add(time.Duration(-delaySeconds) * time.Second)
+	tripProgress, atStop := scheduledTripProgress(tripInstance, schedulePosition)
+	return &gtfs.TripDeviation{
+		CreatedAt:          at,
+		DeviationTimestamp: at,
+		TripProgress:       tripProgress,
+		DataSetId:          tripInstance.DataSetId,
+		TripId:             tripInstance.TripId,
+		VehicleId:          "simulated",
+		AtStop:             atStop,
+		Delay:              delaySeconds,
+		RouteId:            tripInstance.RouteId,
+		ServiceDate:        tripInstance.ServiceDate(),
+		ServiceException:   tripInstance.ServiceException,
+	}
+}
+
+// scheduledTripProgress returns the distance along tripInstance its schedule places a vehicle at schedulePosition,
+// and true if the vehicle is scheduled to be at a stop. Distances between stops are interpolated from the departure
+// and arrival times, before the trip starts the vehicle is at the first stop and after it ends at the last
+func scheduledTripProgress(tripInstance *gtfs.TripInstance, schedulePosition time.Time) (float64, bool) {
+	stops := tripInstance.StopTimeInstances
+	if len(stops) == 0 {
+		return 0, false
+	}
+	for i, stop := range stops {
+		if !schedulePosition.After(stop.DepartureDateTime) {
+			if i == 0 || !schedulePosition.Before(stop.ArrivalDateTime) {
+				return stop.ShapeDistTraveled, true
+			}
+			previous := stops[i-1]
+			travel := stop.ArrivalDateTime.Sub(previous.DepartureDateTime).Seconds()
+			if travel <= 0 {
+				return stop.ShapeDistTraveled, true
+			}
+			traveled := schedulePosition.Sub(previous.DepartureDateTime).Seconds() / travel
+			return previous.ShapeDistTraveled + traveled*(stop.ShapeDistTraveled-previous.ShapeDistTraveled), false
+		}
+	}
+	return stops[len(stops)-1].ShapeDistTraveled, true
+}
@@ -0,0 +1,98 @@
+package predictor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"io"
+	logger "log"
+	"testing"
+	"time"
+)
+
+func Test_scheduledTripProgress(t *testing.T) {
+	location, _ := time.LoadLocation("America/Los_Angeles")
+	trip := getTestTrip(time.Date(2022, 5, 22, 0, 0, 0, 0, location), "trip_instance_1.json", t)
+	tests := []struct {
+		name         string
+		at           time.Time
+		wantProgress float64
+		wantAtStop   bool
+	}{
+		{
+			name:       "before trip starts",
+			at:         time.Date(2022, 5, 22, 11, 0, 0, 0, location),
+			wantAtStop: true,
+		},
+		{
+			name:         "between stops",
+			at:           time.Date(2022, 5, 22, 12, 10, 0, 0, location),
+			wantProgress: 500,
+		},
+		{
+			name:         "at stop",
+			at:           time.Date(2022, 5, 22, 12, 20, 0, 0, location),
+			wantProgress: 1000,
+			wantAtStop:   true,
+		},
+		{
+			name:         "after trip ends",
+			at:           time.Date(2022, 5, 22, 15, 0, 0, 0, location),
+			wantProgress: 6000,
+			wantAtStop:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress, atStop := scheduledTripProgress(trip, tt.at)
+			if progress != tt.wantProgress || atStop != tt.wantAtStop {
+				t.Errorf("scheduledTripProgress() = %v, %v, want %v, %v", progress, atStop, tt.wantProgress,
+					tt.wantAtStop)
+			}
+		})
+	}
+}
+
+func Test_simulateTripUpdate(t *testing.T) {
+	location, _ := time.LoadLocation("America/Los_Angeles")
+	log := logger.New(io.Discard, "", 0)
+	at := time.Date(2022, 5, 22, 12, 30, 0, 0, location)
+	tests := []struct {
+		name            string
+		stubModelFactor float64
+		wantSource      gtfs.PredictionSource
+		wantLastDelay   int
+	}{
+		{
+			name:          "schedule",
+			wantSource:    gtfs.SchedulePrediction,
+			wantLastDelay: 600,
+		},
+		{
+			name:            "stub model",
+			stubModelFactor: 1.5,
+			wantSource:      gtfs.StopMLPrediction,
+			wantLastDelay:   600 + 4900/2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trip := getTestTrip(time.Date(2022, 5, 22, 0, 0, 0, 0, location), "trip_instance_1.json", t)
+			tripUpdate, err := simulateTripUpdate(log, trip, SimulationConf{
+				TripId:                   trip.TripId,
+				At:                       at,
+				DelaySeconds:             600,
+				StubModelFactor:          tt.stubModelFactor,
+				MaximumPredictionMinutes: 180,
+			})
+			if err != nil {
+				t.Fatalf("simulateTripUpdate() error = %v", err)
+			}
+			last := tripUpdate.StopTimeUpdates[len(tripUpdate.StopTimeUpdates)-1]
+			if last.StopSequence != 7 || last.PredictionSource != tt.wantSource {
+				t.Errorf("last StopTimeUpdate = %+v, want stop_sequence 7 predicted by %v", last, tt.wantSource)
+			}
+			if last.ArrivalDelay != tt.wantLastDelay {
+				t.Errorf("last StopTimeUpdate ArrivalDelay = %d, want %d", last.ArrivalDelay, tt.wantLastDelay)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package predictor
+
+import (
+	"context"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/jmoiron/sqlx"
+	logger "log"
+	"sync"
+	"time"
+)
+
+// stopDwellLoadEvery is how often stop dwells are reloaded, picking up dwells computed by model-mgr tuneDwell
+const stopDwellLoadEvery = time.Hour
+
+// stopDwells holds the average dwell at stops, predicting vehicles depart those stops after their predicted arrival.
+// Stops with an average dwell shorter than minimumDwell are left with their dwell embedded in travel times
+type stopDwells struct {
+	mu           sync.RWMutex
+	minimumDwell time.Duration
+	dwells       map[string]time.Duration
+}
+
+// makeStopDwells builds empty stopDwells predicting departures from stops with an average dwell of at least
+// minimumDwellSeconds
+func makeStopDwells(minimumDwellSeconds int) *stopDwells {
+	return &stopDwells{
+		minimumDwell: time.Duration(minimumDwellSeconds) * time.Second,
+		dwells:       make(map[string]time.Duration),
+	}
+}
+
+// replace swaps the dwells held with dwells
+func (d *stopDwells) replace(dwells []gtfs.StopDwell) {
+	loaded := make(map[string]time.Duration)
+	for _, dwell := range dwells {
+		duration := time.Duration(dwell.DwellSeconds) * time.Second
+		if duration > 0 && duration >= d.minimumDwell {
+			loaded[dwell.StopId] = duration
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dwells = loaded
+}
+
+// dwell returns the average dwell at stopId, and false when the stop's departures aren't predicted
+func (d *stopDwells) dwell(stopId string) (time.Duration, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	dwell, present := d.dwells[stopId]
+	return dwell, present
+}
+
+// predictDeparture sets stopUpdate's departure to its predicted arrival at stopTime plus the stop's dwell, no earlier
+// than earlyDeparture allows. stopUpdate is left without a departure when d is nil or the stop has no dwell
+func (d *stopDwells) predictDeparture(stopUpdate *gtfs.StopTimeUpdate,
+	stopTime *gtfs.StopTimeInstance,
+	earlyDeparture earlyDepartureLimit) {
+	if d == nil {
+		return
+	}
+	dwell, present := d.dwell(stopTime.StopId)
+	if !present {
+		return
+	}
+	departureTime := stopUpdate.PredictedArrivalTime.Add(dwell)
+	if limitSeconds, limited := earlyDeparture.seconds(stopTime); limited {
+		departureTime = laterOfDates(departureTime,
+			stopTime.DepartureDateTime.Add(time.Duration(-limitSeconds)*time.Second))
+	}
+	scheduledDepartureTime := stopTime.DepartureDateTime
+	departureDelay := int(departureTime.Sub(scheduledDepartureTime).Seconds())
+	stopUpdate.ScheduledDepartureTime = &scheduledDepartureTime
+	stopUpdate.PredictedDepartureTime = &departureTime
+	stopUpdate.DepartureDelay = &departureDelay
+}
+
+// loadStopDwells replaces the dwells held in dwells with those in the stop_dwell table
+func loadStopDwells(ctx context.Context,
+	log *logger.Logger,
+	db *sqlx.DB,
+	dwells *stopDwells,
+	queryTimeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	loaded, err := gtfs.GetStopDwells(ctx, db)
+	if err != nil {
+		return err
+	}
+	dwells.replace(loaded)
+	log.Printf("loaded average dwells for %d stops\n", len(loaded))
+	return nil
+}
+
+// runStopDwellLoader loads dwells every stopDwellLoadEvery until shutdownSignal is received.
+// Departures are not predicted until dwells are loaded
+func runStopDwellLoader(ctx context.Context,
+	log *logger.Logger,
+	wg *sync.WaitGroup,
+	db *sqlx.DB,
+	dwells *stopDwells,
+	queryTimeout time.Duration,
+	shutdownSignal chan bool) {
+	wg.Add(1)
+	defer wg.Done()
+
+	sleepChan := make(chan bool)
+	sleep := time.Duration(0) //sleep for zero seconds the first time
+
+	for {
+
+		go func() {
+			time.Sleep(sleep)
+			sleepChan <- true
+		}()
+
+		select {
+		case <-shutdownSignal:
+			log.Printf("Exiting stop dwell loader on shutdown signal")
+			return
+		case <-sleepChan:
+		}
+
+		sleep = stopDwellLoadEvery
+		err := loadStopDwells(ctx, log, db, dwells, queryTimeout)
+		if err != nil {
+			log.Printf("error loading stop dwells, keeping current dwells. error:%v\n", err)
+		}
+	}
+}
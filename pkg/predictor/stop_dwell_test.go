@@ -0,0 +1,71 @@
+package predictor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"testing"
+	"time"
+)
+
+func Test_stopDwells_dwell(t *testing.T) {
+	dwells := makeStopDwells(15)
+	dwells.replace([]gtfs.StopDwell{
+		{StopId: "A", DwellSeconds: 45},
+		{StopId: "B", DwellSeconds: 15},
+		{StopId: "C", DwellSeconds: 10},
+		{StopId: "D", DwellSeconds: 0},
+	})
+	tests := []struct {
+		name        string
+		stopId      string
+		wantDwell   time.Duration
+		wantPresent bool
+	}{
+		{
+			name:        "Stop with a long dwell",
+			stopId:      "A",
+			wantDwell:   45 * time.Second,
+			wantPresent: true,
+		},
+		{
+			name:        "Stop dwelling the minimum",
+			stopId:      "B",
+			wantDwell:   15 * time.Second,
+			wantPresent: true,
+		},
+		{
+			name:        "Stop dwelling less than the minimum",
+			stopId:      "C",
+			wantPresent: false,
+		},
+		{
+			name:        "Stop without dwell",
+			stopId:      "D",
+			wantPresent: false,
+		},
+		{
+			name:        "Unknown stop",
+			stopId:      "E",
+			wantPresent: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotDwell, gotPresent := dwells.dwell(tt.stopId)
+			if gotDwell != tt.wantDwell || gotPresent != tt.wantPresent {
+				t.Errorf("dwell() = %v, %v, want %v, %v", gotDwell, gotPresent, tt.wantDwell, tt.wantPresent)
+			}
+		})
+	}
+}
+
+func Test_stopDwells_replace(t *testing.T) {
+	dwells := makeStopDwells(0)
+	dwells.replace([]gtfs.StopDwell{{StopId: "A", DwellSeconds: 45}})
+	dwells.replace([]gtfs.StopDwell{{StopId: "B", DwellSeconds: 20}})
+	if _, present := dwells.dwell("A"); present {
+		t.Errorf("replace() kept dwell of stop A")
+	}
+	if dwell, present := dwells.dwell("B"); !present || dwell != 20*time.Second {
+		t.Errorf("replace() dwell of stop B = %v, %v, want 20s, true", dwell, present)
+	}
+}
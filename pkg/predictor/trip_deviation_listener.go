@@ -1,9 +1,11 @@
-package aggregator
+package predictor
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/foundation/clock"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
 	"github.com/nats-io/nats.go"
 	logger "log"
 	"os"
@@ -11,50 +13,66 @@ import (
 	"time"
 )
 
-// startTripUpdateListener listens on NATS for vehicle-monitor-results (expecting gtfs.VehicleMonitorResults)
+// startTripUpdateListener listens on NATS subject, the tenant's vehicle-monitor-results, for gtfs.VehicleMonitorResults
 // these are used to generate predictions for the vehicles trips
 // uses the NATS queue "prediction-generator", so more than one gtfs-aggregator process can generate predictions
-func startTripUpdateListener(
+// the subscription is checked for lag with lagMonitor, when shedLoad is true only the newest results for a vehicle are
+// processed once its results being processed are finished
+func startTripUpdateListener(ctx context.Context,
 	log *logger.Logger,
 	wg *sync.WaitGroup,
 	osts *observedStopTransitions,
 	natsConn *nats.Conn,
+	subject string,
 	shutdownSignal chan bool,
 	tripPredictorsCollection *tripPredictorsCollection,
 	pendingPredictions *pendingPredictionsCollection,
 	predictionPublisher *predictionPublisher,
 	includedRoutes []string,
-	inferenceBuckets int,
-	maximumPredictionMinutes int) {
+	inferenceRequester inferenceRequester,
+	maximumPredictionMinutes int,
+	vehicleDeviations *vehicleDeviationTracker,
+	lagMonitor *consumerLagMonitor,
+	shedLoad bool,
+	clk clock.Clock) {
 	wg.Add(1)
 	defer wg.Done()
 
 	processor := makeTripUpdateProcessor(log,
-		natsConn,
+		inferenceRequester,
 		predictionPublisher,
 		osts,
 		tripPredictorsCollection,
 		pendingPredictions,
-		inferenceBuckets,
 		includedRoutes,
-		maximumPredictionMinutes)
+		maximumPredictionMinutes,
+		vehicleDeviations,
+		clk)
+	processor.consumerLag = lagMonitor.tracker
+	if shedLoad {
+		processor.latestResults = makeLatestVehicleResults()
+	}
 
 	ch := make(chan *nats.Msg, 64)
-	log.Printf("Subscribing to vehicle-monitor-results in queue group prediction-generator on nats: %v\n",
+	log.Printf("Subscribing to %s in queue group prediction-generator on nats: %v\n", subject,
 		natsConn.Servers())
-	sub, err := natsConn.ChanQueueSubscribe("vehicle-monitor-results", "prediction-generator", ch)
+	sub, err := natsConn.ChanQueueSubscribe(subject, "prediction-generator", ch)
 	if err != nil {
 		log.Printf("Unable to establish subscription to nats server: %v\n", err)
 		os.Exit(1)
 	}
 
 	predictionWG := sync.WaitGroup{}
+	lagTicker := time.NewTicker(consumerLagCheckInterval)
+	defer lagTicker.Stop()
 
 	for {
 		select {
 		case msg := <-ch:
-			go processor.initializePredictionFromMsg(msg, &predictionWG)
+			go processor.initializePredictionFromMsg(ctx, msg, &predictionWG)
 			break
+		case now := <-lagTicker.C:
+			lagMonitor.check(log, now, sub, len(ch))
 		case <-shutdownSignal:
 			log.Printf("ending TripUpdate listener on shutdown signal\n")
 			unsubscribe(log, sub, "TripUpdate: vehicle-monitor-results")
@@ -83,29 +101,31 @@ func unsubscribe(log *logger.Logger, sub *nats.Subscription, subName string) {
 
 // inferenceRequester receives inference requests to send to the inference layer, or implementation for testing
 type inferenceRequester interface {
-	sendInferenceRequests(batch *predictionBatch)
+	sendInferenceRequests(requests []*InferenceRequest)
 }
 
-// natsInferenceRequester sends inference requests over nats
+// natsInferenceRequester sends inference requests over nats encoded by codec on the tenant's subjects
 type natsInferenceRequester struct {
 	log              *logger.Logger
 	natsConn         *nats.Conn
+	codec            natsclient.Codec
+	subjects         natsclient.Subjects
 	inferenceBuckets int
+	clock            clock.Clock
 }
 
-// sendInferenceRequests sends InferenceRequests via NATS to 'inference-request' subject
-func (n *natsInferenceRequester) sendInferenceRequests(batch *predictionBatch) {
-	requests := batch.allInferenceRequests()
-	timestamp := time.Now().Unix()
+// sendInferenceRequests sends InferenceRequests via NATS to the tenant's 'inference-request' subjects
+func (n *natsInferenceRequester) sendInferenceRequests(requests []*InferenceRequest) {
+	timestamp := n.clock.Now().Unix()
 	for _, request := range requests {
-		jsonData, err := request.jsonRequest(timestamp)
+		data, err := n.codec.Marshal(request.message(timestamp))
 		if err != nil {
 			n.log.Printf("Error marshalling inferenceRequest: %v, error:%v", request, err)
 			return
 		}
 		bucket := request.MLModelId % int64(n.inferenceBuckets)
-		subject := fmt.Sprintf("inference-request.%d", bucket)
-		err = n.natsConn.Publish(subject, jsonData)
+		subject := n.subjects.Subject(fmt.Sprintf("inference-request.%d", bucket))
+		err = n.natsConn.Publish(subject, data)
 		if err != nil {
 			n.log.Printf("Error sending inferenceRequest: %v, error:%v", request, err)
 			return
@@ -123,51 +143,71 @@ type tripUpdateProcessor struct {
 	pendingPredictions       *pendingPredictionsCollection
 	includedRoutes           []string
 	maximumPredictionMinutes int
+	vehicleDeviations        *vehicleDeviationTracker
+	clock                    clock.Clock
+	// consumerLag measures the lag of each vehicle-monitor-results processed, when not nil
+	consumerLag *consumerLagTracker
+	// latestResults sheds older results for vehicles whose results are being processed, when not nil
+	latestResults *latestVehicleResults
 }
 
 // makeTripUpdateProcessor builds tripUpdateProcessor
 func makeTripUpdateProcessor(log *logger.Logger,
-	natsConn *nats.Conn,
+	inferenceRequester inferenceRequester,
 	predictionPublisher *predictionPublisher,
 	osts *observedStopTransitions,
 	tripPredictorsCollection *tripPredictorsCollection,
 	pendingPredictions *pendingPredictionsCollection,
-	inferenceBuckets int,
 	includedRoutes []string,
-	maximumPredictionMinutes int) *tripUpdateProcessor {
+	maximumPredictionMinutes int,
+	vehicleDeviations *vehicleDeviationTracker,
+	clk clock.Clock) *tripUpdateProcessor {
 	return &tripUpdateProcessor{
-		log: log,
-		inferenceRequester: &natsInferenceRequester{
-			natsConn:         natsConn,
-			inferenceBuckets: inferenceBuckets},
+		log:                      log,
+		inferenceRequester:       inferenceRequester,
 		predictionPublisher:      predictionPublisher,
 		osts:                     osts,
 		tripPredictorsCollection: tripPredictorsCollection,
 		pendingPredictions:       pendingPredictions,
 		includedRoutes:           includedRoutes,
 		maximumPredictionMinutes: maximumPredictionMinutes,
+		vehicleDeviations:        vehicleDeviations,
+		clock:                    clk,
 	}
 }
 
 // initializePredictionFromMsg unmarshal gtfs.VehicleMonitorResults and create predictions from gtfs.TripDeviation
-func (t *tripUpdateProcessor) initializePredictionFromMsg(msg *nats.Msg, wg *sync.WaitGroup) {
+func (t *tripUpdateProcessor) initializePredictionFromMsg(ctx context.Context, msg *nats.Msg, wg *sync.WaitGroup) {
 	wg.Add(1)
 	defer wg.Done()
 
 	var vehicleMonitorResults gtfs.VehicleMonitorResults
-	err := json.Unmarshal(msg.Data, &vehicleMonitorResults)
+	err := natsclient.Unmarshal(msg.Data, &vehicleMonitorResults)
 	if err != nil {
 		t.log.Printf("error parsing VehicleMonitorResults: %v, payload:%s", err, string(msg.Data))
 		return
 	}
 
-	t.createPredictionBatch(&vehicleMonitorResults)
-
+	if t.latestResults == nil {
+		t.consumerLag.record(t.clock.Now(), &vehicleMonitorResults)
+		t.createPredictionBatch(ctx, &vehicleMonitorResults)
+		return
+	}
+	if !t.latestResults.begin(&vehicleMonitorResults) {
+		return
+	}
+	for results := &vehicleMonitorResults; results != nil; results = t.latestResults.finish(results.VehicleId) {
+		t.consumerLag.record(t.clock.Now(), results)
+		t.createPredictionBatch(ctx, results)
+	}
 }
 
 // createPredictionBatch creates a batch of predictions from vehicleMonitorResults and handles the results
-func (t *tripUpdateProcessor) createPredictionBatch(vehicleMonitorResults *gtfs.VehicleMonitorResults) {
-	batch := t.predictionsForVehicleMonitorResults(vehicleMonitorResults)
+func (t *tripUpdateProcessor) createPredictionBatch(ctx context.Context,
+	vehicleMonitorResults *gtfs.VehicleMonitorResults) {
+	stage := startPipelineStage(ctx, stageInferenceBatching)
+	batch := t.predictionsForVehicleMonitorResults(ctx, vehicleMonitorResults)
+	stage.end()
 	if batch == nil {
 		return
 	}
@@ -176,24 +216,35 @@ func (t *tripUpdateProcessor) createPredictionBatch(vehicleMonitorResults *gtfs.
 
 // predictionsForVehicleMonitorResults creates prediction requests from gtfs.VehicleMonitorResults and returns
 // predictionBatch if successful
-func (t *tripUpdateProcessor) predictionsForVehicleMonitorResults(
+func (t *tripUpdateProcessor) predictionsForVehicleMonitorResults(ctx context.Context,
 	vehicleMonitorResults *gtfs.VehicleMonitorResults) *predictionBatch {
 
 	//first assign the OSTs to vehicleMonitorResults
 	for _, ost := range vehicleMonitorResults.ObservedStopTimes {
 		t.osts.newOST(ost)
 	}
-	batch := makePredictionBatch(time.Now(), vehicleMonitorResults.VehicleId)
-	for _, deviation := range vehicleMonitorResults.TripDeviations {
-		if !t.shouldPredictTripDeviation(deviation) {
-			continue
+	t.vehicleDeviations.record(t.clock.Now(), vehicleMonitorResults.TripDeviations)
+	err := t.tripPredictorsCollection.loadTripPredictors(ctx, vehicleMonitorResults.TripDeviations)
+	if err != nil {
+		t.log.Printf("Error loading trip predictors for vehicle %s, error:%v", vehicleMonitorResults.VehicleId, err)
+	}
+	batch := makePredictionBatch(t.clock.Now(), vehicleMonitorResults.VehicleId)
+	//trips on the block before the last included trip are predicted even when their route is not included,
+	//so delays carry through interlined trips on other routes
+	lastIncluded := -1
+	for i, deviation := range vehicleMonitorResults.TripDeviations {
+		if t.shouldPredictTripDeviation(deviation) {
+			lastIncluded = i
 		}
-		tp, inferenceRequests, err := t.startPredictionForTripDeviation(deviation)
+	}
+	for _, deviation := range vehicleMonitorResults.TripDeviations[:lastIncluded+1] {
+		tp, inferenceRequests, err := t.startPredictionForTripDeviation(ctx, deviation)
 		if err != nil {
 			t.log.Printf("Error generating pendingTripPrediction tripId %s, error:%v", deviation.TripId, err)
 			return nil
 		}
 		if tp != nil {
+			tp.propagationOnly = !t.shouldPredictTripDeviation(deviation)
 			batch.addPendingTripPrediction(tp, inferenceRequests)
 		}
 	}
@@ -218,10 +269,10 @@ func (t *tripUpdateProcessor) shouldPredictTripDeviation(deviation *gtfs.TripDev
 // startPredictionForTripDeviation creates tripPrediction returning it and any InferenceRequests to be made to complete
 // the tripPrediction
 // returns nil, nil, nil if no prediction should be started on this trip yet
-func (t *tripUpdateProcessor) startPredictionForTripDeviation(
+func (t *tripUpdateProcessor) startPredictionForTripDeviation(ctx context.Context,
 	deviation *gtfs.TripDeviation) (*tripPrediction, []*InferenceRequest, error) {
 
-	predictor, err := t.tripPredictorsCollection.retrieveTripPredictor(deviation)
+	predictor, err := t.tripPredictorsCollection.retrieveTripPredictor(ctx, deviation)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -235,12 +286,16 @@ func (t *tripUpdateProcessor) startPredictionForTripDeviation(
 
 // handlePredictionBatch takes a predictionBatch, if complete uses predictionPublisher to publish the results,
 // if not complete (there are inference requests that need to be made) adds predictionBatch to pendingPredictions
-// and sends all InferenceRequests from the predictionBatch
+// and sends all InferenceRequests from the predictionBatch, unless it is held behind a batch for the same trip
 func (t *tripUpdateProcessor) handlePredictionBatch(batch *predictionBatch) {
 	if batch.predictionsRemaining() == 0 {
 		t.predictionPublisher.publishPredictionBatch(batch)
 		return
 	}
-	t.pendingPredictions.addPendingPredictionBatch(time.Now(), batch)
-	t.inferenceRequester.sendInferenceRequests(batch)
+	if !t.pendingPredictions.addPendingPredictionBatch(t.clock.Now(), batch) {
+		return
+	}
+	stage := startPipelineStage(context.Background(), stageInferenceRequests)
+	t.inferenceRequester.sendInferenceRequests(batch.allInferenceRequests())
+	stage.end()
 }
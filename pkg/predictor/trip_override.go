@@ -0,0 +1,220 @@
+package predictor
+
+import (
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/foundation/clock"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
+	"github.com/nats-io/nats.go"
+	logger "log"
+	"sync"
+	"time"
+)
+
+// TripOverride actions
+const (
+	// TripOverrideCancel publishes the trip as canceled
+	TripOverrideCancel = "cancel"
+	// TripOverrideHold predicts the trip departs StopSequence no earlier than HoldUntil
+	TripOverrideHold = "hold"
+	// TripOverrideClear removes any override on the trip
+	TripOverrideClear = "clear"
+)
+
+// TripOverride is a manual instruction from dispatch applied to a trip's TripUpdates until ExpiresAt
+type TripOverride struct {
+	TripId string `json:"trip_id"`
+	// Action is TripOverrideCancel, TripOverrideHold or TripOverrideClear
+	Action string `json:"action"`
+	// StopSequence is the stop the trip is held at
+	StopSequence uint32 `json:"stop_sequence"`
+	// HoldUntil is the earliest time the trip departs StopSequence
+	HoldUntil time.Time `json:"hold_until"`
+	// ExpiresAt is when the override is no longer applied. When zero a hold expires at HoldUntil and a cancellation
+	// after the aggregator's default override expiration
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// validate returns an error if the TripOverride is missing fields required by its action
+func (o *TripOverride) validate() error {
+	if o.TripId == "" {
+		return fmt.Errorf("trip override is missing trip_id")
+	}
+	switch o.Action {
+	case TripOverrideCancel, TripOverrideClear:
+		return nil
+	case TripOverrideHold:
+		if o.StopSequence == 0 || o.HoldUntil.IsZero() {
+			return fmt.Errorf("hold override on trip %s requires stop_sequence and hold_until", o.TripId)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown trip override action %q on trip %s", o.Action, o.TripId)
+}
+
+// tripOverrides holds the current TripOverride of each trip, and applies them to TripUpdates
+type tripOverrides struct {
+	mu                sync.Mutex
+	defaultExpiration time.Duration
+	overrides         map[string]TripOverride
+}
+
+// makeTripOverrides builds tripOverrides, cancellations without an ExpiresAt expire after defaultExpiration
+func makeTripOverrides(defaultExpiration time.Duration) *tripOverrides {
+	return &tripOverrides{
+		defaultExpiration: defaultExpiration,
+		overrides:         make(map[string]TripOverride),
+	}
+}
+
+// set records override received at "now", replacing any previous override on the trip
+func (t *tripOverrides) set(override TripOverride, now time.Time) error {
+	if err := override.validate(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if override.Action == TripOverrideClear {
+		delete(t.overrides, override.TripId)
+		return nil
+	}
+	if override.ExpiresAt.IsZero() {
+		if override.Action == TripOverrideHold {
+			override.ExpiresAt = override.HoldUntil
+		} else {
+			override.ExpiresAt = now.Add(t.defaultExpiration)
+		}
+	}
+	t.overrides[override.TripId] = override
+	return nil
+}
+
+// get returns the override on tripId at "now", removing it once expired
+func (t *tripOverrides) get(tripId string, now time.Time) (TripOverride, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	override, present := t.overrides[tripId]
+	if !present {
+		return override, false
+	}
+	if now.After(override.ExpiresAt) {
+		delete(t.overrides, tripId)
+		return override, false
+	}
+	return override, true
+}
+
+// apply modifies tripUpdate according to the override on its trip at "now". A canceled trip has no StopTimeUpdates,
+// a held trip's predictions from the held stop onward are delayed until the stop's departure is no earlier than
+// HoldUntil. Nil tripOverrides apply no overrides
+func (t *tripOverrides) apply(tripUpdate *gtfs.TripUpdate, now time.Time) {
+	if t == nil {
+		return
+	}
+	override, present := t.get(tripUpdate.TripId, now)
+	if !present {
+		return
+	}
+	switch override.Action {
+	case TripOverrideCancel:
+		tripUpdate.ScheduleRelationship = "CANCELED"
+		tripUpdate.StopTimeUpdates = nil
+	case TripOverrideHold:
+		holdTripUpdate(tripUpdate, override.StopSequence, override.HoldUntil)
+	}
+}
+
+// holdTripUpdate delays the departure of stopSequence in tripUpdate to holdUntil if predicted to depart earlier,
+// delaying the stops after it by the same amount
+func holdTripUpdate(tripUpdate *gtfs.TripUpdate, stopSequence uint32, holdUntil time.Time) {
+	for i := range tripUpdate.StopTimeUpdates {
+		stopUpdate := &tripUpdate.StopTimeUpdates[i]
+		if stopUpdate.StopSequence != stopSequence {
+			continue
+		}
+		shift := holdUntil.Sub(stopUpdate.LatestPredictedTime())
+		if shift <= 0 {
+			return
+		}
+		scheduledDeparture := stopUpdate.ScheduledArrivalTime
+		if stopUpdate.ScheduledDepartureTime != nil {
+			scheduledDeparture = *stopUpdate.ScheduledDepartureTime
+		}
+		departureTime := holdUntil
+		departureDelay := int(departureTime.Sub(scheduledDeparture).Seconds())
+		stopUpdate.ScheduledDepartureTime = &scheduledDeparture
+		stopUpdate.PredictedDepartureTime = &departureTime
+		stopUpdate.DepartureDelay = &departureDelay
+		for j := i + 1; j < len(tripUpdate.StopTimeUpdates); j++ {
+			shiftStopUpdate(&tripUpdate.StopTimeUpdates[j], shift)
+		}
+		return
+	}
+}
+
+// shiftStopUpdate moves the predicted times of stopUpdate later by shift
+func shiftStopUpdate(stopUpdate *gtfs.StopTimeUpdate, shift time.Duration) {
+	stopUpdate.PredictedArrivalTime = stopUpdate.PredictedArrivalTime.Add(shift)
+	stopUpdate.ArrivalDelay += int(shift.Seconds())
+	if stopUpdate.PredictedDepartureTime != nil {
+		departureTime := stopUpdate.PredictedDepartureTime.Add(shift)
+		stopUpdate.PredictedDepartureTime = &departureTime
+	}
+	if stopUpdate.DepartureDelay != nil {
+		departureDelay := *stopUpdate.DepartureDelay + int(shift.Seconds())
+		stopUpdate.DepartureDelay = &departureDelay
+	}
+}
+
+// startTripOverrideListener records TripOverrides received on subject in overrides until shutdownSignal.
+// Messages with a reply subject are answered with "ok" or the reason the override was rejected
+func startTripOverrideListener(log *logger.Logger,
+	wg *sync.WaitGroup,
+	natsConn *nats.Conn,
+	subject string,
+	overrides *tripOverrides,
+	clk clock.Clock,
+	shutdownSignal chan bool) {
+	wg.Add(1)
+	defer wg.Done()
+
+	ch := make(chan *nats.Msg, 64)
+	log.Printf("Subscribing to %s on nats: %v\n", subject, natsConn.Servers())
+	sub, err := natsConn.ChanSubscribe(subject, ch)
+	if err != nil {
+		log.Printf("Unable to establish subscription to %s, trip overrides are disabled: %v\n", subject, err)
+		return
+	}
+	defer unsubscribe(log, sub, subject)
+
+	for {
+		select {
+		case msg := <-ch:
+			applyTripOverrideFromMsg(log, msg, overrides, clk.Now())
+		case <-shutdownSignal:
+			log.Printf("exiting trip override listener on shutdown signal\n")
+			return
+		}
+	}
+}
+
+// applyTripOverrideFromMsg unmarshal TripOverride from nats message and records it in overrides
+func applyTripOverrideFromMsg(log *logger.Logger, msg *nats.Msg, overrides *tripOverrides, now time.Time) {
+	var override TripOverride
+	err := natsclient.Unmarshal(msg.Data, &override)
+	if err == nil {
+		err = overrides.set(override, now)
+	}
+	reply := "ok"
+	if err != nil {
+		log.Printf("rejected trip override: %v, payload:%s", err, string(msg.Data))
+		reply = err.Error()
+	} else {
+		log.Printf("applying %s override to trip %s", override.Action, override.TripId)
+	}
+	if msg.Reply != "" {
+		if err = msg.Respond([]byte(reply)); err != nil {
+			log.Printf("unable to reply to trip override: %v", err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package predictor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"testing"
+	"time"
+)
+
+// makeOverrideTestTripUpdate builds a TripUpdate for trip "1" arriving at stop sequences 1, 2 and 3 a minute apart
+// from start, on schedule
+func makeOverrideTestTripUpdate(start time.Time) *gtfs.TripUpdate {
+	tripUpdate := &gtfs.TripUpdate{TripId: "1", ScheduleRelationship: "SCHEDULED"}
+	for i := 0; i < 3; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		tripUpdate.StopTimeUpdates = append(tripUpdate.StopTimeUpdates, gtfs.StopTimeUpdate{
+			StopSequence:         uint32(i + 1),
+			ScheduledArrivalTime: at,
+			PredictedArrivalTime: at,
+		})
+	}
+	return tripUpdate
+}
+
+func Test_tripOverrides_apply_cancel(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	overrides := makeTripOverrides(time.Hour)
+	if err := overrides.set(TripOverride{TripId: "1", Action: TripOverrideCancel}, at); err != nil {
+		t.Fatalf("set() error = %v", err)
+	}
+
+	tripUpdate := makeOverrideTestTripUpdate(at)
+	overrides.apply(tripUpdate, at.Add(59*time.Minute))
+	if tripUpdate.ScheduleRelationship != "CANCELED" || len(tripUpdate.StopTimeUpdates) != 0 {
+		t.Errorf("apply() = %+v, want canceled trip without stop updates", tripUpdate)
+	}
+
+	tripUpdate = makeOverrideTestTripUpdate(at)
+	overrides.apply(tripUpdate, at.Add(61*time.Minute))
+	if tripUpdate.ScheduleRelationship != "SCHEDULED" {
+		t.Errorf("apply() after expiration ScheduleRelationship = %s, want SCHEDULED",
+			tripUpdate.ScheduleRelationship)
+	}
+}
+
+func Test_tripOverrides_apply_hold(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	overrides := makeTripOverrides(time.Hour)
+	holdUntil := at.Add(3 * time.Minute)
+	err := overrides.set(TripOverride{TripId: "1", Action: TripOverrideHold, StopSequence: 2,
+		HoldUntil: holdUntil}, at)
+	if err != nil {
+		t.Fatalf("set() error = %v", err)
+	}
+
+	tripUpdate := makeOverrideTestTripUpdate(at)
+	overrides.apply(tripUpdate, at)
+
+	first := tripUpdate.StopTimeUpdates[0]
+	if !first.PredictedArrivalTime.Equal(at) || first.ArrivalDelay != 0 {
+		t.Errorf("stop before hold changed: %+v", first)
+	}
+	held := tripUpdate.StopTimeUpdates[1]
+	if held.PredictedDepartureTime == nil || !held.PredictedDepartureTime.Equal(holdUntil) {
+		t.Errorf("held stop PredictedDepartureTime = %v, want %v", held.PredictedDepartureTime, holdUntil)
+	}
+	if held.DepartureDelay == nil || *held.DepartureDelay != 120 {
+		t.Errorf("held stop DepartureDelay = %v, want 120", held.DepartureDelay)
+	}
+	last := tripUpdate.StopTimeUpdates[2]
+	if !last.PredictedArrivalTime.Equal(at.Add(4*time.Minute)) || last.ArrivalDelay != 120 {
+		t.Errorf("stop after hold = %+v, want arrival delayed 120 seconds", last)
+	}
+
+	tripUpdate = makeOverrideTestTripUpdate(at)
+	overrides.apply(tripUpdate, holdUntil.Add(time.Second))
+	if tripUpdate.StopTimeUpdates[1].PredictedDepartureTime != nil {
+		t.Errorf("hold applied after hold_until")
+	}
+}
+
+func Test_tripOverrides_set(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	overrides := makeTripOverrides(time.Hour)
+	invalid := []TripOverride{
+		{Action: TripOverrideCancel},
+		{TripId: "1", Action: "delay"},
+		{TripId: "1", Action: TripOverrideHold, StopSequence: 2},
+	}
+	for _, override := range invalid {
+		if err := overrides.set(override, at); err == nil {
+			t.Errorf("set(%+v) expected error", override)
+		}
+	}
+
+	_ = overrides.set(TripOverride{TripId: "1", Action: TripOverrideCancel}, at)
+	if err := overrides.set(TripOverride{TripId: "1", Action: TripOverrideClear}, at); err != nil {
+		t.Fatalf("set() error = %v", err)
+	}
+	if _, present := overrides.get("1", at); present {
+		t.Errorf("override present after clear")
+	}
+}
@@ -1,4 +1,4 @@
-package aggregator
+package predictor
 
 import (
 	"fmt"
@@ -45,6 +45,9 @@ type tripPrediction struct {
 	stopPredictions    []*stopPrediction
 	tripInstance       *gtfs.TripInstance
 	pendingPredictions int
+	//propagationOnly is set when the trip is on a route that is not published, the trip is still predicted so its
+	//run time is carried into the predictions of later trips on the vehicle's block
+	propagationOnly bool
 }
 
 // makeTripPrediction builds tripPrediction
@@ -97,6 +100,22 @@ func (tp *tripPrediction) applyInferenceResponse(predictor *segmentPredictor, in
 	return nil
 }
 
+// applyScheduleFallback completes the stopPredictions of segmentPredictor with the scheduled travel time between its
+// stops, in place of an inference response that can't be used
+func (tp *tripPrediction) applyScheduleFallback(predictor *segmentPredictor) error {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	predictions := predictor.applySegmentTime(float64(predictor.scheduledTime()), gtfs.SchedulePrediction, true,
+		tp.tripDeviation.TripProgress)
+	for _, prediction := range predictions {
+		err := tp.addInferencePrediction(prediction)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // predictionsRemaining returns the number of stopPredictions awaiting inference responses in this tripPrediction
 // if this returns 0 this tripPrediction is finished and can be published
 func (tp *tripPrediction) predictionsRemaining() int {
@@ -104,3 +123,28 @@ func (tp *tripPrediction) predictionsRemaining() int {
 	defer tp.mu.Unlock()
 	return tp.pendingPredictions
 }
+
+// completeWithScheduleFallback completes every stopPrediction still awaiting an inference response with the scheduled
+// travel time between its stops, so a tripPrediction whose InferenceRequests were never answered can be published.
+// returns the number of stopPredictions completed
+func (tp *tripPrediction) completeWithScheduleFallback() int {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	completed := 0
+	for i, sp := range tp.stopPredictions {
+		if sp.predictionComplete {
+			continue
+		}
+		tp.stopPredictions[i] = &stopPrediction{
+			fromStop:              sp.fromStop,
+			toStop:                sp.toStop,
+			predictedTime:         float64(sp.toStop.ArrivalTime - sp.fromStop.ArrivalTime),
+			predictionSource:      gtfs.SchedulePrediction,
+			stopUpdateDisposition: sp.stopUpdateDisposition,
+			predictionComplete:    true,
+		}
+		completed++
+	}
+	tp.pendingPredictions = 0
+	return completed
+}
@@ -1,6 +1,8 @@
-package aggregator
+package predictor
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
 	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
@@ -11,84 +13,171 @@ import (
 
 // tripPredictorsDataProvider provides data needed for trip predictions
 type tripPredictorsDataProvider interface {
-	GetTripInstance(dataSetId int64,
+	GetTripInstance(ctx context.Context,
+		dataSetId int64,
 		tripId string,
 		at time.Time,
 		tripSearchRangeSeconds int) (*gtfs.TripInstance, error)
+	GetTripInstances(ctx context.Context,
+		dataSetId int64,
+		tripIds []string,
+		serviceDate time.Time) (map[string]*gtfs.TripInstance, error)
 	GetCurrentMLModelsByName() (map[string]*mlmodels.MLModel, error)
+	GetShadowMLModelsByName() (map[string]*mlmodels.MLModel, error)
 }
 
 // dbTripPredictorsDataProvider uses a database connection to retrieve data for trip predictions
+// each query is abandoned after queryTimeout, trips are compacted by compactor while they're predicted
 type dbTripPredictorsDataProvider struct {
-	db *sqlx.DB
+	db           *sqlx.DB
+	queryTimeout time.Duration
+	compactor    *gtfs.TripCompactor
 }
 
-func (d *dbTripPredictorsDataProvider) GetTripInstance(dataSetId int64, tripId string, at time.Time, tripSearchRangeSeconds int) (*gtfs.TripInstance, error) {
-	return gtfs.GetTripInstance(d.db, dataSetId, tripId, at, tripSearchRangeSeconds)
+func (d *dbTripPredictorsDataProvider) GetTripInstance(ctx context.Context, dataSetId int64, tripId string, at time.Time, tripSearchRangeSeconds int) (*gtfs.TripInstance, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.queryTimeout)
+	defer cancel()
+	return gtfs.GetTripInstance(ctx, d.db, dataSetId, tripId, at, tripSearchRangeSeconds, d.compactor)
+}
+
+func (d *dbTripPredictorsDataProvider) GetTripInstances(ctx context.Context, dataSetId int64, tripIds []string, serviceDate time.Time) (map[string]*gtfs.TripInstance, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.queryTimeout)
+	defer cancel()
+	return gtfs.GetTripInstances(ctx, d.db, dataSetId, tripIds, serviceDate, d.compactor)
 }
 
 func (d *dbTripPredictorsDataProvider) GetCurrentMLModelsByName() (map[string]*mlmodels.MLModel, error) {
 	return mlmodels.GetAllCurrentMLModelsByName(d.db, true)
 }
 
+func (d *dbTripPredictorsDataProvider) GetShadowMLModelsByName() (map[string]*mlmodels.MLModel, error) {
+	return mlmodels.GetShadowMLModelsByName(d.db)
+}
+
 // tripPredictorsCollection factory and cache of tripPredictions
 type tripPredictorsCollection struct {
 	dataProvider             tripPredictorsDataProvider
 	predictorFactory         *segmentPredictorFactory
-	expireSeconds            int
+	eviction                 *predictorEvictionPolicy
 	locker                   *tripPredictorsLocker
 	maximumPredictionMinutes int
 }
 
 // makeTripPredictorsCollection builds tripPredictorsCollection
+// when shadowEvaluation is true shadow models are loaded and sent inference requests alongside the current models
+// when serviceExceptionFeatures is true inference requests include the service exceptions of each trip, and when
+// enricher is not nil they include its external features. Cached tripPredictors are removed according to eviction
 func makeTripPredictorsCollection(dataProvider tripPredictorsDataProvider,
 	osts *observedStopTransitions,
 	minimumRMSEModelImprovement float64,
 	minimumObservedStopCount int,
-	tripPredictorExpireSeconds int,
+	eviction *predictorEvictionPolicy,
 	maximumPredictionMinutes int,
 	makePredictions bool,
-	useStatistics bool) (*tripPredictorsCollection, error) {
+	useStatistics bool,
+	timepointOnlyRouteIds []string,
+	shadowEvaluation bool,
+	serviceExceptionFeatures bool,
+	enricher featureEnricher) (*tripPredictorsCollection, error) {
 	modelsByName, err := dataProvider.GetCurrentMLModelsByName()
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve models in makeTripPredictorsCollection: %w", err)
 	}
+	var shadowModelsByName map[string]*mlmodels.MLModel
+	if shadowEvaluation {
+		shadowModelsByName, err = dataProvider.GetShadowMLModelsByName()
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve shadow models in makeTripPredictorsCollection: %w", err)
+		}
+	}
 	predictorFactory := makeSegmentPredictionFactory(modelsByName,
 		osts,
 		minimumRMSEModelImprovement,
 		minimumObservedStopCount,
 		makePredictions,
-		useStatistics)
+		useStatistics,
+		timepointOnlyRouteIds,
+		shadowModelsByName,
+		serviceExceptionFeatures,
+		enricher)
 	return &tripPredictorsCollection{
 		dataProvider:             dataProvider,
 		predictorFactory:         predictorFactory,
-		expireSeconds:            tripPredictorExpireSeconds,
+		eviction:                 eviction,
 		locker:                   makeTripPredictorLocker(),
 		maximumPredictionMinutes: maximumPredictionMinutes,
 	}, nil
 }
 
 // retrieveTripPredictor finds the tripPredictor for use on gtfs.TripDeviation in cache or loads it if not in cache
-func (t *tripPredictorsCollection) retrieveTripPredictor(deviation *gtfs.TripDeviation) (*tripPredictor, error) {
+func (t *tripPredictorsCollection) retrieveTripPredictor(ctx context.Context,
+	deviation *gtfs.TripDeviation) (*tripPredictor, error) {
 	predictorMapId := makePredictorMapId(deviation.DataSetId, deviation.TripId)
 	predictor := t.locker.retrieve(predictorMapId)
 	if predictor != nil {
 		return predictor, nil
 	}
-	tripInstance, err := t.dataProvider.GetTripInstance(deviation.DataSetId, deviation.TripId,
+	tripInstance, err := t.dataProvider.GetTripInstance(ctx, deviation.DataSetId, deviation.TripId,
 		deviation.DeviationTimestamp, 60*60*8)
 	if err != nil {
 		return nil, err
 	}
+	err = gtfs.ValidateTripTopology(tripInstance)
+	if err != nil {
+		return nil, err
+	}
 	predictor = makeTripPredictor(tripInstance, t.predictorFactory, t.maximumPredictionMinutes)
 	t.locker.put(predictorMapId, predictor)
 	return predictor, nil
 }
 
-// removeExpiredPredictors removes all expired predictors from cache as of "now"
-// returns number of tripPredictors in collection before and after cleanup
+// loadTripPredictors loads tripPredictors for all deviations not already in cache, trips are retrieved in a single
+// batch for each data set and service date. Deviations without a service date are left for retrieveTripPredictor
+// to load individually
+func (t *tripPredictorsCollection) loadTripPredictors(ctx context.Context, deviations []*gtfs.TripDeviation) error {
+	// deviations decoded from messages each hold their own time zone, so the service date is keyed by calendar day
+	type tripBatchKey struct {
+		dataSetId  int64
+		serviceDay string
+	}
+	tripIdsByBatch := make(map[tripBatchKey][]string)
+	serviceDates := make(map[tripBatchKey]time.Time)
+	for _, deviation := range deviations {
+		if deviation.ServiceDate.IsZero() {
+			continue
+		}
+		if t.locker.retrieve(makePredictorMapId(deviation.DataSetId, deviation.TripId)) != nil {
+			continue
+		}
+		key := tripBatchKey{dataSetId: deviation.DataSetId, serviceDay: deviation.ServiceDate.Format("2006-01-02")}
+		tripIdsByBatch[key] = append(tripIdsByBatch[key], deviation.TripId)
+		serviceDates[key] = deviation.ServiceDate
+	}
+
+	for key, tripIds := range tripIdsByBatch {
+		tripInstances, err := t.dataProvider.GetTripInstances(ctx, key.dataSetId, tripIds, serviceDates[key])
+		if err != nil {
+			var missingTripInstances *gtfs.MissingTripInstances
+			if !errors.As(err, &missingTripInstances) {
+				return err
+			}
+		}
+		// invalid trips are left for retrieveTripPredictor to report when their deviations are processed
+		gtfs.RemoveInvalidTripTopologies(tripInstances)
+		for _, tripInstance := range tripInstances {
+			predictor := makeTripPredictor(tripInstance, t.predictorFactory, t.maximumPredictionMinutes)
+			t.locker.put(makePredictorMapId(key.dataSetId, tripInstance.TripId), predictor)
+		}
+	}
+	return nil
+}
+
+// removeExpiredPredictors removes all predictors evicted by the predictorEvictionPolicy from cache as of "now",
+// counting them in predictorEvictionMetrics. returns number of tripPredictors in collection before and after cleanup
 func (t *tripPredictorsCollection) removeExpiredPredictors(now time.Time) (int, int) {
-	return t.locker.removeExpiredPredictors(now, t.expireSeconds)
+	startSize, evictions := t.locker.removeExpiredPredictors(now, t.eviction)
+	recordPredictorEvictions(evictions)
+	return startSize, startSize - sumCounts(evictions)
 }
 
 // tripPredictorsLocker thread safe wrapper around map containing tripPredictor for use by tripPredictorsCollection
@@ -117,23 +206,33 @@ func (t *tripPredictorsLocker) put(predictorMapId string, predictor *tripPredict
 	t.tripPredictorMap[predictorMapId] = predictor
 }
 
-// removeExpiredPredictors builds new tripPredictor with only items that have not expired as of "expireSeconds"
-// a tripPredictor has expired if its final stop's arrival time is "expireSeconds" after "now"
-// returns number of tripPredictors in collection before and after cleanup
-func (t *tripPredictorsLocker) removeExpiredPredictors(now time.Time, expireSeconds int) (int, int) {
+// removeExpiredPredictors builds new tripPredictor map with only items eviction keeps as of "now"
+// returns number of tripPredictors in collection before cleanup and the number removed by eviction reason
+func (t *tripPredictorsLocker) removeExpiredPredictors(now time.Time,
+	eviction *predictorEvictionPolicy) (int, map[string]int) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	startSize := len(t.tripPredictorMap)
 	newMap := make(map[string]*tripPredictor)
-	expireBefore := now.Add(time.Duration(-expireSeconds) * time.Second)
+	evictions := make(map[string]int)
 	for key, predictor := range t.tripPredictorMap {
-		lastStop := predictor.tripInstance.LastStopTimeInstance()
-		if lastStop != nil && lastStop.ArrivalDateTime.After(expireBefore) {
-			newMap[key] = predictor
+		if reason := eviction.evictionReason(predictor.tripInstance, now); reason != "" {
+			evictions[reason]++
+			continue
 		}
+		newMap[key] = predictor
 	}
 	t.tripPredictorMap = newMap
-	return startSize, len(newMap)
+	return startSize, evictions
+}
+
+// sumCounts returns the total of counts
+func sumCounts(counts map[string]int) int {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	return total
 }
 
 // makePredictorMapId returns string key for tripPredictor map used by tripPredictorsCollection and tripPredictorsLocker
@@ -156,13 +255,16 @@ func makeTripPredictor(tripInstance *gtfs.TripInstance,
 
 	segmentPredictors := make([]*segmentPredictor, 0)
 
+	timepointOnly := factory.predictTimepointsOnly(tripInstance.RouteId)
+
 	//for each timepoint pair create segmentPredictor
 	var segmentStops []*gtfs.StopTimeInstance
 	for _, stop := range tripInstance.StopTimeInstances {
 
 		segmentStops = append(segmentStops, stop)
 		if len(segmentStops) > 1 && stop.IsTimepoint() {
-			segmentPredictors = append(segmentPredictors, factory.makeSegmentPredictors(segmentStops)...)
+			segmentPredictors = append(segmentPredictors, factory.makeSegmentPredictors(segmentStops,
+				tripInstance.PatternId, timepointOnly)...)
 			segmentStops = []*gtfs.StopTimeInstance{stop}
 		}
 	}
@@ -207,6 +309,9 @@ func (p *tripPredictor) predict(tripDeviation *gtfs.TripDeviation) (*tripPredict
 		if result.inferenceRequest != nil {
 			inferenceRequests = append(inferenceRequests, result.inferenceRequest)
 		}
+		if result.shadowInferenceRequest != nil {
+			inferenceRequests = append(inferenceRequests, result.shadowInferenceRequest)
+		}
 		stopPredictions = append(stopPredictions, result.stopPredictions...)
 
 	}
@@ -1,8 +1,10 @@
-package aggregator
+package predictor
 
 import (
+	"context"
 	"fmt"
 	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/mlmodels"
 	"strings"
 	"testing"
 	"time"
@@ -12,7 +14,7 @@ func Test_makeTripPredictor(t *testing.T) {
 
 	modelMap := getTestModelMap(t, "trip_instance_1_stop_models.json", "trip_instance_1_tp_models.json")
 
-	osts := makeObservedStopTransitions(3600)
+	osts := makeObservedStopTransitions(3600, 0, 0)
 
 	location, err := time.LoadLocation("America/Los_Angeles")
 	if err != nil {
@@ -23,7 +25,7 @@ func Test_makeTripPredictor(t *testing.T) {
 		"trip_instance_1.json", t)
 
 	segmentPredictorFactory1 := makeSegmentPredictionFactory(modelMap, osts, 0.0, 1,
-		true, true)
+		true, true, nil, nil, false, nil)
 
 	type args struct {
 		tripInstance *gtfs.TripInstance
@@ -82,7 +84,7 @@ func Test_tripPredictor_predict(t *testing.T) {
 
 	modelMap := getTestModelMap(t, "trip_instance_1_stop_models.json", "trip_instance_1_tp_models.json")
 
-	osts := makeObservedStopTransitions(3600)
+	osts := makeObservedStopTransitions(3600, 0, 0)
 
 	location, err := time.LoadLocation("America/Los_Angeles")
 	if err != nil {
@@ -97,7 +99,7 @@ func Test_tripPredictor_predict(t *testing.T) {
 	timeAt1310 := time.Date(2022, 5, 22, 13, 10, 0, 0, location)
 
 	segmentPredictionFactory := makeSegmentPredictionFactory(modelMap, osts,
-		0.0, 1, true, true)
+		0.0, 1, true, true, nil, nil, false, nil)
 
 	tests := []struct {
 		name                     string
@@ -333,3 +335,92 @@ func Test_tripIsWithinPredictionRange(t *testing.T) {
 		})
 	}
 }
+
+// testTripPredictorsDataProvider serves trip instances from memory and counts requests made
+type testTripPredictorsDataProvider struct {
+	tripInstances      map[string]*gtfs.TripInstance
+	batchRequests      int
+	individualRequests int
+}
+
+func (d *testTripPredictorsDataProvider) GetTripInstance(_ context.Context, _ int64, tripId string, _ time.Time, _ int) (*gtfs.TripInstance, error) {
+	d.individualRequests++
+	trip, present := d.tripInstances[tripId]
+	if !present {
+		return nil, fmt.Errorf("unable to find trip %s", tripId)
+	}
+	return trip, nil
+}
+
+func (d *testTripPredictorsDataProvider) GetTripInstances(_ context.Context, dataSetId int64, tripIds []string, _ time.Time) (map[string]*gtfs.TripInstance, error) {
+	d.batchRequests++
+	results := make(map[string]*gtfs.TripInstance)
+	missing := make([]string, 0)
+	for _, tripId := range tripIds {
+		if trip, present := d.tripInstances[tripId]; present {
+			results[tripId] = trip
+		} else {
+			missing = append(missing, tripId)
+		}
+	}
+	if len(missing) > 0 {
+		return results, &gtfs.MissingTripInstances{DataSetId: dataSetId, MissingTripIds: missing}
+	}
+	return results, nil
+}
+
+func (d *testTripPredictorsDataProvider) GetCurrentMLModelsByName() (map[string]*mlmodels.MLModel, error) {
+	return make(map[string]*mlmodels.MLModel), nil
+}
+
+func (d *testTripPredictorsDataProvider) GetShadowMLModelsByName() (map[string]*mlmodels.MLModel, error) {
+	return make(map[string]*mlmodels.MLModel), nil
+}
+
+func Test_tripPredictorsCollection_loadTripPredictors(t *testing.T) {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Errorf("Unable to get testing time zone location")
+		return
+	}
+	serviceDate := time.Date(2022, 5, 22, 0, 0, 0, 0, location)
+	trip1 := getTestTrip(serviceDate, "trip_instance_1.json", t)
+
+	dataProvider := &testTripPredictorsDataProvider{
+		tripInstances: map[string]*gtfs.TripInstance{trip1.TripId: trip1},
+	}
+	collection, err := makeTripPredictorsCollection(dataProvider, makeObservedStopTransitions(3600, 0, 0),
+		0.0, 1, &predictorEvictionPolicy{defaultMargin: time.Hour}, 60, true, true, nil, false, false, nil)
+	if err != nil {
+		t.Errorf("unable to make tripPredictorsCollection: %v", err)
+		return
+	}
+
+	// deviations decoded from messages hold the same service date in their own fixed zones
+	deviations := []*gtfs.TripDeviation{
+		{DataSetId: trip1.DataSetId, TripId: trip1.TripId, ServiceDate: serviceDate},
+		{DataSetId: trip1.DataSetId, TripId: "missing", ServiceDate: serviceDate.In(time.FixedZone("", -7*60*60))},
+	}
+	err = collection.loadTripPredictors(context.Background(), deviations)
+	if err != nil {
+		t.Errorf("loadTripPredictors() error = %v", err)
+		return
+	}
+	if dataProvider.batchRequests != 1 {
+		t.Errorf("expected one batch request, got %d", dataProvider.batchRequests)
+	}
+
+	// the predictor is now cached and is retrieved without another request
+	err = collection.loadTripPredictors(context.Background(), deviations[:1])
+	if err != nil {
+		t.Errorf("loadTripPredictors() error = %v", err)
+	}
+	predictor, err := collection.retrieveTripPredictor(context.Background(), deviations[0])
+	if err != nil || predictor.tripInstance != trip1 {
+		t.Errorf("retrieveTripPredictor() = %v, %v, want predictor for trip %s", predictor, err, trip1.TripId)
+	}
+	if dataProvider.batchRequests != 1 || dataProvider.individualRequests != 0 {
+		t.Errorf("expected no further requests, got %d batch and %d individual",
+			dataProvider.batchRequests-1, dataProvider.individualRequests)
+	}
+}
@@ -0,0 +1,15 @@
+// Package tripupdatevalidator checks a GTFS-realtime TripUpdates feed against the GTFS-realtime specification and
+// best practices, such as those produced by gtfs-tripupdate-svc. It needs only the feed, not the static schedule, so
+// it can be run in tests, in CI against a saved feed, or against a live feed:
+//
+//	issues := tripupdatevalidator.Validate(feedMessage, tripupdatevalidator.Options{
+//		Now:               time.Now(),
+//		MaxFeedAgeSeconds: 120,
+//	})
+//	if tripupdatevalidator.CountErrors(issues) > 0 {
+//		return tripupdatevalidator.WriteIssues(os.Stdout, issues)
+//	}
+//
+// Each Issue names the Rule it breaks. Rules with SeverityError make the feed wrong according to the specification,
+// those with SeverityWarning go against best practices consumers rely on.
+package tripupdatevalidator
@@ -0,0 +1,344 @@
+package tripupdatevalidator
+
+import (
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfsrtproto"
+	"io"
+	"time"
+)
+
+// Severity is how seriously an Issue breaks the feed
+type Severity string
+
+const (
+	// SeverityError issues break the GTFS-realtime specification
+	SeverityError Severity = "error"
+	// SeverityWarning issues go against GTFS-realtime best practices
+	SeverityWarning Severity = "warning"
+)
+
+// Rule identifies a check made by Validate
+type Rule string
+
+const (
+	// RuleMissingHeader feeds have no FeedHeader or no gtfs_realtime_version
+	RuleMissingHeader Rule = "missing_header"
+	// RuleMissingFeedTimestamp feeds have no FeedHeader timestamp
+	RuleMissingFeedTimestamp Rule = "missing_feed_timestamp"
+	// RuleFeedTimestampInFuture feeds have a FeedHeader timestamp after Options.Now
+	RuleFeedTimestampInFuture Rule = "feed_timestamp_in_future"
+	// RuleStaleFeed feeds have a FeedHeader timestamp more than Options.MaxFeedAgeSeconds before Options.Now
+	RuleStaleFeed Rule = "stale_feed"
+	// RuleMissingEntityId entities have no id
+	RuleMissingEntityId Rule = "missing_entity_id"
+	// RuleDuplicateEntityId entities have the id of an earlier entity
+	RuleDuplicateEntityId Rule = "duplicate_entity_id"
+	// RuleMissingTripId TripUpdates have no TripDescriptor trip_id
+	RuleMissingTripId Rule = "missing_trip_id"
+	// RuleDuplicateTrip TripUpdates are for a trip_id already updated by an earlier entity
+	RuleDuplicateTrip Rule = "duplicate_trip"
+	// RuleMissingVehicleId TripUpdates have no VehicleDescriptor id
+	RuleMissingVehicleId Rule = "missing_vehicle_id"
+	// RuleMissingTripUpdateTimestamp TripUpdates have no timestamp
+	RuleMissingTripUpdateTimestamp Rule = "missing_trip_update_timestamp"
+	// RuleTripUpdateTimestampAfterFeed TripUpdates have a timestamp after the FeedHeader timestamp
+	RuleTripUpdateTimestampAfterFeed Rule = "trip_update_timestamp_after_feed"
+	// RuleCanceledWithStopTimeUpdates TripUpdates of CANCELED trips have StopTimeUpdates
+	RuleCanceledWithStopTimeUpdates Rule = "canceled_with_stop_time_updates"
+	// RuleMissingStopTimeUpdates TripUpdates of trips that aren't CANCELED have no StopTimeUpdates
+	RuleMissingStopTimeUpdates Rule = "missing_stop_time_updates"
+	// RuleMissingStopReference StopTimeUpdates have neither a stop_sequence nor a stop_id
+	RuleMissingStopReference Rule = "missing_stop_reference"
+	// RuleMissingStopSequence StopTimeUpdates have a stop_id without a stop_sequence
+	RuleMissingStopSequence Rule = "missing_stop_sequence"
+	// RuleStopSequenceNotIncreasing StopTimeUpdates have a stop_sequence not greater than the previous update's
+	RuleStopSequenceNotIncreasing Rule = "stop_sequence_not_increasing"
+	// RuleMissingStopTimeEvent SCHEDULED StopTimeUpdates have neither an arrival nor a departure
+	RuleMissingStopTimeEvent Rule = "missing_stop_time_event"
+	// RuleNoDataWithStopTimeEvent NO_DATA StopTimeUpdates have an arrival or departure
+	RuleNoDataWithStopTimeEvent Rule = "no_data_with_stop_time_event"
+	// RuleEmptyStopTimeEvent StopTimeEvents have neither a delay nor a time
+	RuleEmptyStopTimeEvent Rule = "empty_stop_time_event"
+	// RuleDepartureBeforeArrival StopTimeUpdates have a departure time before their arrival time
+	RuleDepartureBeforeArrival Rule = "departure_before_arrival"
+	// RuleTimeNotIncreasing StopTimeUpdates have an arrival or departure time before the previous update's
+	RuleTimeNotIncreasing Rule = "time_not_increasing"
+	// RuleDelayInconsistent StopTimeEvents with both a time and delay imply a scheduled time before the scheduled
+	// time implied at an earlier event of the trip
+	RuleDelayInconsistent Rule = "delay_inconsistent"
+	// RuleExtremeDelay StopTimeEvents have a delay larger in magnitude than Options.MaxDelaySeconds
+	RuleExtremeDelay Rule = "extreme_delay"
+)
+
+// Options adjusts the checks made by Validate
+type Options struct {
+	//Now is compared with the FeedHeader timestamp, the feed's age isn't checked when zero
+	Now time.Time
+	//MaxFeedAgeSeconds is how old the feed can be at Now, zero doesn't limit the feed's age
+	MaxFeedAgeSeconds int
+	//MaxDelaySeconds is the largest delay expected, zero doesn't limit delays
+	MaxDelaySeconds int
+}
+
+// Issue is a problem found in a TripUpdates feed
+type Issue struct {
+	Severity Severity `json:"severity"`
+	Rule     Rule     `json:"rule"`
+	EntityId string   `json:"entity_id,omitempty"`
+	TripId   string   `json:"trip_id,omitempty"`
+	//StopSequence is the stop_sequence of the StopTimeUpdate, or its position in the TripUpdate when it has none
+	StopSequence *uint32 `json:"stop_sequence,omitempty"`
+	Message      string  `json:"message"`
+}
+
+// String describes Issue on a single line
+func (i Issue) String() string {
+	location := ""
+	if i.EntityId != "" {
+		location += " entity " + i.EntityId
+	}
+	if i.TripId != "" {
+		location += " trip " + i.TripId
+	}
+	if i.StopSequence != nil {
+		location += fmt.Sprintf(" stop_sequence %d", *i.StopSequence)
+	}
+	return fmt.Sprintf("%s %s%s: %s", i.Severity, i.Rule, location, i.Message)
+}
+
+// CountErrors returns the number of issues with SeverityError
+func CountErrors(issues []Issue) int {
+	count := 0
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			count++
+		}
+	}
+	return count
+}
+
+// WriteIssues writes each of issues to w on its own line followed by a count of errors and warnings
+func WriteIssues(w io.Writer, issues []Issue) error {
+	for _, issue := range issues {
+		if _, err := fmt.Fprintln(w, issue.String()); err != nil {
+			return err
+		}
+	}
+	errors := CountErrors(issues)
+	_, err := fmt.Fprintf(w, "%d errors, %d warnings\n", errors, len(issues)-errors)
+	return err
+}
+
+// validation collects the Issues found by Validate
+type validation struct {
+	options     Options
+	issues      []Issue
+	entityIds   map[string]bool
+	tripIds     map[string]bool
+	feedSeconds uint64
+}
+
+// add records an Issue of rule with severity, where its message is formatted from format and args
+func (v *validation) add(severity Severity,
+	rule Rule,
+	entityId string,
+	tripId string,
+	stopSequence *uint32,
+	format string,
+	args ...interface{}) {
+	v.issues = append(v.issues, Issue{
+		Severity:     severity,
+		Rule:         rule,
+		EntityId:     entityId,
+		TripId:       tripId,
+		StopSequence: stopSequence,
+		Message:      fmt.Sprintf(format, args...),
+	})
+}
+
+// Validate checks the FeedHeader of feed and each of its TripUpdates, returning the Issues found in feed order
+func Validate(feed *gtfsrtproto.FeedMessage, options Options) []Issue {
+	v := &validation{
+		options:   options,
+		entityIds: make(map[string]bool),
+		tripIds:   make(map[string]bool),
+	}
+	v.validateHeader(feed.GetHeader())
+	for _, entity := range feed.GetEntity() {
+		v.validateEntity(entity)
+	}
+	return v.issues
+}
+
+// validateHeader checks the version and timestamp of header
+func (v *validation) validateHeader(header *gtfsrtproto.FeedHeader) {
+	if header == nil || header.GetGtfsRealtimeVersion() == "" {
+		v.add(SeverityError, RuleMissingHeader, "", "", nil, "feed has no header or gtfs_realtime_version")
+	}
+	v.feedSeconds = header.GetTimestamp()
+	if v.feedSeconds == 0 {
+		v.add(SeverityError, RuleMissingFeedTimestamp, "", "", nil, "feed header has no timestamp")
+		return
+	}
+	if v.options.Now.IsZero() {
+		return
+	}
+	feedAt := time.Unix(int64(v.feedSeconds), 0)
+	if feedAt.After(v.options.Now) {
+		v.add(SeverityError, RuleFeedTimestampInFuture, "", "", nil, "feed timestamp %s is after %s",
+			feedAt.Format(time.RFC3339), v.options.Now.Format(time.RFC3339))
+	}
+	maxAge := time.Duration(v.options.MaxFeedAgeSeconds) * time.Second
+	if age := v.options.Now.Sub(feedAt); maxAge > 0 && age > maxAge {
+		v.add(SeverityWarning, RuleStaleFeed, "", "", nil, "feed timestamp is %s old, more than %s",
+			age.Round(time.Second), maxAge)
+	}
+}
+
+// validateEntity checks the id of entity and its TripUpdate, entities without a TripUpdate are otherwise ignored
+func (v *validation) validateEntity(entity *gtfsrtproto.FeedEntity) {
+	entityId := entity.GetId()
+	if entityId == "" {
+		v.add(SeverityError, RuleMissingEntityId, "", "", nil, "entity has no id")
+	} else if v.entityIds[entityId] {
+		v.add(SeverityError, RuleDuplicateEntityId, entityId, "", nil, "entity id is used by an earlier entity")
+	}
+	v.entityIds[entityId] = true
+	if entity.GetTripUpdate() != nil {
+		v.validateTripUpdate(entityId, entity.GetTripUpdate())
+	}
+}
+
+// validateTripUpdate checks the trip, vehicle, timestamp and StopTimeUpdates of tripUpdate
+func (v *validation) validateTripUpdate(entityId string, tripUpdate *gtfsrtproto.TripUpdate) {
+	tripId := tripUpdate.GetTrip().GetTripId()
+	if tripId == "" {
+		v.add(SeverityError, RuleMissingTripId, entityId, "", nil, "trip update has no trip_id")
+	} else if v.tripIds[tripId] {
+		v.add(SeverityError, RuleDuplicateTrip, entityId, tripId, nil, "trip is updated by an earlier entity")
+	}
+	v.tripIds[tripId] = true
+	if tripUpdate.GetVehicle().GetId() == "" {
+		v.add(SeverityWarning, RuleMissingVehicleId, entityId, tripId, nil, "trip update has no vehicle id")
+	}
+	if tripUpdate.Timestamp == nil || tripUpdate.GetTimestamp() == 0 {
+		v.add(SeverityWarning, RuleMissingTripUpdateTimestamp, entityId, tripId, nil, "trip update has no timestamp")
+	} else if v.feedSeconds > 0 && tripUpdate.GetTimestamp() > v.feedSeconds {
+		v.add(SeverityError, RuleTripUpdateTimestampAfterFeed, entityId, tripId, nil,
+			"trip update timestamp %d is after feed timestamp %d", tripUpdate.GetTimestamp(), v.feedSeconds)
+	}
+
+	stopTimeUpdates := tripUpdate.GetStopTimeUpdate()
+	if tripUpdate.GetTrip().GetScheduleRelationship() == gtfsrtproto.TripDescriptor_CANCELED {
+		if len(stopTimeUpdates) > 0 {
+			v.add(SeverityWarning, RuleCanceledWithStopTimeUpdates, entityId, tripId, nil,
+				"canceled trip has %d stop time updates", len(stopTimeUpdates))
+		}
+		return
+	}
+	if len(stopTimeUpdates) == 0 {
+		v.add(SeverityError, RuleMissingStopTimeUpdates, entityId, tripId, nil, "trip update has no stop time updates")
+		return
+	}
+	v.validateStopTimeUpdates(entityId, tripId, stopTimeUpdates)
+}
+
+// stopTimeProgress tracks the latest times seen along a trip's StopTimeUpdates
+type stopTimeProgress struct {
+	stopSequence     *uint32
+	time             int64
+	scheduledTime    int64
+	hasTime          bool
+	hasScheduledTime bool
+}
+
+// validateStopTimeUpdates checks each of stopTimeUpdates and that their stop_sequences and times increase
+func (v *validation) validateStopTimeUpdates(entityId string,
+	tripId string,
+	stopTimeUpdates []*gtfsrtproto.TripUpdate_StopTimeUpdate) {
+	progress := stopTimeProgress{}
+	for i, update := range stopTimeUpdates {
+		position := uint32(i)
+		location := &position
+		if update.StopSequence != nil {
+			stopSequence := update.GetStopSequence()
+			location = &stopSequence
+		}
+		if update.StopSequence == nil && update.StopId == nil {
+			v.add(SeverityError, RuleMissingStopReference, entityId, tripId, location,
+				"stop time update %d has neither stop_sequence nor stop_id", i)
+		} else if update.StopSequence == nil {
+			v.add(SeverityWarning, RuleMissingStopSequence, entityId, tripId, location,
+				"stop time update for stop_id %s has no stop_sequence", update.GetStopId())
+		}
+		if update.StopSequence != nil {
+			if progress.stopSequence != nil && update.GetStopSequence() <= *progress.stopSequence {
+				v.add(SeverityError, RuleStopSequenceNotIncreasing, entityId, tripId, location,
+					"stop_sequence %d is not greater than the previous stop_sequence %d", update.GetStopSequence(),
+					*progress.stopSequence)
+			}
+			progress.stopSequence = location
+		}
+
+		arrival, departure := update.GetArrival(), update.GetDeparture()
+		if update.GetScheduleRelationship() == gtfsrtproto.TripUpdate_StopTimeUpdate_NO_DATA {
+			if arrival != nil || departure != nil {
+				v.add(SeverityError, RuleNoDataWithStopTimeEvent, entityId, tripId, location,
+					"NO_DATA stop time update has an arrival or departure")
+			}
+			continue
+		}
+		if update.GetScheduleRelationship() == gtfsrtproto.TripUpdate_StopTimeUpdate_SCHEDULED &&
+			arrival == nil && departure == nil {
+			v.add(SeverityError, RuleMissingStopTimeEvent, entityId, tripId, location,
+				"scheduled stop time update has neither arrival nor departure")
+		}
+		v.validateStopTimeEvent(entityId, tripId, location, "arrival", arrival, &progress)
+		if arrival.GetTime() != 0 && departure.GetTime() != 0 && departure.GetTime() < arrival.GetTime() {
+			v.add(SeverityError, RuleDepartureBeforeArrival, entityId, tripId, location,
+				"departure time %d is before arrival time %d", departure.GetTime(), arrival.GetTime())
+		}
+		v.validateStopTimeEvent(entityId, tripId, location, "departure", departure, &progress)
+	}
+}
+
+// validateStopTimeEvent checks event, the arrival or departure named kind, against progress along the trip, then
+// advances progress to it
+func (v *validation) validateStopTimeEvent(entityId string,
+	tripId string,
+	location *uint32,
+	kind string,
+	event *gtfsrtproto.TripUpdate_StopTimeEvent,
+	progress *stopTimeProgress) {
+	if event == nil {
+		return
+	}
+	if event.Delay == nil && event.Time == nil {
+		v.add(SeverityError, RuleEmptyStopTimeEvent, entityId, tripId, location, "%s has neither delay nor time",
+			kind)
+		return
+	}
+	maxDelay := int32(v.options.MaxDelaySeconds)
+	if event.Delay != nil && maxDelay > 0 && (event.GetDelay() > maxDelay || event.GetDelay() < -maxDelay) {
+		v.add(SeverityWarning, RuleExtremeDelay, entityId, tripId, location, "%s delay %d is beyond %d seconds",
+			kind, event.GetDelay(), maxDelay)
+	}
+	if event.Time == nil {
+		return
+	}
+	if progress.hasTime && event.GetTime() < progress.time {
+		v.add(SeverityError, RuleTimeNotIncreasing, entityId, tripId, location,
+			"%s time %d is before the previous time %d", kind, event.GetTime(), progress.time)
+	}
+	progress.time, progress.hasTime = event.GetTime(), true
+	if event.Delay == nil {
+		return
+	}
+	scheduledTime := event.GetTime() - int64(event.GetDelay())
+	if progress.hasScheduledTime && scheduledTime < progress.scheduledTime {
+		v.add(SeverityError, RuleDelayInconsistent, entityId, tripId, location,
+			"%s time %d less delay %d is scheduled before the previous scheduled time %d", kind, event.GetTime(),
+			event.GetDelay(), progress.scheduledTime)
+	}
+	progress.scheduledTime, progress.hasScheduledTime = scheduledTime, true
+}
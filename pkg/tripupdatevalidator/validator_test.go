@@ -0,0 +1,283 @@
+package tripupdatevalidator
+
+import (
+	"bytes"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfsrtproto"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func uint32Ptr(v uint32) *uint32 {
+	return &v
+}
+
+func int32Ptr(v int32) *int32 {
+	return &v
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+func stringPtr(v string) *string {
+	return &v
+}
+
+// makeStopTimeUpdate builds a SCHEDULED StopTimeUpdate arriving at arrivalTime with arrivalDelay
+func makeStopTimeUpdate(stopSequence uint32, arrivalTime int64, arrivalDelay int32) *gtfsrtproto.TripUpdate_StopTimeUpdate {
+	relationship := gtfsrtproto.TripUpdate_StopTimeUpdate_SCHEDULED
+	return &gtfsrtproto.TripUpdate_StopTimeUpdate{
+		StopSequence:         uint32Ptr(stopSequence),
+		StopId:               stringPtr("stop"),
+		ScheduleRelationship: &relationship,
+		Arrival: &gtfsrtproto.TripUpdate_StopTimeEvent{
+			Time:  int64Ptr(arrivalTime),
+			Delay: int32Ptr(arrivalDelay),
+		},
+	}
+}
+
+// makeFeed builds a TripUpdates FeedMessage taken at "at" with an entity for each of tripUpdates
+func makeFeed(at uint64, tripUpdates ...*gtfsrtproto.TripUpdate) *gtfsrtproto.FeedMessage {
+	version := "2.0"
+	feed := &gtfsrtproto.FeedMessage{
+		Header: &gtfsrtproto.FeedHeader{
+			GtfsRealtimeVersion: &version,
+			Timestamp:           &at,
+		},
+	}
+	for _, tripUpdate := range tripUpdates {
+		feed.Entity = append(feed.Entity, &gtfsrtproto.FeedEntity{
+			Id:         tripUpdate.Trip.TripId,
+			TripUpdate: tripUpdate,
+		})
+	}
+	return feed
+}
+
+// makeTripUpdate builds a SCHEDULED TripUpdate for tripId timestamped "at"
+func makeTripUpdate(tripId string, at uint64, updates ...*gtfsrtproto.TripUpdate_StopTimeUpdate) *gtfsrtproto.TripUpdate {
+	relationship := gtfsrtproto.TripDescriptor_SCHEDULED
+	return &gtfsrtproto.TripUpdate{
+		Trip: &gtfsrtproto.TripDescriptor{
+			TripId:               stringPtr(tripId),
+			ScheduleRelationship: &relationship,
+		},
+		Vehicle:        &gtfsrtproto.VehicleDescriptor{Id: stringPtr("101")},
+		Timestamp:      &at,
+		StopTimeUpdate: updates,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	at := uint64(1650000000)
+	now := time.Unix(int64(at), 0)
+	tests := []struct {
+		name    string
+		feed    func() *gtfsrtproto.FeedMessage
+		options Options
+		want    []Rule
+	}{
+		{
+			name: "conforming feed",
+			feed: func() *gtfsrtproto.FeedMessage {
+				noData := gtfsrtproto.TripUpdate_StopTimeUpdate_NO_DATA
+				return makeFeed(at,
+					makeTripUpdate("1", at,
+						makeStopTimeUpdate(1, 1650000060, 60),
+						makeStopTimeUpdate(2, 1650000120, 0),
+						&gtfsrtproto.TripUpdate_StopTimeUpdate{
+							StopSequence:         uint32Ptr(3),
+							ScheduleRelationship: &noData,
+						}),
+					makeTripUpdate("2", at-30, makeStopTimeUpdate(4, 1650000600, -30)))
+			},
+			options: Options{Now: now, MaxFeedAgeSeconds: 60, MaxDelaySeconds: 3600},
+		},
+		{
+			name: "missing header",
+			feed: func() *gtfsrtproto.FeedMessage {
+				return &gtfsrtproto.FeedMessage{}
+			},
+			want: []Rule{RuleMissingHeader, RuleMissingFeedTimestamp},
+		},
+		{
+			name: "stale feed",
+			feed: func() *gtfsrtproto.FeedMessage {
+				return makeFeed(at - 300)
+			},
+			options: Options{Now: now, MaxFeedAgeSeconds: 60},
+			want:    []Rule{RuleStaleFeed},
+		},
+		{
+			name: "feed in the future",
+			feed: func() *gtfsrtproto.FeedMessage {
+				return makeFeed(at + 300)
+			},
+			options: Options{Now: now},
+			want:    []Rule{RuleFeedTimestampInFuture},
+		},
+		{
+			name: "age not checked without now",
+			feed: func() *gtfsrtproto.FeedMessage {
+				return makeFeed(at - 300)
+			},
+			options: Options{MaxFeedAgeSeconds: 60},
+		},
+		{
+			name: "duplicate entity and trip",
+			feed: func() *gtfsrtproto.FeedMessage {
+				return makeFeed(at,
+					makeTripUpdate("1", at, makeStopTimeUpdate(1, 1650000060, 60)),
+					makeTripUpdate("1", at, makeStopTimeUpdate(1, 1650000060, 60)))
+			},
+			want: []Rule{RuleDuplicateEntityId, RuleDuplicateTrip},
+		},
+		{
+			name: "missing trip id, vehicle and timestamp",
+			feed: func() *gtfsrtproto.FeedMessage {
+				tripUpdate := makeTripUpdate("", 0, makeStopTimeUpdate(1, 1650000060, 60))
+				tripUpdate.Vehicle = nil
+				feed := makeFeed(at, tripUpdate)
+				feed.Entity[0].Id = stringPtr("e1")
+				return feed
+			},
+			want: []Rule{RuleMissingTripId, RuleMissingVehicleId, RuleMissingTripUpdateTimestamp},
+		},
+		{
+			name: "trip update after feed",
+			feed: func() *gtfsrtproto.FeedMessage {
+				return makeFeed(at, makeTripUpdate("1", at+10, makeStopTimeUpdate(1, 1650000060, 60)))
+			},
+			want: []Rule{RuleTripUpdateTimestampAfterFeed},
+		},
+		{
+			name: "canceled trip",
+			feed: func() *gtfsrtproto.FeedMessage {
+				canceled := gtfsrtproto.TripDescriptor_CANCELED
+				tripUpdate := makeTripUpdate("1", at, makeStopTimeUpdate(1, 1650000060, 60))
+				tripUpdate.Trip.ScheduleRelationship = &canceled
+				withoutStops := makeTripUpdate("2", at)
+				withoutStops.Trip.ScheduleRelationship = &canceled
+				return makeFeed(at, tripUpdate, withoutStops)
+			},
+			want: []Rule{RuleCanceledWithStopTimeUpdates},
+		},
+		{
+			name: "no stop time updates",
+			feed: func() *gtfsrtproto.FeedMessage {
+				return makeFeed(at, makeTripUpdate("1", at))
+			},
+			want: []Rule{RuleMissingStopTimeUpdates},
+		},
+		{
+			name: "stop sequence not increasing",
+			feed: func() *gtfsrtproto.FeedMessage {
+				return makeFeed(at, makeTripUpdate("1", at,
+					makeStopTimeUpdate(2, 1650000060, 60),
+					makeStopTimeUpdate(2, 1650000120, 60)))
+			},
+			want: []Rule{RuleStopSequenceNotIncreasing},
+		},
+		{
+			name: "stop references",
+			feed: func() *gtfsrtproto.FeedMessage {
+				noSequence := makeStopTimeUpdate(1, 1650000060, 60)
+				noSequence.StopSequence = nil
+				noReference := makeStopTimeUpdate(2, 1650000120, 60)
+				noReference.StopSequence = nil
+				noReference.StopId = nil
+				return makeFeed(at, makeTripUpdate("1", at, noSequence, noReference))
+			},
+			want: []Rule{RuleMissingStopSequence, RuleMissingStopReference},
+		},
+		{
+			name: "stop time events",
+			feed: func() *gtfsrtproto.FeedMessage {
+				noEvent := makeStopTimeUpdate(1, 1650000060, 60)
+				noEvent.Arrival = nil
+				emptyEvent := makeStopTimeUpdate(2, 1650000060, 60)
+				emptyEvent.Arrival = &gtfsrtproto.TripUpdate_StopTimeEvent{}
+				noData := makeStopTimeUpdate(3, 1650000120, 60)
+				noDataRelationship := gtfsrtproto.TripUpdate_StopTimeUpdate_NO_DATA
+				noData.ScheduleRelationship = &noDataRelationship
+				return makeFeed(at, makeTripUpdate("1", at, noEvent, emptyEvent, noData))
+			},
+			want: []Rule{RuleMissingStopTimeEvent, RuleEmptyStopTimeEvent, RuleNoDataWithStopTimeEvent},
+		},
+		{
+			name: "times not increasing",
+			feed: func() *gtfsrtproto.FeedMessage {
+				departsEarly := makeStopTimeUpdate(1, 1650000120, 60)
+				departsEarly.Departure = &gtfsrtproto.TripUpdate_StopTimeEvent{Time: int64Ptr(1650000100)}
+				return makeFeed(at, makeTripUpdate("1", at,
+					departsEarly,
+					makeStopTimeUpdate(2, 1650000090, 0)))
+			},
+			want: []Rule{RuleDepartureBeforeArrival, RuleTimeNotIncreasing, RuleTimeNotIncreasing},
+		},
+		{
+			name: "delay inconsistent with time",
+			feed: func() *gtfsrtproto.FeedMessage {
+				return makeFeed(at, makeTripUpdate("1", at,
+					makeStopTimeUpdate(1, 1650000060, 0),
+					makeStopTimeUpdate(2, 1650000120, 120)))
+			},
+			want: []Rule{RuleDelayInconsistent},
+		},
+		{
+			name: "extreme delay",
+			feed: func() *gtfsrtproto.FeedMessage {
+				return makeFeed(at, makeTripUpdate("1", at,
+					makeStopTimeUpdate(1, 1650000060, -7200),
+					makeStopTimeUpdate(2, 1650007260, 0)))
+			},
+			options: Options{MaxDelaySeconds: 3600},
+			want:    []Rule{RuleExtremeDelay},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []Rule
+			for _, issue := range Validate(tt.feed(), tt.options) {
+				got = append(got, issue.Rule)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() rules = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteIssues(t *testing.T) {
+	issues := []Issue{
+		{
+			Severity:     SeverityError,
+			Rule:         RuleStopSequenceNotIncreasing,
+			EntityId:     "e1",
+			TripId:       "1",
+			StopSequence: uint32Ptr(2),
+			Message:      "stop_sequence 2 is not greater than the previous stop_sequence 2",
+		},
+		{
+			Severity: SeverityWarning,
+			Rule:     RuleStaleFeed,
+			Message:  "feed timestamp is 5m0s old, more than 1m0s",
+		},
+	}
+	var buffer bytes.Buffer
+	if err := WriteIssues(&buffer, issues); err != nil {
+		t.Fatalf("WriteIssues() error = %v", err)
+	}
+	want := "error stop_sequence_not_increasing entity e1 trip 1 stop_sequence 2: stop_sequence 2 is not greater " +
+		"than the previous stop_sequence 2\n" +
+		"warning stale_feed: feed timestamp is 5m0s old, more than 1m0s\n" +
+		"1 errors, 1 warnings\n"
+	if got := buffer.String(); got != want {
+		t.Errorf("WriteIssues() = %q, want %q", got, want)
+	}
+	if got := CountErrors(issues); got != 1 {
+		t.Errorf("CountErrors() = %d, want 1", got)
+	}
+}
@@ -0,0 +1,38 @@
+package vehiclemonitor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"time"
+)
+
+//assignmentChange returns a gtfs.VehicleAssignmentChange when position places the vehicle on trip before it reached
+//the final segment of the trip it was last positioned on, otherwise nil.
+//positions arriving after the vehicle's last position has expired are not considered a change
+func (vm *Monitor) assignmentChange(position *Position,
+	trip *gtfs.TripInstance) *gtfs.VehicleAssignmentChange {
+	last := vm.lastTripStopPosition
+	if trip == nil || last == nil || vm.isCurrentPositionExpired(position.Timestamp) {
+		return nil
+	}
+	previousTrip := last.tripInstance
+	if previousTrip.TripId == trip.TripId {
+		return nil
+	}
+	if last.nextSTI.StopSequence >= getLastStopTimeSequenceOnTrip(previousTrip) {
+		return nil
+	}
+	return &gtfs.VehicleAssignmentChange{
+		ChangedAt:            time.Unix(position.Timestamp, 0),
+		VehicleId:            vm.Id,
+		DataSetId:            trip.DataSetId,
+		PreviousTripId:       previousTrip.TripId,
+		PreviousRouteId:      previousTrip.RouteId,
+		PreviousBlockId:      previousTrip.BlockId,
+		PreviousStopSequence: last.previousSTI.StopSequence,
+		TripId:               trip.TripId,
+		RouteId:              trip.RouteId,
+		BlockId:              trip.BlockId,
+		StopSequence:         position.StopSequence,
+		BlockChanged:         previousTrip.BlockId != trip.BlockId,
+	}
+}
@@ -0,0 +1,126 @@
+package vehiclemonitor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func makeAssignmentTestTrip(tripId string, blockId string, stopCount int) *gtfs.TripInstance {
+	trip := &gtfs.TripInstance{
+		Trip: gtfs.Trip{
+			DataSetId: 1,
+			TripId:    tripId,
+			RouteId:   "100",
+			BlockId:   blockId,
+		},
+	}
+	for i := 1; i <= stopCount; i++ {
+		trip.StopTimeInstances = append(trip.StopTimeInstances, &gtfs.StopTimeInstance{
+			StopTime: gtfs.StopTime{TripId: tripId, StopSequence: uint32(i)},
+		})
+	}
+	return trip
+}
+
+func Test_vehicleMonitor_assignmentChange(t *testing.T) {
+	tripA := makeAssignmentTestTrip("A", "9001", 5)
+	tripB := makeAssignmentTestTrip("B", "9001", 5)
+	tripC := makeAssignmentTestTrip("C", "9002", 5)
+	lastTimestamp := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC).Unix()
+	positionAt := func(trip *gtfs.TripInstance, previousIndex int) *TripStopPosition {
+		return &TripStopPosition{
+			tripInstance:  trip,
+			previousSTI:   trip.StopTimeInstances[previousIndex],
+			nextSTI:       trip.StopTimeInstances[previousIndex+1],
+			lastTimestamp: lastTimestamp,
+		}
+	}
+	tests := []struct {
+		name         string
+		lastPosition *TripStopPosition
+		trip         *gtfs.TripInstance
+		secondsLater int64
+		want         *gtfs.VehicleAssignmentChange
+	}{
+		{
+			name:         "no previous position",
+			trip:         tripB,
+			secondsLater: 30,
+		},
+		{
+			name:         "same trip",
+			lastPosition: positionAt(tripA, 1),
+			trip:         tripA,
+			secondsLater: 30,
+		},
+		{
+			name:         "next trip after final segment",
+			lastPosition: positionAt(tripA, 3),
+			trip:         tripB,
+			secondsLater: 30,
+		},
+		{
+			name:         "previous position expired",
+			lastPosition: positionAt(tripA, 1),
+			trip:         tripB,
+			secondsLater: 1000,
+		},
+		{
+			name:         "trip on same block mid trip",
+			lastPosition: positionAt(tripA, 1),
+			trip:         tripB,
+			secondsLater: 30,
+			want: &gtfs.VehicleAssignmentChange{
+				ChangedAt:            time.Unix(lastTimestamp+30, 0),
+				VehicleId:            "3501",
+				DataSetId:            1,
+				PreviousTripId:       "A",
+				PreviousRouteId:      "100",
+				PreviousBlockId:      "9001",
+				PreviousStopSequence: 2,
+				TripId:               "B",
+				RouteId:              "100",
+				BlockId:              "9001",
+				StopSequence:         uint32Ptr(1),
+			},
+		},
+		{
+			name:         "trip on different block mid trip",
+			lastPosition: positionAt(tripA, 2),
+			trip:         tripC,
+			secondsLater: 30,
+			want: &gtfs.VehicleAssignmentChange{
+				ChangedAt:            time.Unix(lastTimestamp+30, 0),
+				VehicleId:            "3501",
+				DataSetId:            1,
+				PreviousTripId:       "A",
+				PreviousRouteId:      "100",
+				PreviousBlockId:      "9001",
+				PreviousStopSequence: 3,
+				TripId:               "C",
+				RouteId:              "100",
+				BlockId:              "9002",
+				StopSequence:         uint32Ptr(1),
+				BlockChanged:         true,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := makeVehicleMonitor("3501", earlyTolerancePolicy{defaultTolerance: 0.1}, 900, Smoothing{})
+			vm.lastTripStopPosition = tt.lastPosition
+			position := &Position{
+				Id:           "3501",
+				Timestamp:    lastTimestamp + tt.secondsLater,
+				TripId:       &tt.trip.TripId,
+				StopSequence: uint32Ptr(1),
+			}
+			got := vm.assignmentChange(position, tt.trip)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("assignmentChange() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package vehiclemonitor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"time"
+)
+
+const (
+	// deadheadMinimumMeters is how far a deadheading vehicle must move from its last point to have moved. Until it
+	// moves the deadhead starts from wherever the vehicle is waiting
+	deadheadMinimumMeters = 50.0
+	// deadheadOffShapePositions is the number of consecutive positions on a trip that couldn't be placed on its
+	// shape before the vehicle is considered to be deadheading
+	deadheadOffShapePositions = 3
+	// deadheadPullInSeconds is how long a deadheading vehicle that left a trip can stay without moving before it is
+	// considered to have pulled in
+	deadheadPullInSeconds = 1800
+)
+
+// deadheadPoint is where a vehicle was at a position's timestamp, without a location when the position had none
+type deadheadPoint struct {
+	at          int64
+	hasLocation bool
+	latitude    float64
+	longitude   float64
+}
+
+func makeDeadheadPoint(at int64, latitude, longitude *float32) deadheadPoint {
+	point := deadheadPoint{at: at}
+	if latitude != nil && longitude != nil {
+		point.hasLocation = true
+		point.latitude = float64(*latitude)
+		point.longitude = float64(*longitude)
+	}
+	return point
+}
+
+// metersTo returns the distance from p to other, and false when either is missing a location
+func (p deadheadPoint) metersTo(other deadheadPoint) (float64, bool) {
+	if !p.hasLocation || !other.hasLocation {
+		return 0, false
+	}
+	return simpleLatLngDistance(p.latitude, p.longitude, other.latitude, other.longitude), true
+}
+
+func (p deadheadPoint) lat() *float64 {
+	if !p.hasLocation {
+		return nil
+	}
+	return &p.latitude
+}
+
+func (p deadheadPoint) lon() *float64 {
+	if !p.hasLocation {
+		return nil
+	}
+	return &p.longitude
+}
+
+// deadheadTracker follows a vehicle while it moves without a trip or away from its trip's shape, so the deadhead
+// can be recorded separately from the vehicle's trips once it rejoins a trip or pulls in
+type deadheadTracker struct {
+	//active is true while the vehicle is off trip
+	active bool
+	reason string
+	//previous is the vehicle's last position on a trip before the deadhead, nil when it is a pull out
+	previous *TripStopPosition
+	start    deadheadPoint
+	//last is the last point the vehicle moved to
+	last     deadheadPoint
+	moved    bool
+	distance float64
+	//offShapePositions is the number of consecutive positions that couldn't be placed on the vehicle's trip's shape
+	offShapePositions int
+	//lastOnTrip is the vehicle's last position on a trip while not deadheading
+	lastOnTrip *TripStopPosition
+}
+
+// isOffShape returns true when position has a location but couldn't be placed on its trip's shape between its stops
+func isOffShape(position *TripStopPosition) bool {
+	return position.latitude != nil && position.longitude != nil && !position.atPreviousStop &&
+		len(position.tripInstance.Shapes) > 0 && position.tripDistancePosition == nil
+}
+
+// onTrip ends any deadhead with the vehicle at position on its trip, returning the deadhead when the vehicle moved
+// to a different trip than the one it left
+func (d *deadheadTracker) onTrip(position *TripStopPosition) *gtfs.VehicleDeadhead {
+	d.offShapePositions = 0
+	var deadhead *gtfs.VehicleDeadhead
+	if d.active && d.moved &&
+		(d.previous == nil || d.previous.tripInstance.TripId != position.tripInstance.TripId) {
+		end := makeDeadheadPoint(position.lastTimestamp, position.latitude, position.longitude)
+		if meters, ok := d.last.metersTo(end); ok {
+			d.distance += meters
+		}
+		deadhead = d.makeDeadhead(end, position)
+	}
+	d.active = false
+	d.lastOnTrip = position
+	return deadhead
+}
+
+// offShape counts position as off its trip's shape, returning true when the vehicle is deadheading along with any
+// deadhead ended by the vehicle pulling in
+func (d *deadheadTracker) offShape(position *TripStopPosition) (bool, *gtfs.VehicleDeadhead) {
+	d.offShapePositions++
+	if !d.active && d.offShapePositions < deadheadOffShapePositions {
+		return false, nil
+	}
+	return true, d.offTrip(gtfs.OffShapeDeadhead, position.lastTimestamp, position.latitude, position.longitude)
+}
+
+// offTrip adds a position of the vehicle while it's deadheading for reason, returning the deadhead if the vehicle
+// has pulled in
+func (d *deadheadTracker) offTrip(reason string, timestamp int64, latitude, longitude *float32) *gtfs.VehicleDeadhead {
+	point := makeDeadheadPoint(timestamp, latitude, longitude)
+	if !d.active {
+		d.begin(reason, d.lastOnTrip, point)
+		return nil
+	}
+	if meters, ok := d.last.metersTo(point); ok && meters >= deadheadMinimumMeters {
+		d.moved = true
+		d.distance += meters
+		d.last = point
+		return nil
+	}
+	if !d.moved {
+		//the deadhead starts when the vehicle starts moving
+		d.start = point
+		d.last = point
+		return nil
+	}
+	if timestamp-d.last.at < deadheadPullInSeconds {
+		return nil
+	}
+	var deadhead *gtfs.VehicleDeadhead
+	if d.previous != nil {
+		deadhead = d.makeDeadhead(d.last, nil)
+	}
+	//the vehicle is now waiting for its next pull out
+	d.lastOnTrip = nil
+	d.begin(reason, nil, point)
+	return deadhead
+}
+
+// begin starts a deadhead for reason from point, after previous
+func (d *deadheadTracker) begin(reason string, previous *TripStopPosition, point deadheadPoint) {
+	d.active = true
+	d.reason = reason
+	d.previous = previous
+	d.start = point
+	d.last = point
+	d.moved = false
+	d.distance = 0
+}
+
+// makeDeadhead builds the gtfs.VehicleDeadhead from the deadhead's start to end, rejoining a trip at next, or
+// pulling in when next is nil
+func (d *deadheadTracker) makeDeadhead(end deadheadPoint, next *TripStopPosition) *gtfs.VehicleDeadhead {
+	deadhead := &gtfs.VehicleDeadhead{
+		Reason:         d.reason,
+		StartedAt:      time.Unix(d.start.at, 0),
+		StartLatitude:  d.start.lat(),
+		StartLongitude: d.start.lon(),
+		EndedAt:        time.Unix(end.at, 0),
+		EndLatitude:    end.lat(),
+		EndLongitude:   end.lon(),
+		DistanceMeters: d.distance,
+	}
+	switch {
+	case d.previous == nil:
+		deadhead.Kind = gtfs.PullOutDeadhead
+	case next == nil:
+		deadhead.Kind = gtfs.PullInDeadhead
+	default:
+		deadhead.Kind = gtfs.BetweenTripsDeadhead
+	}
+	if d.previous != nil {
+		tripId, blockId, stopSequence := d.previous.tripInstance.TripId, d.previous.tripInstance.BlockId,
+			d.previous.previousSTI.StopSequence
+		deadhead.DataSetId = d.previous.dataSetId
+		deadhead.PreviousTripId = &tripId
+		deadhead.PreviousBlockId = &blockId
+		deadhead.PreviousStopSequence = &stopSequence
+	}
+	if next != nil {
+		tripId, blockId, stopSequence := next.tripInstance.TripId, next.tripInstance.BlockId,
+			next.previousSTI.StopSequence
+		deadhead.DataSetId = next.dataSetId
+		deadhead.TripId = &tripId
+		deadhead.BlockId = &blockId
+		deadhead.StopSequence = &stopSequence
+	}
+	return deadhead
+}
@@ -0,0 +1,173 @@
+package vehiclemonitor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"testing"
+)
+
+func Test_deadheadTracker(t *testing.T) {
+	// onTrip places the vehicle on tripId at stopSequence
+	onTrip := func(tripId string, stopSequence uint32, at int64, lat float32) *TripStopPosition {
+		lon := float32(-122.6)
+		return &TripStopPosition{
+			dataSetId:     1,
+			tripInstance:  &gtfs.TripInstance{Trip: gtfs.Trip{TripId: tripId, BlockId: "B" + tripId}},
+			previousSTI:   &gtfs.StopTimeInstance{StopTime: gtfs.StopTime{StopSequence: stopSequence}},
+			lastTimestamp: at,
+			latitude:      &lat,
+			longitude:     &lon,
+		}
+	}
+	// position is either on a trip, or off trip at lat when trip is nil
+	type position struct {
+		trip *TripStopPosition
+		at   int64
+		lat  float32
+	}
+	tests := []struct {
+		name      string
+		positions []position
+		// wantKinds is the kind of each deadhead returned, in order
+		wantKinds []string
+		// wantLast describes the last deadhead returned
+		wantStartedAt int64
+		wantEndedAt   int64
+		wantPrevious  *string
+		wantNext      *string
+	}{
+		{
+			name: "pull out starts when the vehicle starts moving",
+			positions: []position{
+				{at: 100, lat: 45.5},
+				{at: 200, lat: 45.5001},
+				{at: 300, lat: 45.501},
+				{at: 400, lat: 45.502},
+				{trip: onTrip("1", 1, 500, 45.503)},
+			},
+			wantKinds:     []string{gtfs.PullOutDeadhead},
+			wantStartedAt: 200,
+			wantEndedAt:   500,
+			wantNext:      strPtr("1"),
+		},
+		{
+			name: "between trips",
+			positions: []position{
+				{trip: onTrip("1", 9, 100, 45.5)},
+				{at: 200, lat: 45.501},
+				{at: 300, lat: 45.502},
+				{trip: onTrip("2", 1, 400, 45.503)},
+			},
+			wantKinds:     []string{gtfs.BetweenTripsDeadhead},
+			wantStartedAt: 200,
+			wantEndedAt:   400,
+			wantPrevious:  strPtr("1"),
+			wantNext:      strPtr("2"),
+		},
+		{
+			name: "returning to the same trip is not a deadhead",
+			positions: []position{
+				{trip: onTrip("1", 3, 100, 45.5)},
+				{at: 200, lat: 45.501},
+				{at: 300, lat: 45.502},
+				{trip: onTrip("1", 4, 400, 45.503)},
+			},
+		},
+		{
+			name: "waiting without a trip is not a deadhead",
+			positions: []position{
+				{trip: onTrip("1", 9, 100, 45.5)},
+				{at: 200, lat: 45.5},
+				{at: 300, lat: 45.5001},
+				{trip: onTrip("2", 1, 400, 45.5)},
+			},
+		},
+		{
+			name: "pull in once the vehicle stops moving",
+			positions: []position{
+				{trip: onTrip("1", 9, 100, 45.5)},
+				{at: 200, lat: 45.5},
+				{at: 300, lat: 45.501},
+				{at: 400, lat: 45.502},
+				{at: 1000, lat: 45.502},
+				{at: 2200, lat: 45.5021},
+				{at: 2300, lat: 45.5021},
+				{at: 2400, lat: 45.503},
+				{trip: onTrip("2", 1, 2500, 45.504)},
+			},
+			wantKinds:     []string{gtfs.PullInDeadhead, gtfs.PullOutDeadhead},
+			wantStartedAt: 2300,
+			wantEndedAt:   2500,
+			wantNext:      strPtr("2"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := deadheadTracker{}
+			var deadheads []*gtfs.VehicleDeadhead
+			for _, p := range tt.positions {
+				var deadhead *gtfs.VehicleDeadhead
+				if p.trip != nil {
+					deadhead = d.onTrip(p.trip)
+				} else {
+					lon := float32(-122.6)
+					deadhead = d.offTrip(gtfs.NoTripDeadhead, p.at, &p.lat, &lon)
+				}
+				if deadhead != nil {
+					deadheads = append(deadheads, deadhead)
+				}
+			}
+			if len(deadheads) != len(tt.wantKinds) {
+				t.Fatalf("got %d deadheads, want %d", len(deadheads), len(tt.wantKinds))
+			}
+			for i, deadhead := range deadheads {
+				if deadhead.Kind != tt.wantKinds[i] {
+					t.Errorf("deadhead %d Kind = %s, want %s", i, deadhead.Kind, tt.wantKinds[i])
+				}
+			}
+			if len(deadheads) == 0 {
+				return
+			}
+			last := deadheads[len(deadheads)-1]
+			if last.StartedAt.Unix() != tt.wantStartedAt || last.EndedAt.Unix() != tt.wantEndedAt {
+				t.Errorf("deadhead from %d to %d, want from %d to %d", last.StartedAt.Unix(), last.EndedAt.Unix(),
+					tt.wantStartedAt, tt.wantEndedAt)
+			}
+			if !equalStringPtr(last.PreviousTripId, tt.wantPrevious) || !equalStringPtr(last.TripId, tt.wantNext) {
+				t.Errorf("deadhead from trip %v to %v, want from %v to %v", last.PreviousTripId, last.TripId,
+					tt.wantPrevious, tt.wantNext)
+			}
+			if last.DistanceMeters <= 0 {
+				t.Errorf("deadhead DistanceMeters = %v, want more than 0", last.DistanceMeters)
+			}
+		})
+	}
+}
+
+func Test_deadheadTracker_offShape(t *testing.T) {
+	lat, lon := float32(45.5), float32(-122.6)
+	position := &TripStopPosition{
+		tripInstance:  &gtfs.TripInstance{Trip: gtfs.Trip{TripId: "1"}},
+		previousSTI:   &gtfs.StopTimeInstance{},
+		lastTimestamp: 100,
+		latitude:      &lat,
+		longitude:     &lon,
+	}
+	d := deadheadTracker{}
+	for i := 1; i <= deadheadOffShapePositions; i++ {
+		deadheading, _ := d.offShape(position)
+		if want := i == deadheadOffShapePositions; deadheading != want {
+			t.Errorf("offShape() after %d positions = %v, want %v", i, deadheading, want)
+		}
+	}
+	d.onTrip(position)
+	if deadheading, _ := d.offShape(position); deadheading {
+		t.Errorf("offShape() after returning to trip = true, want false")
+	}
+}
+
+func equalStringPtr(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
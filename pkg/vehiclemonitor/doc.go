@@ -0,0 +1,25 @@
+// Package vehiclemonitor generates gtfs.ObservedStopTime records, the time vehicles take to travel between
+// scheduled stops, from successive GTFS-realtime vehicle positions. It is the position processing used by
+// gtfs-monitor, without the feed polling, database and NATS publishing around it, so other services can embed it.
+//
+// A Collection keeps a Monitor for each vehicle. Each of a vehicle's positions is given to its Monitor with the
+// gtfs.TripInstance the position reports, and the Result holds the stop time observations made along with where
+// the vehicle was placed on its trip and what became of the position:
+//
+//	collection, err := vehiclemonitor.NewCollection(vehiclemonitor.Options{
+//		EarlyTolerance:        0.1,
+//		ExpirePositionSeconds: 900,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	for _, position := range positions {
+//		trip := lookupTrip(position) // nil when the position's trip isn't in the schedule
+//		result := collection.Vehicle(position.Id).NewPosition(position, trip)
+//		save(result.ObservedStopTimes)
+//	}
+//
+// Trips are loaded with their stop time instances and shapes, as by gtfs.GetTripInstances. Position timestamps are
+// unix seconds and shape distances are in the units of the schedule's shape_dist_traveled, assumed to be feet.
+// BlockDeviations turns a Result's TripStopPosition into gtfs.TripDeviation records for the trips on its block.
+package vehiclemonitor
@@ -0,0 +1,52 @@
+package vehiclemonitor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+)
+
+//earlyTolerancePolicy selects the earlyTolerance movement on a trip is checked against by the trip's route_type,
+//as rail keeps closer to its schedule between stops than buses in traffic
+type earlyTolerancePolicy struct {
+	defaultTolerance    float64
+	routeTypeTolerances map[int]float64
+}
+
+//makeEarlyTolerancePolicy builds earlyTolerancePolicy from defaultTolerance and routeTypeTolerances, a list of
+//route_type and tolerance separated by a colon, for example "0:0.2", overriding the default for the route_type
+func makeEarlyTolerancePolicy(defaultTolerance float64, routeTypeTolerances []string) (earlyTolerancePolicy, error) {
+	policy := earlyTolerancePolicy{
+		defaultTolerance:    defaultTolerance,
+		routeTypeTolerances: make(map[int]float64),
+	}
+	for _, value := range routeTypeTolerances {
+		routeTypeValue, toleranceValue, found := strings.Cut(value, ":")
+		if !found {
+			return policy, fmt.Errorf("expected route_type early tolerance as route_type:tolerance, found %q", value)
+		}
+		routeType, err := strconv.Atoi(routeTypeValue)
+		if err != nil {
+			return policy, fmt.Errorf("invalid route_type for early tolerance: %q", value)
+		}
+		tolerance, err := strconv.ParseFloat(toleranceValue, 64)
+		if err != nil || tolerance < 0 || tolerance > 1 {
+			return policy, fmt.Errorf("early tolerance for route_type %d must be between 0.0 and 1.0, found %q",
+				routeType, toleranceValue)
+		}
+		policy.routeTypeTolerances[routeType] = tolerance
+	}
+	return policy, nil
+}
+
+//tolerance returns the earlyTolerance for movement on trip
+func (p earlyTolerancePolicy) tolerance(trip *gtfs.TripInstance) float64 {
+	if trip.RouteType != nil {
+		if tolerance, present := p.routeTypeTolerances[*trip.RouteType]; present {
+			return tolerance
+		}
+	}
+	return p.defaultTolerance
+}
@@ -0,0 +1,43 @@
+package vehiclemonitor
+
+import (
+	"testing"
+
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+)
+
+func Test_earlyTolerancePolicy_tolerance(t *testing.T) {
+	policy, err := makeEarlyTolerancePolicy(0.1, []string{"0:0.2", "2:0.3"})
+	if err != nil {
+		t.Fatalf("makeEarlyTolerancePolicy() error = %v", err)
+	}
+	lightRail := 0
+	commuterRail := 2
+	bus := 3
+	tests := []struct {
+		name      string
+		routeType *int
+		want      float64
+	}{
+		{name: "light rail", routeType: &lightRail, want: 0.2},
+		{name: "commuter rail", routeType: &commuterRail, want: 0.3},
+		{name: "bus uses default", routeType: &bus, want: 0.1},
+		{name: "unknown route type uses default", want: 0.1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trip := &gtfs.TripInstance{Trip: gtfs.Trip{RouteType: tt.routeType}}
+			if got := policy.tolerance(trip); got != tt.want {
+				t.Errorf("tolerance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_makeEarlyTolerancePolicy_invalid(t *testing.T) {
+	for _, routeTypeTolerance := range []string{"0", "rail:0.2", "0:strict", "0:1.5", "0:-0.1"} {
+		if _, err := makeEarlyTolerancePolicy(0.1, []string{routeTypeTolerance}); err == nil {
+			t.Errorf("makeEarlyTolerancePolicy(%q) expected error", routeTypeTolerance)
+		}
+	}
+}
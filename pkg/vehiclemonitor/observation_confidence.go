@@ -0,0 +1,69 @@
+package vehiclemonitor
+
+import "math"
+
+const (
+	// unobservedStopConfidence multiplies confidence for each stop of a gtfs.ObservedStopTime the vehicle wasn't
+	// seen at, as the time it passed the stop is estimated from positions before and after it
+	unobservedStopConfidence = 0.8
+	// interpolatedPairConfidence multiplies confidence for each stop pair beyond the first that the travel between
+	// two positions was divided between by schedule
+	interpolatedPairConfidence = 0.9
+	// assumedDepartureConfidence multiplies confidence when the vehicle wasn't seen before departing the first stop
+	// of its trip and its departure was assumed from its delay
+	assumedDepartureConfidence = 0.8
+	// unplacedPositionConfidence multiplies confidence for each of the two positions that couldn't be placed on the
+	// trip's shape, having no GPS location or one too far from the shape, leaving travel to the stop unmeasured
+	unplacedPositionConfidence = 0.9
+	// minimumConfidence is the least confidence given, so a scored observation is never mistaken for one not scored
+	minimumConfidence = 0.01
+)
+
+// movementConfidence holds what is known about the movement between two positions that affects the confidence
+// of every gtfs.ObservedStopTime made from it
+type movementConfidence struct {
+	//stopPairs is the number of stop pairs travel was divided between
+	stopPairs int
+	//assumedDeparture is true when departure from the trip's first stop was assumed
+	assumedDeparture bool
+	//unplacedPositions is the number of the two positions without a distance along the trip's shape
+	unplacedPositions int
+}
+
+// makeMovementConfidence builds movementConfidence for the movement from lastTripStopPosition to
+// newTripStopPosition over stopPairs
+func makeMovementConfidence(lastTripStopPosition *TripStopPosition,
+	newTripStopPosition *TripStopPosition,
+	stopPairs int,
+	assumedDeparture bool) movementConfidence {
+	result := movementConfidence{
+		stopPairs:        stopPairs,
+		assumedDeparture: assumedDeparture,
+	}
+	for _, position := range []*TripStopPosition{lastTripStopPosition, newTripStopPosition} {
+		if position.tripDistancePosition == nil {
+			result.unplacedPositions++
+		}
+	}
+	return result
+}
+
+// score returns the confidence from minimumConfidence to 1.0 of a gtfs.ObservedStopTime made from the movement,
+// whose vehicle was or wasn't seen at each of its stops
+func (m movementConfidence) score(observedAtStop bool, observedAtNextStop bool) float64 {
+	confidence := 1.0
+	if !observedAtStop {
+		confidence *= unobservedStopConfidence
+	}
+	if !observedAtNextStop {
+		confidence *= unobservedStopConfidence
+	}
+	if m.stopPairs > 1 {
+		confidence *= math.Pow(interpolatedPairConfidence, float64(m.stopPairs-1))
+	}
+	if m.assumedDeparture {
+		confidence *= assumedDepartureConfidence
+	}
+	confidence *= math.Pow(unplacedPositionConfidence, float64(m.unplacedPositions))
+	return math.Max(math.Round(confidence*1000)/1000, minimumConfidence)
+}
@@ -0,0 +1,60 @@
+package vehiclemonitor
+
+import "testing"
+
+func Test_movementConfidence_score(t *testing.T) {
+	tests := []struct {
+		name               string
+		movement           movementConfidence
+		observedAtStop     bool
+		observedAtNextStop bool
+		want               float64
+	}{
+		{
+			name:               "seen at both stops between consecutive positions",
+			movement:           movementConfidence{stopPairs: 1},
+			observedAtStop:     true,
+			observedAtNextStop: true,
+			want:               1,
+		},
+		{
+			name:           "not seen at next stop",
+			movement:       movementConfidence{stopPairs: 1},
+			observedAtStop: true,
+			want:           0.8,
+		},
+		{
+			name:     "interpolated over three stop pairs without being seen at either stop",
+			movement: movementConfidence{stopPairs: 3},
+			want:     0.518,
+		},
+		{
+			name:               "departure assumed and neither position placed on shape",
+			movement:           movementConfidence{stopPairs: 1, assumedDeparture: true, unplacedPositions: 2},
+			observedAtStop:     true,
+			observedAtNextStop: true,
+			want:               0.648,
+		},
+		{
+			name:     "never less than minimum confidence",
+			movement: movementConfidence{stopPairs: 100, assumedDeparture: true, unplacedPositions: 2},
+			want:     minimumConfidence,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.movement.score(tt.observedAtStop, tt.observedAtNextStop); got != tt.want {
+				t.Errorf("score() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_makeMovementConfidence(t *testing.T) {
+	distance := 100.0
+	got := makeMovementConfidence(&TripStopPosition{tripDistancePosition: &distance}, &TripStopPosition{}, 2, true)
+	want := movementConfidence{stopPairs: 2, assumedDeparture: true, unplacedPositions: 1}
+	if got != want {
+		t.Errorf("makeMovementConfidence() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,28 @@
+package vehiclemonitor
+
+// Outcome describes what a Monitor made of a Position
+type Outcome string
+
+const (
+	// OutcomeUnchanged positions repeat the vehicle's last position
+	OutcomeUnchanged Outcome = "unchanged"
+	// OutcomeStale positions are older than the vehicle's last position by more than Options.StaleToleranceSeconds
+	OutcomeStale Outcome = "dropped_stale"
+	// OutcomeNotOnTrip positions are missing a trip_id, both stop_sequence and stop_id, or stop status
+	OutcomeNotOnTrip Outcome = "not_on_trip"
+	// OutcomeTripNotFound positions are on a trip_id not in the schedule in effect
+	OutcomeTripNotFound Outcome = "trip_not_in_schedule"
+	// OutcomeStopNotFound positions couldn't be placed at a stop_sequence on their trip, or their stop_id isn't on it
+	OutcomeStopNotFound Outcome = "stop_not_found"
+	// OutcomeDeadhead positions are from a vehicle that has left its trip's shape
+	OutcomeDeadhead Outcome = "deadhead"
+	// OutcomeWrongDirection positions are from a vehicle travelling its trip against the direction of the trip's shape
+	OutcomeWrongDirection Outcome = "wrong_direction"
+	// OutcomeNoStopPassed positions are at or approaching the same stop as the vehicle's last position, or are the
+	// first position seen on the trip
+	OutcomeNoStopPassed Outcome = "no_stop_passed"
+	// OutcomeMovementNotBelievable positions would mean the vehicle travelled between stops implausibly quickly
+	OutcomeMovementNotBelievable Outcome = "movement_not_believable"
+	// OutcomeObserved positions produced stop time observations
+	OutcomeObserved Outcome = "observed"
+)
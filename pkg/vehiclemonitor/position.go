@@ -0,0 +1,113 @@
+package vehiclemonitor
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// Position contains fields read from a GTFS-RT vehicle activity feed.
+// fields that are optional are pointers and will be nil if they were not present in the feed
+type Position struct {
+	Id                string
+	Label             string
+	Timestamp         int64
+	TripId            *string
+	RouteId           *string
+	Latitude          *float32
+	Longitude         *float32
+	Bearing           *float32
+	VehicleStopStatus VehicleStopStatus
+	StopSequence      *uint32
+	StopId            *string
+}
+
+// positionIsSame returns true unless any position related differences are seen in other Position
+// secondsTolerance allows for some skew in the Position.Timestamp, due to slight variations
+// typically a few seconds, between service calls to VehiclePosition service being handled by different servers
+// which may have received the position a few seconds apart
+func (v *Position) positionIsSame(v2 *Position, secondsTolerance int64) bool {
+	if v == nil {
+		return v2 == nil
+	} else if v2 == nil {
+		return false
+	}
+	if v.Id != v2.Id || v.VehicleStopStatus != v2.VehicleStopStatus {
+		return false
+	}
+	if v.Timestamp-v2.Timestamp > secondsTolerance {
+		return false
+	}
+	if v.StopSequence != nil && v2.StopSequence != nil && *v.StopSequence != *v2.StopSequence {
+		return false
+	}
+	if v.Latitude != nil && v2.Latitude != nil && *v.Latitude != *v2.Latitude {
+		return false
+	}
+	if v.Longitude != nil && v2.Longitude != nil && *v.Longitude != *v2.Longitude {
+		return false
+	}
+
+	return true
+}
+
+// String implements Stringer interface for Position
+func (v *Position) String() string {
+	var buffer bytes.Buffer
+	buffer.WriteString("Position{ id:")
+	buffer.WriteString(v.Id)
+	buffer.WriteString(", Label:\"")
+	buffer.WriteString(v.Label)
+	buffer.WriteString("\", TripId:")
+	if v.TripId == nil {
+		buffer.WriteString("unknown")
+	} else {
+		buffer.WriteString(*v.TripId)
+	}
+	buffer.WriteString(", previousStopSequence:")
+	if v.StopSequence == nil {
+		buffer.WriteString("unknown")
+	} else {
+		buffer.WriteString(strconv.FormatInt(int64(*v.StopSequence), 10))
+	}
+	buffer.WriteString(", StopPosition:")
+	buffer.WriteString(v.VehicleStopStatus.String())
+	buffer.WriteString(", Timestamp: ")
+	buffer.WriteString(strconv.FormatInt(v.Timestamp, 10))
+	buffer.WriteString(" }")
+	return buffer.String()
+}
+
+// VehicleStopStatus defines the possible relationship a vehicle has to a stop in GTFS
+type VehicleStopStatus int
+
+const (
+	Unknown VehicleStopStatus = -1
+	// IncomingAt indicates vehicle is just about to arrive at the stop (on a stop
+	// display, the vehicle symbol typically flashes).
+	IncomingAt VehicleStopStatus = 0
+	// StoppedAt indicates vehicle is at the stop.
+	StoppedAt VehicleStopStatus = 1
+	// InTransitTo indicates vehicle has departed a previous stop and is in transit to the next stop.
+	InTransitTo VehicleStopStatus = 2
+)
+
+// String - Stringer interface for VehicleStopStatus
+func (s *VehicleStopStatus) String() string {
+	if s == nil {
+		return "unknown"
+	}
+	switch *s {
+	case IncomingAt:
+		return "INCOMING_AT"
+	case StoppedAt:
+		return "STOPPED_AT"
+	case InTransitTo:
+		return "IN_TRANSIT_TO"
+	}
+	return "Unknown"
+}
+
+// IsUnknown convenience method to test for unknown VehicleStopStatus
+func (s *VehicleStopStatus) IsUnknown() bool {
+	return *s == Unknown
+}
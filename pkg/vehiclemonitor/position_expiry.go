@@ -0,0 +1,62 @@
+package vehiclemonitor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+)
+
+//expiryPolicy selects how old a vehicle's previous position can be and still be used by the route_type of the trip
+//it was on, as rail vehicles can wait at terminals longer than buses
+type expiryPolicy struct {
+	defaultSeconds   int64
+	routeTypeSeconds map[int]int64
+}
+
+//makeExpiryPolicy builds expiryPolicy from defaultSeconds and routeTypeSeconds, a list of route_type and seconds
+//separated by a colon, for example "2:3600", overriding the default for the route_type
+func makeExpiryPolicy(defaultSeconds int, routeTypeSeconds []string) (expiryPolicy, error) {
+	policy := expiryPolicy{
+		defaultSeconds:   int64(defaultSeconds),
+		routeTypeSeconds: make(map[int]int64),
+	}
+	for _, value := range routeTypeSeconds {
+		routeTypeValue, secondsValue, found := strings.Cut(value, ":")
+		if !found {
+			return policy, fmt.Errorf("expected route_type position expiry as route_type:seconds, found %q", value)
+		}
+		routeType, err := strconv.Atoi(routeTypeValue)
+		if err != nil {
+			return policy, fmt.Errorf("invalid route_type for position expiry: %q", value)
+		}
+		seconds, err := strconv.ParseInt(secondsValue, 10, 64)
+		if err != nil || seconds <= 0 {
+			return policy, fmt.Errorf("position expiry for route_type %d must be a positive number of seconds, "+
+				"found %q", routeType, secondsValue)
+		}
+		policy.routeTypeSeconds[routeType] = seconds
+	}
+	return policy, nil
+}
+
+//seconds returns how old a previous position on trip can be and still be used
+func (p expiryPolicy) seconds(trip *gtfs.TripInstance) int64 {
+	if trip.RouteType != nil {
+		if seconds, present := p.routeTypeSeconds[*trip.RouteType]; present {
+			return seconds
+		}
+	}
+	return p.defaultSeconds
+}
+
+//isLayoverPosition returns true if position is stopped at the first or last stop of its trip, where vehicles wait
+//between trips. The vehicle's previous position doesn't expire while it continues to report from a layover
+func isLayoverPosition(position *TripStopPosition) bool {
+	if !position.atPreviousStop {
+		return false
+	}
+	return position.previousSTI.FirstStop ||
+		position.previousSTI.StopSequence == getLastStopTimeSequenceOnTrip(position.tripInstance)
+}
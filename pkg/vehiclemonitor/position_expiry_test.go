@@ -0,0 +1,129 @@
+package vehiclemonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+)
+
+func Test_expiryPolicy_seconds(t *testing.T) {
+	policy, err := makeExpiryPolicy(900, []string{"0:1800", "2:3600"})
+	if err != nil {
+		t.Fatalf("makeExpiryPolicy() error = %v", err)
+	}
+	lightRail := 0
+	commuterRail := 2
+	bus := 3
+	tests := []struct {
+		name      string
+		routeType *int
+		want      int64
+	}{
+		{name: "light rail", routeType: &lightRail, want: 1800},
+		{name: "commuter rail", routeType: &commuterRail, want: 3600},
+		{name: "bus uses default", routeType: &bus, want: 900},
+		{name: "unknown route type uses default", want: 900},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trip := &gtfs.TripInstance{Trip: gtfs.Trip{RouteType: tt.routeType}}
+			if got := policy.seconds(trip); got != tt.want {
+				t.Errorf("seconds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_makeExpiryPolicy_invalid(t *testing.T) {
+	for _, routeTypeSeconds := range []string{"0", "rail:1800", "0:long", "0:0", "0:-60"} {
+		if _, err := makeExpiryPolicy(900, []string{routeTypeSeconds}); err == nil {
+			t.Errorf("makeExpiryPolicy(%q) expected error", routeTypeSeconds)
+		}
+	}
+}
+
+func TestMonitor_layoverPausesExpiry(t *testing.T) {
+	serviceDate := time.Date(2019, 12, 11, 0, 0, 0, 0, time.UTC)
+	testTrips := getTestTrips(serviceDate, t)
+	trip := getTestTrip(testTrips, strPtr("9529801"), t)
+	at := func(seconds int) int64 {
+		return serviceDate.Unix() + int64(seconds)
+	}
+	commuterRail := 2
+	railTrip := *trip
+	railTrip.RouteType = &commuterRail
+
+	tests := []struct {
+		name string
+		trip *gtfs.TripInstance
+		//stopSequence the vehicle waits at, reporting from it every reportEverySeconds, or not at all when zero
+		stopSequence       uint32
+		stopId             string
+		reportEverySeconds int
+		//wantKept is true when the vehicle's arrival at the stop is still its current position after waiting
+		wantKept bool
+	}{
+		{
+			name:               "reporting on layover at last stop",
+			trip:               trip,
+			stopSequence:       47,
+			stopId:             "8359",
+			reportEverySeconds: 300,
+			wantKept:           true,
+		},
+		{
+			name:         "silent at last stop",
+			trip:         trip,
+			stopSequence: 47,
+			stopId:       "8359",
+		},
+		{
+			name:               "reporting stopped between first and last stop",
+			trip:               trip,
+			stopSequence:       46,
+			stopId:             trip.StopTimeInstances[45].StopId,
+			reportEverySeconds: 300,
+		},
+		{
+			name:         "silent on route_type with longer expiry",
+			trip:         &railTrip,
+			stopSequence: 47,
+			stopId:       "8359",
+			wantKept:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collection, err := NewCollection(Options{
+				EarlyTolerance:                 0.2,
+				ExpirePositionSeconds:          900,
+				RouteTypeExpirePositionSeconds: []string{"2:3600"},
+			})
+			if err != nil {
+				t.Fatalf("NewCollection() error = %v", err)
+			}
+			vm := collection.Vehicle("1")
+			arrival := tt.trip.StopTimeInstances[tt.stopSequence-1].ArrivalTime
+			vm.newPosition(makeVehiclePositionStopId(tt.trip.TripId, tt.stopSequence-1, StoppedAt, at(arrival-120),
+				tt.trip.StopTimeInstances[tt.stopSequence-2].StopId), tt.trip)
+			vm.newPosition(makeVehiclePositionStopId(tt.trip.TripId, tt.stopSequence, StoppedAt, at(arrival),
+				tt.stopId), tt.trip)
+			// wait 22 minutes, as between the test trips on their block
+			waitUntil := arrival + 22*60
+			if tt.reportEverySeconds > 0 {
+				for seconds := arrival + tt.reportEverySeconds; seconds < waitUntil; seconds += tt.reportEverySeconds {
+					vm.newPosition(makeVehiclePositionStopId(tt.trip.TripId, tt.stopSequence, StoppedAt, at(seconds),
+						tt.stopId), tt.trip)
+				}
+			}
+			if vm.lastTripStopPosition == nil {
+				t.Fatalf("vehicle has no position after waiting")
+			}
+			kept := vm.lastTripStopPosition.lastTimestamp == at(arrival) && !vm.isCurrentPositionExpired(at(waitUntil))
+			if kept != tt.wantKept {
+				t.Errorf("arrival kept after waiting = %v, want %v", kept, tt.wantKept)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package vehiclemonitor
+
+import (
+	"math"
+	"sort"
+)
+
+// Smoothing configures how a Monitor removes noise from AVL feeds that repeat positions with new
+// timestamps or jitter coordinates by a few meters
+type Smoothing struct {
+	//MinimumMovementMeters is how far a vehicle must move from its last position before a new position on the same
+	//trip and stop is used. zero or less disables the check
+	MinimumMovementMeters float64
+	//DistanceMedianWindow is the number of recent distances along the trip a vehicle's distance is the median of.
+	//one or less disables the median filter
+	DistanceMedianWindow int
+}
+
+// isRepeatedPosition returns true if position is on the same trip, stop and status as lastPosition and has moved less
+// than MinimumMovementMeters from it. Positions without coordinates are never considered repeated
+func (s Smoothing) isRepeatedPosition(lastPosition *Position, position *Position) bool {
+	if s.MinimumMovementMeters <= 0 || lastPosition == nil {
+		return false
+	}
+	if !stringPtrsEqual(lastPosition.TripId, position.TripId) ||
+		lastPosition.StopSequence == nil || position.StopSequence == nil ||
+		*lastPosition.StopSequence != *position.StopSequence ||
+		lastPosition.VehicleStopStatus != position.VehicleStopStatus {
+		return false
+	}
+	if lastPosition.Latitude == nil || lastPosition.Longitude == nil ||
+		position.Latitude == nil || position.Longitude == nil {
+		return false
+	}
+	moved := simpleLatLngDistance(float64(*lastPosition.Latitude), float64(*lastPosition.Longitude),
+		float64(*position.Latitude), float64(*position.Longitude))
+	return moved < s.MinimumMovementMeters
+}
+
+// stringPtrsEqual returns true if both a and b are nil or point to the same value
+func stringPtrsEqual(a *string, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// distanceMedianFilter keeps recent distances along a trip for a vehicle and replaces a new TripStopPosition's
+// tripDistancePosition with the median of them
+type distanceMedianFilter struct {
+	window          int
+	tripId          string
+	recentDistances []float64
+}
+
+func makeDistanceMedianFilter(window int) *distanceMedianFilter {
+	return &distanceMedianFilter{window: window}
+}
+
+// smooth replaces position.tripDistancePosition with the median of the recent distances on the same trip, kept between
+// the stops the vehicle is between. Positions at a stop are left alone since their distance is exact, but are
+// remembered for the following positions. A nil distanceMedianFilter leaves the position unchanged
+func (f *distanceMedianFilter) smooth(position *TripStopPosition) {
+	if f == nil || f.window <= 1 {
+		return
+	}
+	if position.tripDistancePosition == nil {
+		f.recentDistances = f.recentDistances[:0]
+		return
+	}
+	if position.tripInstance.TripId != f.tripId {
+		f.tripId = position.tripInstance.TripId
+		f.recentDistances = f.recentDistances[:0]
+	}
+	f.recentDistances = append(f.recentDistances, *position.tripDistancePosition)
+	if len(f.recentDistances) > f.window {
+		f.recentDistances = f.recentDistances[len(f.recentDistances)-f.window:]
+	}
+	if position.atPreviousStop {
+		return
+	}
+	smoothed := math.Max(position.previousSTI.ShapeDistTraveled,
+		math.Min(position.nextSTI.ShapeDistTraveled, median(f.recentDistances)))
+	position.tripDistancePosition = &smoothed
+}
+
+// median returns the median of values without modifying it
+func median(values []float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
@@ -0,0 +1,116 @@
+package vehiclemonitor
+
+import (
+	"testing"
+
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+)
+
+func Test_positionSmoothing_isRepeatedPosition(t *testing.T) {
+	makePosition := func(tripId string, stopSequence uint32, status VehicleStopStatus, lat, lon float32) *Position {
+		return &Position{
+			Id:                "1",
+			TripId:            &tripId,
+			StopSequence:      &stopSequence,
+			VehicleStopStatus: status,
+			Latitude:          &lat,
+			Longitude:         &lon,
+		}
+	}
+	last := makePosition("A", 2, InTransitTo, 45.5, -122.6)
+	smoothing := Smoothing{MinimumMovementMeters: 5}
+	tests := []struct {
+		name      string
+		smoothing Smoothing
+		last      *Position
+		position  *Position
+		want      bool
+	}{
+		{
+			name:      "no last position",
+			smoothing: smoothing,
+			position:  last,
+			want:      false,
+		},
+		{
+			name:      "jitter of a couple meters",
+			smoothing: smoothing,
+			last:      last,
+			position:  makePosition("A", 2, InTransitTo, 45.50002, -122.6),
+			want:      true,
+		},
+		{
+			name:      "moved twenty meters",
+			smoothing: smoothing,
+			last:      last,
+			position:  makePosition("A", 2, InTransitTo, 45.50018, -122.6),
+			want:      false,
+		},
+		{
+			name:      "stopped at next stop",
+			smoothing: smoothing,
+			last:      last,
+			position:  makePosition("A", 2, StoppedAt, 45.5, -122.6),
+			want:      false,
+		},
+		{
+			name:      "new trip",
+			smoothing: smoothing,
+			last:      last,
+			position:  makePosition("B", 2, InTransitTo, 45.5, -122.6),
+			want:      false,
+		},
+		{
+			name:     "disabled",
+			last:     last,
+			position: makePosition("A", 2, InTransitTo, 45.5, -122.6),
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.smoothing.isRepeatedPosition(tt.last, tt.position); got != tt.want {
+				t.Errorf("isRepeatedPosition() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_distanceMedianFilter_smooth(t *testing.T) {
+	trip := &gtfs.TripInstance{Trip: gtfs.Trip{TripId: "A"}}
+	otherTrip := &gtfs.TripInstance{Trip: gtfs.Trip{TripId: "B"}}
+	previousSTI := &gtfs.StopTimeInstance{StopTime: gtfs.StopTime{ShapeDistTraveled: 1000}}
+	nextSTI := &gtfs.StopTimeInstance{StopTime: gtfs.StopTime{ShapeDistTraveled: 2000}}
+
+	filter := makeDistanceMedianFilter(3)
+	tests := []struct {
+		name     string
+		trip     *gtfs.TripInstance
+		distance float64
+		atStop   bool
+		want     float64
+	}{
+		{name: "first position", trip: trip, distance: 1000, atStop: true, want: 1000},
+		{name: "median of two", trip: trip, distance: 1200, want: 1100},
+		{name: "jitter backwards", trip: trip, distance: 1150, want: 1150},
+		{name: "outlier removed", trip: trip, distance: 1900, want: 1200},
+		{name: "new trip resets", trip: otherTrip, distance: 1500, want: 1500},
+		{name: "clamped to previous stop", trip: otherTrip, distance: 0, want: 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distance := tt.distance
+			position := TripStopPosition{
+				tripInstance:         tt.trip,
+				previousSTI:          previousSTI,
+				nextSTI:              nextSTI,
+				atPreviousStop:       tt.atStop,
+				tripDistancePosition: &distance,
+			}
+			filter.smooth(&position)
+			if *position.tripDistancePosition != tt.want {
+				t.Errorf("smooth() distance = %v, want %v", *position.tripDistancePosition, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package vehiclemonitor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"math"
+	"sort"
+	"sync"
+)
+
+// simplifyToleranceMeters is the furthest a shape point may be from the simplified shape before it's kept
+const simplifyToleranceMeters = 1.0
+
+// maximumShapeMatchMeters is the furthest a vehicle can be from its trip's shape and still be placed on it
+const maximumShapeMatchMeters = 200.0
+
+// rTreeNodeCapacity is the number of segments or child nodes in each shapeIndex node
+const rTreeNodeCapacity = 16
+
+// shapeIndexes holds a shapeIndex for each shape on the current data set, shared by all vehicle monitors
+var shapeIndexes = makeShapeIndexCache()
+
+// shapeSegment is the line between two consecutive points of a simplified shape and their distances along it
+type shapeSegment struct {
+	startLat, startLon float64
+	endLat, endLon     float64
+	startDist, endDist float64
+	minLat, minLon     float64
+	maxLat, maxLon     float64
+}
+
+// rTreeNode is a node of a shapeIndex bounding either segments, at the leaves, or child nodes
+type rTreeNode struct {
+	minLat, minLon float64
+	maxLat, maxLon float64
+	children       []*rTreeNode
+	segments       []*shapeSegment
+}
+
+// intersects returns true if the node's bounds overlap the box
+func (n *rTreeNode) intersects(minLat, minLon, maxLat, maxLon float64) bool {
+	return n.minLat <= maxLat && n.maxLat >= minLat && n.minLon <= maxLon && n.maxLon >= minLon
+}
+
+// shapeIndex is an R-tree of the segments of a simplified shape, finding the segments near a location in
+// O(log n) time rather than comparing the location with every point on the shape
+type shapeIndex struct {
+	root *rTreeNode
+}
+
+// makeShapeIndex builds shapeIndex from shapes, the points of a single shape in ShapePtSequence order.
+// returns nil if any point is missing ShapeDistTraveled
+func makeShapeIndex(shapes []*gtfs.Shape) *shapeIndex {
+	for _, shape := range shapes {
+		if shape.ShapeDistTraveled == nil {
+			return nil
+		}
+	}
+	points := simplifyShape(shapes, simplifyToleranceMeters)
+	if len(points) < 2 {
+		return nil
+	}
+	segments := make([]*shapeSegment, 0, len(points)-1)
+	for i := 1; i < len(points); i++ {
+		start := points[i-1]
+		end := points[i]
+		segments = append(segments, &shapeSegment{
+			startLat:  start.ShapePtLat,
+			startLon:  start.ShapePtLng,
+			endLat:    end.ShapePtLat,
+			endLon:    end.ShapePtLng,
+			startDist: *start.ShapeDistTraveled,
+			endDist:   *end.ShapeDistTraveled,
+			minLat:    math.Min(start.ShapePtLat, end.ShapePtLat),
+			minLon:    math.Min(start.ShapePtLng, end.ShapePtLng),
+			maxLat:    math.Max(start.ShapePtLat, end.ShapePtLat),
+			maxLon:    math.Max(start.ShapePtLng, end.ShapePtLng),
+		})
+	}
+	return &shapeIndex{root: packRTree(segments)}
+}
+
+// packRTree builds an R-tree over segments with sort-tile-recursive packing
+func packRTree(segments []*shapeSegment) *rTreeNode {
+	var nodes []*rTreeNode
+	for _, tile := range sortTileRecursive(len(segments), func(i int) (float64, float64) {
+		return (segments[i].minLat + segments[i].maxLat) / 2, (segments[i].minLon + segments[i].maxLon) / 2
+	}) {
+		node := &rTreeNode{}
+		for _, i := range tile {
+			node.segments = append(node.segments, segments[i])
+		}
+		node.minLat, node.minLon, node.maxLat, node.maxLon = node.segments[0].minLat, node.segments[0].minLon,
+			node.segments[0].maxLat, node.segments[0].maxLon
+		for _, segment := range node.segments {
+			node.extend(segment.minLat, segment.minLon, segment.maxLat, segment.maxLon)
+		}
+		nodes = append(nodes, node)
+	}
+	for len(nodes) > 1 {
+		level := nodes
+		nodes = nil
+		for _, tile := range sortTileRecursive(len(level), func(i int) (float64, float64) {
+			return (level[i].minLat + level[i].maxLat) / 2, (level[i].minLon + level[i].maxLon) / 2
+		}) {
+			node := &rTreeNode{}
+			for _, i := range tile {
+				node.children = append(node.children, level[i])
+			}
+			first := node.children[0]
+			node.minLat, node.minLon, node.maxLat, node.maxLon = first.minLat, first.minLon, first.maxLat, first.maxLon
+			for _, child := range node.children {
+				node.extend(child.minLat, child.minLon, child.maxLat, child.maxLon)
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes[0]
+}
+
+// extend grows the node's bounds to include the box
+func (n *rTreeNode) extend(minLat, minLon, maxLat, maxLon float64) {
+	n.minLat = math.Min(n.minLat, minLat)
+	n.minLon = math.Min(n.minLon, minLon)
+	n.maxLat = math.Max(n.maxLat, maxLat)
+	n.maxLon = math.Max(n.maxLon, maxLon)
+}
+
+// sortTileRecursive groups count items with centers into tiles of at most rTreeNodeCapacity, first dividing items into
+// vertical slices by longitude then each slice by latitude, so each tile covers a compact area
+func sortTileRecursive(count int, center func(i int) (float64, float64)) [][]int {
+	indexes := make([]int, count)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.Slice(indexes, func(a, b int) bool {
+		_, lonA := center(indexes[a])
+		_, lonB := center(indexes[b])
+		return lonA < lonB
+	})
+	tileCount := int(math.Ceil(float64(count) / rTreeNodeCapacity))
+	sliceSize := int(math.Ceil(math.Sqrt(float64(tileCount)))) * rTreeNodeCapacity
+	var tiles [][]int
+	for sliceStart := 0; sliceStart < count; sliceStart += sliceSize {
+		slice := indexes[sliceStart:int(math.Min(float64(sliceStart+sliceSize), float64(count)))]
+		sort.Slice(slice, func(a, b int) bool {
+			latA, _ := center(slice[a])
+			latB, _ := center(slice[b])
+			return latA < latB
+		})
+		for tileStart := 0; tileStart < len(slice); tileStart += rTreeNodeCapacity {
+			tileEnd := int(math.Min(float64(tileStart+rTreeNodeCapacity), float64(len(slice))))
+			tiles = append(tiles, slice[tileStart:tileEnd])
+		}
+	}
+	return tiles
+}
+
+// findDistance finds the nearest point within maximumShapeMatchMeters of lat, lon on the part of the shape between
+// fromDist and toDist, returning the distance along the shape of that point in feet, or nil when there is none
+func (s *shapeIndex) findDistance(lat, lon, fromDist, toDist float64) *float64 {
+	latMargin := maximumShapeMatchMeters / 111300
+	lonMargin := maximumShapeMatchMeters / (111300 * math.Cos(lat*math.Pi/180))
+	minLat, minLon, maxLat, maxLon := lat-latMargin, lon-lonMargin, lat+latMargin, lon+lonMargin
+
+	var best *shapeSegment
+	var bestLat, bestLon float64
+	bestMeters := maximumShapeMatchMeters
+	stack := []*rTreeNode{s.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !node.intersects(minLat, minLon, maxLat, maxLon) {
+			continue
+		}
+		stack = append(stack, node.children...)
+		for _, segment := range node.segments {
+			if segment.endDist < fromDist || segment.startDist > toDist ||
+				segment.minLat > maxLat || segment.maxLat < minLat ||
+				segment.minLon > maxLon || segment.maxLon < minLon {
+				continue
+			}
+			snappedLat, snappedLon := nearestLatLngToLineFromPoint(segment.startLat, segment.startLon,
+				segment.endLat, segment.endLon, lat, lon)
+			meters := simpleLatLngDistance(snappedLat, snappedLon, lat, lon)
+			if meters < bestMeters || (meters == bestMeters && best != nil && segment.startDist < best.startDist) {
+				best = segment
+				bestLat, bestLon = snappedLat, snappedLon
+				bestMeters = meters
+			}
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	// interpolate along the segment as simplification may have removed points between its ends
+	segmentMeters := simpleLatLngDistance(best.startLat, best.startLon, best.endLat, best.endLon)
+	result := best.startDist
+	if segmentMeters > 0 {
+		portion := simpleLatLngDistance(best.startLat, best.startLon, bestLat, bestLon) / segmentMeters
+		result += portion * (best.endDist - best.startDist)
+	}
+	result = math.Min(math.Max(result, fromDist), toDist)
+	return &result
+}
+
+// simplifyShape removes points from shapes, the points of a single shape in order, that are within toleranceMeters of
+// the line between the points kept around them, using the Douglas-Peucker algorithm
+func simplifyShape(shapes []*gtfs.Shape, toleranceMeters float64) []*gtfs.Shape {
+	if len(shapes) < 3 {
+		return shapes
+	}
+	keep := make([]bool, len(shapes))
+	keep[0] = true
+	keep[len(shapes)-1] = true
+	type span struct{ first, last int }
+	spans := []span{{0, len(shapes) - 1}}
+	for len(spans) > 0 {
+		current := spans[len(spans)-1]
+		spans = spans[:len(spans)-1]
+		first := shapes[current.first]
+		last := shapes[current.last]
+		furthest := -1
+		furthestMeters := toleranceMeters
+		for i := current.first + 1; i < current.last; i++ {
+			snappedLat, snappedLon := nearestLatLngToLineFromPoint(first.ShapePtLat, first.ShapePtLng,
+				last.ShapePtLat, last.ShapePtLng, shapes[i].ShapePtLat, shapes[i].ShapePtLng)
+			meters := simpleLatLngDistance(snappedLat, snappedLon, shapes[i].ShapePtLat, shapes[i].ShapePtLng)
+			if meters > furthestMeters {
+				furthest = i
+				furthestMeters = meters
+			}
+		}
+		if furthest >= 0 {
+			keep[furthest] = true
+			spans = append(spans, span{current.first, furthest}, span{furthest, current.last})
+		}
+	}
+	simplified := make([]*gtfs.Shape, 0)
+	for i, shape := range shapes {
+		if keep[i] {
+			simplified = append(simplified, shape)
+		}
+	}
+	return simplified
+}
+
+// shapeIndexCache builds a shapeIndex for each shape the first time it's needed and keeps it while its data set is
+// current. Safe for concurrent use
+type shapeIndexCache struct {
+	mu        sync.Mutex
+	dataSetId int64
+	indexes   map[string]*shapeIndex
+}
+
+// makeShapeIndexCache builds shapeIndexCache
+func makeShapeIndexCache() *shapeIndexCache {
+	return &shapeIndexCache{
+		mu:      sync.Mutex{},
+		indexes: make(map[string]*shapeIndex),
+	}
+}
+
+// get returns the shapeIndex for trip's shape, or nil if the shape can't be indexed.
+// indexes for older data sets are discarded once a trip on a newer data set is seen
+func (c *shapeIndexCache) get(trip *gtfs.TripInstance) *shapeIndex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if trip.DataSetId > c.dataSetId {
+		c.dataSetId = trip.DataSetId
+		c.indexes = make(map[string]*shapeIndex)
+	}
+	if trip.DataSetId < c.dataSetId {
+		// trips still running on a replaced data set are rare, don't replace the current data set's indexes
+		return makeShapeIndex(trip.Shapes)
+	}
+	index, present := c.indexes[trip.ShapeId]
+	if !present {
+		index = makeShapeIndex(trip.Shapes)
+		c.indexes[trip.ShapeId] = index
+	}
+	return index
+}
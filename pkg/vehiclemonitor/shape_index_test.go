@@ -0,0 +1,80 @@
+package vehiclemonitor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"math"
+	"testing"
+)
+
+func Test_shapeIndex_findDistance(t *testing.T) {
+	trip := getFirstTestTripFromJson("trip_10958023_2021_08_20.json", t)
+	index := makeShapeIndex(trip.Shapes)
+	if index == nil {
+		t.Fatalf("makeShapeIndex() returned nil for shape with distances")
+	}
+	// compare with scanning every shape point for the middle of each segment between each pair of stops
+	for i := 1; i < len(trip.StopTimeInstances); i++ {
+		from := trip.StopTimeInstances[i-1].ShapeDistTraveled
+		to := trip.StopTimeInstances[i].ShapeDistTraveled
+		shapes := trip.ShapesBetweenDistances(from, to)
+		for j := 1; j < len(shapes); j++ {
+			lat := (shapes[j-1].ShapePtLat + shapes[j].ShapePtLat) / 2
+			lon := (shapes[j-1].ShapePtLng + shapes[j].ShapePtLng) / 2
+			want := findLineDistanceInFeet(lat, lon, shapes)
+			got := index.findDistance(lat, lon, from, to)
+			if want == nil || got == nil {
+				if want != got {
+					t.Errorf("stop %d point %d findDistance() = %v, want %v", i, j, got, want)
+				}
+				continue
+			}
+			// simplification moves the shape by up to a meter, interpolating along the simplified segment instead
+			if math.Abs(*got-*want) > 10 {
+				t.Errorf("stop %d point %d findDistance() = %v, want %v", i, j, *got, *want)
+			}
+		}
+	}
+	if got := index.findDistance(45.0, -123.0, 0, math.MaxFloat64); got != nil {
+		t.Errorf("findDistance() far from shape = %v, want nil", *got)
+	}
+}
+
+func Test_simplifyShape(t *testing.T) {
+	makeShape := func(lat, lon float64) *gtfs.Shape {
+		return &gtfs.Shape{ShapePtLat: lat, ShapePtLng: lon}
+	}
+	shapes := []*gtfs.Shape{
+		makeShape(45.5, -122.68),
+		makeShape(45.500001, -122.675), // about 10 centimeters off the line
+		makeShape(45.5, -122.67),
+		makeShape(45.51, -122.67), // corner
+		makeShape(45.52, -122.67),
+	}
+	simplified := simplifyShape(shapes, simplifyToleranceMeters)
+	want := []*gtfs.Shape{shapes[0], shapes[2], shapes[4]}
+	if len(simplified) != len(want) {
+		t.Fatalf("simplifyShape() kept %d points, want %d", len(simplified), len(want))
+	}
+	for i := range want {
+		if simplified[i] != want[i] {
+			t.Errorf("simplifyShape() point %d = %v, want %v", i, simplified[i], want[i])
+		}
+	}
+}
+
+func Test_shapeIndexCache_get(t *testing.T) {
+	cache := makeShapeIndexCache()
+	trip := getFirstTestTripFromJson("trip_10958023_2021_08_20.json", t)
+	first := cache.get(trip)
+	if first == nil || cache.get(trip) != first {
+		t.Errorf("get() did not reuse the index built for the shape")
+	}
+	newer := *trip
+	newer.DataSetId = trip.DataSetId + 1
+	if cache.get(&newer) == first {
+		t.Errorf("get() reused index from an older data set")
+	}
+	if _, present := cache.indexes[trip.ShapeId]; !present || cache.dataSetId != newer.DataSetId {
+		t.Errorf("get() did not keep index for newest data set")
+	}
+}
@@ -0,0 +1,110 @@
+package vehiclemonitor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+)
+
+//resolveStopSequence returns the stop_sequence on trip that position is placed at, false if none can be found.
+//Agencies can add stops to a trip that aren't in the schedule, so when position's stop_sequence isn't on the trip it's
+//snapped to the trip's stop with position's stop_id, otherwise to one of the scheduled stops either side of it
+func resolveStopSequence(trip *gtfs.TripInstance, position *Position) (uint32, bool) {
+	reported := *position.StopSequence
+	var preceding, following *gtfs.StopTimeInstance
+	for _, sti := range trip.StopTimeInstances {
+		if sti.StopSequence == reported {
+			return reported, true
+		}
+		if sti.StopSequence < reported {
+			preceding = sti
+		} else if following == nil {
+			following = sti
+		}
+	}
+	if sti := findStopTimeByStopId(trip, position.StopId, reported); sti != nil {
+		return sti.StopSequence, true
+	}
+	if preceding == nil && following == nil {
+		return 0, false
+	}
+	if preceding == nil {
+		return following.StopSequence, true
+	}
+	if following == nil {
+		return preceding.StopSequence, true
+	}
+	//a vehicle approaching the added stop is between the scheduled stops either side of it
+	if position.VehicleStopStatus == InTransitTo {
+		return following.StopSequence, true
+	}
+	return nearestStopTimeByProjection(trip, position, preceding, following).StopSequence, true
+}
+
+//findStopTimeByStopId returns the gtfs.StopTimeInstance on trip at stopId, choosing the one with the closest
+//stop_sequence to stopSequence on trips visiting stopId more than once. Returns nil if stopId isn't on trip
+func findStopTimeByStopId(trip *gtfs.TripInstance, stopId *string, stopSequence uint32) *gtfs.StopTimeInstance {
+	if stopId == nil {
+		return nil
+	}
+	var result *gtfs.StopTimeInstance
+	var resultGap uint32
+	for _, sti := range trip.StopTimeInstances {
+		if sti.StopId != *stopId {
+			continue
+		}
+		gap := sti.StopSequence - stopSequence
+		if sti.StopSequence < stopSequence {
+			gap = stopSequence - sti.StopSequence
+		}
+		if result == nil || gap < resultGap {
+			result = sti
+			resultGap = gap
+		}
+	}
+	return result
+}
+
+//nearestStopTimeByProjection returns whichever of preceding and following is closest to position, projected onto
+//trip's shape between them. Returns preceding, the stop the vehicle has surely reached, when position can't be
+//projected onto the shape
+func nearestStopTimeByProjection(trip *gtfs.TripInstance,
+	position *Position,
+	preceding *gtfs.StopTimeInstance,
+	following *gtfs.StopTimeInstance) *gtfs.StopTimeInstance {
+	if position.Latitude == nil || position.Longitude == nil || len(trip.Shapes) == 0 {
+		return preceding
+	}
+	shapes := trip.ShapesBetweenDistances(preceding.ShapeDistTraveled, following.ShapeDistTraveled)
+	distance := findLineDistanceInFeet(float64(*position.Latitude), float64(*position.Longitude), shapes)
+	if distance == nil {
+		return preceding
+	}
+	if following.ShapeDistTraveled-*distance < *distance-preceding.ShapeDistTraveled {
+		return following
+	}
+	return preceding
+}
+
+//findStopSequenceByStopId returns the stop_sequence of stopId on trip, for feeds reporting a vehicle's stop_id without
+//its stop_sequence. On trips visiting stopId more than once the visit scheduled closest to timestamp is chosen.
+//Returns false if stopId isn't on trip
+func findStopSequenceByStopId(trip *gtfs.TripInstance, stopId string, timestamp int64) (uint32, bool) {
+	var result *gtfs.StopTimeInstance
+	var resultGap int64
+	for _, sti := range trip.StopTimeInstances {
+		if sti.StopId != stopId {
+			continue
+		}
+		gap := sti.ArrivalDateTime.Unix() - timestamp
+		if gap < 0 {
+			gap = -gap
+		}
+		if result == nil || gap < resultGap {
+			result = sti
+			resultGap = gap
+		}
+	}
+	if result == nil {
+		return 0, false
+	}
+	return result.StopSequence, true
+}
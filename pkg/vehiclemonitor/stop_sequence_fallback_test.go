@@ -0,0 +1,178 @@
+package vehiclemonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+)
+
+func Test_resolveStopSequence(t *testing.T) {
+	scheduledTrip := getFirstTestTripFromJson("trip_10900607_2021_07_22.json", t)
+	//stop_sequence 2 is missing from the schedule, as if the agency added a stop between stop_sequences 1 and 3
+	trip := *scheduledTrip
+	trip.StopTimeInstances = []*gtfs.StopTimeInstance{scheduledTrip.StopTimeInstances[0],
+		scheduledTrip.StopTimeInstances[2], scheduledTrip.StopTimeInstances[3]}
+	tripId := trip.TripId
+	position := func(stopSequence uint32, status VehicleStopStatus, stopId string) Position {
+		return makeVehiclePositionStopId(tripId, stopSequence, status, 0, stopId)
+	}
+	positionAt := func(stopSequence uint32, status VehicleStopStatus, lat float32, lon float32) Position {
+		return makeVehiclePositionStopIdLL(tripId, stopSequence, status, 0, "added", lat, lon)
+	}
+	tests := []struct {
+		name      string
+		trip      *gtfs.TripInstance
+		position  Position
+		want      uint32
+		wantFound bool
+	}{
+		{
+			name:      "stop_sequence on trip",
+			trip:      &trip,
+			position:  position(3, StoppedAt, "13890"),
+			want:      3,
+			wantFound: true,
+		},
+		{
+			name:      "snapped to stop_id",
+			trip:      &trip,
+			position:  position(2, StoppedAt, "12902"),
+			want:      4,
+			wantFound: true,
+		},
+		{
+			name:      "in transit to added stop snaps to following stop",
+			trip:      &trip,
+			position:  position(2, InTransitTo, "added"),
+			want:      3,
+			wantFound: true,
+		},
+		{
+			name:      "stopped at added stop closer to preceding stop",
+			trip:      &trip,
+			position:  positionAt(2, StoppedAt, 45.426881, -122.489068),
+			want:      1,
+			wantFound: true,
+		},
+		{
+			name:      "stopped at added stop closer to following stop",
+			trip:      &trip,
+			position:  positionAt(2, StoppedAt, 45.427066, -122.496697),
+			want:      3,
+			wantFound: true,
+		},
+		{
+			name:      "stopped at added stop without location snaps to preceding stop",
+			trip:      &trip,
+			position:  position(2, StoppedAt, "added"),
+			want:      1,
+			wantFound: true,
+		},
+		{
+			name:      "after last stop",
+			trip:      &trip,
+			position:  position(9, StoppedAt, "added"),
+			want:      4,
+			wantFound: true,
+		},
+		{
+			name:      "before first stop",
+			trip:      &trip,
+			position:  position(0, InTransitTo, "added"),
+			want:      1,
+			wantFound: true,
+		},
+		{
+			name:     "trip without stops",
+			trip:     &gtfs.TripInstance{},
+			position: position(2, StoppedAt, "added"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := resolveStopSequence(tt.trip, &tt.position)
+			if got != tt.want || found != tt.wantFound {
+				t.Errorf("resolveStopSequence() = %v, %v, want %v, %v", got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+func Test_findStopTimeByStopId_loopTrip(t *testing.T) {
+	trip := &gtfs.TripInstance{
+		StopTimeInstances: []*gtfs.StopTimeInstance{
+			{StopTime: gtfs.StopTime{StopSequence: 1, StopId: "A"}},
+			{StopTime: gtfs.StopTime{StopSequence: 2, StopId: "B"}},
+			{StopTime: gtfs.StopTime{StopSequence: 4, StopId: "A"}},
+		},
+	}
+	if got := findStopTimeByStopId(trip, strPtr("A"), 3); got == nil || got.StopSequence != 4 {
+		t.Errorf("findStopTimeByStopId() = %+v, want stop_sequence 4", got)
+	}
+	if got := findStopTimeByStopId(trip, strPtr("C"), 3); got != nil {
+		t.Errorf("findStopTimeByStopId() = %+v, want nil", got)
+	}
+}
+
+func Test_findStopSequenceByStopId(t *testing.T) {
+	serviceDate := time.Date(2021, 10, 14, 0, 0, 0, 0, time.UTC)
+	loopTrip := &gtfs.TripInstance{
+		StopTimeInstances: []*gtfs.StopTimeInstance{
+			{StopTime: gtfs.StopTime{StopSequence: 1, StopId: "A"}, ArrivalDateTime: serviceDate.Add(time.Hour)},
+			{StopTime: gtfs.StopTime{StopSequence: 2, StopId: "B"}, ArrivalDateTime: serviceDate.Add(70 * time.Minute)},
+			{StopTime: gtfs.StopTime{StopSequence: 3, StopId: "A"}, ArrivalDateTime: serviceDate.Add(80 * time.Minute)},
+		},
+	}
+	tests := []struct {
+		name      string
+		stopId    string
+		at        time.Time
+		want      uint32
+		wantFound bool
+	}{
+		{name: "stop visited once", stopId: "B", at: serviceDate.Add(time.Hour), want: 2, wantFound: true},
+		{name: "first visit closest in schedule", stopId: "A", at: serviceDate.Add(65 * time.Minute), want: 1,
+			wantFound: true},
+		{name: "second visit closest in schedule", stopId: "A", at: serviceDate.Add(78 * time.Minute), want: 3,
+			wantFound: true},
+		{name: "stop not on trip", stopId: "C", at: serviceDate.Add(time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := findStopSequenceByStopId(loopTrip, tt.stopId, tt.at.Unix())
+			if got != tt.want || found != tt.wantFound {
+				t.Errorf("findStopSequenceByStopId() = %v, %v, want %v, %v", got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestMonitor_newPosition_stopIdWithoutStopSequence(t *testing.T) {
+	serviceDate := time.Date(2019, 12, 11, 0, 0, 0, 0, time.UTC)
+	trip := getTestTrip(getTestTrips(serviceDate, t), strPtr("9529801"), t)
+	position := func(stopId string, timestamp int64) Position {
+		return Position{
+			Id:                "1",
+			Timestamp:         timestamp,
+			TripId:            &trip.TripId,
+			VehicleStopStatus: StoppedAt,
+			StopId:            &stopId,
+		}
+	}
+	first := trip.StopTimeInstances[8]
+	second := trip.StopTimeInstances[10]
+	vm := makeVehicleMonitor("1", earlyTolerancePolicy{defaultTolerance: 0.1}, 900, Smoothing{})
+	vm.newPosition(position(first.StopId, first.ArrivalDateTime.Unix()), trip)
+	_, observations := vm.newPosition(position(second.StopId, second.ArrivalDateTime.Unix()), trip)
+	if vm.lastOutcome != OutcomeObserved || len(observations) != 2 {
+		t.Errorf("newPosition() outcome = %s with %d observations, want %s with 2", vm.lastOutcome,
+			len(observations), OutcomeObserved)
+	}
+
+	vm.newPosition(position("not on trip", second.ArrivalDateTime.Unix()+60), trip)
+	if vm.lastOutcome != OutcomeStopNotFound || vm.lastTripStopPosition != nil {
+		t.Errorf("newPosition() outcome = %s, want %s with the vehicle's position removed", vm.lastOutcome,
+			OutcomeStopNotFound)
+	}
+}
@@ -0,0 +1,50 @@
+package vehiclemonitor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"sync"
+)
+
+// stopPair identifies travel from stopId to nextStopId
+type stopPair struct {
+	stopId     string
+	nextStopId string
+}
+
+// TravelBounds holds the least time a vehicle can plausibly take to travel between stop pairs, computed from
+// observed travel times. Movement between pairs with a bound is checked against it in place of the early tolerance.
+// TravelBounds is safe for concurrent use, so bounds can be replaced while Monitors use them. A nil TravelBounds
+// has no bounds
+type TravelBounds struct {
+	mu               sync.RWMutex
+	minTravelSeconds map[stopPair]int64
+}
+
+// NewTravelBounds builds TravelBounds holding bounds
+func NewTravelBounds(bounds []gtfs.StopPairTravelBound) *TravelBounds {
+	t := &TravelBounds{}
+	t.Replace(bounds)
+	return t
+}
+
+// Replace swaps all current bounds for bounds
+func (t *TravelBounds) Replace(bounds []gtfs.StopPairTravelBound) {
+	minTravelSeconds := make(map[stopPair]int64, len(bounds))
+	for _, bound := range bounds {
+		minTravelSeconds[stopPair{stopId: bound.StopId, nextStopId: bound.NextStopId}] = int64(bound.MinTravelSeconds)
+	}
+	t.mu.Lock()
+	t.minTravelSeconds = minTravelSeconds
+	t.mu.Unlock()
+}
+
+// minTravel returns the least plausible seconds of travel from stopId to nextStopId, and false when there is no bound
+func (t *TravelBounds) minTravel(stopId string, nextStopId string) (int64, bool) {
+	if t == nil {
+		return 0, false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	seconds, present := t.minTravelSeconds[stopPair{stopId: stopId, nextStopId: nextStopId}]
+	return seconds, present
+}
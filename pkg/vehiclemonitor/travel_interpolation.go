@@ -0,0 +1,79 @@
+package vehiclemonitor
+
+import "fmt"
+
+// travelInterpolation selects how travel time between two positions is split between the stop pairs passed
+type travelInterpolation string
+
+const (
+	// interpolateBySchedule splits travel in proportion to each stop pair's scheduled time
+	interpolateBySchedule travelInterpolation = "schedule"
+	// interpolateByDistance splits travel in proportion to each stop pair's shape distance travelled at its
+	// scheduled speed, with scheduled speeds kept near the average so padding in the schedule has less effect
+	interpolateByDistance travelInterpolation = "distance"
+)
+
+const (
+	// minimumSpeedProfileFactor is the least a stop pair's scheduled speed can be relative to the average scheduled
+	// speed of all stop pairs passed when interpolating by distance
+	minimumSpeedProfileFactor = 0.5
+	// maximumSpeedProfileFactor is the most a stop pair's scheduled speed can be relative to the average scheduled
+	// speed of all stop pairs passed when interpolating by distance
+	maximumSpeedProfileFactor = 2.0
+)
+
+// makeTravelInterpolation returns the travelInterpolation named by name, "schedule" or "distance"
+func makeTravelInterpolation(name string) (travelInterpolation, error) {
+	switch interpolation := travelInterpolation(name); interpolation {
+	case interpolateBySchedule, interpolateByDistance:
+		return interpolation, nil
+	}
+	return "", fmt.Errorf("unknown travel interpolation %q, expected %q or %q", name, interpolateBySchedule,
+		interpolateByDistance)
+}
+
+// segmentShares returns the share of travel time given to each of stopPairs, summing to 1.0, or nil when travel
+// is split by schedule with getSegmentTravelPortion. Interpolating by distance falls back to the schedule when
+// stopPairs lack increasing shape distances or scheduled times
+func (i travelInterpolation) segmentShares(stopPairs []StopTimePair) []float64 {
+	if i != interpolateByDistance || len(stopPairs) < 2 {
+		return nil
+	}
+	totalDistance := 0.0
+	totalScheduled := 0.0
+	for _, pair := range stopPairs {
+		distance := pair.to.ShapeDistTraveled - pair.from.ShapeDistTraveled
+		if distance < 0 {
+			return nil
+		}
+		totalDistance += distance
+		totalScheduled += float64(pair.to.ArrivalTime - pair.from.ArrivalTime)
+	}
+	if totalDistance <= 0 || totalScheduled <= 0 {
+		return nil
+	}
+	averageSpeed := totalDistance / totalScheduled
+	minimumSpeed := averageSpeed * minimumSpeedProfileFactor
+	maximumSpeed := averageSpeed * maximumSpeedProfileFactor
+
+	shares := make([]float64, len(stopPairs))
+	total := 0.0
+	for index, pair := range stopPairs {
+		distance := pair.to.ShapeDistTraveled - pair.from.ShapeDistTraveled
+		speed := maximumSpeed
+		if scheduled := float64(pair.to.ArrivalTime - pair.from.ArrivalTime); scheduled > 0 {
+			speed = distance / scheduled
+		}
+		if speed < minimumSpeed {
+			speed = minimumSpeed
+		} else if speed > maximumSpeed {
+			speed = maximumSpeed
+		}
+		shares[index] = distance / speed
+		total += shares[index]
+	}
+	for index := range shares {
+		shares[index] /= total
+	}
+	return shares
+}
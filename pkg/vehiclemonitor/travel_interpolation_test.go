@@ -0,0 +1,97 @@
+package vehiclemonitor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"math"
+	"testing"
+)
+
+func Test_makeTravelInterpolation(t *testing.T) {
+	for _, name := range []string{"schedule", "distance"} {
+		if got, err := makeTravelInterpolation(name); err != nil || string(got) != name {
+			t.Errorf("makeTravelInterpolation(%q) = %q, %v", name, got, err)
+		}
+	}
+	if _, err := makeTravelInterpolation("speed"); err == nil {
+		t.Errorf("makeTravelInterpolation(\"speed\") expected error")
+	}
+}
+
+func Test_travelInterpolation_segmentShares(t *testing.T) {
+	// makePairs builds consecutive StopTimePairs from stop distances and arrival times
+	makePairs := func(distances []float64, arrivals []int) []StopTimePair {
+		var pairs []StopTimePair
+		for i := 0; i+1 < len(distances); i++ {
+			pairs = append(pairs, StopTimePair{
+				from: gtfs.StopTimeInstance{StopTime: gtfs.StopTime{ShapeDistTraveled: distances[i],
+					ArrivalTime: arrivals[i]}},
+				to: gtfs.StopTimeInstance{StopTime: gtfs.StopTime{ShapeDistTraveled: distances[i+1],
+					ArrivalTime: arrivals[i+1]}},
+			})
+		}
+		return pairs
+	}
+	tests := []struct {
+		name          string
+		interpolation travelInterpolation
+		stopPairs     []StopTimePair
+		want          []float64
+	}{
+		{
+			name:          "split by schedule",
+			interpolation: interpolateBySchedule,
+			stopPairs:     makePairs([]float64{0, 1200, 1500}, []int{0, 100, 800}),
+			want:          nil,
+		},
+		{
+			name:          "constant scheduled speed splits by distance",
+			interpolation: interpolateByDistance,
+			stopPairs:     makePairs([]float64{0, 100, 300}, []int{0, 10, 30}),
+			want:          []float64{1.0 / 3.0, 2.0 / 3.0},
+		},
+		{
+			name:          "padded stop pair limited to half of average scheduled speed",
+			interpolation: interpolateByDistance,
+			stopPairs:     makePairs([]float64{0, 1200, 1500}, []int{0, 100, 800}),
+			want:          []float64{0.5, 0.5},
+		},
+		{
+			name:          "stop pair without scheduled time travelled at the most speed",
+			interpolation: interpolateByDistance,
+			stopPairs:     makePairs([]float64{0, 100, 200, 300}, []int{0, 20, 20, 40}),
+			want:          []float64{3.0 / 7.0, 1.0 / 7.0, 3.0 / 7.0},
+		},
+		{
+			name:          "single stop pair",
+			interpolation: interpolateByDistance,
+			stopPairs:     makePairs([]float64{0, 100}, []int{0, 10}),
+			want:          nil,
+		},
+		{
+			name:          "decreasing shape distance falls back to schedule",
+			interpolation: interpolateByDistance,
+			stopPairs:     makePairs([]float64{0, 100, 50}, []int{0, 10, 20}),
+			want:          nil,
+		},
+		{
+			name:          "missing shape distances fall back to schedule",
+			interpolation: interpolateByDistance,
+			stopPairs:     makePairs([]float64{0, 0, 0}, []int{0, 10, 20}),
+			want:          nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.interpolation.segmentShares(tt.stopPairs)
+			if len(got) != len(tt.want) {
+				t.Fatalf("segmentShares() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+					t.Errorf("segmentShares() = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
@@ -1,15 +1,15 @@
-package monitor
+package vehiclemonitor
 
 import (
 	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
 	"math"
 )
 
-//findTripDistanceOfVehicleFromPosition if possible find how far along the pattern a vehicle is from tripStopPosition.
-//requires that tripStopPosition contain longitude and latitude
+//findTripDistanceOfVehicleFromPosition if possible find how far along the pattern a vehicle is from TripStopPosition.
+//requires that TripStopPosition contain longitude and latitude
 //and gtfs.StopTimeInstance to have ShapeDistTraveled populated
 //and gtfs.Shape to have ShapeDistTraveled populated
-func findTripDistanceOfVehicleFromPosition(position *tripStopPosition) *float64 {
+func findTripDistanceOfVehicleFromPosition(position *TripStopPosition) *float64 {
 	//if coordinates are not present can't continue
 	if position.latitude == nil || position.longitude == nil {
 		return nil
@@ -22,6 +22,11 @@ func findTripDistanceOfVehicleFromPosition(position *tripStopPosition) *float64
 	if position.atPreviousStop {
 		return &position.previousSTI.ShapeDistTraveled
 	}
+	//search the shape's spatial index when it can be built, otherwise scan the shape between the stops
+	if index := shapeIndexes.get(position.tripInstance); index != nil {
+		return index.findDistance(float64(*position.latitude), float64(*position.longitude),
+			position.previousSTI.ShapeDistTraveled, position.nextSTI.ShapeDistTraveled)
+	}
 	shapes := position.tripInstance.ShapesBetweenDistances(position.previousSTI.ShapeDistTraveled, position.nextSTI.ShapeDistTraveled)
 	return findLineDistanceInFeet(float64(*position.latitude), float64(*position.longitude), shapes)
 
@@ -1,4 +1,4 @@
-package monitor
+package vehiclemonitor
 
 import (
 	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
@@ -14,13 +14,13 @@ func Test_findTripDistanceOfVehicleFromPosition(t *testing.T) {
 
 	tests := []struct {
 		name      string
-		position  tripStopPosition
+		position  TripStopPosition
 		want      *float64
 		tolerance float64
 	}{
 		{
 			name: "find a short distance from stop",
-			position: tripStopPosition{
+			position: TripStopPosition{
 				atPreviousStop: false,
 				tripInstance:   testTripOne,
 				previousSTI:    stopOne,
@@ -33,7 +33,7 @@ func Test_findTripDistanceOfVehicleFromPosition(t *testing.T) {
 		},
 		{
 			name: "Missing lat produces no result",
-			position: tripStopPosition{
+			position: TripStopPosition{
 				atPreviousStop: false,
 				tripInstance:   testTripOne,
 				previousSTI:    stopOne,
@@ -44,7 +44,7 @@ func Test_findTripDistanceOfVehicleFromPosition(t *testing.T) {
 		},
 		{
 			name: "directly on top of stop",
-			position: tripStopPosition{
+			position: TripStopPosition{
 				atPreviousStop: false,
 				tripInstance:   testTripOne,
 				previousSTI:    stopOne,
@@ -57,7 +57,7 @@ func Test_findTripDistanceOfVehicleFromPosition(t *testing.T) {
 		},
 		{
 			name: "vehicle at a stop has no distance from that stop",
-			position: tripStopPosition{
+			position: TripStopPosition{
 				atPreviousStop: true,
 				tripInstance:   testTripOne,
 				previousSTI:    stopOne,
@@ -70,7 +70,7 @@ func Test_findTripDistanceOfVehicleFromPosition(t *testing.T) {
 		},
 		{
 			name: "vehicle close to next stop",
-			position: tripStopPosition{
+			position: TripStopPosition{
 				atPreviousStop: false,
 				tripInstance:   testTripOne,
 				previousSTI:    stopTwo,
@@ -83,7 +83,7 @@ func Test_findTripDistanceOfVehicleFromPosition(t *testing.T) {
 		},
 		{
 			name: "vehicle too far from line produces no result",
-			position: tripStopPosition{
+			position: TripStopPosition{
 				atPreviousStop: false,
 				tripInstance:   testTripOne,
 				previousSTI:    stopTwo,
@@ -95,7 +95,7 @@ func Test_findTripDistanceOfVehicleFromPosition(t *testing.T) {
 		},
 		{
 			name: "vehicle beyond end of pattern is no further away than last position on pattern",
-			position: tripStopPosition{
+			position: TripStopPosition{
 				atPreviousStop: false,
 				tripInstance:   testTripOne,
 				previousSTI:    stopTwo,
@@ -108,7 +108,7 @@ func Test_findTripDistanceOfVehicleFromPosition(t *testing.T) {
 		},
 		{
 			name: "approximately in the middle of stops",
-			position: tripStopPosition{
+			position: TripStopPosition{
 				atPreviousStop: false,
 				tripInstance:   testTripOne,
 				previousSTI:    stopTwo,
@@ -321,3 +321,43 @@ func Test_calculateDelay(t *testing.T) {
 		})
 	}
 }
+
+func Benchmark_findTripDistanceOfVehicleFromPosition(b *testing.B) {
+	trip := getFirstTestTripFromJson("trip_10958023_2021_08_20.json", b)
+	// a position in the middle of the shape between each pair of stops
+	var positions []TripStopPosition
+	for i := 1; i < len(trip.StopTimeInstances); i++ {
+		previousSTI := trip.StopTimeInstances[i-1]
+		nextSTI := trip.StopTimeInstances[i]
+		shapes := trip.ShapesBetweenDistances(previousSTI.ShapeDistTraveled, nextSTI.ShapeDistTraveled)
+		if len(shapes) < 2 {
+			continue
+		}
+		middle := len(shapes) / 2
+		positions = append(positions, TripStopPosition{
+			tripInstance: trip,
+			previousSTI:  previousSTI,
+			nextSTI:      nextSTI,
+			latitude:     float32Ptr(float32((shapes[middle-1].ShapePtLat + shapes[middle].ShapePtLat) / 2)),
+			longitude:    float32Ptr(float32((shapes[middle-1].ShapePtLng + shapes[middle].ShapePtLng) / 2)),
+		})
+	}
+	b.Run("shape index", func(b *testing.B) {
+		// build the trip's cached index before timing
+		findTripDistanceOfVehicleFromPosition(&positions[0])
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			findTripDistanceOfVehicleFromPosition(&positions[n%len(positions)])
+		}
+	})
+	b.Run("shape scan", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			position := &positions[n%len(positions)]
+			shapes := trip.ShapesBetweenDistances(position.previousSTI.ShapeDistTraveled,
+				position.nextSTI.ShapeDistTraveled)
+			findLineDistanceInFeet(float64(*position.latitude), float64(*position.longitude), shapes)
+		}
+	})
+}
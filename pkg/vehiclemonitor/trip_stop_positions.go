@@ -1,4 +1,4 @@
-package monitor
+package vehiclemonitor
 
 import (
 	"fmt"
@@ -7,8 +7,9 @@ import (
 	"time"
 )
 
-//tripStopPosition is used by vehicleMonitor to keep track of vehicle movement between updated positions
-type tripStopPosition struct {
+//TripStopPosition is used by Monitor to keep track of vehicle movement between updated positions, and is where a
+//Result placed the vehicle on its trip
+type TripStopPosition struct {
 	dataSetId int64
 
 	vehicleId string
@@ -19,7 +20,7 @@ type tripStopPosition struct {
 	//witnessedPreviousStop indicates that we have seen the vehicle at or prior to previousSTI
 	witnessedPreviousStop bool
 
-	//tripInstance is always populated from the vehiclePosition's tripId
+	//tripInstance is always populated from the Position's tripId
 	tripInstance *gtfs.TripInstance
 
 	//previousSTI is the stop this trip that we are at or just passed
@@ -28,13 +29,13 @@ type tripStopPosition struct {
 	//nextSTI is the stop this trip that we are headed towards (or at in the case where we are at the last stop of the trip)
 	nextSTI *gtfs.StopTimeInstance
 
-	//lastTimestamp the timestamp of the vehiclePosition this tripStopPosition was created from
+	//lastTimestamp the timestamp of the Position this TripStopPosition was created from
 	lastTimestamp int64
 
-	//latitude optionally included if present in vehiclePosition
+	//latitude optionally included if present in Position
 	latitude *float32
 
-	//longitude optionally included if present in vehiclePosition
+	//longitude optionally included if present in Position
 	longitude *float32
 
 	//how delayed the vehicle is. Positive is late. Negative is early
@@ -52,8 +53,8 @@ type tripStopPosition struct {
 	observedSecondsToTravelToPosition int
 }
 
-//logFormat simple format for logging a tripStopPosition
-func (t *tripStopPosition) logFormat() string {
+//logFormat simple format for logging a TripStopPosition
+func (t *TripStopPosition) logFormat() string {
 	var lat float32
 	if t.latitude != nil {
 		lat = *t.latitude
@@ -63,17 +64,17 @@ func (t *tripStopPosition) logFormat() string {
 		lon = *t.longitude
 	}
 
-	return fmt.Sprintf("tripStopPosition{ tripId:%s, previousStop:(seq:%d id:%s secs:%d), nextStop:(seq:%d id:%s secs:%d), atPrevious:%t, latlng:%f,%f }",
+	return fmt.Sprintf("TripStopPosition{ tripId:%s, previousStop:(seq:%d id:%s secs:%d), nextStop:(seq:%d id:%s secs:%d), atPrevious:%t, latlng:%f,%f }",
 		t.tripInstance.TripId, t.previousSTI.StopSequence, t.previousSTI.StopId, t.previousSTI.ArrivalTime,
 		t.nextSTI.StopSequence, t.nextSTI.StopId, t.nextSTI.ArrivalTime,
 		t.atPreviousStop, lat, lon)
 }
 
-//collectBlockDeviations creates gtfs.TripDeviation for each trip the block in tripStopPosition.BlockId is currently on
-//or scheduled in the future
-func collectBlockDeviations(
+//BlockDeviations creates gtfs.TripDeviation for the trip position is on, and each trip in loadedTripInstancesByTripId
+//scheduled later on the same block. No deviations are made when position couldn't be placed on its trip's shape
+func BlockDeviations(
 	loadedTripInstancesByTripId map[string]*gtfs.TripInstance,
-	position *tripStopPosition) []*gtfs.TripDeviation {
+	position *TripStopPosition) []*gtfs.TripDeviation {
 	results := make([]*gtfs.TripDeviation, 0)
 	if position == nil || position.tripDistancePosition == nil {
 		return results
@@ -100,7 +101,7 @@ func collectBlockDeviations(
 	distanceToNextTrip := position.tripInstance.TripDistance - *position.tripDistancePosition
 	for _, futureTrip := range futureTrips {
 		results = append(results, makeTripDeviation(position, -distanceToNextTrip, futureTrip))
-		distanceToNextTrip += position.tripInstance.TripDistance - *position.tripDistancePosition
+		distanceToNextTrip += futureTrip.TripDistance
 	}
 
 	return results
@@ -108,7 +109,7 @@ func collectBlockDeviations(
 
 //makeTripDeviation creates new gtfs.TripDeviation for trip
 func makeTripDeviation(
-	position *tripStopPosition,
+	position *TripStopPosition,
 	tripProgress float64,
 	trip *gtfs.TripInstance) *gtfs.TripDeviation {
 	return &gtfs.TripDeviation{
@@ -120,5 +121,7 @@ func makeTripDeviation(
 		AtStop:             position.atPreviousStop,
 		Delay:              position.delay,
 		RouteId:            trip.RouteId,
+		ServiceDate:        trip.ServiceDate(),
+		ServiceException:   trip.ServiceException,
 	}
 }
@@ -1,4 +1,4 @@
-package monitor
+package vehiclemonitor
 
 import (
 	"fmt"
@@ -8,17 +8,24 @@ import (
 	"time"
 )
 
-func Test_collectBlockDeviations(t *testing.T) {
+func Test_BlockDeviations(t *testing.T) {
 	location, err := time.LoadLocation("America/Los_Angeles")
 	if err != nil {
 		t.Errorf("Unable to get testing time zone location")
 		return
 	}
-	testTrips := getTestTrips(time.Date(2021, 10, 14, 0, 0, 0, 0, location), t)
+	serviceDate := time.Date(2021, 10, 14, 0, 0, 0, 0, location)
+	testTrips := getTestTrips(serviceDate, t)
+	//interlinedTrip follows the test trips on the same block on another route
+	interlinedTrip := *testTrips[1]
+	interlinedTrip.TripId = "interlined"
+	interlinedTrip.RouteId = "90"
+	interlinedTrip.StartTime = testTrips[1].StartTime + 7200
+	tripsWithInterlinedTrip := append([]*gtfs.TripInstance{&interlinedTrip}, testTrips...)
 
 	type args struct {
 		tripInstances   []*gtfs.TripInstance
-		newTripPosition tripStopPosition
+		newTripPosition TripStopPosition
 	}
 	tests := []struct {
 		name string
@@ -29,7 +36,7 @@ func Test_collectBlockDeviations(t *testing.T) {
 			name: "Simple test at start of first trip",
 			args: args{
 				tripInstances: testTrips,
-				newTripPosition: tripStopPosition{
+				newTripPosition: TripStopPosition{
 					dataSetId:            testTrips[0].DataSetId,
 					vehicleId:            "200",
 					atPreviousStop:       true,
@@ -49,6 +56,7 @@ func Test_collectBlockDeviations(t *testing.T) {
 					AtStop:             true,
 					Delay:              50,
 					RouteId:            "100",
+					ServiceDate:        serviceDate,
 				},
 				{
 					DeviationTimestamp: testDate("2021-10-14T09:00:00-07:00"),
@@ -59,6 +67,7 @@ func Test_collectBlockDeviations(t *testing.T) {
 					AtStop:             true,
 					Delay:              50,
 					RouteId:            "100",
+					ServiceDate:        serviceDate,
 				},
 			},
 		},
@@ -66,7 +75,7 @@ func Test_collectBlockDeviations(t *testing.T) {
 			name: "Located about half way through first trip",
 			args: args{
 				tripInstances: testTrips,
-				newTripPosition: tripStopPosition{
+				newTripPosition: TripStopPosition{
 					dataSetId:            testTrips[0].DataSetId,
 					vehicleId:            "200",
 					atPreviousStop:       false,
@@ -86,6 +95,7 @@ func Test_collectBlockDeviations(t *testing.T) {
 					AtStop:             false,
 					Delay:              2,
 					RouteId:            "100",
+					ServiceDate:        serviceDate,
 				},
 				{
 					DeviationTimestamp: testDate("2021-10-14T09:44:00-07:00"),
@@ -96,6 +106,57 @@ func Test_collectBlockDeviations(t *testing.T) {
 					AtStop:             false,
 					Delay:              2,
 					RouteId:            "100",
+					ServiceDate:        serviceDate,
+				},
+			},
+		},
+		{
+			name: "Later trips on the block are behind each earlier trip",
+			args: args{
+				tripInstances: tripsWithInterlinedTrip,
+				newTripPosition: TripStopPosition{
+					dataSetId:            testTrips[0].DataSetId,
+					vehicleId:            "200",
+					atPreviousStop:       false,
+					tripInstance:         testTrips[0],
+					lastTimestamp:        testDate("2021-10-14T09:44:00-07:00").Unix(),
+					delay:                2,
+					tripDistancePosition: float64Ptr(85936.0),
+				},
+			},
+			want: []*gtfs.TripDeviation{
+				{
+					DeviationTimestamp: testDate("2021-10-14T09:44:00-07:00"),
+					TripProgress:       85936.0,
+					DataSetId:          testTrips[0].DataSetId,
+					TripId:             testTrips[0].TripId,
+					VehicleId:          "200",
+					AtStop:             false,
+					Delay:              2,
+					RouteId:            "100",
+					ServiceDate:        serviceDate,
+				},
+				{
+					DeviationTimestamp: testDate("2021-10-14T09:44:00-07:00"),
+					TripProgress:       -(testTrips[0].TripDistance - 85936.0),
+					DataSetId:          testTrips[0].DataSetId,
+					TripId:             testTrips[1].TripId,
+					VehicleId:          "200",
+					AtStop:             false,
+					Delay:              2,
+					RouteId:            "100",
+					ServiceDate:        serviceDate,
+				},
+				{
+					DeviationTimestamp: testDate("2021-10-14T09:44:00-07:00"),
+					TripProgress:       -(testTrips[0].TripDistance - 85936.0 + testTrips[1].TripDistance),
+					DataSetId:          testTrips[0].DataSetId,
+					TripId:             interlinedTrip.TripId,
+					VehicleId:          "200",
+					AtStop:             false,
+					Delay:              2,
+					RouteId:            "90",
+					ServiceDate:        serviceDate,
 				},
 			},
 		},
@@ -103,7 +164,7 @@ func Test_collectBlockDeviations(t *testing.T) {
 			name: "Located on second trip, ignore earlier trip",
 			args: args{
 				tripInstances: testTrips,
-				newTripPosition: tripStopPosition{
+				newTripPosition: TripStopPosition{
 					dataSetId:            testTrips[0].DataSetId,
 					vehicleId:            "200",
 					atPreviousStop:       false,
@@ -123,6 +184,7 @@ func Test_collectBlockDeviations(t *testing.T) {
 					AtStop:             false,
 					Delay:              2,
 					RouteId:            "100",
+					ServiceDate:        serviceDate,
 				},
 			},
 		},
@@ -133,7 +195,7 @@ func Test_collectBlockDeviations(t *testing.T) {
 			for _, trip := range tt.args.tripInstances {
 				loadedTripInstancesByTripId[trip.TripId] = trip
 			}
-			got := collectBlockDeviations(loadedTripInstancesByTripId, &tt.args.newTripPosition)
+			got := BlockDeviations(loadedTripInstancesByTripId, &tt.args.newTripPosition)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("collectTripDeviations() "+
 					"\ngot  = %+v,"+
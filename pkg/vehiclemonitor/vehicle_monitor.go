@@ -0,0 +1,797 @@
+package vehiclemonitor
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+)
+
+//Options configures the Monitors of a Collection
+type Options struct {
+	//EarlyTolerance is the least portion (between 0.0 and 1.0) of its scheduled time a vehicle can be observed to
+	//take travelling between stops before the movement is discarded as unlikely
+	EarlyTolerance float64
+	//RouteTypeEarlyTolerances override EarlyTolerance for trips on a route_type, each a route_type and tolerance
+	//separated by a colon, for example "0:0.2"
+	RouteTypeEarlyTolerances []string
+	//ExpirePositionSeconds is how old a vehicle's previous position can be and still be used to make
+	//gtfs.ObservedStopTime records with a new position. Positions don't expire while the vehicle continues to report
+	//stopped at the first or last stop of its trip on layover
+	ExpirePositionSeconds int
+	//RouteTypeExpirePositionSeconds override ExpirePositionSeconds for positions on trips with a route_type, each a
+	//route_type and seconds separated by a colon, for example "2:3600"
+	RouteTypeExpirePositionSeconds []string
+	//Smoothing removes noise from feeds that repeat or jitter positions
+	Smoothing Smoothing
+	//StaleToleranceSeconds is how much older than a vehicle's last position a position can be and still be used, at
+	//the last position's timestamp. Older positions are discarded
+	StaleToleranceSeconds int
+	//TravelBounds replaces EarlyTolerance for stop pairs with a bound. May be nil
+	TravelBounds *TravelBounds
+	//Interpolation is how travel between positions is split over the stop pairs passed, "schedule" (the default
+	//when empty) or "distance"
+	Interpolation string
+}
+
+//Collection retrieves and constructs the Monitor of each vehicle. A Collection is not safe for concurrent use, but
+//the Monitors of different vehicles can be used concurrently
+type Collection struct {
+	vehicles              map[string]*Monitor
+	earlyTolerance        earlyTolerancePolicy
+	expiry                expiryPolicy
+	smoothing             Smoothing
+	staleToleranceSeconds int64
+	travelBounds          *TravelBounds
+	interpolation         travelInterpolation
+}
+
+//NewCollection builds a Collection whose Monitors are configured by options, returning an error when options are
+//invalid
+func NewCollection(options Options) (*Collection, error) {
+	earlyTolerance, err := makeEarlyTolerancePolicy(options.EarlyTolerance, options.RouteTypeEarlyTolerances)
+	if err != nil {
+		return nil, err
+	}
+	expiry, err := makeExpiryPolicy(options.ExpirePositionSeconds, options.RouteTypeExpirePositionSeconds)
+	if err != nil {
+		return nil, err
+	}
+	if options.Interpolation == "" {
+		options.Interpolation = string(interpolateBySchedule)
+	}
+	interpolation, err := makeTravelInterpolation(options.Interpolation)
+	if err != nil {
+		return nil, err
+	}
+	return &Collection{
+		vehicles:              make(map[string]*Monitor),
+		earlyTolerance:        earlyTolerance,
+		expiry:                expiry,
+		smoothing:             options.Smoothing,
+		staleToleranceSeconds: int64(options.StaleToleranceSeconds),
+		travelBounds:          options.TravelBounds,
+		interpolation:         interpolation,
+	}, nil
+}
+
+//Vehicle returns the Monitor for vehicleId, making it the first time the vehicle is seen
+func (vc *Collection) Vehicle(vehicleId string) *Monitor {
+	if monitor, present := vc.vehicles[vehicleId]; present {
+		return monitor
+	}
+	monitor := makeVehicleMonitor(vehicleId, vc.earlyTolerance, vc.expiry.defaultSeconds, vc.smoothing)
+	monitor.expiry = vc.expiry
+	monitor.staleToleranceSeconds = vc.staleToleranceSeconds
+	monitor.travelBounds = vc.travelBounds
+	monitor.interpolation = vc.interpolation
+	vc.vehicles[vehicleId] = &monitor
+	return &monitor
+}
+
+//Monitor generates gtfs.ObservedStopTime records by watching subsequent Position records from gtfs
+type Monitor struct {
+	Id                   string
+	lastTripStopPosition *TripStopPosition
+	lastPosition         *Position
+	//earlyTolerance a percentage (should be between 0.0 and 1.0) of how early the vehicle can be observed to have traveled between two stops
+	//before and gtfs.ObservedStopTime is assumed to be invalid and shouldn't be returned.
+	//for example if a vehicle is observed to travel between two stops in 10 seconds, but the scheduled to take 100 seconds
+	//an earlyTolerance of 0.1 or lower would allow that observation to generate a gtfs.ObservedStopTime since the vehicle
+	//appears to have only taken 10 percent of the time it's scheduled to travel between the stops
+	//an earlyTolerance of 0.1 or higher would cause that observation to be discarded as invalid or unlikely
+	//the earlyTolerance used is selected by the route_type of the vehicle's trip
+	earlyTolerance earlyTolerancePolicy
+	//travelBounds replaces earlyTolerance for travel between stop pairs with enough observations to have a bound
+	travelBounds *TravelBounds
+	//interpolation splits travel between positions over the stop pairs passed, by schedule when empty
+	interpolation travelInterpolation
+	//expiry selects how old a previous vehicle position is in seconds before it will not be used
+	//to generate gtfs.ObservedStopTime, by the route_type of its trip
+	expiry expiryPolicy
+	//layoverSeenAt is the timestamp of the vehicle's latest position while on layover at lastTripStopPosition,
+	//which lastTripStopPosition doesn't expire from. Zero when the vehicle isn't on layover
+	layoverSeenAt int64
+	//smoothing controls which repeated positions are ignored
+	smoothing Smoothing
+	//distanceFilter smooths the vehicle's distance along its trip between positions
+	distanceFilter *distanceMedianFilter
+	//staleToleranceSeconds is how much older than lastPosition a position can be and still be used, at the timestamp
+	//of lastPosition
+	staleToleranceSeconds int64
+	//lastOutcome is what became of the last position given to newPosition, with lastOutcomeDetail explaining
+	//discarded positions where there is more to say than the outcome
+	lastOutcome       Outcome
+	lastOutcomeDetail string
+	//lastClampedToLast is true when the last position was older than lastPosition and moved to its timestamp
+	lastClampedToLast bool
+	//direction watches the vehicle's movement for travel against its trip's shape
+	direction directionCheck
+	//pendingAnomaly is set when an assignment anomaly is detected, until taken by takeAnomaly
+	pendingAnomaly *gtfs.VehicleAssignmentAnomaly
+	//deadhead follows the vehicle while it moves without a trip or off its trip's shape
+	deadhead deadheadTracker
+	//pendingDeadhead is set when a deadhead ends, until taken by takeDeadhead
+	pendingDeadhead *gtfs.VehicleDeadhead
+}
+
+func makeVehicleMonitor(Id string,
+	earlyTolerance earlyTolerancePolicy,
+	expirePositionSeconds int64,
+	smoothing Smoothing) Monitor {
+	return Monitor{Id: Id,
+		earlyTolerance: earlyTolerance,
+		expiry:         expiryPolicy{defaultSeconds: expirePositionSeconds},
+		smoothing:      smoothing,
+		distanceFilter: makeDistanceMedianFilter(smoothing.DistanceMedianWindow)}
+}
+
+//Result is what a Monitor made of a Position
+type Result struct {
+	//TripStopPosition is where the vehicle was placed on its trip, nil when the position wasn't used
+	TripStopPosition *TripStopPosition
+	//ObservedStopTimes are made when the vehicle is seen to have passed stops since its last position
+	ObservedStopTimes []*gtfs.ObservedStopTime
+	//Outcome is what became of the position, with OutcomeDetail explaining discarded positions where there is more
+	//to say than the outcome
+	Outcome       Outcome
+	OutcomeDetail string
+	//ClampedToLast is true when the position was older than the vehicle's last position, within
+	//Options.StaleToleranceSeconds, and was used at the last position's timestamp
+	ClampedToLast bool
+	//AssignmentChange is set when the vehicle moved to a new trip before completing the one it was on
+	AssignmentChange *gtfs.VehicleAssignmentChange
+	//Anomaly is set when the vehicle is first found moving in a way that doesn't match its trip
+	Anomaly *gtfs.VehicleAssignmentAnomaly
+	//Deadhead is set when the vehicle finishes moving without a trip or off its trip's shape
+	Deadhead *gtfs.VehicleDeadhead
+}
+
+//NewPosition adds the vehicle's next position on trip and returns what was made of it. trip should be nil when
+//the position's trip isn't in the schedule in effect. Positions should be given in the order they are received
+func (vm *Monitor) NewPosition(position Position, trip *gtfs.TripInstance) Result {
+	change := vm.assignmentChange(&position, trip)
+	tripStopPosition, observedStopTimes := vm.newPosition(position, trip)
+	return Result{
+		TripStopPosition:  tripStopPosition,
+		ObservedStopTimes: observedStopTimes,
+		Outcome:           vm.lastOutcome,
+		OutcomeDetail:     vm.lastOutcomeDetail,
+		ClampedToLast:     vm.lastClampedToLast,
+		AssignmentChange:  change,
+		Anomaly:           vm.takeAnomaly(),
+		Deadhead:          vm.takeDeadhead(),
+	}
+}
+
+//newPosition takes a Position and optionally a gtfs.TripInstance and generates TripStopPosition and gtfs.ObservedStopTime records
+//based on previous positions
+//if trip is nil the vehicles trip is assumed to be unavailable from the gtfs schedule and its position is invalidated
+//what became of position is left in lastOutcome and lastOutcomeDetail
+func (vm *Monitor) newPosition(position Position,
+	trip *gtfs.TripInstance) (*TripStopPosition, []*gtfs.ObservedStopTime) {
+	var results []*gtfs.ObservedStopTime
+	vm.lastOutcomeDetail = ""
+	vm.lastClampedToLast = false
+	//place positions from feeds reporting only a stop_id at the stop's stop_sequence on the trip
+	if position.StopSequence == nil && position.StopId != nil && trip != nil {
+		if stopSequence, found := findStopSequenceByStopId(trip, *position.StopId, position.Timestamp); found {
+			position.StopSequence = &stopSequence
+		}
+	}
+	if position.positionIsSame(vm.lastPosition, 2) || vm.smoothing.isRepeatedPosition(vm.lastPosition, &position) {
+		//a vehicle waiting on layover is still present
+		if vm.layoverSeenAt > 0 && position.Timestamp > vm.layoverSeenAt {
+			vm.layoverSeenAt = position.Timestamp
+		}
+		vm.lastOutcome = OutcomeUnchanged
+		return nil, results
+	}
+	if !vm.acceptPositionOrder(&position) {
+		vm.lastOutcome = OutcomeStale
+		return nil, results
+	}
+	if position.TripId == nil || (position.StopSequence == nil && position.StopId == nil) ||
+		position.VehicleStopStatus.IsUnknown() {
+		vm.removeStopPosition()
+		vm.setDeadhead(vm.deadhead.offTrip(gtfs.NoTripDeadhead, position.Timestamp, position.Latitude,
+			position.Longitude))
+		vm.lastOutcome = OutcomeNotOnTrip
+		return nil, results
+	}
+
+	if trip == nil {
+		//non trip monitoring not implemented yet
+		vm.lastOutcome = OutcomeTripNotFound
+		return nil, results
+	}
+	if position.StopSequence == nil {
+		vm.removeStopPosition()
+		vm.lastOutcome = OutcomeStopNotFound
+		vm.lastOutcomeDetail = fmt.Sprintf("missing stop at tripId:%s stopId:%s", trip.TripId, *position.StopId)
+		return nil, results
+	}
+
+	newTripStopPosition, err := getTripStopPosition(trip, vm.lastTripStopPosition, &position, vm.distanceFilter)
+	if err != nil {
+		vm.removeStopPosition()
+		vm.lastOutcome = OutcomeStopNotFound
+		vm.lastOutcomeDetail = err.Error()
+		return nil, results
+	}
+	//update last position used to generate newTripStopPositionProducesObservations
+	vm.lastPosition = &position
+
+	if isOffShape(newTripStopPosition) {
+		deadheading, deadhead := vm.deadhead.offShape(newTripStopPosition)
+		vm.setDeadhead(deadhead)
+		if deadheading {
+			vm.removeStopPosition()
+			vm.lastOutcome = OutcomeDeadhead
+			return nil, results
+		}
+	} else {
+		vm.setDeadhead(vm.deadhead.onTrip(newTripStopPosition))
+	}
+
+	if vm.wrongDirection(newTripStopPosition) {
+		vm.removeStopPosition()
+		return nil, results
+	}
+
+	lastTripStopPosition := vm.lastTripStopPosition
+
+	if !vm.newTripStopPositionProducesObservations(newTripStopPosition) {
+		vm.lastOutcome = OutcomeNoStopPassed
+		return newTripStopPosition, results
+	}
+
+	stopTimePairs, err := getStopPairsBetweenPositions(lastTripStopPosition, newTripStopPosition)
+	if err != nil {
+		vm.lastOutcome = OutcomeStopNotFound
+		vm.lastOutcomeDetail = err.Error()
+		return newTripStopPosition, results
+	}
+	validMovement, totalScheduleTime, took := isMovementBelievable(stopTimePairs, lastTripStopPosition.lastTimestamp,
+		position.Timestamp, vm.earlyTolerance.tolerance(trip), vm.travelBounds)
+	if !validMovement {
+		vm.removeStopPosition()
+		vm.lastOutcome = OutcomeMovementNotBelievable
+		vm.lastOutcomeDetail = fmt.Sprintf("totalScheduleTime:%d took:%d last %s next %s", totalScheduleTime, took,
+			lastTripStopPosition.logFormat(), newTripStopPosition.logFormat())
+		return newTripStopPosition, results
+	}
+
+	results = makeObservedStopTimes(vm.Id, lastTripStopPosition, newTripStopPosition, stopTimePairs, vm.interpolation)
+	vm.lastOutcome = OutcomeObserved
+
+	return newTripStopPosition, results
+}
+
+//witnessedPreviousStop returns true if the previous TripStopPosition is before or at the stop on tripId at previousStopSequence
+//indicating that the vehicle was seen at ore previous to the last stop
+func witnessedPreviousStop(tripId string, stopSequence uint32, previousTripStopPosition *TripStopPosition) bool {
+	if previousTripStopPosition == nil {
+		return false
+	}
+	if previousTripStopPosition.tripInstance.TripId != tripId {
+		return true
+	}
+	if previousTripStopPosition.previousSTI.StopSequence < stopSequence {
+		return true
+	}
+	if previousTripStopPosition.previousSTI.StopSequence == stopSequence && previousTripStopPosition.atPreviousStop {
+		return true
+	}
+	return false
+}
+
+//getTripStopPosition builds a TripStopPosition at position's stop_sequence, or the stop it's snapped to by
+//resolveStopSequence when the stop_sequence isn't on trip
+//the vehicle's distance along the trip is smoothed by distanceFilter if it's not nil
+func getTripStopPosition(trip *gtfs.TripInstance,
+	previousTripStopPosition *TripStopPosition,
+	position *Position,
+	distanceFilter *distanceMedianFilter) (*TripStopPosition, error) {
+
+	stopSequence, found := resolveStopSequence(trip, position)
+	if !found {
+		return nil, fmt.Errorf("missing stop at tripId:%s previousStopSequence:%d", *position.TripId, *position.StopSequence)
+	}
+	witnessedPrevious := witnessedPreviousStop(trip.TripId, stopSequence, previousTripStopPosition)
+	var previousIndex int
+	var previousSST *gtfs.StopTimeInstance
+	for index, sst := range trip.StopTimeInstances {
+		if sst.StopSequence == stopSequence {
+			//move backwards one if it's still in transit to the stop
+			if position.VehicleStopStatus == InTransitTo && previousSST != nil {
+				index = previousIndex
+				sst = previousSST
+			}
+
+			//if the current stop sequence is the final stop the next stop is the same stop
+			nextSTI := sst
+			//otherwise, get the next one
+			if index+1 < len(trip.StopTimeInstances) {
+				nextSTI = trip.StopTimeInstances[index+1]
+			}
+			result := TripStopPosition{
+				dataSetId:             trip.DataSetId,
+				vehicleId:             position.Id,
+				atPreviousStop:        position.VehicleStopStatus == StoppedAt,
+				witnessedPreviousStop: witnessedPrevious || position.VehicleStopStatus == StoppedAt,
+				tripInstance:          trip,
+				previousSTI:           sst,
+				nextSTI:               nextSTI,
+				lastTimestamp:         position.Timestamp,
+				latitude:              position.Latitude,
+				longitude:             position.Longitude,
+			}
+			//perform gps based calculations on new position
+			result.tripDistancePosition = findTripDistanceOfVehicleFromPosition(&result)
+			distanceFilter.smooth(&result)
+			//next populate between stop attributes of result if possible
+			result.scheduledSecondsFromLastStop, result.observedSecondsToTravelToPosition =
+				calculateTravelBetweenStops(previousTripStopPosition, &result)
+			//populate vehicle's delay
+			result.delay = calculateDelay(result.previousSTI, result.scheduledSecondsFromLastStop, result.lastTimestamp)
+			return &result, nil
+		}
+		previousIndex = index
+		previousSST = sst
+	}
+	return nil, fmt.Errorf("missing stop at tripId:%s previousStopSequence:%d", *position.TripId, *position.StopSequence)
+}
+
+//calculateTravelBetweenStops calculates the time a vehicle may have taken to travel from previousTripStopPosition
+//to its new location between position.previousSTI and position.nextSTI
+//returns:
+//the amount of schedule seconds the vehicle was given to travel to its position between stops
+//observedSecondsToTravelToPosition - the amount of time the vehicle may have spent traveling to this position given
+// how much time it spent traveling from its previous TripStopPosition
+func calculateTravelBetweenStops(previousTripStopPosition *TripStopPosition, position *TripStopPosition) (int, int) {
+	//don't perform calculation if previousTripStopPosition is nil
+	//or position.tripDistancePosition is nil
+	if previousTripStopPosition == nil ||
+		position.tripDistancePosition == nil {
+		return 0, 0
+	}
+	firstScheduleSeconds := previousTripStopPosition.previousSTI.ArrivalTime + previousTripStopPosition.scheduledSecondsFromLastStop
+	lastScheduleSeconds := position.previousSTI.ArrivalTime
+	totalScheduledLengthTraveled := lastScheduleSeconds - firstScheduleSeconds
+
+	totalTimeOfTravel := int(position.lastTimestamp - previousTripStopPosition.lastTimestamp)
+
+	distanceFromPreviousStop := *position.tripDistancePosition - position.previousSTI.ShapeDistTraveled
+	distanceBetweenStops := position.nextSTI.ShapeDistTraveled - position.previousSTI.ShapeDistTraveled
+	//don't proceed if the data doesn't make sense
+	if distanceBetweenStops <= 0 {
+		return 0, 0
+	}
+	//if distance traveled on the trip is greater than the distance between stops, revert to distance between the stops
+	if distanceFromPreviousStop > distanceBetweenStops {
+		distanceFromPreviousStop = distanceBetweenStops
+	}
+	percentBetweenStops := distanceFromPreviousStop / distanceBetweenStops
+	//scheduleTimeBetweenStops = nextStop.scheduledArrivalTime - previousStop.scheduledDepartureTime
+	scheduleTimeBetweenStops := position.nextSTI.ArrivalTime - position.previousSTI.DepartureTime
+
+	scheduledSecondsFromLastStop := int(math.Round(float64(scheduleTimeBetweenStops) * percentBetweenStops))
+
+	//add how far the vehicle moved past the stop to the total scheduled length traveled
+	totalScheduledLengthTraveled += scheduledSecondsFromLastStop
+
+	if totalScheduledLengthTraveled <= 0 {
+		return 0, 0
+	}
+	percentSpentOnTravelPastStop := float64(scheduledSecondsFromLastStop) / float64(totalScheduledLengthTraveled)
+	return scheduledSecondsFromLastStop, int(math.Round(float64(totalTimeOfTravel) * percentSpentOnTravelPastStop))
+
+}
+
+//shouldUseToMoveForward  returns true if the newPosition indicates movement from previousTripStopPosition
+func shouldUseToMoveForward(previousTripStopPosition *TripStopPosition, newPosition *TripStopPosition) bool {
+	if previousTripStopPosition.tripInstance.TripId != newPosition.tripInstance.TripId {
+		return true
+	}
+	if newPosition.previousSTI.StopSequence > previousTripStopPosition.previousSTI.StopSequence {
+		return true
+	}
+	if previousTripStopPosition.previousSTI.StopSequence == newPosition.previousSTI.StopSequence {
+		if !previousTripStopPosition.atPreviousStop && newPosition.atPreviousStop {
+			return true
+		}
+	}
+
+	return false
+}
+
+//updateStoppedAtPosition checks if two tripStopPositions are at the same stop
+//and returns true if the new position should cause an update to the monitored vehicle position
+//Currently new positions at the first stop of the trip is considered new and usable, others are not
+func updateStoppedAtPosition(previousTripStopPosition *TripStopPosition, newPosition *TripStopPosition) bool {
+	if previousTripStopPosition.previousSTI.StopSequence == newPosition.previousSTI.StopSequence {
+		if newPosition.atPreviousStop {
+			return newPosition.previousSTI.FirstStop
+		}
+	}
+	return false
+}
+
+//acceptPositionOrder returns false if position is older than the vehicle's last position by more than
+//staleToleranceSeconds. Positions older within the tolerance are moved forward to the last position's timestamp,
+//setting lastClampedToLast
+func (vm *Monitor) acceptPositionOrder(position *Position) bool {
+	if vm.lastPosition == nil || position.Timestamp >= vm.lastPosition.Timestamp {
+		return true
+	}
+	if vm.lastPosition.Timestamp-position.Timestamp > vm.staleToleranceSeconds {
+		return false
+	}
+	vm.lastClampedToLast = true
+	position.Timestamp = vm.lastPosition.Timestamp
+	return true
+}
+
+//isCurrentPositionExpired returns true if the current position is expired at currentTimestamp, measured from the
+//vehicle's latest position on layover at the current position when it's waiting on layover
+func (vm *Monitor) isCurrentPositionExpired(currentTimestamp int64) bool {
+	lastSeen := vm.lastTripStopPosition.lastTimestamp
+	if vm.layoverSeenAt > lastSeen {
+		lastSeen = vm.layoverSeenAt
+	}
+	diff := currentTimestamp - lastSeen
+	return diff > vm.expiry.seconds(vm.lastTripStopPosition.tripInstance)
+}
+
+//getObservedAtPositions convenience function returns the TripStopPosition arguments that have had their atPreviousStop flag set
+func getObservedAtPositions(position1 *TripStopPosition, position2 *TripStopPosition) []TripStopPosition {
+	result := make([]TripStopPosition, 0)
+	if position1.atPreviousStop {
+		result = append(result, *position1)
+	}
+	if position2.atPreviousStop {
+		result = append(result, *position2)
+	}
+	return result
+}
+
+//newTripStopPositionProducesObservations updates trip position if needed
+//returns true if the vehicle has moved forward from its previous position and can produce a ObservedStopTime
+//or false if the current position has stayed between the same stops
+func (vm *Monitor) newTripStopPositionProducesObservations(
+	newPosition *TripStopPosition) bool {
+
+	//if last position is expired or not set then set it
+	expired := vm.lastTripStopPosition == nil || vm.isCurrentPositionExpired(newPosition.lastTimestamp)
+	if isLayoverPosition(newPosition) {
+		vm.layoverSeenAt = newPosition.lastTimestamp
+	} else {
+		vm.layoverSeenAt = 0
+	}
+	if expired {
+		vm.updateTripStopPosition(newPosition)
+		return false
+	}
+
+	movedForward := shouldUseToMoveForward(vm.lastTripStopPosition, newPosition)
+	if movedForward || updateStoppedAtPosition(vm.lastTripStopPosition, newPosition) {
+		vm.updateTripStopPosition(newPosition)
+	}
+	return movedForward
+}
+
+//updateTripStopPosition sets Monitor's current position to newTripStopPositionProducesObservations at positionTimestamp
+func (vm *Monitor) updateTripStopPosition(
+	newTripStopPosition *TripStopPosition) {
+
+	vm.lastTripStopPosition = newTripStopPosition
+}
+
+//wrongDirection returns true while the vehicle is travelling newTripStopPosition's trip against its shape, setting
+//lastOutcome and a pendingAnomaly when it is first found to be
+func (vm *Monitor) wrongDirection(newTripStopPosition *TripStopPosition) bool {
+	wasWrongDirection := vm.direction.wrongDirection()
+	wrongDirection, detail := vm.direction.check(newTripStopPosition)
+	if !wrongDirection {
+		return false
+	}
+	if !wasWrongDirection {
+		vm.pendingAnomaly = wrongDirectionAnomaly(vm.Id, newTripStopPosition, detail)
+	}
+	vm.lastOutcome = OutcomeWrongDirection
+	vm.lastOutcomeDetail = detail
+	return true
+}
+
+//takeAnomaly returns the assignment anomaly detected by the last position, if any, and clears it
+func (vm *Monitor) takeAnomaly() *gtfs.VehicleAssignmentAnomaly {
+	anomaly := vm.pendingAnomaly
+	vm.pendingAnomaly = nil
+	return anomaly
+}
+
+//setDeadhead leaves deadhead, if any, to be taken by takeDeadhead
+func (vm *Monitor) setDeadhead(deadhead *gtfs.VehicleDeadhead) {
+	if deadhead != nil {
+		deadhead.VehicleId = vm.Id
+		vm.pendingDeadhead = deadhead
+	}
+}
+
+//takeDeadhead returns the deadhead ended by the last position, if any, and clears it
+func (vm *Monitor) takeDeadhead() *gtfs.VehicleDeadhead {
+	deadhead := vm.pendingDeadhead
+	vm.pendingDeadhead = nil
+	return deadhead
+}
+
+//removeStopPosition removes lastTripStopPosition and sets lastStopChangeTimestamp to the timestamp
+func (vm *Monitor) removeStopPosition() {
+	vm.lastTripStopPosition = nil
+	vm.layoverSeenAt = 0
+}
+
+//makeObservedStopTimes build list of gtfs.ObservedStopTime for StopTimePair array
+//startTimestamp should be the previous position prior to StopTimePair being observed
+//endTimestamp is the time the observation was made
+//observedAtTripStopPositions contains list of tripStopPositions where the vehicle was seen at a stop
+//travel is split between stopPairs following interpolation
+func makeObservedStopTimes(
+	vehicleId string,
+	lastTripStopPosition *TripStopPosition,
+	newTripStopPosition *TripStopPosition,
+	stopPairs []StopTimePair,
+	interpolation travelInterpolation) []*gtfs.ObservedStopTime {
+
+	results := make([]*gtfs.ObservedStopTime, 0)
+	lastStopTimePairIndex := len(stopPairs) - 1
+	if lastStopTimePairIndex < 0 {
+		return results
+	}
+
+	firstStop := stopPairs[0]
+
+	observedAtTripStopPositions := getObservedAtPositions(lastTripStopPosition, newTripStopPosition)
+	firstScheduleSeconds := firstStop.from.ArrivalTime
+	lastScheduleSeconds := stopPairs[lastStopTimePairIndex].to.ArrivalTime
+	totalScheduledLength := lastScheduleSeconds - firstScheduleSeconds
+
+	assumedStartTime := lastTripStopPosition.lastTimestamp
+
+	observedTime := newTripStopPosition.lastTimestamp
+
+	//don't include seconds vehicle spent traveling between the next two stops
+	observedTime -= int64(newTripStopPosition.observedSecondsToTravelToPosition)
+
+	//and calculating from the first stop,
+	//and last position was prior to depart time of first stop
+	assumedDeparture := firstStop.from.FirstStop &&
+		lastTripStopPosition.lastTimestamp <= firstStop.from.DepartureDateTime.Unix()
+	if assumedDeparture {
+
+		//when vehicle is early,
+		if newTripStopPosition.delay < 0 {
+			//assume vehicle travel time was the segment length
+			assumedStartTime = observedTime - int64(totalScheduledLength)
+		} else { //vehicle is late
+			//assume vehicle took no longer than the scheduled time plus how late it is, since we didn't see
+			//it dwell at its first stop
+			assumedStartTime = observedTime - int64(totalScheduledLength) - int64(newTripStopPosition.delay)
+		}
+
+	}
+
+	totalTimeOfTravel := int(observedTime - assumedStartTime)
+	confidence := makeMovementConfidence(lastTripStopPosition, newTripStopPosition, len(stopPairs), assumedDeparture)
+	shares := interpolation.segmentShares(stopPairs)
+
+	for i := lastStopTimePairIndex; i >= 0; i-- {
+		pair := stopPairs[i]
+		stopTimeInstance1 := pair.from
+		stopTimeInstance2 := pair.to
+
+		segmentScheduleLength := stopTimeInstance2.ArrivalTime - stopTimeInstance1.ArrivalTime
+		travelSeconds := getSegmentTravelPortion(totalTimeOfTravel, totalScheduledLength, segmentScheduleLength)
+		if shares != nil {
+			travelSeconds = int(shares[i] * float64(totalTimeOfTravel))
+		}
+		if i == 0 { //only needed for first stop pair since LastTripStopPosition will contain any travel time recorded from previous positions
+			travelSeconds += earlierTravelSecondsForStop(&stopTimeInstance1, lastTripStopPosition)
+		}
+
+		observedAtStop := stopTimeInstancePresent(stopTimeInstance1, observedAtTripStopPositions)
+		observedAtNextStop := stopTimeInstancePresent(stopTimeInstance2, observedAtTripStopPositions)
+		observedStopTime := gtfs.ObservedStopTime{
+			RouteId:            pair.trip.RouteId,
+			StopId:             stopTimeInstance1.StopId,
+			StopDistance:       stopTimeInstance1.ShapeDistTraveled,
+			ObservedAtStop:     observedAtStop,
+			NextStopId:         stopTimeInstance2.StopId,
+			NextStopDistance:   stopTimeInstance2.ShapeDistTraveled,
+			ObservedAtNextStop: observedAtNextStop,
+			ObservedTime:       time.Unix(observedTime, 0),
+			TravelSeconds:      travelSeconds,
+			ScheduledSeconds:   &segmentScheduleLength,
+			ScheduledTime:      &stopTimeInstance1.ArrivalTime,
+			VehicleId:          vehicleId,
+			DataSetId:          stopTimeInstance1.DataSetId,
+			TripId:             stopTimeInstance1.TripId,
+			Confidence:         confidence.score(observedAtStop, observedAtNextStop),
+		}
+		//prepend since we are moving backwards
+		results = append([]*gtfs.ObservedStopTime{&observedStopTime}, results...)
+		observedTime -= int64(travelSeconds)
+
+	}
+	return results
+}
+
+//earlierTravelSecondsForStop returns number of seconds vehicle was previously observed traveling from stopInstance
+func earlierTravelSecondsForStop(stopInstance *gtfs.StopTimeInstance, lastTripStopPosition *TripStopPosition) int {
+	if stopInstance.TripId == lastTripStopPosition.previousSTI.TripId &&
+		stopInstance.StopSequence == lastTripStopPosition.previousSTI.StopSequence {
+		return lastTripStopPosition.scheduledSecondsFromLastStop
+	}
+	return 0
+}
+
+//stopTimeInstancePresent returns true if stopTimeInstance is present in positions
+func stopTimeInstancePresent(stopTimeInstance gtfs.StopTimeInstance, positions []TripStopPosition) bool {
+	for _, position := range positions {
+		if stopTimeInstance.TripId == position.tripInstance.TripId &&
+			stopTimeInstance.StopSequence == position.previousSTI.StopSequence {
+			return true
+		}
+	}
+	return false
+}
+
+//getSegmentTravelPortion returns the portion of totalTravelSeconds
+//that segmentScheduleLength represents in totalScheduleLength
+func getSegmentTravelPortion(totalTravelSeconds int,
+	totalScheduledLength int,
+	segmentScheduleLength int) int {
+	if segmentScheduleLength <= 0 {
+		return 0
+	}
+	percent := float32(segmentScheduleLength) / float32(totalScheduledLength)
+	return int(percent * float32(totalTravelSeconds))
+}
+
+//getStopPairsBetweenPositions get list of StopTimePairs between LastPosition and currentPosition
+func getStopPairsBetweenPositions(lastPosition *TripStopPosition,
+	currentPosition *TripStopPosition) ([]StopTimePair, error) {
+
+	currentTrip := currentPosition.tripInstance
+	fromSequence := lastPosition.previousSTI.StopSequence
+	toSequence := currentPosition.previousSTI.StopSequence
+
+	//ignore the previous stop if we do not have information about the vehicle's position from that stop
+	if !lastPosition.witnessedPreviousStop {
+		fromSequence++
+	}
+
+	//check if we are on the same trip
+	if lastPosition.tripInstance.TripId == currentPosition.tripInstance.TripId {
+		return getStopPairsBetweenSequences(currentTrip, fromSequence, toSequence), nil
+	}
+
+	lastTripChangedStops := getStopPairsBetweenSequences(lastPosition.tripInstance, fromSequence, getLastStopTimeSequenceOnTrip(currentTrip))
+	currentChangedStops := getStopPairsBetweenSequences(currentTrip, 0, toSequence)
+	combined := append(lastTripChangedStops, currentChangedStops...)
+
+	return combined, nil
+}
+
+//getLastStopTimeSequenceOnTrip returns the final previousStopSequence on trip
+func getLastStopTimeSequenceOnTrip(trip *gtfs.TripInstance) uint32 {
+	if trip == nil {
+		return 0
+	}
+	size := len(trip.StopTimeInstances)
+	if size < 1 {
+		return 0
+	}
+	return trip.StopTimeInstances[size-1].StopSequence
+}
+
+//StopTimePair contains the "from" and "to" gtfs.StopTimeInstance for a stop transition on a gtfs.TripInstance
+type StopTimePair struct {
+	from gtfs.StopTimeInstance
+	to   gtfs.StopTimeInstance
+	trip *gtfs.TripInstance
+}
+
+//getStopPairsBetweenSequences returns StopTimePair on trip that have stop sequences
+//between fromStopSequence and toStopSequence inclusively
+func getStopPairsBetweenSequences(trip *gtfs.TripInstance,
+	fromStopSequence uint32,
+	toStopSequence uint32) []StopTimePair {
+	changedStops := make([]StopTimePair, 0)
+	if toStopSequence <= fromStopSequence {
+		return changedStops
+	}
+	stopTimeInstances := trip.StopTimeInstances
+	numberStopTimeInstances := len(stopTimeInstances)
+	for i := 0; i+1 < numberStopTimeInstances; i++ {
+		stopTimeInstance1 := stopTimeInstances[i]
+		stopTimeInstance2 := stopTimeInstances[i+1]
+		if stopTimeInstance1.StopSequence >= fromStopSequence && stopTimeInstance2.StopSequence <= toStopSequence {
+			changedStops = append(changedStops, StopTimePair{*stopTimeInstance1, *stopTimeInstance2, trip})
+		}
+		if stopTimeInstance2.StopSequence >= toStopSequence {
+			return changedStops
+		}
+	}
+	return changedStops
+}
+
+//isMovementBelievable for a given StopTimePair list, is it believable that these stops where traversed in the time
+//between fromTimestamp and toTimestamp
+//pairs with a bound in travelBounds must take at least their bound, other pairs at least earlyTolerance of their
+//scheduled time
+func isMovementBelievable(stopTimePairs []StopTimePair,
+	fromTimestamp int64,
+	toTimestamp int64,
+	earlyTolerance float64,
+	travelBounds *TravelBounds) (isValid bool, totalScheduleTime int64, took int64) {
+	took = toTimestamp - fromTimestamp
+	size := len(stopTimePairs)
+	if size < 1 {
+		return true, 0, took
+	}
+	totalScheduleTime = int64(0)
+	furthestTime := int64(0)
+	boundedPairs := 0
+	minimumTime := float64(0)
+	for _, pair := range stopTimePairs {
+		//never move backwards while observing stops
+		if furthestTime > pair.from.ArrivalDateTime.Unix() {
+			return false, 0, took
+		} else {
+			furthestTime = pair.from.ArrivalDateTime.Unix()
+		}
+		scheduleTime := pair.to.ArrivalDateTime.Unix() - pair.from.ArrivalDateTime.Unix()
+		totalScheduleTime += scheduleTime
+		if bound, present := travelBounds.minTravel(pair.from.StopId, pair.to.StopId); present {
+			boundedPairs++
+			minimumTime += float64(bound)
+		} else {
+			minimumTime += float64(scheduleTime) * earlyTolerance
+		}
+	}
+	if totalScheduleTime < 0 {
+		return false, totalScheduleTime, took
+	}
+	if boundedPairs > 0 {
+		return float64(took) >= minimumTime, totalScheduleTime, took
+	}
+
+	if totalScheduleTime == 0.0 && earlyTolerance > 0.0 {
+		return false, totalScheduleTime, took
+	}
+	early := float64(took) / float64(totalScheduleTime)
+	return early >= earlyTolerance, totalScheduleTime, took
+}
@@ -1,4 +1,4 @@
-package monitor
+package vehiclemonitor
 
 import (
 	"encoding/json"
@@ -13,8 +13,8 @@ import (
 )
 
 func makeVehiclePositionStopId(tripId string, stopSequence uint32,
-	stopPosition VehicleStopStatus, timeStamp int64, stopId string) vehiclePosition {
-	return vehiclePosition{
+	stopPosition VehicleStopStatus, timeStamp int64, stopId string) Position {
+	return Position{
 		Id:                "1",
 		Label:             "test",
 		Timestamp:         timeStamp,
@@ -26,8 +26,8 @@ func makeVehiclePositionStopId(tripId string, stopSequence uint32,
 }
 
 func makeVehiclePositionStopIdLL(tripId string, stopSequence uint32,
-	stopPosition VehicleStopStatus, timeStamp int64, stopId string, lat float32, lon float32) vehiclePosition {
-	return vehiclePosition{
+	stopPosition VehicleStopStatus, timeStamp int64, stopId string, lat float32, lon float32) Position {
+	return Position{
 		Id:                "1",
 		Label:             "test",
 		Timestamp:         timeStamp,
@@ -115,7 +115,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 	testTrips = append(testTrips, trip10856058, trip10900607, trip10958023)
 
 	type args struct {
-		Positions []vehiclePosition
+		Positions []Position
 	}
 	type want struct {
 		stopTimes []*gtfs.ObservedStopTime
@@ -128,7 +128,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "Initial position",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(1), StoppedAt,
 						time.Date(2019, 12, 11, 8, 59, 25, 0, location).Unix(), "9848"),
 				},
@@ -140,7 +140,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "Revert to unknown position",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(1), StoppedAt, 1576083565, "9848"),
 					{Id: "1", Label: "", Timestamp: 1576083575},
 				},
@@ -152,7 +152,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "Have not moved to next stop",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(1), StoppedAt,
 						time.Date(2019, 12, 11, 8, 59, 25, 0, location).Unix(), "9848"),
 					makeVehiclePositionStopId("9529801", uint32(2), InTransitTo, 1576083596, "9846"),
@@ -167,7 +167,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "Moved to next stop",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(1), StoppedAt, 1576083565, "9848"),
 					makeVehiclePositionStopId("9529801", uint32(2), InTransitTo, 1576083596, "9846"),
 					makeVehiclePositionStopId("9529801", uint32(2), InTransitTo, 1576083627, "9846"),
@@ -196,7 +196,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "Don't update from an older position",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(2), InTransitTo,
 						time.Date(2019, 12, 11, 9, 1, 10, 0, location).Unix(), "9846"),
 					makeVehiclePositionStopId("9529801", uint32(2), StoppedAt,
@@ -212,7 +212,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "Start tracking movement between stops, produce stop time when between another two stops",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(5), InTransitTo, 1576083922, "9838"),
 					makeVehiclePositionStopId("9529801", uint32(5), InTransitTo, 1576083953, "9838"),
 					makeVehiclePositionStopId("9529801", uint32(5), InTransitTo, 1576083983, "9838"),
@@ -242,7 +242,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "Start tracking movement near end of trip, next position at beginning of next trip",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(46), StoppedAt, 1576089931, "8357"),
 					makeVehiclePositionStopId("9529801", uint32(47), InTransitTo, 1576089962, "8359"),
 					makeVehiclePositionStopId("9529801", uint32(47), InTransitTo, 1576089993, "8359"),
@@ -272,7 +272,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "Start tracking movement near end of trip, next position at second stop of next trip",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(46), StoppedAt,
 						time.Date(2019, 12, 11, 10, 45, 31, 0, location).Unix(), "8357"),
 					makeVehiclePositionStopId("9529801", uint32(47), InTransitTo,
@@ -319,7 +319,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "Second STOPPED_AT position doesn't generate another ObservedStopTime",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(1), StoppedAt, 1576083565, "9848"),
 					makeVehiclePositionStopId("9529801", uint32(2), InTransitTo, 1576083596, "9846"),
 					makeVehiclePositionStopId("9529801", uint32(2), InTransitTo, 1576083627, "9846"),
@@ -336,7 +336,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "Erroneous trip movement doesn't produce observed stop times",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(46), StoppedAt, 1576089931, "8357"),
 					makeVehiclePositionStopId("9529801", uint32(47), InTransitTo, 1576089962, "8359"),
 					makeVehiclePositionStopId("9529801", uint32(47), InTransitTo, 1576089993, "8359"),
@@ -353,7 +353,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "Do not generate arrivalDelay at stop last stop of trip",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(46), StoppedAt, 1576089941, "8357"),
 					makeVehiclePositionStopId("9529801", uint32(47), InTransitTo, 1576089962, "8359"),
 					makeVehiclePositionStopId("9529801", uint32(47), StoppedAt,
@@ -381,7 +381,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "Don't update depart time when at stop in middle of trip",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(46), StoppedAt, 1576089931, "8357"),
 					makeVehiclePositionStopId("9529801", uint32(46), StoppedAt, 1576089941, "8357"),
 					makeVehiclePositionStopId("9529801", uint32(47), InTransitTo, 1576089962, "8359"),
@@ -410,7 +410,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "Do update depart time when at stop at beginning of trip",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(1), StoppedAt, 1576083565, "9848"),
 					makeVehiclePositionStopId("9529801", uint32(1), StoppedAt, 1576083596, "9848"),
 					makeVehiclePositionStopId("9529801", uint32(2), InTransitTo, 1576083627, "9846"),
@@ -438,7 +438,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "At first stop mark observed stop time as traveling at the scheduled travel time when its arrived on time",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(1), StoppedAt,
 						time.Date(2019, 12, 11, 8, 50, 0, 0, location).Unix(), "9848"), //last seen at stop about 11 minutes earlier
 					makeVehiclePositionStopId("9529801", uint32(2), InTransitTo,
@@ -468,7 +468,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "At first stop mark observed stop time as traveling at the nearer the scheduled travel time when its almost on time",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(1), StoppedAt,
 						time.Date(2019, 12, 11, 8, 50, 0, 0, location).Unix(), "9848"), //last seen at stop about 11 minutes earlier
 					makeVehiclePositionStopId("9529801", uint32(2), InTransitTo,
@@ -498,7 +498,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "When traversing two stops from start of trip mark observed stop time as traveling nearer the scheduled travel time when its almost on time, multiple stops",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(1), StoppedAt,
 						time.Date(2019, 12, 11, 8, 50, 0, 0, location).Unix(), "9848"), //last seen at stop about 12 minutes earlier
 					makeVehiclePositionStopId("9529801", uint32(2), InTransitTo,
@@ -541,7 +541,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "arrivalDelay remains as its getting later",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(2), StoppedAt,
 						time.Date(2019, 12, 11, 8, 50, 0, 0, location).Unix(), "9846"),
 					makeVehiclePositionStopId("9529801", uint32(2), StoppedAt,
@@ -569,7 +569,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "arrivalDelay remains after less then the expiration time with just one update",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(2), StoppedAt,
 						time.Date(2019, 12, 11, 8, 50, 0, 0, location).Unix(), "9846"),
 					makeVehiclePositionStopId("9529801", uint32(2), StoppedAt,
@@ -583,7 +583,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "Transitioning from stop 7970 to 8059",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("10856058", uint32(13), InTransitTo,
 						time.Date(2021, 7, 13, 23, 44, 59, 0, location).Unix(), "7962"),
 					makeVehiclePositionStopId("10856058", uint32(15), InTransitTo,
@@ -628,7 +628,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "Use partial progress between stops reduces calculated travel times on previous stop passage",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					//this position is the schedule time for stop one
 					makeVehiclePositionStopIdLL("10900607", uint32(1), StoppedAt,
 						testDate("2021-07-22T16:28:00-07:00").Unix(), "13888", 45.426947, -122.485885),
@@ -658,7 +658,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "Use partial progress between stops to increase calculated travel times on previous stop passage",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					//this position is the schedule time for stop one
 					makeVehiclePositionStopIdLL("10900607", uint32(1), StoppedAt,
 						testDate("2021-07-22T16:28:00-07:00").Unix(), "13888", 45.426947, -122.485885),
@@ -692,7 +692,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 		{
 			name: "Use partial progress between stops to adjust calculated travel times on previous and next stop passages",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					//this position is the schedule time for stop one
 					makeVehiclePositionStopIdLL("10900607", uint32(1), StoppedAt,
 						testDate("2021-07-22T16:28:00-07:00").Unix(), "13888", 45.426947, -122.485885),
@@ -750,7 +750,7 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 			name: "When at first stop and next movement position is late, " +
 				"assume vehicle departed no later than how late it's become",
 			args: args{
-				Positions: []vehiclePosition{
+				Positions: []Position{
 					makeVehiclePositionStopId("9529801", uint32(1), StoppedAt,
 						time.Date(2019, 12, 11, 8, 56, 10, 0, location).Unix(), "9848"), //scheduled to leave at 8:59:10
 					makeVehiclePositionStopId("9529801", uint32(2), StoppedAt,
@@ -779,15 +779,13 @@ func TestVehicleMonitor_NewPosition(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			testLog := makeTestLogWriter()
-
-			vm := makeVehicleMonitor(tt.args.Positions[0].Id, .4, expireSeconds)
+			vm := makeVehicleMonitor(tt.args.Positions[0].Id, earlyTolerancePolicy{defaultTolerance: .4}, expireSeconds, Smoothing{})
 			var result []*gtfs.ObservedStopTime
 			//iterate over positions
 			for _, lastPosition := range tt.args.Positions {
 
 				trip := getTestTrip(testTrips, lastPosition.TripId, t)
-				_, result = vm.newPosition(testLog.log, lastPosition, trip)
+				_, result = vm.newPosition(lastPosition, trip)
 
 			}
 			same, discrepancyDescription := observedStopTimesSame(result, tt.want.stopTimes)
@@ -886,8 +884,8 @@ func Test_shouldUseToMoveForward(t *testing.T) {
 	testTripTwo := getTestTrip(testTrips, strPtr("9530573"), t)
 
 	type args struct {
-		previousTripStopPosition *tripStopPosition
-		newPosition              *tripStopPosition
+		previousTripStopPosition *TripStopPosition
+		newPosition              *TripStopPosition
 	}
 
 	tests := []struct {
@@ -898,14 +896,14 @@ func Test_shouldUseToMoveForward(t *testing.T) {
 		{
 			name: "Update when moved passed stop",
 			args: args{
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: false,
 					tripInstance:          testTripOne,
 					previousSTI:           testTripOne.StopTimeInstances[1],
 					nextSTI:               testTripOne.StopTimeInstances[2],
 				},
-				newPosition: &tripStopPosition{
+				newPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: false,
 					tripInstance:          testTripOne,
@@ -918,14 +916,14 @@ func Test_shouldUseToMoveForward(t *testing.T) {
 		{
 			name: "Update when arrived at stop",
 			args: args{
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: false,
 					tripInstance:          testTripOne,
 					previousSTI:           testTripOne.StopTimeInstances[1],
 					nextSTI:               testTripOne.StopTimeInstances[2],
 				},
-				newPosition: &tripStopPosition{
+				newPosition: &TripStopPosition{
 					atPreviousStop:        true,
 					witnessedPreviousStop: false,
 					tripInstance:          testTripOne,
@@ -938,14 +936,14 @@ func Test_shouldUseToMoveForward(t *testing.T) {
 		{
 			name: "Update when arrived at stop",
 			args: args{
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: false,
 					tripInstance:          testTripOne,
 					previousSTI:           testTripOne.StopTimeInstances[1],
 					nextSTI:               testTripOne.StopTimeInstances[2],
 				},
-				newPosition: &tripStopPosition{
+				newPosition: &TripStopPosition{
 					atPreviousStop:        true,
 					witnessedPreviousStop: false,
 					tripInstance:          testTripOne,
@@ -958,14 +956,14 @@ func Test_shouldUseToMoveForward(t *testing.T) {
 		{
 			name: "Do update when at stop and new position at the next stop",
 			args: args{
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					atPreviousStop:        true,
 					witnessedPreviousStop: false,
 					tripInstance:          testTripOne,
 					previousSTI:           testTripOne.StopTimeInstances[1],
 					nextSTI:               testTripOne.StopTimeInstances[2],
 				},
-				newPosition: &tripStopPosition{
+				newPosition: &TripStopPosition{
 					atPreviousStop:        true,
 					witnessedPreviousStop: true,
 					tripInstance:          testTripOne,
@@ -978,14 +976,14 @@ func Test_shouldUseToMoveForward(t *testing.T) {
 		{
 			name: "Don't update when at stop and new position at the same stop",
 			args: args{
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					atPreviousStop:        true,
 					witnessedPreviousStop: false,
 					tripInstance:          testTripOne,
 					previousSTI:           testTripOne.StopTimeInstances[1],
 					nextSTI:               testTripOne.StopTimeInstances[2],
 				},
-				newPosition: &tripStopPosition{
+				newPosition: &TripStopPosition{
 					atPreviousStop:        true,
 					witnessedPreviousStop: false,
 					tripInstance:          testTripOne,
@@ -998,14 +996,14 @@ func Test_shouldUseToMoveForward(t *testing.T) {
 		{
 			name: "Dont update when two positions between same stops",
 			args: args{
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: false,
 					tripInstance:          testTripOne,
 					previousSTI:           testTripOne.StopTimeInstances[1],
 					nextSTI:               testTripOne.StopTimeInstances[2],
 				},
-				newPosition: &tripStopPosition{
+				newPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: false,
 					tripInstance:          testTripOne,
@@ -1018,14 +1016,14 @@ func Test_shouldUseToMoveForward(t *testing.T) {
 		{
 			name: "Do update when moving between stops",
 			args: args{
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: false,
 					tripInstance:          testTripOne,
 					previousSTI:           testTripOne.StopTimeInstances[1],
 					nextSTI:               testTripOne.StopTimeInstances[2],
 				},
-				newPosition: &tripStopPosition{
+				newPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: false,
 					tripInstance:          testTripOne,
@@ -1038,14 +1036,14 @@ func Test_shouldUseToMoveForward(t *testing.T) {
 		{
 			name: "Do update when different trip",
 			args: args{
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: false,
 					tripInstance:          testTripOne,
 					previousSTI:           testTripOne.StopTimeInstances[11],
 					nextSTI:               testTripOne.StopTimeInstances[32],
 				},
-				newPosition: &tripStopPosition{
+				newPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: false,
 					tripInstance:          testTripTwo,
@@ -1076,7 +1074,7 @@ func Test_getStopTransition(t *testing.T) {
 
 	type args struct {
 		trip                     *gtfs.TripInstance
-		previousTripStopPosition *tripStopPosition
+		previousTripStopPosition *TripStopPosition
 		stopSequence             uint32
 		status                   VehicleStopStatus
 		timestamp                int64
@@ -1084,7 +1082,7 @@ func Test_getStopTransition(t *testing.T) {
 	tests := []struct {
 		name string
 		args args
-		want *tripStopPosition
+		want *TripStopPosition
 	}{
 		{
 			name: "at first stop of trip, 10 seconds late",
@@ -1095,7 +1093,7 @@ func Test_getStopTransition(t *testing.T) {
 				status:                   StoppedAt,
 				timestamp:                testTrip.StopTimeInstances[0].ArrivalDateTime.Unix() + 10,
 			},
-			want: &tripStopPosition{
+			want: &TripStopPosition{
 				dataSetId:             1,
 				atPreviousStop:        true,
 				witnessedPreviousStop: true,
@@ -1110,7 +1108,7 @@ func Test_getStopTransition(t *testing.T) {
 			name: "previously at same first stop of trip",
 			args: args{
 				trip: testTrips[0],
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					atPreviousStop:        true,
 					witnessedPreviousStop: true,
 					tripInstance:          testTrip,
@@ -1121,7 +1119,7 @@ func Test_getStopTransition(t *testing.T) {
 				status:       StoppedAt,
 				timestamp:    testTrip.StopTimeInstances[0].ArrivalDateTime.Unix(),
 			},
-			want: &tripStopPosition{
+			want: &TripStopPosition{
 				dataSetId:             1,
 				atPreviousStop:        true,
 				witnessedPreviousStop: true,
@@ -1135,7 +1133,7 @@ func Test_getStopTransition(t *testing.T) {
 			name: "Moved from being at at first stop to in transit to second",
 			args: args{
 				trip: testTrips[0],
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					atPreviousStop:        true,
 					witnessedPreviousStop: true,
 					tripInstance:          testTrip,
@@ -1146,7 +1144,7 @@ func Test_getStopTransition(t *testing.T) {
 				status:       InTransitTo,
 				timestamp:    testTrip.StopTimeInstances[0].ArrivalDateTime.Unix(),
 			},
-			want: &tripStopPosition{
+			want: &TripStopPosition{
 				dataSetId:             1,
 				atPreviousStop:        false,
 				witnessedPreviousStop: true,
@@ -1165,7 +1163,7 @@ func Test_getStopTransition(t *testing.T) {
 				status:                   StoppedAt,
 				timestamp:                testTrip.StopTimeInstances[1].ArrivalDateTime.Unix(),
 			},
-			want: &tripStopPosition{
+			want: &TripStopPosition{
 				dataSetId:             1,
 				atPreviousStop:        true,
 				witnessedPreviousStop: true,
@@ -1185,7 +1183,7 @@ func Test_getStopTransition(t *testing.T) {
 				status:                   InTransitTo,
 				timestamp:                testTrip.StopTimeInstances[0].ArrivalDateTime.Unix(),
 			},
-			want: &tripStopPosition{
+			want: &TripStopPosition{
 				dataSetId:             1,
 				atPreviousStop:        false,
 				witnessedPreviousStop: false,
@@ -1199,7 +1197,7 @@ func Test_getStopTransition(t *testing.T) {
 			name: "Between stop 3 and 4, last seen between stop 2 and 3",
 			args: args{
 				trip: testTrips[0],
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: false,
 					tripInstance:          testTrip,
@@ -1210,7 +1208,7 @@ func Test_getStopTransition(t *testing.T) {
 				status:       InTransitTo,
 				timestamp:    testTrip.StopTimeInstances[2].ArrivalDateTime.Unix(),
 			},
-			want: &tripStopPosition{
+			want: &TripStopPosition{
 				dataSetId:             1,
 				atPreviousStop:        false,
 				witnessedPreviousStop: true,
@@ -1230,7 +1228,7 @@ func Test_getStopTransition(t *testing.T) {
 				status:                   StoppedAt,
 				timestamp:                testTrip.StopTimeInstances[46].ArrivalDateTime.Unix(),
 			},
-			want: &tripStopPosition{
+			want: &TripStopPosition{
 				dataSetId:             1,
 				atPreviousStop:        true,
 				witnessedPreviousStop: true,
@@ -1244,7 +1242,7 @@ func Test_getStopTransition(t *testing.T) {
 			name: "Seen at last stop of trip, previous position between previous stop",
 			args: args{
 				trip: testTrips[0],
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: true,
 					tripInstance:          testTrip,
@@ -1255,7 +1253,7 @@ func Test_getStopTransition(t *testing.T) {
 				status:       StoppedAt,
 				timestamp:    testTrip.StopTimeInstances[46].ArrivalDateTime.Unix(),
 			},
-			want: &tripStopPosition{
+			want: &TripStopPosition{
 				dataSetId:             1,
 				atPreviousStop:        true,
 				witnessedPreviousStop: true,
@@ -1269,7 +1267,7 @@ func Test_getStopTransition(t *testing.T) {
 			name: "Seen before next stop sequence (15), next seen past but before next stop sequence (16)",
 			args: args{
 				trip: trip10856058,
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: true,
 					tripInstance:          trip10856058,
@@ -1280,7 +1278,7 @@ func Test_getStopTransition(t *testing.T) {
 				status:       InTransitTo,
 				timestamp:    trip10856058.StopTimeInstances[14].ArrivalDateTime.Unix(),
 			},
-			want: &tripStopPosition{
+			want: &TripStopPosition{
 				dataSetId:             3,
 				atPreviousStop:        false,
 				witnessedPreviousStop: true,
@@ -1293,12 +1291,12 @@ func Test_getStopTransition(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			position := vehiclePosition{
+			position := Position{
 				VehicleStopStatus: tt.args.status,
 				StopSequence:      &tt.args.stopSequence,
 				Timestamp:         tt.args.timestamp,
 			}
-			got, _ := getTripStopPosition(tt.args.trip, tt.args.previousTripStopPosition, &position)
+			got, _ := getTripStopPosition(tt.args.trip, tt.args.previousTripStopPosition, &position, nil)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("getTripStopPosition() = \n%+v, want \n%+v", got, tt.want)
 			}
@@ -1319,7 +1317,7 @@ func Test_witnessedPreviousStop(t *testing.T) {
 	type args struct {
 		tripId                   string
 		stopSequence             uint32
-		previousTripStopPosition *tripStopPosition
+		previousTripStopPosition *TripStopPosition
 	}
 	tests := []struct {
 		name string
@@ -1340,7 +1338,7 @@ func Test_witnessedPreviousStop(t *testing.T) {
 			args: args{
 				tripId:       "9529801",
 				stopSequence: 3,
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: false,
 					tripInstance:          testTripOne,
@@ -1355,7 +1353,7 @@ func Test_witnessedPreviousStop(t *testing.T) {
 			args: args{
 				tripId:       "9529801",
 				stopSequence: 3,
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: false,
 					tripInstance:          testTripOne,
@@ -1370,7 +1368,7 @@ func Test_witnessedPreviousStop(t *testing.T) {
 			args: args{
 				tripId:       "9529801",
 				stopSequence: 3,
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					atPreviousStop:        true,
 					witnessedPreviousStop: true,
 					tripInstance:          testTripOne,
@@ -1385,7 +1383,7 @@ func Test_witnessedPreviousStop(t *testing.T) {
 			args: args{
 				tripId:       "9529801",
 				stopSequence: 3,
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					atPreviousStop:        true,
 					witnessedPreviousStop: false,
 					tripInstance:          testTripOne,
@@ -1417,8 +1415,8 @@ func Test_getStopPairsBetweenPositions(t *testing.T) {
 	trip10856058 := getFirstTestTripFromJson("trip_10856058_2021_07_13.json", t)
 
 	type args struct {
-		lastPosition    *tripStopPosition
-		currentPosition *tripStopPosition
+		lastPosition    *TripStopPosition
+		currentPosition *TripStopPosition
 	}
 	tests := []struct {
 		name    string
@@ -1429,14 +1427,14 @@ func Test_getStopPairsBetweenPositions(t *testing.T) {
 		{
 			name: "Still at first stop",
 			args: args{
-				lastPosition: &tripStopPosition{
+				lastPosition: &TripStopPosition{
 					atPreviousStop:        true,
 					witnessedPreviousStop: false,
 					tripInstance:          firstTrip,
 					previousSTI:           firstTrip.StopTimeInstances[0],
 					nextSTI:               firstTrip.StopTimeInstances[1],
 				},
-				currentPosition: &tripStopPosition{
+				currentPosition: &TripStopPosition{
 					atPreviousStop:        true,
 					witnessedPreviousStop: false,
 					tripInstance:          firstTrip,
@@ -1450,14 +1448,14 @@ func Test_getStopPairsBetweenPositions(t *testing.T) {
 		{
 			name: "At first stop then at second stop",
 			args: args{
-				lastPosition: &tripStopPosition{
+				lastPosition: &TripStopPosition{
 					atPreviousStop:        true,
 					witnessedPreviousStop: true,
 					tripInstance:          firstTrip,
 					previousSTI:           firstTrip.StopTimeInstances[0],
 					nextSTI:               firstTrip.StopTimeInstances[1],
 				},
-				currentPosition: &tripStopPosition{
+				currentPosition: &TripStopPosition{
 					atPreviousStop:        true,
 					witnessedPreviousStop: true,
 					tripInstance:          firstTrip,
@@ -1477,14 +1475,14 @@ func Test_getStopPairsBetweenPositions(t *testing.T) {
 		{
 			name: "At first stop, then between second and third stop",
 			args: args{
-				lastPosition: &tripStopPosition{
+				lastPosition: &TripStopPosition{
 					atPreviousStop:        true,
 					witnessedPreviousStop: true,
 					tripInstance:          firstTrip,
 					previousSTI:           firstTrip.StopTimeInstances[0],
 					nextSTI:               firstTrip.StopTimeInstances[1],
 				},
-				currentPosition: &tripStopPosition{
+				currentPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: true,
 					tripInstance:          firstTrip,
@@ -1509,14 +1507,14 @@ func Test_getStopPairsBetweenPositions(t *testing.T) {
 		{
 			name: "between first and second (without being seen at stop), then between second and third stop",
 			args: args{
-				lastPosition: &tripStopPosition{
+				lastPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: false,
 					tripInstance:          firstTrip,
 					previousSTI:           firstTrip.StopTimeInstances[0],
 					nextSTI:               firstTrip.StopTimeInstances[1],
 				},
-				currentPosition: &tripStopPosition{
+				currentPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: true,
 					tripInstance:          firstTrip,
@@ -1536,14 +1534,14 @@ func Test_getStopPairsBetweenPositions(t *testing.T) {
 		{
 			name: "Near end of first trip, into second trip",
 			args: args{
-				lastPosition: &tripStopPosition{
+				lastPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: true,
 					tripInstance:          firstTrip,
 					previousSTI:           firstTrip.StopTimeInstances[44],
 					nextSTI:               firstTrip.StopTimeInstances[45],
 				},
-				currentPosition: &tripStopPosition{
+				currentPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: false,
 					tripInstance:          secondTrip,
@@ -1578,14 +1576,14 @@ func Test_getStopPairsBetweenPositions(t *testing.T) {
 		{
 			name: "Witnessed at previous stop now two stops beyond it",
 			args: args{
-				lastPosition: &tripStopPosition{
+				lastPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: true,
 					tripInstance:          firstTrip,
 					previousSTI:           firstTrip.StopTimeInstances[5],
 					nextSTI:               firstTrip.StopTimeInstances[6],
 				},
-				currentPosition: &tripStopPosition{
+				currentPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: true,
 					tripInstance:          firstTrip,
@@ -1615,14 +1613,14 @@ func Test_getStopPairsBetweenPositions(t *testing.T) {
 		{
 			name: "At second to last stop, then at first stop of next trip",
 			args: args{
-				lastPosition: &tripStopPosition{
+				lastPosition: &TripStopPosition{
 					atPreviousStop:        true,
 					witnessedPreviousStop: true,
 					tripInstance:          firstTrip,
 					previousSTI:           firstTrip.StopTimeInstances[45],
 					nextSTI:               firstTrip.StopTimeInstances[46],
 				},
-				currentPosition: &tripStopPosition{
+				currentPosition: &TripStopPosition{
 					atPreviousStop:        true,
 					witnessedPreviousStop: true,
 					tripInstance:          secondTrip,
@@ -1642,14 +1640,14 @@ func Test_getStopPairsBetweenPositions(t *testing.T) {
 		{
 			name: "Seen before previous stop, now moved past next stop",
 			args: args{
-				lastPosition: &tripStopPosition{
+				lastPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: true,
 					tripInstance:          trip10856058,
 					previousSTI:           trip10856058.StopTimeInstances[14],
 					nextSTI:               trip10856058.StopTimeInstances[15],
 				},
-				currentPosition: &tripStopPosition{
+				currentPosition: &TripStopPosition{
 					atPreviousStop:        false,
 					witnessedPreviousStop: true,
 					tripInstance:          trip10856058,
@@ -1847,11 +1845,9 @@ func Test_TestVehicleMonitor_NewPositionGetsEveryStopPairOnce(t *testing.T) {
 	}
 	testTrips := getTestTrips(time.Date(2019, 12, 11, 16, 0, 0, 0, location), t)
 
-	vm := makeVehicleMonitor("1", .2, 15*60)
+	vm := makeVehicleMonitor("1", earlyTolerancePolicy{defaultTolerance: .2}, 15*60, Smoothing{})
 	t.Run("newPosition produces every stop pair once", func(t *testing.T) {
 
-		testLog := makeTestLogWriter()
-
 		transitionMap := make(map[string]*gtfs.ObservedStopTime)
 		//iterate over positions
 		for i, lastPosition := range testPositions {
@@ -1859,7 +1855,7 @@ func Test_TestVehicleMonitor_NewPositionGetsEveryStopPairOnce(t *testing.T) {
 
 			trip := getTestTrip(testTrips, lastPosition.TripId, t)
 
-			_, results := vm.newPosition(testLog.log, newPos, trip)
+			_, results := vm.newPosition(newPos, trip)
 			if results == nil {
 				continue
 			}
@@ -1891,12 +1887,12 @@ func Test_TestVehicleMonitor_NewPositionGetsEveryStopPairOnce(t *testing.T) {
 	})
 }
 
-func getTestVehiclePositions(t *testing.T, fileName string) []vehiclePosition {
+func getTestVehiclePositions(t testing.TB, fileName string) []Position {
 	file, err := os.ReadFile(fileName)
 	if err != nil {
 		t.Errorf("unable to read test file: %v", err)
 	}
-	vehiclePositions := make([]vehiclePosition, 0)
+	vehiclePositions := make([]Position, 0)
 	err = json.Unmarshal(file, &vehiclePositions)
 	if err != nil {
 		t.Errorf("unable to read test vehiclePositions file: %v", err)
@@ -1962,6 +1958,7 @@ func Test_isMovementBelievable(t *testing.T) {
 		fromTimestamp  int64
 		toTimestamp    int64
 		earlyTolerance float64
+		travelBounds   *TravelBounds
 	}
 	tests := []struct {
 		name string
@@ -2066,10 +2063,78 @@ func Test_isMovementBelievable(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			name: "travel faster than early tolerance is valid when stop pair bound allows it",
+			args: args{
+				stopTimePairs: []StopTimePair{
+					{
+						from: gtfs.StopTimeInstance{
+							StopTime:          gtfs.StopTime{StopId: "A"},
+							ArrivalDateTime:   time.Date(2020, 1, 12, 12, 0, 0, 0, location),
+							DepartureDateTime: time.Date(2020, 1, 12, 12, 0, 0, 0, location),
+						},
+						to: gtfs.StopTimeInstance{
+							StopTime:          gtfs.StopTime{StopId: "B"},
+							ArrivalDateTime:   time.Date(2020, 1, 12, 12, 1, 40, 0, location),
+							DepartureDateTime: time.Date(2020, 1, 12, 12, 1, 40, 0, location),
+						},
+						trip: nil,
+					},
+				},
+				fromTimestamp:  time.Date(2020, 1, 12, 12, 0, 0, 0, location).Unix(),
+				toTimestamp:    time.Date(2020, 1, 12, 12, 0, 20, 0, location).Unix(),
+				earlyTolerance: 0.3,
+				travelBounds: NewTravelBounds([]gtfs.StopPairTravelBound{
+					{StopId: "A", NextStopId: "B", MinTravelSeconds: 15},
+				}),
+			},
+			want: true,
+		},
+		{
+			name: "travel faster than stop pair bound is invalid",
+			args: args{
+				stopTimePairs: []StopTimePair{
+					{
+						from: gtfs.StopTimeInstance{
+							StopTime:          gtfs.StopTime{StopId: "A"},
+							ArrivalDateTime:   time.Date(2020, 1, 12, 12, 0, 0, 0, location),
+							DepartureDateTime: time.Date(2020, 1, 12, 12, 0, 0, 0, location),
+						},
+						to: gtfs.StopTimeInstance{
+							StopTime:          gtfs.StopTime{StopId: "B"},
+							ArrivalDateTime:   time.Date(2020, 1, 12, 12, 1, 40, 0, location),
+							DepartureDateTime: time.Date(2020, 1, 12, 12, 1, 40, 0, location),
+						},
+						trip: nil,
+					},
+					{
+						from: gtfs.StopTimeInstance{
+							StopTime:          gtfs.StopTime{StopId: "B"},
+							ArrivalDateTime:   time.Date(2020, 1, 12, 12, 1, 40, 0, location),
+							DepartureDateTime: time.Date(2020, 1, 12, 12, 1, 40, 0, location),
+						},
+						to: gtfs.StopTimeInstance{
+							StopTime:          gtfs.StopTime{StopId: "C"},
+							ArrivalDateTime:   time.Date(2020, 1, 12, 12, 3, 20, 0, location),
+							DepartureDateTime: time.Date(2020, 1, 12, 12, 3, 20, 0, location),
+						},
+						trip: nil,
+					},
+				},
+				fromTimestamp:  time.Date(2020, 1, 12, 12, 0, 0, 0, location).Unix(),
+				toTimestamp:    time.Date(2020, 1, 12, 12, 0, 50, 0, location).Unix(),
+				earlyTolerance: 0.3,
+				travelBounds: NewTravelBounds([]gtfs.StopPairTravelBound{
+					{StopId: "A", NextStopId: "B", MinTravelSeconds: 25},
+				}),
+			},
+			want: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, _, _ := isMovementBelievable(tt.args.stopTimePairs, tt.args.fromTimestamp, tt.args.toTimestamp, tt.args.earlyTolerance)
+			got, _, _ := isMovementBelievable(tt.args.stopTimePairs, tt.args.fromTimestamp, tt.args.toTimestamp,
+				tt.args.earlyTolerance, tt.args.travelBounds)
 			if got != tt.want {
 				t.Errorf("isMovementBelievable() = %v, want %v", got, tt.want)
 			}
@@ -2081,8 +2146,8 @@ func Test_calculateTravelBetweenStops(t *testing.T) {
 	testTripOne := getFirstTestTripFromJson("trip_10900607_2021_07_22.json", t)
 
 	type args struct {
-		previousTripStopPosition *tripStopPosition
-		position                 *tripStopPosition
+		previousTripStopPosition *TripStopPosition
+		position                 *TripStopPosition
 	}
 
 	tests := []struct {
@@ -2095,7 +2160,7 @@ func Test_calculateTravelBetweenStops(t *testing.T) {
 			name: "no previousStopPosition produces no results",
 			args: args{
 				previousTripStopPosition: nil,
-				position: &tripStopPosition{
+				position: &TripStopPosition{
 					tripInstance:         testTripOne,
 					previousSTI:          testTripOne.StopTimeInstances[1],
 					nextSTI:              testTripOne.StopTimeInstances[2],
@@ -2109,13 +2174,13 @@ func Test_calculateTravelBetweenStops(t *testing.T) {
 		{
 			name: "no tripDistancePosition produces no results",
 			args: args{
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					tripInstance:  testTripOne,
 					previousSTI:   testTripOne.StopTimeInstances[0],
 					nextSTI:       testTripOne.StopTimeInstances[1],
 					lastTimestamp: testDate("2021-07-22T16:29:27-07:00").Unix(),
 				},
-				position: &tripStopPosition{
+				position: &TripStopPosition{
 					tripInstance:  testTripOne,
 					previousSTI:   testTripOne.StopTimeInstances[1],
 					nextSTI:       testTripOne.StopTimeInstances[2],
@@ -2128,14 +2193,14 @@ func Test_calculateTravelBetweenStops(t *testing.T) {
 		{
 			name: "perfect schedule while half way between stops",
 			args: args{
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					tripInstance:         testTripOne,
 					previousSTI:          testTripOne.StopTimeInstances[0],
 					nextSTI:              testTripOne.StopTimeInstances[1],
 					lastTimestamp:        testDate("2021-07-22T16:28:00-07:00").Unix(),
 					tripDistancePosition: float64Ptr(0),
 				},
-				position: &tripStopPosition{
+				position: &TripStopPosition{
 					tripInstance:         testTripOne,
 					previousSTI:          testTripOne.StopTimeInstances[1],
 					nextSTI:              testTripOne.StopTimeInstances[2],
@@ -2149,14 +2214,14 @@ func Test_calculateTravelBetweenStops(t *testing.T) {
 		{
 			name: "Took twice as long as schedule and half way between stops",
 			args: args{
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					tripInstance:         testTripOne,
 					previousSTI:          testTripOne.StopTimeInstances[0],
 					nextSTI:              testTripOne.StopTimeInstances[1],
 					lastTimestamp:        testDate("2021-07-22T16:28:00-07:00").Unix(),
 					tripDistancePosition: float64Ptr(0),
 				},
-				position: &tripStopPosition{
+				position: &TripStopPosition{
 					tripInstance:         testTripOne,
 					previousSTI:          testTripOne.StopTimeInstances[1],
 					nextSTI:              testTripOne.StopTimeInstances[2],
@@ -2170,14 +2235,14 @@ func Test_calculateTravelBetweenStops(t *testing.T) {
 		{
 			name: "Moved almost to the next stop",
 			args: args{
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					tripInstance:         testTripOne,
 					previousSTI:          testTripOne.StopTimeInstances[0],
 					nextSTI:              testTripOne.StopTimeInstances[1],
 					lastTimestamp:        testDate("2021-07-22T16:28:00-07:00").Unix(),
 					tripDistancePosition: float64Ptr(0),
 				},
-				position: &tripStopPosition{
+				position: &TripStopPosition{
 					tripInstance:         testTripOne,
 					previousSTI:          testTripOne.StopTimeInstances[1],
 					nextSTI:              testTripOne.StopTimeInstances[2],
@@ -2192,14 +2257,14 @@ func Test_calculateTravelBetweenStops(t *testing.T) {
 		{
 			name: "Barely past the last stop",
 			args: args{
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					tripInstance:         testTripOne,
 					previousSTI:          testTripOne.StopTimeInstances[0],
 					nextSTI:              testTripOne.StopTimeInstances[1],
 					lastTimestamp:        testDate("2021-07-22T16:28:00-07:00").Unix(),
 					tripDistancePosition: float64Ptr(0),
 				},
-				position: &tripStopPosition{
+				position: &TripStopPosition{
 					tripInstance:         testTripOne,
 					previousSTI:          testTripOne.StopTimeInstances[1],
 					nextSTI:              testTripOne.StopTimeInstances[2],
@@ -2214,7 +2279,7 @@ func Test_calculateTravelBetweenStops(t *testing.T) {
 		{
 			name: "previous positions travel time reduces length of scheduled travel",
 			args: args{
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					tripInstance:                 testTripOne,
 					previousSTI:                  testTripOne.StopTimeInstances[0],
 					nextSTI:                      testTripOne.StopTimeInstances[1],
@@ -2222,7 +2287,7 @@ func Test_calculateTravelBetweenStops(t *testing.T) {
 					tripDistancePosition:         float64Ptr(0),
 					scheduledSecondsFromLastStop: 35,
 				},
-				position: &tripStopPosition{
+				position: &TripStopPosition{
 					tripInstance:         testTripOne,
 					previousSTI:          testTripOne.StopTimeInstances[1],
 					nextSTI:              testTripOne.StopTimeInstances[2],
@@ -2236,14 +2301,14 @@ func Test_calculateTravelBetweenStops(t *testing.T) {
 		{
 			name: "trip distance is beyond next stop, don't use more than scheduled time for the stop",
 			args: args{
-				previousTripStopPosition: &tripStopPosition{
+				previousTripStopPosition: &TripStopPosition{
 					tripInstance:         testTripOne,
 					previousSTI:          testTripOne.StopTimeInstances[0],
 					nextSTI:              testTripOne.StopTimeInstances[1],
 					lastTimestamp:        testDate("2021-07-22T16:28:00-07:00").Unix(),
 					tripDistancePosition: float64Ptr(0),
 				},
-				position: &tripStopPosition{
+				position: &TripStopPosition{
 					tripInstance:         testTripOne,
 					previousSTI:          testTripOne.StopTimeInstances[1],
 					nextSTI:              testTripOne.StopTimeInstances[2],
@@ -2265,3 +2330,225 @@ func Test_calculateTravelBetweenStops(t *testing.T) {
 		})
 	}
 }
+
+// makeLoopTestTrip builds a lollipop trip that leaves terminal 7601, circles through 7603, 7604 and 7605, and returns
+// along the same street, so stops 7601 and 7602 are each visited twice
+func makeLoopTestTrip(serviceDate time.Time) *gtfs.TripInstance {
+	stopIds := []string{"7601", "7602", "7603", "7604", "7605", "7602", "7601"}
+	trip := &gtfs.TripInstance{Trip: gtfs.Trip{DataSetId: 1, TripId: "loop", RouteId: "96", BlockId: "9601"}}
+	for i, stopId := range stopIds {
+		stopTime := gtfs.StopTime{
+			DataSetId:         1,
+			TripId:            "loop",
+			StopSequence:      uint32(i + 1),
+			StopId:            stopId,
+			ArrivalTime:       8*60*60 + i*120,
+			DepartureTime:     8*60*60 + i*120,
+			ShapeDistTraveled: float64(i * 1500),
+		}
+		trip.StopTimeInstances = append(trip.StopTimeInstances, &gtfs.StopTimeInstance{
+			StopTime:          stopTime,
+			FirstStop:         i == 0,
+			ArrivalDateTime:   gtfs.MakeScheduleTime(serviceDate, stopTime.ArrivalTime),
+			DepartureDateTime: gtfs.MakeScheduleTime(serviceDate, stopTime.DepartureTime),
+		})
+	}
+	return trip
+}
+
+func TestVehicleMonitor_NewPositionOnLoopTrip(t *testing.T) {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatalf("Unable to load \"America/Los_Angeles\" timezone: %v", err)
+	}
+	serviceDate := time.Date(2022, 6, 1, 0, 0, 0, 0, location)
+	trip := makeLoopTestTrip(serviceDate)
+	if err = gtfs.ValidateTripTopology(trip); err != nil {
+		t.Fatalf("loop trip should be valid: %v", err)
+	}
+
+	// each vehicle starts stopped at the first stop, then reports status at stopSequences
+	tests := []struct {
+		name             string
+		stopSequences    []uint32
+		status           VehicleStopStatus
+		wantObservations int
+	}{
+		{
+			name:             "stopped at every stop",
+			stopSequences:    []uint32{2, 3, 4, 5, 6, 7},
+			status:           StoppedAt,
+			wantObservations: 6,
+		},
+		{
+			name:             "in transit to every stop",
+			stopSequences:    []uint32{2, 3, 4, 5, 6, 7},
+			status:           InTransitTo,
+			wantObservations: 5,
+		},
+		{
+			name:             "skipping the second visit to a repeated stop",
+			stopSequences:    []uint32{2, 3, 4, 5, 7},
+			status:           StoppedAt,
+			wantObservations: 6,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := makeVehicleMonitor("1", earlyTolerancePolicy{defaultTolerance: .2}, 15*60, Smoothing{})
+			var observations []*gtfs.ObservedStopTime
+			for i, stopSequence := range append([]uint32{1}, tt.stopSequences...) {
+				stop := trip.StopTimeInstances[stopSequence-1]
+				status := tt.status
+				if i == 0 {
+					status = StoppedAt
+				}
+				position := Position{
+					Id:                "1",
+					Timestamp:         stop.ArrivalDateTime.Unix() + 5,
+					TripId:            strPtr(trip.TripId),
+					VehicleStopStatus: status,
+					StopSequence:      uint32Ptr(stopSequence),
+					// the stop_id reported is ambiguous on loop trips and must not be used to place the vehicle
+					StopId: strPtr(stop.StopId),
+				}
+				_, osts := vm.newPosition(position, trip)
+				observations = append(observations, osts...)
+			}
+			if len(observations) != tt.wantObservations {
+				t.Fatalf("got %d observations, want %d. last outcome: %s %s", len(observations),
+					tt.wantObservations, vm.lastOutcome, vm.lastOutcomeDetail)
+			}
+			for i, observation := range observations {
+				from := trip.StopTimeInstances[i]
+				to := trip.StopTimeInstances[i+1]
+				if observation.StopId != from.StopId || observation.NextStopId != to.StopId ||
+					observation.StopDistance != from.ShapeDistTraveled ||
+					observation.NextStopDistance != to.ShapeDistTraveled {
+					t.Errorf("observation %d moved from %s at %v to %s at %v, want stop_sequence %d to %d",
+						i, observation.StopId, observation.StopDistance, observation.NextStopId,
+						observation.NextStopDistance, from.StopSequence, to.StopSequence)
+				}
+			}
+		})
+	}
+}
+
+func TestMonitor_acceptPositionOrder(t *testing.T) {
+	at := time.Date(2022, 5, 22, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		timestamp     time.Time
+		wantAccept    bool
+		wantTimestamp time.Time
+	}{
+		{
+			name:          "newer position",
+			timestamp:     at.Add(time.Second),
+			wantAccept:    true,
+			wantTimestamp: at.Add(time.Second),
+		},
+		{
+			name:          "older within tolerance",
+			timestamp:     at.Add(-10 * time.Second),
+			wantAccept:    true,
+			wantTimestamp: at,
+		},
+		{
+			name:       "older beyond tolerance",
+			timestamp:  at.Add(-11 * time.Second),
+			wantAccept: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := Monitor{
+				lastPosition:          &Position{Id: "1", Timestamp: at.Unix()},
+				staleToleranceSeconds: 10,
+			}
+			position := Position{Id: "1", Timestamp: tt.timestamp.Unix()}
+			if got := vm.acceptPositionOrder(&position); got != tt.wantAccept {
+				t.Fatalf("acceptPositionOrder() = %v, want %v", got, tt.wantAccept)
+			}
+			if clamped := position.Timestamp != tt.timestamp.Unix(); vm.lastClampedToLast != clamped {
+				t.Errorf("acceptPositionOrder() lastClampedToLast = %v, want %v", vm.lastClampedToLast, clamped)
+			}
+			if tt.wantAccept && position.Timestamp != tt.wantTimestamp.Unix() {
+				t.Errorf("acceptPositionOrder() timestamp = %d, want %d", position.Timestamp,
+					tt.wantTimestamp.Unix())
+			}
+		})
+	}
+}
+
+func TestNewCollection(t *testing.T) {
+	collection, err := NewCollection(Options{EarlyTolerance: 0.1, ExpirePositionSeconds: 900})
+	if err != nil {
+		t.Fatalf("NewCollection() error = %v", err)
+	}
+	if collection.interpolation != interpolateBySchedule {
+		t.Errorf("NewCollection() interpolation = %q, want %q", collection.interpolation, interpolateBySchedule)
+	}
+	if monitor := collection.Vehicle("1"); monitor != collection.Vehicle("1") || monitor.Id != "1" {
+		t.Errorf("Vehicle() expected the same Monitor for a vehicle")
+	}
+	if _, err = NewCollection(Options{Interpolation: "speed"}); err == nil {
+		t.Errorf("NewCollection() expected error for unknown interpolation")
+	}
+	if _, err = NewCollection(Options{RouteTypeEarlyTolerances: []string{"0"}}); err == nil {
+		t.Errorf("NewCollection() expected error for invalid route type early tolerance")
+	}
+}
+
+// benchmarkPositions returns the positions of vehicle 102 running both test trips and the trip each is on
+func benchmarkPositions(b *testing.B) ([]Position, []*gtfs.TripInstance) {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		b.Fatalf("Unable to load \"America/Los_Angeles\" timezone: %v", err)
+	}
+	testTrips := getTestTrips(time.Date(2019, 12, 11, 16, 0, 0, 0, location), b)
+	positions := getTestVehiclePositions(b, "testdata/vehicle_102_vehicle_positions.json")
+	trips := make([]*gtfs.TripInstance, len(positions))
+	for i, position := range positions {
+		trips[i] = getTestTrip(testTrips, position.TripId, b)
+	}
+	return positions, trips
+}
+
+func BenchmarkMonitor_newPosition(b *testing.B) {
+	positions, trips := benchmarkPositions(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		vm := makeVehicleMonitor("102", earlyTolerancePolicy{defaultTolerance: .2}, 15*60, Smoothing{})
+		for i, position := range positions {
+			vm.newPosition(position, trips[i])
+		}
+	}
+}
+
+func Benchmark_getStopPairsBetweenPositions(b *testing.B) {
+	positions, trips := benchmarkPositions(b)
+	// collect the consecutive TripStopPositions observations are made between while replaying the positions
+	var lastPositions, currentPositions []*TripStopPosition
+	vm := makeVehicleMonitor("102", earlyTolerancePolicy{defaultTolerance: .2}, 15*60, Smoothing{})
+	for i, position := range positions {
+		lastPosition := vm.lastTripStopPosition
+		currentPosition, observations := vm.newPosition(position, trips[i])
+		if lastPosition != nil && currentPosition != nil && len(observations) > 0 {
+			lastPositions = append(lastPositions, lastPosition)
+			currentPositions = append(currentPositions, currentPosition)
+		}
+	}
+	if len(lastPositions) == 0 {
+		b.Fatalf("replaying positions made no observations")
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		i := n % len(lastPositions)
+		if _, err := getStopPairsBetweenPositions(lastPositions[i], currentPositions[i]); err != nil {
+			b.Fatalf("getStopPairsBetweenPositions() error = %v", err)
+		}
+	}
+}
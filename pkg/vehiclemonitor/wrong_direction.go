@@ -0,0 +1,155 @@
+package vehiclemonitor
+
+import (
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"math"
+	"time"
+)
+
+const (
+	// wrongDirectionMinimumMeters is how far a vehicle must move between GPS points before the direction of its
+	// movement is compared with its trip's shape, so GPS jitter while stopped isn't taken as movement
+	wrongDirectionMinimumMeters = 25.0
+	// wrongDirectionDegrees is the least difference between the vehicle's direction and its trip's shape for the
+	// vehicle to be travelling the shape in reverse
+	wrongDirectionDegrees = 135.0
+	// wrongDirectionMovements is the number of consecutive movements in reverse before the vehicle is considered to
+	// be running its trip in the wrong direction
+	wrongDirectionMovements = 3
+)
+
+// directionCheck watches consecutive GPS points of a vehicle for movement against the direction of its trip's shape,
+// as when AVL reports a trip while the vehicle is on a training run or a deadhead with the wrong sign on
+type directionCheck struct {
+	tripId string
+	//lastLatitude and lastLongitude are the GPS point the next movement is measured from
+	lastLatitude  float64
+	lastLongitude float64
+	hasLast       bool
+	//reverseMovements is the number of consecutive movements against the shape's direction
+	reverseMovements int
+}
+
+// reset forgets the movement seen so far, starting over on tripId
+func (d *directionCheck) reset(tripId string) {
+	*d = directionCheck{tripId: tripId}
+}
+
+// check adds the GPS point of position to the vehicle's movement and returns true while the vehicle has moved
+// against the direction of its trip's shape for wrongDirectionMovements consecutive movements, along with a
+// description of the last movement compared. Positions without GPS or a shape to compare with leave the check
+// unchanged
+func (d *directionCheck) check(position *TripStopPosition) (bool, string) {
+	trip := position.tripInstance
+	if trip.TripId != d.tripId {
+		d.reset(trip.TripId)
+	}
+	if position.latitude == nil || position.longitude == nil {
+		return d.wrongDirection(), ""
+	}
+	latitude := float64(*position.latitude)
+	longitude := float64(*position.longitude)
+	if !d.hasLast {
+		d.lastLatitude, d.lastLongitude, d.hasLast = latitude, longitude, true
+		return false, ""
+	}
+	moved := simpleLatLngDistance(d.lastLatitude, d.lastLongitude, latitude, longitude)
+	if moved < wrongDirectionMinimumMeters {
+		return d.wrongDirection(), ""
+	}
+	shapeBearing, found := shapeBearingNear(trip, position.previousSTI.ShapeDistTraveled,
+		position.nextSTI.ShapeDistTraveled, latitude, longitude)
+	if !found {
+		return d.wrongDirection(), ""
+	}
+	movementBearing := bearing(d.lastLatitude, d.lastLongitude, latitude, longitude)
+	d.lastLatitude, d.lastLongitude = latitude, longitude
+	difference := bearingDifference(movementBearing, shapeBearing)
+	if difference >= wrongDirectionDegrees {
+		d.reverseMovements++
+	} else {
+		d.reverseMovements = 0
+	}
+	return d.wrongDirection(), fmt.Sprintf("moved %.0f meters heading %.0f degrees, shape heading %.0f degrees",
+		moved, movementBearing, shapeBearing)
+}
+
+// wrongDirection returns true once wrongDirectionMovements consecutive movements have been against the shape
+func (d *directionCheck) wrongDirection() bool {
+	return d.reverseMovements >= wrongDirectionMovements
+}
+
+// wrongDirectionAnomaly builds the gtfs.VehicleAssignmentAnomaly logged when a vehicle is first found running
+// the trip of position in the wrong direction
+func wrongDirectionAnomaly(vehicleId string,
+	position *TripStopPosition,
+	detail string) *gtfs.VehicleAssignmentAnomaly {
+	trip := position.tripInstance
+	return &gtfs.VehicleAssignmentAnomaly{
+		DetectedAt:   time.Unix(position.lastTimestamp, 0),
+		VehicleId:    vehicleId,
+		DataSetId:    trip.DataSetId,
+		TripId:       trip.TripId,
+		RouteId:      trip.RouteId,
+		BlockId:      trip.BlockId,
+		StopSequence: position.previousSTI.StopSequence,
+		Anomaly:      gtfs.WrongDirectionAnomaly,
+		Detail:       detail,
+	}
+}
+
+// shapeBearingNear returns the bearing in degrees of the segment of trip's shape nearest lat, lon that overlaps the
+// shape between fromDist and toDist, and false when no segment is within maximumShapeMatchMeters
+func shapeBearingNear(trip *gtfs.TripInstance, fromDist, toDist, lat, lon float64) (float64, bool) {
+	bestDistance := maximumShapeMatchMeters
+	bestBearing := 0.0
+	found := false
+	for i := 0; i+1 < len(trip.Shapes); i++ {
+		start := trip.Shapes[i]
+		end := trip.Shapes[i+1]
+		if start.ShapeDistTraveled == nil || end.ShapeDistTraveled == nil {
+			continue
+		}
+		if *end.ShapeDistTraveled < fromDist {
+			continue
+		}
+		if *start.ShapeDistTraveled > toDist {
+			break
+		}
+		if start.ShapePtLat == end.ShapePtLat && start.ShapePtLng == end.ShapePtLng {
+			continue
+		}
+		snappedLat, snappedLon := nearestLatLngToLineFromPoint(start.ShapePtLat, start.ShapePtLng,
+			end.ShapePtLat, end.ShapePtLng, lat, lon)
+		distance := simpleLatLngDistance(snappedLat, snappedLon, lat, lon)
+		if distance <= bestDistance {
+			bestDistance = distance
+			bestBearing = bearing(start.ShapePtLat, start.ShapePtLng, end.ShapePtLat, end.ShapePtLng)
+			found = true
+		}
+	}
+	return bestBearing, found
+}
+
+// bearing returns the approximate compass bearing in degrees, from 0 up to 360, of travel from lat1, lon1 to
+// lat2, lon2, with the same simplifications as simpleLatLngDistance
+func bearing(lat1, lon1, lat2, lon2 float64) float64 {
+	latitude := (lat1 + lat2) / 2 * math.Pi / 180
+	north := lat2 - lat1
+	east := (lon2 - lon1) * math.Cos(latitude)
+	degrees := math.Atan2(east, north) * 180 / math.Pi
+	if degrees < 0 {
+		degrees += 360
+	}
+	return degrees
+}
+
+// bearingDifference returns the angle in degrees, from 0 to 180, between two bearings
+func bearingDifference(bearing1, bearing2 float64) float64 {
+	difference := math.Mod(math.Abs(bearing1-bearing2), 360)
+	if difference > 180 {
+		difference = 360 - difference
+	}
+	return difference
+}
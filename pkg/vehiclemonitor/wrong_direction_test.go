@@ -0,0 +1,86 @@
+package vehiclemonitor
+
+import (
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"testing"
+)
+
+func Test_directionCheck_check(t *testing.T) {
+	// trip's shape heads due north from 45.5, -122.6 for about 1100 meters, shape distance in feet
+	northDist := 3600.0
+	trip := &gtfs.TripInstance{
+		Trip: gtfs.Trip{TripId: "1"},
+		Shapes: []*gtfs.Shape{
+			{ShapePtLat: 45.5, ShapePtLng: -122.6, ShapeDistTraveled: float64Ptr(0)},
+			{ShapePtLat: 45.51, ShapePtLng: -122.6, ShapeDistTraveled: &northDist},
+		},
+	}
+	from := &gtfs.StopTimeInstance{StopTime: gtfs.StopTime{ShapeDistTraveled: 0}}
+	to := &gtfs.StopTimeInstance{StopTime: gtfs.StopTime{ShapeDistTraveled: northDist}}
+	// positionAt places the vehicle on trip at lat on the shape's longitude
+	positionAt := func(lat float32) *TripStopPosition {
+		lon := float32(-122.6)
+		return &TripStopPosition{tripInstance: trip, previousSTI: from, nextSTI: to, latitude: &lat, longitude: &lon}
+	}
+	tests := []struct {
+		name      string
+		latitudes []float32
+		want      bool
+	}{
+		{
+			name:      "travelling with the shape",
+			latitudes: []float32{45.501, 45.502, 45.503, 45.504, 45.505},
+			want:      false,
+		},
+		{
+			name:      "travelling against the shape",
+			latitudes: []float32{45.505, 45.504, 45.503, 45.502},
+			want:      true,
+		},
+		{
+			name:      "too few movements against the shape",
+			latitudes: []float32{45.505, 45.504, 45.503},
+			want:      false,
+		},
+		{
+			name:      "movement with the shape clears reverse movements",
+			latitudes: []float32{45.505, 45.504, 45.503, 45.504, 45.503, 45.502},
+			want:      false,
+		},
+		{
+			name:      "GPS jitter is not movement",
+			latitudes: []float32{45.505, 45.504, 45.503, 45.50301, 45.503, 45.50302},
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := directionCheck{}
+			got := false
+			for _, lat := range tt.latitudes {
+				got, _ = d.check(positionAt(lat))
+			}
+			if got != tt.want {
+				t.Errorf("check() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_bearingDifference(t *testing.T) {
+	tests := []struct {
+		bearing1 float64
+		bearing2 float64
+		want     float64
+	}{
+		{bearing1: 0, bearing2: 180, want: 180},
+		{bearing1: 350, bearing2: 10, want: 20},
+		{bearing1: 90, bearing2: 45, want: 45},
+		{bearing1: 270, bearing2: 60, want: 150},
+	}
+	for _, tt := range tests {
+		if got := bearingDifference(tt.bearing1, tt.bearing2); got != tt.want {
+			t.Errorf("bearingDifference(%v, %v) = %v, want %v", tt.bearing1, tt.bearing2, got, tt.want)
+		}
+	}
+}
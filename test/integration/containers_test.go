@@ -0,0 +1,135 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/foundation/database"
+	"github.com/jmoiron/sqlx"
+	"github.com/nats-io/nats.go"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// containerStartTimeout is how long containers have to accept connections after starting
+const containerStartTimeout = 60 * time.Second
+
+// startContainer runs image in docker with containerPort published on a random host port, removing the container when
+// the test ends. Returns the host port
+func startContainer(t *testing.T, image string, containerPort string, env ...string) string {
+	t.Helper()
+	var dockerArgs []string
+	for _, variable := range env {
+		dockerArgs = append(dockerArgs, "--env", variable)
+	}
+	return startContainerWithArgs(t, image, containerPort, dockerArgs, nil)
+}
+
+// startContainerWithArgs runs image like startContainer, adding dockerArgs to the docker run options and passing
+// command to the image. Returns the host port
+func startContainerWithArgs(t *testing.T,
+	image string,
+	containerPort string,
+	dockerArgs []string,
+	command []string) string {
+	t.Helper()
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker is required for integration tests")
+	}
+	args := []string{"run", "--detach", "--rm", "--publish", containerPort}
+	args = append(args, dockerArgs...)
+	args = append(args, image)
+	args = append(args, command...)
+	output, err := exec.Command("docker", args...).Output()
+	if err != nil {
+		t.Fatalf("unable to start %s container: %v", image, err)
+	}
+	containerId := strings.TrimSpace(string(output))
+	t.Cleanup(func() {
+		_ = exec.Command("docker", "rm", "--force", containerId).Run()
+	})
+	output, err = exec.Command("docker", "port", containerId, containerPort).Output()
+	if err != nil {
+		t.Fatalf("unable to find host port of %s container: %v", image, err)
+	}
+	// the first line is the address on all ipv4 interfaces, such as 0.0.0.0:49153
+	address := strings.Split(strings.TrimSpace(string(output)), "\n")[0]
+	return address[strings.LastIndex(address, ":")+1:]
+}
+
+// startPostgres starts a Postgres container and connects to it once it's ready, with the schedule, monitor and model
+// tables created from the ddl directory
+func startPostgres(t *testing.T) *sqlx.DB {
+	t.Helper()
+	port := startContainer(t, "postgres:14", "5432", "POSTGRES_PASSWORD=postgres")
+	db, err := database.Open(database.Config{
+		User:       "postgres",
+		Password:   "postgres",
+		Host:       "localhost:" + port,
+		Name:       "postgres",
+		DisableTLS: true,
+	})
+	if err != nil {
+		t.Fatalf("unable to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	// postgres restarts once after initializing the database, so wait until the schema can be created
+	deadline := time.Now().Add(containerStartTimeout)
+	for {
+		err = createSchema(db)
+		if err == nil {
+			return db
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unable to create schema: %v", err)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// createSchema runs the ddl files used by the apps in a single transaction
+func createSchema(db *sqlx.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, file := range []string{"schedule_and_monitor_ddl.sql", "models_ddl.sql"} {
+		ddl, err := os.ReadFile(filepath.Join("..", "..", "ddl", file))
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, string(ddl)); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("unable to run %s: %w", file, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// startNats starts a NATS container and connects to it once it's ready
+func startNats(t *testing.T) *nats.Conn {
+	t.Helper()
+	port := startContainer(t, "nats:2", "4222")
+	deadline := time.Now().Add(containerStartTimeout)
+	for {
+		conn, err := nats.Connect("nats://localhost:" + port)
+		if err == nil {
+			t.Cleanup(conn.Close)
+			return conn
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unable to connect to nats: %v", err)
+		}
+		time.Sleep(time.Second)
+	}
+}
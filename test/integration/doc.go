@@ -0,0 +1,8 @@
+// Package integration runs gtfs-loader, gtfs-monitor and gtfs-aggregator together against Postgres and NATS started
+// in docker containers, checking the contracts between the apps from a loaded schedule to published TripUpdates, and
+// the contract with OpenTripPlanner consuming the TripUpdates feed served by gtfs-tripupdate-svc.
+//
+// The tests require docker and are only built with the integration tag:
+//
+//	go test -tags integration ./test/integration/...
+package integration
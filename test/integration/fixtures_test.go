@@ -0,0 +1,224 @@
+//go:build integration
+
+package integration
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfsrtproto"
+	"google.golang.org/protobuf/proto"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fixture trip identifiers
+const (
+	fixtureRouteId   = "route-1"
+	fixtureTripId    = "trip-1"
+	fixtureVehicleId = "vehicle-1"
+)
+
+// fixtureStopCount is the number of stops on the fixture trip
+const fixtureStopCount = 6
+
+// fixtureStopSeconds is the scheduled travel time between each stop on the fixture trip
+const fixtureStopSeconds = 120
+
+// fixtureStopLongitudeSpacing is the distance in degrees between each stop, running east along fixtureLatitude
+const (
+	fixtureLatitude             = 45.5
+	fixtureStartLongitude       = -122.68
+	fixtureStopLongitudeSpacing = 0.005
+)
+
+// fixtureSchedule is a single trip scheduled on today's service date, started half way through its stops at now
+type fixtureSchedule struct {
+	serviceDate time.Time
+	startTime   int
+}
+
+// makeFixtureSchedule builds fixtureSchedule with the trip reaching its middle stop a minute before now
+func makeFixtureSchedule(t *testing.T, now time.Time) fixtureSchedule {
+	serviceDate := gtfs.Get12AmTime(now)
+	nowSeconds := int(now.Sub(serviceDate).Seconds())
+	startTime := nowSeconds - 60 - (fixtureStopCount/2-1)*fixtureStopSeconds
+	if startTime < 0 || nowSeconds+fixtureStopCount*fixtureStopSeconds > 24*60*60 {
+		t.Skip("fixture trip can't be scheduled across midnight")
+	}
+	return fixtureSchedule{serviceDate: serviceDate, startTime: startTime}
+}
+
+// stopTime returns the scheduled seconds after midnight of the stop at index
+func (f fixtureSchedule) stopTime(index int) int {
+	return f.startTime + index*fixtureStopSeconds
+}
+
+// stopLongitude returns the longitude of the stop at index
+func stopLongitude(index int) float64 {
+	return fixtureStartLongitude + float64(index)*fixtureStopLongitudeSpacing
+}
+
+// stopDistance returns the distance in feet along the shape of the stop at index
+func stopDistance(index int) float64 {
+	metersPerDegree := 111300 * math.Cos(fixtureLatitude*math.Pi/180)
+	return float64(index) * fixtureStopLongitudeSpacing * metersPerDegree * 3.281
+}
+
+// gtfsZip builds a gtfs zip file holding the fixture trip
+func (f fixtureSchedule) gtfsZip(t *testing.T) []byte {
+	files := map[string][]string{
+		"agency.txt": {"agency_id,agency_name,agency_url,agency_timezone",
+			fmt.Sprintf("agency-1,Fixture Transit,https://example.com,%s", time.Local.String())},
+		"calendar_dates.txt": {"service_id,date,exception_type",
+			fmt.Sprintf("service-1,%s,1", f.serviceDate.Format("20060102"))},
+		"routes.txt": {"route_id,agency_id,route_short_name,route_type", fixtureRouteId + ",agency-1,1,3"},
+		"trips.txt": {"route_id,service_id,trip_id,block_id,shape_id",
+			fmt.Sprintf("%s,service-1,%s,block-1,shape-1", fixtureRouteId, fixtureTripId)},
+	}
+	stops := []string{"stop_id,stop_name,stop_lat,stop_lon"}
+	stopTimes := []string{"trip_id,arrival_time,departure_time,stop_id,stop_sequence,shape_dist_traveled,timepoint"}
+	shapes := []string{"shape_id,shape_pt_lat,shape_pt_lon,shape_pt_sequence,shape_dist_traveled"}
+	for i := 0; i < fixtureStopCount; i++ {
+		stops = append(stops, fmt.Sprintf("stop-%d,Stop %d,%f,%f", i+1, i+1, fixtureLatitude, stopLongitude(i)))
+		scheduled := formatGTFSTime(f.stopTime(i))
+		stopTimes = append(stopTimes, fmt.Sprintf("%s,%s,%s,stop-%d,%d,%.1f,1", fixtureTripId, scheduled, scheduled,
+			i+1, i+1, stopDistance(i)))
+		shapes = append(shapes, fmt.Sprintf("shape-1,%f,%f,%d,%.1f", fixtureLatitude, stopLongitude(i), i+1,
+			stopDistance(i)))
+	}
+	files["stops.txt"] = stops
+	files["stop_times.txt"] = stopTimes
+	files["shapes.txt"] = shapes
+
+	var buffer bytes.Buffer
+	zipWriter := zip.NewWriter(&buffer)
+	for name, lines := range files {
+		writer, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatalf("unable to create %s: %v", name, err)
+		}
+		if _, err = writer.Write([]byte(strings.Join(lines, "\n") + "\n")); err != nil {
+			t.Fatalf("unable to write %s: %v", name, err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatalf("unable to write gtfs zip: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// formatGTFSTime formats seconds after midnight as HH:MM:SS
+func formatGTFSTime(seconds int) string {
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// serveGTFS serves gtfsZip with a Last-Modified header, as gtfs-loader expects from an agency's server
+func serveGTFS(t *testing.T, gtfsZip []byte) string {
+	modified := time.Now().Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "gtfs.zip", modified, bytes.NewReader(gtfsZip))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// fixturePosition is a vehicle position replayed to gtfs-monitor
+type fixturePosition struct {
+	timestamp    int64
+	stoppedAt    bool
+	latitude     float64
+	longitude    float64
+	stopSequence uint32
+}
+
+// positions returns the fixture vehicle's positions, stopped at each stop up to and including the middle stop at its
+// scheduled time and in transit half way between them, running on schedule
+func (f fixtureSchedule) positions() []fixturePosition {
+	var positions []fixturePosition
+	for i := 0; i < fixtureStopCount/2; i++ {
+		if i > 0 {
+			positions = append(positions, fixturePosition{
+				timestamp:    gtfs.MakeScheduleTime(f.serviceDate, f.stopTime(i)-fixtureStopSeconds/2).Unix(),
+				latitude:     fixtureLatitude,
+				longitude:    (stopLongitude(i-1) + stopLongitude(i)) / 2,
+				stopSequence: uint32(i + 1),
+			})
+		}
+		positions = append(positions, fixturePosition{
+			timestamp:    gtfs.MakeScheduleTime(f.serviceDate, f.stopTime(i)).Unix(),
+			stoppedAt:    true,
+			latitude:     fixtureLatitude,
+			longitude:    stopLongitude(i),
+			stopSequence: uint32(i + 1),
+		})
+	}
+	return positions
+}
+
+// vehiclePositionFeed serves a gtfs-rt vehicle position feed, advancing through positions one at a time on each
+// request and repeating the last once all have been served
+type vehiclePositionFeed struct {
+	mu        sync.Mutex
+	positions []fixturePosition
+	next      int
+}
+
+func (v *vehiclePositionFeed) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	v.mu.Lock()
+	position := v.positions[v.next]
+	if v.next < len(v.positions)-1 {
+		v.next++
+	}
+	v.mu.Unlock()
+
+	status := gtfsrtproto.VehiclePosition_IN_TRANSIT_TO
+	if position.stoppedAt {
+		status = gtfsrtproto.VehiclePosition_STOPPED_AT
+	}
+	feed := gtfsrtproto.FeedMessage{
+		Header: &gtfsrtproto.FeedHeader{
+			GtfsRealtimeVersion: proto.String("2.0"),
+			Timestamp:           proto.Uint64(uint64(position.timestamp)),
+		},
+		Entity: []*gtfsrtproto.FeedEntity{{
+			Id: proto.String(fixtureVehicleId),
+			Vehicle: &gtfsrtproto.VehiclePosition{
+				Trip: &gtfsrtproto.TripDescriptor{
+					TripId:  proto.String(fixtureTripId),
+					RouteId: proto.String(fixtureRouteId),
+				},
+				Vehicle: &gtfsrtproto.VehicleDescriptor{
+					Id:    proto.String(fixtureVehicleId),
+					Label: proto.String(fixtureRouteId),
+				},
+				Position: &gtfsrtproto.Position{
+					Latitude:  proto.Float32(float32(position.latitude)),
+					Longitude: proto.Float32(float32(position.longitude)),
+				},
+				CurrentStopSequence: proto.Uint32(position.stopSequence),
+				CurrentStatus:       status.Enum(),
+				Timestamp:           proto.Uint64(uint64(position.timestamp)),
+			},
+		}},
+	}
+	data, err := proto.Marshal(&feed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(data)
+}
+
+// serveVehiclePositions serves positions as a gtfs-rt vehicle position feed
+func serveVehiclePositions(t *testing.T, positions []fixturePosition) string {
+	server := httptest.NewServer(&vehiclePositionFeed{positions: positions})
+	t.Cleanup(server.Close)
+	return server.URL
+}
@@ -0,0 +1,242 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/OpenTransitTools/transitcast/app/gtfs-tripupdate-svc/tripupdate"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// otpImage is the OpenTripPlanner release the TripUpdates feed is verified against
+const otpImage = "opentripplanner/opentripplanner:2.5.0"
+
+// otpFeedId is the feed id OpenTripPlanner gives the fixture schedule and the TripUpdates feed
+const otpFeedId = "transitcast"
+
+// otpTimeout is how long OpenTripPlanner has to build its graph and apply the published delays
+const otpTimeout = 5 * time.Minute
+
+// fixtureDelaySeconds is the delay published for each stop the fixture vehicle hasn't reached
+const fixtureDelaySeconds = 180
+
+// Test_otpStopTimeUpdater publishes TripUpdates on NATS as gtfs-aggregator does, serves them from gtfs-tripupdate-svc
+// in the time feed mode to OpenTripPlanner's stop-time-updater, and expects OpenTripPlanner to plan the fixture
+// trip's remaining stops with the published delay
+func Test_otpStopTimeUpdater(t *testing.T) {
+	if time.Local.String() == "Local" {
+		t.Skip("TZ must name a time zone for OpenTripPlanner to load the fixture schedule")
+	}
+	logger := log.New(os.Stdout, "INTEGRATION : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile)
+	fixture := makeFixtureSchedule(t, time.Now())
+	natsConn := startNats(t)
+
+	feedPort := freePort(t)
+	serviceShutdown := make(chan os.Signal, 1)
+	serviceDone := make(chan bool)
+	go func() {
+		tripupdate.StartServices(logger, 120, feedPort, natsConn, predictionSubject, nil, tripupdate.ArrivalsConf{},
+			tripupdate.FeedConf{Mode: tripupdate.FeedModeTime, NoData: tripupdate.NoDataEach}, serviceShutdown)
+		serviceDone <- true
+	}()
+	defer func() {
+		serviceShutdown <- os.Interrupt
+		<-serviceDone
+	}()
+
+	// TripUpdates are republished until the test ends so they don't expire while OpenTripPlanner builds its graph
+	natsCodec, err := natsclient.NewCodec(natsclient.CompressionGzip, natsclient.EncodingProtobuf)
+	if err != nil {
+		t.Fatalf("unable to create NATS codec: %v", err)
+	}
+	stopPublishing := make(chan bool)
+	defer close(stopPublishing)
+	go func() {
+		for {
+			tripUpdate := fixture.delayedTripUpdate(time.Now())
+			data, err := natsCodec.Marshal(&tripUpdate)
+			if err != nil {
+				t.Errorf("unable to marshal TripUpdate: %v", err)
+				return
+			}
+			if err = natsConn.Publish(predictionSubject, data); err != nil {
+				t.Errorf("unable to publish TripUpdate: %v", err)
+				return
+			}
+			select {
+			case <-stopPublishing:
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}()
+
+	otpPort := startOTP(t, fixture.gtfsZip(t), feedPort)
+
+	var lastResult string
+	deadline := time.Now().Add(otpTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(5 * time.Second)
+		stopTimes, err := otpStopTimes(otpPort, fixture.serviceDate)
+		if err != nil {
+			lastResult = err.Error()
+			continue
+		}
+		lastResult = fmt.Sprintf("%+v", stopTimes)
+		if fixtureDelaysApplied(stopTimes) {
+			validateServedFeed(t, feedPort)
+			return
+		}
+	}
+	t.Fatalf("OpenTripPlanner didn't apply the published delay of %d seconds within %v, last result: %s",
+		fixtureDelaySeconds, otpTimeout, lastResult)
+}
+
+// delayedTripUpdate builds the TripUpdate gtfs-aggregator would publish at "at" for the fixture trip, with the stops
+// after the middle stop predicted fixtureDelaySeconds late
+func (f fixtureSchedule) delayedTripUpdate(at time.Time) gtfs.TripUpdate {
+	tripUpdate := gtfs.TripUpdate{
+		TripId:               fixtureTripId,
+		RouteId:              fixtureRouteId,
+		ScheduleRelationship: "SCHEDULED",
+		Timestamp:            uint64(at.Unix()),
+		VehicleId:            fixtureVehicleId,
+		SchemaVersion:        gtfs.MessageSchemaVersion,
+	}
+	for i := fixtureStopCount / 2; i < fixtureStopCount; i++ {
+		scheduled := gtfs.MakeScheduleTime(f.serviceDate, f.stopTime(i))
+		tripUpdate.StopTimeUpdates = append(tripUpdate.StopTimeUpdates, gtfs.StopTimeUpdate{
+			StopSequence:         uint32(i + 1),
+			StopId:               fmt.Sprintf("stop-%d", i+1),
+			ArrivalDelay:         fixtureDelaySeconds,
+			ScheduledArrivalTime: scheduled,
+			PredictedArrivalTime: scheduled.Add(fixtureDelaySeconds * time.Second),
+			PredictionSource:     gtfs.StopMLPrediction,
+		})
+	}
+	return tripUpdate
+}
+
+// freePort returns a port on the host that's not in use
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("unable to find free port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+	return port
+}
+
+// startOTP starts an OpenTripPlanner container that builds a transit only graph from gtfsZip and polls the TripUpdates
+// feed served on feedPort of the host. Returns the host port of OpenTripPlanner's api
+func startOTP(t *testing.T, gtfsZip []byte, feedPort int) string {
+	t.Helper()
+	directory := t.TempDir()
+	files := map[string][]byte{
+		"gtfs.zip": gtfsZip,
+		"build-config.json": []byte(fmt.Sprintf(
+			`{"transitFeeds": [{"type": "gtfs", "feedId": %q, "source": "file:///var/opentripplanner/gtfs.zip"}]}`,
+			otpFeedId)),
+		"router-config.json": []byte(fmt.Sprintf(`{"updaters": [{"type": "stop-time-updater", "frequency": "5s", `+
+			`"url": "http://host.docker.internal:%d/tripUpdate", "feedId": %q}]}`, feedPort, otpFeedId)),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(directory, name), data, 0644); err != nil {
+			t.Fatalf("unable to write %s: %v", name, err)
+		}
+	}
+	return startContainerWithArgs(t, otpImage, "8080", []string{
+		"--volume", directory + ":/var/opentripplanner",
+		"--add-host", "host.docker.internal:host-gateway",
+		"--env", "JAVA_TOOL_OPTIONS=-Xmx2g",
+	}, []string{"--build", "--serve"})
+}
+
+// otpStopTime is a stop time of the fixture trip as planned by OpenTripPlanner
+type otpStopTime struct {
+	Stop struct {
+		GtfsId string `json:"gtfsId"`
+	} `json:"stop"`
+	Realtime     bool `json:"realtime"`
+	ArrivalDelay int  `json:"arrivalDelay"`
+}
+
+// otpStopTimes queries OpenTripPlanner's GTFS GraphQL api on otpPort for the fixture trip's stop times on serviceDate
+func otpStopTimes(otpPort string, serviceDate time.Time) ([]otpStopTime, error) {
+	query := fmt.Sprintf(`{ trip(id: "%s:%s") { stoptimesForDate(serviceDate: "%s") `+
+		`{ stop { gtfsId } realtime arrivalDelay } } }`, otpFeedId, fixtureTripId, serviceDate.Format("20060102"))
+	body, err := json.Marshal(map[string]string{"query": query})
+	if err != nil {
+		return nil, err
+	}
+	response, err := http.Post("http://localhost:"+otpPort+"/otp/gtfs/v1", "application/json",
+		bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s: %s", response.Status, string(data))
+	}
+	var result struct {
+		Data struct {
+			Trip *struct {
+				StoptimesForDate []otpStopTime `json:"stoptimesForDate"`
+			} `json:"trip"`
+		} `json:"data"`
+	}
+	if err = json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("unable to parse response %s: %w", string(data), err)
+	}
+	if result.Data.Trip == nil {
+		return nil, fmt.Errorf("trip not found: %s", string(data))
+	}
+	return result.Data.Trip.StoptimesForDate, nil
+}
+
+// fixtureDelaysApplied returns true if stopTimes has each stop of the fixture trip with the stops after the middle stop
+// delayed by fixtureDelaySeconds from the realtime feed
+func fixtureDelaysApplied(stopTimes []otpStopTime) bool {
+	if len(stopTimes) != fixtureStopCount {
+		return false
+	}
+	for i := fixtureStopCount / 2; i < fixtureStopCount; i++ {
+		stopTime := stopTimes[i]
+		if stopTime.Stop.GtfsId != fmt.Sprintf("%s:stop-%d", otpFeedId, i+1) || !stopTime.Realtime ||
+			stopTime.ArrivalDelay != fixtureDelaySeconds {
+			return false
+		}
+	}
+	return true
+}
+
+// validateServedFeed checks the TripUpdates feed served on feedPort against GTFS-realtime best practices
+func validateServedFeed(t *testing.T, feedPort int) {
+	var output bytes.Buffer
+	errors, err := tripupdate.ValidateFeed(&output, fmt.Sprintf("http://localhost:%d/tripUpdate", feedPort),
+		tripupdate.ValidateConf{MaxFeedAgeSeconds: 60, MaxDelaySeconds: 3600, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatalf("unable to validate TripUpdates feed: %v", err)
+	}
+	if errors > 0 {
+		t.Errorf("TripUpdates feed has %d validation errors:\n%s", errors, output.String())
+	}
+}
@@ -0,0 +1,165 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"github.com/OpenTransitTools/transitcast/app/gtfs-loader/gtfsmanager"
+	"github.com/OpenTransitTools/transitcast/app/gtfs-monitor/monitor"
+	"github.com/OpenTransitTools/transitcast/business/data/gtfs"
+	"github.com/OpenTransitTools/transitcast/foundation/clock"
+	"github.com/OpenTransitTools/transitcast/foundation/health"
+	"github.com/OpenTransitTools/transitcast/foundation/natsclient"
+	"github.com/OpenTransitTools/transitcast/pkg/predictor"
+	"github.com/nats-io/nats.go"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// predictionSubject is the NATS subject the aggregator publishes TripUpdates on
+const predictionSubject = "trip-update-prediction"
+
+// pipelineTimeout is how long the monitor and aggregator have to publish a prediction for the fixture trip
+const pipelineTimeout = 90 * time.Second
+
+// Test_pipeline loads a single trip schedule with gtfs-loader, replays the trip's vehicle positions through
+// gtfs-monitor and expects gtfs-aggregator to publish a TripUpdate predicting the stops the vehicle hasn't reached
+func Test_pipeline(t *testing.T) {
+	logger := log.New(os.Stdout, "INTEGRATION : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile)
+	ctx := context.Background()
+	fixture := makeFixtureSchedule(t, time.Now())
+
+	db := startPostgres(t)
+	natsConn := startNats(t)
+
+	err := gtfsmanager.CreatePartitions(ctx, logger, db, time.Now(), gtfs.MonthlyPartition, 2)
+	if err != nil {
+		t.Fatalf("unable to create partitions: %v", err)
+	}
+	gtfsURL := serveGTFS(t, fixture.gtfsZip(t)) + "/gtfs.zip"
+	_, err = gtfsmanager.UpdateGTFSSchedule(ctx, logger, db, t.TempDir(), gtfsURL, true, false,
+		gtfsmanager.StopTimeLoadConf{}, gtfsmanager.ConflictFail, nil)
+	if err != nil {
+		t.Fatalf("unable to load gtfs schedule: %v", err)
+	}
+
+	tripUpdates := make(chan gtfs.TripUpdate, 100)
+	subscription, err := natsConn.Subscribe(predictionSubject, func(msg *nats.Msg) {
+		var tripUpdate gtfs.TripUpdate
+		if err := natsclient.Unmarshal(msg.Data, &tripUpdate); err != nil {
+			t.Errorf("unable to unmarshal TripUpdate: %v", err)
+			return
+		}
+		tripUpdates <- tripUpdate
+	})
+	if err != nil {
+		t.Fatalf("unable to subscribe to %s: %v", predictionSubject, err)
+	}
+	defer func() {
+		_ = subscription.Unsubscribe()
+	}()
+
+	// messages between the apps are compressed protobuf to check those payloads flow through the pipeline
+	natsCodec, err := natsclient.NewCodec(natsclient.CompressionGzip, natsclient.EncodingProtobuf)
+	if err != nil {
+		t.Fatalf("unable to create NATS codec: %v", err)
+	}
+
+	positions := fixture.positions()
+	positionURL := serveVehiclePositions(t, positions)
+	monitorShutdown := make(chan os.Signal, 1)
+	aggregatorShutdown := make(chan os.Signal, 1)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		err := monitor.RunVehicleMonitorLoop(logger, db, natsConn, monitor.Conf{
+			NatsCodec:              natsCodec,
+			PositionSource:         monitor.PositionSourceConf{Type: "http", URL: positionURL},
+			LoopEverySeconds:       1,
+			MaxFetchBackoffSeconds: 5,
+			EarlyTolerance:         0.1,
+			ExpirePositionSeconds:  3600,
+			MinimumMovementMeters:  5,
+			DistanceMedianWindow:   1,
+			Interpolation:          "schedule",
+			RecordToDatabase:       true,
+			PublishOverNats:        true,
+			TripCacheSize:          100,
+			QueryTimeoutSeconds:    30,
+			PositionWorkers:        1,
+			PositionPolls:          health.NewHeartbeat(time.Now()),
+			Clock:                  clock.System{},
+		}, monitorShutdown)
+		if err != nil {
+			t.Errorf("vehicle monitor failed: %v", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		err := predictor.StartPredictionAggregator(logger, db, aggregatorShutdown, natsConn, predictor.Conf{
+			ExpirePredictionSeconds:               8,
+			MaximumObservedTransitionAgeInSeconds: 3600,
+			MinimumObservedStopCount:              100,
+			PredictionSubject:                     predictionSubject,
+			ExpirePredictorSeconds:                3600,
+			LimitEarlyDepartureSeconds:            60,
+			InferenceBuckets:                      8,
+			MaximumPredictionMinutes:              60,
+			MakePredictions:                       true,
+			UseStatistics:                         true,
+			QueryTimeoutSeconds:                   30,
+			InferenceTransport:                    predictor.InferenceTransportNats,
+			RecentObservationCount:                5,
+			PredictionSourceStatsSubject:          "prediction-source-stats",
+			PredictionSourceStatsSeconds:          60,
+			NATSCompression:                       natsclient.CompressionGzip,
+			NATSEncoding:                          natsclient.EncodingProtobuf,
+		})
+		if err != nil {
+			t.Errorf("prediction aggregator failed: %v", err)
+		}
+	}()
+	defer func() {
+		monitorShutdown <- os.Interrupt
+		aggregatorShutdown <- os.Interrupt
+		wg.Wait()
+	}()
+
+	lastStopSequence := positions[len(positions)-1].stopSequence
+	timeout := time.After(pipelineTimeout)
+	for {
+		select {
+		case tripUpdate := <-tripUpdates:
+			if tripUpdate.TripId != fixtureTripId {
+				t.Errorf("TripUpdate published for unexpected trip %s", tripUpdate.TripId)
+				continue
+			}
+			if len(tripUpdate.StopTimeUpdates) == 0 ||
+				tripUpdate.StopTimeUpdates[len(tripUpdate.StopTimeUpdates)-1].StopSequence != fixtureStopCount {
+				continue
+			}
+			if tripUpdate.SchemaVersion != gtfs.MessageSchemaVersion {
+				t.Errorf("TripUpdate SchemaVersion = %d, want %d", tripUpdate.SchemaVersion, gtfs.MessageSchemaVersion)
+			}
+			if tripUpdate.VehicleId != fixtureVehicleId {
+				t.Errorf("TripUpdate VehicleId = %s, want %s", tripUpdate.VehicleId, fixtureVehicleId)
+			}
+			for _, update := range tripUpdate.StopTimeUpdates {
+				if update.StopSequence < lastStopSequence {
+					t.Errorf("TripUpdate predicts stop_sequence %d the vehicle has already passed", update.StopSequence)
+				}
+				if update.PredictedArrivalTime.Before(update.ScheduledArrivalTime.Add(-time.Minute)) {
+					t.Errorf("TripUpdate predicts stop_sequence %d at %v, well before its schedule %v",
+						update.StopSequence, update.PredictedArrivalTime, update.ScheduledArrivalTime)
+				}
+			}
+			return
+		case <-timeout:
+			t.Fatalf("no TripUpdate predicting the end of %s published within %v", fixtureTripId, pipelineTimeout)
+		}
+	}
+}